@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultOSVURL = "https://api.osv.dev"
+	// maxAdvisories bounds the vulnerability records fetched for one failure
+	maxAdvisories = 10
+)
+
+var (
+	advisoryIDPattern = regexp.MustCompile(`\b(GHSA(?:-[0-9a-z]{4}){3}|CVE-\d{4}-\d{4,}|GO-\d{4}-\d{4,}|PYSEC-\d{4}-\d+|RUSTSEC-\d{4}-\d{4})\b`)
+	// packageAtVersionPattern matches name@version, as npm and govulncheck print packages
+	packageAtVersionPattern = regexp.MustCompile(`(@?[A-Za-z0-9][\w.-]*(?:/[\w.-]+)*)@(v?\d+\.\d+\.\d+[\w.+-]*)`)
+	tableVersionPattern     = regexp.MustCompile(`^v?\d+\.\d+`)
+)
+
+// Advisory is a known vulnerability in a package the failure reports
+type Advisory struct {
+	ID               string        `json:"id"`
+	Aliases          []string      `json:"aliases,omitempty"`
+	Package          string        `json:"package"`
+	Ecosystem        string        `json:"ecosystem"`
+	Severity         SeverityLevel `json:"severity,omitempty"`
+	Summary          string        `json:"summary,omitempty"`
+	InstalledVersion string        `json:"installed_version,omitempty"`
+	FixedVersion     string        `json:"fixed_version,omitempty"` // empty when no fix is published
+	URL              string        `json:"url"`
+}
+
+// OSVClient looks up vulnerabilities in the OSV.dev database
+type OSVClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewOSVClient creates a client for the OSV API at baseURL, e.g. https://api.osv.dev
+func NewOSVClient(baseURL string) *OSVClient {
+	return &OSVClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: registryTimeout},
+	}
+}
+
+type osvQuery struct {
+	Package osvPackage `json:"package"`
+	Version string     `json:"version"`
+}
+
+type osvPackage struct {
+	Name      string `json:"name"`
+	Ecosystem string `json:"ecosystem"`
+}
+
+// osvVulnerability is the part of an OSV record advisories are built from
+type osvVulnerability struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Summary  string   `json:"summary"`
+	Affected []struct {
+		Package osvPackage `json:"package"`
+		Ranges  []struct {
+			Type   string `json:"type"`
+			Events []struct {
+				Fixed string `json:"fixed"`
+			} `json:"events"`
+		} `json:"ranges"`
+		DatabaseSpecific struct {
+			Severity string `json:"severity"`
+		} `json:"database_specific"`
+	} `json:"affected"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// queryBatch returns the IDs of the vulnerabilities affecting each queried package version
+func (c *OSVClient) queryBatch(ctx context.Context, queries []osvQuery) ([][]string, error) {
+	body, err := json.Marshal(map[string]interface{}{"queries": queries})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode OSV query: %w", err)
+	}
+
+	var response struct {
+		Results []struct {
+			Vulns []struct {
+				ID string `json:"id"`
+			} `json:"vulns"`
+		} `json:"results"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/v1/querybatch", body, &response); err != nil {
+		return nil, err
+	}
+	ids := make([][]string, len(response.Results))
+	for i, result := range response.Results {
+		for _, vuln := range result.Vulns {
+			ids[i] = append(ids[i], vuln.ID)
+		}
+	}
+	return ids, nil
+}
+
+// vulnerability fetches the OSV record of a vulnerability by ID or alias
+func (c *OSVClient) vulnerability(ctx context.Context, id string) (*osvVulnerability, error) {
+	var vuln osvVulnerability
+	if err := c.do(ctx, http.MethodGet, "/v1/vulns/"+url.PathEscape(id), nil, &vuln); err != nil {
+		return nil, err
+	}
+	return &vuln, nil
+}
+
+func (c *OSVClient) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create OSV request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", registryUserAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("OSV request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read OSV response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("OSV %s returned %s", path, resp.Status)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse OSV response: %w", err)
+	}
+	return nil
+}
+
+// advisoryReferences are the advisory IDs and package versions named in error lines
+type advisoryReferences struct {
+	ids      []string
+	packages []string          // in order of appearance
+	versions map[string]string // installed version by package
+}
+
+// extractAdvisoryReferences finds advisory IDs, and the packages and versions reported
+// with them, in the output of scanners such as npm audit, trivy and govulncheck
+func extractAdvisoryReferences(lines []string) advisoryReferences {
+	refs := advisoryReferences{versions: make(map[string]string)}
+	addPackage := func(name, version string) {
+		if _, seen := refs.versions[name]; !seen {
+			refs.packages = append(refs.packages, name)
+			refs.versions[name] = version
+		}
+	}
+
+	for _, line := range lines {
+		ids := advisoryIDPattern.FindAllString(line, -1)
+		refs.ids = appendMissing(refs.ids, ids...)
+
+		// Table rows (trivy): package, advisory, severity, ..., installed version, fixed version
+		if cells := strings.FieldsFunc(line, func(r rune) bool { return r == '│' || r == '|' }); len(ids) > 0 && len(cells) >= 3 {
+			name := strings.TrimSpace(cells[0])
+			for _, cell := range cells[1:] {
+				if cell = strings.TrimSpace(cell); name != "" && !advisoryIDPattern.MatchString(name) && tableVersionPattern.MatchString(cell) {
+					addPackage(name, cell)
+					break
+				}
+			}
+			continue
+		}
+		if strings.Contains(strings.ToLower(line), "fixed in") {
+			continue
+		}
+		for _, match := range packageAtVersionPattern.FindAllStringSubmatch(line, -1) {
+			addPackage(match[1], match[2])
+		}
+	}
+	return refs
+}
+
+// osvEcosystem maps a GitHub repository language to the OSV ecosystem of its packages
+func osvEcosystem(language string) string {
+	switch strings.ToLower(language) {
+	case "javascript", "typescript":
+		return "npm"
+	case "go":
+		return "Go"
+	case "python":
+		return "PyPI"
+	case "rust":
+		return "crates.io"
+	}
+	return ""
+}
+
+// osvSeverity maps a GitHub advisory severity to a severity level
+func osvSeverity(severity string) SeverityLevel {
+	level, err := ParseSeverity(severity)
+	if err != nil || level == UnknownSeverity {
+		return ""
+	}
+	return level
+}
+
+// lookupAdvisories looks up the advisories a security failure names, and those affecting
+// the package versions it reports, in OSV
+func (c *OSVClient) lookupAdvisories(ctx context.Context, fc FailureContext) ([]Advisory, error) {
+	var lines []string
+	if fc.Logs != nil {
+		lines = fc.Logs.ErrorLines
+	}
+	refs := extractAdvisoryReferences(lines)
+	ids := refs.ids
+
+	if ecosystem := osvEcosystem(fc.Repository.Language); ecosystem != "" && len(refs.packages) > 0 {
+		queries := make([]osvQuery, 0, len(refs.packages))
+		for _, name := range refs.packages {
+			queries = append(queries, osvQuery{Package: osvPackage{Name: name, Ecosystem: ecosystem}, Version: strings.TrimPrefix(refs.versions[name], "v")})
+		}
+		results, err := c.queryBatch(ctx, queries)
+		if err != nil {
+			return nil, err
+		}
+		for _, found := range results {
+			ids = appendMissing(ids, found...)
+		}
+	}
+
+	var advisories []Advisory
+	var seen []string
+	for _, id := range ids {
+		if len(advisories) == maxAdvisories {
+			break
+		}
+		if containsString(seen, id) {
+			continue
+		}
+		vuln, err := c.vulnerability(ctx, id)
+		if err != nil {
+			return advisories, fmt.Errorf("failed to look up %s: %w", id, err)
+		}
+		// A CVE named in the logs resolves to the same record as its GHSA
+		seen = append(append(seen, vuln.ID), vuln.Aliases...)
+		advisories = append(advisories, advisoryFromVulnerability(vuln, refs.versions))
+	}
+	return advisories, nil
+}
+
+// advisoryFromVulnerability describes a vulnerability for the package it affects that the
+// logs report, or its first affected package. The fixed version is the lowest one above
+// the installed version, or the highest one when the installed version is unknown.
+func advisoryFromVulnerability(vuln *osvVulnerability, installed map[string]string) Advisory {
+	advisory := Advisory{
+		ID:       vuln.ID,
+		Aliases:  vuln.Aliases,
+		Summary:  vuln.Summary,
+		Severity: osvSeverity(vuln.DatabaseSpecific.Severity),
+		URL:      "https://osv.dev/vulnerability/" + vuln.ID,
+	}
+	if len(vuln.Affected) == 0 {
+		return advisory
+	}
+
+	affected := vuln.Affected[0]
+	for _, candidate := range vuln.Affected {
+		if _, ok := installed[candidate.Package.Name]; ok {
+			affected = candidate
+			break
+		}
+	}
+	advisory.Package = affected.Package.Name
+	advisory.Ecosystem = affected.Package.Ecosystem
+	advisory.InstalledVersion = installed[affected.Package.Name]
+	if severity := osvSeverity(affected.DatabaseSpecific.Severity); severity != "" {
+		advisory.Severity = severity
+	}
+
+	current, hasCurrent := parsePackageVersion(advisory.InstalledVersion)
+	var fixed packageVersion
+	for _, r := range affected.Ranges {
+		if r.Type == "GIT" {
+			continue
+		}
+		for _, event := range r.Events {
+			v, ok := parsePackageVersion(event.Fixed)
+			if !ok || (hasCurrent && v.compare(current) <= 0) {
+				continue
+			}
+			if advisory.FixedVersion == "" || (hasCurrent && v.compare(fixed) < 0) || (!hasCurrent && v.compare(fixed) > 0) {
+				advisory.FixedVersion, fixed = event.Fixed, v
+			}
+		}
+	}
+	return advisory
+}
+
+// enrichWithAdvisories attaches the advisories of a security failure to its analysis.
+// Lookup failures are logged; the analysis is used without advisories then.
+func (e *FailureAnalysisEngine) enrichWithAdvisories(ctx context.Context, analysis *FailureAnalysisResult) {
+	if e.osv == nil || analysis.Classification.Type != SecurityFailure {
+		return
+	}
+	advisories, err := e.osv.lookupAdvisories(ctx, analysis.Context)
+	if err != nil {
+		e.logger.WithError(err).Warn("Failed to look up security advisories")
+	}
+	if len(advisories) == 0 {
+		return
+	}
+	analysis.Advisories = advisories
+
+	ids := make([]string, 0, len(advisories))
+	for _, advisory := range advisories {
+		ids = append(ids, advisory.ID)
+	}
+	e.logger.WithFields(logrus.Fields{
+		"analysis_id": analysis.ID,
+		"advisories":  ids,
+	}).Info("Attached security advisories to analysis")
+}
+
+func containsAdvisory(advisories []Advisory, id string) bool {
+	for _, advisory := range advisories {
+		if advisory.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCriticalAdvisory reports whether any advisory is of critical severity
+func hasCriticalAdvisory(advisories []Advisory) bool {
+	for _, advisory := range advisories {
+		if advisory.Severity == Critical {
+			return true
+		}
+	}
+	return false
+}
+
+// writeAdvisoriesPrompt lists the advisories for the fix generation prompt
+func writeAdvisoriesPrompt(prompt *strings.Builder, advisories []Advisory) {
+	prompt.WriteString("## Security Advisories\n\n")
+	prompt.WriteString("The failure reports these known vulnerabilities. Bump each affected package to exactly ")
+	prompt.WriteString("its fixed version instead of proposing generic dependency updates.\n\n")
+	for _, advisory := range advisories {
+		line := fmt.Sprintf("- **%s**", advisory.ID)
+		if len(advisory.Aliases) > 0 {
+			line += fmt.Sprintf(" (%s)", strings.Join(advisory.Aliases, ", "))
+		}
+		line += fmt.Sprintf(" in %s (%s), severity %s", valueOr(advisory.Package, notAvailable), valueOr(advisory.Ecosystem, notAvailable), valueOr(string(advisory.Severity), "unknown"))
+		if advisory.Summary != "" {
+			line += ": " + advisory.Summary
+		}
+		if advisory.InstalledVersion != "" {
+			line += fmt.Sprintf(". Installed: %s", advisory.InstalledVersion)
+		}
+		if advisory.FixedVersion != "" {
+			line += fmt.Sprintf(". Fixed version: **%s**", advisory.FixedVersion)
+		} else {
+			line += ". No fixed version is published"
+		}
+		prompt.WriteString(line + "\n")
+	}
+	prompt.WriteString("\n")
+}
+
+// writeAdvisoriesTable adds the advisories table of a security fix PR
+func writeAdvisoriesTable(body *strings.Builder, advisories []Advisory) {
+	body.WriteString("## 🛡️ Security Advisories\n\n")
+	body.WriteString("| Advisory | Package | Severity | Fixed Version |\n")
+	body.WriteString("| --- | --- | --- | --- |\n")
+	for _, advisory := range advisories {
+		body.WriteString(fmt.Sprintf("| [%s](%s) | %s | %s | %s |\n",
+			advisory.ID, advisory.URL, codeOr(advisory.Package), valueOr(string(advisory.Severity), notAvailable), valueOr(advisory.FixedVersion, notAvailable)))
+	}
+	body.WriteString("\n")
+}
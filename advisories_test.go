@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const lodashVulnerability = `{
+	"id": "GHSA-jf85-cpcp-j695",
+	"aliases": ["CVE-2019-10744"],
+	"summary": "Prototype Pollution in lodash",
+	"affected": [{
+		"package": {"name": "lodash", "ecosystem": "npm"},
+		"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "4.17.12"}]}]
+	}],
+	"database_specific": {"severity": "CRITICAL"}
+}`
+
+// osvServer stubs the OSV API with vulnerability records by ID, and answers batch queries
+// with the records affecting each queried package
+func osvServer(t *testing.T, vulns map[string]string, affecting map[string][]string) (*httptest.Server, *[]osvQuery) {
+	var queried []osvQuery
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && r.URL.Path == "/v1/querybatch" {
+			var batch struct {
+				Queries []osvQuery `json:"queries"`
+			}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&batch))
+			queried = append(queried, batch.Queries...)
+			results := make([]map[string]interface{}, 0, len(batch.Queries))
+			for _, query := range batch.Queries {
+				var found []map[string]string
+				for _, id := range affecting[query.Package.Name+"@"+query.Version] {
+					found = append(found, map[string]string{"id": id})
+				}
+				results = append(results, map[string]interface{}{"vulns": found})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+			return
+		}
+		body, ok := vulns[r.URL.Path[len("/v1/vulns/"):]]
+		if r.Method != http.MethodGet || !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &queried
+}
+
+// TestExtractAdvisoryReferences tests finding advisories and package versions in scanner output
+func TestExtractAdvisoryReferences(t *testing.T) {
+	refs := extractAdvisoryReferences([]string{
+		"lodash  <4.17.12",
+		"Prototype Pollution in lodash - https://github.com/advisories/GHSA-jf85-cpcp-j695",
+		"│ minimist │ CVE-2021-44906 │ CRITICAL │ fixed  │ 1.2.5             │ 1.2.6         │ prototype pollution │",
+		"Found in: golang.org/x/net@v0.7.0",
+		"Fixed in: golang.org/x/net@v0.17.0",
+		"GHSA-jf85-cpcp-j695 again",
+	})
+	assert.Equal(t, []string{"GHSA-jf85-cpcp-j695", "CVE-2021-44906"}, refs.ids)
+	assert.Equal(t, []string{"minimist", "golang.org/x/net"}, refs.packages)
+	assert.Equal(t, map[string]string{"minimist": "1.2.5", "golang.org/x/net": "v0.7.0"}, refs.versions)
+}
+
+// TestAdvisoryFromVulnerability tests choosing the fixed version of an advisory
+func TestAdvisoryFromVulnerability(t *testing.T) {
+	var vuln osvVulnerability
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"id": "GO-2023-2102",
+		"aliases": ["CVE-2023-39325", "GHSA-4374-p667-p6c8"],
+		"affected": [
+			{"package": {"name": "stdlib", "ecosystem": "Go"},
+			 "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.20.10"}]}]},
+			{"package": {"name": "golang.org/x/net", "ecosystem": "Go"},
+			 "ranges": [
+				{"type": "GIT", "events": [{"fixed": "b225e7ca6dde"}]},
+				{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "0.17.0"}]}
+			 ],
+			 "database_specific": {"severity": "HIGH"}}
+		]
+	}`), &vuln))
+
+	advisory := advisoryFromVulnerability(&vuln, map[string]string{"golang.org/x/net": "v0.7.0"})
+	assert.Equal(t, Advisory{
+		ID:               "GO-2023-2102",
+		Aliases:          []string{"CVE-2023-39325", "GHSA-4374-p667-p6c8"},
+		Package:          "golang.org/x/net",
+		Ecosystem:        "Go",
+		Severity:         High,
+		InstalledVersion: "v0.7.0",
+		FixedVersion:     "0.17.0",
+		URL:              "https://osv.dev/vulnerability/GO-2023-2102",
+	}, advisory)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"id": "GHSA-x", "affected": [{"package": {"name": "pkg", "ecosystem": "npm"},
+		"ranges": [{"type": "SEMVER", "events": [{"introduced": "1.0.0"}, {"fixed": "1.4.2"}, {"introduced": "2.0.0"}, {"fixed": "2.1.3"}]}]}]}`), &vuln))
+	assert.Equal(t, "1.4.2", advisoryFromVulnerability(&vuln, map[string]string{"pkg": "1.3.0"}).FixedVersion)
+	assert.Equal(t, "2.1.3", advisoryFromVulnerability(&vuln, map[string]string{"pkg": "2.0.1"}).FixedVersion)
+	assert.Equal(t, "2.1.3", advisoryFromVulnerability(&vuln, nil).FixedVersion, "the highest fix covers every range")
+}
+
+// TestSecurityAdvisoryPinsFixedVersion tests that a GHSA in the logs of a security failure
+// is looked up in OSV and ends up as a bump to its fixed version
+func TestSecurityAdvisoryPinsFixedVersion(t *testing.T) {
+	server, queried := osvServer(t,
+		map[string]string{"GHSA-jf85-cpcp-j695": lodashVulnerability},
+		map[string][]string{"lodash@4.17.11": {"GHSA-jf85-cpcp-j695"}})
+
+	llm := &mockLLMClient{response: &LLMResponse{Content: `{"root_cause": "npm audit found a critical vulnerability in lodash",
+		"classification": {"type": "security", "severity": "high", "confidence": 0.9}}`}}
+	engine := &FailureAnalysisEngine{
+		llmClient: llm,
+		logger:    quietLogger(),
+		patterns:  loadErrorPatterns(),
+		prompts:   loadPromptTemplates(),
+	}
+	engine.SetOSVClient(NewOSVClient(server.URL))
+
+	ctx := context.Background()
+	analysis, err := engine.AnalyzeFailure(ctx, FailureContext{
+		WorkflowRun: &WorkflowRun{ID: 7},
+		Repository:  RepositoryContext{Owner: "acme", Name: "web", Language: "JavaScript"},
+		Logs: &WorkflowLogs{ErrorLines: []string{
+			"web@1.0.0 /app",
+			"└── lodash@4.17.11",
+			"lodash  <4.17.12",
+			"Severity: critical",
+			"Prototype Pollution in lodash - https://github.com/advisories/GHSA-jf85-cpcp-j695",
+			"1 critical severity vulnerability",
+		}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []osvQuery{
+		{Package: osvPackage{Name: "web", Ecosystem: "npm"}, Version: "1.0.0"},
+		{Package: osvPackage{Name: "lodash", Ecosystem: "npm"}, Version: "4.17.11"},
+	}, *queried)
+	assert.Equal(t, []Advisory{{
+		ID:               "GHSA-jf85-cpcp-j695",
+		Aliases:          []string{"CVE-2019-10744"},
+		Package:          "lodash",
+		Ecosystem:        "npm",
+		Severity:         Critical,
+		Summary:          "Prototype Pollution in lodash",
+		InstalledVersion: "4.17.11",
+		FixedVersion:     "4.17.12",
+		URL:              "https://osv.dev/vulnerability/GHSA-jf85-cpcp-j695",
+	}}, analysis.Advisories)
+
+	llm.response = &LLMResponse{Content: `[]`}
+	_, err = engine.GenerateFixes(ctx, analysis)
+	require.NoError(t, err)
+	prompt := llm.requests[len(llm.requests)-1].Prompt
+	assert.Contains(t, prompt, "## Security Advisories")
+	assert.Contains(t, prompt, "- **GHSA-jf85-cpcp-j695** (CVE-2019-10744) in lodash (npm), severity critical: Prototype Pollution in lodash. Installed: 4.17.11. Fixed version: **4.17.12**")
+
+	manifest := "{\n  \"name\": \"web\",\n  \"dependencies\": {\n    \"lodash\": \"^4.17.11\"\n  }\n}\n"
+	resolver, mock := testResolver(registryServer(t, nil), map[string]string{"package.json": manifest, "package-lock.json": "{}"})
+	lockCommand := "npm install --package-lock-only --ignore-scripts"
+	mock.CommandOutputs[lockCommand] = MockCommandResult{Writes: map[string]string{"package-lock.json": `{"packages": {"node_modules/lodash": {"version": "4.17.12"}}}`}}
+
+	fix, err := resolver.ResolveDependencyFix(ctx, &dagger.Directory{}, analysis)
+	require.NoError(t, err)
+	require.NotNil(t, fix)
+	assert.Equal(t, SecurityFix, fix.Type)
+	assert.Equal(t, "Bump lodash to 4.17.12 in package.json to fix GHSA-jf85-cpcp-j695", fix.Description)
+	require.Len(t, fix.Changes, 2)
+	assert.Equal(t, "{\n  \"name\": \"web\",\n  \"dependencies\": {\n    \"lodash\": \"^4.17.12\"\n  }\n}\n", fix.Changes[0].NewContent)
+	assert.Equal(t, "package-lock.json", fix.Changes[1].FilePath)
+
+	prEngine := &PullRequestEngine{}
+	body := prEngine.generatePRBody(analysis, &FixValidationResult{Fix: fix})
+	assert.Contains(t, body, "## 🛡️ Security Advisories")
+	assert.Contains(t, body, "| [GHSA-jf85-cpcp-j695](https://osv.dev/vulnerability/GHSA-jf85-cpcp-j695) | `lodash` | critical | 4.17.12 |")
+
+	labels := prEngine.generatePRLabels(analysis, fix)
+	assert.Contains(t, labels, "security")
+	assert.Contains(t, labels, "priority-critical")
+	assert.NotContains(t, labels, "priority-high", "critical advisories replace the failure severity")
+}
+
+// TestAdvisoryLookupFailure tests that an unavailable OSV API leaves the analysis intact
+func TestAdvisoryLookupFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	engine := &FailureAnalysisEngine{
+		llmClient: &mockLLMClient{response: &LLMResponse{Content: `{"root_cause": "trivy failed", "classification": {"type": "security", "confidence": 0.9}}`}},
+		logger:    quietLogger(),
+		patterns:  loadErrorPatterns(),
+		prompts:   loadPromptTemplates(),
+	}
+	engine.SetOSVClient(NewOSVClient(server.URL))
+
+	analysis, err := engine.AnalyzeFailure(context.Background(), FailureContext{
+		WorkflowRun: &WorkflowRun{ID: 8},
+		Logs:        &WorkflowLogs{ErrorLines: []string{"│ minimist │ CVE-2021-44906 │ CRITICAL │ fixed │ 1.2.5 │ 1.2.6 │"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, SecurityFailure, analysis.Classification.Type)
+	assert.Empty(t, analysis.Advisories)
+	assert.NotContains(t, (&PullRequestEngine{}).generatePRLabels(analysis, nil), "security")
+}
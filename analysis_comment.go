@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// postAnalysisComment comments the failure analysis on the failing commit when AutoFix
+// cannot produce a fix. It is opt-in and posts at most once per workflow run.
+func (m *DaggerAutofix) postAnalysisComment(ctx context.Context, runID int64, analysis *FailureAnalysisResult, reason string) {
+	if !m.AnalysisComments {
+		return
+	}
+	m.commentAnalysis(ctx, runID, analysis, reason)
+}
+
+// commentAnalysis posts the analysis comment at most once per workflow run
+func (m *DaggerAutofix) commentAnalysis(ctx context.Context, runID int64, analysis *FailureAnalysisResult, reason string) {
+	if analysis == nil {
+		return
+	}
+
+	run := analysis.Context.WorkflowRun
+	if run == nil || run.CommitSHA == "" {
+		m.logger.WithField("run_id", runID).Warn("Skipping analysis comment, commit SHA unknown")
+		return
+	}
+
+	m.commentMu.Lock()
+	if m.commentedRuns[runID] {
+		m.commentMu.Unlock()
+		return
+	}
+	if m.commentedRuns == nil {
+		m.commentedRuns = make(map[int64]bool)
+	}
+	m.commentedRuns[runID] = true
+	m.commentMu.Unlock()
+
+	if err := m.githubClient.CreateCommitComment(ctx, run.CommitSHA, formatAnalysisComment(analysis, reason)); err != nil {
+		// Allow a later attempt to post the comment
+		m.commentMu.Lock()
+		delete(m.commentedRuns, runID)
+		m.commentMu.Unlock()
+
+		m.logger.WithError(err).WithField("run_id", runID).Warn("Failed to post analysis comment")
+		return
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"run_id":     runID,
+		"commit_sha": run.CommitSHA,
+	}).Info("Posted failure analysis comment")
+}
+
+// formatAnalysisComment renders a failure analysis for humans when no automated fix is available
+func formatAnalysisComment(analysis *FailureAnalysisResult, reason string) string {
+	var body strings.Builder
+
+	body.WriteString("## 🤖 Automated Failure Analysis\n\n")
+	body.WriteString(fmt.Sprintf("%s, so no fix pull request was opened. Here is what the analysis found.\n\n", reason))
+
+	writeFailureSummary(&body, analysis)
+
+	if len(analysis.ErrorPatterns) > 0 {
+		body.WriteString("## 🔎 Error Patterns\n\n")
+		for _, pattern := range analysis.ErrorPatterns {
+			if pattern.Location != "" {
+				body.WriteString(fmt.Sprintf("- `%s` at %s", pattern.Pattern, pattern.Location))
+			} else {
+				body.WriteString(fmt.Sprintf("- `%s`", pattern.Pattern))
+			}
+			if pattern.Description != "" {
+				body.WriteString(fmt.Sprintf(": %s", pattern.Description))
+			}
+			body.WriteString("\n")
+		}
+		body.WriteString("\n")
+	}
+
+	if len(analysis.AffectedFiles) > 0 {
+		body.WriteString("## 📝 Affected Files\n\n")
+		for _, file := range analysis.AffectedFiles {
+			body.WriteString(fmt.Sprintf("- `%s`\n", file))
+		}
+		body.WriteString("\n")
+	}
+
+	if steps := suggestedManualSteps(analysis); len(steps) > 0 {
+		body.WriteString("## 🛠️ Suggested Manual Steps\n\n")
+		for _, step := range steps {
+			body.WriteString(fmt.Sprintf("- %s\n", step))
+		}
+		body.WriteString("\n")
+	}
+
+	body.WriteString("## 🔍 Metadata\n\n")
+	body.WriteString(fmt.Sprintf("**Analysis ID**: `%s`\n", analysis.ID))
+	body.WriteString(fmt.Sprintf("**LLM Provider**: %s\n\n", analysis.LLMProvider))
+
+	body.WriteString("---\n")
+	body.WriteString("*This comment was automatically generated by the GitHub Actions Auto-Fix Agent*\n")
+
+	return body.String()
+}
+
+// suggestedManualSteps collects the solutions of known error patterns found in the failure logs
+func suggestedManualSteps(analysis *FailureAnalysisResult) []string {
+	logs := analysis.Context.Logs
+	if logs == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var steps []string
+	for _, match := range builtinErrorPatterns.matchingRules(strings.Join(logs.ErrorLines, "\n"), logs.RawLogs) {
+		for _, solution := range match.rule.Solutions {
+			if !seen[solution] {
+				seen[solution] = true
+				steps = append(steps, solution)
+			}
+		}
+	}
+	return steps
+}
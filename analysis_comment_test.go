@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type postedComment struct {
+	sha  string
+	body string
+}
+
+// noFixAutofix builds a module whose fixes never validate
+func noFixAutofix(comments *[]postedComment, generateErr error) *DaggerAutofix {
+	m := fixtureAutofix(nil)
+	gh := m.githubClient.(*mockGitHub)
+	gh.getWorkflowLogsFunc = func(ctx context.Context, runID int64) (*WorkflowLogs, error) {
+		return &WorkflowLogs{ErrorLines: []string{"dial tcp: connection timeout"}}, nil
+	}
+	gh.createCommitCommentFunc = func(ctx context.Context, sha, body string) error {
+		*comments = append(*comments, postedComment{sha, body})
+		return nil
+	}
+
+	fe := m.failureEngine.(*mockFailureAnalysisEngine)
+	fe.analyzeFunc = func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+		return &FailureAnalysisResult{
+			ID:             "analysis-1",
+			RootCause:      "Registry unreachable",
+			Classification: FailureClassification{Type: InfrastructureFailure, Confidence: 0.8},
+			Context:        fc,
+		}, nil
+	}
+	if generateErr != nil {
+		fe.generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+			return nil, generateErr
+		}
+	}
+
+	m.testEngine.(*mockTestEngine).runTestsWithChangesFunc = func(ctx context.Context, source *dagger.Directory, changes []CodeChange) (*TestResult, error) {
+		return &TestResult{Success: false}, nil
+	}
+	return m
+}
+
+// TestAutoFixAnalysisComments tests the commit comment fallback when no fix can be validated
+func TestAutoFixAnalysisComments(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		var comments []postedComment
+		m := noFixAutofix(&comments, nil)
+
+		_, err := m.AutoFix(ctx, 1)
+		assert.Error(t, err)
+		assert.Empty(t, comments)
+	})
+
+	t.Run("PostsOncePerRun", func(t *testing.T) {
+		var comments []postedComment
+		m := noFixAutofix(&comments, nil).WithAnalysisComments(true)
+
+		_, err := m.AutoFix(ctx, 1)
+		assert.Error(t, err)
+		_, err = m.AutoFix(ctx, 1)
+		assert.Error(t, err)
+
+		require.Len(t, comments, 1)
+		assert.Equal(t, "abc123", comments[0].sha)
+		assert.Contains(t, comments[0].body, "No proposed fix passed validation")
+		assert.Contains(t, comments[0].body, "Registry unreachable")
+
+		_, err = m.AutoFix(ctx, 2)
+		assert.Error(t, err)
+		assert.Len(t, comments, 2)
+	})
+
+	t.Run("FixGenerationFailure", func(t *testing.T) {
+		var comments []postedComment
+		m := noFixAutofix(&comments, errors.New("llm unavailable")).WithAnalysisComments(true)
+
+		_, err := m.AutoFix(ctx, 1)
+		assert.Error(t, err)
+		require.Len(t, comments, 1)
+		assert.Contains(t, comments[0].body, "Fix generation failed")
+	})
+
+	t.Run("NotInDryRun", func(t *testing.T) {
+		var comments []postedComment
+		failing := noFixAutofix(&comments, nil).WithAnalysisComments(true).WithDryRun(true)
+		_, err := failing.AutoFix(ctx, 1)
+		assert.Error(t, err)
+
+		generationFailed := noFixAutofix(&comments, errors.New("llm unavailable")).WithAnalysisComments(true).WithDryRun(true)
+		_, err = generationFailed.AutoFix(ctx, 2)
+		assert.Error(t, err)
+
+		unvalidated := noFixAutofix(&comments, nil).WithAnalysisComments(true).WithDryRun(true)
+		unvalidated.testEngine.(*mockTestEngine).runTestsWithChangesFunc = func(ctx context.Context, source *dagger.Directory, changes []CodeChange) (*TestResult, error) {
+			return nil, errors.New("dagger engine unavailable")
+		}
+		_, err = unvalidated.AutoFix(ctx, 3)
+		assert.ErrorIs(t, err, ErrNoValidFixes)
+
+		assert.Empty(t, comments, "dry runs post nothing")
+	})
+
+	t.Run("RetriesAfterPostFailure", func(t *testing.T) {
+		var comments []postedComment
+		m := noFixAutofix(&comments, nil).WithAnalysisComments(true)
+		gh := m.githubClient.(*mockGitHub)
+
+		attempts := 0
+		gh.createCommitCommentFunc = func(ctx context.Context, sha, body string) error {
+			attempts++
+			if attempts == 1 {
+				return errors.New("server error")
+			}
+			return nil
+		}
+
+		_, _ = m.AutoFix(ctx, 1)
+		_, _ = m.AutoFix(ctx, 1)
+		_, _ = m.AutoFix(ctx, 1)
+		assert.Equal(t, 2, attempts)
+	})
+}
+
+// TestFormatAnalysisComment verifies the comment includes the analysis and pattern solutions
+func TestFormatAnalysisComment(t *testing.T) {
+	analysis := &FailureAnalysisResult{
+		ID:        "analysis-1",
+		RootCause: "Registry unreachable",
+		Classification: FailureClassification{
+			Type:       InfrastructureFailure,
+			Severity:   High,
+			Confidence: 0.8,
+		},
+		ErrorPatterns: []ErrorPattern{{Pattern: "connection timeout", Location: "build:fetch", Description: "network"}},
+		AffectedFiles: []string{"go.mod"},
+		Context: FailureContext{
+			WorkflowRun: &WorkflowRun{ID: 42, URL: "https://github.com/o/r/actions/runs/42"},
+			Logs:        &WorkflowLogs{ErrorLines: []string{"dial tcp: connection timeout"}},
+		},
+	}
+
+	body := formatAnalysisComment(analysis, "No valid fixes were generated")
+
+	assert.Contains(t, body, "No valid fixes were generated")
+	assert.Contains(t, body, "[#42](https://github.com/o/r/actions/runs/42)")
+	assert.Contains(t, body, "**Failure Type**: infrastructure")
+	assert.Contains(t, body, "**Root Cause**: Registry unreachable")
+	assert.Contains(t, body, "- `connection timeout` at build:fetch: network")
+	assert.Contains(t, body, "- `go.mod`")
+	assert.Contains(t, body, "## 🛠️ Suggested Manual Steps")
+	assert.Contains(t, body, "- Check network connectivity")
+}
+
+// TestCreateCommitComment tests posting a commit comment through the GitHub API
+func TestCreateCommitComment(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+
+	var body map[string]string
+	mux.HandleFunc("/repos/owner/repo/commits/abc123/comments", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.NoError(t, decodeJSON(r, &body))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"id":1}`)
+	})
+
+	require.NoError(t, gh.CreateCommitComment(context.Background(), "abc123", "analysis"))
+	assert.Equal(t, "analysis", body["body"])
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/v45/github"
+)
+
+// Annotation levels GitHub reports for check run annotations
+const (
+	AnnotationFailure = "failure"
+	AnnotationWarning = "warning"
+	AnnotationNotice  = "notice"
+)
+
+// annotationsPerPage is the most annotations the check run annotations endpoint returns at once
+const annotationsPerPage = 50
+
+// maxPromptAnnotations bounds the annotations listed in the analysis prompt
+const maxPromptAnnotations = 30
+
+// Annotation is a check run annotation, the structured error, warning or notice a toolchain
+// reported for a file and line range of a job
+type Annotation struct {
+	Job       string `json:"job"` // the check run, named after its job
+	Path      string `json:"path"`
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+	Level     string `json:"level"` // failure, warning or notice
+	Title     string `json:"title,omitempty"`
+	Message   string `json:"message"`
+}
+
+// location returns the annotated path and lines, e.g. src/sum.js:3-5
+func (a Annotation) location() string {
+	switch {
+	case a.StartLine == 0:
+		return a.Path
+	case a.EndLine > a.StartLine:
+		return fmt.Sprintf("%s:%d-%d", a.Path, a.StartLine, a.EndLine)
+	default:
+		return fmt.Sprintf("%s:%d", a.Path, a.StartLine)
+	}
+}
+
+// annotatesFile reports whether an annotation points at a repository file. Actions annotates
+// failed steps with "Process completed with exit code 1" on the .github directory.
+func (a Annotation) annotatesFile() bool {
+	return a.Path != "" && path.Clean(a.Path) != ".github"
+}
+
+// GetCheckRunAnnotations returns the annotations of the check runs of a workflow run, which
+// are those of the run's check suite among the check runs for its head commit. Runs without
+// check runs have no annotations.
+func (g *GitHubIntegration) GetCheckRunAnnotations(ctx context.Context, runID int64) ([]Annotation, error) {
+	if g.client == nil {
+		return nil, errGitHubNotInitialized
+	}
+	run, err := callGitHub(ctx, g, func() (*github.WorkflowRun, *github.Response, error) {
+		return g.client.Actions.GetWorkflowRunByID(ctx, g.repoOwner, g.repoName, runID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow run: %w", err)
+	}
+	if run.GetHeadSHA() == "" {
+		return nil, nil
+	}
+
+	opts := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	var annotations []Annotation
+	for {
+		var results *github.ListCheckRunsResults
+		var resp *github.Response
+		err := g.withRateLimit(ctx, func() (*github.Response, error) {
+			var err error
+			results, resp, err = g.client.Checks.ListCheckRunsForRef(ctx, g.repoOwner, g.repoName, run.GetHeadSHA(), opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list check runs: %w", err)
+		}
+
+		for _, checkRun := range results.CheckRuns {
+			// Other workflows' check runs for the same commit belong to other check suites
+			if run.GetCheckSuiteID() != 0 && checkRun.GetCheckSuite().GetID() != run.GetCheckSuiteID() {
+				continue
+			}
+			if checkRun.GetOutput() != nil && checkRun.GetOutput().GetAnnotationsCount() == 0 {
+				continue
+			}
+			runAnnotations, err := g.listCheckRunAnnotations(ctx, checkRun)
+			if err != nil {
+				return nil, err
+			}
+			annotations = append(annotations, runAnnotations...)
+		}
+
+		if resp == nil || resp.NextPage == 0 {
+			return annotations, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// listCheckRunAnnotations returns every annotation of a check run, a page at a time
+func (g *GitHubIntegration) listCheckRunAnnotations(ctx context.Context, checkRun *github.CheckRun) ([]Annotation, error) {
+	opts := &github.ListOptions{PerPage: annotationsPerPage}
+	var annotations []Annotation
+	for {
+		var page []*github.CheckRunAnnotation
+		var resp *github.Response
+		err := g.withRateLimit(ctx, func() (*github.Response, error) {
+			var err error
+			page, resp, err = g.client.Checks.ListCheckRunAnnotations(ctx, g.repoOwner, g.repoName, checkRun.GetID(), opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list annotations of check run %s: %w", checkRun.GetName(), err)
+		}
+
+		for _, annotation := range page {
+			annotations = append(annotations, newAnnotation(checkRun.GetName(), annotation))
+		}
+
+		if resp == nil || resp.NextPage == 0 {
+			return annotations, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// newAnnotation converts an annotation of the check run of job
+func newAnnotation(job string, annotation *github.CheckRunAnnotation) Annotation {
+	return Annotation{
+		Job:       job,
+		Path:      annotation.GetPath(),
+		StartLine: annotation.GetStartLine(),
+		EndLine:   annotation.GetEndLine(),
+		Level:     annotation.GetAnnotationLevel(),
+		Title:     annotation.GetTitle(),
+		Message:   annotation.GetMessage(),
+	}
+}
+
+// annotationsByLevel returns the failure annotations followed by the warnings. Notices rarely
+// explain a failure and are left out.
+func annotationsByLevel(logs *WorkflowLogs) []Annotation {
+	if logs == nil {
+		return nil
+	}
+	var failures, warnings []Annotation
+	for _, annotation := range logs.Annotations {
+		switch annotation.Level {
+		case AnnotationFailure:
+			failures = append(failures, annotation)
+		case AnnotationWarning:
+			warnings = append(warnings, annotation)
+		}
+	}
+	return append(failures, warnings...)
+}
+
+// failureAnnotationMessages returns the messages of the failure annotations, which the error
+// patterns are matched against along with the error lines
+func failureAnnotationMessages(logs *WorkflowLogs) []string {
+	var messages []string
+	for _, annotation := range annotationsByLevel(logs) {
+		if annotation.Level == AnnotationFailure {
+			messages = append(messages, annotation.Message)
+		}
+	}
+	return messages
+}
+
+// annotatedFiles returns the files the failure and then the warning annotations point at
+func annotatedFiles(logs *WorkflowLogs) []string {
+	var files []string
+	for _, annotation := range annotationsByLevel(logs) {
+		if annotation.annotatesFile() {
+			files = appendMissing(files, path.Clean(annotation.Path))
+		}
+	}
+	return files
+}
+
+// writeAnnotationsPrompt lists the failure and warning annotations, which toolchains report
+// with exact files and lines and so explain a failure better than the logs
+func writeAnnotationsPrompt(prompt *strings.Builder, logs *WorkflowLogs) {
+	annotations := annotationsByLevel(logs)
+	if len(annotations) == 0 {
+		return
+	}
+	prompt.WriteString("**Annotations** (reported by the toolchains, more precise than the logs below):\n")
+	for i, annotation := range annotations {
+		if i == maxPromptAnnotations {
+			prompt.WriteString(fmt.Sprintf("- ... and %d more\n", len(annotations)-i))
+			break
+		}
+		message := strings.Join(strings.Fields(annotation.Message), " ")
+		if annotation.Title != "" {
+			message = annotation.Title + ": " + message
+		}
+		prompt.WriteString(fmt.Sprintf("- [%s] %s: %s\n", annotation.Level, annotation.location(), message))
+	}
+	prompt.WriteString("\n")
+}
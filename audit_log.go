@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/sirupsen/logrus"
+)
+
+// AuditAction is an action recorded in the audit log
+type AuditAction string
+
+const (
+	AuditWorkflowRunFetched AuditAction = "workflow_run_fetched"
+	AuditLogsRetrieved      AuditAction = "logs_retrieved"
+	AuditWorkflowRerun      AuditAction = "workflow_rerun"
+	AuditLLMRequest         AuditAction = "llm_request"
+	AuditFixesGenerated     AuditAction = "fixes_generated"
+	AuditBranchCreated      AuditAction = "branch_created"
+	AuditBranchDeleted      AuditAction = "branch_deleted"
+	AuditFilesModified      AuditAction = "files_modified"
+	AuditPROpened           AuditAction = "pr_opened"
+	AuditPRClosed           AuditAction = "pr_closed"
+	AuditFixVerified        AuditAction = "fix_verified"
+	AuditSARIFUploaded      AuditAction = "sarif_uploaded"
+)
+
+// AuditEntry is one line of the audit log. Details hold identifiers, hashes, sizes and
+// paths only; log contents, prompts and secrets are never written.
+type AuditEntry struct {
+	Sequence   int64                  `json:"seq"`
+	Timestamp  time.Time              `json:"timestamp"`
+	RunID      int64                  `json:"run_id"`
+	AnalysisID string                 `json:"analysis_id,omitempty"`
+	Action     AuditAction            `json:"action"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// AuditLogger appends audit entries as JSON lines. Sequence numbers keep increasing across
+// restarts that reuse the file.
+type AuditLogger struct {
+	logger *logrus.Logger
+	redact func(string) string
+
+	mu   sync.Mutex
+	file *os.File
+	seq  int64
+}
+
+// NewAuditLogger opens path for appending, creating it when needed
+func NewAuditLogger(path string, logger *logrus.Logger) (*AuditLogger, error) {
+	seq, err := lastAuditSequence(path)
+	if err != nil {
+		return nil, err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+		}
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &AuditLogger{logger: logger, redact: newSecretRedactor(), file: file, seq: seq}, nil
+}
+
+// lastAuditSequence returns the sequence of the last entry in path, 0 when there is none
+func lastAuditSequence(path string) (int64, error) {
+	entries, err := readAuditLog(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	return entries[len(entries)-1].Sequence, nil
+}
+
+// Record appends an entry. Write failures are logged, never returned, so auditing does
+// not interrupt the fix pipeline.
+func (l *AuditLogger) Record(runID int64, analysisID string, action AuditAction, details map[string]interface{}) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	entry := AuditEntry{
+		Sequence:   l.seq,
+		Timestamp:  time.Now().UTC(),
+		RunID:      runID,
+		AnalysisID: analysisID,
+		Action:     action,
+		Details:    redactAuditDetails(details, l.redact),
+	}
+	line, err := json.Marshal(entry)
+	if err == nil {
+		_, err = l.file.Write(append(line, '\n'))
+	}
+	if err != nil && l.logger != nil {
+		l.logger.WithError(err).WithField("action", action).Warn("Failed to write audit log entry")
+	}
+}
+
+// Close closes the audit log file
+func (l *AuditLogger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// redactAuditDetails masks anything that looks like a token in detail strings
+func redactAuditDetails(details map[string]interface{}, redact func(string) string) map[string]interface{} {
+	if details == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(details))
+	for key, value := range details {
+		redacted[key] = redactAuditValue(value, redact)
+	}
+	return redacted
+}
+
+func redactAuditValue(value interface{}, redact func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return redact(v)
+	case []string:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = redact(item)
+		}
+		return items
+	case map[string]interface{}:
+		return redactAuditDetails(v, redact)
+	case []map[string]interface{}:
+		items := make([]map[string]interface{}, len(v))
+		for i, item := range v {
+			items[i] = redactAuditDetails(item, redact)
+		}
+		return items
+	default:
+		return value
+	}
+}
+
+// auditHash returns the hex SHA-256 of content, recorded instead of the content itself
+func auditHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// auditChanges lists the paths and operations of changes
+func auditChanges(changes []CodeChange) []map[string]interface{} {
+	files := make([]map[string]interface{}, 0, len(changes))
+	for _, change := range changes {
+		file := map[string]interface{}{"path": change.FilePath, "operation": string(change.Operation)}
+		if change.Operation == ChangeOperationRename {
+			file["new_path"] = change.NewFilePath
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+type auditContextKey struct{}
+
+// auditRun ties audit entries recorded under a context to a workflow run, so components
+// shared between concurrent fixes record to the right run
+type auditRun struct {
+	logger *AuditLogger
+	runID  int64
+
+	mu         sync.Mutex
+	analysisID string
+}
+
+// withAuditRun returns ctx recording audit entries for runID, unless auditing is disabled
+// or ctx already records for that run
+func withAuditRun(ctx context.Context, logger *AuditLogger, runID int64) context.Context {
+	if logger == nil {
+		return ctx
+	}
+	if run, ok := ctx.Value(auditContextKey{}).(*auditRun); ok && run.runID == runID {
+		return ctx
+	}
+	return context.WithValue(ctx, auditContextKey{}, &auditRun{logger: logger, runID: runID})
+}
+
+// setAuditAnalysis attaches the analysis ID to later entries of the run in ctx
+func setAuditAnalysis(ctx context.Context, analysisID string) {
+	if run, ok := ctx.Value(auditContextKey{}).(*auditRun); ok {
+		run.mu.Lock()
+		run.analysisID = analysisID
+		run.mu.Unlock()
+	}
+}
+
+// audit records an entry for the run in ctx, if any
+func audit(ctx context.Context, action AuditAction, details map[string]interface{}) {
+	run, ok := ctx.Value(auditContextKey{}).(*auditRun)
+	if !ok {
+		return
+	}
+	run.mu.Lock()
+	analysisID := run.analysisID
+	run.mu.Unlock()
+	run.logger.Record(run.runID, analysisID, action, details)
+}
+
+// readAuditLog reads every entry of the audit log at path
+func readAuditLog(path string) ([]AuditEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid audit log entry at %s:%d: %w", path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// readAuditTrail returns the entries of one workflow run in sequence order
+func readAuditTrail(path string, runID int64) ([]AuditEntry, error) {
+	entries, err := readAuditLog(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	trail := make([]AuditEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.RunID == runID {
+			trail = append(trail, entry)
+		}
+	}
+	sort.SliceStable(trail, func(i, j int) bool { return trail[i].Sequence < trail[j].Sequence })
+	return trail, nil
+}
+
+// writeAuditTrail pretty-prints the audit trail of a run
+func writeAuditTrail(w io.Writer, runID int64, trail []AuditEntry) {
+	fmt.Fprintf(w, "\n=== Audit Trail for Run %d ===\n", runID)
+	analysisID := ""
+	for _, entry := range trail {
+		if entry.AnalysisID != "" && entry.AnalysisID != analysisID {
+			analysisID = entry.AnalysisID
+			fmt.Fprintf(w, "Analysis: %s\n", analysisID)
+		}
+		fmt.Fprintf(w, "%4d  %s  %-20s", entry.Sequence, entry.Timestamp.Format(time.RFC3339), entry.Action)
+		keys := make([]string, 0, len(entry.Details))
+		for key := range entry.Details {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, " %s=%s", key, formatAuditValue(entry.Details[key]))
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w)
+}
+
+// formatAuditValue renders a detail value on one line. Objects such as files and fixes are
+// written as their path or id followed by the other fields.
+func formatAuditValue(value interface{}) string {
+	switch v := value.(type) {
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatAuditValue(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		nameKey := ""
+		for _, key := range []string{"path", "id"} {
+			if _, ok := v[key]; ok {
+				nameKey = key
+				break
+			}
+		}
+		var name string
+		var fields []string
+		for key, field := range v {
+			if key == nameKey {
+				name = formatAuditValue(field)
+				continue
+			}
+			fields = append(fields, key+"="+formatAuditValue(field))
+		}
+		sort.Strings(fields)
+		if name == "" {
+			return "{" + strings.Join(fields, " ") + "}"
+		}
+		if len(fields) == 0 {
+			return name
+		}
+		return name + " (" + strings.Join(fields, " ") + ")"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ExportAuditLog returns a directory containing the audit log, for exporting it from a
+// Dagger pipeline
+func (m *DaggerAutofix) ExportAuditLog(ctx context.Context) (*dagger.Directory, error) {
+	if m.AuditLog == "" {
+		return nil, fmt.Errorf("no audit log configured, call WithAuditLog first")
+	}
+	if dag == nil {
+		return nil, fmt.Errorf("dagger client not available")
+	}
+	contents, err := os.ReadFile(m.AuditLog)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return dag.Directory().WithNewFile(filepath.Base(m.AuditLog), string(contents)), nil
+}
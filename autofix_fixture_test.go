@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"dagger.io/dagger"
+)
+
+// fixtureAutofix builds a module on mock engines that fixes any run end to end: the run
+// failed at commit abc123, its test failure is analyzed as "a1", and parserFix, with
+// confidence 0.9, passes the tests on the local source with 90% coverage before PR #1 is
+// opened for it. The fixes of opened PRs are recorded in prFixes when it is not nil.
+// Recorders like prFixes are guarded, as runs and their validations may run concurrently.
+//
+// Tests replace the mock functions they need; modules that do not run AutoFix are built
+// inline.
+func fixtureAutofix(prFixes *[]*FixValidationResult) *DaggerAutofix {
+	gh := &mockGitHub{
+		getWorkflowRunFunc: func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+			return &WorkflowRun{ID: runID, CommitSHA: "abc123"}, nil
+		},
+		getWorkflowLogsFunc: func(ctx context.Context, runID int64) (*WorkflowLogs, error) {
+			return &WorkflowLogs{}, nil
+		},
+	}
+
+	fe := &mockFailureAnalysisEngine{
+		analyzeFunc: func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+			return &FailureAnalysisResult{ID: "a1", Classification: FailureClassification{Type: TestFailure}, Context: fc}, nil
+		},
+		generateFixesFunc: func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+			fix := parserFix()
+			fix.Confidence = 0.9
+			return []*ProposedFix{fix}, nil
+		},
+	}
+
+	te := &mockTestEngine{
+		runTestsFunc: func(ctx context.Context, owner, repo, branch string) (*TestResult, error) {
+			return &TestResult{Success: true, Coverage: 90}, nil
+		},
+		runTestsWithChangesFunc: func(ctx context.Context, source *dagger.Directory, changes []CodeChange) (*TestResult, error) {
+			return &TestResult{Success: true, Coverage: 90}, nil
+		},
+		generateTestsFunc: func(ctx context.Context, fix *ProposedFix, analysis *FailureAnalysisResult) ([]CodeChange, error) {
+			return []CodeChange{{FilePath: "parser/parser_fix_test.go", NewContent: "package parser", Operation: ChangeOperationAdd}}, nil
+		},
+	}
+
+	var mu sync.Mutex
+	pr := &mockPullRequestEngine{
+		createWithOptionsFunc: func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error) {
+			if prFixes != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				*prFixes = append(*prFixes, fix)
+			}
+			return &PullRequest{Number: 1}, nil
+		},
+	}
+
+	// The source is the checkout of the failed commit, so fixes are validated on it
+	return &DaggerAutofix{
+		Source:        &dagger.Directory{},
+		SourceCommit:  "abc123",
+		githubClient:  gh,
+		failureEngine: fe,
+		testEngine:    te,
+		prEngine:      pr,
+		llmClient:     &LLMClient{},
+		logger:        quietLogger(),
+		MinCoverage:   80,
+	}
+}
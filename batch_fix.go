@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+// Outcomes of a fix in a batch
+const (
+	BatchFixed      = "fixed"        // the fix succeeded, usually with a pull request
+	BatchNoValidFix = "no_valid_fix" // the fix ran, but none of its proposed fixes passed validation
+	BatchError      = "error"        // the fix could not run, e.g. the analysis failed
+)
+
+// batchOutcome classifies the result of a fix in a batch
+func (r *AutoFixResult) batchOutcome() string {
+	if r.Success {
+		return BatchFixed
+	}
+	switch category, _ := r.Metadata["error_category"].(string); ErrorCategory(category) {
+	case "", ErrorCategoryNoValidFixes, ErrorCategoryCoverage:
+		return BatchNoValidFix
+	}
+	return BatchError
+}
+
+// batchRun is a failed run claimed for a batch and the agent of its repository
+type batchRun struct {
+	agent *DaggerAutofix
+	run   *WorkflowRun
+}
+
+// AutoFixAll fixes the failed runs of the monitored repositories in one go, e.g. from a
+// nightly workflow, and returns a result per run in the order they were listed. Runs are
+// filtered, clustered and deduplicated as by MonitorOnce, and fixed MaxConcurrentFixes at a
+// time, each within FixTimeout. A failed fix does not stop the others; its result metadata
+// names the error. The error reports repositories whose failed runs could not be listed.
+func (m *DaggerAutofix) AutoFixAll(ctx context.Context) ([]*AutoFixResult, error) {
+	if m.githubClient == nil {
+		return nil, ErrNotInitialized
+	}
+
+	var runs []batchRun
+	var errs []error
+	for _, agent := range m.agents() {
+		err := m.claimFailures(ctx, agent, func(run *WorkflowRun) bool {
+			runs = append(runs, batchRun{agent: agent, run: run})
+			return true
+		})
+		if err != nil {
+			if agent != m {
+				err = fmt.Errorf("%s: %w", agent.repositoryName(), err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	m.logger.WithField("runs", len(runs)).Info("Fixing failed workflow runs")
+
+	workers := m.MaxConcurrentFixes
+	if workers <= 0 {
+		workers = DefaultMaxConcurrentFixes
+	}
+	timeout := m.FixTimeout
+	if timeout <= 0 {
+		timeout = DefaultFixTimeout
+	}
+
+	results := make([]*AutoFixResult, len(runs))
+	var group errgroup.Group
+	group.SetLimit(workers)
+	for i, claimed := range runs {
+		group.Go(func() error {
+			results[i] = m.batchFix(ctx, claimed, timeout)
+			return nil
+		})
+	}
+	group.Wait()
+
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.batchOutcome()]++
+	}
+	m.logger.WithFields(logrus.Fields{
+		"fixed":        counts[BatchFixed],
+		"no_valid_fix": counts[BatchNoValidFix],
+		"errors":       counts[BatchError],
+	}).Info("Batch fix finished")
+	return results, errors.Join(errs...)
+}
+
+// batchFix fixes a run claimed for a batch within timeout, counting its outcome as the
+// worker pool does
+func (m *DaggerAutofix) batchFix(ctx context.Context, claimed batchRun, timeout time.Duration) *AutoFixResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	claimed.agent.notify(ctx, runNotification(FailureDetected, claimed.run.ID, claimed.run))
+	result, err := claimed.agent.AutoFix(ctx, claimed.run.ID)
+	m.finishRun(claimed.run.ID, err)
+	if err != nil {
+		m.stats.failedFixes.Add(1)
+		m.logger.WithError(err).WithField("run_id", claimed.run.ID).Error("Auto-fix failed")
+		return result
+	}
+	m.stats.completedFixes.Add(1)
+	return result
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAutoFixAll tests that a batch fixes every failed run, keeping on after a run without a
+// valid fix and a run whose fix errored
+func TestAutoFixAll(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	runs := []*WorkflowRun{
+		{ID: 1, CreatedAt: now},
+		{ID: 2, CreatedAt: now},
+		{ID: 3, CreatedAt: now},
+	}
+	errorLines := map[int64][]string{
+		1: {"--- FAIL: TestParse (0.02s)"},
+		2: {"--- FAIL: TestRender (0.01s)"},
+		3: {"Error: Cannot find module 'left-pad'"},
+	}
+	m, _, _ := clusteringAutofix(runs, errorLines)
+	fe := m.failureEngine.(*mockFailureAnalysisEngine)
+	analyze := fe.analyzeFunc
+	fe.analyzeFunc = func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+		if fc.WorkflowRun.ID == 3 {
+			return nil, errors.New("LLM provider unavailable")
+		}
+		return analyze(ctx, fc)
+	}
+	generate := fe.generateFixesFunc
+	fe.generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+		if analysis.Context.WorkflowRun.ID == 2 {
+			return nil, nil
+		}
+		return generate(ctx, analysis)
+	}
+
+	results, err := m.AutoFixAll(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+
+	outcomes := make(map[int64]string)
+	for _, result := range results {
+		outcomes[result.RunID] = result.batchOutcome()
+	}
+	assert.Equal(t, map[int64]string{1: BatchFixed, 2: BatchNoValidFix, 3: BatchError}, outcomes)
+	assert.NotNil(t, results[0].PullRequest)
+
+	metrics, err := m.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, metrics.TotalFailuresDetected)
+
+	batchErr := batchFixError(results, nil)
+	assert.Equal(t, exitError, exitCode(batchErr), "a hard error wins over runs without a valid fix")
+	assert.EqualError(t, batchErr, "1 of 3 fixes failed with an error")
+	assert.Equal(t, exitNoValidFixes, exitCode(batchFixError(results[:2], nil)))
+	assert.NoError(t, batchFixError(results[:1], nil))
+
+	// The runs were claimed by the batch, so they are not fixed again
+	results, err = m.AutoFixAll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	assert.Equal(t, exitNothingToFix, exitCode(batchFixError(results, nil)))
+}
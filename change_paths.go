@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// rejectedChangePenalty is how much a fix's confidence drops for each change dropped
+// because of its path
+const rejectedChangePenalty = 0.2
+
+// workspacePrefixes match the checkout directories LLMs copy from CI logs and container
+// paths, e.g. /workspace/src/app.js or /home/runner/work/repo/repo/src/app.js
+var workspacePrefixes = regexp.MustCompile(`^(?:/github/workspace|/workspace|/app|/home/runner/work/[^/]+/[^/]+)/`)
+
+// windowsDrive matches absolute Windows paths such as C:/repo/main.go
+var windowsDrive = regexp.MustCompile(`^[A-Za-z]:(?:/|$)`)
+
+// PathPolicy restricts the repository paths fixes may change. Prefixes are directories or
+// files relative to the repository root, e.g. "src" or "docs/index.md".
+type PathPolicy struct {
+	// Allow lists the only prefixes fixes may change; empty allows every path
+	Allow []string `json:"allow"`
+	// Deny lists prefixes fixes may never change, even when allowed
+	Deny []string `json:"deny"`
+}
+
+// workflowsDir holds the workflow files only workflow fixes may change
+const workflowsDir = ".github/workflows"
+
+// normalizeChangePath turns a file path proposed by the LLM into a clean path relative to
+// the repository root. Backslashes become slashes and workspace prefixes are stripped.
+// Absolute paths, paths escaping the repository and paths inside .git are rejected.
+func normalizeChangePath(filePath string) (string, error) {
+	normalized := strings.ReplaceAll(strings.TrimSpace(filePath), `\`, "/")
+	normalized = workspacePrefixes.ReplaceAllString(normalized, "")
+	return cleanChangePath(normalized)
+}
+
+// cleanChangePath cleans a repository relative path, rejecting absolute paths, paths
+// escaping the repository root and paths inside .git
+func cleanChangePath(filePath string) (string, error) {
+	if filePath == "" {
+		return "", fmt.Errorf("empty file path")
+	}
+	if path.IsAbs(filePath) || windowsDrive.MatchString(filePath) {
+		return "", fmt.Errorf("absolute file path %q", filePath)
+	}
+	cleaned := path.Clean(filePath)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("file path %q escapes the repository", filePath)
+	}
+	for _, part := range strings.Split(cleaned, "/") {
+		if part == ".git" {
+			return "", fmt.Errorf("file path %q is inside .git", filePath)
+		}
+	}
+	return cleaned, nil
+}
+
+// check rejects a clean path the policy does not let a fix of fixType change
+func (p PathPolicy) check(fixType FixType, filePath string) error {
+	if hasPathPrefix(filePath, workflowsDir) && fixType != WorkflowFix {
+		return fmt.Errorf("only workflow fixes may change %s", filePath)
+	}
+	for _, prefix := range p.Deny {
+		if hasPathPrefix(filePath, prefix) {
+			return fmt.Errorf("%s is denied by the path policy", filePath)
+		}
+	}
+	if len(p.Allow) == 0 {
+		return nil
+	}
+	for _, prefix := range p.Allow {
+		if hasPathPrefix(filePath, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not allowed by the path policy", filePath)
+}
+
+// hasPathPrefix reports whether filePath is prefix or inside the directory prefix
+func hasPathPrefix(filePath, prefix string) bool {
+	prefix = strings.Trim(path.Clean("/"+strings.TrimSpace(prefix)), "/")
+	if prefix == "" {
+		return true
+	}
+	return filePath == prefix || strings.HasPrefix(filePath, prefix+"/")
+}
+
+// changeOperationSynonyms maps the operation names LLMs use besides the canonical ones
+var changeOperationSynonyms = map[string]ChangeOperation{
+	"":        ChangeOperationModify,
+	"create":  ChangeOperationAdd,
+	"new":     ChangeOperationAdd,
+	"update":  ChangeOperationModify,
+	"edit":    ChangeOperationModify,
+	"replace": ChangeOperationModify,
+	"remove":  ChangeOperationDelete,
+	"move":    ChangeOperationRename,
+}
+
+// normalizeChangeOperation turns an operation proposed by the LLM into a ChangeOperation,
+// accepting common synonyms such as create, update, remove and move
+func normalizeChangeOperation(operation ChangeOperation) (ChangeOperation, error) {
+	name := strings.ToLower(strings.TrimSpace(string(operation)))
+	switch ChangeOperation(name) {
+	case ChangeOperationAdd, ChangeOperationModify, ChangeOperationDelete, ChangeOperationRename:
+		return ChangeOperation(name), nil
+	}
+	if canonical, ok := changeOperationSynonyms[name]; ok {
+		return canonical, nil
+	}
+	return "", fmt.Errorf("unknown operation %q", operation)
+}
+
+// sanitizeFixChanges normalizes the operations and file paths of a fix's changes and drops
+// the changes with unknown operations or paths the policy rejects, lowering the fix's
+// confidence for each. It returns why changes were dropped, which are also added to the
+// fix's risks.
+func sanitizeFixChanges(fix *ProposedFix, policy PathPolicy) []string {
+	var rejected []string
+	changes := fix.Changes[:0]
+	for _, change := range fix.Changes {
+		if err := sanitizeChange(&change, fix.Type, policy); err != nil {
+			rejected = append(rejected, fmt.Sprintf("Dropped a change: %v", err))
+			continue
+		}
+		changes = append(changes, change)
+	}
+	fix.Changes = changes
+	if len(rejected) > 0 {
+		fix.Confidence = max(0, fix.Confidence-rejectedChangePenalty*float64(len(rejected)))
+		fix.Risks = append(fix.Risks, rejected...)
+	}
+	return rejected
+}
+
+// sanitizeChange normalizes a change's operation and paths in place, checking every path it
+// writes against the policy
+func sanitizeChange(change *CodeChange, fixType FixType, policy PathPolicy) error {
+	operation, err := normalizeChangeOperation(change.Operation)
+	if err != nil {
+		return fmt.Errorf("%w for %s", err, change.FilePath)
+	}
+	change.Operation = operation
+
+	cleaned, err := normalizeChangePath(change.FilePath)
+	if err == nil {
+		err = policy.check(fixType, cleaned)
+	}
+	if err != nil {
+		return err
+	}
+	change.FilePath = cleaned
+
+	if operation != ChangeOperationRename {
+		change.NewFilePath = ""
+		return nil
+	}
+	if strings.TrimSpace(change.NewFilePath) == "" {
+		return fmt.Errorf("rename of %s has no new file path", cleaned)
+	}
+	renamed, err := normalizeChangePath(change.NewFilePath)
+	if err == nil {
+		err = policy.check(fixType, renamed)
+	}
+	if err != nil {
+		return err
+	}
+	if renamed == cleaned {
+		return fmt.Errorf("rename of %s does not change its path", cleaned)
+	}
+	change.NewFilePath = renamed
+	return nil
+}
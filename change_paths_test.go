@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNormalizeChangePath tests cleaning the file paths the LLM proposes
+func TestNormalizeChangePath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string
+		wantErr string
+	}{
+		{path: "src/app.js", want: "src/app.js"},
+		{path: "  ./src/../src/app.js ", want: "src/app.js"},
+		{path: "/workspace/src/app.js", want: "src/app.js"},
+		{path: "/github/workspace/go.mod", want: "go.mod"},
+		{path: "/app/package.json", want: "package.json"},
+		{path: "/home/runner/work/repo/repo/cmd/main.go", want: "cmd/main.go"},
+		{path: `src\lib\util.go`, want: "src/lib/util.go"},
+		{path: ".github/CODEOWNERS", want: ".github/CODEOWNERS"},
+		{path: ".gitignore", want: ".gitignore"},
+		{path: "", wantErr: "empty file path"},
+		{path: "/etc/passwd", wantErr: `absolute file path "/etc/passwd"`},
+		{path: `C:\repo\main.go`, wantErr: `absolute file path "C:/repo/main.go"`},
+		{path: "d:/main.go", wantErr: "absolute file path"},
+		{path: "../../etc/passwd", wantErr: "escapes the repository"},
+		{path: "src/../../outside.go", wantErr: "escapes the repository"},
+		{path: "/workspace/../etc/passwd", wantErr: "escapes the repository"},
+		{path: `..\secrets.txt`, wantErr: "escapes the repository"},
+		{path: ".", wantErr: "escapes the repository"},
+		{path: ".git/config", wantErr: "is inside .git"},
+		{path: "vendor/lib/.git/hooks/pre-commit", wantErr: "is inside .git"},
+		{path: "/workspace/.git", wantErr: "is inside .git"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := normalizeChangePath(tt.path)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestPathPolicyCheck tests the allowed and denied path prefixes and the workflow files only
+// workflow fixes may change
+func TestPathPolicyCheck(t *testing.T) {
+	policy := PathPolicy{Allow: []string{"src", "./docs/", ".github"}, Deny: []string{"src/generated/", "docs/CHANGELOG.md"}}
+	tests := []struct {
+		name    string
+		policy  PathPolicy
+		fixType FixType
+		path    string
+		wantErr string
+	}{
+		{name: "no policy", fixType: CodeFix, path: "main.go"},
+		{name: "allowed", policy: policy, fixType: CodeFix, path: "src/app.js"},
+		{name: "allowed directory prefix", policy: policy, fixType: TestFix, path: "docs/guide/setup.md"},
+		{name: "not allowed", policy: policy, fixType: CodeFix, path: "main.go", wantErr: "main.go is not allowed by the path policy"},
+		{name: "prefix is not a directory", policy: policy, fixType: CodeFix, path: "srcs/app.js", wantErr: "not allowed"},
+		{name: "denied directory", policy: policy, fixType: CodeFix, path: "src/generated/api.go", wantErr: "src/generated/api.go is denied by the path policy"},
+		{name: "denied file", policy: policy, fixType: TestFix, path: "docs/CHANGELOG.md", wantErr: "denied"},
+		{name: "denied without allow", policy: PathPolicy{Deny: []string{"vendor"}}, fixType: DependencyFix, path: "vendor/modules.txt", wantErr: "denied"},
+		{name: "workflow fix", fixType: WorkflowFix, path: ".github/workflows/ci.yml"},
+		{name: "workflow change by a code fix", fixType: CodeFix, path: ".github/workflows/ci.yml", wantErr: "only workflow fixes may change .github/workflows/ci.yml"},
+		{name: "other .github files", policy: policy, fixType: ConfigurationFix, path: ".github/dependabot.yml"},
+		{name: "denied workflow", policy: PathPolicy{Deny: []string{".github/workflows/release.yml"}}, fixType: WorkflowFix, path: ".github/workflows/release.yml", wantErr: "denied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.check(tt.fixType, tt.path)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+// TestSanitizeFixPaths tests dropping the rejected changes of a fix and lowering its confidence
+func TestSanitizeFixPaths(t *testing.T) {
+	fix := &ProposedFix{
+		ID:         "fix-1",
+		Type:       CodeFix,
+		Confidence: 0.9,
+		Risks:      []string{"Touches the build"},
+		Changes: []CodeChange{
+			{FilePath: "/workspace/src/app.js", Operation: ChangeOperationModify},
+			{FilePath: "../../etc/passwd", Operation: ChangeOperationModify},
+			{FilePath: ".github/workflows/ci.yml", Operation: ChangeOperationModify},
+			{FilePath: `src\util.js`, Operation: ChangeOperationAdd},
+		},
+	}
+
+	rejected := sanitizeFixChanges(fix, PathPolicy{})
+	require.Len(t, rejected, 2)
+	assert.Contains(t, rejected[0], "escapes the repository")
+	assert.Contains(t, rejected[1], "only workflow fixes may change")
+	assert.Equal(t, []string{"src/app.js", "src/util.js"}, []string{fix.Changes[0].FilePath, fix.Changes[1].FilePath})
+	assert.Len(t, fix.Changes, 2)
+	assert.InDelta(t, 0.5, fix.Confidence, 1e-9)
+	assert.Equal(t, append([]string{"Touches the build"}, rejected...), fix.Risks)
+
+	assert.Empty(t, sanitizeFixChanges(fix, PathPolicy{}), "sanitized fixes pass again")
+	assert.InDelta(t, 0.5, fix.Confidence, 1e-9)
+
+	fix.Changes = append(fix.Changes, CodeChange{FilePath: "/etc/a"}, CodeChange{FilePath: "/etc/b"}, CodeChange{FilePath: "/etc/c"})
+	assert.Len(t, sanitizeFixChanges(fix, PathPolicy{}), 3)
+	assert.Zero(t, fix.Confidence, "confidence does not drop below 0")
+}
+
+// TestParseFixesResponseSanitizesPaths tests that generated fixes only keep the changes the
+// path policy allows, and are skipped once every change is dropped
+func TestParseFixesResponseSanitizesPaths(t *testing.T) {
+	engine := NewFailureAnalysisEngine(nil, quietLogger())
+	engine.SetPathPolicy(PathPolicy{Deny: []string{"vendor"}})
+	content := `[
+		{"type": "code", "confidence": 0.8, "changes": [
+			{"file_path": "/github/workspace/main.go", "operation": "modify", "new_content": "package main"},
+			{"file_path": "vendor/lib/lib.go", "operation": "modify", "new_content": "package lib"}
+		]},
+		{"type": "code", "confidence": 0.9, "changes": [
+			{"file_path": "../../etc/passwd", "operation": "modify", "new_content": "root::0:0"}
+		]},
+		{"type": "workflow", "confidence": 0.7, "changes": [
+			{"file_path": ".github/workflows/ci.yml", "operation": "modify", "new_content": "on: push"}
+		]}
+	]`
+
+	fixes, err := engine.parseFixesResponse(content, &FailureAnalysisResult{ID: "analysis"})
+	require.NoError(t, err)
+	require.Len(t, fixes, 2)
+	assert.Regexp(t, `^analysis-fix-1-[0-9a-f]{6}$`, fixes[0].ID)
+	assert.Equal(t, []CodeChange{{FilePath: "main.go", Operation: ChangeOperationModify, NewContent: "package main"}}, fixes[0].Changes)
+	assert.InDelta(t, 0.6, fixes[0].Confidence, 1e-9)
+	assert.Equal(t, []string{"Dropped a change: vendor/lib/lib.go is denied by the path policy"}, fixes[0].Risks)
+	assert.Regexp(t, `^analysis-fix-3-[0-9a-f]{6}$`, fixes[1].ID)
+	assert.Equal(t, ".github/workflows/ci.yml", fixes[1].Changes[0].FilePath)
+}
+
+// TestParseFixesResponseNormalizesOperations tests that operation synonyms are accepted and
+// changes with unknown operations are dropped when the LLM response is parsed
+func TestParseFixesResponseNormalizesOperations(t *testing.T) {
+	engine := NewFailureAnalysisEngine(nil, quietLogger())
+	content := `[
+		{"type": "code", "confidence": 0.8, "changes": [
+			{"file_path": "src/util.js", "operation": "create", "new_content": "module.exports = {}"},
+			{"file_path": "src/legacy.js", "operation": "remove"},
+			{"file_path": "src/app.js", "operation": "update", "new_content": "require('./util')"},
+			{"file_path": "src/old.js", "operation": "move", "new_file_path": "src/new.js"},
+			{"file_path": "src/app.js", "operation": "patch", "new_content": "@@ -1 +1 @@"}
+		]}
+	]`
+
+	fixes, err := engine.parseFixesResponse(content, &FailureAnalysisResult{ID: "analysis"})
+	require.NoError(t, err)
+	require.Len(t, fixes, 1)
+	operations := make([]ChangeOperation, 0, len(fixes[0].Changes))
+	for _, change := range fixes[0].Changes {
+		operations = append(operations, change.Operation)
+	}
+	assert.Equal(t, []ChangeOperation{ChangeOperationAdd, ChangeOperationDelete, ChangeOperationModify, ChangeOperationRename}, operations)
+	assert.Equal(t, "src/new.js", fixes[0].Changes[3].NewFilePath)
+	assert.InDelta(t, 0.6, fixes[0].Confidence, 1e-9)
+	assert.Equal(t, []string{`Dropped a change: unknown operation "patch" for src/app.js`}, fixes[0].Risks)
+}
+
+// TestGenerateFixesSanitizesPaths tests that the agent checks the paths of every fix,
+// including fixes not parsed from the LLM, against its path policy
+func TestGenerateFixesSanitizesPaths(t *testing.T) {
+	m := New().WithPathPolicy([]string{"src"}, nil)
+	m.logger = quietLogger()
+	m.failureEngine = &mockFailureAnalysisEngine{
+		generateFixesFunc: func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+			return []*ProposedFix{
+				{ID: "allowed", Type: CodeFix, Confidence: 0.9, Changes: []CodeChange{
+					{FilePath: "./src/app.js", Operation: ChangeOperationModify},
+					{FilePath: "README.md", Operation: ChangeOperationModify},
+				}},
+				{ID: "outside", Type: CodeFix, Confidence: 0.9, Changes: []CodeChange{
+					{FilePath: "docs/index.md", Operation: ChangeOperationModify},
+				}},
+			}, nil
+		},
+	}
+
+	fixes, err := m.generateFixes(context.Background(), &FailureAnalysisResult{ID: "analysis"})
+	require.NoError(t, err)
+	require.Len(t, fixes, 1)
+	assert.Equal(t, "allowed", fixes[0].ID)
+	assert.Equal(t, []CodeChange{{FilePath: "src/app.js", Operation: ChangeOperationModify}}, fixes[0].Changes)
+	assert.InDelta(t, 0.7, fixes[0].Confidence, 1e-9)
+}
+
+// TestValidateCodeChangePaths tests that changes are checked again right before they are applied
+func TestValidateCodeChangePaths(t *testing.T) {
+	for _, filePath := range []string{"../outside.go", "/etc/passwd", "C:/repo/main.go", ".git/config", ""} {
+		assert.ErrorContains(t, validateCodeChange(CodeChange{FilePath: filePath, Operation: ChangeOperationModify}), "invalid file path", filePath)
+	}
+	assert.NoError(t, validateCodeChange(CodeChange{FilePath: "./README.md", Operation: ChangeOperationModify}))
+}
+
+// TestNormalizeChangeOperation tests accepting the operation synonyms LLMs use
+func TestNormalizeChangeOperation(t *testing.T) {
+	tests := []struct {
+		operation ChangeOperation
+		want      ChangeOperation
+	}{
+		{"add", ChangeOperationAdd},
+		{"create", ChangeOperationAdd},
+		{" Create ", ChangeOperationAdd},
+		{"modify", ChangeOperationModify},
+		{"update", ChangeOperationModify},
+		{"", ChangeOperationModify},
+		{"delete", ChangeOperationDelete},
+		{"remove", ChangeOperationDelete},
+		{"rename", ChangeOperationRename},
+		{"MOVE", ChangeOperationRename},
+	}
+	for _, tt := range tests {
+		got, err := normalizeChangeOperation(tt.operation)
+		require.NoError(t, err, tt.operation)
+		assert.Equal(t, tt.want, got, tt.operation)
+	}
+
+	_, err := normalizeChangeOperation("chmod")
+	assert.EqualError(t, err, `unknown operation "chmod"`)
+}
+
+// TestSanitizeFixChangesOperations tests that changes with unknown operations or incomplete
+// renames are dropped like changes to rejected paths
+func TestSanitizeFixChangesOperations(t *testing.T) {
+	fix := &ProposedFix{
+		ID:         "fix-1",
+		Type:       CodeFix,
+		Confidence: 0.9,
+		Changes: []CodeChange{
+			{FilePath: "src/new.js", Operation: "create", NewFilePath: "ignored.js"},
+			{FilePath: "src/old.js", Operation: "chmod"},
+			{FilePath: "/workspace/src/a.js", Operation: "move", NewFilePath: `src\b.js`},
+			{FilePath: "src/c.js", Operation: ChangeOperationRename},
+			{FilePath: "src/d.js", Operation: ChangeOperationRename, NewFilePath: "./src/d.js"},
+			{FilePath: "src/e.js", Operation: ChangeOperationRename, NewFilePath: "vendor/e.js"},
+		},
+	}
+
+	rejected := sanitizeFixChanges(fix, PathPolicy{Deny: []string{"vendor"}})
+	assert.Equal(t, []string{
+		`Dropped a change: unknown operation "chmod" for src/old.js`,
+		"Dropped a change: rename of src/c.js has no new file path",
+		"Dropped a change: rename of src/d.js does not change its path",
+		"Dropped a change: vendor/e.js is denied by the path policy",
+	}, rejected)
+	assert.Equal(t, []CodeChange{
+		{FilePath: "src/new.js", Operation: ChangeOperationAdd},
+		{FilePath: "src/a.js", Operation: ChangeOperationRename, NewFilePath: "src/b.js"},
+	}, fix.Changes)
+	assert.InDelta(t, 0.1, fix.Confidence, 1e-9)
+}
+
+// TestValidateCodeChangeRename tests that renames are checked again right before they are
+// applied
+func TestValidateCodeChangeRename(t *testing.T) {
+	assert.NoError(t, validateCodeChange(CodeChange{FilePath: "a.go", NewFilePath: "b/a.go", Operation: ChangeOperationRename}))
+	assert.ErrorContains(t, validateCodeChange(CodeChange{FilePath: "a.go", NewFilePath: "../a.go", Operation: ChangeOperationRename}), "invalid new file path")
+	assert.ErrorContains(t, validateCodeChange(CodeChange{FilePath: "a.go", Operation: ChangeOperationRename}), "invalid new file path")
+	assert.ErrorContains(t, validateCodeChange(CodeChange{FilePath: "a.go", NewFilePath: "./a.go", Operation: ChangeOperationRename}), "does not change its path")
+	assert.ErrorContains(t, validateCodeChange(CodeChange{FilePath: "a.go", Operation: "create"}), "unknown operation")
+}
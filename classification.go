@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/tosin2013/dagger-autofix/pkg/autofix"
+)
+
+// Unknown values stand in for classifications an LLM or a stored analysis gives that match
+// none of the known ones
+const (
+	UnknownFailure  = autofix.UnknownFailure
+	UnknownFix      = autofix.UnknownFix
+	UnknownSeverity = autofix.UnknownSeverity
+	UnknownCategory = autofix.UnknownCategory
+)
+
+// ParseFailureType returns the failure type a value names, see autofix.ParseFailureType
+func ParseFailureType(value string) (FailureType, error) {
+	return autofix.ParseFailureType(value)
+}
+
+// ParseFixType returns the fix type a value names, see autofix.ParseFixType
+func ParseFixType(value string) (FixType, error) {
+	return autofix.ParseFixType(value)
+}
+
+// ParseSeverity returns the severity level a value names, see autofix.ParseSeverity
+func ParseSeverity(value string) (SeverityLevel, error) {
+	return autofix.ParseSeverity(value)
+}
+
+// ParseCategory returns the failure category a value names, see autofix.ParseCategory
+func ParseCategory(value string) (FailureCategory, error) {
+	return autofix.ParseCategory(value)
+}
+
+// parseLLMClassification parses a classification field of an LLM response, logging values
+// that fall back to unknown
+func parseLLMClassification[T ~string](logger *logrus.Logger, field, value string, parse func(string) (T, error)) T {
+	parsed, err := parse(value)
+	if err != nil && logger != nil {
+		logger.WithField("field", field).WithError(err).Warn("LLM returned an unknown classification")
+	}
+	return parsed
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClassificationJSON tests that decoding stored analyses and fixes normalizes their
+// classifications and that encoded values decode to themselves
+func TestClassificationJSON(t *testing.T) {
+	var analysis FailureAnalysisResult
+	require.NoError(t, json.Unmarshal([]byte(`{"classification": {
+		"type": "Dependency_Failure", "severity": "MODERATE", "category": "made up"}}`), &analysis))
+	assert.Equal(t, FailureClassification{Type: DependencyFailure, Severity: Medium, Category: UnknownCategory}, analysis.Classification)
+
+	var fix ProposedFix
+	require.NoError(t, json.Unmarshal([]byte(`{"type": "CI"}`), &fix))
+	assert.Equal(t, WorkflowFix, fix.Type)
+
+	var empty FailureClassification
+	require.NoError(t, json.Unmarshal([]byte(`{"type": "", "severity": null}`), &empty))
+	assert.Equal(t, FailureClassification{}, empty, "empty values stay empty")
+
+	var failureType FailureType
+	assert.Error(t, json.Unmarshal([]byte(`42`), &failureType))
+
+	original := FailureClassification{Type: SecurityFailure, Severity: Critical, Category: Flaky, Confidence: 0.8}
+	data, err := json.Marshal(original)
+	require.NoError(t, err)
+	var decoded FailureClassification
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, original, decoded)
+
+	policy := PRPolicy{Actions: map[FailureType]PRPolicyAction{SecurityFailure: PRPolicyDraft}}
+	data, err = json.Marshal(policy)
+	require.NoError(t, err)
+	var decodedPolicy PRPolicy
+	require.NoError(t, json.Unmarshal(data, &decodedPolicy))
+	assert.Equal(t, policy, decodedPolicy)
+}
+
+// TestParseResponseClassification tests that classifications from LLM responses are normalized
+func TestParseResponseClassification(t *testing.T) {
+	engine := NewFailureAnalysisEngine(nil, quietLogger())
+
+	analysis, err := engine.parseAnalysisResponse(`{"root_cause": "missing module",
+		"classification": {"type": "dependency_failure", "severity": "Major", "category": "intermittent"}}`,
+		FailureContext{WorkflowRun: &WorkflowRun{ID: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, DependencyFailure, analysis.Classification.Type)
+	assert.Equal(t, High, analysis.Classification.Severity)
+	assert.Equal(t, Flaky, analysis.Classification.Category)
+
+	analysis, err = engine.parseAnalysisResponse(`{"classification": {"type": "gremlins"}}`,
+		FailureContext{WorkflowRun: &WorkflowRun{ID: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, UnknownFailure, analysis.Classification.Type)
+	assert.Equal(t, Medium, analysis.Classification.Severity, "missing fields keep their default")
+
+	fixes, err := engine.parseFixesResponse(`[{"type": "Dependency Fix"}, {"type": "magic"}]`, &FailureAnalysisResult{ID: "a"})
+	require.NoError(t, err)
+	require.Len(t, fixes, 2)
+	assert.Equal(t, DependencyFix, fixes[0].Type)
+	assert.Equal(t, UnknownFix, fixes[1].Type)
+
+	labels := NewPullRequestEngine(nil, logrus.New()).generatePRLabels(analysis, fixes[0])
+	assert.Contains(t, labels, "unknown-failure")
+	assert.Contains(t, labels, "dependency-fix")
+}
+
+// TestParsePRPolicyAliases tests that policy entries accept failure type aliases
+func TestParsePRPolicyAliases(t *testing.T) {
+	policy, err := ParsePRPolicy([]string{"POLICY_DEPS=draft", "POLICY_VULNERABILITY=analysis-only"})
+	require.NoError(t, err)
+	assert.Equal(t, PRPolicyDraft, policy.actionFor(DependencyFailure))
+	assert.Equal(t, PRPolicyAnalysisOnly, policy.actionFor(SecurityFailure))
+}
+
+// TestOSVSeverity tests that advisory severities keep mapping unknown values to no severity
+func TestOSVSeverity(t *testing.T) {
+	assert.Equal(t, Medium, osvSeverity("MODERATE"))
+	assert.Equal(t, Critical, osvSeverity("CRITICAL"))
+	assert.Equal(t, SeverityLevel(""), osvSeverity(""))
+	assert.Equal(t, SeverityLevel(""), osvSeverity("UNKNOWN"))
+}
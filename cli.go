@@ -2,36 +2,237 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
+	"dagger.io/dagger"
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/tosin2013/dagger-autofix/pkg/autofix"
 )
 
 // CLI represents the command-line interface for the GitHub Auto-Fix Agent
 type CLI struct {
-	logger  *logrus.Logger
-	rootCmd *cobra.Command
+	logger     *logrus.Logger
+	rootCmd    *cobra.Command
+	yamlConfig *yamlConfig // YAML config file, nil when none was found
 }
 
 // CLIConfig holds CLI configuration
 type CLIConfig struct {
-	GitHubToken  string `json:"github_token"`
-	LLMProvider  string `json:"llm_provider"`
-	LLMAPIKey    string `json:"llm_api_key"`
-	RepoOwner    string `json:"repo_owner"`
-	RepoName     string `json:"repo_name"`
-	TargetBranch string `json:"target_branch"`
-	MinCoverage  int    `json:"min_coverage"`
-	ConfigFile   string `json:"config_file"`
-	Verbose      bool   `json:"verbose"`
-	DryRun       bool   `json:"dry_run"`
-	LogLevel     string `json:"log_level"`
-	LogFormat    string `json:"log_format"`
+	GitHubToken          string `json:"github_token"`
+	GitHubAppID          int64  `json:"github_app_id"`
+	GitHubInstallationID int64  `json:"github_installation_id"`
+	GitHubPrivateKeyFile string `json:"github_private_key_file"`
+	GitHubAPIURL         string `json:"github_api_url"`
+	GitHubUploadURL      string `json:"github_upload_url"`
+	LLMProvider          string `json:"llm_provider"`
+	LLMAPIKey            string `json:"llm_api_key"`
+	RepoOwner            string `json:"repo_owner"`
+	RepoName             string `json:"repo_name"`
+	TargetBranch         string `json:"target_branch"`
+	MinCoverage          int    `json:"min_coverage"`
+	RequireCoverage      bool   `json:"require_coverage"`
+	TestNetwork          string `json:"test_network"`
+	ConfigFile           string `json:"config_file"`
+	Verbose              bool   `json:"verbose"`
+	DryRun               bool   `json:"dry_run"`
+	LogLevel             string `json:"log_level"`
+	LogFormat            string `json:"log_format"`
+
+	// Repositories are further "owner/name" repositories to monitor alongside RepoOwner/RepoName
+	Repositories []string `json:"repositories"`
+
+	// Organization has its repositories discovered, filtered by name globs and skipping
+	// archived and forked repositories unless included
+	Organization    string   `json:"organization"`
+	RepoInclude     []string `json:"repo_include"`
+	RepoExclude     []string `json:"repo_exclude"`
+	IncludeArchived bool     `json:"include_archived"`
+	IncludeForks    bool     `json:"include_forks"`
+
+	// Pull request defaults; reviewers may be users or "org/team" teams
+	PRReviewers []string `json:"pr_reviewers"`
+	PRAssignees []string `json:"pr_assignees"`
+	PRLabels    []string `json:"pr_labels"`
+	PRAutoMerge bool     `json:"pr_auto_merge"`
+	PRDraft     bool     `json:"pr_draft"`
+	// PRCoverageGist links the HTML coverage report of each fix from its PR through a gist
+	PRCoverageGist bool `json:"pr_coverage_gist"`
+	// PRCommentMode decides how fixes for failed pull_request runs are proposed
+	PRCommentMode string `json:"pr_comment_mode"`
+
+	// Fix lifecycle notifications; the webhook URL is a secret
+	NotificationWebhook string `json:"notification_webhook"`
+	NotificationFormat  string `json:"notification_format"`
+
+	// AuditLog is the JSON lines file recording the agent's actions
+	AuditLog string `json:"audit_log"`
+
+	// RedactionPatterns are regular expressions masked in addition to the built-in patterns
+	RedactionPatterns []string `json:"redaction_patterns"`
+
+	// Repository path prefixes fixes may and may never change
+	AllowedPaths []string `json:"allowed_paths"`
+	DeniedPaths  []string `json:"denied_paths"`
+
+	// Fix guardrails: the most files and lines a fix may change, the paths it may never
+	// change and what happens to fixes exceeding them
+	MaxFixFiles     int      `json:"max_fix_files"`
+	MaxFixLines     int      `json:"max_fix_lines"`
+	ProtectedPaths  []string `json:"protected_paths"`
+	GuardrailAction string   `json:"guardrail_action"`
+
+	// Binary file extensions and generated files, given as "pattern=command", besides the
+	// built-in ones
+	BinaryExtensions []string `json:"binary_extensions"`
+	GeneratedFiles   []string `json:"generated_files"`
+
+	// LLM response cache; NoLLMCache forces fresh LLM requests
+	LLMCacheDir string        `json:"llm_cache_dir"`
+	LLMCacheTTL time.Duration `json:"llm_cache_ttl"`
+	NoLLMCache  bool          `json:"no_llm_cache"`
+
+	// LLM prices in US dollars per 1,000 tokens for the configured provider; zero keeps the
+	// built-in price
+	LLMInputPrice  float64 `json:"llm_input_price_per_1k"`
+	LLMOutputPrice float64 `json:"llm_output_price_per_1k"`
+
+	// Extra headers of LLM requests as "Name: value", and OpenAI's billing attribution
+	LLMHeaders         []string `json:"llm_headers"`
+	OpenAIOrganization string   `json:"openai_organization"`
+	OpenAIProject      string   `json:"openai_project"`
+
+	// Models of the analysis and fix generation requests, and the analysis confidence below
+	// which an analysis is re-run with the fix model
+	AnalysisModel        string  `json:"analysis_model"`
+	FixModel             string  `json:"fix_model"`
+	EscalationConfidence float64 `json:"escalation_confidence"`
+
+	// Summarize logs too long for the analysis prompt in chunks
+	LogChunking     bool    `json:"log_chunking"`
+	LogChunkFactor  float64 `json:"log_chunk_factor"`
+	LogChunkBytes   int     `json:"log_chunk_bytes"`
+	LogChunkOverlap int     `json:"log_chunk_overlap"`
+	LogChunkMax     int     `json:"log_chunk_max"`
+
+	// Re-run failures that look flaky before fixing them
+	FlakyRetry       bool          `json:"flaky_retry"`
+	FlakyRetryMaxAge time.Duration `json:"flaky_retry_max_age"`
+
+	// SARIFUpload uploads the analyses of fixed failures to GitHub code scanning
+	SARIFUpload bool `json:"sarif_upload"`
+
+	// FixHistory is the JSON file remembering fixes per failure, so recurring failures reuse them
+	FixHistory string `json:"fix_history"`
+
+	// PromptDir holds prompt template files overriding the built-in prompts
+	PromptDir string `json:"prompt_dir"`
+
+	sources  map[string]valueSource // where each setting came from, keyed by config file path
+	problems []configProblem        // values that could not be parsed
+}
+
+// prDefaults converts the pull request settings into module PR defaults
+func (c *CLIConfig) prDefaults() PRDefaults {
+	reviewers, teams := parseReviewers(c.PRReviewers)
+	return PRDefaults{
+		Reviewers:     reviewers,
+		TeamReviewers: teams,
+		Assignees:     c.PRAssignees,
+		Labels:        c.PRLabels,
+		AutoMerge:     c.PRAutoMerge,
+		Draft:         c.PRDraft,
+		CoverageGist:  c.PRCoverageGist,
+	}
+}
+
+// fixGuardrails converts the guardrail settings into module fix guardrails
+func (c *CLIConfig) fixGuardrails() FixGuardrails {
+	guardrails := FixGuardrails{
+		MaxFiles: c.MaxFixFiles,
+		MaxLines: c.MaxFixLines,
+		Action:   GuardrailAction(strings.ToLower(c.GuardrailAction)),
+	}
+	// No protected paths keeps the defaults
+	if len(c.ProtectedPaths) > 0 {
+		guardrails.ProtectedPaths = c.ProtectedPaths
+	}
+	return guardrails
+}
+
+// fileClassification converts the binary and generated file settings into a module file
+// classification
+func (c *CLIConfig) fileClassification() FileClassification {
+	classification := FileClassification{BinaryExtensions: c.BinaryExtensions}
+	for _, entry := range c.GeneratedFiles {
+		classification.GeneratedFiles = append(classification.GeneratedFiles, parseGeneratedFile(entry))
+	}
+	return classification
+}
+
+// logChunking converts the log chunking settings into module log chunking
+func (c *CLIConfig) logChunking() LogChunking {
+	return LogChunking{
+		Enabled:      c.LogChunking,
+		Factor:       c.LogChunkFactor,
+		ChunkBytes:   c.LogChunkBytes,
+		OverlapLines: c.LogChunkOverlap,
+		MaxChunks:    c.LogChunkMax,
+	}
+}
+
+// llmPrice returns the configured price of the LLM provider, filling an unset input or
+// output price from the built-in table, and false when neither is set
+func (c *CLIConfig) llmPrice() (LLMPrice, bool) {
+	if c.LLMInputPrice == 0 && c.LLMOutputPrice == 0 {
+		return LLMPrice{}, false
+	}
+	provider := LLMProvider(c.LLMProvider)
+	price := defaultLLMPrices[provider]
+	price.Provider = provider
+	if c.LLMInputPrice != 0 {
+		price.InputPer1K = c.LLMInputPrice
+	}
+	if c.LLMOutputPrice != 0 {
+		price.OutputPer1K = c.LLMOutputPrice
+	}
+	return price, true
+}
+
+// llmHeaders returns the extra headers of LLM requests, the OpenAI organization and project
+// last
+func (c *CLIConfig) llmHeaders() ([]LLMHeader, error) {
+	var headers []LLMHeader
+	for _, entry := range c.LLMHeaders {
+		header, err := parseLLMHeader(entry)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, header)
+	}
+	if c.OpenAIOrganization != "" {
+		headers = append(headers, LLMHeader{Name: headerOpenAIOrganization, Value: c.OpenAIOrganization})
+	}
+	if c.OpenAIProject != "" {
+		headers = append(headers, LLMHeader{Name: headerOpenAIProject, Value: c.OpenAIProject})
+	}
+	return headers, validateLLMHeaders(llmHeaderMap(headers))
+}
+
+// usesGitHubApp reports whether GitHub App credentials were supplied
+func (c *CLIConfig) usesGitHubApp() bool {
+	return c.GitHubAppID != 0 || c.GitHubInstallationID != 0 || c.GitHubPrivateKeyFile != ""
 }
 
 // NewCLI creates a new CLI instance
@@ -39,6 +240,8 @@ func NewCLI() *CLI {
 	logger := logrus.New()
 	logger.SetLevel(logrus.InfoLevel)
 	logger.SetFormatter(&logrus.JSONFormatter{})
+	// stdout is reserved for command results
+	logger.SetOutput(os.Stderr)
 
 	cli := &CLI{
 		logger: logger,
@@ -64,27 +267,83 @@ func (c *CLI) setupRootCommand() {
 This tool monitors GitHub Actions workflows, analyzes failures using LLM-powered intelligence,
 generates and validates fixes, and creates pull requests automatically.
 
-Supports multiple LLM providers: OpenAI, Anthropic, Gemini, DeepSeek, and LiteLLM proxy.`,
-		Version: "1.0.0",
-		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+Supports multiple LLM providers: OpenAI, Anthropic, Gemini, DeepSeek, and LiteLLM proxy.
+
+` + exitCodeHelp,
+		Version: agentVersion,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			c.loadConfiguration()
 			c.setupLogging()
+			return validateOutputFormat(c.outputFormat())
 		},
 	}
 
 	// Global flags
-	c.rootCmd.PersistentFlags().String("config", ".github-autofix.env", "Configuration file path")
+	c.rootCmd.PersistentFlags().String("config", ".github-autofix.env", "Configuration file path (.env or .yml)")
 	c.rootCmd.PersistentFlags().String("github-token", "", "GitHub personal access token")
+	c.rootCmd.PersistentFlags().Int64("github-app-id", 0, "GitHub App ID (alternative to a personal access token)")
+	c.rootCmd.PersistentFlags().Int64("github-installation-id", 0, "GitHub App installation ID")
+	c.rootCmd.PersistentFlags().String("github-private-key-file", "", "Path to the GitHub App private key (PEM)")
+	c.rootCmd.PersistentFlags().String("github-api-url", "", "GitHub Enterprise Server API URL (e.g. https://github.example.com/api/v3/)")
+	c.rootCmd.PersistentFlags().String("github-upload-url", "", "GitHub Enterprise Server upload URL (defaults to the API host)")
 	c.rootCmd.PersistentFlags().String("llm-provider", "openai", "LLM provider (openai, anthropic, gemini, deepseek, litellm)")
 	c.rootCmd.PersistentFlags().String("llm-api-key", "", "LLM API key")
 	c.rootCmd.PersistentFlags().String("repo-owner", "", "GitHub repository owner")
 	c.rootCmd.PersistentFlags().String("repo-name", "", "GitHub repository name")
-	c.rootCmd.PersistentFlags().String("target-branch", "main", "Target branch for fixes")
+	c.rootCmd.PersistentFlags().StringSlice("repo", nil, "Also monitor this owner/name repository (repeatable)")
+	c.rootCmd.PersistentFlags().String("organization", "", "Discover and monitor the repositories of this GitHub organization")
+	c.rootCmd.PersistentFlags().StringSlice("repo-include", nil, "Only monitor organization repositories whose name matches this glob (repeatable)")
+	c.rootCmd.PersistentFlags().StringSlice("repo-exclude", nil, "Skip organization repositories whose name matches this glob (repeatable)")
+	c.rootCmd.PersistentFlags().Bool("include-archived", false, "Monitor archived organization repositories")
+	c.rootCmd.PersistentFlags().Bool("include-forks", false, "Monitor forked organization repositories")
+	c.rootCmd.PersistentFlags().String("target-branch", "", "Target branch for fixes (default: the repository's default branch)")
 	c.rootCmd.PersistentFlags().Int("min-coverage", 85, "Minimum test coverage percentage")
+	c.rootCmd.PersistentFlags().Bool("require-coverage", false, "Reject fixes whose coverage cannot be measured instead of judging them by their tests")
+	c.rootCmd.PersistentFlags().String("test-network", string(TestNetworkFull), "Network for the repository's commands during fix validation (full, restricted, none)")
+	c.rootCmd.PersistentFlags().StringSlice("pr-reviewer", nil, "Request review of fix PRs from a user or org/team (repeatable)")
+	c.rootCmd.PersistentFlags().StringSlice("pr-label", nil, "Extra label added to fix PRs (repeatable)")
+	c.rootCmd.PersistentFlags().Bool("pr-auto-merge", false, "Enable auto-merge on fix PRs when the repository allows it")
+	c.rootCmd.PersistentFlags().String("pr-comment-mode", string(PRCommentReview), "How fixes for failed pull_request runs are proposed (review, comment, off)")
+	c.rootCmd.PersistentFlags().String("notification-webhook", "", "Webhook URL receiving fix lifecycle notifications (JSON or Slack incoming webhook)")
+	c.rootCmd.PersistentFlags().String("notification-format", "", "Notification payload format (webhook, slack); detected from the URL by default")
+	c.rootCmd.PersistentFlags().String("audit-log", "", "Append an audit trail of the agent's actions to this JSON lines file")
+	c.rootCmd.PersistentFlags().StringSlice("redact-pattern", nil, "Regular expression masked in logs, prompts and test output (repeatable)")
+	c.rootCmd.PersistentFlags().StringSlice("allow-path", nil, "Only let fixes change files under this path prefix (repeatable)")
+	c.rootCmd.PersistentFlags().StringSlice("deny-path", nil, "Never let fixes change files under this path prefix (repeatable)")
+	c.rootCmd.PersistentFlags().Int("max-fix-files", DefaultMaxFixFiles, "Most files a fix may change; negative removes the limit")
+	c.rootCmd.PersistentFlags().Int("max-fix-lines", DefaultMaxFixLines, "Most lines a fix may add and remove; negative removes the limit")
+	c.rootCmd.PersistentFlags().StringSlice("protected-path", nil, "CODEOWNERS style pattern of files fixes may never change, replacing the defaults (repeatable)")
+	c.rootCmd.PersistentFlags().StringSlice("binary-extension", nil, "Extension of binary files fixes may not change, besides images, archives and compiled code (repeatable)")
+	c.rootCmd.PersistentFlags().StringSlice("generated-file", nil, "Generated files as pattern=command, regenerated by running command when a fix changes them (repeatable)")
+	c.rootCmd.PersistentFlags().String("guardrail-action", string(GuardrailReject), "What happens to fixes exceeding the guardrails (reject, draft, analysis-only)")
+	c.rootCmd.PersistentFlags().String("llm-cache-dir", "", "Directory persisting cached LLM responses between runs; in memory when empty")
+	c.rootCmd.PersistentFlags().Duration("llm-cache-ttl", defaultLLMCacheTTL, "How long cached LLM responses are reused")
+	c.rootCmd.PersistentFlags().Bool("no-llm-cache", false, "Send every LLM request, ignoring cached responses")
+	c.rootCmd.PersistentFlags().Float64("llm-input-price", 0, "Price in USD per 1K prompt tokens for cost estimates; 0 uses the built-in price")
+	c.rootCmd.PersistentFlags().Float64("llm-output-price", 0, "Price in USD per 1K completion tokens for cost estimates; 0 uses the built-in price")
+	c.rootCmd.PersistentFlags().StringSlice("llm-header", nil, "Extra header of LLM requests as 'Name: value', e.g. for a gateway (repeatable)")
+	c.rootCmd.PersistentFlags().String("openai-organization", "", "OpenAI organization LLM requests are billed to")
+	c.rootCmd.PersistentFlags().String("openai-project", "", "OpenAI project LLM requests are billed to")
+	c.rootCmd.PersistentFlags().String("analysis-model", "", "Model analyzing failures, e.g. a cheaper one; the provider's model when empty")
+	c.rootCmd.PersistentFlags().String("fix-model", "", "Model generating fixes; the provider's model when empty")
+	c.rootCmd.PersistentFlags().Float64("escalation-confidence", DefaultEscalationConfidence, "Analysis confidence below which the analysis is re-run with the fix model; 0 disables")
+	c.rootCmd.PersistentFlags().Bool("log-chunking", false, "Summarize logs far longer than the analysis prompt in chunks instead of cutting their middle")
+	c.rootCmd.PersistentFlags().Float64("log-chunk-factor", DefaultLogChunkFactor, "How many times the analysis prompt's log budget logs must exceed to be chunked")
+	c.rootCmd.PersistentFlags().Int("log-chunk-bytes", DefaultLogChunkBytes, "Most bytes of each log chunk")
+	c.rootCmd.PersistentFlags().Int("log-chunk-overlap", DefaultLogChunkOverlapLines, "Lines each log chunk repeats from the previous one; negative disables overlap")
+	c.rootCmd.PersistentFlags().Int("log-chunk-max", DefaultLogChunkMaxChunks, "Most log chunks summarized per analysis, capping its LLM requests")
+	c.rootCmd.PersistentFlags().Bool("flaky-retry", false, "Re-run the failed jobs of failures that look flaky and skip the fix when they pass")
+	c.rootCmd.PersistentFlags().Duration("flaky-retry-max-age", DefaultFlakyRetryMaxAge, "How recent a success of the same workflow on the same commit marks a failure as flaky")
+	c.rootCmd.PersistentFlags().Bool("sarif-upload", false, "Upload the analysis of each fixed failure to GitHub code scanning as SARIF")
+	c.rootCmd.PersistentFlags().String("fix-history", "", "JSON file remembering fixes per failure, reused as a prior when a failure recurs")
+	c.rootCmd.PersistentFlags().String("prompt-dir", "", "Directory of prompt templates (failure_analysis.tmpl, fix_generation.tmpl, ...) overriding the built-in prompts")
 	c.rootCmd.PersistentFlags().Bool("verbose", false, "Enable verbose logging")
 	c.rootCmd.PersistentFlags().Bool("dry-run", false, "Dry run mode (no actual changes)")
+	c.rootCmd.PersistentFlags().Bool("show-diff", false, "Show unified diffs of fix changes in text output; analyze then also generates fixes to preview")
+	c.rootCmd.PersistentFlags().Bool("debug-prompts", false, "Capture the redacted LLM prompts and responses of analyses; analyze prints them after its output")
 	c.rootCmd.PersistentFlags().String("log-level", "info", "Log level (trace, debug, info, warn, error)")
 	c.rootCmd.PersistentFlags().String("log-format", "json", "Log format (json, text)")
+	c.rootCmd.PersistentFlags().String("output", OutputText, "Result output format (text, json, yaml)")
 }
 
 func (c *CLI) setupCommands() {
@@ -92,27 +351,80 @@ func (c *CLI) setupCommands() {
 	monitorCmd := &cobra.Command{
 		Use:   "monitor",
 		Short: "Monitor GitHub Actions workflows for failures",
-		Long:  "Continuously monitor GitHub Actions workflows and automatically fix failures when detected.",
-		RunE:  c.runMonitor,
+		Long: "Continuously monitor GitHub Actions workflows and automatically fix failures when detected.\n\n" +
+			"With --once the failed runs are checked a single time, e.g. from cron, and the command\n" +
+			"exits once their fixes finished: 0 when every fix succeeded, 2 when a fix failed and\n" +
+			"12 when there was nothing to fix.",
+		RunE: c.runMonitor,
 	}
+	monitorCmd.Flags().String("metrics-addr", "", "Serve Prometheus metrics on this address, e.g. :9090")
+	monitorCmd.Flags().Duration("drain-timeout", DefaultDrainTimeout, "How long shutdown waits for in-flight fixes before cancelling them")
+	monitorCmd.Flags().Duration("claim-lease", DefaultRunClaimLease, "How long a failed run claimed for fixing stays reserved when its fix does not complete")
+	monitorCmd.Flags().Bool("once", false, "Check for failed runs once, fix them and exit")
+	monitorCmd.Flags().String("pid-file", "", "Write the process ID to this file, refusing to start while the process it names is running")
+	monitorCmd.Flags().String("log-file", "", "Write logs to this file instead of stderr, rotating it by size")
+	monitorCmd.Flags().Int("log-max-size", defaultLogMaxSizeMB, "Size in megabytes at which the log file is rotated")
+	monitorCmd.Flags().Int("log-keep", defaultLogKeep, "Rotated log files kept")
 
 	// Analyze command
 	analyzeCmd := &cobra.Command{
-		Use:   "analyze [workflow-run-id]",
+		Use:   "analyze [workflow-run-id|run-url]",
 		Short: "Analyze a specific workflow failure",
-		Long:  "Analyze a specific GitHub Actions workflow run failure and provide detailed insights.",
-		Args:  cobra.ExactArgs(1),
-		RunE:  c.runAnalyze,
+		Long: "Analyze a specific GitHub Actions workflow run failure and provide detailed insights.\n" +
+			"The run is given by its ID or by the URL of the run or one of its jobs.\n\n" +
+			"With --from-file or --stdin the failure in a build log from any CI system is analyzed\n" +
+			"instead, without GitHub access; only the LLM provider and API key are required.\n\n" +
+			"With --watch the run is followed as it is re-run: each failed attempt is analyzed once it\n" +
+			"completes and compared with the previous one, until an attempt passes or the command is\n" +
+			"interrupted.",
+		Args: cobra.MaximumNArgs(1),
+		RunE: c.runAnalyze,
 	}
+	analyzeCmd.Flags().String("from-file", "", "Analyze the build log in this file instead of a workflow run, without GitHub access")
+	analyzeCmd.Flags().Bool("stdin", false, "Analyze the build log read from stdin instead of a workflow run, without GitHub access")
+	analyzeCmd.Flags().Bool("fixes", false, "Also generate fixes for the log analyzed with --from-file or --stdin")
+	analyzeCmd.Flags().String("language", "", "Language of the repository the log comes from, e.g. javascript, to guide the analysis")
+	analyzeCmd.Flags().String("sarif", "", "Also write the analysis to this file as SARIF 2.1.0, e.g. for GitHub code scanning")
+	analyzeCmd.Flags().Bool("watch", false, "Follow the run's attempts, analyzing each failed one as it completes")
+	analyzeCmd.Flags().Duration("watch-interval", workflowRunPollInterval, "How often --watch checks the run")
 
 	// Fix command
 	fixCmd := &cobra.Command{
-		Use:   "fix [workflow-run-id]",
+		Use:   "fix [workflow-run-id|run-url]",
 		Short: "Generate and apply fixes for a workflow failure",
-		Long:  "Generate fixes for a specific workflow failure, validate them, and create a pull request.",
+		Long: "Generate fixes for a specific workflow failure, validate them, and create a pull request.\n" +
+			"The run is given by its ID or by the URL of the run or one of its jobs.",
 		Args:  cobra.ExactArgs(1),
 		RunE:  c.runFix,
 	}
+	fixCmd.Flags().String("export-dir", "", "Write the validated fix to this directory (files/, fix.json, fix.patch) instead of opening a pull request")
+	fixCmd.Flags().Bool("interactive", false, "Review the candidate fixes and choose which one to open a pull request for, editing its title and body")
+	fixCmd.Flags().Int("select", 0, "Open a pull request for the Nth candidate fix instead of the highest confidence one")
+	fixCmd.Flags().Bool("progress", false, "Report each stage of the fix on stderr, as JSON lines with --output json or yaml")
+
+	// Fix batch command
+	fixBatchCmd := &cobra.Command{
+		Use:   "fix-batch",
+		Short: "Fix every current workflow failure",
+		Long: "Fix the failed workflow runs within the lookback window in one invocation, e.g. from a\n" +
+			"nightly workflow, and print a summary. Runs are filtered and clustered as by monitor.\n" +
+			"Exits with 0 when every fix succeeded, 1 when a fix errored, 9 when fixes ran but some\n" +
+			"found no valid fix and 12 when there was nothing to fix.",
+		Args: cobra.NoArgs,
+		RunE: c.runFixBatch,
+	}
+
+	// Review command
+	reviewCmd := &cobra.Command{
+		Use:   "review [pr-number]",
+		Short: "Fix the failing CI of an open pull request",
+		Long: "Fix the latest failed workflow run at the head of an open pull request and push the\n" +
+			"validated fix to its branch as a new commit, commenting what changed. Fixes for pull\n" +
+			"requests from forks are commented as suggestions instead. Exits with 9 when no fix\n" +
+			"passed validation and 12 when the pull request has no failed run.",
+		Args: cobra.ExactArgs(1),
+		RunE: c.runReview,
+	}
 
 	// Validate command
 	validateCmd := &cobra.Command{
@@ -123,6 +435,19 @@ func (c *CLI) setupCommands() {
 		RunE:  c.runValidate,
 	}
 
+	// Verify command
+	verifyCmd := &cobra.Command{
+		Use:   "verify [pr-number]",
+		Short: "Verify that a merged fix resolved its workflow failure",
+		Long: "Wait for the workflow a merged fix pull request was opened for to run on the target\n" +
+			"branch at the merge commit, record whether it succeeded and comment the outcome on the\n" +
+			"pull request. Exits with 2 when the workflow failed again or did not complete in time.",
+		Args: cobra.ExactArgs(1),
+		RunE: c.runVerify,
+	}
+	verifyCmd.Flags().Duration("timeout", DefaultVerificationTimeout, "How long after the merge the workflow has to complete")
+	verifyCmd.Flags().Bool("follow-up", false, "Analyze the workflow run when it failed again")
+
 	// Status command
 	statusCmd := &cobra.Command{
 		Use:   "status",
@@ -130,6 +455,9 @@ func (c *CLI) setupCommands() {
 		Long:  "Display current status, metrics, and operational information about the auto-fix agent.",
 		RunE:  c.runStatus,
 	}
+	statusCmd.Flags().Int64("audit", 0, "Show the audit trail of a workflow run instead of metrics")
+	statusCmd.Flags().Bool("costs", false, "Show LLM token usage and estimated cost by provider")
+	statusCmd.Flags().Bool("history", false, "Show the fixes remembered in the fix history instead of metrics")
 
 	// Config command
 	configCmd := &cobra.Command{
@@ -142,8 +470,12 @@ func (c *CLI) setupCommands() {
 	configInitCmd := &cobra.Command{
 		Use:   "init",
 		Short: "Initialize configuration file",
+		Long:  "Create a configuration file, prompting for each setting when run on a terminal. Secrets are written as ${GITHUB_TOKEN} and ${LLM_API_KEY} references.",
 		RunE:  c.runConfigInit,
 	}
+	configInitCmd.Flags().BoolP("yes", "y", false, "Use detected and default values without prompting")
+	configInitCmd.Flags().String("format", "", "Config file format (env, yaml); defaults to the --config file extension")
+	configInitCmd.Flags().Bool("force", false, "Overwrite an existing config file")
 
 	configShowCmd := &cobra.Command{
 		Use:   "show",
@@ -154,8 +486,17 @@ func (c *CLI) setupCommands() {
 	configValidateCmd := &cobra.Command{
 		Use:   "validate",
 		Short: "Validate configuration",
+		Long:  "Check the configuration offline, reporting each problem with the setting and where its value came from. With --live, also connect to GitHub and the LLM provider.",
 		RunE:  c.runConfigValidate,
 	}
+	configValidateCmd.Flags().Bool("live", false, "Also check the GitHub and LLM connections")
+
+	configShowPromptsCmd := &cobra.Command{
+		Use:   "show-prompts",
+		Short: "Show the effective prompt templates",
+		Long:  "Print each prompt template the agent renders its LLM prompts from, and whether it is built in or loaded from --prompt-dir.",
+		RunE:  c.runConfigShowPrompts,
+	}
 
 	// Test command
 	testCmd := &cobra.Command{
@@ -177,95 +518,457 @@ func (c *CLI) setupCommands() {
 		RunE:  c.runTestLLM,
 	}
 
+	// Doctor command
+	doctorCmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check the setup before running the agent",
+		Long: `Run preflight checks of the configuration, network access to GitHub and the LLM provider,
+the GitHub token and its permissions on the repository, Actions being enabled, the LLM
+provider and the Dagger engine. Each problem found comes with a remediation hint.
+The command exits with 2 when a check failed and 13 when checks only warned.`,
+		RunE: c.runDoctor,
+	}
+
 	// Add subcommands
-	configCmd.AddCommand(configInitCmd, configShowCmd, configValidateCmd)
+	configCmd.AddCommand(configInitCmd, configShowCmd, configValidateCmd, configShowPromptsCmd)
 	testCmd.AddCommand(testConnectionCmd, testLLMCmd)
-	c.rootCmd.AddCommand(monitorCmd, analyzeCmd, fixCmd, validateCmd, statusCmd, configCmd, testCmd)
+	c.rootCmd.AddCommand(monitorCmd, analyzeCmd, fixCmd, fixBatchCmd, reviewCmd, validateCmd, verifyCmd, statusCmd, configCmd, testCmd, doctorCmd)
 }
 
 // Command implementations
 
 func (c *CLI) runMonitor(cmd *cobra.Command, args []string) error {
+	closeLog, err := c.setupLogFile(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+	if pidFile, _ := cmd.Flags().GetString("pid-file"); pidFile != "" {
+		release, err := acquirePIDFile(pidFile)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
 	c.logger.Info("Starting workflow monitoring")
 
-	ctx := context.Background()
+	// SIGINT and SIGTERM cancel monitoring, which drains in-flight fixes before returning
+	ctx, stop := signal.NotifyContext(context.Background(), shutdownSignals...)
+	defer stop()
 	agent, err := c.initializeAgent(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to initialize agent: %w", err)
 	}
 
-	return agent.MonitorWorkflows(ctx)
+	drainTimeout, _ := cmd.Flags().GetDuration("drain-timeout")
+	claimLease, _ := cmd.Flags().GetDuration("claim-lease")
+	agent.WithDrainTimeout(drainTimeout).WithRunClaimLease(claimLease)
+	if once, _ := cmd.Flags().GetBool("once"); once {
+		return c.monitorOnce(ctx, agent)
+	}
+
+	metricsAddr, _ := cmd.Flags().GetString("metrics-addr")
+	err = agent.WithMetricsAddr(metricsAddr).MonitorWorkflows(ctx)
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		c.logger.Info("Shut down gracefully")
+		return nil
+	}
+	return err
 }
 
-func (c *CLI) runAnalyze(cmd *cobra.Command, args []string) error {
-	runIDStr := args[0]
-	runID, err := strconv.ParseInt(runIDStr, 10, 64)
+// monitorOnce runs a single monitoring pass and prints it. The error sets the exit code:
+// nil when every fix succeeded, a check failure when one failed and nothingToFix when no
+// failed run needed a fix.
+func (c *CLI) monitorOnce(ctx context.Context, agent *DaggerAutofix) error {
+	pass, err := agent.MonitorOnce(ctx)
+	if pass == nil {
+		return err
+	}
+	if printErr := c.printMonitorPass(pass); printErr != nil {
+		return printErr
+	}
+	switch {
+	case err != nil:
+		return err
+	case pass.FixesFailed > 0:
+		return checkFailure{fmt.Errorf("%d of %d fixes failed", pass.FixesFailed, pass.FailuresDetected)}
+	case !pass.FixesAttempted():
+		return nothingToFix{errors.New("no failed workflow runs to fix")}
+	}
+	return nil
+}
+
+// setupLogFile sends the CLI's logs, and so the agent's, to the --log-file file, returning
+// the function closing it
+func (c *CLI) setupLogFile(cmd *cobra.Command) (func(), error) {
+	path, _ := cmd.Flags().GetString("log-file")
+	if path == "" {
+		return func() {}, nil
+	}
+	maxSize, _ := cmd.Flags().GetInt("log-max-size")
+	keep, _ := cmd.Flags().GetInt("log-keep")
+	file, err := openRotatingFile(path, maxSize, keep)
 	if err != nil {
-		return fmt.Errorf("invalid workflow run ID: %w", err)
+		return nil, err
 	}
+	previous := c.logger.Out
+	c.logger.SetOutput(file)
+	return func() {
+		c.logger.SetOutput(previous)
+		file.Close()
+	}, nil
+}
 
-	c.logger.WithField("run_id", runID).Info("Analyzing workflow failure")
+// shutdownSignals are the signals that stop the monitor command
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+func (c *CLI) runAnalyze(cmd *cobra.Command, args []string) error {
+	fromFile, _ := cmd.Flags().GetString("from-file")
+	fromStdin, _ := cmd.Flags().GetBool("stdin")
+	if fromFile != "" || fromStdin {
+		if len(args) > 0 || (fromFile != "" && fromStdin) {
+			return fmt.Errorf("give a workflow run ID, --from-file or --stdin, not several")
+		}
+		return c.runAnalyzeLog(cmd, fromFile)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("%w: give a workflow run ID, --from-file or --stdin", ErrInvalidRunID)
+	}
+
+	if _, err := ParseRunReference(args[0]); err != nil {
+		return err
+	}
 
 	ctx := context.Background()
 	agent, err := c.initializeAgent(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to initialize agent: %w", err)
 	}
+	agent, runID, err := c.resolveRun(ctx, agent, args[0])
+	if err != nil {
+		return err
+	}
+	if watch, _ := cmd.Flags().GetBool("watch"); watch {
+		interval, _ := cmd.Flags().GetDuration("watch-interval")
+		return c.watchRun(agent.WithRunPollInterval(interval), runID)
+	}
+	c.logger.WithField("run_id", runID).Info("Analyzing workflow failure")
 
-	analysis, err := agent.AnalyzeFailure(ctx, runID)
+	analyses, err := agent.AnalyzeFailureJobs(ctx, runID)
 	if err != nil {
 		return fmt.Errorf("analysis failed: %w", err)
 	}
 
-	c.printAnalysisResult(analysis)
+	if len(analyses) == 1 {
+		err = c.printAnalysisResult(analyses[0])
+	} else {
+		err = c.printJobAnalyses(analyses)
+	}
+	if err != nil {
+		return err
+	}
+	sarifPath, _ := cmd.Flags().GetString("sarif")
+	if err := writeSARIFFile(sarifPath, analyses...); err != nil {
+		return err
+	}
+
+	// Preview the fixes AutoFix would validate for each analysis
+	if c.showDiff() && c.outputFormat() == OutputText {
+		for _, analysis := range analyses {
+			if insufficientData(analysis) {
+				continue
+			}
+			fixes, err := agent.generateFixes(ctx, analysis)
+			if err != nil {
+				return fmt.Errorf("fix generation failed: %w", err)
+			}
+			if err := c.printGeneratedFixes(fixes); err != nil {
+				return err
+			}
+		}
+	}
+	c.printInteractions(analyses...)
 	return nil
 }
 
-func (c *CLI) runFix(cmd *cobra.Command, args []string) error {
-	runIDStr := args[0]
-	runID, err := strconv.ParseInt(runIDStr, 10, 64)
+// watchRun prints the analysis of each attempt of a run as it completes, until an attempt
+// passes or SIGINT or SIGTERM stops watching
+func (c *CLI) watchRun(agent *DaggerAutofix, runID int64) error {
+	ctx, stop := signal.NotifyContext(context.Background(), shutdownSignals...)
+	defer stop()
+
+	err := agent.WatchRun(ctx, runID, c.printAttemptAnalysis)
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		c.logger.Info("Stopped watching the workflow run")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("watch failed: %w", err)
+	}
+	return nil
+}
+
+// printAttemptAnalysis prints a completed attempt of a watched run
+func (c *CLI) printAttemptAnalysis(attempt *AttemptAnalysis) error {
+	return c.render(attempt, func(w io.Writer) {
+		fmt.Fprintf(w, "\n=== Attempt %d: %s ===\n", attempt.Attempt, valueOr(attempt.Run.Conclusion, attempt.Run.Status))
+		if comparison := attempt.Comparison; comparison != nil {
+			fmt.Fprintf(w, "%s\n", comparison.Summary)
+			if comparison.RootCauseChanged {
+				fmt.Fprintf(w, "Previous Root Cause: %s\n", comparison.PreviousRootCause)
+			}
+		}
+		if attempt.Analysis != nil {
+			fmt.Fprintln(w)
+			writeAnalysis(w, attempt.Analysis)
+		}
+		fmt.Fprintln(w)
+	})
+}
+
+// runAnalyzeLog analyzes the build log in file, or on stdin when file is empty, without GitHub
+func (c *CLI) runAnalyzeLog(cmd *cobra.Command, file string) error {
+	in := cmd.InOrStdin()
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("failed to open log: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	logText, err := autofix.ReadLog(in)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	agent, err := c.initializeLogAgent(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialize agent: %w", err)
+	}
+	withFixes, _ := cmd.Flags().GetBool("fixes")
+	language, _ := cmd.Flags().GetString("language")
+	sarifPath, _ := cmd.Flags().GetString("sarif")
+	return c.analyzeLog(ctx, agent, logText, RepositoryContext{Language: language}, withFixes, sarifPath)
+}
+
+// writeSARIFFile writes analyses to path as a SARIF log, nothing when path is empty
+func writeSARIFFile(path string, analyses ...*FailureAnalysisResult) error {
+	if path == "" {
+		return nil
+	}
+	sarif, err := sarifReport(analyses...)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, sarif, 0o644); err != nil {
+		return fmt.Errorf("failed to write SARIF: %w", err)
+	}
+	return nil
+}
+
+// logAnalysisResult is the output of analyze --fixes for a log
+type logAnalysisResult struct {
+	Analysis *FailureAnalysisResult `json:"analysis"`
+	Fixes    []*ProposedFix         `json:"fixes"`
+}
+
+// analyzeLog analyzes logText with agent and prints the analysis, with the fixes generated for
+// it when withFixes is set. The analysis is also written to sarifPath as SARIF when set.
+func (c *CLI) analyzeLog(ctx context.Context, agent *DaggerAutofix, logText string, hints RepositoryContext, withFixes bool, sarifPath string) error {
+	analysis, err := agent.AnalyzeLogText(ctx, logText, hints)
+	if err != nil {
+		return fmt.Errorf("analysis failed: %w", err)
+	}
+	if err := writeSARIFFile(sarifPath, analysis); err != nil {
+		return err
+	}
+	if !withFixes {
+		if err := c.printAnalysisResult(analysis); err != nil {
+			return err
+		}
+		c.printInteractions(analysis)
+		return nil
+	}
+
+	fixes, err := agent.generateFixes(ctx, analysis)
 	if err != nil {
-		return fmt.Errorf("invalid workflow run ID: %w", err)
+		return fmt.Errorf("fix generation failed: %w", err)
+	}
+	return c.render(logAnalysisResult{Analysis: analysis, Fixes: fixes}, func(w io.Writer) {
+		fmt.Fprintf(w, "\n=== Failure Analysis Result ===\n")
+		writeAnalysis(w, analysis)
+		c.writeGeneratedFixes(w, fixes)
+		c.writeInteractions(w, []*FailureAnalysisResult{analysis})
+	})
+}
+
+func (c *CLI) runFix(cmd *cobra.Command, args []string) error {
+	if _, err := ParseRunReference(args[0]); err != nil {
+		return err
 	}
 
 	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	interactive, _ := cmd.Flags().GetBool("interactive")
+	selected, _ := cmd.Flags().GetInt("select")
+	review := fixReviewOptions{interactive: interactive, selected: selected, dryRun: dryRun}
+	if err := review.validate(cmd.InOrStdin()); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	agent, err := c.initializeAgent(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialize agent: %w", err)
+	}
+	agent, runID, err := c.resolveRun(ctx, agent, args[0])
+	if err != nil {
+		return err
+	}
 	c.logger.WithFields(logrus.Fields{
 		"run_id":  runID,
 		"dry_run": dryRun,
 	}).Info("Generating and applying fix")
 
-	ctx := context.Background()
+	if interactive || selected != 0 {
+		return c.reviewFix(ctx, agent, runID, review)
+	}
+	showProgress, _ := cmd.Flags().GetBool("progress")
+	progress := c.newProgressPrinter(showProgress)
+	if progress != nil {
+		agent.WithProgressFunc(progress.report)
+	}
+	if exportDir, _ := cmd.Flags().GetString("export-dir"); exportDir != "" {
+		return c.exportFix(ctx, agent, runID, exportDir, progress)
+	}
+
+	// Dry-run still validates fixes but stops before opening a pull request
+	result, err := agent.WithDryRun(dryRun).AutoFix(ctx, runID)
+	progress.finish()
+	if err != nil {
+		return fmt.Errorf("auto-fix failed: %w", err)
+	}
+
+	if err := c.printAutoFixResult(result); err != nil {
+		return err
+	}
+	if reason, ok := result.Metadata["logs_unavailable"].(string); ok {
+		return checkFailure{fmt.Errorf("%w: %s", ErrLogsUnavailable, reason)}
+	}
+	if !result.Success {
+		return checkFailure{fmt.Errorf("auto-fix did not produce a valid fix")}
+	}
+	return nil
+}
+
+// resolveRun resolves a workflow run argument, an ID or a run or job URL, to the run's ID and
+// the agent of its repository, suggesting the flag that selects the run's repository or host
+// when the agent is not configured for it
+func (c *CLI) resolveRun(ctx context.Context, agent *DaggerAutofix, value string) (*DaggerAutofix, int64, error) {
+	repoAgent, runID, err := agent.ResolveRunReference(ctx, value)
+	if !errors.Is(err, ErrRunRepositoryMismatch) {
+		return repoAgent, runID, err
+	}
+	ref, _ := ParseRunReference(value)
+	if host := agent.webHost(); ref.Host != host && ref.Host != "www."+host {
+		return nil, 0, fmt.Errorf("%w; pass --github-api-url for the GitHub Enterprise host %s", err, ref.Host)
+	}
+	return nil, 0, fmt.Errorf("%w; pass --repo %s to use that repository", err, ref.Repository())
+}
+
+// runFixBatch fixes the current failed runs and prints a summary
+func (c *CLI) runFixBatch(cmd *cobra.Command, args []string) error {
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	ctx, stop := signal.NotifyContext(context.Background(), shutdownSignals...)
+	defer stop()
 	agent, err := c.initializeAgent(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to initialize agent: %w", err)
 	}
 
-	if dryRun {
-		// In dry-run mode, only analyze and generate fixes
-		analysis, err := agent.AnalyzeFailure(ctx, runID)
-		if err != nil {
-			return fmt.Errorf("analysis failed: %w", err)
-		}
+	results, err := agent.WithDryRun(dryRun).AutoFixAll(ctx)
+	if printErr := c.printBatchResults(results); printErr != nil {
+		return printErr
+	}
+	return batchFixError(results, err)
+}
 
-		fixes, err := agent.failureEngine.GenerateFixes(ctx, analysis)
-		if err != nil {
-			return fmt.Errorf("fix generation failed: %w", err)
-		}
+// batchFixError returns the error setting the exit code of fix-batch: a hard error when a fix
+// errored or runs could not be listed, ErrNoValidFixes when some fixes found no valid fix and
+// nothingToFix when no failed run needed a fix
+func batchFixError(results []*AutoFixResult, err error) error {
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.batchOutcome()]++
+	}
+	switch {
+	case err != nil:
+		return err
+	case counts[BatchError] > 0:
+		return fmt.Errorf("%d of %d fixes failed with an error", counts[BatchError], len(results))
+	case counts[BatchNoValidFix] > 0:
+		return fmt.Errorf("%w for %d of %d failed runs", ErrNoValidFixes, counts[BatchNoValidFix], len(results))
+	case len(results) == 0:
+		return nothingToFix{errors.New("no failed workflow runs to fix")}
+	}
+	return nil
+}
 
-		c.printAnalysisResult(analysis)
-		c.printGeneratedFixes(fixes)
-		return nil
+// runReview fixes the failing CI of an open pull request on the pull request itself
+func (c *CLI) runReview(cmd *cobra.Command, args []string) error {
+	prNumber, err := parsePRNumber(args[0])
+	if err != nil {
+		return err
 	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	c.logger.WithFields(logrus.Fields{
+		"pr_number": prNumber,
+		"dry_run":   dryRun,
+	}).Info("Fixing the failing pull request")
 
-	result, err := agent.AutoFix(ctx, runID)
+	ctx := context.Background()
+	agent, err := c.initializeAgent(ctx)
 	if err != nil {
-		return fmt.Errorf("auto-fix failed: %w", err)
+		return fmt.Errorf("failed to initialize agent: %w", err)
 	}
 
-	c.printAutoFixResult(result)
+	result, err := agent.WithDryRun(dryRun).FixExistingPR(ctx, prNumber)
+	if errors.Is(err, errNoFailedPRRun) {
+		return nothingToFix{err}
+	}
+	if err != nil {
+		return fmt.Errorf("review failed: %w", err)
+	}
+	if err := c.printAutoFixResult(result); err != nil {
+		return err
+	}
+	if !result.Success {
+		return checkFailure{fmt.Errorf("review did not produce a valid fix for pull request #%d", prNumber)}
+	}
 	return nil
 }
 
+// exportFix writes the validated fix for a run to dir for pipelines that apply it themselves
+func (c *CLI) exportFix(ctx context.Context, agent *DaggerAutofix, runID int64, dir string, progress *progressPrinter) error {
+	result, export, err := agent.exportFix(ctx, runID)
+	progress.finish()
+	if err != nil {
+		return fmt.Errorf("fix export failed: %w", err)
+	}
+	if err := export.writeTo(dir); err != nil {
+		return err
+	}
+	result.Metadata["export_dir"] = dir
+	c.logger.WithFields(logrus.Fields{
+		"run_id": runID,
+		"dir":    dir,
+		"files":  len(export.manifest.Files),
+	}).Info("Exported fix")
+	return c.printAutoFixResult(result)
+}
+
 func (c *CLI) runValidate(cmd *cobra.Command, args []string) error {
 	branch := args[0]
 	c.logger.WithField("branch", branch).Info("Running validation")
@@ -281,11 +984,57 @@ func (c *CLI) runValidate(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("validation failed: %w", err)
 	}
 
-	c.printTestResult(testResult)
+	if err := c.printTestResult(testResult); err != nil {
+		return err
+	}
+	if !testResult.Success {
+		return checkFailure{fmt.Errorf("validation failed: %d of %d tests failed, coverage %s",
+			testResult.FailedTests, testResult.TotalTests, testResult.coverageText())}
+	}
+	return nil
+}
+
+func (c *CLI) runVerify(cmd *cobra.Command, args []string) error {
+	prNumber, err := parsePRNumber(args[0])
+	if err != nil {
+		return err
+	}
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	followUp, _ := cmd.Flags().GetBool("follow-up")
+	c.logger.WithField("pr_number", prNumber).Info("Verifying merged fix")
+
+	ctx := context.Background()
+	agent, err := c.initializeAgent(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to initialize agent: %w", err)
+	}
+	return c.verifyFix(ctx, agent.WithFixVerification(timeout, followUp), prNumber)
+}
+
+// verifyFix verifies a merged fix PR with agent and prints the outcome
+func (c *CLI) verifyFix(ctx context.Context, agent *DaggerAutofix, prNumber int) error {
+	result, err := agent.VerifyFix(ctx, prNumber)
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	if err := c.printVerificationResult(result); err != nil {
+		return err
+	}
+	if !result.Verified() {
+		return checkFailure{fmt.Errorf("fix #%d is unverified", prNumber)}
+	}
 	return nil
 }
 
 func (c *CLI) runStatus(cmd *cobra.Command, args []string) error {
+	if cmd.Flags().Changed("audit") {
+		runID, _ := cmd.Flags().GetInt64("audit")
+		return c.printAuditTrail(runID)
+	}
+	if history, _ := cmd.Flags().GetBool("history"); history {
+		return c.printFixHistory()
+	}
+
 	c.logger.Info("Getting agent status")
 
 	ctx := context.Background()
@@ -299,23 +1048,77 @@ func (c *CLI) runStatus(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to get metrics: %w", err)
 	}
 
-	c.printMetrics(metrics)
-	return nil
+	if costs, _ := cmd.Flags().GetBool("costs"); costs {
+		return c.printCosts(metrics)
+	}
+	return c.printMetrics(metrics)
 }
 
 func (c *CLI) runConfigInit(cmd *cobra.Command, args []string) error {
 	c.logger.Info("Initializing configuration")
 
 	var configFile string
+	var configChanged bool
 	// Safely navigate the command hierarchy
 	if cmd.Parent() != nil && cmd.Parent().Parent() != nil {
-		configFile, _ = cmd.Parent().Parent().PersistentFlags().GetString("config")
+		root := cmd.Parent().Parent()
+		configFile, _ = root.PersistentFlags().GetString("config")
+		configChanged = root.PersistentFlags().Changed("config")
+	}
+	format, _ := cmd.Flags().GetString("format")
+	if format == "" {
+		format = ConfigFormatEnv
+		if isYAMLConfig(configFile) {
+			format = ConfigFormatYAML
+		}
+	}
+	if err := validateConfigFormat(format); err != nil {
+		return err
 	}
-	// Use default filename if none provided
-	if configFile == "" {
+	// Use the default filename for the format if none provided
+	if configFile == "" || (!configChanged && format == ConfigFormatYAML) {
 		configFile = ".github-autofix.env"
+		if format == ConfigFormatYAML {
+			configFile = yamlConfigName
+		}
+	}
+
+	yes, _ := cmd.Flags().GetBool("yes")
+	force, _ := cmd.Flags().GetBool("force")
+	out := cmd.OutOrStdout()
+
+	answers := c.initDefaults(c.getCurrentConfig(c.rootCmd), out)
+	var wizard *configWizard
+	if !yes && stdinIsTerminal(cmd.InOrStdin()) {
+		wizard = newConfigWizard(cmd.InOrStdin(), out)
+		var err error
+		if answers, err = wizard.run(answers); err != nil {
+			return err
+		}
+	}
+
+	if problems := validateAnswers(answers, configFile); len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintln(out, problem)
+		}
+		return fmt.Errorf("generated configuration is invalid: %d problem(s) found", len(problems))
+	}
+	content, err := renderConfigFile(format, answers)
+	if err != nil {
+		return err
 	}
-	return c.createDefaultConfig(configFile)
+
+	if existing, err := os.ReadFile(configFile); err == nil && !force {
+		if string(existing) == content {
+			fmt.Fprintf(out, "%s is already up to date\n", configFile)
+			return nil
+		}
+		if wizard == nil || wizard.confirm(fmt.Sprintf("%s already exists. Show what would change?", configFile)) {
+			fmt.Fprintf(out, "--- %s\n+++ %s (generated)\n%s", configFile, configFile, lineDiff(string(existing), content))
+		}
+		return fmt.Errorf("%s already exists, use --force to overwrite", configFile)
+	}
+	return c.writeConfigFile(configFile, content)
 }
 
 func (c *CLI) runConfigShow(cmd *cobra.Command, args []string) error {
@@ -329,16 +1132,43 @@ func (c *CLI) runConfigShow(cmd *cobra.Command, args []string) error {
 func (c *CLI) runConfigValidate(cmd *cobra.Command, args []string) error {
 	c.logger.Info("Validating configuration")
 
-	ctx := context.Background()
-	_, err := c.initializeAgent(ctx)
-	if err != nil {
-		return fmt.Errorf("configuration validation failed: %w", err)
+	problems := validateCLIConfig(c.getCurrentConfig(c.rootCmd))
+	for _, problem := range problems {
+		fmt.Fprintln(cmd.OutOrStdout(), problem)
+	}
+	if len(problems) > 0 {
+		return checkFailure{fmt.Errorf("configuration validation failed: %d problem(s) found", len(problems))}
+	}
+
+	if live, _ := cmd.Flags().GetBool("live"); live {
+		ctx := context.Background()
+		if _, err := c.initializeAgent(ctx); err != nil {
+			return fmt.Errorf("configuration validation failed: %w", err)
+		}
 	}
 
 	c.logger.Info("Configuration is valid")
 	return nil
 }
 
+func (c *CLI) runConfigShowPrompts(cmd *cobra.Command, args []string) error {
+	config := c.getCurrentConfig(c.rootCmd)
+	prompts := loadPromptTemplates()
+	if config.PromptDir != "" {
+		var err error
+		if prompts, err = loadPromptTemplateDir(config.PromptDir); err != nil {
+			return err
+		}
+	}
+	templates := prompts.list()
+	return c.render(templates, func(w io.Writer) {
+		for _, tmpl := range templates {
+			fmt.Fprintf(w, "=== %s (%s) ===\n%s\n", tmpl.File, tmpl.Source, strings.TrimRight(tmpl.Template, "\n"))
+			fmt.Fprintln(w)
+		}
+	})
+}
+
 func (c *CLI) runTestConnection(cmd *cobra.Command, args []string) error {
 	c.logger.Info("Testing connections")
 
@@ -359,8 +1189,12 @@ func (c *CLI) runTestLLM(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 
 	// Create LLM client for testing
+	headers, err := config.llmHeaders()
+	if err != nil {
+		return err
+	}
 	apiKey := dag.SetSecret("llm-api-key", config.LLMAPIKey)
-	llmClient, err := NewLLMClient(ctx, LLMProvider(config.LLMProvider), apiKey)
+	llmClient, err := NewLLMClient(withLLMHeaders(ctx, llmHeaderMap(headers)), LLMProvider(config.LLMProvider), apiKey, c.logger)
 	if err != nil {
 		return fmt.Errorf("failed to create LLM client: %w", err)
 	}
@@ -384,88 +1218,315 @@ func (c *CLI) runTestLLM(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// runDoctor runs the preflight checks and prints their findings. Missing settings are
+// findings too, so the agent is built but not initialized.
+func (c *CLI) runDoctor(cmd *cobra.Command, args []string) error {
+	c.logger.Info("Running preflight checks")
+
+	agent, err := c.buildAgent(c.getCurrentConfig(c.rootCmd), false)
+	if err != nil {
+		return fmt.Errorf("failed to configure agent: %w", err)
+	}
+	report, err := agent.Preflight(context.Background())
+	if err != nil {
+		return fmt.Errorf("preflight checks failed: %w", err)
+	}
+	if err := c.printPreflightReport(report); err != nil {
+		return err
+	}
+
+	switch report.Status {
+	case PreflightFail:
+		return checkFailure{fmt.Errorf("%d preflight check(s) failed", report.count(PreflightFail))}
+	case PreflightWarn:
+		return preflightWarnings{fmt.Errorf("%d preflight check(s) warned", report.count(PreflightWarn))}
+	}
+	return nil
+}
+
 // Helper methods
 
 func (c *CLI) setupLogging() {
 	cfg := c.getCurrentConfig(c.rootCmd)
 
-	// Set log level
-	level, err := logrus.ParseLevel(cfg.LogLevel)
-	if err != nil {
-		level = logrus.InfoLevel
-	}
+	level := cfg.LogLevel
 	if cfg.Verbose {
-		level = logrus.DebugLevel
+		level = logrus.DebugLevel.String()
 	}
-	c.logger.SetLevel(level)
-
-	// Set log format
-	switch cfg.LogFormat {
-	case "text":
-		c.logger.SetFormatter(&logrus.TextFormatter{})
-	default:
-		c.logger.SetFormatter(&logrus.JSONFormatter{})
+	// Invalid settings fall back to info level JSON logs; config validate reports them
+	c.logger.SetLevel(logrus.InfoLevel)
+	c.logger.SetFormatter(&logrus.JSONFormatter{})
+	if err := configureLogger(c.logger, level, cfg.LogFormat); err != nil {
+		c.logger.WithError(err).Warn("Invalid logging configuration")
 	}
 }
 
 func (c *CLI) loadConfiguration() {
+	c.yamlConfig = nil
 	configFile, _ := c.rootCmd.PersistentFlags().GetString("config")
+	if isYAMLConfig(configFile) {
+		c.loadYAMLConfigFile(configFile)
+		return
+	}
 	if configFile != "" {
 		if err := godotenv.Load(configFile); err != nil {
 			c.logger.WithError(err).Debug("Could not load config file, using environment variables")
 		}
 	}
+	if path := discoverYAMLConfig(); path != "" {
+		c.loadYAMLConfigFile(path)
+	}
 }
 
 func (c *CLI) initializeAgent(ctx context.Context) (*DaggerAutofix, error) {
+	return c.newAgent(ctx, false)
+}
+
+// initializeLogAgent initializes an agent that only analyzes logs, so GitHub credentials and
+// a repository are optional
+func (c *CLI) initializeLogAgent(ctx context.Context) (*DaggerAutofix, error) {
+	return c.newAgent(ctx, true)
+}
+
+// newAgent builds and initializes the agent from the current configuration, without GitHub
+// when logsOnly is set
+func (c *CLI) newAgent(ctx context.Context, logsOnly bool) (*DaggerAutofix, error) {
 	config := c.getCurrentConfig(c.rootCmd)
 
 	// Validate required configuration
-	if config.GitHubToken == "" {
-		return nil, fmt.Errorf("GitHub token is required")
+	if !logsOnly {
+		if config.usesGitHubApp() {
+			if config.GitHubAppID == 0 || config.GitHubInstallationID == 0 || config.GitHubPrivateKeyFile == "" {
+				return nil, fmt.Errorf("GitHub App authentication requires app ID, installation ID, and private key file")
+			}
+		} else if config.GitHubToken == "" {
+			return nil, fmt.Errorf("GitHub token is required")
+		}
 	}
 	if config.LLMAPIKey == "" {
 		return nil, fmt.Errorf("LLM API key is required")
 	}
-	if config.RepoOwner == "" || config.RepoName == "" {
+	if !logsOnly && (config.RepoOwner == "" || config.RepoName == "") && len(config.Repositories) == 0 && config.Organization == "" {
 		return nil, fmt.Errorf("repository owner and name are required")
 	}
 
+	agent, err := c.buildAgent(config, logsOnly)
+	if err != nil {
+		return nil, err
+	}
+	agent, err = agent.Initialize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Mask secrets in the CLI's own log output too
+	c.logger.AddHook(newRedactionHook(agent.redactor))
+	return agent, nil
+}
+
+// buildAgent configures an agent from config without initializing it, without GitHub when
+// logsOnly is set
+func (c *CLI) buildAgent(config *CLIConfig, logsOnly bool) (*DaggerAutofix, error) {
+	prPolicy, err := ParsePRPolicy(os.Environ())
+	if err != nil {
+		return nil, fmt.Errorf("invalid PR policy: %w", err)
+	}
+	fixTypes, err := ParseFixTypeConstraints(os.Environ())
+	if err != nil {
+		return nil, err
+	}
+
 	// Create agent - handle case where dag is nil (in tests)
 	var agent *DaggerAutofix
 	if dag != nil {
+		// The agent logs with the CLI's settings
 		agent = New().
-			WithGitHubToken(dag.SetSecret("github-token", config.GitHubToken)).
-			WithLLMProvider(config.LLMProvider, dag.SetSecret("llm-api-key", config.LLMAPIKey)).
+			WithLogsOnly(logsOnly).
+			WithLogLevel(c.logger.GetLevel().String()).
+			WithLogFormat(logFormat(c.logger)).
+			WithLogOutput(c.logger.Out)
+		// Logs only agents never call GitHub, so they get no GitHub credentials
+		switch {
+		case logsOnly:
+		case config.usesGitHubApp():
+			privateKey, err := os.ReadFile(config.GitHubPrivateKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+			}
+			agent = agent.WithGitHubApp(config.GitHubAppID, config.GitHubInstallationID, dag.SetSecret("github-app-private-key", string(privateKey)))
+		case config.GitHubToken != "":
+			agent = agent.WithGitHubToken(dag.SetSecret("github-token", config.GitHubToken))
+		}
+		// A missing API key stays unset, for doctor to report it
+		var llmAPIKey *dagger.Secret
+		if config.LLMAPIKey != "" {
+			llmAPIKey = dag.SetSecret("llm-api-key", config.LLMAPIKey)
+		}
+		agent = agent.
+			WithLLMProvider(config.LLMProvider, llmAPIKey).
 			WithRepository(config.RepoOwner, config.RepoName).
 			WithTargetBranch(config.TargetBranch).
-			WithMinCoverage(config.MinCoverage)
-		
-		// Initialize agent
-		return agent.Initialize(ctx)
+			WithMinCoverage(config.MinCoverage).
+			WithRequireCoverage(config.RequireCoverage).
+			WithAutoPRPolicy(prPolicy).
+			WithAllowedFixTypes(fixTypes).
+			WithPRDefaults(config.prDefaults())
+		if len(config.Repositories) > 0 {
+			agent = agent.WithRepositories(config.Repositories...)
+		}
+		if config.Organization != "" {
+			agent = agent.
+				WithOrganization(config.Organization).
+				WithRepoFilter(config.RepoInclude, config.RepoExclude).
+				WithArchivedAndForkedRepos(config.IncludeArchived, config.IncludeForks)
+		}
+		if config.GitHubAPIURL != "" {
+			agent = agent.WithGitHubBaseURL(config.GitHubAPIURL, config.GitHubUploadURL)
+		}
+		if config.NotificationWebhook != "" {
+			agent = agent.
+				WithNotificationWebhook(dag.SetSecret("notification-webhook", config.NotificationWebhook)).
+				WithNotificationFormat(config.NotificationFormat)
+		}
+		if config.PRCommentMode != "" {
+			agent = agent.WithPRCommentMode(config.PRCommentMode)
+		}
+		if config.TestNetwork != "" {
+			agent = agent.WithTestNetwork(config.TestNetwork)
+		}
+		if config.AuditLog != "" {
+			agent = agent.WithAuditLog(config.AuditLog)
+		}
+		if len(config.RedactionPatterns) > 0 {
+			agent = agent.WithRedactionPatterns(config.RedactionPatterns)
+		}
+		if len(config.AllowedPaths) > 0 || len(config.DeniedPaths) > 0 {
+			agent = agent.WithPathPolicy(config.AllowedPaths, config.DeniedPaths)
+		}
+		agent = agent.WithFixGuardrails(config.fixGuardrails())
+		classification := config.fileClassification()
+		agent = agent.WithBinaryExtensions(classification.BinaryExtensions)
+		for _, generated := range classification.GeneratedFiles {
+			agent = agent.WithGeneratedFile(generated.Pattern, generated.Command)
+		}
+		if !config.NoLLMCache {
+			agent = agent.WithLLMCache(config.LLMCacheDir, config.LLMCacheTTL)
+		}
+		if price, ok := config.llmPrice(); ok {
+			agent = agent.WithLLMPrice(string(price.Provider), price.InputPer1K, price.OutputPer1K)
+		}
+		headers, err := config.llmHeaders()
+		if err != nil {
+			return nil, err
+		}
+		for _, header := range headers {
+			agent = agent.WithLLMHeader(header.Name, header.Value)
+		}
+		agent = agent.
+			WithAnalysisModel(config.AnalysisModel).
+			WithFixModel(config.FixModel).
+			WithEscalationConfidence(config.EscalationConfidence)
+		if config.LogChunking {
+			agent = agent.WithLogChunking(config.logChunking())
+		}
+		if config.FlakyRetry {
+			agent = agent.WithFlakyRetry(true, config.FlakyRetryMaxAge)
+		}
+		if config.SARIFUpload {
+			agent = agent.WithSARIFUpload(true)
+		}
+		if config.FixHistory != "" {
+			agent = agent.WithFixHistory(config.FixHistory)
+		}
+		if config.PromptDir != "" {
+			agent = agent.WithPromptTemplates(config.PromptDir)
+		}
+		if c.debugPrompts() {
+			agent = agent.WithPromptCapture(true)
+		}
+		return agent, nil
 	} else {
 		// For testing without Dagger context
 		return nil, fmt.Errorf("dagger client not available (testing environment)")
 	}
 }
 
+// getCurrentConfig resolves the configuration with the precedence flags > env > config file > defaults
 func (c *CLI) getCurrentConfig(cmd *cobra.Command) *CLIConfig {
 	config := &CLIConfig{}
-
-	// Get values from flags or environment variables
-	config.GitHubToken = c.getStringValue(cmd, "github-token", "GITHUB_TOKEN")
-	config.LLMProvider = c.getStringValue(cmd, "llm-provider", "LLM_PROVIDER")
-	config.LLMAPIKey = c.getStringValue(cmd, "llm-api-key", "LLM_API_KEY")
-	config.RepoOwner = c.getStringValue(cmd, "repo-owner", "REPO_OWNER")
-	config.RepoName = c.getStringValue(cmd, "repo-name", "REPO_NAME")
-	config.TargetBranch = c.getStringValue(cmd, "target-branch", "TARGET_BRANCH")
-	config.MinCoverage = c.getIntValue(cmd, "min-coverage", "MIN_COVERAGE")
-
-	config.Verbose = c.getBoolValue(cmd, "verbose", "VERBOSE")
-	config.DryRun = c.getBoolValue(cmd, "dry-run", "DRY_RUN")
-	config.LogLevel = c.getStringValue(cmd, "log-level", "LOG_LEVEL")
-	config.LogFormat = c.getStringValue(cmd, "log-format", "LOG_FORMAT")
+	r := &configResolver{cli: c, cmd: cmd, file: c.yamlConfig, sources: make(map[string]valueSource)}
+
+	config.GitHubToken = r.stringValue("github.token")
+	config.GitHubAppID = r.int64Value("github.app_id")
+	config.GitHubInstallationID = r.int64Value("github.installation_id")
+	config.GitHubPrivateKeyFile = r.stringValue("github.private_key_file")
+	config.GitHubAPIURL = r.stringValue("github.api_url")
+	config.GitHubUploadURL = r.stringValue("github.upload_url")
+	config.LLMProvider = r.stringValue("llm.provider")
+	config.LLMAPIKey = r.stringValue("llm.api_key")
+	config.RepoOwner = r.stringValue("github.owner")
+	config.RepoName = r.stringValue("github.repo")
+	config.Repositories = r.listValue("github.repositories")
+	config.Organization = r.stringValue("github.organization")
+	config.RepoInclude = r.listValue("github.repo_include")
+	config.RepoExclude = r.listValue("github.repo_exclude")
+	config.IncludeArchived = r.boolValue("github.include_archived")
+	config.IncludeForks = r.boolValue("github.include_forks")
+	config.TargetBranch = r.stringValue("github.target_branch")
+	config.MinCoverage = r.intValue("monitoring.min_coverage")
+	config.RequireCoverage = r.boolValue("monitoring.require_coverage")
+	config.TestNetwork = r.stringValue("monitoring.test_network")
+	config.PRReviewers = r.listValue("pr.reviewers")
+	config.PRAssignees = r.listValue("pr.assignees")
+	config.PRLabels = r.listValue("pr.labels")
+	config.PRAutoMerge = r.boolValue("pr.auto_merge")
+	config.PRCommentMode = r.stringValue("pr.comment_mode")
+	config.PRDraft = r.boolValue("pr.draft")
+	config.PRCoverageGist = r.boolValue("pr.coverage_gist")
+	config.NotificationWebhook = r.stringValue("notifications.webhook_url")
+	config.NotificationFormat = r.stringValue("notifications.format")
+	config.AuditLog = r.stringValue("audit.log")
+	config.RedactionPatterns = r.listValue("redaction.patterns")
+	config.AllowedPaths = r.listValue("paths.allow")
+	config.DeniedPaths = r.listValue("paths.deny")
+	config.MaxFixFiles = r.intValue("guardrails.max_files")
+	config.MaxFixLines = r.intValue("guardrails.max_lines")
+	config.ProtectedPaths = r.listValue("guardrails.protected_paths")
+	config.GuardrailAction = r.stringValue("guardrails.action")
+	config.BinaryExtensions = r.listValue("files.binary_extensions")
+	config.GeneratedFiles = r.listValue("files.generated")
+	config.LLMCacheDir = r.stringValue("llm.cache_dir")
+	config.LLMCacheTTL = r.durationValue("llm.cache_ttl")
+	config.NoLLMCache = r.boolValue("llm.no_cache")
+	config.LLMInputPrice = r.floatValue("llm.input_price_per_1k")
+	config.LLMOutputPrice = r.floatValue("llm.output_price_per_1k")
+	config.LLMHeaders = r.listValue("llm.headers")
+	config.OpenAIOrganization = r.stringValue("llm.openai_organization")
+	config.OpenAIProject = r.stringValue("llm.openai_project")
+	config.AnalysisModel = r.stringValue("llm.analysis_model")
+	config.FixModel = r.stringValue("llm.fix_model")
+	config.EscalationConfidence = r.floatValue("llm.escalation_confidence")
+	config.LogChunking = r.boolValue("llm.log_chunking")
+	config.LogChunkFactor = r.floatValue("llm.log_chunk_factor")
+	config.LogChunkBytes = r.intValue("llm.log_chunk_bytes")
+	config.LogChunkOverlap = r.intValue("llm.log_chunk_overlap")
+	config.LogChunkMax = r.intValue("llm.log_chunk_max")
+	config.FlakyRetry = r.boolValue("monitoring.flaky_retry")
+	config.FlakyRetryMaxAge = r.durationValue("monitoring.flaky_retry_max_age")
+	config.SARIFUpload = r.boolValue("monitoring.sarif_upload")
+	config.FixHistory = r.stringValue("history.path")
+	config.PromptDir = r.stringValue("prompts.dir")
+
+	config.Verbose = r.boolValue("logging.verbose")
+	config.DryRun = r.boolValue("monitoring.dry_run")
+	config.LogLevel = r.stringValue("logging.level")
+	config.LogFormat = r.stringValue("logging.format")
 	config.ConfigFile, _ = cmd.PersistentFlags().GetString("config")
+	if c.yamlConfig != nil {
+		config.ConfigFile = c.yamlConfig.path
+		config.problems = append(config.problems, c.yamlConfig.problems...)
+	}
+	config.sources = r.sources
+	config.problems = append(config.problems, r.problems...)
 
 	return config
 }
@@ -482,6 +1543,30 @@ func (c *CLI) getStringValue(cmd *cobra.Command, flagName, envName string) strin
 	return val
 }
 
+// getStringSliceValue reads a repeatable flag, falling back to a comma-separated environment variable
+func (c *CLI) getStringSliceValue(cmd *cobra.Command, flagName, envName string) []string {
+	if cmd.Flags().Changed(flagName) {
+		val, _ := cmd.PersistentFlags().GetStringSlice(flagName)
+		return val
+	}
+	if envVal := os.Getenv(envName); envVal != "" {
+		return splitList(envVal)
+	}
+	val, _ := cmd.PersistentFlags().GetStringSlice(flagName)
+	return val
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func (c *CLI) getIntValue(cmd *cobra.Command, flagName, envName string) int {
 	if cmd.Flags().Changed(flagName) {
 		val, _ := cmd.PersistentFlags().GetInt(flagName)
@@ -499,6 +1584,20 @@ func (c *CLI) getIntValue(cmd *cobra.Command, flagName, envName string) int {
 	return 85 // default
 }
 
+func (c *CLI) getInt64Value(cmd *cobra.Command, flagName, envName string) int64 {
+	if cmd.Flags().Changed(flagName) {
+		val, _ := cmd.PersistentFlags().GetInt64(flagName)
+		return val
+	}
+	if envVal := os.Getenv(envName); envVal != "" {
+		if intVal, err := strconv.ParseInt(envVal, 10, 64); err == nil {
+			return intVal
+		}
+	}
+	val, _ := cmd.PersistentFlags().GetInt64(flagName)
+	return val
+}
+
 func (c *CLI) getBoolValue(cmd *cobra.Command, flagName, envName string) bool {
 	if cmd.Flags().Changed(flagName) {
 		val, _ := cmd.PersistentFlags().GetBool(flagName)
@@ -513,41 +1612,27 @@ func (c *CLI) getBoolValue(cmd *cobra.Command, flagName, envName string) bool {
 	return val
 }
 
+// createDefaultConfig writes a config file with the default settings, in YAML when filename ends in .yml or .yaml
 func (c *CLI) createDefaultConfig(filename string) error {
-	configContent := `# GitHub Actions Auto-Fix Agent Configuration
-
-# GitHub Settings
-GITHUB_TOKEN=your_github_token_here
-REPO_OWNER=your_repo_owner
-REPO_NAME=your_repo_name
-TARGET_BRANCH=main
-
-# LLM Settings
-LLM_PROVIDER=openai
-LLM_API_KEY=your_llm_api_key_here
-
-# Agent Settings
-MIN_COVERAGE=85
-
-# Logging Settings
-LOG_LEVEL=info
-LOG_FORMAT=json
-
-# Optional: LiteLLM Proxy (if using)
-# LITELLM_BASE_URL=http://localhost:4000
-
-# Optional: Advanced Settings
-# DRY_RUN=false
-# VERBOSE=false
-`
+	format := ConfigFormatEnv
+	if isYAMLConfig(filename) {
+		format = ConfigFormatYAML
+	}
+	content, err := renderConfigFile(format, defaultConfigAnswers())
+	if err != nil {
+		return err
+	}
+	return c.writeConfigFile(filename, content)
+}
 
+func (c *CLI) writeConfigFile(filename, content string) error {
 	f, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	_, err = f.WriteString(configContent)
+	_, err = f.WriteString(content)
 	if err != nil {
 		return err
 	}
@@ -556,125 +1641,561 @@ LOG_FORMAT=json
 	return nil
 }
 
-func (c *CLI) printAnalysisResult(analysis *FailureAnalysisResult) {
-	fmt.Printf("\n=== Failure Analysis Result ===\n")
-	fmt.Printf("ID: %s\n", analysis.ID)
-	fmt.Printf("Type: %s\n", analysis.Classification.Type)
-	fmt.Printf("Severity: %s\n", analysis.Classification.Severity)
-	fmt.Printf("Category: %s\n", analysis.Classification.Category)
-	fmt.Printf("Confidence: %.1f%%\n", analysis.Classification.Confidence*100)
-	fmt.Printf("Root Cause: %s\n", analysis.RootCause)
-	fmt.Printf("Description: %s\n", analysis.Description)
-	fmt.Printf("Processing Time: %v\n", analysis.ProcessingTime)
+func (c *CLI) printAnalysisResult(analysis *FailureAnalysisResult) error {
+	return c.render(analysis, func(w io.Writer) {
+		fmt.Fprintf(w, "\n=== Failure Analysis Result ===\n")
+		writeAnalysis(w, analysis)
+		fmt.Fprintln(w)
+	})
+}
+
+// printJobAnalyses prints the distinct failures of a run's jobs, with the jobs each explains
+func (c *CLI) printJobAnalyses(analyses []*FailureAnalysisResult) error {
+	return c.render(analyses, func(w io.Writer) {
+		jobs := 0
+		for _, analysis := range analyses {
+			jobs += len(analysis.Jobs)
+		}
+		fmt.Fprintf(w, "\n=== Failure Analysis: %d distinct failures in %d failed jobs ===\n", len(analyses), jobs)
+		for i, analysis := range analyses {
+			fmt.Fprintf(w, "\n--- Failure %d ---\n", i+1)
+			writeAnalysis(w, analysis)
+		}
+		fmt.Fprintln(w)
+	})
+}
+
+func writeAnalysis(w io.Writer, analysis *FailureAnalysisResult) {
+	fmt.Fprintf(w, "ID: %s\n", analysis.ID)
+	if insufficientData(analysis) {
+		fmt.Fprintf(w, "Logs Unavailable: %s; re-run the workflow, or analyze a saved log with --from-file\n", analysis.RootCause)
+	}
+	if len(analysis.Jobs) > 0 {
+		fmt.Fprintf(w, "Jobs: %s\n", strings.Join(analysis.Jobs, ", "))
+	}
+	repository := analysis.Context.Repository
+	if repository.Language != "" {
+		fmt.Fprintf(w, "Language: %s\n", repository.Language)
+	}
+	if repository.Framework != "" {
+		fmt.Fprintf(w, "Framework: %s\n", repository.Framework)
+	}
+	fmt.Fprintf(w, "Type: %s\n", analysis.Classification.Type)
+	fmt.Fprintf(w, "Severity: %s\n", analysis.Classification.Severity)
+	fmt.Fprintf(w, "Category: %s\n", analysis.Classification.Category)
+	fmt.Fprintf(w, "Confidence: %.1f%%\n", analysis.Classification.Confidence*100)
+	fmt.Fprintf(w, "Root Cause: %s\n", analysis.RootCause)
+	fmt.Fprintf(w, "Description: %s\n", analysis.Description)
+	fmt.Fprintf(w, "Processing Time: %v\n", analysis.ProcessingTime)
 
 	if len(analysis.AffectedFiles) > 0 {
-		fmt.Printf("\nAffected Files:\n")
+		fmt.Fprintf(w, "\nAffected Files:\n")
 		for _, file := range analysis.AffectedFiles {
-			fmt.Printf("  - %s\n", file)
+			fmt.Fprintf(w, "  - %s\n", file)
 		}
 	}
 
 	if len(analysis.ErrorPatterns) > 0 {
-		fmt.Printf("\nError Patterns:\n")
+		fmt.Fprintf(w, "\nError Patterns:\n")
 		for _, pattern := range analysis.ErrorPatterns {
-			fmt.Printf("  - %s (%.1f%% confidence)\n", pattern.Description, pattern.Confidence*100)
+			fmt.Fprintf(w, "  - %s (%.1f%% confidence)\n", pattern.Description, pattern.Confidence*100)
 		}
 	}
-	fmt.Println()
 }
 
-func (c *CLI) printGeneratedFixes(fixes []*ProposedFix) {
-	fmt.Printf("\n=== Generated Fixes ===\n")
+// printInteractions prints the LLM interactions captured for analyses after the text output;
+// the other formats include them in the analyses
+func (c *CLI) printInteractions(analyses ...*FailureAnalysisResult) {
+	if c.outputFormat() == OutputText {
+		c.writeInteractions(c.rootCmd.OutOrStdout(), analyses)
+	}
+}
+
+// writeInteractions writes the text output of the LLM interactions captured for analyses,
+// nothing when analyze did not run with --debug-prompts
+func (c *CLI) writeInteractions(w io.Writer, analyses []*FailureAnalysisResult) {
+	if !c.debugPrompts() {
+		return
+	}
+	fmt.Fprintf(w, "\n=== LLM Interactions ===\n")
+	for _, analysis := range analyses {
+		for i, interaction := range analysis.Interactions {
+			fmt.Fprintf(w, "\n--- %s: %d. %s ---\n", analysis.ID, i+1, interaction.Stage)
+			fmt.Fprintf(w, "Model: %s\n", interaction.Model)
+			if interaction.Usage != nil {
+				fmt.Fprintf(w, "Tokens: %d prompt, %d completion\n", interaction.Usage.PromptTokens, interaction.Usage.CompletionTokens)
+			}
+			fmt.Fprintf(w, "\nSystem Message:\n%s\n", interaction.SystemMsg)
+			fmt.Fprintf(w, "\nPrompt:\n%s\n", interaction.Prompt)
+			fmt.Fprintf(w, "\nResponse:\n%s\n", interaction.Response)
+		}
+	}
+}
+
+func (c *CLI) printGeneratedFixes(fixes []*ProposedFix) error {
+	return c.render(fixes, func(w io.Writer) {
+		c.writeGeneratedFixes(w, fixes)
+	})
+}
+
+// writeGeneratedFixes writes the text output of fixes
+func (c *CLI) writeGeneratedFixes(w io.Writer, fixes []*ProposedFix) {
+	fmt.Fprintf(w, "\n=== Generated Fixes ===\n")
 	for i, fix := range fixes {
-		fmt.Printf("\nFix %d:\n", i+1)
-		fmt.Printf("  ID: %s\n", fix.ID)
-		fmt.Printf("  Type: %s\n", fix.Type)
-		fmt.Printf("  Confidence: %.1f%%\n", fix.Confidence*100)
-		fmt.Printf("  Description: %s\n", fix.Description)
-		fmt.Printf("  Rationale: %s\n", fix.Rationale)
+		fmt.Fprintf(w, "\nFix %d:\n", i+1)
+		fmt.Fprintf(w, "  ID: %s\n", fix.ID)
+		fmt.Fprintf(w, "  Type: %s\n", fix.Type)
+		fmt.Fprintf(w, "  Confidence: %.1f%%\n", fix.Confidence*100)
+		fmt.Fprintf(w, "  Description: %s\n", fix.Description)
+		fmt.Fprintf(w, "  Rationale: %s\n", fix.Rationale)
 
 		if len(fix.Changes) > 0 {
-			fmt.Printf("  Changes:\n")
+			fmt.Fprintf(w, "  Changes:\n")
 			for _, change := range fix.Changes {
-				fmt.Printf("    - %s: %s\n", change.Operation, change.FilePath)
+				fmt.Fprintf(w, "    - %s: %s\n", change.Operation, change.displayPath())
+				if c.showDiff() {
+					printChangeDiff(w, change)
+				}
 			}
 		}
 
 		if len(fix.Risks) > 0 {
-			fmt.Printf("  Risks:\n")
+			fmt.Fprintf(w, "  Risks:\n")
 			for _, risk := range fix.Risks {
-				fmt.Printf("    - %s\n", risk)
+				fmt.Fprintf(w, "    - %s\n", risk)
 			}
 		}
 	}
-	fmt.Println()
+	fmt.Fprintln(w)
 }
 
-func (c *CLI) printAutoFixResult(result *AutoFixResult) {
-	fmt.Printf("\n=== Auto-Fix Result ===\n")
-	fmt.Printf("Success: %t\n", result.Success)
-	fmt.Printf("Duration: %v\n", result.Duration)
+func (c *CLI) printAutoFixResult(result *AutoFixResult) error {
+	return c.render(result, func(w io.Writer) {
+		fmt.Fprintf(w, "\n=== Auto-Fix Result ===\n")
+		fmt.Fprintf(w, "Success: %t\n", result.Success)
+		fmt.Fprintf(w, "Duration: %v\n", result.Duration)
+		if reason, ok := result.Metadata["logs_unavailable"].(string); ok {
+			fmt.Fprintf(w, "\nNo Fix Generated:\n")
+			fmt.Fprintf(w, "  Reason: %s\n", reason)
+			fmt.Fprintf(w, "  Next Step: re-run the workflow and fix the new attempt\n")
+		}
+
+		update, _ := result.Metadata["pr_update"].(string)
+		if result.PullRequest != nil && update != "" {
+			fmt.Fprintf(w, "\nPull Request Updated:\n")
+			fmt.Fprintf(w, "  Number: #%d\n", result.PullRequest.Number)
+			fmt.Fprintf(w, "  URL: %s\n", result.PullRequest.URL)
+			fmt.Fprintf(w, "  Branch: %s\n", result.PullRequest.Branch)
+			if update == ExistingPRPushed {
+				fmt.Fprintf(w, "  Pushed Commit: %s\n", result.Metadata["commit_sha"])
+			} else {
+				fmt.Fprintf(w, "  Suggested: the branch is in a fork, so the fix was commented\n")
+			}
+		} else if result.PullRequest != nil {
+			fmt.Fprintf(w, "\nPull Request Created:\n")
+			fmt.Fprintf(w, "  Number: #%d\n", result.PullRequest.Number)
+			fmt.Fprintf(w, "  Title: %s\n", result.PullRequest.Title)
+			fmt.Fprintf(w, "  URL: %s\n", result.PullRequest.URL)
+			fmt.Fprintf(w, "  Branch: %s\n", result.PullRequest.Branch)
+		}
+
+		if len(result.PullRequests) > 1 {
+			fmt.Fprintf(w, "\nAlternative Fix Pull Requests:\n")
+			for _, pr := range result.PullRequests[1:] {
+				fmt.Fprintf(w, "  #%d %s (%s)\n", pr.Number, pr.Title, pr.URL)
+			}
+		}
+
+		if dryRun, _ := result.Metadata["dry_run"].(bool); dryRun {
+			fmt.Fprintf(w, "\nDry Run (no pull request created):\n")
+			if branch, ok := result.Metadata["branch_name"].(string); ok {
+				fmt.Fprintf(w, "  Branch: %s\n", branch)
+			}
+			if title, ok := result.Metadata["pr_title"].(string); ok {
+				fmt.Fprintf(w, "  PR Title: %s\n", title)
+			}
+			if files, ok := result.Metadata["changed_files"].([]string); ok {
+				fmt.Fprintf(w, "  Changed Files: %s\n", strings.Join(files, ", "))
+			}
+		}
+
+		if dir, ok := result.Metadata["export_dir"].(string); ok {
+			fmt.Fprintf(w, "\nExported Fix:\n")
+			fmt.Fprintf(w, "  Directory: %s\n", dir)
+			fmt.Fprintf(w, "  Apply With: git apply %s\n", filepath.Join(dir, fixPatchFile))
+		}
+
+		if result.Fix != nil {
+			fmt.Fprintf(w, "\nFix Validation:\n")
+			fmt.Fprintf(w, "  Valid: %t\n", result.Fix.Valid)
+			fmt.Fprintf(w, "  Tests Passed: %t\n", result.Fix.TestResult.Success)
+			fmt.Fprintf(w, "  Coverage: %s\n", result.Fix.TestResult.coverageText())
+			if result.Fix.CoverageNote != "" {
+				fmt.Fprintf(w, "  Note: %s\n", result.Fix.CoverageNote)
+			}
+		}
 
-	if result.PullRequest != nil {
-		fmt.Printf("\nPull Request Created:\n")
-		fmt.Printf("  Number: #%d\n", result.PullRequest.Number)
-		fmt.Printf("  Title: %s\n", result.PullRequest.Title)
-		fmt.Printf("  URL: %s\n", result.PullRequest.URL)
-		fmt.Printf("  Branch: %s\n", result.PullRequest.Branch)
+		if result.Fix != nil && result.Fix.Fix != nil && c.showDiff() {
+			fmt.Fprintf(w, "\nChanges:\n")
+			for _, change := range result.Fix.Fix.Changes {
+				fmt.Fprintf(w, "    - %s: %s\n", change.Operation, change.displayPath())
+				printChangeDiff(w, change)
+			}
+		}
+		fmt.Fprintln(w)
+	})
+}
+
+// showDiff reports whether text output includes the diffs of fix changes
+func (c *CLI) showDiff() bool {
+	show, _ := c.rootCmd.PersistentFlags().GetBool("show-diff")
+	return show
+}
+
+// debugPrompts reports whether LLM prompts and responses are captured and printed
+func (c *CLI) debugPrompts() bool {
+	debug, _ := c.rootCmd.PersistentFlags().GetBool("debug-prompts")
+	return debug
+}
+
+// printChangeDiff writes the unified diff of a change, indented under its file
+func printChangeDiff(w io.Writer, change CodeChange) {
+	for _, line := range splitLines(changeDiff(change)) {
+		fmt.Fprintf(w, "      %s", line)
 	}
+}
 
-	if result.Fix != nil {
-		fmt.Printf("\nFix Validation:\n")
-		fmt.Printf("  Valid: %t\n", result.Fix.Valid)
-		fmt.Printf("  Tests Passed: %t\n", result.Fix.TestResult.Success)
-		fmt.Printf("  Coverage: %.1f%%\n", result.Fix.TestResult.Coverage)
+func (c *CLI) printTestResult(result *TestResult) error {
+	return c.render(result, func(w io.Writer) {
+		fmt.Fprintf(w, "\n=== Test Results ===\n")
+		fmt.Fprintf(w, "Success: %t\n", result.Success)
+		fmt.Fprintf(w, "Total Tests: %d\n", result.TotalTests)
+		fmt.Fprintf(w, "Passed: %d\n", result.PassedTests)
+		fmt.Fprintf(w, "Failed: %d\n", result.FailedTests)
+		fmt.Fprintf(w, "Skipped: %d\n", result.SkippedTests)
+		fmt.Fprintf(w, "Coverage: %s\n", result.coverageText())
+		fmt.Fprintf(w, "Duration: %v\n", result.Duration)
+
+		if len(result.Errors) > 0 {
+			fmt.Fprintf(w, "\nErrors:\n")
+			for _, err := range result.Errors {
+				fmt.Fprintf(w, "  - %s\n", err)
+			}
+		}
+		fmt.Fprintln(w)
+	})
+}
+
+// printAuditTrail prints the audit log entries of a workflow run; it reads the log only
+// and needs no credentials
+func (c *CLI) printAuditTrail(runID int64) error {
+	config := c.getCurrentConfig(c.rootCmd)
+	if config.AuditLog == "" {
+		return fmt.Errorf("no audit log configured, set --audit-log or AUDIT_LOG")
 	}
-	fmt.Println()
+	trail, err := readAuditTrail(config.AuditLog, runID)
+	if err != nil {
+		return err
+	}
+	if len(trail) == 0 {
+		return fmt.Errorf("no audit entries for run %d in %s", runID, config.AuditLog)
+	}
+	return c.render(trail, func(w io.Writer) {
+		writeAuditTrail(w, runID, trail)
+	})
+}
+
+// printFixHistory prints the fixes remembered in the fix history, most recent first; it reads
+// the file only and needs no credentials
+func (c *CLI) printFixHistory() error {
+	config := c.getCurrentConfig(c.rootCmd)
+	if config.FixHistory == "" {
+		return fmt.Errorf("no fix history configured, set --fix-history or FIX_HISTORY")
+	}
+	history, err := loadFixHistory(config.FixHistory)
+	if err != nil {
+		return err
+	}
+	entries := history.list()
+	return c.render(entries, func(w io.Writer) {
+		fmt.Fprintf(w, "\n=== Fix History ===\n")
+		if len(entries) == 0 {
+			fmt.Fprintf(w, "No fixes recorded in %s\n\n", config.FixHistory)
+			return
+		}
+		for _, entry := range entries {
+			fmt.Fprintf(w, "PR #%d [%s] %s: %s\n", entry.PRNumber, entry.State, entry.Classification.Type, entry.FixDescription)
+			fmt.Fprintf(w, "  Fingerprint: %s, recorded %s\n", entry.Fingerprint, entry.RecordedAt.Format(time.RFC3339))
+			if entry.RunID != 0 {
+				fmt.Fprintf(w, "  Run: %s #%d\n", valueOr(entry.Workflow, notAvailable), entry.RunID)
+			}
+			if len(entry.Files) > 0 {
+				fmt.Fprintf(w, "  Files: %s\n", strings.Join(entry.Files, ", "))
+			}
+		}
+		fmt.Fprintln(w)
+	})
 }
 
-func (c *CLI) printTestResult(result *TestResult) {
-	fmt.Printf("\n=== Test Results ===\n")
-	fmt.Printf("Success: %t\n", result.Success)
-	fmt.Printf("Total Tests: %d\n", result.TotalTests)
-	fmt.Printf("Passed: %d\n", result.PassedTests)
-	fmt.Printf("Failed: %d\n", result.FailedTests)
-	fmt.Printf("Skipped: %d\n", result.SkippedTests)
-	fmt.Printf("Coverage: %.1f%%\n", result.Coverage)
-	fmt.Printf("Duration: %v\n", result.Duration)
+// batchFixRow is a line of the fix-batch summary
+type batchFixRow struct {
+	RunID       int64  `json:"run_id"`
+	FailureType string `json:"failure_type"`
+	Outcome     string `json:"outcome"`
+	PullRequest string `json:"pull_request,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
 
-	if len(result.Errors) > 0 {
-		fmt.Printf("\nErrors:\n")
-		for _, err := range result.Errors {
-			fmt.Printf("  - %s\n", err)
+// printBatchResults prints a summary line for each fix of a batch
+func (c *CLI) printBatchResults(results []*AutoFixResult) error {
+	rows := make([]batchFixRow, 0, len(results))
+	for _, result := range results {
+		row := batchFixRow{
+			RunID:       result.RunID,
+			FailureType: metricsFailureType(result.Analysis),
+			Outcome:     result.batchOutcome(),
+		}
+		if result.PullRequest != nil {
+			row.PullRequest = result.PullRequest.URL
 		}
+		row.Error, _ = result.Metadata["error"].(string)
+		rows = append(rows, row)
 	}
-	fmt.Println()
+	return c.render(rows, func(w io.Writer) {
+		fmt.Fprintf(w, "\n=== Batch Fix ===\n")
+		if len(rows) == 0 {
+			fmt.Fprintf(w, "No failed workflow runs to fix\n\n")
+			return
+		}
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "RUN\tFAILURE TYPE\tOUTCOME\tPULL REQUEST")
+		for _, row := range rows {
+			fmt.Fprintf(table, "%d\t%s\t%s\t%s\n", row.RunID, row.FailureType, row.Outcome, valueOr(row.PullRequest, "-"))
+		}
+		table.Flush()
+		for _, row := range rows {
+			if row.Error != "" {
+				fmt.Fprintf(w, "Run %d: %s\n", row.RunID, row.Error)
+			}
+		}
+		fmt.Fprintln(w)
+	})
 }
 
-func (c *CLI) printMetrics(metrics *OperationalMetrics) {
-	fmt.Printf("\n=== Agent Metrics ===\n")
-	fmt.Printf("Total Failures Detected: %d\n", metrics.TotalFailuresDetected)
-	fmt.Printf("Successful Fixes: %d\n", metrics.SuccessfulFixes)
-	fmt.Printf("Failed Fixes: %d\n", metrics.FailedFixes)
-	fmt.Printf("Average Fix Time: %v\n", metrics.AverageFixTime)
-	fmt.Printf("Test Coverage: %.1f%%\n", metrics.TestCoverage)
-	fmt.Printf("Last Updated: %v\n", metrics.LastUpdated)
-	fmt.Println()
+// printPreflightReport prints the findings of the preflight checks as a table, followed by the
+// remediation of each problem
+func (c *CLI) printPreflightReport(report *PreflightReport) error {
+	return c.render(report, func(w io.Writer) {
+		fmt.Fprintf(w, "\n=== Preflight Checks ===\n")
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "CHECK\tSTATUS\tDETAIL")
+		for _, check := range report.Checks {
+			fmt.Fprintf(table, "%s\t%s\t%s\n", check.Name, strings.ToUpper(string(check.Status)), check.Detail)
+		}
+		table.Flush()
+		for _, check := range report.Checks {
+			if check.Remediation != "" {
+				fmt.Fprintf(w, "%s: %s\n", check.Name, check.Remediation)
+			}
+		}
+		fmt.Fprintf(w, "\nResult: %s\n\n", strings.ToUpper(string(report.Status)))
+	})
+}
+
+// printMonitorPass prints what a monitor --once pass found and fixed
+func (c *CLI) printMonitorPass(pass *MonitorPass) error {
+	return c.render(pass, func(w io.Writer) {
+		fmt.Fprintf(w, "\n=== Monitoring Pass ===\n")
+		fmt.Fprintf(w, "Failures Detected: %d\n", pass.FailuresDetected)
+		fmt.Fprintf(w, "Fixes Completed: %d\n", pass.FixesCompleted)
+		fmt.Fprintf(w, "Fixes Failed: %d\n", pass.FixesFailed)
+		fmt.Fprintf(w, "Duration: %v\n", pass.Duration)
+		fmt.Fprintln(w)
+	})
+}
+
+func (c *CLI) printMetrics(metrics *OperationalMetrics) error {
+	return c.render(metrics, func(w io.Writer) {
+		fmt.Fprintf(w, "\n=== Agent Metrics ===\n")
+		fmt.Fprintf(w, "Total Failures Detected: %d\n", metrics.TotalFailuresDetected)
+		fmt.Fprintf(w, "Successful Fixes: %d\n", metrics.SuccessfulFixes)
+		fmt.Fprintf(w, "Failed Fixes: %d\n", metrics.FailedFixes)
+		fmt.Fprintf(w, "Average Fix Time: %v\n", metrics.AverageFixTime)
+		fmt.Fprintf(w, "Test Coverage: %.1f%%\n", metrics.TestCoverage)
+		if verifications := metrics.VerifiedFixes + metrics.UnverifiedFixes; verifications > 0 {
+			fmt.Fprintf(w, "Verified Fixes: %d of %d merged fixes verified\n", metrics.VerifiedFixes, verifications)
+		}
+		if metrics.GitHubRateRemaining >= 0 {
+			fmt.Fprintf(w, "GitHub Rate Remaining: %d\n", metrics.GitHubRateRemaining)
+		}
+		if metrics.LLMTokensUsed > 0 {
+			fmt.Fprintf(w, "LLM Tokens Used: %d (est. $%.4f)\n", metrics.LLMTokensUsed, metrics.LLMEstimatedCost)
+		}
+		if health := metrics.Health; health != nil {
+			fmt.Fprintf(w, "Health: %s", health.Status)
+			if health.ConsecutiveFailures > 0 {
+				fmt.Fprintf(w, " (%d consecutive failures, last: %s)", health.ConsecutiveFailures, health.LastError)
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Last Updated: %v\n", metrics.LastUpdated)
+		if discovery := metrics.Discovery; discovery != nil {
+			fmt.Fprintf(w, "\n=== Organization %s ===\n", discovery.Organization)
+			fmt.Fprintf(w, "Refreshed: %v\n", discovery.RefreshedAt)
+			fmt.Fprintf(w, "Monitored Repositories (%d): %s\n", len(discovery.Repositories), strings.Join(discovery.Repositories, ", "))
+			for _, skipped := range discovery.Skipped {
+				fmt.Fprintf(w, "Skipped %s: %s\n", skipped.Name, skipped.Reason)
+			}
+		}
+		fmt.Fprintln(w)
+	})
+}
+
+// printVerificationResult prints the outcome of verifying a merged fix
+func (c *CLI) printVerificationResult(result *VerificationResult) error {
+	return c.render(result, func(w io.Writer) {
+		fmt.Fprintf(w, "\n=== Fix Verification ===\n")
+		fmt.Fprintf(w, "Pull Request: #%d\n", result.PRNumber)
+		if result.Workflow != "" {
+			fmt.Fprintf(w, "Workflow: %s\n", result.Workflow)
+		}
+		fmt.Fprintf(w, "Merge Commit: %s\n", shortSHA(result.MergeCommitSHA))
+		fmt.Fprintf(w, "Outcome: %s\n", result.Outcome)
+		if run := result.Run; run != nil {
+			fmt.Fprintf(w, "Run: #%d %s (%s)\n", run.ID, run.Conclusion, run.URL)
+		}
+		if result.Reason != "" {
+			fmt.Fprintf(w, "Reason: %s\n", result.Reason)
+		}
+		if followUp := result.FollowUp; followUp != nil {
+			fmt.Fprintf(w, "\n--- Follow-up Analysis ---\n")
+			writeAnalysis(w, followUp)
+		}
+		fmt.Fprintln(w)
+	})
+}
+
+// printCosts prints the LLM token usage and estimated cost per provider
+func (c *CLI) printCosts(metrics *OperationalMetrics) error {
+	return c.render(metrics.LLMUsage, func(w io.Writer) {
+		fmt.Fprintf(w, "\n=== LLM Costs ===\n")
+		if len(metrics.LLMUsage) == 0 {
+			fmt.Fprintf(w, "No LLM usage recorded\n\n")
+			return
+		}
+		fmt.Fprintf(w, "%-10s %8s %12s %12s %12s %10s\n", "Provider", "Requests", "Prompt", "Completion", "Total", "Est. Cost")
+		for _, provider := range metrics.LLMUsage.sorted() {
+			writeUsageRow(w, string(provider), metrics.LLMUsage[provider])
+		}
+		writeUsageRow(w, "total", metrics.LLMUsage.total())
+		fmt.Fprintln(w)
+	})
+}
+
+func writeUsageRow(w io.Writer, name string, usage LLMUsageSummary) {
+	fmt.Fprintf(w, "%-10s %8d %12d %12d %12d %10s\n", name, usage.Requests, usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens, fmt.Sprintf("$%.4f", usage.EstimatedCostUSD))
 }
 
 func (c *CLI) printConfig(config *CLIConfig) {
+	from := config.sourceOf
 	fmt.Printf("\n=== Current Configuration ===\n")
-	fmt.Printf("GitHub Token: %s\n", c.maskToken(config.GitHubToken))
-	fmt.Printf("LLM Provider: %s\n", config.LLMProvider)
-	fmt.Printf("LLM API Key: %s\n", c.maskToken(config.LLMAPIKey))
-	fmt.Printf("Repository: %s/%s\n", config.RepoOwner, config.RepoName)
-	fmt.Printf("Target Branch: %s\n", config.TargetBranch)
-	fmt.Printf("Min Coverage: %d%%\n", config.MinCoverage)
+	fmt.Printf("GitHub Token: %s%s\n", c.maskToken(config.GitHubToken), from("github.token"))
+	if config.usesGitHubApp() {
+		fmt.Printf("GitHub App: %d (installation %d)%s\n", config.GitHubAppID, config.GitHubInstallationID, from("github.app_id"))
+	}
+	if config.GitHubAPIURL != "" {
+		fmt.Printf("GitHub API URL: %s%s\n", config.GitHubAPIURL, from("github.api_url"))
+	}
+	fmt.Printf("LLM Provider: %s%s\n", config.LLMProvider, from("llm.provider"))
+	fmt.Printf("LLM API Key: %s%s\n", c.maskToken(config.LLMAPIKey), from("llm.api_key"))
+	switch {
+	case config.NoLLMCache:
+		fmt.Printf("LLM Cache: disabled%s\n", from("llm.no_cache"))
+	case config.LLMCacheDir != "":
+		fmt.Printf("LLM Cache: %s, TTL %v%s\n", config.LLMCacheDir, config.LLMCacheTTL, from("llm.cache_dir"))
+	default:
+		fmt.Printf("LLM Cache: in memory, TTL %v%s\n", config.LLMCacheTTL, from("llm.cache_ttl"))
+	}
+	if price, ok := config.llmPrice(); ok {
+		fmt.Printf("LLM Pricing: $%g input, $%g output per 1K tokens%s\n", price.InputPer1K, price.OutputPer1K, from("llm.input_price_per_1k"))
+	}
+	if headers, err := config.llmHeaders(); err == nil && len(headers) > 0 {
+		fmt.Printf("LLM Headers: %s%s\n", strings.Join(redactedLLMHeaders(llmHeaderMap(headers)), ", "), from("llm.headers"))
+	}
+	if config.AnalysisModel != "" || config.FixModel != "" {
+		fmt.Printf("LLM Models: analysis %s, fixes %s%s\n", valueOr(config.AnalysisModel, "default"), valueOr(config.FixModel, "default"), from("llm.analysis_model"))
+		fmt.Printf("Escalation Confidence: %g%s\n", config.EscalationConfidence, from("llm.escalation_confidence"))
+	}
+	if config.LogChunking {
+		chunking := config.logChunking().withDefaults()
+		fmt.Printf("Log Chunking: beyond %gx the prompt budget, %d byte chunks overlapping %d lines, at most %d chunks%s\n",
+			chunking.Factor, chunking.ChunkBytes, chunking.OverlapLines, chunking.MaxChunks, from("llm.log_chunking"))
+	}
+	fmt.Printf("Repository: %s/%s%s\n", config.RepoOwner, config.RepoName, from("github.repo"))
+	if len(config.Repositories) > 0 {
+		fmt.Printf("Repositories: %s%s\n", strings.Join(config.Repositories, ", "), from("github.repositories"))
+	}
+	if config.Organization != "" {
+		fmt.Printf("Organization: %s%s\n", config.Organization, from("github.organization"))
+	}
+	fmt.Printf("Target Branch: %s%s\n", valueOr(config.TargetBranch, "repository default"), from("github.target_branch"))
+	fmt.Printf("Min Coverage: %d%%%s\n", config.MinCoverage, from("monitoring.min_coverage"))
+	if config.RequireCoverage {
+		fmt.Printf("Require Coverage: enabled%s\n", from("monitoring.require_coverage"))
+	}
+	fmt.Printf("Test Network: %s%s\n", valueOr(config.TestNetwork, string(TestNetworkFull)), from("monitoring.test_network"))
+	if config.FlakyRetry {
+		fmt.Printf("Flaky Retry: enabled, successes within %v%s\n", config.FlakyRetryMaxAge, from("monitoring.flaky_retry"))
+	}
+	if config.SARIFUpload {
+		fmt.Printf("SARIF Upload: enabled%s\n", from("monitoring.sarif_upload"))
+	}
+	if len(config.PRReviewers) > 0 {
+		fmt.Printf("PR Reviewers: %s%s\n", strings.Join(config.PRReviewers, ", "), from("pr.reviewers"))
+	}
+	if len(config.PRLabels) > 0 {
+		fmt.Printf("PR Labels: %s%s\n", strings.Join(config.PRLabels, ", "), from("pr.labels"))
+	}
+	fmt.Printf("PR Auto-Merge: %t%s\n", config.PRAutoMerge, from("pr.auto_merge"))
+	fmt.Printf("PR Comment Mode: %s%s\n", valueOr(config.PRCommentMode, string(PRCommentReview)), from("pr.comment_mode"))
+	if config.PRCoverageGist {
+		fmt.Printf("PR Coverage Gist: enabled%s\n", from("pr.coverage_gist"))
+	}
+	if config.NotificationWebhook != "" {
+		fmt.Printf("Notification Webhook: %s%s\n", c.maskToken(config.NotificationWebhook), from("notifications.webhook_url"))
+	}
+	if len(config.RedactionPatterns) > 0 {
+		fmt.Printf("Redaction Patterns: %d%s\n", len(config.RedactionPatterns), from("redaction.patterns"))
+	}
+	if len(config.AllowedPaths) > 0 {
+		fmt.Printf("Allowed Paths: %s%s\n", strings.Join(config.AllowedPaths, ", "), from("paths.allow"))
+	}
+	if len(config.DeniedPaths) > 0 {
+		fmt.Printf("Denied Paths: %s%s\n", strings.Join(config.DeniedPaths, ", "), from("paths.deny"))
+	}
+	guardrails := config.fixGuardrails().withDefaults()
+	fmt.Printf("Fix Guardrails: %d files, %d lines, %s%s\n", guardrails.MaxFiles, guardrails.MaxLines, guardrails.Action, from("guardrails.action"))
+	fmt.Printf("Protected Paths: %s%s\n", strings.Join(guardrails.ProtectedPaths, ", "), from("guardrails.protected_paths"))
+	if len(config.BinaryExtensions) > 0 {
+		fmt.Printf("Binary Extensions: %s%s\n", strings.Join(config.BinaryExtensions, ", "), from("files.binary_extensions"))
+	}
+	if len(config.GeneratedFiles) > 0 {
+		fmt.Printf("Generated Files: %s%s\n", strings.Join(config.GeneratedFiles, ", "), from("files.generated"))
+	}
+	if config.AuditLog != "" {
+		fmt.Printf("Audit Log: %s%s\n", config.AuditLog, from("audit.log"))
+	}
+	if config.FixHistory != "" {
+		fmt.Printf("Fix History: %s%s\n", config.FixHistory, from("history.path"))
+	}
+	if config.PromptDir != "" {
+		fmt.Printf("Prompt Templates: %s%s\n", config.PromptDir, from("prompts.dir"))
+	}
 	fmt.Printf("Config File: %s\n", config.ConfigFile)
-	fmt.Printf("Log Level: %s\n", config.LogLevel)
-	fmt.Printf("Log Format: %s\n", config.LogFormat)
-	fmt.Printf("Verbose: %t\n", config.Verbose)
-	fmt.Printf("Dry Run: %t\n", config.DryRun)
+	fmt.Printf("Log Level: %s%s\n", config.LogLevel, from("logging.level"))
+	fmt.Printf("Log Format: %s%s\n", config.LogFormat, from("logging.format"))
+	fmt.Printf("Verbose: %t%s\n", config.Verbose, from("logging.verbose"))
+	fmt.Printf("Dry Run: %t%s\n", config.DryRun, from("monitoring.dry_run"))
 	fmt.Println()
 }
 
@@ -708,7 +2229,13 @@ func (c *CLI) maskToken(token string) string {
 // Main entry point for CLI
 func main() {
 	cli := NewCLI()
-	if err := cli.Execute(); err != nil {
-		os.Exit(1)
+	err := cli.Execute()
+	// Spans still batched are exported before exiting
+	shutdownTracing()
+	if err != nil {
+		if hint := errorHint(err); hint != "" {
+			fmt.Fprintln(os.Stderr, "Hint:", hint)
+		}
+		os.Exit(exitCode(err))
 	}
 }
@@ -0,0 +1,608 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlConfigName is the YAML config file discovered when --config does not name one
+const yamlConfigName = ".github-autofix.yml"
+
+// Where a configuration value came from, in order of precedence
+const (
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceFile    = "file"
+	sourceDefault = "default"
+)
+
+// valueSource records where a configuration value came from
+type valueSource struct {
+	Kind string
+	Name string // flag name, environment variable or config file path
+	Line int    // line in the config file
+}
+
+func (s valueSource) String() string {
+	switch s.Kind {
+	case sourceFlag:
+		return "flag --" + s.Name
+	case sourceEnv:
+		return "env " + s.Name
+	case sourceFile:
+		if s.Line == 0 {
+			return "file " + s.Name
+		}
+		return fmt.Sprintf("file %s:%d", s.Name, s.Line)
+	case sourceDefault:
+		return sourceDefault
+	default:
+		return "not set"
+	}
+}
+
+// configKey ties a config file key to its flag and environment variable
+type configKey struct {
+	Path string
+	Flag string // empty when the setting has no flag
+	Env  string
+}
+
+// configKeys lists every setting of the YAML config file
+var configKeys = []configKey{
+	{"github.token", "github-token", "GITHUB_TOKEN"},
+	{"github.app_id", "github-app-id", "GITHUB_APP_ID"},
+	{"github.installation_id", "github-installation-id", "GITHUB_INSTALLATION_ID"},
+	{"github.private_key_file", "github-private-key-file", "GITHUB_PRIVATE_KEY_FILE"},
+	{"github.api_url", "github-api-url", "GITHUB_API_URL"},
+	{"github.upload_url", "github-upload-url", "GITHUB_UPLOAD_URL"},
+	{"github.owner", "repo-owner", "REPO_OWNER"},
+	{"github.repo", "repo-name", "REPO_NAME"},
+	{"github.repositories", "repo", "REPOSITORIES"},
+	{"github.organization", "organization", "GITHUB_ORGANIZATION"},
+	{"github.repo_include", "repo-include", "REPO_INCLUDE"},
+	{"github.repo_exclude", "repo-exclude", "REPO_EXCLUDE"},
+	{"github.include_archived", "include-archived", "INCLUDE_ARCHIVED_REPOS"},
+	{"github.include_forks", "include-forks", "INCLUDE_FORKED_REPOS"},
+	{"github.target_branch", "target-branch", "TARGET_BRANCH"},
+	{"llm.provider", "llm-provider", "LLM_PROVIDER"},
+	{"llm.api_key", "llm-api-key", "LLM_API_KEY"},
+	{"llm.cache_dir", "llm-cache-dir", "LLM_CACHE_DIR"},
+	{"llm.cache_ttl", "llm-cache-ttl", "LLM_CACHE_TTL"},
+	{"llm.no_cache", "no-llm-cache", "NO_LLM_CACHE"},
+	{"llm.input_price_per_1k", "llm-input-price", "LLM_INPUT_PRICE_PER_1K"},
+	{"llm.output_price_per_1k", "llm-output-price", "LLM_OUTPUT_PRICE_PER_1K"},
+	{"llm.headers", "llm-header", "LLM_HEADERS"},
+	{"llm.openai_organization", "openai-organization", "OPENAI_ORG_ID"},
+	{"llm.openai_project", "openai-project", "OPENAI_PROJECT_ID"},
+	{"llm.analysis_model", "analysis-model", "LLM_ANALYSIS_MODEL"},
+	{"llm.fix_model", "fix-model", "LLM_FIX_MODEL"},
+	{"llm.escalation_confidence", "escalation-confidence", "LLM_ESCALATION_CONFIDENCE"},
+	{"llm.log_chunking", "log-chunking", "LLM_LOG_CHUNKING"},
+	{"llm.log_chunk_factor", "log-chunk-factor", "LLM_LOG_CHUNK_FACTOR"},
+	{"llm.log_chunk_bytes", "log-chunk-bytes", "LLM_LOG_CHUNK_BYTES"},
+	{"llm.log_chunk_overlap", "log-chunk-overlap", "LLM_LOG_CHUNK_OVERLAP"},
+	{"llm.log_chunk_max", "log-chunk-max", "LLM_LOG_CHUNK_MAX"},
+	{"monitoring.min_coverage", "min-coverage", "MIN_COVERAGE"},
+	{"monitoring.require_coverage", "require-coverage", "REQUIRE_COVERAGE"},
+	{"monitoring.test_network", "test-network", "TEST_NETWORK"},
+	{"monitoring.dry_run", "dry-run", "DRY_RUN"},
+	{"monitoring.flaky_retry", "flaky-retry", "FLAKY_RETRY"},
+	{"monitoring.flaky_retry_max_age", "flaky-retry-max-age", "FLAKY_RETRY_MAX_AGE"},
+	{"monitoring.sarif_upload", "sarif-upload", "SARIF_UPLOAD"},
+	{"pr.reviewers", "pr-reviewer", "PR_REVIEWERS"},
+	{"pr.assignees", "", "PR_ASSIGNEES"},
+	{"pr.labels", "pr-label", "PR_LABELS"},
+	{"pr.auto_merge", "pr-auto-merge", "PR_AUTO_MERGE"},
+	{"pr.comment_mode", "pr-comment-mode", "PR_COMMENT_MODE"},
+	{"pr.draft", "", "PR_DRAFT"},
+	{"pr.coverage_gist", "", "PR_COVERAGE_GIST"},
+	{"notifications.webhook_url", "notification-webhook", "NOTIFICATION_WEBHOOK_URL"},
+	{"notifications.format", "notification-format", "NOTIFICATION_FORMAT"},
+	{"audit.log", "audit-log", "AUDIT_LOG"},
+	{"history.path", "fix-history", "FIX_HISTORY"},
+	{"prompts.dir", "prompt-dir", "PROMPT_TEMPLATES_DIR"},
+	{"redaction.patterns", "redact-pattern", "REDACTION_PATTERNS"},
+	{"paths.allow", "allow-path", "ALLOWED_PATHS"},
+	{"paths.deny", "deny-path", "DENIED_PATHS"},
+	{"guardrails.max_files", "max-fix-files", "FIX_MAX_FILES"},
+	{"guardrails.max_lines", "max-fix-lines", "FIX_MAX_LINES"},
+	{"guardrails.protected_paths", "protected-path", "FIX_PROTECTED_PATHS"},
+	{"guardrails.action", "guardrail-action", "FIX_GUARDRAIL_ACTION"},
+	{"files.binary_extensions", "binary-extension", "BINARY_EXTENSIONS"},
+	{"files.generated", "generated-file", "GENERATED_FILES"},
+	{"logging.level", "log-level", "LOG_LEVEL"},
+	{"logging.format", "log-format", "LOG_FORMAT"},
+	{"logging.verbose", "verbose", "VERBOSE"},
+}
+
+func lookupConfigKey(path string) (configKey, bool) {
+	for _, key := range configKeys {
+		if key.Path == path {
+			return key, true
+		}
+	}
+	return configKey{}, false
+}
+
+// configProblem is a configuration error reported by config validate
+type configProblem struct {
+	Key     string
+	Source  valueSource
+	Message string
+}
+
+func (p configProblem) String() string {
+	return fmt.Sprintf("%s (%s): %s", p.Key, p.Source, p.Message)
+}
+
+// fileValue is a value read from the YAML config file, after environment expansion
+type fileValue struct {
+	Value string   // scalar value
+	List  []string // sequence value
+	Line  int
+}
+
+// yamlConfig is a parsed YAML config file. Values are keyed by their dotted path, e.g. "llm.provider".
+type yamlConfig struct {
+	path     string
+	values   map[string]fileValue
+	problems []configProblem
+}
+
+// envReference matches ${VAR} references expanded in config file values
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// loadYAMLConfig parses a YAML config file with github, llm, monitoring, pr and logging sections
+func loadYAMLConfig(path string) (*yamlConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	cfg := &yamlConfig{path: path, values: make(map[string]fileValue)}
+	if len(doc.Content) > 0 {
+		cfg.walk("", doc.Content[0])
+	}
+	return cfg, nil
+}
+
+// walk records the values below node, reporting unknown keys and undefined variables
+func (c *yamlConfig) walk(prefix string, node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		c.problem(strings.TrimSuffix(prefix, "."), node.Line, "expected a mapping")
+		return
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		path := prefix + keyNode.Value
+
+		if valueNode.Kind == yaml.MappingNode {
+			c.walk(path+".", valueNode)
+			continue
+		}
+		if _, ok := lookupConfigKey(path); !ok {
+			c.problem(path, keyNode.Line, "unknown key")
+			continue
+		}
+
+		value := fileValue{Line: keyNode.Line}
+		switch valueNode.Kind {
+		case yaml.SequenceNode:
+			for _, item := range valueNode.Content {
+				value.List = append(value.List, c.expand(path, item))
+			}
+		case yaml.ScalarNode:
+			value.Value = c.expand(path, valueNode)
+		default:
+			c.problem(path, keyNode.Line, "expected a value or list")
+			continue
+		}
+		c.values[path] = value
+	}
+}
+
+// expand substitutes ${VAR} references, reporting variables that are not set
+func (c *yamlConfig) expand(path string, node *yaml.Node) string {
+	return envReference.ReplaceAllStringFunc(node.Value, func(ref string) string {
+		name := envReference.FindStringSubmatch(ref)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			c.problem(path, node.Line, fmt.Sprintf("environment variable %s is not set", name))
+		}
+		return value
+	})
+}
+
+func (c *yamlConfig) problem(path string, line int, message string) {
+	c.problems = append(c.problems, configProblem{
+		Key:     path,
+		Source:  valueSource{Kind: sourceFile, Name: c.path, Line: line},
+		Message: message,
+	})
+}
+
+// isYAMLConfig reports whether path names a YAML config file rather than a .env file
+func isYAMLConfig(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yml" || ext == ".yaml"
+}
+
+// configSearchPaths returns where the YAML config file is looked for: the working
+// directory, the repository root, then $XDG_CONFIG_HOME/github-autofix
+func configSearchPaths() []string {
+	var paths []string
+	if wd, err := os.Getwd(); err == nil {
+		paths = append(paths, filepath.Join(wd, yamlConfigName))
+		if root := findRepoRoot(wd); root != "" && root != wd {
+			paths = append(paths, filepath.Join(root, yamlConfigName))
+		}
+	}
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	if configHome != "" {
+		paths = append(paths, filepath.Join(configHome, "github-autofix", "config.yml"))
+	}
+	return paths
+}
+
+// findRepoRoot returns the closest directory at or above dir that contains .git
+func findRepoRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// discoverYAMLConfig returns the first YAML config file found in the search paths
+func discoverYAMLConfig() string {
+	for _, path := range configSearchPaths() {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// configResolver resolves settings with the precedence flags > env > file > defaults,
+// recording where each value came from
+type configResolver struct {
+	cli      *CLI
+	cmd      *cobra.Command
+	file     *yamlConfig
+	sources  map[string]valueSource
+	problems []configProblem
+}
+
+// source picks the layer a setting comes from
+func (r *configResolver) source(path string) (configKey, valueSource) {
+	key, _ := lookupConfigKey(path)
+	src := valueSource{Kind: sourceDefault}
+	switch {
+	case key.Flag != "" && r.cmd.Flags().Changed(key.Flag):
+		src = valueSource{Kind: sourceFlag, Name: key.Flag}
+	case os.Getenv(key.Env) != "":
+		src = valueSource{Kind: sourceEnv, Name: key.Env}
+	case r.file != nil:
+		if value, ok := r.file.values[path]; ok {
+			src = valueSource{Kind: sourceFile, Name: r.file.path, Line: value.Line}
+		}
+	}
+	r.sources[path] = src
+	return key, src
+}
+
+// invalid records a value that could not be parsed; the setting keeps its default
+func (r *configResolver) invalid(path string, src valueSource, message string) {
+	r.problems = append(r.problems, configProblem{Key: path, Source: src, Message: message})
+}
+
+func (r *configResolver) stringValue(path string) string {
+	key, src := r.source(path)
+	if src.Kind == sourceFile {
+		return r.file.values[path].Value
+	}
+	return r.cli.getStringValue(r.cmd, key.Flag, key.Env)
+}
+
+func (r *configResolver) listValue(path string) []string {
+	key, src := r.source(path)
+	if src.Kind == sourceFile {
+		value := r.file.values[path]
+		if value.List != nil {
+			return value.List
+		}
+		return splitList(value.Value)
+	}
+	return r.cli.getStringSliceValue(r.cmd, key.Flag, key.Env)
+}
+
+// raw returns the unparsed env or file value of a setting, and false when it comes from a flag or default
+func (r *configResolver) raw(path string) (configKey, valueSource, string, bool) {
+	key, src := r.source(path)
+	switch src.Kind {
+	case sourceEnv:
+		return key, src, os.Getenv(key.Env), true
+	case sourceFile:
+		return key, src, r.file.values[path].Value, true
+	}
+	return key, src, "", false
+}
+
+func (r *configResolver) intValue(path string) int {
+	key, src, raw, ok := r.raw(path)
+	if !ok {
+		return r.cli.getIntValue(r.cmd, key.Flag, key.Env)
+	}
+	val, err := strconv.Atoi(raw)
+	if err != nil {
+		r.invalid(path, src, fmt.Sprintf("%q is not an integer", raw))
+		val, _ = r.cmd.PersistentFlags().GetInt(key.Flag)
+	}
+	return val
+}
+
+func (r *configResolver) int64Value(path string) int64 {
+	key, src, raw, ok := r.raw(path)
+	if !ok {
+		return r.cli.getInt64Value(r.cmd, key.Flag, key.Env)
+	}
+	val, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		r.invalid(path, src, fmt.Sprintf("%q is not an integer", raw))
+		val, _ = r.cmd.PersistentFlags().GetInt64(key.Flag)
+	}
+	return val
+}
+
+func (r *configResolver) boolValue(path string) bool {
+	key, src, raw, ok := r.raw(path)
+	if !ok {
+		return r.cli.getBoolValue(r.cmd, key.Flag, key.Env)
+	}
+	val, err := strconv.ParseBool(raw)
+	if err != nil {
+		r.invalid(path, src, fmt.Sprintf("%q is not a boolean", raw))
+		val, _ = r.cmd.PersistentFlags().GetBool(key.Flag)
+	}
+	return val
+}
+
+func (r *configResolver) floatValue(path string) float64 {
+	key, src, raw, ok := r.raw(path)
+	if !ok {
+		val, _ := r.cmd.PersistentFlags().GetFloat64(key.Flag)
+		return val
+	}
+	val, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		r.invalid(path, src, fmt.Sprintf("%q is not a number", raw))
+		val, _ = r.cmd.PersistentFlags().GetFloat64(key.Flag)
+	}
+	return val
+}
+
+func (r *configResolver) durationValue(path string) time.Duration {
+	key, src, raw, ok := r.raw(path)
+	if !ok {
+		val, _ := r.cmd.PersistentFlags().GetDuration(key.Flag)
+		return val
+	}
+	val, err := time.ParseDuration(raw)
+	if err != nil {
+		r.invalid(path, src, fmt.Sprintf("%q is not a duration", raw))
+		val, _ = r.cmd.PersistentFlags().GetDuration(key.Flag)
+	}
+	return val
+}
+
+// loadYAMLConfigFile loads the YAML config file, remembering parse errors for config validate
+func (c *CLI) loadYAMLConfigFile(path string) {
+	cfg, err := loadYAMLConfig(path)
+	if err != nil {
+		c.logger.WithError(err).Warn("Could not load config file")
+		c.yamlConfig = &yamlConfig{
+			path:     path,
+			problems: []configProblem{{Key: "config", Source: valueSource{Kind: sourceFile, Name: path}, Message: err.Error()}},
+		}
+		return
+	}
+	c.yamlConfig = cfg
+}
+
+// validateCLIConfig checks the configuration offline and reports each problem with its key and source
+func validateCLIConfig(config *CLIConfig) []configProblem {
+	problems := append([]configProblem(nil), config.problems...)
+	report := func(path, message string) {
+		problems = append(problems, configProblem{Key: path, Source: config.sources[path], Message: message})
+	}
+	// missing reports a required setting that no flag, variable or config file sets
+	missing := func(path, message string) {
+		problems = append(problems, configProblem{Key: path, Message: message})
+	}
+
+	if config.usesGitHubApp() {
+		if config.GitHubAppID == 0 {
+			missing("github.app_id", "required for GitHub App authentication")
+		}
+		if config.GitHubInstallationID == 0 {
+			missing("github.installation_id", "required for GitHub App authentication")
+		}
+		if config.GitHubPrivateKeyFile == "" {
+			missing("github.private_key_file", "required for GitHub App authentication")
+		} else if _, err := os.Stat(config.GitHubPrivateKeyFile); err != nil {
+			report("github.private_key_file", fmt.Sprintf("cannot read %s", config.GitHubPrivateKeyFile))
+		}
+	} else if config.GitHubToken == "" {
+		missing("github.token", "required unless GitHub App credentials are set")
+	}
+	if len(config.Repositories) == 0 && config.Organization == "" {
+		if config.RepoOwner == "" {
+			missing("github.owner", "required")
+		}
+		if config.RepoName == "" {
+			missing("github.repo", "required")
+		}
+	}
+	for _, repo := range config.Repositories {
+		if _, err := parseRepository(repo); err != nil {
+			report("github.repositories", err.Error())
+		}
+	}
+	if err := validateRepoFilter(RepoFilter{Include: config.RepoInclude}); err != nil {
+		report("github.repo_include", err.Error())
+	}
+	if err := validateRepoFilter(RepoFilter{Exclude: config.RepoExclude}); err != nil {
+		report("github.repo_exclude", err.Error())
+	}
+	for _, key := range []struct{ path, value string }{
+		{"github.api_url", config.GitHubAPIURL},
+		{"github.upload_url", config.GitHubUploadURL},
+	} {
+		if key.value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(key.value); err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+			report(key.path, fmt.Sprintf("%q is not an absolute http(s) URL", key.value))
+		}
+	}
+
+	if !isKnownLLMProvider(LLMProvider(config.LLMProvider)) {
+		report("llm.provider", fmt.Sprintf("unknown provider %q, expected one of %s", config.LLMProvider, strings.Join(knownLLMProviderNames(), ", ")))
+	}
+	if config.LLMAPIKey == "" {
+		missing("llm.api_key", "required")
+	}
+	if config.MinCoverage < 0 || config.MinCoverage > 100 {
+		report("monitoring.min_coverage", fmt.Sprintf("must be between 0 and 100, got %d", config.MinCoverage))
+	}
+	if config.NotificationWebhook != "" {
+		// The webhook URL is a secret, so it is not repeated in the message
+		if parsed, err := url.Parse(config.NotificationWebhook); err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+			report("notifications.webhook_url", "is not an absolute http(s) URL")
+		}
+	}
+	if err := validatePRCommentMode(PRCommentMode(strings.ToLower(config.PRCommentMode))); err != nil {
+		report("pr.comment_mode", err.Error())
+	}
+	if err := validateTestNetwork(TestNetwork(strings.ToLower(config.TestNetwork))); err != nil {
+		report("monitoring.test_network", err.Error())
+	}
+	if err := validateNotificationFormat(config.NotificationFormat); err != nil {
+		report("notifications.format", fmt.Sprintf("unknown notification format %q, expected webhook or slack", config.NotificationFormat))
+	}
+	if config.FlakyRetryMaxAge < 0 {
+		report("monitoring.flaky_retry_max_age", fmt.Sprintf("must not be negative, got %v", config.FlakyRetryMaxAge))
+	}
+	if _, err := config.llmHeaders(); err != nil {
+		report("llm.headers", err.Error())
+	}
+	if config.LLMCacheTTL < 0 {
+		report("llm.cache_ttl", fmt.Sprintf("must not be negative, got %v", config.LLMCacheTTL))
+	}
+	if config.LLMInputPrice < 0 {
+		report("llm.input_price_per_1k", fmt.Sprintf("must not be negative, got %v", config.LLMInputPrice))
+	}
+	if config.LLMOutputPrice < 0 {
+		report("llm.output_price_per_1k", fmt.Sprintf("must not be negative, got %v", config.LLMOutputPrice))
+	}
+	if config.EscalationConfidence < 0 || config.EscalationConfidence > 1 {
+		report("llm.escalation_confidence", fmt.Sprintf("must be between 0 and 1, got %v", config.EscalationConfidence))
+	}
+	if config.LogChunkFactor != 0 && config.LogChunkFactor < 1 {
+		report("llm.log_chunk_factor", fmt.Sprintf("must be at least 1, got %v", config.LogChunkFactor))
+	}
+	if config.LogChunkBytes < 0 {
+		report("llm.log_chunk_bytes", fmt.Sprintf("must not be negative, got %d", config.LogChunkBytes))
+	}
+	if config.LogChunkMax < 0 {
+		report("llm.log_chunk_max", fmt.Sprintf("must not be negative, got %d", config.LogChunkMax))
+	}
+	if config.PromptDir != "" {
+		if _, err := loadPromptTemplateDir(config.PromptDir); err != nil {
+			report("prompts.dir", err.Error())
+		}
+	}
+	if err := validateGuardrailAction(config.fixGuardrails().Action); err != nil {
+		report("guardrails.action", err.Error())
+	}
+	for _, pattern := range config.ProtectedPaths {
+		if _, err := codeownersPattern(pattern); err != nil {
+			report("guardrails.protected_paths", err.Error())
+		}
+	}
+	classification := config.fileClassification()
+	if err := (FileClassification{BinaryExtensions: classification.BinaryExtensions}).validate(); err != nil {
+		report("files.binary_extensions", err.Error())
+	}
+	if err := (FileClassification{GeneratedFiles: classification.GeneratedFiles}).validate(); err != nil {
+		report("files.generated", err.Error())
+	}
+	for _, pattern := range config.RedactionPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			report("redaction.patterns", fmt.Sprintf("invalid regular expression %q: %v", pattern, err))
+		}
+	}
+	if _, err := logrus.ParseLevel(config.LogLevel); err != nil {
+		report("logging.level", fmt.Sprintf("unknown log level %q", config.LogLevel))
+	}
+	if config.LogFormat != "json" && config.LogFormat != "text" {
+		report("logging.format", fmt.Sprintf("unknown log format %q, expected json or text", config.LogFormat))
+	}
+	return problems
+}
+
+var knownLLMProviders = []LLMProvider{OpenAI, Anthropic, Gemini, DeepSeek, LiteLLM}
+
+func isKnownLLMProvider(provider LLMProvider) bool {
+	for _, known := range knownLLMProviders {
+		if provider == known {
+			return true
+		}
+	}
+	return false
+}
+
+func knownLLMProviderNames() []string {
+	names := make([]string, len(knownLLMProviders))
+	for i, provider := range knownLLMProviders {
+		names[i] = string(provider)
+	}
+	return names
+}
+
+// sourceOf describes where a setting came from for config show, e.g. " (env GITHUB_TOKEN)"
+func (c *CLIConfig) sourceOf(path string) string {
+	src, ok := c.sources[path]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", src)
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clearConfigEnv unsets every configuration variable for the duration of the test
+func clearConfigEnv(t *testing.T) {
+	for _, key := range configKeys {
+		t.Setenv(key.Env, "")
+	}
+}
+
+func writeConfigFile(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, yamlConfigName)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+// TestLoadYAMLConfig tests reading nested sections and expanding ${VAR} references
+func TestLoadYAMLConfig(t *testing.T) {
+	t.Setenv("AUTOFIX_TEST_TOKEN", "ghp_from_env")
+	path := writeConfigFile(t, t.TempDir(), `github:
+  token: ${AUTOFIX_TEST_TOKEN}
+  owner: acme
+  repo: widgets
+llm:
+  provider: anthropic
+  api_key: ${AUTOFIX_TEST_UNSET}
+  model: claude
+monitoring:
+  min_coverage: 90
+pr:
+  reviewers: [alice, acme/platform]
+  labels: ci
+pricing: cheap
+`)
+
+	cfg, err := loadYAMLConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, fileValue{Value: "ghp_from_env", Line: 2}, cfg.values["github.token"])
+	assert.Equal(t, fileValue{Value: "anthropic", Line: 6}, cfg.values["llm.provider"])
+	assert.Equal(t, fileValue{Value: "90", Line: 10}, cfg.values["monitoring.min_coverage"])
+	assert.Equal(t, []string{"alice", "acme/platform"}, cfg.values["pr.reviewers"].List)
+
+	var problems []string
+	for _, problem := range cfg.problems {
+		problems = append(problems, problem.String())
+	}
+	assert.Equal(t, []string{
+		"llm.api_key (file " + path + ":7): environment variable AUTOFIX_TEST_UNSET is not set",
+		"llm.model (file " + path + ":8): unknown key",
+		"pricing (file " + path + ":14): unknown key",
+	}, problems)
+
+	_, err = loadYAMLConfig(writeConfigFile(t, t.TempDir(), "github: [\n"))
+	assert.ErrorContains(t, err, "failed to parse config file")
+}
+
+// TestGetCurrentConfigPrecedence tests that flags override env, env overrides the
+// config file and the file overrides defaults, recording each value's source
+func TestGetCurrentConfigPrecedence(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, t.TempDir(), `github:
+  owner: file-owner
+  repo: file-repo
+llm:
+  provider: gemini
+monitoring:
+  min_coverage: 70
+pr:
+  labels: [from-file]
+`)
+	t.Setenv("REPO_OWNER", "env-owner")
+	t.Setenv("LLM_PROVIDER", "deepseek")
+
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	require.NoError(t, cli.rootCmd.ParseFlags([]string{"--config", path, "--llm-provider", "anthropic"}))
+	cli.loadConfiguration()
+
+	config := cli.getCurrentConfig(cli.rootCmd)
+	assert.Equal(t, "anthropic", config.LLMProvider)
+	assert.Equal(t, "env-owner", config.RepoOwner)
+	assert.Equal(t, "file-repo", config.RepoName)
+	assert.Equal(t, 70, config.MinCoverage)
+	assert.Equal(t, []string{"from-file"}, config.PRLabels)
+	assert.Empty(t, config.TargetBranch, "the repository's default branch")
+	assert.Equal(t, path, config.ConfigFile)
+
+	assert.Equal(t, " (flag --llm-provider)", config.sourceOf("llm.provider"))
+	assert.Equal(t, " (env REPO_OWNER)", config.sourceOf("github.owner"))
+	assert.Equal(t, " (file "+path+":3)", config.sourceOf("github.repo"))
+	assert.Equal(t, " (default)", config.sourceOf("github.target_branch"))
+}
+
+// TestDiscoverYAMLConfig tests finding the config file in the working directory,
+// the repository root and $XDG_CONFIG_HOME
+func TestDiscoverYAMLConfig(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "cmd", "tool")
+	require.NoError(t, os.MkdirAll(sub, 0o755))
+	require.NoError(t, os.Mkdir(filepath.Join(root, ".git"), 0o755))
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(sub))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	assert.Empty(t, discoverYAMLConfig())
+
+	xdg := filepath.Join(configHome, "github-autofix", "config.yml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(xdg), 0o755))
+	require.NoError(t, os.WriteFile(xdg, []byte("{}"), 0o644))
+	assert.Equal(t, xdg, discoverYAMLConfig())
+
+	atRoot := writeConfigFile(t, root, "{}")
+	assert.Equal(t, atRoot, discoverYAMLConfig())
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	inCwd := writeConfigFile(t, cwd, "{}")
+	assert.Equal(t, inCwd, discoverYAMLConfig())
+}
+
+// TestValidateCLIConfig tests the offline checks and how problems are reported
+func TestValidateCLIConfig(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, t.TempDir(), `github:
+  api_url: "not a url"
+llm:
+  provider: mistral
+  escalation_confidence: 1.5
+monitoring:
+  min_coverage: 150
+  dry_run: maybe
+`)
+	t.Setenv("LLM_API_KEY", "sk-test")
+	t.Setenv("LOG_FORMAT", "xml")
+
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	require.NoError(t, cli.rootCmd.ParseFlags([]string{"--config", path}))
+	cli.loadConfiguration()
+
+	var problems []string
+	for _, problem := range validateCLIConfig(cli.getCurrentConfig(cli.rootCmd)) {
+		problems = append(problems, problem.String())
+	}
+	assert.Equal(t, []string{
+		`monitoring.dry_run (file ` + path + `:8): "maybe" is not a boolean`,
+		"github.token (not set): required unless GitHub App credentials are set",
+		"github.owner (not set): required",
+		"github.repo (not set): required",
+		`github.api_url (file ` + path + `:2): "not a url" is not an absolute http(s) URL`,
+		`llm.provider (file ` + path + `:4): unknown provider "mistral", expected one of openai, anthropic, gemini, deepseek, litellm`,
+		"monitoring.min_coverage (file " + path + ":7): must be between 0 and 100, got 150",
+		"llm.escalation_confidence (file " + path + ":5): must be between 0 and 1, got 1.5",
+		`logging.format (env LOG_FORMAT): unknown log format "xml", expected json or text`,
+	}, problems)
+
+	t.Run("ValidConfig", func(t *testing.T) {
+		config := &CLIConfig{GitHubToken: "ghp_test", RepoOwner: "acme", RepoName: "widgets", LLMProvider: "litellm",
+			LLMAPIKey: "sk-test", MinCoverage: 0, GitHubAPIURL: "https://github.example.com/api/v3/", LogLevel: "info", LogFormat: "text"}
+		assert.Empty(t, validateCLIConfig(config))
+	})
+
+	t.Run("GitHubApp", func(t *testing.T) {
+		config := &CLIConfig{GitHubAppID: 12, GitHubPrivateKeyFile: filepath.Join(t.TempDir(), "missing.pem"), RepoOwner: "acme", RepoName: "widgets",
+			LLMProvider: "openai", LLMAPIKey: "sk-test", MinCoverage: 85, LogLevel: "info", LogFormat: "json"}
+		problems := validateCLIConfig(config)
+		require.Len(t, problems, 2)
+		assert.Equal(t, "github.installation_id (not set): required for GitHub App authentication", problems[0].String())
+		assert.Contains(t, problems[1].String(), "github.private_key_file (not set): cannot read")
+	})
+}
+
+// TestNotificationConfig tests reading and validating the notification settings
+func TestNotificationConfig(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, t.TempDir(), `notifications:
+  webhook_url: ${AUTOFIX_TEST_WEBHOOK}
+  format: teams
+`)
+	t.Setenv("AUTOFIX_TEST_WEBHOOK", "hooks.slack.com/services/T000/B000/secret")
+
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	require.NoError(t, cli.rootCmd.ParseFlags([]string{"--config", path}))
+	cli.loadConfiguration()
+
+	config := cli.getCurrentConfig(cli.rootCmd)
+	assert.Equal(t, "hooks.slack.com/services/T000/B000/secret", config.NotificationWebhook)
+	assert.Equal(t, "teams", config.NotificationFormat)
+
+	var problems []string
+	for _, problem := range validateCLIConfig(config) {
+		if strings.HasPrefix(problem.Key, "notifications.") {
+			problems = append(problems, problem.String())
+		}
+	}
+	assert.Equal(t, []string{
+		"notifications.webhook_url (file " + path + ":2): is not an absolute http(s) URL",
+		`notifications.format (file ` + path + `:3): unknown notification format "teams", expected webhook or slack`,
+	}, problems)
+
+	t.Setenv("NOTIFICATION_WEBHOOK_URL", "https://example.com/hooks/autofix")
+	require.NoError(t, cli.rootCmd.ParseFlags([]string{"--notification-format", "webhook"}))
+	config = cli.getCurrentConfig(cli.rootCmd)
+	assert.Equal(t, "https://example.com/hooks/autofix", config.NotificationWebhook)
+	assert.Equal(t, " (env NOTIFICATION_WEBHOOK_URL)", config.sourceOf("notifications.webhook_url"))
+	assert.Equal(t, " (flag --notification-format)", config.sourceOf("notifications.format"))
+}
+
+// TestRedactionPatternsConfig tests reading redaction patterns as a YAML list, which may
+// contain commas, and reporting invalid expressions
+func TestRedactionPatternsConfig(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, t.TempDir(), `redaction:
+  patterns:
+    - 'ACME-[0-9]{4,8}'
+    - '(unclosed'
+`)
+
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	require.NoError(t, cli.rootCmd.ParseFlags([]string{"--config", path}))
+	cli.loadConfiguration()
+
+	config := cli.getCurrentConfig(cli.rootCmd)
+	assert.Equal(t, []string{"ACME-[0-9]{4,8}", "(unclosed"}, config.RedactionPatterns)
+
+	var problems []string
+	for _, problem := range validateCLIConfig(config) {
+		if problem.Key == "redaction.patterns" {
+			problems = append(problems, problem.Message)
+		}
+	}
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0], `invalid regular expression "(unclosed"`)
+
+	t.Setenv("REDACTION_PATTERNS", "internal-[0-9]+")
+	config = cli.getCurrentConfig(cli.rootCmd)
+	assert.Equal(t, []string{"internal-[0-9]+"}, config.RedactionPatterns)
+}
+
+// TestPathPolicyConfig tests reading the path prefixes fixes may change from the config file,
+// flags and the environment
+func TestPathPolicyConfig(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfigFile(t, t.TempDir(), `paths:
+  allow: [src, docs]
+  deny:
+    - src/generated
+`)
+
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	require.NoError(t, cli.rootCmd.ParseFlags([]string{"--config", path, "--deny-path", "vendor"}))
+	cli.loadConfiguration()
+
+	config := cli.getCurrentConfig(cli.rootCmd)
+	assert.Equal(t, []string{"src", "docs"}, config.AllowedPaths)
+	assert.Equal(t, []string{"vendor"}, config.DeniedPaths)
+	assert.Equal(t, " (flag --deny-path)", config.sourceOf("paths.deny"))
+
+	t.Setenv("ALLOWED_PATHS", "lib")
+	config = cli.getCurrentConfig(cli.rootCmd)
+	assert.Equal(t, []string{"lib"}, config.AllowedPaths)
+}
+
+// TestRunConfigValidateReportsProblems tests that config validate prints each problem
+// and fails without initializing the agent
+func TestRunConfigValidateReportsProblems(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("GITHUB_TOKEN", "ghp_test")
+	t.Setenv("REPO_OWNER", "acme")
+	t.Setenv("REPO_NAME", "widgets")
+	t.Setenv("LLM_API_KEY", "sk-test")
+	t.Setenv("MIN_COVERAGE", "-5")
+
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	cli.yamlConfig = nil
+	validateCmd, _, err := cli.rootCmd.Find([]string{"config", "validate"})
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	validateCmd.SetOut(&out)
+	err = cli.runConfigValidate(validateCmd, nil)
+	assert.EqualError(t, err, "configuration validation failed: 1 problem(s) found")
+	assert.Equal(t, "monitoring.min_coverage (env MIN_COVERAGE): must be between 0 and 100, got -5\n", out.String())
+
+	t.Setenv("MIN_COVERAGE", "")
+	out.Reset()
+	assert.NoError(t, cli.runConfigValidate(validateCmd, nil))
+	assert.Empty(t, out.String())
+}
+
+// TestCreateDefaultYAMLConfig tests that config init writes a YAML template that loads cleanly
+func TestCreateDefaultYAMLConfig(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "ghp_test")
+	t.Setenv("LLM_API_KEY", "sk-test")
+	t.Setenv("REPO_OWNER", "acme")
+	t.Setenv("REPO_NAME", "widgets")
+	path := filepath.Join(t.TempDir(), "autofix.yml")
+
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	require.NoError(t, cli.createDefaultConfig(path))
+
+	cfg, err := loadYAMLConfig(path)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.problems)
+	assert.Equal(t, "openai", cfg.values["llm.provider"].Value)
+	assert.Equal(t, "ghp_test", cfg.values["github.token"].Value)
+	assert.Equal(t, "acme", cfg.values["github.owner"].Value)
+}
+
+// TestLLMHeadersConfig tests reading extra LLM headers, expanding ${VAR} references in the
+// config file, and reporting headers overriding the API key
+func TestLLMHeadersConfig(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("AUTOFIX_TEST_GATEWAY_TOKEN", "gw-0123456789")
+	path := writeConfigFile(t, t.TempDir(), `llm:
+  headers:
+    - 'X-Org-Id: acme'
+    - 'X-Gateway-Token: ${AUTOFIX_TEST_GATEWAY_TOKEN}'
+  openai_organization: org-acme
+`)
+
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	require.NoError(t, cli.rootCmd.ParseFlags([]string{"--config", path, "--openai-project", "proj_ci"}))
+	cli.loadConfiguration()
+
+	config := cli.getCurrentConfig(cli.rootCmd)
+	headers, err := config.llmHeaders()
+	require.NoError(t, err)
+	assert.Equal(t, []LLMHeader{
+		{Name: "X-Org-Id", Value: "acme"},
+		{Name: "X-Gateway-Token", Value: "gw-0123456789"},
+		{Name: headerOpenAIOrganization, Value: "org-acme"},
+		{Name: headerOpenAIProject, Value: "proj_ci"},
+	}, headers)
+
+	t.Setenv("LLM_HEADERS", "x-api-key: stolen")
+	config = cli.getCurrentConfig(cli.rootCmd)
+	var problems []string
+	for _, problem := range validateCLIConfig(config) {
+		if problem.Key == "llm.headers" {
+			problems = append(problems, problem.Message)
+		}
+	}
+	assert.Equal(t, []string{"LLM header X-Api-Key is set from the API key and cannot be overridden"}, problems)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Defaults of the monitor command's log file rotation
+const (
+	defaultLogMaxSizeMB = 100
+	defaultLogKeep      = 5
+)
+
+// errAlreadyRunning is returned when the PID file names another running monitor
+var errAlreadyRunning = errors.New("another instance is already running")
+
+// acquirePIDFile writes the process ID to path and returns the function removing it again.
+// It refuses to start while the PID already in the file is a running process; files left
+// by processes that exited are replaced.
+func acquirePIDFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create PID file directory: %w", err)
+	}
+	pid := os.Getpid()
+	// A stale file is removed once and the exclusive create retried, so two monitors
+	// starting together cannot both take it
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", pid)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write PID file: %w", err)
+			}
+			return func() { releasePIDFile(path, pid) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) || attempt > 0 {
+			return nil, fmt.Errorf("failed to create PID file: %w", err)
+		}
+
+		holder, err := readPIDFile(path)
+		if err == nil && holder != pid && processRunning(holder) {
+			return nil, fmt.Errorf("%w with PID %d (%s)", errAlreadyRunning, holder, path)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove stale PID file: %w", err)
+		}
+	}
+}
+
+// releasePIDFile removes the PID file unless another process took it over
+func releasePIDFile(path string, pid int) {
+	if holder, err := readPIDFile(path); err == nil && holder == pid {
+		os.Remove(path)
+	}
+}
+
+// readPIDFile returns the process ID in a PID file
+func readPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("invalid PID file %s", path)
+	}
+	return pid, nil
+}
+
+// processRunning reports whether a process with pid exists. Signal 0 only checks for it;
+// a permission error means it exists but belongs to another user.
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// rotatingFile is a log file renamed to path.1, path.2, ... once it reaches maxSize bytes,
+// keeping the keep most recent of them
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	keep    int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// openRotatingFile opens path for appending, rotating it at maxSizeMB megabytes
+func openRotatingFile(path string, maxSizeMB, keep int) (*rotatingFile, error) {
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultLogMaxSizeMB
+	}
+	if keep < 0 {
+		keep = defaultLogKeep
+	}
+	r := &rotatingFile{path: path, maxSize: int64(maxSizeMB) << 20, keep: keep}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	r.file, r.size = file, info.Size()
+	return nil
+}
+
+// Write appends p, first rotating the file when p would take it past its maximum size
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the rotated files up by one, dropping the oldest, and starts a new file
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+
+	var err error
+	if r.keep == 0 {
+		err = os.Remove(r.path)
+	} else {
+		os.Remove(r.rotatedPath(r.keep))
+		for i := r.keep - 1; i >= 1; i-- {
+			os.Rename(r.rotatedPath(i), r.rotatedPath(i+1))
+		}
+		err = os.Rename(r.path, r.rotatedPath(1))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) rotatedPath(n int) string {
+	return fmt.Sprintf("%s.%d", r.path, n)
+}
+
+// Close closes the current file
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
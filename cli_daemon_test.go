@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exitedPID returns the PID of a process that has exited
+func exitedPID(t *testing.T) int {
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+	return cmd.Process.Pid
+}
+
+// TestAcquirePIDFile tests that PID files of running processes stop a second monitor, and
+// that stale and corrupt ones are replaced
+func TestAcquirePIDFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "autofix.pid")
+	writePID := func(content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	release, err := acquirePIDFile(path)
+	require.NoError(t, err)
+	pid, err := readPIDFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), pid)
+	release()
+	assert.NoFileExists(t, path)
+
+	// The test binary's parent is running
+	writePID(strconv.Itoa(os.Getppid()) + "\n")
+	_, err = acquirePIDFile(path)
+	assert.ErrorIs(t, err, errAlreadyRunning)
+	assert.ErrorContains(t, err, strconv.Itoa(os.Getppid()))
+
+	for name, content := range map[string]string{
+		"Stale":   strconv.Itoa(exitedPID(t)),
+		"Corrupt": "not a pid",
+		"OwnPID":  strconv.Itoa(os.Getpid()), // e.g. PID 1 again after a container restart
+	} {
+		t.Run(name, func(t *testing.T) {
+			writePID(content)
+			release, err := acquirePIDFile(path)
+			require.NoError(t, err)
+			pid, err := readPIDFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, os.Getpid(), pid)
+			release()
+		})
+	}
+
+	// A PID file another process took over is left alone
+	release, err = acquirePIDFile(path)
+	require.NoError(t, err)
+	writePID(strconv.Itoa(os.Getppid()))
+	release()
+	assert.FileExists(t, path)
+}
+
+// TestRotatingFile tests rotating the log file by size, keeping the newest files
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autofix.log")
+	file, err := openRotatingFile(path, 1, 2)
+	require.NoError(t, err)
+	file.maxSize = 10
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		n, err := file.Write([]byte(line))
+		require.NoError(t, err)
+		assert.Equal(t, len(line), n)
+	}
+	require.NoError(t, file.Close())
+
+	read := func(path string) string {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(data)
+	}
+	assert.Equal(t, "fourth\n", read(path))
+	assert.Equal(t, "third\n", read(path+".1"))
+	assert.Equal(t, "second\n", read(path+".2"))
+	assert.NoFileExists(t, path+".3", "only two rotated files are kept")
+
+	// Reopening appends and counts the existing size
+	file, err = openRotatingFile(path, 1, 2)
+	require.NoError(t, err)
+	file.maxSize = 10
+	_, err = file.Write([]byte("fifth\n"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	assert.Equal(t, "fifth\n", read(path))
+	assert.Equal(t, "fourth\n", read(path+".1"))
+
+	_, err = file.Write([]byte("closed\n"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+}
+
+// TestMonitorLogFile tests that the monitor's --log-file receives the CLI's logs
+func TestMonitorLogFile(t *testing.T) {
+	cli, _ := outputCLI(t, OutputText)
+	path := filepath.Join(t.TempDir(), "autofix.log")
+	monitorCmd, _, err := cli.rootCmd.Find([]string{"monitor"})
+	require.NoError(t, err)
+	require.NoError(t, monitorCmd.ParseFlags([]string{"--log-file", path}))
+
+	closeLog, err := cli.setupLogFile(monitorCmd)
+	require.NoError(t, err)
+	cli.logger.SetLevel(logrus.InfoLevel)
+	cli.logger.Info("Starting workflow monitoring")
+	closeLog()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "Starting workflow monitoring")
+}
@@ -67,8 +67,9 @@ func TestCLICommandFunctionsSimple(t *testing.T) {
 
 	t.Run("runConfigValidate", func(t *testing.T) {
 		cmd := &cobra.Command{}
+		cmd.Flags().Bool("live", true, "")
 		err := cli.runConfigValidate(cmd, []string{})
-		// Expected to fail in test environment due to Dagger not being available
+		// Live checks are expected to fail in test environment due to Dagger not being available
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "dagger client not available")
 	})
@@ -350,7 +350,8 @@ func TestCreateDefaultConfig(t *testing.T) {
 	configStr := string(content)
 
 	// Check that expected content is present
-	assert.Contains(t, configStr, "GITHUB_TOKEN=your_github_token_here")
+	assert.Contains(t, configStr, "GITHUB_TOKEN=${GITHUB_TOKEN}")
+	assert.Contains(t, configStr, "LLM_API_KEY=${LLM_API_KEY}")
 	assert.Contains(t, configStr, "LLM_PROVIDER=openai")
 	assert.Contains(t, configStr, "MIN_COVERAGE=85")
 	assert.Contains(t, configStr, "LOG_LEVEL=info")
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v45/github"
+)
+
+// codeownersPaths are the locations GitHub reads CODEOWNERS from, in the order it looks
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// codeownersRule is one CODEOWNERS line: a path pattern and the owners of matching files
+type codeownersRule struct {
+	pattern string
+	match   *regexp.Regexp
+	owners  []string
+}
+
+// Codeowners holds the rules of a CODEOWNERS file
+type Codeowners struct {
+	rules []codeownersRule
+	// Invalid lists the line numbers GitHub would reject, which are ignored
+	Invalid []int
+}
+
+// ParseCodeowners parses a CODEOWNERS file. Patterns follow GitHub's gitignore-like rules:
+// "*" and "?" do not match "/", "**" matches across directories, a leading or inner "/"
+// anchors the pattern to the repository root and a trailing "/" matches everything in the
+// directory. GitHub does not support "!" negation or "[ ]" ranges, so those lines are
+// ignored and listed in Invalid.
+func ParseCodeowners(content string) *Codeowners {
+	owners := &Codeowners{}
+	for i, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		pattern := fields[0]
+		if strings.HasPrefix(pattern, `\#`) {
+			pattern = pattern[1:]
+		}
+		match, err := codeownersPattern(pattern)
+		if err != nil {
+			owners.Invalid = append(owners.Invalid, i+1)
+			continue
+		}
+		rule := codeownersRule{pattern: pattern, match: match}
+		for _, owner := range fields[1:] {
+			if strings.HasPrefix(owner, "#") {
+				break
+			}
+			rule.owners = append(rule.owners, owner)
+		}
+		owners.rules = append(owners.rules, rule)
+	}
+	return owners
+}
+
+// codeownersPattern compiles a CODEOWNERS pattern into a regular expression matching
+// repository relative paths
+func codeownersPattern(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, "!") || strings.ContainsAny(pattern, "[]") {
+		return nil, fmt.Errorf("unsupported pattern %q", pattern)
+	}
+	directory := strings.HasSuffix(pattern, "/")
+	trimmed := strings.Trim(pattern, "/")
+	if trimmed == "" {
+		return nil, fmt.Errorf("empty pattern %q", pattern)
+	}
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+
+	var expr strings.Builder
+	if anchored {
+		expr.WriteString("^")
+	} else {
+		expr.WriteString("^(?:.*/)?")
+	}
+	segments := strings.Split(trimmed, "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if segment == "**" {
+			if last {
+				expr.WriteString(".*")
+			} else {
+				expr.WriteString("(?:.*/)?")
+			}
+			continue
+		}
+		for _, r := range segment {
+			switch r {
+			case '*':
+				expr.WriteString("[^/]*")
+			case '?':
+				expr.WriteString("[^/]")
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		if !last {
+			expr.WriteString("/")
+		}
+	}
+	switch {
+	case directory:
+		expr.WriteString("/.*")
+	case segments[len(segments)-1] == "*" && len(segments) > 1:
+		// GitHub matches "docs/*" against the files in docs, but not in its subdirectories
+	default:
+		expr.WriteString("(?:/.*)?")
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// Owners returns the owners of file. The last matching rule wins, so a later rule without
+// owners leaves the file unowned.
+func (c *Codeowners) Owners(file string) []string {
+	file = strings.TrimPrefix(path.Clean(strings.TrimPrefix(file, "/")), "./")
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if c.rules[i].match.MatchString(file) {
+			return c.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// OwnersOf returns the @user and @org/team owners of any of files, in the order they are
+// first matched. Email owners cannot be requested as reviewers and are skipped.
+func (c *Codeowners) OwnersOf(files []string) []string {
+	var handles []string
+	for _, file := range files {
+		for _, owner := range c.Owners(file) {
+			if strings.HasPrefix(owner, "@") {
+				handles = append(handles, owner)
+			}
+		}
+	}
+	return mergeNames(nil, handles)
+}
+
+// BranchReviewRules are the review requirements branch protection puts on a target branch
+type BranchReviewRules struct {
+	RequiredApprovals       int  `json:"required_approvals"`
+	RequireCodeOwnerReviews bool `json:"require_code_owner_reviews"`
+}
+
+// GetCodeowners reads the CODEOWNERS file of ref, returning nil when the repository has none
+func (g *GitHubIntegration) GetCodeowners(ctx context.Context, ref string) (*Codeowners, error) {
+	for _, file := range codeownersPaths {
+		content, ok, err := g.GetFileContent(ctx, file, ref)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return ParseCodeowners(content), nil
+		}
+	}
+	return nil, nil
+}
+
+// GetBranchReviewRules returns the pull request review rules protecting branch, or nil when
+// the branch is not protected or does not require reviews. Reading protection needs admin
+// access, so callers should treat ErrGitHubAuth as unknown rules.
+func (g *GitHubIntegration) GetBranchReviewRules(ctx context.Context, branch string) (*BranchReviewRules, error) {
+	protection, err := callGitHub(ctx, g, func() (*github.Protection, *github.Response, error) {
+		return g.client.Repositories.GetBranchProtection(ctx, g.repoOwner, g.repoName, branch)
+	})
+	if errors.Is(err, github.ErrBranchNotProtected) || errors.Is(err, ErrGitHubNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s branch protection: %w", branch, err)
+	}
+	reviews := protection.GetRequiredPullRequestReviews()
+	if reviews == nil {
+		return nil, nil
+	}
+	return &BranchReviewRules{
+		RequiredApprovals:       reviews.RequiredApprovingReviewCount,
+		RequireCodeOwnerReviews: reviews.RequireCodeOwnerReviews,
+	}, nil
+}
+
+// PermissionError is returned by Initialize when the token cannot create the branches and
+// pull requests fixes need. errors.Is matches it with ErrGitHubAuth.
+type PermissionError struct {
+	Repository string
+	Missing    string // the repository permission the token lacks
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("token lacks %s permission on %s, which fix branches and pull requests need", e.Missing, e.Repository)
+}
+
+func (e *PermissionError) Unwrap() error {
+	return ErrGitHubAuth
+}
+
+// CheckPushAccess fails with a PermissionError when the token cannot push to the repository.
+// GitHub does not report permissions for every token, e.g. GitHub App installation tokens,
+// and those pass.
+func (g *GitHubIntegration) CheckPushAccess(ctx context.Context) error {
+	name := g.repoOwner + "/" + g.repoName
+	repo, err := callGitHub(ctx, g, func() (*github.Repository, *github.Response, error) {
+		return g.client.Repositories.Get(ctx, g.repoOwner, g.repoName)
+	})
+	var errResp *github.ErrorResponse
+	if errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w: %w", &PermissionError{Repository: name, Missing: "read"}, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get repository %s: %w", name, err)
+	}
+	if permissions := repo.GetPermissions(); len(permissions) > 0 && !permissions["push"] {
+		return &PermissionError{Repository: name, Missing: "push"}
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCodeowners = `# Default owners
+*                   @acme/maintainers
+
+*.js                @frontend-dev
+**/logs             @logger
+/build/logs/        @doctocat
+docs/*              docs@example.com @acme/docs
+apps/               @octocat
+/scripts/**/deploy  @acme/sre
+\#notes.md          @hubot
+
+# Later rules win, and a rule without owners leaves the files unowned
+/vendor/
+!generated.go       @ignored
+[Mm]akefile         @ignored
+`
+
+// TestCodeownersOwners tests GitHub's CODEOWNERS path matching
+func TestCodeownersOwners(t *testing.T) {
+	owners := ParseCodeowners(testCodeowners)
+	assert.Equal(t, []int{14, 15}, owners.Invalid, "negations and ranges are not supported")
+
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{"main.go", []string{"@acme/maintainers"}},
+		{"./cmd/main.go", []string{"@acme/maintainers"}},
+		{"web/app.js", []string{"@frontend-dev"}},
+		{"build/logs/2024/today.log", []string{"@doctocat"}},
+		{"src/build/logs/a.txt", []string{"@logger"}}, // /build/logs/ is anchored to the root
+		{"var/logs", []string{"@logger"}},
+		{"docs/index.md", []string{"docs@example.com", "@acme/docs"}},
+		{"docs/guides/setup.md", []string{"@acme/maintainers"}}, // docs/* only matches direct files
+		{"apps/web/main.go", []string{"@octocat"}},
+		{"src/apps/main.go", []string{"@octocat"}}, // unanchored directory
+		{"scripts/deploy", []string{"@acme/sre"}},
+		{"scripts/ci/prod/deploy", []string{"@acme/sre"}},
+		{"tools/scripts/deploy", []string{"@acme/maintainers"}},
+		{"#notes.md", []string{"@hubot"}},
+		{"vendor/lib/lib.go", nil},
+		{"generated.go", []string{"@acme/maintainers"}},
+		{"Makefile", []string{"@acme/maintainers"}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, owners.Owners(tt.file), tt.file)
+	}
+
+	assert.Equal(t, []string{"@frontend-dev", "@acme/docs", "@acme/maintainers"},
+		owners.OwnersOf([]string{"app.js", "docs/a.md", "lib/b.js", "main.go", "vendor/x.go"}))
+	assert.Empty(t, ParseCodeowners("").OwnersOf([]string{"main.go"}))
+}
+
+// TestCreateFixPRRequestsCodeowners tests that fix PRs request the code owners of the changed
+// files and note the approvals branch protection requires
+func TestCreateFixPRRequestsCodeowners(t *testing.T) {
+	ctx := context.Background()
+	analysis := &FailureAnalysisResult{ID: "analysis-42", Context: FailureContext{WorkflowRun: &WorkflowRun{ID: 42}}}
+	fix := highConfidenceFix()
+	fix.Fix.Changes = []CodeChange{
+		{FilePath: "web/app.js", Operation: ChangeOperationModify, NewContent: "x\n"},
+		{FilePath: "api/main.go", Operation: ChangeOperationModify, NewContent: "y\n"},
+	}
+
+	tests := []struct {
+		name             string
+		codeownersPath   string
+		protectionStatus int
+		protection       string
+		wantUsers        []string
+		wantTeams        []string
+		wantSection      string
+	}{
+		{
+			name:             "protected with code owners",
+			codeownersPath:   ".github/CODEOWNERS",
+			protectionStatus: http.StatusOK,
+			protection:       `{"required_pull_request_reviews":{"required_approving_review_count":2,"require_code_owner_reviews":true}}`,
+			wantUsers:        []string{"octocat", "frontend-dev"},
+			wantTeams:        []string{"maintainers"},
+			wantSection: "## 👀 Review Requirements\n\n**Required approvals**: 2, including a code owner\n" +
+				"**Code Owners**: @frontend-dev, @acme/maintainers\n\n---\n",
+		},
+		{
+			name:             "docs CODEOWNERS and protection without reviews",
+			codeownersPath:   "docs/CODEOWNERS",
+			protectionStatus: http.StatusOK,
+			protection:       `{"required_status_checks":{"strict":true}}`,
+			wantUsers:        []string{"octocat", "frontend-dev"},
+			wantTeams:        []string{"maintainers"},
+			wantSection:      "## 👀 Review Requirements\n\n**Code Owners**: @frontend-dev, @acme/maintainers\n\n---\n",
+		},
+		{
+			name:             "unprotected without CODEOWNERS",
+			protectionStatus: http.StatusNotFound,
+			protection:       `{"message":"Branch not protected"}`,
+			wantUsers:        []string{"octocat"},
+		},
+		{
+			name:             "protection unreadable without admin access",
+			codeownersPath:   "CODEOWNERS",
+			protectionStatus: http.StatusForbidden,
+			protection:       `{"message":"Resource not accessible by integration"}`,
+			wantUsers:        []string{"octocat", "frontend-dev"},
+			wantTeams:        []string{"maintainers"},
+			wantSection:      "## 👀 Review Requirements\n\n**Code Owners**: @frontend-dev, @acme/maintainers\n\n---\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh, mux, got := prDefaultsMux(t, false, "")
+			mux.HandleFunc("/repos/owner/repo/branches/main/protection", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.protectionStatus)
+				fmt.Fprint(w, tt.protection)
+			})
+			mux.HandleFunc("/repos/owner/repo/contents/", func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/repos/owner/repo/contents/"+tt.codeownersPath {
+					http.NotFound(w, r)
+					return
+				}
+				assert.Equal(t, "main", r.URL.Query().Get("ref"))
+				fmt.Fprintf(w, `{"type":"file","encoding":"base64","content":%q}`, base64.StdEncoding.EncodeToString([]byte(testCodeowners)))
+			})
+
+			engine := NewPullRequestEngine(gh, quietLogger())
+			engine.SetPRDefaults(PRDefaults{Reviewers: []string{"octocat"}})
+			_, err := engine.CreateFixPR(ctx, analysis, fix)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantUsers, got.reviewers.Reviewers)
+			assert.Equal(t, tt.wantTeams, got.reviewers.TeamReviewers)
+			if tt.wantSection == "" {
+				assert.NotContains(t, got.body, "Review Requirements")
+			} else {
+				assert.Contains(t, got.body, tt.wantSection)
+			}
+		})
+	}
+}
+
+// TestCheckPushAccess tests detecting tokens that cannot open fix PRs
+func TestCheckPushAccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		repo    string
+		wantErr string
+	}{
+		{name: "push", status: http.StatusOK, repo: `{"permissions":{"pull":true,"push":true}}`},
+		{name: "no permissions reported", status: http.StatusOK, repo: `{"name":"repo"}`},
+		{name: "read only", status: http.StatusOK, repo: `{"permissions":{"pull":true,"push":false}}`,
+			wantErr: "token lacks push permission on owner/repo, which fix branches and pull requests need"},
+		{name: "forbidden", status: http.StatusForbidden, repo: `{"message":"Resource not accessible by integration"}`,
+			wantErr: "token lacks read permission on owner/repo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh, mux := newMockGitHubAPI(t)
+			mux.HandleFunc("/repos/owner/repo", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.repo)
+			})
+
+			err := gh.CheckPushAccess(context.Background())
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+			var permErr *PermissionError
+			assert.ErrorAs(t, err, &permErr)
+			assert.ErrorIs(t, err, ErrGitHubAuth)
+		})
+	}
+}
+
+// TestInitializeChecksPushAccess tests that Initialize fails early on a read-only token,
+// unless nothing will be pushed in dry-run mode
+func TestInitializeChecksPushAccess(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+	mux.HandleFunc("/repos/owner/repo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"permissions":{"pull":true,"push":false}}`)
+	})
+
+	oldGH, oldLLM := newGitHubIntegration, newLLMClient
+	t.Cleanup(func() { newGitHubIntegration, newLLMClient = oldGH, oldLLM })
+	newGitHubIntegration = func(ctx context.Context, token *dagger.Secret, owner, name string, endpoints *GitHubEndpoints, logger *logrus.Logger) (*GitHubIntegration, error) {
+		return gh, nil
+	}
+	newLLMClient = func(ctx context.Context, provider LLMProvider, apiKey *dagger.Secret, logger *logrus.Logger) (*LLMClient, error) {
+		return &LLMClient{provider: provider}, nil
+	}
+	agent := func() *DaggerAutofix {
+		m := New().
+			WithGitHubToken(createTestSecret("token", "ghp_test")).
+			WithLLMProvider("openai", createTestSecret("key", "sk-test")).
+			WithRepository("owner", "repo")
+		m.logger = quietLogger()
+		return m
+	}
+
+	_, err := agent().Initialize(context.Background())
+	var permErr *PermissionError
+	require.ErrorAs(t, err, &permErr)
+	assert.Equal(t, &PermissionError{Repository: "owner/repo", Missing: "push"}, permErr)
+	assert.Equal(t, exitGitHubAuth, exitCode(err))
+
+	_, err = agent().WithDryRun(true).Initialize(context.Background())
+	assert.NoError(t, err)
+}
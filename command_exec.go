@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// stderrTailLines is how many trailing lines of a failed command's output are kept in errors
+const stderrTailLines = 20
+
+// commandProgressInterval is how often a running stage command is reported at debug level
+var commandProgressInterval = 30 * time.Second
+
+// ExecOutput is the captured result of a command run in a test container
+type ExecOutput struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// Combined returns stdout followed by stderr, the output the parse functions operate on
+func (o *ExecOutput) Combined() string {
+	switch {
+	case o.Stderr == "":
+		return o.Stdout
+	case o.Stdout == "":
+		return o.Stderr
+	default:
+		return strings.TrimSuffix(o.Stdout, "\n") + "\n" + o.Stderr
+	}
+}
+
+// commandError reports a command that exited with a non-zero code
+type commandError struct {
+	command  string
+	exitCode int
+	// tail holds the last lines of stderr, or of stdout when stderr is empty
+	tail string
+}
+
+func (e *commandError) Error() string {
+	if e.tail == "" {
+		return fmt.Sprintf("%s exited with code %d", e.command, e.exitCode)
+	}
+	return fmt.Sprintf("%s exited with code %d:\n%s", e.command, e.exitCode, e.tail)
+}
+
+// tailLines returns the last n lines of s, ignoring trailing newlines
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// runCommand runs a stage command and returns the executed container and its combined
+// output. A non-zero exit is returned as a *commandError. Progress is logged at debug
+// level while the command runs, followed by its output once it finishes.
+func (e *TestEngine) runCommand(ctx context.Context, container ContainerInterface, stage, command string) (ContainerInterface, string, error) {
+	log := e.logger.WithFields(logrus.Fields{"stage": stage, "command": command})
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		start := time.Now()
+		ticker := time.NewTicker(commandProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				log.WithField("elapsed", time.Since(start).Round(time.Second)).Debug("Command still running")
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	executed, output, err := container.Exec(ctx, strings.Split(command, " "))
+	if err != nil {
+		return container, "", err
+	}
+
+	if e.logger.IsLevelEnabled(logrus.DebugLevel) {
+		for _, line := range strings.Split(strings.TrimRight(output.Combined(), "\n"), "\n") {
+			log.Debug(line)
+		}
+	}
+
+	if output.ExitCode != 0 {
+		tail := output.Stderr
+		if strings.TrimSpace(tail) == "" {
+			tail = output.Stdout
+		}
+		return executed, output.Combined(), &commandError{
+			command:  command,
+			exitCode: output.ExitCode,
+			tail:     tailLines(tail, stderrTailLines),
+		}
+	}
+	return executed, output.Combined(), nil
+}
+
+// commandFailureDetails adds the exit code and output tail of a failed command to details
+func commandFailureDetails(err error, details map[string]interface{}) map[string]interface{} {
+	var cmdErr *commandError
+	if errors.As(err, &cmdErr) {
+		details["exit_code"] = cmdErr.exitCode
+		details["stderr"] = cmdErr.tail
+	}
+	return details
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExecOutputCombined tests combining stdout and stderr for parsing
+func TestExecOutputCombined(t *testing.T) {
+	assert.Equal(t, "out\nerr\n", (&ExecOutput{Stdout: "out\n", Stderr: "err\n"}).Combined())
+	assert.Equal(t, "out", (&ExecOutput{Stdout: "out"}).Combined())
+	assert.Equal(t, "err", (&ExecOutput{Stderr: "err"}).Combined())
+
+	assert.Equal(t, "c\nd", tailLines("a\nb\nc\nd\n", 2))
+	assert.Equal(t, "a", tailLines("a", 20))
+}
+
+// TestRunTestsCapturesStderr verifies stderr and exit codes of failed stages end up in the result
+func TestRunTestsCapturesStderr(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("BuildFailure", func(t *testing.T) {
+		mockProvider := NewMockContainerProvider()
+		mock := mockProvider.MockContainer
+		mock.FileSystem = map[string]string{"go.mod": "module test"}
+
+		var stderr strings.Builder
+		for i := 1; i <= 25; i++ {
+			fmt.Fprintf(&stderr, "# warning %d\n", i)
+		}
+		stderr.WriteString("./main.go:12:2: undefined: parseConfig\n")
+		mock.SetCommandOutput("go build ./...", "", stderr.String(), 2, nil)
+
+		engine := NewTestEngine(80, quietLogger())
+		engine.SetContainerProvider(mockProvider)
+
+		result, err := engine.RunTests(ctx, "owner", "repo", "main")
+		require.NoError(t, err)
+		assert.False(t, result.Success)
+		assert.Equal(t, "build", result.Details["stage"])
+		assert.Equal(t, 2, result.Details["exit_code"])
+		assert.Contains(t, result.Details["stderr"], "undefined: parseConfig")
+		assert.Contains(t, result.Output, "undefined: parseConfig")
+
+		require.Len(t, result.Errors, 1)
+		assert.Contains(t, result.Errors[0], "go build ./... exited with code 2")
+		assert.Contains(t, result.Errors[0], "./main.go:12:2: undefined: parseConfig")
+		assert.NotContains(t, result.Errors[0], "# warning 6\n", "only the last lines of stderr are kept")
+		assert.Contains(t, result.Errors[0], "# warning 7\n")
+		assert.Len(t, strings.Split(result.Details["stderr"].(string), "\n"), stderrTailLines)
+	})
+
+	t.Run("TestFailureParsesCombinedOutput", func(t *testing.T) {
+		mockProvider := NewMockContainerProvider()
+		mock := mockProvider.MockContainer
+		mock.FileSystem = map[string]string{"go.mod": "module test"}
+		mock.SetCommandOutput("go test -json ./...",
+			`{"Action":"pass","Package":"test","Test":"TestOK","Elapsed":0.01}`,
+			"--- FAIL: TestBroken (0.00s)\n    broken_test.go:9: boom\n", 1, nil)
+
+		engine := NewTestEngine(80, quietLogger())
+		engine.SetContainerProvider(mockProvider)
+
+		result, err := engine.RunTests(ctx, "owner", "repo", "main")
+		require.NoError(t, err)
+		assert.Equal(t, "test", result.Details["stage"])
+		assert.Equal(t, 1, result.Details["exit_code"])
+		assert.Contains(t, result.Output, "broken_test.go:9: boom")
+		assert.Contains(t, result.Errors[0], "broken_test.go:9: boom")
+		assert.Equal(t, 1, result.PassedTests)
+	})
+
+	t.Run("EmptyStderrUsesStdout", func(t *testing.T) {
+		mockProvider := NewMockContainerProvider()
+		mock := mockProvider.MockContainer
+		mock.FileSystem = map[string]string{"go.mod": "module test"}
+		mock.SetCommandOutput("go test -json ./...", "FAIL\ttest [setup failed]\n", "", 1, nil)
+
+		engine := NewTestEngine(80, quietLogger())
+		engine.SetContainerProvider(mockProvider)
+
+		result, err := engine.RunTests(ctx, "owner", "repo", "main")
+		require.NoError(t, err)
+		assert.Equal(t, "FAIL\ttest [setup failed]", result.Details["stderr"])
+	})
+}
+
+// TestRunCommandLogsProgress verifies long-running commands report progress at debug level
+func TestRunCommandLogsProgress(t *testing.T) {
+	interval := commandProgressInterval
+	commandProgressInterval = 5 * time.Millisecond
+	defer func() { commandProgressInterval = interval }()
+
+	var logs bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&logs)
+	logger.SetLevel(logrus.DebugLevel)
+
+	mockProvider := NewMockContainerProvider()
+	mock := mockProvider.MockContainer
+	mock.CommandOutputs["go test ./..."] = MockCommandResult{Stdout: "ok\ttest\t0.1s\n", Delay: 50 * time.Millisecond}
+
+	engine := NewTestEngine(80, logger)
+	_, output, err := engine.runCommand(context.Background(), &MockContainerWrapper{mock}, stageTest, "go test ./...")
+	require.NoError(t, err)
+	assert.Equal(t, "ok\ttest\t0.1s\n", output)
+	assert.Contains(t, logs.String(), "Command still running")
+	assert.Contains(t, logs.String(), `msg="ok\ttest\t0.1s"`)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// DefaultCommitTemplate renders fix commits as Conventional Commits, e.g.
+// "fix(parser): handle empty input", with the analysis and fix IDs in the body
+const DefaultCommitTemplate = `{{.Type}}{{if .Scope}}({{.Scope}}){{end}}: {{.Subject}}
+
+Analysis ID: {{.AnalysisID}}
+Fix ID: {{.FixID}}
+
+Co-authored-by: {{.CoAuthor}}`
+
+// commitCoAuthor is credited on every fix commit
+const commitCoAuthor = "github-actions[bot] <41898282+github-actions[bot]@users.noreply.github.com>"
+
+// maxCommitSubject is the longest subject kept before it is truncated
+const maxCommitSubject = 72
+
+// CommitMessageData is available to commit message templates
+type CommitMessageData struct {
+	// Type is the Conventional Commit type derived from the fix type: fix, build, ci, test or chore
+	Type string
+	// Scope is the primary directory the fix changes, or "deps" for dependency fixes;
+	// empty when only root files change
+	Scope string
+	// Subject is the first line of the fix description, truncated to 72 characters
+	Subject string
+	// Description is the full fix description
+	Description string
+	FixType     FixType
+	FailureType FailureType
+	AnalysisID  string
+	FixID       string
+	// Files lists the changed file paths
+	Files []string
+	// CoAuthor is the Co-authored-by trailer value
+	CoAuthor string
+}
+
+// conventionalCommitType maps a fix type to its Conventional Commit type and fixed scope
+func conventionalCommitType(fixType FixType) (string, string) {
+	switch fixType {
+	case DependencyFix:
+		return "chore", "deps"
+	case ConfigurationFix, InfrastructureFix:
+		return "build", ""
+	case WorkflowFix:
+		return "ci", ""
+	case TestFix:
+		return "test", ""
+	default:
+		return "fix", ""
+	}
+}
+
+// newCommitMessageData collects the template fields for a fix
+func newCommitMessageData(analysis *FailureAnalysisResult, fix *ProposedFix) CommitMessageData {
+	commitType, scope := conventionalCommitType(fix.Type)
+	files := make([]string, 0, len(fix.Changes))
+	for _, change := range fix.Changes {
+		files = append(files, change.paths()...)
+	}
+	if scope == "" {
+		scope = commitScope(files)
+	}
+
+	data := CommitMessageData{
+		Type:        commitType,
+		Scope:       scope,
+		Subject:     commitSubject(fix.Description),
+		Description: fix.Description,
+		FixType:     fix.Type,
+		FixID:       fix.ID,
+		Files:       files,
+		CoAuthor:    commitCoAuthor,
+	}
+	if analysis != nil {
+		data.AnalysisID = analysis.ID
+		data.FailureType = analysis.Classification.Type
+	}
+	return data
+}
+
+// commitScope returns the name of the directory containing most of the changed files
+func commitScope(files []string) string {
+	counts := make(map[string]int)
+	scope, best := "", 0
+	for _, file := range files {
+		dir := path.Dir(path.Clean(file))
+		if dir == "." {
+			continue
+		}
+		counts[dir]++
+		if counts[dir] > best {
+			scope, best = dir, counts[dir]
+		}
+	}
+	return strings.TrimPrefix(path.Base(scope), ".")
+}
+
+// commitSubject returns the first line of the description without a trailing period,
+// truncated to maxCommitSubject characters
+func commitSubject(description string) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(description), "\n")
+	subject = strings.TrimSuffix(strings.TrimSpace(subject), ".")
+	if subject == "" {
+		return "apply automated fix"
+	}
+	if runes := []rune(subject); len(runes) > maxCommitSubject {
+		subject = strings.TrimSpace(string(runes[:maxCommitSubject-3])) + "..."
+	}
+	return subject
+}
+
+// parseCommitTemplate parses a commit message template, using DefaultCommitTemplate when empty
+func parseCommitTemplate(tmpl string) (*template.Template, error) {
+	if tmpl == "" {
+		tmpl = DefaultCommitTemplate
+	}
+	return template.New("commit").Parse(tmpl)
+}
+
+// renderCommitMessage renders the commit message for a fix with the given template
+func renderCommitMessage(tmpl string, analysis *FailureAnalysisResult, fix *ProposedFix) (string, error) {
+	parsed, err := parseCommitTemplate(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid commit template: %w", err)
+	}
+
+	var message strings.Builder
+	if err := parsed.Execute(&message, newCommitMessageData(analysis, fix)); err != nil {
+		return "", fmt.Errorf("failed to render commit message: %w", err)
+	}
+	return strings.TrimSpace(message.String()), nil
+}
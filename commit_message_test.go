@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRenderCommitMessage tests the default template for every fix type
+func TestRenderCommitMessage(t *testing.T) {
+	analysis := &FailureAnalysisResult{ID: "analysis-42-1700000000", Classification: FailureClassification{Type: BuildFailure}}
+	changes := map[FixType][]CodeChange{
+		CodeFix:           {{FilePath: "internal/parser/parser.go"}, {FilePath: "internal/parser/lexer.go"}, {FilePath: "main.go"}},
+		ConfigurationFix:  {{FilePath: "config/app.yaml"}},
+		DependencyFix:     {{FilePath: "go.mod"}, {FilePath: "go.sum"}},
+		InfrastructureFix: {{FilePath: "Dockerfile"}},
+		WorkflowFix:       {{FilePath: ".github/workflows/ci.yml"}},
+		TestFix:           {{FilePath: "pkg/api/handler_test.go"}},
+		SecurityFix:       {{FilePath: "pkg/auth/token.go"}},
+	}
+
+	tests := []struct {
+		fixType FixType
+		header  string
+	}{
+		{CodeFix, "fix(parser): Handle empty input"},
+		{ConfigurationFix, "build(config): Handle empty input"},
+		{DependencyFix, "chore(deps): Handle empty input"},
+		{InfrastructureFix, "build: Handle empty input"},
+		{WorkflowFix, "ci(workflows): Handle empty input"},
+		{TestFix, "test(api): Handle empty input"},
+		{SecurityFix, "fix(auth): Handle empty input"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.fixType), func(t *testing.T) {
+			fix := &ProposedFix{ID: "fix-1", Type: tt.fixType, Description: "Handle empty input.", Changes: changes[tt.fixType]}
+
+			message, err := renderCommitMessage("", analysis, fix)
+			require.NoError(t, err)
+			assert.Equal(t, tt.header+"\n\nAnalysis ID: analysis-42-1700000000\nFix ID: fix-1\n\n"+
+				"Co-authored-by: github-actions[bot] <41898282+github-actions[bot]@users.noreply.github.com>", message)
+		})
+	}
+}
+
+// TestCommitSubject tests truncating long and multi-line fix descriptions
+func TestCommitSubject(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	assert.Equal(t, strings.Repeat("x", 69)+"...", commitSubject(long))
+	assert.Len(t, commitSubject(long), maxCommitSubject)
+	assert.Equal(t, strings.Repeat("x", 72), commitSubject(strings.Repeat("x", 72)))
+	assert.Equal(t, "Pin lodash", commitSubject("Pin lodash\n\nVersion 4.17.21 fixes the build"))
+	assert.Equal(t, "apply automated fix", commitSubject(" "))
+}
+
+// TestCustomCommitTemplate tests overriding the template and rejecting invalid ones
+func TestCustomCommitTemplate(t *testing.T) {
+	fix := &ProposedFix{ID: "fix-1", Type: TestFix, Description: "Fix flaky test", Changes: []CodeChange{{FilePath: "a_test.go"}, {FilePath: "b_test.go"}}}
+
+	message, err := renderCommitMessage("{{.Type}}: {{.Subject}} [{{.FailureType}}]\n\n{{range .Files}}- {{.}}\n{{end}}", &FailureAnalysisResult{Classification: FailureClassification{Type: TestFailure}}, fix)
+	require.NoError(t, err)
+	assert.Equal(t, "test: Fix flaky test [test]\n\n- a_test.go\n- b_test.go", message)
+
+	_, err = renderCommitMessage("{{.Type", nil, fix)
+	assert.ErrorContains(t, err, "invalid commit template")
+
+	_, err = renderCommitMessage("{{.Missing}}", nil, fix)
+	assert.ErrorContains(t, err, "failed to render commit message")
+
+	err = New().WithGitHubToken(&dagger.Secret{}).WithRepository("owner", "repo").WithCommitTemplate("{{.Type").validateConfiguration()
+	assert.ErrorContains(t, err, "invalid commit template")
+}
+
+// TestFixPRCommitsUseCommitTemplate verifies the file commits of a fix PR carry the rendered message
+func TestFixPRCommitsUseCommitTemplate(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+	gh.SetTargetBranch("main")
+	var open []map[string]interface{}
+	fixPRAPI(t, mux, &open)
+
+	var messages []string
+	mux.HandleFunc("/repos/owner/repo/contents/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"type":"file","sha":"f00"}`)
+			return
+		}
+		var body github.RepositoryContentFileOptions
+		assert.NoError(t, decodeJSON(r, &body))
+		messages = append(messages, body.GetMessage())
+		fmt.Fprint(w, `{}`)
+	})
+
+	engine := NewPullRequestEngine(gh, quietLogger())
+	engine.SetCommitTemplate("{{.Type}}({{.Scope}}): {{.Subject}}\n\nFix ID: {{.FixID}}")
+	fix := &FixValidationResult{
+		Fix: &ProposedFix{
+			ID:          "fix-1",
+			Type:        DependencyFix,
+			Description: "Bump lodash to 4.17.21",
+			Confidence:  0.9,
+			Changes: []CodeChange{
+				{FilePath: "package.json", Operation: ChangeOperationModify, NewContent: "{}"},
+				{FilePath: "yarn.lock", Operation: ChangeOperationAdd, NewContent: "# lock"},
+			},
+		},
+		TestResult: &TestResult{Success: true, Coverage: 90},
+		Valid:      true,
+	}
+	analysis := &FailureAnalysisResult{ID: "a1", Classification: FailureClassification{Type: DependencyFailure}, Context: FailureContext{WorkflowRun: &WorkflowRun{ID: 42}}}
+
+	_, err := engine.CreateFixPR(context.Background(), analysis, fix)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"chore(deps): Bump lodash to 4.17.21\n\nFix ID: fix-1", "chore(deps): Bump lodash to 4.17.21\n\nFix ID: fix-1"}, messages)
+}
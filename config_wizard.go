@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Config file formats written by config init
+const (
+	ConfigFormatEnv  = "env"
+	ConfigFormatYAML = "yaml"
+)
+
+func validateConfigFormat(format string) error {
+	switch format {
+	case ConfigFormatEnv, ConfigFormatYAML:
+		return nil
+	default:
+		return fmt.Errorf("invalid config format %q, expected env or yaml", format)
+	}
+}
+
+// configAnswers are the settings config init asks for. Secrets are never asked for:
+// the generated file references them as ${GITHUB_TOKEN} and ${LLM_API_KEY}.
+type configAnswers struct {
+	Provider     string
+	Owner        string
+	Repo         string
+	TargetBranch string
+	MinCoverage  int
+}
+
+// defaultConfigAnswers are used for settings that are neither configured nor detected.
+// The repository is left as an environment reference so the file stays valid.
+func defaultConfigAnswers() configAnswers {
+	return configAnswers{
+		Provider:     string(OpenAI),
+		Owner:        "${REPO_OWNER}",
+		Repo:         "${REPO_NAME}",
+		TargetBranch: "main",
+		MinCoverage:  85,
+	}
+}
+
+// gitRemoteURL returns the URL of the origin remote of the clone in the working directory
+var gitRemoteURL = func() (string, error) {
+	out, err := exec.Command("git", "remote", "get-url", "origin").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get origin remote: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// stdinIsTerminal reports whether in is a terminal the CLI can prompt on
+var stdinIsTerminal = func(in io.Reader) bool {
+	f, ok := in.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	// /dev/null is also a character device
+	devNull, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, devNull)
+}
+
+// parseGitHubRemote extracts the owner and repository from an HTTPS or SSH remote URL
+func parseGitHubRemote(remote string) (string, string, bool) {
+	remote = strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(remote), "/"), ".git")
+	switch {
+	case strings.Contains(remote, "://"):
+		// https://github.com/owner/repo or ssh://git@github.com/owner/repo
+		remote = remote[strings.Index(remote, "://")+3:]
+		if i := strings.Index(remote, "/"); i != -1 {
+			remote = remote[i+1:]
+		} else {
+			return "", "", false
+		}
+	case strings.Contains(remote, ":"):
+		// git@github.com:owner/repo
+		remote = remote[strings.Index(remote, ":")+1:]
+	default:
+		return "", "", false
+	}
+
+	parts := strings.Split(remote, "/")
+	if len(parts) < 2 || parts[len(parts)-2] == "" || parts[len(parts)-1] == "" {
+		return "", "", false
+	}
+	return parts[len(parts)-2], parts[len(parts)-1], true
+}
+
+// prompter asks questions on out and reads the answers from in, one per line
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	return &prompter{in: bufio.NewReader(in), out: out}
+}
+
+// configWizard prompts for the config init settings
+type configWizard struct {
+	*prompter
+}
+
+func newConfigWizard(in io.Reader, out io.Writer) *configWizard {
+	return &configWizard{newPrompter(in, out)}
+}
+
+// ask prompts for a value, returning def when the answer is empty or input has ended
+func (w *prompter) ask(prompt, def string) (string, bool) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", prompt, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", prompt)
+	}
+	line, err := w.in.ReadString('\n')
+	eof := err != nil
+	if eof {
+		fmt.Fprintln(w.out)
+	}
+	if line = strings.TrimSpace(line); line != "" {
+		return line, eof
+	}
+	return def, eof
+}
+
+// confirm asks a yes/no question, defaulting to no
+func (w *prompter) confirm(prompt string) bool {
+	answer, _ := w.ask(prompt+" [y/N]", "")
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes"
+}
+
+// run prompts for each setting, offering defaults as the answer and asking again
+// when an answer is invalid
+func (w *configWizard) run(defaults configAnswers) (configAnswers, error) {
+	answers := defaults
+
+	for {
+		provider, eof := w.ask(fmt.Sprintf("LLM provider (%s)", strings.Join(knownLLMProviderNames(), ", ")), defaults.Provider)
+		if isKnownLLMProvider(LLMProvider(provider)) {
+			answers.Provider = provider
+			break
+		}
+		if eof {
+			return answers, fmt.Errorf("unknown LLM provider %q", provider)
+		}
+		fmt.Fprintf(w.out, "Unknown provider %q, expected one of %s\n", provider, strings.Join(knownLLMProviderNames(), ", "))
+	}
+
+	answers.Owner, _ = w.ask("Repository owner", defaults.Owner)
+	answers.Repo, _ = w.ask("Repository name", defaults.Repo)
+	answers.TargetBranch, _ = w.ask("Target branch", defaults.TargetBranch)
+
+	for {
+		coverage, eof := w.ask("Minimum test coverage (0-100)", strconv.Itoa(defaults.MinCoverage))
+		value, err := strconv.Atoi(coverage)
+		if err == nil && value >= 0 && value <= 100 {
+			answers.MinCoverage = value
+			break
+		}
+		if eof {
+			return answers, fmt.Errorf("invalid minimum coverage %q", coverage)
+		}
+		fmt.Fprintf(w.out, "Minimum coverage must be a number between 0 and 100\n")
+	}
+	return answers, nil
+}
+
+// initDefaults starts the answers from the current configuration, then the origin remote
+func (c *CLI) initDefaults(config *CLIConfig, out io.Writer) configAnswers {
+	answers := defaultConfigAnswers()
+	if config.LLMProvider != "" {
+		answers.Provider = config.LLMProvider
+	}
+	if config.TargetBranch != "" {
+		answers.TargetBranch = config.TargetBranch
+	}
+	if config.MinCoverage != 0 {
+		answers.MinCoverage = config.MinCoverage
+	}
+
+	if config.RepoOwner != "" && config.RepoName != "" {
+		answers.Owner, answers.Repo = config.RepoOwner, config.RepoName
+		return answers
+	}
+	remote, err := gitRemoteURL()
+	if err != nil {
+		c.logger.WithError(err).Debug("Not detecting repository from git remote")
+		return answers
+	}
+	if owner, repo, ok := parseGitHubRemote(remote); ok {
+		fmt.Fprintf(out, "Detected repository %s/%s from git remote origin\n", owner, repo)
+		answers.Owner, answers.Repo = owner, repo
+	}
+	return answers
+}
+
+// validateAnswers runs the config validate checks on the settings of a generated file
+func validateAnswers(answers configAnswers, filename string) []configProblem {
+	src := valueSource{Kind: sourceFile, Name: filename}
+	config := &CLIConfig{
+		GitHubToken:  "${GITHUB_TOKEN}",
+		LLMProvider:  answers.Provider,
+		LLMAPIKey:    "${LLM_API_KEY}",
+		RepoOwner:    answers.Owner,
+		RepoName:     answers.Repo,
+		TargetBranch: answers.TargetBranch,
+		MinCoverage:  answers.MinCoverage,
+		LogLevel:     "info",
+		LogFormat:    "json",
+		sources:      make(map[string]valueSource),
+	}
+	for _, key := range configKeys {
+		config.sources[key.Path] = src
+	}
+	return validateCLIConfig(config)
+}
+
+const envConfigTemplate = `# GitHub Actions Auto-Fix Agent Configuration
+# Secrets are read from the environment: export GITHUB_TOKEN and LLM_API_KEY
+
+# GitHub Settings
+GITHUB_TOKEN=${GITHUB_TOKEN}
+# Or authenticate as a GitHub App instead of using a token
+# GITHUB_APP_ID=123456
+# GITHUB_INSTALLATION_ID=7890123
+# GITHUB_PRIVATE_KEY_FILE=/path/to/app-private-key.pem
+# For GitHub Enterprise Server, point at your instance's API
+# GITHUB_API_URL=https://github.example.com/api/v3/
+REPO_OWNER={{.Owner}}
+REPO_NAME={{.Repo}}
+# Monitor further repositories from the same agent (comma-separated owner/name)
+# REPOSITORIES=acme/api,acme/web
+# Or discover the repositories of an organization, filtered by name globs
+# GITHUB_ORGANIZATION=acme
+# REPO_INCLUDE=service-*
+# REPO_EXCLUDE=*-sandbox
+TARGET_BRANCH={{.TargetBranch}}
+
+# LLM Settings
+LLM_PROVIDER={{.Provider}}
+LLM_API_KEY=${LLM_API_KEY}
+
+# Agent Settings
+MIN_COVERAGE={{.MinCoverage}}
+
+# Pull Request Policy (auto, draft or analysis-only per failure type)
+# POLICY_SECURITY=draft
+# POLICY_DEPLOYMENT=draft
+# POLICY_BUILD=auto
+# POLICY_MIN_CONFIDENCE=0.6
+
+# Allowed Fix Types (comma-separated fix types accepted per failure type)
+# FIX_TYPES_TEST=code
+# FIX_TYPES_CONFIGURATION=configuration,workflow
+
+# Pull Request Defaults (comma-separated; reviewers may be users or org/team)
+# PR_REVIEWERS=octocat,my-org/platform-team
+# PR_ASSIGNEES=octocat
+# PR_LABELS=needs-review
+# PR_AUTO_MERGE=false
+# PR_DRAFT=false
+
+# Notifications (Slack incoming webhooks are detected from the URL)
+# NOTIFICATION_WEBHOOK_URL=https://hooks.slack.com/services/T000/B000/XXXX
+# NOTIFICATION_FORMAT=slack
+
+# Re-run failures that look flaky and skip the fix when the re-run passes
+# FLAKY_RETRY=false
+# FLAKY_RETRY_MAX_AGE=24h
+
+# Upload the analysis of each fixed failure to GitHub code scanning as SARIF
+# SARIF_UPLOAD=false
+
+# Network for the repository's commands during fix validation (full, restricted, none)
+# TEST_NETWORK=full
+
+# Audit trail of every action the agent takes (JSON lines)
+# AUDIT_LOG=.github-autofix/audit.jsonl
+
+# Fixes remembered per failure, reused when the same failure recurs
+# FIX_HISTORY=.github-autofix/fix-history.json
+
+# LLM response cache (in memory unless a directory is set)
+# LLM_CACHE_DIR=.github-autofix/llm-cache
+# LLM_CACHE_TTL=24h
+# NO_LLM_CACHE=false
+
+# LLM prices in USD per 1K tokens for cost estimates (built-in prices when unset)
+# LLM_INPUT_PRICE_PER_1K=0.0025
+# LLM_OUTPUT_PRICE_PER_1K=0.01
+
+# Summarize logs far longer than the analysis prompt in chunks instead of cutting their middle
+# LLM_LOG_CHUNKING=false
+# LLM_LOG_CHUNK_BYTES=16000
+# LLM_LOG_CHUNK_MAX=8
+
+# Extra regular expressions masked in logs, prompts and test output (comma-separated)
+# REDACTION_PATTERNS=internal-[0-9]+
+
+# Logging Settings
+LOG_LEVEL=info
+LOG_FORMAT=json
+
+# Optional: LiteLLM Proxy (if using)
+# LITELLM_BASE_URL=http://localhost:4000
+
+# Optional: Advanced Settings
+# DRY_RUN=false
+# VERBOSE=false
+`
+
+const yamlConfigTemplate = `# GitHub Actions Auto-Fix Agent Configuration
+# Values may reference environment variables as ${VAR}; flags and environment
+# variables take precedence over this file.
+
+github:
+  token: ${GITHUB_TOKEN}
+  # Or authenticate as a GitHub App instead of using a token
+  # app_id: 123456
+  # installation_id: 7890123
+  # private_key_file: /path/to/app-private-key.pem
+  # For GitHub Enterprise Server, point at your instance's API
+  # api_url: https://github.example.com/api/v3/
+  owner: {{.Owner}}
+  repo: {{.Repo}}
+  # Further repositories monitored by the same agent
+  # repositories: [acme/api, acme/web]
+  # Or discover the repositories of an organization, filtered by name globs
+  # organization: acme
+  # repo_include: [service-*]
+  # repo_exclude: ["*-sandbox"]
+  # include_archived: false
+  # include_forks: false
+  target_branch: {{.TargetBranch}}
+
+llm:
+  provider: {{.Provider}} # {{providers}}
+  api_key: ${LLM_API_KEY}
+  # cache_dir: .github-autofix/llm-cache
+  # cache_ttl: 24h
+  # input_price_per_1k: 0.0025
+  # output_price_per_1k: 0.01
+  # log_chunking: true
+  # log_chunk_bytes: 16000
+  # log_chunk_max: 8
+
+monitoring:
+  min_coverage: {{.MinCoverage}}
+  dry_run: false
+  # flaky_retry: true
+  # flaky_retry_max_age: 24h
+  # sarif_upload: true
+  # test_network: restricted # full, restricted or none
+
+pr:
+  reviewers: []
+  labels: []
+  auto_merge: false
+  # coverage_gist: true # link each fix's HTML coverage report, needs the gist scope
+
+# notifications:
+#   webhook_url: ${NOTIFICATION_WEBHOOK_URL}
+#   format: slack # webhook, slack
+
+# audit:
+#   log: .github-autofix/audit.jsonl
+
+# history:
+#   path: .github-autofix/fix-history.json
+
+# redaction:
+#   patterns: ['internal-[0-9]+']
+
+logging:
+  level: info
+  format: json
+`
+
+var configTemplates = map[string]*template.Template{
+	ConfigFormatEnv: template.Must(template.New(ConfigFormatEnv).Parse(envConfigTemplate)),
+	ConfigFormatYAML: template.Must(template.New(ConfigFormatYAML).Funcs(template.FuncMap{
+		"providers": func() string { return strings.Join(knownLLMProviderNames(), ", ") },
+	}).Parse(yamlConfigTemplate)),
+}
+
+// renderConfigFile renders the answers as a config file of the given format
+func renderConfigFile(format string, answers configAnswers) (string, error) {
+	if err := validateConfigFormat(format); err != nil {
+		return "", err
+	}
+	var content strings.Builder
+	if err := configTemplates[format].Execute(&content, answers); err != nil {
+		return "", fmt.Errorf("failed to render config file: %w", err)
+	}
+	return content.String(), nil
+}
+
+// lineDiff returns a line-based diff of old and new, prefixing removed lines with "-",
+// added lines with "+" and unchanged lines with " "
+func lineDiff(old, new string) string {
+	a := strings.Split(strings.TrimSuffix(old, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(new, "\n"), "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			diff.WriteString(" " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			diff.WriteString("-" + a[i] + "\n")
+			i++
+		default:
+			diff.WriteString("+" + b[j] + "\n")
+			j++
+		}
+	}
+	return diff.String()
+}
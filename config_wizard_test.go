@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// initCommand returns the config init command with its flags parsed, reading prompts
+// from input and treating it as a terminal unless input is nil
+func initCommand(t *testing.T, input *string, args ...string) (*CLI, *cobra.Command, *bytes.Buffer) {
+	clearConfigEnv(t)
+	origTerminal, origRemote := stdinIsTerminal, gitRemoteURL
+	t.Cleanup(func() { stdinIsTerminal, gitRemoteURL = origTerminal, origRemote })
+	stdinIsTerminal = func(io.Reader) bool { return input != nil }
+	gitRemoteURL = func() (string, error) { return "git@github.com:acme/widgets.git", nil }
+
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	initCmd, _, err := cli.rootCmd.Find([]string{"config", "init"})
+	require.NoError(t, err)
+	require.NoError(t, initCmd.ParseFlags(args))
+	require.NoError(t, cli.rootCmd.ParseFlags(nil))
+
+	var out bytes.Buffer
+	initCmd.SetOut(&out)
+	if input != nil {
+		initCmd.SetIn(strings.NewReader(*input))
+	}
+	return cli, initCmd, &out
+}
+
+// TestConfigInitWizard tests answering the prompts, including an invalid answer that is asked again
+func TestConfigInitWizard(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autofix.yml")
+	input := "mistral\nanthropic\n\nplatform\nrelease\n150\n90\n"
+	cli, cmd, out := initCommand(t, &input, "--config", path)
+
+	require.NoError(t, cli.runConfigInit(cmd, nil))
+
+	assert.Contains(t, out.String(), "Detected repository acme/widgets from git remote origin")
+	assert.Contains(t, out.String(), "LLM provider (openai, anthropic, gemini, deepseek, litellm) [openai]: ")
+	assert.Contains(t, out.String(), `Unknown provider "mistral"`)
+	assert.Contains(t, out.String(), "Repository owner [acme]: ")
+	assert.Contains(t, out.String(), "Minimum coverage must be a number between 0 and 100")
+
+	t.Setenv("GITHUB_TOKEN", "ghp_test")
+	t.Setenv("LLM_API_KEY", "sk-test")
+	cfg, err := loadYAMLConfig(path)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.problems)
+	for key, want := range map[string]string{
+		"llm.provider":            "anthropic",
+		"llm.api_key":             "sk-test",
+		"github.token":            "ghp_test",
+		"github.owner":            "acme",
+		"github.repo":             "platform",
+		"github.target_branch":    "release",
+		"monitoring.min_coverage": "90",
+	} {
+		assert.Equal(t, want, cfg.values[key].Value, key)
+	}
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "token: ${GITHUB_TOKEN}")
+	assert.NotContains(t, string(content), "ghp_test")
+}
+
+// TestConfigInitNonInteractive tests --yes and --format without a terminal
+func TestConfigInitNonInteractive(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	input := "should not be read\n"
+	cli, cmd, out := initCommand(t, &input, "--yes", "--format", "yaml")
+	require.NoError(t, cli.runConfigInit(cmd, nil))
+	assert.NotContains(t, out.String(), "LLM provider")
+
+	content, err := os.ReadFile(filepath.Join(dir, yamlConfigName))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "owner: acme\n  repo: widgets\n")
+	assert.Contains(t, string(content), "provider: openai")
+
+	t.Run("EnvFormat", func(t *testing.T) {
+		path := filepath.Join(dir, "autofix.env")
+		cli, cmd, _ := initCommand(t, nil, "--config", path)
+		t.Setenv("MIN_COVERAGE", "75")
+		require.NoError(t, cli.runConfigInit(cmd, nil))
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "GITHUB_TOKEN=${GITHUB_TOKEN}\n")
+		assert.Contains(t, string(content), "REPO_OWNER=acme\nREPO_NAME=widgets\n")
+		assert.Contains(t, string(content), "MIN_COVERAGE=75\n")
+	})
+
+	t.Run("NoRemote", func(t *testing.T) {
+		path := filepath.Join(dir, "no-remote.env")
+		cli, cmd, _ := initCommand(t, nil, "--config", path)
+		gitRemoteURL = func() (string, error) { return "", errors.New("not a git repository") }
+		require.NoError(t, cli.runConfigInit(cmd, nil))
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "REPO_OWNER=${REPO_OWNER}\nREPO_NAME=${REPO_NAME}\n")
+	})
+
+	t.Run("InvalidSettings", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.env")
+		cli, cmd, out := initCommand(t, nil, "--config", path)
+		t.Setenv("LLM_PROVIDER", "mistral")
+
+		err := cli.runConfigInit(cmd, nil)
+		assert.EqualError(t, err, "generated configuration is invalid: 1 problem(s) found")
+		assert.Contains(t, out.String(), `llm.provider (file `+path+`): unknown provider "mistral"`)
+		assert.NoFileExists(t, path)
+	})
+
+	t.Run("InvalidFormat", func(t *testing.T) {
+		cli, cmd, _ := initCommand(t, nil, "--format", "toml")
+		assert.EqualError(t, cli.runConfigInit(cmd, nil), `invalid config format "toml", expected env or yaml`)
+	})
+}
+
+// TestConfigInitExistingFile tests refusing to overwrite without --force and showing the diff
+func TestConfigInitExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autofix.env")
+	cli, cmd, _ := initCommand(t, nil, "--config", path)
+	require.NoError(t, cli.runConfigInit(cmd, nil))
+
+	t.Run("UpToDate", func(t *testing.T) {
+		cli, cmd, out := initCommand(t, nil, "--config", path)
+		require.NoError(t, cli.runConfigInit(cmd, nil))
+		assert.Contains(t, out.String(), "is already up to date")
+	})
+
+	t.Run("Refused", func(t *testing.T) {
+		cli, cmd, out := initCommand(t, nil, "--config", path, "--target-branch", "develop")
+		err := cli.runConfigInit(cmd, nil)
+		assert.EqualError(t, err, path+" already exists, use --force to overwrite")
+		assert.Contains(t, out.String(), "-TARGET_BRANCH=main\n+TARGET_BRANCH=develop\n")
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "TARGET_BRANCH=main\n")
+	})
+
+	t.Run("DiffDeclined", func(t *testing.T) {
+		input := "\n\n\ndevelop\n\nn\n"
+		cli, cmd, out := initCommand(t, &input, "--config", path)
+		assert.Error(t, cli.runConfigInit(cmd, nil))
+		assert.Contains(t, out.String(), "already exists. Show what would change? [y/N]: ")
+		assert.NotContains(t, out.String(), "+TARGET_BRANCH=develop")
+	})
+
+	t.Run("Forced", func(t *testing.T) {
+		cli, cmd, _ := initCommand(t, nil, "--config", path, "--target-branch", "develop", "--force")
+		require.NoError(t, cli.runConfigInit(cmd, nil))
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "TARGET_BRANCH=develop\n")
+	})
+}
+
+// TestParseGitHubRemote tests the remote URL forms git clones use
+func TestParseGitHubRemote(t *testing.T) {
+	tests := []struct {
+		remote, owner, repo string
+		ok                  bool
+	}{
+		{"https://github.com/acme/widgets.git", "acme", "widgets", true},
+		{"https://github.com/acme/widgets", "acme", "widgets", true},
+		{"git@github.com:acme/widgets.git", "acme", "widgets", true},
+		{"ssh://git@github.example.com:2222/acme/widgets.git\n", "acme", "widgets", true},
+		{"https://github.com/acme", "", "", false},
+		{"/srv/git/widgets", "", "", false},
+		{"", "", "", false},
+	}
+
+	for _, tt := range tests {
+		owner, repo, ok := parseGitHubRemote(tt.remote)
+		assert.Equal(t, tt.ok, ok, tt.remote)
+		assert.Equal(t, tt.owner, owner, tt.remote)
+		assert.Equal(t, tt.repo, repo, tt.remote)
+	}
+}
+
+// TestLineDiff tests the diff shown before refusing to overwrite a config file
+func TestLineDiff(t *testing.T) {
+	assert.Equal(t, " a\n-b\n+B\n c\n+d\n", lineDiff("a\nb\nc\n", "a\nB\nc\nd\n"))
+	assert.Equal(t, " same\n", lineDiff("same\n", "same\n"))
+}
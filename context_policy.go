@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// DefaultContextMaxFiles is how many repository files the fix generation prompt includes
+	// by default
+	DefaultContextMaxFiles = 5
+	// DefaultContextMaxFileBytes is how much of each file the prompt includes by default
+	DefaultContextMaxFileBytes = 8000
+)
+
+// defaultContextSkipPatterns match lockfiles, build output, vendored and generated code,
+// which cost many tokens and explain few failures
+var defaultContextSkipPatterns = []string{
+	"package-lock.json", "yarn.lock", "pnpm-lock.yaml", "go.sum", "Cargo.lock", "poetry.lock",
+	"Gemfile.lock", "composer.lock", "**/dist/**", "**/vendor/**", "**/node_modules/**",
+	"*.min.js", "*.min.css", "*.map", "*.pb.go", "*_pb2.py",
+}
+
+// Relevance of a repository file to a failure. An error line mention outweighs the other two
+// together, and being an affected file outweighs a recent change.
+const (
+	contextScoreErrorLine    = 4
+	contextScoreAffected     = 2
+	contextScoreRecentCommit = 1
+)
+
+// contextPathPattern matches file paths in error lines, e.g. src/app.js:12:5 or
+// /home/runner/work/app/app/lib/util.py
+var contextPathPattern = regexp.MustCompile(`/?(?:[\w.@-]+/)*[\w@-][\w.@-]*\.[A-Za-z][A-Za-z0-9]*(:\d+)?`)
+
+// ContextPolicy decides which repository files the fix generation prompt includes. Files
+// mentioned in the error lines, affected by the failure or changed by the recent commits
+// are candidates, included by relevance until MaxFiles.
+type ContextPolicy struct {
+	// MaxFiles is the most files included and MaxFileBytes the most bytes of each; longer
+	// files keep their head and tail. Zero uses the defaults and a negative MaxFiles includes
+	// no files.
+	MaxFiles     int `json:"max_files"`
+	MaxFileBytes int `json:"max_file_bytes"`
+	// SkipPatterns are CODEOWNERS style patterns of files left out unless the error lines
+	// mention them; nil uses the defaults
+	SkipPatterns []string `json:"skip_patterns"`
+}
+
+// ContextFile is a repository file included in the fix generation prompt
+type ContextFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	// Truncated tells the middle of the file was omitted
+	Truncated bool `json:"truncated,omitempty"`
+	// Binary tells the content was left out, as the file is binary
+	Binary bool `json:"binary,omitempty"`
+	// Generated tells the file is generated, so fixes should change its sources instead
+	Generated bool `json:"generated,omitempty"`
+}
+
+// ContextDecision records why a candidate file was included in the prompt or skipped
+type ContextDecision struct {
+	Path     string `json:"path"`
+	Score    int    `json:"score"`
+	Included bool   `json:"included"`
+	Reason   string `json:"reason"`
+}
+
+// contextCandidate is a file the prompt may include and why it is relevant
+type contextCandidate struct {
+	path    string
+	score   int
+	reasons []string
+}
+
+// withDefaults fills the unset limits and skip patterns
+func (p ContextPolicy) withDefaults() ContextPolicy {
+	if p.MaxFiles == 0 {
+		p.MaxFiles = DefaultContextMaxFiles
+	}
+	if p.MaxFileBytes <= 0 {
+		p.MaxFileBytes = DefaultContextMaxFileBytes
+	}
+	if p.SkipPatterns == nil {
+		p.SkipPatterns = defaultContextSkipPatterns
+	}
+	return p
+}
+
+// validate checks the skip patterns
+func (p ContextPolicy) validate() error {
+	for _, pattern := range p.SkipPatterns {
+		if _, err := codeownersPattern(pattern); err != nil {
+			return fmt.Errorf("invalid context skip pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+// skipPattern returns the skip pattern matching a file, empty when none does
+func (p ContextPolicy) skipPattern(file string) string {
+	for _, pattern := range p.SkipPatterns {
+		// Invalid patterns are rejected when the agent is initialized
+		if expr, err := codeownersPattern(pattern); err == nil && expr.MatchString(file) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// contextCandidates scores the files relevant to an analyzed failure, most relevant first.
+// Ties keep the order the files were found in.
+func contextCandidates(analysis *FailureAnalysisResult) []*contextCandidate {
+	var candidates []*contextCandidate
+	byPath := make(map[string]*contextCandidate)
+	add := func(file string, score int, reason string) {
+		file, err := normalizeChangePath(file)
+		if err != nil {
+			return
+		}
+		candidate, ok := byPath[file]
+		if !ok {
+			candidate = &contextCandidate{path: file}
+			byPath[file] = candidate
+			candidates = append(candidates, candidate)
+		}
+		for _, existing := range candidate.reasons {
+			if existing == reason {
+				return
+			}
+		}
+		candidate.score += score
+		candidate.reasons = append(candidate.reasons, reason)
+	}
+
+	var errorLines []string
+	if logs := analysis.Context.Logs; logs != nil {
+		errorLines = logs.ErrorLines
+		for _, file := range annotatedFiles(logs) {
+			add(file, contextScoreErrorLine, "mentioned in the error lines")
+		}
+	}
+	for _, line := range errorLines {
+		for _, match := range contextPathPattern.FindAllStringSubmatch(line, -1) {
+			// Bare names without a directory or line number are more often hosts or
+			// identifiers than files
+			file := strings.TrimSuffix(match[0], match[1])
+			if strings.Contains(file, "/") || match[1] != "" {
+				add(file, contextScoreErrorLine, "mentioned in the error lines")
+			}
+		}
+	}
+	for _, file := range analysis.AffectedFiles {
+		add(file, contextScoreAffected, "affected by the failure")
+	}
+	for _, commit := range analysis.Context.RecentCommits {
+		for _, change := range commit.Changes {
+			if change.Status != "removed" {
+				add(change.Filename, contextScoreRecentCommit, "changed by a recent commit")
+			}
+		}
+	}
+	// Affected files and recent changes the error lines name without a directory
+	for _, candidate := range candidates {
+		if candidate.score < contextScoreErrorLine && mentionedIn(candidate.path, errorLines) {
+			candidate.score += contextScoreErrorLine
+			candidate.reasons = append([]string{"mentioned in the error lines"}, candidate.reasons...)
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+	return candidates
+}
+
+// mentionedIn reports whether any line names the file
+func mentionedIn(file string, lines []string) bool {
+	for _, line := range lines {
+		if strings.Contains(line, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectContextFiles fetches the most relevant files for the fix generation prompt at the
+// failed run's commit, and records the decision made for every candidate
+func (e *FailureAnalysisEngine) selectContextFiles(ctx context.Context, analysis *FailureAnalysisResult) ([]ContextFile, []ContextDecision) {
+	var ref string
+	if run := analysis.Context.WorkflowRun; run != nil {
+		ref = run.CommitSHA
+	}
+	if e.fileSource == nil || ref == "" {
+		return nil, nil
+	}
+	policy := e.contextPolicy.withDefaults()
+
+	var files []ContextFile
+	var decisions []ContextDecision
+	for _, candidate := range contextCandidates(analysis) {
+		decision := ContextDecision{Path: candidate.path, Score: candidate.score, Reason: strings.Join(candidate.reasons, ", ")}
+		mentioned := candidate.score >= contextScoreErrorLine
+		if pattern := policy.skipPattern(candidate.path); pattern != "" && !mentioned {
+			decision.Reason = fmt.Sprintf("skipped: generated or vendored (%s)", pattern)
+			decisions = append(decisions, decision)
+			continue
+		}
+		if len(files) >= policy.MaxFiles {
+			decision.Reason = fmt.Sprintf("skipped: over the limit of %d files", max(policy.MaxFiles, 0))
+			decisions = append(decisions, decision)
+			continue
+		}
+
+		content, found, err := e.fileSource(ctx, candidate.path, ref)
+		switch {
+		case err != nil:
+			decision.Reason = fmt.Sprintf("skipped: %v", err)
+		case !found:
+			decision.Reason = "skipped: not in the repository"
+		case e.fileClassification.binaryFile(candidate.path, content):
+			files = append(files, ContextFile{Path: candidate.path, Content: binaryPlaceholder(content), Binary: true})
+			decision.Reason += "; binary, content not included"
+			decision.Included = true
+		default:
+			file := ContextFile{Path: candidate.path, Content: content}
+			_, file.Generated = e.fileClassification.generatedFile(candidate.path)
+			if len(content) > policy.MaxFileBytes {
+				file.Content = truncateMiddle(content, policy.MaxFileBytes)
+				file.Truncated = true
+				decision.Reason += fmt.Sprintf("; cut to %d of %d bytes", policy.MaxFileBytes, len(content))
+			}
+			files = append(files, file)
+			decision.Included = true
+		}
+		decisions = append(decisions, decision)
+	}
+	return files, decisions
+}
+
+// truncateMiddle keeps the head and tail of content within limit bytes, marking what was
+// omitted in between
+func truncateMiddle(content string, limit int) string {
+	half := limit / 2
+	omitted := len(content) - 2*half
+	return fmt.Sprintf("%s\n... [%d bytes omitted] ...\n%s", content[:half], omitted, content[len(content)-half:])
+}
+
+// writeContextFilesPrompt adds the repository files selected for the prompt, so fixes modify
+// what the files actually contain
+func writeContextFilesPrompt(prompt *strings.Builder, files []ContextFile) {
+	if len(files) == 0 {
+		return
+	}
+	prompt.WriteString("## Repository Files\n\n")
+	for _, file := range files {
+		if file.Binary {
+			fmt.Fprintf(prompt, "### %s\n(%s; do not change this file)\n\n", file.Path, file.Content)
+			continue
+		}
+		note := ""
+		switch {
+		case file.Generated:
+			note = " (generated; change its sources instead, it is regenerated)"
+		case file.Truncated:
+			note = " (middle omitted; do not rewrite this file in full)"
+		}
+		fmt.Fprintf(prompt, "### %s%s\n```\n%s\n```\n\n", file.Path, note, strings.TrimRight(file.Content, "\n"))
+	}
+}
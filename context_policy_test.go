@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contextAnalysis returns an analysis of a failure at commit abc123 whose error lines,
+// affected files and recent commits name repository files
+func contextAnalysis(errorLines []string, affected []string, changed ...string) *FailureAnalysisResult {
+	var changes []FileChange
+	for _, file := range changed {
+		changes = append(changes, FileChange{Filename: file, Status: "modified"})
+	}
+	return &FailureAnalysisResult{
+		ID:            "analysis-1",
+		AffectedFiles: affected,
+		Context: FailureContext{
+			WorkflowRun:   &WorkflowRun{ID: 1, CommitSHA: "abc123"},
+			Logs:          &WorkflowLogs{ErrorLines: errorLines},
+			RecentCommits: []CommitInfo{{SHA: "abc123", Changes: changes}},
+		},
+	}
+}
+
+// TestContextCandidates tests that files are ranked by where they are named
+func TestContextCandidates(t *testing.T) {
+	analysis := contextAnalysis(
+		[]string{
+			"FAIL src/sum.test.js:12:5",
+			"  at /home/runner/work/app/app/lib/util.js:3",
+			"npm ERR! request to https://registry.npmjs.org failed",
+			"Expected config.yml to exist",
+		},
+		[]string{"src/sum.js", "lib/util.js", "config.yml"},
+		"README.md", "src/sum.js",
+	)
+
+	var paths []string
+	scores := make(map[string]int)
+	for _, candidate := range contextCandidates(analysis) {
+		paths = append(paths, candidate.path)
+		scores[candidate.path] = candidate.score
+	}
+	assert.Equal(t, []string{"lib/util.js", "config.yml", "src/sum.test.js", "src/sum.js", "README.md"}, paths)
+	assert.Equal(t, map[string]int{
+		"lib/util.js":     contextScoreErrorLine + contextScoreAffected,
+		"config.yml":      contextScoreErrorLine + contextScoreAffected,
+		"src/sum.test.js": contextScoreErrorLine,
+		"src/sum.js":      contextScoreAffected + contextScoreRecentCommit,
+		"README.md":       contextScoreRecentCommit,
+	}, scores)
+}
+
+// TestContextPolicySkipPatterns tests the default skip list and the patterns overriding it
+func TestContextPolicySkipPatterns(t *testing.T) {
+	policy := ContextPolicy{}.withDefaults()
+	for file, pattern := range map[string]string{
+		"package-lock.json":          "package-lock.json",
+		"web/yarn.lock":              "yarn.lock",
+		"dist/app.js":                "**/dist/**",
+		"pkg/vendor/lib/x.go":        "**/vendor/**",
+		"static/jquery.min.js":       "*.min.js",
+		"api/service.pb.go":          "*.pb.go",
+		"src/app.js":                 "",
+		"distribution/notes.md":      "",
+		"internal/vendoring/tool.go": "",
+	} {
+		assert.Equal(t, pattern, policy.skipPattern(file), file)
+	}
+
+	policy = ContextPolicy{SkipPatterns: []string{"*.snap"}}.withDefaults()
+	assert.Equal(t, "*.snap", policy.skipPattern("tests/__snapshots__/app.snap"))
+	assert.Empty(t, policy.skipPattern("package-lock.json"), "custom patterns replace the defaults")
+
+	assert.NoError(t, ContextPolicy{}.validate())
+	assert.Error(t, ContextPolicy{SkipPatterns: []string{"!dist/"}}.validate())
+}
+
+// TestSelectContextFiles tests which files the fix generation prompt includes and the
+// decisions recorded for the others
+func TestSelectContextFiles(t *testing.T) {
+	repo := map[string]string{
+		"src/sum.js":        "module.exports = (a, b) => a - b\n",
+		"package-lock.json": `{"lockfileVersion": 3}`,
+		"yarn.lock":         "# yarn lockfile v1\n",
+		"src/big.js":        strings.Repeat("a", 60) + strings.Repeat("b", 60),
+		"README.md":         "# app\n",
+	}
+	var refs []string
+	engine := NewFailureAnalysisEngine(&scriptedLLMClient{}, quietLogger())
+	engine.SetFileSource(func(ctx context.Context, path, ref string) (string, bool, error) {
+		refs = append(refs, ref)
+		if path == "src/broken.js" {
+			return "", false, errors.New("connection reset")
+		}
+		content, ok := repo[path]
+		return content, ok, nil
+	})
+	engine.SetContextPolicy(ContextPolicy{MaxFiles: 3, MaxFileBytes: 40})
+
+	analysis := contextAnalysis(
+		[]string{"npm ERR! package-lock.json is out of sync", "FAIL src/sum.test.js:3"},
+		[]string{"package-lock.json", "src/sum.js", "src/broken.js", "yarn.lock", "src/big.js"},
+		"README.md",
+	)
+	files, decisions := engine.selectContextFiles(context.Background(), analysis)
+
+	require.Len(t, files, 3)
+	assert.Equal(t, ContextFile{Path: "package-lock.json", Content: `{"lockfileVersion": 3}`, Generated: true}, files[0], "the error lines make a lockfile the subject")
+	assert.Equal(t, "src/sum.js", files[1].Path)
+	assert.Equal(t, "src/big.js", files[2].Path)
+	assert.True(t, files[2].Truncated)
+	assert.Equal(t, strings.Repeat("a", 20)+"\n... [80 bytes omitted] ...\n"+strings.Repeat("b", 20), files[2].Content)
+
+	reasons := make(map[string]string)
+	for _, decision := range decisions {
+		reasons[decision.Path] = decision.Reason
+		assert.Equal(t, decision.Path != "src/sum.test.js" && decision.Path != "src/broken.js" &&
+			decision.Path != "yarn.lock" && decision.Path != "README.md", decision.Included, decision.Path)
+	}
+	assert.Equal(t, "skipped: not in the repository", reasons["src/sum.test.js"])
+	assert.Equal(t, "skipped: connection reset", reasons["src/broken.js"])
+	assert.Equal(t, "skipped: generated or vendored (yarn.lock)", reasons["yarn.lock"])
+	assert.Equal(t, "affected by the failure; cut to 40 of 120 bytes", reasons["src/big.js"])
+	assert.Equal(t, "skipped: over the limit of 3 files", reasons["README.md"])
+	for _, ref := range refs {
+		assert.Equal(t, "abc123", ref)
+	}
+
+	// Without a commit or a file source no files are included
+	analysis.Context.WorkflowRun.CommitSHA = ""
+	files, decisions = engine.selectContextFiles(context.Background(), analysis)
+	assert.Empty(t, files)
+	assert.Empty(t, decisions)
+}
+
+// TestGenerateFixesIncludesContextFiles tests that the selected files reach the fix
+// generation prompt and the decisions the analysis metadata
+func TestGenerateFixesIncludesContextFiles(t *testing.T) {
+	var prompt string
+	llm := &scriptedLLMClient{chatFunc: func(req *LLMRequest) (*LLMResponse, error) {
+		prompt = req.Prompt
+		return &LLMResponse{Content: `[{"type": "code", "description": "Add instead of subtracting", "confidence": 0.8,
+			"changes": [{"file_path": "src/sum.js", "operation": "modify", "new_content": "module.exports = (a, b) => a + b\n"}]}]`}, nil
+	}}
+	engine := NewFailureAnalysisEngine(llm, quietLogger())
+	engine.SetOSVClient(nil)
+	engine.SetFileSource(func(ctx context.Context, path, ref string) (string, bool, error) {
+		return "module.exports = (a, b) => a - b\n", path == "src/sum.js", nil
+	})
+
+	analysis := contextAnalysis([]string{"FAIL src/sum.test.js:3"}, []string{"src/sum.js"})
+	_, err := engine.GenerateFixes(context.Background(), analysis)
+	require.NoError(t, err)
+
+	assert.Contains(t, prompt, "## Repository Files\n\n### src/sum.js\n```\nmodule.exports = (a, b) => a - b\n```")
+	assert.Equal(t, []ContextFile{{Path: "src/sum.js", Content: "module.exports = (a, b) => a - b\n"}}, analysis.Context.Files)
+	assert.Equal(t, []ContextDecision{
+		{Path: "src/sum.test.js", Score: contextScoreErrorLine, Reason: "skipped: not in the repository"},
+		{Path: "src/sum.js", Score: contextScoreAffected, Included: true, Reason: "affected by the failure"},
+	}, analysis.Metadata["context_files"])
+}
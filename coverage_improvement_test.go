@@ -251,7 +251,7 @@ func TestUpdateFile(t *testing.T) {
 					err = assert.AnError
 				}
 			}()
-			err = engine.updateFile(ctx, "test-branch", change)
+			err = engine.updateFile(ctx, "test-branch", change, "")
 		}()
 		
 		// Should error due to nil GitHub client
@@ -279,7 +279,7 @@ func TestUpdateFile(t *testing.T) {
 					err = assert.AnError
 				}
 			}()
-			err = engine.updateFile(ctx, "test-branch", change)
+			err = engine.updateFile(ctx, "test-branch", change, "")
 		}()
 		
 		// Should error due to empty file path or nil client
@@ -315,7 +315,7 @@ func TestDeleteFile(t *testing.T) {
 					err = assert.AnError
 				}
 			}()
-			err = engine.deleteFile(ctx, "test-branch", change)
+			err = engine.deleteFile(ctx, "test-branch", change, "")
 		}()
 		
 		// Should error due to nil GitHub client
@@ -342,7 +342,7 @@ func TestDeleteFile(t *testing.T) {
 					err = assert.AnError
 				}
 			}()
-			err = engine.deleteFile(ctx, "test-branch", change)
+			err = engine.deleteFile(ctx, "test-branch", change, "")
 		}()
 		
 		// Should error due to empty file path or nil client
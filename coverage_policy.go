@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CoveragePolicy controls how a fix's test coverage decides whether the fix is valid
+type CoveragePolicy string
+
+const (
+	// CoveragePolicyAbsolute requires coverage of at least MinCoverage
+	CoveragePolicyAbsolute CoveragePolicy = "absolute"
+	// CoveragePolicyDelta requires coverage not to drop below the base branch by more than CoverageTolerance
+	CoveragePolicyDelta CoveragePolicy = "delta"
+	// CoveragePolicyEither accepts fixes that satisfy either the absolute or the delta policy
+	CoveragePolicyEither CoveragePolicy = "either"
+)
+
+// DefaultCoverageTolerance is how many percentage points coverage may drop under the delta policy
+const DefaultCoverageTolerance = 0.5
+
+// coverageNotMeasuredNote is the CoverageNote of fixes validated without coverage
+const coverageNotMeasuredNote = "Coverage not measured: the project has no coverage tooling the agent could run, so the fix was validated by its tests alone"
+
+// CoverageComparison compares a fix's coverage with the coverage of the base branch it targets
+type CoverageComparison struct {
+	BaseBranch   string  `json:"base_branch"`
+	BaseSHA      string  `json:"base_sha"`
+	BaseCoverage float64 `json:"base_coverage"`
+	FixCoverage  float64 `json:"fix_coverage"`
+	Delta        float64 `json:"delta"` // fix minus base, in percentage points
+	Tolerance    float64 `json:"tolerance"`
+}
+
+// withinTolerance reports whether coverage dropped by no more than the tolerance
+func (c *CoverageComparison) withinTolerance() bool {
+	return c.Delta >= -c.Tolerance
+}
+
+// coverageBaseline is the measured coverage of a base branch commit
+type coverageBaseline struct {
+	branch   string
+	sha      string
+	coverage float64
+	// err is set when the base tests fail, since their coverage is then meaningless
+	err error
+}
+
+// validateCoveragePolicy rejects unknown policies; an empty policy means absolute
+func validateCoveragePolicy(policy CoveragePolicy) error {
+	switch policy {
+	case "", CoveragePolicyAbsolute, CoveragePolicyDelta, CoveragePolicyEither:
+		return nil
+	default:
+		return fmt.Errorf("unsupported coverage policy %q (expected absolute, delta or either)", policy)
+	}
+}
+
+func (m *DaggerAutofix) coveragePolicy() CoveragePolicy {
+	if m.CoveragePolicy == "" {
+		return CoveragePolicyAbsolute
+	}
+	return m.CoveragePolicy
+}
+
+// applyCoveragePolicy decides whether a validated fix is valid under the coverage policy.
+// When the base coverage cannot be measured the absolute threshold is used instead. Without
+// a coverage measurement the fix is valid when its tests pass, unless coverage is required.
+func (m *DaggerAutofix) applyCoveragePolicy(ctx context.Context, validation *FixValidationResult) {
+	result := validation.TestResult
+	policy := m.coveragePolicy()
+	validation.CoveragePolicy = policy
+
+	if result.CoverageUnknown {
+		validation.Valid = result.testsPassed() && !m.RequireCoverage
+		if validation.Valid {
+			validation.CoverageNote = coverageNotMeasuredNote
+		}
+		return
+	}
+
+	absolute := result.Success && result.Coverage >= float64(m.settings(ctx).MinCoverage)
+	validation.Valid = absolute
+	if policy == CoveragePolicyAbsolute || !result.testsPassed() {
+		return
+	}
+
+	baseline, err := m.measureBaseCoverage(ctx)
+	if err == nil {
+		err = baseline.err
+	}
+	if err != nil {
+		m.logger.WithError(err).Warn("Base coverage unavailable, using the absolute coverage threshold")
+		validation.Errors = append(validation.Errors, err.Error())
+		return
+	}
+
+	comparison := &CoverageComparison{
+		BaseBranch:   baseline.branch,
+		BaseSHA:      baseline.sha,
+		BaseCoverage: baseline.coverage,
+		FixCoverage:  result.Coverage,
+		Delta:        math.Round((result.Coverage-baseline.coverage)*100) / 100,
+		Tolerance:    m.CoverageTolerance,
+	}
+	validation.Coverage = comparison
+
+	if policy == CoveragePolicyDelta {
+		validation.Valid = comparison.withinTolerance()
+	} else {
+		validation.Valid = absolute || comparison.withinTolerance()
+	}
+}
+
+// measureBaseCoverage runs the tests on the base branch, or on the unchanged local source,
+// once per base commit. Concurrent validations wait for the first measurement.
+func (m *DaggerAutofix) measureBaseCoverage(ctx context.Context) (*coverageBaseline, error) {
+	// Without GitHub, e.g. for FixLocal, the local source is the only base
+	branch, sha := localSourceRef, localSourceRef
+	var err error
+	if m.githubClient != nil {
+		if branch, sha, err = m.githubClient.GetBaseBranchHead(ctx); err != nil {
+			return nil, fmt.Errorf("failed to resolve base commit: %w", err)
+		}
+	}
+
+	m.baseCoverageMu.Lock()
+	defer m.baseCoverageMu.Unlock()
+	if baseline, ok := m.baseCoverage[sha]; ok {
+		return baseline, nil
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"branch": branch,
+		"sha":    sha,
+	}).Info("Measuring base branch coverage")
+
+	var result *TestResult
+	if m.Source != nil {
+		result, err = m.testEngine.RunTestsWithChanges(ctx, m.Source, nil)
+	} else {
+		result, err = m.testEngine.RunTests(ctx, m.RepoOwner, m.RepoName, branch)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure base coverage: %w", err)
+	}
+
+	baseline := &coverageBaseline{branch: branch, sha: sha, coverage: result.Coverage}
+	if !result.testsPassed() {
+		baseline.err = fmt.Errorf("tests fail on %s, so its coverage cannot be compared", branch)
+	}
+
+	if m.baseCoverage == nil {
+		m.baseCoverage = make(map[string]*coverageBaseline)
+	}
+	m.baseCoverage[sha] = baseline
+	return baseline, nil
+}
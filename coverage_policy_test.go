@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// coveragePolicyAutofix builds a module whose base branch has baseCoverage and whose fixes pass with fixCoverage
+func coveragePolicyAutofix(policy string, baseCoverage, fixCoverage float64, branches *[]string) *DaggerAutofix {
+	var mu sync.Mutex
+	te := &mockTestEngine{
+		runTestsFunc: func(ctx context.Context, owner, repo, branch string) (*TestResult, error) {
+			mu.Lock()
+			*branches = append(*branches, branch)
+			mu.Unlock()
+			coverage := fixCoverage
+			if branch == "main" {
+				coverage = baseCoverage
+			}
+			// The engine's minimum coverage fails Success, but the tests themselves pass
+			return &TestResult{Success: coverage >= 85, TestsPassed: true, PassedTests: 10, Coverage: coverage}, nil
+		},
+	}
+
+	m := &DaggerAutofix{
+		githubClient:      &mockGitHub{},
+		testEngine:        te,
+		logger:            quietLogger(),
+		MinCoverage:       85,
+		CoverageTolerance: DefaultCoverageTolerance,
+	}
+	return m.WithCoveragePolicy(policy)
+}
+
+// TestValidateFixCoveragePolicy tests fix validity under each coverage policy
+func TestValidateFixCoveragePolicy(t *testing.T) {
+	ctx := context.Background()
+	fix := &ProposedFix{ID: "f1"}
+
+	t.Run("LegacyRepoAbsoluteFails", func(t *testing.T) {
+		var branches []string
+		m := coveragePolicyAutofix("absolute", 40, 40, &branches)
+
+		res, err := m.ValidateFix(ctx, fix)
+		require.NoError(t, err)
+		assert.False(t, res.Valid)
+		assert.Nil(t, res.Coverage, "the base branch is not measured under the absolute policy")
+		assert.Len(t, branches, 1)
+	})
+
+	t.Run("LegacyRepoDeltaPasses", func(t *testing.T) {
+		var branches []string
+		m := coveragePolicyAutofix("Delta", 40, 39.6, &branches)
+
+		res, err := m.ValidateFix(ctx, fix)
+		require.NoError(t, err)
+		assert.True(t, res.Valid)
+		assert.Equal(t, CoveragePolicyDelta, res.CoveragePolicy)
+		require.NotNil(t, res.Coverage)
+		assert.Equal(t, CoverageComparison{
+			BaseBranch:   "main",
+			BaseSHA:      "base123",
+			BaseCoverage: 40,
+			FixCoverage:  39.6,
+			Delta:        -0.4,
+			Tolerance:    0.5,
+		}, *res.Coverage)
+	})
+
+	t.Run("DeltaRejectsCoverageDrop", func(t *testing.T) {
+		var branches []string
+		m := coveragePolicyAutofix("delta", 90, 88, &branches)
+
+		res, err := m.ValidateFix(ctx, fix)
+		require.NoError(t, err)
+		assert.False(t, res.Valid, "dropping 2 points fails delta even above MinCoverage")
+		assert.Equal(t, -2.0, res.Coverage.Delta)
+	})
+
+	t.Run("EitherAcceptsAbsolute", func(t *testing.T) {
+		var branches []string
+		m := coveragePolicyAutofix("either", 90, 88, &branches)
+
+		res, err := m.ValidateFix(ctx, fix)
+		require.NoError(t, err)
+		assert.True(t, res.Valid)
+	})
+
+	t.Run("EitherRejectsBoth", func(t *testing.T) {
+		var branches []string
+		m := coveragePolicyAutofix("either", 40, 38, &branches)
+
+		res, err := m.ValidateFix(ctx, fix)
+		require.NoError(t, err)
+		assert.False(t, res.Valid)
+	})
+
+	t.Run("LocalSourceMeasuresUnchangedSource", func(t *testing.T) {
+		var changeSets [][]CodeChange
+		m := coveragePolicyAutofix("delta", 0, 0, new([]string))
+		m.Source = &dagger.Directory{}
+		m.testEngine = &mockTestEngine{
+			runTestsWithChangesFunc: func(ctx context.Context, source *dagger.Directory, changes []CodeChange) (*TestResult, error) {
+				changeSets = append(changeSets, changes)
+				coverage := 41.0
+				if changes == nil {
+					coverage = 40
+				}
+				return &TestResult{TestsPassed: true, PassedTests: 10, Coverage: coverage}, nil
+			},
+		}
+
+		res, err := m.ValidateFix(ctx, &ProposedFix{ID: "f1", Changes: []CodeChange{{FilePath: "main.go"}}})
+		require.NoError(t, err)
+		assert.True(t, res.Valid)
+		assert.Len(t, changeSets, 2)
+		assert.Equal(t, 1.0, res.Coverage.Delta)
+	})
+
+	t.Run("FailingTestsAreNeverValid", func(t *testing.T) {
+		m := &DaggerAutofix{
+			githubClient: &mockGitHub{},
+			testEngine: &mockTestEngine{
+				runTestsFunc: func(ctx context.Context, owner, repo, branch string) (*TestResult, error) {
+					return &TestResult{FailedTests: 1, Coverage: 40}, nil
+				},
+			},
+			logger: quietLogger(),
+		}
+		m.WithCoveragePolicy("delta")
+
+		res, err := m.ValidateFix(ctx, fix)
+		require.NoError(t, err)
+		assert.False(t, res.Valid)
+		assert.Nil(t, res.Coverage)
+	})
+}
+
+// TestBaseCoverageCachedPerCommit verifies the base branch is measured once per commit
+func TestBaseCoverageCachedPerCommit(t *testing.T) {
+	ctx := context.Background()
+	var branches []string
+	m := coveragePolicyAutofix("delta", 40, 40, &branches)
+
+	sha := "base123"
+	m.githubClient = &mockGitHub{
+		getBaseBranchHeadFunc: func(ctx context.Context) (string, string, error) {
+			return "main", sha, nil
+		},
+	}
+
+	for _, id := range []string{"f1", "f2", "f3"} {
+		res, err := m.ValidateFix(ctx, &ProposedFix{ID: id})
+		require.NoError(t, err)
+		assert.True(t, res.Valid)
+	}
+	assert.Equal(t, 1, countBranch(branches, "main"), "candidate fixes share the base measurement")
+
+	sha = "base456"
+	_, err := m.ValidateFix(ctx, &ProposedFix{ID: "f4"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, countBranch(branches, "main"), "a new base commit is measured again")
+}
+
+func countBranch(branches []string, name string) int {
+	count := 0
+	for _, branch := range branches {
+		if branch == name {
+			count++
+		}
+	}
+	return count
+}
+
+// TestBaseCoverageUnavailableFallsBackToAbsolute tests validation when the base cannot be measured
+func TestBaseCoverageUnavailableFallsBackToAbsolute(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("LookupFails", func(t *testing.T) {
+		var branches []string
+		m := coveragePolicyAutofix("either", 40, 90, &branches)
+		m.githubClient = &mockGitHub{
+			getBaseBranchHeadFunc: func(ctx context.Context) (string, string, error) {
+				return "", "", errors.New("not found")
+			},
+		}
+
+		res, err := m.ValidateFix(ctx, &ProposedFix{ID: "f1"})
+		require.NoError(t, err)
+		assert.True(t, res.Valid, "the fix still meets MinCoverage")
+		assert.Nil(t, res.Coverage)
+		require.Len(t, res.Errors, 1)
+		assert.Contains(t, res.Errors[0], "failed to resolve base commit")
+	})
+
+	t.Run("BaseTestsFail", func(t *testing.T) {
+		m := coveragePolicyAutofix("delta", 0, 40, new([]string))
+		m.testEngine = &mockTestEngine{
+			runTestsFunc: func(ctx context.Context, owner, repo, branch string) (*TestResult, error) {
+				if branch == "main" {
+					return &TestResult{FailedTests: 3}, nil
+				}
+				return &TestResult{TestsPassed: true, PassedTests: 10, Coverage: 40}, nil
+			},
+		}
+
+		res, err := m.ValidateFix(ctx, &ProposedFix{ID: "f1"})
+		require.NoError(t, err)
+		assert.False(t, res.Valid)
+		assert.Contains(t, res.Errors[0], "tests fail on main")
+	})
+}
+
+// TestValidateFixUnknownCoverage tests that fixes of projects without coverage tooling are
+// judged by their tests, unless coverage is required
+func TestValidateFixUnknownCoverage(t *testing.T) {
+	ctx := context.Background()
+	unmeasured := func(testsPassed bool) *DaggerAutofix {
+		var branches []string
+		m := coveragePolicyAutofix("either", 0, 0, &branches)
+		m.testEngine = &mockTestEngine{
+			runTestsFunc: func(ctx context.Context, owner, repo, branch string) (*TestResult, error) {
+				branches = append(branches, branch)
+				return &TestResult{Success: testsPassed, TestsPassed: testsPassed, PassedTests: 10, CoverageUnknown: true}, nil
+			},
+		}
+		t.Cleanup(func() { assert.Equal(t, 1, len(branches), "the base branch is not measured") })
+		return m
+	}
+
+	res, err := unmeasured(true).ValidateFix(ctx, &ProposedFix{ID: "f1"})
+	require.NoError(t, err)
+	assert.True(t, res.Valid)
+	assert.Nil(t, res.Coverage)
+	assert.Equal(t, coverageNotMeasuredNote, res.CoverageNote)
+	assert.Empty(t, res.Errors)
+
+	body := NewPullRequestEngine(nil, quietLogger()).generatePRBody(&FailureAnalysisResult{ID: "a1"}, res)
+	assert.Contains(t, body, "**Test Coverage**: not measured (Required: not available)\n")
+	assert.Contains(t, body, "**Note**: Coverage not measured: ")
+	assert.NotContains(t, body, "0.0%")
+
+	res, err = unmeasured(false).ValidateFix(ctx, &ProposedFix{ID: "f1"})
+	require.NoError(t, err)
+	assert.False(t, res.Valid, "failing tests are not excused")
+	assert.Empty(t, res.CoverageNote)
+
+	m := unmeasured(true).WithRequireCoverage(true)
+	res, err = m.ValidateFix(ctx, &ProposedFix{ID: "f1"})
+	require.NoError(t, err)
+	assert.False(t, res.Valid)
+	assert.Empty(t, res.CoverageNote)
+
+	err = m.noPassingFixError(context.Background(), []*FixValidationResult{res})
+	var coverageErr *CoverageError
+	require.ErrorAs(t, err, &coverageErr)
+	assert.True(t, coverageErr.NotMeasured)
+	assert.ErrorContains(t, err, "coverage was not measured but is required (minimum 85.00%)")
+}
+
+// TestPRBodyShowsCoverageDelta verifies the base coverage and delta appear in the validation section
+func TestPRBodyShowsCoverageDelta(t *testing.T) {
+	engine := NewPullRequestEngine(nil, quietLogger())
+
+	body := engine.generatePRBody(&FailureAnalysisResult{ID: "a1"}, &FixValidationResult{
+		Fix:            &ProposedFix{ID: "f1"},
+		TestResult:     &TestResult{TestsPassed: true, PassedTests: 10, Coverage: 39.6},
+		Valid:          true,
+		CoveragePolicy: CoveragePolicyDelta,
+		Coverage:       &CoverageComparison{BaseBranch: "main", BaseCoverage: 40, FixCoverage: 39.6, Delta: -0.4, Tolerance: 0.5},
+	})
+
+	assert.Contains(t, body, "**Tests Passed**: ✅")
+	assert.Contains(t, body, "**Base Coverage**: 40.0% on `main` (-0.4% with this fix, tolerance 0.5%, policy: delta)\n")
+}
+
+// TestValidateCoveragePolicy tests configuration validation of the coverage policy
+func TestValidateCoveragePolicy(t *testing.T) {
+	assert.NoError(t, validateCoveragePolicy(""))
+	assert.NoError(t, validateCoveragePolicy(CoveragePolicyEither))
+	assert.ErrorContains(t, validateCoveragePolicy("relative"), "unsupported coverage policy")
+
+	m := New().WithCoveragePolicy("relative")
+	assert.Equal(t, CoveragePolicy("relative"), m.CoveragePolicy)
+	assert.Equal(t, DefaultCoverageTolerance, New().CoverageTolerance)
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dagger.io/dagger"
+	"github.com/google/go-github/v45/github"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxCoverageReportBytes is the largest coverage report kept on a TestResult. Larger
+	// reports are still summarized but not kept, as a truncated report is of no use.
+	maxCoverageReportBytes = 1 << 20
+	// maxCoverageReportsBytes caps all coverage reports kept for one test run
+	maxCoverageReportsBytes = 5 << 20
+	// maxCoverageTableRows is how many of the lowest covered files a fix PR lists
+	maxCoverageTableRows = 10
+)
+
+// FileCoverage is the coverage of one file, or of one package in a package summary
+type FileCoverage struct {
+	File    string `json:"file"`
+	Covered int    `json:"covered"` // covered statements or lines
+	Total   int    `json:"total"`
+}
+
+// Percent returns the covered share of the file in percent, 100 for files without statements
+func (f FileCoverage) Percent() float64 {
+	if f.Total == 0 {
+		return 100
+	}
+	return float64(f.Covered) / float64(f.Total) * 100
+}
+
+// collectCoverageReports reads the coverage reports the coverage stage wrote, first running
+// the framework's report command, e.g. to render an HTML report. Missing reports are skipped.
+func (e *TestEngine) collectCoverageReports(ctx context.Context, container ContainerInterface, framework *TestFramework) (map[string]string, []FileCoverage) {
+	if len(framework.CoverageArtifacts) == 0 {
+		return nil, nil
+	}
+	if framework.CoverageReportCommand != "" {
+		executed, output, err := e.runCommand(ctx, container, stageCoverage, framework.CoverageReportCommand)
+		if err != nil {
+			e.logger.WithError(err).WithField("output", truncateString(output, 500)).Debug("Failed to render coverage report")
+		} else {
+			container = executed
+		}
+	}
+
+	reports := make(map[string]string)
+	var files []FileCoverage
+	kept := 0
+	for _, name := range framework.CoverageArtifacts {
+		contents, err := container.File(name).Contents(ctx)
+		if err != nil {
+			e.logger.WithError(err).WithField("path", name).Debug("Coverage report not found")
+			continue
+		}
+		if files == nil {
+			files = parseFileCoverage(contents)
+		}
+
+		log := e.logger.WithFields(logrus.Fields{"path": name, "bytes": len(contents)})
+		switch {
+		case len(contents) > maxCoverageReportBytes:
+			log.Warn("Coverage report exceeds the size limit, not keeping it")
+		case kept+len(contents) > maxCoverageReportsBytes:
+			log.Warn("Coverage reports exceed the total size limit, not keeping the rest")
+		default:
+			reports[name] = contents
+			kept += len(contents)
+		}
+	}
+	if len(reports) == 0 {
+		return nil, files
+	}
+	return reports, files
+}
+
+// coverageReportDirectory returns the coverage reports as a directory for exporting them from
+// a Dagger pipeline, or nil without reports or a Dagger client
+func coverageReportDirectory(reports map[string]string) *dagger.Directory {
+	if dag == nil || len(reports) == 0 {
+		return nil
+	}
+	dir := dag.Directory()
+	for _, name := range sortedKeys(reports) {
+		dir = dir.WithNewFile(name, reports[name])
+	}
+	return dir
+}
+
+// coverageHTMLReport returns the name and contents of the HTML coverage report among reports
+func coverageHTMLReport(reports map[string]string) (string, string, bool) {
+	for _, name := range sortedKeys(reports) {
+		if path.Ext(name) == ".html" {
+			return name, reports[name], true
+		}
+	}
+	return "", "", false
+}
+
+// parseFileCoverage reads the per-file coverage of a Go cover profile, an lcov tracefile or a
+// Cobertura XML report. It returns nil for other reports.
+func parseFileCoverage(report string) []FileCoverage {
+	trimmed := strings.TrimSpace(report)
+	switch {
+	case strings.HasPrefix(trimmed, "mode:"):
+		return parseGoCoverProfile(trimmed)
+	case strings.HasPrefix(trimmed, "TN:") || strings.HasPrefix(trimmed, "SF:"):
+		return parseLcov(trimmed)
+	case strings.Contains(trimmed, "<coverage"):
+		return parseCoberturaFiles(trimmed)
+	default:
+		return nil
+	}
+}
+
+// parseGoCoverProfile reads a cover profile, whose lines are
+// "github.com/org/repo/pkg/file.go:10.13,12.2 <statements> <count>". Blocks listed by several
+// test binaries count once.
+func parseGoCoverProfile(profile string) []FileCoverage {
+	type block struct {
+		statements int
+		covered    bool
+	}
+	blocks := make(map[string]block)
+	var order []string
+	for _, line := range strings.Split(profile, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !strings.Contains(fields[0], ":") {
+			continue
+		}
+		statements, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		existing, seen := blocks[fields[0]]
+		if !seen {
+			order = append(order, fields[0])
+		}
+		blocks[fields[0]] = block{statements: statements, covered: existing.covered || count > 0}
+	}
+
+	byFile := make(map[string]int)
+	var files []FileCoverage
+	for _, location := range order {
+		file := location[:strings.LastIndex(location, ":")]
+		i, ok := byFile[file]
+		if !ok {
+			i = len(files)
+			byFile[file] = i
+			files = append(files, FileCoverage{File: file})
+		}
+		b := blocks[location]
+		files[i].Total += b.statements
+		if b.covered {
+			files[i].Covered += b.statements
+		}
+	}
+	return files
+}
+
+// parseLcov reads the SF (source file), LF (lines found) and LH (lines hit) records of an
+// lcov tracefile, as written by Jest and c8
+func parseLcov(tracefile string) []FileCoverage {
+	var files []FileCoverage
+	var current *FileCoverage
+	for _, line := range strings.Split(tracefile, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), ":")
+		switch key {
+		case "SF":
+			files = append(files, FileCoverage{File: value})
+			current = &files[len(files)-1]
+		case "LF", "LH":
+			n, err := strconv.Atoi(value)
+			if current == nil || err != nil {
+				continue
+			}
+			if key == "LF" {
+				current.Total = n
+			} else {
+				current.Covered = n
+			}
+		case "end_of_record":
+			current = nil
+		}
+	}
+	return files
+}
+
+// coberturaReport is the part of a Cobertura XML report, as written by coverage.py, that
+// lists the lines of each file
+type coberturaReport struct {
+	Classes []struct {
+		Filename string `xml:"filename,attr"`
+		Lines    []struct {
+			Hits int `xml:"hits,attr"`
+		} `xml:"lines>line"`
+	} `xml:"packages>package>classes>class"`
+}
+
+// parseCoberturaFiles reads the line coverage of each file in a Cobertura XML report
+func parseCoberturaFiles(report string) []FileCoverage {
+	var parsed coberturaReport
+	if err := xml.Unmarshal([]byte(report), &parsed); err != nil {
+		return nil
+	}
+	byFile := make(map[string]int)
+	var files []FileCoverage
+	for _, class := range parsed.Classes {
+		i, ok := byFile[class.Filename]
+		if !ok {
+			i = len(files)
+			byFile[class.Filename] = i
+			files = append(files, FileCoverage{File: class.Filename})
+		}
+		for _, line := range class.Lines {
+			files[i].Total++
+			if line.Hits > 0 {
+				files[i].Covered++
+			}
+		}
+	}
+	return files
+}
+
+// changedFileCoverage returns the coverage of the changed files found in a report, under
+// their repository paths. Reports name files by module path or absolute path, so they are
+// matched by suffix.
+func changedFileCoverage(files []FileCoverage, changes []CodeChange) []FileCoverage {
+	var changed []FileCoverage
+	for _, change := range changes {
+		target := change.targetPath()
+		if change.Operation == ChangeOperationDelete || target == "" {
+			continue
+		}
+		for _, file := range files {
+			if file.File == target || strings.HasSuffix(file.File, "/"+target) {
+				file.File = target
+				changed = append(changed, file)
+				break
+			}
+		}
+	}
+	return changed
+}
+
+// packageCoverage sums the coverage of files by the directory they are in
+func packageCoverage(files []FileCoverage) []FileCoverage {
+	byPackage := make(map[string]int)
+	var packages []FileCoverage
+	for _, file := range files {
+		dir := path.Dir(file.File)
+		i, ok := byPackage[dir]
+		if !ok {
+			i = len(packages)
+			byPackage[dir] = i
+			packages = append(packages, FileCoverage{File: dir})
+		}
+		packages[i].Covered += file.Covered
+		packages[i].Total += file.Total
+	}
+	return packages
+}
+
+// lowestCovered returns up to limit entries, the lowest covered first
+func lowestCovered(files []FileCoverage, limit int) []FileCoverage {
+	sorted := append([]FileCoverage(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Percent() < sorted[j].Percent()
+	})
+	if len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+	return sorted
+}
+
+// writeCoverageTable adds the coverage of the changed files to a fix PR body, the lowest
+// covered first. When the report has none of them it lists the lowest covered packages.
+func writeCoverageTable(body *strings.Builder, files []FileCoverage, changes []CodeChange) {
+	if len(files) == 0 {
+		return
+	}
+	rows, column := changedFileCoverage(files, changes), "File"
+	if len(rows) == 0 {
+		rows, column = packageCoverage(files), "Package"
+	}
+
+	if column == "File" {
+		body.WriteString("**Coverage of Changed Files** (lowest first):\n\n")
+	} else {
+		body.WriteString("**Lowest Covered Packages** (no changed file is in the coverage report):\n\n")
+	}
+	body.WriteString(fmt.Sprintf("| %s | Coverage | Covered |\n", column))
+	body.WriteString("| --- | --- | --- |\n")
+	for _, row := range lowestCovered(rows, maxCoverageTableRows) {
+		body.WriteString(fmt.Sprintf("| `%s` | %.1f%% | %d/%d |\n", row.File, row.Percent(), row.Covered, row.Total))
+	}
+	if len(rows) > maxCoverageTableRows {
+		body.WriteString(fmt.Sprintf("\n%d more not shown.\n", len(rows)-maxCoverageTableRows))
+	}
+	body.WriteString("\n")
+}
+
+// CreateGist creates a secret gist of the given files and returns its URL
+func (g *GitHubIntegration) CreateGist(ctx context.Context, description string, files map[string]string) (string, error) {
+	gist := &github.Gist{
+		Description: github.String(description),
+		Public:      github.Bool(false),
+		Files:       make(map[github.GistFilename]github.GistFile, len(files)),
+	}
+	for name, contents := range files {
+		gist.Files[github.GistFilename(name)] = github.GistFile{Content: github.String(contents)}
+	}
+
+	created, err := callGitHub(ctx, g, func() (*github.Gist, *github.Response, error) {
+		return g.client.Gists.Create(ctx, gist)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create gist: %w", err)
+	}
+	return created.GetHTMLURL(), nil
+}
+
+// uploadCoverageReport uploads the HTML coverage report of a fix as a secret gist when
+// configured, and returns the PR body section linking it; "" when there is nothing to link
+func (p *PullRequestEngine) uploadCoverageReport(ctx context.Context, fix *FixValidationResult) string {
+	if !p.defaults.CoverageGist || fix.TestResult == nil {
+		return ""
+	}
+	name, contents, ok := coverageHTMLReport(fix.TestResult.Reports)
+	if !ok {
+		return ""
+	}
+
+	description := fmt.Sprintf("Coverage report for fix %s", fix.Fix.ID)
+	url, err := p.githubClient.CreateGist(ctx, description, map[string]string{path.Base(name): contents})
+	if err != nil {
+		p.logger.WithError(err).Warn("Failed to upload the coverage report")
+		return ""
+	}
+	return fmt.Sprintf("## 📈 Coverage Report\n\nThe full HTML coverage report of this fix (`%s`) is in [a gist](%s).\n\n", name, url)
+}
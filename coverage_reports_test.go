@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sampleCoverProfile is a cover profile of two packages; the block of format.go at line 3
+// is listed twice, as with several test binaries
+const sampleCoverProfile = `mode: set
+github.com/acme/widgets/calc/sum.go:3.24,5.2 2 1
+github.com/acme/widgets/calc/sum.go:7.30,9.16 2 0
+github.com/acme/widgets/calc/sum.go:9.16,11.3 1 0
+github.com/acme/widgets/text/format.go:3.30,6.2 3 0
+github.com/acme/widgets/text/format.go:3.30,6.2 3 1
+github.com/acme/widgets/text/format.go:8.28,10.2 1 1
+github.com/acme/widgets/text/pad.go:3.40,9.2 4 0
+`
+
+const sampleLcov = `TN:
+SF:/src/app/src/sum.js
+FN:1,sum
+LF:10
+LH:4
+end_of_record
+TN:
+SF:/src/app/src/format.js
+LF:20
+LH:20
+end_of_record
+`
+
+const sampleCobertura = `<?xml version="1.0" ?>
+<coverage version="7.4.0" line-rate="0.6">
+	<packages>
+		<package name="widgets">
+			<classes>
+				<class name="sum.py" filename="widgets/sum.py" line-rate="0.5">
+					<lines>
+						<line number="1" hits="1"/>
+						<line number="2" hits="0"/>
+					</lines>
+				</class>
+				<class name="format.py" filename="widgets/format.py" line-rate="0.67">
+					<lines>
+						<line number="1" hits="3"/>
+						<line number="2" hits="1"/>
+						<line number="5" hits="0"/>
+					</lines>
+				</class>
+			</classes>
+		</package>
+	</packages>
+</coverage>`
+
+// TestParseFileCoverage tests reading per-file coverage from the reports of each framework
+func TestParseFileCoverage(t *testing.T) {
+	tests := []struct {
+		name   string
+		report string
+		want   []FileCoverage
+	}{
+		{
+			name:   "go cover profile",
+			report: sampleCoverProfile,
+			want: []FileCoverage{
+				{File: "github.com/acme/widgets/calc/sum.go", Covered: 2, Total: 5},
+				{File: "github.com/acme/widgets/text/format.go", Covered: 4, Total: 4},
+				{File: "github.com/acme/widgets/text/pad.go", Covered: 0, Total: 4},
+			},
+		},
+		{
+			name:   "lcov",
+			report: sampleLcov,
+			want: []FileCoverage{
+				{File: "/src/app/src/sum.js", Covered: 4, Total: 10},
+				{File: "/src/app/src/format.js", Covered: 20, Total: 20},
+			},
+		},
+		{
+			name:   "cobertura",
+			report: sampleCobertura,
+			want: []FileCoverage{
+				{File: "widgets/sum.py", Covered: 1, Total: 2},
+				{File: "widgets/format.py", Covered: 2, Total: 3},
+			},
+		},
+		{name: "html", report: "<html><body>coverage</body></html>"},
+		{name: "invalid cobertura", report: "<coverage><packages>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseFileCoverage(tt.report))
+		})
+	}
+
+	assert.Equal(t, 40.0, FileCoverage{Covered: 2, Total: 5}.Percent())
+	assert.Equal(t, 100.0, FileCoverage{}.Percent())
+}
+
+// TestCollectCoverageReports tests that the coverage reports of a Go test run are rendered,
+// collected from the test container and summarized on the test result
+func TestCollectCoverageReports(t *testing.T) {
+	provider := NewMockContainerProvider()
+	mock := provider.MockContainer
+	mock.FileSystem = map[string]string{"go.mod": "module github.com/acme/widgets\n\ngo 1.22"}
+	mock.SetCommandOutput("go test -json ./...", "PASS: 5 passed, 0 failed\nok\ttest\t0.005s", "", 0, nil)
+	mock.SetCommandOutput("go build ./...", "", "", 0, nil)
+	mock.SetCommandOutput("golangci-lint run", "", "", 0, nil)
+	mock.CommandOutputs["go test -coverprofile=coverage.out ./..."] = MockCommandResult{
+		Stdout: "ok\tgithub.com/acme/widgets/calc\tcoverage: 61.5% of statements",
+		Writes: map[string]string{"coverage.out": sampleCoverProfile},
+	}
+	mock.CommandOutputs["go tool cover -html=coverage.out -o coverage.html"] = MockCommandResult{
+		Writes: map[string]string{"coverage.html": "<html>coverage</html>"},
+	}
+
+	engine := NewTestEngine(0, quietLogger())
+	engine.SetContainerProvider(provider)
+	result, err := engine.RunTests(context.Background(), "acme", "widgets", "main")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"coverage.out":  sampleCoverProfile,
+		"coverage.html": "<html>coverage</html>",
+	}, result.Reports)
+	assert.Nil(t, result.ReportDir, "report directories need a Dagger client")
+	require.Len(t, result.FileCoverage, 3)
+	assert.Equal(t, FileCoverage{File: "github.com/acme/widgets/text/pad.go", Covered: 0, Total: 4}, result.FileCoverage[2])
+
+	var rendered bool
+	for _, args := range mock.ExecHistory {
+		rendered = rendered || strings.Join(args, " ") == "go tool cover -html=coverage.out -o coverage.html"
+	}
+	assert.True(t, rendered, "the HTML report is rendered after the coverage command")
+}
+
+// TestCollectCoverageReportsLimits tests that oversized reports are summarized but not kept
+func TestCollectCoverageReportsLimits(t *testing.T) {
+	mock := NewMockDaggerContainer()
+	large := sampleCoverProfile + strings.Repeat("\n", maxCoverageReportBytes)
+	mock.FileSystem = map[string]string{"coverage.out": large, "coverage.html": "<html></html>"}
+	framework := &TestFramework{CoverageArtifacts: []string{"coverage.out", "coverage.html", "missing.xml"}}
+
+	engine := NewTestEngine(0, quietLogger())
+	reports, files := engine.collectCoverageReports(context.Background(), &MockContainerWrapper{mock}, framework)
+	assert.Equal(t, map[string]string{"coverage.html": "<html></html>"}, reports)
+	assert.Len(t, files, 3)
+
+	mock.FileSystem = map[string]string{}
+	reports, files = engine.collectCoverageReports(context.Background(), &MockContainerWrapper{mock}, framework)
+	assert.Nil(t, reports)
+	assert.Nil(t, files)
+
+	reports, files = engine.collectCoverageReports(context.Background(), &MockContainerWrapper{mock}, &TestFramework{})
+	assert.Nil(t, reports)
+	assert.Nil(t, files)
+}
+
+// TestWriteCoverageTable tests the coverage table of fix PR bodies
+func TestWriteCoverageTable(t *testing.T) {
+	files := parseFileCoverage(sampleCoverProfile)
+	changes := []CodeChange{
+		{FilePath: "text/format.go", Operation: "modify"},
+		{FilePath: "calc/sum.go", Operation: "modify"},
+		{FilePath: "calc/old.go", Operation: "delete"},
+		{FilePath: "README.md", Operation: "modify"},
+	}
+
+	var body strings.Builder
+	writeCoverageTable(&body, files, changes)
+	assert.Equal(t, "**Coverage of Changed Files** (lowest first):\n\n"+
+		"| File | Coverage | Covered |\n"+
+		"| --- | --- | --- |\n"+
+		"| `calc/sum.go` | 40.0% | 2/5 |\n"+
+		"| `text/format.go` | 100.0% | 4/4 |\n\n", body.String())
+
+	body.Reset()
+	writeCoverageTable(&body, files, []CodeChange{{FilePath: "README.md", Operation: "modify"}})
+	assert.Equal(t, "**Lowest Covered Packages** (no changed file is in the coverage report):\n\n"+
+		"| Package | Coverage | Covered |\n"+
+		"| --- | --- | --- |\n"+
+		"| `github.com/acme/widgets/calc` | 40.0% | 2/5 |\n"+
+		"| `github.com/acme/widgets/text` | 50.0% | 4/8 |\n\n", body.String())
+
+	body.Reset()
+	writeCoverageTable(&body, nil, changes)
+	assert.Empty(t, body.String())
+
+	var many []FileCoverage
+	var manyChanges []CodeChange
+	for i := 0; i < maxCoverageTableRows+3; i++ {
+		many = append(many, FileCoverage{File: fmt.Sprintf("pkg/f%02d.go", i), Covered: i, Total: 20})
+		manyChanges = append(manyChanges, CodeChange{FilePath: fmt.Sprintf("pkg/f%02d.go", i), Operation: "modify"})
+	}
+	body.Reset()
+	writeCoverageTable(&body, many, manyChanges)
+	assert.Equal(t, maxCoverageTableRows, strings.Count(body.String(), "| `pkg/"))
+	assert.Contains(t, body.String(), "| `pkg/f00.go` | 0.0% | 0/20 |")
+	assert.NotContains(t, body.String(), "f12.go")
+	assert.Contains(t, body.String(), "\n3 more not shown.\n")
+
+	engine := NewPullRequestEngine(nil, quietLogger())
+	prBody := engine.generatePRBody(nil, &FixValidationResult{
+		Fix:        &ProposedFix{ID: "fix-1", Changes: changes[:2]},
+		TestResult: &TestResult{Success: true, Coverage: 61.5, FileCoverage: files},
+	})
+	assert.Contains(t, prBody, "**Tests Run**: 0 passed, 0 failed, 0 skipped\n\n**Coverage of Changed Files**")
+}
+
+// TestCoverageReportGist tests linking the HTML coverage report of a fix PR through a gist
+func TestCoverageReportGist(t *testing.T) {
+	ctx := context.Background()
+	analysis := &FailureAnalysisResult{
+		ID:             "analysis-42-1700000000",
+		Classification: FailureClassification{Type: BuildFailure},
+		Context:        FailureContext{WorkflowRun: &WorkflowRun{ID: 42}},
+	}
+	fix := highConfidenceFix()
+	fix.TestResult.Reports = map[string]string{
+		"coverage.out":  sampleCoverProfile,
+		"coverage.html": "<html>coverage</html>",
+	}
+
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("enabled=%t", enabled), func(t *testing.T) {
+			gh, mux, got := prDefaultsMux(t, false, "")
+			var gists []github.Gist
+			mux.HandleFunc("/gists", func(w http.ResponseWriter, r *http.Request) {
+				var gist github.Gist
+				assert.NoError(t, decodeJSON(r, &gist))
+				gists = append(gists, gist)
+				fmt.Fprint(w, `{"id":"g1","html_url":"https://gist.github.com/octocat/g1"}`)
+			})
+
+			engine := NewPullRequestEngine(gh, quietLogger())
+			engine.SetPRDefaults(PRDefaults{CoverageGist: enabled})
+			_, err := engine.CreateFixPR(ctx, analysis, fix)
+			require.NoError(t, err)
+
+			if !enabled {
+				assert.Empty(t, gists)
+				assert.NotContains(t, got.body, "Coverage Report")
+				return
+			}
+			require.Len(t, gists, 1)
+			assert.False(t, gists[0].GetPublic())
+			assert.Equal(t, "Coverage report for fix fix-1", gists[0].GetDescription())
+			file := gists[0].Files["coverage.html"]
+			assert.Equal(t, "<html>coverage</html>", file.GetContent())
+			assert.Contains(t, got.body, "## 📈 Coverage Report\n\nThe full HTML coverage report of this fix (`coverage.html`) is in [a gist](https://gist.github.com/octocat/g1).\n\n---\n")
+		})
+	}
+
+	// Failed uploads leave the PR without the link
+	gh, mux, got := prDefaultsMux(t, false, "")
+	mux.HandleFunc("/gists", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message":"Not Found"}`)
+	})
+	engine := NewPullRequestEngine(gh, quietLogger())
+	engine.SetPRDefaults(PRDefaults{CoverageGist: true})
+	_, err := engine.CreateFixPR(ctx, analysis, fix)
+	require.NoError(t, err)
+	assert.NotContains(t, got.body, "Coverage Report")
+}
@@ -3,7 +3,11 @@ package main
 import (
 	"context"
 	"fmt"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"dagger.io/dagger"
 )
@@ -18,10 +22,20 @@ type ContainerInterface interface {
 	From(image string) ContainerInterface
 	WithExec(args []string) ContainerInterface
 	WithEnvVariable(key, value string) ContainerInterface
+	WithoutEnvVariable(key string) ContainerInterface
 	WithWorkdir(path string) ContainerInterface
+	WithDirectory(path string, dir *dagger.Directory) ContainerInterface
+	WithNewFile(path, contents string) ContainerInterface
+	WithSecretVariable(name string, secret *dagger.Secret) ContainerInterface
+	WithMountedCache(path, key string) ContainerInterface
 	File(path string) FileInterface
+	Directory(path string) DirectoryInterface
 	Stdout(ctx context.Context) (string, error)
 	Stderr(ctx context.Context) (string, error)
+	Sync(ctx context.Context) error
+	// Exec runs a command and captures its output and exit code. A non-zero exit is not
+	// an error and leaves the returned container usable, e.g. to read test reports.
+	Exec(ctx context.Context, args []string) (ContainerInterface, *ExecOutput, error)
 }
 
 // FileInterface abstracts Dagger file operations
@@ -29,6 +43,12 @@ type FileInterface interface {
 	Contents(ctx context.Context) (string, error)
 }
 
+// DirectoryInterface abstracts Dagger directory operations
+type DirectoryInterface interface {
+	Entries(ctx context.Context) ([]string, error)
+	Unwrap() *dagger.Directory
+}
+
 // RealContainerProvider uses actual Dagger (production)
 type RealContainerProvider struct{}
 
@@ -56,14 +76,38 @@ func (r *RealContainerWrapper) WithEnvVariable(key, value string) ContainerInter
 	return &RealContainerWrapper{r.container.WithEnvVariable(key, value)}
 }
 
+func (r *RealContainerWrapper) WithoutEnvVariable(key string) ContainerInterface {
+	return &RealContainerWrapper{r.container.WithoutEnvVariable(key)}
+}
+
 func (r *RealContainerWrapper) WithWorkdir(path string) ContainerInterface {
 	return &RealContainerWrapper{r.container.WithWorkdir(path)}
 }
 
+func (r *RealContainerWrapper) WithDirectory(path string, dir *dagger.Directory) ContainerInterface {
+	return &RealContainerWrapper{r.container.WithDirectory(path, dir)}
+}
+
+func (r *RealContainerWrapper) WithNewFile(path, contents string) ContainerInterface {
+	return &RealContainerWrapper{r.container.WithNewFile(path, dagger.ContainerWithNewFileOpts{Contents: contents})}
+}
+
+func (r *RealContainerWrapper) WithSecretVariable(name string, secret *dagger.Secret) ContainerInterface {
+	return &RealContainerWrapper{r.container.WithSecretVariable(name, secret)}
+}
+
+func (r *RealContainerWrapper) WithMountedCache(path, key string) ContainerInterface {
+	return &RealContainerWrapper{r.container.WithMountedCache(path, dag.CacheVolume(key))}
+}
+
 func (r *RealContainerWrapper) File(path string) FileInterface {
 	return &RealFileWrapper{r.container.File(path)}
 }
 
+func (r *RealContainerWrapper) Directory(path string) DirectoryInterface {
+	return &RealDirectoryWrapper{r.container.Directory(path)}
+}
+
 func (r *RealContainerWrapper) Stdout(ctx context.Context) (string, error) {
 	return r.container.Stdout(ctx)
 }
@@ -72,6 +116,40 @@ func (r *RealContainerWrapper) Stderr(ctx context.Context) (string, error) {
 	return r.container.Stderr(ctx)
 }
 
+func (r *RealContainerWrapper) Sync(ctx context.Context) error {
+	_, err := r.container.Sync(ctx)
+	return err
+}
+
+// exitCodeFile receives the exit code of commands run through Exec
+const exitCodeFile = "/tmp/.autofix-exit-code"
+
+func (r *RealContainerWrapper) Exec(ctx context.Context, args []string) (ContainerInterface, *ExecOutput, error) {
+	// Dagger fails the whole exec on a non-zero exit, so the command is wrapped to
+	// record its exit code instead
+	script := `"$@"; echo $? > ` + exitCodeFile
+	executed := r.container.WithExec(append([]string{"sh", "-c", script, "sh"}, args...))
+
+	stdout, err := executed.Stdout(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	stderr, err := executed.Stderr(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	code, err := executed.File(exitCodeFile).Contents(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read exit code: %w", err)
+	}
+	exitCode, err := strconv.Atoi(strings.TrimSpace(code))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid exit code %q: %w", code, err)
+	}
+
+	return &RealContainerWrapper{executed}, &ExecOutput{Stdout: stdout, Stderr: stderr, ExitCode: exitCode}, nil
+}
+
 // RealFileWrapper wraps real Dagger file
 type RealFileWrapper struct {
 	file *dagger.File
@@ -81,9 +159,26 @@ func (r *RealFileWrapper) Contents(ctx context.Context) (string, error) {
 	return r.file.Contents(ctx)
 }
 
-// MockContainerProvider for testing
+// RealDirectoryWrapper wraps real Dagger directory
+type RealDirectoryWrapper struct {
+	directory *dagger.Directory
+}
+
+func (r *RealDirectoryWrapper) Entries(ctx context.Context) ([]string, error) {
+	return r.directory.Entries(ctx)
+}
+
+func (r *RealDirectoryWrapper) Unwrap() *dagger.Directory {
+	return r.directory
+}
+
+// MockContainerProvider for testing. By default every container it creates is MockContainer.
+// When Isolated is set, each one gets its own environment, secrets and history, sharing
+// MockContainer's file system and command outputs, and is recorded in Containers.
 type MockContainerProvider struct {
 	MockContainer *MockDaggerContainer
+	Isolated      bool
+	Containers    []*MockDaggerContainer
 }
 
 func NewMockContainerProvider() *MockContainerProvider {
@@ -93,7 +188,18 @@ func NewMockContainerProvider() *MockContainerProvider {
 }
 
 func (m *MockContainerProvider) CreateContainer() ContainerInterface {
-	return &MockContainerWrapper{m.MockContainer}
+	if !m.Isolated {
+		return &MockContainerWrapper{m.MockContainer}
+	}
+	container := &MockDaggerContainer{
+		WorkingDir:     "/",
+		EnvVars:        make(map[string]string),
+		Caches:         make(map[string]string),
+		FileSystem:     m.MockContainer.FileSystem,
+		CommandOutputs: m.MockContainer.CommandOutputs,
+	}
+	m.Containers = append(m.Containers, container)
+	return &MockContainerWrapper{container}
 }
 
 // MockDaggerContainer simulates all Dagger operations
@@ -102,6 +208,10 @@ type MockDaggerContainer struct {
 	WorkingDir     string
 	EnvVars        map[string]string
 	ExecHistory    [][]string
+	Operations     []string // ordered log of execs, file writes and mounts
+	Directories    []string
+	SecretVars     []string
+	Caches         map[string]string // mount path -> cache volume key
 	FileSystem     map[string]string
 	CommandOutputs map[string]MockCommandResult
 	ShouldFail     bool
@@ -113,6 +223,8 @@ type MockCommandResult struct {
 	Stderr   string
 	ExitCode int
 	Error    error
+	Delay    time.Duration // simulates a slow command; honors ctx cancellation
+	Writes   map[string]string
 }
 
 func NewMockDaggerContainer() *MockDaggerContainer {
@@ -122,6 +234,7 @@ func NewMockDaggerContainer() *MockDaggerContainer {
 		EnvVars:        make(map[string]string),
 		ExecHistory:    make([][]string, 0),
 		FileSystem:     make(map[string]string),
+		Caches:         make(map[string]string),
 		CommandOutputs: make(map[string]MockCommandResult),
 		ShouldFail:     false,
 	}
@@ -139,7 +252,7 @@ func (m *MockDaggerContainer) setupDefaultFiles() {
 	m.FileSystem["pom.xml"] = `<?xml version="1.0"?><project><modelVersion>4.0.0</modelVersion></project>`
 
 	// Default command outputs
-	m.CommandOutputs["go test ./..."] = MockCommandResult{
+	m.CommandOutputs["go test -json ./..."] = MockCommandResult{
 		Stdout:   "PASS\ncoverage: 87.5% of statements\nok\ttest\t0.005s",
 		ExitCode: 0,
 	}
@@ -184,11 +297,18 @@ func (m *MockContainerWrapper) From(image string) ContainerInterface {
 
 func (m *MockContainerWrapper) WithExec(args []string) ContainerInterface {
 	m.mock.ExecHistory = append(m.mock.ExecHistory, args)
+	m.mock.Operations = append(m.mock.Operations, "exec:"+strings.Join(args, " "))
 	return m
 }
 
 func (m *MockContainerWrapper) WithEnvVariable(key, value string) ContainerInterface {
 	m.mock.EnvVars[key] = value
+	m.mock.Operations = append(m.mock.Operations, "env:"+key)
+	return m
+}
+
+func (m *MockContainerWrapper) WithoutEnvVariable(key string) ContainerInterface {
+	delete(m.mock.EnvVars, key)
 	return m
 }
 
@@ -197,10 +317,37 @@ func (m *MockContainerWrapper) WithWorkdir(path string) ContainerInterface {
 	return m
 }
 
+func (m *MockContainerWrapper) WithDirectory(path string, dir *dagger.Directory) ContainerInterface {
+	m.mock.Directories = append(m.mock.Directories, path)
+	m.mock.Operations = append(m.mock.Operations, "directory:"+path)
+	return m
+}
+
+func (m *MockContainerWrapper) WithNewFile(path, contents string) ContainerInterface {
+	m.mock.FileSystem[path] = contents
+	m.mock.Operations = append(m.mock.Operations, "write:"+path)
+	return m
+}
+
+func (m *MockContainerWrapper) WithSecretVariable(name string, secret *dagger.Secret) ContainerInterface {
+	m.mock.SecretVars = append(m.mock.SecretVars, name)
+	return m
+}
+
+func (m *MockContainerWrapper) WithMountedCache(path, key string) ContainerInterface {
+	m.mock.Caches[path] = key
+	m.mock.Operations = append(m.mock.Operations, "cache:"+path+"="+key)
+	return m
+}
+
 func (m *MockContainerWrapper) File(path string) FileInterface {
 	return &MockFileWrapper{path: path, container: m.mock}
 }
 
+func (m *MockContainerWrapper) Directory(path string) DirectoryInterface {
+	return &MockDirectoryWrapper{path: path, container: m.mock}
+}
+
 func (m *MockContainerWrapper) Stdout(ctx context.Context) (string, error) {
 	if m.mock.ShouldFail {
 		return "", fmt.Errorf("mock container failed: %s", m.mock.FailureMessage)
@@ -210,6 +357,13 @@ func (m *MockContainerWrapper) Stdout(ctx context.Context) (string, error) {
 	if len(m.mock.ExecHistory) > 0 {
 		lastCmd := strings.Join(m.mock.ExecHistory[len(m.mock.ExecHistory)-1], " ")
 		if result, exists := m.mock.CommandOutputs[lastCmd]; exists {
+			if result.Delay > 0 {
+				select {
+				case <-time.After(result.Delay):
+				case <-ctx.Done():
+					return "", ctx.Err()
+				}
+			}
 			if result.Error != nil {
 				return result.Stdout, result.Error
 			}
@@ -224,9 +378,54 @@ func (m *MockContainerWrapper) Stderr(ctx context.Context) (string, error) {
 	if m.mock.ShouldFail {
 		return m.mock.FailureMessage, fmt.Errorf("mock container failed")
 	}
+
+	if len(m.mock.ExecHistory) > 0 {
+		lastCmd := strings.Join(m.mock.ExecHistory[len(m.mock.ExecHistory)-1], " ")
+		if result, exists := m.mock.CommandOutputs[lastCmd]; exists {
+			return result.Stderr, nil
+		}
+	}
 	return "", nil
 }
 
+// Exec runs the command like WithExec. A configured Error without an exit code is
+// treated as the command exiting with code 1.
+func (m *MockContainerWrapper) Exec(ctx context.Context, args []string) (ContainerInterface, *ExecOutput, error) {
+	m.WithExec(args)
+	if m.mock.ShouldFail {
+		return nil, nil, fmt.Errorf("mock container failed: %s", m.mock.FailureMessage)
+	}
+
+	result, exists := m.mock.CommandOutputs[strings.Join(args, " ")]
+	if !exists {
+		return m, &ExecOutput{Stdout: "mock output"}, nil
+	}
+	if result.Delay > 0 {
+		select {
+		case <-time.After(result.Delay):
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	for path, contents := range result.Writes {
+		m.mock.FileSystem[path] = contents
+	}
+
+	output := &ExecOutput{Stdout: result.Stdout, Stderr: result.Stderr, ExitCode: result.ExitCode}
+	if result.Error != nil && output.ExitCode == 0 {
+		output.ExitCode = 1
+	}
+	return m, output, nil
+}
+
+func (m *MockContainerWrapper) Sync(ctx context.Context) error {
+	if m.mock.ShouldFail {
+		return fmt.Errorf("mock container failed: %s", m.mock.FailureMessage)
+	}
+	return nil
+}
+
 // MockFileWrapper implements FileInterface
 type MockFileWrapper struct {
 	path      string
@@ -243,4 +442,45 @@ func (f *MockFileWrapper) Contents(ctx context.Context) (string, error) {
 	}
 
 	return "", fmt.Errorf("file not found: %s", f.path)
-}
\ No newline at end of file
+}
+
+// MockDirectoryWrapper implements DirectoryInterface by listing the mock file system,
+// whose paths are relative to the working directory
+type MockDirectoryWrapper struct {
+	path      string
+	container *MockDaggerContainer
+}
+
+func (d *MockDirectoryWrapper) Entries(ctx context.Context) ([]string, error) {
+	if d.container.ShouldFail {
+		return nil, fmt.Errorf("directory not found: %s", d.path)
+	}
+
+	prefix := ""
+	if dir := path.Clean(d.path); dir != "." {
+		prefix = dir + "/"
+	}
+
+	seen := make(map[string]bool)
+	var entries []string
+	for filePath := range d.container.FileSystem {
+		if !strings.HasPrefix(filePath, prefix) {
+			continue
+		}
+		entry, _, _ := strings.Cut(strings.TrimPrefix(filePath, prefix), "/")
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 && prefix != "" {
+		return nil, fmt.Errorf("directory not found: %s", d.path)
+	}
+
+	sort.Strings(entries)
+	return entries, nil
+}
+
+func (d *MockDirectoryWrapper) Unwrap() *dagger.Directory {
+	return &dagger.Directory{}
+}
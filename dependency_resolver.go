@@ -0,0 +1,908 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// dependencyFixConfidence is the confidence of a resolved version bump: the version is
+	// known to exist and the lockfile was regenerated by the package manager itself
+	dependencyFixConfidence = 0.95
+	registryTimeout         = 30 * time.Second
+	registryUserAgent       = "github-autofix"
+)
+
+// DependencyRegistries are the base URLs of the registries versions are resolved against
+type DependencyRegistries struct {
+	NPM     string
+	GoProxy string
+	PyPI    string
+	Crates  string
+}
+
+// DefaultDependencyRegistries returns the public registries
+func DefaultDependencyRegistries() DependencyRegistries {
+	return DependencyRegistries{
+		NPM:     "https://registry.npmjs.org",
+		GoProxy: "https://proxy.golang.org",
+		PyPI:    "https://pypi.org/pypi",
+		Crates:  "https://crates.io/api/v1/crates",
+	}
+}
+
+// DependencyResolver turns dependency failures into exact version bumps. It finds the
+// failing package in the error output, looks up the latest version compatible with the
+// manifest's constraint in the package registry, edits the manifest and regenerates the
+// lockfile with the package manager, so the fix does not depend on the LLM getting
+// versions or lockfile contents right.
+type DependencyResolver struct {
+	logger            *logrus.Logger
+	client            *http.Client
+	containerProvider ContainerProvider
+	registries        DependencyRegistries
+}
+
+// NewDependencyResolver creates a resolver that queries the public registries
+func NewDependencyResolver(logger *logrus.Logger) *DependencyResolver {
+	return &DependencyResolver{
+		logger:            logger,
+		client:            &http.Client{Timeout: registryTimeout},
+		containerProvider: &RealContainerProvider{},
+		registries:        DefaultDependencyRegistries(),
+	}
+}
+
+// SetContainerProvider sets the container provider lockfiles are regenerated with
+func (r *DependencyResolver) SetContainerProvider(provider ContainerProvider) {
+	r.containerProvider = provider
+}
+
+// SetRegistries points the resolver at other registries, e.g. a mirror
+func (r *DependencyResolver) SetRegistries(registries DependencyRegistries) {
+	r.registries = registries
+}
+
+// packageEcosystem describes how the packages of one package manager are found, looked
+// up and pinned
+type packageEcosystem struct {
+	name     string
+	osv      string // the ecosystem's name in OSV advisories
+	manifest string
+	// lockfile is regenerated by lockCommand in the image of framework; empty when the
+	// ecosystem has none
+	lockfile    string
+	lockCommand string
+	framework   string
+	// patterns capture the failing package in an error line
+	patterns []*regexp.Regexp
+	// module maps the failing package to the name it is declared under in the manifest
+	module   func(r *DependencyResolver, ctx context.Context, manifest, pkg string) (string, error)
+	current  func(manifest, pkg string) string
+	versions func(r *DependencyResolver, ctx context.Context, pkg string) (versions []string, latest string, err error)
+	update   func(manifest, pkg, version string) (string, error)
+}
+
+var packageEcosystems = []*packageEcosystem{
+	{
+		name:        "npm",
+		osv:         "npm",
+		manifest:    "package.json",
+		lockfile:    "package-lock.json",
+		lockCommand: "npm install --package-lock-only --ignore-scripts",
+		framework:   "nodejs",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`No matching version found for (@?[^@\s]+)@`),
+			regexp.MustCompile(`'(@?[^@'\s]+)@[^']*' is not in (?:the npm|this) registry`),
+			regexp.MustCompile(`Cannot find module '(@?[^'./][^']*)'`),
+		},
+		module: func(r *DependencyResolver, ctx context.Context, manifest, pkg string) (string, error) {
+			return npmPackageName(pkg), nil
+		},
+		current:  npmCurrentVersion,
+		versions: (*DependencyResolver).npmVersions,
+		update:   updatePackageJSON,
+	},
+	{
+		name:        "go",
+		osv:         "Go",
+		manifest:    "go.mod",
+		lockfile:    "go.sum",
+		lockCommand: "go mod tidy",
+		framework:   "golang",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`no required module provides package ([^\s;]+)`),
+			regexp.MustCompile(`missing go\.sum entry for module providing package ([^\s;]+)`),
+			regexp.MustCompile(`cannot find module providing package ([^\s;]+)`),
+			regexp.MustCompile(`go: ([^\s@]+)@v\S+: (?:invalid version|unknown revision|reading)`),
+		},
+		module:   (*DependencyResolver).goModule,
+		current:  goModCurrentVersion,
+		versions: (*DependencyResolver).goVersions,
+		update:   updateGoMod,
+	},
+	{
+		name:     "pypi",
+		osv:      "PyPI",
+		manifest: "requirements.txt",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`No matching distribution found for ([A-Za-z0-9][A-Za-z0-9._-]*)`),
+			regexp.MustCompile(`ModuleNotFoundError: No module named '([^'.]+)`),
+		},
+		current:  requirementsCurrentVersion,
+		versions: (*DependencyResolver).pypiVersions,
+		update:   updateRequirements,
+	},
+	{
+		name:        "cargo",
+		osv:         "crates.io",
+		manifest:    "Cargo.toml",
+		lockfile:    "Cargo.lock",
+		lockCommand: "cargo fetch",
+		framework:   "rust",
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile("failed to select a version for the requirement `([A-Za-z0-9_-]+) ="),
+			regexp.MustCompile("no matching package named `([A-Za-z0-9_-]+)` found"),
+		},
+		current:  cargoCurrentVersion,
+		versions: (*DependencyResolver).crateVersions,
+		update:   updateCargoToml,
+	},
+}
+
+// failingPackage returns the first package the error lines blame, or ""
+func (eco *packageEcosystem) failingPackage(lines []string) string {
+	for _, line := range lines {
+		for _, pattern := range eco.patterns {
+			if match := pattern.FindStringSubmatch(line); match != nil {
+				return match[1]
+			}
+		}
+	}
+	return ""
+}
+
+// ResolveDependencyFix proposes a version bump of the package a dependency failure blames,
+// or of a package with a security advisory to its fixed version. It returns nil when no
+// supported manifest declares such a package, or when the manifest and lockfile already
+// pin the resolved version.
+func (r *DependencyResolver) ResolveDependencyFix(ctx context.Context, source *dagger.Directory, analysis *FailureAnalysisResult) (*ProposedFix, error) {
+	if source == nil {
+		return nil, fmt.Errorf("source directory is required")
+	}
+
+	workspace := r.containerProvider.CreateContainer().From(workspaceImage).
+		WithDirectory("/workspace", source).
+		WithWorkdir("/workspace")
+	if len(analysis.Advisories) > 0 {
+		if fix, err := r.resolveAdvisories(ctx, source, workspace, analysis); fix != nil || err != nil {
+			return fix, err
+		}
+	}
+
+	lines := []string{analysis.RootCause, analysis.Description}
+	if logs := analysis.Context.Logs; logs != nil {
+		lines = append(append([]string{}, logs.ErrorLines...), lines...)
+	}
+	for _, eco := range packageEcosystems {
+		pkg := eco.failingPackage(lines)
+		if pkg == "" {
+			continue
+		}
+		manifest, err := workspace.File(eco.manifest).Contents(ctx)
+		if err != nil {
+			continue
+		}
+		return r.resolve(ctx, source, workspace, eco, manifest, pkg, analysis)
+	}
+	return nil, nil
+}
+
+func (r *DependencyResolver) resolve(ctx context.Context, source *dagger.Directory, workspace ContainerInterface, eco *packageEcosystem, manifest, pkg string, analysis *FailureAnalysisResult) (*ProposedFix, error) {
+	if eco.module != nil {
+		module, err := eco.module(r, ctx, manifest, pkg)
+		if err != nil {
+			return nil, err
+		}
+		pkg = module
+	}
+
+	current := eco.current(manifest, pkg)
+	versions, latest, err := eco.versions(r, ctx, pkg)
+	if err != nil {
+		return nil, err
+	}
+	version := latestCompatibleVersion(versions, current)
+	if version == "" {
+		version = latest
+	}
+	if version == "" {
+		return nil, fmt.Errorf("no published versions of %s found in the %s registry", pkg, eco.name)
+	}
+	r.logger.WithFields(logrus.Fields{
+		"ecosystem": eco.name,
+		"package":   pkg,
+		"current":   current,
+		"version":   version,
+	}).Info("Resolved dependency version")
+
+	changes, err := r.pin(ctx, source, workspace, eco, manifest, pkg, version)
+	if err != nil || len(changes) == 0 {
+		return nil, err
+	}
+
+	description := fmt.Sprintf("Bump %s to %s in %s", pkg, version, eco.manifest)
+	if current == "" {
+		description = fmt.Sprintf("Add %s %s to %s", pkg, version, eco.manifest)
+	}
+	rationale := fmt.Sprintf("%s %s is the latest published version compatible with %s.", pkg, version, valueOr(current, "the manifest"))
+	return newDependencyFix(analysis, eco, changes, description, rationale), nil
+}
+
+// resolveAdvisories bumps the first package with a fixed advisory that the manifest of its
+// ecosystem declares to the highest fixed version of its advisories. Packages only
+// required transitively are left to the generated fixes.
+func (r *DependencyResolver) resolveAdvisories(ctx context.Context, source *dagger.Directory, workspace ContainerInterface, analysis *FailureAnalysisResult) (*ProposedFix, error) {
+	for _, advisory := range analysis.Advisories {
+		eco := osvPackageEcosystem(advisory.Ecosystem)
+		if eco == nil || advisory.FixedVersion == "" {
+			continue
+		}
+		manifest, err := workspace.File(eco.manifest).Contents(ctx)
+		if err != nil || eco.current(manifest, advisory.Package) == "" {
+			continue
+		}
+
+		version, fixedVersion, ids := advisory.FixedVersion, packageVersion{}, []string{}
+		for _, other := range analysis.Advisories {
+			if other.Package != advisory.Package || other.Ecosystem != advisory.Ecosystem {
+				continue
+			}
+			ids = appendMissing(ids, other.ID)
+			if v, ok := parsePackageVersion(other.FixedVersion); ok && (len(ids) == 1 || v.compare(fixedVersion) > 0) {
+				version, fixedVersion = other.FixedVersion, v
+			}
+		}
+		if eco.name == "go" && !strings.HasPrefix(version, "v") {
+			version = "v" + version
+		}
+		r.logger.WithFields(logrus.Fields{
+			"package":    advisory.Package,
+			"advisories": ids,
+			"version":    version,
+		}).Info("Resolved fixed version of vulnerable dependency")
+
+		changes, err := r.pin(ctx, source, workspace, eco, manifest, advisory.Package, version)
+		if err != nil || len(changes) == 0 {
+			return nil, err
+		}
+		description := fmt.Sprintf("Bump %s to %s in %s to fix %s", advisory.Package, version, eco.manifest, strings.Join(ids, ", "))
+		rationale := fmt.Sprintf("%s is the version of %s that fixes %s.", version, advisory.Package, strings.Join(ids, ", "))
+		fix := newDependencyFix(analysis, eco, changes, description, rationale)
+		fix.Type = SecurityFix
+		return fix, nil
+	}
+	return nil, nil
+}
+
+func osvPackageEcosystem(name string) *packageEcosystem {
+	for _, eco := range packageEcosystems {
+		if eco.osv == name {
+			return eco
+		}
+	}
+	return nil
+}
+
+// pin requires version of pkg in the manifest and regenerates the lockfile. It returns no
+// changes when both already pin it.
+func (r *DependencyResolver) pin(ctx context.Context, source *dagger.Directory, workspace ContainerInterface, eco *packageEcosystem, manifest, pkg, version string) ([]CodeChange, error) {
+	updated, err := eco.update(manifest, pkg, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update %s: %w", eco.manifest, err)
+	}
+
+	var changes []CodeChange
+	if eco.lockfile != "" {
+		lockChanges, tidied, err := r.regenerateLockfile(ctx, source, workspace, eco, updated)
+		if err != nil {
+			return nil, err
+		}
+		updated = tidied
+		changes = append(changes, lockChanges...)
+	}
+	if updated != manifest {
+		changes = append([]CodeChange{{
+			FilePath:    eco.manifest,
+			OldContent:  manifest,
+			NewContent:  updated,
+			Operation:   ChangeOperationModify,
+			Explanation: fmt.Sprintf("Require %s %s", pkg, version),
+		}}, changes...)
+	}
+	if len(changes) == 0 {
+		r.logger.WithField("package", pkg).Info("Manifest and lockfile already pin the resolved version")
+	}
+	return changes, nil
+}
+
+func newDependencyFix(analysis *FailureAnalysisResult, eco *packageEcosystem, changes []CodeChange, description, rationale string) *ProposedFix {
+	fix := &ProposedFix{
+		ID:          fmt.Sprintf("%s-dependency", analysis.ID),
+		Type:        DependencyFix,
+		Description: description,
+		Rationale:   rationale,
+		Changes:     changes,
+		Confidence:  dependencyFixConfidence,
+		Benefits:    []string{"Pins a version that exists in the registry"},
+		Timestamp:   time.Now(),
+	}
+	if eco.lockCommand != "" {
+		fix.Commands = []string{eco.lockCommand}
+		fix.Rationale += fmt.Sprintf(" %s was regenerated with `%s`.", eco.lockfile, eco.lockCommand)
+	}
+	return fix
+}
+
+// regenerateLockfile runs the ecosystem's lock command on the updated manifest and returns
+// the lockfile change along with the manifest as the package manager left it
+func (r *DependencyResolver) regenerateLockfile(ctx context.Context, source *dagger.Directory, workspace ContainerInterface, eco *packageEcosystem, manifest string) ([]CodeChange, string, error) {
+	previous, err := workspace.File(eco.lockfile).Contents(ctx)
+	operation := ChangeOperationModify
+	if err != nil {
+		previous, operation = "", ChangeOperationAdd
+	}
+
+	container := r.containerProvider.CreateContainer().From(loadTestFrameworks()[eco.framework].Image).
+		WithDirectory("/workspace", source).
+		WithWorkdir("/workspace").
+		WithNewFile(eco.manifest, manifest)
+	executed, output, err := container.Exec(ctx, strings.Fields(eco.lockCommand))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to run %s: %w", eco.lockCommand, err)
+	}
+	if output.ExitCode != 0 {
+		return nil, "", fmt.Errorf("%s exited with code %d: %s", eco.lockCommand, output.ExitCode, strings.TrimSpace(valueOr(output.Stderr, output.Stdout)))
+	}
+
+	lockfile, err := executed.File(eco.lockfile).Contents(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read regenerated %s: %w", eco.lockfile, err)
+	}
+	if tidied, err := executed.File(eco.manifest).Contents(ctx); err == nil {
+		manifest = tidied
+	}
+	if lockfile == previous {
+		return nil, manifest, nil
+	}
+	return []CodeChange{{
+		FilePath:    eco.lockfile,
+		OldContent:  previous,
+		NewContent:  lockfile,
+		Operation:   operation,
+		Explanation: fmt.Sprintf("Regenerated with `%s`", eco.lockCommand),
+	}}, manifest, nil
+}
+
+// resolveDependencyFix asks the dependency resolver for a version bump when the failure is
+// a dependency failure, or a security failure with advisories. Resolution errors are
+// logged; the LLM fixes are used alone then.
+func (m *DaggerAutofix) resolveDependencyFix(ctx context.Context, analysis *FailureAnalysisResult) *ProposedFix {
+	if m.dependencies == nil || m.Source == nil {
+		return nil
+	}
+	if analysis.Classification.Type != DependencyFailure && (analysis.Classification.Type != SecurityFailure || len(analysis.Advisories) == 0) {
+		return nil
+	}
+	fix, err := m.dependencies.ResolveDependencyFix(ctx, m.Source, analysis)
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to resolve dependency fix, using generated fixes only")
+		return nil
+	}
+	if fix != nil {
+		m.logger.WithField("fix", fix.Description).Info("Resolved dependency fix")
+	}
+	return fix
+}
+
+// getRegistry fetches url from a package registry
+func (r *DependencyResolver) getRegistry(ctx context.Context, registryURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, registryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create registry request: %w", err)
+	}
+	req.Header.Set("User-Agent", registryUserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("registry request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry response: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return nil, fmt.Errorf("%s not found in registry", registryURL)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("registry %s returned %s", registryURL, resp.Status)
+	}
+	return body, nil
+}
+
+func (r *DependencyResolver) getRegistryJSON(ctx context.Context, registryURL string, out interface{}) error {
+	body, err := r.getRegistry(ctx, registryURL)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse registry response from %s: %w", registryURL, err)
+	}
+	return nil
+}
+
+func (r *DependencyResolver) npmVersions(ctx context.Context, pkg string) ([]string, string, error) {
+	var doc struct {
+		DistTags map[string]string          `json:"dist-tags"`
+		Versions map[string]json.RawMessage `json:"versions"`
+	}
+	if err := r.getRegistryJSON(ctx, r.registries.NPM+"/"+strings.Replace(pkg, "/", "%2F", 1), &doc); err != nil {
+		return nil, "", err
+	}
+	versions := make([]string, 0, len(doc.Versions))
+	for version := range doc.Versions {
+		versions = append(versions, version)
+	}
+	return versions, doc.DistTags["latest"], nil
+}
+
+func (r *DependencyResolver) goVersions(ctx context.Context, module string) ([]string, string, error) {
+	base := r.registries.GoProxy + "/" + escapeModulePath(module) + "/@v/list"
+	list, err := r.getRegistry(ctx, base)
+	if err != nil {
+		return nil, "", err
+	}
+	latest, err := r.goLatest(ctx, module)
+	if err != nil {
+		return nil, "", err
+	}
+	return strings.Fields(string(list)), latest, nil
+}
+
+func (r *DependencyResolver) goLatest(ctx context.Context, module string) (string, error) {
+	var info struct {
+		Version string `json:"Version"`
+	}
+	if err := r.getRegistryJSON(ctx, r.registries.GoProxy+"/"+escapeModulePath(module)+"/@latest", &info); err != nil {
+		return "", err
+	}
+	return info.Version, nil
+}
+
+// goModule returns the module that provides pkg: the longest module required in go.mod
+// that is a prefix of it, otherwise the longest prefix the proxy knows
+func (r *DependencyResolver) goModule(ctx context.Context, gomod, pkg string) (string, error) {
+	module := ""
+	for _, required := range goModRequirements(gomod) {
+		if (pkg == required || strings.HasPrefix(pkg, required+"/")) && len(required) > len(module) {
+			module = required
+		}
+	}
+	if module != "" {
+		return module, nil
+	}
+
+	parts := strings.Split(pkg, "/")
+	for n := len(parts); n >= 1; n-- {
+		candidate := strings.Join(parts[:n], "/")
+		if !strings.Contains(parts[0], ".") {
+			break // standard library or a local package
+		}
+		if _, err := r.goLatest(ctx, candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no module provides package %s", pkg)
+}
+
+func (r *DependencyResolver) pypiVersions(ctx context.Context, pkg string) ([]string, string, error) {
+	var doc struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		Releases map[string][]struct {
+			Yanked bool `json:"yanked"`
+		} `json:"releases"`
+	}
+	if err := r.getRegistryJSON(ctx, r.registries.PyPI+"/"+url.PathEscape(pkg)+"/json", &doc); err != nil {
+		return nil, "", err
+	}
+	var versions []string
+	for version, files := range doc.Releases {
+		for _, file := range files {
+			if !file.Yanked {
+				versions = append(versions, version)
+				break
+			}
+		}
+	}
+	return versions, doc.Info.Version, nil
+}
+
+func (r *DependencyResolver) crateVersions(ctx context.Context, crate string) ([]string, string, error) {
+	var doc struct {
+		Crate struct {
+			MaxStableVersion string `json:"max_stable_version"`
+		} `json:"crate"`
+		Versions []struct {
+			Num    string `json:"num"`
+			Yanked bool   `json:"yanked"`
+		} `json:"versions"`
+	}
+	if err := r.getRegistryJSON(ctx, r.registries.Crates+"/"+url.PathEscape(crate), &doc); err != nil {
+		return nil, "", err
+	}
+	var versions []string
+	for _, version := range doc.Versions {
+		if !version.Yanked {
+			versions = append(versions, version.Num)
+		}
+	}
+	return versions, doc.Crate.MaxStableVersion, nil
+}
+
+// escapeModulePath escapes a module path for the Go module proxy, which encodes each
+// upper-case letter as '!' followed by the lower-case letter
+func escapeModulePath(module string) string {
+	var b strings.Builder
+	for _, c := range module {
+		if c >= 'A' && c <= 'Z' {
+			b.WriteByte('!')
+			c += 'a' - 'A'
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+var (
+	versionPattern           = regexp.MustCompile(`^v?(\d+)(?:\.(\d+))?(?:\.(\d+))?(.*)$`)
+	constraintVersionPattern = regexp.MustCompile(`v?\d+(?:\.\d+)*`)
+	stableSuffixPattern      = regexp.MustCompile(`^(?:(?:\.\d+)*|\+.*|\.?post\d*)$`)
+)
+
+// packageVersion is a parsed release version; suffix holds anything after the patch
+// number, such as a pre-release
+type packageVersion struct {
+	major, minor, patch int
+	suffix              string
+}
+
+func parsePackageVersion(version string) (packageVersion, bool) {
+	match := versionPattern.FindStringSubmatch(strings.TrimSpace(version))
+	if match == nil {
+		return packageVersion{}, false
+	}
+	var v packageVersion
+	v.major, _ = strconv.Atoi(match[1])
+	v.minor, _ = strconv.Atoi(match[2])
+	v.patch, _ = strconv.Atoi(match[3])
+	v.suffix = match[4]
+	return v, true
+}
+
+func (v packageVersion) stable() bool {
+	return stableSuffixPattern.MatchString(v.suffix)
+}
+
+func (v packageVersion) compare(other packageVersion) int {
+	for _, d := range []int{v.major - other.major, v.minor - other.minor, v.patch - other.patch} {
+		if d != 0 {
+			return d
+		}
+	}
+	switch {
+	case v.suffix == other.suffix:
+		return 0
+	case v.stable() != other.stable():
+		if v.stable() {
+			return 1
+		}
+		return -1
+	case v.suffix > other.suffix:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// latestCompatibleVersion returns the highest stable version with the major version of
+// the constraint, and the same minor version for 0.x constraints. Without a constraint
+// any stable version is compatible. It returns "" when no version is.
+func latestCompatibleVersion(versions []string, constraint string) string {
+	base, constrained := parsePackageVersion(constraintVersionPattern.FindString(constraint))
+	best, bestVersion := "", packageVersion{}
+	for _, version := range versions {
+		v, ok := parsePackageVersion(version)
+		if !ok || !v.stable() {
+			continue
+		}
+		if constrained && (v.major != base.major || (base.major == 0 && v.minor != base.minor)) {
+			continue
+		}
+		if best == "" || v.compare(bestVersion) > 0 {
+			best, bestVersion = version, v
+		}
+	}
+	return best
+}
+
+// npmPackageName strips the file path from a module specifier: lodash/fp is lodash and
+// @scope/pkg/lib is @scope/pkg
+func npmPackageName(specifier string) string {
+	parts := strings.Split(specifier, "/")
+	if strings.HasPrefix(specifier, "@") && len(parts) > 1 {
+		return parts[0] + "/" + parts[1]
+	}
+	return parts[0]
+}
+
+var npmDependencySections = []string{"dependencies", "devDependencies", "optionalDependencies", "peerDependencies"}
+
+func npmCurrentVersion(manifest, pkg string) string {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(manifest), &doc); err != nil {
+		return ""
+	}
+	for _, section := range npmDependencySections {
+		var deps map[string]string
+		if json.Unmarshal(doc[section], &deps) == nil && deps[pkg] != "" {
+			return deps[pkg]
+		}
+	}
+	return ""
+}
+
+// updatePackageJSON sets the constraint of pkg to ^version in place, keeping the file's
+// formatting, or adds pkg to the dependencies when no section declares it
+func updatePackageJSON(manifest, pkg, version string) (string, error) {
+	constraint := "^" + version
+	entry := regexp.MustCompile(`("` + regexp.QuoteMeta(pkg) + `"\s*:\s*")[^"]*(")`)
+	for _, section := range npmDependencySections {
+		start, end, ok := jsonObjectBounds(manifest, section)
+		if !ok {
+			continue
+		}
+		body := manifest[start:end]
+		if loc := entry.FindStringSubmatchIndex(body); loc != nil {
+			updated := manifest[:start] + body[:loc[3]] + constraint + body[loc[4]:] + manifest[end:]
+			return validPackageJSON(updated)
+		}
+	}
+
+	start, end, ok := jsonObjectBounds(manifest, "dependencies")
+	if !ok {
+		open := strings.Index(manifest, "{")
+		if open < 0 {
+			return "", fmt.Errorf("package.json is not an object")
+		}
+		separator := ","
+		if strings.TrimSpace(manifest[open+1:]) == "}" {
+			separator = ""
+		}
+		return validPackageJSON(manifest[:open+1] + fmt.Sprintf("\n  \"dependencies\": {\n    %q: %q\n  }%s", pkg, constraint, separator) + manifest[open+1:])
+	}
+
+	keyIndent := lineIndent(manifest, start)
+	entryIndent := keyIndent + valueOr(keyIndent, "  ")
+	if strings.TrimSpace(manifest[start:end]) == "" {
+		return validPackageJSON(manifest[:start] + fmt.Sprintf("\n%s%q: %q\n%s", entryIndent, pkg, constraint, keyIndent) + manifest[end:])
+	}
+	return validPackageJSON(manifest[:start] + fmt.Sprintf("\n%s%q: %q,", entryIndent, pkg, constraint) + manifest[start:])
+}
+
+// jsonObjectBounds returns the offsets of the body of the object under key, between its
+// braces. Dependency objects hold only strings, so the first closing brace ends them.
+func jsonObjectBounds(manifest, key string) (int, int, bool) {
+	loc := regexp.MustCompile(`"` + regexp.QuoteMeta(key) + `"\s*:\s*\{`).FindStringIndex(manifest)
+	if loc == nil {
+		return 0, 0, false
+	}
+	end := strings.Index(manifest[loc[1]:], "}")
+	if end < 0 {
+		return 0, 0, false
+	}
+	return loc[1], loc[1] + end, true
+}
+
+// lineIndent returns the leading whitespace of the line containing offset
+func lineIndent(text string, offset int) string {
+	line := text[strings.LastIndex(text[:offset], "\n")+1:]
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+func validPackageJSON(manifest string) (string, error) {
+	if !json.Valid([]byte(manifest)) {
+		return "", fmt.Errorf("updated package.json is not valid JSON")
+	}
+	return manifest, nil
+}
+
+// goModRequirements returns the modules required in go.mod
+func goModRequirements(gomod string) []string {
+	var modules []string
+	inBlock := false
+	for _, line := range strings.Split(gomod, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inBlock = true
+		case inBlock && fields[0] == ")":
+			inBlock = false
+		case inBlock && len(fields) >= 2:
+			modules = append(modules, fields[0])
+		case fields[0] == "require" && len(fields) >= 3:
+			modules = append(modules, fields[1])
+		}
+	}
+	return modules
+}
+
+func goModCurrentVersion(gomod, module string) string {
+	inBlock := false
+	for _, line := range strings.Split(gomod, "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inBlock = true
+		case inBlock && fields[0] == ")":
+			inBlock = false
+		case inBlock && len(fields) >= 2 && fields[0] == module:
+			return fields[1]
+		case fields[0] == "require" && len(fields) >= 3 && fields[1] == module:
+			return fields[2]
+		}
+	}
+	return ""
+}
+
+// updateGoMod sets the required version of module, adding it to the first require block
+// when go.mod does not require it yet
+func updateGoMod(gomod, module, version string) (string, error) {
+	lines := strings.Split(gomod, "\n")
+	inBlock, blockEnd := false, -1
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inBlock = true
+		case inBlock && fields[0] == ")":
+			inBlock = false
+			if blockEnd < 0 {
+				blockEnd = i
+			}
+		case inBlock && len(fields) >= 2 && fields[0] == module:
+			fields[1] = version
+			lines[i] = indent + strings.Join(fields, " ")
+			return strings.Join(lines, "\n"), nil
+		case fields[0] == "require" && len(fields) >= 3 && fields[1] == module:
+			fields[2] = version
+			lines[i] = indent + strings.Join(fields, " ")
+			return strings.Join(lines, "\n"), nil
+		}
+	}
+
+	if blockEnd >= 0 {
+		lines = append(lines[:blockEnd], append([]string{"\t" + module + " " + version}, lines[blockEnd:]...)...)
+		return strings.Join(lines, "\n"), nil
+	}
+	return strings.TrimRight(gomod, "\n") + "\n\nrequire " + module + " " + version + "\n", nil
+}
+
+var requirementPattern = regexp.MustCompile(`^\s*([A-Za-z0-9][A-Za-z0-9._-]*)(\[[^\]]*\])?\s*([=<>!~][^#;]*)?(.*)$`)
+
+// normalizePythonName normalizes a distribution name as pip compares them
+func normalizePythonName(name string) string {
+	return strings.ToLower(regexp.MustCompile(`[-_.]+`).ReplaceAllString(name, "-"))
+}
+
+func requirementsCurrentVersion(requirements, pkg string) string {
+	for _, line := range strings.Split(requirements, "\n") {
+		if match := requirementPattern.FindStringSubmatch(line); match != nil && normalizePythonName(match[1]) == normalizePythonName(pkg) {
+			return strings.TrimSpace(match[3])
+		}
+	}
+	return ""
+}
+
+// updateRequirements pins pkg to version, keeping its extras and comment, or appends it
+func updateRequirements(requirements, pkg, version string) (string, error) {
+	lines := strings.Split(requirements, "\n")
+	for i, line := range lines {
+		match := requirementPattern.FindStringSubmatch(line)
+		if match == nil || normalizePythonName(match[1]) != normalizePythonName(pkg) {
+			continue
+		}
+		lines[i] = match[1] + match[2] + "==" + version
+		if rest := strings.TrimSpace(match[4]); rest != "" {
+			lines[i] += " " + rest
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	if requirements != "" && !strings.HasSuffix(requirements, "\n") {
+		requirements += "\n"
+	}
+	return requirements + pkg + "==" + version + "\n", nil
+}
+
+var (
+	tomlSectionPattern  = regexp.MustCompile(`^\s*\[([^\]]+)\]\s*$`)
+	cargoVersionPattern = regexp.MustCompile(`(version\s*=\s*")[^"]*(")`)
+	cargoSections       = map[string]bool{"dependencies": true, "dev-dependencies": true, "build-dependencies": true}
+)
+
+// cargoDependencyLine returns the index of the line declaring crate and its value
+func cargoDependencyLine(lines []string, crate string) (int, string) {
+	entry := regexp.MustCompile(`^\s*` + regexp.QuoteMeta(crate) + `\s*=\s*(.*)$`)
+	inDependencies := false
+	for i, line := range lines {
+		if match := tomlSectionPattern.FindStringSubmatch(line); match != nil {
+			inDependencies = cargoSections[strings.TrimSpace(match[1])]
+			continue
+		}
+		if match := entry.FindStringSubmatch(line); inDependencies && match != nil {
+			return i, match[1]
+		}
+	}
+	return -1, ""
+}
+
+func cargoCurrentVersion(manifest, crate string) string {
+	_, value := cargoDependencyLine(strings.Split(manifest, "\n"), crate)
+	if match := cargoVersionPattern.FindString(value); match != "" {
+		return strings.Trim(match[strings.Index(match, `"`):], `"`)
+	}
+	return strings.Trim(strings.TrimSpace(value), `"`)
+}
+
+// updateCargoToml sets the version requirement of crate, which Cargo reads as ^version,
+// or adds the crate to [dependencies]
+func updateCargoToml(manifest, crate, version string) (string, error) {
+	lines := strings.Split(manifest, "\n")
+	if i, value := cargoDependencyLine(lines, crate); i >= 0 {
+		switch {
+		case strings.HasPrefix(strings.TrimSpace(value), `"`):
+			lines[i] = strings.Replace(lines[i], value, strconv.Quote(version), 1)
+		case cargoVersionPattern.MatchString(value):
+			lines[i] = strings.Replace(lines[i], value, cargoVersionPattern.ReplaceAllString(value, "${1}"+version+"${2}"), 1)
+		default:
+			return "", fmt.Errorf("%s is not declared with a version", crate)
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+
+	for i, line := range lines {
+		if match := tomlSectionPattern.FindStringSubmatch(line); match != nil && strings.TrimSpace(match[1]) == "dependencies" {
+			lines = append(lines[:i+1], append([]string{fmt.Sprintf("%s = %q", crate, version)}, lines[i+1:]...)...)
+			return strings.Join(lines, "\n"), nil
+		}
+	}
+	return strings.TrimRight(manifest, "\n") + fmt.Sprintf("\n\n[dependencies]\n%s = %q\n", crate, version), nil
+}
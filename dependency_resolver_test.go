@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registryServer serves fixed responses by request path and 404s everything else
+func registryServer(t *testing.T, responses map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.EscapedPath()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testResolver returns a resolver whose registries are all served by server
+func testResolver(server *httptest.Server, files map[string]string) (*DependencyResolver, *MockDaggerContainer) {
+	provider := NewMockContainerProvider()
+	provider.MockContainer.FileSystem = files
+
+	resolver := NewDependencyResolver(quietLogger())
+	resolver.SetContainerProvider(provider)
+	resolver.SetRegistries(DependencyRegistries{
+		NPM:     server.URL + "/npm",
+		GoProxy: server.URL + "/go",
+		PyPI:    server.URL + "/pypi",
+		Crates:  server.URL + "/crates",
+	})
+	return resolver, provider.MockContainer
+}
+
+func dependencyAnalysis(errorLines ...string) *FailureAnalysisResult {
+	return &FailureAnalysisResult{
+		ID:             "a1",
+		Classification: FailureClassification{Type: DependencyFailure},
+		Context:        FailureContext{Logs: &WorkflowLogs{ErrorLines: errorLines}},
+	}
+}
+
+// TestResolveDependencyFixNPM tests bumping a constraint no published version satisfies
+func TestResolveDependencyFixNPM(t *testing.T) {
+	server := registryServer(t, map[string]string{
+		"/npm/lodash": `{"dist-tags": {"latest": "4.17.21", "next": "5.0.0-beta.1"},
+			"versions": {"3.10.1": {}, "4.17.20": {}, "4.17.21": {}, "5.0.0-beta.1": {}}}`,
+	})
+	manifest := "{\n  \"name\": \"web\",\n  \"dependencies\": {\n    \"express\": \"^4.18.2\",\n    \"lodash\": \"^4.18.0\"\n  }\n}\n"
+	resolver, mock := testResolver(server, map[string]string{
+		"package.json":      manifest,
+		"package-lock.json": `{"name": "web", "lockfileVersion": 3, "packages": {}}`,
+	})
+	lockCommand := "npm install --package-lock-only --ignore-scripts"
+	regenerated := `{"name": "web", "lockfileVersion": 3, "packages": {"node_modules/lodash": {"version": "4.17.21"}}}`
+	mock.CommandOutputs[lockCommand] = MockCommandResult{Writes: map[string]string{"package-lock.json": regenerated}}
+
+	fix, err := resolver.ResolveDependencyFix(context.Background(), &dagger.Directory{},
+		dependencyAnalysis("npm error notarget No matching version found for lodash@^4.18.0."))
+	require.NoError(t, err)
+	require.NotNil(t, fix)
+
+	assert.Equal(t, DependencyFix, fix.Type)
+	assert.Equal(t, "Bump lodash to 4.17.21 in package.json", fix.Description)
+	assert.Equal(t, dependencyFixConfidence, fix.Confidence)
+	assert.Equal(t, []string{lockCommand}, fix.Commands)
+	assert.Equal(t, []CodeChange{
+		{
+			FilePath:    "package.json",
+			OldContent:  manifest,
+			NewContent:  "{\n  \"name\": \"web\",\n  \"dependencies\": {\n    \"express\": \"^4.18.2\",\n    \"lodash\": \"^4.17.21\"\n  }\n}\n",
+			Operation:   ChangeOperationModify,
+			Explanation: "Require lodash 4.17.21",
+		},
+		{
+			FilePath:    "package-lock.json",
+			OldContent:  `{"name": "web", "lockfileVersion": 3, "packages": {}}`,
+			NewContent:  regenerated,
+			Operation:   ChangeOperationModify,
+			Explanation: "Regenerated with `" + lockCommand + "`",
+		},
+	}, fix.Changes)
+	assert.Equal(t, "node:20", mock.BaseImage)
+	assert.Contains(t, mock.Operations, "exec:"+lockCommand)
+}
+
+// TestResolveDependencyFixGo tests adding a missing module and keeping go.mod as tidied
+func TestResolveDependencyFixGo(t *testing.T) {
+	server := registryServer(t, map[string]string{
+		"/go/github.com/google/uuid/@latest": `{"Version": "v1.6.0"}`,
+		"/go/github.com/google/uuid/@v/list": "v1.5.0\nv1.6.0\nv1.7.0-rc.1\n",
+	})
+	gomod := "module example.com/app\n\ngo 1.22\n\nrequire (\n\tgithub.com/sirupsen/logrus v1.9.3\n)\n"
+	resolver, mock := testResolver(server, map[string]string{"go.mod": gomod})
+	tidied := "module example.com/app\n\ngo 1.22\n\nrequire (\n\tgithub.com/google/uuid v1.6.0\n\tgithub.com/sirupsen/logrus v1.9.3\n)\n"
+	gosum := "github.com/google/uuid v1.6.0 h1:NIvaJDMOsjHA8n1jAhLSgzrAzy1Hgr+hNrb57e+94F0=\ngithub.com/google/uuid v1.6.0/go.mod h1:TIyPZe4MgqvfeYDBFedMoGGpEw/LqOeaOT+nhxU+yHo=\n"
+	mock.CommandOutputs["go mod tidy"] = MockCommandResult{Writes: map[string]string{"go.mod": tidied, "go.sum": gosum}}
+
+	fix, err := resolver.ResolveDependencyFix(context.Background(), &dagger.Directory{},
+		dependencyAnalysis("main.go:5:2: no required module provides package github.com/google/uuid; to add it:"))
+	require.NoError(t, err)
+	require.NotNil(t, fix)
+
+	assert.Equal(t, "Add github.com/google/uuid v1.6.0 to go.mod", fix.Description)
+	assert.Equal(t, []CodeChange{
+		{
+			FilePath:    "go.mod",
+			OldContent:  gomod,
+			NewContent:  tidied,
+			Operation:   ChangeOperationModify,
+			Explanation: "Require github.com/google/uuid v1.6.0",
+		},
+		{
+			FilePath:    "go.sum",
+			NewContent:  gosum,
+			Operation:   ChangeOperationAdd,
+			Explanation: "Regenerated with `go mod tidy`",
+		},
+	}, fix.Changes)
+	assert.Equal(t, "golang:1.22", mock.BaseImage)
+	assert.Contains(t, mock.Operations, "write:go.mod")
+}
+
+// TestResolveDependencyFixWithoutPackage tests failures the resolver cannot attribute
+func TestResolveDependencyFixWithoutPackage(t *testing.T) {
+	server := registryServer(t, nil)
+	resolver, mock := testResolver(server, map[string]string{"go.mod": "module example.com/app\n"})
+	ctx := context.Background()
+
+	fix, err := resolver.ResolveDependencyFix(ctx, &dagger.Directory{}, dependencyAnalysis("npm ERR! network timeout"))
+	require.NoError(t, err)
+	assert.Nil(t, fix)
+
+	fix, err = resolver.ResolveDependencyFix(ctx, &dagger.Directory{}, dependencyAnalysis("No matching version found for lodash@^9.0.0"))
+	require.NoError(t, err)
+	assert.Nil(t, fix, "the repository has no package.json")
+
+	_, err = resolver.ResolveDependencyFix(ctx, &dagger.Directory{}, dependencyAnalysis("no required module provides package github.com/acme/missing"))
+	assert.ErrorContains(t, err, "no module provides package github.com/acme/missing")
+	assert.Empty(t, mock.ExecHistory)
+
+	_, err = resolver.ResolveDependencyFix(ctx, nil, dependencyAnalysis())
+	assert.Error(t, err)
+}
+
+// TestLatestCompatibleVersion tests choosing a version for a constraint
+func TestLatestCompatibleVersion(t *testing.T) {
+	versions := []string{"0.9.1", "0.10.0", "0.10.3", "1.2.0", "1.10.0", "2.0.0-rc.1", "2.0.0", "2.1.0b1"}
+	tests := []struct {
+		constraint string
+		expected   string
+	}{
+		{"^1.3.0", "1.10.0"},
+		{"1.x", "1.10.0"},
+		{"~0.10.1", "0.10.3"},
+		{">=2.0,<3", "2.0.0"},
+		{"", "2.0.0"},
+		{"*", "2.0.0"},
+		{"^7.0.0", ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, latestCompatibleVersion(versions, tt.constraint), tt.constraint)
+	}
+	assert.Equal(t, "v1.6.0", latestCompatibleVersion([]string{"v1.5.0", "v1.6.0", "v1.7.0-rc.1"}, "v1.5.0"))
+	assert.Equal(t, "2.31.0", latestCompatibleVersion([]string{"2.30.0.post1", "2.31.0", "2.32.0.dev1"}, "==2.28.0"))
+}
+
+// TestDependencyManifestUpdates tests the manifest edits of the ecosystems
+func TestDependencyManifestUpdates(t *testing.T) {
+	t.Run("PackageJSONAdd", func(t *testing.T) {
+		updated, err := updatePackageJSON("{\n  \"name\": \"web\",\n  \"dependencies\": {\n    \"express\": \"^4.18.2\"\n  }\n}\n", "lodash", "4.17.21")
+		require.NoError(t, err)
+		assert.Equal(t, "{\n  \"name\": \"web\",\n  \"dependencies\": {\n    \"lodash\": \"^4.17.21\",\n    \"express\": \"^4.18.2\"\n  }\n}\n", updated)
+
+		updated, err = updatePackageJSON(`{"name": "web"}`, "@types/node", "20.11.5")
+		require.NoError(t, err)
+		assert.Equal(t, "^20.11.5", npmCurrentVersion(updated, "@types/node"))
+	})
+
+	t.Run("PackageJSONDevDependency", func(t *testing.T) {
+		updated, err := updatePackageJSON(`{"devDependencies": {"jest": "^30.0.0"}}`, "jest", "29.7.0")
+		require.NoError(t, err)
+		assert.Equal(t, `{"devDependencies": {"jest": "^29.7.0"}}`, updated)
+	})
+
+	t.Run("GoModSingleRequire", func(t *testing.T) {
+		updated, err := updateGoMod("module app\n\nrequire github.com/pkg/errors v0.8.0 // indirect\n", "github.com/pkg/errors", "v0.9.1")
+		require.NoError(t, err)
+		assert.Equal(t, "module app\n\nrequire github.com/pkg/errors v0.9.1 // indirect\n", updated)
+		assert.Equal(t, "v0.9.1", goModCurrentVersion(updated, "github.com/pkg/errors"))
+
+		updated, err = updateGoMod("module app\n\ngo 1.22\n", "github.com/pkg/errors", "v0.9.1")
+		require.NoError(t, err)
+		assert.Equal(t, "module app\n\ngo 1.22\n\nrequire github.com/pkg/errors v0.9.1\n", updated)
+	})
+
+	t.Run("Requirements", func(t *testing.T) {
+		requirements := "flask==2.0.1\nRequests[socks]>=2.20  # http\n"
+		updated, err := updateRequirements(requirements, "requests", "2.31.0")
+		require.NoError(t, err)
+		assert.Equal(t, "flask==2.0.1\nRequests[socks]==2.31.0 # http\n", updated)
+		assert.Equal(t, ">=2.20", requirementsCurrentVersion(requirements, "requests"))
+
+		updated, err = updateRequirements("flask==2.0.1", "PyYAML", "6.0.1")
+		require.NoError(t, err)
+		assert.Equal(t, "flask==2.0.1\nPyYAML==6.0.1\n", updated)
+	})
+
+	t.Run("CargoToml", func(t *testing.T) {
+		manifest := "[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\nserde = { version = \"9.0\", features = [\"derive\"] }\nrand = \"0.7\"\n"
+		assert.Equal(t, "9.0", cargoCurrentVersion(manifest, "serde"))
+		assert.Equal(t, "", cargoCurrentVersion(manifest, "app"), "package fields are not dependencies")
+
+		updated, err := updateCargoToml(manifest, "serde", "1.0.197")
+		require.NoError(t, err)
+		updated, err = updateCargoToml(updated, "rand", "0.8.5")
+		require.NoError(t, err)
+		updated, err = updateCargoToml(updated, "anyhow", "1.0.81")
+		require.NoError(t, err)
+		assert.Equal(t, "[package]\nname = \"app\"\nversion = \"0.1.0\"\n\n[dependencies]\nanyhow = \"1.0.81\"\nserde = { version = \"1.0.197\", features = [\"derive\"] }\nrand = \"0.8.5\"\n", updated)
+	})
+
+	assert.Equal(t, "github.com/!burnt!sushi/toml", escapeModulePath("github.com/BurntSushi/toml"))
+	assert.Equal(t, "@scope/pkg", npmPackageName("@scope/pkg/lib/index.js"))
+	assert.Equal(t, "lodash", npmPackageName("lodash/fp"))
+}
+
+type mockDependencyFixer struct {
+	resolveFunc func(ctx context.Context, source *dagger.Directory, analysis *FailureAnalysisResult) (*ProposedFix, error)
+}
+
+func (m *mockDependencyFixer) ResolveDependencyFix(ctx context.Context, source *dagger.Directory, analysis *FailureAnalysisResult) (*ProposedFix, error) {
+	return m.resolveFunc(ctx, source, analysis)
+}
+
+// TestAutoFixPrefersResolvedDependencyFix tests that AutoFix validates the resolved version
+// bump ahead of the generated fixes and still opens a PR when fix generation fails
+func TestAutoFixPrefersResolvedDependencyFix(t *testing.T) {
+	resolved := &ProposedFix{
+		ID:          "a1-dependency",
+		Type:        DependencyFix,
+		Description: "Bump lodash to 4.17.21 in package.json",
+		Confidence:  dependencyFixConfidence,
+		Changes:     []CodeChange{{FilePath: "package.json", NewContent: `{"dependencies": {"lodash": "^4.17.21"}}`, Operation: ChangeOperationModify}},
+	}
+
+	setup := func(generateErr error) (*DaggerAutofix, *[]*FixValidationResult) {
+		var prFixes []*FixValidationResult
+		m := fixtureAutofix(&prFixes)
+		fe := m.failureEngine.(*mockFailureAnalysisEngine)
+		fe.analyzeFunc = func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+			return &FailureAnalysisResult{ID: "a1", Classification: FailureClassification{Type: DependencyFailure}, Context: fc}, nil
+		}
+		if generateErr != nil {
+			fe.generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+				return nil, generateErr
+			}
+		}
+		m.dependencies = &mockDependencyFixer{resolveFunc: func(ctx context.Context, source *dagger.Directory, analysis *FailureAnalysisResult) (*ProposedFix, error) {
+			return resolved, nil
+		}}
+		return m, &prFixes
+	}
+
+	t.Run("WithGeneratedFixes", func(t *testing.T) {
+		m, prFixes := setup(nil)
+		result, err := m.AutoFix(context.Background(), 1)
+		require.NoError(t, err)
+		require.Len(t, *prFixes, 1)
+		assert.Equal(t, "a1-dependency", (*prFixes)[0].Fix.ID)
+		assert.Equal(t, DependencyFix, result.Fix.Fix.Type)
+	})
+
+	t.Run("GenerationFailed", func(t *testing.T) {
+		m, prFixes := setup(errors.New("LLM unavailable"))
+		_, err := m.AutoFix(context.Background(), 1)
+		require.NoError(t, err)
+		require.Len(t, *prFixes, 1)
+		assert.Equal(t, "a1-dependency", (*prFixes)[0].Fix.ID)
+	})
+
+	t.Run("NotADependencyFailure", func(t *testing.T) {
+		var prFixes []*FixValidationResult
+		m := fixtureAutofix(&prFixes)
+		m.dependencies = &mockDependencyFixer{resolveFunc: func(ctx context.Context, source *dagger.Directory, analysis *FailureAnalysisResult) (*ProposedFix, error) {
+			t.Fatal("the resolver only runs for dependency failures")
+			return nil, nil
+		}}
+		_, err := m.AutoFix(context.Background(), 1)
+		require.NoError(t, err)
+		require.Len(t, prFixes, 1)
+		assert.NotEqual(t, DependencyFix, prFixes[0].Fix.Type)
+	})
+}
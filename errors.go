@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tosin2013/dagger-autofix/pkg/autofix"
+)
+
+// Errors returned for invalid input to the public methods and the CLI. They are wrapped with
+// the offending value, so check them with errors.Is.
+var (
+	// ErrInvalidRunID is returned for workflow run IDs that are not positive numbers
+	ErrInvalidRunID = errors.New("invalid workflow run ID")
+	// ErrInvalidPRNumber is returned for pull request numbers that are not positive numbers
+	ErrInvalidPRNumber = errors.New("invalid pull request number")
+	// ErrInvalidRepo is returned for repository owners and names GitHub does not allow
+	ErrInvalidRepo = errors.New("invalid repository")
+	// ErrRunRepositoryMismatch is returned for run URLs of a repository or GitHub host the
+	// agent is not configured for
+	ErrRunRepositoryMismatch = errors.New("workflow run belongs to another repository")
+	// ErrInvalidBranch is returned for branch names git does not accept as a ref
+	ErrInvalidBranch = errors.New("invalid branch name")
+	// ErrInvalidLog is returned for log text AnalyzeLogText cannot analyze
+	ErrInvalidLog = autofix.ErrInvalidLog
+)
+
+// Errors returned when an operation fails. They wrap the underlying cause, so errors.As still
+// finds e.g. a *github.ErrorResponse.
+var (
+	// ErrNotInitialized is returned by methods that need Initialize to have been called
+	ErrNotInitialized = errors.New("module not initialized, call Initialize first")
+	// ErrGitHubAuth is returned when GitHub rejects the token or it lacks a permission
+	ErrGitHubAuth = errors.New("GitHub authentication failed")
+	// ErrGitHubNotFound is returned when a repository, run, branch or pull request does not
+	// exist or the token cannot see it
+	ErrGitHubNotFound = errors.New("GitHub resource not found")
+	// ErrLLMAuth is returned when the LLM provider rejects the API key
+	ErrLLMAuth = errors.New("LLM authentication failed")
+	// ErrLLMRateLimited is returned when the LLM provider rate limits or exhausts the quota
+	ErrLLMRateLimited = errors.New("LLM rate limit exceeded")
+	// ErrLLMTimeout is returned when an LLM request runs past its context deadline or the
+	// configured request timeout
+	ErrLLMTimeout = errors.New("LLM request timed out")
+	// ErrLLMInvalidResponse is returned for LLM responses that cannot be parsed
+	ErrLLMInvalidResponse = errors.New("invalid LLM response")
+	// ErrLLMContentFiltered is returned when the LLM provider blocks the prompt or the response
+	// with its safety or content filters
+	ErrLLMContentFiltered = errors.New("LLM response blocked by content filter")
+	// ErrNoValidFixes is returned when no proposed fix passed validation
+	ErrNoValidFixes = errors.New("no valid fixes")
+	// ErrCoverageBelowMinimum is returned when tests pass but coverage misses the threshold
+	ErrCoverageBelowMinimum = errors.New("coverage below minimum")
+	// ErrLogsUnavailable is returned when the logs of a workflow run expired or were deleted
+	ErrLogsUnavailable = errors.New("workflow logs unavailable")
+)
+
+// CoverageError reports tests that passed with too little coverage. errors.Is matches it with
+// ErrCoverageBelowMinimum.
+type CoverageError struct {
+	Coverage    float64 // percent
+	Minimum     float64 // percent
+	NotMeasured bool    // coverage is required but could not be measured
+}
+
+func (e *CoverageError) Error() string {
+	if e.NotMeasured {
+		return fmt.Sprintf("coverage was not measured but is required (minimum %.2f%%)", e.Minimum)
+	}
+	return fmt.Sprintf("coverage %.2f%% is below minimum required %.2f%%", e.Coverage, e.Minimum)
+}
+
+func (e *CoverageError) Unwrap() error {
+	return ErrCoverageBelowMinimum
+}
+
+// LogsUnavailableError reports a workflow run whose job logs GitHub no longer serves.
+// errors.Is matches it with ErrLogsUnavailable.
+type LogsUnavailableError struct {
+	RunID  int64
+	Status int // HTTP status of the job log requests, 404 or 410
+	// ExpiredAt is when the logs expired under the default retention, zero when they were
+	// deleted before that or the run's completion time is unknown
+	ExpiredAt time.Time
+}
+
+func (e *LogsUnavailableError) Error() string {
+	if !e.ExpiredAt.IsZero() {
+		return fmt.Sprintf("logs for run %d expired on %s", e.RunID, e.ExpiredAt.Format("2006-01-02"))
+	}
+	return fmt.Sprintf("logs for run %d were deleted or have expired", e.RunID)
+}
+
+func (e *LogsUnavailableError) Unwrap() error {
+	return ErrLogsUnavailable
+}
+
+// ErrorCategory names the kind of an error in AutoFixResult metadata and selects the CLI
+// exit code
+type ErrorCategory string
+
+const (
+	ErrorCategoryInvalidInput       ErrorCategory = "invalid_input"
+	ErrorCategoryNotInitialized     ErrorCategory = "not_initialized"
+	ErrorCategoryGitHubAuth         ErrorCategory = "github_auth"
+	ErrorCategoryGitHubNotFound     ErrorCategory = "github_not_found"
+	ErrorCategoryLLMAuth            ErrorCategory = "llm_auth"
+	ErrorCategoryLLMRateLimited     ErrorCategory = "llm_rate_limited"
+	ErrorCategoryLLMInvalidResponse ErrorCategory = "llm_invalid_response"
+	ErrorCategoryLLMContentFiltered ErrorCategory = "llm_content_filtered"
+	ErrorCategoryCoverage           ErrorCategory = "coverage_below_minimum"
+	ErrorCategoryNoValidFixes       ErrorCategory = "no_valid_fixes"
+	ErrorCategoryTimeout            ErrorCategory = "timeout"
+	ErrorCategoryOther              ErrorCategory = "other"
+)
+
+// errorCategories maps the errors above to their category. An error can wrap several of them,
+// e.g. no valid fixes because GitHub rejected the token, so the causes that need the user's
+// action come first.
+var errorCategories = []struct {
+	err      error
+	category ErrorCategory
+}{
+	{ErrInvalidRunID, ErrorCategoryInvalidInput},
+	{ErrInvalidPRNumber, ErrorCategoryInvalidInput},
+	{ErrInvalidRepo, ErrorCategoryInvalidInput},
+	{ErrRunRepositoryMismatch, ErrorCategoryInvalidInput},
+	{ErrInvalidBranch, ErrorCategoryInvalidInput},
+	{ErrInvalidLog, ErrorCategoryInvalidInput},
+	{ErrNotInitialized, ErrorCategoryNotInitialized},
+	{ErrGitHubAuth, ErrorCategoryGitHubAuth},
+	{ErrLLMAuth, ErrorCategoryLLMAuth},
+	{ErrLLMRateLimited, ErrorCategoryLLMRateLimited},
+	{ErrLLMContentFiltered, ErrorCategoryLLMContentFiltered},
+	{ErrGitHubNotFound, ErrorCategoryGitHubNotFound},
+	{ErrLLMInvalidResponse, ErrorCategoryLLMInvalidResponse},
+	{ErrLLMTimeout, ErrorCategoryTimeout},
+	{ErrCoverageBelowMinimum, ErrorCategoryCoverage},
+	{ErrNoValidFixes, ErrorCategoryNoValidFixes},
+}
+
+// errorCategory returns the category of err, ErrorCategoryOther for errors outside the
+// taxonomy and "" for nil
+func errorCategory(err error) ErrorCategory {
+	if err == nil {
+		return ""
+	}
+	for _, c := range errorCategories {
+		if errors.Is(err, c.err) {
+			return c.category
+		}
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorCategoryTimeout
+	}
+	return ErrorCategoryOther
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestErrorCategory tests categorizing errors wrapped by several layers
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorCategory
+	}{
+		{nil, ""},
+		{errors.New("boom"), ErrorCategoryOther},
+		{fmt.Errorf("auto-fix failed: %w", ErrNotInitialized), ErrorCategoryNotInitialized},
+		{fmt.Errorf("failed to initialize agent: %w", validateRunID(0)), ErrorCategoryInvalidInput},
+		{fmt.Errorf("failure analysis failed: %w", fmt.Errorf("%w: %w", ErrGitHubNotFound, errors.New("404"))), ErrorCategoryGitHubNotFound},
+		{fmt.Errorf("fix generation failed: %w", fmt.Errorf("%w: API error 429", ErrLLMRateLimited)), ErrorCategoryLLMRateLimited},
+		{fmt.Errorf("fix generation failed: %w", fmt.Errorf("%w: gemini stopped with SAFETY", ErrLLMContentFiltered)), ErrorCategoryLLMContentFiltered},
+		{fmt.Errorf("%w: no fix passed validation: %w", ErrNoValidFixes, &CoverageError{Coverage: 50, Minimum: 80}), ErrorCategoryCoverage},
+		{fmt.Errorf("%w generated: %w", ErrNoValidFixes, errors.Join(errors.New("tests failed"), fmt.Errorf("%w: 401", ErrGitHubAuth))), ErrorCategoryGitHubAuth},
+		{fmt.Errorf("%w generated", ErrNoValidFixes), ErrorCategoryNoValidFixes},
+		{fmt.Errorf("fix timed out: %w", context.DeadlineExceeded), ErrorCategoryTimeout},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, errorCategory(tt.err), "%v", tt.err)
+	}
+}
+
+// TestGitHubErrorsWrapSentinels tests that GitHub responses keep their *github.ErrorResponse
+// and match the sentinels up to AutoFix and the CLI exit code
+func TestGitHubErrorsWrapSentinels(t *testing.T) {
+	g, mux := newMockGitHubAPI(t)
+	mux.HandleFunc("/repos/owner/repo/actions/runs/1", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"message": "Bad credentials"}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/2", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "Not Found"}`)
+	})
+	ctx := context.Background()
+
+	_, err := g.GetWorkflowRun(ctx, 1)
+	assert.ErrorIs(t, err, ErrGitHubAuth)
+	var errResp *github.ErrorResponse
+	require.ErrorAs(t, err, &errResp)
+	assert.Equal(t, http.StatusUnauthorized, errResp.Response.StatusCode)
+
+	_, err = g.GetWorkflowRun(ctx, 2)
+	assert.ErrorIs(t, err, ErrGitHubNotFound)
+	assert.NotErrorIs(t, err, ErrGitHubAuth)
+
+	m := fixtureAutofix(nil)
+	m.githubClient = g
+	result, err := m.AutoFix(ctx, 2)
+	assert.ErrorIs(t, err, ErrGitHubNotFound)
+	require.NotNil(t, result)
+	assert.False(t, result.Success)
+	assert.Equal(t, "github_not_found", result.Metadata["error_category"])
+	assert.Equal(t, exitGitHubNotFound, exitCode(fmt.Errorf("auto-fix failed: %w", err)))
+}
+
+// TestLLMErrorsWrapSentinels tests classifying provider errors and unparsable responses
+// through the failure analysis engine
+func TestLLMErrorsWrapSentinels(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		{"rejected key", http.StatusUnauthorized, `{"error": {"message": "Incorrect API key"}}`, ErrLLMAuth},
+		{"rate limited", http.StatusTooManyRequests, `{"error": {"message": "Rate limit reached"}}`, ErrLLMRateLimited},
+		{"not json", http.StatusOK, `<html>proxy error</html>`, ErrLLMInvalidResponse},
+		{"no choices", http.StatusOK, `{"choices": []}`, ErrLLMInvalidResponse},
+		{"content filtered", http.StatusOK, `{"choices": [{"message": {"content": null}, "finish_reason": "content_filter"}]}`, ErrLLMContentFiltered},
+		{"not an analysis", http.StatusOK, `{"choices": [{"message": {"content": ""}, "finish_reason": "stop"}]}`, ErrLLMInvalidResponse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			engine := NewFailureAnalysisEngine(createTestClient(OpenAI, server.URL), quietLogger())
+			_, err := engine.AnalyzeFailure(context.Background(), FailureContext{
+				WorkflowRun: &WorkflowRun{ID: 1},
+				Logs:        &WorkflowLogs{ErrorLines: []string{"go build failed"}},
+			})
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+// TestAutoFixCoverageBelowMinimum tests that fixes whose tests pass with too little coverage
+// report the coverage, not just that no fix was valid
+func TestAutoFixCoverageBelowMinimum(t *testing.T) {
+	var prFixes []*FixValidationResult
+	m := fixtureAutofix(&prFixes)
+	m.MinCoverage = 95
+
+	result, err := m.AutoFix(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrNoValidFixes)
+	assert.ErrorIs(t, err, ErrCoverageBelowMinimum)
+	var coverageErr *CoverageError
+	require.ErrorAs(t, err, &coverageErr)
+	assert.Equal(t, 90.0, coverageErr.Coverage)
+	assert.Equal(t, 95.0, coverageErr.Minimum)
+	assert.EqualError(t, err, "no valid fixes: no fix passed validation: coverage 90.00% is below minimum required 95.00%")
+
+	require.NotNil(t, result)
+	assert.Equal(t, "coverage_below_minimum", result.Metadata["error_category"])
+	assert.Equal(t, "a1", result.Analysis.ID)
+	assert.Empty(t, prFixes)
+	assert.Equal(t, exitCoverage, exitCode(err))
+	assert.Contains(t, errorHint(err), "--min-coverage")
+}
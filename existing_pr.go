@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Ways FixExistingPR proposes a fix on the pull request
+const (
+	ExistingPRPushed    = "pushed"    // the fix was pushed to the pull request's branch
+	ExistingPRSuggested = "suggested" // the branch is in a fork, so the fix was commented
+)
+
+// errNoFailedPRRun is returned by FixExistingPR for pull requests without a failed run to fix
+var errNoFailedPRRun = errors.New("no failed workflow run at the head commit")
+
+// existingPRContextKey carries the pull request a fix is for through the fix pipeline
+type existingPRContextKey struct{}
+
+// withExistingPR makes the fix of ctx finish pr rather than open a pull request of its own
+func withExistingPR(ctx context.Context, pr *PullRequest) context.Context {
+	return context.WithValue(ctx, existingPRContextKey{}, pr)
+}
+
+// existingPR returns the pull request the fix of ctx finishes, nil for other fixes
+func existingPR(ctx context.Context) *PullRequest {
+	pr, _ := ctx.Value(existingPRContextKey{}).(*PullRequest)
+	return pr
+}
+
+// FixExistingPR helps finish an open pull request whose CI fails instead of opening a
+// competing one. It fixes the latest failed workflow run at the pull request's head commit,
+// validating the fixes on top of the pull request's branch, and pushes the best fix to that
+// branch as a new commit. Branches of forks cannot be pushed to, so their fix is proposed as a
+// suggestion comment instead. Either way the pull request gets a comment with the changes and
+// their validation. Dry runs stop before changing the pull request.
+func (m *DaggerAutofix) FixExistingPR(ctx context.Context, prNumber int) (*AutoFixResult, error) {
+	if err := validatePRNumber(prNumber); err != nil {
+		return nil, err
+	}
+	if err := m.ensureInitialized(); err != nil {
+		return nil, err
+	}
+
+	pr, err := m.githubClient.GetPullRequest(ctx, prNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull request #%d: %w", prNumber, err)
+	}
+	if pr.State != "open" {
+		return nil, fmt.Errorf("pull request #%d is %s, not open", prNumber, valueOr(pr.State, "unknown"))
+	}
+	if pr.Branch == "" || pr.CommitSHA == "" {
+		return nil, fmt.Errorf("pull request #%d has no head branch", prNumber)
+	}
+
+	run, err := m.latestFailedPRRun(ctx, pr)
+	if err != nil {
+		return nil, err
+	}
+	if run == nil {
+		return nil, fmt.Errorf("pull request #%d has %w %s", prNumber, errNoFailedPRRun, shortSHA(pr.CommitSHA))
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"pr_number": prNumber,
+		"branch":    pr.Branch,
+		"fork":      pr.Fork,
+		"run_id":    run.ID,
+		"workflow":  run.Name,
+	}).Info("Fixing the failed workflow run of the pull request")
+	return m.AutoFix(withExistingPR(ctx, pr), run.ID)
+}
+
+// latestFailedPRRun returns the most recent failed workflow run at the head commit of pr, nil
+// when none failed
+func (m *DaggerAutofix) latestFailedPRRun(ctx context.Context, pr *PullRequest) (*WorkflowRun, error) {
+	runs, err := m.githubClient.GetCommitWorkflowRuns(ctx, pr.Branch, pr.CommitSHA, time.Time{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the workflow runs of pull request #%d: %w", pr.Number, err)
+	}
+	var latest *WorkflowRun
+	for _, run := range runs {
+		failed := run.Conclusion == "failure" || (m.IncludeTimedOutRuns && run.Conclusion == "timed_out")
+		if run.Status != "completed" || !failed {
+			continue
+		}
+		if latest == nil || run.CreatedAt.After(latest.CreatedAt) {
+			latest = run
+		}
+	}
+	return latest, nil
+}
+
+// runFixTestsOnPR tests a fix on a test branch holding the fix on top of the head commit of
+// the pull request it finishes. For branches in this repository the test branch is created
+// from the pull request's branch first, which the MCP server needs to commit onto it.
+func (m *DaggerAutofix) runFixTestsOnPR(ctx context.Context, fix *ProposedFix, index int, pr *PullRequest) (*TestResult, error) {
+	testBranch := testBranchName(fix, index)
+	if err := validateBranchName(testBranch); err != nil {
+		return nil, err
+	}
+	if !pr.Fork {
+		if err := m.githubClient.CreateBranch(ctx, testBranch, pr.Branch); err != nil {
+			return nil, fmt.Errorf("failed to create test branch: %w", err)
+		}
+	}
+	// Registered so shutdown deletes the branch when the fix does not finish in time
+	m.testBranches.add(testBranch, func() {
+		cleanupCtx, cancel := cleanupContext(ctx)
+		defer cancel()
+		if err := m.githubClient.DeleteBranch(cleanupCtx, testBranch); err != nil {
+			m.logger.WithError(err).Warnf("Failed to delete test branch %s", testBranch)
+			return
+		}
+		audit(ctx, AuditBranchDeleted, map[string]interface{}{"branch": testBranch})
+	})
+	defer m.testBranches.release(testBranch)
+
+	if _, err := m.githubClient.CommitChanges(ctx, testBranch, pr.CommitSHA, fix.Changes, "Validate fix "+fix.ID); err != nil {
+		return nil, fmt.Errorf("failed to create test branch: %w", err)
+	}
+	audit(ctx, AuditBranchCreated, map[string]interface{}{"branch": testBranch, "purpose": "validation"})
+	audit(ctx, AuditFilesModified, map[string]interface{}{"branch": testBranch, "fix_id": fix.ID, "files": auditChanges(fix.Changes)})
+
+	testResult, err := m.testEngine.RunTests(ctx, m.RepoOwner, m.RepoName, testBranch, fix.Validation...)
+	if err != nil {
+		return nil, fmt.Errorf("test execution failed: %w", err)
+	}
+	return testResult, nil
+}
+
+// pushFixToPR proposes a validated fix on the pull request it finishes and returns how: it
+// is pushed to the pull request's branch as a new commit with a comment on what changed, or
+// for branches in forks, commented as for failed pull_request runs. The pushed commit
+// follows the commit the failed run tested, so it is rejected when the branch moved since.
+func (m *DaggerAutofix) pushFixToPR(ctx context.Context, pr *PullRequest, analysis *FailureAnalysisResult, fix *FixValidationResult) (string, string, error) {
+	logger := m.logger.WithFields(logrus.Fields{"pr_number": pr.Number, "fix_id": fix.Fix.ID})
+	if pr.Fork {
+		analysis.Context.PRNumber = pr.Number
+		if _, err := m.commentFixOnPR(ctx, analysis, fix); err != nil {
+			return "", "", err
+		}
+		logger.Info("Pull request branch is in a fork, suggested the fix instead of pushing it")
+		return ExistingPRSuggested, "", nil
+	}
+
+	sha, err := m.githubClient.CommitChanges(ctx, pr.Branch, pr.CommitSHA, fix.Fix.Changes, m.fixCommitMessage(analysis, fix.Fix))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to push the fix to %s: %w", pr.Branch, err)
+	}
+	audit(ctx, AuditFilesModified, map[string]interface{}{"branch": pr.Branch, "fix_id": fix.Fix.ID, "files": auditChanges(fix.Fix.Changes), "commit_sha": sha})
+	logger.WithField("commit_sha", sha).Info("Pushed the fix to the pull request branch")
+
+	// The fix is pushed already, so failing to describe it does not fail the fix
+	if err := m.githubClient.AddPullRequestComment(ctx, pr.Number, formatPushedFixComment(analysis, fix, pr.Branch, sha, m.settings(ctx).MinCoverage)); err != nil {
+		logger.WithError(err).Warn("Failed to comment the pushed fix on the pull request")
+	}
+	return ExistingPRPushed, sha, nil
+}
+
+// fixCommitMessage renders the commit message of a fix with the configured template, falling
+// back to the default template when it fails
+func (m *DaggerAutofix) fixCommitMessage(analysis *FailureAnalysisResult, fix *ProposedFix) string {
+	message, err := renderCommitMessage(m.CommitTemplate, analysis, fix)
+	if err == nil {
+		return message
+	}
+	m.logger.WithError(err).Warn("Failed to render commit message, using the default template")
+	message, _ = renderCommitMessage(DefaultCommitTemplate, analysis, fix)
+	return message
+}
+
+// formatPushedFixComment renders the comment on a pull request a fix was pushed to as the
+// commit sha on branch
+func formatPushedFixComment(analysis *FailureAnalysisResult, fix *FixValidationResult, branch, sha string, minCoverage int) string {
+	intro := fmt.Sprintf("The workflow run failed on this pull request, so commit %s with a validated fix was pushed to `%s`. "+
+		"Here is what the analysis found and what the commit changes.", shortSHA(sha), branch)
+	return formatFixComment("Automated Fix Pushed", intro, analysis, fix, nil, minCoverage)
+}
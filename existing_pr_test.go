@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pushedCommit is a CommitChanges call of the mocked GitHub client
+type pushedCommit struct {
+	branch, parent, message string
+	changes                 []CodeChange
+}
+
+// existingPRAutofix returns an agent serving open pull request #42, whose branch fix-parser
+// is in a fork when fork is set and whose head commit head123 failed run 7. It records the
+// commits made, the branches tested and the pull request comments.
+func existingPRAutofix(fork bool) (m *DaggerAutofix, gh *mockGitHub, commits *[]pushedCommit, tested *[]string, comments *[]string) {
+	commits, tested, comments = new([]pushedCommit), new([]string), new([]string)
+	m = fixtureAutofix(nil)
+	gh = m.githubClient.(*mockGitHub)
+	gh.getPullRequestFunc = func(ctx context.Context, number int) (*PullRequest, error) {
+		return &PullRequest{Number: number, State: "open", Branch: "fix-parser", CommitSHA: "head123", Fork: fork}, nil
+	}
+	now := time.Now()
+	gh.getCommitRunsFunc = func(ctx context.Context, branch, sha string, since time.Time) ([]*WorkflowRun, error) {
+		if branch != "fix-parser" || sha != "head123" {
+			return nil, nil
+		}
+		return []*WorkflowRun{
+			{ID: 5, Status: "completed", Conclusion: "failure", CreatedAt: now.Add(-time.Hour)},
+			{ID: 6, Status: "completed", Conclusion: "success", CreatedAt: now.Add(time.Minute)},
+			{ID: 7, Status: "completed", Conclusion: "failure", CreatedAt: now},
+		}, nil
+	}
+	gh.getWorkflowRunFunc = func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+		return &WorkflowRun{ID: runID, Branch: "fix-parser", CommitSHA: "head123", Event: pullRequestEvent}, nil
+	}
+	var mu sync.Mutex
+	gh.commitChangesFunc = func(ctx context.Context, branch, parentSHA string, changes []CodeChange, message string) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		*commits = append(*commits, pushedCommit{branch: branch, parent: parentSHA, message: message, changes: changes})
+		return "fixed4567890", nil
+	}
+	gh.addPullRequestCommentFunc = func(ctx context.Context, number int, body string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		*comments = append(*comments, body)
+		return nil
+	}
+	m.testEngine.(*mockTestEngine).runTestsFunc = func(ctx context.Context, owner, repo, branch string) (*TestResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		*tested = append(*tested, branch)
+		return &TestResult{Success: true, Coverage: 90}, nil
+	}
+	m.prEngine.(*mockPullRequestEngine).createWithOptionsFunc = func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error) {
+		return nil, errors.New("no pull request may be opened for an existing one")
+	}
+	return m, gh, commits, tested, comments
+}
+
+// TestFixExistingPR tests finishing a failing pull request by pushing the fix to its branch,
+// and suggesting it on pull requests from forks
+func TestFixExistingPR(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("PushesToBranch", func(t *testing.T) {
+		m, gh, commits, tested, comments := existingPRAutofix(false)
+
+		result, err := m.FixExistingPR(ctx, 42)
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+		assert.Equal(t, int64(7), result.RunID, "the latest failed run at the head commit is fixed")
+		assert.Equal(t, 42, result.PullRequest.Number)
+		assert.Equal(t, ExistingPRPushed, result.Metadata["pr_update"])
+		assert.Equal(t, "fixed4567890", result.Metadata["commit_sha"])
+
+		// The fix is validated on top of the pull request, then pushed onto its head commit
+		require.Len(t, *commits, 2)
+		testBranch := (*commits)[0].branch
+		assert.True(t, strings.HasPrefix(testBranch, testBranchPrefix))
+		assert.Equal(t, "head123", (*commits)[0].parent)
+		assert.Equal(t, []string{testBranch}, *tested)
+		assert.Contains(t, gh.calls, "CreateBranch")
+		assert.Contains(t, gh.calls, "DeleteBranch")
+
+		pushed := (*commits)[1]
+		assert.Equal(t, "fix-parser", pushed.branch)
+		assert.Equal(t, "head123", pushed.parent)
+		assert.Equal(t, "parser/parser.go", pushed.changes[0].FilePath)
+		assert.NotEmpty(t, pushed.message)
+
+		require.Len(t, *comments, 1)
+		assert.Contains(t, (*comments)[0], "Automated Fix Pushed")
+		assert.Contains(t, (*comments)[0], "commit fixed456 with a validated fix was pushed to `fix-parser`")
+		assert.Contains(t, (*comments)[0], "parser/parser.go")
+	})
+
+	t.Run("ForkFallsBackToSuggestion", func(t *testing.T) {
+		m, gh, commits, tested, comments := existingPRAutofix(true)
+
+		result, err := m.FixExistingPR(ctx, 42)
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+		assert.Equal(t, ExistingPRSuggested, result.Metadata["pr_update"])
+		assert.NotContains(t, result.Metadata, "commit_sha")
+
+		// Only the test branch is committed; the fork's branch is left alone
+		require.Len(t, *commits, 1)
+		assert.Equal(t, []string{(*commits)[0].branch}, *tested)
+		assert.NotContains(t, gh.calls, "CreateBranch", "the fork's branch is not in the repository")
+
+		require.Len(t, *comments, 1)
+		assert.Contains(t, (*comments)[0], "Automated Fix Suggestion")
+	})
+
+	t.Run("DryRunLeavesPRAlone", func(t *testing.T) {
+		m, _, commits, _, comments := existingPRAutofix(false)
+
+		result, err := m.WithDryRun(true).FixExistingPR(ctx, 42)
+		require.NoError(t, err)
+		assert.Equal(t, "fix-parser", result.Metadata["branch_name"])
+		assert.Len(t, *commits, 1, "only the test branch is committed")
+		assert.Empty(t, *comments)
+	})
+
+	t.Run("NoFailedRun", func(t *testing.T) {
+		m, gh, _, _, _ := existingPRAutofix(false)
+		gh.getCommitRunsFunc = func(ctx context.Context, branch, sha string, since time.Time) ([]*WorkflowRun, error) {
+			return []*WorkflowRun{{ID: 6, Status: "completed", Conclusion: "success"}}, nil
+		}
+
+		_, err := m.FixExistingPR(ctx, 42)
+		assert.ErrorIs(t, err, errNoFailedPRRun)
+		assert.Equal(t, exitNothingToFix, exitCode(nothingToFix{err}))
+	})
+
+	t.Run("ClosedPR", func(t *testing.T) {
+		m, gh, _, _, _ := existingPRAutofix(false)
+		gh.getPullRequestFunc = func(ctx context.Context, number int) (*PullRequest, error) {
+			return &PullRequest{Number: number, State: "closed", Branch: "fix-parser", CommitSHA: "head123"}, nil
+		}
+
+		_, err := m.FixExistingPR(ctx, 42)
+		assert.EqualError(t, err, "pull request #42 is closed, not open")
+		_, err = m.FixExistingPR(ctx, 0)
+		assert.ErrorIs(t, err, ErrInvalidPRNumber)
+	})
+}
+
+// TestConvertPullRequestFork tests telling pull requests from forks by their head repository
+func TestConvertPullRequestFork(t *testing.T) {
+	branch := func(repo string) *github.PullRequestBranch {
+		if repo == "" {
+			return &github.PullRequestBranch{}
+		}
+		return &github.PullRequestBranch{Repo: &github.Repository{FullName: github.String(repo)}}
+	}
+	tests := []struct {
+		name       string
+		head, base string
+		fork       bool
+	}{
+		{"same repository", "acme/widgets", "acme/widgets", false},
+		{"fork", "contributor/widgets", "acme/widgets", true},
+		{"deleted fork", "", "acme/widgets", true},
+		{"unknown base", "acme/widgets", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pr := convertPullRequest(&github.PullRequest{Head: branch(tt.head), Base: branch(tt.base)})
+			assert.Equal(t, tt.fork, pr.Fork)
+			assert.Equal(t, tt.head, pr.HeadRepository)
+		})
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/tosin2013/dagger-autofix/pkg/autofix"
 )
 
 // FailureAnalysisEngine analyzes CI/CD failures using LLM-powered intelligence
@@ -16,11 +19,38 @@ type FailureAnalysisEngine struct {
 	logger    *logrus.Logger
 	patterns  *ErrorPatternDatabase
 	prompts   *PromptTemplates
+	redactor  *Redactor
+	history   *fixHistory
+	osv       *OSVClient
+	paths     PathPolicy
+	// fixTypes drops the generated fixes of a type not allowed for the failure type
+	fixTypes FixTypeConstraints
+
+	// Models of the analysis and fix generation requests; empty uses the client's model
+	analysisModel        string
+	fixModel             string
+	escalationConfidence float64
+	// capturePrompts records every request and response in the analysis's Interactions
+	capturePrompts bool
+	// fileSource reads repository files at a commit for the fix generation prompt, which
+	// includes none without it
+	fileSource    func(ctx context.Context, path, ref string) (string, bool, error)
+	contextPolicy ContextPolicy
+	// fileClassification tells binary and generated files apart among the context files
+	fileClassification FileClassification
+	logChunking        LogChunking
 }
 
+// DefaultEscalationConfidence is the analysis confidence below which an analysis by the
+// analysis model is re-run with the fix model
+const DefaultEscalationConfidence = 0.6
+
 // ErrorPatternDatabase contains known error patterns and their solutions
 type ErrorPatternDatabase struct {
 	Patterns map[string]*ErrorPatternRule `json:"patterns"`
+
+	matcherOnce sync.Once
+	matcher     *patternMatcher
 }
 
 // ErrorPatternRule defines a rule for matching and categorizing errors
@@ -37,11 +67,20 @@ type ErrorPatternRule struct {
 
 // PromptTemplates contains templates for different types of analysis
 type PromptTemplates struct {
-	FailureAnalysis  string `json:"failure_analysis"`
-	CodeAnalysis     string `json:"code_analysis"`
-	FixGeneration    string `json:"fix_generation"`
-	TestGeneration   string `json:"test_generation"`
-	SecurityAnalysis string `json:"security_analysis"`
+	FailureAnalysis       string `json:"failure_analysis"`
+	FailureAnalysisPrompt string `json:"failure_analysis_prompt"`
+	CodeAnalysis          string `json:"code_analysis"`
+	FixGeneration         string `json:"fix_generation"`
+	FixGenerationPrompt   string `json:"fix_generation_prompt"`
+	TestGeneration        string `json:"test_generation"`
+	SecurityAnalysis      string `json:"security_analysis"`
+	LogChunkSummary       string `json:"log_chunk_summary"`
+	LogChunkSummaryPrompt string `json:"log_chunk_summary_prompt"`
+
+	// Sources maps the file name of each template loaded from a prompt directory to its path
+	Sources map[string]string `json:"sources,omitempty"`
+
+	parsed map[string]*template.Template
 }
 
 // NewFailureAnalysisEngine creates a new failure analysis engine
@@ -51,7 +90,87 @@ func NewFailureAnalysisEngine(llmClient LLMClientInterface, logger *logrus.Logge
 		logger:    logger,
 		patterns:  loadErrorPatterns(),
 		prompts:   loadPromptTemplates(),
+		osv:       NewOSVClient(defaultOSVURL),
+
+		escalationConfidence: DefaultEscalationConfidence,
+	}
+}
+
+// SetRedactor masks credentials in every prompt sent to the LLM
+func (e *FailureAnalysisEngine) SetRedactor(redactor *Redactor) {
+	e.redactor = redactor
+}
+
+// SetFixHistory makes the engine reuse the fixes previously merged for recurring failures
+func (e *FailureAnalysisEngine) SetFixHistory(history *fixHistory) {
+	e.history = history
+}
+
+// SetPathPolicy restricts the files the changes of generated fixes may touch
+func (e *FailureAnalysisEngine) SetPathPolicy(policy PathPolicy) {
+	e.paths = policy
+}
+
+// SetFixTypeConstraints restricts the types of the fixes generated for each failure type
+func (e *FailureAnalysisEngine) SetFixTypeConstraints(constraints FixTypeConstraints) {
+	e.fixTypes = constraints
+}
+
+// SetModels sets the models of the analysis and the fix generation requests, so a cheaper
+// model can analyze failures. Empty models use the client's configured model.
+func (e *FailureAnalysisEngine) SetModels(analysisModel, fixModel string) {
+	e.analysisModel = analysisModel
+	e.fixModel = fixModel
+}
+
+// SetEscalationConfidence sets the analysis confidence below which an analysis is re-run once
+// with the fix model, when it differs from the analysis model; 0 never re-runs analyses
+func (e *FailureAnalysisEngine) SetEscalationConfidence(threshold float64) {
+	e.escalationConfidence = threshold
+}
+
+// SetPromptCapture records the redacted prompts and responses of the analysis and fix
+// generation requests in the analysis, for debugging them
+func (e *FailureAnalysisEngine) SetPromptCapture(enabled bool) {
+	e.capturePrompts = enabled
+}
+
+// SetFileSource sets where the repository files included in the fix generation prompt are
+// read from; nil includes no files
+func (e *FailureAnalysisEngine) SetFileSource(source func(ctx context.Context, path, ref string) (string, bool, error)) {
+	e.fileSource = source
+}
+
+// SetContextPolicy sets which repository files the fix generation prompt includes and how
+// much of each
+func (e *FailureAnalysisEngine) SetContextPolicy(policy ContextPolicy) {
+	e.contextPolicy = policy
+}
+
+// SetFileClassification sets which files the fix generation prompt treats as binary or
+// generated, besides the built-in ones
+func (e *FailureAnalysisEngine) SetFileClassification(classification FileClassification) {
+	e.fileClassification = classification
+}
+
+// SetLogChunking sets when and how logs too long for the analysis prompt are summarized in
+// chunks
+func (e *FailureAnalysisEngine) SetLogChunking(chunking LogChunking) {
+	e.logChunking = chunking
+}
+
+// SetPromptTemplates sets the templates the analysis and fix generation prompts are rendered
+// from; nil uses the built-in templates
+func (e *FailureAnalysisEngine) SetPromptTemplates(prompts *PromptTemplates) {
+	if prompts == nil {
+		prompts = loadPromptTemplates()
 	}
+	e.prompts = prompts
+}
+
+// SetOSVClient sets the client security advisories are looked up with; nil disables the lookup
+func (e *FailureAnalysisEngine) SetOSVClient(client *OSVClient) {
+	e.osv = client
 }
 
 // AnalyzeFailure performs comprehensive failure analysis using LLM
@@ -62,38 +181,100 @@ func (e *FailureAnalysisEngine) AnalyzeFailure(ctx context.Context, failureCtx F
 	// Step 1: Pre-classify using pattern matching
 	preClassification := e.preClassifyFailure(failureCtx)
 
-	// Step 2: Prepare comprehensive context for LLM
-	analysisPrompt := e.buildAnalysisPrompt(failureCtx, preClassification)
+	// Recurring failures carry the fix that was merged for them last time
+	fingerprint := failureFingerprint(failureCtx.Logs)
+	previousFix := e.history.lookup(fingerprint)
+	if previousFix != nil {
+		e.logger.WithFields(logrus.Fields{
+			"fingerprint": fingerprint,
+			"pr_number":   previousFix.PRNumber,
+		}).Info("Similar failure was fixed before")
+	}
+
+	// Step 2: Prepare comprehensive context for LLM. Logs far beyond the prompt budget are
+	// summarized in chunks instead of losing their middle.
+	promptData := newAnalysisPromptData(failureCtx, preClassification)
+	chunkSummaries, err := e.summarizeLogChunks(ctx, failureCtx)
+	if err != nil {
+		return nil, err
+	}
+	var modelsUsed []string
+	var interactions []LLMInteraction
+	if chunkSummaries != nil {
+		promptData.Logs = ""
+		promptData.LogSummariesSection = chunkSummaries.section
+		modelsUsed = chunkSummaries.models
+		interactions = chunkSummaries.interactions
+	}
+	analysisPrompt := e.renderPrompt("failure_analysis_prompt.tmpl", promptData)
 
 	// Step 3: Analyze with LLM
 	req := &LLMRequest{
-		SystemMsg: e.prompts.FailureAnalysis,
-		Prompt:    analysisPrompt,
+		SystemMsg: e.renderSystemPrompt("failure_analysis.tmpl", promptData),
+		Prompt:    e.redactor.Redact(analysisPrompt),
 		Context: map[string]interface{}{
 			"failure_type": preClassification.Type,
 			"repository":   failureCtx.Repository,
 			"workflow_run": failureCtx.WorkflowRun,
 		},
-	}
-
-	response, err := e.llmClient.Chat(ctx, req)
-	if err != nil {
-		return nil, fmt.Errorf("LLM analysis failed: %w", err)
+		Model: e.analysisModel,
 	}
 
 	// Step 4: Parse and structure the analysis result
-	analysis, err := e.parseAnalysisResponse(response.Content, failureCtx)
+	analysis, response, err := e.requestAnalysis(ctx, req, failureCtx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse analysis response: %w", err)
+		return nil, err
+	}
+	modelsUsed = appendModel(modelsUsed, responseModel(response, req))
+	interactions = e.captureInteraction(interactions, InteractionAnalysis, req, response)
+	if chunkSummaries != nil {
+		chunkSummaries.stats.LLMCalls++
+	}
+
+	// A low confidence analysis by the analysis model gets a second opinion from the fix model
+	if e.analysisModel != e.fixModel && analysis.Classification.Confidence < e.escalationConfidence {
+		e.logger.WithFields(logrus.Fields{
+			"run_id":     failureCtx.WorkflowRun.ID,
+			"confidence": analysis.Classification.Confidence,
+			"model":      e.fixModel,
+		}).Info("Analysis confidence is low, re-running the analysis with the fix model")
+		escalated := *req
+		escalated.Model = e.fixModel
+		if chunkSummaries != nil {
+			chunkSummaries.stats.LLMCalls++
+		}
+		retried, retriedResponse, err := e.requestAnalysis(ctx, &escalated, failureCtx)
+		interactions = e.captureInteraction(interactions, InteractionEscalatedAnalysis, &escalated, retriedResponse)
+		if err != nil {
+			e.logger.WithError(err).Warn("Escalated analysis failed, keeping the first analysis")
+		} else {
+			analysis = retried
+			modelsUsed = appendModel(modelsUsed, responseModel(retriedResponse, &escalated))
+		}
 	}
 
-	// Step 5: Enhance with pattern-based insights
+	// Step 5: Enhance with pattern-based insights. The files annotations point at are
+	// affected for sure, so they come first.
 	e.enhanceWithPatterns(analysis, preClassification)
+	analysis.AffectedFiles = appendMissing(annotatedFiles(failureCtx.Logs), analysis.AffectedFiles...)
 
 	// Step 6: Finalize result
-	analysis.ID = fmt.Sprintf("analysis-%d-%d", failureCtx.WorkflowRun.ID, time.Now().Unix())
+	analysis.ID = analysisID(failureCtx.WorkflowRun.ID, fingerprint, failureCtx.Logs)
 	analysis.Context = failureCtx
 	analysis.Timestamp = time.Now()
+	analysis.Fingerprint = fingerprint
+	analysis.PreviousFix = previousFix
+	analysis.ModelsUsed = modelsUsed
+	analysis.Interactions = interactions
+	if chunkSummaries != nil {
+		if analysis.Metadata == nil {
+			analysis.Metadata = make(map[string]interface{})
+		}
+		analysis.Metadata["log_chunking"] = chunkSummaries.stats
+	}
+
+	// Security failures carry the advisories they report, with their fixed versions
+	e.enrichWithAdvisories(ctx, analysis)
 
 	// Set LLM provider if available
 	if realClient, ok := e.llmClient.(*LLMClient); ok {
@@ -118,33 +299,48 @@ func (e *FailureAnalysisEngine) AnalyzeFailure(ctx context.Context, failureCtx F
 func (e *FailureAnalysisEngine) GenerateFixes(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
 	e.logger.WithField("analysis_id", analysis.ID).Info("Generating fixes")
 
+	// The most relevant repository files show the LLM what it changes
+	files, decisions := e.selectContextFiles(ctx, analysis)
+	analysis.Context.Files = files
+	if len(decisions) > 0 {
+		if analysis.Metadata == nil {
+			analysis.Metadata = make(map[string]interface{})
+		}
+		analysis.Metadata["context_files"] = decisions
+	}
+
 	// Build fix generation prompt
-	fixPrompt := e.buildFixGenerationPrompt(analysis)
+	promptData := e.fixPromptData(analysis)
+	fixPrompt := e.renderPrompt("fix_generation_prompt.tmpl", promptData)
 
 	req := &LLMRequest{
-		SystemMsg: e.prompts.FixGeneration,
-		Prompt:    fixPrompt,
+		SystemMsg: e.renderSystemPrompt("fix_generation.tmpl", promptData),
+		Prompt:    e.redactor.Redact(fixPrompt),
 		Context: map[string]interface{}{
 			"analysis":     analysis,
 			"failure_type": analysis.Classification.Type,
 		},
+		Model: e.fixModel,
 	}
 
-	response, err := e.llmClient.Chat(ctx, req)
+	response, err := e.chat(ctx, ProgressGeneratingFixes, req)
 	if err != nil {
 		return nil, fmt.Errorf("fix generation failed: %w", err)
 	}
+	analysis.ModelsUsed = appendModel(analysis.ModelsUsed, responseModel(response, req))
+	analysis.Interactions = e.captureInteraction(analysis.Interactions, InteractionFixGeneration, req, response)
 
 	// Parse fixes from response
 	fixes, err := e.parseFixesResponse(response.Content, analysis)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse fixes response: %w", err)
+		return nil, fmt.Errorf("failed to parse fixes response: %w: %w", ErrLLMInvalidResponse, err)
 	}
 
 	// Enhance fixes with validation steps
 	for _, fix := range fixes {
 		e.addValidationSteps(fix, analysis)
 	}
+	applyFixHistoryPrior(fixes, analysis.PreviousFix)
 
 	e.logger.WithFields(logrus.Fields{
 		"analysis_id": analysis.ID,
@@ -154,42 +350,88 @@ func (e *FailureAnalysisEngine) GenerateFixes(ctx context.Context, analysis *Fai
 	return fixes, nil
 }
 
-// preClassifyFailure performs initial classification using pattern matching
-func (e *FailureAnalysisEngine) preClassifyFailure(ctx FailureContext) *FailureClassification {
-	var errorLines, allLogs string
-	if ctx.Logs != nil {
-		errorLines = strings.Join(ctx.Logs.ErrorLines, "\n")
-		allLogs = ctx.Logs.RawLogs
+// requestAnalysis asks the LLM to analyze a failure and parses the analysis. The response is
+// also returned when it could not be parsed.
+func (e *FailureAnalysisEngine) requestAnalysis(ctx context.Context, req *LLMRequest, failureCtx FailureContext) (*FailureAnalysisResult, *LLMResponse, error) {
+	response, err := e.chat(ctx, ProgressAnalyzing, req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("LLM analysis failed: %w", err)
 	}
+	analysis, err := e.parseAnalysisResponse(response.Content, failureCtx)
+	if err != nil {
+		return nil, response, fmt.Errorf("failed to parse analysis response: %w: %w", ErrLLMInvalidResponse, err)
+	}
+	return analysis, response, nil
+}
+
+// captureInteraction appends req and its response to interactions when prompt capture is
+// enabled. Everything captured is redacted again, as the system message and the response
+// never passed the redactor.
+func (e *FailureAnalysisEngine) captureInteraction(interactions []LLMInteraction, stage string, req *LLMRequest, response *LLMResponse) []LLMInteraction {
+	if !e.capturePrompts || response == nil {
+		return interactions
+	}
+	interaction := LLMInteraction{
+		Stage:     stage,
+		Model:     responseModel(response, req),
+		Provider:  response.Provider,
+		SystemMsg: e.redactor.Redact(req.SystemMsg),
+		Prompt:    e.redactor.Redact(req.Prompt),
+		Response:  e.redactor.Redact(response.Content),
+		Timestamp: time.Now(),
+	}
+	if response.Usage != nil {
+		usage := *response.Usage
+		interaction.Usage = &usage
+	}
+	return append(interactions, interaction)
+}
 
-	// Check against known patterns, sorted by pattern length (longest first) for specificity
-	type patternEntry struct {
-		name string
-		rule *ErrorPatternRule
+// responseModel returns the model that answered req, as far as the response tells
+func responseModel(response *LLMResponse, req *LLMRequest) string {
+	if response.Model != "" {
+		return response.Model
 	}
-	var patterns []patternEntry
-	for name, rule := range e.patterns.Patterns {
-		patterns = append(patterns, patternEntry{name, rule})
+	return req.Model
+}
+
+// appendModel adds a model to the models used unless it is unknown or already listed
+func appendModel(models []string, model string) []string {
+	if model == "" {
+		return models
 	}
-	// Sort by pattern length descending to match more specific patterns first
-	for i := 0; i < len(patterns)-1; i++ {
-		for j := i + 1; j < len(patterns); j++ {
-			if len(patterns[i].rule.Pattern) < len(patterns[j].rule.Pattern) {
-				patterns[i], patterns[j] = patterns[j], patterns[i]
-			}
+	return appendMissing(models, model)
+}
+
+// chat sends a request to the LLM. When the run reports progress and the client can stream,
+// the response is streamed so the progress shows it arriving.
+func (e *FailureAnalysisEngine) chat(ctx context.Context, stage ProgressStage, req *LLMRequest) (*LLMResponse, error) {
+	if streamer, ok := e.llmClient.(LLMStreamer); ok {
+		if onDelta := streamProgress(ctx, stage); onDelta != nil {
+			return streamer.ChatStream(ctx, req, onDelta)
 		}
 	}
+	return e.llmClient.Chat(ctx, req)
+}
 
-	for _, entry := range patterns {
-		if strings.Contains(errorLines, entry.rule.Pattern) || strings.Contains(allLogs, entry.rule.Pattern) {
-			e.logger.WithField("pattern", entry.name).Debug("Matched error pattern")
-			return &FailureClassification{
-				Type:       entry.rule.Type,
-				Severity:   entry.rule.Severity,
-				Category:   entry.rule.Category,
-				Confidence: entry.rule.Confidence,
-				Tags:       entry.rule.Tags,
-			}
+// preClassifyFailure performs initial classification using pattern matching
+func (e *FailureAnalysisEngine) preClassifyFailure(ctx FailureContext) *FailureClassification {
+	// Failure annotations are error lines a toolchain reported itself
+	var errorLines, allLogs string
+	if ctx.Logs != nil {
+		errorLines = strings.Join(append(failureAnnotationMessages(ctx.Logs), ctx.Logs.ErrorLines...), "\n")
+		allLogs = ctx.Logs.RawLogs
+	}
+
+	if matches := e.patterns.matchingRules(errorLines, allLogs); len(matches) > 0 {
+		entry := matches[0]
+		e.logger.WithField("pattern", entry.name).Debug("Matched error pattern")
+		return &FailureClassification{
+			Type:       entry.rule.Type,
+			Severity:   entry.rule.Severity,
+			Category:   entry.rule.Category,
+			Confidence: entry.rule.Confidence,
+			Tags:       entry.rule.Tags,
 		}
 	}
 
@@ -205,238 +447,66 @@ func (e *FailureAnalysisEngine) preClassifyFailure(ctx FailureContext) *FailureC
 
 // buildAnalysisPrompt creates a comprehensive prompt for failure analysis
 func (e *FailureAnalysisEngine) buildAnalysisPrompt(ctx FailureContext, preClass *FailureClassification) string {
-	var prompt strings.Builder
-
-	prompt.WriteString("## GitHub Actions Workflow Failure Analysis\n\n")
-
-	// Workflow context
-	prompt.WriteString(fmt.Sprintf("**Workflow**: %s\n", ctx.WorkflowRun.Name))
-	prompt.WriteString(fmt.Sprintf("**Branch**: %s\n", ctx.WorkflowRun.Branch))
-	prompt.WriteString(fmt.Sprintf("**Commit**: %s\n", ctx.WorkflowRun.CommitSHA))
-	prompt.WriteString(fmt.Sprintf("**Status**: %s/%s\n", ctx.WorkflowRun.Status, ctx.WorkflowRun.Conclusion))
-	prompt.WriteString(fmt.Sprintf("**Repository**: %s/%s\n\n", ctx.Repository.Owner, ctx.Repository.Name))
-
-	// Repository context
-	if ctx.Repository.Language != "" {
-		prompt.WriteString(fmt.Sprintf("**Language**: %s\n", ctx.Repository.Language))
-	}
-	if ctx.Repository.Framework != "" {
-		prompt.WriteString(fmt.Sprintf("**Framework**: %s\n", ctx.Repository.Framework))
-	}
-
-	// Pre-classification
-	prompt.WriteString(fmt.Sprintf("**Initial Classification**: %s (confidence: %.2f)\n\n", preClass.Type.DisplayName(), preClass.Confidence))
-
-	// Error logs
-	prompt.WriteString("## Error Information\n\n")
-	if len(ctx.Logs.ErrorLines) > 0 {
-		prompt.WriteString("**Error Lines**:\n```\n")
-		for _, line := range ctx.Logs.ErrorLines {
-			prompt.WriteString(line + "\n")
-		}
-		prompt.WriteString("```\n\n")
-	}
-
-	// Full logs (truncated if too long)
-	if len(ctx.Logs.RawLogs) > 0 {
-		prompt.WriteString("**Full Logs**:\n```\n")
-		logContent := ctx.Logs.RawLogs
-		if len(logContent) > 8000 {
-			logContent = logContent[:4000] + "\n...\n[TRUNCATED]\n...\n" + logContent[len(logContent)-4000:]
-		}
-		prompt.WriteString(logContent)
-		prompt.WriteString("\n```\n\n")
-	}
-
-	// Recent commits context
-	if len(ctx.RecentCommits) > 0 {
-		prompt.WriteString("## Recent Changes\n\n")
-		for i, commit := range ctx.RecentCommits {
-			if i >= 3 {
-				break // Limit to 3 recent commits
-			}
-			shaShort := commit.SHA
-			if len(shaShort) > 8 {
-				shaShort = shaShort[:8]
-			}
-			prompt.WriteString(fmt.Sprintf("**Commit %s**: %s (by %s)\n", shaShort, commit.Message, commit.Author))
-			for _, change := range commit.Changes {
-				prompt.WriteString(fmt.Sprintf("  - %s: %s (+%d/-%d)\n", change.Status, change.Filename, change.Additions, change.Deletions))
-			}
-			prompt.WriteString("\n")
-		}
-	}
-
-	prompt.WriteString("\n## Analysis Instructions\n\n")
-	prompt.WriteString("Please provide a comprehensive analysis including:\n")
-	prompt.WriteString("1. **Root Cause**: What exactly caused this failure?\n")
-	prompt.WriteString("2. **Classification**: Confirm or adjust the failure type, severity, and category\n")
-	prompt.WriteString("3. **Affected Components**: Which files, dependencies, or configurations are involved?\n")
-	prompt.WriteString("4. **Error Patterns**: Identify specific error patterns and their meanings\n")
-	prompt.WriteString("5. **Context Analysis**: How do recent changes relate to this failure?\n")
-	prompt.WriteString("\nFormat your response as structured JSON with the required fields.\n")
-
-	return prompt.String()
+	return e.renderPrompt("failure_analysis_prompt.tmpl", newAnalysisPromptData(ctx, preClass))
 }
 
 // buildFixGenerationPrompt creates a prompt for generating fixes
 func (e *FailureAnalysisEngine) buildFixGenerationPrompt(analysis *FailureAnalysisResult) string {
-	var prompt strings.Builder
-
-	prompt.WriteString("## Fix Generation for CI/CD Failure\n\n")
-
-	// Analysis summary
-	prompt.WriteString(fmt.Sprintf("**Failure Type**: %s\n", analysis.Classification.Type.DisplayName()))
-	prompt.WriteString(fmt.Sprintf("**Root Cause**: %s\n", analysis.RootCause))
-	prompt.WriteString(fmt.Sprintf("**Description**: %s\n\n", analysis.Description))
-
-	// Affected files
-	if len(analysis.AffectedFiles) > 0 {
-		prompt.WriteString("**Affected Files**:\n")
-		for _, file := range analysis.AffectedFiles {
-			prompt.WriteString(fmt.Sprintf("- %s\n", file))
-		}
-		prompt.WriteString("\n")
-	}
+	return e.renderPrompt("fix_generation_prompt.tmpl", e.fixPromptData(analysis))
+}
 
-	// Error patterns
-	if len(analysis.ErrorPatterns) > 0 {
-		prompt.WriteString("**Error Patterns**:\n")
-		for _, pattern := range analysis.ErrorPatterns {
-			prompt.WriteString(fmt.Sprintf("- %s: %s (confidence: %.2f)\n", pattern.Pattern, pattern.Description, pattern.Confidence))
-		}
-		prompt.WriteString("\n")
-	}
+// fixPromptData returns the data of the fix generation templates, with the fix types allowed
+// for the failure type
+func (e *FailureAnalysisEngine) fixPromptData(analysis *FailureAnalysisResult) *FixPromptData {
+	data := newFixPromptData(analysis)
+	if allowed, ok := e.fixTypes[analysis.Classification.Type]; ok {
+		data.AllowedFixTypes = allowed
+		var section strings.Builder
+		writeFixTypesPrompt(&section, analysis.Classification.Type, allowed)
+		data.FixTypesSection = section.String()
+	}
+	return data
+}
 
-	// Repository context
-	prompt.WriteString(fmt.Sprintf("**Repository**: %s/%s\n", analysis.Context.Repository.Owner, analysis.Context.Repository.Name))
-	if analysis.Context.Repository.Language != "" {
-		prompt.WriteString(fmt.Sprintf("**Language**: %s\n", analysis.Context.Repository.Language))
+// renderPrompt renders a prompt template. Templates are checked against sample data when
+// loaded, so a failure here means data the sample did not cover, like a nil pointer a custom
+// template dereferences; the built-in template is used then rather than failing the fix.
+func (e *FailureAnalysisEngine) renderPrompt(name string, data interface{}) string {
+	prompt, err := e.prompts.render(name, data)
+	if err == nil {
+		return prompt
 	}
-	if analysis.Context.Repository.Framework != "" {
-		prompt.WriteString(fmt.Sprintf("**Framework**: %s\n\n", analysis.Context.Repository.Framework))
+	e.logger.WithError(err).Warn("Falling back to the built-in prompt template")
+	prompt, err = builtinPromptTemplates.render(name, data)
+	if err != nil {
+		e.logger.WithError(err).Error("Failed to render built-in prompt template")
 	}
+	return prompt
+}
 
-	prompt.WriteString("## Fix Generation Instructions\n\n")
-	prompt.WriteString("Generate 2-3 different fix proposals, each with:\n")
-	prompt.WriteString("1. **Type**: The type of fix (code, configuration, dependency, etc.)\n")
-	prompt.WriteString("2. **Description**: Clear description of what the fix does\n")
-	prompt.WriteString("3. **Rationale**: Why this fix addresses the root cause\n")
-	prompt.WriteString("4. **Changes**: Specific code/configuration changes needed\n")
-	prompt.WriteString("5. **Confidence**: Your confidence level (0.0-1.0)\n")
-	prompt.WriteString("6. **Risks**: Potential risks or side effects\n")
-	prompt.WriteString("7. **Benefits**: Expected benefits\n")
-	prompt.WriteString("\nOrder fixes by confidence level (highest first).\n")
-	prompt.WriteString("Format response as JSON array of fix objects.\n")
-
-	return prompt.String()
+// renderSystemPrompt renders a system prompt template without the file's trailing newline
+func (e *FailureAnalysisEngine) renderSystemPrompt(name string, data interface{}) string {
+	return strings.TrimRight(e.renderPrompt(name, data), "\n")
 }
 
-// parseAnalysisResponse parses the LLM response into a structured analysis result
+// parseAnalysisResponse parses the LLM response into a structured analysis result, see
+// autofix.ParseAnalysis
 func (e *FailureAnalysisEngine) parseAnalysisResponse(content string, ctx FailureContext) (*FailureAnalysisResult, error) {
-	// Return error for empty content
-	if strings.TrimSpace(content) == "" {
-		return nil, fmt.Errorf("empty response content")
-	}
-
-	// Try to extract JSON from the response
-	jsonStart := strings.Index(content, "{")
-	jsonEnd := strings.LastIndex(content, "}")
-
-	if jsonStart == -1 || jsonEnd == -1 {
-		return e.parseUnstructuredAnalysis(content, ctx)
-	}
-
-	jsonContent := content[jsonStart : jsonEnd+1]
-	var parsed map[string]interface{}
-	if err := json.Unmarshal([]byte(jsonContent), &parsed); err != nil {
-		return e.parseUnstructuredAnalysis(content, ctx)
-	}
-
-	// Extract structured data
-	analysis := &FailureAnalysisResult{}
-
-	if rootCause, ok := parsed["root_cause"].(string); ok {
-		analysis.RootCause = rootCause
-	}
-	if description, ok := parsed["description"].(string); ok {
-		analysis.Description = description
-	}
-
-	// Parse classification
-	if classData, ok := parsed["classification"].(map[string]interface{}); ok {
-		analysis.Classification = FailureClassification{
-			Type:       FailureType(getStringField(classData, "type", string(CodeFailure))),
-			Severity:   SeverityLevel(getStringField(classData, "severity", string(Medium))),
-			Category:   FailureCategory(getStringField(classData, "category", string(Systematic))),
-			Confidence: getFloatField(classData, "confidence", 0.7),
-			Tags:       getStringArrayField(classData, "tags"),
-		}
-	}
-
-	// Parse affected files
-	if files, ok := parsed["affected_files"].([]interface{}); ok {
-		for _, file := range files {
-			if fileStr, ok := file.(string); ok {
-				analysis.AffectedFiles = append(analysis.AffectedFiles, fileStr)
-			}
+	parsed, err := autofix.ParseAnalysis(content, func(field string, err error) {
+		if e.logger != nil {
+			e.logger.WithField("field", field).WithError(err).Warn("LLM returned an unknown classification")
 		}
-	}
-
-	// Parse error patterns
-	if patterns, ok := parsed["error_patterns"].([]interface{}); ok {
-		for _, pattern := range patterns {
-			if patternMap, ok := pattern.(map[string]interface{}); ok {
-				analysis.ErrorPatterns = append(analysis.ErrorPatterns, ErrorPattern{
-					Pattern:     getStringField(patternMap, "pattern", ""),
-					Description: getStringField(patternMap, "description", ""),
-					Confidence:  getFloatField(patternMap, "confidence", 0.5),
-					Location:    getStringField(patternMap, "location", ""),
-				})
-			}
-		}
-	}
-
-	return analysis, nil
-}
-
-// parseUnstructuredAnalysis parses unstructured LLM response
-func (e *FailureAnalysisEngine) parseUnstructuredAnalysis(content string, ctx FailureContext) (*FailureAnalysisResult, error) {
-	// Try to detect failure type from content
-	contentLower := strings.ToLower(content)
-	var failureType FailureType = CodeFailure
-
-	// Simple pattern matching for unstructured content
-	if strings.Contains(contentLower, "dependency") || strings.Contains(contentLower, "dependencies") ||
-		strings.Contains(contentLower, "package") {
-		failureType = DependencyFailure
-	} else if strings.Contains(contentLower, "build") || strings.Contains(contentLower, "compilation") {
-		failureType = BuildFailure
-	} else if strings.Contains(contentLower, "test") {
-		failureType = TestFailure
-	} else if strings.Contains(contentLower, "infrastructure") || strings.Contains(contentLower, "network") ||
-		strings.Contains(contentLower, "timeout") {
-		failureType = InfrastructureFailure
-	} else if strings.Contains(contentLower, "security") || strings.Contains(contentLower, "vulnerability") {
-		failureType = SecurityFailure
-	} else if strings.Contains(contentLower, "configuration") || strings.Contains(contentLower, "config") {
-		failureType = ConfigurationFailure
-	}
-
-	// Fallback parsing for unstructured responses
-	analysis := &FailureAnalysisResult{
-		Description: content,
-		RootCause:   "Analysis provided in description field",
-		Classification: FailureClassification{
-			Type:       failureType,
-			Severity:   Medium,
-			Category:   Systematic,
-			Confidence: 0.5,
-			Tags:       []string{"unstructured"},
-		},
-	}
-
-	return analysis, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &FailureAnalysisResult{
+		RootCause:      parsed.RootCause,
+		Description:    parsed.Description,
+		Classification: parsed.Classification,
+		AffectedFiles:  parsed.AffectedFiles,
+		ErrorPatterns:  parsed.ErrorPatterns,
+	}, nil
 }
 
 // parseFixesResponse parses fix generation response
@@ -458,8 +528,7 @@ func (e *FailureAnalysisEngine) parseFixesResponse(content string, analysis *Fai
 	var fixes []*ProposedFix
 	for i, fixData := range parsed {
 		fix := &ProposedFix{
-			ID:          fmt.Sprintf("%s-fix-%d", analysis.ID, i+1),
-			Type:        FixType(getStringField(fixData, "type", string(CodeFix))),
+			Type:        parseLLMClassification(e.logger, "fix type", getStringField(fixData, "type", string(CodeFix)), ParseFixType),
 			Description: getStringField(fixData, "description", ""),
 			Rationale:   getStringField(fixData, "rationale", ""),
 			Confidence:  getFloatField(fixData, "confidence", 0.5),
@@ -476,12 +545,32 @@ func (e *FailureAnalysisEngine) parseFixesResponse(content string, analysis *Fai
 						FilePath:    getStringField(changeMap, "file_path", ""),
 						OldContent:  getStringField(changeMap, "old_content", ""),
 						NewContent:  getStringField(changeMap, "new_content", ""),
-						Operation:   getStringField(changeMap, "operation", "modify"),
+						NewFilePath: getStringField(changeMap, "new_file_path", ""),
+						Operation:   ChangeOperation(getStringField(changeMap, "operation", string(ChangeOperationModify))),
 						Explanation: getStringField(changeMap, "explanation", ""),
 					})
 				}
 			}
 		}
+		rejected := sanitizeFixChanges(fix, e.paths)
+		fix.ID = fixID(analysis.ID, i+1, fix.Changes)
+		for _, reason := range rejected {
+			e.logger.WithField("fix_id", fix.ID).Warn(reason)
+		}
+		if len(rejected) > 0 && len(fix.Changes) == 0 {
+			e.logger.WithField("fix_id", fix.ID).Warn("Skipping fix, all of its changes were dropped")
+			continue
+		}
+		if !e.fixTypes.accepts(fix, analysis, e.logger) {
+			continue
+		}
+		for _, guessed := range correctWorkflowPaths(fix, analysis.Context.Workflow) {
+			e.logger.WithFields(logrus.Fields{
+				"fix_id":   fix.ID,
+				"guessed":  guessed,
+				"workflow": analysis.Context.Workflow.Path,
+			}).Info("Pointed a workflow change at the workflow file of the failed run")
+		}
 
 		fixes = append(fixes, fix)
 	}
@@ -492,13 +581,16 @@ func (e *FailureAnalysisEngine) parseFixesResponse(content string, analysis *Fai
 // parseUnstructuredFixes creates a basic fix from unstructured content
 func (e *FailureAnalysisEngine) parseUnstructuredFixes(content string, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
 	fix := &ProposedFix{
-		ID:          fmt.Sprintf("%s-fix-1", analysis.ID),
+		ID:          fixID(analysis.ID, 1, nil),
 		Type:        CodeFix,
 		Description: "Fix based on analysis",
 		Rationale:   content,
 		Confidence:  0.3,
 		Timestamp:   time.Now(),
 	}
+	if !e.fixTypes.accepts(fix, analysis, e.logger) {
+		return nil, nil
+	}
 
 	return []*ProposedFix{fix}, nil
 }
@@ -512,26 +604,24 @@ func (e *FailureAnalysisEngine) enhanceWithPatterns(analysis *FailureAnalysisRes
 	}
 }
 
-// addValidationSteps adds appropriate validation steps to fixes
+// addValidationSteps adds appropriate validation steps to fixes. They pass on exit code 0;
+// make targets the repository does not have are skipped.
 func (e *FailureAnalysisEngine) addValidationSteps(fix *ProposedFix, analysis *FailureAnalysisResult) {
 	validationSteps := []ValidationStep{
 		{
-			Name:     "Syntax Check",
-			Command:  "make lint",
-			Expected: "No syntax errors",
-			Timeout:  30 * time.Second,
+			Name:    "Syntax Check",
+			Command: "make lint",
+			Timeout: 30 * time.Second,
 		},
 		{
-			Name:     "Unit Tests",
-			Command:  "make test",
-			Expected: "All tests pass",
-			Timeout:  5 * time.Minute,
+			Name:    "Unit Tests",
+			Command: "make test",
+			Timeout: 5 * time.Minute,
 		},
 		{
-			Name:     "Build Check",
-			Command:  "make build",
-			Expected: "Build succeeds",
-			Timeout:  10 * time.Minute,
+			Name:    "Build Check",
+			Command: "make build",
+			Timeout: 10 * time.Minute,
 		},
 	}
 
@@ -539,17 +629,21 @@ func (e *FailureAnalysisEngine) addValidationSteps(fix *ProposedFix, analysis *F
 	switch fix.Type {
 	case DependencyFix:
 		validationSteps = append(validationSteps, ValidationStep{
-			Name:     "Dependency Check",
-			Command:  "make deps-check",
-			Expected: "Dependencies resolved",
-			Timeout:  2 * time.Minute,
+			Name:    "Dependency Check",
+			Command: "make deps-check",
+			Timeout: 2 * time.Minute,
 		})
 	case SecurityFix:
 		validationSteps = append(validationSteps, ValidationStep{
-			Name:     "Security Scan",
-			Command:  "make security-scan",
-			Expected: "No security issues",
-			Timeout:  3 * time.Minute,
+			Name:    "Security Scan",
+			Command: "make security-scan",
+			Timeout: 3 * time.Minute,
+		})
+	case WorkflowFix:
+		validationSteps = append(validationSteps, ValidationStep{
+			Name:    "Workflow Lint",
+			Command: workflowLintCommand,
+			Timeout: 2 * time.Minute,
 		})
 	}
 
@@ -585,9 +679,28 @@ func getStringArrayField(data map[string]interface{}, key string) []string {
 	return []string{}
 }
 
-// loadErrorPatterns loads predefined error patterns
+// matchingRules returns the rules whose pattern appears in the logs, most specific (longest)
+// first and by name among patterns of the same length
+func (db *ErrorPatternDatabase) matchingRules(logs ...string) []patternMatch {
+	return db.index().match(logs...)
+}
+
+// index returns the matcher of the patterns, building it on first use. The patterns must not
+// change afterwards.
+func (db *ErrorPatternDatabase) index() *patternMatcher {
+	db.matcherOnce.Do(func() {
+		db.matcher = newPatternMatcher(db.Patterns)
+	})
+	return db.matcher
+}
+
+// builtinErrorPatterns are the predefined error patterns, shared by the callers matching
+// logs outside of an analysis engine
+var builtinErrorPatterns = loadErrorPatterns()
+
+// loadErrorPatterns loads predefined error patterns, indexed for matching up front
 func loadErrorPatterns() *ErrorPatternDatabase {
-	return &ErrorPatternDatabase{
+	db := &ErrorPatternDatabase{
 		Patterns: map[string]*ErrorPatternRule{
 			"connection_timeout": {
 				Pattern:     "connection timeout",
@@ -721,69 +834,6 @@ func loadErrorPatterns() *ErrorPatternDatabase {
 			},
 		},
 	}
-}
-
-// loadPromptTemplates loads prompt templates for different analysis types
-func loadPromptTemplates() *PromptTemplates {
-	return &PromptTemplates{
-		FailureAnalysis: `You are an expert DevOps engineer and CI/CD specialist with deep knowledge of software development workflows, testing frameworks, and deployment pipelines. Your task is to analyze GitHub Actions workflow failures and provide comprehensive, actionable insights.
-
-Analyze the provided failure information using a systematic approach:
-
-1. **Root Cause Analysis**: Identify the primary cause of the failure by examining error messages, stack traces, and context
-2. **Classification**: Categorize the failure type (infrastructure, code, test, dependency, build, deployment, configuration, security)
-3. **Severity Assessment**: Determine the impact level (critical, high, medium, low)
-4. **Category Determination**: Classify as transient, systematic, environmental, or flaky
-5. **Pattern Recognition**: Identify recurring error patterns and their implications
-6. **Context Correlation**: Connect the failure to recent code changes, dependencies, or environmental factors
-
-Provide your analysis in a structured format that enables automated processing and decision-making.`,
-
-		CodeAnalysis: `You are a senior software engineer specializing in code quality and static analysis. Analyze the provided code context to understand how it relates to the reported CI/CD failure.
-
-Focus on:
-- Code structure and patterns
-- Potential bugs or logic errors
-- Dependency issues
-- Configuration problems
-- Security vulnerabilities
-- Performance concerns
-
-Provide specific, actionable recommendations for code improvements.`,
-
-		FixGeneration: `You are an expert software developer and DevOps engineer. Generate specific, implementable fixes for the analyzed CI/CD failure.
-
-For each fix proposal:
-1. Provide clear, specific code changes with exact file paths and line numbers when possible
-2. Explain the rationale behind each change
-3. Assess the confidence level of the fix
-4. Identify potential risks and mitigation strategies
-5. Suggest validation steps to verify the fix
-6. Consider backwards compatibility and deployment implications
-
-Generate multiple fix alternatives when possible, ordered by confidence and risk level.`,
-
-		TestGeneration: `You are a test automation expert. Generate comprehensive test cases to validate the proposed fixes and prevent regression of the identified issues.
-
-Include:
-- Unit tests for specific code changes
-- Integration tests for system interactions
-- End-to-end tests for user workflows
-- Performance tests if relevant
-- Security tests if applicable
-
-Ensure tests are maintainable, reliable, and follow best practices for the target language and framework.`,
-
-		SecurityAnalysis: `You are a cybersecurity expert specializing in application security and DevSecOps. Analyze the failure context for security implications and vulnerabilities.
-
-Focus on:
-- Security misconfigurations
-- Dependency vulnerabilities
-- Code injection risks
-- Authentication/authorization issues
-- Data exposure risks
-- Infrastructure security
-
-Provide specific security recommendations and remediation steps.`,
-	}
+	db.index()
+	return db
 }
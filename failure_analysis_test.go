@@ -7,6 +7,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestNewFailureAnalysisEngine tests the constructor
@@ -250,29 +251,6 @@ func TestParseAnalysisResponse(t *testing.T) {
 	}
 }
 
-// TestParseUnstructuredAnalysis tests the parseUnstructuredAnalysis method
-func TestParseUnstructuredAnalysis(t *testing.T) {
-	logger := logrus.New()
-	engine := NewFailureAnalysisEngine(nil, logger)
-
-	ctx := FailureContext{
-		WorkflowRun: &WorkflowRun{ID: 123},
-		Repository:  RepositoryContext{Name: "test-repo"},
-	}
-
-	content := `The build failed due to missing dependencies.
-	This is clearly a dependency issue.
-	The package.json file is missing required packages.`
-
-	result, err := engine.parseUnstructuredAnalysis(content, ctx)
-
-	assert.NoError(t, err)
-	assert.NotNil(t, result)
-	assert.NotEmpty(t, result.RootCause)
-	assert.NotEmpty(t, result.Description)
-	assert.Equal(t, DependencyFailure, result.Classification.Type)
-}
-
 // TestParseFixesResponse tests the parseFixesResponse method
 func TestParseFixesResponse(t *testing.T) {
 	logger := logrus.New()
@@ -415,9 +393,11 @@ type mockLLMClient struct {
 	response *LLMResponse
 	err      error
 	provider LLMProvider
+	requests []*LLMRequest
 }
 
 func (m *mockLLMClient) Chat(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	m.requests = append(m.requests, req)
 	if m.err != nil {
 		return nil, m.err
 	}
@@ -720,3 +700,121 @@ func TestLoadPromptTemplates(t *testing.T) {
 	assert.NotEmpty(t, prompts.FailureAnalysis)
 	assert.NotEmpty(t, prompts.FixGeneration)
 }
+
+// routingResponse answers analysis requests with confidence and fix requests with a fix, as
+// the model the request asked for
+func routingResponse(confidence float64) func(req *LLMRequest) (*LLMResponse, error) {
+	return func(req *LLMRequest) (*LLMResponse, error) {
+		if _, ok := req.Context["analysis"]; ok {
+			return &LLMResponse{Content: npmFixesResponse, Model: req.Model}, nil
+		}
+		return &LLMResponse{
+			Content: fmt.Sprintf(`{"root_cause": "sum concatenates strings", "classification": {"type": "test", "confidence": %v}}`, confidence),
+			Model:   req.Model,
+		}, nil
+	}
+}
+
+func requestModels(requests []*LLMRequest) []string {
+	models := make([]string, 0, len(requests))
+	for _, req := range requests {
+		models = append(models, req.Model)
+	}
+	return models
+}
+
+// TestModelRouting tests that analysis and fix generation use their own models and that a low
+// confidence analysis is re-run with the fix model exactly once
+func TestModelRouting(t *testing.T) {
+	failureCtx := FailureContext{
+		WorkflowRun: &WorkflowRun{ID: 1},
+		Logs:        &WorkflowLogs{ErrorLines: []string{"expected 3, got \"12\""}},
+	}
+
+	tests := []struct {
+		name          string
+		analysisModel string
+		fixModel      string
+		confidence    float64
+		wantRequests  []string
+		wantUsed      []string
+	}{
+		{
+			name:          "confident analysis",
+			analysisModel: "gpt-4o-mini",
+			fixModel:      "gpt-4o",
+			confidence:    0.85,
+			wantRequests:  []string{"gpt-4o-mini", "gpt-4o"},
+			wantUsed:      []string{"gpt-4o-mini", "gpt-4o"},
+		},
+		{
+			name:          "low confidence escalates once",
+			analysisModel: "gpt-4o-mini",
+			fixModel:      "gpt-4o",
+			confidence:    0.3,
+			wantRequests:  []string{"gpt-4o-mini", "gpt-4o", "gpt-4o"},
+			wantUsed:      []string{"gpt-4o-mini", "gpt-4o"},
+		},
+		{
+			name:          "same model never escalates",
+			analysisModel: "gpt-4o",
+			fixModel:      "gpt-4o",
+			confidence:    0.3,
+			wantRequests:  []string{"gpt-4o", "gpt-4o"},
+			wantUsed:      []string{"gpt-4o"},
+		},
+		{
+			name:         "default models",
+			confidence:   0.3,
+			wantRequests: []string{"", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llm := &scriptedLLMClient{chatFunc: routingResponse(tt.confidence)}
+			engine := NewFailureAnalysisEngine(llm, quietLogger())
+			engine.SetOSVClient(nil)
+			engine.SetModels(tt.analysisModel, tt.fixModel)
+
+			analysis, err := engine.AnalyzeFailure(context.Background(), failureCtx)
+			require.NoError(t, err)
+			_, err = engine.GenerateFixes(context.Background(), analysis)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantRequests, requestModels(llm.requests))
+			assert.Equal(t, tt.wantUsed, analysis.ModelsUsed)
+		})
+	}
+
+	t.Run("disabled escalation", func(t *testing.T) {
+		llm := &scriptedLLMClient{chatFunc: routingResponse(0.3)}
+		engine := NewFailureAnalysisEngine(llm, quietLogger())
+		engine.SetOSVClient(nil)
+		engine.SetModels("gpt-4o-mini", "gpt-4o")
+		engine.SetEscalationConfidence(0)
+
+		_, err := engine.AnalyzeFailure(context.Background(), failureCtx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"gpt-4o-mini"}, requestModels(llm.requests))
+	})
+
+	t.Run("failed escalation keeps the first analysis", func(t *testing.T) {
+		llm := &scriptedLLMClient{}
+		llm.chatFunc = func(req *LLMRequest) (*LLMResponse, error) {
+			if req.Model == "gpt-4o" {
+				return nil, fmt.Errorf("%w: API error 429", ErrLLMRateLimited)
+			}
+			return routingResponse(0.3)(req)
+		}
+		engine := NewFailureAnalysisEngine(llm, quietLogger())
+		engine.SetOSVClient(nil)
+		engine.SetModels("gpt-4o-mini", "gpt-4o")
+
+		analysis, err := engine.AnalyzeFailure(context.Background(), failureCtx)
+		require.NoError(t, err)
+		assert.Equal(t, "sum concatenates strings", analysis.RootCause)
+		assert.Equal(t, []string{"gpt-4o-mini"}, analysis.ModelsUsed)
+		assert.Len(t, llm.requests, 2)
+	})
+}
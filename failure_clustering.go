@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// failureCluster is a group of failed runs sharing a failure fingerprint. Only the newest run
+// is fixed; the others are recorded with its fix. A cluster whose failure an earlier poll
+// already submitted has fixedBy set and no run to fix.
+type failureCluster struct {
+	fingerprint string
+	run         *WorkflowRun
+	others      []*WorkflowRun
+	fixedBy     int64
+}
+
+// clusteredFailure remembers the run submitted for a fingerprint, so the same failure found
+// by a later poll is not fixed again
+type clusteredFailure struct {
+	runID     int64
+	createdAt time.Time
+}
+
+// clusterFailures groups new failed runs by the fingerprint of their error lines, newest run
+// first in each cluster. Runs whose logs cannot be read or have no error lines stand alone.
+// Clusters keep the order their newest run was listed in.
+func (m *DaggerAutofix) clusterFailures(ctx context.Context, runs []*WorkflowRun) []*failureCluster {
+	var clusters []*failureCluster
+	byFingerprint := make(map[string]*failureCluster)
+	for _, run := range runs {
+		fingerprint := ""
+		if !m.DisableFailureClustering {
+			logs, err := m.githubClient.GetWorkflowLogs(ctx, run.ID)
+			if err != nil {
+				m.logger.WithError(err).WithField("run_id", run.ID).Warn("Failed to get workflow logs, fixing the run on its own")
+			}
+			fingerprint = failureFingerprint(logs)
+		}
+		cluster, ok := byFingerprint[fingerprint]
+		if fingerprint == "" || !ok {
+			cluster = &failureCluster{fingerprint: fingerprint}
+			clusters = append(clusters, cluster)
+			if fingerprint != "" {
+				byFingerprint[fingerprint] = cluster
+			}
+		}
+		cluster.others = append(cluster.others, run)
+	}
+
+	lookback := m.failureLookback()
+	m.poolMu.Lock()
+	defer m.poolMu.Unlock()
+	for fingerprint, earlier := range m.recentFailures {
+		if time.Since(earlier.createdAt) > lookback {
+			delete(m.recentFailures, fingerprint)
+		}
+	}
+	for _, cluster := range clusters {
+		sort.SliceStable(cluster.others, func(i, j int) bool {
+			return cluster.others[i].CreatedAt.After(cluster.others[j].CreatedAt)
+		})
+		if earlier, ok := m.recentFailures[cluster.fingerprint]; ok && cluster.fingerprint != "" {
+			cluster.fixedBy = earlier.runID
+			continue
+		}
+		cluster.run, cluster.others = cluster.others[0], cluster.others[1:]
+	}
+	return clusters
+}
+
+// failureLookback returns FailureLookback, or the default when unset
+func (m *DaggerAutofix) failureLookback() time.Duration {
+	if m.FailureLookback > 0 {
+		return m.FailureLookback
+	}
+	return DefaultFailureLookback
+}
+
+// recordCluster remembers the run submitted for a cluster and the runs fixed along with it
+func (m *DaggerAutofix) recordCluster(cluster *failureCluster) {
+	m.poolMu.Lock()
+	defer m.poolMu.Unlock()
+
+	if cluster.fingerprint != "" {
+		if m.recentFailures == nil {
+			m.recentFailures = make(map[string]clusteredFailure)
+		}
+		m.recentFailures[cluster.fingerprint] = clusteredFailure{runID: cluster.run.ID, createdAt: cluster.run.CreatedAt}
+	}
+	if len(cluster.others) > 0 {
+		if m.clusteredRuns == nil {
+			m.clusteredRuns = make(map[int64][]*WorkflowRun)
+		}
+		m.clusteredRuns[cluster.run.ID] = cluster.others
+	}
+}
+
+// takeClusteredRuns returns the runs clustered with runID, forgetting them
+func (m *DaggerAutofix) takeClusteredRuns(runID int64) []*WorkflowRun {
+	m.poolMu.Lock()
+	defer m.poolMu.Unlock()
+
+	runs := m.clusteredRuns[runID]
+	delete(m.clusteredRuns, runID)
+	return runs
+}
+
+// logClusteredRuns reports the runs left to the fix of another run with the same failure
+func (m *DaggerAutofix) logClusteredRuns(cluster *failureCluster) {
+	ids := clusteredRunIDs(cluster.others)
+	if len(ids) == 0 {
+		return
+	}
+	fixedBy := cluster.fixedBy
+	if cluster.run != nil {
+		fixedBy = cluster.run.ID
+	}
+	m.logger.WithFields(logrus.Fields{
+		"run_id":         fixedBy,
+		"clustered_runs": ids,
+		"fingerprint":    cluster.fingerprint,
+	}).Info("Failed runs share a failure, fixing it once")
+}
+
+// clusteredRunIDs returns the IDs of runs
+func clusteredRunIDs(runs []*WorkflowRun) []int64 {
+	ids := make([]int64, 0, len(runs))
+	for _, run := range runs {
+		ids = append(ids, run.ID)
+	}
+	return ids
+}
+
+// clusteredRunsLine lists the other runs a fix PR resolves, with their branches
+func clusteredRunsLine(runs []*WorkflowRun) string {
+	refs := make([]string, 0, len(runs))
+	for _, run := range runs {
+		ref := fmt.Sprintf("#%d", run.ID)
+		if run.URL != "" {
+			ref = fmt.Sprintf("[#%d](%s)", run.ID, run.URL)
+		}
+		if run.Branch != "" {
+			ref += fmt.Sprintf(" on `%s`", run.Branch)
+		}
+		refs = append(refs, ref)
+	}
+	return strings.Join(refs, ", ")
+}
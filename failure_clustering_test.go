@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clusteringAutofix returns an agent whose monitored repository lists the failed runs with
+// the error lines in errorLines. The runs each analysis was made for are recorded in analyzed
+// and the analyses PRs were opened for in fixed.
+func clusteringAutofix(runs []*WorkflowRun, errorLines map[int64][]string) (m *DaggerAutofix, analyzed func() []int64, fixed func() []*FailureAnalysisResult) {
+	var mu sync.Mutex
+	var analyzedRuns []int64
+	var fixedAnalyses []*FailureAnalysisResult
+
+	m = fixtureAutofix(nil)
+	gh := m.githubClient.(*mockGitHub)
+	gh.getFailedWorkflowRunsFunc = func(ctx context.Context) ([]*WorkflowRun, error) {
+		return runs, nil
+	}
+	gh.getWorkflowLogsFunc = func(ctx context.Context, runID int64) (*WorkflowLogs, error) {
+		return &WorkflowLogs{ErrorLines: errorLines[runID]}, nil
+	}
+	fe := m.failureEngine.(*mockFailureAnalysisEngine)
+	fe.analyzeFunc = func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		analyzedRuns = append(analyzedRuns, fc.WorkflowRun.ID)
+		return &FailureAnalysisResult{ID: fmt.Sprintf("a%d", fc.WorkflowRun.ID), Classification: FailureClassification{Type: TestFailure}, Context: fc}, nil
+	}
+	m.prEngine.(*mockPullRequestEngine).createWithOptionsFunc = func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fixedAnalyses = append(fixedAnalyses, analysis)
+		return &PullRequest{Number: len(fixedAnalyses)}, nil
+	}
+	analyzed = func() []int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		ids := append([]int64(nil), analyzedRuns...)
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		return ids
+	}
+	fixed = func() []*FailureAnalysisResult {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*FailureAnalysisResult(nil), fixedAnalyses...)
+	}
+	return m, analyzed, fixed
+}
+
+// TestMonitorClustersFailures tests that runs failing the same way are fixed once, through
+// the newest run
+func TestMonitorClustersFailures(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	runs := []*WorkflowRun{
+		{ID: 1, Branch: "main", CreatedAt: now.Add(-3 * time.Hour)},
+		{ID: 2, Branch: "feature-a", CreatedAt: now.Add(-2 * time.Hour), URL: "https://github.com/test/repo/actions/runs/2"},
+		{ID: 3, Branch: "feature-b", CreatedAt: now.Add(-time.Hour)},
+		{ID: 4, Branch: "main", CreatedAt: now},
+	}
+	errorLines := map[int64][]string{
+		1: {"2024-03-01T06:00:01Z npm ERR! 404 Not Found - GET https://registry.npmjs.org/left-pad (took 1.2s)",
+			"Error: Cannot find module 'left-pad' from /home/runner/work/app/app/src/index.js"},
+		2: {"2024-03-01T06:10:44Z npm ERR! 404 Not Found - GET https://registry.npmjs.org/left-pad (took 850ms)",
+			"Error: Cannot find module 'left-pad' from /github/workspace/src/index.js"},
+		3: {"2024-03-01T07:02:13Z npm ERR! 404 Not Found - GET https://registry.npmjs.org/left-pad (took 2m3s)",
+			"Error: Cannot find module 'left-pad' from /tmp/build-8812/src/index.js"},
+		4: {"--- FAIL: TestParse (0.02s)"},
+	}
+	m, analyzed, fixed := clusteringAutofix(runs, errorLines)
+	m.MaxConcurrentFixes = 1
+	collector := useTestMetrics(t)
+
+	pass, err := m.MonitorOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pass.FailuresDetected)
+	assert.Equal(t, []int64{3, 4}, analyzed(), "a single fix for runs 1 to 3")
+
+	var clusteredRuns []int64
+	for _, analysis := range fixed() {
+		if analysis.Context.WorkflowRun.ID == 3 {
+			clusteredRuns = clusteredRunIDs(analysis.Context.ClusteredRuns)
+		} else {
+			assert.Empty(t, analysis.Context.ClusteredRuns)
+		}
+	}
+	assert.Equal(t, []int64{2, 1}, clusteredRuns)
+
+	metrics, err := m.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, metrics.ClusteredFailures)
+	scrape := scrapeMetrics(t, collector)
+	assert.Regexp(t, `github_autofix_failures_clustered_total\{repository="[^"]*"\} 2\n`, scrape)
+	assert.Regexp(t, `github_autofix_failures_detected_total\{repository="[^"]*"\} 2\n`, scrape)
+	assert.NotContains(t, scrape, "github_autofix_failures_skipped_total{")
+
+	// A new run of the same failure within the lookback is left to the earlier fix
+	runs = append(runs, &WorkflowRun{ID: 5, Branch: "feature-c", CreatedAt: now})
+	errorLines[5] = errorLines[1]
+	pass, err = m.MonitorOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, pass.FailuresDetected)
+	assert.Equal(t, []int64{3, 4}, analyzed())
+
+	// Disabled, every run is fixed on its own
+	m, analyzed, _ = clusteringAutofix(runs[:3], errorLines)
+	m = m.WithFailureClustering(false)
+	_, err = m.MonitorOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, analyzed())
+}
+
+// TestAutoFixRecordsClusteredRuns tests that the fix of a cluster's run names the other runs
+// in its metadata and PR body
+func TestAutoFixRecordsClusteredRuns(t *testing.T) {
+	m, _, fixed := clusteringAutofix(nil, nil)
+	others := []*WorkflowRun{
+		{ID: 2, Branch: "feature-a", URL: "https://github.com/test/repo/actions/runs/2"},
+		{ID: 1, Branch: "main"},
+	}
+	m.recordCluster(&failureCluster{fingerprint: "f00d", run: &WorkflowRun{ID: 3}, others: others})
+
+	result, err := m.AutoFix(context.Background(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2, 1}, result.Metadata["clustered_runs"])
+	require.Len(t, fixed(), 1)
+
+	body := NewPullRequestEngine(nil, quietLogger()).generatePRBody(fixed()[0], result.Fix)
+	assert.Contains(t, body, "**Same Failure In**: [#2](https://github.com/test/repo/actions/runs/2) on `feature-a`, #1 on `main`\n")
+
+	// The clustered runs belong to that one fix
+	result, err = m.AutoFix(context.Background(), 3)
+	require.NoError(t, err)
+	assert.NotContains(t, result.Metadata, "clustered_runs")
+}
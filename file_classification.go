@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"dagger.io/dagger"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultBinaryExtensions are the extensions of images, archives, fonts, media, compiled
+// code and databases, whose content is never useful in a prompt nor editable as text
+var defaultBinaryExtensions = []string{
+	".png", ".jpg", ".jpeg", ".gif", ".bmp", ".ico", ".webp", ".tiff", ".psd",
+	".zip", ".gz", ".tgz", ".bz2", ".xz", ".7z", ".tar", ".rar", ".jar", ".war",
+	".woff", ".woff2", ".ttf", ".otf", ".eot",
+	".mp3", ".mp4", ".wav", ".ogg", ".mov", ".avi", ".webm",
+	".pdf", ".exe", ".dll", ".so", ".dylib", ".a", ".o", ".class", ".pyc", ".wasm", ".bin",
+	".db", ".sqlite", ".sqlite3",
+}
+
+// GeneratedFile describes files generated from other files, which fixes must regenerate
+// rather than edit
+type GeneratedFile struct {
+	// Pattern is a CODEOWNERS style pattern of the generated files
+	Pattern string `json:"pattern"`
+	// Command regenerates the files from the directory holding them; empty when they cannot
+	// be regenerated, so fixes changing them are rejected
+	Command string `json:"command,omitempty"`
+	// image the command runs in, the workspace image when empty
+	image string
+	// kind names the generator in messages
+	kind string
+}
+
+// defaultGeneratedFiles are protobuf output and the lockfiles the dependency resolver
+// regenerates
+func defaultGeneratedFiles() []GeneratedFile {
+	files := []GeneratedFile{
+		{Pattern: "*.pb.go", kind: "protobuf output"},
+		{Pattern: "*_pb2.py", kind: "protobuf output"},
+		{Pattern: "*_pb2_grpc.py", kind: "protobuf output"},
+		{Pattern: "*.pb.cc", kind: "protobuf output"},
+		{Pattern: "*.pb.h", kind: "protobuf output"},
+	}
+	frameworks := loadTestFrameworks()
+	for _, eco := range packageEcosystems {
+		if eco.lockfile != "" {
+			files = append(files, GeneratedFile{Pattern: eco.lockfile, Command: eco.lockCommand, image: frameworks[eco.framework].Image, kind: eco.name + " lockfile"})
+		}
+	}
+	return files
+}
+
+// FileClassification extends the built-in lists of binary and generated files. Binary files
+// are left out of prompts and fixes may not change them; generated files are regenerated
+// when a fix changes them.
+type FileClassification struct {
+	// BinaryExtensions are extensions of binary files besides the built-in ones, e.g. ".dat"
+	BinaryExtensions []string `json:"binary_extensions"`
+	// GeneratedFiles are generated files besides protobuf output and lockfiles; they take
+	// precedence over the built-in ones
+	GeneratedFiles []GeneratedFile `json:"generated_files"`
+}
+
+// validate checks the extensions and the generated file patterns
+func (c FileClassification) validate() error {
+	for _, ext := range c.BinaryExtensions {
+		if strings.Trim(ext, ".") == "" || strings.ContainsAny(ext, "/* ") {
+			return fmt.Errorf("invalid binary file extension %q", ext)
+		}
+	}
+	for _, file := range c.GeneratedFiles {
+		if _, err := codeownersPattern(file.Pattern); err != nil {
+			return fmt.Errorf("invalid generated file pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+// binaryFile reports whether a file is binary, by its extension or its content as diffs
+// tell binary files
+func (c FileClassification) binaryFile(file, content string) bool {
+	ext := strings.ToLower(path.Ext(file))
+	if ext != "" {
+		if slices.Contains(defaultBinaryExtensions, ext) {
+			return true
+		}
+		for _, extra := range c.BinaryExtensions {
+			if strings.ToLower("."+strings.TrimPrefix(extra, ".")) == ext {
+				return true
+			}
+		}
+	}
+	return isBinaryContent(content)
+}
+
+// generatedFile returns how a file is generated, and false when it is not
+func (c FileClassification) generatedFile(file string) (GeneratedFile, bool) {
+	for _, generated := range append(slices.Clone(c.GeneratedFiles), defaultGeneratedFiles()...) {
+		// Invalid patterns are rejected when the agent is initialized
+		if expr, err := codeownersPattern(generated.Pattern); err == nil && expr.MatchString(file) {
+			return generated, true
+		}
+	}
+	return GeneratedFile{}, false
+}
+
+// describe names the generator of a file in messages
+func (g GeneratedFile) describe() string {
+	return valueOr(g.kind, "generated by "+g.Pattern)
+}
+
+// binaryPlaceholder stands in for the content of a binary file in prompts
+func binaryPlaceholder(content string) string {
+	return fmt.Sprintf("binary file, %d bytes, not included", len(content))
+}
+
+// parseGeneratedFile parses a generated file given as "pattern=command", or a bare pattern
+// for files that cannot be regenerated
+func parseGeneratedFile(value string) GeneratedFile {
+	pattern, command, _ := strings.Cut(value, "=")
+	return GeneratedFile{Pattern: strings.TrimSpace(pattern), Command: strings.TrimSpace(command)}
+}
+
+// checkFixFiles rejects fixes editing binary files and replaces the proposed content of
+// generated files with the output of their command, run on the source with the fix's other
+// changes applied. Changes the fix already produced by running the command, such as the
+// dependency resolver's lockfiles, are kept. It returns why the fix is rejected, nothing when
+// it can be validated.
+func (m *DaggerAutofix) checkFixFiles(ctx context.Context, fix *ProposedFix) []string {
+	var problems []string
+	for i, change := range fix.Changes {
+		file := change.targetPath()
+		if change.Operation != ChangeOperationDelete && m.FileClassification.binaryFile(file, change.NewContent) {
+			problems = append(problems, fmt.Sprintf("changes binary file %s, which cannot be edited as text", file))
+			continue
+		}
+		generated, ok := m.FileClassification.generatedFile(file)
+		if !ok || (generated.Command != "" && slices.Contains(fix.Commands, generated.Command)) {
+			continue
+		}
+		if generated.Command == "" {
+			problems = append(problems, fmt.Sprintf("changes %s, which is %s; change its source and regenerate it instead", file, generated.describe()))
+			continue
+		}
+		if m.Source == nil {
+			problems = append(problems, fmt.Sprintf("changes %s, which is %s and needs a source directory to regenerate with `%s`", file, generated.describe(), generated.Command))
+			continue
+		}
+
+		others := slices.Delete(slices.Clone(fix.Changes), i, i+1)
+		content, found, err := m.testEngine.RegenerateFile(ctx, m.Source, others, generated, file)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("changes %s, which could not be regenerated: %v", file, err))
+			continue
+		}
+		m.logger.WithFields(logrus.Fields{"fix_id": fix.ID, "file": file, "command": generated.Command}).Info("Regenerated generated file instead of using the proposed content")
+		change.NewContent = content
+		change.Explanation = fmt.Sprintf("Regenerated with `%s`", generated.Command)
+		if !found {
+			change.Operation, change.NewContent = ChangeOperationDelete, ""
+		}
+		fix.Changes[i] = change
+		fix.Commands = append(fix.Commands, generated.Command)
+	}
+	return problems
+}
+
+// RegenerateFile runs the command of a generated file in the directory holding it, on source
+// with changes applied, and returns the file's content and whether the command left it
+func (e *TestEngine) RegenerateFile(ctx context.Context, source *dagger.Directory, changes []CodeChange, generated GeneratedFile, file string) (string, bool, error) {
+	if source == nil {
+		return "", false, fmt.Errorf("source directory is required")
+	}
+	container := e.containerProvider.CreateContainer().From(valueOr(generated.image, workspaceImage)).
+		WithDirectory("/workspace", source).
+		WithWorkdir("/workspace")
+	container, err := e.applyChanges(container, changes)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to apply changes: %w", err)
+	}
+
+	executed, output, err := container.WithWorkdir(path.Join("/workspace", path.Dir(file))).
+		Exec(ctx, []string{"sh", "-c", generated.Command})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to run %s: %w", generated.Command, err)
+	}
+	if output.ExitCode != 0 {
+		return "", false, fmt.Errorf("%s exited with code %d: %s", generated.Command, output.ExitCode, firstLine(valueOr(output.Stderr, output.Stdout)))
+	}
+	return readWorkspaceFile(ctx, executed.WithWorkdir("/workspace"), file)
+}
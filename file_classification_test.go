@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pngContent is the start of a PNG image, whose header has NUL bytes
+const pngContent = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x10"
+
+// TestFileClassification tests how files are told binary or generated, by the built-in and
+// configured lists
+func TestFileClassification(t *testing.T) {
+	classification := FileClassification{
+		BinaryExtensions: []string{"DAT"},
+		GeneratedFiles:   []GeneratedFile{{Pattern: "/schema.json", Command: "sh scripts/schema.sh"}, {Pattern: "go.sum"}},
+	}
+
+	assert.True(t, classification.binaryFile("assets/logo.png", ""), "by extension")
+	assert.True(t, classification.binaryFile("assets/LOGO.PNG", "text"), "extensions ignore case")
+	assert.True(t, classification.binaryFile("fixtures/data", pngContent), "by content")
+	assert.True(t, classification.binaryFile("fixtures/sample.dat", "text"), "configured extension")
+	assert.False(t, classification.binaryFile("src/sum.js", "module.exports = (a, b) => a - b\n"))
+	assert.False(t, FileClassification{}.binaryFile("fixtures/sample.dat", "text"))
+
+	generated, ok := classification.generatedFile("api/v1/user.pb.go")
+	require.True(t, ok)
+	assert.Equal(t, "protobuf output", generated.describe())
+	assert.Empty(t, generated.Command, "protobuf output is regenerated from its sources")
+
+	generated, ok = classification.generatedFile("web/package-lock.json")
+	require.True(t, ok)
+	assert.Equal(t, "npm install --package-lock-only --ignore-scripts", generated.Command)
+	assert.Equal(t, "node:20", generated.image)
+
+	generated, ok = classification.generatedFile("schema.json")
+	require.True(t, ok)
+	assert.Equal(t, "sh scripts/schema.sh", generated.Command)
+	_, ok = classification.generatedFile("docs/schema.json")
+	assert.False(t, ok, "anchored patterns only match at the root")
+
+	generated, ok = classification.generatedFile("go.sum")
+	require.True(t, ok)
+	assert.Empty(t, generated.Command, "configured files take precedence over the built-in ones")
+	assert.Equal(t, "generated by go.sum", generated.describe())
+
+	_, ok = classification.generatedFile("src/sum.js")
+	assert.False(t, ok)
+
+	require.NoError(t, classification.validate())
+	assert.EqualError(t, FileClassification{BinaryExtensions: []string{"."}}.validate(), `invalid binary file extension "."`)
+	assert.EqualError(t, FileClassification{BinaryExtensions: []string{"*.dat"}}.validate(), `invalid binary file extension "*.dat"`)
+	assert.ErrorContains(t, FileClassification{GeneratedFiles: []GeneratedFile{{Pattern: ""}}}.validate(), "invalid generated file pattern")
+
+	assert.Equal(t, GeneratedFile{Pattern: "/schema.json", Command: "sh scripts/schema.sh"}, parseGeneratedFile(" /schema.json = sh scripts/schema.sh"))
+	assert.Equal(t, GeneratedFile{Pattern: "*.snap"}, parseGeneratedFile("*.snap"))
+}
+
+// TestSelectContextFilesBinary tests that binary files are described instead of included in
+// the fix generation prompt, and generated files are marked
+func TestSelectContextFilesBinary(t *testing.T) {
+	repo := map[string]string{
+		"assets/logo.png":   pngContent,
+		"package-lock.json": `{"lockfileVersion": 3}`,
+		"src/sum.js":        "module.exports = (a, b) => a - b\n",
+	}
+	engine := NewFailureAnalysisEngine(&scriptedLLMClient{}, quietLogger())
+	engine.SetFileSource(func(ctx context.Context, path, ref string) (string, bool, error) {
+		content, ok := repo[path]
+		return content, ok, nil
+	})
+
+	analysis := contextAnalysis(
+		[]string{"npm ERR! package-lock.json is out of sync", "Error: cannot read assets/logo.png"},
+		[]string{"package-lock.json", "src/sum.js"},
+	)
+	files, decisions := engine.selectContextFiles(context.Background(), analysis)
+
+	assert.Equal(t, []ContextFile{
+		{Path: "package-lock.json", Content: `{"lockfileVersion": 3}`, Generated: true},
+		{Path: "assets/logo.png", Content: "binary file, 20 bytes, not included", Binary: true},
+		{Path: "src/sum.js", Content: "module.exports = (a, b) => a - b\n"},
+	}, files)
+	for _, decision := range decisions {
+		if decision.Path == "assets/logo.png" {
+			assert.True(t, decision.Included)
+			assert.Contains(t, decision.Reason, "binary, content not included")
+		}
+	}
+
+	var prompt strings.Builder
+	writeContextFilesPrompt(&prompt, files)
+	assert.Contains(t, prompt.String(), "### assets/logo.png\n(binary file, 20 bytes, not included; do not change this file)\n\n")
+	assert.Contains(t, prompt.String(), "### package-lock.json (generated; change its sources instead, it is regenerated)\n```")
+	assert.NotContains(t, prompt.String(), "PNG")
+}
+
+// classifiedAutofix returns an agent validating fixes with a source directory, whose test
+// engine records the changes it tests and regenerates files with regenerate
+func classifiedAutofix(tested *[]CodeChange, regenerate func(changes []CodeChange, generated GeneratedFile, file string) (string, bool, error)) *DaggerAutofix {
+	return &DaggerAutofix{
+		Source:       &dagger.Directory{},
+		githubClient: &mockGitHub{},
+		logger:       quietLogger(),
+		testEngine: &mockTestEngine{
+			runTestsWithChangesFunc: func(ctx context.Context, source *dagger.Directory, changes []CodeChange) (*TestResult, error) {
+				*tested = changes
+				return &TestResult{Success: true, TestsPassed: true, PassedTests: 3}, nil
+			},
+			regenerateFileFunc: func(ctx context.Context, source *dagger.Directory, changes []CodeChange, generated GeneratedFile, file string) (string, bool, error) {
+				return regenerate(changes, generated, file)
+			},
+		},
+	}
+}
+
+// TestValidateFixBinaryAndGeneratedFiles tests that fixes editing binary files or protobuf
+// output are rejected untested, and that lockfile content is regenerated instead of trusted
+func TestValidateFixBinaryAndGeneratedFiles(t *testing.T) {
+	ctx := context.Background()
+	manifest := CodeChange{FilePath: "web/package.json", Operation: ChangeOperationModify, NewContent: `{"dependencies": {"left-pad": "1.3.0"}}`}
+	noRegeneration := func(changes []CodeChange, generated GeneratedFile, file string) (string, bool, error) {
+		t.Fatalf("%s must not be regenerated", file)
+		return "", false, nil
+	}
+
+	t.Run("PNG", func(t *testing.T) {
+		var tested []CodeChange
+		m := classifiedAutofix(&tested, noRegeneration)
+		res, err := m.ValidateFix(ctx, &ProposedFix{ID: "f1", Changes: []CodeChange{
+			{FilePath: "assets/logo.png", Operation: ChangeOperationModify, NewContent: "iVBORw0KGgo="},
+		}})
+		require.NoError(t, err)
+		assert.False(t, res.Valid)
+		assert.Equal(t, []string{"changes binary file assets/logo.png, which cannot be edited as text"}, res.Errors)
+		assert.Nil(t, tested, "rejected fixes are not tested")
+
+		res, err = m.ValidateFix(ctx, &ProposedFix{ID: "f2", Changes: []CodeChange{
+			{FilePath: "assets/logo.png", Operation: ChangeOperationDelete},
+		}})
+		require.NoError(t, err)
+		assert.True(t, res.Valid, "binary files may be deleted")
+	})
+
+	t.Run("protobuf output", func(t *testing.T) {
+		var tested []CodeChange
+		m := classifiedAutofix(&tested, noRegeneration)
+		res, err := m.ValidateFix(ctx, &ProposedFix{ID: "f1", Changes: []CodeChange{
+			{FilePath: "api/v1/user.pb.go", Operation: ChangeOperationModify, NewContent: "package v1\n"},
+		}})
+		require.NoError(t, err)
+		assert.False(t, res.Valid)
+		assert.Equal(t, []string{"changes api/v1/user.pb.go, which is protobuf output; change its source and regenerate it instead"}, res.Errors)
+		assert.Nil(t, tested)
+	})
+
+	t.Run("lockfile", func(t *testing.T) {
+		var tested []CodeChange
+		m := classifiedAutofix(&tested, func(changes []CodeChange, generated GeneratedFile, file string) (string, bool, error) {
+			assert.Equal(t, []CodeChange{manifest}, changes, "the lockfile is regenerated from the fix's other changes")
+			assert.Equal(t, "web/package-lock.json", file)
+			return `{"lockfileVersion": 3, "packages": {"node_modules/left-pad": {"version": "1.3.0"}}}`, true, nil
+		})
+		fix := &ProposedFix{ID: "f1", Changes: []CodeChange{
+			manifest,
+			{FilePath: "web/package-lock.json", Operation: ChangeOperationModify, NewContent: `{"hallucinated": true}`},
+		}}
+		res, err := m.ValidateFix(ctx, fix)
+		require.NoError(t, err)
+		assert.True(t, res.Valid, res.Errors)
+
+		lockfile := fix.Changes[1]
+		assert.Equal(t, `{"lockfileVersion": 3, "packages": {"node_modules/left-pad": {"version": "1.3.0"}}}`, lockfile.NewContent)
+		assert.Equal(t, "Regenerated with `npm install --package-lock-only --ignore-scripts`", lockfile.Explanation)
+		assert.Equal(t, []string{"npm install --package-lock-only --ignore-scripts"}, fix.Commands)
+		assert.Equal(t, fix.Changes, tested, "the regenerated lockfile is tested")
+	})
+
+	t.Run("lockfile regeneration fails", func(t *testing.T) {
+		var tested []CodeChange
+		m := classifiedAutofix(&tested, func(changes []CodeChange, generated GeneratedFile, file string) (string, bool, error) {
+			return "", false, errors.New("npm install exited with code 1: ERESOLVE")
+		})
+		res, err := m.ValidateFix(ctx, &ProposedFix{ID: "f1", Changes: []CodeChange{
+			{FilePath: "package-lock.json", Operation: ChangeOperationModify, NewContent: "{}"},
+		}})
+		require.NoError(t, err)
+		assert.False(t, res.Valid)
+		assert.Equal(t, []string{"changes package-lock.json, which could not be regenerated: npm install exited with code 1: ERESOLVE"}, res.Errors)
+	})
+
+	t.Run("lockfile already regenerated", func(t *testing.T) {
+		var tested []CodeChange
+		m := classifiedAutofix(&tested, noRegeneration)
+		fix := &ProposedFix{ID: "f1", Commands: []string{"go mod tidy"}, Changes: []CodeChange{
+			{FilePath: "go.sum", Operation: ChangeOperationModify, NewContent: "example.com/m v1.0.0 h1:abc=\n"},
+		}}
+		res, err := m.ValidateFix(ctx, fix)
+		require.NoError(t, err)
+		assert.True(t, res.Valid, "the dependency resolver's lockfiles are kept")
+		assert.Equal(t, "example.com/m v1.0.0 h1:abc=\n", fix.Changes[0].NewContent)
+	})
+}
+
+// TestRegenerateFile tests that a generated file is regenerated in its ecosystem's image, in
+// its directory, with the other changes applied
+func TestRegenerateFile(t *testing.T) {
+	ctx := context.Background()
+	provider := NewMockContainerProvider()
+	engine := NewTestEngine(80, quietLogger())
+	engine.SetContainerProvider(provider)
+	generated, _ := FileClassification{}.generatedFile("web/package-lock.json")
+	command := "sh -c " + generated.Command
+	provider.MockContainer.CommandOutputs[command] = MockCommandResult{Writes: map[string]string{"web/package-lock.json": `{"lockfileVersion": 3}`}}
+
+	content, found, err := engine.RegenerateFile(ctx, &dagger.Directory{}, []CodeChange{
+		{FilePath: "web/package.json", Operation: ChangeOperationModify, NewContent: "{}"},
+	}, generated, "web/package-lock.json")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, `{"lockfileVersion": 3}`, content)
+	assert.Equal(t, "node:20", provider.MockContainer.BaseImage)
+	assert.Equal(t, []string{"directory:/workspace", "write:web/package.json", "exec:" + command}, provider.MockContainer.Operations)
+
+	provider.MockContainer.SetCommandOutput(command, "", "npm ERR! ERESOLVE unable to resolve dependency tree", 1, nil)
+	_, _, err = engine.RegenerateFile(ctx, &dagger.Directory{}, nil, generated, "web/package-lock.json")
+	assert.EqualError(t, err, generated.Command+" exited with code 1: npm ERR! ERESOLVE unable to resolve dependency tree")
+}
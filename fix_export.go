@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+)
+
+// Layout of an exported fix
+const (
+	fixManifestFile = "fix.json"
+	fixPatchFile    = "fix.patch"
+	// fixFilesDir holds the added and modified files at their repository paths
+	fixFilesDir = "files"
+)
+
+// FixManifest describes an exported fix in fix.json
+type FixManifest struct {
+	RunID      int64               `json:"run_id"` // 0 for fixes of a local failure log
+	BaseBranch string              `json:"base_branch"`
+	BaseSHA    string              `json:"base_sha"` // the commit fix.patch applies to
+	Analysis   FixManifestAnalysis `json:"analysis"`
+	Fix        FixManifestFix      `json:"fix"`
+	Files      []FixManifestFile   `json:"files"`
+	ExportedAt time.Time           `json:"exported_at"`
+}
+
+// FixManifestAnalysis summarizes the failure analysis of an exported fix
+type FixManifestAnalysis struct {
+	ID          string        `json:"id"`
+	FailureType FailureType   `json:"failure_type"`
+	Severity    SeverityLevel `json:"severity"`
+	RootCause   string        `json:"root_cause"`
+	Description string        `json:"description"`
+	Jobs        []string      `json:"jobs,omitempty"`
+}
+
+// FixManifestFix describes an exported fix and how it validated
+type FixManifestFix struct {
+	ID             string   `json:"id"`
+	Type           FixType  `json:"type"`
+	Description    string   `json:"description"`
+	Rationale      string   `json:"rationale,omitempty"`
+	Confidence     float64  `json:"confidence"`
+	Commands       []string `json:"commands,omitempty"`
+	Risks          []string `json:"risks,omitempty"`
+	GeneratedTests []string `json:"generated_tests,omitempty"`
+	TestsPassed    bool     `json:"tests_passed"`
+	Coverage       float64  `json:"coverage"`
+}
+
+// FixManifestFile is a file an exported fix adds, modifies or deletes. Deleted files are only
+// listed here and in fix.patch.
+type FixManifestFile struct {
+	Path        string          `json:"path"`
+	Operation   ChangeOperation `json:"operation"` // add, modify, delete
+	Explanation string          `json:"explanation,omitempty"`
+	// Binary files are left out of fix.patch; copy them from files/ instead
+	Binary bool `json:"binary,omitempty"`
+}
+
+// fixExport is an exported fix before it is written to a directory
+type fixExport struct {
+	manifest FixManifest
+	files    map[string]string // repository path to content of the added and modified files
+	patch    string
+}
+
+// ExportFix analyzes a workflow failure, then generates and validates fixes like AutoFix in
+// dry-run mode. Instead of opening a pull request it returns the best fix as a directory with
+// the added and modified files under files/, a fix.json manifest and a fix.patch for git apply.
+func (m *DaggerAutofix) ExportFix(ctx context.Context, runID int64) (*dagger.Directory, error) {
+	if dag == nil {
+		return nil, fmt.Errorf("dagger client not available")
+	}
+	_, export, err := m.exportFix(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	return export.directory()
+}
+
+// exportFix runs AutoFix without opening a pull request and exports the selected fix
+func (m *DaggerAutofix) exportFix(ctx context.Context, runID int64) (*AutoFixResult, *fixExport, error) {
+	result, err := m.autoFix(ctx, runID, true)
+	if err != nil {
+		return result, nil, err
+	}
+	if result.Fix == nil {
+		return result, nil, fmt.Errorf("%w: no fix to export", ErrNoValidFixes)
+	}
+
+	export, err := m.buildFixExport(ctx, runID, result.Analysis, result.Fix)
+	if err != nil {
+		return result, nil, fmt.Errorf("failed to export fix: %w", err)
+	}
+	result.Metadata["exported_files"] = len(export.manifest.Files)
+	return result, export, nil
+}
+
+// buildFixExport reads the files a fix changes from the base branch head and diffs them
+func (m *DaggerAutofix) buildFixExport(ctx context.Context, runID int64, analysis *FailureAnalysisResult, validation *FixValidationResult) (*fixExport, error) {
+	baseBranch, baseSHA, err := m.githubClient.GetBaseBranchHead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	manifest := FixManifest{RunID: runID, BaseBranch: baseBranch, BaseSHA: baseSHA}
+	return m.exportChanges(manifest, analysis, validation, func(name string) (string, bool, error) {
+		return m.githubClient.GetFileContent(ctx, name, baseSHA)
+	})
+}
+
+// exportChanges diffs the files a fix changes against their base content, which readFile
+// returns along with whether the file exists. manifest names the base the export applies to.
+func (m *DaggerAutofix) exportChanges(manifest FixManifest, analysis *FailureAnalysisResult, validation *FixValidationResult, readFile func(name string) (string, bool, error)) (*fixExport, error) {
+	// A fix may change a file more than once; the last change decides its content
+	type exportedFile struct {
+		base        string
+		exists      bool
+		content     string
+		deleted     bool
+		explanation string
+	}
+	files := make(map[string]*exportedFile)
+	var paths []string
+	fileAt := func(name string) (*exportedFile, error) {
+		if file, seen := files[name]; seen {
+			return file, nil
+		}
+		base, exists, err := readFile(name)
+		if err != nil {
+			return nil, err
+		}
+		file := &exportedFile{base: base, exists: exists, content: base}
+		files[name] = file
+		paths = append(paths, name)
+		return file, nil
+	}
+	for _, change := range validation.Fix.Changes {
+		if err := validateCodeChange(change); err != nil {
+			return nil, err
+		}
+		file, err := fileAt(path.Clean(change.FilePath))
+		if err != nil {
+			return nil, err
+		}
+		file.explanation = valueOr(change.Explanation, file.explanation)
+		if change.Operation != ChangeOperationRename {
+			file.deleted = change.Operation == ChangeOperationDelete
+			file.content = change.NewContent
+			continue
+		}
+		// A rename deletes the old path and writes its content, or NewContent, to the new one
+		moved := valueOr(change.NewContent, file.content)
+		file.deleted = true
+		target, err := fileAt(path.Clean(change.NewFilePath))
+		if err != nil {
+			return nil, err
+		}
+		target.deleted = false
+		target.content = moved
+		target.explanation = valueOr(change.Explanation, target.explanation)
+	}
+	sort.Strings(paths)
+
+	manifest.Analysis = manifestAnalysis(analysis)
+	manifest.Fix = manifestFix(validation)
+	manifest.Files = []FixManifestFile{}
+	manifest.ExportedAt = time.Now().UTC()
+	export := &fixExport{manifest: manifest, files: make(map[string]string)}
+	var patch strings.Builder
+	for _, name := range paths {
+		file := files[name]
+		operation := ChangeOperationModify
+		switch {
+		case file.deleted && !file.exists:
+			m.logger.WithField("file", name).Warn("Fix deletes a file missing from the base branch, leaving it out of the export")
+			continue
+		case file.deleted:
+			operation = ChangeOperationDelete
+		case !file.exists:
+			operation = ChangeOperationAdd
+		case file.content == file.base:
+			continue
+		}
+
+		binary := isBinaryContent(file.base) || isBinaryContent(file.content)
+		export.manifest.Files = append(export.manifest.Files, FixManifestFile{Path: name, Operation: operation, Explanation: file.explanation, Binary: binary})
+		if operation != ChangeOperationDelete {
+			export.files[name] = file.content
+		}
+		// git apply needs the full index of a binary change, which a diff of contents lacks
+		if !binary {
+			patch.WriteString(unifiedDiff(name, file.base, file.content, operation))
+		}
+	}
+	export.patch = patch.String()
+	return export, nil
+}
+
+func manifestAnalysis(analysis *FailureAnalysisResult) FixManifestAnalysis {
+	analysis = orEmptyAnalysis(analysis)
+	return FixManifestAnalysis{
+		ID:          analysis.ID,
+		FailureType: analysis.Classification.Type,
+		Severity:    analysis.Classification.Severity,
+		RootCause:   analysis.RootCause,
+		Description: analysis.Description,
+		Jobs:        analysis.Jobs,
+	}
+}
+
+func manifestFix(validation *FixValidationResult) FixManifestFix {
+	fix := validation.Fix
+	manifest := FixManifestFix{
+		ID:             fix.ID,
+		Type:           fix.Type,
+		Description:    fix.Description,
+		Rationale:      fix.Rationale,
+		Confidence:     fix.Confidence,
+		Commands:       fix.Commands,
+		Risks:          fix.Risks,
+		GeneratedTests: fix.GeneratedTests,
+	}
+	if validation.TestResult != nil {
+		manifest.TestsPassed = validation.TestResult.testsPassed()
+		manifest.Coverage = validation.TestResult.Coverage
+	}
+	return manifest
+}
+
+// entries returns the exported files keyed by their path in the export directory
+func (e *fixExport) entries() (map[string]string, error) {
+	manifest, err := json.MarshalIndent(e.manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode fix manifest: %w", err)
+	}
+	entries := map[string]string{
+		fixManifestFile: string(manifest) + "\n",
+		fixPatchFile:    e.patch,
+	}
+	for name, content := range e.files {
+		entries[path.Join(fixFilesDir, name)] = content
+	}
+	return entries, nil
+}
+
+// directory returns the export as a Dagger directory
+func (e *fixExport) directory() (*dagger.Directory, error) {
+	entries, err := e.entries()
+	if err != nil {
+		return nil, err
+	}
+	dir := dag.Directory()
+	for _, name := range sortedKeys(entries) {
+		dir = dir.WithNewFile(name, entries[name])
+	}
+	return dir, nil
+}
+
+// writeTo writes the export into dir on the local filesystem, creating it if needed
+func (e *fixExport) writeTo(dir string) error {
+	entries, err := e.entries()
+	if err != nil {
+		return err
+	}
+	for _, name := range sortedKeys(entries) {
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return fmt.Errorf("failed to create export directory: %w", err)
+		}
+		if err := os.WriteFile(target, []byte(entries[name]), 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
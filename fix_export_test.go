@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fileContentGitHub is a mockGitHub that can read files from a base branch
+type fileContentGitHub struct {
+	*mockGitHub
+	files map[string]string
+	refs  []string
+}
+
+func (g *fileContentGitHub) GetFileContent(ctx context.Context, path, ref string) (string, bool, error) {
+	g.refs = append(g.refs, ref)
+	content, ok := g.files[path]
+	return content, ok, nil
+}
+
+// exportAutofix returns an agent whose fix modifies, adds and deletes files of base
+func exportAutofix(base map[string]string, prFixes *[]*FixValidationResult) (*DaggerAutofix, *fileContentGitHub) {
+	m := fixtureAutofix(prFixes).WithGeneratedTests(true)
+	gh := &fileContentGitHub{mockGitHub: m.githubClient.(*mockGitHub), files: base}
+	gh.getBaseBranchHeadFunc = func(ctx context.Context) (string, string, error) {
+		return "main", "base123", nil
+	}
+	m.githubClient = gh
+	m.failureEngine.(*mockFailureAnalysisEngine).generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+		fix := parserFix()
+		fix.Confidence = 0.9
+		fix.Changes = append(fix.Changes,
+			CodeChange{FilePath: "parser/errors.go", Operation: ChangeOperationAdd, NewContent: "package parser\n\nvar ErrEmpty = errors.New(\"empty\")\n"},
+			CodeChange{FilePath: "parser/legacy.go", Operation: ChangeOperationDelete, Explanation: "Unused"},
+			CodeChange{FilePath: "./README.md", Operation: ChangeOperationModify, NewContent: base["README.md"]},
+		)
+		return []*ProposedFix{fix}, nil
+	}
+	return m, gh
+}
+
+// TestExportFix tests exporting a validated fix as files, a manifest and a patch that applies
+// to the base branch with git apply
+func TestExportFix(t *testing.T) {
+	base := map[string]string{
+		"parser/parser.go": "package parser\n\nfunc Parse(s string) int { return 0 }\n",
+		"parser/legacy.go": "package parser\n\nfunc legacy() {}\n",
+		"README.md":        "# parser\n",
+	}
+	var prFixes []*FixValidationResult
+	m, gh := exportAutofix(base, &prFixes)
+
+	result, export, err := m.exportFix(context.Background(), 42)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Nil(t, result.PullRequest)
+	assert.Empty(t, prFixes)
+	assert.Equal(t, 4, result.Metadata["exported_files"])
+	for _, ref := range gh.refs {
+		assert.Equal(t, "base123", ref)
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, export.writeTo(dir))
+
+	var names []string
+	require.NoError(t, filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			name, _ := filepath.Rel(dir, path)
+			names = append(names, filepath.ToSlash(name))
+		}
+		return err
+	}))
+	assert.Equal(t, []string{
+		"files/parser/errors.go",
+		"files/parser/parser.go",
+		"files/parser/parser_fix_test.go",
+		"fix.json",
+		"fix.patch",
+	}, names)
+
+	var manifest FixManifest
+	require.NoError(t, json.Unmarshal([]byte(readFile(t, filepath.Join(dir, fixManifestFile))), &manifest))
+	assert.Equal(t, int64(42), manifest.RunID)
+	assert.Equal(t, "main", manifest.BaseBranch)
+	assert.Equal(t, "base123", manifest.BaseSHA)
+	assert.Equal(t, "a1", manifest.Analysis.ID)
+	assert.Equal(t, TestFailure, manifest.Analysis.FailureType)
+	assert.Equal(t, "fix1", manifest.Fix.ID)
+	assert.Equal(t, 0.9, manifest.Fix.Confidence)
+	assert.True(t, manifest.Fix.TestsPassed)
+	assert.Equal(t, 90.0, manifest.Fix.Coverage)
+	assert.Equal(t, []string{"parser/parser_fix_test.go"}, manifest.Fix.GeneratedTests)
+	assert.Equal(t, []FixManifestFile{
+		{Path: "parser/errors.go", Operation: ChangeOperationAdd},
+		{Path: "parser/legacy.go", Operation: ChangeOperationDelete, Explanation: "Unused"},
+		{Path: "parser/parser.go", Operation: ChangeOperationModify, Explanation: "Return an error for empty input"},
+		{Path: "parser/parser_fix_test.go", Operation: ChangeOperationAdd},
+	}, manifest.Files)
+
+	repo := gitRepo(t)
+	for name, content := range base {
+		writeRepoFile(t, repo, name, content)
+	}
+	gitApply(t, repo, readFile(t, filepath.Join(dir, fixPatchFile)))
+
+	for _, file := range manifest.Files {
+		content, err := os.ReadFile(filepath.Join(repo, file.Path))
+		if file.Operation == ChangeOperationDelete {
+			assert.True(t, os.IsNotExist(err), file.Path)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, readFile(t, filepath.Join(dir, fixFilesDir, file.Path)), string(content), file.Path)
+	}
+	assert.Equal(t, base["README.md"], readFile(t, filepath.Join(repo, "README.md")))
+}
+
+// TestExportFixBinaryFiles tests that deleted binary files are listed in the manifest but left
+// out of fix.patch, which git apply could not apply. Fixes editing binary files are rejected
+// before they are exported.
+func TestExportFixBinaryFiles(t *testing.T) {
+	var prFixes []*FixValidationResult
+	m, _ := exportAutofix(map[string]string{"parser/parser.go": "package parser\n", "logo.png": "\x89PNG\x00old"}, &prFixes)
+	m.failureEngine.(*mockFailureAnalysisEngine).generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+		fix := parserFix()
+		fix.Confidence = 0.9
+		fix.Changes = append(fix.Changes, CodeChange{FilePath: "logo.png", Operation: ChangeOperationDelete})
+		return []*ProposedFix{fix}, nil
+	}
+
+	_, export, err := m.exportFix(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Contains(t, export.manifest.Files, FixManifestFile{Path: "logo.png", Operation: ChangeOperationDelete, Binary: true})
+	assert.NotContains(t, export.patch, "logo.png")
+	assert.Contains(t, export.patch, "diff --git a/parser/parser.go b/parser/parser.go\n")
+
+	m.failureEngine.(*mockFailureAnalysisEngine).generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+		fix := parserFix()
+		fix.Confidence = 0.9
+		fix.Changes = append(fix.Changes, CodeChange{FilePath: "logo.png", Operation: ChangeOperationModify, NewContent: "\x89PNG\x00new"})
+		return []*ProposedFix{fix}, nil
+	}
+	_, _, err = m.exportFix(context.Background(), 1)
+	assert.ErrorContains(t, err, "no fix passed validation")
+}
+
+// TestExportFixRenames tests that a rename exports as deleting the old path and adding the new
+// one with the old content, or the rename's new content
+func TestExportFixRenames(t *testing.T) {
+	var prFixes []*FixValidationResult
+	base := map[string]string{
+		"parser/parser.go": "package parser\n",
+		"parser/legacy.go": "package parser\n\nfunc legacy() {}\n",
+		"parser/util.go":   "package parser\n\nfunc util() {}\n",
+	}
+	m, _ := exportAutofix(base, &prFixes)
+	m.failureEngine.(*mockFailureAnalysisEngine).generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+		fix := parserFix()
+		fix.Confidence = 0.9
+		fix.Changes = append(fix.Changes,
+			CodeChange{FilePath: "parser/legacy.go", NewFilePath: "parser/compat.go", Operation: ChangeOperationRename},
+			CodeChange{FilePath: "parser/util.go", NewFilePath: "internal/util.go", Operation: ChangeOperationRename, NewContent: "package internal\n\nfunc Util() {}\n"},
+		)
+		return []*ProposedFix{fix}, nil
+	}
+
+	_, export, err := m.exportFix(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Subset(t, export.manifest.Files, []FixManifestFile{
+		{Path: "internal/util.go", Operation: ChangeOperationAdd},
+		{Path: "parser/compat.go", Operation: ChangeOperationAdd},
+		{Path: "parser/legacy.go", Operation: ChangeOperationDelete},
+		{Path: "parser/util.go", Operation: ChangeOperationDelete},
+	})
+	assert.Equal(t, base["parser/legacy.go"], export.files["parser/compat.go"])
+	assert.Equal(t, "package internal\n\nfunc Util() {}\n", export.files["internal/util.go"])
+
+	repo := gitRepo(t)
+	for name, content := range base {
+		writeRepoFile(t, repo, name, content)
+	}
+	gitApply(t, repo, export.patch)
+	assert.Equal(t, base["parser/legacy.go"], readFile(t, filepath.Join(repo, "parser/compat.go")))
+	_, err = os.Stat(filepath.Join(repo, "parser/legacy.go"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// TestExportFixErrors tests exports without a valid fix or when the base files cannot be read
+func TestExportFixErrors(t *testing.T) {
+	var prFixes []*FixValidationResult
+
+	m := fixtureAutofix(&prFixes)
+	m.githubClient.(*mockGitHub).getFileContentFunc = func(ctx context.Context, path, ref string) (string, bool, error) {
+		return "", false, fmt.Errorf("failed to get %s: forbidden", path)
+	}
+	_, _, err := m.exportFix(context.Background(), 1)
+	assert.ErrorContains(t, err, "forbidden")
+
+	m, _ = exportAutofix(map[string]string{}, &prFixes)
+	m.MinCoverage = 95
+	result, export, err := m.exportFix(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrNoValidFixes)
+	assert.Nil(t, export)
+	require.NotNil(t, result)
+	assert.False(t, result.Success)
+
+	m, _ = exportAutofix(map[string]string{}, &prFixes)
+	m.failureEngine.(*mockFailureAnalysisEngine).generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+		fix := parserFix()
+		fix.Confidence = 0.9
+		fix.Changes[0].FilePath = "../outside.go"
+		return []*ProposedFix{fix}, nil
+	}
+	_, _, err = m.exportFix(context.Background(), 1)
+	assert.Error(t, err)
+	assert.Empty(t, prFixes)
+
+	_, err = m.ExportFix(context.Background(), 1)
+	assert.EqualError(t, err, "dagger client not available")
+}
+
+// TestPrintAutoFixResultExportDir tests pointing the text output at the exported patch
+func TestPrintAutoFixResultExportDir(t *testing.T) {
+	cli, out := outputCLI(t, "text")
+	require.NoError(t, cli.printAutoFixResult(&AutoFixResult{
+		Success:  true,
+		Metadata: map[string]interface{}{"export_dir": "out"},
+	}))
+	assert.Contains(t, out.String(), "Exported Fix:\n  Directory: out\n  Apply With: git apply "+filepath.Join("out", "fix.patch"))
+	assert.False(t, strings.Contains(out.String(), "Pull Request"))
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	content, err := os.ReadFile(name)
+	require.NoError(t, err)
+	return string(content)
+}
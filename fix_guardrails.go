@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// GuardrailAction is what happens to a fix exceeding the fix guardrails
+type GuardrailAction string
+
+const (
+	// GuardrailReject fails the fix's validation without running its tests
+	GuardrailReject GuardrailAction = "reject"
+	// GuardrailDraft validates the fix but opens its pull request as a draft
+	GuardrailDraft GuardrailAction = "draft"
+	// GuardrailAnalysisOnly validates the fix but only comments the analysis
+	GuardrailAnalysisOnly GuardrailAction = "analysis-only"
+)
+
+const (
+	// DefaultMaxFixFiles is how many files a fix may change by default
+	DefaultMaxFixFiles = 10
+	// DefaultMaxFixLines is how many lines a fix may add and remove by default
+	DefaultMaxFixLines = 500
+)
+
+// defaultProtectedPaths keep fixes away from CI, container and secret files. Workflow fixes
+// may still change workflow files.
+var defaultProtectedPaths = []string{".github/workflows/**", "Dockerfile*", "**/secrets*", ".git/**"}
+
+// FixGuardrails bound how much a single fix may change. They are checked after fixes are
+// generated and before they are validated; Action decides what happens to a fix exceeding
+// them.
+type FixGuardrails struct {
+	// MaxFiles is the most files a fix may change and MaxLines the most lines it may add and
+	// remove. Zero uses the defaults and a negative value removes the limit.
+	MaxFiles int `json:"max_files"`
+	MaxLines int `json:"max_lines"`
+	// ProtectedPaths are CODEOWNERS style patterns of files no fix may change; nil uses the
+	// defaults
+	ProtectedPaths []string        `json:"protected_paths"`
+	Action         GuardrailAction `json:"action"`
+}
+
+// withDefaults fills the unset limits, protected paths and action
+func (g FixGuardrails) withDefaults() FixGuardrails {
+	if g.MaxFiles == 0 {
+		g.MaxFiles = DefaultMaxFixFiles
+	}
+	if g.MaxLines == 0 {
+		g.MaxLines = DefaultMaxFixLines
+	}
+	if g.ProtectedPaths == nil {
+		g.ProtectedPaths = defaultProtectedPaths
+	}
+	if g.Action == "" {
+		g.Action = GuardrailReject
+	}
+	return g
+}
+
+// validate checks the action and the protected path patterns
+func (g FixGuardrails) validate() error {
+	if err := validateGuardrailAction(g.Action); err != nil {
+		return err
+	}
+	for _, pattern := range g.ProtectedPaths {
+		if _, err := codeownersPattern(pattern); err != nil {
+			return fmt.Errorf("invalid protected path: %w", err)
+		}
+	}
+	return nil
+}
+
+func validateGuardrailAction(action GuardrailAction) error {
+	switch action {
+	case "", GuardrailReject, GuardrailDraft, GuardrailAnalysisOnly:
+		return nil
+	default:
+		return fmt.Errorf("unsupported guardrail action %q (expected reject, draft or analysis-only)", action)
+	}
+}
+
+// check returns how fix exceeds the guardrails, nothing when it stays within them
+func (g FixGuardrails) check(fix *ProposedFix) []string {
+	g = g.withDefaults()
+	var violations []string
+
+	files := make(map[string]bool)
+	lines := 0
+	for _, change := range fix.Changes {
+		files[change.FilePath] = true
+		lines += changedLines(change)
+	}
+	if g.MaxFiles > 0 && len(files) > g.MaxFiles {
+		violations = append(violations, fmt.Sprintf("changes %d files, more than the limit of %d", len(files), g.MaxFiles))
+	}
+	if g.MaxLines > 0 && lines > g.MaxLines {
+		violations = append(violations, fmt.Sprintf("changes %d lines, more than the limit of %d", lines, g.MaxLines))
+	}
+
+	patterns := make([]*regexp.Regexp, 0, len(g.ProtectedPaths))
+	for _, pattern := range g.ProtectedPaths {
+		// Invalid patterns are rejected when the agent is initialized
+		if expr, err := codeownersPattern(pattern); err == nil {
+			patterns = append(patterns, expr)
+		}
+	}
+	reported := make(map[string]bool)
+	for _, change := range fix.Changes {
+		for _, file := range change.paths() {
+			if reported[file] || (fix.Type == WorkflowFix && hasPathPrefix(file, workflowsDir)) {
+				continue
+			}
+			for i, expr := range patterns {
+				if expr.MatchString(file) {
+					violations = append(violations, fmt.Sprintf("changes protected path %s (%s)", file, g.ProtectedPaths[i]))
+					reported[file] = true
+					break
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// demote applies the guardrail action to the PR policy decision for a fix exceeding the
+// guardrails. Rejected fixes never pass validation, so they never get this far.
+func (g FixGuardrails) demote(decision PRPolicyDecision, fix *FixValidationResult) PRPolicyDecision {
+	if len(fix.GuardrailViolations) == 0 || decision.Action == PRPolicyAnalysisOnly {
+		return decision
+	}
+	reason := guardrailReason(fix)
+	switch g.withDefaults().Action {
+	case GuardrailAnalysisOnly:
+		return PRPolicyDecision{Action: PRPolicyAnalysisOnly, Reason: reason}
+	case GuardrailDraft:
+		return PRPolicyDecision{Action: PRPolicyDraft, Reason: reason}
+	}
+	return decision
+}
+
+// guardrailReason explains how a fix exceeds the guardrails
+func guardrailReason(fix *FixValidationResult) string {
+	return fmt.Sprintf("fix %s exceeds the fix guardrails: %s", fix.Fix.ID, strings.Join(fix.GuardrailViolations, "; "))
+}
+
+// rejectedByGuardrails returns the first validation failed by the guardrails, or nil
+func rejectedByGuardrails(validations []*FixValidationResult) *FixValidationResult {
+	for _, validation := range validations {
+		if !validation.Valid && len(validation.GuardrailViolations) > 0 {
+			return validation
+		}
+	}
+	return nil
+}
+
+// changedLines counts the lines a change adds and removes, as git diff --stat does
+func changedLines(change CodeChange) int {
+	switch change.Operation {
+	case ChangeOperationAdd:
+		return len(splitLines(change.NewContent))
+	case ChangeOperationDelete:
+		return len(splitLines(change.OldContent))
+	case ChangeOperationRename:
+		if change.NewContent == "" {
+			return 0
+		}
+	}
+	count := 0
+	for _, edit := range lineEdits(splitLines(change.OldContent), splitLines(change.NewContent)) {
+		if edit.kind != ' ' {
+			count++
+		}
+	}
+	return count
+}
+
+// fixGuardrails returns the configured guardrails with their defaults
+func (m *DaggerAutofix) fixGuardrails() FixGuardrails {
+	return m.FixGuardrails.withDefaults()
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// manyFileChanges returns modifications of n files changing one line each
+func manyFileChanges(n int) []CodeChange {
+	changes := make([]CodeChange, 0, n)
+	for i := 0; i < n; i++ {
+		changes = append(changes, CodeChange{
+			FilePath:   fmt.Sprintf("pkg/file%d.go", i),
+			Operation:  ChangeOperationModify,
+			OldContent: "a\n",
+			NewContent: "b\n",
+		})
+	}
+	return changes
+}
+
+// TestFixGuardrailsCheck tests each guardrail limit and the protected paths
+func TestFixGuardrailsCheck(t *testing.T) {
+	bigFile := CodeChange{FilePath: "pkg/big.go", Operation: ChangeOperationAdd, NewContent: strings.Repeat("line\n", 501)}
+
+	tests := []struct {
+		name       string
+		guardrails FixGuardrails
+		fix        *ProposedFix
+		want       []string
+	}{
+		{
+			name: "within the defaults",
+			fix:  &ProposedFix{Type: CodeFix, Changes: manyFileChanges(10)},
+		},
+		{
+			name: "too many files",
+			fix:  &ProposedFix{Type: CodeFix, Changes: manyFileChanges(11)},
+			want: []string{"changes 11 files, more than the limit of 10"},
+		},
+		{
+			name: "changes to the same file count once",
+			fix:  &ProposedFix{Type: CodeFix, Changes: append(manyFileChanges(10), manyFileChanges(1)...)},
+		},
+		{
+			name:       "custom file limit",
+			guardrails: FixGuardrails{MaxFiles: 2},
+			fix:        &ProposedFix{Type: CodeFix, Changes: manyFileChanges(3)},
+			want:       []string{"changes 3 files, more than the limit of 2"},
+		},
+		{
+			name:       "negative file limit removes it",
+			guardrails: FixGuardrails{MaxFiles: -1},
+			fix:        &ProposedFix{Type: CodeFix, Changes: manyFileChanges(30)},
+		},
+		{
+			name: "too many lines",
+			fix:  &ProposedFix{Type: CodeFix, Changes: []CodeChange{bigFile}},
+			want: []string{"changes 501 lines, more than the limit of 500"},
+		},
+		{
+			name:       "custom line limit counts removed and added lines",
+			guardrails: FixGuardrails{MaxLines: 3},
+			fix:        &ProposedFix{Type: CodeFix, Changes: manyFileChanges(2)},
+			want:       []string{"changes 4 lines, more than the limit of 3"},
+		},
+		{
+			name:       "negative line limit removes it",
+			guardrails: FixGuardrails{MaxLines: -1},
+			fix:        &ProposedFix{Type: CodeFix, Changes: []CodeChange{bigFile}},
+		},
+		{
+			name: "protected paths",
+			fix: &ProposedFix{Type: ConfigurationFix, Changes: []CodeChange{
+				{FilePath: "Dockerfile", Operation: ChangeOperationModify, OldContent: "FROM a\n", NewContent: "FROM b\n"},
+				{FilePath: "deploy/Dockerfile.prod", Operation: ChangeOperationDelete},
+				{FilePath: "config/secrets.yml", Operation: ChangeOperationAdd, NewContent: "token: x\n"},
+				{FilePath: ".github/workflows/ci.yml", Operation: ChangeOperationModify, NewContent: "on: push\n"},
+			}},
+			want: []string{
+				"changes protected path Dockerfile (Dockerfile*)",
+				"changes protected path deploy/Dockerfile.prod (Dockerfile*)",
+				"changes protected path config/secrets.yml (**/secrets*)",
+				"changes protected path .github/workflows/ci.yml (.github/workflows/**)",
+			},
+		},
+		{
+			name: "workflow fixes may change workflows",
+			fix: &ProposedFix{Type: WorkflowFix, Changes: []CodeChange{
+				{FilePath: ".github/workflows/ci.yml", Operation: ChangeOperationModify, NewContent: "on: push\n"},
+			}},
+		},
+		{
+			name: "renames into protected paths",
+			fix: &ProposedFix{Type: CodeFix, Changes: []CodeChange{
+				{FilePath: "build/app.docker", NewFilePath: "Dockerfile", Operation: ChangeOperationRename},
+			}},
+			want: []string{"changes protected path Dockerfile (Dockerfile*)"},
+		},
+		{
+			name:       "custom protected paths replace the defaults",
+			guardrails: FixGuardrails{ProtectedPaths: []string{"go.mod"}},
+			fix: &ProposedFix{Type: DependencyFix, Changes: []CodeChange{
+				{FilePath: "go.mod", Operation: ChangeOperationModify, NewContent: "module x\n"},
+				{FilePath: "Dockerfile", Operation: ChangeOperationModify, NewContent: "FROM b\n"},
+			}},
+			want: []string{"changes protected path go.mod (go.mod)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.guardrails.check(tt.fix))
+		})
+	}
+}
+
+// TestChangedLines tests counting the lines each kind of change adds and removes
+func TestChangedLines(t *testing.T) {
+	assert.Equal(t, 3, changedLines(CodeChange{Operation: ChangeOperationAdd, NewContent: "a\nb\nc"}))
+	assert.Equal(t, 2, changedLines(CodeChange{Operation: ChangeOperationDelete, OldContent: "a\nb\n"}))
+	assert.Equal(t, 2, changedLines(CodeChange{Operation: ChangeOperationModify, OldContent: "a\nb\nc\n", NewContent: "a\nB\nc\n"}))
+	assert.Equal(t, 0, changedLines(CodeChange{Operation: ChangeOperationRename, OldContent: "a\n"}))
+	assert.Equal(t, 1, changedLines(CodeChange{Operation: ChangeOperationRename, OldContent: "a\n", NewContent: "a\nb\n"}))
+}
+
+// TestFixGuardrailsValidate tests rejecting unknown actions and unsupported patterns
+func TestFixGuardrailsValidate(t *testing.T) {
+	assert.NoError(t, FixGuardrails{}.validate())
+	assert.NoError(t, FixGuardrails{Action: GuardrailDraft, ProtectedPaths: []string{"infra/**"}}.validate())
+
+	err := FixGuardrails{Action: "warn"}.validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unsupported guardrail action "warn"`)
+
+	err = New().WithLogsOnly(true).WithFixGuardrails(FixGuardrails{ProtectedPaths: []string{"!docs"}}).validateConfiguration()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid protected path")
+}
+
+// guardrailAutofix builds a module whose only fix changes the Dockerfile, recording the
+// PRs, commit comments and test runs
+func guardrailAutofix(created *[]createdFixPR, comments *[]postedComment, testRuns *int) *DaggerAutofix {
+	var linked []*PullRequest
+	m := strategyAutofix(created, &linked)
+	m.AnalysisComments = true
+	var mu sync.Mutex
+	m.githubClient.(*mockGitHub).createCommitCommentFunc = func(ctx context.Context, sha, body string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		*comments = append(*comments, postedComment{sha, body})
+		return nil
+	}
+	m.failureEngine.(*mockFailureAnalysisEngine).generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+		return []*ProposedFix{{ID: "docker", Type: ConfigurationFix, Confidence: 0.9, Changes: []CodeChange{
+			{FilePath: "Dockerfile", Operation: ChangeOperationModify, OldContent: "FROM golang:1.20\n", NewContent: "FROM golang:1.21\n"},
+		}}}, nil
+	}
+	m.testEngine.(*mockTestEngine).runTestsWithChangesFunc = func(ctx context.Context, source *dagger.Directory, changes []CodeChange) (*TestResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		*testRuns++
+		return &TestResult{Success: true, Coverage: 90}, nil
+	}
+	return m
+}
+
+// TestAutoFixGuardrailActions tests what happens to a fix changing a protected path under each
+// guardrail action, and how the actions combine with the PR policy
+func TestAutoFixGuardrailActions(t *testing.T) {
+	ctx := context.Background()
+	violation := "changes protected path Dockerfile (Dockerfile*)"
+
+	t.Run("Reject", func(t *testing.T) {
+		var created []createdFixPR
+		var comments []postedComment
+		var testRuns int
+		m := guardrailAutofix(&created, &comments, &testRuns)
+
+		_, err := m.AutoFix(ctx, 1)
+		require.ErrorIs(t, err, ErrNoValidFixes)
+		assert.Contains(t, err.Error(), "fix docker exceeds the fix guardrails: "+violation)
+		assert.Zero(t, testRuns, "rejected fixes are not tested")
+		assert.Empty(t, created)
+		require.Len(t, comments, 1)
+		assert.Contains(t, comments[0].body, "No proposed fix passed validation; fix docker exceeds the fix guardrails: "+violation)
+
+		validation, err := m.ValidateFix(ctx, &ProposedFix{ID: "docker", Changes: []CodeChange{{FilePath: "Dockerfile", Operation: ChangeOperationDelete}}})
+		require.NoError(t, err)
+		assert.False(t, validation.Valid)
+		assert.Equal(t, []string{violation}, validation.Errors)
+		assert.Equal(t, []string{violation}, validation.GuardrailViolations)
+	})
+
+	t.Run("Draft", func(t *testing.T) {
+		var created []createdFixPR
+		var comments []postedComment
+		var testRuns int
+		m := guardrailAutofix(&created, &comments, &testRuns).WithFixGuardrails(FixGuardrails{Action: GuardrailDraft})
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, testRuns)
+		assert.Equal(t, []createdFixPR{{"docker", true}}, created)
+		assert.Equal(t, "draft", res.Metadata["pr_policy"])
+		assert.Equal(t, "fix docker exceeds the fix guardrails: "+violation, res.Metadata["pr_policy_reason"])
+		assert.True(t, res.Fix.Valid)
+		assert.Equal(t, []string{violation}, res.Fix.Errors)
+		assert.Empty(t, comments)
+	})
+
+	t.Run("AnalysisOnly", func(t *testing.T) {
+		var created []createdFixPR
+		var comments []postedComment
+		var testRuns int
+		m := guardrailAutofix(&created, &comments, &testRuns).WithFixGuardrails(FixGuardrails{Action: GuardrailAnalysisOnly})
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, testRuns)
+		assert.Empty(t, created)
+		assert.Nil(t, res.PullRequest)
+		assert.Equal(t, "analysis-only", res.Metadata["pr_policy"])
+		require.Len(t, comments, 1)
+		assert.Contains(t, comments[0].body, "The pull request policy withheld the fix (fix docker exceeds the fix guardrails: "+violation+")")
+	})
+
+	t.Run("PolicyMinimumConfidenceStillWithholds", func(t *testing.T) {
+		var created []createdFixPR
+		var comments []postedComment
+		var testRuns int
+		m := guardrailAutofix(&created, &comments, &testRuns).
+			WithFixGuardrails(FixGuardrails{Action: GuardrailDraft}).
+			WithAutoPRPolicy(PRPolicy{MinConfidence: 0.95})
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Empty(t, created)
+		assert.Equal(t, "analysis-only", res.Metadata["pr_policy"])
+		assert.Contains(t, res.Metadata["pr_policy_reason"], "below the policy minimum")
+	})
+
+	t.Run("DraftOnlyDemotesViolatingAlternatives", func(t *testing.T) {
+		var created []createdFixPR
+		var comments []postedComment
+		var testRuns int
+		m := guardrailAutofix(&created, &comments, &testRuns).
+			WithFixGuardrails(FixGuardrails{Action: GuardrailDraft}).
+			WithFixStrategy("all")
+		m.failureEngine.(*mockFailureAnalysisEngine).generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+			return []*ProposedFix{
+				{ID: "code", Type: CodeFix, Confidence: 0.9, Changes: manyFileChanges(1)},
+				{ID: "docker", Type: ConfigurationFix, Confidence: 0.5, Changes: []CodeChange{{FilePath: "Dockerfile", Operation: ChangeOperationDelete}}},
+			}, nil
+		}
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []createdFixPR{{"code", false}, {"docker", true}}, created)
+		assert.Equal(t, "auto", res.Metadata["pr_policy"])
+	})
+
+	t.Run("AnalysisOnlySkipsViolatingAlternatives", func(t *testing.T) {
+		var created []createdFixPR
+		var comments []postedComment
+		var testRuns int
+		m := guardrailAutofix(&created, &comments, &testRuns).
+			WithFixGuardrails(FixGuardrails{Action: GuardrailAnalysisOnly}).
+			WithFixStrategy("all")
+		m.failureEngine.(*mockFailureAnalysisEngine).generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+			return []*ProposedFix{
+				{ID: "code", Type: CodeFix, Confidence: 0.9, Changes: manyFileChanges(1)},
+				{ID: "docker", Type: ConfigurationFix, Confidence: 0.5, Changes: []CodeChange{{FilePath: "Dockerfile", Operation: ChangeOperationDelete}}},
+			}, nil
+		}
+
+		_, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []createdFixPR{{"code", false}}, created)
+	})
+}
+
+// TestPRBodyListsGuardrailViolations tests that a PR for a fix exceeding the guardrails says so
+func TestPRBodyListsGuardrailViolations(t *testing.T) {
+	engine := &PullRequestEngine{}
+	fix := &FixValidationResult{
+		Fix:                 &ProposedFix{ID: "docker"},
+		Valid:               true,
+		GuardrailViolations: []string{"changes protected path Dockerfile (Dockerfile*)"},
+	}
+
+	body := engine.generatePRBody(&FailureAnalysisResult{}, fix)
+	assert.Contains(t, body, "## 🚧 Fix Guardrails\n\nThis fix exceeds the configured fix guardrails, review it with extra care:\n\n- changes protected path Dockerfile (Dockerfile*)\n")
+
+	fix.GuardrailViolations = nil
+	assert.NotContains(t, engine.generatePRBody(&FailureAnalysisResult{}, fix), "Fix Guardrails")
+}
+
+// TestFixGuardrailsConfig tests the guardrail settings from flags, environment and problems
+// reported by config validate
+func TestFixGuardrailsConfig(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("FIX_MAX_LINES", "200")
+	t.Setenv("FIX_GUARDRAIL_ACTION", "Draft")
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	require.NoError(t, cli.rootCmd.ParseFlags([]string{"--max-fix-files", "3", "--protected-path", "infra/**", "--protected-path", "go.mod"}))
+
+	config := cli.getCurrentConfig(cli.rootCmd)
+	assert.Equal(t, FixGuardrails{MaxFiles: 3, MaxLines: 200, ProtectedPaths: []string{"infra/**", "go.mod"}, Action: GuardrailDraft}, config.fixGuardrails())
+	assert.Equal(t, "env FIX_MAX_LINES", config.sources["guardrails.max_lines"].String())
+
+	defaults := NewCLI()
+	defaults.logger = quietLogger()
+	t.Setenv("FIX_MAX_LINES", "")
+	t.Setenv("FIX_GUARDRAIL_ACTION", "")
+	assert.Equal(t, FixGuardrails{MaxFiles: DefaultMaxFixFiles, MaxLines: DefaultMaxFixLines, ProtectedPaths: defaultProtectedPaths, Action: GuardrailReject},
+		defaults.getCurrentConfig(defaults.rootCmd).fixGuardrails().withDefaults())
+
+	config.GuardrailAction = "warn"
+	config.ProtectedPaths = []string{"[abc]"}
+	var keys []string
+	for _, problem := range validateCLIConfig(config) {
+		if strings.HasPrefix(problem.Key, "guardrails.") {
+			keys = append(keys, problem.Key)
+		}
+	}
+	assert.Equal(t, []string{"guardrails.action", "guardrails.protected_paths"}, keys)
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// fingerprintErrorLines is how many distinct error lines, from the top, identify a failure
+	fingerprintErrorLines = 5
+	// fixHistoryConfidenceBoost is added to the confidence of fixes that follow a previously
+	// merged fix for the same failure
+	fixHistoryConfidenceBoost = 0.15
+)
+
+var (
+	logTimestampPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T[\d:.]+Z\s*`)
+	// Timestamps, durations and absolute directories inside error lines differ between runs
+	// of the same failure, e.g. on other runners or branches
+	inlineTimestampPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[t ]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:z|[+-]\d{2}:?\d{2})?|\b\d{2}:\d{2}:\d{2}(?:\.\d+)?\b`)
+	durationPattern        = regexp.MustCompile(`\b(?:\d+(?:\.\d+)?(?:ns|µs|us|ms|h|m|s))+\b`)
+	absoluteDirPattern     = regexp.MustCompile(`(^|[\s'"(=])(?:/[\w.@+-]+)+/`)
+	hexIDPattern           = regexp.MustCompile(`\b[0-9a-f]{7,}\b`)
+	numberPattern          = regexp.MustCompile(`\d+`)
+)
+
+// FixHistoryEntry records a fix PR opened for a failure, and whether it was merged
+type FixHistoryEntry struct {
+	Fingerprint    string                `json:"fingerprint"`
+	Classification FailureClassification `json:"classification"`
+	RootCause      string                `json:"root_cause"`
+	FixType        FixType               `json:"fix_type"`
+	FixDescription string                `json:"fix_description"`
+	Summary        string                `json:"summary"` // one line per changed file, no contents
+	Files          []string              `json:"files"`
+	RunID          int64                 `json:"run_id"`
+	Workflow       string                `json:"workflow"`
+	PRNumber       int                   `json:"pr_number"`
+	PRURL          string                `json:"pr_url"`
+	State          string                `json:"state"` // TrackedPROpen or TrackedPRMerged
+	RecordedAt     time.Time             `json:"recorded_at"`
+	MergedAt       time.Time             `json:"merged_at,omitempty"`
+}
+
+// fixHistoryFile is the JSON document a fix history is stored in
+type fixHistoryFile struct {
+	Fixes []*FixHistoryEntry `json:"fixes"`
+}
+
+// fixHistory remembers the fixes opened per failure fingerprint so a recurring failure can
+// reuse the fix that was merged last time. A nil history records nothing.
+type fixHistory struct {
+	mu      sync.Mutex
+	path    string
+	entries []*FixHistoryEntry
+}
+
+// loadFixHistory reads the fix history at path. A missing file starts empty.
+func loadFixHistory(path string) (*fixHistory, error) {
+	h := &fixHistory{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fix history: %w", err)
+	}
+
+	var file fixHistoryFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse fix history %s: %w", path, err)
+	}
+	h.entries = file.Fixes
+	return h, nil
+}
+
+// record adds an entry for a newly opened fix PR
+func (h *fixHistory) record(entry *FixHistoryEntry) error {
+	if h == nil || entry.Fingerprint == "" {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, existing := range h.entries {
+		if existing.PRNumber == entry.PRNumber {
+			return nil
+		}
+	}
+	h.entries = append(h.entries, entry)
+	return h.saveLocked()
+}
+
+// resolve marks the entry of a merged PR as a successful fix and forgets PRs closed unmerged
+func (h *fixHistory) resolve(prNumber int, merged bool, at time.Time) error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, entry := range h.entries {
+		if entry.PRNumber != prNumber || entry.State != TrackedPROpen {
+			continue
+		}
+		if merged {
+			entry.State = TrackedPRMerged
+			entry.MergedAt = at
+		} else {
+			h.entries = append(h.entries[:i], h.entries[i+1:]...)
+		}
+		return h.saveLocked()
+	}
+	return nil
+}
+
+// lookup returns a copy of the most recently merged fix for a fingerprint, or nil
+func (h *fixHistory) lookup(fingerprint string) *FixHistoryEntry {
+	if h == nil || fingerprint == "" {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var latest *FixHistoryEntry
+	for _, entry := range h.entries {
+		if entry.Fingerprint == fingerprint && entry.State == TrackedPRMerged &&
+			(latest == nil || entry.MergedAt.After(latest.MergedAt)) {
+			latest = entry
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+	found := *latest
+	return &found
+}
+
+// list returns copies of every entry, most recently recorded first
+func (h *fixHistory) list() []FixHistoryEntry {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries := make([]FixHistoryEntry, 0, len(h.entries))
+	for _, entry := range h.entries {
+		entries = append(entries, *entry)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].RecordedAt.After(entries[j].RecordedAt)
+	})
+	return entries
+}
+
+func (h *fixHistory) saveLocked() error {
+	data, err := json.MarshalIndent(fixHistoryFile{Fixes: h.entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode fix history: %w", err)
+	}
+	if err := writeFileAtomic(h.path, ".autofix-history-*", data); err != nil {
+		return fmt.Errorf("failed to write fix history: %w", err)
+	}
+	return nil
+}
+
+// failureFingerprint hashes the top distinct error lines of a failure with timestamps,
+// numbers and hex identifiers normalized away, so a recurring failure hashes the same in
+// every run. Logs without error lines have no fingerprint.
+func failureFingerprint(logs *WorkflowLogs) string {
+	if logs == nil {
+		return ""
+	}
+
+	var lines []string
+	for _, line := range logs.ErrorLines {
+		normalized := normalizeErrorLine(line)
+		if normalized == "" || containsString(lines, normalized) {
+			continue
+		}
+		lines = append(lines, normalized)
+		if len(lines) == fingerprintErrorLines {
+			break
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// normalizeErrorLine reduces an error line to what stays the same across runs of a failure
+func normalizeErrorLine(line string) string {
+	line = logTimestampPattern.ReplaceAllString(strings.TrimSpace(line), "")
+	line = strings.ToLower(line)
+	line = inlineTimestampPattern.ReplaceAllString(line, "<time>")
+	line = durationPattern.ReplaceAllString(line, "<duration>")
+	line = absoluteDirPattern.ReplaceAllString(line, "$1")
+	line = hexIDPattern.ReplaceAllString(line, "<id>")
+	line = numberPattern.ReplaceAllString(line, "<n>")
+	return strings.Join(strings.Fields(line), " ")
+}
+
+func containsString(list []string, value string) bool {
+	for _, existing := range list {
+		if existing == value {
+			return true
+		}
+	}
+	return false
+}
+
+// fixHistoryEntry describes a fix PR for the history; file contents are never stored
+func fixHistoryEntry(analysis *FailureAnalysisResult, fix *ProposedFix, pr *PullRequest) *FixHistoryEntry {
+	fingerprint := analysis.Fingerprint
+	if fingerprint == "" {
+		fingerprint = failureFingerprint(analysis.Context.Logs)
+	}
+
+	entry := &FixHistoryEntry{
+		Fingerprint:    fingerprint,
+		Classification: analysis.Classification,
+		RootCause:      analysis.RootCause,
+		FixType:        fix.Type,
+		FixDescription: fix.Description,
+		PRNumber:       pr.Number,
+		PRURL:          pr.URL,
+		State:          TrackedPROpen,
+		RecordedAt:     time.Now(),
+	}
+	if run := analysis.Context.WorkflowRun; run != nil {
+		entry.RunID = run.ID
+		entry.Workflow = run.Name
+	}
+	var summary []string
+	for _, change := range fix.Changes {
+		entry.Files = appendMissing(entry.Files, change.paths()...)
+		line := fmt.Sprintf("- %s %s", valueOr(string(change.Operation), "change"), change.displayPath())
+		if change.Explanation != "" {
+			line += ": " + change.Explanation
+		}
+		summary = append(summary, line)
+	}
+	entry.Summary = strings.Join(summary, "\n")
+	return entry
+}
+
+// recordFixHistory remembers a newly opened fix PR so its fix can be reused once merged
+func (m *DaggerAutofix) recordFixHistory(analysis *FailureAnalysisResult, fix *ProposedFix, pr *PullRequest) {
+	if m.history == nil || fix == nil {
+		return
+	}
+	if err := m.history.record(fixHistoryEntry(analysis, fix, pr)); err != nil {
+		m.logger.WithError(err).WithField("pr_number", pr.Number).Warn("Failed to record fix history")
+	}
+}
+
+// resolveFixHistory records the outcome of a tracked fix PR in the fix history
+func (m *DaggerAutofix) resolveFixHistory(prNumber int, merged bool) {
+	if err := m.history.resolve(prNumber, merged, time.Now()); err != nil {
+		m.logger.WithError(err).WithField("pr_number", prNumber).Warn("Failed to update fix history")
+	}
+}
+
+// applyFixHistoryPrior raises the confidence of fixes that change the files the previously
+// merged fix for the failure changed, or that are of its type when it changed no files
+func applyFixHistoryPrior(fixes []*ProposedFix, previous *FixHistoryEntry) {
+	if previous == nil {
+		return
+	}
+	for _, fix := range fixes {
+		follows := len(previous.Files) == 0 && fix.Type == previous.FixType
+		for _, change := range fix.Changes {
+			if containsString(previous.Files, change.FilePath) {
+				follows = true
+				break
+			}
+		}
+		if follows {
+			fix.Confidence = math.Min(fix.Confidence+fixHistoryConfidenceBoost, 1)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFailureFingerprint tests that recurring failures hash the same across runs
+func TestFailureFingerprint(t *testing.T) {
+	first := &WorkflowLogs{ErrorLines: []string{
+		"2024-03-01T12:00:03.123Z --- FAIL: TestParse (0.02s)",
+		"2024-03-01T12:00:03.124Z parser_test.go:42: unexpected token at offset 17",
+		"2024-03-01T12:00:03.124Z parser_test.go:42: unexpected token at offset 17",
+		"2024-03-01T12:00:04Z exit status 1 in container 3f9a8c2d1e",
+	}}
+	recurring := &WorkflowLogs{ErrorLines: []string{
+		"2024-05-09T08:30:00.999Z --- FAIL: TestParse (0.05s)",
+		"2024-05-09T08:30:01.000Z parser_test.go:44:   unexpected token at offset 9",
+		"2024-05-09T08:30:02Z exit status 1 in container a7b6c5d4e3",
+	}}
+	other := &WorkflowLogs{ErrorLines: []string{"--- FAIL: TestLexer (0.01s)"}}
+
+	fingerprint := failureFingerprint(first)
+	assert.Len(t, fingerprint, 16)
+	assert.Equal(t, fingerprint, failureFingerprint(recurring))
+	assert.NotEqual(t, fingerprint, failureFingerprint(other))
+	assert.Empty(t, failureFingerprint(&WorkflowLogs{}))
+	assert.Empty(t, failureFingerprint(nil))
+
+	// Timestamps, durations and absolute directories inside the lines do not count
+	assert.Equal(t,
+		failureFingerprint(&WorkflowLogs{ErrorLines: []string{"[2024-03-01 12:00:03] build failed after 1m2.5s in /home/runner/work/app/app/src/main.go"}}),
+		failureFingerprint(&WorkflowLogs{ErrorLines: []string{"[2024-05-09 08:30:00] build failed after 350ms in /tmp/build-42/src/main.go"}}))
+	assert.NotEqual(t,
+		failureFingerprint(&WorkflowLogs{ErrorLines: []string{"build failed in /app/src/main.go"}}),
+		failureFingerprint(&WorkflowLogs{ErrorLines: []string{"build failed in /app/src/util.go"}}))
+}
+
+// TestFixHistory tests recording fixes, resolving their PRs and reloading the file
+func TestFixHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fix-history.json")
+	history, err := loadFixHistory(path)
+	require.NoError(t, err)
+	assert.Empty(t, history.list())
+
+	require.NoError(t, history.record(&FixHistoryEntry{Fingerprint: "f1", PRNumber: 10, State: TrackedPROpen, RecordedAt: time.Now().Add(-time.Hour)}))
+	require.NoError(t, history.record(&FixHistoryEntry{Fingerprint: "f1", PRNumber: 11, State: TrackedPROpen, RecordedAt: time.Now()}))
+	require.NoError(t, history.record(&FixHistoryEntry{Fingerprint: "f2", PRNumber: 12, State: TrackedPROpen, RecordedAt: time.Now()}))
+	require.NoError(t, history.record(&FixHistoryEntry{PRNumber: 13}), "failures without a fingerprint are not recorded")
+	assert.Nil(t, history.lookup("f1"), "open fixes are not reused")
+
+	merged := time.Now()
+	require.NoError(t, history.resolve(10, true, merged.Add(-time.Minute)))
+	require.NoError(t, history.resolve(11, true, merged))
+	require.NoError(t, history.resolve(12, false, merged))
+
+	previous := history.lookup("f1")
+	require.NotNil(t, previous)
+	assert.Equal(t, 11, previous.PRNumber, "the most recently merged fix is reused")
+	assert.Nil(t, history.lookup("f2"), "fixes closed without merging are forgotten")
+
+	reloaded, err := loadFixHistory(path)
+	require.NoError(t, err)
+	entries := reloaded.list()
+	require.Len(t, entries, 2)
+	assert.Equal(t, 11, entries[0].PRNumber)
+	assert.Equal(t, TrackedPRMerged, entries[1].State)
+
+	var nilHistory *fixHistory
+	assert.NoError(t, nilHistory.record(&FixHistoryEntry{Fingerprint: "f1"}))
+	assert.Nil(t, nilHistory.lookup("f1"))
+}
+
+// TestRecurringFailureReusesFix tests that a repeat failure carries the merged fix into the
+// fix generation prompt and boosts the fixes that follow it
+func TestRecurringFailureReusesFix(t *testing.T) {
+	logs := &WorkflowLogs{ErrorLines: []string{"--- FAIL: TestParse (0.02s)", "parser_test.go:42: unexpected token"}}
+	history, err := loadFixHistory(filepath.Join(t.TempDir(), "fix-history.json"))
+	require.NoError(t, err)
+	require.NoError(t, history.record(&FixHistoryEntry{
+		Fingerprint:    failureFingerprint(logs),
+		RootCause:      "Parser rejects trailing commas",
+		FixType:        CodeFix,
+		FixDescription: "Accept trailing commas in lists",
+		Summary:        "- modify parser/parser.go: skip trailing comma",
+		Files:          []string{"parser/parser.go"},
+		PRNumber:       12,
+		State:          TrackedPROpen,
+	}))
+	require.NoError(t, history.resolve(12, true, time.Now()))
+
+	llm := &mockLLMClient{response: &LLMResponse{Content: `{"root_cause": "Parser rejects trailing commas", "failure_type": "test_failure", "confidence": 0.8}`}}
+	engine := &FailureAnalysisEngine{
+		llmClient: llm,
+		logger:    quietLogger(),
+		patterns:  loadErrorPatterns(),
+		prompts:   loadPromptTemplates(),
+	}
+	engine.SetFixHistory(history)
+
+	ctx := context.Background()
+	analysis, err := engine.AnalyzeFailure(ctx, FailureContext{WorkflowRun: &WorkflowRun{ID: 2}, Logs: logs})
+	require.NoError(t, err)
+	require.NotNil(t, analysis.PreviousFix)
+	assert.Equal(t, 12, analysis.PreviousFix.PRNumber)
+	assert.Equal(t, failureFingerprint(logs), analysis.Fingerprint)
+
+	llm.response = &LLMResponse{Content: `[
+		{"type": "code_fix", "description": "Accept trailing commas", "confidence": 0.7,
+		 "changes": [{"file_path": "parser/parser.go", "operation": "modify", "new_content": "package parser"}]},
+		{"type": "code_fix", "description": "Strip commas in the lexer", "confidence": 0.6,
+		 "changes": [{"file_path": "parser/lexer.go", "operation": "modify", "new_content": "package parser"}]}
+	]`}
+	fixes, err := engine.GenerateFixes(ctx, analysis)
+	require.NoError(t, err)
+
+	prompt := llm.requests[len(llm.requests)-1].Prompt
+	assert.Contains(t, prompt, "## Previously Successful Fix")
+	assert.Contains(t, prompt, "fixed by PR #12")
+	assert.Contains(t, prompt, "**Fix Description**: Accept trailing commas in lists")
+	assert.Contains(t, prompt, "- modify parser/parser.go: skip trailing comma")
+
+	require.Len(t, fixes, 2)
+	assert.InDelta(t, 0.7+fixHistoryConfidenceBoost, fixes[0].Confidence, 1e-9)
+	assert.InDelta(t, 0.6, fixes[1].Confidence, 1e-9, "fixes touching other files are not boosted")
+
+	body := (&PullRequestEngine{}).generatePRBody(analysis, &FixValidationResult{Fix: fixes[0]})
+	assert.Contains(t, body, "Similar failure previously fixed in PR #12")
+
+	t.Run("FirstOccurrence", func(t *testing.T) {
+		analysis, err := engine.AnalyzeFailure(ctx, FailureContext{WorkflowRun: &WorkflowRun{ID: 3}, Logs: &WorkflowLogs{ErrorLines: []string{"build failed"}}})
+		require.NoError(t, err)
+		assert.Nil(t, analysis.PreviousFix)
+		_, err = engine.GenerateFixes(ctx, analysis)
+		require.NoError(t, err)
+		assert.NotContains(t, llm.requests[len(llm.requests)-1].Prompt, "Previously Successful Fix")
+	})
+}
+
+// TestAutoFixRecordsFixHistory tests that fix PRs are remembered and become reusable once merged
+func TestAutoFixRecordsFixHistory(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "fix-history.json")
+	statuses := map[int]*PullRequest{100: {Number: 100, State: "closed", Merged: true}}
+	m := trackingAutofix("", statuses, make(map[int]string))
+	logs := &WorkflowLogs{ErrorLines: []string{"--- FAIL: TestParse (0.02s)"}}
+	m.githubClient.(*mockGitHub).getWorkflowLogsFunc = func(ctx context.Context, runID int64) (*WorkflowLogs, error) {
+		return logs, nil
+	}
+	history, err := loadFixHistory(path)
+	require.NoError(t, err)
+	m.history = history
+
+	_, err = m.AutoFix(ctx, 100)
+	require.NoError(t, err)
+	entries := history.list()
+	require.Len(t, entries, 1)
+	assert.Equal(t, failureFingerprint(logs), entries[0].Fingerprint)
+	assert.Equal(t, TrackedPROpen, entries[0].State)
+	assert.Equal(t, "CI", entries[0].Workflow)
+	assert.NotEmpty(t, entries[0].Files)
+	assert.NotContains(t, entries[0].Summary, "package parser", "file contents are not stored")
+
+	require.NoError(t, m.ReconcilePRs(ctx))
+	previous := history.lookup(failureFingerprint(logs))
+	require.NotNil(t, previous)
+	assert.Equal(t, 100, previous.PRNumber)
+}
+
+// TestStatusHistoryCommand tests printing the fix history without credentials
+func TestStatusHistoryCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fix-history.json")
+	history, err := loadFixHistory(path)
+	require.NoError(t, err)
+	require.NoError(t, history.record(&FixHistoryEntry{
+		Fingerprint:    "0123456789abcdef",
+		Classification: FailureClassification{Type: TestFailure},
+		FixDescription: "Accept trailing commas in lists",
+		Files:          []string{"parser/parser.go"},
+		RunID:          41,
+		Workflow:       "CI",
+		PRNumber:       12,
+		State:          TrackedPROpen,
+		RecordedAt:     time.Now(),
+	}))
+
+	run := func(args ...string) (string, error) {
+		clearConfigEnv(t)
+		cli := NewCLI()
+		cli.logger = quietLogger()
+		var out bytes.Buffer
+		cli.rootCmd.SetOut(&out)
+		cli.rootCmd.SetErr(&out)
+		cli.rootCmd.SetArgs(args)
+		err := cli.Execute()
+		return out.String(), err
+	}
+
+	out, err := run("status", "--history", "--fix-history", path)
+	require.NoError(t, err)
+	assert.Contains(t, out, "=== Fix History ===")
+	assert.Contains(t, out, "PR #12 [open] test: Accept trailing commas in lists")
+	assert.Contains(t, out, "Run: CI #41")
+	assert.Contains(t, out, "Files: parser/parser.go")
+
+	out, err = run("status", "--history", "--fix-history", path, "--output", "json")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"fingerprint": "0123456789abcdef"`)
+
+	_, err = run("status", "--history")
+	assert.ErrorContains(t, err, "no fix history configured")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Lengths of the hashes in analysis IDs, fix IDs and branch names
+const (
+	analysisHashLength  = 8
+	changeSetHashLength = 6
+)
+
+// shortHash returns the first length hex digits of the sha256 of value
+func shortHash(value string, length int) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])[:length]
+}
+
+// analysisID identifies the analysis of a run's failure by the run and its failure
+// fingerprint, so analysing the same failure again gives the same ID. Logs without error
+// lines have no fingerprint and are hashed whole instead.
+func analysisID(runID int64, fingerprint string, logs *WorkflowLogs) string {
+	hash := fingerprint
+	if hash == "" {
+		var raw string
+		if logs != nil {
+			raw = logs.RawLogs
+		}
+		hash = shortHash(raw, analysisHashLength)
+	}
+	return fmt.Sprintf("analysis-%d-%s", runID, hash[:min(len(hash), analysisHashLength)])
+}
+
+// fixID identifies the index-th fix proposed for an analysis by its changes, so regenerating
+// the same fix gives the same ID and different fixes never share one
+func fixID(analysisID string, index int, changes []CodeChange) string {
+	return fmt.Sprintf("%s-fix-%d-%s", analysisID, index, changeSetHash(changes))
+}
+
+// changeSetHash hashes what a fix changes: the operation, paths and new content of every change
+func changeSetHash(changes []CodeChange) string {
+	var set strings.Builder
+	for _, change := range changes {
+		fmt.Fprintf(&set, "%s\x00%s\x00%s\x00%s\x00", change.Operation, change.FilePath, change.NewFilePath, change.NewContent)
+	}
+	return shortHash(set.String(), changeSetHashLength)
+}
+
+// branchHash names an analysis in its fix branches. Analysis IDs already end in a hash, but
+// job analyses and combined analyses append to it, so the whole ID is hashed.
+func branchHash(analysis *FailureAnalysisResult) string {
+	return shortHash(analysis.ID, analysisHashLength)
+}
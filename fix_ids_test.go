@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAnalysisID tests that analyses of the same failure get the same ID in every attempt
+func TestAnalysisID(t *testing.T) {
+	logs := &WorkflowLogs{ErrorLines: []string{"2026-01-02T03:04:05Z Error: cannot find module 'lodash'"}}
+	retried := &WorkflowLogs{ErrorLines: []string{"2026-01-09T10:11:12Z Error: cannot find module 'lodash'"}}
+	other := &WorkflowLogs{ErrorLines: []string{"Error: expected 3, got 4 in sum.test.js"}}
+
+	id := analysisID(42, failureFingerprint(logs), logs)
+	assert.Regexp(t, `^analysis-42-[0-9a-f]{8}$`, id)
+	assert.Equal(t, id, analysisID(42, failureFingerprint(retried), retried), "timestamps do not change the ID")
+	assert.NotEqual(t, id, analysisID(42, failureFingerprint(other), other))
+	assert.NotEqual(t, id, analysisID(43, failureFingerprint(logs), logs))
+
+	// Without error lines the logs are hashed instead
+	raw := &WorkflowLogs{RawLogs: "Process completed with exit code 1"}
+	assert.Equal(t, analysisID(42, "", raw), analysisID(42, "", raw))
+	assert.NotEqual(t, analysisID(42, "", raw), analysisID(42, "", &WorkflowLogs{RawLogs: "Killed"}))
+	assert.Regexp(t, `^analysis-42-[0-9a-f]{8}$`, analysisID(42, "", nil))
+}
+
+// TestFixIDs tests that regenerating the same fixes gives the same IDs, and fixes with other
+// changes different ones
+func TestFixIDs(t *testing.T) {
+	engine := NewFailureAnalysisEngine(nil, quietLogger())
+	analysis := &FailureAnalysisResult{ID: "analysis-42-1a2b3c4d"}
+	content := `[
+		{"type": "code", "changes": [{"file_path": "src/sum.js", "operation": "modify", "new_content": "return Number(a) + Number(b)"}]},
+		{"type": "code", "changes": [{"file_path": "src/sum.js", "operation": "modify", "new_content": "return +a + +b"}]}
+	]`
+
+	first, err := engine.parseFixesResponse(content, analysis)
+	require.NoError(t, err)
+	retried, err := engine.parseFixesResponse(content, analysis)
+	require.NoError(t, err)
+	require.Len(t, first, 2)
+	assert.Regexp(t, `^analysis-42-1a2b3c4d-fix-1-[0-9a-f]{6}$`, first[0].ID)
+	assert.Regexp(t, `^analysis-42-1a2b3c4d-fix-2-[0-9a-f]{6}$`, first[1].ID)
+	assert.Equal(t, first[0].ID, retried[0].ID)
+	assert.Equal(t, first[1].ID, retried[1].ID)
+	assert.NotEqual(t, changeSetHash(first[0].Changes), changeSetHash(first[1].Changes))
+	assert.Equal(t, testBranchName(first[0], 1), testBranchName(retried[0], 1), "a retried validation reuses the test branch")
+
+	renamed := []CodeChange{{FilePath: "a.go", NewFilePath: "b.go", Operation: ChangeOperationRename}}
+	moved := []CodeChange{{FilePath: "a.go", NewFilePath: "c.go", Operation: ChangeOperationRename}}
+	assert.NotEqual(t, changeSetHash(renamed), changeSetHash(moved))
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// errReviewAborted is returned when the reviewer aborts without opening a pull request
+var errReviewAborted = errors.New("fix review aborted, no pull request created")
+
+// fixReview holds the candidate fixes for a failure, for a reviewer to choose from
+type fixReview struct {
+	runID    int64
+	start    time.Time
+	analysis *FailureAnalysisResult
+	// candidates are in the order they were generated. Fixes that failed validation are
+	// kept so the reviewer sees why.
+	candidates []*FixValidationResult
+}
+
+// reviewFixes analyzes a failure, then generates and validates fixes like AutoFix, leaving
+// the choice of the fix to open a pull request for to the caller
+func (m *DaggerAutofix) reviewFixes(ctx context.Context, runID int64) (*fixReview, error) {
+	if err := validateRunID(runID); err != nil {
+		return nil, err
+	}
+	if err := m.ensureInitialized(); err != nil {
+		return nil, err
+	}
+	review := &fixReview{runID: runID, start: time.Now()}
+	ctx = withAuditRun(ctx, m.auditLog, runID)
+
+	analyses, err := m.AnalyzeFailureJobs(ctx, runID)
+	if err != nil {
+		return nil, fmt.Errorf("failure analysis failed: %w", err)
+	}
+	review.analysis, _ = analysisToFix(analyses)
+	if insufficientData(review.analysis) {
+		return nil, fmt.Errorf("%w: %s", ErrLogsUnavailable, review.analysis.RootCause)
+	}
+	setAuditAnalysis(ctx, review.analysis.ID)
+
+	fixes, err := m.generateFixes(ctx, review.analysis)
+	if err != nil {
+		return nil, fmt.Errorf("fix generation failed: %w", err)
+	}
+	if len(fixes) == 0 {
+		return nil, fmt.Errorf("%w generated", ErrNoValidFixes)
+	}
+	for _, fix := range fixes {
+		validation, err := m.ValidateFix(ctx, fix)
+		if err != nil {
+			m.logger.WithError(err).WithField("fix_id", fix.ID).Warn("Fix validation failed")
+			validation = &FixValidationResult{Fix: fix, Errors: []string{err.Error()}, Timestamp: time.Now()}
+		}
+		review.candidates = append(review.candidates, validation)
+	}
+	return review, nil
+}
+
+// openReviewedPR opens a pull request for the fix a reviewer chose, or only previews it in
+// dry-run mode. The PR policy and fix strategy are not applied, except that the policy can
+// still make the pull request a draft, as exceeding the fix guardrails does.
+func (m *DaggerAutofix) openReviewedPR(ctx context.Context, review *fixReview, fix *FixValidationResult, opts FixPROptions, dryRun bool) (*AutoFixResult, error) {
+	if !fix.Valid {
+		return nil, fmt.Errorf("%w: fix %s did not pass validation", ErrNoValidFixes, fix.Fix.ID)
+	}
+	ctx = withAuditRun(ctx, m.auditLog, review.runID)
+	setAuditAnalysis(ctx, review.analysis.ID)
+
+	result := &AutoFixResult{
+		ID:       fmt.Sprintf("autofix-%d-%d", review.runID, review.start.Unix()),
+		Analysis: review.analysis,
+		Fix:      fix,
+		Metadata: map[string]interface{}{
+			"fixes_generated":         len(review.candidates),
+			"fixes_validated":         countValidFixes(review.candidates),
+			"selected_fix_confidence": fix.Fix.Confidence,
+			"llm_provider":            string(m.LLMProvider),
+			"reviewed":                true,
+		},
+	}
+	finish := func() *AutoFixResult {
+		result.Timestamp = time.Now()
+		result.Duration = result.Timestamp.Sub(review.start)
+		return result
+	}
+
+	if dryRun {
+		m.applyDryRun(ctx, result)
+		result.Success = true
+		return finish(), nil
+	}
+
+	// The fix was reviewed, so a repository configuration adds reviewers and drafts but does not
+	// withhold it
+	settings := m.mergeRepoConfig(m.repoConfig(ctx))
+	opts.Draft = opts.Draft || len(fix.GuardrailViolations) > 0 || settings.PRPolicy.decide(review.analysis, fix).Action == PRPolicyDraft
+	opts.Reviewers, opts.TeamReviewers = settings.Reviewers, settings.TeamReviewers
+	pr, err := m.prEngine.CreateFixPRWithOptions(ctx, review.analysis, fix, opts)
+	if err != nil {
+		return nil, fmt.Errorf("PR creation failed: %w", err)
+	}
+	if pr == nil {
+		return nil, fmt.Errorf("no pull request returned for fix %s", fix.Fix.ID)
+	}
+	if pr.Existing {
+		result.Metadata["existing_pr"] = true
+	} else {
+		m.recordFixPR(ctx, review.analysis, fix, pr, opts)
+	}
+	m.trackPRs(review.analysis.Context.WorkflowRun, review.analysis.Classification.Type, []*PullRequest{pr})
+
+	result.PullRequest = pr
+	result.PullRequests = []*PullRequest{pr}
+	result.Success = true
+	m.logger.WithFields(logrus.Fields{
+		"fix_id":    fix.Fix.ID,
+		"pr_number": pr.Number,
+		"pr_url":    pr.URL,
+	}).Info("Reviewed fix pull request opened")
+	return finish(), nil
+}
+
+// fixReviewOptions are the fix command flags that pick the fix instead of AutoFix
+type fixReviewOptions struct {
+	interactive bool
+	selected    int // 1-based index of the fix to open a pull request for, 0 to ask
+	dryRun      bool
+}
+
+// validate checks the review flags before the agent spends an analysis on them
+func (o fixReviewOptions) validate(in io.Reader) error {
+	if o.selected < 0 {
+		return fmt.Errorf("invalid --select %d: fixes are numbered from 1", o.selected)
+	}
+	if o.interactive && o.selected == 0 && !stdinIsTerminal(in) {
+		return fmt.Errorf("--interactive needs a terminal on stdin; drop --interactive, or pick a fix with --select N")
+	}
+	return nil
+}
+
+// reviewFix lets the user pick the fix to open a pull request for, either by the --select
+// index or by prompting. Prompts are written to stderr so stdout only carries the result.
+func (c *CLI) reviewFix(ctx context.Context, agent *DaggerAutofix, runID int64, opts fixReviewOptions) error {
+	in := c.rootCmd.InOrStdin()
+	review, err := agent.reviewFixes(ctx, runID)
+	if err != nil {
+		return fmt.Errorf("fix review failed: %w", err)
+	}
+
+	var fix *FixValidationResult
+	var prOpts FixPROptions
+	if opts.selected > 0 {
+		if opts.selected > len(review.candidates) {
+			return fmt.Errorf("invalid --select %d: only %d fixes were generated", opts.selected, len(review.candidates))
+		}
+		fix = review.candidates[opts.selected-1]
+	} else {
+		session := &fixReviewSession{prompter: newPrompter(in, c.rootCmd.ErrOrStderr()), review: review, preview: agent.prEngine.PreviewFixPR}
+		if fix, prOpts, err = session.run(); err != nil {
+			if errors.Is(err, errReviewAborted) {
+				fmt.Fprintln(c.rootCmd.ErrOrStderr(), "Aborted, no pull request created")
+				return nil
+			}
+			return err
+		}
+	}
+
+	result, err := agent.openReviewedPR(ctx, review, fix, prOpts, opts.dryRun)
+	if err != nil {
+		return fmt.Errorf("auto-fix failed: %w", err)
+	}
+	return c.printAutoFixResult(result)
+}
+
+// fixReviewSession prompts for the fix to open a pull request for and its title and body
+type fixReviewSession struct {
+	*prompter
+	review  *fixReview
+	preview func(analysis *FailureAnalysisResult, fix *FixValidationResult) *PRCreationOptions
+}
+
+// run shows the candidate fixes and asks until one is confirmed, or the reviewer aborts
+func (s *fixReviewSession) run() (*FixValidationResult, FixPROptions, error) {
+	s.writeCandidates()
+	for {
+		fix, err := s.choose()
+		if err != nil {
+			return nil, FixPROptions{}, err
+		}
+		plan := s.preview(s.review.analysis, fix)
+		opts := FixPROptions{Title: plan.Title, Body: plan.Body}
+		reselect, err := s.edit(&opts)
+		if err != nil {
+			return nil, FixPROptions{}, err
+		}
+		if !reselect {
+			return fix, opts, nil
+		}
+	}
+}
+
+// writeCandidates lists each fix with its confidence, risks, validation result and diff
+func (s *fixReviewSession) writeCandidates() {
+	fmt.Fprintf(s.out, "\n=== Candidate Fixes for Run %d ===\n", s.review.runID)
+	if rootCause := s.review.analysis.RootCause; rootCause != "" {
+		fmt.Fprintf(s.out, "Root Cause: %s\n", rootCause)
+	}
+	for i, candidate := range s.review.candidates {
+		fix := candidate.Fix
+		fmt.Fprintf(s.out, "\nFix %d: %s\n", i+1, fix.Description)
+		fmt.Fprintf(s.out, "  ID: %s\n", fix.ID)
+		fmt.Fprintf(s.out, "  Type: %s\n", fix.Type)
+		fmt.Fprintf(s.out, "  Confidence: %.1f%%\n", fix.Confidence*100)
+		if candidate.TestResult != nil {
+			fmt.Fprintf(s.out, "  Validation: valid=%t, tests passed=%t, coverage %.1f%%\n", candidate.Valid, candidate.TestResult.testsPassed(), candidate.TestResult.Coverage)
+		} else {
+			fmt.Fprintf(s.out, "  Validation: valid=%t\n", candidate.Valid)
+		}
+		for _, msg := range candidate.Errors {
+			fmt.Fprintf(s.out, "    ! %s\n", msg)
+		}
+		if len(fix.Risks) > 0 {
+			fmt.Fprintf(s.out, "  Risks:\n")
+			for _, risk := range fix.Risks {
+				fmt.Fprintf(s.out, "    - %s\n", risk)
+			}
+		}
+		if len(fix.Changes) > 0 {
+			fmt.Fprintf(s.out, "  Changes:\n")
+			for _, change := range fix.Changes {
+				fmt.Fprintf(s.out, "    - %s: %s\n", change.Operation, change.displayPath())
+				printChangeDiff(s.out, change)
+			}
+		}
+	}
+	fmt.Fprintln(s.out)
+}
+
+// choose asks for the number of a valid fix
+func (s *fixReviewSession) choose() (*FixValidationResult, error) {
+	for {
+		answer, eof := s.ask(fmt.Sprintf("Select a fix to open a pull request for (1-%d), or q to abort", len(s.review.candidates)), "")
+		if answer == "q" || answer == "quit" || answer == "abort" {
+			return nil, errReviewAborted
+		}
+		n, err := strconv.Atoi(answer)
+		switch {
+		case err != nil || n < 1 || n > len(s.review.candidates):
+			if eof {
+				return nil, fmt.Errorf("input ended before a fix was selected")
+			}
+			fmt.Fprintf(s.out, "Enter a number between 1 and %d\n", len(s.review.candidates))
+		case !s.review.candidates[n-1].Valid:
+			if eof {
+				return nil, fmt.Errorf("input ended before a fix was selected")
+			}
+			fmt.Fprintf(s.out, "Fix %d did not pass validation, select another one\n", n)
+		default:
+			return s.review.candidates[n-1], nil
+		}
+	}
+}
+
+// edit shows the pull request title and body and lets the reviewer change them before
+// creating it. It reports whether the reviewer wants to select another fix.
+func (s *fixReviewSession) edit(opts *FixPROptions) (bool, error) {
+	for {
+		fmt.Fprintf(s.out, "\nPull Request Title: %s\n\n%s\n\n", opts.Title, opts.Body)
+		answer, eof := s.ask("[c]reate pull request, edit [t]itle, edit [b]ody, [s]elect another fix or [a]bort", "")
+		switch strings.ToLower(answer) {
+		case "c", "create":
+			return false, nil
+		case "t", "title":
+			if title, _ := s.ask("New title", opts.Title); strings.TrimSpace(title) != "" {
+				opts.Title = title
+			}
+		case "b", "body":
+			opts.Body = s.readBody(opts.Body)
+		case "s", "select":
+			return true, nil
+		case "a", "abort", "q", "quit":
+			return false, errReviewAborted
+		default:
+			if eof {
+				return false, fmt.Errorf("input ended before the pull request was confirmed")
+			}
+			fmt.Fprintf(s.out, "Unknown choice %q\n", answer)
+		}
+	}
+}
+
+// readBody reads a new pull request body up to a line with a single ".", keeping current
+// when nothing is entered
+func (s *fixReviewSession) readBody(current string) string {
+	fmt.Fprintln(s.out, `Enter the new body, ending with a line containing only "." (nothing keeps the current body):`)
+	var lines []string
+	for {
+		line, err := s.in.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line == "." || (err != nil && line == "") {
+			break
+		}
+		lines = append(lines, line)
+		if err != nil {
+			break
+		}
+	}
+	if len(lines) == 0 {
+		return current
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
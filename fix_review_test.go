@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reviewAutofix returns an agent proposing three fixes, the last of which fails its tests,
+// and records the options of every pull request it opens
+func reviewAutofix(prFixes *[]*FixValidationResult, prOpts *[]FixPROptions) *DaggerAutofix {
+	m := fixtureAutofix(prFixes)
+	m.failureEngine.(*mockFailureAnalysisEngine).generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+		best, alternative, broken := parserFix(), parserFix(), parserFix()
+		best.Confidence = 0.9
+		alternative.ID, alternative.Description, alternative.Confidence = "fix2", "Default to zero", 0.6
+		alternative.Risks = []string{"hides bad input"}
+		broken.ID, broken.Confidence = "fix3", 0.95
+		broken.Changes[0].FilePath = "broken.go"
+		return []*ProposedFix{best, alternative, broken}, nil
+	}
+	m.testEngine.(*mockTestEngine).runTestsWithChangesFunc = func(ctx context.Context, source *dagger.Directory, changes []CodeChange) (*TestResult, error) {
+		if changes[0].FilePath == "broken.go" {
+			return &TestResult{Success: false, FailedTests: 2, Coverage: 90}, nil
+		}
+		return &TestResult{Success: true, Coverage: 90}, nil
+	}
+	pr := m.prEngine.(*mockPullRequestEngine)
+	pr.createWithOptionsFunc = func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error) {
+		*prFixes = append(*prFixes, fix)
+		*prOpts = append(*prOpts, opts)
+		return &PullRequest{Number: 7, Title: valueOr(opts.Title, "generated title"), URL: "https://github.com/owner/repo/pull/7"}, nil
+	}
+	pr.previewFunc = func(analysis *FailureAnalysisResult, fix *FixValidationResult) *PRCreationOptions {
+		return &PRCreationOptions{Title: "fix: " + fix.Fix.Description, Body: "Generated body for " + fix.Fix.ID}
+	}
+	return m
+}
+
+// reviewCLI returns a CLI reading review answers from input, with the prompts in the
+// second buffer and the result in the first
+func reviewCLI(t *testing.T, input string) (*CLI, *bytes.Buffer, *bytes.Buffer) {
+	cli, out := outputCLI(t, OutputText)
+	var prompts bytes.Buffer
+	cli.rootCmd.SetIn(strings.NewReader(input))
+	cli.rootCmd.SetErr(&prompts)
+	return cli, out, &prompts
+}
+
+// TestReviewFixInteractiveSession drives a session rejecting an invalid fix, then
+// selecting another and editing the pull request title and body
+func TestReviewFixInteractiveSession(t *testing.T) {
+	var prFixes []*FixValidationResult
+	var prOpts []FixPROptions
+	m := reviewAutofix(&prFixes, &prOpts)
+
+	input := strings.Join([]string{
+		"9", // out of range
+		"3", // failed validation
+		"2", // default to zero
+		"x", // unknown choice
+		"t", // edit the title
+		"fix: default empty input to zero",
+		"b", // edit the body
+		"Reviewed by hand.",
+		"",
+		"Keeps Parse total.",
+		".",
+		"c",
+	}, "\n") + "\n"
+	cli, out, prompts := reviewCLI(t, input)
+	require.NoError(t, cli.reviewFix(context.Background(), m, 1, fixReviewOptions{interactive: true}))
+
+	session := prompts.String()
+	assert.Contains(t, session, "=== Candidate Fixes for Run 1 ===")
+	assert.Contains(t, session, "\nFix 2: Default to zero\n  ID: fix2\n  Type: code\n  Confidence: 60.0%\n"+
+		"  Validation: valid=true, tests passed=true, coverage 90.0%\n  Risks:\n    - hides bad input\n"+
+		"  Changes:\n    - modify: parser/parser.go\n      diff --git a/parser/parser.go b/parser/parser.go\n")
+	assert.Contains(t, session, "  Validation: valid=false, tests passed=false, coverage 90.0%\n")
+	assert.Contains(t, session, "Enter a number between 1 and 3\n")
+	assert.Contains(t, session, "Fix 3 did not pass validation, select another one\n")
+	assert.Contains(t, session, "Pull Request Title: fix: Default to zero\n\nGenerated body for fix2\n")
+	assert.Contains(t, session, "Unknown choice \"x\"\n")
+
+	require.Len(t, prFixes, 1)
+	assert.Equal(t, "fix2", prFixes[0].Fix.ID)
+	assert.Equal(t, FixPROptions{Title: "fix: default empty input to zero", Body: "Reviewed by hand.\n\nKeeps Parse total.\n"}, prOpts[0])
+
+	assert.Contains(t, out.String(), "Pull Request Created:\n  Number: #7\n  Title: fix: default empty input to zero\n")
+	assert.NotContains(t, out.String(), "Candidate Fixes")
+}
+
+// TestReviewFixSessionChoices tests selecting another fix, aborting and running out of input
+func TestReviewFixSessionChoices(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantFix string
+		wantErr string
+	}{
+		{name: "select another fix", input: "1\ns\n2\nc\n", wantFix: "fix2"},
+		{name: "keep defaults", input: "1\nt\n\nb\n.\nc\n", wantFix: "fix1"},
+		{name: "abort at selection", input: "q\n"},
+		{name: "abort at confirmation", input: "1\na\n"},
+		{name: "input ends at selection", input: "3\n", wantErr: "input ended before a fix was selected"},
+		{name: "input ends at confirmation", input: "1\n", wantErr: "input ended before the pull request was confirmed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prFixes []*FixValidationResult
+			var prOpts []FixPROptions
+			cli, _, prompts := reviewCLI(t, tt.input)
+
+			err := cli.reviewFix(context.Background(), reviewAutofix(&prFixes, &prOpts), 1, fixReviewOptions{interactive: true})
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Empty(t, prFixes)
+				return
+			}
+			require.NoError(t, err)
+			if tt.wantFix == "" {
+				assert.Empty(t, prFixes)
+				assert.Contains(t, prompts.String(), "Aborted, no pull request created\n")
+				return
+			}
+			require.Len(t, prFixes, 1)
+			assert.Equal(t, tt.wantFix, prFixes[0].Fix.ID)
+			assert.Equal(t, "Generated body for "+tt.wantFix, prOpts[0].Body)
+		})
+	}
+}
+
+// TestReviewFixSelect tests picking a fix by its number for scripts
+func TestReviewFixSelect(t *testing.T) {
+	var prFixes []*FixValidationResult
+	var prOpts []FixPROptions
+	cli, out, prompts := reviewCLI(t, "")
+
+	require.NoError(t, cli.reviewFix(context.Background(), reviewAutofix(&prFixes, &prOpts), 1, fixReviewOptions{selected: 2}))
+	require.Len(t, prFixes, 1)
+	assert.Equal(t, "fix2", prFixes[0].Fix.ID)
+	assert.Equal(t, FixPROptions{}, prOpts[0])
+	assert.Empty(t, prompts.String())
+	assert.Contains(t, out.String(), "Number: #7")
+
+	err := cli.reviewFix(context.Background(), reviewAutofix(&prFixes, &prOpts), 1, fixReviewOptions{selected: 3})
+	assert.ErrorIs(t, err, ErrNoValidFixes)
+	err = cli.reviewFix(context.Background(), reviewAutofix(&prFixes, &prOpts), 1, fixReviewOptions{selected: 4})
+	assert.EqualError(t, err, "invalid --select 4: only 3 fixes were generated")
+	assert.Len(t, prFixes, 1)
+
+	out.Reset()
+	require.NoError(t, cli.reviewFix(context.Background(), reviewAutofix(&prFixes, &prOpts), 1, fixReviewOptions{selected: 1, dryRun: true}))
+	assert.Len(t, prFixes, 1)
+	assert.Contains(t, out.String(), "Dry Run (no pull request created):\n")
+}
+
+// TestFixReviewOptionsValidate tests rejecting --interactive without a terminal
+func TestFixReviewOptionsValidate(t *testing.T) {
+	orig := stdinIsTerminal
+	t.Cleanup(func() { stdinIsTerminal = orig })
+	terminal := false
+	stdinIsTerminal = func(io.Reader) bool { return terminal }
+
+	err := fixReviewOptions{interactive: true}.validate(strings.NewReader(""))
+	assert.EqualError(t, err, "--interactive needs a terminal on stdin; drop --interactive, or pick a fix with --select N")
+	assert.NoError(t, fixReviewOptions{interactive: true, selected: 1}.validate(strings.NewReader("")))
+	assert.NoError(t, fixReviewOptions{selected: 2}.validate(strings.NewReader("")))
+	assert.EqualError(t, fixReviewOptions{selected: -1}.validate(strings.NewReader("")), "invalid --select -1: fixes are numbered from 1")
+
+	terminal = true
+	assert.NoError(t, fixReviewOptions{interactive: true}.validate(strings.NewReader("")))
+}
+
+// TestRunFixInteractiveWithoutTerminal tests that the fix command fails before
+// initializing the agent when --interactive cannot prompt
+func TestRunFixInteractiveWithoutTerminal(t *testing.T) {
+	cli, _ := outputCLI(t, OutputText)
+	cli.rootCmd.SetIn(strings.NewReader(""))
+	cli.rootCmd.SetArgs([]string{"fix", "123", "--interactive"})
+	cli.rootCmd.SilenceUsage, cli.rootCmd.SilenceErrors = true, true
+
+	err := cli.rootCmd.Execute()
+	assert.ErrorContains(t, err, "drop --interactive, or pick a fix with --select N")
+}
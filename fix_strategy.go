@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FixStrategy controls how many pull requests AutoFix opens for validated fixes
+type FixStrategy string
+
+const (
+	// FixStrategyBest opens a single PR for the highest-confidence valid fix
+	FixStrategyBest FixStrategy = "best"
+	// FixStrategyAll opens a PR for every valid fix and cross-links them
+	FixStrategyAll FixStrategy = "all"
+	// FixStrategyDraftBelow behaves like FixStrategyAll but opens fixes below DraftThreshold as drafts
+	FixStrategyDraftBelow FixStrategy = "draft-below"
+)
+
+// DefaultDraftThreshold is the fix confidence below which draft-below opens draft PRs
+const DefaultDraftThreshold = 0.7
+
+// validateFixStrategy rejects unknown strategies; an empty strategy means best
+func validateFixStrategy(strategy FixStrategy) error {
+	switch strategy {
+	case "", FixStrategyBest, FixStrategyAll, FixStrategyDraftBelow:
+		return nil
+	default:
+		return fmt.Errorf("unsupported fix strategy %q (expected best, all or draft-below)", strategy)
+	}
+}
+
+func (m *DaggerAutofix) fixStrategy() FixStrategy {
+	if m.FixStrategy == "" {
+		return FixStrategyBest
+	}
+	return m.FixStrategy
+}
+
+func (m *DaggerAutofix) draftThreshold() float64 {
+	if m.DraftThreshold <= 0 {
+		return DefaultDraftThreshold
+	}
+	return m.DraftThreshold
+}
+
+// fixCandidates returns the fixes to open PRs for, best fix first and the
+// remaining valid fixes by descending confidence
+func (m *DaggerAutofix) fixCandidates(ctx context.Context, validations []*FixValidationResult, best *FixValidationResult) []*FixValidationResult {
+	candidates := []*FixValidationResult{best}
+	if m.fixStrategy() == FixStrategyBest {
+		return candidates
+	}
+
+	// Only the best fix can be demoted to an analysis comment, so alternatives exceeding the
+	// guardrails are left out instead
+	skipViolations := m.settings(ctx).Guardrails.Action == GuardrailAnalysisOnly
+	var alternatives []*FixValidationResult
+	for _, validation := range validations {
+		if skipViolations && len(validation.GuardrailViolations) > 0 {
+			continue
+		}
+		if validation.Valid && validation != best {
+			alternatives = append(alternatives, validation)
+		}
+	}
+	sort.SliceStable(alternatives, func(i, j int) bool {
+		return alternatives[i].Fix.Confidence > alternatives[j].Fix.Confidence
+	})
+
+	return append(candidates, alternatives...)
+}
+
+// createFixPRs opens a PR for each candidate and links them when more than one is created.
+// forceDraft opens every PR as a draft, as do fixes exceeding the guardrails. Only a failure for the first (best) candidate is
+// fatal; alternatives are best effort.
+func (m *DaggerAutofix) createFixPRs(ctx context.Context, analysis *FailureAnalysisResult, candidates []*FixValidationResult, forceDraft bool) ([]*PullRequest, error) {
+	strategy := m.fixStrategy()
+	settings := m.settings(ctx)
+	prs := make([]*PullRequest, 0, len(candidates))
+
+	for i, fix := range candidates {
+		opts := FixPROptions{
+			Draft:          forceDraft || len(fix.GuardrailViolations) > 0 || (strategy == FixStrategyDraftBelow && fix.Fix.Confidence < m.draftThreshold()),
+			AllowDuplicate: i > 0,
+			Reviewers:      settings.Reviewers,
+			TeamReviewers:  settings.TeamReviewers,
+		}
+
+		pr, err := m.prEngine.CreateFixPRWithOptions(ctx, analysis, fix, opts)
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			m.logger.WithError(err).WithField("fix_id", fix.Fix.ID).Warn("Failed to create PR for alternative fix")
+			continue
+		}
+		if pr == nil {
+			if i == 0 {
+				return nil, fmt.Errorf("no pull request returned for fix %s", fix.Fix.ID)
+			}
+			continue
+		}
+		prs = append(prs, pr)
+		if !pr.Existing {
+			m.recordFixPR(ctx, analysis, fix, pr, opts)
+		}
+
+		// The run already has an open fix PR, so no alternatives are opened next to it
+		if pr.Existing {
+			return prs, nil
+		}
+	}
+
+	if len(prs) > 1 {
+		if err := m.prEngine.LinkRelatedPRs(ctx, prs); err != nil {
+			m.logger.WithError(err).Warn("Failed to cross-link related fix PRs")
+		}
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"strategy": strategy,
+		"prs":      len(prs),
+	}).Info("Created fix pull requests")
+
+	return prs, nil
+}
+
+// recordFixPR audits a newly opened fix pull request and remembers it in the fix history
+func (m *DaggerAutofix) recordFixPR(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, pr *PullRequest, opts FixPROptions) {
+	audit(ctx, AuditBranchCreated, map[string]interface{}{"branch": pr.Branch, "purpose": "fix"})
+	audit(ctx, AuditFilesModified, map[string]interface{}{"branch": pr.Branch, "fix_id": fix.Fix.ID, "files": auditChanges(fix.Fix.Changes)})
+	audit(ctx, AuditPROpened, map[string]interface{}{"number": pr.Number, "url": pr.URL, "branch": pr.Branch, "fix_id": fix.Fix.ID, "draft": opts.Draft})
+	m.recordFixHistory(analysis, fix.Fix, pr)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type createdFixPR struct {
+	fixID string
+	draft bool
+}
+
+// strategyAutofix builds a module that validates two fixes with confidence 0.9 and 0.5
+func strategyAutofix(created *[]createdFixPR, linked *[]*PullRequest) *DaggerAutofix {
+	m := fixtureAutofix(nil)
+	fe := m.failureEngine.(*mockFailureAnalysisEngine)
+	fe.analyzeFunc = func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+		return &FailureAnalysisResult{ID: "a1", Classification: FailureClassification{Type: BuildFailure, Confidence: 0.9}, Context: fc}, nil
+	}
+	fe.generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+		low, high := parserFix(), parserFix()
+		low.ID, low.Confidence = "low", 0.5
+		high.ID, high.Confidence = "high", 0.9
+		return []*ProposedFix{low, high}, nil
+	}
+
+	var mu sync.Mutex
+	pr := m.prEngine.(*mockPullRequestEngine)
+	pr.createWithOptionsFunc = func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		*created = append(*created, createdFixPR{fix.Fix.ID, opts.Draft})
+		return &PullRequest{Number: len(*created), Title: "fix " + fix.Fix.ID}, nil
+	}
+	pr.linkRelatedFunc = func(ctx context.Context, prs []*PullRequest) error {
+		mu.Lock()
+		defer mu.Unlock()
+		*linked = prs
+		return nil
+	}
+	return m
+}
+
+// TestAutoFixFixStrategies tests PR creation for each fix strategy with two valid fixes
+func TestAutoFixFixStrategies(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Best", func(t *testing.T) {
+		var created []createdFixPR
+		var linked []*PullRequest
+		m := strategyAutofix(&created, &linked).WithFixStrategy("best")
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []createdFixPR{{"high", false}}, created)
+		assert.Nil(t, linked)
+		assert.Equal(t, 1, res.PullRequest.Number)
+		assert.Len(t, res.PullRequests, 1)
+		assert.Equal(t, "best", res.Metadata["fix_strategy"])
+	})
+
+	t.Run("All", func(t *testing.T) {
+		var created []createdFixPR
+		var linked []*PullRequest
+		m := strategyAutofix(&created, &linked).WithFixStrategy("ALL")
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []createdFixPR{{"high", false}, {"low", false}}, created)
+		require.Len(t, res.PullRequests, 2)
+		assert.Equal(t, res.PullRequests, linked)
+		assert.Same(t, res.PullRequests[0], res.PullRequest)
+		assert.Equal(t, "high", res.Fix.Fix.ID)
+	})
+
+	t.Run("DraftBelow", func(t *testing.T) {
+		var created []createdFixPR
+		var linked []*PullRequest
+		m := strategyAutofix(&created, &linked).WithFixStrategy("draft-below").WithDraftThreshold(0.6)
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []createdFixPR{{"high", false}, {"low", true}}, created)
+		assert.Len(t, res.PullRequests, 2)
+		assert.Len(t, linked, 2)
+	})
+
+	t.Run("AlternativeFailureIsNotFatal", func(t *testing.T) {
+		var created []createdFixPR
+		var linked []*PullRequest
+		m := strategyAutofix(&created, &linked).WithFixStrategy("all")
+		engine := m.prEngine.(*mockPullRequestEngine)
+		engine.createWithOptionsFunc = func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error) {
+			if fix.Fix.ID == "low" {
+				return nil, errors.New("branch exists")
+			}
+			return &PullRequest{Number: 1}, nil
+		}
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.True(t, res.Success)
+		assert.Len(t, res.PullRequests, 1)
+		assert.Nil(t, linked)
+	})
+
+	t.Run("ExistingPRSkipsAlternatives", func(t *testing.T) {
+		var created []createdFixPR
+		var linked []*PullRequest
+		var allowDuplicate []bool
+		m := strategyAutofix(&created, &linked).WithFixStrategy("all")
+		engine := m.prEngine.(*mockPullRequestEngine)
+		engine.createWithOptionsFunc = func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error) {
+			allowDuplicate = append(allowDuplicate, opts.AllowDuplicate)
+			return &PullRequest{Number: 5, Existing: true}, nil
+		}
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []bool{false}, allowDuplicate, "only the best fix is checked against open PRs")
+		assert.Equal(t, 5, res.PullRequest.Number)
+		assert.Len(t, res.PullRequests, 1)
+		assert.Nil(t, linked)
+		assert.Equal(t, true, res.Metadata["existing_pr"])
+	})
+}
+
+// TestValidateFixStrategy tests strategy validation
+func TestValidateFixStrategy(t *testing.T) {
+	for _, strategy := range []FixStrategy{"", FixStrategyBest, FixStrategyAll, FixStrategyDraftBelow} {
+		assert.NoError(t, validateFixStrategy(strategy))
+	}
+	assert.Error(t, validateFixStrategy("random"))
+
+	m := New()
+	assert.Equal(t, FixStrategyBest, m.FixStrategy)
+	assert.Equal(t, DefaultDraftThreshold, m.DraftThreshold)
+}
+
+// TestLinkRelatedPRs verifies each PR body links to the other fix PRs
+func TestLinkRelatedPRs(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+
+	bodies := map[int]string{}
+	for _, number := range []int{1, 2} {
+		number := number
+		mux.HandleFunc(fmt.Sprintf("/repos/owner/repo/pulls/%d", number), func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPatch, r.Method)
+			var body github.PullRequest
+			assert.NoError(t, decodeJSON(r, &body))
+			bodies[number] = body.GetBody()
+			fmt.Fprintf(w, `{"number":%d}`, number)
+		})
+	}
+
+	engine := NewPullRequestEngine(gh, quietLogger())
+	prs := []*PullRequest{
+		{Number: 1, Title: "Fix A", Body: "body A"},
+		{Number: 2, Title: "Fix B", Body: "body B"},
+	}
+
+	require.NoError(t, engine.LinkRelatedPRs(context.Background(), prs))
+	assert.Contains(t, bodies[1], "body A")
+	assert.Contains(t, bodies[1], "## 🔗 Related Fixes")
+	assert.Contains(t, bodies[1], "- #2 Fix B")
+	assert.NotContains(t, bodies[1], "#1 Fix A")
+	assert.Contains(t, bodies[2], "- #1 Fix A")
+	assert.Equal(t, bodies[2], prs[1].Body)
+
+	assert.NoError(t, engine.LinkRelatedPRs(context.Background(), prs[:1]))
+}
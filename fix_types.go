@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// fixTypesEnvPrefix prefixes config file entries such as FIX_TYPES_TEST=code
+const fixTypesEnvPrefix = "FIX_TYPES_"
+
+// FixTypeConstraints lists per failure type the only fix types AutoFix accepts, e.g. code
+// fixes alone for test failures so tests are not "fixed" by changing their expectations.
+// Failure types without an entry accept every fix type.
+type FixTypeConstraints map[FailureType][]FixType
+
+// allows tells whether fixes of fixType are accepted for failures of failureType
+func (c FixTypeConstraints) allows(failureType FailureType, fixType FixType) bool {
+	allowed, ok := c[failureType]
+	if !ok {
+		return true
+	}
+	for _, t := range allowed {
+		if t == fixType {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks that every entry names known failure and fix types and allows some fix type
+func (c FixTypeConstraints) validate() error {
+	for failureType, fixTypes := range c {
+		if _, err := ParseFailureType(string(failureType)); err != nil || failureType == UnknownFailure {
+			return fmt.Errorf("invalid allowed fix types: unknown failure type %q", failureType)
+		}
+		if len(fixTypes) == 0 {
+			return fmt.Errorf("invalid allowed fix types for %s failures: no fix type allowed, use the analysis-only PR policy instead", failureType)
+		}
+		for _, fixType := range fixTypes {
+			if _, err := ParseFixType(string(fixType)); err != nil || fixType == UnknownFix {
+				return fmt.Errorf("invalid allowed fix types for %s failures: unknown fix type %q", failureType, fixType)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseFixTypeConstraints builds fix type constraints from KEY=value environment entries.
+// FIX_TYPES_<FAILURE_TYPE> lists the fix types allowed for a failure type, separated by
+// commas, e.g. FIX_TYPES_CONFIGURATION=configuration,workflow.
+func ParseFixTypeConstraints(environ []string) (FixTypeConstraints, error) {
+	constraints := make(FixTypeConstraints)
+
+	for _, entry := range environ {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(key, fixTypesEnvPrefix) {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(key, fixTypesEnvPrefix))
+		failureType, err := ParseFailureType(name)
+		if err != nil || failureType == UnknownFailure {
+			return nil, fmt.Errorf("invalid %s: unknown failure type %q", key, name)
+		}
+
+		var fixTypes []FixType
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			fixType, err := ParseFixType(field)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			fixTypes = append(fixTypes, fixType)
+		}
+		constraints[failureType] = fixTypes
+	}
+
+	if err := constraints.validate(); err != nil {
+		return nil, err
+	}
+	return constraints, nil
+}
+
+// writeFixTypesPrompt tells the LLM which fix types it may propose for the failure, so it
+// does not spend a proposal on one that is dropped
+func writeFixTypesPrompt(prompt *strings.Builder, failureType FailureType, allowed []FixType) {
+	names := make([]string, 0, len(allowed))
+	for _, fixType := range allowed {
+		names = append(names, fmt.Sprintf("`%s`", fixType))
+	}
+	prompt.WriteString("## Allowed Fix Types\n\n")
+	prompt.WriteString(fmt.Sprintf("For %s failures only propose fixes of type %s. Fixes of any other type are discarded.\n\n",
+		failureType.DisplayName(), strings.Join(names, " or ")))
+}
+
+// accepts tells whether fix is of a type allowed for the analysis's failure type. Dropped
+// fixes are logged and listed in the analysis metadata.
+func (c FixTypeConstraints) accepts(fix *ProposedFix, analysis *FailureAnalysisResult, logger *logrus.Logger) bool {
+	failureType := analysis.Classification.Type
+	if c.allows(failureType, fix.Type) {
+		return true
+	}
+	logger.WithFields(logrus.Fields{
+		"fix_id":       fix.ID,
+		"fix_type":     fix.Type,
+		"failure_type": failureType,
+	}).Warn("Dropping fix, its type is not allowed for the failure type")
+	if analysis.Metadata == nil {
+		analysis.Metadata = make(map[string]interface{})
+	}
+	filtered, _ := analysis.Metadata["filtered_fixes"].([]map[string]interface{})
+	analysis.Metadata["filtered_fixes"] = append(filtered, map[string]interface{}{
+		"id":          fix.ID,
+		"type":        string(fix.Type),
+		"description": fix.Description,
+	})
+	return false
+}
+
+// filteredFixTypes returns the distinct types of the fixes the fix type constraints dropped,
+// in order
+func filteredFixTypes(analysis *FailureAnalysisResult) []string {
+	filtered, _ := analysis.Metadata["filtered_fixes"].([]map[string]interface{})
+	var types []string
+	for _, fix := range filtered {
+		if fixType, ok := fix["type"].(string); ok {
+			types = appendMissing(types, fixType)
+		}
+	}
+	return types
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testFailureConstraints only accepts code fixes for test failures
+var testFailureConstraints = FixTypeConstraints{
+	TestFailure:          {CodeFix},
+	ConfigurationFailure: {ConfigurationFix, WorkflowFix},
+}
+
+// fixesResponse proposes a test fix changing the expectation and a code fix
+const fixesResponse = `[
+	{"type": "test", "description": "Expect 12", "confidence": 0.9,
+	 "changes": [{"file_path": "src/sum.test.js", "operation": "modify", "new_content": "expect(sum(1, 2)).toBe('12')"}]},
+	{"type": "code", "description": "Add numbers", "confidence": 0.8,
+	 "changes": [{"file_path": "src/sum.js", "operation": "modify", "new_content": "return a + b"}]}
+]`
+
+// TestFixTypesPrompt tests that the fix generation prompt names the allowed fix types
+func TestFixTypesPrompt(t *testing.T) {
+	engine := NewFailureAnalysisEngine(nil, quietLogger())
+	engine.SetFixTypeConstraints(testFailureConstraints)
+
+	prompt := engine.buildFixGenerationPrompt(&FailureAnalysisResult{Classification: FailureClassification{Type: ConfigurationFailure}})
+	assert.Contains(t, prompt, "## Allowed Fix Types\n\n"+
+		"For ConfigurationFailure failures only propose fixes of type `configuration` or `workflow`. "+
+		"Fixes of any other type are discarded.\n\n## Fix Generation Instructions")
+
+	prompt = engine.buildFixGenerationPrompt(&FailureAnalysisResult{Classification: FailureClassification{Type: BuildFailure}})
+	assert.NotContains(t, prompt, "Allowed Fix Types")
+}
+
+// TestParseFixesResponseFixTypes tests dropping fixes of a type not allowed for the failure
+func TestParseFixesResponseFixTypes(t *testing.T) {
+	engine := NewFailureAnalysisEngine(nil, quietLogger())
+	engine.SetFixTypeConstraints(testFailureConstraints)
+
+	analysis := &FailureAnalysisResult{ID: "a1", Classification: FailureClassification{Type: TestFailure}}
+	fixes, err := engine.parseFixesResponse(fixesResponse, analysis)
+	require.NoError(t, err)
+	require.Len(t, fixes, 1)
+	assert.Equal(t, CodeFix, fixes[0].Type)
+	assert.Equal(t, []string{"test"}, filteredFixTypes(analysis))
+	filtered := analysis.Metadata["filtered_fixes"].([]map[string]interface{})
+	assert.Equal(t, "Expect 12", filtered[0]["description"])
+
+	// Unconstrained failure types keep every fix
+	analysis = &FailureAnalysisResult{ID: "a2", Classification: FailureClassification{Type: BuildFailure}}
+	fixes, err = engine.parseFixesResponse(fixesResponse, analysis)
+	require.NoError(t, err)
+	assert.Len(t, fixes, 2)
+	assert.Nil(t, analysis.Metadata)
+
+	// The code fix made of an unstructured response is dropped too
+	analysis = &FailureAnalysisResult{ID: "a3", Classification: FailureClassification{Type: ConfigurationFailure}}
+	fixes, err = engine.parseFixesResponse("Change the test instead", analysis)
+	require.NoError(t, err)
+	assert.Empty(t, fixes)
+	assert.Equal(t, []string{"code"}, filteredFixTypes(analysis))
+}
+
+// TestAutoFixFixTypesFallback tests that AutoFix comments the analysis when every fix has a
+// type not allowed for the failure
+func TestAutoFixFixTypesFallback(t *testing.T) {
+	var created []createdFixPR
+	var comments []postedComment
+	m := policyAutofix(ConfigurationFailure, 0.9, &created, &comments).WithAllowedFixTypes(testFailureConstraints)
+	engine := NewFailureAnalysisEngine(&mockLLMClient{response: &LLMResponse{Content: fixesResponse}}, quietLogger())
+	engine.SetFixTypeConstraints(m.AllowedFixTypes)
+	m.failureEngine.(*mockFailureAnalysisEngine).generateFixesFunc = engine.GenerateFixes
+
+	res, err := m.AutoFix(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Empty(t, created)
+	assert.False(t, res.Success)
+	assert.Equal(t, "analysis-only", res.Metadata["pr_policy"])
+	assert.Equal(t, "Every proposed fix was of a type not allowed for configuration failures (test, code)", res.Metadata["pr_policy_reason"])
+	assert.Len(t, res.Metadata["filtered_fixes"], 2)
+	require.Len(t, comments, 1)
+	assert.Contains(t, comments[0].body, "not allowed for configuration failures")
+
+	// Dry runs record the outcome without commenting
+	comments = nil
+	res, err = m.WithDryRun(true).AutoFix(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, "analysis-only", res.Metadata["pr_policy"])
+	assert.Empty(t, comments)
+}
+
+// TestParseFixTypeConstraints tests loading fix type constraints from config file entries
+func TestParseFixTypeConstraints(t *testing.T) {
+	constraints, err := ParseFixTypeConstraints([]string{
+		"FIX_TYPES_TEST=code",
+		"FIX_TYPES_CONFIGURATION= configuration, CI ",
+		"POLICY_TEST=draft",
+		"PATH=/usr/bin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, FixTypeConstraints{
+		TestFailure:          {CodeFix},
+		ConfigurationFailure: {ConfigurationFix, WorkflowFix},
+	}, constraints)
+	assert.True(t, constraints.allows(TestFailure, CodeFix))
+	assert.False(t, constraints.allows(TestFailure, TestFix))
+	assert.True(t, constraints.allows(BuildFailure, TestFix))
+
+	for _, entry := range []string{"FIX_TYPES_COSMIC=code", "FIX_TYPES_TEST=rewrite", "FIX_TYPES_TEST= , "} {
+		_, err := ParseFixTypeConstraints([]string{entry})
+		assert.Error(t, err, entry)
+	}
+
+	err = New().WithAllowedFixTypes(map[FailureType][]FixType{TestFailure: {UnknownFix}}).AllowedFixTypes.validate()
+	assert.ErrorContains(t, err, "unknown fix type")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultMaxParallelValidations is how many of a run's proposed fixes are validated at once
+const DefaultMaxParallelValidations = 2
+
+// validateFixes validates fixes on at most MaxParallelValidations workers. It returns the
+// validations in the order of the fixes, so ties between equally confident fixes are broken
+// as before, and the errors of the fixes that could not be validated. Cancelling ctx aborts
+// the running validations, whose test branches are still deleted, and skips the rest; the
+// validations completed before then are returned with ctx's error.
+func (m *DaggerAutofix) validateFixes(ctx context.Context, fixes []*ProposedFix) ([]*FixValidationResult, []error, error) {
+	workers := m.MaxParallelValidations
+	if workers <= 0 {
+		workers = DefaultMaxParallelValidations
+	}
+
+	validations := make([]*FixValidationResult, len(fixes))
+	errs := make([]error, len(fixes))
+	var group errgroup.Group
+	group.SetLimit(workers)
+	for i, fix := range fixes {
+		group.Go(func() error {
+			if ctx.Err() != nil {
+				return nil
+			}
+			start := time.Now()
+			validation, err := m.validateFix(withProgressIndex(ctx, i+1, len(fixes)), fix, i+1)
+			duration := time.Since(start)
+			agentMetrics.validationDuration.observe(duration.Seconds())
+			log := m.logger.WithFields(logrus.Fields{"fix_id": fix.ID, "duration": duration.String()})
+			if err != nil {
+				// A fix that cannot be validated is skipped without stopping the others
+				log.WithError(err).Warn("Fix validation failed, skipping")
+				errs[i] = err
+				return nil
+			}
+			log.Debug("Fix validated")
+			validations[i] = validation
+			return nil
+		})
+	}
+	group.Wait()
+
+	completed := make([]*FixValidationResult, 0, len(fixes))
+	var failed []error
+	for i := range fixes {
+		if validations[i] != nil {
+			completed = append(completed, validations[i])
+		}
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+		}
+	}
+	return completed, failed, ctx.Err()
+}
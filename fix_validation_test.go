@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// branchRecorder records the test branches created and deleted while fixes are validated
+type branchRecorder struct {
+	mu      sync.Mutex
+	created []string
+	deleted []string
+}
+
+func (r *branchRecorder) createTestBranch(ctx context.Context, branch string, changes []CodeChange) (func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.created = append(r.created, branch)
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.deleted = append(r.deleted, branch)
+	}, nil
+}
+
+// parallelValidationAutofix returns an agent validating three fixes on test branches with
+// runTests. The second fix is the most confident and the third shares the first's ID.
+func parallelValidationAutofix(prFixes *[]*FixValidationResult, runTests func(ctx context.Context, branch string) (*TestResult, error)) (*DaggerAutofix, *branchRecorder) {
+	m := fixtureAutofix(prFixes).WithMaxParallelValidations(3)
+	m.Source = nil
+	m.failureEngine.(*mockFailureAnalysisEngine).generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+		first, best, sameID := parserFix(), parserFix(), parserFix()
+		first.Confidence = 0.6
+		best.ID, best.Confidence = "fix2", 0.9
+		sameID.Confidence = 0.95
+		return []*ProposedFix{first, best, sameID}, nil
+	}
+	m.testEngine.(*mockTestEngine).runTestsFunc = func(ctx context.Context, owner, repo, branch string) (*TestResult, error) {
+		return runTests(ctx, branch)
+	}
+	branches := &branchRecorder{}
+	m.githubClient.(*mockGitHub).createTestBranchFunc = branches.createTestBranch
+	return m, branches
+}
+
+// TestAutoFixValidatesFixesInParallel tests that fixes are validated at once on their own
+// test branches, which are all deleted, and that the best fix is selected among them all
+func TestAutoFixValidatesFixesInParallel(t *testing.T) {
+	const delay = 150 * time.Millisecond
+	var prFixes []*FixValidationResult
+	m, branches := parallelValidationAutofix(&prFixes, func(ctx context.Context, branch string) (*TestResult, error) {
+		switch {
+		case strings.HasSuffix(branch, "-3"):
+			return nil, errors.New("runner unavailable")
+		case strings.HasSuffix(branch, "-2"):
+			time.Sleep(2 * delay)
+		default:
+			time.Sleep(delay)
+		}
+		return &TestResult{Success: true, Coverage: 90}, nil
+	})
+	observed := agentMetrics.validationDuration.count
+
+	start := time.Now()
+	result, err := m.AutoFix(context.Background(), 42)
+	elapsed := time.Since(start)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+
+	assert.GreaterOrEqual(t, elapsed, 2*delay)
+	assert.Less(t, elapsed, 3*delay, "the validations take as long as the slowest, not their sum")
+	require.Len(t, prFixes, 1)
+	assert.Equal(t, "fix2", prFixes[0].Fix.ID, "the slowest validation still counts")
+	assert.Equal(t, observed+3, agentMetrics.validationDuration.count, "each validation's duration is recorded")
+
+	assert.ElementsMatch(t, []string{"autofix-test-fix1-1", "autofix-test-fix2-2", "autofix-test-fix1-3"}, branches.created)
+	assert.ElementsMatch(t, branches.created, branches.deleted, "every test branch is deleted, even the failed validation's")
+}
+
+// TestAutoFixCancelledDuringValidation tests that cancelling a run aborts the running
+// validations and skips the rest, deleting the test branches already created
+func TestAutoFixCancelledDuringValidation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan struct{}, 3)
+	var prFixes []*FixValidationResult
+	m, branches := parallelValidationAutofix(&prFixes, func(ctx context.Context, branch string) (*TestResult, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	m.MaxParallelValidations = 2
+
+	go func() {
+		<-started
+		<-started
+		cancel()
+	}()
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.AutoFix(ctx, 42)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("AutoFix did not return after being cancelled")
+	}
+	assert.Empty(t, prFixes)
+	assert.Len(t, branches.created, 2, "the third validation never starts")
+	assert.ElementsMatch(t, branches.created, branches.deleted)
+}
+
+// TestValidateFixesKeepsCompletedOnCancel tests that the validations completed before a
+// run is cancelled are returned with the cancellation
+func TestValidateFixesKeepsCompletedOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, _ := parallelValidationAutofix(nil, func(ctx context.Context, branch string) (*TestResult, error) {
+		if strings.HasSuffix(branch, "-1") {
+			return &TestResult{Success: true, Coverage: 90}, nil
+		}
+		cancel()
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	m.MaxParallelValidations = 1
+	fixes, err := m.failureEngine.GenerateFixes(ctx, nil)
+	require.NoError(t, err)
+
+	validations, failed, err := m.validateFixes(ctx, fixes)
+	assert.ErrorIs(t, err, context.Canceled)
+	require.Len(t, validations, 1)
+	assert.Equal(t, "fix1", validations[0].Fix.ID)
+	assert.Len(t, failed, 1, "the third validation never starts")
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Verification outcomes of a merged fix pull request
+const (
+	VerificationPending    = "pending"    // the workflow has not yet run at the merge commit
+	VerificationVerified   = "verified"   // the workflow succeeded at the merge commit
+	VerificationUnverified = "unverified" // the workflow failed again, or did not run in time
+)
+
+// DefaultVerificationTimeout is how long after a fix PR merged its workflow has to complete
+// at the merge commit before the fix is recorded as unverified
+const DefaultVerificationTimeout = 2 * time.Hour
+
+// verificationPollInterval is how often VerifyFix looks for the runs of the merge commit
+var verificationPollInterval = 30 * time.Second
+
+// verificationClockSkew widens the window runs of the merge commit are listed in, so a run
+// created just as GitHub recorded the merge is not missed
+const verificationClockSkew = time.Minute
+
+// VerificationResult tells whether the workflow a fix PR was opened for succeeded on the
+// target branch after the PR merged
+type VerificationResult struct {
+	PRNumber       int         `json:"pr_number"`
+	PRURL          string      `json:"pr_url,omitempty"`
+	FailedRunID    int64       `json:"failed_run_id,omitempty"` // run the PR fixed, when the PR is tracked
+	Workflow       string      `json:"workflow,omitempty"`      // empty when every workflow counts
+	FailureType    FailureType `json:"failure_type,omitempty"`
+	MergeCommitSHA string      `json:"merge_commit_sha"`
+	Outcome        string      `json:"outcome"` // verified or unverified
+	// Run is the run at the merge commit that decided the outcome, nil when none completed
+	// in time; Reason then tells why the fix is unverified
+	Run    *WorkflowRun `json:"run,omitempty"`
+	Reason string       `json:"reason,omitempty"`
+	// FollowUp is the analysis of a failed Run, when follow-up analyses are enabled
+	FollowUp   *FailureAnalysisResult `json:"follow_up,omitempty"`
+	VerifiedAt time.Time              `json:"verified_at"`
+}
+
+// Verified reports whether the workflow succeeded after the fix
+func (r *VerificationResult) Verified() bool {
+	return r.Outcome == VerificationVerified
+}
+
+// verificationTimeout returns the configured verification timeout or the default
+func (m *DaggerAutofix) verificationTimeout() time.Duration {
+	if m.VerificationTimeout > 0 {
+		return m.VerificationTimeout
+	}
+	return DefaultVerificationTimeout
+}
+
+// VerifyFix checks that a merged fix PR resolved its failure: it waits for the workflow of
+// the run the PR fixed to complete on the target branch at the merge commit, until the
+// verification timeout after the merge, and records a verified or unverified outcome. The
+// outcome is commented on the PR. PRs the agent does not track are verified against the
+// workflow of the run named in their metadata, or every workflow run at the merge commit
+// when they have none.
+func (m *DaggerAutofix) VerifyFix(ctx context.Context, prNumber int) (*VerificationResult, error) {
+	if err := validatePRNumber(prNumber); err != nil {
+		return nil, err
+	}
+	if m.prEngine == nil || m.githubClient == nil {
+		return nil, ErrNotInitialized
+	}
+	status, err := m.prEngine.GetPRStatus(ctx, prNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pull request #%d: %w", prNumber, err)
+	}
+	if !status.Merged {
+		return nil, fmt.Errorf("pull request #%d is not merged", prNumber)
+	}
+	if status.MergeCommitSHA == "" {
+		return nil, fmt.Errorf("pull request #%d has no merge commit", prNumber)
+	}
+	tracker, err := m.prTracking()
+	if err != nil {
+		return nil, err
+	}
+
+	tracked, ok := tracker.get(prNumber)
+	if !ok {
+		tracked = m.untrackedPR(ctx, prNumber, status)
+	} else if tracked.State == TrackedPROpen {
+		// Merged since the last reconciliation
+		if err := tracker.resolve(prNumber, TrackedPRMerged, time.Now()); err != nil {
+			return nil, err
+		}
+		m.resolveFixHistory(prNumber, true)
+	}
+	tracked.MergeCommitSHA = status.MergeCommitSHA
+	mergedAt := status.MergedAt
+	if mergedAt.IsZero() {
+		mergedAt = time.Now()
+	}
+
+	deadline := mergedAt.Add(m.verificationTimeout())
+	for {
+		result, err := m.checkVerification(ctx, tracked, mergedAt, deadline)
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			m.recordVerification(ctx, tracker, result)
+			return result, nil
+		}
+		m.logger.WithFields(logrus.Fields{
+			"pr_number":        prNumber,
+			"merge_commit_sha": tracked.MergeCommitSHA,
+		}).Debug("Waiting for the workflow to run at the merge commit")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(verificationPollInterval):
+		}
+	}
+}
+
+// untrackedPR describes a PR the agent does not track by the workflow run in its metadata,
+// so it is verified against that run's workflow and branch. PRs without metadata, or whose
+// run cannot be read, are verified against every workflow.
+func (m *DaggerAutofix) untrackedPR(ctx context.Context, number int, pr *PullRequest) TrackedPR {
+	tracked := TrackedPR{Number: number, URL: pr.URL}
+	metadata := prMetadata(pr, m.logger)
+	if metadata == nil || metadata.RunID == 0 {
+		return tracked
+	}
+	tracked.RunID = metadata.RunID
+	run, err := m.githubClient.GetWorkflowRun(ctx, metadata.RunID)
+	if err != nil {
+		m.logger.WithError(err).WithField("run_id", metadata.RunID).Warn("Failed to get the workflow run of the fix PR, verifying every workflow")
+		return tracked
+	}
+	tracked.Workflow, tracked.Branch = run.Name, run.Branch
+	return tracked
+}
+
+// verifyMergedFixes verifies the merged PRs whose workflow has completed at the merge commit
+// since the last reconciliation, leaving the others pending until their timeout
+func (m *DaggerAutofix) verifyMergedFixes(ctx context.Context, tracker *prTracker) error {
+	for _, tracked := range tracker.pendingVerifications() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		result, err := m.checkVerification(ctx, tracked, tracked.ResolvedAt, tracked.ResolvedAt.Add(m.verificationTimeout()))
+		if err != nil {
+			m.logger.WithError(err).WithField("pr_number", tracked.Number).Warn("Failed to verify merged fix")
+			continue
+		}
+		if result != nil {
+			m.recordVerification(ctx, tracker, result)
+		}
+	}
+	return nil
+}
+
+// checkVerification decides the outcome of a merged PR from the runs of its workflow at the
+// merge commit. A failed run decides at once; otherwise it returns nil while runs are in
+// progress or none ran yet, until the deadline.
+func (m *DaggerAutofix) checkVerification(ctx context.Context, tracked TrackedPR, mergedAt, deadline time.Time) (*VerificationResult, error) {
+	result := &VerificationResult{
+		PRNumber:       tracked.Number,
+		PRURL:          tracked.URL,
+		FailedRunID:    tracked.RunID,
+		Workflow:       tracked.Workflow,
+		FailureType:    tracked.FailureType,
+		MergeCommitSHA: tracked.MergeCommitSHA,
+		Outcome:        VerificationUnverified,
+	}
+	if tracked.MergeCommitSHA == "" {
+		result.Reason = "the merge commit is unknown"
+		result.VerifiedAt = time.Now()
+		return result, nil
+	}
+
+	// The fix PR targets the branch of the run it fixed
+	branch := tracked.Branch
+	if branch == "" {
+		branch = m.TargetBranch
+	}
+	runs, err := m.githubClient.GetCommitWorkflowRuns(ctx, branch, tracked.MergeCommitSHA, mergedAt.Add(-verificationClockSkew))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the workflow runs of merge commit %s: %w", shortSHA(tracked.MergeCommitSHA), err)
+	}
+	var failed, running, succeeded *WorkflowRun
+	for _, run := range runs {
+		if tracked.Workflow != "" && run.Name != tracked.Workflow {
+			continue
+		}
+		switch {
+		case run.Status != "completed":
+			running = run
+		case run.Conclusion == "success":
+			succeeded = run
+		case run.Conclusion == "failure" || run.Conclusion == "timed_out":
+			failed = run
+		}
+	}
+
+	now := time.Now()
+	switch {
+	case failed != nil:
+		result.Run = failed
+	case running != nil && now.Before(deadline):
+		return nil, nil
+	case succeeded != nil:
+		result.Outcome = VerificationVerified
+		result.Run = succeeded
+	case now.Before(deadline):
+		return nil, nil
+	default:
+		result.Reason = fmt.Sprintf("%s did not complete at the merge commit within %s", workflowLabel(tracked.Workflow), m.verificationTimeout())
+	}
+	result.VerifiedAt = now
+	return result, nil
+}
+
+// recordVerification records the outcome of a verification in the PR tracking state, the
+// metrics and the audit log, analyzes the failed run when follow-up analyses are enabled,
+// and comments the outcome on the PR
+func (m *DaggerAutofix) recordVerification(ctx context.Context, tracker *prTracker, result *VerificationResult) {
+	var runID int64
+	if result.Run != nil {
+		runID = result.Run.ID
+	}
+	if err := tracker.verify(result.PRNumber, result.Outcome, result.MergeCommitSHA, runID); err != nil {
+		m.logger.WithError(err).Warn("Failed to save PR tracking state")
+	}
+	failureType := string(result.FailureType)
+	if failureType == "" {
+		failureType = "unknown"
+	}
+	agentMetrics.recordFixVerification(failureType, result.Outcome)
+	m.auditLog.Record(result.FailedRunID, "", AuditFixVerified, map[string]interface{}{
+		"number":              result.PRNumber,
+		"outcome":             result.Outcome,
+		"merge_commit_sha":    result.MergeCommitSHA,
+		"verification_run_id": runID,
+	})
+	m.logger.WithFields(logrus.Fields{
+		"pr_number":           result.PRNumber,
+		"outcome":             result.Outcome,
+		"verification_run_id": runID,
+		"reason":              result.Reason,
+	}).Info("Merged fix verified")
+
+	if result.Run == nil {
+		return
+	}
+	if !result.Verified() && m.FollowUpAnalysis {
+		analysis, err := m.AnalyzeFailure(ctx, result.Run.ID)
+		if err != nil {
+			m.logger.WithError(err).WithField("run_id", result.Run.ID).Warn("Follow-up analysis failed")
+		} else {
+			result.FollowUp = analysis
+		}
+	}
+	if err := m.githubClient.AddPullRequestComment(ctx, result.PRNumber, verificationComment(result)); err != nil {
+		m.logger.WithError(err).WithField("pr_number", result.PRNumber).Warn("Failed to comment the verification on the fix PR")
+	}
+}
+
+// verificationComment is the comment telling a merged fix PR how its workflow did afterwards
+func verificationComment(result *VerificationResult) string {
+	run := result.Run
+	var b strings.Builder
+	if result.Verified() {
+		fmt.Fprintf(&b, "✅ %s succeeded on %s after this fix", workflowLabel(run.Name), run.Branch)
+	} else {
+		fmt.Fprintf(&b, "❌ %s failed again on %s after this fix", workflowLabel(run.Name), run.Branch)
+	}
+	fmt.Fprintf(&b, " (commit %s", shortSHA(result.MergeCommitSHA))
+	if run.URL != "" {
+		fmt.Fprintf(&b, ", [run #%d](%s)", run.ID, run.URL)
+	}
+	b.WriteString(").")
+	if result.FollowUp != nil {
+		fmt.Fprintf(&b, "\n\nFollow-up analysis (%s): %s", result.FollowUp.Classification.Type, result.FollowUp.RootCause)
+	}
+	return b.String()
+}
+
+// workflowLabel names a workflow in messages, every workflow when it is empty
+func workflowLabel(workflow string) string {
+	if workflow == "" {
+		return "The workflows"
+	}
+	return fmt.Sprintf("Workflow %s", workflow)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const mergeSHA = "f00dfeed1234567890"
+
+// verificationAutofix returns an agent tracking the fix PR #100 it opened for a failed CI run.
+// The PR is merged at mergeSHA, whose workflow runs are the next entry of runs on each
+// lookup, the last entry repeating. Comments on PRs are recorded in comments.
+func verificationAutofix(t *testing.T, runs [][]*WorkflowRun) (*DaggerAutofix, map[int][]string) {
+	statuses := map[int]*PullRequest{
+		100: {Number: 100, State: "closed", Merged: true, MergeCommitSHA: mergeSHA, MergedAt: time.Now()},
+	}
+	m := trackingAutofix(filepath.Join(t.TempDir(), "state.json"), statuses, make(map[int]string))
+	_, err := m.AutoFix(context.Background(), 100)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	lookups := 0
+	comments := make(map[int][]string)
+	gh := m.githubClient.(*mockGitHub)
+	gh.getCommitRunsFunc = func(ctx context.Context, branch, sha string, since time.Time) ([]*WorkflowRun, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "main", branch)
+		assert.Equal(t, mergeSHA, sha)
+		next := runs[min(lookups, len(runs)-1)]
+		lookups++
+		return next, nil
+	}
+	gh.addPullRequestCommentFunc = func(ctx context.Context, number int, body string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		comments[number] = append(comments[number], body)
+		return nil
+	}
+	return m, comments
+}
+
+func mergeRun(id int64, name, status, conclusion string) *WorkflowRun {
+	return &WorkflowRun{ID: id, Name: name, Status: status, Conclusion: conclusion, Branch: "main", CommitSHA: mergeSHA,
+		URL: fmt.Sprintf("https://github.com/test/repo/actions/runs/%d", id)}
+}
+
+// verifiedCount returns the verified fixes of failureType counted in the Prometheus metrics
+func verifiedCount(failureType FailureType) float64 {
+	c := agentMetrics.fixVerifications
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[formatLabels(c.labels, []string{string(failureType), VerificationVerified})]
+}
+
+// TestVerifyFix tests verifying a merged fix PR by the run of its workflow at the merge commit
+func TestVerifyFix(t *testing.T) {
+	ctx := context.Background()
+	defer func(interval time.Duration) { verificationPollInterval = interval }(verificationPollInterval)
+	verificationPollInterval = time.Millisecond
+
+	t.Run("Verified", func(t *testing.T) {
+		m, comments := verificationAutofix(t, [][]*WorkflowRun{
+			nil,
+			{mergeRun(201, "CI", "in_progress", "")},
+			{mergeRun(202, "Lint", "completed", "failure"), mergeRun(201, "CI", "completed", "success")},
+		})
+
+		result, err := m.VerifyFix(ctx, 100)
+		require.NoError(t, err)
+		assert.True(t, result.Verified())
+		assert.Equal(t, int64(201), result.Run.ID, "other workflows do not count")
+		assert.Equal(t, int64(100), result.FailedRunID)
+		assert.Equal(t, TestFailure, result.FailureType)
+		require.Len(t, comments[100], 1)
+		assert.Contains(t, comments[100][0], "✅ Workflow CI succeeded on main after this fix (commit f00dfeed")
+
+		metrics, err := m.GetMetrics(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, metrics.SuccessfulFixes)
+		assert.Equal(t, 1, metrics.VerifiedFixes)
+		assert.Equal(t, map[FailureType]float64{TestFailure: 1}, metrics.VerifiedRateByType)
+	})
+
+	t.Run("FailedAgain", func(t *testing.T) {
+		m, comments := verificationAutofix(t, [][]*WorkflowRun{{mergeRun(203, "CI", "completed", "failure")}})
+		m.FollowUpAnalysis = true
+
+		result, err := m.VerifyFix(ctx, 100)
+		require.NoError(t, err)
+		assert.False(t, result.Verified())
+		assert.Equal(t, VerificationUnverified, result.Outcome)
+		require.NotNil(t, result.FollowUp)
+		assert.Equal(t, int64(203), result.FollowUp.Context.WorkflowRun.ID)
+		require.Len(t, comments[100], 1)
+		assert.Contains(t, comments[100][0], "❌ Workflow CI failed again on main after this fix")
+		assert.Contains(t, comments[100][0], "Follow-up analysis (test)")
+
+		metrics, err := m.GetMetrics(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, metrics.VerifiedFixes)
+		assert.Equal(t, 1, metrics.UnverifiedFixes)
+		assert.Equal(t, map[FailureType]float64{TestFailure: 0}, metrics.VerifiedRateByType)
+	})
+
+	t.Run("NoRunInTime", func(t *testing.T) {
+		m, comments := verificationAutofix(t, [][]*WorkflowRun{nil})
+		m.VerificationTimeout = 20 * time.Millisecond
+
+		result, err := m.VerifyFix(ctx, 100)
+		require.NoError(t, err)
+		assert.Equal(t, VerificationUnverified, result.Outcome)
+		assert.Nil(t, result.Run)
+		assert.Contains(t, result.Reason, "Workflow CI did not complete at the merge commit")
+		assert.Empty(t, comments, "there is no run to report")
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		m, _ := verificationAutofix(t, [][]*WorkflowRun{nil})
+		_, err := m.VerifyFix(ctx, 0)
+		assert.ErrorIs(t, err, ErrInvalidPRNumber)
+		_, err = m.VerifyFix(ctx, 300)
+		assert.ErrorContains(t, err, "pull request #300 is not merged")
+		_, err = (&DaggerAutofix{}).VerifyFix(ctx, 100)
+		assert.ErrorIs(t, err, ErrNotInitialized)
+	})
+}
+
+// TestReconcilePRsVerifiesMergedFixes tests that reconciliation verifies merged fix PRs once
+// their workflow completed at the merge commit, without waiting for it
+func TestReconcilePRsVerifiesMergedFixes(t *testing.T) {
+	ctx := context.Background()
+	m, comments := verificationAutofix(t, [][]*WorkflowRun{
+		{mergeRun(201, "CI", "queued", "")},
+		{mergeRun(201, "CI", "completed", "success")},
+	})
+	observed := verifiedCount(TestFailure)
+
+	require.NoError(t, m.ReconcilePRs(ctx))
+	tracker, err := m.prTracking()
+	require.NoError(t, err)
+	tracked, _ := tracker.get(100)
+	assert.Equal(t, VerificationPending, tracked.Verification)
+	assert.Equal(t, mergeSHA, tracked.MergeCommitSHA)
+	assert.Empty(t, comments)
+
+	require.NoError(t, m.ReconcilePRs(ctx))
+	tracked, _ = tracker.get(100)
+	assert.Equal(t, VerificationVerified, tracked.Verification)
+	assert.Equal(t, int64(201), tracked.VerificationRunID)
+	assert.Len(t, comments[100], 1)
+	assert.Equal(t, observed+1, verifiedCount(TestFailure))
+
+	// Verified PRs are not checked again
+	require.NoError(t, m.ReconcilePRs(ctx))
+	assert.Len(t, comments[100], 1)
+	assert.Empty(t, tracker.pendingVerifications())
+
+	restarted, err := loadPRTracker(m.StateFile)
+	require.NoError(t, err)
+	assert.Equal(t, 1, restarted.outcomes().verified, "the outcome is persisted")
+}
+
+// TestVerifyCommand tests the exit codes of the verify command
+func TestVerifyCommand(t *testing.T) {
+	ctx := context.Background()
+
+	cli, out := outputCLI(t, OutputText)
+	m, _ := verificationAutofix(t, [][]*WorkflowRun{{mergeRun(201, "CI", "completed", "success")}})
+	require.NoError(t, cli.verifyFix(ctx, m, 100))
+	assert.Contains(t, out.String(), "Outcome: verified\n")
+
+	cli, out = outputCLI(t, OutputJSON)
+	m, _ = verificationAutofix(t, [][]*WorkflowRun{{mergeRun(203, "CI", "completed", "failure")}})
+	err := cli.verifyFix(ctx, m, 100)
+	assert.Equal(t, exitChecksFailed, exitCode(err))
+	assert.Contains(t, out.String(), `"outcome": "unverified"`)
+
+	cli, _ = outputCLI(t, OutputText)
+	cli.rootCmd.SetArgs([]string{"verify", "abc"})
+	assert.Equal(t, exitInvalidInput, exitCode(cli.rootCmd.Execute()))
+}
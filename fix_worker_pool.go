@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultMaxConcurrentFixes is how many auto-fix pipelines run in parallel
+	DefaultMaxConcurrentFixes = 2
+	// DefaultFixTimeout bounds a single auto-fix run
+	DefaultFixTimeout = 30 * time.Minute
+	// fixQueueSize is how many failed runs may wait for a free worker before new ones are skipped
+	fixQueueSize = MaxConcurrentOps
+	// DefaultDrainTimeout is how long shutdown waits for in-flight fixes before cancelling them
+	DefaultDrainTimeout = 5 * time.Minute
+	// fixCancelGrace is how long shutdown waits for cancelled fixes to return
+	fixCancelGrace = 30 * time.Second
+)
+
+// fixStats counts auto-fix outcomes for GetMetrics
+type fixStats struct {
+	failuresDetected atomic.Int64
+	completedFixes   atomic.Int64
+	failedFixes      atomic.Int64
+	flakyResolved    atomic.Int64 // failures resolved by re-running them instead of fixing
+	clusteredRuns    atomic.Int64 // failed runs left to the fix of a run failing the same way
+}
+
+// fixWorkerPool runs auto-fix jobs on a fixed number of workers fed by a bounded queue
+type fixWorkerPool struct {
+	queue   chan int64
+	run     func(ctx context.Context, runID int64) error
+	timeout time.Duration
+	logger  *logrus.Logger
+	stats   *fixStats
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	pending map[int64]bool
+	closed  bool
+}
+
+// newFixWorkerPool starts workers that call run for each submitted workflow run.
+// Jobs run detached from parent's cancellation so shutdown can drain them.
+func newFixWorkerPool(parent context.Context, workers int, timeout time.Duration, run func(ctx context.Context, runID int64) error, stats *fixStats, logger *logrus.Logger) *fixWorkerPool {
+	if workers <= 0 {
+		workers = DefaultMaxConcurrentFixes
+	}
+	if timeout <= 0 {
+		timeout = DefaultFixTimeout
+	}
+
+	ctx, cancel := context.WithCancel(context.WithoutCancel(parent))
+	p := &fixWorkerPool{
+		queue:   make(chan int64, fixQueueSize),
+		run:     run,
+		timeout: timeout,
+		logger:  logger,
+		stats:   stats,
+		ctx:     ctx,
+		cancel:  cancel,
+		pending: make(map[int64]bool),
+	}
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+
+	return p
+}
+
+// Submit queues a workflow run for fixing. It returns false if the run is already
+// queued or running, the queue is full, or the pool is shutting down.
+func (p *fixWorkerPool) Submit(runID int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || p.pending[runID] {
+		return false
+	}
+
+	select {
+	case p.queue <- runID:
+		p.pending[runID] = true
+		return true
+	default:
+		p.logger.WithField("run_id", runID).Warn("Auto-fix queue is full, skipping workflow run")
+		return false
+	}
+}
+
+// Shutdown stops accepting work and waits up to drainTimeout for queued and in-flight
+// fixes to finish. Fixes still running after the timeout are cancelled, and abandoned when
+// they do not return within fixCancelGrace.
+func (p *fixWorkerPool) Shutdown(drainTimeout time.Duration) error {
+	done := p.stop()
+
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-time.After(drainTimeout):
+		p.cancel()
+		select {
+		case <-done:
+		case <-time.After(fixCancelGrace):
+			p.logger.Warn("Cancelled auto-fix runs did not return, abandoning them")
+		}
+		return fmt.Errorf("auto-fix runs did not finish within %v", drainTimeout)
+	}
+}
+
+// Wait stops accepting work and waits for queued and in-flight fixes to finish. When ctx is
+// done first, the remaining fixes are drained as by Shutdown.
+func (p *fixWorkerPool) Wait(ctx context.Context, drainTimeout time.Duration) error {
+	select {
+	case <-p.stop():
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		return p.Shutdown(drainTimeout)
+	}
+}
+
+// stop stops accepting work and returns a channel closed once the workers have returned
+func (p *fixWorkerPool) stop() <-chan struct{} {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+func (p *fixWorkerPool) worker() {
+	defer p.wg.Done()
+
+	for runID := range p.queue {
+		p.process(runID)
+
+		p.mu.Lock()
+		delete(p.pending, runID)
+		p.mu.Unlock()
+	}
+}
+
+// process runs a single fix with its own timeout, converting panics into failures
+func (p *fixWorkerPool) process(runID int64) {
+	ctx, cancel := context.WithTimeout(p.ctx, p.timeout)
+	defer cancel()
+
+	logger := p.logger.WithField("run_id", runID)
+
+	defer func() {
+		if r := recover(); r != nil {
+			p.stats.failedFixes.Add(1)
+			logger.WithFields(logrus.Fields{
+				"panic": r,
+				"stack": string(debug.Stack()),
+			}).Error("Auto-fix panicked")
+		}
+	}()
+
+	if err := p.run(ctx, runID); err != nil {
+		p.stats.failedFixes.Add(1)
+		logger.WithError(err).Error("Auto-fix failed")
+		return
+	}
+	p.stats.completedFixes.Add(1)
+}
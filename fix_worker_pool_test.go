@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func quietLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+	return logger
+}
+
+// blockingAutofix builds a module whose failure analysis blocks until release is closed
+func blockingAutofix(runIDs []int64, started chan<- int64, release <-chan struct{}, active, maxActive *int32) *DaggerAutofix {
+	var runs []*WorkflowRun
+	for _, id := range runIDs {
+		runs = append(runs, &WorkflowRun{ID: id})
+	}
+
+	m := fixtureAutofix(nil)
+	m.MaxConcurrentFixes = 2
+	m.githubClient.(*mockGitHub).getFailedWorkflowRunsFunc = func(ctx context.Context) ([]*WorkflowRun, error) {
+		return runs, nil
+	}
+	m.failureEngine.(*mockFailureAnalysisEngine).analyzeFunc = func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+		n := atomic.AddInt32(active, 1)
+		defer atomic.AddInt32(active, -1)
+		for {
+			current := atomic.LoadInt32(maxActive)
+			if n <= current || atomic.CompareAndSwapInt32(maxActive, current, n) {
+				break
+			}
+		}
+
+		started <- fc.WorkflowRun.ID
+		select {
+		case <-release:
+			return nil, errors.New("analysis failed")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return m
+}
+
+// TestCheckForFailuresConcurrencyCap verifies no more than MaxConcurrentFixes run at once
+func TestCheckForFailuresConcurrencyCap(t *testing.T) {
+	var active, maxActive int32
+	started := make(chan int64, 10)
+	release := make(chan struct{})
+
+	m := blockingAutofix([]int64{1, 2, 3, 4, 5}, started, release, &active, &maxActive)
+	require.NoError(t, m.checkForFailures(context.Background()))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for workers to start")
+		}
+	}
+
+	// Give a third worker the chance to (incorrectly) start
+	select {
+	case id := <-started:
+		t.Fatalf("run %d started while the pool was saturated", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&active))
+
+	close(release)
+	m.drainFixes()
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxActive))
+	assert.Len(t, started, 3)
+
+	metrics, err := m.GetMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 5, metrics.TotalFailuresDetected)
+	assert.Equal(t, 5, metrics.FailedFixes)
+}
+
+// TestFixWorkerPoolQueueOverflow verifies full queues and duplicate runs are skipped
+func TestFixWorkerPoolQueueOverflow(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	pool := newFixWorkerPool(context.Background(), 1, time.Minute, func(ctx context.Context, runID int64) error {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return nil
+	}, &fixStats{}, quietLogger())
+
+	require.True(t, pool.Submit(1))
+	<-started
+
+	assert.False(t, pool.Submit(1), "running job should not be queued twice")
+	for id := int64(2); id < 2+fixQueueSize; id++ {
+		require.True(t, pool.Submit(id))
+	}
+	assert.False(t, pool.Submit(100), "full queue should skip new runs")
+
+	close(release)
+	require.NoError(t, pool.Shutdown(time.Second))
+	assert.False(t, pool.Submit(101), "stopped pool should not accept runs")
+}
+
+// TestFixWorkerPoolPanicRecovery verifies a panicking fix is recorded and the worker keeps going
+func TestFixWorkerPoolPanicRecovery(t *testing.T) {
+	stats := &fixStats{}
+	var mu sync.Mutex
+	var processed []int64
+
+	pool := newFixWorkerPool(context.Background(), 1, time.Minute, func(ctx context.Context, runID int64) error {
+		mu.Lock()
+		processed = append(processed, runID)
+		mu.Unlock()
+		if runID == 1 {
+			panic("boom")
+		}
+		return nil
+	}, stats, quietLogger())
+
+	require.True(t, pool.Submit(1))
+	require.True(t, pool.Submit(2))
+	require.NoError(t, pool.Shutdown(time.Second))
+
+	assert.Equal(t, []int64{1, 2}, processed)
+	assert.Equal(t, int64(1), stats.failedFixes.Load())
+	assert.Equal(t, int64(1), stats.completedFixes.Load())
+}
+
+// TestFixWorkerPoolTimeouts verifies per-run and drain timeouts cancel stuck fixes
+func TestFixWorkerPoolTimeouts(t *testing.T) {
+	t.Run("PerRunTimeout", func(t *testing.T) {
+		stats := &fixStats{}
+		pool := newFixWorkerPool(context.Background(), 1, 20*time.Millisecond, func(ctx context.Context, runID int64) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, stats, quietLogger())
+
+		require.True(t, pool.Submit(1))
+		require.NoError(t, pool.Shutdown(time.Second))
+		assert.Equal(t, int64(1), stats.failedFixes.Load())
+	})
+
+	t.Run("DrainTimeout", func(t *testing.T) {
+		started := make(chan struct{})
+		pool := newFixWorkerPool(context.Background(), 1, time.Hour, func(ctx context.Context, runID int64) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}, &fixStats{}, quietLogger())
+
+		require.True(t, pool.Submit(1))
+		<-started
+		err := pool.Shutdown(20 * time.Millisecond)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "did not finish")
+	})
+}
+
+// TestMonitorWorkflowsDrainsInFlightFixes verifies cancellation waits for running fixes
+func TestMonitorWorkflowsDrainsInFlightFixes(t *testing.T) {
+	var active, maxActive int32
+	started := make(chan int64, 10)
+	release := make(chan struct{})
+	m := blockingAutofix([]int64{7}, started, release, &active, &maxActive)
+
+	oldTicker := newTicker
+	newTicker = func(d time.Duration) *time.Ticker {
+		return time.NewTicker(time.Millisecond)
+	}
+	defer func() { newTicker = oldTicker }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- m.MonitorWorkflows(ctx)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for fix to start")
+	}
+	cancel()
+
+	select {
+	case <-errCh:
+		t.Fatal("monitor exited before the in-flight fix finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case err := <-errCh:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("monitor did not exit after draining")
+	}
+	assert.Equal(t, int64(1), m.stats.failedFixes.Load())
+}
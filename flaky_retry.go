@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultFlakyRetryMaxAge is how recent a success of the same workflow on the same commit
+	// must be to mark a failure as flaky
+	DefaultFlakyRetryMaxAge = 24 * time.Hour
+	// flakyRetryTimeout bounds the wait for the re-run of a flaky failure
+	flakyRetryTimeout = 20 * time.Minute
+)
+
+// Flaky retry outcomes, used as metric labels and in AutoFix metadata
+const (
+	flakyRetryResolved     = "resolved"
+	flakyRetryStillFailing = "still_failing"
+	flakyRetryError        = "error"
+)
+
+// retryFlakyFailure re-runs the failed jobs of a run that looks flaky and waits for the new
+// attempt. It returns the retry outcome and why the run looked flaky, or an empty outcome when
+// the run was not retried. Errors are logged so AutoFix can go on to analyze the failure.
+func (m *DaggerAutofix) retryFlakyFailure(ctx context.Context, runID int64) (string, string) {
+	logger := m.logger.WithField("run_id", runID)
+	run, err := m.githubClient.GetWorkflowRun(ctx, runID)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to get workflow run, skipping flaky retry")
+		return "", ""
+	}
+	if run.RunAttempt > 1 {
+		// Retrying again would loop on failures that only looked flaky
+		logger.WithField("attempt", run.RunAttempt).Debug("Workflow run was already re-run, skipping flaky retry")
+		return "", ""
+	}
+	logs, err := m.githubClient.GetWorkflowLogs(ctx, runID)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to get workflow logs, skipping flaky retry")
+		return "", ""
+	}
+	reason := m.flakyReason(ctx, run, logs)
+	if reason == "" {
+		return "", ""
+	}
+
+	logger.WithField("reason", reason).Info("Failure looks flaky, re-running failed jobs")
+	if err := m.githubClient.RerunWorkflowFailedJobs(ctx, runID); err != nil {
+		logger.WithError(err).Warn("Failed to re-run failed jobs, analyzing the failure")
+		agentMetrics.recordFlakyRetry(flakyRetryError)
+		return flakyRetryError, reason
+	}
+	audit(ctx, AuditWorkflowRerun, map[string]interface{}{
+		"reason":  reason,
+		"attempt": run.RunAttempt + 1,
+	})
+
+	waitCtx, cancel := context.WithTimeout(ctx, flakyRetryTimeout)
+	rerun, err := m.WaitForRunCompletion(waitCtx, runID, run.RunAttempt+1)
+	cancel()
+	if err != nil {
+		logger.WithError(err).Warn("Failed to wait for re-run, analyzing the failure")
+		agentMetrics.recordFlakyRetry(flakyRetryError)
+		return flakyRetryError, reason
+	}
+	if rerun.Conclusion != "success" {
+		logger.WithField("conclusion", rerun.Conclusion).Info("Re-run failed too, analyzing the failure")
+		agentMetrics.recordFlakyRetry(flakyRetryStillFailing)
+		return flakyRetryStillFailing, reason
+	}
+
+	logger.WithFields(logrus.Fields{
+		"reason":  reason,
+		"attempt": rerun.RunAttempt,
+	}).Info("Re-run succeeded, failure was flaky")
+	agentMetrics.recordFlakyRetry(flakyRetryResolved)
+	m.stats.flakyResolved.Add(1)
+	if m.AnalysisComments && run.CommitSHA != "" {
+		if err := m.githubClient.CreateCommitComment(ctx, run.CommitSHA, formatFlakyComment(rerun, reason)); err != nil {
+			logger.WithError(err).Warn("Failed to post flaky failure comment")
+		}
+	}
+	return flakyRetryResolved, reason
+}
+
+// flakyReason returns why a failed run looks flaky, or "" when it looks like a real failure
+func (m *DaggerAutofix) flakyReason(ctx context.Context, run *WorkflowRun, logs *WorkflowLogs) string {
+	classifier := &FailureAnalysisEngine{logger: m.logger, patterns: builtinErrorPatterns}
+	classification := classifier.preClassifyFailure(FailureContext{WorkflowRun: run, Logs: logs})
+	if classification.Category == Transient || classification.Category == Flaky {
+		return fmt.Sprintf("logs match a %s error pattern", classification.Category)
+	}
+
+	maxAge := m.FlakyRetryMaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultFlakyRetryMaxAge
+	}
+	successes, err := m.githubClient.GetSuccessfulWorkflowRuns(ctx, run.Branch, run.CommitSHA, time.Now().Add(-maxAge))
+	if err != nil {
+		m.logger.WithError(err).WithField("run_id", run.ID).Warn("Failed to list successful runs of the commit")
+		return ""
+	}
+	for _, success := range successes {
+		if success.ID != run.ID && success.Name == run.Name {
+			return fmt.Sprintf("workflow succeeded on the same commit in run %d", success.ID)
+		}
+	}
+	return ""
+}
+
+// formatFlakyComment tells the commit author the failure went away on a re-run
+func formatFlakyComment(run *WorkflowRun, reason string) string {
+	var body strings.Builder
+
+	body.WriteString("## 🤖 Flaky Failure Resolved by Retry\n\n")
+	body.WriteString(fmt.Sprintf("The **%s** workflow failed, but its failed jobs passed when re-run, so no fix pull request was opened.\n\n", run.Name))
+	body.WriteString(fmt.Sprintf("**Why it looked flaky**: %s\n", reason))
+	body.WriteString(fmt.Sprintf("**Passing Attempt**: %d", run.RunAttempt))
+	if run.URL != "" {
+		body.WriteString(fmt.Sprintf(" ([view run](%s))", run.URL))
+	}
+	body.WriteString("\n\n")
+
+	body.WriteString("---\n")
+	body.WriteString("*This comment was automatically generated by the GitHub Actions Auto-Fix Agent*\n")
+
+	return body.String()
+}
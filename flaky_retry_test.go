@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fastWorkflowPolling makes WaitForWorkflowRun poll every millisecond for the test
+func fastWorkflowPolling(t *testing.T) {
+	previous := workflowRunPollInterval
+	workflowRunPollInterval = time.Millisecond
+	t.Cleanup(func() { workflowRunPollInterval = previous })
+}
+
+// TestWaitForWorkflowRun tests that a re-run is followed through queued, in_progress and
+// completed, ignoring the completed attempt that was re-run
+func TestWaitForWorkflowRun(t *testing.T) {
+	fastWorkflowPolling(t)
+	g, mux := newMockGitHubAPI(t)
+
+	var reruns int32
+	mux.HandleFunc("/repos/owner/repo/actions/runs/7/rerun-failed-jobs", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		atomic.AddInt32(&reruns, 1)
+		w.WriteHeader(http.StatusCreated)
+	})
+	states := []map[string]interface{}{
+		{"status": "completed", "conclusion": "failure", "run_attempt": 1},
+		{"status": "queued", "run_attempt": 2},
+		{"status": "in_progress", "run_attempt": 2},
+		{"status": "completed", "conclusion": "success", "run_attempt": 2},
+	}
+	var polls int32
+	mux.HandleFunc("/repos/owner/repo/actions/runs/7", func(w http.ResponseWriter, r *http.Request) {
+		state := states[min(int(atomic.AddInt32(&polls, 1))-1, len(states)-1)]
+		state["id"] = 7
+		json.NewEncoder(w).Encode(state)
+	})
+
+	require.NoError(t, g.RerunWorkflowFailedJobs(context.Background(), 7))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reruns))
+
+	run, err := g.WaitForWorkflowRun(context.Background(), 7, 2, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "success", run.Conclusion)
+	assert.Equal(t, 2, run.RunAttempt)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&polls))
+
+	t.Run("Timeout", func(t *testing.T) {
+		states = []map[string]interface{}{{"status": "in_progress", "run_attempt": 2}}
+		_, err := g.WaitForWorkflowRun(context.Background(), 7, 2, 20*time.Millisecond)
+		assert.ErrorContains(t, err, "timed out waiting for workflow run 7 to complete")
+	})
+}
+
+// flakyAutofix returns an agent whose run 1 failed with errorLine and whose re-run concludes
+// with conclusion. The re-run attempts and posted comments are counted.
+func flakyAutofix(errorLine, conclusion string, reruns *int, comments *[]string) *DaggerAutofix {
+	m := fixtureAutofix(nil).WithFlakyRetry(true, time.Hour)
+	gh := m.githubClient.(*mockGitHub)
+	gh.getWorkflowRunFunc = func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+		return &WorkflowRun{ID: runID, Name: "CI", Branch: "main", CommitSHA: "abc123", Status: "completed", Conclusion: "failure", RunAttempt: 1}, nil
+	}
+	gh.getWorkflowLogsFunc = func(ctx context.Context, runID int64) (*WorkflowLogs, error) {
+		return &WorkflowLogs{RawLogs: errorLine, ErrorLines: []string{errorLine}}, nil
+	}
+	gh.rerunFailedJobsFunc = func(ctx context.Context, runID int64) error {
+		*reruns++
+		return nil
+	}
+	gh.waitForWorkflowRunFunc = func(ctx context.Context, runID int64, minAttempt int, timeout time.Duration) (*WorkflowRun, error) {
+		return &WorkflowRun{ID: runID, Name: "CI", Status: "completed", Conclusion: conclusion, RunAttempt: minAttempt}, nil
+	}
+	gh.createCommitCommentFunc = func(ctx context.Context, sha, body string) error {
+		*comments = append(*comments, body)
+		return nil
+	}
+	return m
+}
+
+// TestAutoFixFlakyRetry tests the re-run of failures that look flaky before fixing them
+func TestAutoFixFlakyRetry(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ResolvedSkipsFix", func(t *testing.T) {
+		metrics := useTestMetrics(t)
+		var reruns int
+		var comments []string
+		m := flakyAutofix("TestFetch: timeout after 30s", "success", &reruns, &comments).WithAnalysisComments(true)
+		analyzed := false
+		m.failureEngine.(*mockFailureAnalysisEngine).analyzeFunc = func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+			analyzed = true
+			return nil, assert.AnError
+		}
+
+		result, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+		assert.Nil(t, result.PullRequest)
+		assert.False(t, analyzed, "no LLM analysis is spent on a flaky failure")
+		assert.Equal(t, 1, reruns)
+		assert.Equal(t, flakyRetryResolved, result.Metadata["flaky_retry"])
+		assert.Equal(t, "logs match a transient error pattern", result.Metadata["flaky_reason"])
+
+		require.Len(t, comments, 1)
+		assert.Contains(t, comments[0], "Flaky Failure Resolved by Retry")
+		assert.Contains(t, comments[0], "**Passing Attempt**: 2")
+
+		operational, err := m.GetMetrics(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, operational.FlakyResolvedByRetry)
+		body := scrapeMetrics(t, metrics)
+		assert.Contains(t, body, `github_autofix_flaky_retries_total{outcome="resolved"} 1`+"\n")
+		assert.NotContains(t, body, "github_autofix_fixes_attempted_total{", "a flaky failure is not a fix attempt")
+	})
+
+	t.Run("StillFailingContinues", func(t *testing.T) {
+		metrics := useTestMetrics(t)
+		var reruns int
+		var comments []string
+		m := flakyAutofix("TestFetch: timeout after 30s", "failure", &reruns, &comments)
+
+		result, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, reruns)
+		require.NotNil(t, result.PullRequest, "the fix pipeline runs when the re-run fails too")
+		assert.Equal(t, flakyRetryStillFailing, result.Metadata["flaky_retry"])
+		assert.Empty(t, comments)
+		assert.Contains(t, scrapeMetrics(t, metrics), `github_autofix_flaky_retries_total{outcome="still_failing"} 1`+"\n")
+	})
+
+	t.Run("RecentSuccessOnCommit", func(t *testing.T) {
+		useTestMetrics(t)
+		var reruns int
+		var comments []string
+		m := flakyAutofix("build failed", "success", &reruns, &comments)
+		var since time.Time
+		m.githubClient.(*mockGitHub).getSuccessfulRunsFunc = func(ctx context.Context, branch, sha string, after time.Time) ([]*WorkflowRun, error) {
+			assert.Equal(t, "main", branch)
+			assert.Equal(t, "abc123", sha)
+			since = after
+			return []*WorkflowRun{{ID: 5, Name: "Lint"}, {ID: 6, Name: "CI"}}, nil
+		}
+
+		result, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 1, reruns)
+		assert.Equal(t, "workflow succeeded on the same commit in run 6", result.Metadata["flaky_reason"])
+		assert.WithinDuration(t, time.Now().Add(-time.Hour), since, time.Minute)
+	})
+
+	t.Run("NotFlaky", func(t *testing.T) {
+		useTestMetrics(t)
+		var reruns int
+		var comments []string
+		m := flakyAutofix("build failed", "success", &reruns, &comments)
+		m.githubClient.(*mockGitHub).getSuccessfulRunsFunc = func(ctx context.Context, branch, sha string, after time.Time) ([]*WorkflowRun, error) {
+			return []*WorkflowRun{{ID: 5, Name: "Lint"}}, nil
+		}
+
+		result, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Zero(t, reruns)
+		require.NotNil(t, result.PullRequest)
+		assert.NotContains(t, result.Metadata, "flaky_retry")
+	})
+
+	t.Run("AlreadyRerun", func(t *testing.T) {
+		useTestMetrics(t)
+		var reruns int
+		var comments []string
+		m := flakyAutofix("TestFetch: timeout after 30s", "success", &reruns, &comments)
+		gh := m.githubClient.(*mockGitHub)
+		gh.getWorkflowRunFunc = func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+			return &WorkflowRun{ID: runID, Name: "CI", CommitSHA: "abc123", Conclusion: "failure", RunAttempt: 2}, nil
+		}
+
+		_, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Zero(t, reruns, "a failed re-run is not retried again")
+	})
+
+	t.Run("DisabledOrDryRun", func(t *testing.T) {
+		useTestMetrics(t)
+		var reruns int
+		var comments []string
+		m := flakyAutofix("TestFetch: timeout after 30s", "success", &reruns, &comments).WithDryRun(true)
+		_, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+
+		m = flakyAutofix("TestFetch: timeout after 30s", "success", &reruns, &comments).WithFlakyRetry(false, 0)
+		_, err = m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Zero(t, reruns)
+	})
+}
+
+// TestFlakyRetryConfig tests the CLI flaky retry settings
+func TestFlakyRetryConfig(t *testing.T) {
+	clearConfigEnv(t)
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	config := cli.getCurrentConfig(cli.rootCmd)
+	assert.False(t, config.FlakyRetry)
+	assert.Equal(t, DefaultFlakyRetryMaxAge, config.FlakyRetryMaxAge)
+
+	t.Setenv("FLAKY_RETRY_MAX_AGE", "6h")
+	require.NoError(t, cli.rootCmd.ParseFlags([]string{"--flaky-retry"}))
+	config = cli.getCurrentConfig(cli.rootCmd)
+	assert.True(t, config.FlakyRetry)
+	assert.Equal(t, 6*time.Hour, config.FlakyRetryMaxAge)
+
+	t.Setenv("FLAKY_RETRY_MAX_AGE", "-1h")
+	config = cli.getCurrentConfig(cli.rootCmd)
+	var messages []string
+	for _, problem := range validateCLIConfig(config) {
+		messages = append(messages, problem.String())
+	}
+	assert.Contains(t, messages, "monitoring.flaky_retry_max_age (env FLAKY_RETRY_MAX_AGE): must not be negative, got -1h0m0s")
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// frameworkMarkerFiles identify a framework, checked in this order in each scanned directory.
+// Markers may be globs for files named after the project.
+var frameworkMarkerFiles = []string{
+	"package.json", "go.mod", "pom.xml", "requirements.txt", "Cargo.toml", "composer.json",
+	"build.gradle", "build.gradle.kts", "settings.gradle", "settings.gradle.kts",
+	"*.sln", "*.csproj", "Gemfile",
+}
+
+// aggregatingFrameworks build and test their subprojects from the repository root, so their
+// subprojects are not detected separately when the root already uses the framework
+var aggregatingFrameworks = map[string]bool{
+	"gradle": true,
+	"dotnet": true,
+}
+
+// ignoredFrameworkDirs hold dependencies or build output and are never scanned for frameworks
+var ignoredFrameworkDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"target":       true,
+	"dist":         true,
+	"build":        true,
+}
+
+// detectFrameworksIn returns the frameworks whose marker files are among a directory's entries
+func (e *TestEngine) detectFrameworksIn(ctx context.Context, container ContainerInterface, dir string, entries []string) []*TestFramework {
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		present[strings.TrimSuffix(entry, "/")] = true
+	}
+
+	var frameworks []*TestFramework
+	detected := make(map[string]bool)
+	for _, marker := range frameworkMarkerFiles {
+		file, ok := markerEntry(marker, entries, present)
+		if !ok {
+			continue
+		}
+
+		// Several markers can identify the same framework, e.g. build.gradle and settings.gradle
+		base := e.getFrameworkByFile(file)
+		if base == nil || detected[base.Name] {
+			continue
+		}
+		detected[base.Name] = true
+
+		framework := *base
+		switch base.Name {
+		case "nodejs":
+			framework = *e.detectNodeFramework(ctx, container, dir, base, present)
+		case "gradle":
+			framework = *gradleFramework(base, present)
+		}
+		framework.Path = dir
+		frameworks = append(frameworks, &framework)
+	}
+	return frameworks
+}
+
+// markerEntry returns the directory entry matching a marker file or glob
+func markerEntry(marker string, entries []string, present map[string]bool) (string, bool) {
+	if !strings.ContainsAny(marker, "*?[") {
+		return marker, present[marker]
+	}
+	for _, entry := range entries {
+		if name := strings.TrimSuffix(entry, "/"); matchesMarker(marker, name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// matchesMarker reports whether a file name matches a marker glob such as "*.csproj"
+func matchesMarker(marker, name string) bool {
+	matched, err := path.Match(marker, name)
+	return err == nil && matched
+}
+
+// gradleFramework runs the project's Gradle wrapper when it has one, so the build uses the
+// Gradle version the project pins
+func gradleFramework(base *TestFramework, present map[string]bool) *TestFramework {
+	framework := *base
+	if !present["gradlew"] {
+		return &framework
+	}
+
+	wrapper := func(command string) string {
+		if rest, ok := strings.CutPrefix(command, "gradle "); ok {
+			return "./gradlew " + rest
+		}
+		return command
+	}
+	framework.Framework = "gradlew"
+	framework.TestCommand = wrapper(base.TestCommand)
+	framework.CoverageCommand = wrapper(base.CoverageCommand)
+	framework.BuildCommand = wrapper(base.BuildCommand)
+	framework.LintCommand = wrapper(base.LintCommand)
+	return &framework
+}
+
+// nodeCacheVolumes are the dependency caches of each Node.js package manager
+var nodeCacheVolumes = map[string]map[string]string{
+	"npm":  {"/root/.npm": "npm"},
+	"yarn": {"/usr/local/share/.cache/yarn": "yarn"},
+	"pnpm": {"/root/.local/share/pnpm/store": "pnpm-store"},
+}
+
+// packageJSON holds the parts of package.json used to pick Node.js commands
+type packageJSON struct {
+	Scripts         map[string]string `json:"scripts"`
+	PackageManager  string            `json:"packageManager"` // e.g. "pnpm@8.15.0"
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
+}
+
+// nodeCoverageTools are the coverage capable tools looked for in package.json, in order of
+// preference
+var nodeCoverageTools = []string{"vitest", "jest", "c8"}
+
+// coverageTool returns the coverage capable tool the test script runs, or else the first one
+// among the dependencies, e.g. when the test script delegates to another script
+func (p packageJSON) coverageTool() string {
+	for _, tool := range nodeCoverageTools {
+		if strings.Contains(p.Scripts["test"], tool) {
+			return tool
+		}
+	}
+	for _, tool := range nodeCoverageTools {
+		if _, ok := p.DevDependencies[tool]; ok {
+			return tool
+		}
+		if _, ok := p.Dependencies[tool]; ok {
+			return tool
+		}
+	}
+	return ""
+}
+
+// detectNodeFramework inspects package.json and lockfiles to pick the package manager and
+// the test, lint, build and coverage commands the project actually defines
+func (e *TestEngine) detectNodeFramework(ctx context.Context, container ContainerInterface, dir string, base *TestFramework, present map[string]bool) *TestFramework {
+	var pkg packageJSON
+	contents, err := container.File(path.Join(dir, "package.json")).Contents(ctx)
+	if err == nil {
+		err = json.Unmarshal([]byte(contents), &pkg)
+	}
+	if err != nil {
+		e.logger.WithError(err).WithField("path", dir).Warn("Failed to read package.json, using default Node.js commands")
+	}
+
+	return nodeFramework(base, pkg, nodePackageManager(pkg, present))
+}
+
+// nodePackageManager prefers the packageManager field and falls back to the lockfile
+func nodePackageManager(pkg packageJSON, present map[string]bool) string {
+	if name, _, _ := strings.Cut(pkg.PackageManager, "@"); name == "npm" || name == "yarn" || name == "pnpm" {
+		return name
+	}
+
+	switch {
+	case present["pnpm-lock.yaml"]:
+		return "pnpm"
+	case present["yarn.lock"]:
+		return "yarn"
+	default:
+		return "npm"
+	}
+}
+
+// nodeFramework derives the commands for a Node.js project from its scripts
+func nodeFramework(base *TestFramework, pkg packageJSON, packageManager string) *TestFramework {
+	framework := *base
+	framework.Framework = packageManager
+	framework.CacheVolumes = nodeCacheVolumes[packageManager]
+	framework.Environment = make(map[string]string, len(base.Environment))
+	for key, value := range base.Environment {
+		framework.Environment[key] = value
+	}
+
+	// Binaries from node_modules are run through the package manager
+	runner := map[string]string{"npm": "npx", "yarn": "yarn", "pnpm": "pnpm exec"}[packageManager]
+	script := func(name string) string {
+		if _, ok := pkg.Scripts[name]; ok {
+			return packageManager + " run " + name
+		}
+		return ""
+	}
+
+	testScript := pkg.Scripts["test"]
+	framework.TestCommand = packageManager + " test"
+	if strings.Contains(testScript, "vitest") {
+		// Plain vitest watches for changes outside CI, so run it once explicitly
+		framework.TestCommand = runner + " vitest run"
+	}
+
+	// Without a coverage script the command is synthesized for the coverage tool in use
+	framework.CoverageCommand = script("coverage")
+	if framework.CoverageCommand == "" {
+		switch pkg.coverageTool() {
+		case "vitest":
+			framework.CoverageCommand = runner + " vitest run --coverage"
+		case "jest":
+			framework.CoverageCommand = runner + " jest --coverage"
+		case "c8":
+			framework.CoverageCommand = runner + " c8 " + framework.TestCommand
+			if strings.Contains(testScript, "c8") {
+				// The test script already reports coverage
+				framework.CoverageCommand = framework.TestCommand
+			}
+		}
+	}
+
+	framework.LintCommand = script("lint")
+	framework.BuildCommand = script("build")
+	return &framework
+}
+
+// frameworkDir returns the directory a framework was detected in, "." for the repository root
+func frameworkDir(framework *TestFramework) string {
+	if framework.Path == "" {
+		return "."
+	}
+	return path.Clean(framework.Path)
+}
+
+// frameworkKey identifies a framework in combined results, e.g. "golang" or "nodejs (frontend)"
+func frameworkKey(framework *TestFramework) string {
+	if dir := frameworkDir(framework); dir != "." {
+		return fmt.Sprintf("%s (%s)", framework.Name, dir)
+	}
+	return framework.Name
+}
+
+// selectTestPaths keeps the frameworks in the configured test paths, or all of them when none are set
+func (e *TestEngine) selectTestPaths(frameworks []*TestFramework) ([]*TestFramework, error) {
+	if len(e.testPaths) == 0 {
+		return frameworks, nil
+	}
+
+	allowed := make(map[string]bool, len(e.testPaths))
+	for _, testPath := range e.testPaths {
+		allowed[path.Clean(strings.TrimPrefix(testPath, "/"))] = true
+	}
+
+	var selected []*TestFramework
+	for _, framework := range frameworks {
+		if allowed[frameworkDir(framework)] {
+			selected = append(selected, framework)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no test frameworks detected in %s", strings.Join(e.testPaths, ", "))
+	}
+	return selected, nil
+}
+
+// combineResults merges per-framework results: counts, errors and cases are summed, the run
+// succeeds only if every framework succeeds, and coverage is the lowest across the frameworks
+// that measured it
+func (e *TestEngine) combineResults(frameworks []*TestFramework, results []*TestResult, start time.Time) *TestResult {
+	combined := &TestResult{Success: true, TestsPassed: true, CoverageUnknown: true}
+	perFramework := make(map[string]interface{}, len(results))
+	names := make([]string, 0, len(results))
+	var output strings.Builder
+
+	for i, result := range results {
+		key := frameworkKey(frameworks[i])
+		names = append(names, key)
+
+		combined.Success = combined.Success && result.Success
+		combined.TestsPassed = combined.TestsPassed && result.TestsPassed
+		combined.TotalTests += result.TotalTests
+		combined.PassedTests += result.PassedTests
+		combined.FailedTests += result.FailedTests
+		combined.SkippedTests += result.SkippedTests
+		if !result.CoverageUnknown && (combined.CoverageUnknown || result.Coverage < combined.Coverage) {
+			combined.Coverage = result.Coverage
+			combined.CoverageUnknown = false
+		}
+		combined.Cases = append(combined.Cases, result.Cases...)
+		for _, msg := range result.Errors {
+			combined.Errors = append(combined.Errors, fmt.Sprintf("%s: %s", key, msg))
+		}
+		fmt.Fprintf(&output, "==> %s\n%s\n", key, result.Output)
+
+		details := map[string]interface{}{
+			"path":         frameworkDir(frameworks[i]),
+			"success":      result.Success,
+			"total_tests":  result.TotalTests,
+			"passed_tests": result.PassedTests,
+			"failed_tests": result.FailedTests,
+			"coverage":     result.Coverage,
+			"duration":     result.Duration,
+			"errors":       result.Errors,
+		}
+		for k, v := range result.Details {
+			details[k] = v
+		}
+		perFramework[key] = details
+	}
+
+	combined.Duration = time.Since(start)
+	combined.Output = output.String()
+	combined.Details = map[string]interface{}{
+		"framework":    strings.Join(names, ", "),
+		"frameworks":   perFramework,
+		"min_coverage": e.minCoverage,
+	}
+	return combined
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const goTestJSONPass = `{"Action":"run","Package":"test","Test":"TestServer"}
+{"Action":"pass","Package":"test","Test":"TestServer","Elapsed":0.01}
+{"Action":"pass","Package":"test","Elapsed":0.02}`
+
+// monorepoMock sets up a Go module at the root and a pnpm/vitest frontend subproject
+func monorepoMock() *MockContainerProvider {
+	mockProvider := NewMockContainerProvider()
+	mock := mockProvider.MockContainer
+	mock.FileSystem = map[string]string{
+		"go.mod":                      "module test\n\ngo 1.21",
+		"main.go":                     "package main",
+		".github/workflows/ci.yml":    "name: ci",
+		"frontend/package.json":       `{"name":"web","scripts":{"test":"vitest","lint":"eslint .","build":"vite build"}}`,
+		"frontend/pnpm-lock.yaml":     "lockfileVersion: '6.0'",
+		"node_modules/x/package.json": `{}`,
+	}
+	mock.SetCommandOutput("go test -json ./...", goTestJSONPass, "", 0, nil)
+	mock.SetCommandOutput("go test -coverprofile=coverage.out ./...", "coverage: 91.0% of statements", "", 0, nil)
+	mock.SetCommandOutput("pnpm exec vitest run", " Test Files  2 passed (2)\n      Tests  1 skipped | 6 passed (7)", "", 0, nil)
+	mock.SetCommandOutput("pnpm exec vitest run --coverage", "All files |   82.50 |   70.00 |", "", 0, nil)
+	return mockProvider
+}
+
+func TestDetectFrameworkMonorepo(t *testing.T) {
+	mockProvider := monorepoMock()
+	engine := NewTestEngine(80, quietLogger())
+	engine.SetContainerProvider(mockProvider)
+
+	frameworks, err := engine.detectFramework(context.Background(), &MockContainerWrapper{mockProvider.MockContainer})
+	require.NoError(t, err)
+	require.Len(t, frameworks, 2)
+
+	assert.Equal(t, "golang", frameworks[0].Name)
+	assert.Equal(t, "", frameworks[0].Path)
+
+	frontend := frameworks[1]
+	assert.Equal(t, "nodejs", frontend.Name)
+	assert.Equal(t, "frontend", frontend.Path)
+	assert.Equal(t, "pnpm", frontend.Framework)
+	assert.Equal(t, "pnpm exec vitest run", frontend.TestCommand)
+	assert.Equal(t, "pnpm run lint", frontend.LintCommand)
+	assert.Equal(t, "pnpm run build", frontend.BuildCommand)
+
+	// Shared framework definitions are never modified
+	assert.Equal(t, "npm test", engine.testFrameworks["nodejs"].TestCommand)
+	assert.Empty(t, engine.testFrameworks["golang"].Path)
+}
+
+func TestRunTestsMonorepoCombinesResults(t *testing.T) {
+	mockProvider := monorepoMock()
+	mock := mockProvider.MockContainer
+	engine := NewTestEngine(85, quietLogger())
+	engine.SetContainerProvider(mockProvider)
+
+	result, err := engine.RunTestsWithChanges(context.Background(), &dagger.Directory{}, nil)
+	require.NoError(t, err)
+
+	assert.False(t, result.Success, "the frontend is below the minimum coverage")
+	assert.Equal(t, 8, result.TotalTests)
+	assert.Equal(t, 7, result.PassedTests)
+	assert.Equal(t, 1, result.SkippedTests)
+	assert.Equal(t, 82.5, result.Coverage, "coverage is the minimum across frameworks")
+	assert.Equal(t, []string{"nodejs (frontend): Coverage 82.50% below minimum 85.00%"}, result.Errors)
+	assert.Contains(t, result.Output, "==> golang\n")
+	assert.Contains(t, result.Output, "==> nodejs (frontend)\n")
+
+	assert.Equal(t, "golang, nodejs (frontend)", result.Details["framework"])
+	perFramework, ok := result.Details["frameworks"].(map[string]interface{})
+	require.True(t, ok)
+	goDetails := perFramework["golang"].(map[string]interface{})
+	assert.Equal(t, true, goDetails["success"])
+	assert.Equal(t, 91.0, goDetails["coverage"])
+	frontendDetails := perFramework["nodejs (frontend)"].(map[string]interface{})
+	assert.Equal(t, "frontend", frontendDetails["path"])
+	assert.Equal(t, false, frontendDetails["success"])
+
+	assert.Contains(t, mock.Operations, "exec:go test -json ./...")
+	assert.Contains(t, mock.Operations, "exec:pnpm exec vitest run")
+	assert.Equal(t, "/workspace/frontend", mock.WorkingDir, "the frontend pipeline runs in its own directory")
+	for _, op := range mock.Operations {
+		assert.NotContains(t, op, "npm test")
+	}
+}
+
+func TestRunTestsWithTestPaths(t *testing.T) {
+	t.Run("RootOnly", func(t *testing.T) {
+		mockProvider := monorepoMock()
+		engine := NewTestEngine(80, quietLogger()).WithTestPaths(".")
+		engine.SetContainerProvider(mockProvider)
+
+		result, err := engine.RunTestsWithChanges(context.Background(), &dagger.Directory{}, nil)
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+		assert.Equal(t, "golang", result.Details["framework"])
+		assert.Equal(t, 91.0, result.Coverage)
+		assert.NotContains(t, mockProvider.MockContainer.Operations, "exec:pnpm exec vitest run")
+	})
+
+	t.Run("Subproject", func(t *testing.T) {
+		mockProvider := monorepoMock()
+		engine := NewTestEngine(80, quietLogger()).WithTestPaths("frontend/")
+		engine.SetContainerProvider(mockProvider)
+
+		result, err := engine.RunTestsWithChanges(context.Background(), &dagger.Directory{}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "nodejs", result.Details["framework"])
+		assert.Equal(t, 6, result.PassedTests)
+		assert.Equal(t, 82.5, result.Coverage)
+	})
+
+	t.Run("NoMatch", func(t *testing.T) {
+		mockProvider := monorepoMock()
+		engine := NewTestEngine(80, quietLogger()).WithTestPaths("backend")
+		engine.SetContainerProvider(mockProvider)
+
+		_, err := engine.RunTestsWithChanges(context.Background(), &dagger.Directory{}, nil)
+		assert.ErrorContains(t, err, "no test frameworks detected in backend")
+	})
+}
+
+func TestNodeFrameworkCommands(t *testing.T) {
+	base := loadTestFrameworks()["nodejs"]
+
+	t.Run("YarnJest", func(t *testing.T) {
+		pkg := packageJSON{Scripts: map[string]string{"test": "jest --ci"}}
+		framework := nodeFramework(base, pkg, nodePackageManager(pkg, map[string]bool{"yarn.lock": true}))
+		assert.Equal(t, "yarn", framework.Framework)
+		assert.Equal(t, "yarn test", framework.TestCommand)
+		assert.Equal(t, "yarn jest --coverage", framework.CoverageCommand)
+		assert.Empty(t, framework.LintCommand)
+		assert.Empty(t, framework.BuildCommand)
+	})
+
+	t.Run("PackageManagerField", func(t *testing.T) {
+		pkg := packageJSON{PackageManager: "pnpm@8.15.0", Scripts: map[string]string{"test": "mocha", "coverage": "c8 mocha"}}
+		framework := nodeFramework(base, pkg, nodePackageManager(pkg, map[string]bool{"yarn.lock": true}))
+		assert.Equal(t, "pnpm test", framework.TestCommand)
+		assert.Equal(t, "pnpm run coverage", framework.CoverageCommand)
+	})
+
+	t.Run("NpmVitest", func(t *testing.T) {
+		pkg := packageJSON{Scripts: map[string]string{"test": "vitest"}}
+		framework := nodeFramework(base, pkg, nodePackageManager(pkg, nil))
+		assert.Equal(t, "npx vitest run", framework.TestCommand)
+		assert.Equal(t, "npx vitest run --coverage", framework.CoverageCommand)
+		assert.Equal(t, "test", framework.Environment["NODE_ENV"])
+	})
+
+	t.Run("CoverageToolFromDependencies", func(t *testing.T) {
+		pkg := packageJSON{
+			Scripts:         map[string]string{"test": "npm run test:unit"},
+			DevDependencies: map[string]string{"c8": "^9.1.0", "vitest": "^1.4.0"},
+		}
+		framework := nodeFramework(base, pkg, nodePackageManager(pkg, nil))
+		assert.Equal(t, "npm test", framework.TestCommand)
+		assert.Equal(t, "npx vitest run --coverage", framework.CoverageCommand, "vitest is preferred over c8")
+
+		pkg = packageJSON{Scripts: map[string]string{"test": "mocha"}, DevDependencies: map[string]string{"c8": "^9.1.0"}}
+		framework = nodeFramework(base, pkg, nodePackageManager(pkg, map[string]bool{"pnpm-lock.yaml": true}))
+		assert.Equal(t, "pnpm exec c8 pnpm test", framework.CoverageCommand)
+	})
+
+	t.Run("C8InTestScript", func(t *testing.T) {
+		pkg := packageJSON{Scripts: map[string]string{"test": "c8 node --test"}}
+		framework := nodeFramework(base, pkg, nodePackageManager(pkg, nil))
+		assert.Equal(t, "npm test", framework.CoverageCommand, "the tests already report coverage")
+	})
+
+	t.Run("NoCoverageTool", func(t *testing.T) {
+		pkg := packageJSON{Scripts: map[string]string{"test": "mocha"}, DevDependencies: map[string]string{"mocha": "^10.0.0"}}
+		framework := nodeFramework(base, pkg, nodePackageManager(pkg, nil))
+		assert.Empty(t, framework.CoverageCommand)
+	})
+}
+
+func TestDetectFrameworkListingFailureUsesGeneric(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	mockProvider := NewMockContainerProvider()
+	mockProvider.MockContainer.ShouldFail = true
+
+	engine := NewTestEngine(80, logger)
+	frameworks, err := engine.detectFramework(context.Background(), &MockContainerWrapper{mockProvider.MockContainer})
+	require.NoError(t, err)
+	require.Len(t, frameworks, 1)
+	assert.Equal(t, "generic", frameworks[0].Name)
+}
+
+func TestDetectGradleDotnetRubyFrameworks(t *testing.T) {
+	detect := func(t *testing.T, files map[string]string) []*TestFramework {
+		mockProvider := NewMockContainerProvider()
+		mockProvider.MockContainer.FileSystem = files
+		engine := NewTestEngine(80, quietLogger())
+		frameworks, err := engine.detectFramework(context.Background(), &MockContainerWrapper{mockProvider.MockContainer})
+		require.NoError(t, err)
+		return frameworks
+	}
+
+	t.Run("GradleWrapper", func(t *testing.T) {
+		frameworks := detect(t, map[string]string{
+			"settings.gradle.kts": `rootProject.name = "orders"`,
+			"build.gradle.kts":    "plugins { java; jacoco }",
+			"gradlew":             "#!/bin/sh",
+			"app/build.gradle":    "plugins { application }",
+		})
+		require.Len(t, frameworks, 1, "subprojects are built by the root Gradle build")
+		assert.Equal(t, "gradle", frameworks[0].Name)
+		assert.Equal(t, "gradlew", frameworks[0].Framework)
+		assert.Equal(t, "./gradlew test", frameworks[0].TestCommand)
+		assert.Equal(t, "./gradlew test jacocoTestReport", frameworks[0].CoverageCommand)
+		assert.Equal(t, "./gradlew check -x test", frameworks[0].LintCommand)
+	})
+
+	t.Run("GradleWithoutWrapper", func(t *testing.T) {
+		frameworks := detect(t, map[string]string{"build.gradle": "apply plugin: 'java'"})
+		require.Len(t, frameworks, 1)
+		assert.Equal(t, "gradle test", frameworks[0].TestCommand)
+	})
+
+	t.Run("DotnetSolution", func(t *testing.T) {
+		frameworks := detect(t, map[string]string{
+			"Orders.sln":                        "Microsoft Visual Studio Solution File",
+			"Orders/Orders.csproj":              `<Project Sdk="Microsoft.NET.Sdk"/>`,
+			"Orders.Tests/Orders.Tests.csproj":  `<Project Sdk="Microsoft.NET.Sdk"/>`,
+			"Orders.Tests/OrderServiceTests.cs": "namespace Orders.Tests;",
+		})
+		require.Len(t, frameworks, 1, "projects are tested through the solution")
+		assert.Equal(t, "dotnet", frameworks[0].Name)
+		assert.Equal(t, "", frameworks[0].Path)
+	})
+
+	t.Run("DotnetProjectsWithoutSolution", func(t *testing.T) {
+		frameworks := detect(t, map[string]string{
+			"README.md":                    "# Billing",
+			"Billing/Billing.csproj":       `<Project Sdk="Microsoft.NET.Sdk"/>`,
+			"Billing/Billing.Tests.csproj": `<Project Sdk="Microsoft.NET.Sdk"/>`,
+		})
+		require.Len(t, frameworks, 1, "one framework per directory")
+		assert.Equal(t, "dotnet", frameworks[0].Name)
+		assert.Equal(t, "Billing", frameworks[0].Path)
+	})
+
+	t.Run("RubyNextToNode", func(t *testing.T) {
+		frameworks := detect(t, map[string]string{
+			"Gemfile":      `source "https://rubygems.org"`,
+			"Gemfile.lock": "GEM",
+			"package.json": `{"scripts":{"test":"jest"}}`,
+		})
+		require.Len(t, frameworks, 2)
+		assert.Equal(t, "nodejs", frameworks[0].Name)
+		assert.Equal(t, "ruby", frameworks[1].Name)
+		assert.Equal(t, "bundle exec rspec", frameworks[1].TestCommand)
+	})
+}
+
+func TestRunTestsGradleWithMocks(t *testing.T) {
+	mockProvider := NewMockContainerProvider()
+	mock := mockProvider.MockContainer
+	mock.FileSystem = map[string]string{
+		"build.gradle": "plugins { id 'java'; id 'jacoco' }",
+		"build/test-results/test/TEST-com.example.CalculatorTest.xml": readTestResultFixture(t, "surefire-TEST-com.example.CalculatorTest.xml"),
+		"build/reports/jacoco/test/jacocoTestReport.xml":              readTestResultFixture(t, "jacocoTestReport.xml"),
+	}
+	mock.SetCommandOutput("sh -c ls -1 build/test-results/test/TEST-*.xml", "build/test-results/test/TEST-com.example.CalculatorTest.xml\n", "", 0, nil)
+	mock.SetCommandOutput("gradle test", "BUILD FAILED in 9s", "> Task :test FAILED\n3 tests completed, 1 failed", 1, nil)
+
+	engine := NewTestEngine(80, quietLogger())
+	engine.SetContainerProvider(mockProvider)
+
+	result, err := engine.RunTests(context.Background(), "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, 3, result.TotalTests, "counts come from the JUnit reports")
+	assert.Equal(t, 1, result.FailedTests)
+	assert.Equal(t, "gradle:8-jdk21", mock.BaseImage)
+	assert.Equal(t, "gradle-owner-repo", mock.Caches["/root/.gradle/caches"])
+	assert.Equal(t, "-Dorg.gradle.daemon=false", mock.EnvVars["GRADLE_OPTS"])
+
+	mock.SetCommandOutput("gradle test", "BUILD SUCCESSFUL in 9s", "", 0, nil)
+	mock.FileSystem["build/test-results/test/TEST-com.example.CalculatorTest.xml"] = `<testsuite name="CalculatorTest" tests="2"><testcase classname="CalculatorTest" name="adds"/><testcase classname="CalculatorTest" name="divides"/></testsuite>`
+
+	result, err = engine.RunTests(context.Background(), "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Equal(t, 82.5, result.Coverage, "coverage comes from the JaCoCo report")
+	coverage := result.Details["coverage_detail"].(*CoverageResult)
+	assert.Equal(t, "xml", coverage.ReportFormat)
+	assert.Contains(t, mock.Operations, "exec:gradle test jacocoTestReport")
+}
+
+func TestRunTestsDotnetWithMocks(t *testing.T) {
+	mockProvider := NewMockContainerProvider()
+	mock := mockProvider.MockContainer
+	mock.FileSystem = map[string]string{
+		"Orders.sln":           "Microsoft Visual Studio Solution File",
+		"Orders/Orders.csproj": `<Project Sdk="Microsoft.NET.Sdk"/>`,
+	}
+	output := readTestResultFixture(t, "dotnet-test-coverlet.txt")
+	mock.SetCommandOutput("dotnet test", output, "", 1, nil)
+	mock.SetCommandOutput("dotnet build", "Build succeeded.", "", 0, nil)
+
+	engine := NewTestEngine(80, quietLogger())
+	engine.SetContainerProvider(mockProvider)
+
+	result, err := engine.RunTests(context.Background(), "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, "test", result.Details["stage"])
+	assert.Equal(t, 17, result.TotalTests)
+	assert.Equal(t, 1, result.FailedTests)
+	assert.Equal(t, "mcr.microsoft.com/dotnet/sdk:8.0", mock.BaseImage)
+	assert.Equal(t, "1", mock.EnvVars["DOTNET_CLI_TELEMETRY_OPTOUT"])
+	assert.Equal(t, "nuget-owner-repo", mock.Caches["/root/.nuget/packages"])
+
+	mock.SetCommandOutput("dotnet test", "Passed!  - Failed:     0, Passed:    12, Skipped:     0, Total:    12, Duration: 40 ms - Orders.Tests.dll (net8.0)", "", 0, nil)
+	mock.SetCommandOutput("dotnet test /p:CollectCoverage=true", output, "", 0, nil)
+
+	result, err = engine.RunTests(context.Background(), "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Equal(t, 12, result.PassedTests)
+	assert.Equal(t, 84.21, result.Coverage, "coverage comes from the coverlet summary")
+}
+
+func TestRunTestsRubyWithMocks(t *testing.T) {
+	mockProvider := NewMockContainerProvider()
+	mock := mockProvider.MockContainer
+	mock.FileSystem = map[string]string{
+		"Gemfile":                 `source "https://rubygems.org"`,
+		"spec/cart_spec.rb":       "RSpec.describe Cart do; end",
+		"coverage/.last_run.json": readTestResultFixture(t, "simplecov-last_run.json"),
+	}
+	mock.SetCommandOutput("bundle exec rspec", readTestResultFixture(t, "rspec.txt"), "", 1, nil)
+
+	engine := NewTestEngine(80, quietLogger())
+	engine.SetContainerProvider(mockProvider)
+
+	result, err := engine.RunTests(context.Background(), "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, 11, result.TotalTests)
+	assert.Equal(t, 1, result.FailedTests)
+	assert.Equal(t, "ruby:3.3", mock.BaseImage)
+	assert.Equal(t, "test", mock.EnvVars["RAILS_ENV"])
+	assert.Equal(t, "bundle-owner-repo", mock.Caches["/usr/local/bundle"])
+
+	mock.SetCommandOutput("bundle exec rspec", "Finished in 0.04 seconds\n11 examples, 0 failures", "", 0, nil)
+
+	result, err = engine.RunTests(context.Background(), "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Equal(t, 11, result.PassedTests)
+	assert.Equal(t, 92.31, result.Coverage, "coverage comes from simplecov's .last_run.json")
+	assert.Contains(t, mock.Operations, "exec:bundle install")
+}
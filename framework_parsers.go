@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// jacocoReport holds the report-level counters of a JaCoCo XML report
+type jacocoReport struct {
+	XMLName  xml.Name        `xml:"report"`
+	Counters []jacocoCounter `xml:"counter"`
+}
+
+type jacocoCounter struct {
+	Type    string `xml:"type,attr"`
+	Missed  int    `xml:"missed,attr"`
+	Covered int    `xml:"covered,attr"`
+}
+
+// parseJaCoCoXML returns the line coverage of a JaCoCo XML report, as written by the
+// Gradle jacocoTestReport task and the Maven jacoco:report goal
+func parseJaCoCoXML(report string) (float64, bool) {
+	if !strings.Contains(report, "<report") {
+		return 0, false
+	}
+
+	var parsed jacocoReport
+	if err := xml.Unmarshal([]byte(report), &parsed); err != nil {
+		return 0, false
+	}
+	for _, counter := range parsed.Counters {
+		if counter.Type != "LINE" {
+			continue
+		}
+		total := counter.Missed + counter.Covered
+		if total == 0 {
+			return 0, true
+		}
+		return math.Round(float64(counter.Covered)/float64(total)*10000) / 100, true
+	}
+	return 0, false
+}
+
+// simpleCovLastRun is simplecov's coverage/.last_run.json. Releases before 0.18 report
+// covered_percent instead of line.
+type simpleCovLastRun struct {
+	Result struct {
+		Line           *float64 `json:"line"`
+		CoveredPercent *float64 `json:"covered_percent"`
+	} `json:"result"`
+}
+
+// parseSimpleCovLastRun returns the line coverage recorded in simplecov's .last_run.json
+func parseSimpleCovLastRun(report string) (float64, bool) {
+	if !strings.HasPrefix(strings.TrimSpace(report), "{") {
+		return 0, false
+	}
+
+	var lastRun simpleCovLastRun
+	if err := json.Unmarshal([]byte(report), &lastRun); err != nil {
+		return 0, false
+	}
+	switch {
+	case lastRun.Result.Line != nil:
+		return *lastRun.Result.Line, true
+	case lastRun.Result.CoveredPercent != nil:
+		return *lastRun.Result.CoveredPercent, true
+	default:
+		return 0, false
+	}
+}
+
+// parseCoverletTotal reads the line coverage from the Total row of coverlet's summary table:
+// "| Total   | 85.5% | 75%    | 90%    |"
+func parseCoverletTotal(line string) (float64, bool) {
+	cells := strings.Split(strings.TrimSpace(line), "|")
+	if len(cells) < 4 || strings.TrimSpace(cells[1]) != "Total" {
+		return 0, false
+	}
+	val, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(cells[2]), "%"), 64)
+	if err != nil {
+		return 0, false
+	}
+	return val, true
+}
+
+// parseDotnetSummaryLine reads the per-assembly summary of dotnet test:
+// "Passed!  - Failed:     0, Passed:    12, Skipped:     1, Total:    13, Duration: 45 ms - App.Tests.dll (net8.0)"
+func parseDotnetSummaryLine(line string) (TestStats, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || (fields[0] != "Passed!" && fields[0] != "Failed!") {
+		return TestStats{}, false
+	}
+
+	var stats TestStats
+	for i := 1; i < len(fields); i++ {
+		val, err := strconv.Atoi(strings.TrimSuffix(fields[i], ","))
+		if err != nil {
+			continue
+		}
+		switch fields[i-1] {
+		case "Failed:":
+			stats.Failed = val
+		case "Passed:":
+			stats.Passed = val
+		case "Skipped:":
+			stats.Skipped = val
+		case "Total:":
+			stats.Total = val
+		}
+	}
+	return stats, true
+}
+
+// parseRSpecSummaryLine reads the RSpec summary: "12 examples, 2 failures, 1 pending"
+func parseRSpecSummaryLine(line string) (TestStats, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || (fields[1] != "examples," && fields[1] != "example,") {
+		return TestStats{}, false
+	}
+
+	var stats TestStats
+	for i := 1; i < len(fields); i++ {
+		val, err := strconv.Atoi(fields[i-1])
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSuffix(fields[i], ",") {
+		case "examples", "example":
+			stats.Total = val
+		case "failures", "failure":
+			stats.Failed = val
+		case "pending":
+			stats.Skipped = val
+		}
+	}
+	stats.Passed = stats.Total - stats.Failed - stats.Skipped
+	return stats, true
+}
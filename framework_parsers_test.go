@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseJaCoCoXML tests reading line coverage from the report-level JaCoCo counters
+func TestParseJaCoCoXML(t *testing.T) {
+	coverage, ok := parseJaCoCoXML(readTestResultFixture(t, "jacocoTestReport.xml"))
+	assert.True(t, ok)
+	assert.Equal(t, 82.5, coverage, "33 of 40 lines are covered")
+
+	_, ok = parseJaCoCoXML(`<report name="empty"><counter type="BRANCH" missed="1" covered="1"/></report>`)
+	assert.False(t, ok, "reports without a LINE counter are not parsed")
+
+	_, ok = parseJaCoCoXML("BUILD SUCCESSFUL in 12s")
+	assert.False(t, ok)
+}
+
+// TestParseSimpleCovLastRun tests both .last_run.json layouts written by simplecov
+func TestParseSimpleCovLastRun(t *testing.T) {
+	coverage, ok := parseSimpleCovLastRun(readTestResultFixture(t, "simplecov-last_run.json"))
+	assert.True(t, ok)
+	assert.Equal(t, 92.31, coverage)
+
+	coverage, ok = parseSimpleCovLastRun(`{"result":{"covered_percent":76.4}}`)
+	assert.True(t, ok)
+	assert.Equal(t, 76.4, coverage)
+
+	_, ok = parseSimpleCovLastRun(`{"name":"web"}`)
+	assert.False(t, ok)
+}
+
+// TestParseDotnetTestOutput tests test counts and coverlet coverage from dotnet test output
+func TestParseDotnetTestOutput(t *testing.T) {
+	engine := NewTestEngine(85, quietLogger())
+	framework := engine.testFrameworks["dotnet"]
+	output := readTestResultFixture(t, "dotnet-test-coverlet.txt")
+
+	stats := engine.parseTestOutput(output, framework)
+	assert.Equal(t, 17, stats.Total, "summaries of every test assembly are summed")
+	assert.Equal(t, 15, stats.Passed)
+	assert.Equal(t, 1, stats.Failed)
+	assert.Equal(t, 1, stats.Skipped)
+
+	assert.Equal(t, 84.21, engine.parseCoverageOutput(output, framework))
+
+	_, ok := parseCoverletTotal("| Average | 84.21% | 75%    | 90%    |")
+	assert.False(t, ok)
+}
+
+// TestParseRSpecOutput tests test counts from the RSpec summary line
+func TestParseRSpecOutput(t *testing.T) {
+	engine := NewTestEngine(85, quietLogger())
+
+	stats := engine.parseTestOutput(readTestResultFixture(t, "rspec.txt"), engine.testFrameworks["ruby"])
+	assert.Equal(t, TestStats{Total: 11, Passed: 9, Failed: 1, Skipped: 1}, stats)
+
+	stats = engine.parseTestOutput("1 example, 0 failures", engine.testFrameworks["ruby"])
+	assert.Equal(t, 1, stats.Passed)
+}
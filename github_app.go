@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/google/go-github/v45/github"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// appJWTLifetime is how long a GitHub App JWT is valid (GitHub allows at most 10 minutes)
+	appJWTLifetime = 9 * time.Minute
+	// appJWTClockSkew backdates the JWT issue time to tolerate clock drift
+	appJWTClockSkew = 60 * time.Second
+	// installationTokenEarlyExpiry refreshes installation tokens before GitHub expires them
+	installationTokenEarlyExpiry = 5 * time.Minute
+)
+
+// GitHubAppConfig holds GitHub App credentials used instead of a personal access token
+type GitHubAppConfig struct {
+	AppID          int64          `json:"app_id"`
+	InstallationID int64          `json:"installation_id"`
+	PrivateKey     *dagger.Secret `json:"-"`
+}
+
+// appJWTTransport authenticates requests as the GitHub App itself using a short-lived JWT
+type appJWTTransport struct {
+	appID int64
+	key   *rsa.PrivateKey
+	base  http.RoundTripper
+}
+
+func (t *appJWTTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := signAppJWT(t.appID, t.key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	clone := req.Clone(req.Context())
+	clone.Header.Set("Authorization", "Bearer "+token)
+	clone.Header.Set("Accept", "application/vnd.github+json")
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(clone)
+}
+
+// installationTokenSource mints installation access tokens via the GitHub Apps API
+type installationTokenSource struct {
+	mu             sync.Mutex
+	installationID int64
+	appsClient     *github.Client
+	logger         *logrus.Logger
+}
+
+// Token implements oauth2.TokenSource
+func (s *installationTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	installationToken, _, err := s.appsClient.Apps.CreateInstallationToken(ctx, s.installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation token: %w", err)
+	}
+	if installationToken.GetToken() == "" {
+		return nil, fmt.Errorf("GitHub returned an empty installation token")
+	}
+
+	token := &oauth2.Token{AccessToken: installationToken.GetToken()}
+	if installationToken.ExpiresAt != nil {
+		token.Expiry = *installationToken.ExpiresAt
+	}
+
+	if s.logger != nil {
+		s.logger.WithFields(logrus.Fields{
+			"installation_id": s.installationID,
+			"expires_at":      token.Expiry,
+		}).Debug("Minted GitHub App installation token")
+	}
+
+	return token, nil
+}
+
+// NewGitHubAppIntegration creates a GitHub integration authenticated as a GitHub App
+// installation, logging to logger
+func NewGitHubAppIntegration(ctx context.Context, config *GitHubAppConfig, owner, name string, endpoints *GitHubEndpoints, logger *logrus.Logger) (*GitHubIntegration, error) {
+	if config == nil || config.PrivateKey == nil {
+		return nil, fmt.Errorf("GitHub App private key is required")
+	}
+
+	keyPEM, err := config.PrivateKey.Plaintext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GitHub App private key: %w", err)
+	}
+
+	key, err := parseAppPrivateKey([]byte(keyPEM))
+	if err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = logrus.New()
+	}
+	appsClient, err := newGitHubRESTClient(&http.Client{
+		Transport: &appJWTTransport{appID: config.AppID, key: key},
+	}, endpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenSource := newInstallationTokenSource(appsClient, config.InstallationID, logger)
+	client, err := newGitHubRESTClient(oauth2.NewClient(ctx, tokenSource), endpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GitHubIntegration{
+		client:           client,
+		repoOwner:        owner,
+		repoName:         name,
+		logger:           logger,
+		tokenSource:      tokenSource,
+		appsClient:       appsClient,
+		rateLimitRetries: MaxRetries,
+	}, nil
+}
+
+// AuthenticatedLogin returns the login of the account the integration authenticates as, and
+// opens fix PRs as: the user of a token, or the bot user of a GitHub App
+func (g *GitHubIntegration) AuthenticatedLogin(ctx context.Context) (string, error) {
+	g.loginMu.Lock()
+	defer g.loginMu.Unlock()
+	if g.login != "" {
+		return g.login, nil
+	}
+
+	if g.appsClient != nil {
+		var app *github.App
+		err := g.withRateLimit(ctx, func() (*github.Response, error) {
+			var resp *github.Response
+			var err error
+			app, resp, err = g.appsClient.Apps.Get(ctx, "")
+			return resp, err
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to get GitHub App: %w", err)
+		}
+		g.login = app.GetSlug() + "[bot]"
+		return g.login, nil
+	}
+
+	var user *github.User
+	err := g.withRateLimit(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		user, resp, err = g.client.Users.Get(ctx, "")
+		return resp, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get authenticated user: %w", err)
+	}
+	g.login = user.GetLogin()
+	return g.login, nil
+}
+
+// accessToken returns the token the integration authenticates with, minting an installation
+// token under GitHub App auth
+func (g *GitHubIntegration) accessToken() (string, error) {
+	if g.tokenSource == nil {
+		return g.token, nil
+	}
+	token, err := g.tokenSource.Token()
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// newInstallationTokenSource wraps the installation token minting so tokens are reused until shortly before expiry
+func newInstallationTokenSource(appsClient *github.Client, installationID int64, logger *logrus.Logger) oauth2.TokenSource {
+	return oauth2.ReuseTokenSourceWithExpiry(nil, &installationTokenSource{
+		installationID: installationID,
+		appsClient:     appsClient,
+		logger:         logger,
+	}, installationTokenEarlyExpiry)
+}
+
+// validateGitHubAppConfig checks that all GitHub App credentials are present
+func validateGitHubAppConfig(config *GitHubAppConfig) error {
+	if config == nil {
+		return fmt.Errorf("GitHub App configuration is required")
+	}
+	if config.AppID <= 0 {
+		return fmt.Errorf("GitHub App ID must be positive")
+	}
+	if config.InstallationID <= 0 {
+		return fmt.Errorf("GitHub App installation ID must be positive")
+	}
+	if config.PrivateKey == nil {
+		return fmt.Errorf("GitHub App private key is required")
+	}
+	return nil
+}
+
+// parseAppPrivateKey parses a PEM encoded RSA private key in PKCS#1 or PKCS#8 form
+func parseAppPrivateKey(keyPEM []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("invalid GitHub App private key: no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub App private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid GitHub App private key: expected RSA key")
+	}
+	return key, nil
+}
+
+// signAppJWT creates an RS256 signed JWT identifying the GitHub App
+func signAppJWT(appID int64, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JWT header: %w", err)
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-appJWTClockSkew).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": fmt.Sprintf("%d", appID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JWT claims: %w", err)
+	}
+
+	encoding := base64.RawURLEncoding
+	signingInput := encoding.EncodeToString(header) + "." + encoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign JWT: %w", err)
+	}
+
+	return signingInput + "." + encoding.EncodeToString(signature), nil
+}
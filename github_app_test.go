@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generateTestAppKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+// TestParseAppPrivateKey tests PEM parsing for GitHub App keys
+func TestParseAppPrivateKey(t *testing.T) {
+	key := generateTestAppKey(t)
+
+	t.Run("PKCS1", func(t *testing.T) {
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		parsed, err := parseAppPrivateKey(keyPEM)
+		assert.NoError(t, err)
+		assert.True(t, key.Equal(parsed))
+	})
+
+	t.Run("PKCS8", func(t *testing.T) {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		parsed, err := parseAppPrivateKey(keyPEM)
+		assert.NoError(t, err)
+		assert.True(t, key.Equal(parsed))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := parseAppPrivateKey([]byte("not a key"))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "no PEM block")
+	})
+}
+
+// TestSignAppJWT verifies the JWT claims and RS256 signature
+func TestSignAppJWT(t *testing.T) {
+	key := generateTestAppKey(t)
+	now := time.Unix(1700000000, 0)
+
+	token, err := signAppJWT(12345, key, now)
+	require.NoError(t, err)
+
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	var claims map[string]interface{}
+	require.NoError(t, json.Unmarshal(claimsJSON, &claims))
+	assert.Equal(t, "12345", claims["iss"])
+	assert.Equal(t, float64(now.Add(-appJWTClockSkew).Unix()), claims["iat"])
+	assert.Equal(t, float64(now.Add(appJWTLifetime).Unix()), claims["exp"])
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], signature))
+}
+
+// TestInstallationTokenSource verifies tokens are minted with the app JWT and refreshed before expiry
+func TestInstallationTokenSource(t *testing.T) {
+	key := generateTestAppKey(t)
+
+	var mints int32
+	var expiresIn atomic.Value
+	expiresIn.Store(time.Hour)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/app/installations/99/access_tokens", r.URL.Path)
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ey"))
+		n := atomic.AddInt32(&mints, 1)
+		expiry := time.Now().Add(expiresIn.Load().(time.Duration)).UTC().Format(time.RFC3339)
+		fmt.Fprintf(w, `{"token":"ghs_token%d","expires_at":"%s"}`, n, expiry)
+	}))
+	defer server.Close()
+
+	appsClient := github.NewClient(&http.Client{Transport: &appJWTTransport{appID: 1, key: key}})
+	baseURL, err := url.Parse(server.URL + "/")
+	require.NoError(t, err)
+	appsClient.BaseURL = baseURL
+
+	source := newInstallationTokenSource(appsClient, 99, nil)
+
+	first, err := source.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "ghs_token1", first.AccessToken)
+
+	// A still-valid token is reused
+	second, err := source.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "ghs_token1", second.AccessToken)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&mints))
+
+	// Tokens inside the early expiry window are refreshed
+	expiresIn.Store(time.Minute)
+	source = newInstallationTokenSource(appsClient, 99, nil)
+	_, err = source.Token()
+	require.NoError(t, err)
+	refreshed, err := source.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "ghs_token3", refreshed.AccessToken)
+}
+
+// TestAuthenticatedLogin tests that the login is the token's user, or the bot user of a
+// GitHub App, and is looked up once
+func TestAuthenticatedLogin(t *testing.T) {
+	ctx := context.Background()
+	gh, mux := newMockGitHubAPI(t)
+	var lookups int32
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&lookups, 1)
+		fmt.Fprint(w, `{"login":"octocat"}`)
+	})
+	mux.HandleFunc("/app", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&lookups, 1)
+		fmt.Fprint(w, `{"slug":"autofix-app"}`)
+	})
+
+	login, err := gh.AuthenticatedLogin(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "octocat", login)
+	login, err = gh.AuthenticatedLogin(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "octocat", login)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lookups))
+
+	app, _ := newMockGitHubAPI(t)
+	app.client, app.appsClient = gh.client, gh.client
+	login, err = app.AuthenticatedLogin(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "autofix-app[bot]", login)
+}
+
+// TestValidateGitHubAppConfig tests GitHub App credential validation
+func TestValidateGitHubAppConfig(t *testing.T) {
+	secret := createTestSecret("key", "value")
+
+	assert.Error(t, validateGitHubAppConfig(nil))
+	assert.Error(t, validateGitHubAppConfig(&GitHubAppConfig{InstallationID: 2, PrivateKey: secret}))
+	assert.Error(t, validateGitHubAppConfig(&GitHubAppConfig{AppID: 1, PrivateKey: secret}))
+	assert.Error(t, validateGitHubAppConfig(&GitHubAppConfig{AppID: 1, InstallationID: 2}))
+	assert.NoError(t, validateGitHubAppConfig(&GitHubAppConfig{AppID: 1, InstallationID: 2, PrivateKey: secret}))
+}
+
+// TestWithGitHubApp tests that App credentials satisfy configuration validation without a token
+func TestWithGitHubApp(t *testing.T) {
+	module := New().
+		WithGitHubApp(1, 2, createTestSecret("key", "value")).
+		WithLLMProvider("openai", createTestSecret("llm", "sk-test")).
+		WithRepository("owner", "repo")
+
+	assert.Equal(t, int64(1), module.GitHubApp.AppID)
+	assert.Equal(t, int64(2), module.GitHubApp.InstallationID)
+	assert.Nil(t, module.GitHubToken)
+	assert.NoError(t, module.validateConfiguration())
+}
+
+// TestHasGitHubTokenPrefix tests accepted token prefixes
+func TestHasGitHubTokenPrefix(t *testing.T) {
+	assert.True(t, hasGitHubTokenPrefix("ghp_abc"))
+	assert.True(t, hasGitHubTokenPrefix("gho_abc"))
+	assert.True(t, hasGitHubTokenPrefix("ghs_abc"))
+	assert.True(t, hasGitHubTokenPrefix("github_pat_abc"))
+	assert.False(t, hasGitHubTokenPrefix("invalid"))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v45/github"
+)
+
+const (
+	// publicGitHubAPIHost is the API host of github.com, which needs no enterprise client
+	publicGitHubAPIHost  = "api.github.com"
+	enterpriseAPIPath    = "/api/v3/"
+	enterpriseUploadPath = "/api/uploads/"
+)
+
+// GitHubEndpoints holds the API endpoints of a GitHub Enterprise Server instance
+type GitHubEndpoints struct {
+	APIURL    string `json:"api_url"`
+	UploadURL string `json:"upload_url"`
+}
+
+// isEnterprise reports whether the endpoints point somewhere other than github.com
+func (e *GitHubEndpoints) isEnterprise() bool {
+	if e == nil || e.APIURL == "" {
+		return false
+	}
+	parsed, err := url.Parse(e.APIURL)
+	if err != nil {
+		return true
+	}
+	return !strings.EqualFold(parsed.Hostname(), publicGitHubAPIHost)
+}
+
+// webURL returns the scheme and host repositories are cloned from: github.com, or the host
+// of the GitHub Enterprise Server API
+func (e *GitHubEndpoints) webURL() string {
+	if !e.isEnterprise() {
+		return "https://github.com"
+	}
+	parsed, err := url.Parse(strings.TrimSpace(e.APIURL))
+	if err != nil || parsed.Host == "" {
+		return "https://github.com"
+	}
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// newGitHubRESTClient creates a go-github client for github.com or, when endpoints are set,
+// for a GitHub Enterprise Server instance
+func newGitHubRESTClient(httpClient *http.Client, endpoints *GitHubEndpoints) (*github.Client, error) {
+	if !endpoints.isEnterprise() {
+		return github.NewClient(httpClient), nil
+	}
+
+	apiURL, err := normalizeEnterpriseURL(endpoints.APIURL, enterpriseAPIPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub API URL: %w", err)
+	}
+
+	uploadURL := endpoints.UploadURL
+	if uploadURL == "" {
+		// GHES serves uploads from the same host as the API
+		parsed, _ := url.Parse(apiURL)
+		uploadURL = parsed.Scheme + "://" + parsed.Host
+	}
+	uploadURL, err = normalizeEnterpriseURL(uploadURL, enterpriseUploadPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub upload URL: %w", err)
+	}
+
+	client, err := github.NewEnterpriseClient(apiURL, uploadURL, httpClient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub Enterprise client: %w", err)
+	}
+	return client, nil
+}
+
+// normalizeEnterpriseURL validates a GHES endpoint and ensures it ends with the given API path.
+// Plain http is only accepted for localhost and loopback addresses so tokens are never sent
+// in clear text.
+func normalizeEnterpriseURL(raw, apiPath string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if parsed.Host == "" {
+		return "", fmt.Errorf("%q must be an absolute URL", raw)
+	}
+
+	switch parsed.Scheme {
+	case "https":
+	case "http":
+		if !isLocalHost(parsed.Hostname()) {
+			return "", fmt.Errorf("%q must use https", raw)
+		}
+	default:
+		return "", fmt.Errorf("%q must use https", raw)
+	}
+
+	path := strings.TrimRight(parsed.Path, "/")
+	if !strings.HasSuffix(path+"/", apiPath) {
+		path += strings.TrimSuffix(apiPath, "/")
+	}
+	parsed.Path = path + "/"
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+
+	return parsed.String(), nil
+}
+
+// isLocalHost reports whether host is localhost or a loopback IP address. Other names are not
+// resolved, so a DNS answer pointing at the loopback cannot allow plain http.
+func isLocalHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNormalizeEnterpriseURL tests GHES URL validation and path normalization
+func TestNormalizeEnterpriseURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		apiPath  string
+		expected string
+		wantErr  bool
+	}{
+		{"adds api path", "https://github.example.com", enterpriseAPIPath, "https://github.example.com/api/v3/", false},
+		{"adds trailing slash", "https://github.example.com/api/v3", enterpriseAPIPath, "https://github.example.com/api/v3/", false},
+		{"keeps normalized url", "https://github.example.com/api/v3/", enterpriseAPIPath, "https://github.example.com/api/v3/", false},
+		{"collapses extra slashes", "https://github.example.com//", enterpriseAPIPath, "https://github.example.com/api/v3/", false},
+		{"upload path", "https://github.example.com", enterpriseUploadPath, "https://github.example.com/api/uploads/", false},
+		{"http localhost", "http://localhost:8080", enterpriseAPIPath, "http://localhost:8080/api/v3/", false},
+		{"http loopback", "http://127.0.0.1:8080/api/v3", enterpriseAPIPath, "http://127.0.0.1:8080/api/v3/", false},
+		{"http remote rejected", "http://github.example.com", enterpriseAPIPath, "", true},
+		{"http name of loopback rejected", "http://127.0.0.1.nip.io:8080", enterpriseAPIPath, "", true},
+		{"unsupported scheme", "ftp://github.example.com", enterpriseAPIPath, "", true},
+		{"relative url", "github.example.com/api/v3", enterpriseAPIPath, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := normalizeEnterpriseURL(tt.raw, tt.apiPath)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+// TestGitHubEndpointsIsEnterprise tests that github.com endpoints use the public client
+func TestGitHubEndpointsIsEnterprise(t *testing.T) {
+	var nilEndpoints *GitHubEndpoints
+	assert.False(t, nilEndpoints.isEnterprise())
+	assert.False(t, (&GitHubEndpoints{}).isEnterprise())
+	assert.False(t, (&GitHubEndpoints{APIURL: "https://api.github.com"}).isEnterprise())
+	assert.True(t, (&GitHubEndpoints{APIURL: "https://github.example.com"}).isEnterprise())
+}
+
+// TestGitHubEndpointsWebURL tests that repositories are cloned from the GHES API host
+func TestGitHubEndpointsWebURL(t *testing.T) {
+	var nilEndpoints *GitHubEndpoints
+	assert.Equal(t, "https://github.com", nilEndpoints.webURL())
+	assert.Equal(t, "https://github.com", (&GitHubEndpoints{APIURL: "https://api.github.com"}).webURL())
+	assert.Equal(t, "https://github.example.com", (&GitHubEndpoints{APIURL: "https://github.example.com/api/v3/"}).webURL())
+	assert.Equal(t, "http://localhost:8080", (&GitHubEndpoints{APIURL: "http://localhost:8080/api/v3"}).webURL())
+}
+
+// TestNewGitHubRESTClientEnterprise verifies the enterprise client talks to the GHES API path
+func TestNewGitHubRESTClientEnterprise(t *testing.T) {
+	var requestedPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPath = r.URL.Path
+		fmt.Fprint(w, `{"name":"repo","default_branch":"main"}`)
+	}))
+	defer server.Close()
+
+	client, err := newGitHubRESTClient(nil, &GitHubEndpoints{APIURL: server.URL})
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/api/v3/", client.BaseURL.String())
+	assert.Equal(t, server.URL+"/api/uploads/", client.UploadURL.String())
+
+	repo, _, err := client.Repositories.Get(context.Background(), "owner", "repo")
+	require.NoError(t, err)
+	assert.Equal(t, "/api/v3/repos/owner/repo", requestedPath)
+	assert.Equal(t, "main", repo.GetDefaultBranch())
+
+	publicClient, err := newGitHubRESTClient(nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.github.com/", publicClient.BaseURL.String())
+}
+
+// TestWithGitHubBaseURL tests enterprise URL configuration and validation
+func TestWithGitHubBaseURL(t *testing.T) {
+	module := New().
+		WithGitHubToken(createTestSecret("github", "token")).
+		WithLLMProvider("openai", createTestSecret("llm", "sk-test")).
+		WithRepository("owner", "repo").
+		WithGitHubBaseURL("https://github.example.com", "")
+
+	assert.Equal(t, "https://github.example.com", module.GitHubAPIURL)
+	assert.Equal(t, &GitHubEndpoints{APIURL: "https://github.example.com"}, module.githubEndpoints())
+	assert.NoError(t, module.validateConfiguration())
+
+	module.WithGitHubBaseURL("http://github.example.com", "")
+	err := module.validateConfiguration()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must use https")
+
+	module.WithGitHubBaseURL("", "")
+	assert.Nil(t, module.githubEndpoints())
+}
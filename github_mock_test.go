@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// mockGitHub is a GitHubClient whose methods call the function set for them, or return a
+// default. It records the methods called, so tests can assert on the calls made.
+type mockGitHub struct {
+	getWorkflowRunFunc        func(ctx context.Context, runID int64) (*WorkflowRun, error)
+	getWorkflowLogsFunc       func(ctx context.Context, runID int64) (*WorkflowLogs, error)
+	getRunAttemptFunc         func(ctx context.Context, runID int64, attempt int) (*WorkflowRun, error)
+	getRunAttemptLogsFunc     func(ctx context.Context, runID int64, attempt int) (*WorkflowLogs, error)
+	getJobRunIDFunc           func(ctx context.Context, jobID int64) (int64, error)
+	getAnnotationsFunc        func(ctx context.Context, runID int64) ([]Annotation, error)
+	getWorkflowDefinitionFunc func(ctx context.Context, runID int64) (string, string, error)
+	getFailedWorkflowRunsFunc func(ctx context.Context) ([]*WorkflowRun, error)
+	getSuccessfulRunsFunc     func(ctx context.Context, branch, sha string, since time.Time) ([]*WorkflowRun, error)
+	getCommitRunsFunc         func(ctx context.Context, branch, sha string, since time.Time) ([]*WorkflowRun, error)
+	getRecentRunsFunc         func(ctx context.Context, workflowID int64, branch string, limit int) ([]*WorkflowRun, error)
+	rerunFailedJobsFunc       func(ctx context.Context, runID int64) error
+	waitForWorkflowRunFunc    func(ctx context.Context, runID int64, minAttempt int, timeout time.Duration) (*WorkflowRun, error)
+	createTestBranchFunc      func(ctx context.Context, branchName string, changes []CodeChange) (func(), error)
+	createCommitCommentFunc   func(ctx context.Context, sha, body string) error
+	commitChangesFunc         func(ctx context.Context, branch, parentSHA string, changes []CodeChange, message string) (string, error)
+	uploadSARIFFunc           func(ctx context.Context, commitSHA, ref string, sarif []byte) (string, error)
+	getRepositoryContextFunc  func(ctx context.Context) (*RepositoryContext, error)
+	getBaseBranchHeadFunc     func(ctx context.Context) (string, string, error)
+	listOpenPullRequestsFunc  func(ctx context.Context, labels []string) ([]*PullRequest, error)
+	authenticatedLoginFunc    func(ctx context.Context) (string, error)
+	getFileContentFunc        func(ctx context.Context, path, ref string) (string, bool, error)
+	listDirectoryFunc         func(ctx context.Context, path, ref string) ([]string, error)
+	getLanguagesFunc          func(ctx context.Context) (map[string]int, error)
+	createBranchFunc          func(ctx context.Context, branch, baseBranch string) error
+	deleteBranchFunc          func(ctx context.Context, branch string) error
+	createPullRequestFunc     func(ctx context.Context, opts *PRCreationOptions) (*PullRequest, error)
+	getPullRequestFunc        func(ctx context.Context, number int) (*PullRequest, error)
+	updatePullRequestFunc     func(ctx context.Context, number int, update PullRequestUpdate) (*PullRequest, error)
+	closePullRequestFunc      func(ctx context.Context, number int) error
+	addPullRequestCommentFunc func(ctx context.Context, number int, body string) error
+	findPRForCommitFunc       func(ctx context.Context, sha string) (*PullRequest, error)
+	listPRFilesFunc           func(ctx context.Context, number int) ([]FileChange, error)
+	createReviewCommentFunc   func(ctx context.Context, number int, comment ReviewComment) error
+
+	// calls records the name of every method called, in order
+	mu    sync.Mutex
+	calls []string
+}
+
+func (m *mockGitHub) record(method string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, method)
+}
+
+func (m *mockGitHub) GetWorkflowRun(ctx context.Context, runID int64) (*WorkflowRun, error) {
+	m.record("GetWorkflowRun")
+	if m.getWorkflowRunFunc != nil {
+		return m.getWorkflowRunFunc(ctx, runID)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) GetWorkflowDefinition(ctx context.Context, runID int64) (string, string, error) {
+	m.record("GetWorkflowDefinition")
+	if m.getWorkflowDefinitionFunc != nil {
+		return m.getWorkflowDefinitionFunc(ctx, runID)
+	}
+	return "", "", nil
+}
+
+func (m *mockGitHub) GetWorkflowLogs(ctx context.Context, runID int64) (*WorkflowLogs, error) {
+	m.record("GetWorkflowLogs")
+	if m.getWorkflowLogsFunc != nil {
+		return m.getWorkflowLogsFunc(ctx, runID)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) GetWorkflowRunAttempt(ctx context.Context, runID int64, attempt int) (*WorkflowRun, error) {
+	m.record("GetWorkflowRunAttempt")
+	if m.getRunAttemptFunc != nil {
+		return m.getRunAttemptFunc(ctx, runID, attempt)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) GetWorkflowRunAttemptLogs(ctx context.Context, runID int64, attempt int) (*WorkflowLogs, error) {
+	m.record("GetWorkflowRunAttemptLogs")
+	if m.getRunAttemptLogsFunc != nil {
+		return m.getRunAttemptLogsFunc(ctx, runID, attempt)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) GetJobRunID(ctx context.Context, jobID int64) (int64, error) {
+	m.record("GetJobRunID")
+	if m.getJobRunIDFunc != nil {
+		return m.getJobRunIDFunc(ctx, jobID)
+	}
+	return 0, nil
+}
+
+func (m *mockGitHub) GetCheckRunAnnotations(ctx context.Context, runID int64) ([]Annotation, error) {
+	m.record("GetCheckRunAnnotations")
+	if m.getAnnotationsFunc != nil {
+		return m.getAnnotationsFunc(ctx, runID)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) GetFailedWorkflowRuns(ctx context.Context) ([]*WorkflowRun, error) {
+	m.record("GetFailedWorkflowRuns")
+	if m.getFailedWorkflowRunsFunc != nil {
+		return m.getFailedWorkflowRunsFunc(ctx)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) GetSuccessfulWorkflowRuns(ctx context.Context, branch, sha string, since time.Time) ([]*WorkflowRun, error) {
+	m.record("GetSuccessfulWorkflowRuns")
+	if m.getSuccessfulRunsFunc != nil {
+		return m.getSuccessfulRunsFunc(ctx, branch, sha, since)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) GetCommitWorkflowRuns(ctx context.Context, branch, sha string, since time.Time) ([]*WorkflowRun, error) {
+	m.record("GetCommitWorkflowRuns")
+	if m.getCommitRunsFunc != nil {
+		return m.getCommitRunsFunc(ctx, branch, sha, since)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) GetRecentWorkflowRuns(ctx context.Context, workflowID int64, branch string, limit int) ([]*WorkflowRun, error) {
+	m.record("GetRecentWorkflowRuns")
+	if m.getRecentRunsFunc != nil {
+		return m.getRecentRunsFunc(ctx, workflowID, branch, limit)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) RerunWorkflowFailedJobs(ctx context.Context, runID int64) error {
+	m.record("RerunWorkflowFailedJobs")
+	if m.rerunFailedJobsFunc != nil {
+		return m.rerunFailedJobsFunc(ctx, runID)
+	}
+	return nil
+}
+
+func (m *mockGitHub) WaitForWorkflowRun(ctx context.Context, runID int64, minAttempt int, timeout time.Duration) (*WorkflowRun, error) {
+	m.record("WaitForWorkflowRun")
+	if m.waitForWorkflowRunFunc != nil {
+		return m.waitForWorkflowRunFunc(ctx, runID, minAttempt, timeout)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) CreateTestBranch(ctx context.Context, branchName string, changes []CodeChange) (func(), error) {
+	m.record("CreateTestBranch")
+	if m.createTestBranchFunc != nil {
+		return m.createTestBranchFunc(ctx, branchName, changes)
+	}
+	return func() {}, nil
+}
+
+func (m *mockGitHub) CommitChanges(ctx context.Context, branch, parentSHA string, changes []CodeChange, message string) (string, error) {
+	m.record("CommitChanges")
+	if m.commitChangesFunc != nil {
+		return m.commitChangesFunc(ctx, branch, parentSHA, changes, message)
+	}
+	return "", nil
+}
+
+func (m *mockGitHub) UploadSARIF(ctx context.Context, commitSHA, ref string, sarif []byte) (string, error) {
+	m.record("UploadSARIF")
+	if m.uploadSARIFFunc != nil {
+		return m.uploadSARIFFunc(ctx, commitSHA, ref, sarif)
+	}
+	return "", nil
+}
+
+func (m *mockGitHub) CreateCommitComment(ctx context.Context, sha, body string) error {
+	m.record("CreateCommitComment")
+	if m.createCommitCommentFunc != nil {
+		return m.createCommitCommentFunc(ctx, sha, body)
+	}
+	return nil
+}
+
+func (m *mockGitHub) GetRepositoryContext(ctx context.Context) (*RepositoryContext, error) {
+	m.record("GetRepositoryContext")
+	if m.getRepositoryContextFunc != nil {
+		return m.getRepositoryContextFunc(ctx)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) GetBaseBranchHead(ctx context.Context) (string, string, error) {
+	m.record("GetBaseBranchHead")
+	if m.getBaseBranchHeadFunc != nil {
+		return m.getBaseBranchHeadFunc(ctx)
+	}
+	return "main", "base123", nil
+}
+
+func (m *mockGitHub) ListOpenPullRequests(ctx context.Context, labels []string) ([]*PullRequest, error) {
+	m.record("ListOpenPullRequests")
+	if m.listOpenPullRequestsFunc != nil {
+		return m.listOpenPullRequestsFunc(ctx, labels)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) AuthenticatedLogin(ctx context.Context) (string, error) {
+	m.record("AuthenticatedLogin")
+	if m.authenticatedLoginFunc != nil {
+		return m.authenticatedLoginFunc(ctx)
+	}
+	return "", nil
+}
+
+func (m *mockGitHub) GetFileContent(ctx context.Context, path, ref string) (string, bool, error) {
+	m.record("GetFileContent")
+	if m.getFileContentFunc != nil {
+		return m.getFileContentFunc(ctx, path, ref)
+	}
+	return "", false, nil
+}
+
+func (m *mockGitHub) ListDirectory(ctx context.Context, path, ref string) ([]string, error) {
+	m.record("ListDirectory")
+	if m.listDirectoryFunc != nil {
+		return m.listDirectoryFunc(ctx, path, ref)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) GetLanguages(ctx context.Context) (map[string]int, error) {
+	m.record("GetLanguages")
+	if m.getLanguagesFunc != nil {
+		return m.getLanguagesFunc(ctx)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) CreateBranch(ctx context.Context, branch, baseBranch string) error {
+	m.record("CreateBranch")
+	if m.createBranchFunc != nil {
+		return m.createBranchFunc(ctx, branch, baseBranch)
+	}
+	return nil
+}
+
+func (m *mockGitHub) DeleteBranch(ctx context.Context, branch string) error {
+	m.record("DeleteBranch")
+	if m.deleteBranchFunc != nil {
+		return m.deleteBranchFunc(ctx, branch)
+	}
+	return nil
+}
+
+// CreatePullRequest returns pull request #1 built from opts by default
+func (m *mockGitHub) CreatePullRequest(ctx context.Context, opts *PRCreationOptions) (*PullRequest, error) {
+	m.record("CreatePullRequest")
+	if m.createPullRequestFunc != nil {
+		return m.createPullRequestFunc(ctx, opts)
+	}
+	return &PullRequest{Number: 1, Title: opts.Title, Body: opts.Body, Branch: opts.BranchName, State: "open", Labels: opts.Labels}, nil
+}
+
+// GetPullRequest returns an open pull request with the number by default
+func (m *mockGitHub) GetPullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	m.record("GetPullRequest")
+	if m.getPullRequestFunc != nil {
+		return m.getPullRequestFunc(ctx, number)
+	}
+	return &PullRequest{Number: number, State: "open"}, nil
+}
+
+// UpdatePullRequest returns the update applied to an open pull request by default
+func (m *mockGitHub) UpdatePullRequest(ctx context.Context, number int, update PullRequestUpdate) (*PullRequest, error) {
+	m.record("UpdatePullRequest")
+	if m.updatePullRequestFunc != nil {
+		return m.updatePullRequestFunc(ctx, number, update)
+	}
+	return &PullRequest{Number: number, Title: update.Title, Body: update.Body, State: valueOr(update.State, "open"), Labels: update.Labels}, nil
+}
+
+func (m *mockGitHub) ClosePullRequest(ctx context.Context, number int) error {
+	m.record("ClosePullRequest")
+	if m.closePullRequestFunc != nil {
+		return m.closePullRequestFunc(ctx, number)
+	}
+	return nil
+}
+
+func (m *mockGitHub) AddPullRequestComment(ctx context.Context, number int, body string) error {
+	m.record("AddPullRequestComment")
+	if m.addPullRequestCommentFunc != nil {
+		return m.addPullRequestCommentFunc(ctx, number, body)
+	}
+	return nil
+}
+
+func (m *mockGitHub) FindPullRequestForCommit(ctx context.Context, sha string) (*PullRequest, error) {
+	m.record("FindPullRequestForCommit")
+	if m.findPRForCommitFunc != nil {
+		return m.findPRForCommitFunc(ctx, sha)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) ListPullRequestFiles(ctx context.Context, number int) ([]FileChange, error) {
+	m.record("ListPullRequestFiles")
+	if m.listPRFilesFunc != nil {
+		return m.listPRFilesFunc(ctx, number)
+	}
+	return nil, nil
+}
+
+func (m *mockGitHub) CreateReviewComment(ctx context.Context, number int, comment ReviewComment) error {
+	m.record("CreateReviewComment")
+	if m.createReviewCommentFunc != nil {
+		return m.createReviewCommentFunc(ctx, number, comment)
+	}
+	return nil
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v45/github"
+)
+
+// PullRequestUpdate is a change to an open pull request. Empty fields are left unchanged and
+// non-nil Labels replace the pull request's labels.
+type PullRequestUpdate struct {
+	Title  string   `json:"title,omitempty"`
+	Body   string   `json:"body,omitempty"`
+	State  string   `json:"state,omitempty"` // "open" or "closed"
+	Labels []string `json:"labels,omitempty"`
+}
+
+// errGitHubNotInitialized is returned by GitHub operations of an agent that was not initialized
+var errGitHubNotInitialized = errors.New("GitHub client not initialized")
+
+// CreateBranch creates branch from the head of baseBranch. A branch that already exists, e.g.
+// from an earlier attempt at the same fix, is force-updated to that head instead.
+func (g *GitHubIntegration) CreateBranch(ctx context.Context, branch, baseBranch string) error {
+	if g.client == nil {
+		return errGitHubNotInitialized
+	}
+	baseRef, err := callGitHub(ctx, g, func() (*github.Reference, *github.Response, error) {
+		return g.client.Git.GetRef(ctx, g.repoOwner, g.repoName, "heads/"+baseBranch)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get %s branch ref: %w", baseBranch, err)
+	}
+
+	newRef := &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: baseRef.GetObject().SHA},
+	}
+	_, err = callGitHub(ctx, g, func() (*github.Reference, *github.Response, error) {
+		return g.client.Git.CreateRef(ctx, g.repoOwner, g.repoName, newRef)
+	})
+	if isRefExists(err) {
+		_, err = callGitHub(ctx, g, func() (*github.Reference, *github.Response, error) {
+			return g.client.Git.UpdateRef(ctx, g.repoOwner, g.repoName, newRef, true)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to reset branch %s: %w", branch, err)
+		}
+		g.logger.WithField("branch", branch).Info("Reset existing branch to the base branch head")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create branch: %w", err)
+	}
+	return nil
+}
+
+// CommitChanges commits changes on top of the commit parentSHA as a single commit and points
+// branch at it, creating branch when it does not exist. An existing branch is only
+// fast-forwarded, so commits pushed to it since parentSHA are never overwritten. It returns
+// the SHA of the new commit.
+func (g *GitHubIntegration) CommitChanges(ctx context.Context, branch, parentSHA string, changes []CodeChange, message string) (string, error) {
+	if g.client == nil {
+		return "", errGitHubNotInitialized
+	}
+	parent, err := callGitHub(ctx, g, func() (*github.Commit, *github.Response, error) {
+		return g.client.Git.GetCommit(ctx, g.repoOwner, g.repoName, parentSHA)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit %s: %w", shortSHA(parentSHA), err)
+	}
+
+	entries, err := g.treeEntries(ctx, parentSHA, changes)
+	if err != nil {
+		return "", err
+	}
+	tree, err := callGitHub(ctx, g, func() (*github.Tree, *github.Response, error) {
+		return g.client.Git.CreateTree(ctx, g.repoOwner, g.repoName, parent.GetTree().GetSHA(), entries)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create tree: %w", err)
+	}
+	commit, err := callGitHub(ctx, g, func() (*github.Commit, *github.Response, error) {
+		return g.client.Git.CreateCommit(ctx, g.repoOwner, g.repoName, &github.Commit{
+			Message: &message,
+			Tree:    &github.Tree{SHA: tree.SHA},
+			Parents: []*github.Commit{{SHA: &parentSHA}},
+		})
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create commit: %w", err)
+	}
+
+	ref := &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: commit.SHA},
+	}
+	_, err = callGitHub(ctx, g, func() (*github.Reference, *github.Response, error) {
+		return g.client.Git.CreateRef(ctx, g.repoOwner, g.repoName, ref)
+	})
+	if isRefExists(err) {
+		_, err = callGitHub(ctx, g, func() (*github.Reference, *github.Response, error) {
+			return g.client.Git.UpdateRef(ctx, g.repoOwner, g.repoName, ref, false)
+		})
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to update branch %s: %w", branch, err)
+	}
+	return commit.GetSHA(), nil
+}
+
+// treeEntries converts changes into the entries of a tree based on the commit parentSHA.
+// Entries without content delete their path; renames without new content keep the content
+// the file has at parentSHA.
+func (g *GitHubIntegration) treeEntries(ctx context.Context, parentSHA string, changes []CodeChange) ([]*github.TreeEntry, error) {
+	blob := func(path, content string) *github.TreeEntry {
+		return &github.TreeEntry{Path: github.String(path), Mode: github.String("100644"), Type: github.String("blob"), Content: github.String(content)}
+	}
+	removed := func(path string) *github.TreeEntry {
+		return &github.TreeEntry{Path: github.String(path), Mode: github.String("100644"), Type: github.String("blob")}
+	}
+
+	entries := make([]*github.TreeEntry, 0, len(changes))
+	for _, change := range changes {
+		if err := validateCodeChange(change); err != nil {
+			return nil, fmt.Errorf("invalid change to %s: %w", change.FilePath, err)
+		}
+		switch change.Operation {
+		case ChangeOperationAdd, ChangeOperationModify:
+			entries = append(entries, blob(change.FilePath, change.NewContent))
+		case ChangeOperationDelete:
+			entries = append(entries, removed(change.FilePath))
+		case ChangeOperationRename:
+			content := change.NewContent
+			if content == "" {
+				old, found, err := g.GetFileContent(ctx, change.FilePath, parentSHA)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read %s: %w", change.FilePath, err)
+				}
+				if !found {
+					return nil, fmt.Errorf("cannot rename %s: the file does not exist", change.FilePath)
+				}
+				content = old
+			}
+			entries = append(entries, removed(change.FilePath), blob(change.NewFilePath, content))
+		}
+	}
+	return entries, nil
+}
+
+// isRefExists reports whether GitHub rejected creating a ref because it already exists
+func isRefExists(err error) bool {
+	var errResp *github.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Response != nil &&
+		errResp.Response.StatusCode == http.StatusUnprocessableEntity &&
+		strings.Contains(errResp.Message, "already exists")
+}
+
+// CreatePullRequest opens a pull request from opts.BranchName into opts.TargetBranch, then
+// adds its labels, reviewers and assignees. Failing to add those is logged rather than
+// returned, since the pull request is already open. Auto-merge is left to the caller.
+func (g *GitHubIntegration) CreatePullRequest(ctx context.Context, opts *PRCreationOptions) (*PullRequest, error) {
+	if g.client == nil {
+		return nil, errGitHubNotInitialized
+	}
+	newPR := &github.NewPullRequest{
+		Title: &opts.Title,
+		Head:  &opts.BranchName,
+		Base:  &opts.TargetBranch,
+		Body:  &opts.Body,
+		Draft: &opts.Draft,
+	}
+	created, err := callGitHub(ctx, g, func() (*github.PullRequest, *github.Response, error) {
+		return g.client.PullRequests.Create(ctx, g.repoOwner, g.repoName, newPR)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PR: %w", err)
+	}
+	number := created.GetNumber()
+
+	if len(opts.Labels) > 0 {
+		if _, err := callGitHub(ctx, g, func() ([]*github.Label, *github.Response, error) {
+			return g.client.Issues.AddLabelsToIssue(ctx, g.repoOwner, g.repoName, number, opts.Labels)
+		}); err != nil {
+			g.logger.WithError(err).Warn("Failed to add labels to PR")
+		}
+	}
+
+	if len(opts.Reviewers) > 0 || len(opts.TeamReviewers) > 0 {
+		reviewers := github.ReviewersRequest{
+			Reviewers:     opts.Reviewers,
+			TeamReviewers: opts.TeamReviewers,
+		}
+		if _, err := callGitHub(ctx, g, func() (*github.PullRequest, *github.Response, error) {
+			return g.client.PullRequests.RequestReviewers(ctx, g.repoOwner, g.repoName, number, reviewers)
+		}); err != nil {
+			g.logger.WithError(err).Warn("Failed to request reviewers")
+		}
+	}
+
+	if len(opts.Assignees) > 0 {
+		if _, err := callGitHub(ctx, g, func() (*github.Issue, *github.Response, error) {
+			return g.client.Issues.AddAssignees(ctx, g.repoOwner, g.repoName, number, opts.Assignees)
+		}); err != nil {
+			g.logger.WithError(err).Warn("Failed to add assignees")
+		}
+	}
+
+	pr := convertPullRequest(created)
+	pr.Branch = opts.BranchName
+	pr.Labels = opts.Labels
+	return pr, nil
+}
+
+// GetPullRequest returns a pull request by number
+func (g *GitHubIntegration) GetPullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	if g.client == nil {
+		return nil, errGitHubNotInitialized
+	}
+	pr, err := callGitHub(ctx, g, func() (*github.PullRequest, *github.Response, error) {
+		return g.client.PullRequests.Get(ctx, g.repoOwner, g.repoName, number)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get PR #%d: %w", number, err)
+	}
+	return convertPullRequest(pr), nil
+}
+
+// UpdatePullRequest applies update to a pull request and returns it as updated
+func (g *GitHubIntegration) UpdatePullRequest(ctx context.Context, number int, update PullRequestUpdate) (*PullRequest, error) {
+	if g.client == nil {
+		return nil, errGitHubNotInitialized
+	}
+	edit := &github.PullRequest{}
+	if update.Title != "" {
+		edit.Title = &update.Title
+	}
+	if update.Body != "" {
+		edit.Body = &update.Body
+	}
+	if update.State != "" {
+		edit.State = &update.State
+	}
+	edited, err := callGitHub(ctx, g, func() (*github.PullRequest, *github.Response, error) {
+		return g.client.PullRequests.Edit(ctx, g.repoOwner, g.repoName, number, edit)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update PR #%d: %w", number, err)
+	}
+	pr := convertPullRequest(edited)
+
+	if update.Labels != nil {
+		if _, err := callGitHub(ctx, g, func() ([]*github.Label, *github.Response, error) {
+			return g.client.Issues.ReplaceLabelsForIssue(ctx, g.repoOwner, g.repoName, number, update.Labels)
+		}); err != nil {
+			return nil, fmt.Errorf("failed to update labels of PR #%d: %w", number, err)
+		}
+		pr.Labels = update.Labels
+	}
+	return pr, nil
+}
+
+// ClosePullRequest closes a pull request without merging it
+func (g *GitHubIntegration) ClosePullRequest(ctx context.Context, number int) error {
+	_, err := g.UpdatePullRequest(ctx, number, PullRequestUpdate{State: "closed"})
+	return err
+}
+
+// AddPullRequestComment posts a comment on a pull request's conversation
+func (g *GitHubIntegration) AddPullRequestComment(ctx context.Context, number int, body string) error {
+	if g.client == nil {
+		return errGitHubNotInitialized
+	}
+	comment := &github.IssueComment{Body: &body}
+	if _, err := callGitHub(ctx, g, func() (*github.IssueComment, *github.Response, error) {
+		return g.client.Issues.CreateComment(ctx, g.repoOwner, g.repoName, number, comment)
+	}); err != nil {
+		return fmt.Errorf("failed to comment on PR #%d: %w", number, err)
+	}
+	return nil
+}
+
+// ReviewComment is a pull request review comment on the lines StartLine to Line of Path, as
+// the file is at CommitSHA. A zero StartLine comments on Line alone.
+type ReviewComment struct {
+	Body      string `json:"body"`
+	Path      string `json:"path"`
+	CommitSHA string `json:"commit_sha"`
+	StartLine int    `json:"start_line,omitempty"`
+	Line      int    `json:"line"`
+}
+
+// FindPullRequestForCommit returns the open pull request whose head is sha, or else the first
+// open pull request containing it, and nil when no open pull request contains it
+func (g *GitHubIntegration) FindPullRequestForCommit(ctx context.Context, sha string) (*PullRequest, error) {
+	if g.client == nil {
+		return nil, errGitHubNotInitialized
+	}
+	prs, err := callGitHub(ctx, g, func() ([]*github.PullRequest, *github.Response, error) {
+		return g.client.PullRequests.ListPullRequestsWithCommit(ctx, g.repoOwner, g.repoName, sha, nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the pull request of commit %s: %w", sha, err)
+	}
+	var found *github.PullRequest
+	for _, pr := range prs {
+		if pr.GetState() != "open" {
+			continue
+		}
+		if pr.GetHead().GetSHA() == sha {
+			found = pr
+			break
+		}
+		if found == nil {
+			found = pr
+		}
+	}
+	if found == nil {
+		return nil, nil
+	}
+	return convertPullRequest(found), nil
+}
+
+// ListPullRequestFiles returns the files a pull request changes with their patches
+func (g *GitHubIntegration) ListPullRequestFiles(ctx context.Context, number int) ([]FileChange, error) {
+	if g.client == nil {
+		return nil, errGitHubNotInitialized
+	}
+	opts := &github.ListOptions{PerPage: 100}
+	var changes []FileChange
+	for {
+		var files []*github.CommitFile
+		var resp *github.Response
+		err := g.withRateLimit(ctx, func() (*github.Response, error) {
+			var err error
+			files, resp, err = g.client.PullRequests.ListFiles(ctx, g.repoOwner, g.repoName, number, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the files of PR #%d: %w", number, err)
+		}
+		for _, file := range files {
+			changes = append(changes, FileChange{
+				Filename:  file.GetFilename(),
+				Status:    file.GetStatus(),
+				Patch:     file.GetPatch(),
+				Additions: file.GetAdditions(),
+				Deletions: file.GetDeletions(),
+			})
+		}
+		if resp == nil || resp.NextPage == 0 {
+			return changes, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// CreateReviewComment comments on lines of a file a pull request changes
+func (g *GitHubIntegration) CreateReviewComment(ctx context.Context, number int, comment ReviewComment) error {
+	if g.client == nil {
+		return errGitHubNotInitialized
+	}
+	reviewComment := &github.PullRequestComment{
+		Body:     &comment.Body,
+		Path:     &comment.Path,
+		CommitID: &comment.CommitSHA,
+		Line:     &comment.Line,
+		Side:     github.String("RIGHT"),
+	}
+	if comment.StartLine > 0 && comment.StartLine < comment.Line {
+		reviewComment.StartLine = &comment.StartLine
+		reviewComment.StartSide = github.String("RIGHT")
+	}
+	if _, err := callGitHub(ctx, g, func() (*github.PullRequestComment, *github.Response, error) {
+		return g.client.PullRequests.CreateComment(ctx, g.repoOwner, g.repoName, number, reviewComment)
+	}); err != nil {
+		return fmt.Errorf("failed to create review comment on PR #%d: %w", number, err)
+	}
+	return nil
+}
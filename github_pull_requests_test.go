@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGitHubPullRequestLifecycle tests the pull request operations of GitHubIntegration
+// against the REST API
+func TestGitHubPullRequestLifecycle(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+	ctx := context.Background()
+
+	var created github.NewPullRequest
+	var labels, assignees []string
+	var reviewers map[string][]string
+	mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.NoError(t, decodeJSON(r, &created))
+		fmt.Fprint(w, `{"number":7,"node_id":"PR_7","title":"Fix","state":"open","head":{"ref":"autofix/fix","sha":"abc"}}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/issues/7/labels", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, decodeJSON(r, &labels))
+		if r.Method == http.MethodPut {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/owner/repo/issues/7/assignees", func(w http.ResponseWriter, r *http.Request) {
+		var body struct{ Assignees []string }
+		assert.NoError(t, decodeJSON(r, &body))
+		assignees = body.Assignees
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/pulls/7/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, decodeJSON(r, &reviewers))
+		fmt.Fprint(w, `{}`)
+	})
+	var edits []github.PullRequest
+	mux.HandleFunc("/repos/owner/repo/pulls/7", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `{"number":7,"state":"closed","merged":true,"labels":[{"name":"autofix"}],"head":{"ref":"autofix/fix"}}`)
+			return
+		}
+		var edit github.PullRequest
+		assert.NoError(t, decodeJSON(r, &edit))
+		edits = append(edits, edit)
+		fmt.Fprintf(w, `{"number":7,"title":"Fix","state":%q}`, valueOr(edit.GetState(), "open"))
+	})
+	var comment github.IssueComment
+	mux.HandleFunc("/repos/owner/repo/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, decodeJSON(r, &comment))
+		fmt.Fprint(w, `{}`)
+	})
+
+	pr, err := gh.CreatePullRequest(ctx, &PRCreationOptions{
+		BranchName:    "autofix/fix",
+		TargetBranch:  "main",
+		Title:         "Fix",
+		Draft:         true,
+		Labels:        []string{"autofix"},
+		Reviewers:     []string{"alice"},
+		TeamReviewers: []string{"platform"},
+		Assignees:     []string{"bob"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "autofix/fix", created.GetHead())
+	assert.Equal(t, "main", created.GetBase())
+	assert.True(t, created.GetDraft())
+	assert.Equal(t, []string{"autofix"}, labels)
+	assert.Equal(t, []string{"bob"}, assignees)
+	assert.Equal(t, []string{"alice"}, reviewers["reviewers"])
+	assert.Equal(t, []string{"platform"}, reviewers["team_reviewers"])
+	assert.Equal(t, 7, pr.Number)
+	assert.Equal(t, "PR_7", pr.NodeID)
+	assert.Equal(t, "autofix/fix", pr.Branch)
+	assert.Equal(t, []string{"autofix"}, pr.Labels)
+
+	pr, err = gh.GetPullRequest(ctx, 7)
+	require.NoError(t, err)
+	assert.True(t, pr.Merged)
+	assert.Equal(t, []string{"autofix"}, pr.Labels)
+
+	pr, err = gh.UpdatePullRequest(ctx, 7, PullRequestUpdate{Body: "new body"})
+	require.NoError(t, err)
+	assert.Equal(t, "open", pr.State)
+	require.Len(t, edits, 1)
+	assert.Equal(t, "new body", edits[0].GetBody())
+	assert.Nil(t, edits[0].Title, "empty fields are left unchanged")
+
+	_, err = gh.UpdatePullRequest(ctx, 7, PullRequestUpdate{Labels: []string{"stale"}})
+	assert.ErrorContains(t, err, "failed to update labels of PR #7")
+	assert.Equal(t, []string{"stale"}, labels)
+
+	require.NoError(t, gh.ClosePullRequest(ctx, 7))
+	assert.Equal(t, "closed", edits[len(edits)-1].GetState())
+
+	require.NoError(t, gh.AddPullRequestComment(ctx, 7, "Superseded by #8"))
+	assert.Equal(t, "Superseded by #8", comment.GetBody())
+}
+
+// TestGitHubCreateBranch tests creating a branch from the head of another
+func TestGitHubCreateBranch(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+
+	mux.HandleFunc("/repos/owner/repo/git/ref/heads/develop", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ref":"refs/heads/develop","object":{"sha":"base123"}}`)
+	})
+	var ref github.Reference
+	mux.HandleFunc("/repos/owner/repo/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		var body struct{ Ref, SHA string }
+		assert.NoError(t, decodeJSON(r, &body))
+		ref = github.Reference{Ref: &body.Ref, Object: &github.GitObject{SHA: &body.SHA}}
+		fmt.Fprint(w, `{}`)
+	})
+
+	require.NoError(t, gh.CreateBranch(context.Background(), "autofix/fix", "develop"))
+	assert.Equal(t, "refs/heads/autofix/fix", ref.GetRef())
+	assert.Equal(t, "base123", ref.GetObject().GetSHA())
+
+	assert.ErrorContains(t, gh.CreateBranch(context.Background(), "autofix/fix", "missing"), "failed to get missing branch ref")
+}
+
+// TestGitHubCreateBranchResetsExisting tests that creating a branch that already exists
+// force-updates it to the base head instead of failing
+func TestGitHubCreateBranchResetsExisting(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+
+	mux.HandleFunc("/repos/owner/repo/git/ref/heads/main", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ref":"refs/heads/main","object":{"sha":"base456"}}`)
+	})
+	var creates int
+	mux.HandleFunc("/repos/owner/repo/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		creates++
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"message":"Reference already exists"}`)
+	})
+	var update struct {
+		SHA   string `json:"sha"`
+		Force bool   `json:"force"`
+	}
+	mux.HandleFunc("/repos/owner/repo/git/refs/heads/autofix/build/1a2b3c4d", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPatch, r.Method)
+		assert.NoError(t, decodeJSON(r, &update))
+		fmt.Fprint(w, `{}`)
+	})
+
+	require.NoError(t, gh.CreateBranch(context.Background(), "autofix/build/1a2b3c4d", "main"))
+	assert.Equal(t, 1, creates)
+	assert.Equal(t, "base456", update.SHA)
+	assert.True(t, update.Force)
+
+	assert.True(t, isRefExists(&github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusUnprocessableEntity}, Message: "Reference already exists"}))
+	assert.False(t, isRefExists(&github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusUnprocessableEntity}, Message: "Reference update failed"}))
+}
+
+// TestGitHubClientNotInitialized tests that the pull request operations of a GitHub client
+// without an API client fail instead of panicking
+func TestGitHubClientNotInitialized(t *testing.T) {
+	gh := &GitHubIntegration{repoOwner: "owner", repoName: "repo"}
+	ctx := context.Background()
+
+	_, err := gh.CreatePullRequest(ctx, &PRCreationOptions{})
+	assert.ErrorIs(t, err, errGitHubNotInitialized)
+	_, err = gh.GetPullRequest(ctx, 1)
+	assert.ErrorIs(t, err, errGitHubNotInitialized)
+	assert.ErrorIs(t, gh.ClosePullRequest(ctx, 1), errGitHubNotInitialized)
+	assert.ErrorIs(t, gh.AddPullRequestComment(ctx, 1, "comment"), errGitHubNotInitialized)
+	assert.ErrorIs(t, gh.CreateBranch(ctx, "branch", "main"), errGitHubNotInitialized)
+	assert.ErrorIs(t, gh.DeleteBranch(ctx, "branch"), errGitHubNotInitialized)
+}
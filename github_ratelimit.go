@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// lowRateLimitThreshold is the remaining request quota below which a warning is logged
+	lowRateLimitThreshold = 100
+	// secondaryRateLimitBackoff is used when a secondary rate limit response carries no Retry-After
+	secondaryRateLimitBackoff = time.Minute
+	// rateLimitResetBuffer is added to the reset time so the retry lands after the window rolls over
+	rateLimitResetBuffer = time.Second
+)
+
+// rateLimitState tracks the most recent request quota reported by the GitHub API
+type rateLimitState struct {
+	mu        sync.Mutex
+	remaining int
+	known     bool
+}
+
+// SetRateLimitRetries configures how many times a rate limited call is retried before giving up
+func (g *GitHubIntegration) SetRateLimitRetries(retries int) {
+	if retries < 0 {
+		retries = 0
+	}
+	g.rateLimitRetries = retries
+}
+
+// RateRemaining returns the remaining GitHub API quota, or -1 if no response has been seen yet
+func (g *GitHubIntegration) RateRemaining() int {
+	g.rateLimit.mu.Lock()
+	defer g.rateLimit.mu.Unlock()
+
+	if !g.rateLimit.known {
+		return -1
+	}
+	return g.rateLimit.remaining
+}
+
+// callGitHub runs a go-github call through the rate limit aware executor and returns its result
+func callGitHub[T any](ctx context.Context, g *GitHubIntegration, call func() (T, *github.Response, error)) (T, error) {
+	var result T
+	err := g.withRateLimit(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		result, resp, err = call()
+		return resp, err
+	})
+	return result, err
+}
+
+// withRateLimit executes a GitHub API call, waiting out primary and secondary rate limits.
+// Waits are bounded by ctx and the call is retried up to the configured number of times.
+func (g *GitHubIntegration) withRateLimit(ctx context.Context, call func() (*github.Response, error)) error {
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		resp, err := call()
+		g.logCall(resp, time.Since(start), err)
+		g.recordRate(resp)
+		agentMetrics.recordGitHubCall(err)
+		if err == nil {
+			return nil
+		}
+
+		wait, limited := rateLimitWait(err, attempt)
+		if !limited || attempt >= g.rateLimitRetries {
+			return classifyGitHubError(err)
+		}
+
+		if g.logger != nil {
+			g.logger.WithFields(logrus.Fields{
+				"attempt": attempt + 1,
+				"wait":    wait,
+			}).Warn("GitHub rate limit hit, waiting before retry")
+		}
+
+		if waitErr := sleepContext(ctx, wait); waitErr != nil {
+			return fmt.Errorf("gave up waiting for GitHub rate limit: %w", err)
+		}
+	}
+}
+
+// logCall logs a GitHub API call at debug level
+func (g *GitHubIntegration) logCall(resp *github.Response, duration time.Duration, err error) {
+	if g.logger == nil || !g.logger.IsLevelEnabled(logrus.DebugLevel) {
+		return
+	}
+	log := g.logger.WithField("duration", duration)
+	if resp != nil && resp.Response != nil {
+		log = log.WithField("status", resp.StatusCode)
+		if resp.Request != nil {
+			log = log.WithFields(logrus.Fields{"method": resp.Request.Method, "path": resp.Request.URL.Path})
+		}
+	}
+	if err != nil {
+		log = log.WithError(err)
+	}
+	log.Debug("GitHub API call completed")
+}
+
+// classifyGitHubError wraps authentication and not found responses with ErrGitHubAuth and
+// ErrGitHubNotFound. Rate limit errors have their own types and are returned unchanged.
+func classifyGitHubError(err error) error {
+	var errResp *github.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		return err
+	}
+	switch errResp.Response.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrGitHubAuth, err)
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %w", ErrGitHubNotFound, err)
+	}
+	return err
+}
+
+// recordRate stores the quota reported by a response and warns when it runs low
+func (g *GitHubIntegration) recordRate(resp *github.Response) {
+	if resp == nil || resp.Rate.Limit == 0 {
+		return
+	}
+
+	g.rateLimit.mu.Lock()
+	wasLow := g.rateLimit.known && g.rateLimit.remaining < lowRateLimitThreshold
+	g.rateLimit.remaining = resp.Rate.Remaining
+	g.rateLimit.known = true
+	g.rateLimit.mu.Unlock()
+	agentMetrics.githubRate.setValue(float64(resp.Rate.Remaining))
+
+	// Only warn when crossing the threshold to avoid logging on every call
+	if !wasLow && resp.Rate.Remaining < lowRateLimitThreshold && g.logger != nil {
+		g.logger.WithFields(logrus.Fields{
+			"remaining": resp.Rate.Remaining,
+			"limit":     resp.Rate.Limit,
+			"reset":     resp.Rate.Reset.Time,
+		}).Warn("GitHub API rate limit running low")
+	}
+}
+
+// rateLimitWait returns how long to wait before retrying err, and whether err is a rate limit error
+func rateLimitWait(err error, attempt int) (time.Duration, bool) {
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		if abuseErr.RetryAfter != nil {
+			return *abuseErr.RetryAfter, true
+		}
+		return secondaryRateLimitBackoff * time.Duration(1<<attempt), true
+	}
+
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		wait := time.Until(rateErr.Rate.Reset.Time) + rateLimitResetBuffer
+		if wait < rateLimitResetBuffer {
+			wait = rateLimitResetBuffer
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const secondaryRateLimitBody = `{"message":"You have exceeded a secondary rate limit","documentation_url":"https://docs.github.com/rest/overview/resources-in-the-rest-api#secondary-rate-limits"}`
+
+func writeRateHeaders(w http.ResponseWriter, remaining int, reset time.Time) {
+	w.Header().Set("X-RateLimit-Limit", "5000")
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+}
+
+// TestWithRateLimitSecondaryRetryAfter verifies abuse responses are retried after Retry-After
+func TestWithRateLimitSecondaryRetryAfter(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+	gh.logger.SetLevel(logrus.ErrorLevel)
+	gh.SetRateLimitRetries(2)
+
+	var requests int32
+	mux.HandleFunc("/repos/owner/repo/actions/runs/42", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, secondaryRateLimitBody)
+			return
+		}
+		writeRateHeaders(w, 4321, time.Now().Add(time.Hour))
+		fmt.Fprint(w, `{"id":42,"name":"CI","conclusion":"failure"}`)
+	})
+
+	start := time.Now()
+	run, err := gh.GetWorkflowRun(context.Background(), 42)
+	elapsed := time.Since(start)
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), run.ID)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests), "should retry once, not busy-wait")
+	assert.GreaterOrEqual(t, elapsed, time.Second)
+	assert.Less(t, elapsed, 3*time.Second)
+	assert.Equal(t, 4321, gh.RateRemaining())
+}
+
+// TestWithRateLimitBoundedByContext verifies waits for a distant reset stop when the context ends
+func TestWithRateLimitBoundedByContext(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+	gh.logger.SetLevel(logrus.ErrorLevel)
+	gh.SetRateLimitRetries(3)
+
+	var requests int32
+	mux.HandleFunc("/repos/owner/repo/actions/runs/42", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		writeRateHeaders(w, 0, time.Now().Add(time.Hour))
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"message":"API rate limit exceeded"}`)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := gh.GetWorkflowRun(ctx, 42)
+
+	require.Error(t, err)
+	var rateErr *github.RateLimitError
+	assert.True(t, errors.As(err, &rateErr))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	assert.Equal(t, 0, gh.RateRemaining())
+}
+
+// TestWithRateLimitRetriesExhausted verifies non rate limit errors and exhausted retries are returned
+func TestWithRateLimitRetriesExhausted(t *testing.T) {
+	gh := &GitHubIntegration{}
+
+	var calls int
+	err := gh.withRateLimit(context.Background(), func() (*github.Response, error) {
+		calls++
+		retryAfter := time.Duration(0)
+		return nil, &github.AbuseRateLimitError{RetryAfter: &retryAfter}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+
+	gh.SetRateLimitRetries(5)
+	calls = 0
+	err = gh.withRateLimit(context.Background(), func() (*github.Response, error) {
+		calls++
+		return nil, errors.New("not found")
+	})
+	assert.EqualError(t, err, "not found")
+	assert.Equal(t, 1, calls)
+}
+
+// TestRateLimitWait tests wait durations derived from rate limit errors
+func TestRateLimitWait(t *testing.T) {
+	retryAfter := 7 * time.Second
+	wait, limited := rateLimitWait(&github.AbuseRateLimitError{RetryAfter: &retryAfter}, 0)
+	assert.True(t, limited)
+	assert.Equal(t, retryAfter, wait)
+
+	wait, limited = rateLimitWait(&github.AbuseRateLimitError{}, 1)
+	assert.True(t, limited)
+	assert.Equal(t, 2*secondaryRateLimitBackoff, wait)
+
+	reset := github.Timestamp{Time: time.Now().Add(time.Minute)}
+	wait, limited = rateLimitWait(&github.RateLimitError{Rate: github.Rate{Reset: reset}}, 0)
+	assert.True(t, limited)
+	assert.InDelta(t, float64(time.Minute+rateLimitResetBuffer), float64(wait), float64(time.Second))
+
+	wait, limited = rateLimitWait(fmt.Errorf("wrapped: %w", &github.RateLimitError{}), 0)
+	assert.True(t, limited)
+	assert.Equal(t, rateLimitResetBuffer, wait)
+
+	_, limited = rateLimitWait(errors.New("boom"), 0)
+	assert.False(t, limited)
+}
+
+// TestGetMetricsGitHubRateRemaining verifies the remaining quota is surfaced through metrics
+func TestGetMetricsGitHubRateRemaining(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+	mux.HandleFunc("/repos/owner/repo/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+		writeRateHeaders(w, 1234, time.Now().Add(time.Hour))
+		fmt.Fprint(w, `{"total_count":0,"workflow_runs":[]}`)
+	})
+
+	module := New()
+	module.githubClient = gh
+
+	metrics, err := module.GetMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, -1, metrics.GitHubRateRemaining)
+
+	_, err = gh.GetFailedWorkflowRuns(context.Background())
+	require.NoError(t, err)
+
+	metrics, err = module.GetMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1234, metrics.GitHubRateRemaining)
+}
@@ -9,12 +9,13 @@ import (
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/tosin2013/dagger-autofix/pkg/autofix"
 )
 
 // Constants for improved code quality
 const (
 	DefaultTimeout       = 30 * time.Second
-	MaxLogSize           = 10 * 1024 * 1024 // 10MB
+	MaxLogSize           = autofix.MaxLogSize
 	MaxRetries           = 3
 	RetryBackoffDuration = 2 * time.Second
 	MaxConcurrentOps     = 10
@@ -286,46 +287,6 @@ func min(a, b int) int {
 	return b
 }
 
-//nolint:unused // Infrastructure function for future use
-func validateRunID(runID int64) error {
-	if runID <= 0 {
-		return fmt.Errorf("invalid run ID: %d, must be positive", runID)
-	}
-
-	// GitHub run IDs are typically large integers
-	if runID < 1000000 {
-		return fmt.Errorf("run ID %d appears invalid, expected GitHub Actions run ID", runID)
-	}
-
-	return nil
-}
-
-//nolint:unused // Infrastructure function for future use
-func validateRepositoryName(owner, name string) error {
-	if owner == "" {
-		return fmt.Errorf("repository owner cannot be empty")
-	}
-
-	if name == "" {
-		return fmt.Errorf("repository name cannot be empty")
-	}
-
-	// GitHub repository names have specific rules
-	if len(owner) > 39 || len(name) > 100 {
-		return fmt.Errorf("repository owner/name too long: %s/%s", owner, name)
-	}
-
-	// Check for invalid characters (simplified)
-	invalidChars := []string{" ", ".", "..", "~", "^", ":", "?", "*", "[", "\\"}
-	for _, char := range invalidChars {
-		if strings.Contains(owner, char) || strings.Contains(name, char) {
-			return fmt.Errorf("repository owner/name contains invalid character '%s': %s/%s", char, owner, name)
-		}
-	}
-
-	return nil
-}
-
 //nolint:unused // Infrastructure function for future use
 func validateLLMProvider(provider LLMProvider) error {
 	validProviders := []LLMProvider{OpenAI, Anthropic, Gemini, DeepSeek, LiteLLM}
@@ -262,16 +262,16 @@ func TestUtilityFunctions(t *testing.T) {
 		assert.NoError(t, validateRunID(9999999))
 		assert.Error(t, validateRunID(0))
 		assert.Error(t, validateRunID(-1))
-		assert.Error(t, validateRunID(999999)) // Too small for GitHub run ID
+		assert.NoError(t, validateRunID(999999)) // GitHub Enterprise Server run IDs start at 1
 	})
 
-	t.Run("validateRepositoryName", func(t *testing.T) {
-		assert.NoError(t, validateRepositoryName("owner", "valid-repo"))
-		assert.NoError(t, validateRepositoryName("user", "repo"))
-		assert.NoError(t, validateRepositoryName("org", "project-name"))
-		assert.Error(t, validateRepositoryName("", "repo"))
-		assert.Error(t, validateRepositoryName("owner", ""))
-		assert.Error(t, validateRepositoryName("owner", "invalid repo name"))
+	t.Run("validateRepository", func(t *testing.T) {
+		assert.NoError(t, validateRepository("owner", "valid-repo"))
+		assert.NoError(t, validateRepository("user", "repo"))
+		assert.NoError(t, validateRepository("org", "project-name"))
+		assert.Error(t, validateRepository("", "repo"))
+		assert.Error(t, validateRepository("owner", ""))
+		assert.Error(t, validateRepository("owner", "invalid repo name"))
 	})
 
 	t.Run("validateLLMProvider", func(t *testing.T) {
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AnalyzeFailureJobs analyzes each failed job of a workflow run separately, so the jobs of a
+// build matrix that fail for different reasons get their own analysis. Analyses with the same
+// failure type and root cause are merged, listing every job they explain. Runs whose logs do
+// not name their failed jobs are analyzed as a whole.
+func (m *DaggerAutofix) AnalyzeFailureJobs(ctx context.Context, runID int64) ([]*FailureAnalysisResult, error) {
+	if err := validateRunID(runID); err != nil {
+		return nil, err
+	}
+	if m.failureEngine == nil {
+		return nil, ErrNotInitialized
+	}
+
+	m.logger.WithField("run_id", runID).Info("Analyzing failed jobs of workflow run")
+	ctx = withAuditRun(ctx, m.auditLog, runID)
+
+	failureCtx, err := m.failureContext(ctx, runID)
+	if analysis := m.logsUnavailableAnalysis(failureCtx, err); analysis != nil {
+		return []*FailureAnalysisResult{analysis}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	jobs := failureCtx.Logs.FailedJobs
+	if len(jobs) == 0 {
+		analysis, err := m.analyzeFailureContext(ctx, failureCtx)
+		if err != nil {
+			return nil, err
+		}
+		return []*FailureAnalysisResult{analysis}, nil
+	}
+
+	var analyses []*FailureAnalysisResult
+	var firstErr error
+	for _, job := range jobs {
+		jobCtx := failureCtx
+		jobCtx.JobName = job
+		jobCtx.Logs = failureCtx.Logs.forJob(job)
+		analysis, err := m.analyzeFailureContext(ctx, jobCtx)
+		if err != nil {
+			m.logger.WithError(err).WithField("job", job).Warn("Failed to analyze job, continuing with the other jobs")
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		analyses = append(analyses, analysis)
+	}
+	if len(analyses) == 0 {
+		return nil, firstErr
+	}
+
+	analyses = dedupeAnalyses(analyses)
+	m.logger.WithFields(logrus.Fields{
+		"run_id":      runID,
+		"failed_jobs": len(jobs),
+		"analyses":    len(analyses),
+	}).Info("Job analysis completed")
+	return analyses, nil
+}
+
+// forJob returns the logs limited to one job
+func (l *WorkflowLogs) forJob(job string) *WorkflowLogs {
+	return &WorkflowLogs{
+		RawLogs:       l.JobLogs[job],
+		JobLogs:       map[string]string{job: l.JobLogs[job]},
+		StepLogs:      make(map[string]string),
+		ErrorLines:    append([]string{}, l.JobErrorLines[job]...),
+		FailedJobs:    []string{job},
+		JobErrorLines: map[string][]string{job: append([]string{}, l.JobErrorLines[job]...)},
+		Annotations:   slices.DeleteFunc(slices.Clone(l.Annotations), func(a Annotation) bool { return a.Job != job }),
+		FailedSteps:   slices.DeleteFunc(slices.Clone(l.FailedSteps), func(s FailedStep) bool { return s.Job != job }),
+	}
+}
+
+// mergeWorkflowLogs combines the logs of several jobs, in order
+func mergeWorkflowLogs(logs ...*WorkflowLogs) *WorkflowLogs {
+	merged := &WorkflowLogs{
+		JobLogs:       make(map[string]string),
+		StepLogs:      make(map[string]string),
+		JobErrorLines: make(map[string][]string),
+	}
+	var raw strings.Builder
+	for _, l := range logs {
+		if l == nil {
+			continue
+		}
+		raw.WriteString(l.RawLogs)
+		for job, log := range l.JobLogs {
+			merged.JobLogs[job] = log
+		}
+		for step, log := range l.StepLogs {
+			merged.StepLogs[step] = log
+		}
+		for job, lines := range l.JobErrorLines {
+			merged.JobErrorLines[job] = lines
+		}
+		merged.ErrorLines = append(merged.ErrorLines, l.ErrorLines...)
+		merged.FailedJobs = appendMissing(merged.FailedJobs, l.FailedJobs...)
+		merged.Annotations = append(merged.Annotations, l.Annotations...)
+		merged.FailedSteps = append(merged.FailedSteps, l.FailedSteps...)
+	}
+	merged.RawLogs = raw.String()
+	return merged
+}
+
+// dedupeAnalyses merges analyses with the same failure type and root cause, so a matrix of
+// identical failures yields one analysis covering all of its jobs
+func dedupeAnalyses(analyses []*FailureAnalysisResult) []*FailureAnalysisResult {
+	var deduped []*FailureAnalysisResult
+	byKey := make(map[string]*FailureAnalysisResult)
+	for _, analysis := range analyses {
+		key := string(analysis.Classification.Type) + "\x00" + normalizeRootCause(analysis.RootCause)
+		kept, ok := byKey[key]
+		if !ok {
+			byKey[key] = analysis
+			deduped = append(deduped, analysis)
+			continue
+		}
+		kept.Jobs = appendMissing(kept.Jobs, analysis.Jobs...)
+		kept.AffectedFiles = appendMissing(kept.AffectedFiles, analysis.AffectedFiles...)
+		kept.ModelsUsed = appendMissing(kept.ModelsUsed, analysis.ModelsUsed...)
+		if analysis.LLMUsage != nil {
+			usage := LLMUsageSummary{}
+			if kept.LLMUsage != nil {
+				usage = *kept.LLMUsage
+			}
+			usage.add(*analysis.LLMUsage)
+			kept.LLMUsage = &usage
+		}
+	}
+	return deduped
+}
+
+// normalizeRootCause ignores case and whitespace differences between root causes
+func normalizeRootCause(rootCause string) string {
+	return strings.ToLower(strings.Join(strings.Fields(rootCause), " "))
+}
+
+// analysisToFix picks the analyses AutoFix fixes: the group of analyses sharing affected
+// files that explains the most jobs, combined into one analysis when the group has several.
+// The analyses left out are returned so they can be reported.
+func analysisToFix(analyses []*FailureAnalysisResult) (*FailureAnalysisResult, []*FailureAnalysisResult) {
+	if len(analyses) == 1 {
+		return analyses[0], nil
+	}
+
+	groups := groupBySharedFiles(analyses)
+	best := 0
+	for i, group := range groups {
+		if countJobs(group) > countJobs(groups[best]) {
+			best = i
+		}
+	}
+
+	var unaddressed []*FailureAnalysisResult
+	for i, group := range groups {
+		if i != best {
+			unaddressed = append(unaddressed, group...)
+		}
+	}
+	if len(groups[best]) == 1 {
+		return groups[best][0], unaddressed
+	}
+	return combineAnalyses(groups[best]), unaddressed
+}
+
+// groupBySharedFiles groups analyses that have an affected file in common, directly or
+// through another analysis of the group. Groups keep the order of their first analysis.
+func groupBySharedFiles(analyses []*FailureAnalysisResult) [][]*FailureAnalysisResult {
+	parent := make([]int, len(analyses))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	owner := make(map[string]int)
+	for i, analysis := range analyses {
+		for _, file := range analysis.AffectedFiles {
+			if j, ok := owner[file]; ok {
+				a, b := find(i), find(j)
+				if a > b {
+					a, b = b, a
+				}
+				parent[b] = a
+				continue
+			}
+			owner[file] = i
+		}
+	}
+
+	var groups [][]*FailureAnalysisResult
+	index := make(map[int]int)
+	for i, analysis := range analyses {
+		root := find(i)
+		g, ok := index[root]
+		if !ok {
+			g = len(groups)
+			index[root] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], analysis)
+	}
+	return groups
+}
+
+// combineAnalyses merges distinct analyses touching the same files into one, so a single fix
+// addresses all of their root causes. The most confident analysis provides the classification.
+func combineAnalyses(group []*FailureAnalysisResult) *FailureAnalysisResult {
+	sorted := append([]*FailureAnalysisResult{}, group...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Classification.Confidence > sorted[j].Classification.Confidence
+	})
+
+	combined := *sorted[0]
+	combined.ID = sorted[0].ID + "-combined"
+	combined.Jobs, combined.AffectedFiles, combined.ErrorPatterns, combined.Advisories = nil, nil, nil, nil
+	combined.ModelsUsed, combined.Interactions = nil, nil
+	combined.ProcessingTime = 0
+	var usage LLMUsageSummary
+	var rootCauses, descriptions []string
+	logs := make([]*WorkflowLogs, 0, len(sorted))
+	for _, analysis := range sorted {
+		label := strings.Join(analysis.Jobs, ", ")
+		rootCauses = append(rootCauses, fmt.Sprintf("[%s] %s", label, analysis.RootCause))
+		descriptions = append(descriptions, fmt.Sprintf("[%s] %s", label, analysis.Description))
+		combined.Jobs = appendMissing(combined.Jobs, analysis.Jobs...)
+		combined.AffectedFiles = appendMissing(combined.AffectedFiles, analysis.AffectedFiles...)
+		combined.ModelsUsed = appendMissing(combined.ModelsUsed, analysis.ModelsUsed...)
+		combined.ErrorPatterns = append(combined.ErrorPatterns, analysis.ErrorPatterns...)
+		combined.Interactions = append(combined.Interactions, analysis.Interactions...)
+		for _, advisory := range analysis.Advisories {
+			if !containsAdvisory(combined.Advisories, advisory.ID) {
+				combined.Advisories = append(combined.Advisories, advisory)
+			}
+		}
+		combined.ProcessingTime += analysis.ProcessingTime
+		if analysis.LLMUsage != nil {
+			usage.add(*analysis.LLMUsage)
+		}
+		logs = append(logs, analysis.Context.Logs)
+	}
+	combined.RootCause = strings.Join(rootCauses, "\n")
+	combined.Description = strings.Join(descriptions, "\n")
+	combined.Context.JobName = ""
+	combined.Context.Logs = mergeWorkflowLogs(logs...)
+	combined.Fingerprint = failureFingerprint(combined.Context.Logs)
+	combined.LLMUsage = &usage
+	return &combined
+}
+
+func countJobs(group []*FailureAnalysisResult) int {
+	n := 0
+	for _, analysis := range group {
+		n += max(len(analysis.Jobs), 1)
+	}
+	return n
+}
+
+// appendMissing appends the values not already in list
+func appendMissing(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range list {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// jobSlug turns a job name such as "test (1.22, ubuntu-latest)" into "test-1-22-ubuntu-latest"
+func jobSlug(job string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(job) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// matrixLogs returns logs of a run whose jobs failed with the given error lines
+func matrixLogs(jobErrors map[string]string, jobs ...string) *WorkflowLogs {
+	logs := &WorkflowLogs{JobLogs: make(map[string]string), JobErrorLines: make(map[string][]string)}
+	for _, job := range jobs {
+		logs.JobLogs[job] = fmt.Sprintf("Job: %s\n%s\n", job, jobErrors[job])
+		logs.RawLogs += logs.JobLogs[job]
+		logs.ErrorLines = append(logs.ErrorLines, jobErrors[job])
+		logs.JobErrorLines[job] = []string{jobErrors[job]}
+		logs.FailedJobs = append(logs.FailedJobs, job)
+	}
+	return logs
+}
+
+// jobAnalysisAutofix returns an agent whose failure engine explains each job's error with
+// rootCauses and affectedFiles, keyed by the error line
+func jobAnalysisAutofix(logs *WorkflowLogs, rootCauses map[string]string, affectedFiles map[string][]string, fixed *[]*FailureAnalysisResult) *DaggerAutofix {
+	m := fixtureAutofix(nil)
+	m.githubClient.(*mockGitHub).getWorkflowLogsFunc = func(ctx context.Context, runID int64) (*WorkflowLogs, error) {
+		return logs, nil
+	}
+	engine := m.failureEngine.(*mockFailureAnalysisEngine)
+	generate := engine.generateFixesFunc
+	engine.analyzeFunc = func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+		if len(fc.Logs.ErrorLines) != 1 {
+			return nil, fmt.Errorf("job %q was analyzed with %d error lines", fc.JobName, len(fc.Logs.ErrorLines))
+		}
+		errorLine := fc.Logs.ErrorLines[0]
+		return &FailureAnalysisResult{
+			ID:             "analysis-42",
+			Classification: FailureClassification{Type: TestFailure, Confidence: 0.8},
+			RootCause:      rootCauses[errorLine],
+			AffectedFiles:  affectedFiles[errorLine],
+			Context:        fc,
+		}, nil
+	}
+	engine.generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+		*fixed = append(*fixed, analysis)
+		return generate(ctx, analysis)
+	}
+	return m
+}
+
+// TestDedupeAnalyses tests that analyses with the same type and root cause are merged
+func TestDedupeAnalyses(t *testing.T) {
+	var analyses []*FailureAnalysisResult
+	for i, version := range []string{"1.21", "1.22", "1.23"} {
+		for _, platform := range []string{"linux", "mac"} {
+			rootCause := "TestParse dereferences a nil config"
+			if i == 1 {
+				rootCause = "  testparse dereferences a NIL config "
+			}
+			analyses = append(analyses, &FailureAnalysisResult{
+				ID:             fmt.Sprintf("analysis-%s-%s", version, platform),
+				Classification: FailureClassification{Type: TestFailure},
+				RootCause:      rootCause,
+				AffectedFiles:  []string{"parser/parser.go"},
+				Jobs:           []string{fmt.Sprintf("test (%s, %s)", version, platform)},
+				LLMUsage:       &LLMUsageSummary{Requests: 1, TotalTokens: 100},
+			})
+		}
+	}
+	analyses = append(analyses, &FailureAnalysisResult{
+		ID:             "analysis-build",
+		Classification: FailureClassification{Type: BuildFailure},
+		RootCause:      "TestParse dereferences a nil config",
+		Jobs:           []string{"build"},
+	})
+
+	deduped := dedupeAnalyses(analyses)
+	require.Len(t, deduped, 2)
+	assert.Equal(t, "analysis-1.21-linux", deduped[0].ID)
+	assert.Equal(t, []string{
+		"test (1.21, linux)", "test (1.21, mac)", "test (1.22, linux)",
+		"test (1.22, mac)", "test (1.23, linux)", "test (1.23, mac)",
+	}, deduped[0].Jobs)
+	assert.Equal(t, []string{"parser/parser.go"}, deduped[0].AffectedFiles)
+	assert.Equal(t, 600, deduped[0].LLMUsage.TotalTokens)
+	assert.Equal(t, []string{"build"}, deduped[1].Jobs, "a different failure type is a different failure")
+}
+
+// TestGroupBySharedFiles tests that analyses are grouped through shared files transitively
+func TestGroupBySharedFiles(t *testing.T) {
+	a := &FailureAnalysisResult{ID: "a", AffectedFiles: []string{"parser.go"}}
+	b := &FailureAnalysisResult{ID: "b", AffectedFiles: []string{"lexer.go"}}
+	c := &FailureAnalysisResult{ID: "c", AffectedFiles: []string{"lexer.go", "parser.go"}}
+	d := &FailureAnalysisResult{ID: "d", AffectedFiles: []string{"docs.md"}}
+	e := &FailureAnalysisResult{ID: "e"}
+
+	groups := groupBySharedFiles([]*FailureAnalysisResult{a, b, d, c, e})
+	require.Len(t, groups, 3)
+	assert.Equal(t, []*FailureAnalysisResult{a, b, c}, groups[0])
+	assert.Equal(t, []*FailureAnalysisResult{d}, groups[1])
+	assert.Equal(t, []*FailureAnalysisResult{e}, groups[2])
+}
+
+// TestAnalyzeFailureJobs tests that a matrix with two distinct failures yields one analysis
+// per distinct failure, each analyzed from its own job's logs
+func TestAnalyzeFailureJobs(t *testing.T) {
+	logs := matrixLogs(map[string]string{
+		"test (1.21, linux)": "parser_test.go:12: nil pointer dereference",
+		"test (1.22, linux)": "parser_test.go:12: nil pointer dereference",
+		"test (1.23, linux)": "parser_test.go:12: nil pointer dereference",
+		"lint":               "lexer.go:40: undefined: strings.CutPrefix",
+	}, "test (1.21, linux)", "lint", "test (1.22, linux)", "test (1.23, linux)")
+	var fixed []*FailureAnalysisResult
+	m := jobAnalysisAutofix(logs, map[string]string{
+		"parser_test.go:12: nil pointer dereference": "Parse does not handle a nil config",
+		"lexer.go:40: undefined: strings.CutPrefix":  "strings.CutPrefix needs Go 1.20",
+	}, nil, &fixed)
+
+	analyses, err := m.AnalyzeFailureJobs(context.Background(), 42)
+	require.NoError(t, err)
+	require.Len(t, analyses, 2)
+
+	assert.Equal(t, "Parse does not handle a nil config", analyses[0].RootCause)
+	assert.Equal(t, []string{"test (1.21, linux)", "test (1.22, linux)", "test (1.23, linux)"}, analyses[0].Jobs)
+	assert.Equal(t, "analysis-42-test-1-21-linux", analyses[0].ID)
+	assert.Equal(t, "test (1.21, linux)", analyses[0].Context.JobName)
+	assert.Equal(t, "Job: test (1.21, linux)\nparser_test.go:12: nil pointer dereference\n", analyses[0].Context.Logs.RawLogs)
+
+	assert.Equal(t, "strings.CutPrefix needs Go 1.20", analyses[1].RootCause)
+	assert.Equal(t, []string{"lint"}, analyses[1].Jobs)
+	assert.Equal(t, "analysis-42-lint", analyses[1].ID)
+
+	// Logs without failed job names are analyzed as a whole
+	m.githubClient.(*mockGitHub).getWorkflowLogsFunc = func(ctx context.Context, runID int64) (*WorkflowLogs, error) {
+		return &WorkflowLogs{RawLogs: "FAIL", ErrorLines: []string{"parser_test.go:12: nil pointer dereference"}}, nil
+	}
+	analyses, err = m.AnalyzeFailureJobs(context.Background(), 42)
+	require.NoError(t, err)
+	require.Len(t, analyses, 1)
+	assert.Empty(t, analyses[0].Jobs)
+	assert.Equal(t, "analysis-42", analyses[0].ID)
+}
+
+// TestAutoFixCombinesFailuresSharingFiles tests that distinct failures in the same files are
+// fixed together
+func TestAutoFixCombinesFailuresSharingFiles(t *testing.T) {
+	useTestMetrics(t)
+	logs := matrixLogs(map[string]string{
+		"test (linux)": "parser_test.go:12: nil pointer dereference",
+		"test (mac)":   "parser_test.go:30: path separator mismatch",
+	}, "test (linux)", "test (mac)")
+	var fixed []*FailureAnalysisResult
+	m := jobAnalysisAutofix(logs, map[string]string{
+		"parser_test.go:12: nil pointer dereference": "Parse does not handle a nil config",
+		"parser_test.go:30: path separator mismatch": "Parse joins paths with a forward slash",
+	}, map[string][]string{
+		"parser_test.go:12: nil pointer dereference": {"parser/parser.go"},
+		"parser_test.go:30: path separator mismatch": {"parser/parser.go", "parser/path.go"},
+	}, &fixed)
+
+	result, err := m.AutoFix(context.Background(), 42)
+	require.NoError(t, err)
+	require.Len(t, fixed, 1, "one combined fix is generated")
+
+	combined := fixed[0]
+	assert.Equal(t, result.Analysis, combined)
+	assert.Equal(t, "analysis-42-test-linux-combined", combined.ID)
+	assert.Equal(t, []string{"test (linux)", "test (mac)"}, combined.Jobs)
+	assert.Equal(t, []string{"parser/parser.go", "parser/path.go"}, combined.AffectedFiles)
+	assert.Equal(t, "[test (linux)] Parse does not handle a nil config\n[test (mac)] Parse joins paths with a forward slash", combined.RootCause)
+	assert.Empty(t, combined.Context.JobName)
+	assert.Len(t, combined.Context.Logs.ErrorLines, 2)
+	assert.Equal(t, []string{"test (linux)", "test (mac)"}, result.Metadata["failed_jobs"])
+	assert.NotContains(t, result.Metadata, "unaddressed_analyses")
+}
+
+// TestAutoFixReportsUnrelatedFailures tests that the failure covering the most jobs is fixed
+// when failures share no files, and the others are reported
+func TestAutoFixReportsUnrelatedFailures(t *testing.T) {
+	useTestMetrics(t)
+	logs := matrixLogs(map[string]string{
+		"lint":        "lexer.go:40: undefined: strings.CutPrefix",
+		"test (1.21)": "parser_test.go:12: nil pointer dereference",
+		"test (1.22)": "parser_test.go:12: nil pointer dereference",
+	}, "lint", "test (1.21)", "test (1.22)")
+	var fixed []*FailureAnalysisResult
+	m := jobAnalysisAutofix(logs, map[string]string{
+		"lexer.go:40: undefined: strings.CutPrefix":  "strings.CutPrefix needs Go 1.20",
+		"parser_test.go:12: nil pointer dereference": "Parse does not handle a nil config",
+	}, map[string][]string{
+		"lexer.go:40: undefined: strings.CutPrefix":  {"lexer/lexer.go"},
+		"parser_test.go:12: nil pointer dereference": {"parser/parser.go"},
+	}, &fixed)
+
+	result, err := m.AutoFix(context.Background(), 42)
+	require.NoError(t, err)
+	require.Len(t, fixed, 1)
+	assert.Equal(t, "Parse does not handle a nil config", fixed[0].RootCause)
+	assert.Equal(t, []string{"test (1.21)", "test (1.22)"}, result.Metadata["failed_jobs"])
+	assert.Equal(t, []map[string]interface{}{
+		{"id": "analysis-42-lint", "jobs": []string{"lint"}, "root_cause": "strings.CutPrefix needs Go 1.20"},
+	}, result.Metadata["unaddressed_analyses"])
+}
+
+// TestPrintJobAnalyses tests the per-job breakdown of the analyze command
+func TestPrintJobAnalyses(t *testing.T) {
+	cli, out := outputCLI(t, OutputText)
+	require.NoError(t, cli.printJobAnalyses([]*FailureAnalysisResult{
+		{ID: "a1", Jobs: []string{"test (1.21)", "test (1.22)"}, RootCause: "nil config", Classification: FailureClassification{Type: TestFailure}},
+		{ID: "a2", Jobs: []string{"lint"}, RootCause: "missing import", Classification: FailureClassification{Type: BuildFailure}},
+	}))
+
+	text := out.String()
+	assert.Contains(t, text, "=== Failure Analysis: 2 distinct failures in 3 failed jobs ===\n")
+	assert.Contains(t, text, "--- Failure 1 ---\nID: a1\nJobs: test (1.21), test (1.22)\nType: test\n")
+	assert.Contains(t, text, "--- Failure 2 ---\nID: a2\nJobs: lint\nType: build\n")
+	assert.Equal(t, 1, strings.Count(text, "Root Cause: nil config"))
+}
+
+// TestJobSlug tests job names used in analysis IDs
+func TestJobSlug(t *testing.T) {
+	assert.Equal(t, "test-1-22-ubuntu-latest", jobSlug("test (1.22, ubuntu-latest)"))
+	assert.Equal(t, "lint", jobSlug("Lint"))
+	assert.Equal(t, "build-go", jobSlug("  build / go  "))
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultLLMCacheTTL is how long cached responses are reused when no TTL is configured
+	defaultLLMCacheTTL = 24 * time.Hour
+	// llmCacheMaxEntries bounds the responses kept in memory and on disk
+	llmCacheMaxEntries = 500
+)
+
+// llmCacheEntry is a cached response as stored in memory and on disk
+type llmCacheEntry struct {
+	StoredAt time.Time       `json:"stored_at"`
+	Response json.RawMessage `json:"response"`
+}
+
+// llmCache stores LLM responses keyed by a hash of the request. Entries are kept in an
+// in-memory LRU and, when dir is set, as one JSON file per entry so they survive restarts.
+type llmCache struct {
+	dir        string
+	ttl        time.Duration
+	maxEntries int
+	logger     *logrus.Logger
+	now        func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // most recently used first; values are keys
+	entries map[string]*list.Element
+	values  map[string]llmCacheEntry
+}
+
+// newLLMCache creates a cache keeping up to maxEntries responses for ttl. An empty dir
+// keeps them in memory only.
+func newLLMCache(dir string, ttl time.Duration, maxEntries int, logger *logrus.Logger) (*llmCache, error) {
+	if ttl <= 0 {
+		ttl = defaultLLMCacheTTL
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create LLM cache directory: %w", err)
+		}
+	}
+	return &llmCache{
+		dir:        dir,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		logger:     logger,
+		now:        time.Now,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+		values:     make(map[string]llmCacheEntry),
+	}, nil
+}
+
+// llmCacheKey returns the SHA-256 of everything that determines a response, including the
+// sampling temperature and the token limit that can cut it short
+func llmCacheKey(provider LLMProvider, model string, temperature float64, maxTokens int, request *LLMRequest) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		string(provider), model,
+		strconv.FormatFloat(temperature, 'g', -1, 64), strconv.Itoa(maxTokens),
+		request.SystemMsg, request.Prompt,
+	}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns a copy of the cached response for key, if it has not expired
+func (c *llmCache) get(key string) (*LLMResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.values[key]
+	if !ok && c.dir != "" {
+		entry, ok = c.load(key)
+		if ok {
+			c.store(key, entry)
+		}
+	}
+	if !ok {
+		return nil, false
+	}
+	if c.now().Sub(entry.StoredAt) >= c.ttl {
+		c.remove(key)
+		return nil, false
+	}
+	c.order.MoveToFront(c.entries[key])
+
+	var response LLMResponse
+	if err := json.Unmarshal(entry.Response, &response); err != nil {
+		c.remove(key)
+		return nil, false
+	}
+	return &response, true
+}
+
+// put caches response under key, evicting the least recently used entries over the limit
+func (c *llmCache) put(key string, response *LLMResponse) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+	entry := llmCacheEntry{StoredAt: c.now(), Response: data}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.store(key, entry)
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Back().Value.(string))
+	}
+	if c.dir != "" {
+		if err := c.save(key, entry); err != nil {
+			c.logger.WithError(err).Warn("Failed to write LLM cache entry")
+			return
+		}
+		c.pruneDir()
+	}
+}
+
+// store adds entry to the in-memory LRU. The caller holds mu.
+func (c *llmCache) store(key string, entry llmCacheEntry) {
+	c.values[key] = entry
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(key)
+}
+
+// remove drops key from memory and disk. The caller holds mu.
+func (c *llmCache) remove(key string) {
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+	delete(c.values, key)
+	if c.dir != "" {
+		os.Remove(c.path(key))
+	}
+}
+
+func (c *llmCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+func (c *llmCache) load(key string) (llmCacheEntry, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return llmCacheEntry{}, false
+	}
+	var entry llmCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		os.Remove(c.path(key))
+		return llmCacheEntry{}, false
+	}
+	return entry, true
+}
+
+// save writes entry through a temporary file so readers never see a partial entry
+func (c *llmCache) save(key string, entry llmCacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+// pruneDir removes expired entry files and the oldest ones over the limit. The caller holds mu.
+func (c *llmCache) pruneDir() {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	type cached struct {
+		name    string
+		modTime time.Time
+	}
+	var live []cached
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		if c.now().Sub(info.ModTime()) >= c.ttl {
+			os.Remove(filepath.Join(c.dir, file.Name()))
+			continue
+		}
+		live = append(live, cached{file.Name(), info.ModTime()})
+	}
+	if len(live) <= c.maxEntries {
+		return
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].modTime.Before(live[j].modTime) })
+	for _, file := range live[:len(live)-c.maxEntries] {
+		if err := os.Remove(filepath.Join(c.dir, file.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			c.logger.WithError(err).Debug("Failed to evict LLM cache entry")
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const toolCallResponse = `{
+	"model": "gpt-4o",
+	"choices": [{
+		"message": {
+			"role": "assistant",
+			"content": "",
+			"tool_calls": [{"id": "call_1", "function": {"name": "read_file", "arguments": "{\"path\": \"main.go\"}"}}]
+		},
+		"finish_reason": "tool_calls"
+	}]
+}`
+
+// countingLLMServer serves body for every request and counts the requests
+func countingLLMServer(t *testing.T, body string) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// fakeClock returns a clock for cache tests and a function advancing it
+func fakeClock() (func() time.Time, func(time.Duration)) {
+	now := time.Now()
+	return func() time.Time { return now }, func(d time.Duration) { now = now.Add(d) }
+}
+
+// TestLLMCacheHit tests that a second identical request is answered without contacting the backend
+func TestLLMCacheHit(t *testing.T) {
+	metrics := useTestMetrics(t)
+	server, requests := countingLLMServer(t, mockResponses[OpenAI])
+	cache, err := newLLMCache("", time.Hour, llmCacheMaxEntries, quietLogger())
+	require.NoError(t, err)
+	client := createTestClient(OpenAI, server.URL).WithCache(cache)
+	client.logger = quietLogger()
+
+	request := &LLMRequest{SystemMsg: "You fix CI failures", Prompt: "Analyze this failure"}
+	first, err := client.Chat(context.Background(), request)
+	require.NoError(t, err)
+	second, err := client.Chat(context.Background(), &LLMRequest{SystemMsg: "You fix CI failures", Prompt: "Analyze this failure"})
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+	assert.Equal(t, first, second)
+	second.Content = "changed"
+	third, err := client.Chat(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, first.Content, third.Content, "cached responses are copies")
+
+	// Any difference in the request is a miss
+	_, err = client.Chat(context.Background(), &LLMRequest{SystemMsg: "You fix CI failures", Prompt: "Analyze this failure", Model: "gpt-4o-mini"})
+	require.NoError(t, err)
+	_, err = client.Chat(context.Background(), &LLMRequest{SystemMsg: "You analyze CI failures", Prompt: "Analyze this failure"})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(requests))
+
+	body := scrapeMetrics(t, metrics)
+	assert.Contains(t, body, `github_autofix_llm_cache_hits_total{provider="openai"} 2`+"\n")
+	assert.Contains(t, body, `github_autofix_llm_requests_total{provider="openai",outcome="success"} 3`+"\n")
+}
+
+// TestLLMCacheTTL tests that an expired response triggers a real request
+func TestLLMCacheTTL(t *testing.T) {
+	useTestMetrics(t)
+	server, requests := countingLLMServer(t, mockResponses[OpenAI])
+	cache, err := newLLMCache(t.TempDir(), time.Hour, llmCacheMaxEntries, quietLogger())
+	require.NoError(t, err)
+	now, advance := fakeClock()
+	cache.now = now
+	client := createTestClient(OpenAI, server.URL).WithCache(cache)
+	client.logger = quietLogger()
+
+	request := &LLMRequest{Prompt: "Analyze this failure"}
+	for i := 0; i < 2; i++ {
+		_, err := client.Chat(context.Background(), request)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+	advance(time.Hour)
+	_, err = client.Chat(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+
+	_, err = client.Chat(context.Background(), request)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests), "the fresh response is cached again")
+}
+
+// TestLLMCacheBypassesToolCalls tests that requests with tools and responses with tool calls are not cached
+func TestLLMCacheBypassesToolCalls(t *testing.T) {
+	useTestMetrics(t)
+	server, requests := countingLLMServer(t, toolCallResponse)
+	cache, err := newLLMCache("", time.Hour, llmCacheMaxEntries, quietLogger())
+	require.NoError(t, err)
+	client := createTestClient(OpenAI, server.URL).WithCache(cache)
+	client.logger = quietLogger()
+
+	for _, request := range []*LLMRequest{
+		{Prompt: "Read the file", Tools: []LLMTool{{Name: "read_file", Parameters: `{"type":"object"}`}}},
+		{Prompt: "Read the file", Tools: []LLMTool{{Name: "read_file", Parameters: `{"type":"object"}`}}},
+		{Prompt: "Unprompted tool call"},
+		{Prompt: "Unprompted tool call"},
+	} {
+		response, err := client.Chat(context.Background(), request)
+		require.NoError(t, err)
+		require.Len(t, response.ToolCalls, 1)
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(requests))
+}
+
+// TestLLMCacheDisk tests that cached responses survive a restart and the entry limit evicts
+// the least recently used responses
+func TestLLMCacheDisk(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "llm-cache")
+	cache, err := newLLMCache(dir, time.Hour, 2, quietLogger())
+	require.NoError(t, err)
+
+	cache.put("a", &LLMResponse{Content: "first"})
+	time.Sleep(10 * time.Millisecond)
+	cache.put("b", &LLMResponse{Content: "second"})
+	_, ok := cache.get("a")
+	require.True(t, ok)
+	cache.put("c", &LLMResponse{Content: "third"})
+
+	_, ok = cache.get("b")
+	assert.False(t, ok, "the least recently used entry is evicted")
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+
+	restarted, err := newLLMCache(dir, time.Hour, 2, quietLogger())
+	require.NoError(t, err)
+	response, ok := restarted.get("c")
+	require.True(t, ok)
+	assert.Equal(t, "third", response.Content)
+
+	now, advance := fakeClock()
+	restarted.now = now
+	advance(2 * time.Hour)
+	_, ok = restarted.get("c")
+	assert.False(t, ok)
+	assert.NoFileExists(t, filepath.Join(dir, "c.json"), "expired entries are deleted")
+}
+
+// TestLLMCacheKey tests that the key covers provider, model, sampling settings, system message
+// and prompt
+func TestLLMCacheKey(t *testing.T) {
+	base := llmCacheKey(OpenAI, "gpt-4o", 0.1, 4000, &LLMRequest{SystemMsg: "system", Prompt: "prompt"})
+	assert.Len(t, base, 64)
+	assert.Equal(t, base, llmCacheKey(OpenAI, "gpt-4o", 0.1, 4000, &LLMRequest{SystemMsg: "system", Prompt: "prompt"}))
+	for _, other := range []string{
+		llmCacheKey(Anthropic, "gpt-4o", 0.1, 4000, &LLMRequest{SystemMsg: "system", Prompt: "prompt"}),
+		llmCacheKey(OpenAI, "gpt-4", 0.1, 4000, &LLMRequest{SystemMsg: "system", Prompt: "prompt"}),
+		llmCacheKey(OpenAI, "gpt-4o", 0.7, 4000, &LLMRequest{SystemMsg: "system", Prompt: "prompt"}),
+		llmCacheKey(OpenAI, "gpt-4o", 0.1, 1000, &LLMRequest{SystemMsg: "system", Prompt: "prompt"}),
+		llmCacheKey(OpenAI, "gpt-4o", 0.1, 4000, &LLMRequest{SystemMsg: "systemprompt"}),
+		llmCacheKey(OpenAI, "gpt-4o", 0.1, 4000, &LLMRequest{SystemMsg: "system", Prompt: "prompt2"}),
+	} {
+		assert.NotEqual(t, base, other)
+	}
+}
+
+// TestLLMCacheSkipsTruncatedResponses tests that responses cut off by the token limit are not
+// cached, and that changing the limit misses the cache
+func TestLLMCacheSkipsTruncatedResponses(t *testing.T) {
+	useTestMetrics(t)
+	server, requests := countingLLMServer(t, `{"model": "gpt-4o", "choices": [{"message": {"role": "assistant", "content": "The build fails beca"}, "finish_reason": "length"}]}`)
+	cache, err := newLLMCache("", time.Hour, llmCacheMaxEntries, quietLogger())
+	require.NoError(t, err)
+	client := createTestClient(OpenAI, server.URL).WithCache(cache)
+	client.logger = quietLogger()
+
+	for i := 0; i < 2; i++ {
+		response, err := client.Chat(context.Background(), &LLMRequest{Prompt: "Analyze this failure"})
+		require.NoError(t, err)
+		assert.Equal(t, FinishLength, response.FinishReason)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+
+	complete, requests := countingLLMServer(t, mockResponses[OpenAI])
+	client = createTestClient(OpenAI, complete.URL).WithCache(cache)
+	client.logger = quietLogger()
+	for _, maxTokens := range []int{4000, 4000, 8000} {
+		_, err := client.WithMaxTokens(maxTokens).Chat(context.Background(), &LLMRequest{Prompt: "Analyze this failure"})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+}
+
+// TestNoLLMCacheFlag tests the CLI cache settings
+func TestNoLLMCacheFlag(t *testing.T) {
+	clearConfigEnv(t)
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	config := cli.getCurrentConfig(cli.rootCmd)
+	assert.False(t, config.NoLLMCache)
+	assert.Equal(t, defaultLLMCacheTTL, config.LLMCacheTTL)
+
+	t.Setenv("LLM_CACHE_TTL", "30m")
+	require.NoError(t, cli.rootCmd.ParseFlags([]string{"--no-llm-cache", "--llm-cache-dir", "/tmp/cache"}))
+	config = cli.getCurrentConfig(cli.rootCmd)
+	assert.True(t, config.NoLLMCache)
+	assert.Equal(t, "/tmp/cache", config.LLMCacheDir)
+	assert.Equal(t, 30*time.Minute, config.LLMCacheTTL)
+
+	t.Setenv("LLM_CACHE_TTL", "soon")
+	config = cli.getCurrentConfig(cli.rootCmd)
+	require.Len(t, config.problems, 1)
+	assert.Equal(t, `llm.cache_ttl (env LLM_CACHE_TTL): "soon" is not a duration`, config.problems[0].String())
+}
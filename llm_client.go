@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -38,6 +40,9 @@ type LLMClient struct {
 	httpClient *http.Client
 	logger     *logrus.Logger
 	config     *LLMConfig
+	cache      *llmCache
+	// headers are sent with every request, see WithExtraHeaders
+	headers map[string]string
 }
 
 // LLMConfig holds configuration for LLM providers
@@ -66,10 +71,52 @@ type LLMResponse struct {
 	Usage        *LLMUsage              `json:"usage,omitempty"`
 	Model        string                 `json:"model"`
 	Provider     string                 `json:"provider"`
-	FinishReason string                 `json:"finish_reason"`
+	FinishReason FinishReason           `json:"finish_reason"`
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
 }
 
+// FinishReason tells why the LLM stopped generating, normalized across providers. The
+// provider's own reason is kept in the response metadata as provider_finish_reason.
+type FinishReason string
+
+const (
+	FinishStop          FinishReason = "stop"
+	FinishLength        FinishReason = "length"
+	FinishToolCalls     FinishReason = "tool_calls"
+	FinishContentFilter FinishReason = "content_filter"
+	FinishError         FinishReason = "error"
+)
+
+// providerFinishReasons maps the finish reasons of the providers to FinishReason. Gemini
+// reports STOP for tool calls too, which finishResponse corrects.
+var providerFinishReasons = map[string]FinishReason{
+	// OpenAI and the compatible providers
+	"stop":           FinishStop,
+	"length":         FinishLength,
+	"tool_calls":     FinishToolCalls,
+	"function_call":  FinishToolCalls,
+	"content_filter": FinishContentFilter,
+	// Anthropic
+	"end_turn":      FinishStop,
+	"stop_sequence": FinishStop,
+	"pause_turn":    FinishStop,
+	"max_tokens":    FinishLength,
+	"tool_use":      FinishToolCalls,
+	"refusal":       FinishContentFilter,
+	// Gemini
+	"STOP":                    FinishStop,
+	"MAX_TOKENS":              FinishLength,
+	"SAFETY":                  FinishContentFilter,
+	"RECITATION":              FinishContentFilter,
+	"BLOCKLIST":               FinishContentFilter,
+	"PROHIBITED_CONTENT":      FinishContentFilter,
+	"SPII":                    FinishContentFilter,
+	"IMAGE_SAFETY":            FinishContentFilter,
+	"LANGUAGE":                FinishContentFilter,
+	"MALFORMED_FUNCTION_CALL": FinishError,
+	"OTHER":                   FinishError,
+}
+
 // LLMTool represents a tool that can be called by the LLM
 type LLMTool struct {
 	Name        string `json:"name"`
@@ -91,8 +138,8 @@ type LLMUsage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
-// NewLLMClient creates a new LLM client for the specified provider
-func NewLLMClient(ctx context.Context, provider LLMProvider, apiKey *dagger.Secret) (*LLMClient, error) {
+// NewLLMClient creates a new LLM client for the specified provider, logging to logger
+func NewLLMClient(ctx context.Context, provider LLMProvider, apiKey *dagger.Secret, logger *logrus.Logger) (*LLMClient, error) {
 	var keyStr string
 	var err error
 
@@ -120,16 +167,21 @@ func NewLLMClient(ctx context.Context, provider LLMProvider, apiKey *dagger.Secr
 
 	config := getDefaultConfig(provider)
 	baseURL := getProviderBaseURL(provider)
+	if logger == nil {
+		logger = logrus.New()
+	}
 
 	client := &LLMClient{
 		provider: provider,
 		apiKey:   keyStr,
 		baseURL:  baseURL,
-		httpClient: &http.Client{
-			Timeout: config.Timeout,
-		},
-		logger: logrus.New(),
-		config: config,
+		// Requests are bounded by their context, see requestContext
+		httpClient: &http.Client{},
+		logger:     logger,
+		config:     config,
+	}
+	if _, err := client.WithExtraHeaders(contextLLMHeaders(ctx)); err != nil {
+		return nil, err
 	}
 
 	// Test connection
@@ -140,31 +192,133 @@ func NewLLMClient(ctx context.Context, provider LLMProvider, apiKey *dagger.Secr
 	return client, nil
 }
 
-// Chat sends a chat request to the LLM and returns the response
+// Chat sends a chat request to the LLM and returns the response. With a cache configured,
+// identical requests without tools are answered from the cache instead, once a response
+// ended normally.
 func (c *LLMClient) Chat(ctx context.Context, request *LLMRequest) (*LLMResponse, error) {
+	return c.chat(ctx, request, nil)
+}
+
+// chat answers a request from the cache or sends it, streaming the response to onDelta
+// unless it is nil
+func (c *LLMClient) chat(ctx context.Context, request *LLMRequest, onDelta func(string)) (*LLMResponse, error) {
+	if c.cache == nil || len(request.Tools) > 0 {
+		return c.send(ctx, request, onDelta)
+	}
+
+	model := c.requestModel(request)
+	key := llmCacheKey(c.provider, model, c.config.Temperature, c.config.MaxTokens, request)
+	if cached, ok := c.cache.get(key); ok {
+		agentMetrics.llmCacheHits.inc(string(c.provider))
+		c.logger.WithFields(logrus.Fields{
+			"provider":  c.provider,
+			"model":     model,
+			"cache_key": key[:12],
+		}).Info("Using cached LLM response")
+		if onDelta != nil {
+			onDelta(cached.Content)
+		}
+		return cached, nil
+	}
+
+	// Truncated responses and tool calls are not answers to reuse
+	response, err := c.send(ctx, request, onDelta)
+	if err == nil && response.FinishReason == FinishStop {
+		c.cache.put(key, response)
+	}
+	return response, err
+}
+
+// send sends a chat request to the provider, streaming the response when onDelta is set
+func (c *LLMClient) send(ctx context.Context, request *LLMRequest, onDelta func(string)) (response *LLMResponse, err error) {
 	start := time.Now()
 	defer func() {
+		agentMetrics.recordLLMRequest(c.provider, err)
+		if err == nil {
+			recordLLMUsage(ctx, response)
+		}
+		c.auditRequest(ctx, request, response, err)
 		c.logger.WithFields(logrus.Fields{
 			"provider": c.provider,
 			"duration": time.Since(start),
-			"model":    request.Model,
+			"model":    c.requestModel(request),
+			"stream":   onDelta != nil,
 		}).Debug("LLM request completed")
 	}()
 
+	if onDelta != nil {
+		return c.stream(ctx, request, onDelta)
+	}
+	reqCtx, cancel := c.requestContext(ctx)
+	defer cancel()
 	switch c.provider {
 	case OpenAI:
-		return c.chatOpenAI(ctx, request)
+		response, err = c.chatOpenAI(reqCtx, request)
 	case Anthropic:
-		return c.chatAnthropic(ctx, request)
+		response, err = c.chatAnthropic(reqCtx, request)
 	case Gemini:
-		return c.chatGemini(ctx, request)
+		response, err = c.chatGemini(reqCtx, request)
 	case DeepSeek:
-		return c.chatDeepSeek(ctx, request)
+		response, err = c.chatDeepSeek(reqCtx, request)
 	case LiteLLM:
-		return c.chatLiteLLM(ctx, request)
+		response, err = c.chatLiteLLM(reqCtx, request)
 	default:
 		return nil, fmt.Errorf("unsupported provider: %s", c.provider)
 	}
+	if err != nil {
+		return nil, err
+	}
+	// The parsers report the configured model, which the request may override
+	response.Model = c.requestModel(request)
+	return response, nil
+}
+
+// requestContext bounds a request by the configured timeout when ctx has no deadline. A
+// deadline set by the caller, e.g. the fix timeout, applies instead, whether it is sooner or
+// later than the configured timeout.
+func (c *LLMClient) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || c.config.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.config.Timeout)
+}
+
+// WithTimeout sets how long a request may take when the caller's context has no deadline
+func (c *LLMClient) WithTimeout(timeout time.Duration) *LLMClient {
+	c.config.Timeout = timeout
+	return c
+}
+
+// auditRequest records an LLM request in the audit log with a hash of the prompt, never
+// the prompt itself
+func (c *LLMClient) auditRequest(ctx context.Context, request *LLMRequest, response *LLMResponse, err error) {
+	details := map[string]interface{}{
+		"provider":      string(c.provider),
+		"model":         c.requestModel(request),
+		"prompt_sha256": auditHash(request.SystemMsg + "\n" + request.Prompt),
+		"prompt_bytes":  len(request.SystemMsg) + len(request.Prompt),
+		"outcome":       metricsOutcome(err),
+	}
+	if response != nil && response.Usage != nil {
+		details["prompt_tokens"] = response.Usage.PromptTokens
+		details["completion_tokens"] = response.Usage.CompletionTokens
+		details["total_tokens"] = response.Usage.TotalTokens
+	}
+	audit(ctx, AuditLLMRequest, details)
+}
+
+// requestModel returns the model a request is sent to
+func (c *LLMClient) requestModel(request *LLMRequest) string {
+	if request.Model == "" && c.config != nil {
+		return c.config.Model
+	}
+	return request.Model
+}
+
+// WithCache answers identical requests from cache instead of sending them again
+func (c *LLMClient) WithCache(cache *llmCache) *LLMClient {
+	c.cache = cache
+	return c
 }
 
 // WithModel sets the model to use for requests
@@ -188,6 +342,16 @@ func (c *LLMClient) WithMaxTokens(tokens int) *LLMClient {
 // Provider-specific implementations
 
 func (c *LLMClient) chatOpenAI(ctx context.Context, request *LLMRequest) (*LLMResponse, error) {
+	resp, err := c.makeRequest(ctx, "POST", "/v1/chat/completions", c.openAIPayload(request))
+	if err != nil {
+		return nil, err
+	}
+
+	return parsedResponse(c.parseOpenAIResponse(resp))
+}
+
+// openAIPayload builds the chat completions request of the OpenAI compatible providers
+func (c *LLMClient) openAIPayload(request *LLMRequest) map[string]interface{} {
 	model := request.Model
 	if model == "" {
 		model = c.config.Model
@@ -226,15 +390,24 @@ func (c *LLMClient) chatOpenAI(ctx context.Context, request *LLMRequest) (*LLMRe
 		payload["tool_choice"] = "auto"
 	}
 
-	resp, err := c.makeRequest(ctx, "POST", "/v1/chat/completions", payload)
+	return payload
+}
+
+func (c *LLMClient) chatAnthropic(ctx context.Context, request *LLMRequest) (*LLMResponse, error) {
+	payload, err := c.anthropicPayload(request)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.makeRequest(ctx, "POST", "/v1/messages", payload)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.parseOpenAIResponse(resp)
+	return parsedResponse(c.parseAnthropicResponse(resp))
 }
 
-func (c *LLMClient) chatAnthropic(ctx context.Context, request *LLMRequest) (*LLMResponse, error) {
+// anthropicPayload builds the Messages API request
+func (c *LLMClient) anthropicPayload(request *LLMRequest) (map[string]interface{}, error) {
 	model := request.Model
 	if model == "" {
 		model = c.config.Model
@@ -256,20 +429,43 @@ func (c *LLMClient) chatAnthropic(ctx context.Context, request *LLMRequest) (*LL
 		payload["system"] = request.SystemMsg
 	}
 
-	resp, err := c.makeRequest(ctx, "POST", "/v1/messages", payload)
-	if err != nil {
-		return nil, err
+	// Add tools if provided
+	if len(request.Tools) > 0 {
+		tools := make([]map[string]interface{}, len(request.Tools))
+		for i, tool := range request.Tools {
+			schema, err := toolSchema(tool)
+			if err != nil {
+				return nil, err
+			}
+			tools[i] = map[string]interface{}{
+				"name":         tool.Name,
+				"description":  tool.Description,
+				"input_schema": schema,
+			}
+		}
+		payload["tools"] = tools
+		payload["tool_choice"] = map[string]interface{}{"type": "auto"}
 	}
 
-	return c.parseAnthropicResponse(resp)
+	return payload, nil
 }
 
 func (c *LLMClient) chatGemini(ctx context.Context, request *LLMRequest) (*LLMResponse, error) {
-	model := request.Model
-	if model == "" {
-		model = c.config.Model
+	payload, err := c.geminiPayload(request)
+	if err != nil {
+		return nil, err
 	}
+	url := fmt.Sprintf("/v1beta/models/%s:generateContent", c.requestModel(request))
+	resp, err := c.makeRequest(ctx, "POST", url, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsedResponse(c.parseGeminiResponse(resp))
+}
 
+// geminiPayload builds the generateContent request
+func (c *LLMClient) geminiPayload(request *LLMRequest) (map[string]interface{}, error) {
 	payload := map[string]interface{}{
 		"contents": []map[string]interface{}{
 			{
@@ -296,13 +492,30 @@ func (c *LLMClient) chatGemini(ctx context.Context, request *LLMRequest) (*LLMRe
 		}
 	}
 
-	url := fmt.Sprintf("/v1beta/models/%s:generateContent", model)
-	resp, err := c.makeRequest(ctx, "POST", url, payload)
-	if err != nil {
-		return nil, err
+	// Add tools if provided
+	if len(request.Tools) > 0 {
+		declarations := make([]map[string]interface{}, len(request.Tools))
+		for i, tool := range request.Tools {
+			schema, err := toolSchema(tool)
+			if err != nil {
+				return nil, err
+			}
+			declarations[i] = map[string]interface{}{
+				"name":        tool.Name,
+				"description": tool.Description,
+			}
+			// Gemini rejects object schemas without properties, so tools without
+			// parameters declare none
+			if properties, _ := schema["properties"].(map[string]interface{}); len(properties) > 0 {
+				declarations[i]["parameters"] = geminiSchema(schema)
+			}
+		}
+		payload["tools"] = []map[string]interface{}{
+			{"functionDeclarations": declarations},
+		}
 	}
 
-	return c.parseGeminiResponse(resp)
+	return payload, nil
 }
 
 func (c *LLMClient) chatDeepSeek(ctx context.Context, request *LLMRequest) (*LLMResponse, error) {
@@ -317,6 +530,63 @@ func (c *LLMClient) chatLiteLLM(ctx context.Context, request *LLMRequest) (*LLMR
 
 // Helper methods
 
+// toolSchema decodes the JSON schema of a tool's parameters, an object schema without
+// properties when it has none
+func toolSchema(tool LLMTool) (map[string]interface{}, error) {
+	if strings.TrimSpace(tool.Parameters) == "" {
+		return map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}, nil
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(tool.Parameters), &schema); err != nil {
+		return nil, fmt.Errorf("invalid parameters schema for tool %s: %w", tool.Name, err)
+	}
+	return schema, nil
+}
+
+// geminiUnsupportedSchemaKeys are JSON schema keywords Gemini's OpenAPI schema subset rejects
+var geminiUnsupportedSchemaKeys = map[string]bool{
+	"$schema":              true,
+	"$id":                  true,
+	"$ref":                 true,
+	"$defs":                true,
+	"definitions":          true,
+	"additionalProperties": true,
+	"default":              true,
+}
+
+// geminiSchema converts a JSON schema into the OpenAPI schema subset of Gemini function
+// declarations: types are upper case and unsupported keywords are dropped
+func geminiSchema(schema map[string]interface{}) map[string]interface{} {
+	converted := make(map[string]interface{}, len(schema))
+	for key, value := range schema {
+		if geminiUnsupportedSchemaKeys[key] {
+			continue
+		}
+		switch key {
+		case "type":
+			if name, ok := value.(string); ok {
+				value = strings.ToUpper(name)
+			}
+		case "properties":
+			if properties, ok := value.(map[string]interface{}); ok {
+				convertedProperties := make(map[string]interface{}, len(properties))
+				for name, property := range properties {
+					if propertySchema, ok := property.(map[string]interface{}); ok {
+						convertedProperties[name] = geminiSchema(propertySchema)
+					}
+				}
+				value = convertedProperties
+			}
+		case "items":
+			if items, ok := value.(map[string]interface{}); ok {
+				value = geminiSchema(items)
+			}
+		}
+		converted[key] = value
+	}
+	return converted
+}
+
 func (c *LLMClient) makeRequest(ctx context.Context, method, path string, payload interface{}) (map[string]interface{}, error) {
 	body, err := json.Marshal(payload)
 	if err != nil {
@@ -329,46 +599,41 @@ func (c *LLMClient) makeRequest(ctx context.Context, method, path string, payloa
 			return nil, fmt.Errorf("failed to create request: %w", err)
 		}
 
-		// Set headers based on provider
-		switch c.provider {
-		case OpenAI, DeepSeek, LiteLLM:
-			req.Header.Set("Authorization", "Bearer "+c.apiKey)
-			req.Header.Set("Content-Type", "application/json")
-		case Anthropic:
-			req.Header.Set("x-api-key", c.apiKey)
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("anthropic-version", "2023-06-01")
-		case Gemini:
-			q := req.URL.Query()
-			q.Add("key", c.apiKey)
-			req.URL.RawQuery = q.Encode()
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("x-goog-api-key", c.apiKey)
-		}
+		c.setHeaders(req)
 
 		resp, err := c.httpClient.Do(req)
 		if err != nil {
-			return nil, fmt.Errorf("request failed: %w", err)
+			err = transportError(ctx, err)
+			if errors.Is(err, ErrLLMTimeout) || ctx.Err() != nil || attempt == c.config.RetryCount {
+				return nil, fmt.Errorf("request failed: %w", err)
+			}
+			// retry on transient network errors, e.g. a reset connection
+			if err := retryDelay(ctx); err != nil {
+				return nil, fmt.Errorf("request failed: %w", transportError(ctx, err))
+			}
+			continue
 		}
 
 		respBody, err := io.ReadAll(resp.Body)
 		resp.Body.Close()
 		if err != nil {
-			return nil, fmt.Errorf("failed to read response: %w", err)
+			return nil, fmt.Errorf("failed to read response: %w", transportError(ctx, err))
 		}
 
 		if resp.StatusCode >= 500 && attempt < c.config.RetryCount {
 			// retry on transient server errors
-			time.Sleep(100 * time.Millisecond)
+			if err := retryDelay(ctx); err != nil {
+				return nil, fmt.Errorf("request failed: %w", transportError(ctx, err))
+			}
 			continue
 		}
 		if resp.StatusCode >= 400 {
-			return nil, fmt.Errorf("API error %d: %s", resp.StatusCode, string(respBody))
+			return nil, classifyLLMError(resp.StatusCode, fmt.Errorf("API error %d: %s", resp.StatusCode, string(respBody)))
 		}
 
 		var result map[string]interface{}
 		if err := json.Unmarshal(respBody, &result); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+			return nil, fmt.Errorf("%w: failed to unmarshal response: %w", ErrLLMInvalidResponse, err)
 		}
 		return result, nil
 	}
@@ -376,92 +641,242 @@ func (c *LLMClient) makeRequest(ctx context.Context, method, path string, payloa
 	return nil, fmt.Errorf("request failed after retries")
 }
 
-func (c *LLMClient) parseOpenAIResponse(resp map[string]interface{}) (*LLMResponse, error) {
-	choices, ok := resp["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
-		return nil, fmt.Errorf("no choices in response")
+// llmRetryDelay is how long a failed request waits before it is retried
+const llmRetryDelay = 100 * time.Millisecond
+
+// retryDelay waits llmRetryDelay before a retry, returning ctx's error when it is done first
+func retryDelay(ctx context.Context) error {
+	select {
+	case <-time.After(llmRetryDelay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	choice := choices[0].(map[string]interface{})
-	message := choice["message"].(map[string]interface{})
+// transportError wraps errors of requests that ran past their deadline, whether the context's
+// or a network timeout, with ErrLLMTimeout
+func transportError(ctx context.Context, err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %w", ErrLLMTimeout, err)
+	}
+	return err
+}
 
-	var content string
-	if contentVal := message["content"]; contentVal != nil {
-		content = contentVal.(string)
+// setHeaders sets the extra headers, then the authentication and content headers of the
+// provider
+func (c *LLMClient) setHeaders(req *http.Request) {
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
 	}
+	switch c.provider {
+	case OpenAI, DeepSeek, LiteLLM:
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+		req.Header.Set("Content-Type", "application/json")
+	case Anthropic:
+		req.Header.Set("x-api-key", c.apiKey)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("anthropic-version", "2023-06-01")
+	case Gemini:
+		q := req.URL.Query()
+		q.Add("key", c.apiKey)
+		req.URL.RawQuery = q.Encode()
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("x-goog-api-key", c.apiKey)
+	}
+}
+
+// classifyLLMError wraps errors for rejected API keys and rate limits with ErrLLMAuth and
+// ErrLLMRateLimited
+func classifyLLMError(statusCode int, err error) error {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %w", ErrLLMAuth, err)
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%w: %w", ErrLLMRateLimited, err)
+	}
+	return err
+}
 
+// parsedResponse wraps errors from the provider response parsers with ErrLLMInvalidResponse,
+// except for responses the provider's content filter blocked
+func parsedResponse(response *LLMResponse, err error) (*LLMResponse, error) {
+	if errors.Is(err, ErrLLMContentFiltered) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrLLMInvalidResponse, err)
+	}
+	return response, nil
+}
+
+// finishResponse normalizes the provider's finish reason of a parsed response. A missing or
+// unknown reason is taken as a normal end. Responses stopped by a content filter are returned
+// as ErrLLMContentFiltered, since whatever they contain was cut off.
+func finishResponse(response *LLMResponse, reason string) (*LLMResponse, error) {
+	finish, ok := providerFinishReasons[reason]
+	if !ok {
+		finish = FinishStop
+	}
+	if finish == FinishStop && len(response.ToolCalls) > 0 {
+		finish = FinishToolCalls
+	}
+	if finish == FinishContentFilter {
+		return nil, contentFiltered(LLMProvider(response.Provider), reason)
+	}
+
+	response.FinishReason = finish
+	if reason != "" {
+		if response.Metadata == nil {
+			response.Metadata = make(map[string]interface{})
+		}
+		response.Metadata["provider_finish_reason"] = reason
+	}
+	return response, nil
+}
+
+func contentFiltered(provider LLMProvider, reason string) error {
+	return fmt.Errorf("%w: %s stopped with %s", ErrLLMContentFiltered, provider, reason)
+}
+
+func promptBlocked(provider LLMProvider, reason string) error {
+	return fmt.Errorf("%w: %s blocked the prompt with %s", ErrLLMContentFiltered, provider, reason)
+}
+
+// The provider responses are decoded into generic maps. These helpers read their fields
+// without panicking on missing fields, nulls or unexpected types.
+
+func mapField(m map[string]interface{}, key string) map[string]interface{} {
+	v, _ := m[key].(map[string]interface{})
+	return v
+}
+
+func sliceField(m map[string]interface{}, key string) []interface{} {
+	v, _ := m[key].([]interface{})
+	return v
+}
+
+func stringField(m map[string]interface{}, key string) string {
+	v, _ := m[key].(string)
+	return v
+}
+
+func intField(m map[string]interface{}, key string) int {
+	v, _ := m[key].(float64)
+	return int(v)
+}
+
+func (c *LLMClient) parseOpenAIResponse(resp map[string]interface{}) (*LLMResponse, error) {
+	choices := sliceField(resp, "choices")
+	if len(choices) == 0 {
+		return nil, fmt.Errorf("no choices in response")
+	}
+	choice, ok := choices[0].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid choice format")
+	}
+	message := mapField(choice, "message")
+	if message == nil {
+		return nil, fmt.Errorf("no message in choice")
+	}
+
+	// content is null when the model only calls tools
 	response := &LLMResponse{
-		Content:      content,
-		Provider:     string(c.provider),
-		Model:        c.config.Model,
-		FinishReason: choice["finish_reason"].(string),
+		Content:  stringField(message, "content"),
+		Provider: string(c.provider),
+		Model:    c.config.Model,
 	}
 
-	// Parse usage if available
-	if usage, ok := resp["usage"].(map[string]interface{}); ok {
+	if usage := mapField(resp, "usage"); usage != nil {
 		response.Usage = &LLMUsage{
-			PromptTokens:     int(usage["prompt_tokens"].(float64)),
-			CompletionTokens: int(usage["completion_tokens"].(float64)),
-			TotalTokens:      int(usage["total_tokens"].(float64)),
+			PromptTokens:     intField(usage, "prompt_tokens"),
+			CompletionTokens: intField(usage, "completion_tokens"),
+			TotalTokens:      intField(usage, "total_tokens"),
 		}
 	}
 
-	// Parse tool calls if available
-	if toolCalls, ok := message["tool_calls"].([]interface{}); ok {
-		for _, tc := range toolCalls {
-			toolCall := tc.(map[string]interface{})
-			function := toolCall["function"].(map[string]interface{})
+	for _, item := range sliceField(message, "tool_calls") {
+		toolCall, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		function := mapField(toolCall, "function")
 
-			var args map[string]interface{}
-			if argsStr, ok := function["arguments"].(string); ok {
-				if err := json.Unmarshal([]byte(argsStr), &args); err != nil {
-					// Log error but continue processing other tool calls
-					continue
-				}
+		var args map[string]interface{}
+		if argsStr := stringField(function, "arguments"); argsStr != "" {
+			if err := json.Unmarshal([]byte(argsStr), &args); err != nil {
+				// Skip tool calls with invalid arguments and keep the others
+				continue
 			}
-
-			response.ToolCalls = append(response.ToolCalls, LLMToolCall{
-				Name:      function["name"].(string),
-				Arguments: args,
-				CallID:    toolCall["id"].(string),
-			})
 		}
+
+		response.ToolCalls = append(response.ToolCalls, LLMToolCall{
+			Name:      stringField(function, "name"),
+			Arguments: args,
+			CallID:    stringField(toolCall, "id"),
+		})
 	}
 
-	return response, nil
+	return finishResponse(response, stringField(choice, "finish_reason"))
 }
 
 func (c *LLMClient) parseAnthropicResponse(resp map[string]interface{}) (*LLMResponse, error) {
-	content, ok := resp["content"].([]interface{})
-	if !ok || len(content) == 0 {
+	stopReason := stringField(resp, "stop_reason")
+	content := sliceField(resp, "content")
+	if len(content) == 0 {
+		if providerFinishReasons[stopReason] == FinishContentFilter {
+			return nil, contentFiltered(c.provider, stopReason)
+		}
 		return nil, fmt.Errorf("no content in response")
 	}
 
-	firstContent := content[0].(map[string]interface{})
-	text := firstContent["text"].(string)
-
 	response := &LLMResponse{
-		Content:      text,
-		Provider:     string(c.provider),
-		Model:        c.config.Model,
-		FinishReason: resp["stop_reason"].(string),
+		Provider: string(c.provider),
+		Model:    c.config.Model,
+	}
+
+	// Responses mix text blocks with the tool_use blocks of tool calls
+	var texts []string
+	for _, item := range content {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid content block format")
+		}
+		switch block["type"] {
+		case "text":
+			if text := stringField(block, "text"); text != "" {
+				texts = append(texts, text)
+			}
+		case "tool_use":
+			response.ToolCalls = append(response.ToolCalls, LLMToolCall{
+				Name:      stringField(block, "name"),
+				Arguments: mapField(block, "input"),
+				CallID:    stringField(block, "id"),
+			})
+		}
 	}
+	response.Content = strings.Join(texts, "\n")
 
-	// Parse usage if available
-	if usage, ok := resp["usage"].(map[string]interface{}); ok {
+	if usage := mapField(resp, "usage"); usage != nil {
 		response.Usage = &LLMUsage{
-			PromptTokens:     int(usage["input_tokens"].(float64)),
-			CompletionTokens: int(usage["output_tokens"].(float64)),
+			PromptTokens:     intField(usage, "input_tokens"),
+			CompletionTokens: intField(usage, "output_tokens"),
 		}
 		response.Usage.TotalTokens = response.Usage.PromptTokens + response.Usage.CompletionTokens
 	}
 
-	return response, nil
+	return finishResponse(response, stopReason)
 }
 
 func (c *LLMClient) parseGeminiResponse(resp map[string]interface{}) (*LLMResponse, error) {
-	candidates, ok := resp["candidates"].([]interface{})
-	if !ok || len(candidates) == 0 {
+	// A blocked prompt has no candidates, only the reason in the prompt feedback
+	candidates := sliceField(resp, "candidates")
+	if len(candidates) == 0 {
+		if reason := stringField(mapField(resp, "promptFeedback"), "blockReason"); reason != "" {
+			return nil, promptBlocked(c.provider, reason)
+		}
 		return nil, fmt.Errorf("no candidates in response")
 	}
 
@@ -469,33 +884,50 @@ func (c *LLMClient) parseGeminiResponse(resp map[string]interface{}) (*LLMRespon
 	if !ok {
 		return nil, fmt.Errorf("invalid candidate format")
 	}
-	content, ok := candidate["content"].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("no content in candidate")
-	}
-	parts, ok := content["parts"].([]interface{})
-	if !ok || len(parts) == 0 {
+	// A candidate blocked by the safety settings has a finish reason but no content
+	finish := stringField(candidate, "finishReason")
+	parts := sliceField(mapField(candidate, "content"), "parts")
+	if len(parts) == 0 {
+		if providerFinishReasons[finish] == FinishContentFilter {
+			return nil, contentFiltered(c.provider, finish)
+		}
 		return nil, fmt.Errorf("no parts in response")
 	}
-	part0, ok := parts[0].(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid part format")
+
+	response := &LLMResponse{
+		Provider: string(c.provider),
+		Model:    c.config.Model,
 	}
-	text, _ := part0["text"].(string)
 
-	finish := ""
-	if fr, ok := candidate["finishReason"].(string); ok {
-		finish = fr
+	// Responses mix text parts with the functionCall parts of tool calls
+	var texts []string
+	for _, item := range parts {
+		part, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid part format")
+		}
+		if text := stringField(part, "text"); text != "" {
+			texts = append(texts, text)
+		}
+		if call := mapField(part, "functionCall"); call != nil {
+			response.ToolCalls = append(response.ToolCalls, LLMToolCall{
+				Name:      stringField(call, "name"),
+				Arguments: mapField(call, "args"),
+				CallID:    stringField(call, "id"),
+			})
+		}
 	}
+	response.Content = strings.Join(texts, "")
 
-	response := &LLMResponse{
-		Content:      text,
-		Provider:     string(c.provider),
-		Model:        c.config.Model,
-		FinishReason: finish,
+	if usage := mapField(resp, "usageMetadata"); usage != nil {
+		response.Usage = &LLMUsage{
+			PromptTokens:     intField(usage, "promptTokenCount"),
+			CompletionTokens: intField(usage, "candidatesTokenCount"),
+			TotalTokens:      intField(usage, "totalTokenCount"),
+		}
 	}
 
-	return response, nil
+	return finishResponse(response, finish)
 }
 
 func (c *LLMClient) testConnection(ctx context.Context) error {
@@ -509,6 +941,21 @@ func (c *LLMClient) testConnection(ctx context.Context) error {
 	return err
 }
 
+// probe sends a one token completion to model, the configured model when empty, checking the
+// key and the model at the least cost
+func (c *LLMClient) probe(ctx context.Context, model string) (*LLMResponse, error) {
+	config := *c.config
+	config.MaxTokens = 1
+	probe := *c
+	probe.config = &config
+	probe.cache = nil
+	return probe.Chat(ctx, &LLMRequest{
+		Prompt:    "Hello, world!",
+		SystemMsg: "You are a helpful assistant. Respond with just 'OK'.",
+		Model:     model,
+	})
+}
+
 func getDefaultConfig(provider LLMProvider) *LLMConfig {
 	switch provider {
 	case OpenAI:
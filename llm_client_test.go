@@ -99,7 +99,7 @@ func TestLLMClient_NewLLMClient(t *testing.T) {
 			// but for now we skip the connection test in unit tests
 
 			if tt.provider != LLMProvider("invalid") {
-				client, err := NewLLMClient(ctx, tt.provider, apiKey)
+				client, err := NewLLMClient(ctx, tt.provider, apiKey, nil)
 				if tt.wantErr {
 					assert.Error(t, err)
 					assert.Nil(t, client)
@@ -225,6 +225,189 @@ func TestLLMClient_ChatWithTools(t *testing.T) {
 	assert.Equal(t, "get_weather", response.ToolCalls[0].Name)
 }
 
+// weatherTool is a tool with a JSON schema using keywords Gemini does not support
+var weatherTool = LLMTool{
+	Name:        "get_weather",
+	Description: "Get current weather",
+	Parameters:  `{"$schema":"http://json-schema.org/draft-07/schema#","type":"object","properties":{"location":{"type":"string"},"days":{"type":"array","items":{"type":"integer"}}},"required":["location"],"additionalProperties":false}`,
+}
+
+// createToolMockServer returns a server answering with response and recording the payload of
+// the last request
+func createToolMockServer(t *testing.T, response string, payload *map[string]interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(payload))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(response))
+	}))
+}
+
+// TestLLMClient_ChatWithTools_Anthropic tests tool calling through Anthropic's tool_use blocks
+func TestLLMClient_ChatWithTools_Anthropic(t *testing.T) {
+	tests := []struct {
+		name        string
+		response    string
+		wantContent string
+	}{
+		{
+			name: "tool call",
+			response: `{
+				"id": "msg_123",
+				"type": "message",
+				"role": "assistant",
+				"content": [{
+					"type": "tool_use",
+					"id": "toolu_01",
+					"name": "get_weather",
+					"input": {"location": "New York City"}
+				}],
+				"stop_reason": "tool_use",
+				"usage": {"input_tokens": 15, "output_tokens": 10}
+			}`,
+		},
+		{
+			name: "text and tool call",
+			response: `{
+				"id": "msg_123",
+				"type": "message",
+				"role": "assistant",
+				"content": [
+					{"type": "text", "text": "Let me check the weather."},
+					{"type": "tool_use", "id": "toolu_01", "name": "get_weather", "input": {"location": "New York City"}}
+				],
+				"stop_reason": "tool_use",
+				"usage": {"input_tokens": 15, "output_tokens": 20}
+			}`,
+			wantContent: "Let me check the weather.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload map[string]interface{}
+			server := createToolMockServer(t, tt.response, &payload)
+			defer server.Close()
+
+			client := createTestClient(Anthropic, server.URL)
+			response, err := client.Chat(context.Background(), &LLMRequest{
+				Prompt: "What's the weather in NYC?",
+				Tools:  []LLMTool{weatherTool},
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantContent, response.Content)
+			assert.Equal(t, FinishToolCalls, response.FinishReason)
+			assert.Equal(t, []LLMToolCall{{
+				Name:      "get_weather",
+				Arguments: map[string]interface{}{"location": "New York City"},
+				CallID:    "toolu_01",
+			}}, response.ToolCalls)
+
+			tools := payload["tools"].([]interface{})
+			require.Len(t, tools, 1)
+			tool := tools[0].(map[string]interface{})
+			assert.Equal(t, "get_weather", tool["name"])
+			assert.Equal(t, "Get current weather", tool["description"])
+			schema := tool["input_schema"].(map[string]interface{})
+			assert.Equal(t, "object", schema["type"])
+			assert.Equal(t, []interface{}{"location"}, schema["required"])
+			assert.Equal(t, map[string]interface{}{"type": "auto"}, payload["tool_choice"])
+		})
+	}
+}
+
+// TestLLMClient_ChatWithTools_Gemini tests tool calling through Gemini's function declarations
+// and functionCall parts
+func TestLLMClient_ChatWithTools_Gemini(t *testing.T) {
+	tests := []struct {
+		name        string
+		response    string
+		wantContent string
+	}{
+		{
+			name: "tool call",
+			response: `{
+				"candidates": [{
+					"content": {
+						"parts": [{"functionCall": {"name": "get_weather", "args": {"location": "New York City"}}}],
+						"role": "model"
+					},
+					"finishReason": "STOP"
+				}]
+			}`,
+		},
+		{
+			name: "text and tool call",
+			response: `{
+				"candidates": [{
+					"content": {
+						"parts": [
+							{"text": "Let me check the weather."},
+							{"functionCall": {"name": "get_weather", "args": {"location": "New York City"}}}
+						],
+						"role": "model"
+					},
+					"finishReason": "STOP"
+				}]
+			}`,
+			wantContent: "Let me check the weather.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload map[string]interface{}
+			server := createToolMockServer(t, tt.response, &payload)
+			defer server.Close()
+
+			client := createTestClient(Gemini, server.URL)
+			response, err := client.Chat(context.Background(), &LLMRequest{
+				Prompt: "What's the weather in NYC?",
+				Tools:  []LLMTool{weatherTool, {Name: "list_cities", Description: "List the known cities"}},
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantContent, response.Content)
+			assert.Equal(t, []LLMToolCall{{
+				Name:      "get_weather",
+				Arguments: map[string]interface{}{"location": "New York City"},
+			}}, response.ToolCalls)
+
+			tools := payload["tools"].([]interface{})
+			require.Len(t, tools, 1)
+			declarations := tools[0].(map[string]interface{})["functionDeclarations"].([]interface{})
+			require.Len(t, declarations, 2)
+			assert.Equal(t, map[string]interface{}{
+				"name":        "get_weather",
+				"description": "Get current weather",
+				"parameters": map[string]interface{}{
+					"type": "OBJECT",
+					"properties": map[string]interface{}{
+						"location": map[string]interface{}{"type": "STRING"},
+						"days":     map[string]interface{}{"type": "ARRAY", "items": map[string]interface{}{"type": "INTEGER"}},
+					},
+					"required": []interface{}{"location"},
+				},
+			}, declarations[0])
+			assert.Equal(t, map[string]interface{}{"name": "list_cities", "description": "List the known cities"}, declarations[1],
+				"tools without parameters declare none")
+		})
+	}
+}
+
+// TestLLMClient_ChatWithTools_InvalidSchema tests that tools with an invalid parameters schema
+// are rejected before the request is sent
+func TestLLMClient_ChatWithTools_InvalidSchema(t *testing.T) {
+	for _, provider := range []LLMProvider{Anthropic, Gemini} {
+		client := createTestClient(provider, "http://127.0.0.1:0")
+		_, err := client.Chat(context.Background(), &LLMRequest{
+			Prompt: "What's the weather in NYC?",
+			Tools:  []LLMTool{{Name: "get_weather", Parameters: `{"type":`}},
+		})
+		assert.ErrorContains(t, err, "invalid parameters schema for tool get_weather", string(provider))
+	}
+}
+
 // TestLLMClient_ErrorHandling tests various error scenarios
 func TestLLMClient_ErrorHandling(t *testing.T) {
 	tests := []struct {
@@ -501,7 +684,7 @@ func createTestClient(provider LLMProvider, baseURL string) *LLMClient {
 		provider:   provider,
 		apiKey:     "test-api-key",
 		baseURL:    baseURL,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+		httpClient: &http.Client{},
 		logger:     logrus.New(),
 		config:     getDefaultConfig(provider),
 	}
@@ -667,6 +850,55 @@ func TestLLMClient_ContextCancel_Extended(t *testing.T) {
 	assert.Contains(t, strings.ToLower(err.Error()), "context")
 }
 
+// TestLLMClient_RequestTimeout tests that a request is bounded by the deadline of its
+// context, falling back to the configured timeout when the context has none
+func TestLLMClient_RequestTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(mockResponses[OpenAI]))
+	}))
+	defer srv.Close()
+
+	t.Run("context deadline before timeout", func(t *testing.T) {
+		client := createTestClient(OpenAI, srv.URL).WithTimeout(time.Minute)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		_, err := client.Chat(ctx, &LLMRequest{Prompt: "hello"})
+		assert.ErrorIs(t, err, ErrLLMTimeout)
+		assert.Equal(t, ErrorCategoryTimeout, errorCategory(err))
+		assert.Less(t, time.Since(start), 150*time.Millisecond, "the request must not outlive its context")
+	})
+
+	t.Run("context deadline after timeout", func(t *testing.T) {
+		client := createTestClient(OpenAI, srv.URL).WithTimeout(50 * time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		response, err := client.Chat(ctx, &LLMRequest{Prompt: "hello"})
+		require.NoError(t, err, "the caller's deadline governs over the configured timeout")
+		assert.NotEmpty(t, response.Content)
+	})
+
+	t.Run("configured timeout without deadline", func(t *testing.T) {
+		client := createTestClient(OpenAI, srv.URL).WithTimeout(20 * time.Millisecond)
+		client.config.RetryCount = 0
+
+		_, err := client.Chat(context.Background(), &LLMRequest{Prompt: "hello"})
+		assert.ErrorIs(t, err, ErrLLMTimeout)
+
+		client.WithTimeout(time.Second)
+		_, err = client.Chat(context.Background(), &LLMRequest{Prompt: "hello"})
+		assert.NoError(t, err)
+	})
+}
+
 // TestLLMClient_InvalidInputs_Extended checks behavior with invalid baseURL and empty prompt.
 func TestLLMClient_InvalidInputs_Extended(t *testing.T) {
 	client := &LLMClient{
@@ -742,3 +974,159 @@ func TestLLMClient_ParseOpenAI_ToolCalls_Extended(t *testing.T) {
 	require.Len(t, res.ToolCalls, 1)
 	assert.Equal(t, "get_weather", res.ToolCalls[0].Name)
 }
+
+// TestLLMClient_ParseFinishReasons tests normalizing the finish reasons of the providers and
+// parsing responses with null or missing fields
+func TestLLMClient_ParseFinishReasons(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  LLMProvider
+		response  string
+		want      FinishReason
+		wantRaw   string
+		wantUsage *LLMUsage
+		wantCalls int
+	}{
+		{
+			name:      "openai tool call with null content",
+			provider:  OpenAI,
+			response:  `{"choices": [{"message": {"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"location\": \"NYC\"}"}}]}, "finish_reason": "tool_calls"}], "usage": {"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5}}`,
+			want:      FinishToolCalls,
+			wantRaw:   "tool_calls",
+			wantUsage: &LLMUsage{PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5},
+			wantCalls: 1,
+		},
+		{
+			name:     "openai without finish reason and usage",
+			provider: OpenAI,
+			response: `{"choices": [{"message": {"content": "Hello"}}]}`,
+			want:     FinishStop,
+		},
+		{
+			name:      "openai length with partial usage",
+			provider:  OpenAI,
+			response:  `{"choices": [{"message": {"content": "Hel"}, "finish_reason": "length"}], "usage": {"prompt_tokens": 3}}`,
+			want:      FinishLength,
+			wantRaw:   "length",
+			wantUsage: &LLMUsage{PromptTokens: 3},
+		},
+		{
+			name:     "anthropic max tokens without usage",
+			provider: Anthropic,
+			response: `{"content": [{"type": "text", "text": "Hel"}], "stop_reason": "max_tokens"}`,
+			want:     FinishLength,
+			wantRaw:  "max_tokens",
+		},
+		{
+			name:      "anthropic end turn",
+			provider:  Anthropic,
+			response:  `{"content": [{"type": "text", "text": "Hello"}], "stop_reason": "end_turn", "usage": {"input_tokens": 4, "output_tokens": 1}}`,
+			want:      FinishStop,
+			wantRaw:   "end_turn",
+			wantUsage: &LLMUsage{PromptTokens: 4, CompletionTokens: 1, TotalTokens: 5},
+		},
+		{
+			name:      "gemini function call reported as STOP",
+			provider:  Gemini,
+			response:  `{"candidates": [{"content": {"parts": [{"functionCall": {"name": "get_weather", "args": {"location": "NYC"}}}]}, "finishReason": "STOP"}], "usageMetadata": {"promptTokenCount": 6, "candidatesTokenCount": 2, "totalTokenCount": 8}}`,
+			want:      FinishToolCalls,
+			wantRaw:   "STOP",
+			wantUsage: &LLMUsage{PromptTokens: 6, CompletionTokens: 2, TotalTokens: 8},
+			wantCalls: 1,
+		},
+		{
+			name:     "gemini malformed function call",
+			provider: Gemini,
+			response: `{"candidates": [{"content": {"parts": [{"text": "Hello"}]}, "finishReason": "MALFORMED_FUNCTION_CALL"}]}`,
+			want:     FinishError,
+			wantRaw:  "MALFORMED_FUNCTION_CALL",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload map[string]interface{}
+			server := createToolMockServer(t, tt.response, &payload)
+			defer server.Close()
+
+			response, err := createTestClient(tt.provider, server.URL).Chat(context.Background(), &LLMRequest{Prompt: "Hello"})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, response.FinishReason)
+			if tt.wantRaw != "" {
+				assert.Equal(t, tt.wantRaw, response.Metadata["provider_finish_reason"])
+			} else {
+				assert.NotContains(t, response.Metadata, "provider_finish_reason")
+			}
+			assert.Equal(t, tt.wantUsage, response.Usage)
+			assert.Len(t, response.ToolCalls, tt.wantCalls)
+		})
+	}
+}
+
+// TestLLMClient_ContentFiltered tests that responses blocked by a provider's content filter
+// are reported as ErrLLMContentFiltered with the block reason
+func TestLLMClient_ContentFiltered(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider LLMProvider
+		response string
+		wantErr  string
+	}{
+		{
+			name:     "gemini safety block",
+			provider: Gemini,
+			response: `{"candidates": [{"finishReason": "SAFETY", "index": 0, "safetyRatings": [{"category": "HARM_CATEGORY_DANGEROUS_CONTENT", "probability": "HIGH"}]}]}`,
+			wantErr:  "gemini stopped with SAFETY",
+		},
+		{
+			name:     "gemini blocked prompt",
+			provider: Gemini,
+			response: `{"promptFeedback": {"blockReason": "PROHIBITED_CONTENT"}}`,
+			wantErr:  "gemini blocked the prompt with PROHIBITED_CONTENT",
+		},
+		{
+			name:     "openai content filter",
+			provider: OpenAI,
+			response: `{"choices": [{"message": {"content": null}, "finish_reason": "content_filter"}]}`,
+			wantErr:  "openai stopped with content_filter",
+		},
+		{
+			name:     "anthropic refusal",
+			provider: Anthropic,
+			response: `{"content": [], "stop_reason": "refusal"}`,
+			wantErr:  "anthropic stopped with refusal",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload map[string]interface{}
+			server := createToolMockServer(t, tt.response, &payload)
+			defer server.Close()
+
+			response, err := createTestClient(tt.provider, server.URL).Chat(context.Background(), &LLMRequest{Prompt: "Hello"})
+			assert.Nil(t, response)
+			assert.ErrorIs(t, err, ErrLLMContentFiltered)
+			assert.NotErrorIs(t, err, ErrLLMInvalidResponse)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+// TestLLMClient_RequestModel tests that a request's model overrides the configured model in
+// the payload and the response
+func TestLLMClient_RequestModel(t *testing.T) {
+	var payload map[string]interface{}
+	server := createToolMockServer(t, mockResponses[OpenAI], &payload)
+	defer server.Close()
+
+	client := createTestClient(OpenAI, server.URL)
+	response, err := client.Chat(context.Background(), &LLMRequest{Prompt: "Hello", Model: "gpt-4o-mini"})
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini", payload["model"])
+	assert.Equal(t, "gpt-4o-mini", response.Model)
+
+	response, err = client.Chat(context.Background(), &LLMRequest{Prompt: "Hello"})
+	require.NoError(t, err)
+	assert.Equal(t, client.config.Model, response.Model)
+}
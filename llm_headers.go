@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Headers of OpenAI's billing attribution, also forwarded by OpenAI-compatible gateways
+const (
+	headerOpenAIOrganization = "OpenAI-Organization"
+	headerOpenAIProject      = "OpenAI-Project"
+)
+
+// RedactionLLMHeader marks sensitive extra header values in logs
+const RedactionLLMHeader = "llm_header"
+
+// protectedLLMHeaders carry the API key of a provider, so extra headers may not set them
+var protectedLLMHeaders = []string{"Authorization", "X-Api-Key", "X-Goog-Api-Key"}
+
+// headerName matches the token characters HTTP allows in header names
+var headerName = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// sensitiveHeaderWords mark header names whose values are credentials
+var sensitiveHeaderWords = []string{"auth", "key", "token", "secret", "password", "cookie", "signature", "credential"}
+
+// LLMHeader is an extra HTTP header sent with every LLM request, e.g. for a gateway
+type LLMHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// validateLLMHeaders rejects header names HTTP does not allow, values spanning lines, and
+// headers overriding the provider's authentication
+func validateLLMHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if !headerName.MatchString(name) {
+			return fmt.Errorf("invalid LLM header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("LLM header %s must not span lines", name)
+		}
+		if slices.Contains(protectedLLMHeaders, http.CanonicalHeaderKey(name)) {
+			return fmt.Errorf("LLM header %s is set from the API key and cannot be overridden", name)
+		}
+	}
+	return nil
+}
+
+// parseLLMHeader parses a header given as "Name: value"
+func parseLLMHeader(header string) (LLMHeader, error) {
+	name, value, ok := strings.Cut(header, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return LLMHeader{}, fmt.Errorf("invalid LLM header %q, expected Name: value", header)
+	}
+	return LLMHeader{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)}, nil
+}
+
+// llmHeaderMap returns headers as a map, later headers replacing earlier ones of the same name
+func llmHeaderMap(headers []LLMHeader) map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(headers))
+	for _, header := range headers {
+		m[http.CanonicalHeaderKey(header.Name)] = header.Value
+	}
+	return m
+}
+
+// sensitiveLLMHeader reports whether the value of a header is likely a credential
+func sensitiveLLMHeader(name string) bool {
+	name = strings.ToLower(name)
+	for _, word := range sensitiveHeaderWords {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactedLLMHeaders lists headers as "Name: value" for logs, masking sensitive values
+func redactedLLMHeaders(headers map[string]string) []string {
+	list := make([]string, 0, len(headers))
+	for name, value := range headers {
+		if sensitiveLLMHeader(name) {
+			value = redactionMarker(RedactionLLMHeader)
+		}
+		list = append(list, name+": "+value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// WithExtraHeaders sends headers with every request to the provider, in addition to its
+// authentication and content headers, which they may not override
+func (c *LLMClient) WithExtraHeaders(headers map[string]string) (*LLMClient, error) {
+	if err := validateLLMHeaders(headers); err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		c.setExtraHeader(name, value)
+	}
+	if len(headers) > 0 && c.logger != nil {
+		c.logger.WithField("headers", redactedLLMHeaders(headers)).Debug("Sending extra headers with LLM requests")
+	}
+	return c, nil
+}
+
+// WithOpenAIOrganization attributes requests to an OpenAI organization
+func (c *LLMClient) WithOpenAIOrganization(org string) *LLMClient {
+	c.setExtraHeader(headerOpenAIOrganization, org)
+	return c
+}
+
+// WithOpenAIProject attributes requests to an OpenAI project
+func (c *LLMClient) WithOpenAIProject(project string) *LLMClient {
+	c.setExtraHeader(headerOpenAIProject, project)
+	return c
+}
+
+// setExtraHeader adds a header to a copy of the extra headers, so copies of the client made
+// before keep theirs
+func (c *LLMClient) setExtraHeader(name, value string) {
+	headers := make(map[string]string, len(c.headers)+1)
+	for k, v := range c.headers {
+		headers[k] = v
+	}
+	headers[http.CanonicalHeaderKey(name)] = value
+	c.headers = headers
+}
+
+// llmHeadersContextKey carries the extra headers of LLM clients created under a context
+type llmHeadersContextKey struct{}
+
+// withLLMHeaders makes LLM clients created under ctx send headers, starting with their
+// connection test
+func withLLMHeaders(ctx context.Context, headers map[string]string) context.Context {
+	if len(headers) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, llmHeadersContextKey{}, headers)
+}
+
+// contextLLMHeaders returns the extra headers of LLM clients created under ctx
+func contextLLMHeaders(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(llmHeadersContextKey{}).(map[string]string)
+	return headers
+}
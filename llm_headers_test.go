@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// headerRecordingServer answers like provider and records the headers of the last request
+func headerRecordingServer(t *testing.T, provider LLMProvider, headers *http.Header) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*headers = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(mockResponses[provider]))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestLLMClientExtraHeaders tests that extra headers and OpenAI's organization and project
+// arrive with requests, next to the provider's own headers
+func TestLLMClientExtraHeaders(t *testing.T) {
+	var received http.Header
+	server := headerRecordingServer(t, OpenAI, &received)
+
+	client, err := createTestClient(OpenAI, server.URL).WithExtraHeaders(map[string]string{
+		"X-Org-Id":         "acme",
+		"x-request-source": "autofix",
+	})
+	require.NoError(t, err)
+	client = client.WithOpenAIOrganization("org-acme").WithOpenAIProject("proj_ci")
+	client.logger = quietLogger()
+
+	_, err = client.Chat(context.Background(), &LLMRequest{Prompt: "Analyze this failure"})
+	require.NoError(t, err)
+	assert.Equal(t, "acme", received.Get("X-Org-Id"))
+	assert.Equal(t, "autofix", received.Get("X-Request-Source"))
+	assert.Equal(t, "org-acme", received.Get("OpenAI-Organization"))
+	assert.Equal(t, "proj_ci", received.Get("OpenAI-Project"))
+	assert.Equal(t, "Bearer test-api-key", received.Get("Authorization"))
+	assert.Equal(t, "application/json", received.Get("Content-Type"))
+
+	t.Run("Anthropic", func(t *testing.T) {
+		var received http.Header
+		server := headerRecordingServer(t, Anthropic, &received)
+		client, err := createTestClient(Anthropic, server.URL).WithExtraHeaders(map[string]string{"X-Org-Id": "acme"})
+		require.NoError(t, err)
+		client.logger = quietLogger()
+
+		_, err = client.Chat(context.Background(), &LLMRequest{Prompt: "Analyze this failure"})
+		require.NoError(t, err)
+		assert.Equal(t, "acme", received.Get("X-Org-Id"))
+		assert.Equal(t, "test-api-key", received.Get("X-Api-Key"))
+	})
+}
+
+// TestLLMClientExtraHeadersRejected tests that extra headers cannot replace the API key or
+// smuggle in malformed headers
+func TestLLMClientExtraHeadersRejected(t *testing.T) {
+	for name, value := range map[string]string{
+		"Authorization":  "Bearer sk-other",
+		"x-api-key":      "other",
+		"X-Goog-Api-Key": "other",
+	} {
+		client := createTestClient(OpenAI, "http://localhost")
+		_, err := client.WithExtraHeaders(map[string]string{name: value})
+		assert.ErrorContains(t, err, "is set from the API key and cannot be overridden", name)
+		assert.Empty(t, client.headers, name)
+	}
+
+	_, err := createTestClient(OpenAI, "http://localhost").WithExtraHeaders(map[string]string{"X Org": "acme"})
+	assert.EqualError(t, err, `invalid LLM header name "X Org"`)
+	_, err = createTestClient(OpenAI, "http://localhost").WithExtraHeaders(map[string]string{"X-Org-Id": "acme\r\nAuthorization: Bearer sk-other"})
+	assert.EqualError(t, err, "LLM header X-Org-Id must not span lines")
+
+	m := New().WithLLMHeader("Authorization", "Bearer sk-other")
+	assert.ErrorContains(t, m.validateLLMConfiguration(), "cannot be overridden")
+}
+
+// TestLLMHeadersContext tests the headers withLLMHeaders passes to new clients, and that
+// copies of a client made before more headers are added keep theirs
+func TestLLMHeadersContext(t *testing.T) {
+	headers := map[string]string{"X-Org-Id": "acme"}
+	assert.Equal(t, headers, contextLLMHeaders(withLLMHeaders(context.Background(), headers)))
+	assert.Nil(t, contextLLMHeaders(withLLMHeaders(context.Background(), nil)))
+
+	client, err := createTestClient(OpenAI, "http://localhost").WithExtraHeaders(headers)
+	require.NoError(t, err)
+	probe := *client
+	client.WithOpenAIProject("proj_ci")
+	assert.Equal(t, map[string]string{"X-Org-Id": "acme"}, probe.headers)
+	assert.Equal(t, map[string]string{"X-Org-Id": "acme", "Openai-Project": "proj_ci"}, client.headers)
+}
+
+// TestRedactedLLMHeaders tests that header values that look like credentials are masked in logs
+func TestRedactedLLMHeaders(t *testing.T) {
+	assert.Equal(t, []string{
+		"X-Gateway-Token: [REDACTED:llm_header]",
+		"X-Org-Id: acme",
+		"X-Proxy-Authorization: [REDACTED:llm_header]",
+	}, redactedLLMHeaders(map[string]string{
+		"X-Org-Id":              "acme",
+		"X-Gateway-Token":       "gw-0123456789",
+		"X-Proxy-Authorization": "Basic YWNtZTpzZWNyZXQ=",
+	}))
+
+	header, err := parseLLMHeader("X-Org-Id:  acme ")
+	require.NoError(t, err)
+	assert.Equal(t, LLMHeader{Name: "X-Org-Id", Value: "acme"}, header)
+	_, err = parseLLMHeader("X-Org-Id")
+	assert.EqualError(t, err, `invalid LLM header "X-Org-Id", expected Name: value`)
+}
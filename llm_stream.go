@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// LLMStreamer is implemented by LLM clients that can stream their responses
+type LLMStreamer interface {
+	ChatStream(ctx context.Context, req *LLMRequest, onDelta func(string)) (*LLMResponse, error)
+}
+
+// ChatStream sends a chat request with the response streamed, calling onDelta with each piece
+// of text as it arrives, and returns the complete response as Chat would. The client timeout
+// bounds how long the stream may go without data rather than the whole response, so long
+// generations are not cut off. Without onDelta it is Chat.
+func (c *LLMClient) ChatStream(ctx context.Context, request *LLMRequest, onDelta func(string)) (*LLMResponse, error) {
+	return c.chat(ctx, request, onDelta)
+}
+
+// streamParser accumulates the server-sent events of a provider's response stream
+type streamParser interface {
+	// event handles one event, returning the text it adds and whether the stream is complete
+	event(name string, data []byte) (delta string, done bool, err error)
+	// result returns the response read from the stream, or an error when it ended early
+	result() (*LLMResponse, error)
+}
+
+// stream sends a streaming chat request to the provider
+func (c *LLMClient) stream(ctx context.Context, request *LLMRequest, onDelta func(string)) (*LLMResponse, error) {
+	response := &LLMResponse{Provider: string(c.provider), Model: c.requestModel(request)}
+	switch c.provider {
+	case OpenAI, DeepSeek, LiteLLM:
+		payload := c.openAIPayload(request)
+		payload["stream"] = true
+		payload["stream_options"] = map[string]interface{}{"include_usage": true}
+		return c.streamRequest(ctx, "/v1/chat/completions", payload, &openAIStream{response: response}, onDelta)
+	case Anthropic:
+		payload, err := c.anthropicPayload(request)
+		if err != nil {
+			return nil, err
+		}
+		payload["stream"] = true
+		return c.streamRequest(ctx, "/v1/messages", payload, &anthropicStream{response: response}, onDelta)
+	case Gemini:
+		payload, err := c.geminiPayload(request)
+		if err != nil {
+			return nil, err
+		}
+		path := fmt.Sprintf("/v1beta/models/%s:streamGenerateContent?alt=sse", c.requestModel(request))
+		return c.streamRequest(ctx, path, payload, &geminiStream{response: response}, onDelta)
+	default:
+		return nil, fmt.Errorf("unsupported provider: %s", c.provider)
+	}
+}
+
+// streamRequest posts payload and reads the response stream into parser. Transient server
+// errors before the stream starts are retried; errors in the stream are not, as its text
+// already reached onDelta.
+func (c *LLMClient) streamRequest(ctx context.Context, path string, payload map[string]interface{}, parser streamParser, onDelta func(string)) (*LLMResponse, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	// The idle timer replaces the client's total timeout
+	client := *c.httpClient
+	client.Timeout = 0
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var idle atomic.Bool
+	resetIdle := func() {}
+	if c.config.Timeout > 0 {
+		timer := time.AfterFunc(c.config.Timeout, func() {
+			idle.Store(true)
+			cancel()
+		})
+		defer timer.Stop()
+		resetIdle = func() { timer.Reset(c.config.Timeout) }
+	}
+	idleErr := func(err error) error {
+		if idle.Load() {
+			return fmt.Errorf("%w: LLM stream received no data for %s", ErrLLMTimeout, c.config.Timeout)
+		}
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		c.setHeaders(req)
+		req.Header.Set("Accept", "text/event-stream")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("request failed: %w", idleErr(err))
+		}
+		if resp.StatusCode >= 400 {
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode >= 500 && attempt < c.config.RetryCount {
+				// retry on transient server errors
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return nil, classifyLLMError(resp.StatusCode, fmt.Errorf("API error %d: %s", resp.StatusCode, string(respBody)))
+		}
+
+		err = readServerSentEvents(resp.Body, resetIdle, func(name string, data []byte) (bool, error) {
+			delta, done, err := parser.event(name, data)
+			if delta != "" {
+				onDelta(delta)
+			}
+			return done, err
+		})
+		resp.Body.Close()
+		if err != nil {
+			return nil, idleErr(err)
+		}
+		return parser.result()
+	}
+}
+
+// readServerSentEvents calls handle with the name and data of each event read from r until it
+// reports the stream complete or r ends. read is called for each line, to track idle time.
+func readServerSentEvents(r io.Reader, read func(), handle func(name string, data []byte) (bool, error)) error {
+	reader := bufio.NewReader(r)
+	var name string
+	var data [][]byte
+	dispatch := func() (bool, error) {
+		if len(data) == 0 {
+			name = ""
+			return false, nil
+		}
+		done, err := handle(name, bytes.Join(data, []byte("\n")))
+		name, data = "", nil
+		return done, err
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			read()
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 && err == nil {
+			if done, err := dispatch(); done || err != nil {
+				return err
+			}
+			continue
+		}
+		switch field, value, _ := bytes.Cut(line, []byte(":")); string(field) {
+		case "event":
+			name = string(bytes.TrimSpace(value))
+		case "data":
+			data = append(data, bytes.TrimPrefix(value, []byte(" ")))
+		}
+		if errors.Is(err, io.EOF) {
+			_, err := dispatch()
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read response stream: %w", err)
+		}
+	}
+}
+
+// streamError returns the error a stream event reports in its error object
+func streamError(message string) error {
+	return fmt.Errorf("LLM stream failed: %s", message)
+}
+
+// streamEndedEarly is returned for streams that end before the response is complete
+func streamEndedEarly(provider LLMProvider) error {
+	return fmt.Errorf("%w: %s response stream ended before the response was complete", ErrLLMInvalidResponse, provider)
+}
+
+// invalidStreamEvent wraps errors decoding stream events
+func invalidStreamEvent(err error) error {
+	return fmt.Errorf("%w: failed to decode stream event: %w", ErrLLMInvalidResponse, err)
+}
+
+// streamToolCall is a tool call whose arguments arrive in pieces
+type streamToolCall struct {
+	index     int
+	name      string
+	id        string
+	arguments strings.Builder
+	input     map[string]interface{}
+}
+
+// toolCalls returns the tool calls of a stream in the order of their index, skipping those
+// whose arguments are not valid JSON like the non-streaming parsers
+func toolCalls(calls map[int]*streamToolCall) []LLMToolCall {
+	ordered := make([]*streamToolCall, 0, len(calls))
+	for _, call := range calls {
+		ordered = append(ordered, call)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].index < ordered[j].index })
+
+	var result []LLMToolCall
+	for _, call := range ordered {
+		args := call.input
+		if call.arguments.Len() > 0 {
+			if err := json.Unmarshal([]byte(call.arguments.String()), &args); err != nil {
+				continue
+			}
+		}
+		result = append(result, LLMToolCall{Name: call.name, Arguments: args, CallID: call.id})
+	}
+	return result
+}
+
+// openAIStream reads the chat completion chunks of the OpenAI compatible providers, which
+// end with a [DONE] event
+type openAIStream struct {
+	response *LLMResponse
+	content  strings.Builder
+	calls    map[int]*streamToolCall
+	reason   string
+	done     bool
+}
+
+func (s *openAIStream) event(name string, data []byte) (string, bool, error) {
+	if string(bytes.TrimSpace(data)) == "[DONE]" {
+		s.done = true
+		return "", true, nil
+	}
+	var chunk struct {
+		Choices []struct {
+			Delta struct {
+				Content   string `json:"content"`
+				ToolCalls []struct {
+					Index    int    `json:"index"`
+					ID       string `json:"id"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"delta"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *LLMUsage `json:"usage"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return "", false, invalidStreamEvent(err)
+	}
+	if chunk.Error != nil {
+		return "", false, streamError(chunk.Error.Message)
+	}
+	if chunk.Usage != nil {
+		s.response.Usage = chunk.Usage
+	}
+
+	var delta string
+	for _, choice := range chunk.Choices {
+		delta += choice.Delta.Content
+		if choice.FinishReason != "" {
+			s.reason = choice.FinishReason
+		}
+		for _, tc := range choice.Delta.ToolCalls {
+			if s.calls == nil {
+				s.calls = make(map[int]*streamToolCall)
+			}
+			call, ok := s.calls[tc.Index]
+			if !ok {
+				call = &streamToolCall{index: tc.Index}
+				s.calls[tc.Index] = call
+			}
+			if tc.ID != "" {
+				call.id = tc.ID
+			}
+			if tc.Function.Name != "" {
+				call.name = tc.Function.Name
+			}
+			call.arguments.WriteString(tc.Function.Arguments)
+		}
+	}
+	s.content.WriteString(delta)
+	return delta, false, nil
+}
+
+func (s *openAIStream) result() (*LLMResponse, error) {
+	if !s.done {
+		return nil, streamEndedEarly(LLMProvider(s.response.Provider))
+	}
+	s.response.Content = s.content.String()
+	s.response.ToolCalls = toolCalls(s.calls)
+	return finishResponse(s.response, s.reason)
+}
+
+// anthropicStream reads the Messages API event stream, which ends with a message_stop event.
+// Text blocks are joined by newlines like in non-streaming responses.
+type anthropicStream struct {
+	response *LLMResponse
+	content  strings.Builder
+	calls    map[int]*streamToolCall
+	reason   string
+	done     bool
+}
+
+func (s *anthropicStream) event(name string, data []byte) (string, bool, error) {
+	var event struct {
+		Type    string `json:"type"`
+		Index   int    `json:"index"`
+		Message struct {
+			Usage struct {
+				InputTokens int `json:"input_tokens"`
+			} `json:"usage"`
+		} `json:"message"`
+		ContentBlock struct {
+			Type  string                 `json:"type"`
+			ID    string                 `json:"id"`
+			Name  string                 `json:"name"`
+			Text  string                 `json:"text"`
+			Input map[string]interface{} `json:"input"`
+		} `json:"content_block"`
+		Delta struct {
+			Type        string `json:"type"`
+			Text        string `json:"text"`
+			PartialJSON string `json:"partial_json"`
+			StopReason  string `json:"stop_reason"`
+		} `json:"delta"`
+		Usage struct {
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return "", false, invalidStreamEvent(err)
+	}
+	if event.Type == "" {
+		event.Type = name
+	}
+
+	switch event.Type {
+	case "message_start":
+		s.usage().PromptTokens = event.Message.Usage.InputTokens
+	case "content_block_start":
+		switch event.ContentBlock.Type {
+		case "text":
+			return s.addText(event.ContentBlock.Text, true), false, nil
+		case "tool_use":
+			if s.calls == nil {
+				s.calls = make(map[int]*streamToolCall)
+			}
+			s.calls[event.Index] = &streamToolCall{
+				index: event.Index,
+				name:  event.ContentBlock.Name,
+				id:    event.ContentBlock.ID,
+				input: event.ContentBlock.Input,
+			}
+		}
+	case "content_block_delta":
+		switch event.Delta.Type {
+		case "text_delta":
+			return s.addText(event.Delta.Text, false), false, nil
+		case "input_json_delta":
+			if call, ok := s.calls[event.Index]; ok {
+				call.arguments.WriteString(event.Delta.PartialJSON)
+			}
+		}
+	case "message_delta":
+		if event.Delta.StopReason != "" {
+			s.reason = event.Delta.StopReason
+		}
+		s.usage().CompletionTokens = event.Usage.OutputTokens
+	case "message_stop":
+		s.done = true
+		return "", true, nil
+	case "error":
+		if event.Error.Type == "rate_limit_error" {
+			return "", false, fmt.Errorf("%w: %w", ErrLLMRateLimited, streamError(event.Error.Message))
+		}
+		return "", false, streamError(event.Error.Message)
+	}
+	return "", false, nil
+}
+
+// addText adds text to the response, separating a new text block from the text before it
+func (s *anthropicStream) addText(text string, newBlock bool) string {
+	if newBlock && s.content.Len() > 0 {
+		text = "\n" + text
+	}
+	s.content.WriteString(text)
+	return text
+}
+
+func (s *anthropicStream) usage() *LLMUsage {
+	if s.response.Usage == nil {
+		s.response.Usage = &LLMUsage{}
+	}
+	return s.response.Usage
+}
+
+func (s *anthropicStream) result() (*LLMResponse, error) {
+	if !s.done {
+		return nil, streamEndedEarly(LLMProvider(s.response.Provider))
+	}
+	if s.response.Usage != nil {
+		s.response.Usage.TotalTokens = s.response.Usage.PromptTokens + s.response.Usage.CompletionTokens
+	}
+	s.response.Content = s.content.String()
+	s.response.ToolCalls = toolCalls(s.calls)
+	return finishResponse(s.response, s.reason)
+}
+
+// geminiStream reads the responses of streamGenerateContent. The stream has no end marker,
+// so it is complete once a candidate reports its finish reason.
+type geminiStream struct {
+	response *LLMResponse
+	content  strings.Builder
+	calls    map[int]*streamToolCall
+	reason   string
+}
+
+func (s *geminiStream) event(name string, data []byte) (string, bool, error) {
+	var chunk struct {
+		Candidates []struct {
+			Content struct {
+				Parts []struct {
+					Text         string `json:"text"`
+					FunctionCall *struct {
+						ID   string                 `json:"id"`
+						Name string                 `json:"name"`
+						Args map[string]interface{} `json:"args"`
+					} `json:"functionCall"`
+				} `json:"parts"`
+			} `json:"content"`
+			FinishReason string `json:"finishReason"`
+		} `json:"candidates"`
+		PromptFeedback struct {
+			BlockReason string `json:"blockReason"`
+		} `json:"promptFeedback"`
+		UsageMetadata *struct {
+			PromptTokenCount     int `json:"promptTokenCount"`
+			CandidatesTokenCount int `json:"candidatesTokenCount"`
+			TotalTokenCount      int `json:"totalTokenCount"`
+		} `json:"usageMetadata"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return "", false, invalidStreamEvent(err)
+	}
+	if chunk.Error != nil {
+		return "", false, streamError(chunk.Error.Message)
+	}
+	if reason := chunk.PromptFeedback.BlockReason; reason != "" {
+		return "", false, promptBlocked(LLMProvider(s.response.Provider), reason)
+	}
+	if usage := chunk.UsageMetadata; usage != nil {
+		s.response.Usage = &LLMUsage{
+			PromptTokens:     usage.PromptTokenCount,
+			CompletionTokens: usage.CandidatesTokenCount,
+			TotalTokens:      usage.TotalTokenCount,
+		}
+	}
+	if len(chunk.Candidates) == 0 {
+		return "", false, nil
+	}
+
+	candidate := chunk.Candidates[0]
+	var delta string
+	for _, part := range candidate.Content.Parts {
+		delta += part.Text
+		if call := part.FunctionCall; call != nil {
+			if s.calls == nil {
+				s.calls = make(map[int]*streamToolCall)
+			}
+			index := len(s.calls)
+			s.calls[index] = &streamToolCall{index: index, name: call.Name, id: call.ID, input: call.Args}
+		}
+	}
+	if candidate.FinishReason != "" {
+		s.reason = candidate.FinishReason
+	}
+	s.content.WriteString(delta)
+	return delta, false, nil
+}
+
+func (s *geminiStream) result() (*LLMResponse, error) {
+	if s.reason == "" {
+		return nil, streamEndedEarly(LLMProvider(s.response.Provider))
+	}
+	s.response.Content = s.content.String()
+	s.response.ToolCalls = toolCalls(s.calls)
+	return finishResponse(s.response, s.reason)
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createSSEServer returns a server writing events to each request as a server-sent event
+// stream, flushing after each and sleeping pause between them. The payload of the last
+// request is recorded.
+func createSSEServer(t *testing.T, events []string, pause time.Duration, payload *map[string]interface{}) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if payload != nil {
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(payload))
+			(*payload)["path"] = r.URL.Path
+			(*payload)["query"] = r.URL.RawQuery
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			fmt.Fprint(w, event)
+			w.(http.Flusher).Flush()
+			time.Sleep(pause)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// chatStream streams a request through client, returning the deltas it received
+func chatStream(client *LLMClient, request *LLMRequest) (*LLMResponse, []string, error) {
+	var deltas []string
+	response, err := client.ChatStream(context.Background(), request, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	return response, deltas, err
+}
+
+// TestLLMClient_ChatStream_OpenAI tests streaming chat completion chunks and tool call deltas
+func TestLLMClient_ChatStream_OpenAI(t *testing.T) {
+	var payload map[string]interface{}
+	server := createSSEServer(t, []string{
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"\"}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hello\"}}]}\n\n",
+		": keep-alive\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\" world\"}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"function\":{\"name\":\"get_weather\",\"arguments\":\"{\\\"loc\"}}]}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":\"ation\\\":\\\"NYC\\\"}\"}}]}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"tool_calls\"}]}\n\n",
+		"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":5,\"total_tokens\":15}}\n\n",
+		"data: [DONE]\n\n",
+	}, 0, &payload)
+
+	client := createTestClient(OpenAI, server.URL)
+	response, deltas, err := chatStream(client, &LLMRequest{Prompt: "Hello", Tools: []LLMTool{{Name: "get_weather", Parameters: `{"type":"object"}`}}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Hello", " world"}, deltas)
+	assert.Equal(t, "Hello world", response.Content)
+	assert.Equal(t, FinishToolCalls, response.FinishReason)
+	assert.Equal(t, &LLMUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}, response.Usage)
+	assert.Equal(t, []LLMToolCall{{Name: "get_weather", Arguments: map[string]interface{}{"location": "NYC"}, CallID: "call_1"}}, response.ToolCalls)
+	assert.Equal(t, "openai", response.Provider)
+	assert.Equal(t, "gpt-4o", response.Model)
+
+	assert.Equal(t, true, payload["stream"])
+	assert.Equal(t, map[string]interface{}{"include_usage": true}, payload["stream_options"])
+	assert.Equal(t, "/v1/chat/completions", payload["path"])
+}
+
+// TestLLMClient_ChatStream_Anthropic tests streaming Messages API events
+func TestLLMClient_ChatStream_Anthropic(t *testing.T) {
+	var payload map[string]interface{}
+	server := createSSEServer(t, []string{
+		"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_1\",\"usage\":{\"input_tokens\":25,\"output_tokens\":1}}}\n\n",
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0,\"content_block\":{\"type\":\"text\",\"text\":\"\"}}\n\n",
+		"event: ping\ndata: {\"type\":\"ping\"}\n\n",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Let me \"}}\n\n",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"check.\"}}\n\n",
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":0}\n\n",
+		"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":1,\"content_block\":{\"type\":\"tool_use\",\"id\":\"toolu_1\",\"name\":\"get_weather\",\"input\":{}}}\n\n",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{\\\"location\\\":\"}}\n\n",
+		"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":1,\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\" \\\"NYC\\\"}\"}}\n\n",
+		"event: content_block_stop\ndata: {\"type\":\"content_block_stop\",\"index\":1}\n\n",
+		"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"tool_use\"},\"usage\":{\"output_tokens\":40}}\n\n",
+		"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n",
+	}, 0, &payload)
+
+	client := createTestClient(Anthropic, server.URL)
+	response, deltas, err := chatStream(client, &LLMRequest{Prompt: "Hello"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Let me ", "check."}, deltas)
+	assert.Equal(t, "Let me check.", response.Content)
+	assert.Equal(t, FinishToolCalls, response.FinishReason)
+	assert.Equal(t, &LLMUsage{PromptTokens: 25, CompletionTokens: 40, TotalTokens: 65}, response.Usage)
+	assert.Equal(t, []LLMToolCall{{Name: "get_weather", Arguments: map[string]interface{}{"location": "NYC"}, CallID: "toolu_1"}}, response.ToolCalls)
+	assert.Equal(t, true, payload["stream"])
+	assert.Equal(t, "/v1/messages", payload["path"])
+}
+
+// TestLLMClient_ChatStream_Gemini tests streaming streamGenerateContent responses
+func TestLLMClient_ChatStream_Gemini(t *testing.T) {
+	var payload map[string]interface{}
+	server := createSSEServer(t, []string{
+		"data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"Hello\"}],\"role\":\"model\"}}]}\r\n\r\n",
+		"data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\" world\"},{\"functionCall\":{\"name\":\"get_weather\",\"args\":{\"location\":\"NYC\"}}}],\"role\":\"model\"},\"finishReason\":\"STOP\"}],\"usageMetadata\":{\"promptTokenCount\":8,\"candidatesTokenCount\":4,\"totalTokenCount\":12}}\r\n\r\n",
+	}, 0, &payload)
+
+	client := createTestClient(Gemini, server.URL)
+	response, deltas, err := chatStream(client, &LLMRequest{Prompt: "Hello"})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Hello", " world"}, deltas)
+	assert.Equal(t, "Hello world", response.Content)
+	assert.Equal(t, FinishToolCalls, response.FinishReason)
+	assert.Equal(t, &LLMUsage{PromptTokens: 8, CompletionTokens: 4, TotalTokens: 12}, response.Usage)
+	assert.Equal(t, []LLMToolCall{{Name: "get_weather", Arguments: map[string]interface{}{"location": "NYC"}}}, response.ToolCalls)
+	assert.Equal(t, "/v1beta/models/gemini-2.0-flash-exp:streamGenerateContent", payload["path"])
+	assert.Contains(t, payload["query"], "alt=sse")
+}
+
+// TestLLMClient_ChatStream_Errors tests error events, streams ending early and malformed
+// events for each provider
+func TestLLMClient_ChatStream_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider LLMProvider
+		events   []string
+		wantErr  string
+		wantIs   error
+	}{
+		{
+			name:     "openai error mid-stream",
+			provider: OpenAI,
+			events: []string{
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n",
+				"data: {\"error\":{\"message\":\"The server had an error while processing your request\"}}\n\n",
+			},
+			wantErr: "LLM stream failed: The server had an error while processing your request",
+		},
+		{
+			name:     "openai stream without [DONE]",
+			provider: OpenAI,
+			events:   []string{"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"},\"finish_reason\":\"stop\"}]}\n\n"},
+			wantIs:   ErrLLMInvalidResponse,
+		},
+		{
+			name:     "openai malformed chunk",
+			provider: OpenAI,
+			events:   []string{"data: {\"choices\":\n\n"},
+			wantIs:   ErrLLMInvalidResponse,
+		},
+		{
+			name:     "gemini safety block",
+			provider: Gemini,
+			events: []string{
+				"data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"Hel\"}],\"role\":\"model\"}}]}\r\n\r\n",
+				"data: {\"candidates\":[{\"finishReason\":\"SAFETY\",\"safetyRatings\":[{\"category\":\"HARM_CATEGORY_DANGEROUS_CONTENT\",\"probability\":\"HIGH\"}]}]}\r\n\r\n",
+			},
+			wantErr: "LLM response blocked by content filter: gemini stopped with SAFETY",
+			wantIs:  ErrLLMContentFiltered,
+		},
+		{
+			name:     "anthropic rate limit error event",
+			provider: Anthropic,
+			events: []string{
+				"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":25}}}\n\n",
+				"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"rate_limit_error\",\"message\":\"Rate limited\"}}\n\n",
+			},
+			wantIs: ErrLLMRateLimited,
+		},
+		{
+			name:     "anthropic overloaded error event",
+			provider: Anthropic,
+			events:   []string{"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n"},
+			wantErr:  "LLM stream failed: Overloaded",
+		},
+		{
+			name:     "anthropic stream without message_stop",
+			provider: Anthropic,
+			events:   []string{"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hel\"}}\n\n"},
+			wantIs:   ErrLLMInvalidResponse,
+		},
+		{
+			name:     "gemini error",
+			provider: Gemini,
+			events:   []string{"data: {\"error\":{\"code\":500,\"message\":\"Internal error\"}}\n\n"},
+			wantErr:  "LLM stream failed: Internal error",
+		},
+		{
+			name:     "gemini stream without finish reason",
+			provider: Gemini,
+			events:   []string{"data: {\"candidates\":[{\"content\":{\"parts\":[{\"text\":\"Hel\"}]}}]}\n\n"},
+			wantIs:   ErrLLMInvalidResponse,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := createSSEServer(t, tt.events, 0, nil)
+			client := createTestClient(tt.provider, server.URL)
+
+			response, _, err := chatStream(client, &LLMRequest{Prompt: "Hello"})
+			assert.Nil(t, response)
+			require.Error(t, err)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+			if tt.wantIs != nil {
+				assert.ErrorIs(t, err, tt.wantIs)
+			}
+		})
+	}
+
+	// Errors before the stream starts are classified like those of Chat
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(mockErrorResponses["invalid_key"]))
+	}))
+	defer server.Close()
+	_, _, err := chatStream(createTestClient(OpenAI, server.URL), &LLMRequest{Prompt: "Hello"})
+	assert.ErrorIs(t, err, ErrLLMAuth)
+}
+
+// TestLLMClient_ChatStream_IdleTimeout tests that the timeout bounds the time between chunks
+// rather than the whole response
+func TestLLMClient_ChatStream_IdleTimeout(t *testing.T) {
+	chunk := "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ok \"}}]}\n\n"
+
+	// Six chunks 40ms apart outlast the 100ms timeout as a whole, but never go idle for it
+	slow := createSSEServer(t, []string{chunk, chunk, chunk, chunk, chunk, chunk, "data: [DONE]\n\n"}, 40*time.Millisecond, nil)
+	client := createTestClient(OpenAI, slow.URL)
+	client.config.Timeout = 100 * time.Millisecond
+	client.httpClient.Timeout = 100 * time.Millisecond
+	response, deltas, err := chatStream(client, &LLMRequest{Prompt: "Hello"})
+	require.NoError(t, err)
+	assert.Len(t, deltas, 6)
+	assert.Equal(t, strings.Repeat("ok ", 6), response.Content)
+
+	// A stream stalling after its first chunk fails once the timeout passes
+	stalled := createSSEServer(t, []string{chunk, "data: [DONE]\n\n"}, 300*time.Millisecond, nil)
+	client = createTestClient(OpenAI, stalled.URL)
+	client.config.Timeout = 100 * time.Millisecond
+	_, deltas, err = chatStream(client, &LLMRequest{Prompt: "Hello"})
+	assert.ErrorContains(t, err, "LLM stream received no data for 100ms")
+	assert.Equal(t, []string{"ok "}, deltas)
+}
+
+// TestReadServerSentEvents tests splitting a stream into events
+func TestReadServerSentEvents(t *testing.T) {
+	stream := "event: first\ndata: line one\ndata: line two\n\n: comment\n\ndata:no space\r\n\r\ndata: last without a blank line"
+	type event struct{ name, data string }
+	var events []event
+	lines := 0
+	err := readServerSentEvents(strings.NewReader(stream), func() { lines++ }, func(name string, data []byte) (bool, error) {
+		events = append(events, event{name, string(data)})
+		return false, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []event{{"first", "line one\nline two"}, {"", "no space"}, {"", "last without a blank line"}}, events)
+	assert.Equal(t, 9, lines)
+
+	// Handlers reporting the stream complete stop the reading
+	events = nil
+	err = readServerSentEvents(strings.NewReader("data: a\n\ndata: b\n\n"), func() {}, func(name string, data []byte) (bool, error) {
+		events = append(events, event{name, string(data)})
+		return true, nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+}
+
+// TestFailureAnalysisStreamsWithProgress tests that analyses stream the LLM response when the
+// run reports progress, and send it in one piece otherwise
+func TestFailureAnalysisStreamsWithProgress(t *testing.T) {
+	oldInterval := streamProgressInterval
+	streamProgressInterval = 0
+	t.Cleanup(func() { streamProgressInterval = oldInterval })
+
+	body := `{"root_cause": "The build failed", "classification": {"type": "build", "confidence": 0.8}}`
+	encoded, err := json.Marshal(body)
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		if payload["stream"] != true {
+			fmt.Fprintf(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":%s},"finish_reason":"stop"}]}`, encoded)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		half := len(body) / 2
+		for _, part := range []string{body[:half], body[half:]} {
+			content, _ := json.Marshal(part)
+			fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%s}}]}\n\n", content)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	engine := NewFailureAnalysisEngine(createTestClient(OpenAI, server.URL), quietLogger())
+	engine.SetOSVClient(nil)
+	failure := FailureContext{
+		WorkflowRun: &WorkflowRun{ID: 7, Name: "CI"},
+		Logs:        &WorkflowLogs{ErrorLines: []string{"Error: build failed"}},
+	}
+
+	var events []ProgressEvent
+	ctx := withProgress(context.Background(), func(event ProgressEvent) { events = append(events, event) }, quietLogger(), 7)
+	analysis, err := engine.AnalyzeFailure(ctx, failure)
+	require.NoError(t, err)
+	assert.Equal(t, "The build failed", analysis.RootCause)
+	require.Len(t, events, 2)
+	assert.Equal(t, ProgressAnalyzing, events[0].Stage)
+	assert.Equal(t, fmt.Sprintf("Receiving the LLM response (%d characters)", len(body)/2), events[0].Message)
+	assert.Equal(t, fmt.Sprintf("Receiving the LLM response (%d characters)", len(body)), events[1].Message)
+
+	analysis, err = engine.AnalyzeFailure(context.Background(), failure)
+	require.NoError(t, err)
+	assert.Equal(t, "The build failed", analysis.RootCause)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// LLMPrice is what a provider charges, in US dollars per 1,000 tokens
+type LLMPrice struct {
+	Provider    LLMProvider `json:"provider"`
+	InputPer1K  float64     `json:"input_per_1k"`
+	OutputPer1K float64     `json:"output_per_1k"`
+}
+
+// defaultLLMPrices are the list prices of each provider's default model. LiteLLM is priced
+// like its default model; configure a price when the proxy routes elsewhere.
+var defaultLLMPrices = map[LLMProvider]LLMPrice{
+	OpenAI:    {Provider: OpenAI, InputPer1K: 0.0025, OutputPer1K: 0.01},
+	Anthropic: {Provider: Anthropic, InputPer1K: 0.003, OutputPer1K: 0.015},
+	Gemini:    {Provider: Gemini, InputPer1K: 0.0001, OutputPer1K: 0.0004},
+	DeepSeek:  {Provider: DeepSeek, InputPer1K: 0.00027, OutputPer1K: 0.0011},
+	LiteLLM:   {Provider: LiteLLM, InputPer1K: 0.0025, OutputPer1K: 0.01},
+}
+
+// llmPriceTable returns the default prices overridden by the configured ones
+func llmPriceTable(configured []LLMPrice) map[LLMProvider]LLMPrice {
+	prices := make(map[LLMProvider]LLMPrice, len(defaultLLMPrices))
+	for provider, price := range defaultLLMPrices {
+		prices[provider] = price
+	}
+	for _, price := range configured {
+		prices[price.Provider] = price
+	}
+	return prices
+}
+
+func validateLLMPrice(price LLMPrice) error {
+	if !isKnownLLMProvider(price.Provider) {
+		return fmt.Errorf("unknown LLM provider %q in price table", price.Provider)
+	}
+	if price.InputPer1K < 0 || price.OutputPer1K < 0 {
+		return fmt.Errorf("LLM prices for %s must not be negative", price.Provider)
+	}
+	return nil
+}
+
+// cost returns the estimated cost of usage in US dollars
+func (p LLMPrice) cost(promptTokens, completionTokens int) float64 {
+	return float64(promptTokens)/1000*p.InputPer1K + float64(completionTokens)/1000*p.OutputPer1K
+}
+
+// LLMUsageSummary totals the tokens and estimated cost of LLM requests that reported usage
+type LLMUsageSummary struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
+}
+
+func (s *LLMUsageSummary) add(other LLMUsageSummary) {
+	s.Requests += other.Requests
+	s.PromptTokens += other.PromptTokens
+	s.CompletionTokens += other.CompletionTokens
+	s.TotalTokens += other.TotalTokens
+	s.EstimatedCostUSD += other.EstimatedCostUSD
+}
+
+// LLMUsageByProvider is LLM usage keyed by provider
+type LLMUsageByProvider map[LLMProvider]LLMUsageSummary
+
+// usageTracker accumulates the LLM usage recorded under a context. Trackers form a chain,
+// so a request counts toward its analysis, its AutoFix run and the agent's totals.
+type usageTracker struct {
+	parent *usageTracker
+	prices map[LLMProvider]LLMPrice
+
+	mu         sync.Mutex
+	byProvider LLMUsageByProvider
+}
+
+func newUsageTracker(prices map[LLMProvider]LLMPrice) *usageTracker {
+	return &usageTracker{prices: prices, byProvider: make(LLMUsageByProvider)}
+}
+
+// record adds usage to t and its parents
+func (t *usageTracker) record(provider LLMProvider, usage LLMUsageSummary) {
+	for tracker := t; tracker != nil; tracker = tracker.parent {
+		tracker.mu.Lock()
+		summary := tracker.byProvider[provider]
+		summary.add(usage)
+		tracker.byProvider[provider] = summary
+		tracker.mu.Unlock()
+	}
+}
+
+// providers returns a copy of the usage per provider
+func (t *usageTracker) providers() LLMUsageByProvider {
+	providers := make(LLMUsageByProvider)
+	if t == nil {
+		return providers
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for provider, summary := range t.byProvider {
+		providers[provider] = summary
+	}
+	return providers
+}
+
+// total returns the usage summed over providers
+func (t *usageTracker) total() LLMUsageSummary {
+	return t.providers().total()
+}
+
+type usageContextKey struct{}
+
+// withUsageTracking returns ctx recording LLM usage to a new tracker below the one already in
+// ctx, or below root when ctx has none
+func withUsageTracking(ctx context.Context, root *usageTracker) (context.Context, *usageTracker) {
+	parent, ok := ctx.Value(usageContextKey{}).(*usageTracker)
+	if !ok {
+		parent = root
+	}
+	tracker := newUsageTracker(defaultLLMPrices)
+	if parent != nil {
+		tracker.parent = parent
+		tracker.prices = parent.prices
+	}
+	return context.WithValue(ctx, usageContextKey{}, tracker), tracker
+}
+
+// recordLLMUsage records the tokens and estimated cost of a response from the provider to
+// the trackers in ctx and the metrics. Cached responses are not sent, so they cost nothing.
+func recordLLMUsage(ctx context.Context, response *LLMResponse) {
+	if response == nil || response.Usage == nil {
+		return
+	}
+	provider := LLMProvider(response.Provider)
+	if provider == "" {
+		provider = "unknown"
+	}
+	tracker, _ := ctx.Value(usageContextKey{}).(*usageTracker)
+	prices := defaultLLMPrices
+	if tracker != nil {
+		prices = tracker.prices
+	}
+
+	usage := LLMUsageSummary{
+		Requests:         1,
+		PromptTokens:     response.Usage.PromptTokens,
+		CompletionTokens: response.Usage.CompletionTokens,
+		TotalTokens:      response.Usage.TotalTokens,
+		EstimatedCostUSD: prices[provider].cost(response.Usage.PromptTokens, response.Usage.CompletionTokens),
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	agentMetrics.recordLLMUsage(provider, usage)
+	tracker.record(provider, usage)
+}
+
+// total returns the usage summed over providers
+func (u LLMUsageByProvider) total() LLMUsageSummary {
+	var total LLMUsageSummary
+	for _, summary := range u {
+		total.add(summary)
+	}
+	return total
+}
+
+// sorted returns the providers in name order
+func (u LLMUsageByProvider) sorted() []LLMProvider {
+	providers := make([]LLMProvider, 0, len(u))
+	for provider := range u {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i] < providers[j] })
+	return providers
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// usageTestClient returns a client for a mock OpenAI server reporting 10 prompt and 20
+// completion tokens per request
+func usageTestClient(t *testing.T) (*LLMClient, *int32) {
+	server, requests := countingLLMServer(t, mockResponses[OpenAI])
+	client := createTestClient(OpenAI, server.URL)
+	client.logger = quietLogger()
+	return client, requests
+}
+
+// TestRecordLLMUsage tests that usage counts toward every tracker in the chain, priced from
+// the root's price table
+func TestRecordLLMUsage(t *testing.T) {
+	useTestMetrics(t)
+	client, _ := usageTestClient(t)
+	root := newUsageTracker(llmPriceTable([]LLMPrice{{Provider: OpenAI, InputPer1K: 1, OutputPer1K: 2}}))
+
+	runCtx, run := withUsageTracking(context.Background(), root)
+	analysisCtx, analysis := withUsageTracking(runCtx, root)
+	_, err := client.Chat(analysisCtx, &LLMRequest{Prompt: "Analyze this failure"})
+	require.NoError(t, err)
+	_, err = client.Chat(runCtx, &LLMRequest{Prompt: "Generate fixes"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, analysis.total().Requests)
+	assert.Equal(t, 10, analysis.total().PromptTokens)
+	assert.Equal(t, 20, analysis.total().CompletionTokens)
+	assert.Equal(t, 30, analysis.total().TotalTokens)
+	assert.InDelta(t, 0.05, analysis.total().EstimatedCostUSD, 1e-9)
+	assert.Equal(t, 2, run.total().Requests)
+	assert.Equal(t, 60, run.total().TotalTokens)
+	assert.InDelta(t, 0.1, root.providers()[OpenAI].EstimatedCostUSD, 1e-9)
+
+	// Without a tracker the request is still priced with the built-in table
+	_, err = client.Chat(context.Background(), &LLMRequest{Prompt: "Untracked"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, root.total().Requests)
+}
+
+// TestCachedResponsesAreFree tests that responses served from the cache are not counted
+func TestCachedResponsesAreFree(t *testing.T) {
+	useTestMetrics(t)
+	client, requests := usageTestClient(t)
+	cache, err := newLLMCache("", time.Hour, llmCacheMaxEntries, quietLogger())
+	require.NoError(t, err)
+	client.WithCache(cache)
+
+	ctx, tracker := withUsageTracking(context.Background(), nil)
+	for i := 0; i < 3; i++ {
+		_, err := client.Chat(ctx, &LLMRequest{Prompt: "Analyze this failure"})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+	assert.Equal(t, 1, tracker.total().Requests)
+	assert.Equal(t, 30, tracker.total().TotalTokens)
+}
+
+// TestAutoFixLLMUsage tests that analysis, fix generation and test generation usage reach the
+// analysis, the result metadata, the operational metrics and the Prometheus endpoint
+func TestAutoFixLLMUsage(t *testing.T) {
+	metrics := useTestMetrics(t)
+	client, _ := usageTestClient(t)
+
+	m := fixtureAutofix(nil)
+	m.GeneratedTests = true
+	m.usage = newUsageTracker(llmPriceTable([]LLMPrice{{Provider: OpenAI, InputPer1K: 1, OutputPer1K: 2}}))
+	engine := m.failureEngine.(*mockFailureAnalysisEngine)
+	analyze, generate := engine.analyzeFunc, engine.generateFixesFunc
+	engine.analyzeFunc = func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+		if _, err := client.Chat(ctx, &LLMRequest{Prompt: "Analyze this failure"}); err != nil {
+			return nil, err
+		}
+		return analyze(ctx, fc)
+	}
+	engine.generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+		if _, err := client.Chat(ctx, &LLMRequest{Prompt: "Generate fixes"}); err != nil {
+			return nil, err
+		}
+		return generate(ctx, analysis)
+	}
+	tests := m.testEngine.(*mockTestEngine)
+	generateTests := tests.generateTestsFunc
+	tests.generateTestsFunc = func(ctx context.Context, fix *ProposedFix, analysis *FailureAnalysisResult) ([]CodeChange, error) {
+		if _, err := client.Chat(ctx, &LLMRequest{Prompt: "Generate tests"}); err != nil {
+			return nil, err
+		}
+		return generateTests(ctx, fix, analysis)
+	}
+
+	analysis, err := m.AnalyzeFailure(context.Background(), 7)
+	require.NoError(t, err)
+	require.NotNil(t, analysis.LLMUsage)
+	assert.Equal(t, 1, analysis.LLMUsage.Requests)
+
+	result, err := m.AutoFix(context.Background(), 7)
+	require.NoError(t, err)
+	require.NotNil(t, result.Analysis.LLMUsage)
+	usage := *result.Analysis.LLMUsage
+	assert.Equal(t, 3, usage.Requests)
+	assert.Equal(t, 30, usage.PromptTokens)
+	assert.Equal(t, 60, usage.CompletionTokens)
+	assert.Equal(t, 90, usage.TotalTokens)
+	assert.InDelta(t, 0.15, usage.EstimatedCostUSD, 1e-9)
+	assert.Equal(t, usage, result.Metadata["llm_usage"])
+
+	operational, err := m.GetMetrics(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 120, operational.LLMTokensUsed, "the standalone analysis counts toward the agent's totals")
+	assert.InDelta(t, 0.2, operational.LLMEstimatedCost, 1e-9)
+	assert.Equal(t, 4, operational.LLMUsage[OpenAI].Requests)
+
+	body := scrapeMetrics(t, metrics)
+	assert.Contains(t, body, `github_autofix_llm_tokens_total{provider="openai",type="prompt"} 40`+"\n")
+	assert.Contains(t, body, `github_autofix_llm_tokens_total{provider="openai",type="completion"} 80`+"\n")
+	assert.Contains(t, body, `github_autofix_llm_estimated_cost_usd_total{provider="openai"} 0.2`)
+}
+
+// TestPRBodyShowsLLMUsage tests the tokens and cost lines of the PR metadata section
+func TestPRBodyShowsLLMUsage(t *testing.T) {
+	engine := NewPullRequestEngine(nil, quietLogger())
+	fix := &FixValidationResult{Fix: &ProposedFix{ID: "f1"}, TestResult: &TestResult{}}
+
+	body := engine.generatePRBody(&FailureAnalysisResult{ID: "a1"}, fix)
+	assert.NotContains(t, body, "LLM Tokens")
+
+	body = engine.generatePRBody(&FailureAnalysisResult{ID: "a1", LLMUsage: &LLMUsageSummary{
+		Requests: 3, PromptTokens: 1200, CompletionTokens: 300, TotalTokens: 1500, EstimatedCostUSD: 0.0123,
+	}}, fix)
+	assert.Contains(t, body, "**LLM Tokens**: 1500 (1200 prompt, 300 completion)\n")
+	assert.Contains(t, body, "**Estimated LLM Cost**: $0.0123\n")
+}
+
+// TestLLMPriceTable tests default prices, overrides and price validation
+func TestLLMPriceTable(t *testing.T) {
+	prices := llmPriceTable([]LLMPrice{{Provider: Anthropic, InputPer1K: 0.001, OutputPer1K: 0.005}})
+	assert.Equal(t, defaultLLMPrices[OpenAI], prices[OpenAI])
+	assert.Equal(t, 0.001, prices[Anthropic].InputPer1K)
+	for _, provider := range knownLLMProviders {
+		assert.Contains(t, defaultLLMPrices, provider)
+	}
+	assert.Equal(t, defaultLLMPrices[Anthropic], llmPriceTable(nil)[Anthropic], "overrides do not change the defaults")
+
+	assert.NoError(t, validateLLMPrice(LLMPrice{Provider: OpenAI}))
+	assert.ErrorContains(t, validateLLMPrice(LLMPrice{Provider: "mystery"}), `unknown LLM provider "mystery"`)
+	assert.ErrorContains(t, validateLLMPrice(LLMPrice{Provider: OpenAI, OutputPer1K: -1}), "must not be negative")
+
+	m := New().WithRepository("owner", "repo").
+		WithGitHubToken(createTestSecret("token", "t")).
+		WithLLMProvider("openai", createTestSecret("key", "k")).
+		WithLLMPrice("openai", -0.1, 0)
+	assert.ErrorContains(t, m.validateConfiguration(), "LLM prices for openai must not be negative")
+}
+
+// TestLLMPriceConfig tests the CLI price settings and the status --costs view
+func TestLLMPriceConfig(t *testing.T) {
+	cli, out := outputCLI(t, OutputText)
+	config := cli.getCurrentConfig(cli.rootCmd)
+	_, ok := config.llmPrice()
+	assert.False(t, ok)
+
+	t.Setenv("LLM_PROVIDER", "anthropic")
+	t.Setenv("LLM_OUTPUT_PRICE_PER_1K", "0.02")
+	config = cli.getCurrentConfig(cli.rootCmd)
+	price, ok := config.llmPrice()
+	require.True(t, ok)
+	assert.Equal(t, LLMPrice{Provider: Anthropic, InputPer1K: defaultLLMPrices[Anthropic].InputPer1K, OutputPer1K: 0.02}, price)
+
+	t.Setenv("LLM_INPUT_PRICE_PER_1K", "cheap")
+	config = cli.getCurrentConfig(cli.rootCmd)
+	require.Len(t, config.problems, 1)
+	assert.Equal(t, `llm.input_price_per_1k (env LLM_INPUT_PRICE_PER_1K): "cheap" is not a number`, config.problems[0].String())
+
+	require.NoError(t, cli.printCosts(&OperationalMetrics{LLMUsage: LLMUsageByProvider{
+		OpenAI:    {Requests: 2, PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150, EstimatedCostUSD: 0.0012},
+		Anthropic: {Requests: 1, PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15, EstimatedCostUSD: 0.0001},
+	}}))
+	assert.Equal(t, `
+=== LLM Costs ===
+Provider   Requests       Prompt   Completion        Total  Est. Cost
+anthropic         1           10            5           15    $0.0001
+openai            2          100           50          150    $0.0012
+total             3          110           55          165    $0.0013
+
+`, out.String())
+}
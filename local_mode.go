@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/sirupsen/logrus"
+)
+
+// localSourceRef names the mounted source where a branch or commit would name the base
+const localSourceRef = "source"
+
+// AnalyzeLocal analyzes a failure from the output of a command that failed on the mounted
+// Source, without calling GitHub. The repository's language and framework are detected from
+// Source like the test pipeline does.
+func (m *DaggerAutofix) AnalyzeLocal(ctx context.Context, failureLog string) (*FailureAnalysisResult, error) {
+	if err := m.ensureLocalReady(); err != nil {
+		return nil, err
+	}
+	return m.AnalyzeLogText(ctx, failureLog, m.localRepository(ctx))
+}
+
+// FixLocal analyzes a failure from the output of a command that failed on the mounted
+// Source, then generates fixes and validates them by running the detected framework's tests
+// on a copy of Source, without calling GitHub. It returns the best fix as a directory laid
+// out like ExportFix's, with files/, fix.json and fix.patch.
+func (m *DaggerAutofix) FixLocal(ctx context.Context, failureLog string) (*dagger.Directory, error) {
+	if dag == nil {
+		return nil, fmt.Errorf("dagger client not available")
+	}
+	_, export, err := m.fixLocal(ctx, failureLog)
+	if err != nil {
+		return nil, err
+	}
+	return export.directory()
+}
+
+// ensureLocalReady checks what AnalyzeLocal and FixLocal need, which excludes GitHub
+func (m *DaggerAutofix) ensureLocalReady() error {
+	if m.llmClient == nil || m.failureEngine == nil || m.testEngine == nil {
+		return ErrNotInitialized
+	}
+	if m.Source == nil {
+		return fmt.Errorf("source directory is required, set it with WithSource")
+	}
+	return nil
+}
+
+// localRepository describes the mounted source by the frameworks detected in it. Detection
+// failing only leaves the language and framework out.
+func (m *DaggerAutofix) localRepository(ctx context.Context) RepositoryContext {
+	repository := RepositoryContext{Owner: m.RepoOwner, Name: m.RepoName, DefaultBranch: m.TargetBranch}
+	frameworks, err := m.testEngine.DetectFrameworks(ctx, m.Source)
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to detect the source's frameworks, continuing without them")
+		return repository
+	}
+
+	var languages, names []string
+	for _, framework := range frameworks {
+		if framework.Name == "generic" {
+			continue
+		}
+		if !containsString(languages, framework.Language) {
+			languages = append(languages, framework.Language)
+		}
+		if !containsString(names, framework.Framework) {
+			names = append(names, framework.Framework)
+		}
+	}
+	repository.Language = strings.Join(languages, ", ")
+	repository.Framework = strings.Join(names, ", ")
+	return repository
+}
+
+// fixLocal runs the AutoFix steps up to selecting the best fix on a local failure log and
+// exports that fix against the mounted source
+func (m *DaggerAutofix) fixLocal(ctx context.Context, failureLog string) (*AutoFixResult, *fixExport, error) {
+	start := time.Now()
+	if err := m.ensureLocalReady(); err != nil {
+		return nil, nil, err
+	}
+	ctx, usage := withUsageTracking(ctx, m.usage)
+
+	analysis, err := m.AnalyzeLocal(ctx, failureLog)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fixes, err := m.generateFixes(ctx, analysis)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fix generation failed: %w", err)
+	}
+
+	validations := make([]*FixValidationResult, 0, len(fixes))
+	for _, fix := range fixes {
+		validation, err := m.ValidateFix(ctx, fix)
+		if err != nil {
+			m.logger.WithError(err).WithField("fix_id", fix.ID).Warn("Fix validation failed, skipping")
+			continue
+		}
+		validations = append(validations, validation)
+	}
+	if len(validations) == 0 {
+		return nil, nil, fmt.Errorf("%w generated", ErrNoValidFixes)
+	}
+	bestFix := m.selectBestFix(validations)
+	if bestFix == nil {
+		return nil, nil, m.noPassingFixError(ctx, validations)
+	}
+	if m.GeneratedTests {
+		bestFix = m.addGeneratedTests(ctx, analysis, bestFix)
+	}
+
+	runUsage := usage.total()
+	analysis.LLMUsage = &runUsage
+
+	manifest := FixManifest{BaseBranch: localSourceRef}
+	export, err := m.exportChanges(manifest, analysis, bestFix, func(name string) (string, bool, error) {
+		return m.testEngine.ReadSourceFile(ctx, m.Source, name)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to export fix: %w", err)
+	}
+
+	result := &AutoFixResult{
+		ID:       fmt.Sprintf("autofix-local-%d", start.Unix()),
+		Success:  true,
+		Analysis: analysis,
+		Fix:      bestFix,
+		Metadata: map[string]interface{}{
+			"fixes_generated":         len(fixes),
+			"fixes_validated":         countValidFixes(validations),
+			"selected_fix_confidence": bestFix.Fix.Confidence,
+			"llm_provider":            string(m.LLMProvider),
+			"llm_usage":               runUsage,
+			"exported_files":          len(export.manifest.Files),
+		},
+		Timestamp: time.Now(),
+	}
+	result.Duration = result.Timestamp.Sub(start)
+
+	m.logger.WithFields(logrus.Fields{
+		"analysis_id": analysis.ID,
+		"fix_id":      bestFix.Fix.ID,
+		"files":       len(export.manifest.Files),
+	}).Info("Local fix completed")
+	return result, export, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// snapshotContainerProvider gives every container its own copy of the source files, as
+// Dagger's immutable containers do, so changes applied to validate a fix leave the source
+// untouched. Command outputs are shared.
+type snapshotContainerProvider struct {
+	files      map[string]string
+	outputs    map[string]MockCommandResult
+	containers []*MockDaggerContainer
+}
+
+func (p *snapshotContainerProvider) CreateContainer() ContainerInterface {
+	mock := NewMockDaggerContainer()
+	mock.FileSystem = make(map[string]string, len(p.files))
+	for name, content := range p.files {
+		mock.FileSystem[name] = content
+	}
+	mock.CommandOutputs = p.outputs
+	p.containers = append(p.containers, mock)
+	return &MockContainerWrapper{mock}
+}
+
+// executed returns every command run in the provider's containers
+func (p *snapshotContainerProvider) executed() []string {
+	var commands []string
+	for _, container := range p.containers {
+		for _, args := range container.ExecHistory {
+			commands = append(commands, joinArgs(args))
+		}
+	}
+	return commands
+}
+
+func joinArgs(args []string) string {
+	data, _ := json.Marshal(args)
+	return string(data)
+}
+
+// localAgent returns a logs only agent fixing npmFailureLog in a mounted npm project whose
+// tests run in mock containers
+func localAgent(t *testing.T) (*DaggerAutofix, *scriptedLLMClient, *snapshotContainerProvider) {
+	m, llm := logsOnlyAgent(t)
+	provider := &snapshotContainerProvider{
+		files: map[string]string{
+			"package.json":      `{"name":"widgets","scripts":{"test":"jest","coverage":"jest --coverage"}}`,
+			"src/sum.js":        "function sum(a, b) {\n  return a + b\n}\n",
+			"src/sum.test.js":   "test('adds two numbers', () => expect(sum('1', '2')).toBe(3))\n",
+			"src/format.js":     "module.exports = String\n",
+			"package-lock.json": "{}",
+		},
+		outputs: map[string]MockCommandResult{
+			"npm test":         {Stdout: "Tests:       5 passed, 5 total\n"},
+			"npm run coverage": {Stdout: "All files |   92.5 |\n"},
+		},
+	}
+	engine := NewTestEngine(80, quietLogger())
+	engine.SetContainerProvider(provider)
+	m.testEngine = engine
+	resolver := NewDependencyResolver(quietLogger())
+	resolver.SetContainerProvider(provider)
+	m.dependencies = resolver
+	m.Source = &dagger.Directory{}
+	return m, llm, provider
+}
+
+// TestAnalyzeLocal tests that local analyses describe the source's detected frameworks
+func TestAnalyzeLocal(t *testing.T) {
+	m, llm, _ := localAgent(t)
+
+	analysis, err := m.AnalyzeLocal(context.Background(), npmFailureLog)
+	require.NoError(t, err)
+	assert.Equal(t, TestFailure, analysis.Classification.Type)
+	assert.Equal(t, "javascript", analysis.Context.Repository.Language)
+	assert.Equal(t, "npm", analysis.Context.Repository.Framework)
+	require.Len(t, llm.requests, 1)
+	assert.Contains(t, llm.requests[0].Prompt, "javascript")
+
+	_, err = m.AnalyzeLocal(context.Background(), "  ")
+	assert.ErrorIs(t, err, ErrInvalidLog)
+
+	m.Source = nil
+	_, err = m.AnalyzeLocal(context.Background(), npmFailureLog)
+	assert.ErrorContains(t, err, "source directory is required")
+
+	_, err = New().AnalyzeLocal(context.Background(), npmFailureLog)
+	assert.ErrorIs(t, err, ErrNotInitialized)
+}
+
+// TestFixLocal tests analyzing, fixing and validating a failure of the mounted source without
+// GitHub, and exporting the fix against the unchanged source
+func TestFixLocal(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Success", func(t *testing.T) {
+		m, llm, provider := localAgent(t)
+
+		result, export, err := m.fixLocal(ctx, npmFailureLog)
+		require.NoError(t, err)
+		assert.Nil(t, m.githubClient)
+		assert.Len(t, llm.requests, 2, "one analysis and one fix generation request")
+		assert.True(t, result.Success)
+		assert.True(t, result.Fix.Valid)
+		assert.Equal(t, 1, result.Metadata["exported_files"])
+		require.NotNil(t, result.Analysis.LLMUsage)
+
+		assert.Contains(t, provider.executed(), `["npm","test"]`, "the fix is validated with the detected test command")
+		var written bool
+		for _, container := range provider.containers {
+			if container.FileSystem["src/sum.js"] == "return Number(a) + Number(b)" {
+				written = true
+			}
+		}
+		assert.True(t, written, "the fix is applied in a test container")
+
+		assert.Zero(t, export.manifest.RunID)
+		assert.Equal(t, localSourceRef, export.manifest.BaseBranch)
+		assert.Equal(t, TestFailure, export.manifest.Analysis.FailureType)
+		assert.Equal(t, []FixManifestFile{{Path: "src/sum.js", Operation: ChangeOperationModify}}, export.manifest.Files)
+		assert.Equal(t, map[string]string{"src/sum.js": "return Number(a) + Number(b)"}, export.files)
+		assert.Contains(t, export.patch, "--- a/src/sum.js\n+++ b/src/sum.js\n")
+		assert.Contains(t, export.patch, "-  return a + b\n")
+
+		entries, err := export.entries()
+		require.NoError(t, err)
+		var manifest FixManifest
+		require.NoError(t, json.Unmarshal([]byte(entries[fixManifestFile]), &manifest))
+		assert.True(t, manifest.Fix.TestsPassed)
+		assert.Equal(t, 92.5, manifest.Fix.Coverage)
+	})
+
+	t.Run("TestsFail", func(t *testing.T) {
+		m, _, provider := localAgent(t)
+		provider.outputs["npm test"] = MockCommandResult{Stdout: "Tests:       1 failed, 4 passed, 5 total\n", ExitCode: 1}
+
+		_, _, err := m.fixLocal(ctx, npmFailureLog)
+		assert.ErrorIs(t, err, ErrNoValidFixes)
+	})
+
+	t.Run("LLMFails", func(t *testing.T) {
+		m, llm, _ := localAgent(t)
+		llm.chatFunc = func(req *LLMRequest) (*LLMResponse, error) {
+			return nil, errors.New("provider unavailable")
+		}
+
+		_, _, err := m.fixLocal(ctx, npmFailureLog)
+		assert.ErrorContains(t, err, "provider unavailable")
+	})
+
+	t.Run("NoDaggerClient", func(t *testing.T) {
+		m, _, _ := localAgent(t)
+		_, err := m.FixLocal(ctx, npmFailureLog)
+		assert.ErrorContains(t, err, "dagger client not available")
+	})
+}
+
+// TestReadSourceFile tests telling missing source files apart from unreadable ones
+func TestReadSourceFile(t *testing.T) {
+	ctx := context.Background()
+	provider := NewMockContainerProvider()
+	provider.MockContainer.FileSystem = map[string]string{"src/sum.js": "sum"}
+	engine := NewTestEngine(80, quietLogger())
+	engine.SetContainerProvider(provider)
+	source := &dagger.Directory{}
+
+	content, exists, err := engine.ReadSourceFile(ctx, source, "src/sum.js")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, "sum", content)
+
+	for _, name := range []string{"src/missing.js", "lib/missing.js"} {
+		_, exists, err = engine.ReadSourceFile(ctx, source, name)
+		require.NoError(t, err, name)
+		assert.False(t, exists, name)
+	}
+
+	_, _, err = engine.ReadSourceFile(ctx, nil, "src/sum.js")
+	assert.Error(t, err)
+
+	frameworks, err := engine.DetectFrameworks(ctx, source)
+	require.NoError(t, err)
+	require.Len(t, frameworks, 1)
+	assert.Equal(t, "generic", frameworks[0].Name)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tosin2013/dagger-autofix/pkg/autofix"
+)
+
+// AnalyzeLogText analyzes a failure from the text of a build log, e.g. from a CI system other
+// than GitHub Actions, without calling GitHub. repoHints describes the repository the log
+// comes from; the owner and name default to the configured repository.
+func (m *DaggerAutofix) AnalyzeLogText(ctx context.Context, logText string, repoHints RepositoryContext) (*FailureAnalysisResult, error) {
+	if m.failureEngine == nil {
+		return nil, ErrNotInitialized
+	}
+	if err := autofix.CheckLog(logText); err != nil {
+		return nil, err
+	}
+
+	logs := &WorkflowLogs{
+		RawLogs:       logText,
+		JobLogs:       make(map[string]string),
+		StepLogs:      make(map[string]string),
+		ErrorLines:    autofix.ExtractErrorLines(logText),
+		JobErrorLines: make(map[string][]string),
+	}
+	m.redactor.RedactLogs(logs)
+	m.logger.WithFields(logrus.Fields{
+		"bytes":       len(logText),
+		"error_lines": len(logs.ErrorLines),
+	}).Info("Analyzing log text")
+
+	repository := repoHints
+	repository.Owner = valueOr(repository.Owner, m.RepoOwner)
+	repository.Name = valueOr(repository.Name, m.RepoName)
+	now := time.Now()
+	return m.analyzeFailureContext(ctx, FailureContext{
+		// The log has no workflow run, but the analysis engine describes the failure by one
+		WorkflowRun: &WorkflowRun{
+			Name:       "log",
+			Status:     "completed",
+			Conclusion: "failure",
+			Branch:     repository.DefaultBranch,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		},
+		Logs:       logs,
+		Repository: repository,
+	})
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tosin2013/dagger-autofix/pkg/autofix"
+)
+
+// npmFailureLog is a failing `npm test` run as a CI system other than GitHub Actions logs it
+const npmFailureLog = "2024-05-01T10:00:00.000Z > widgets@1.0.0 test\n" +
+	"2024-05-01T10:00:00.100Z > jest\n" +
+	"\n" +
+	"\x1b[31mFAIL\x1b[39m src/sum.test.js\n" +
+	"  ● sum › adds two numbers\n" +
+	"\n" +
+	"    expect(received).toBe(expected) // Object.is equality\n" +
+	"\n" +
+	"    Expected: 3\n" +
+	"    Received: \"12\"\n" +
+	"\n" +
+	"PASS src/format.test.js\n" +
+	"Tests:       1 failed, 4 passed, 5 total\n" +
+	"Found 0 errors in the type check\n" +
+	"npm ERR! code ELIFECYCLE\n" +
+	"npm ERR! errno 1\n" +
+	"npm ERR! widgets@1.0.0 test: `jest`\n" +
+	"npm ERR! Exit status 1\n" +
+	"npm ERR! Exit status 1\n" +
+	"Error: Process completed with exit code 1.\n"
+
+const npmAnalysisResponse = `{
+	"root_cause": "sum concatenates its arguments as strings",
+	"description": "The sum test expects 3 but sum returns \"12\"",
+	"classification": {"type": "test", "category": "systematic", "confidence": 0.85},
+	"affected_files": ["src/sum.js"]
+}`
+
+const npmFixesResponse = `[{
+	"type": "code",
+	"description": "Convert the arguments of sum to numbers",
+	"confidence": 0.8,
+	"changes": [{
+		"file_path": "/workspace/src/sum.js",
+		"operation": "modify",
+		"old_content": "return a + b",
+		"new_content": "return Number(a) + Number(b)"
+	}]
+}]`
+
+// scriptedLLMClient answers LLM requests with chatFunc and records them
+type scriptedLLMClient struct {
+	chatFunc func(req *LLMRequest) (*LLMResponse, error)
+	requests []*LLMRequest
+}
+
+func (c *scriptedLLMClient) Chat(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	c.requests = append(c.requests, req)
+	return c.chatFunc(req)
+}
+
+// logsOnlyAgent returns an initialized logs only agent whose LLM answers the analysis and fix
+// generation prompts for npmFailureLog. Creating a GitHub client fails the test.
+func logsOnlyAgent(t *testing.T) (*DaggerAutofix, *scriptedLLMClient) {
+	oldGH, oldLLM, oldFailure := newGitHubIntegration, newLLMClient, newFailureAnalysisEngine
+	t.Cleanup(func() {
+		newGitHubIntegration, newLLMClient, newFailureAnalysisEngine = oldGH, oldLLM, oldFailure
+	})
+	newGitHubIntegration = func(ctx context.Context, token *dagger.Secret, owner, name string, endpoints *GitHubEndpoints, logger *logrus.Logger) (*GitHubIntegration, error) {
+		t.Error("logs only agents must not create a GitHub client")
+		return &GitHubIntegration{}, nil
+	}
+	newLLMClient = func(ctx context.Context, provider LLMProvider, apiKey *dagger.Secret, logger *logrus.Logger) (*LLMClient, error) {
+		return &LLMClient{provider: provider}, nil
+	}
+	llm := &scriptedLLMClient{}
+	llm.chatFunc = func(req *LLMRequest) (*LLMResponse, error) {
+		if len(llm.requests) == 1 {
+			return &LLMResponse{Content: npmAnalysisResponse}, nil
+		}
+		return &LLMResponse{Content: npmFixesResponse}, nil
+	}
+	newFailureAnalysisEngine = func(llmClient LLMClientInterface, logger *logrus.Logger) *FailureAnalysisEngine {
+		engine := NewFailureAnalysisEngine(llm, logger)
+		engine.SetOSVClient(nil)
+		return engine
+	}
+
+	m := New().WithLLMProvider("openai", createTestSecret("key", "sk-test")).WithLogsOnly(true)
+	m.logger = quietLogger()
+	m, err := m.Initialize(context.Background())
+	require.NoError(t, err)
+	return m, llm
+}
+
+// TestAnalyzeLogText tests analyzing an npm failure log and generating fixes for it without
+// GitHub credentials, a repository or any GitHub call
+func TestAnalyzeLogText(t *testing.T) {
+	m, llm := logsOnlyAgent(t)
+	assert.Nil(t, m.githubClient)
+	assert.Nil(t, m.prEngine)
+
+	analysis, err := m.AnalyzeLogText(context.Background(), npmFailureLog, RepositoryContext{Language: "javascript"})
+	require.NoError(t, err)
+	assert.Equal(t, "sum concatenates its arguments as strings", analysis.RootCause)
+	assert.Equal(t, TestFailure, analysis.Classification.Type)
+	assert.Equal(t, npmFailureLog, analysis.Context.Logs.RawLogs)
+	assert.Contains(t, analysis.Context.Logs.ErrorLines, "npm ERR! code ELIFECYCLE")
+	assert.Equal(t, "javascript", analysis.Context.Repository.Language)
+	require.NotNil(t, analysis.LLMUsage)
+
+	require.Len(t, llm.requests, 1)
+	assert.Contains(t, llm.requests[0].Prompt, "FAIL src/sum.test.js")
+	assert.Contains(t, llm.requests[0].Prompt, "javascript")
+
+	fixes, err := m.generateFixes(context.Background(), analysis)
+	require.NoError(t, err)
+	require.Len(t, fixes, 1)
+	assert.Equal(t, "src/sum.js", fixes[0].Changes[0].FilePath)
+
+	_, err = m.AutoFix(context.Background(), 42)
+	assert.ErrorIs(t, err, ErrNotInitialized, "logs only agents cannot fix workflow runs")
+}
+
+// TestAnalyzeLogTextErrors tests the inputs AnalyzeLogText rejects
+func TestAnalyzeLogTextErrors(t *testing.T) {
+	_, err := New().AnalyzeLogText(context.Background(), npmFailureLog, RepositoryContext{})
+	assert.ErrorIs(t, err, ErrNotInitialized)
+
+	m, llm := logsOnlyAgent(t)
+	_, err = m.AnalyzeLogText(context.Background(), " \n\t", RepositoryContext{})
+	assert.ErrorIs(t, err, ErrInvalidLog)
+	assert.Equal(t, exitInvalidInput, exitCode(err))
+	_, err = m.AnalyzeLogText(context.Background(), strings.Repeat("x", MaxLogSize+1), RepositoryContext{})
+	assert.ErrorIs(t, err, ErrInvalidLog)
+	assert.Empty(t, llm.requests)
+
+	_, err = autofix.ReadLog(strings.NewReader(strings.Repeat("x", MaxLogSize+1)))
+	assert.ErrorIs(t, err, ErrInvalidLog)
+}
+
+// TestLogsOnlyConfiguration tests that logs only agents need an LLM API key but no GitHub
+// credentials or repository
+func TestLogsOnlyConfiguration(t *testing.T) {
+	m := &DaggerAutofix{LogsOnly: true, LLMAPIKey: createTestSecret("key", "sk-test")}
+	assert.NoError(t, m.validateConfiguration())
+
+	m.LLMAPIKey = nil
+	assert.EqualError(t, m.validateConfiguration(), "LLM API key is required")
+
+	m = &DaggerAutofix{LLMAPIKey: createTestSecret("key", "sk-test")}
+	assert.EqualError(t, m.validateConfiguration(), "GitHub token is required")
+}
+
+// TestAnalyzeLogCommand tests the log sources of the analyze command and printing the
+// analysis of a log with its fixes
+func TestAnalyzeLogCommand(t *testing.T) {
+	clearConfigEnv(t)
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "no source", args: []string{"analyze"}, wantErr: "give a workflow run ID, --from-file or --stdin"},
+		{name: "run and file", args: []string{"analyze", "42", "--from-file", "build.log"}, wantErr: "not several"},
+		{name: "file and stdin", args: []string{"analyze", "--from-file", "build.log", "--stdin"}, wantErr: "not several"},
+		{name: "missing file", args: []string{"analyze", "--from-file", filepath.Join(t.TempDir(), "missing.log")}, wantErr: "failed to open log"},
+		{name: "no LLM key", args: []string{"analyze", "--stdin"}, wantErr: "LLM API key is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cli := NewCLI()
+			cli.logger = quietLogger()
+			cli.rootCmd.SetArgs(tt.args)
+			cli.rootCmd.SetIn(strings.NewReader(npmFailureLog))
+			cli.rootCmd.SetOut(&bytes.Buffer{})
+			cli.rootCmd.SetErr(&bytes.Buffer{})
+			assert.ErrorContains(t, cli.rootCmd.Execute(), tt.wantErr)
+		})
+	}
+
+	// Only the LLM key is needed; without a Dagger client the agent itself cannot start
+	path := filepath.Join(t.TempDir(), "build.log")
+	require.NoError(t, os.WriteFile(path, []byte(npmFailureLog), 0o644))
+	t.Setenv("LLM_API_KEY", "sk-test")
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	cli.rootCmd.SetArgs([]string{"analyze", "--from-file", path})
+	assert.ErrorContains(t, cli.rootCmd.Execute(), "dagger client not available")
+
+	m, _ := logsOnlyAgent(t)
+	cli, out := outputCLI(t, OutputJSON)
+	require.NoError(t, cli.analyzeLog(context.Background(), m, npmFailureLog, RepositoryContext{}, true, ""))
+	var result struct {
+		Analysis struct {
+			RootCause string `json:"root_cause"`
+		} `json:"analysis"`
+		Fixes []struct {
+			Description string `json:"description"`
+		} `json:"fixes"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &result), out.String())
+	assert.Equal(t, "sum concatenates its arguments as strings", result.Analysis.RootCause)
+	require.Len(t, result.Fixes, 1)
+	assert.Equal(t, "Convert the arguments of sum to numbers", result.Fixes[0].Description)
+
+	m, _ = logsOnlyAgent(t)
+	cli, out = outputCLI(t, OutputText)
+	require.NoError(t, cli.analyzeLog(context.Background(), m, npmFailureLog, RepositoryContext{}, true, ""))
+	assert.Contains(t, out.String(), "=== Failure Analysis Result ===")
+	assert.Contains(t, out.String(), "=== Generated Fixes ===")
+	assert.Contains(t, out.String(), "    - modify: src/sum.js\n")
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tosin2013/dagger-autofix/pkg/autofix"
+)
+
+const (
+	// analysisLogBudget is how many bytes of raw logs the analysis prompt includes; longer
+	// logs keep their head and tail
+	analysisLogBudget = 8000
+
+	// DefaultLogChunkFactor is how many times the analysis log budget logs must exceed to be
+	// analyzed in chunks
+	DefaultLogChunkFactor = 4
+	// DefaultLogChunkBytes is the size of the chunks logs are split into
+	DefaultLogChunkBytes = 16000
+	// DefaultLogChunkOverlapLines is how many lines consecutive chunks share, so an error and
+	// its context are not split apart
+	DefaultLogChunkOverlapLines = 20
+	// DefaultLogChunkMaxChunks is the most chunks summarized for an analysis
+	DefaultLogChunkMaxChunks = 8
+
+	// logChunkSummaryMaxBytes bounds each chunk summary in the analysis prompt
+	logChunkSummaryMaxBytes = 2000
+)
+
+// LogChunking analyzes logs far longer than the analysis prompt takes in chunks. Without it
+// the prompt keeps the head and tail of long logs, cutting the middle where the first real
+// error of a matrix build often is. With it, the logs are split into overlapping chunks at
+// line boundaries, each chunk is summarized into its error candidates by the analysis model,
+// and the failure is analyzed from the summaries and the error lines.
+type LogChunking struct {
+	Enabled bool `json:"enabled"`
+	// Factor is how many times the 8000 bytes of logs the analysis prompt includes logs must
+	// exceed to be chunked
+	Factor float64 `json:"factor"`
+	// ChunkBytes is the most bytes of a chunk; a longer line is a chunk of its own, cut to
+	// ChunkBytes
+	ChunkBytes int `json:"chunk_bytes"`
+	// OverlapLines is how many lines a chunk repeats from the end of the previous one. Zero
+	// uses the default and a negative value does not overlap chunks.
+	OverlapLines int `json:"overlap_lines"`
+	// MaxChunks is the most chunks summarized, which caps a chunked analysis at MaxChunks+1
+	// LLM requests, one more when it is escalated. When there are more chunks, those with the
+	// most error lines are summarized.
+	MaxChunks int `json:"max_chunks"`
+}
+
+// withDefaults fills the unset factor, sizes and limit
+func (c LogChunking) withDefaults() LogChunking {
+	if c.Factor == 0 {
+		c.Factor = DefaultLogChunkFactor
+	}
+	if c.ChunkBytes == 0 {
+		c.ChunkBytes = DefaultLogChunkBytes
+	}
+	if c.OverlapLines == 0 {
+		c.OverlapLines = DefaultLogChunkOverlapLines
+	} else if c.OverlapLines < 0 {
+		c.OverlapLines = 0
+	}
+	if c.MaxChunks == 0 {
+		c.MaxChunks = DefaultLogChunkMaxChunks
+	}
+	return c
+}
+
+// validate checks the factor, sizes and limit
+func (c LogChunking) validate() error {
+	if c.Factor != 0 && c.Factor < 1 {
+		return fmt.Errorf("log chunking factor must be at least 1, got %v", c.Factor)
+	}
+	if c.ChunkBytes < 0 {
+		return fmt.Errorf("log chunk size must not be negative, got %d", c.ChunkBytes)
+	}
+	if c.MaxChunks < 0 {
+		return fmt.Errorf("log chunk limit must not be negative, got %d", c.MaxChunks)
+	}
+	return nil
+}
+
+// applies tells whether logs of logBytes are analyzed in chunks
+func (c LogChunking) applies(logBytes int) bool {
+	return c.Enabled && float64(logBytes) > c.withDefaults().Factor*analysisLogBudget
+}
+
+// LogChunkingStats records a chunked analysis in the analysis's Metadata["log_chunking"]
+type LogChunkingStats struct {
+	LogBytes int `json:"log_bytes"`
+	Chunks   int `json:"chunks"`
+	// Summarized chunks were summarized by the LLM; Failed chunks were sent but are
+	// represented by their error lines, as their summary request failed
+	Summarized int `json:"summarized"`
+	Failed     int `json:"failed,omitempty"`
+	// LLMCalls counts the summary and analysis requests and MaxLLMCalls is their cap,
+	// without the escalated analysis
+	LLMCalls    int `json:"llm_calls"`
+	MaxLLMCalls int `json:"max_llm_calls"`
+	// Usage is the usage of the summary requests
+	Usage LLMUsageSummary `json:"usage"`
+}
+
+// logChunk is a run of log lines, numbered from 1
+type logChunk struct {
+	startLine int
+	endLine   int
+	text      string
+	// errorLines is how many of its lines look like they report a failure
+	errorLines int
+}
+
+// splitLogChunks splits logs into chunks of at most chunkBytes at line boundaries, each
+// starting overlapLines lines before the end of the previous one
+func splitLogChunks(logs string, chunkBytes, overlapLines int) []logChunk {
+	lines := strings.SplitAfter(logs, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var chunks []logChunk
+	for start := 0; start < len(lines); {
+		end, size := start, 0
+		for end < len(lines) && (end == start || size+len(lines[end]) <= chunkBytes) {
+			size += len(lines[end])
+			end++
+		}
+		text := strings.Join(lines[start:end], "")
+		if len(text) > chunkBytes {
+			text = text[:chunkBytes]
+		}
+		chunk := logChunk{startLine: start + 1, endLine: end, text: text}
+		for _, line := range lines[start:end] {
+			if autofix.IsErrorLine(line) {
+				chunk.errorLines++
+			}
+		}
+		chunks = append(chunks, chunk)
+
+		if end == len(lines) {
+			break
+		}
+		start = max(end-overlapLines, start+1)
+	}
+	return chunks
+}
+
+// selectLogChunks returns the indexes of the chunks to summarize in log order: all of them,
+// or the limit with the most error lines, earlier chunks first on ties
+func selectLogChunks(chunks []logChunk, limit int) []int {
+	selected := make([]int, len(chunks))
+	for i := range chunks {
+		selected[i] = i
+	}
+	if len(chunks) <= limit {
+		return selected
+	}
+	sort.SliceStable(selected, func(i, j int) bool {
+		return chunks[selected[i]].errorLines > chunks[selected[j]].errorLines
+	})
+	selected = selected[:limit]
+	sort.Ints(selected)
+	return selected
+}
+
+// logChunkSummaries are the summaries of the chunks of logs too long for the analysis prompt
+type logChunkSummaries struct {
+	section      string
+	stats        LogChunkingStats
+	models       []string
+	interactions []LLMInteraction
+}
+
+// summarizeLogChunks summarizes the chunks of the failure's logs when they are long enough to
+// be chunked, nil otherwise. A chunk whose summary request fails is represented by its error
+// lines rather than failing the analysis.
+func (e *FailureAnalysisEngine) summarizeLogChunks(ctx context.Context, failureCtx FailureContext) (*logChunkSummaries, error) {
+	if failureCtx.Logs == nil || !e.logChunking.applies(len(failureCtx.Logs.RawLogs)) {
+		return nil, nil
+	}
+	config := e.logChunking.withDefaults()
+	logs := failureCtx.Logs.RawLogs
+	chunks := splitLogChunks(logs, config.ChunkBytes, config.OverlapLines)
+	selected := selectLogChunks(chunks, config.MaxChunks)
+	logger := e.logger.WithFields(logrus.Fields{
+		"run_id":     failureCtx.WorkflowRun.ID,
+		"log_bytes":  len(logs),
+		"chunks":     len(chunks),
+		"summarized": len(selected),
+	})
+	logger.Info("Logs exceed the prompt budget, summarizing them in chunks")
+
+	// The summary requests are tracked on their own too, so their cost is reported apart
+	ctx, usage := withUsageTracking(ctx, nil)
+	summaries := &logChunkSummaries{stats: LogChunkingStats{
+		LogBytes:    len(logs),
+		Chunks:      len(chunks),
+		MaxLLMCalls: config.MaxChunks + 1,
+	}}
+	var section strings.Builder
+	section.WriteString(fmt.Sprintf("**Log Summaries** (the logs are %d bytes, too long to include, so ", len(logs)))
+	if len(selected) < len(chunks) {
+		section.WriteString(fmt.Sprintf("the %d of their %d parts with the most error lines were summarized separately):\n\n", len(selected), len(chunks)))
+	} else {
+		section.WriteString(fmt.Sprintf("each of their %d parts was summarized separately):\n\n", len(chunks)))
+	}
+
+	for _, index := range selected {
+		chunk := chunks[index]
+		data := &LogChunkPromptData{
+			Run:        failureCtx.WorkflowRun,
+			Repository: failureCtx.Repository,
+			JobName:    failureCtx.JobName,
+			Index:      index + 1,
+			Total:      len(chunks),
+			StartLine:  chunk.startLine,
+			EndLine:    chunk.endLine,
+			Chunk:      chunk.text,
+		}
+		req := &LLMRequest{
+			SystemMsg: e.renderSystemPrompt("log_chunk_summary.tmpl", data),
+			Prompt:    e.redactor.Redact(e.renderPrompt("log_chunk_summary_prompt.tmpl", data)),
+			Context:   map[string]interface{}{"log_chunk": index + 1},
+			Model:     e.analysisModel,
+		}
+		summaries.stats.LLMCalls++
+
+		var summary string
+		response, err := e.chat(ctx, ProgressAnalyzing, req)
+		switch {
+		case ctx.Err() != nil:
+			return nil, fmt.Errorf("log chunk summary failed: %w", ctx.Err())
+		case err != nil:
+			logger.WithError(err).WithField("chunk", index+1).Warn("Failed to summarize log chunk, using its error lines")
+			summaries.stats.Failed++
+			summary = strings.Join(autofix.ExtractErrorLines(chunk.text), "\n")
+		default:
+			summaries.stats.Summarized++
+			summaries.models = appendModel(summaries.models, responseModel(response, req))
+			summaries.interactions = e.captureInteraction(summaries.interactions, InteractionLogChunkSummary, req, response)
+			summary = strings.TrimSpace(response.Content)
+		}
+		if summary == "" {
+			summary = "No errors in this part"
+		}
+		if len(summary) > logChunkSummaryMaxBytes {
+			summary = truncateMiddle(summary, logChunkSummaryMaxBytes)
+		}
+		section.WriteString(fmt.Sprintf("Part %d of %d, lines %d-%d:\n```\n%s\n```\n\n", index+1, len(chunks), chunk.startLine, chunk.endLine, e.redactor.Redact(summary)))
+	}
+
+	summaries.section = section.String()
+	summaries.stats.Usage = usage.total()
+	return summaries, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tosin2013/dagger-autofix/pkg/autofix"
+)
+
+const middleLogError = "FATAL: migration 0042_add_users failed: relation \"users\" already exists"
+
+// largeFailureLog returns a log of about 60KB whose only real error is in its middle
+func largeFailureLog() string {
+	var log strings.Builder
+	for i := 0; i < 1200; i++ {
+		if i == 600 {
+			log.WriteString(middleLogError + "\n")
+		}
+		fmt.Fprintf(&log, "step %04d: compiling package example.com/app/pkg%04d\n", i, i)
+	}
+	log.WriteString("Process completed with exit code 1.\n")
+	return log.String()
+}
+
+// usageRecordingLLM records the usage of the responses of its client, as LLMClient does
+type usageRecordingLLM struct {
+	*scriptedLLMClient
+}
+
+func (c usageRecordingLLM) Chat(ctx context.Context, req *LLMRequest) (*LLMResponse, error) {
+	response, err := c.scriptedLLMClient.Chat(ctx, req)
+	recordLLMUsage(ctx, response)
+	return response, err
+}
+
+// chunkSummarizingLLM summarizes log chunks into their lines that look like errors and
+// analyzes failures as a migration failure
+func chunkSummarizingLLM(summaryErr error) *scriptedLLMClient {
+	return &scriptedLLMClient{chatFunc: func(req *LLMRequest) (*LLMResponse, error) {
+		usage := &LLMUsage{PromptTokens: 1000, CompletionTokens: 100, TotalTokens: 1100}
+		if _, ok := req.Context["log_chunk"]; ok {
+			if summaryErr != nil && strings.Contains(req.Prompt, middleLogError) {
+				return nil, summaryErr
+			}
+			return &LLMResponse{Content: strings.Join(autofix.ExtractErrorLines(req.Prompt), "\n"), Provider: "openai", Model: "gpt-4o-mini", Usage: usage}, nil
+		}
+		return &LLMResponse{
+			Content:  `{"root_cause": "migration 0042 creates an existing table", "classification": {"type": "configuration", "confidence": 0.9}}`,
+			Provider: "openai",
+			Model:    "gpt-4o",
+			Usage:    usage,
+		}, nil
+	}}
+}
+
+func chunkingEngine(llm LLMClientInterface, chunking LogChunking) *FailureAnalysisEngine {
+	engine := NewFailureAnalysisEngine(llm, quietLogger())
+	engine.SetOSVClient(nil)
+	engine.SetLogChunking(chunking)
+	return engine
+}
+
+// analysisRequests splits the requests into the chunk summary prompts and the analysis prompts
+func analysisRequests(requests []*LLMRequest) (chunks []string, analyses []string) {
+	for _, req := range requests {
+		if _, ok := req.Context["log_chunk"]; ok {
+			chunks = append(chunks, req.Prompt)
+		} else {
+			analyses = append(analyses, req.Prompt)
+		}
+	}
+	return chunks, analyses
+}
+
+// TestSplitLogChunks tests splitting logs into overlapping chunks at line boundaries
+func TestSplitLogChunks(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 10; i++ {
+		lines = append(lines, fmt.Sprintf("line %02d", i)) // 8 bytes with the newline
+	}
+	logs := strings.Join(lines, "\n") + "\n"
+
+	chunks := splitLogChunks(logs, 32, 1)
+	var ranges [][2]int
+	for _, chunk := range chunks {
+		ranges = append(ranges, [2]int{chunk.startLine, chunk.endLine})
+		assert.LessOrEqual(t, len(chunk.text), 32)
+		assert.True(t, strings.HasSuffix(chunk.text, "\n"), "chunks end at line boundaries")
+		assert.Equal(t, strings.Join(lines[chunk.startLine-1:chunk.endLine], "\n")+"\n", chunk.text)
+	}
+	assert.Equal(t, [][2]int{{1, 4}, {4, 7}, {7, 10}}, ranges)
+
+	chunks = splitLogChunks(logs, 32, 0)
+	assert.Len(t, chunks, 3)
+	assert.Equal(t, 9, chunks[2].startLine)
+
+	t.Run("LongLine", func(t *testing.T) {
+		chunks := splitLogChunks("short\n"+strings.Repeat("x", 100)+"\nshort\n", 32, 5)
+		require.Len(t, chunks, 3)
+		assert.Equal(t, [2]int{2, 2}, [2]int{chunks[1].startLine, chunks[1].endLine})
+		assert.Len(t, chunks[1].text, 32, "a line longer than a chunk is cut")
+	})
+
+	t.Run("ErrorLines", func(t *testing.T) {
+		chunks := splitLogChunks("ok\nerror: boom\n0 errors\nFAILED test\n", 1000, 0)
+		require.Len(t, chunks, 1)
+		assert.Equal(t, 2, chunks[0].errorLines)
+	})
+}
+
+// TestSelectLogChunks tests that the chunks with the most error lines are summarized
+func TestSelectLogChunks(t *testing.T) {
+	chunks := []logChunk{{errorLines: 0}, {errorLines: 3}, {errorLines: 1}, {errorLines: 3}, {errorLines: 0}}
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, selectLogChunks(chunks, 5))
+	assert.Equal(t, []int{1, 3}, selectLogChunks(chunks, 2), "log order")
+	assert.Equal(t, []int{1, 2, 3}, selectLogChunks(chunks, 3))
+	assert.Equal(t, []int{0, 1, 2, 3}, selectLogChunks(chunks, 4), "earlier chunks first on ties")
+}
+
+// TestAnalyzeFailureLogChunking tests that an error in the middle of a huge log reaches the
+// analysis through the chunk summaries
+func TestAnalyzeFailureLogChunking(t *testing.T) {
+	logs := largeFailureLog()
+	failureCtx := FailureContext{
+		WorkflowRun: &WorkflowRun{ID: 1, Name: "CI"},
+		Logs:        &WorkflowLogs{RawLogs: logs, ErrorLines: []string{"Process completed with exit code 1."}},
+	}
+
+	t.Run("Truncated", func(t *testing.T) {
+		llm := chunkSummarizingLLM(nil)
+		_, err := chunkingEngine(llm, LogChunking{}).AnalyzeFailure(context.Background(), failureCtx)
+		require.NoError(t, err)
+		chunks, analyses := analysisRequests(llm.requests)
+		assert.Empty(t, chunks)
+		require.Len(t, analyses, 1)
+		assert.Contains(t, analyses[0], "[TRUNCATED]")
+		assert.NotContains(t, analyses[0], middleLogError, "cutting the middle loses the error")
+	})
+
+	t.Run("Chunked", func(t *testing.T) {
+		llm := chunkSummarizingLLM(nil)
+		engine := chunkingEngine(usageRecordingLLM{llm}, LogChunking{Enabled: true, ChunkBytes: 8000, MaxChunks: 20})
+		engine.SetModels("gpt-4o-mini", "gpt-4o")
+		engine.SetPromptCapture(true)
+		ctx, usage := withUsageTracking(context.Background(), nil)
+		analysis, err := engine.AnalyzeFailure(ctx, failureCtx)
+		require.NoError(t, err)
+
+		chunks, analyses := analysisRequests(llm.requests)
+		require.Len(t, chunks, 10)
+		withError := 0
+		for i, prompt := range chunks {
+			assert.True(t, strings.HasPrefix(prompt, fmt.Sprintf("## Build Log Part %d of 10\n", i+1)))
+			assert.LessOrEqual(t, len(prompt), 8000+500, "the prompt holds one chunk")
+			if strings.Contains(prompt, middleLogError) {
+				withError++
+			}
+		}
+		assert.Equal(t, 1, withError)
+		for _, req := range llm.requests[:len(chunks)] {
+			assert.Equal(t, "gpt-4o-mini", req.Model, "chunks are summarized by the analysis model")
+		}
+
+		require.Len(t, analyses, 1)
+		assert.Contains(t, analyses[0], middleLogError, "the middle of the log reaches the analysis")
+		assert.Contains(t, analyses[0], "Process completed with exit code 1.", "the error lines are kept")
+		assert.Contains(t, analyses[0], "**Log Summaries**")
+		assert.NotContains(t, analyses[0], "[TRUNCATED]")
+		assert.NotContains(t, analyses[0], "step 0600: compiling", "the raw logs are left out")
+
+		stats, ok := analysis.Metadata["log_chunking"].(LogChunkingStats)
+		require.True(t, ok)
+		assert.Equal(t, len(logs), stats.LogBytes)
+		assert.Equal(t, 10, stats.Chunks)
+		assert.Equal(t, 10, stats.Summarized)
+		assert.Equal(t, 11, stats.LLMCalls)
+		assert.Equal(t, 21, stats.MaxLLMCalls)
+		assert.Equal(t, 10, stats.Usage.Requests)
+		assert.Equal(t, 11000, stats.Usage.TotalTokens)
+		assert.Equal(t, 11, usage.total().Requests, "summaries count toward the analysis's usage")
+		assert.Equal(t, []string{"gpt-4o-mini", "gpt-4o"}, analysis.ModelsUsed)
+		require.Len(t, analysis.Interactions, 11)
+		assert.Equal(t, InteractionLogChunkSummary, analysis.Interactions[0].Stage)
+		assert.Equal(t, InteractionAnalysis, analysis.Interactions[10].Stage)
+	})
+
+	t.Run("Capped", func(t *testing.T) {
+		llm := chunkSummarizingLLM(nil)
+		analysis, err := chunkingEngine(llm, LogChunking{Enabled: true, ChunkBytes: 4000, MaxChunks: 2}).AnalyzeFailure(context.Background(), failureCtx)
+		require.NoError(t, err)
+		chunks, analyses := analysisRequests(llm.requests)
+		assert.Len(t, chunks, 2)
+		assert.Contains(t, analyses[0], middleLogError, "the chunks with error lines are summarized")
+		stats := analysis.Metadata["log_chunking"].(LogChunkingStats)
+		assert.Greater(t, stats.Chunks, 2)
+		assert.Equal(t, 2, stats.Summarized)
+		assert.Equal(t, 3, stats.LLMCalls)
+		assert.LessOrEqual(t, stats.LLMCalls, stats.MaxLLMCalls)
+	})
+
+	t.Run("SummaryFailure", func(t *testing.T) {
+		llm := chunkSummarizingLLM(errors.New("rate limited"))
+		analysis, err := chunkingEngine(llm, LogChunking{Enabled: true, ChunkBytes: 8000}).AnalyzeFailure(context.Background(), failureCtx)
+		require.NoError(t, err)
+		_, analyses := analysisRequests(llm.requests)
+		assert.Contains(t, analyses[0], middleLogError, "a failed chunk is represented by its error lines")
+		stats := analysis.Metadata["log_chunking"].(LogChunkingStats)
+		assert.Equal(t, 1, stats.Failed)
+		assert.Equal(t, DefaultLogChunkMaxChunks-1, stats.Summarized)
+	})
+
+	t.Run("BelowFactor", func(t *testing.T) {
+		llm := chunkSummarizingLLM(nil)
+		analysis, err := chunkingEngine(llm, LogChunking{Enabled: true, Factor: 10}).AnalyzeFailure(context.Background(), failureCtx)
+		require.NoError(t, err)
+		chunks, _ := analysisRequests(llm.requests)
+		assert.Empty(t, chunks, "60KB is below 10 times the prompt budget")
+		assert.NotContains(t, analysis.Metadata, "log_chunking")
+	})
+}
+
+// TestLogChunkingValidate tests validating log chunking settings
+func TestLogChunkingValidate(t *testing.T) {
+	assert.NoError(t, LogChunking{}.validate())
+	assert.NoError(t, LogChunking{Enabled: true, Factor: 2, ChunkBytes: 4000, OverlapLines: -1, MaxChunks: 3}.validate())
+	assert.Error(t, LogChunking{Factor: 0.5}.validate())
+	assert.Error(t, LogChunking{ChunkBytes: -1}.validate())
+	assert.Error(t, LogChunking{MaxChunks: -1}.validate())
+
+	defaults := LogChunking{OverlapLines: -1}.withDefaults()
+	assert.Equal(t, 0, defaults.OverlapLines)
+	assert.Equal(t, float64(DefaultLogChunkFactor), defaults.Factor)
+}
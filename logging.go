@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Log formats of WithLogFormat and the CLI's logging.format setting
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// configureLogger applies a log level such as "debug" and a log format to logger. Empty values
+// keep the logger's current setting; invalid ones are returned as errors and leave it unchanged.
+func configureLogger(logger *logrus.Logger, level, format string) error {
+	var errs []error
+	if level != "" {
+		parsed, err := logrus.ParseLevel(level)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unknown log level %q", level))
+		} else {
+			logger.SetLevel(parsed)
+		}
+	}
+	switch format {
+	case "":
+	case LogFormatJSON:
+		logger.SetFormatter(&logrus.JSONFormatter{})
+	case LogFormatText:
+		logger.SetFormatter(&logrus.TextFormatter{})
+	default:
+		errs = append(errs, fmt.Errorf("unknown log format %q, expected %s or %s", format, LogFormatJSON, LogFormatText))
+	}
+	return errors.Join(errs...)
+}
+
+// validateLogOptions checks a log level and format without applying them
+func validateLogOptions(level, format string) error {
+	return configureLogger(logrus.New(), level, format)
+}
+
+// logFormat returns the format logger writes entries in
+func logFormat(logger *logrus.Logger) string {
+	if _, ok := logger.Formatter.(*logrus.TextFormatter); ok {
+		return LogFormatText
+	}
+	return LogFormatJSON
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loggingAgent returns an initialized agent writing its logs to a buffer, whose GitHub and LLM
+// clients are real clients talking to mock servers with the logger the agent gives them
+func loggingAgent(t *testing.T, level, format string) (*DaggerAutofix, *bytes.Buffer) {
+	oldGH, oldLLM := newGitHubIntegration, newLLMClient
+	t.Cleanup(func() { newGitHubIntegration, newLLMClient = oldGH, oldLLM })
+
+	gh, mux := newMockGitHubAPI(t)
+	mux.HandleFunc("/repos/owner/repo/actions/runs/7", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":7,"name":"CI","status":"completed","conclusion":"failure"}`)
+	})
+	llmServer := createMockServer(t, OpenAI, false)
+	t.Cleanup(llmServer.Close)
+
+	newGitHubIntegration = func(ctx context.Context, token *dagger.Secret, owner, name string, endpoints *GitHubEndpoints, logger *logrus.Logger) (*GitHubIntegration, error) {
+		gh.logger = logger
+		return gh, nil
+	}
+	newLLMClient = func(ctx context.Context, provider LLMProvider, apiKey *dagger.Secret, logger *logrus.Logger) (*LLMClient, error) {
+		return &LLMClient{
+			provider:   provider,
+			apiKey:     "sk-test",
+			baseURL:    llmServer.URL,
+			httpClient: llmServer.Client(),
+			logger:     logger,
+			config:     getDefaultConfig(provider),
+		}, nil
+	}
+
+	var buf bytes.Buffer
+	m := New().
+		WithGitHubToken(createTestSecret("token", "ghp_test")).
+		WithLLMProvider("openai", createTestSecret("key", "sk-test")).
+		WithRepository("owner", "repo").
+		WithDryRun(true).
+		WithLogLevel(level).
+		WithLogFormat(format)
+	m.logger.SetOutput(&buf)
+	m, err := m.Initialize(context.Background())
+	require.NoError(t, err)
+	return m, &buf
+}
+
+// TestModuleLogLevel tests that the module's log level reaches the GitHub integration and the
+// LLM client
+func TestModuleLogLevel(t *testing.T) {
+	ctx := context.Background()
+
+	m, buf := loggingAgent(t, "debug", "json")
+	_, err := m.githubClient.GetWorkflowRun(ctx, 7)
+	require.NoError(t, err)
+	_, err = m.llmClient.Chat(ctx, &LLMRequest{Prompt: "Hello"})
+	require.NoError(t, err)
+
+	assert.Contains(t, buf.String(), `"msg":"GitHub API call completed"`)
+	assert.Contains(t, buf.String(), `"path":"/repos/owner/repo/actions/runs/7"`)
+	assert.Contains(t, buf.String(), `"msg":"LLM request completed"`)
+	assert.Contains(t, buf.String(), `"level":"debug"`)
+	assert.Contains(t, buf.String(), `"repo":"repo"`, "entries carry the repository fields")
+
+	// The default info level leaves debug entries out
+	m, buf = loggingAgent(t, "", "text")
+	_, err = m.githubClient.GetWorkflowRun(ctx, 7)
+	require.NoError(t, err)
+	_, err = m.llmClient.Chat(ctx, &LLMRequest{Prompt: "Hello"})
+	require.NoError(t, err)
+
+	assert.Contains(t, buf.String(), `msg="DaggerAutofix initialized successfully"`)
+	assert.NotContains(t, buf.String(), "GitHub API call completed")
+	assert.NotContains(t, buf.String(), "LLM request completed")
+}
+
+// TestConfigureLogger tests applying and validating log levels and formats
+func TestConfigureLogger(t *testing.T) {
+	logger := logrus.New()
+	require.NoError(t, configureLogger(logger, "warn", LogFormatText))
+	assert.Equal(t, logrus.WarnLevel, logger.GetLevel())
+	assert.Equal(t, LogFormatText, logFormat(logger))
+
+	// Empty values keep the current settings
+	require.NoError(t, configureLogger(logger, "", ""))
+	assert.Equal(t, logrus.WarnLevel, logger.GetLevel())
+	assert.Equal(t, LogFormatText, logFormat(logger))
+
+	err := configureLogger(logger, "loud", "xml")
+	assert.ErrorContains(t, err, `unknown log level "loud"`)
+	assert.ErrorContains(t, err, `unknown log format "xml", expected json or text`)
+	assert.Equal(t, logrus.WarnLevel, logger.GetLevel())
+	assert.Equal(t, LogFormatText, logFormat(logger))
+
+	m := New().
+		WithGitHubToken(createTestSecret("token", "ghp_test")).
+		WithLLMProvider("openai", createTestSecret("key", "sk-test")).
+		WithRepository("owner", "repo").
+		WithLogLevel("loud")
+	_, err = m.Initialize(context.Background())
+	assert.ErrorContains(t, err, `configuration validation failed: unknown log level "loud"`)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultLogRetention is how long GitHub keeps the logs of workflow runs unless the repository
+// or organization configured a different retention
+const defaultLogRetention = 90 * 24 * time.Hour
+
+// Classification tags of analyses of runs whose logs GitHub no longer serves
+const (
+	TagInsufficientData = "insufficient-data"
+	TagLogsExpired      = "logs-expired"
+)
+
+// logsExpiry dates a LogsUnavailableError of run: logs that are gone past the default retention
+// expired then, while logs gone before it were deleted
+func logsExpiry(err *LogsUnavailableError, run *WorkflowRun, now time.Time) {
+	if err.Status != http.StatusGone || run == nil || run.UpdatedAt.IsZero() {
+		return
+	}
+	if expiry := run.UpdatedAt.Add(defaultLogRetention); expiry.Before(now) {
+		err.ExpiredAt = expiry
+	}
+}
+
+// logsUnavailableAnalysis returns the analysis of a run whose logs expired or were deleted when
+// err reports that, and nil otherwise. Without logs there is nothing to send the LLM, so the
+// analysis only says so and AutoFix does not generate fixes for it.
+func (m *DaggerAutofix) logsUnavailableAnalysis(failureCtx FailureContext, err error) *FailureAnalysisResult {
+	var unavailable *LogsUnavailableError
+	if !errors.As(err, &unavailable) {
+		return nil
+	}
+	m.logger.WithField("run_id", unavailable.RunID).Warnf("Skipping the analysis, %s", unavailable)
+	return &FailureAnalysisResult{
+		ID: fmt.Sprintf("analysis-%d-logs-unavailable", unavailable.RunID),
+		Classification: FailureClassification{
+			Type:     UnknownFailure,
+			Severity: UnknownSeverity,
+			Category: UnknownCategory,
+			Tags:     []string{TagInsufficientData, TagLogsExpired},
+		},
+		RootCause: unavailable.Error(),
+		Description: "GitHub no longer serves the logs of this run, so the failure was not analyzed. " +
+			"Re-run the workflow to analyze its new attempt, or analyze a saved copy of the log with analyze --from-file.",
+		Context:   failureCtx,
+		Timestamp: time.Now(),
+		Metadata: map[string]interface{}{
+			"insufficient_data": true,
+			"logs_unavailable":  unavailable.Error(),
+		},
+	}
+}
+
+// insufficientData reports whether analysis was made without the logs of the run
+func insufficientData(analysis *FailureAnalysisResult) bool {
+	if analysis == nil {
+		return false
+	}
+	missing, _ := analysis.Metadata["insufficient_data"].(bool)
+	return missing
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expiredLogsAPI mocks run 7, completed on 2024-01-02, whose jobs' logs GitHub answers with
+// status, and run 8 whose first job's logs are gone while the second's are served
+func expiredLogsAPI(t *testing.T, status int) *GitHubIntegration {
+	g, mux := newMockGitHubAPI(t)
+	mux.HandleFunc("/repos/owner/repo/actions/runs/7", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": 7, "name": "CI", "status": "completed", "conclusion": "failure", "updated_at": "2024-01-02T03:04:05Z"}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/7/jobs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count": 2, "jobs": [{"id": 70, "name": "test", "conclusion": "failure"}, {"id": 71, "name": "lint", "conclusion": "failure"}]}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/8/jobs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"total_count": 2, "jobs": [{"id": 70, "name": "test", "conclusion": "failure"}, {"id": 80, "name": "lint", "conclusion": "failure"}]}`)
+	})
+	for _, job := range []string{"70", "71"} {
+		mux.HandleFunc("/repos/owner/repo/actions/jobs/"+job+"/logs", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			fmt.Fprint(w, `{"message": "Gone"}`)
+		})
+	}
+	mux.HandleFunc("/repos/owner/repo/actions/jobs/80/logs", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://logs.example.com/80", http.StatusFound)
+	})
+	return g
+}
+
+// TestGetWorkflowLogsUnavailable tests that runs whose job logs are all gone report
+// ErrLogsUnavailable, while runs with some logs left are analyzed from those
+func TestGetWorkflowLogsUnavailable(t *testing.T) {
+	for _, status := range []int{http.StatusGone, http.StatusNotFound} {
+		g := expiredLogsAPI(t, status)
+		_, err := g.GetWorkflowLogs(context.Background(), 7)
+		assert.ErrorIs(t, err, ErrLogsUnavailable)
+		var unavailable *LogsUnavailableError
+		require.ErrorAs(t, err, &unavailable)
+		assert.Equal(t, &LogsUnavailableError{RunID: 7, Status: status}, unavailable)
+		assert.EqualError(t, err, "logs for run 7 were deleted or have expired")
+	}
+
+	logs, err := expiredLogsAPI(t, http.StatusGone).GetWorkflowLogs(context.Background(), 8)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"lint"}, logs.FailedJobs)
+}
+
+// TestLogsExpiry tests dating logs that are gone past the default retention
+func TestLogsExpiry(t *testing.T) {
+	completed := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	run := &WorkflowRun{ID: 7, UpdatedAt: completed}
+
+	expired := &LogsUnavailableError{RunID: 7, Status: http.StatusGone}
+	logsExpiry(expired, run, completed.Add(100*24*time.Hour))
+	assert.Equal(t, "logs for run 7 expired on 2024-04-01", expired.Error())
+
+	deleted := &LogsUnavailableError{RunID: 7, Status: http.StatusGone}
+	logsExpiry(deleted, run, completed.Add(24*time.Hour))
+	assert.True(t, deleted.ExpiredAt.IsZero(), "logs gone within the retention were deleted")
+
+	missing := &LogsUnavailableError{RunID: 7, Status: http.StatusNotFound}
+	logsExpiry(missing, run, completed.Add(100*24*time.Hour))
+	assert.True(t, missing.ExpiredAt.IsZero())
+}
+
+// noLLMEngine returns a failure analysis engine whose LLM fails the test when asked anything
+func noLLMEngine(t *testing.T) (*FailureAnalysisEngine, *scriptedLLMClient) {
+	llm := &scriptedLLMClient{chatFunc: func(req *LLMRequest) (*LLMResponse, error) {
+		t.Errorf("unexpected LLM request: %s", req.Prompt)
+		return nil, errors.New("unexpected LLM request")
+	}}
+	return NewFailureAnalysisEngine(llm, quietLogger()), llm
+}
+
+// TestAnalyzeFailureLogsExpired tests that runs whose logs expired are reported as such
+// without an LLM request
+func TestAnalyzeFailureLogsExpired(t *testing.T) {
+	engine, llm := noLLMEngine(t)
+	m := &DaggerAutofix{githubClient: expiredLogsAPI(t, http.StatusGone), failureEngine: engine, logger: quietLogger()}
+
+	analysis, err := m.AnalyzeFailure(context.Background(), 7)
+	require.NoError(t, err)
+	assert.Empty(t, llm.requests)
+	assert.True(t, insufficientData(analysis))
+	assert.Equal(t, UnknownFailure, analysis.Classification.Type)
+	assert.Zero(t, analysis.Classification.Confidence)
+	assert.Equal(t, []string{TagInsufficientData, TagLogsExpired}, analysis.Classification.Tags)
+	assert.Equal(t, "logs for run 7 expired on 2024-04-01", analysis.RootCause)
+	assert.Equal(t, int64(7), analysis.Context.WorkflowRun.ID)
+
+	analyses, err := m.AnalyzeFailureJobs(context.Background(), 7)
+	require.NoError(t, err)
+	require.Len(t, analyses, 1)
+	assert.True(t, insufficientData(analyses[0]))
+	assert.Empty(t, llm.requests)
+
+	assert.False(t, insufficientData(&FailureAnalysisResult{}))
+}
+
+// TestAutoFixLogsExpired tests that AutoFix generates no fix and opens no pull request for a
+// run whose logs expired
+func TestAutoFixLogsExpired(t *testing.T) {
+	var prFixes []*FixValidationResult
+	m := fixtureAutofix(&prFixes)
+	m.githubClient = expiredLogsAPI(t, http.StatusGone)
+	engine, llm := noLLMEngine(t)
+	m.failureEngine = engine
+
+	result, err := m.AutoFix(context.Background(), 7)
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Nil(t, result.PullRequest)
+	assert.Empty(t, prFixes)
+	assert.Empty(t, llm.requests)
+	assert.Equal(t, true, result.Metadata["insufficient_data"])
+	assert.Equal(t, "logs for run 7 expired on 2024-04-01", result.Metadata["logs_unavailable"])
+	assert.Equal(t, 0, result.Metadata["fixes_generated"])
+}
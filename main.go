@@ -4,20 +4,67 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
+	"sync"
 	"time"
 
 	"dagger.io/dagger"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Interfaces for dependency injection
+
+// agentVersion is the version of the agent, printed by --version and recorded in the metadata
+// of fix PRs
+const agentVersion = "1.0.0"
+
+// GitHubClient is every GitHub operation the agent and its pull request engine need. It is
+// implemented by GitHubIntegration with the REST API and by MCPGitHubClient with an MCP server.
 type GitHubClient interface {
+	// Workflow runs
 	GetWorkflowRun(ctx context.Context, runID int64) (*WorkflowRun, error)
 	GetWorkflowLogs(ctx context.Context, runID int64) (*WorkflowLogs, error)
+	GetWorkflowRunAttempt(ctx context.Context, runID int64, attempt int) (*WorkflowRun, error)
+	GetWorkflowRunAttemptLogs(ctx context.Context, runID int64, attempt int) (*WorkflowLogs, error)
+	GetJobRunID(ctx context.Context, jobID int64) (int64, error)
+	GetCheckRunAnnotations(ctx context.Context, runID int64) ([]Annotation, error)
+	GetWorkflowDefinition(ctx context.Context, runID int64) (string, string, error)
 	GetFailedWorkflowRuns(ctx context.Context) ([]*WorkflowRun, error)
+	GetSuccessfulWorkflowRuns(ctx context.Context, branch, sha string, since time.Time) ([]*WorkflowRun, error)
+	GetCommitWorkflowRuns(ctx context.Context, branch, sha string, since time.Time) ([]*WorkflowRun, error)
+	GetRecentWorkflowRuns(ctx context.Context, workflowID int64, branch string, limit int) ([]*WorkflowRun, error)
+	RerunWorkflowFailedJobs(ctx context.Context, runID int64) error
+	WaitForWorkflowRun(ctx context.Context, runID int64, minAttempt int, timeout time.Duration) (*WorkflowRun, error)
+
+	// Repository content and branches
+	GetRepositoryContext(ctx context.Context) (*RepositoryContext, error)
+	GetBaseBranchHead(ctx context.Context) (string, string, error)
+	GetFileContent(ctx context.Context, path, ref string) (string, bool, error)
+	ListDirectory(ctx context.Context, path, ref string) ([]string, error)
+	GetLanguages(ctx context.Context) (map[string]int, error)
+	CreateBranch(ctx context.Context, branch, baseBranch string) error
+	DeleteBranch(ctx context.Context, branch string) error
 	CreateTestBranch(ctx context.Context, branchName string, changes []CodeChange) (func(), error)
+	CommitChanges(ctx context.Context, branch, parentSHA string, changes []CodeChange, message string) (string, error)
+
+	// Pull requests and comments
+	ListOpenPullRequests(ctx context.Context, labels []string) ([]*PullRequest, error)
+	CreatePullRequest(ctx context.Context, opts *PRCreationOptions) (*PullRequest, error)
+	GetPullRequest(ctx context.Context, number int) (*PullRequest, error)
+	UpdatePullRequest(ctx context.Context, number int, update PullRequestUpdate) (*PullRequest, error)
+	ClosePullRequest(ctx context.Context, number int) error
+	AddPullRequestComment(ctx context.Context, number int, body string) error
+	CreateCommitComment(ctx context.Context, sha, body string) error
+	FindPullRequestForCommit(ctx context.Context, sha string) (*PullRequest, error)
+	ListPullRequestFiles(ctx context.Context, number int) ([]FileChange, error)
+	CreateReviewComment(ctx context.Context, number int, comment ReviewComment) error
+
+	// Code scanning
+	UploadSARIF(ctx context.Context, commitSHA, ref string, sarif []byte) (string, error)
 }
 
 type FailureEngine interface {
@@ -26,26 +73,188 @@ type FailureEngine interface {
 }
 
 type TestRunner interface {
-	RunTests(ctx context.Context, owner, repo, branch string) (*TestResult, error)
+	RunTests(ctx context.Context, owner, repo, branch string, steps ...ValidationStep) (*TestResult, error)
+	RunTestsWithChanges(ctx context.Context, source *dagger.Directory, changes []CodeChange, steps ...ValidationStep) (*TestResult, error)
+	GenerateTestsForFix(ctx context.Context, fix *ProposedFix, analysis *FailureAnalysisResult) ([]CodeChange, error)
+	DetectFrameworks(ctx context.Context, source *dagger.Directory) ([]*TestFramework, error)
+	ReadSourceFile(ctx context.Context, source *dagger.Directory, name string) (string, bool, error)
+	SourceCommit(ctx context.Context, source *dagger.Directory) (string, error)
+	RegenerateFile(ctx context.Context, source *dagger.Directory, changes []CodeChange, generated GeneratedFile, file string) (string, bool, error)
 }
 
 type PREngine interface {
-	CreateFixPR(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult) (*PullRequest, error)
+	CreateFixPRWithOptions(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error)
+	LinkRelatedPRs(ctx context.Context, prs []*PullRequest) error
+	PreviewFixPR(analysis *FailureAnalysisResult, fix *FixValidationResult) *PRCreationOptions
+	GetPRStatus(ctx context.Context, prNumber int) (*PullRequest, error)
+	ClosePR(ctx context.Context, prNumber int, reason string) error
+}
+
+// DependencyFixer proposes deterministic fixes for dependency failures
+type DependencyFixer interface {
+	ResolveDependencyFix(ctx context.Context, source *dagger.Directory, analysis *FailureAnalysisResult) (*ProposedFix, error)
 }
 
 // DaggerAutofix represents the main Dagger module for GitHub Actions auto-fixing
 type DaggerAutofix struct {
 	// Source directory for the project
 	Source *dagger.Directory
+	// SourceCommit is the commit Source holds, read from its git metadata when empty
+	SourceCommit string
 
 	// Configuration
-	GitHubToken  *dagger.Secret
-	LLMProvider  LLMProvider
-	LLMAPIKey    *dagger.Secret
-	RepoOwner    string
-	RepoName     string
-	TargetBranch string
-	MinCoverage  int
+	GitHubToken     *dagger.Secret
+	GitHubApp       *GitHubAppConfig
+	GitHubAPIURL    string
+	GitHubUploadURL string
+	LLMProvider     LLMProvider
+	LLMAPIKey       *dagger.Secret
+	RepoOwner       string
+	RepoName        string
+	TargetBranch    string
+	MinCoverage     int
+
+	// GitHubRateLimitRetries is how many times a rate limited GitHub API call is retried
+	GitHubRateLimitRetries int
+
+	// Repositories are further "owner/name" repositories MonitorWorkflows watches
+	Repositories []string
+	// Organization has its repositories passing RepoFilter discovered and monitored as well
+	Organization string
+	RepoFilter   RepoFilter
+	// LogsOnly initializes the agent without GitHub, for AnalyzeLogText, AnalyzeLocal and
+	// FixLocal; GitHub credentials and a repository are then optional
+	LogsOnly bool
+
+	// Failure discovery
+	FailureLookback     time.Duration
+	MaxFailedRuns       int
+	WorkflowFilter      []string
+	IncludeTimedOutRuns bool
+	// DisableFailureClustering fixes every failed run on its own instead of once per failure
+	// fingerprint
+	DisableFailureClustering bool
+
+	// Fix scheduling
+	MaxConcurrentFixes     int
+	MaxParallelValidations int
+	FixTimeout             time.Duration
+	DrainTimeout           time.Duration
+	// RunClaimLease is how long a run claimed for fixing stays reserved when its fix does
+	// not complete
+	RunClaimLease    time.Duration
+	DryRun                 bool
+	AnalysisComments       bool
+
+	// Pull request selection
+	FixStrategy    FixStrategy
+	DraftThreshold float64
+	PRPolicy       PRPolicy
+	PRDefaults     PRDefaults
+	// AllowedFixTypes restricts the types of the fixes generated for each failure type
+	AllowedFixTypes FixTypeConstraints
+	// PRCommentMode decides whether fixes for failed pull_request runs are commented on the
+	// pull request or opened as new pull requests
+	PRCommentMode PRCommentMode
+	// CommitTemplate is the text/template for fix commit messages, executed with CommitMessageData
+	CommitTemplate string
+	// GeneratedTests adds LLM-generated tests to the selected fix when they pass validation
+	GeneratedTests bool
+	// StateFile persists the fix PRs opened per workflow run and their outcomes across restarts
+	StateFile string
+
+	// TestTimeouts bounds each stage of fix validation; unset stages use the defaults
+	TestTimeouts TestTimeouts
+	// TestPaths restricts validation to frameworks detected in these directories
+	TestPaths []string
+	// DisableTestCache skips the dependency cache volumes shared between test runs
+	DisableTestCache bool
+	// TestContainerImage replaces every framework's toolchain image when set
+	TestContainerImage string
+	// TestContainerEnv is set in every test container, e.g. proxy variables
+	TestContainerEnv map[string]string
+	// TestContainerSecrets are exposed to every test container as secret variables
+	TestContainerSecrets map[string]*dagger.Secret
+	// TestNetwork is the network policy of the repository's commands in test containers
+	TestNetwork TestNetwork
+	// AllowTestPublish lets the repository's test commands publish packages and images
+	AllowTestPublish bool
+	// CoveragePolicy decides whether fixes meet MinCoverage, keep the base branch's coverage, or either
+	CoveragePolicy CoveragePolicy
+	// CoverageTolerance is how many percentage points coverage may drop under the delta policy
+	CoverageTolerance float64
+	// RequireCoverage rejects fixes whose coverage could not be measured instead of judging
+	// them by their tests alone
+	RequireCoverage bool
+	// MetricsAddr is where MonitorWorkflows serves Prometheus metrics; empty disables the server
+	MetricsAddr string
+	// NotificationWebhook receives fix lifecycle notifications; NotificationFormat selects the
+	// payload, detecting Slack incoming webhooks when empty
+	NotificationWebhook *dagger.Secret
+	NotificationFormat  string
+	// AuditLog is the JSON lines file recording every action the agent takes; empty disables it
+	AuditLog string
+	// RedactionPatterns are regular expressions masked in logs, prompts and test output in
+	// addition to the built-in credential patterns
+	RedactionPatterns []string
+	// AllowedPaths are the only repository path prefixes fixes may change, all paths when
+	// empty; DeniedPaths are prefixes they may never change
+	AllowedPaths []string
+	DeniedPaths  []string
+	// FixGuardrails limit how many files and lines a fix may change and protect paths from
+	// fixes altogether; fixes exceeding them are rejected or only get drafts or comments
+	FixGuardrails FixGuardrails
+	// ContextPolicy selects the repository files the fix generation prompt includes
+	ContextPolicy ContextPolicy
+	// FileClassification adds binary files, which fixes may not change, and generated files,
+	// which validation regenerates, to the built-in ones
+	FileClassification FileClassification
+	// LogChunking summarizes logs too long for the analysis prompt in chunks
+	LogChunking LogChunking
+	// LLMCache reuses responses to identical LLM requests for LLMCacheTTL, keeping them in
+	// LLMCacheDir when set and in memory otherwise
+	LLMCache    bool
+	LLMCacheDir string
+	LLMCacheTTL time.Duration
+	// LLMPricing overrides the built-in per-provider prices used to estimate LLM cost
+	LLMPricing []LLMPrice
+	// LLMHeaders are extra headers sent with every LLM request, e.g. for a gateway or
+	// OpenAI's organization and project attribution
+	LLMHeaders []LLMHeader
+	// FlakyRetry re-runs the failed jobs of failures that look flaky before analyzing them;
+	// FlakyRetryMaxAge is how recent a success on the same commit must be to count as flaky
+	FlakyRetry       bool
+	FlakyRetryMaxAge time.Duration
+	// RunPollInterval is how often workflow runs are checked while waiting for them to
+	// complete, e.g. by analyze --watch
+	RunPollInterval time.Duration
+	// SARIFUpload uploads the analyses of failures to code scanning for the failing commit
+	SARIFUpload bool
+	// VerificationTimeout is how long after a fix PR merged its workflow has to succeed at
+	// the merge commit for the fix to be verified; FollowUpAnalysis analyzes the run when
+	// it failed again
+	VerificationTimeout time.Duration
+	FollowUpAnalysis    bool
+	// FixHistory is the JSON file remembering the fix PRs opened per failure fingerprint, so
+	// recurring failures reuse the fix that was merged; empty disables it
+	FixHistory string
+	// AnalysisModel and FixModel override the provider's model for the failure analysis and
+	// the fix generation requests. An analysis by AnalysisModel whose confidence is below
+	// EscalationConfidence is re-run once with FixModel.
+	AnalysisModel        string
+	FixModel             string
+	EscalationConfidence float64
+	// PromptDir, or PromptDirectory when set, overrides the built-in prompt templates with
+	// the files of the same name in it, such as failure_analysis.tmpl or fix_generation.tmpl
+	PromptDir       string
+	PromptDirectory *dagger.Directory
+	// PromptCapture keeps the redacted prompts and responses of each analysis's LLM requests
+	// in its Interactions and, with an audit log or state file, in files beside it
+	PromptCapture bool
+	// LogLevel and LogFormat configure the logger the agent and all of its components share;
+	// empty values keep info level JSON logs
+	LogLevel  string
+	LogFormat string
 	
 	// MCP Configuration
 	MCPEnabled     bool
@@ -58,14 +267,71 @@ type DaggerAutofix struct {
 	failureEngine FailureEngine
 	testEngine    TestRunner
 	prEngine      PREngine
+	notifier      Notifier
+	auditLog      *AuditLogger
+	redactor      *Redactor
+	usage         *usageTracker // LLM usage since the agent was initialized
+	progress      func(ProgressEvent)
+
+	poolMu  sync.Mutex
+	fixPool *fixWorkerPool
+	stats   fixStats
+
+	commentMu     sync.Mutex
+	commentedRuns map[int64]bool
+
+	sourceCommitMu sync.Mutex
+	sourceHead     *string // commit read from Source's git metadata
+
+	baseCoverageMu sync.Mutex
+	baseCoverage   map[string]*coverageBaseline // keyed by base commit SHA
+
+	profileMu sync.Mutex
+	profiles  map[string]repositoryProfile // keyed by repository and default branch head SHA
+
+	repoConfigMu sync.Mutex
+	repoConfigs  map[string]*RepoConfig // keyed by repository and base branch head SHA
+
+	trackerMu sync.Mutex
+	tracker   *prTracker
+
+	history *fixHistory
+
+	prompts *PromptTemplates
+
+	testBranches testBranchRegistry
+
+	health monitorHealth
+
+	dependencies DependencyFixer
+
+	// Agents of the monitored repositories when there are several and the last organization
+	// discovery, guarded by reposMu
+	reposMu      sync.Mutex
+	repositories []*DaggerAutofix
+	discovery    *RepositoryDiscovery
+
+	// The agent and workflow run of each queued run and the runs an agent already submitted,
+	// guarded by poolMu
+	queuedRuns    map[int64]queuedRun
+	processedRuns map[int64]bool
+	// Runs claimed by polling or event dispatch, so each is fixed once
+	runClaims runClaims
+	// The runs clustered with each submitted run and the run submitted per failure
+	// fingerprint within the failure lookback, guarded by poolMu
+	clusteredRuns  map[int64][]*WorkflowRun
+	recentFailures map[string]clusteredFailure
 }
 
 var (
 	newGitHubIntegration     = NewGitHubIntegration
+	newGitHubAppIntegration  = NewGitHubAppIntegration
 	newLLMClient             = NewLLMClient
 	newFailureAnalysisEngine = NewFailureAnalysisEngine
+	newDependencyResolver    = NewDependencyResolver
 	newTestEngine            = NewTestEngine
 	newPullRequestEngine     = NewPullRequestEngine
+	newNotifier              = NewNotifier
 	newTicker                = time.NewTicker
 )
 
@@ -85,17 +351,39 @@ func New(source ...*dagger.Directory) *DaggerAutofix {
 	}
 
 	return &DaggerAutofix{
-		Source:       sourceDir,
-		LLMProvider:  OpenAI, // default provider
-		TargetBranch: "main",
-		MinCoverage:  85,
-		logger:       logger,
+		Source:                 sourceDir,
+		LLMProvider:            OpenAI, // default provider
+		MinCoverage:            85,
+		GitHubRateLimitRetries: MaxRetries,
+		MaxConcurrentFixes:     DefaultMaxConcurrentFixes,
+		MaxParallelValidations: DefaultMaxParallelValidations,
+		FixTimeout:             DefaultFixTimeout,
+		DrainTimeout:           DefaultDrainTimeout,
+		RunClaimLease:          DefaultRunClaimLease,
+		FixStrategy:            FixStrategyBest,
+		DraftThreshold:         DefaultDraftThreshold,
+		CoveragePolicy:         CoveragePolicyAbsolute,
+		CoverageTolerance:      DefaultCoverageTolerance,
+		EscalationConfidence:   DefaultEscalationConfidence,
+		logger:                 logger,
 	}
 }
 
 // WithSource configures the source directory
 func (m *DaggerAutofix) WithSource(source *dagger.Directory) *DaggerAutofix {
 	m.Source = source
+	m.sourceCommitMu.Lock()
+	m.sourceHead = nil
+	m.sourceCommitMu.Unlock()
+	return m
+}
+
+// WithSourceCommit names the commit the source directory holds, e.g. when it has no git
+// metadata. Fixes of a failed run are validated against the source directory only when it
+// holds the commit that failed; otherwise a test branch of the repository is pushed and
+// cloned.
+func (m *DaggerAutofix) WithSourceCommit(sha string) *DaggerAutofix {
+	m.SourceCommit = sha
 	return m
 }
 
@@ -105,6 +393,260 @@ func (m *DaggerAutofix) WithGitHubToken(token *dagger.Secret) *DaggerAutofix {
 	return m
 }
 
+// WithGitHubApp configures GitHub App authentication as an alternative to a personal access token.
+// Installation tokens are minted from the app's private key and refreshed before they expire.
+func (m *DaggerAutofix) WithGitHubApp(appID int64, installationID int64, privateKey *dagger.Secret) *DaggerAutofix {
+	m.GitHubApp = &GitHubAppConfig{
+		AppID:          appID,
+		InstallationID: installationID,
+		PrivateKey:     privateKey,
+	}
+	return m
+}
+
+// WithGitHubBaseURL targets a GitHub Enterprise Server instance instead of github.com.
+// The upload URL may be empty, in which case it is derived from the API URL's host.
+func (m *DaggerAutofix) WithGitHubBaseURL(apiURL, uploadURL string) *DaggerAutofix {
+	m.GitHubAPIURL = apiURL
+	m.GitHubUploadURL = uploadURL
+	return m
+}
+
+// WithRateLimitRetries configures how many times GitHub API calls are retried after hitting a rate limit
+func (m *DaggerAutofix) WithRateLimitRetries(retries int) *DaggerAutofix {
+	m.GitHubRateLimitRetries = retries
+	return m
+}
+
+// WithFailureLookback limits failure discovery to workflow runs created within the given window
+func (m *DaggerAutofix) WithFailureLookback(lookback time.Duration) *DaggerAutofix {
+	m.FailureLookback = lookback
+	return m
+}
+
+// WithFailureClustering sets whether failed runs with the same failure fingerprint are fixed
+// once, through the newest of them (default: enabled). Disabled, each run is fixed on its own.
+func (m *DaggerAutofix) WithFailureClustering(enabled bool) *DaggerAutofix {
+	m.DisableFailureClustering = !enabled
+	return m
+}
+
+// WithMaxFailedRuns caps how many failed workflow runs are fetched per poll
+func (m *DaggerAutofix) WithMaxFailedRuns(maxRuns int) *DaggerAutofix {
+	m.MaxFailedRuns = maxRuns
+	return m
+}
+
+// WithWorkflowFilter restricts failure discovery to the given workflow file names (e.g. ci.yml)
+func (m *DaggerAutofix) WithWorkflowFilter(names ...string) *DaggerAutofix {
+	m.WorkflowFilter = names
+	return m
+}
+
+// WithTimedOutRuns controls whether timed out workflow runs are treated as failures
+func (m *DaggerAutofix) WithTimedOutRuns(include bool) *DaggerAutofix {
+	m.IncludeTimedOutRuns = include
+	return m
+}
+
+// WithMaxConcurrentFixes limits how many auto-fix pipelines the monitor runs in parallel
+func (m *DaggerAutofix) WithMaxConcurrentFixes(n int) *DaggerAutofix {
+	m.MaxConcurrentFixes = n
+	return m
+}
+
+// WithMaxParallelValidations limits how many of a run's proposed fixes AutoFix validates at once
+func (m *DaggerAutofix) WithMaxParallelValidations(n int) *DaggerAutofix {
+	m.MaxParallelValidations = n
+	return m
+}
+
+// WithFixTimeout bounds how long a single monitored auto-fix run may take
+func (m *DaggerAutofix) WithFixTimeout(timeout time.Duration) *DaggerAutofix {
+	m.FixTimeout = timeout
+	return m
+}
+
+// WithDrainTimeout bounds how long MonitorWorkflows waits for in-flight auto-fixes when it
+// is cancelled before cancelling them too
+func (m *DaggerAutofix) WithDrainTimeout(timeout time.Duration) *DaggerAutofix {
+	m.DrainTimeout = timeout
+	return m
+}
+
+// WithRunClaimLease sets how long a failed run claimed by polling or event dispatch stays
+// reserved when its fix does not complete, after which it can be claimed again
+func (m *DaggerAutofix) WithRunClaimLease(lease time.Duration) *DaggerAutofix {
+	m.RunClaimLease = lease
+	return m
+}
+
+// WithLogsOnly initializes the agent without GitHub, so AnalyzeLogText can analyze logs from
+// other CI systems, and AnalyzeLocal and FixLocal fix the mounted source, without GitHub
+// credentials or a repository
+func (m *DaggerAutofix) WithLogsOnly(enabled bool) *DaggerAutofix {
+	m.LogsOnly = enabled
+	return m
+}
+
+// WithDryRun makes AutoFix analyze, generate and validate fixes without opening a pull request
+func (m *DaggerAutofix) WithDryRun(enabled bool) *DaggerAutofix {
+	m.DryRun = enabled
+	return m
+}
+
+// WithAnalysisComments posts the failure analysis as a commit comment when no fix can be validated
+func (m *DaggerAutofix) WithAnalysisComments(enabled bool) *DaggerAutofix {
+	m.AnalysisComments = enabled
+	return m
+}
+
+// WithFixStrategy selects which validated fixes get pull requests: "best", "all" or "draft-below"
+func (m *DaggerAutofix) WithFixStrategy(strategy string) *DaggerAutofix {
+	m.FixStrategy = FixStrategy(strings.ToLower(strategy))
+	return m
+}
+
+// WithPRCommentMode selects how fixes for failed pull_request runs are proposed: "review"
+// comments on the pull request, as a suggestion when the fix is a small change to lines it
+// changes, "comment" always posts a regular comment and "off" opens a new pull request
+func (m *DaggerAutofix) WithPRCommentMode(mode string) *DaggerAutofix {
+	m.PRCommentMode = PRCommentMode(strings.ToLower(mode))
+	return m
+}
+
+// WithDraftThreshold sets the confidence below which the draft-below strategy opens draft PRs
+func (m *DaggerAutofix) WithDraftThreshold(threshold float64) *DaggerAutofix {
+	m.DraftThreshold = threshold
+	return m
+}
+
+// WithAutoPRPolicy sets per failure type whether AutoFix opens a PR, a draft PR, or only
+// comments the analysis, plus the minimum fix confidence for opening any PR
+func (m *DaggerAutofix) WithAutoPRPolicy(policy PRPolicy) *DaggerAutofix {
+	m.PRPolicy = policy
+	return m
+}
+
+// WithAllowedFixTypes sets per failure type the only fix types AutoFix accepts, e.g.
+// TestFailure: [CodeFix] so failing tests are never fixed by changing their expectations. The
+// fix generation prompt names the allowed types and fixes of other types are dropped; when
+// every fix is dropped, AutoFix comments the analysis instead. Failure types without an entry
+// accept every fix type.
+func (m *DaggerAutofix) WithAllowedFixTypes(allowed map[FailureType][]FixType) *DaggerAutofix {
+	m.AllowedFixTypes = allowed
+	return m
+}
+
+// WithPRDefaults sets the reviewers, team reviewers, assignees and extra labels of every
+// fix PR, and whether fix PRs are opened as drafts or with auto-merge enabled
+func (m *DaggerAutofix) WithPRDefaults(opts PRDefaults) *DaggerAutofix {
+	m.PRDefaults = opts
+	return m
+}
+
+// WithCommitTemplate overrides the Conventional Commit template used for fix commits.
+// The template is a Go text/template executed with CommitMessageData.
+func (m *DaggerAutofix) WithCommitTemplate(tmpl string) *DaggerAutofix {
+	m.CommitTemplate = tmpl
+	return m
+}
+
+// WithGeneratedTests adds LLM-generated test files to the selected fix. The fix is
+// validated again with the tests, which are dropped if that validation fails.
+func (m *DaggerAutofix) WithGeneratedTests(enabled bool) *DaggerAutofix {
+	m.GeneratedTests = enabled
+	return m
+}
+
+// WithStateFile persists tracked fix PRs and their merge outcomes to path, so superseded
+// PRs are still closed and metrics survive restarts
+func (m *DaggerAutofix) WithStateFile(path string) *DaggerAutofix {
+	m.StateFile = path
+	return m
+}
+
+// WithTestTimeouts overrides the lint, build, test and coverage stage timeouts used to validate fixes
+func (m *DaggerAutofix) WithTestTimeouts(timeouts TestTimeouts) *DaggerAutofix {
+	m.TestTimeouts = timeouts
+	return m
+}
+
+// WithCoveragePolicy selects how coverage validates fixes: "absolute" requires MinCoverage,
+// "delta" requires coverage not to drop below the base branch by more than the tolerance,
+// and "either" accepts fixes that satisfy one of the two
+func (m *DaggerAutofix) WithCoveragePolicy(policy string) *DaggerAutofix {
+	m.CoveragePolicy = CoveragePolicy(strings.ToLower(policy))
+	return m
+}
+
+// WithRequireCoverage rejects fixes whose coverage could not be measured, e.g. in projects
+// without coverage tooling. By default such fixes are valid when their tests pass.
+func (m *DaggerAutofix) WithRequireCoverage(required bool) *DaggerAutofix {
+	m.RequireCoverage = required
+	return m
+}
+
+// WithCoverageTolerance sets how many percentage points coverage may drop under the delta policy
+func (m *DaggerAutofix) WithCoverageTolerance(tolerance float64) *DaggerAutofix {
+	m.CoverageTolerance = tolerance
+	return m
+}
+
+// WithTestPaths restricts fix validation to the frameworks detected in the given
+// directories (e.g. "." and "frontend"); by default every detected framework runs
+func (m *DaggerAutofix) WithTestPaths(paths ...string) *DaggerAutofix {
+	m.TestPaths = paths
+	return m
+}
+
+// WithTestCache enables or disables the Dagger cache volumes that keep downloaded
+// dependencies between fix validations. Caching is on by default.
+func (m *DaggerAutofix) WithTestCache(enabled bool) *DaggerAutofix {
+	m.DisableTestCache = !enabled
+	return m
+}
+
+// WithTestContainerImage runs fix validation in image instead of each framework's
+// toolchain image. A repository's .github-autofix-test.yml still takes precedence.
+func (m *DaggerAutofix) WithTestContainerImage(image string) *DaggerAutofix {
+	m.TestContainerImage = image
+	return m
+}
+
+// WithTestContainerEnv sets environment variables in every test container, e.g. HTTP_PROXY
+// and NO_PROXY in corporate networks
+func (m *DaggerAutofix) WithTestContainerEnv(env map[string]string) *DaggerAutofix {
+	m.TestContainerEnv = env
+	return m
+}
+
+// WithTestContainerSecret exposes a secret to every test container as the variable name,
+// e.g. a private registry token, without it appearing in plaintext
+func (m *DaggerAutofix) WithTestContainerSecret(name string, secret *dagger.Secret) *DaggerAutofix {
+	if m.TestContainerSecrets == nil {
+		m.TestContainerSecrets = make(map[string]*dagger.Secret)
+	}
+	m.TestContainerSecrets[name] = secret
+	return m
+}
+
+// WithTestNetwork sets how much network the repository's commands get during fix
+// validation: "full" (the default), "restricted", which cuts it off after the setup
+// commands installed dependencies, or "none". It is enforced through proxy variables and
+// package manager offline settings, as Dagger cannot isolate a command from the network.
+func (m *DaggerAutofix) WithTestNetwork(network string) *DaggerAutofix {
+	m.TestNetwork = TestNetwork(strings.ToLower(network))
+	return m
+}
+
+// WithTestPublishCommands allows the repository's test commands and validation steps to
+// publish packages or images (npm publish, docker push, ...), which are refused by default
+func (m *DaggerAutofix) WithTestPublishCommands(allowed bool) *DaggerAutofix {
+	m.AllowTestPublish = allowed
+	return m
+}
+
 // WithLLMProvider configures the LLM provider and API key
 func (m *DaggerAutofix) WithLLMProvider(provider string, apiKey *dagger.Secret) *DaggerAutofix {
 	m.LLMProvider = LLMProvider(strings.ToLower(provider))
@@ -119,7 +661,49 @@ func (m *DaggerAutofix) WithRepository(owner, name string) *DaggerAutofix {
 	return m
 }
 
-// WithTargetBranch configures the target branch (default: main)
+// WithRepositories adds "owner/name" repositories for MonitorWorkflows to watch. Each gets its
+// own GitHub client, PR tracking and processed runs, while fixes share one worker pool, so
+// MaxConcurrentFixes holds across repositories. The first repository becomes the primary one
+// when WithRepository was not called.
+func (m *DaggerAutofix) WithRepositories(repos ...string) *DaggerAutofix {
+	m.Repositories = append(m.Repositories, repos...)
+	if m.RepoName == "" && len(repos) > 0 {
+		if repo, err := parseRepository(repos[0]); err == nil {
+			m.RepoOwner = repo.owner
+			m.RepoName = repo.name
+		}
+	}
+	return m
+}
+
+// WithOrganization monitors the repositories of org, discovering them on Initialize and every
+// hour while monitoring so new repositories are picked up without a restart. Repositories
+// with GitHub Actions disabled or without any workflow run are skipped.
+func (m *DaggerAutofix) WithOrganization(org string) *DaggerAutofix {
+	m.Organization = org
+	if m.RepoOwner == "" {
+		m.RepoOwner = org
+	}
+	return m
+}
+
+// WithRepoFilter limits organization discovery to repositories whose names match one of the
+// include globs, when given, and none of the exclude globs
+func (m *DaggerAutofix) WithRepoFilter(include, exclude []string) *DaggerAutofix {
+	m.RepoFilter.Include = include
+	m.RepoFilter.Exclude = exclude
+	return m
+}
+
+// WithArchivedAndForkedRepos includes archived and forked repositories in organization
+// discovery, which skips both by default
+func (m *DaggerAutofix) WithArchivedAndForkedRepos(archived, forks bool) *DaggerAutofix {
+	m.RepoFilter.IncludeArchived = archived
+	m.RepoFilter.IncludeForks = forks
+	return m
+}
+
+// WithTargetBranch configures the target branch (default: the repository's default branch)
 func (m *DaggerAutofix) WithTargetBranch(branch string) *DaggerAutofix {
 	m.TargetBranch = branch
 	return m
@@ -138,22 +722,261 @@ func (m *DaggerAutofix) WithMinCoverage(coverage int) *DaggerAutofix {
 	return m
 }
 
+// WithMetricsAddr serves Prometheus metrics on addr, e.g. ":9090", while monitoring
+func (m *DaggerAutofix) WithMetricsAddr(addr string) *DaggerAutofix {
+	m.MetricsAddr = addr
+	return m
+}
+
+// WithNotificationWebhook posts fix lifecycle notifications to the webhook URL
+func (m *DaggerAutofix) WithNotificationWebhook(url *dagger.Secret) *DaggerAutofix {
+	m.NotificationWebhook = url
+	return m
+}
+
+// WithNotificationFormat sets the notification payload format (webhook, slack)
+func (m *DaggerAutofix) WithNotificationFormat(format string) *DaggerAutofix {
+	m.NotificationFormat = format
+	return m
+}
+
+// WithAuditLog appends an audit trail of the agent's actions to the JSON lines file at path
+func (m *DaggerAutofix) WithAuditLog(path string) *DaggerAutofix {
+	m.AuditLog = path
+	return m
+}
+
+// WithRedactionPatterns masks matches of the regular expressions in workflow logs, LLM
+// prompts, test output and log entries, in addition to the built-in credential patterns
+func (m *DaggerAutofix) WithRedactionPatterns(patterns []string) *DaggerAutofix {
+	m.RedactionPatterns = patterns
+	return m
+}
+
+// WithPathPolicy restricts the files fixes may change to the path prefixes in allow, or any
+// path when allow is empty, minus the prefixes in deny. Changes outside the policy are
+// dropped from their fix, which loses confidence for each.
+func (m *DaggerAutofix) WithPathPolicy(allow, deny []string) *DaggerAutofix {
+	m.AllowedPaths = allow
+	m.DeniedPaths = deny
+	return m
+}
+
+// WithFixGuardrails limits how many files and lines a fix may change and which paths it may
+// never change. Fixes exceeding the guardrails are rejected without being tested, or opened
+// as draft PRs or only commented on, depending on the guardrails' action.
+func (m *DaggerAutofix) WithFixGuardrails(g FixGuardrails) *DaggerAutofix {
+	m.FixGuardrails = g
+	return m
+}
+
+// WithContextPolicy sets which repository files the fix generation prompt includes. Files
+// the error lines mention rank above the affected files, which rank above files changed by
+// recent commits; lockfiles, build output and generated code are skipped unless the error
+// lines mention them.
+func (m *DaggerAutofix) WithContextPolicy(p ContextPolicy) *DaggerAutofix {
+	m.ContextPolicy = p
+	return m
+}
+
+// WithBinaryExtensions treats files with the extensions, e.g. ".dat", as binary besides
+// images, archives, fonts, media and compiled code: prompts leave their content out and fixes
+// changing them are rejected
+func (m *DaggerAutofix) WithBinaryExtensions(extensions []string) *DaggerAutofix {
+	m.FileClassification.BinaryExtensions = append(m.FileClassification.BinaryExtensions, extensions...)
+	return m
+}
+
+// WithGeneratedFile treats files matching the CODEOWNERS style pattern as generated: changes a
+// fix proposes to them are replaced by running command in their directory before the fix is
+// tested. Without a command, fixes changing them are rejected. Protobuf output and lockfiles
+// are generated files already.
+func (m *DaggerAutofix) WithGeneratedFile(pattern string, command string) *DaggerAutofix {
+	m.FileClassification.GeneratedFiles = append(m.FileClassification.GeneratedFiles, GeneratedFile{Pattern: pattern, Command: command})
+	return m
+}
+
+// WithLogChunking analyzes logs exceeding the analysis prompt budget by c.Factor in chunks:
+// each overlapping chunk is summarized into its error candidates, and the failure is analyzed
+// from the summaries instead of the head and tail of the logs.
+func (m *DaggerAutofix) WithLogChunking(c LogChunking) *DaggerAutofix {
+	m.LogChunking = c
+	return m
+}
+
+// WithLLMCache reuses LLM responses to identical prompts for ttl instead of paying for them
+// again. Responses are stored in dir, or only in memory when dir is empty; a zero ttl keeps
+// them for 24 hours.
+func (m *DaggerAutofix) WithLLMCache(dir string, ttl time.Duration) *DaggerAutofix {
+	m.LLMCache = true
+	m.LLMCacheDir = dir
+	m.LLMCacheTTL = ttl
+	return m
+}
+
+// WithLLMPrice sets the price of a provider's tokens, in US dollars per 1,000 input and
+// output tokens, used to estimate the cost of LLM requests
+func (m *DaggerAutofix) WithLLMPrice(provider string, inputPer1K, outputPer1K float64) *DaggerAutofix {
+	m.LLMPricing = append(m.LLMPricing, LLMPrice{Provider: LLMProvider(provider), InputPer1K: inputPer1K, OutputPer1K: outputPer1K})
+	return m
+}
+
+// WithLLMHeader sends an extra header with every LLM request, e.g. the headers an LLM
+// gateway requires. Headers carrying the API key, such as Authorization and x-api-key, cannot
+// be set this way.
+func (m *DaggerAutofix) WithLLMHeader(name, value string) *DaggerAutofix {
+	m.LLMHeaders = append(m.LLMHeaders, LLMHeader{Name: name, Value: value})
+	return m
+}
+
+// WithOpenAIOrganization attributes LLM requests to an OpenAI organization for billing
+func (m *DaggerAutofix) WithOpenAIOrganization(org string) *DaggerAutofix {
+	return m.WithLLMHeader(headerOpenAIOrganization, org)
+}
+
+// WithOpenAIProject attributes LLM requests to an OpenAI project for billing
+func (m *DaggerAutofix) WithOpenAIProject(project string) *DaggerAutofix {
+	return m.WithLLMHeader(headerOpenAIProject, project)
+}
+
+// WithFlakyRetry re-runs the failed jobs of failures that look flaky before analyzing them,
+// skipping the fix when the re-run passes. Failures look flaky when their logs match a
+// transient or flaky error pattern, or when the same workflow succeeded on the same commit
+// within maxAge; a zero maxAge uses 24 hours. Dry runs never re-run workflows.
+func (m *DaggerAutofix) WithFlakyRetry(enabled bool, maxAge time.Duration) *DaggerAutofix {
+	m.FlakyRetry = enabled
+	m.FlakyRetryMaxAge = maxAge
+	return m
+}
+
+// WithRunPollInterval sets how often WaitForRunCompletion and WatchRun check a workflow run
+// (default: 15s)
+func (m *DaggerAutofix) WithRunPollInterval(interval time.Duration) *DaggerAutofix {
+	m.RunPollInterval = interval
+	return m
+}
+
+// WithSARIFUpload uploads the analysis of each fixed failure to GitHub code scanning as a
+// SARIF log for the failing commit, so its findings show up as code scanning alerts. The
+// token needs the security_events scope. Dry runs never upload.
+func (m *DaggerAutofix) WithSARIFUpload(enabled bool) *DaggerAutofix {
+	m.SARIFUpload = enabled
+	return m
+}
+
+// WithFixVerification sets how long after a fix PR merged its workflow has to complete on
+// the target branch at the merge commit before the fix is recorded as unverified; zero uses
+// two hours. With followUp, a run that failed again is analyzed and the analysis summarized
+// in the comment on the merged PR.
+func (m *DaggerAutofix) WithFixVerification(timeout time.Duration, followUp bool) *DaggerAutofix {
+	m.VerificationTimeout = timeout
+	m.FollowUpAnalysis = followUp
+	return m
+}
+
+// WithFixHistory remembers the fix PRs opened for each failure in path. When a failure with
+// the same normalized error lines recurs, the fix merged for it last time is given to the LLM
+// as a prior, fixes following it get a confidence boost, and the PR body links the old PR.
+func (m *DaggerAutofix) WithFixHistory(path string) *DaggerAutofix {
+	m.FixHistory = path
+	return m
+}
+
+// WithAnalysisModel analyzes failures with model instead of the provider's configured model,
+// e.g. a cheaper one like gpt-4o-mini
+func (m *DaggerAutofix) WithAnalysisModel(model string) *DaggerAutofix {
+	m.AnalysisModel = model
+	return m
+}
+
+// WithFixModel generates fixes with model instead of the provider's configured model
+func (m *DaggerAutofix) WithFixModel(model string) *DaggerAutofix {
+	m.FixModel = model
+	return m
+}
+
+// WithEscalationConfidence sets the analysis confidence, between 0 and 1, below which an
+// analysis is re-run once with the fix model when it differs from the analysis model; 0
+// never re-runs analyses
+func (m *DaggerAutofix) WithEscalationConfidence(threshold float64) *DaggerAutofix {
+	m.EscalationConfidence = threshold
+	return m
+}
+
+// WithPromptTemplates renders the LLM prompts from the Go text/template files in dir,
+// falling back to the built-in template for each file that is missing. The templates are
+// parsed when the agent is initialized; a template that does not parse fails it.
+func (m *DaggerAutofix) WithPromptTemplates(dir string) *DaggerAutofix {
+	m.PromptDir = dir
+	return m
+}
+
+// WithPromptTemplatesDirectory is WithPromptTemplates for a directory of the Dagger host
+func (m *DaggerAutofix) WithPromptTemplatesDirectory(dir *dagger.Directory) *DaggerAutofix {
+	m.PromptDirectory = dir
+	return m
+}
+
+// WithPromptCapture records the exact system message, prompt, response and token usage of
+// every LLM request of an analysis in its Interactions, redacted like the prompts. With an
+// audit log or state file they are also written to prompts/<analysis ID>.json beside it.
+// Interactions never go into pull requests or comments.
+func (m *DaggerAutofix) WithPromptCapture(enabled bool) *DaggerAutofix {
+	m.PromptCapture = enabled
+	return m
+}
+
+// WithLogLevel sets the level the agent and its GitHub, LLM and engine components log at:
+// trace, debug, info, warn, error, fatal or panic
+func (m *DaggerAutofix) WithLogLevel(level string) *DaggerAutofix {
+	m.LogLevel = level
+	return m
+}
+
+// WithLogFormat sets whether log entries are written as JSON ("json") or as text ("text")
+func (m *DaggerAutofix) WithLogFormat(format string) *DaggerAutofix {
+	m.LogFormat = format
+	return m
+}
+
+// WithLogOutput writes the agent's log entries to w instead of stderr, e.g. a log file
+func (m *DaggerAutofix) WithLogOutput(w io.Writer) *DaggerAutofix {
+	m.logger.SetOutput(w)
+	return m
+}
+
+// WithProgressFunc calls report at each stage boundary of AutoFix and ValidateFix, and as
+// each test pipeline stage starts. report runs on the pipeline's goroutine, so it should
+// return quickly; a panic in it is logged and the event dropped.
+func (m *DaggerAutofix) WithProgressFunc(report func(event ProgressEvent)) *DaggerAutofix {
+	m.progress = report
+	return m
+}
+
 // Initialize sets up all internal components
 func (m *DaggerAutofix) Initialize(ctx context.Context) (*DaggerAutofix, error) {
 	if err := m.validateConfiguration(); err != nil {
 		return nil, fmt.Errorf("configuration validation failed: %w", err)
 	}
+	// Components get m.logger rather than their own, so these settings reach all of them
+	if err := configureLogger(m.logger, m.LogLevel, m.LogFormat); err != nil {
+		return nil, err
+	}
+	setupTracing(m.logger)
 
 	// Initialize GitHub client (MCP or direct)
 	var ghClient GitHubClient
 	var err error
 	
-	if m.MCPEnabled && m.MCPGitHubConfig != nil {
+	if m.LogsOnly {
+		m.logger.Info("Logs only mode, skipping the GitHub client")
+	} else if m.MCPEnabled && m.MCPGitHubConfig != nil {
 		// Use MCP GitHub client
 		mcpClient, mcpErr := NewMCPGitHubClient(m.MCPGitHubConfig, m.logger)
 		if mcpErr != nil {
 			return nil, fmt.Errorf("failed to initialize MCP GitHub client: %w", mcpErr)
 		}
+		mcpClient.SetTargetBranch(m.TargetBranch)
 		
 		// Connect to MCP server
 		if connectErr := mcpClient.Connect(ctx); connectErr != nil {
@@ -163,11 +986,33 @@ func (m *DaggerAutofix) Initialize(ctx context.Context) (*DaggerAutofix, error)
 		ghClient = mcpClient
 		m.logger.Info("Using MCP GitHub client")
 	} else {
-		// Use direct GitHub client
-		directClient, directErr := newGitHubIntegration(ctx, m.GitHubToken, m.RepoOwner, m.RepoName)
+		// Use direct GitHub client, authenticated as a GitHub App when configured
+		var directClient *GitHubIntegration
+		var directErr error
+		if m.GitHubApp != nil {
+			directClient, directErr = newGitHubAppIntegration(ctx, m.GitHubApp, m.RepoOwner, m.RepoName, m.githubEndpoints(), m.logger)
+		} else {
+			directClient, directErr = newGitHubIntegration(ctx, m.GitHubToken, m.RepoOwner, m.RepoName, m.githubEndpoints(), m.logger)
+		}
 		if directErr != nil {
 			return nil, fmt.Errorf("failed to initialize GitHub client: %w", directErr)
 		}
+		directClient.SetTargetBranch(m.TargetBranch)
+		directClient.SetRateLimitRetries(m.GitHubRateLimitRetries)
+		directClient.SetFailedRunFilter(FailedRunFilter{
+			Lookback:        m.FailureLookback,
+			MaxResults:      m.MaxFailedRuns,
+			Workflows:       m.WorkflowFilter,
+			IncludeTimedOut: m.IncludeTimedOutRuns,
+		})
+		// Fail now on a token that cannot open fix PRs, rather than midway through AutoFix
+		if !m.DryRun && m.RepoName != "" && directClient.client != nil {
+			if err := directClient.CheckPushAccess(ctx); errors.Is(err, ErrGitHubAuth) || errors.Is(err, ErrGitHubNotFound) {
+				return nil, fmt.Errorf("GitHub capability check failed: %w", err)
+			} else if err != nil {
+				m.logger.WithError(err).Warn("Could not check the GitHub token's permissions")
+			}
+		}
 		ghClient = directClient
 		m.logger.Info("Using direct GitHub client")
 	}
@@ -175,28 +1020,147 @@ func (m *DaggerAutofix) Initialize(ctx context.Context) (*DaggerAutofix, error)
 	m.githubClient = ghClient
 
 	// Initialize LLM client
-	llmClient, err := newLLMClient(ctx, m.LLMProvider, m.LLMAPIKey)
+	llmClient, err := newLLMClient(withLLMHeaders(ctx, llmHeaderMap(m.LLMHeaders)), m.LLMProvider, m.LLMAPIKey, m.logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize LLM client: %w", err)
 	}
+	if m.LLMCache {
+		cache, err := newLLMCache(m.LLMCacheDir, m.LLMCacheTTL, llmCacheMaxEntries, m.logger)
+		if err != nil {
+			return nil, err
+		}
+		llmClient.WithCache(cache)
+	}
 	m.llmClient = llmClient
 
+	// Mask the agent's own credentials and anything that looks like one before logs reach
+	// the LLM, PR bodies or our log output
+	redactor, err := NewRedactor(m.RedactionPatterns)
+	if err != nil {
+		return nil, err
+	}
+	redactor.AddSecret(RedactionLLMAPIKey, llmClient.apiKey)
+	for _, header := range m.LLMHeaders {
+		if sensitiveLLMHeader(header.Name) {
+			redactor.AddSecret(RedactionLLMHeader, header.Value)
+		}
+	}
+	if directClient, ok := ghClient.(*GitHubIntegration); ok {
+		redactor.AddSecret(RedactionGitHubToken, directClient.token)
+	}
+	if m.redactor == nil {
+		m.logger.AddHook(newRedactionHook(redactor))
+		if !m.multiRepository() && !m.LogsOnly {
+			m.logger.AddHook(newRepositoryHook(repositoryRef{owner: m.RepoOwner, name: m.RepoName}))
+		}
+	}
+	m.redactor = redactor
+
 	// Initialize failure analysis engine
-	m.failureEngine = newFailureAnalysisEngine(m.llmClient, m.logger)
+	failureEngine := newFailureAnalysisEngine(m.llmClient, m.logger)
+	failureEngine.SetRedactor(m.redactor)
+	if m.FixHistory != "" && m.history == nil {
+		history, err := loadFixHistory(m.FixHistory)
+		if err != nil {
+			return nil, err
+		}
+		m.history = history
+	}
+	failureEngine.SetFixHistory(m.history)
+	failureEngine.SetPathPolicy(m.pathPolicy())
+	failureEngine.SetFixTypeConstraints(m.AllowedFixTypes)
+	failureEngine.SetContextPolicy(m.ContextPolicy)
+	failureEngine.SetFileClassification(m.FileClassification)
+	failureEngine.SetLogChunking(m.LogChunking)
+	if m.githubClient != nil {
+		failureEngine.SetFileSource(m.githubClient.GetFileContent)
+	}
+	failureEngine.SetModels(m.AnalysisModel, m.FixModel)
+	failureEngine.SetEscalationConfidence(m.EscalationConfidence)
+	failureEngine.SetPromptCapture(m.PromptCapture)
+	if m.prompts == nil {
+		prompts, err := m.loadPromptTemplates(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load prompt templates: %w", err)
+		}
+		m.prompts = prompts
+	}
+	failureEngine.SetPromptTemplates(m.prompts)
+	m.failureEngine = failureEngine
+	m.dependencies = newDependencyResolver(m.logger)
 
 	// Initialize test engine
-	m.testEngine = newTestEngine(m.MinCoverage, m.logger)
+	testEngine := newTestEngine(m.MinCoverage, m.logger).WithTestTimeouts(m.TestTimeouts).WithTestPaths(m.TestPaths...).WithTestCache(!m.DisableTestCache).WithRequireCoverage(m.RequireCoverage).
+		WithContainerImage(m.TestContainerImage).WithContainerEnv(m.TestContainerEnv).WithContainerSecrets(m.TestContainerSecrets).
+		WithNetwork(m.TestNetwork).WithPublishCommands(m.AllowTestPublish)
+	testEngine.SetRepository(m.RepoOwner, m.RepoName)
+	testEngine.SetLLMClient(m.llmClient)
+	testEngine.SetPromptTemplates(m.prompts)
+	testEngine.SetGitHubURL(m.githubEndpoints().webURL())
+	if directClient, ok := ghClient.(*GitHubIntegration); ok && directClient.tokenSource != nil {
+		// Installation tokens expire within the hour, so each clone gets a fresh one
+		testEngine.SetGitHubTokenSource(func(ctx context.Context) (*dagger.Secret, error) {
+			token, err := directClient.accessToken()
+			if err != nil {
+				return nil, err
+			}
+			return dag.SetSecret(fmt.Sprintf("github-installation-token-%d", time.Now().UnixNano()), token), nil
+		})
+	} else if m.GitHubToken != nil {
+		testEngine.SetGitHubToken(m.GitHubToken)
+	}
+	m.testEngine = testEngine
 
 	// Initialize PR engine (currently requires direct GitHub client)
 	// TODO: Refactor PR engine to use GitHubClient interface
 	if directClient, ok := ghClient.(*GitHubIntegration); ok {
-		m.prEngine = newPullRequestEngine(directClient, m.logger)
-	} else {
+		prEngine := newPullRequestEngine(directClient, m.logger)
+		prEngine.SetTargetBranch(m.TargetBranch)
+		prEngine.SetPRDefaults(m.PRDefaults)
+		prEngine.SetCommitTemplate(m.CommitTemplate)
+		prEngine.SetMinCoverage(m.MinCoverage)
+		m.prEngine = prEngine
+	} else if !m.LogsOnly {
 		// For MCP clients, we'll need to implement PR engine functionality via MCP
 		// For now, disable PR engine when using MCP
 		m.logger.Warn("PR engine not available with MCP client yet")
 	}
 
+	if _, err := m.prTracking(); err != nil {
+		return nil, fmt.Errorf("failed to load PR tracking state: %w", err)
+	}
+
+	if m.usage == nil {
+		m.usage = newUsageTracker(llmPriceTable(m.LLMPricing))
+	}
+
+	if m.AuditLog != "" && m.auditLog == nil {
+		auditLog, err := NewAuditLogger(m.AuditLog, m.logger)
+		if err != nil {
+			return nil, err
+		}
+		m.auditLog = auditLog
+	}
+
+	if m.NotificationWebhook != nil {
+		webhookURL, err := m.NotificationWebhook.Plaintext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read notification webhook: %w", err)
+		}
+		m.redactor.AddSecret(RedactionWebhook, webhookURL)
+		notifier, err := newNotifier(webhookURL, m.NotificationFormat)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize notifier: %w", err)
+		}
+		m.notifier = notifier
+	}
+
+	if !m.LogsOnly {
+		if err := m.initRepositories(ctx); err != nil {
+			return nil, err
+		}
+	}
+
 	m.logger.Info("DaggerAutofix initialized successfully")
 	return m, nil
 }
@@ -204,22 +1168,56 @@ func (m *DaggerAutofix) Initialize(ctx context.Context) (*DaggerAutofix, error)
 // MonitorWorkflows continuously monitors GitHub Actions workflows for failures
 func (m *DaggerAutofix) MonitorWorkflows(ctx context.Context) error {
 	if m.githubClient == nil {
-		return fmt.Errorf("module not initialized, call Initialize first")
+		return ErrNotInitialized
 	}
 
 	m.logger.Info("Starting workflow monitoring")
+	m.reconcileTestBranches(ctx)
 
-	ticker := newTicker(30 * time.Second)
+	if m.MetricsAddr != "" {
+		addr, _, err := serveMetrics(ctx, m.MetricsAddr, agentMetrics, m.health.status)
+		if err != nil {
+			return err
+		}
+		m.logger.WithField("addr", addr.String()).Info("Serving Prometheus metrics on /metrics and health on /healthz")
+	}
+
+	ticker := newTicker(monitorPollInterval)
 	defer ticker.Stop()
+	interval := monitorPollInterval
+	reconcileTicker := newTicker(prReconcileInterval)
+	defer reconcileTicker.Stop()
+	var discoveryTick <-chan time.Time
+	if m.Organization != "" {
+		discoveryTicker := newTicker(repoDiscoveryInterval)
+		defer discoveryTicker.Stop()
+		discoveryTick = discoveryTicker.C
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
+			m.drainFixes()
+			m.cleanupTestBranches()
 			m.logger.Info("Monitoring stopped")
 			return ctx.Err()
 		case <-ticker.C:
+			// Back off while GitHub keeps failing and return to the polling interval once it recovers
+			var next time.Duration
 			if err := m.checkForFailures(ctx); err != nil {
-				m.logger.WithError(err).Error("Failed to check for workflow failures")
+				next = m.pollFailed(ctx, err)
+			} else {
+				next = m.health.recordSuccess()
+			}
+			if next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		case <-reconcileTicker.C:
+			m.reconcileRepositories(ctx)
+		case <-discoveryTick:
+			if err := m.refreshRepositories(ctx); err != nil {
+				m.logger.WithError(err).Error("Failed to refresh organization repositories")
 			}
 		}
 	}
@@ -227,40 +1225,147 @@ func (m *DaggerAutofix) MonitorWorkflows(ctx context.Context) error {
 
 // AnalyzeFailure analyzes a specific workflow failure and generates fixes
 func (m *DaggerAutofix) AnalyzeFailure(ctx context.Context, runID int64) (*FailureAnalysisResult, error) {
+	if err := validateRunID(runID); err != nil {
+		return nil, err
+	}
 	if m.failureEngine == nil {
-		return nil, fmt.Errorf("module not initialized, call Initialize first")
+		return nil, ErrNotInitialized
 	}
 
 	m.logger.WithField("run_id", runID).Info("Analyzing workflow failure")
+	ctx = withAuditRun(ctx, m.auditLog, runID)
 
+	failureCtx, err := m.failureContext(ctx, runID)
+	if analysis := m.logsUnavailableAnalysis(failureCtx, err); analysis != nil {
+		return analysis, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m.analyzeFailureContext(ctx, failureCtx)
+}
+
+// failureContext fetches the workflow run, its redacted logs and the repository metadata
+func (m *DaggerAutofix) failureContext(ctx context.Context, runID int64) (FailureContext, error) {
+	return m.attemptFailureContext(ctx, runID, 0)
+}
+
+// attemptFailureContext fetches the failure context of an attempt of a workflow run, the
+// latest one when attempt is 0. Check run annotations are only listed for the latest attempt,
+// so the failures of a given attempt are analyzed from its logs alone.
+func (m *DaggerAutofix) attemptFailureContext(ctx context.Context, runID int64, attempt int) (FailureContext, error) {
 	// Get workflow run details
-	workflowRun, err := m.githubClient.GetWorkflowRun(ctx, runID)
+	var workflowRun *WorkflowRun
+	var err error
+	if attempt > 0 {
+		workflowRun, err = m.githubClient.GetWorkflowRunAttempt(ctx, runID, attempt)
+	} else {
+		workflowRun, err = m.githubClient.GetWorkflowRun(ctx, runID)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get workflow run: %w", err)
+		return FailureContext{}, fmt.Errorf("failed to get workflow run: %w", err)
 	}
+	audit(ctx, AuditWorkflowRunFetched, map[string]interface{}{
+		"workflow":   workflowRun.Name,
+		"branch":     workflowRun.Branch,
+		"commit_sha": workflowRun.CommitSHA,
+		"conclusion": workflowRun.Conclusion,
+	})
 
 	// Get failure logs
-	logs, err := m.githubClient.GetWorkflowLogs(ctx, runID)
+	var logs *WorkflowLogs
+	if attempt > 0 {
+		logs, err = m.githubClient.GetWorkflowRunAttemptLogs(ctx, runID, attempt)
+	} else {
+		logs, err = m.githubClient.GetWorkflowLogs(ctx, runID)
+	}
+	var unavailable *LogsUnavailableError
+	if errors.As(err, &unavailable) {
+		logsExpiry(unavailable, workflowRun, time.Now())
+		return FailureContext{WorkflowRun: workflowRun}, fmt.Errorf("failed to get workflow logs: %w", err)
+	}
+	if err != nil {
+		return FailureContext{}, fmt.Errorf("failed to get workflow logs: %w", err)
+	}
+	// Annotations only sharpen what the logs say, so the analysis goes on without them
+	if attempt == 0 {
+		if annotations, err := m.githubClient.GetCheckRunAnnotations(ctx, runID); err != nil {
+			m.logger.WithError(err).Warn("Failed to get check run annotations, continuing with the logs only")
+		} else {
+			logs.Annotations = annotations
+		}
+	}
+	m.redactor.RedactLogs(logs)
+	audit(ctx, AuditLogsRetrieved, map[string]interface{}{
+		"sha256": auditHash(logs.RawLogs),
+		"bytes":  len(logs.RawLogs),
+		"jobs":   len(logs.JobLogs),
+	})
+
+	// Repository metadata only enriches the prompt, so fall back to owner/name if unavailable
+	repository := RepositoryContext{
+		Owner: m.RepoOwner,
+		Name:  m.RepoName,
+	}
+	repoCtx, err := m.githubClient.GetRepositoryContext(ctx)
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to get repository context, continuing without language details")
+	} else if repoCtx != nil {
+		repository.DefaultBranch = repoCtx.DefaultBranch
+		repository.Language = repoCtx.Language
+		repository.Framework = repoCtx.Framework
+	}
+	m.profileRepository(ctx, &repository, workflowRun.CommitSHA)
+
+	// Without the workflow file the analysis relies on the logs alone
+	var workflow *WorkflowDefinition
+	path, content, err := m.githubClient.GetWorkflowDefinition(ctx, runID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get workflow logs: %w", err)
+		m.logger.WithError(err).Warn("Failed to get workflow definition, continuing without it")
+		workflow = &WorkflowDefinition{Path: path, Note: fmt.Sprintf("The workflow file could not be fetched: %v", err)}
+	} else if path != "" {
+		workflow = &WorkflowDefinition{Path: path, Content: m.redactor.Redact(content)}
 	}
 
-	// Analyze failure with LLM
-	analysis, err := m.failureEngine.AnalyzeFailure(ctx, FailureContext{
+	// Failures of pull_request runs are explained by the pull request's changes
+	prNumber, prDiff := m.pullRequestContext(ctx, workflowRun)
+
+	return FailureContext{
 		WorkflowRun: workflowRun,
 		Logs:        logs,
-		Repository: RepositoryContext{
-			Owner: m.RepoOwner,
-			Name:  m.RepoName,
-		},
-	})
+		Repository:  repository,
+		Workflow:    workflow,
+		PRNumber:    prNumber,
+		PRDiff:      prDiff,
+		History:     m.runHistory(ctx, workflowRun, valueOr(m.TargetBranch, repository.DefaultBranch)),
+	}, nil
+}
+
+// analyzeFailureContext analyzes a failure with the LLM. Analyses of a single job get the
+// job's name appended to their ID so the analyses of one run stay distinct.
+func (m *DaggerAutofix) analyzeFailureContext(ctx context.Context, failureCtx FailureContext) (*FailureAnalysisResult, error) {
+	ctx, usage := withUsageTracking(ctx, m.usage)
+
+	analysisStart := time.Now()
+	analysis, err := m.failureEngine.AnalyzeFailure(ctx, failureCtx)
+	agentMetrics.analysisDuration.observe(time.Since(analysisStart).Seconds())
 	if err != nil {
 		return nil, fmt.Errorf("failure analysis failed: %w", err)
 	}
+	if failureCtx.JobName != "" {
+		analysis.ID += "-" + jobSlug(failureCtx.JobName)
+		analysis.Jobs = []string{failureCtx.JobName}
+	}
+	setAuditAnalysis(ctx, analysis.ID)
+	analysisUsage := usage.total()
+	analysis.LLMUsage = &analysisUsage
+	m.savePromptCapture(analysis)
 
 	m.logger.WithFields(logrus.Fields{
+		"analysis_id":  analysis.ID,
 		"failure_type": analysis.Classification.Type,
 		"confidence":   analysis.Classification.Confidence,
+		"job":          failureCtx.JobName,
 	}).Info("Failure analysis completed")
 
 	return analysis, nil
@@ -268,58 +1373,421 @@ func (m *DaggerAutofix) AnalyzeFailure(ctx context.Context, runID int64) (*Failu
 
 // AutoFix performs end-to-end automated fixing of a workflow failure
 func (m *DaggerAutofix) AutoFix(ctx context.Context, runID int64) (*AutoFixResult, error) {
+	return m.autoFix(ctx, runID, m.DryRun)
+}
+
+// generateFixes proposes fixes for an analysis. A resolved version bump comes first and the
+// LLM fixes remain as alternatives.
+func (m *DaggerAutofix) generateFixes(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+	fixes, err := m.failureEngine.GenerateFixes(ctx, analysis)
+	m.savePromptCapture(analysis)
+	if fix := m.resolveDependencyFix(ctx, analysis); fix != nil && m.AllowedFixTypes.accepts(fix, analysis, m.logger) {
+		fixes = append([]*ProposedFix{fix}, fixes...)
+		err = nil
+	}
+	// Fixes also come from the fix history and the dependency resolver, so their operations
+	// and paths are checked again before anything is applied. Fixes left without changes are dropped.
+	policy := m.pathPolicy()
+	kept := fixes[:0]
+	for _, fix := range fixes {
+		rejected := sanitizeFixChanges(fix, policy)
+		for _, reason := range rejected {
+			m.logger.WithField("fix_id", fix.ID).Warn(reason)
+		}
+		if len(rejected) > 0 && len(fix.Changes) == 0 {
+			m.logger.WithField("fix_id", fix.ID).Warn("Skipping fix, all of its changes were dropped")
+			continue
+		}
+		kept = append(kept, fix)
+	}
+	return kept, err
+}
+
+// pathPolicy returns the paths fixes may change
+func (m *DaggerAutofix) pathPolicy() PathPolicy {
+	return PathPolicy{Allow: m.AllowedPaths, Deny: m.DeniedPaths}
+}
+
+// loadPromptTemplates returns the built-in prompt templates overridden by the configured
+// prompt directory
+func (m *DaggerAutofix) loadPromptTemplates(ctx context.Context) (*PromptTemplates, error) {
+	switch {
+	case m.PromptDirectory != nil:
+		return loadPromptTemplateDirectory(ctx, m.PromptDirectory)
+	case m.PromptDir != "":
+		return loadPromptTemplateDir(m.PromptDir)
+	}
+	return loadPromptTemplates(), nil
+}
+
+// autoFix runs AutoFix, stopping before the pull request when dryRun is set
+func (m *DaggerAutofix) autoFix(ctx context.Context, runID int64, dryRun bool) (result *AutoFixResult, err error) {
+	start := time.Now()
+	var analysis *FailureAnalysisResult
+	// Failed runs still return a result whose metadata names the error category
+	defer func() {
+		if err != nil && result == nil {
+			result = failedAutoFixResult(runID, start, analysis, err)
+		}
+		if result != nil {
+			result.RunID = runID
+		}
+	}()
+
+	if err := validateRunID(runID); err != nil {
+		return nil, err
+	}
 	if err := m.ensureInitialized(); err != nil {
 		return nil, err
 	}
 
 	m.logger.WithField("run_id", runID).Info("Starting automated fix process")
+	clustered := m.takeClusteredRuns(runID)
+	ctx = withRepoSettings(ctx, m.mergeRepoConfig(m.repoConfig(ctx)))
+
+	validationFailed := false
+	resolvedByRetry := false
+	ctx, span := startSpan(ctx, "autofix", attribute.Int64("run_id", runID))
+	ctx = withAuditRun(ctx, m.auditLog, runID)
+	ctx, usage := withUsageTracking(ctx, m.usage)
+	ctx = withProgress(ctx, m.progress, m.logger, runID)
+	defer func() {
+		if err != nil && !validationFailed {
+			notification := analysisNotification(AutoFixAborted, runID, analysis)
+			notification.Reason = err.Error()
+			// Still report runs aborted by the fix timeout
+			m.notify(context.WithoutCancel(ctx), notification)
+		}
+		failureType := metricsFailureType(analysis)
+		if !resolvedByRetry {
+			agentMetrics.recordFix(metricsRepository(m), failureType, err == nil && result != nil && result.Success, time.Since(start))
+		}
+		span.SetAttributes(attribute.String("failure_type", failureType))
+		if result != nil {
+			span.SetAttributes(attribute.Bool("success", result.Success))
+		}
+		endSpan(span, err)
+	}()
+
+	// Step 0: Re-run failures that look flaky before spending an LLM analysis on them
+	var retryOutcome, retryReason string
+	if m.FlakyRetry && !dryRun {
+		stageCtx, stage := startSpan(ctx, "autofix.flaky_retry")
+		retryOutcome, retryReason = m.retryFlakyFailure(stageCtx, runID)
+		stage.SetAttributes(attribute.String("outcome", retryOutcome))
+		endSpan(stage, nil)
+		if retryOutcome == flakyRetryResolved {
+			resolvedByRetry = true
+			result = &AutoFixResult{
+				ID:      fmt.Sprintf("autofix-%d-%d", runID, start.Unix()),
+				Success: true,
+				Metadata: map[string]interface{}{
+					"flaky_retry":  retryOutcome,
+					"flaky_reason": retryReason,
+				},
+			}
+			result.Timestamp = time.Now()
+			result.Duration = result.Timestamp.Sub(start)
+			return result, nil
+		}
+	}
 
-	// Step 1: Analyze failure
-	analysis, err := m.AnalyzeFailure(ctx, runID)
+	// Step 1: Analyze each failed job, fixing the failures that share files together
+	reportProgress(ctx, ProgressAnalyzing, "", "Analyzing the failed jobs of run %d", runID)
+	stageCtx, stage := startSpan(ctx, "autofix.analysis")
+	analyses, err := m.AnalyzeFailureJobs(stageCtx, runID)
+	endSpan(stage, err)
 	if err != nil {
 		return nil, fmt.Errorf("failure analysis failed: %w", err)
 	}
+	analysis, unaddressed := analysisToFix(analyses)
+	if insufficientData(analysis) {
+		// Fixes generated without the logs would be guesses, so the run is left as analyzed
+		result = &AutoFixResult{
+			ID:       fmt.Sprintf("autofix-%d-%d", runID, start.Unix()),
+			Analysis: analysis,
+			Metadata: map[string]interface{}{
+				"fixes_generated":   0,
+				"insufficient_data": true,
+				"logs_unavailable":  analysis.Metadata["logs_unavailable"],
+			},
+		}
+		result.Timestamp = time.Now()
+		result.Duration = result.Timestamp.Sub(start)
+		return result, nil
+	}
+	analysis.Context.ClusteredRuns = clustered
+	if run := analysis.Context.WorkflowRun; run != nil {
+		ctx = withFailedCommit(ctx, run.CommitSHA)
+	}
+	for _, other := range unaddressed {
+		m.logger.WithFields(logrus.Fields{
+			"run_id":      runID,
+			"analysis_id": other.ID,
+			"jobs":        other.Jobs,
+		}).Warn("Failure shares no files with the failure being fixed, leaving it for a separate fix")
+	}
+	setAuditAnalysis(ctx, analysis.ID)
+	m.notify(ctx, analysisNotification(AnalysisCompleted, runID, analysis))
+	var sarifID string
+	if m.SARIFUpload && !dryRun {
+		sarifID = m.uploadSARIF(ctx, runID, analyses)
+	}
 
 	// Step 2: Generate fixes
-	fixes, err := m.failureEngine.GenerateFixes(ctx, analysis)
+	reportProgress(ctx, ProgressGeneratingFixes, "", "Generating fixes for %s", valueOr(analysis.RootCause, "the failure"))
+	stageCtx, stage = startSpan(ctx, "autofix.generate_fixes")
+	fixes, err := m.generateFixes(stageCtx, analysis)
+	stage.SetAttributes(attribute.Int("fixes_generated", len(fixes)))
+	endSpan(stage, err)
 	if err != nil {
+		if !dryRun {
+			m.postAnalysisComment(ctx, runID, analysis, "Fix generation failed")
+		}
 		return nil, fmt.Errorf("fix generation failed: %w", err)
 	}
+	if types := filteredFixTypes(analysis); len(fixes) == 0 && len(types) > 0 {
+		// Every fix was of a type the constraints drop, so the analysis is commented instead
+		reason := fmt.Sprintf("Every proposed fix was of a type not allowed for %s failures (%s)",
+			analysis.Classification.Type, strings.Join(types, ", "))
+		m.logger.WithFields(logrus.Fields{
+			"run_id":      runID,
+			"analysis_id": analysis.ID,
+			"fix_types":   types,
+		}).Info("No fix of an allowed type was generated, posting analysis only")
+		result = &AutoFixResult{
+			ID:       fmt.Sprintf("autofix-%d-%d", runID, start.Unix()),
+			Analysis: analysis,
+			Metadata: map[string]interface{}{
+				"fixes_generated":  0,
+				"filtered_fixes":   analysis.Metadata["filtered_fixes"],
+				"pr_policy":        string(PRPolicyAnalysisOnly),
+				"pr_policy_reason": reason,
+			},
+		}
+		if !dryRun {
+			m.commentAnalysis(ctx, runID, analysis, reason)
+		}
+		result.Timestamp = time.Now()
+		result.Duration = result.Timestamp.Sub(start)
+		return result, nil
+	}
+	generated := make([]map[string]interface{}, 0, len(fixes))
+	for _, fix := range fixes {
+		generated = append(generated, map[string]interface{}{"id": fix.ID, "type": string(fix.Type), "confidence": fix.Confidence})
+	}
+	audit(ctx, AuditFixesGenerated, map[string]interface{}{"fixes": generated})
 
 	// Step 3: Validate fixes
-	validationResults := make([]*FixValidationResult, 0, len(fixes))
-	for _, fix := range fixes {
-		validation, err := m.ValidateFix(ctx, fix)
-		if err != nil {
-			m.logger.WithError(err).Warn("Fix validation failed, skipping")
-			continue
-		}
-		validationResults = append(validationResults, validation)
+	stageCtx, stage = startSpan(ctx, "autofix.validation")
+	validationResults, validationErrs, err := m.validateFixes(stageCtx, fixes)
+	stage.SetAttributes(attribute.Int("fixes_validated", countValidFixes(validationResults)))
+	endSpan(stage, err)
+	if err != nil {
+		return nil, fmt.Errorf("fix validation aborted with %d of %d fixes validated: %w", len(validationResults), len(fixes), err)
 	}
 
 	if len(validationResults) == 0 {
-		return nil, fmt.Errorf("no valid fixes generated")
+		if !dryRun {
+			m.postAnalysisComment(ctx, runID, analysis, "No valid fixes were generated")
+		}
+		validationFailed = true
+		m.notifyValidationFailed(ctx, runID, analysis, "No valid fixes were generated")
+		if len(validationErrs) > 0 {
+			return nil, fmt.Errorf("%w generated: %w", ErrNoValidFixes, errors.Join(validationErrs...))
+		}
+		return nil, fmt.Errorf("%w generated", ErrNoValidFixes)
 	}
 
 	// Step 4: Select best fix (highest confidence + passes tests)
 	bestFix := m.selectBestFix(validationResults)
+	if bestFix == nil {
+		reason := "No proposed fix passed validation"
+		if rejected := rejectedByGuardrails(validationResults); rejected != nil {
+			reason += "; " + guardrailReason(rejected)
+		}
+		if !dryRun {
+			m.postAnalysisComment(ctx, runID, analysis, reason)
+		}
+		validationFailed = true
+		m.notifyValidationFailed(ctx, runID, analysis, reason)
+		return nil, m.noPassingFixError(ctx, validationResults)
+	}
+
+	if m.GeneratedTests {
+		withTests := m.addGeneratedTests(ctx, analysis, bestFix)
+		for i, validation := range validationResults {
+			if validation == bestFix {
+				validationResults[i] = withTests
+			}
+		}
+		bestFix = withTests
+	}
+
+	// The analysis carries the run's usage so the PR body can report it
+	runUsage := usage.total()
+	analysis.LLMUsage = &runUsage
+
+	result = &AutoFixResult{
+		ID:       fmt.Sprintf("autofix-%d-%d", runID, start.Unix()),
+		Analysis: analysis,
+		Fix:      bestFix,
+		Metadata: map[string]interface{}{
+			"fixes_generated":         len(fixes),
+			"fixes_validated":         countValidFixes(validationResults),
+			"selected_fix_confidence": bestFix.Fix.Confidence,
+			"llm_provider":            string(m.LLMProvider),
+			"fix_strategy":            string(m.fixStrategy()),
+			"llm_usage":               runUsage,
+		},
+	}
+	if len(analysis.ModelsUsed) > 0 {
+		result.Metadata["models_used"] = analysis.ModelsUsed
+	}
+	if filtered, ok := analysis.Metadata["filtered_fixes"]; ok {
+		result.Metadata["filtered_fixes"] = filtered
+	}
+	if sarifID != "" {
+		result.Metadata["sarif_id"] = sarifID
+	}
+	if m.GeneratedTests {
+		result.Metadata["generated_tests"] = bestFix.Fix.GeneratedTests
+	}
+	if len(analysis.Jobs) > 0 {
+		result.Metadata["failed_jobs"] = analysis.Jobs
+	}
+	if len(clustered) > 0 {
+		result.Metadata["clustered_runs"] = clusteredRunIDs(clustered)
+	}
+	if retryOutcome != "" {
+		result.Metadata["flaky_retry"] = retryOutcome
+		result.Metadata["flaky_reason"] = retryReason
+	}
+	if len(unaddressed) > 0 {
+		others := make([]map[string]interface{}, 0, len(unaddressed))
+		for _, other := range unaddressed {
+			others = append(others, map[string]interface{}{"id": other.ID, "jobs": other.Jobs, "root_cause": other.RootCause})
+		}
+		result.Metadata["unaddressed_analyses"] = others
+	}
+
+	// Step 5: Apply the PR policy for this failure type
+	settings := m.settings(ctx)
+	decision := settings.Guardrails.demote(settings.decide(analysis, bestFix), bestFix)
+	result.Metadata["pr_policy"] = string(decision.Action)
+	result.Metadata["pr_policy_reason"] = decision.Reason
+
+	if dryRun {
+		m.applyDryRun(ctx, result)
+		result.Success = true
+		result.Timestamp = time.Now()
+		result.Duration = result.Timestamp.Sub(start)
+		return result, nil
+	}
+
+	if decision.Action == PRPolicyAnalysisOnly {
+		m.logger.WithFields(logrus.Fields{
+			"run_id":      runID,
+			"analysis_id": analysis.ID,
+			"fix_id":      bestFix.Fix.ID,
+			"reason":      decision.Reason,
+		}).Info("PR policy withheld the pull request, posting analysis only")
+		m.commentAnalysis(ctx, runID, analysis, "The pull request policy withheld the fix ("+decision.Reason+")")
+
+		result.Timestamp = time.Now()
+		result.Duration = result.Timestamp.Sub(start)
+		return result, nil
+	}
+
+	// Step 6: Push the fix to the pull request it finishes, propose it on the pull request the
+	// run tested, or else create pull requests according to the fix strategy
+	if pr := existingPR(ctx); pr != nil {
+		reportProgress(ctx, ProgressCreatingPR, "", "Adding fix %s to pull request #%d", bestFix.Fix.ID, pr.Number)
+		stageCtx, stage = startSpan(ctx, "autofix.push_pr", attribute.Int("pr_number", pr.Number))
+		outcome, sha, err := m.pushFixToPR(stageCtx, pr, analysis, bestFix)
+		endSpan(stage, err)
+		if err != nil {
+			return nil, fmt.Errorf("updating PR #%d failed: %w", pr.Number, err)
+		}
+		result.PullRequest = pr
+		result.Metadata["pr_number"] = pr.Number
+		result.Metadata["pr_update"] = outcome
+		if sha != "" {
+			result.Metadata["commit_sha"] = sha
+		}
+		result.Success = bestFix.Valid
+		result.Timestamp = time.Now()
+		result.Duration = result.Timestamp.Sub(start)
+
+		m.logger.WithFields(logrus.Fields{
+			"run_id":      runID,
+			"analysis_id": analysis.ID,
+			"fix_id":      bestFix.Fix.ID,
+			"pr_number":   pr.Number,
+			"pr_update":   outcome,
+		}).Info("Automated fix added to the pull request")
+		return result, nil
+	}
 
-	// Step 5: Create pull request
-	pr, err := m.prEngine.CreateFixPR(ctx, analysis, bestFix)
+	if prNumber := analysis.Context.PRNumber; prNumber > 0 && m.prCommentMode() != PRCommentOff {
+		reportProgress(ctx, ProgressCreatingPR, "", "Commenting fix %s on pull request #%d", bestFix.Fix.ID, prNumber)
+		stageCtx, stage = startSpan(ctx, "autofix.comment_pr", attribute.Int("pr_number", prNumber))
+		comment, err := m.commentFixOnPR(stageCtx, analysis, bestFix)
+		endSpan(stage, err)
+		if err != nil {
+			return nil, fmt.Errorf("PR comment failed: %w", err)
+		}
+		result.Metadata["pr_number"] = prNumber
+		result.Metadata["pr_comment"] = comment
+		result.Success = bestFix.Valid
+		result.Timestamp = time.Now()
+		result.Duration = result.Timestamp.Sub(start)
+
+		m.logger.WithFields(logrus.Fields{
+			"run_id":      runID,
+			"analysis_id": analysis.ID,
+			"fix_id":      bestFix.Fix.ID,
+			"pr_number":   prNumber,
+			"comment":     comment,
+		}).Info("Automated fix proposed on the pull request")
+		return result, nil
+	}
+
+	forceDraft := decision.Action == PRPolicyDraft
+	reportProgress(ctx, ProgressCreatingPR, "", "Opening a pull request for fix %s", bestFix.Fix.ID)
+	stageCtx, stage = startSpan(ctx, "autofix.create_pr")
+	prs, err := m.createFixPRs(stageCtx, analysis, m.fixCandidates(ctx, validationResults, bestFix), forceDraft)
+	if err == nil {
+		stage.SetAttributes(attribute.Int("pr_number", prs[0].Number))
+	}
+	endSpan(stage, err)
 	if err != nil {
 		return nil, fmt.Errorf("PR creation failed: %w", err)
 	}
 
-	result := &AutoFixResult{
-		Analysis:    analysis,
-		Fix:         bestFix,
-		PullRequest: pr,
-		Timestamp:   time.Now(),
+	pr := prs[0]
+	result.PullRequest = pr
+	result.PullRequests = prs
+	reportProgress(ctx, ProgressCreatingPR, "", "Opened pull request #%d", pr.Number)
+	m.trackPRs(analysis.Context.WorkflowRun, analysis.Classification.Type, prs)
+	if pr.Existing {
+		result.Metadata["existing_pr"] = true
+	} else {
+		notification := analysisNotification(FixPROpened, runID, analysis)
+		notification.PRNumber = pr.Number
+		notification.PRURL = pr.URL
+		m.notify(ctx, notification)
 	}
+	result.Success = pr != nil && bestFix.Valid
+	result.Timestamp = time.Now()
+	result.Duration = result.Timestamp.Sub(start)
 
 	m.logger.WithFields(logrus.Fields{
-		"pr_number": pr.Number,
-		"pr_url":    pr.URL,
+		"run_id":      runID,
+		"analysis_id": analysis.ID,
+		"fix_id":      bestFix.Fix.ID,
+		"pr_number":   pr.Number,
+		"pr_url":      pr.URL,
 	}).Info("Automated fix completed successfully")
 
 	return result, nil
@@ -327,57 +1795,222 @@ func (m *DaggerAutofix) AutoFix(ctx context.Context, runID int64) (*AutoFixResul
 
 // ValidateFix validates a proposed fix by running tests and checking coverage
 func (m *DaggerAutofix) ValidateFix(ctx context.Context, fix *ProposedFix) (*FixValidationResult, error) {
+	return m.validateFix(ctx, fix, 0)
+}
+
+// validateFix validates the index-th of the fixes validated together, whose test branches
+// are told apart by their index. A zero index is a fix validated on its own.
+func (m *DaggerAutofix) validateFix(ctx context.Context, fix *ProposedFix, index int) (*FixValidationResult, error) {
 	if m.testEngine == nil {
-		return nil, fmt.Errorf("module not initialized, call Initialize first")
+		return nil, ErrNotInitialized
 	}
 
 	m.logger.WithField("fix_id", fix.ID).Info("Validating proposed fix")
+	ctx = withProgress(ctx, m.progress, m.logger, 0)
+	reportProgress(ctx, ProgressValidatingFix, "", "Validating fix %s", fix.ID)
+
+	// The guardrails are checked first, so a rejected fix costs no test run
+	guardrails := m.settings(ctx).Guardrails
+	violations := guardrails.check(fix)
+	if len(violations) > 0 {
+		m.logger.WithFields(logrus.Fields{
+			"fix_id":     fix.ID,
+			"violations": violations,
+			"action":     guardrails.Action,
+		}).Warn("Fix exceeds the fix guardrails")
+	}
+	if len(violations) > 0 && guardrails.Action == GuardrailReject {
+		reportProgress(ctx, ProgressValidatingFix, "", "Fix %s exceeds the fix guardrails", fix.ID)
+		return &FixValidationResult{
+			Fix:                 fix,
+			Timestamp:           time.Now(),
+			Errors:              violations,
+			GuardrailViolations: violations,
+		}, nil
+	}
 
-	// Create temporary branch with fix
-	testBranch := fmt.Sprintf("autofix-test-%s-%d", fix.ID, time.Now().Unix())
-	cleanup, err := m.githubClient.CreateTestBranch(ctx, testBranch, fix.Changes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create test branch: %w", err)
+	// Binary files cannot be edited as text, and generated files are regenerated rather than
+	// trusting the proposed content
+	if problems := m.checkFixFiles(ctx, fix); len(problems) > 0 {
+		m.logger.WithFields(logrus.Fields{"fix_id": fix.ID, "problems": problems}).Warn("Fix changes binary or generated files")
+		reportProgress(ctx, ProgressValidatingFix, "", "Fix %s changes binary or generated files", fix.ID)
+		return &FixValidationResult{
+			Fix:       fix,
+			Timestamp: time.Now(),
+			Errors:    problems,
+		}, nil
 	}
-	defer cleanup()
 
-	// Run tests
-	testResult, err := m.testEngine.RunTests(ctx, m.RepoOwner, m.RepoName, testBranch)
+	testStart := time.Now()
+	testResult, err := m.runFixTests(ctx, fix, index)
+	agentMetrics.testDuration.observe(time.Since(testStart).Seconds())
 	if err != nil {
-		return nil, fmt.Errorf("test execution failed: %w", err)
+		reportProgress(ctx, ProgressValidatingFix, "", "Fix %s could not be validated", fix.ID)
+		return nil, err
 	}
+	m.redactor.RedactTestResult(testResult)
 
 	validation := &FixValidationResult{
 		Fix:        fix,
 		TestResult: testResult,
-		Valid:      testResult.Success && testResult.Coverage >= float64(m.MinCoverage),
 		Timestamp:  time.Now(),
 	}
-
-	m.logger.WithFields(logrus.Fields{
-		"tests_passed": testResult.Success,
-		"coverage":     testResult.Coverage,
-		"valid":        validation.Valid,
-	}).Info("Fix validation completed")
+	if testResult.Details["stage"] == stageWorkflow {
+		// The linter output explains why the fix was rejected
+		validation.Errors = append(validation.Errors, testResult.Errors...)
+	}
+	m.applyCoveragePolicy(ctx, validation)
+	validation.StepResults = testResult.Steps
+	for _, step := range failedSteps(testResult.Steps) {
+		validation.Valid = false
+		validation.Errors = append(validation.Errors, fmt.Sprintf("Validation step %s failed: %s", step.Name, step.Note))
+	}
+	validation.Errors = append(validation.Errors, violations...)
+	validation.GuardrailViolations = violations
+
+	fields := logrus.Fields{
+		"tests_passed":    testResult.testsPassed(),
+		"coverage":        testResult.Coverage,
+		"coverage_policy": validation.CoveragePolicy,
+		"valid":           validation.Valid,
+	}
+	if validation.Coverage != nil {
+		fields["base_coverage"] = validation.Coverage.BaseCoverage
+		fields["coverage_delta"] = validation.Coverage.Delta
+	}
+	m.logger.WithFields(fields).Info("Fix validation completed")
+	if validation.Valid {
+		reportProgress(ctx, ProgressValidatingFix, "", "Fix %s passed validation", fix.ID)
+	} else {
+		reportProgress(ctx, ProgressValidatingFix, "", "Fix %s failed validation", fix.ID)
+	}
 
 	return validation, nil
 }
 
+// addGeneratedTests validates the fix again with generated tests added to its changes and
+// returns that validation when it still passes. Otherwise the original validation is kept.
+func (m *DaggerAutofix) addGeneratedTests(ctx context.Context, analysis *FailureAnalysisResult, validation *FixValidationResult) *FixValidationResult {
+	log := m.logger.WithField("fix_id", validation.Fix.ID)
+
+	tests, err := m.testEngine.GenerateTestsForFix(ctx, validation.Fix, analysis)
+	if err != nil {
+		log.WithError(err).Warn("Test generation failed, keeping the fix without generated tests")
+		return validation
+	}
+	if len(tests) == 0 {
+		return validation
+	}
+
+	fix := *validation.Fix
+	fix.Changes = append(append([]CodeChange{}, validation.Fix.Changes...), tests...)
+	fix.GeneratedTests = make([]string, 0, len(tests))
+	for _, test := range tests {
+		fix.GeneratedTests = append(fix.GeneratedTests, test.FilePath)
+	}
+
+	withTests, err := m.ValidateFix(ctx, &fix)
+	if err != nil {
+		log.WithError(err).Warn("Validation with generated tests failed, dropping them")
+		return validation
+	}
+	if !withTests.Valid {
+		log.WithField("generated_tests", fix.GeneratedTests).Warn("Fix is not valid with generated tests, dropping them")
+		return validation
+	}
+
+	log.WithField("generated_tests", fix.GeneratedTests).Info("Added generated tests to fix")
+	return withTests
+}
+
+// runFixTests applies the fix to the local source when available and at the failed commit,
+// and otherwise pushes a temporary branch and tests a clone of it. Fixes finishing a pull
+// request are tested on top of its branch.
+func (m *DaggerAutofix) runFixTests(ctx context.Context, fix *ProposedFix, index int) (*TestResult, error) {
+	if pr := existingPR(ctx); pr != nil {
+		return m.runFixTestsOnPR(ctx, fix, index, pr)
+	}
+	if m.validatesOnSource(ctx, fix) {
+		testResult, err := m.testEngine.RunTestsWithChanges(ctx, m.Source, fix.Changes, fix.Validation...)
+		if err != nil {
+			return nil, fmt.Errorf("test execution failed: %w", err)
+		}
+		return testResult, nil
+	}
+
+	// Create temporary branch with fix
+	testBranch := testBranchName(fix, index)
+	if err := validateBranchName(testBranch); err != nil {
+		return nil, err
+	}
+	cleanup, err := m.githubClient.CreateTestBranch(ctx, testBranch, fix.Changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create test branch: %w", err)
+	}
+	audit(ctx, AuditBranchCreated, map[string]interface{}{"branch": testBranch, "purpose": "validation"})
+	audit(ctx, AuditFilesModified, map[string]interface{}{"branch": testBranch, "fix_id": fix.ID, "files": auditChanges(fix.Changes)})
+	// Registered so shutdown deletes the branch when the fix does not finish in time
+	m.testBranches.add(testBranch, func() {
+		cleanup()
+		audit(ctx, AuditBranchDeleted, map[string]interface{}{"branch": testBranch})
+	})
+	defer m.testBranches.release(testBranch)
+
+	// Run tests
+	testResult, err := m.testEngine.RunTests(ctx, m.RepoOwner, m.RepoName, testBranch, fix.Validation...)
+	if err != nil {
+		return nil, fmt.Errorf("test execution failed: %w", err)
+	}
+	return testResult, nil
+}
+
 // GetMetrics returns operational metrics for monitoring
 func (m *DaggerAutofix) GetMetrics(ctx context.Context) (*OperationalMetrics, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 	if m.githubClient == nil {
-		return nil, fmt.Errorf("module not initialized")
+		return nil, ErrNotInitialized
+	}
+	// A fix succeeds once its PR is merged; PRs closed unmerged count as failed fixes
+	outcomes, err := m.trackedOutcomes()
+	if err != nil {
+		return nil, err
 	}
-	return &OperationalMetrics{
-		TotalFailuresDetected: 0, // TODO: implement metrics collection
-		SuccessfulFixes:       0,
-		FailedFixes:           0,
+	metrics := &OperationalMetrics{
+		TotalFailuresDetected: int(m.stats.failuresDetected.Load()),
+		SuccessfulFixes:       outcomes.merged,
+		FailedFixes:           int(m.stats.failedFixes.Load()) + outcomes.closed,
+		CompletedFixes:        int(m.stats.completedFixes.Load()),
+		FlakyResolvedByRetry:  int(m.flakyResolved()),
+		ClusteredFailures:     int(m.stats.clusteredRuns.Load()),
+		OpenFixPRs:            outcomes.open,
+		SupersededFixPRs:      outcomes.superseded,
+		VerifiedFixes:         outcomes.verified,
+		UnverifiedFixes:       outcomes.unverified,
 		AverageFixTime:        0,
 		TestCoverage:          float64(m.MinCoverage),
-	}, nil
+		GitHubRateRemaining:   -1,
+		LastUpdated:           time.Now(),
+	}
+	for failureType, verifications := range outcomes.verificationsByType {
+		if metrics.VerifiedRateByType == nil {
+			metrics.VerifiedRateByType = make(map[FailureType]float64)
+		}
+		metrics.VerifiedRateByType[failureType] = float64(outcomes.verifiedByType[failureType]) / float64(verifications)
+	}
+	if directClient, ok := m.githubClient.(*GitHubIntegration); ok {
+		metrics.GitHubRateRemaining = directClient.RateRemaining()
+	}
+	metrics.Health = m.health.status()
+	metrics.LLMUsage = m.usage.providers()
+	total := metrics.LLMUsage.total()
+	metrics.LLMTokensUsed = total.TotalTokens
+	metrics.LLMEstimatedCost = total.EstimatedCostUSD
+	m.reposMu.Lock()
+	metrics.Discovery = m.discovery
+	m.reposMu.Unlock()
+	return metrics, nil
 }
 
 // CLI returns a CLI container for manual execution
@@ -407,44 +2040,194 @@ func (m *DaggerAutofix) CLI() (container *dagger.Container) {
 // Helper methods
 
 func (m *DaggerAutofix) validateConfiguration() error {
-	if m.GitHubToken == nil {
+	if !m.LogsOnly {
+		if err := m.validateGitHubConfiguration(); err != nil {
+			return err
+		}
+	}
+	if err := validateFixStrategy(m.FixStrategy); err != nil {
+		return err
+	}
+	if err := m.PRPolicy.validate(); err != nil {
+		return err
+	}
+	if err := m.AllowedFixTypes.validate(); err != nil {
+		return err
+	}
+	if err := validatePRCommentMode(m.PRCommentMode); err != nil {
+		return err
+	}
+	if err := validateTestNetwork(m.TestNetwork); err != nil {
+		return err
+	}
+	if _, err := parseCommitTemplate(m.CommitTemplate); err != nil {
+		return fmt.Errorf("invalid commit template: %w", err)
+	}
+	if err := validateCoveragePolicy(m.CoveragePolicy); err != nil {
+		return err
+	}
+	if err := m.FixGuardrails.validate(); err != nil {
+		return err
+	}
+	if err := m.ContextPolicy.validate(); err != nil {
+		return err
+	}
+	if err := m.FileClassification.validate(); err != nil {
+		return err
+	}
+	if err := m.LogChunking.validate(); err != nil {
+		return err
+	}
+	if err := validateNotificationFormat(m.NotificationFormat); err != nil {
+		return err
+	}
+	if err := validateLogOptions(m.LogLevel, m.LogFormat); err != nil {
+		return err
+	}
+	if m.CoverageTolerance < 0 {
+		return fmt.Errorf("coverage tolerance must not be negative, got %v", m.CoverageTolerance)
+	}
+	if m.EscalationConfidence < 0 || m.EscalationConfidence > 1 {
+		return fmt.Errorf("escalation confidence must be between 0 and 1, got %v", m.EscalationConfidence)
+	}
+	return m.validateLLMConfiguration()
+}
+
+// validateGitHubConfiguration checks the credentials and repositories everything but
+// AnalyzeLogText needs
+func (m *DaggerAutofix) validateGitHubConfiguration() error {
+	if m.GitHubApp != nil {
+		if err := validateGitHubAppConfig(m.GitHubApp); err != nil {
+			return err
+		}
+	} else if m.GitHubToken == nil {
 		return fmt.Errorf("GitHub token is required")
 	}
-	if m.RepoOwner == "" || m.RepoName == "" {
+	if (m.RepoOwner == "" || m.RepoName == "") && m.Organization == "" {
 		return fmt.Errorf("repository owner and name are required")
 	}
+	if m.Organization != "" {
+		if err := validateOwner(m.Organization); err != nil {
+			return err
+		}
+	}
+	if m.RepoName != "" {
+		if err := validateRepository(m.RepoOwner, m.RepoName); err != nil {
+			return err
+		}
+	}
+	if m.TargetBranch != "" {
+		if err := validateBranchName(m.TargetBranch); err != nil {
+			return fmt.Errorf("invalid target branch: %w", err)
+		}
+	}
+	if _, err := m.monitoredRepositories(); err != nil {
+		return err
+	}
+	if err := validateRepoFilter(m.RepoFilter); err != nil {
+		return err
+	}
+	if endpoints := m.githubEndpoints(); endpoints.isEnterprise() {
+		if _, err := normalizeEnterpriseURL(endpoints.APIURL, enterpriseAPIPath); err != nil {
+			return fmt.Errorf("invalid GitHub API URL: %w", err)
+		}
+		if endpoints.UploadURL != "" {
+			if _, err := normalizeEnterpriseURL(endpoints.UploadURL, enterpriseUploadPath); err != nil {
+				return fmt.Errorf("invalid GitHub upload URL: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateLLMConfiguration checks the LLM settings every mode needs
+func (m *DaggerAutofix) validateLLMConfiguration() error {
+	if m.LLMCacheTTL < 0 {
+		return fmt.Errorf("LLM cache TTL must not be negative, got %v", m.LLMCacheTTL)
+	}
+	if err := validateLLMHeaders(llmHeaderMap(m.LLMHeaders)); err != nil {
+		return err
+	}
+	for _, price := range m.LLMPricing {
+		if err := validateLLMPrice(price); err != nil {
+			return err
+		}
+	}
 	if m.LLMAPIKey == nil {
 		return fmt.Errorf("LLM API key is required")
 	}
 	return nil
 }
 
+// githubEndpoints returns the configured GitHub Enterprise endpoints, or nil for github.com
+func (m *DaggerAutofix) githubEndpoints() *GitHubEndpoints {
+	if m.GitHubAPIURL == "" {
+		return nil
+	}
+	return &GitHubEndpoints{APIURL: m.GitHubAPIURL, UploadURL: m.GitHubUploadURL}
+}
+
 func (m *DaggerAutofix) ensureInitialized() error {
 	if m.githubClient == nil || m.llmClient == nil || m.failureEngine == nil {
-		return fmt.Errorf("module not initialized, call Initialize first")
+		return ErrNotInitialized
 	}
 	return nil
 }
 
-func (m *DaggerAutofix) checkForFailures(ctx context.Context) error {
-	failedRuns, err := m.githubClient.GetFailedWorkflowRuns(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to get workflow runs: %w", err)
+// ensureFixPool lazily starts the worker pool that runs monitored auto-fixes
+func (m *DaggerAutofix) ensureFixPool(ctx context.Context) *fixWorkerPool {
+	m.poolMu.Lock()
+	defer m.poolMu.Unlock()
+
+	if m.fixPool == nil {
+		m.fixPool = newFixWorkerPool(ctx, m.MaxConcurrentFixes, m.FixTimeout, func(ctx context.Context, runID int64) (err error) {
+			panicked := true
+			defer func() {
+				if panicked {
+					// The pool recovers the panic, and the run is freed rather than skipped
+					// until its lease expires
+					m.runClaims.release(runID)
+					return
+				}
+				m.finishRun(runID, err)
+			}()
+
+			agent, run := m.dequeueRun(runID)
+			if run != nil {
+				// Notified by the worker, so the failure precedes the events of its fix
+				agent.notify(ctx, runNotification(FailureDetected, runID, run))
+			}
+			_, err = agent.AutoFix(ctx, runID)
+			panicked = false
+			return err
+		}, &m.stats, m.logger)
 	}
+	return m.fixPool
+}
 
-	for _, run := range failedRuns {
-		if !m.shouldProcessRun(run) {
-			continue
-		}
+// drainFixes waits for in-flight auto-fixes to finish before monitoring exits
+func (m *DaggerAutofix) drainFixes() {
+	m.poolMu.Lock()
+	pool := m.fixPool
+	m.fixPool = nil
+	m.poolMu.Unlock()
 
-		go func(runID int64) {
-			if _, err := m.AutoFix(ctx, runID); err != nil {
-				m.logger.WithError(err).WithField("run_id", runID).Error("Auto-fix failed")
-			}
-		}(run.ID)
+	if pool == nil {
+		return
 	}
 
-	return nil
+	m.logger.WithField("timeout", m.drainTimeout()).Info("Waiting for in-flight auto-fixes to finish")
+	if err := pool.Shutdown(m.drainTimeout()); err != nil {
+		m.logger.WithError(err).Warn("Cancelled in-flight auto-fixes")
+	}
+}
+
+// drainTimeout returns DrainTimeout, or the default when unset
+func (m *DaggerAutofix) drainTimeout() time.Duration {
+	if m.DrainTimeout <= 0 {
+		return DefaultDrainTimeout
+	}
+	return m.DrainTimeout
 }
 
 func (m *DaggerAutofix) shouldProcessRun(run *WorkflowRun) bool {
@@ -454,6 +2237,78 @@ func (m *DaggerAutofix) shouldProcessRun(run *WorkflowRun) bool {
 	return true // Simplified for now
 }
 
+// applyDryRun records the pull request AutoFix would have opened for the selected fix, or
+// the pull request the fix would have been added to
+func (m *DaggerAutofix) applyDryRun(ctx context.Context, result *AutoFixResult) {
+	fix := result.Fix
+	changedFiles := make([]string, 0, len(fix.Fix.Changes))
+	for _, change := range fix.Fix.Changes {
+		changedFiles = append(changedFiles, change.paths()...)
+	}
+
+	result.Metadata["dry_run"] = true
+	result.Metadata["changed_files"] = changedFiles
+	if pr := existingPR(ctx); pr != nil {
+		result.Metadata["pr_number"] = pr.Number
+		result.Metadata["branch_name"] = pr.Branch
+	} else if m.prEngine != nil {
+		plan := m.prEngine.PreviewFixPR(result.Analysis, fix)
+		result.Metadata["branch_name"] = plan.BranchName
+		result.Metadata["target_branch"] = plan.TargetBranch
+		result.Metadata["pr_title"] = plan.Title
+	}
+
+	m.logger.WithFields(logrus.Fields{
+		"fix_id":        fix.Fix.ID,
+		"changed_files": len(changedFiles),
+	}).Info("Dry run completed, skipping pull request creation")
+}
+
+// countValidFixes returns how many validation results passed
+func countValidFixes(validations []*FixValidationResult) int {
+	count := 0
+	for _, validation := range validations {
+		if validation.Valid {
+			count++
+		}
+	}
+	return count
+}
+
+// noPassingFixError explains why none of the validated fixes is valid. When tests passed,
+// the coverage of the best covered fix was too low.
+func (m *DaggerAutofix) noPassingFixError(ctx context.Context, validations []*FixValidationResult) error {
+	var covered *TestResult
+	for _, validation := range validations {
+		if result := validation.TestResult; result != nil && result.testsPassed() && (covered == nil || result.Coverage > covered.Coverage) {
+			covered = result
+		}
+	}
+	if covered == nil {
+		if rejected := rejectedByGuardrails(validations); rejected != nil {
+			return fmt.Errorf("%w: no fix passed validation: %s", ErrNoValidFixes, guardrailReason(rejected))
+		}
+		return fmt.Errorf("%w: no fix passed validation", ErrNoValidFixes)
+	}
+	return fmt.Errorf("%w: no fix passed validation: %w", ErrNoValidFixes, &CoverageError{Coverage: covered.Coverage, Minimum: float64(m.settings(ctx).MinCoverage), NotMeasured: covered.CoverageUnknown})
+}
+
+// failedAutoFixResult is the result AutoFix returns alongside err
+func failedAutoFixResult(runID int64, start time.Time, analysis *FailureAnalysisResult, err error) *AutoFixResult {
+	result := &AutoFixResult{
+		ID:       fmt.Sprintf("autofix-%d-%d", runID, start.Unix()),
+		Analysis: analysis,
+		Success:  false,
+		Metadata: map[string]interface{}{
+			"error_category": string(errorCategory(err)),
+			"error":          err.Error(),
+		},
+	}
+	result.Timestamp = time.Now()
+	result.Duration = result.Timestamp.Sub(start)
+	return result
+}
+
 func (m *DaggerAutofix) selectBestFix(validations []*FixValidationResult) *FixValidationResult {
 	var best *FixValidationResult
 	for _, validation := range validations {
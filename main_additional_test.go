@@ -165,7 +165,7 @@ func TestNewModule(t *testing.T) {
 	// Test default values
 	assert.NotNil(t, module)
 	assert.Equal(t, LLMProvider("openai"), module.LLMProvider)
-	assert.Equal(t, "main", module.TargetBranch)
+	assert.Empty(t, module.TargetBranch)
 	assert.Equal(t, 85, module.MinCoverage)
 	assert.NotNil(t, module.logger)
 	
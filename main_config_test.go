@@ -96,10 +96,10 @@ func TestInitializeAndEnsureInitialized(t *testing.T) {
 			newPullRequestEngine = oldPR
 		}()
 
-		newGitHubIntegration = func(ctx context.Context, token *dagger.Secret, owner, name string) (*GitHubIntegration, error) {
+		newGitHubIntegration = func(ctx context.Context, token *dagger.Secret, owner, name string, endpoints *GitHubEndpoints, logger *logrus.Logger) (*GitHubIntegration, error) {
 			return &GitHubIntegration{}, nil
 		}
-		newLLMClient = func(ctx context.Context, provider LLMProvider, apiKey *dagger.Secret) (*LLMClient, error) {
+		newLLMClient = func(ctx context.Context, provider LLMProvider, apiKey *dagger.Secret, logger *logrus.Logger) (*LLMClient, error) {
 			return &LLMClient{}, nil
 		}
 		newFailureAnalysisEngine = func(llmClient LLMClientInterface, logger *logrus.Logger) *FailureAnalysisEngine {
@@ -17,7 +17,7 @@ func TestDaggerAutofix(t *testing.T) {
 		module := New()
 		assert.NotNil(t, module)
 		assert.Equal(t, LLMProvider("openai"), module.LLMProvider)
-		assert.Equal(t, "main", module.TargetBranch)
+		assert.Empty(t, module.TargetBranch)
 		assert.Equal(t, 85, module.MinCoverage)
 	})
 
@@ -275,7 +275,7 @@ func TestLLMClient(t *testing.T) {
 		apiKey := createTestSecret("test-key", "test-value")
 
 		// This would fail in real testing without valid API key
-		_, err := NewLLMClient(ctx, OpenAI, apiKey)
+		_, err := NewLLMClient(ctx, OpenAI, apiKey, nil)
 		if err != nil {
 			t.Skip("Skipping LLM client test - requires valid API key")
 		}
@@ -393,13 +393,10 @@ func TestPullRequestEngine(t *testing.T) {
 
 	t.Run("GenerateBranchName", func(t *testing.T) {
 		engine := NewPullRequestEngine(nil, logrus.New())
-		analysis := &FailureAnalysisResult{ID: "analysis-123"}
-		fix := &ProposedFix{Type: DependencyFix}
+		analysis := &FailureAnalysisResult{ID: "analysis-123", Classification: FailureClassification{Type: DependencyFailure}}
 
-		branchName := engine.generateBranchName(analysis, fix)
-		assert.Contains(t, branchName, "autofix")
-		assert.Contains(t, branchName, "dependency")
-		assert.Contains(t, branchName, "analysis-123")
+		branchName := engine.generateBranchName(analysis)
+		assert.Equal(t, "autofix/dependency/"+shortHash("analysis-123", analysisHashLength), branchName)
 	})
 }
 
@@ -541,7 +538,7 @@ func TestProposedFix(t *testing.T) {
 		assert.Equal(t, 0.9, fix.Confidence)
 		assert.Len(t, fix.Changes, 1)
 		assert.Equal(t, "main.go", fix.Changes[0].FilePath)
-		assert.Equal(t, "modify", fix.Changes[0].Operation)
+		assert.Equal(t, ChangeOperationModify, fix.Changes[0].Operation)
 	})
 }
 
@@ -751,7 +748,7 @@ func TestValidateFix(t *testing.T) {
 
 		fix := &ProposedFix{
 			ID:          "comprehensive-fix",
-			Type:        ConfigurationFix,
+			Type:        WorkflowFix,
 			Confidence:  0.95,
 			Description: "Fix configuration issue",
 			Changes: []CodeChange{
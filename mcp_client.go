@@ -5,7 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os/exec"
+	"strings"
+	"time"
 
+	"github.com/google/go-github/v45/github"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/sirupsen/logrus"
 )
@@ -115,6 +118,7 @@ func (m *MCPClient) Close() error {
 // MCPGitHubClient implements GitHubClient interface using MCP
 type MCPGitHubClient struct {
 	*MCPClient
+	targetBranch string
 }
 
 // NewMCPGitHubClient creates a new GitHub client using MCP
@@ -129,6 +133,11 @@ func NewMCPGitHubClient(config *MCPConfig, logger *logrus.Logger) (*MCPGitHubCli
 	}, nil
 }
 
+// SetTargetBranch configures the branch that test branches are created from
+func (m *MCPGitHubClient) SetTargetBranch(branch string) {
+	m.targetBranch = branch
+}
+
 // GetWorkflowRun retrieves a workflow run via MCP
 func (m *MCPGitHubClient) GetWorkflowRun(ctx context.Context, runID int64) (*WorkflowRun, error) {
 	result, err := m.CallTool(ctx, "get_workflow_run", map[string]interface{}{
@@ -164,6 +173,130 @@ func (m *MCPGitHubClient) GetWorkflowLogs(ctx context.Context, runID int64) (*Wo
 	return &logs, nil
 }
 
+// GetWorkflowRunAttempt retrieves a workflow run as of one of its attempts via MCP
+func (m *MCPGitHubClient) GetWorkflowRunAttempt(ctx context.Context, runID int64, attempt int) (*WorkflowRun, error) {
+	result, err := m.CallTool(ctx, "get_workflow_run", map[string]interface{}{
+		"run_id":  runID,
+		"attempt": attempt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attempt %d of workflow run: %w", attempt, err)
+	}
+
+	var workflowRun WorkflowRun
+	if err := parseToolResult(result, &workflowRun); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow run result: %w", err)
+	}
+	return &workflowRun, nil
+}
+
+// GetWorkflowRunAttemptLogs retrieves the logs of one attempt of a workflow run via MCP
+func (m *MCPGitHubClient) GetWorkflowRunAttemptLogs(ctx context.Context, runID int64, attempt int) (*WorkflowLogs, error) {
+	result, err := m.CallTool(ctx, "get_workflow_logs", map[string]interface{}{
+		"run_id":  runID,
+		"attempt": attempt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logs of attempt %d: %w", attempt, err)
+	}
+
+	var logs WorkflowLogs
+	if err := parseToolResult(result, &logs); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow logs result: %w", err)
+	}
+	return &logs, nil
+}
+
+// GetJobRunID returns the ID of the workflow run a job belongs to via MCP
+func (m *MCPGitHubClient) GetJobRunID(ctx context.Context, jobID int64) (int64, error) {
+	result, err := m.CallTool(ctx, "get_workflow_job", map[string]interface{}{
+		"job_id": jobID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get workflow job: %w", err)
+	}
+	var job github.WorkflowJob
+	if err := parseToolResult(result, &job); err != nil {
+		return 0, fmt.Errorf("failed to parse workflow job result: %w", err)
+	}
+	return job.GetRunID(), nil
+}
+
+// GetCheckRunAnnotations returns the annotations of the check runs of a workflow run via MCP.
+// The check run of an Actions job has the job's ID, so the annotations of each of the run's
+// jobs are listed.
+func (m *MCPGitHubClient) GetCheckRunAnnotations(ctx context.Context, runID int64) ([]Annotation, error) {
+	result, err := m.CallTool(ctx, "list_workflow_jobs", map[string]interface{}{
+		"run_id": runID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workflow jobs: %w", err)
+	}
+	var jobs github.Jobs
+	if err := parseToolResult(result, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow jobs result: %w", err)
+	}
+
+	var annotations []Annotation
+	for _, job := range jobs.Jobs {
+		result, err := m.CallTool(ctx, "list_check_run_annotations", map[string]interface{}{
+			"check_run_id": job.GetID(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list annotations of job %s: %w", job.GetName(), err)
+		}
+		var page []*github.CheckRunAnnotation
+		if err := parseToolResult(result, &page); err != nil {
+			return nil, fmt.Errorf("failed to parse annotations result: %w", err)
+		}
+		for _, annotation := range page {
+			annotations = append(annotations, newAnnotation(job.GetName(), annotation))
+		}
+	}
+	return annotations, nil
+}
+
+// GetWorkflowDefinition retrieves the workflow file a run was started from via MCP, read at
+// the run's head commit
+func (m *MCPGitHubClient) GetWorkflowDefinition(ctx context.Context, runID int64) (string, string, error) {
+	result, err := m.CallTool(ctx, "get_workflow_run", map[string]interface{}{
+		"run_id": runID,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get workflow run: %w", err)
+	}
+
+	// The tool returns the run as the GitHub REST API does, which includes the workflow path
+	var run struct {
+		Path    string `json:"path"`
+		HeadSHA string `json:"head_sha"`
+	}
+	if err := parseToolResult(result, &run); err != nil {
+		return "", "", fmt.Errorf("failed to parse workflow run result: %w", err)
+	}
+	if run.Path == "" {
+		return "", "", fmt.Errorf("workflow run %d has no workflow path", runID)
+	}
+
+	result, err = m.CallTool(ctx, "get_file_contents", map[string]interface{}{
+		"path": run.Path,
+		"ref":  run.HeadSHA,
+	})
+	if err != nil {
+		return run.Path, "", fmt.Errorf("failed to get %s: %w", run.Path, err)
+	}
+
+	var file github.RepositoryContent
+	if err := parseToolResult(result, &file); err != nil {
+		return run.Path, "", fmt.Errorf("failed to parse %s: %w", run.Path, err)
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return run.Path, "", fmt.Errorf("failed to decode %s: %w", run.Path, err)
+	}
+	return run.Path, content, nil
+}
+
 // GetFailedWorkflowRuns retrieves failed workflow runs via MCP
 func (m *MCPGitHubClient) GetFailedWorkflowRuns(ctx context.Context) ([]*WorkflowRun, error) {
 	result, err := m.CallTool(ctx, "list_workflow_runs", map[string]interface{}{
@@ -188,19 +321,159 @@ func (m *MCPGitHubClient) GetFailedWorkflowRuns(ctx context.Context) ([]*Workflo
 	return ptrRuns, nil
 }
 
+// GetCommitWorkflowRuns lists the runs of any status on branch for commit sha via MCP
+func (m *MCPGitHubClient) GetCommitWorkflowRuns(ctx context.Context, branch, sha string, since time.Time) ([]*WorkflowRun, error) {
+	result, err := m.CallTool(ctx, "list_workflow_runs", map[string]interface{}{
+		"branch":   branch,
+		"head_sha": sha,
+		"created":  ">=" + since.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow runs for commit: %w", err)
+	}
+
+	var runs []WorkflowRun
+	if err := parseToolResult(result, &runs); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow runs result: %w", err)
+	}
+
+	var ptrRuns []*WorkflowRun
+	for i := range runs {
+		// Servers may ignore filters they do not support
+		if runs[i].CommitSHA == sha {
+			ptrRuns = append(ptrRuns, &runs[i])
+		}
+	}
+
+	return ptrRuns, nil
+}
+
+// GetRecentWorkflowRuns lists the last completed runs of a workflow on branch via MCP
+func (m *MCPGitHubClient) GetRecentWorkflowRuns(ctx context.Context, workflowID int64, branch string, limit int) ([]*WorkflowRun, error) {
+	result, err := m.CallTool(ctx, "list_workflow_runs", map[string]interface{}{
+		"workflow_id": workflowID,
+		"branch":      branch,
+		"status":      "completed",
+		"per_page":    limit,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent workflow runs: %w", err)
+	}
+
+	var runs []WorkflowRun
+	if err := parseToolResult(result, &runs); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow runs result: %w", err)
+	}
+
+	var ptrRuns []*WorkflowRun
+	for i := range runs {
+		// Servers may ignore filters they do not support
+		if runs[i].WorkflowID == workflowID && runs[i].Branch == branch && runs[i].Status == "completed" && len(ptrRuns) < limit {
+			ptrRuns = append(ptrRuns, &runs[i])
+		}
+	}
+
+	return ptrRuns, nil
+}
+
+// GetSuccessfulWorkflowRuns lists the successful runs on branch for commit sha via MCP
+func (m *MCPGitHubClient) GetSuccessfulWorkflowRuns(ctx context.Context, branch, sha string, since time.Time) ([]*WorkflowRun, error) {
+	result, err := m.CallTool(ctx, "list_workflow_runs", map[string]interface{}{
+		"branch":     branch,
+		"head_sha":   sha,
+		"status":     "completed",
+		"conclusion": "success",
+		"created":    ">=" + since.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get successful workflow runs: %w", err)
+	}
+
+	var runs []WorkflowRun
+	if err := parseToolResult(result, &runs); err != nil {
+		return nil, fmt.Errorf("failed to parse workflow runs result: %w", err)
+	}
+
+	var ptrRuns []*WorkflowRun
+	for i := range runs {
+		// Servers may ignore filters they do not support
+		if runs[i].CommitSHA == sha && runs[i].Conclusion == "success" {
+			ptrRuns = append(ptrRuns, &runs[i])
+		}
+	}
+
+	return ptrRuns, nil
+}
+
+// RerunWorkflowFailedJobs re-runs the failed jobs of a workflow run via MCP
+func (m *MCPGitHubClient) RerunWorkflowFailedJobs(ctx context.Context, runID int64) error {
+	_, err := m.CallTool(ctx, "rerun_failed_jobs", map[string]interface{}{
+		"run_id": runID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to re-run failed jobs: %w", err)
+	}
+	return nil
+}
+
+// WaitForWorkflowRun polls a workflow run via MCP until attempt minAttempt or a later one completes
+func (m *MCPGitHubClient) WaitForWorkflowRun(ctx context.Context, runID int64, minAttempt int, timeout time.Duration) (*WorkflowRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval(ctx))
+	defer ticker.Stop()
+	for {
+		run, err := m.GetWorkflowRun(ctx, runID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("timed out waiting for workflow run %d to complete: %w", runID, ctx.Err())
+			}
+			return nil, err
+		}
+		if run.Status == "completed" && run.RunAttempt >= minAttempt {
+			return run, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out waiting for workflow run %d to complete: %w", runID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
 // CreateTestBranch creates a test branch with changes via MCP
 func (m *MCPGitHubClient) CreateTestBranch(ctx context.Context, branchName string, changes []CodeChange) (func(), error) {
+	baseBranch := m.targetBranch
+	if baseBranch == "" {
+		baseBranch = "main"
+	}
+
 	// First create the branch
-	_, err := m.CallTool(ctx, "create_branch", map[string]interface{}{
-		"branch": branchName,
-		"from":   "main", // TODO: make configurable
-	})
-	if err != nil {
+	if err := m.CreateBranch(ctx, branchName, baseBranch); err != nil {
 		return nil, fmt.Errorf("failed to create test branch: %w", err)
 	}
 
+	// Return cleanup function, which still deletes the branch once ctx is cancelled
+	cleanup := func() {
+		cleanupCtx, cancel := cleanupContext(ctx)
+		defer cancel()
+		if cleanupErr := m.DeleteBranch(cleanupCtx, branchName); cleanupErr != nil {
+			m.logger.WithError(cleanupErr).Error("Failed to cleanup test branch")
+		}
+	}
+
 	// Apply changes
 	for _, change := range changes {
+		if change.Operation == ChangeOperationRename {
+			if err := m.renameFile(ctx, branchName, change); err != nil {
+				cleanup()
+				return nil, fmt.Errorf("failed to apply change %s: %w", change.FilePath, err)
+			}
+			continue
+		}
+
 		var toolName string
 		args := map[string]interface{}{
 			"path":    change.FilePath,
@@ -218,27 +491,502 @@ func (m *MCPGitHubClient) CreateTestBranch(ctx context.Context, branchName strin
 			toolName = "delete_file"
 			// Note: SHA would be retrieved by the MCP server if needed
 		default:
+			cleanup()
 			return nil, fmt.Errorf("unsupported operation: %s", change.Operation)
 		}
 
 		_, err := m.CallTool(ctx, toolName, args)
 		if err != nil {
+			cleanup()
 			return nil, fmt.Errorf("failed to apply change %s: %w", change.FilePath, err)
 		}
 	}
 
-	// Return cleanup function
-	cleanup := func() {
-		cleanupCtx := context.Background()
-		_, cleanupErr := m.CallTool(cleanupCtx, "delete_branch", map[string]interface{}{
-			"branch": branchName,
+	return cleanup, nil
+}
+
+// renameFile moves a file on branch by creating the new path with the old content, or
+// NewContent when set, and deleting the old path
+func (m *MCPGitHubClient) renameFile(ctx context.Context, branch string, change CodeChange) error {
+	content := change.NewContent
+	if content == "" {
+		result, err := m.CallTool(ctx, "get_file_contents", map[string]interface{}{
+			"path": change.FilePath,
+			"ref":  branch,
 		})
-		if cleanupErr != nil {
-			m.logger.WithError(cleanupErr).Error("Failed to cleanup test branch")
+		if err != nil {
+			return fmt.Errorf("failed to get %s: %w", change.FilePath, err)
+		}
+		var file github.RepositoryContent
+		if err := parseToolResult(result, &file); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", change.FilePath, err)
+		}
+		if content, err = file.GetContent(); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", change.FilePath, err)
 		}
 	}
 
-	return cleanup, nil
+	if _, err := m.CallTool(ctx, "create_file", map[string]interface{}{
+		"path":    change.NewFilePath,
+		"content": content,
+		"branch":  branch,
+	}); err != nil {
+		return err
+	}
+	_, err := m.CallTool(ctx, "delete_file", map[string]interface{}{
+		"path":   change.FilePath,
+		"branch": branch,
+	})
+	return err
+}
+
+// GetBaseBranchHead returns the branch fixes are based on and its head commit SHA via MCP
+func (m *MCPGitHubClient) GetBaseBranchHead(ctx context.Context) (string, string, error) {
+	baseBranch := m.targetBranch
+	if baseBranch == "" {
+		baseBranch = "main"
+	}
+
+	sha, err := m.branchHead(ctx, baseBranch)
+	if err != nil {
+		return "", "", err
+	}
+	return baseBranch, sha, nil
+}
+
+// branchHead returns the SHA of the head commit of branch via MCP
+func (m *MCPGitHubClient) branchHead(ctx context.Context, name string) (string, error) {
+	result, err := m.CallTool(ctx, "get_branch", map[string]interface{}{
+		"branch": name,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get branch %s: %w", name, err)
+	}
+
+	var branch struct {
+		Commit struct {
+			SHA string `json:"sha"`
+		} `json:"commit"`
+	}
+	if err := parseToolResult(result, &branch); err != nil {
+		return "", fmt.Errorf("failed to parse branch result: %w", err)
+	}
+	return branch.Commit.SHA, nil
+}
+
+// CommitChanges commits changes onto branch via MCP. The MCP server commits onto the head of
+// an existing branch, so branch must exist and still be at parentSHA. Additions and
+// modifications are pushed as one commit, deletions and renames as a commit each. It returns
+// the SHA of the branch's new head.
+func (m *MCPGitHubClient) CommitChanges(ctx context.Context, branch, parentSHA string, changes []CodeChange, message string) (string, error) {
+	head, err := m.branchHead(ctx, branch)
+	if err != nil {
+		return "", err
+	}
+	if head != parentSHA {
+		return "", fmt.Errorf("branch %s is at %s rather than %s, and the MCP server can only commit onto a branch's head",
+			branch, shortSHA(head), shortSHA(parentSHA))
+	}
+
+	var files []map[string]interface{}
+	for _, change := range changes {
+		if err := validateCodeChange(change); err != nil {
+			return "", fmt.Errorf("invalid change to %s: %w", change.FilePath, err)
+		}
+		switch change.Operation {
+		case ChangeOperationAdd, ChangeOperationModify:
+			files = append(files, map[string]interface{}{"path": change.FilePath, "content": change.NewContent})
+		case ChangeOperationDelete:
+			if _, err := m.CallTool(ctx, "delete_file", map[string]interface{}{
+				"path":    change.FilePath,
+				"branch":  branch,
+				"message": message,
+			}); err != nil {
+				return "", fmt.Errorf("failed to delete %s: %w", change.FilePath, err)
+			}
+		case ChangeOperationRename:
+			if err := m.renameFile(ctx, branch, change); err != nil {
+				return "", fmt.Errorf("failed to rename %s: %w", change.FilePath, err)
+			}
+		}
+	}
+	if len(files) > 0 {
+		if _, err := m.CallTool(ctx, "push_files", map[string]interface{}{
+			"branch":  branch,
+			"files":   files,
+			"message": message,
+		}); err != nil {
+			return "", fmt.Errorf("failed to push changes to %s: %w", branch, err)
+		}
+	}
+	return m.branchHead(ctx, branch)
+}
+
+// ListOpenPullRequests lists open pull requests carrying every given label via MCP
+func (m *MCPGitHubClient) ListOpenPullRequests(ctx context.Context, labels []string) ([]*PullRequest, error) {
+	result, err := m.CallTool(ctx, "list_pull_requests", map[string]interface{}{
+		"state":   "open",
+		"perPage": 100,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pull requests: %w", err)
+	}
+
+	// The tool returns pull requests as the GitHub REST API does
+	var prs []*github.PullRequest
+	if err := parseToolResult(result, &prs); err != nil {
+		return nil, fmt.Errorf("failed to parse pull requests result: %w", err)
+	}
+
+	var results []*PullRequest
+	for _, pr := range prs {
+		if pr := convertPullRequest(pr); hasLabels(pr.Labels, labels) {
+			results = append(results, pr)
+		}
+	}
+	return results, nil
+}
+
+// AuthenticatedLogin returns the login of the account the MCP server authenticates as
+func (m *MCPGitHubClient) AuthenticatedLogin(ctx context.Context) (string, error) {
+	result, err := m.CallTool(ctx, "get_me", map[string]interface{}{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get authenticated user: %w", err)
+	}
+
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := parseToolResult(result, &user); err != nil {
+		return "", fmt.Errorf("failed to parse authenticated user result: %w", err)
+	}
+	return user.Login, nil
+}
+
+// CreateCommitComment posts a comment on a commit via MCP
+func (m *MCPGitHubClient) CreateCommitComment(ctx context.Context, sha, body string) error {
+	_, err := m.CallTool(ctx, "create_commit_comment", map[string]interface{}{
+		"sha":  sha,
+		"body": body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create commit comment: %w", err)
+	}
+	return nil
+}
+
+// GetRepositoryContext retrieves repository metadata via MCP
+func (m *MCPGitHubClient) GetRepositoryContext(ctx context.Context) (*RepositoryContext, error) {
+	result, err := m.CallTool(ctx, "get_repository", map[string]interface{}{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository: %w", err)
+	}
+
+	var repo struct {
+		Owner         string `json:"owner"`
+		Name          string `json:"name"`
+		DefaultBranch string `json:"default_branch"`
+		Language      string `json:"language"`
+	}
+	if err := parseToolResult(result, &repo); err != nil {
+		return nil, fmt.Errorf("failed to parse repository result: %w", err)
+	}
+
+	return &RepositoryContext{
+		Owner:         repo.Owner,
+		Name:          repo.Name,
+		DefaultBranch: repo.DefaultBranch,
+		Language:      repo.Language,
+		Framework:     frameworkForLanguage(repo.Language),
+	}, nil
+}
+
+// GetFileContent returns the content of a file at ref via MCP. The MCP server reports a
+// missing file as a failed tool call, so it is returned as an error rather than false.
+func (m *MCPGitHubClient) GetFileContent(ctx context.Context, path, ref string) (string, bool, error) {
+	result, err := m.CallTool(ctx, "get_file_contents", map[string]interface{}{
+		"path": path,
+		"ref":  ref,
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get %s: %w", path, err)
+	}
+	var file github.RepositoryContent
+	if err := parseToolResult(result, &file); err != nil {
+		return "", false, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	content, err := file.GetContent()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return content, true, nil
+}
+
+// ListDirectory returns the names of the entries of a directory at ref via MCP, with a
+// trailing slash for subdirectories
+func (m *MCPGitHubClient) ListDirectory(ctx context.Context, path, ref string) ([]string, error) {
+	result, err := m.CallTool(ctx, "get_file_contents", map[string]interface{}{
+		"path": path,
+		"ref":  ref,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", path, err)
+	}
+	var dir []*github.RepositoryContent
+	if err := parseToolResult(result, &dir); err != nil {
+		return nil, fmt.Errorf("failed to parse %s listing: %w", path, err)
+	}
+	return directoryEntries(dir), nil
+}
+
+// GetLanguages returns the repository's languages with the bytes of code written in each via MCP
+func (m *MCPGitHubClient) GetLanguages(ctx context.Context) (map[string]int, error) {
+	result, err := m.CallTool(ctx, "list_languages", map[string]interface{}{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository languages: %w", err)
+	}
+	var languages map[string]int
+	if err := parseToolResult(result, &languages); err != nil {
+		return nil, fmt.Errorf("failed to parse repository languages: %w", err)
+	}
+	return languages, nil
+}
+
+// UploadSARIF uploads a SARIF log to code scanning as the analysis of commitSHA on ref via MCP
+func (m *MCPGitHubClient) UploadSARIF(ctx context.Context, commitSHA, ref string, sarif []byte) (string, error) {
+	encoded, err := encodeSARIF(sarif)
+	if err != nil {
+		return "", err
+	}
+	result, err := m.CallTool(ctx, "upload_sarif", map[string]interface{}{
+		"commit_sha": commitSHA,
+		"ref":        ref,
+		"sarif":      encoded,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload SARIF: %w", err)
+	}
+	var upload struct {
+		ID string `json:"id"`
+	}
+	if err := parseToolResult(result, &upload); err != nil {
+		return "", fmt.Errorf("failed to parse SARIF upload: %w", err)
+	}
+	return upload.ID, nil
+}
+
+// CreateBranch creates branch from the head of baseBranch via MCP. The MCP server cannot
+// force-update a ref, so a branch that already exists is deleted and created again.
+func (m *MCPGitHubClient) CreateBranch(ctx context.Context, branch, baseBranch string) error {
+	args := map[string]interface{}{
+		"branch": branch,
+		"from":   baseBranch,
+	}
+	_, err := m.CallTool(ctx, "create_branch", args)
+	if err != nil && strings.Contains(err.Error(), "already exists") {
+		if err := m.DeleteBranch(ctx, branch); err != nil {
+			return err
+		}
+		_, err = m.CallTool(ctx, "create_branch", args)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create branch %s: %w", branch, err)
+	}
+	return nil
+}
+
+// DeleteBranch deletes a branch via MCP
+func (m *MCPGitHubClient) DeleteBranch(ctx context.Context, branch string) error {
+	if _, err := m.CallTool(ctx, "delete_branch", map[string]interface{}{
+		"branch": branch,
+	}); err != nil {
+		return fmt.Errorf("failed to delete branch %s: %w", branch, err)
+	}
+	return nil
+}
+
+// CreatePullRequest opens a pull request via MCP, then sets its labels, assignees and
+// reviewers. Like GitHubIntegration it only logs failing to set those.
+func (m *MCPGitHubClient) CreatePullRequest(ctx context.Context, opts *PRCreationOptions) (*PullRequest, error) {
+	result, err := m.CallTool(ctx, "create_pull_request", map[string]interface{}{
+		"title": opts.Title,
+		"body":  opts.Body,
+		"head":  opts.BranchName,
+		"base":  opts.TargetBranch,
+		"draft": opts.Draft,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PR: %w", err)
+	}
+	var created github.PullRequest
+	if err := parseToolResult(result, &created); err != nil {
+		return nil, fmt.Errorf("failed to parse pull request result: %w", err)
+	}
+	number := created.GetNumber()
+
+	if len(opts.Labels) > 0 || len(opts.Assignees) > 0 {
+		args := map[string]interface{}{"issue_number": number}
+		if len(opts.Labels) > 0 {
+			args["labels"] = opts.Labels
+		}
+		if len(opts.Assignees) > 0 {
+			args["assignees"] = opts.Assignees
+		}
+		if _, err := m.CallTool(ctx, "update_issue", args); err != nil {
+			m.logger.WithError(err).Warn("Failed to add labels and assignees to PR")
+		}
+	}
+	if reviewers := append(append([]string{}, opts.Reviewers...), opts.TeamReviewers...); len(reviewers) > 0 {
+		if _, err := m.CallTool(ctx, "update_pull_request", map[string]interface{}{
+			"pullNumber": number,
+			"reviewers":  reviewers,
+		}); err != nil {
+			m.logger.WithError(err).Warn("Failed to request reviewers")
+		}
+	}
+
+	pr := convertPullRequest(&created)
+	pr.Branch = opts.BranchName
+	pr.Labels = opts.Labels
+	return pr, nil
+}
+
+// GetPullRequest returns a pull request by number via MCP
+func (m *MCPGitHubClient) GetPullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	result, err := m.CallTool(ctx, "get_pull_request", map[string]interface{}{
+		"pullNumber": number,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get PR #%d: %w", number, err)
+	}
+	var pr github.PullRequest
+	if err := parseToolResult(result, &pr); err != nil {
+		return nil, fmt.Errorf("failed to parse pull request result: %w", err)
+	}
+	return convertPullRequest(&pr), nil
+}
+
+// UpdatePullRequest applies update to a pull request via MCP
+func (m *MCPGitHubClient) UpdatePullRequest(ctx context.Context, number int, update PullRequestUpdate) (*PullRequest, error) {
+	args := map[string]interface{}{"pullNumber": number}
+	if update.Title != "" {
+		args["title"] = update.Title
+	}
+	if update.Body != "" {
+		args["body"] = update.Body
+	}
+	if update.State != "" {
+		args["state"] = update.State
+	}
+	result, err := m.CallTool(ctx, "update_pull_request", args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update PR #%d: %w", number, err)
+	}
+	var edited github.PullRequest
+	if err := parseToolResult(result, &edited); err != nil {
+		return nil, fmt.Errorf("failed to parse pull request result: %w", err)
+	}
+	pr := convertPullRequest(&edited)
+
+	if update.Labels != nil {
+		if _, err := m.CallTool(ctx, "update_issue", map[string]interface{}{
+			"issue_number": number,
+			"labels":       update.Labels,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to update labels of PR #%d: %w", number, err)
+		}
+		pr.Labels = update.Labels
+	}
+	return pr, nil
+}
+
+// ClosePullRequest closes a pull request without merging it via MCP
+func (m *MCPGitHubClient) ClosePullRequest(ctx context.Context, number int) error {
+	_, err := m.UpdatePullRequest(ctx, number, PullRequestUpdate{State: "closed"})
+	return err
+}
+
+// AddPullRequestComment posts a comment on a pull request's conversation via MCP
+func (m *MCPGitHubClient) AddPullRequestComment(ctx context.Context, number int, body string) error {
+	if _, err := m.CallTool(ctx, "add_issue_comment", map[string]interface{}{
+		"issue_number": number,
+		"body":         body,
+	}); err != nil {
+		return fmt.Errorf("failed to comment on PR #%d: %w", number, err)
+	}
+	return nil
+}
+
+// FindPullRequestForCommit returns the open pull request whose head is sha via MCP, and nil
+// when there is none. Unlike GitHubIntegration it does not find pull requests sha is only
+// part of.
+func (m *MCPGitHubClient) FindPullRequestForCommit(ctx context.Context, sha string) (*PullRequest, error) {
+	result, err := m.CallTool(ctx, "list_pull_requests", map[string]interface{}{
+		"state":   "open",
+		"perPage": 100,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the pull request of commit %s: %w", sha, err)
+	}
+	var prs []*github.PullRequest
+	if err := parseToolResult(result, &prs); err != nil {
+		return nil, fmt.Errorf("failed to parse pull requests result: %w", err)
+	}
+	for _, pr := range prs {
+		if pr.GetHead().GetSHA() == sha {
+			return convertPullRequest(pr), nil
+		}
+	}
+	return nil, nil
+}
+
+// ListPullRequestFiles returns the files a pull request changes with their patches via MCP
+func (m *MCPGitHubClient) ListPullRequestFiles(ctx context.Context, number int) ([]FileChange, error) {
+	result, err := m.CallTool(ctx, "get_pull_request_files", map[string]interface{}{
+		"pullNumber": number,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the files of PR #%d: %w", number, err)
+	}
+	var files []*github.CommitFile
+	if err := parseToolResult(result, &files); err != nil {
+		return nil, fmt.Errorf("failed to parse pull request files result: %w", err)
+	}
+	changes := make([]FileChange, 0, len(files))
+	for _, file := range files {
+		changes = append(changes, FileChange{
+			Filename:  file.GetFilename(),
+			Status:    file.GetStatus(),
+			Patch:     file.GetPatch(),
+			Additions: file.GetAdditions(),
+			Deletions: file.GetDeletions(),
+		})
+	}
+	return changes, nil
+}
+
+// CreateReviewComment comments on lines of a file a pull request changes via MCP, as a
+// review holding the single comment
+func (m *MCPGitHubClient) CreateReviewComment(ctx context.Context, number int, comment ReviewComment) error {
+	reviewComment := map[string]interface{}{
+		"path": comment.Path,
+		"line": comment.Line,
+		"side": "RIGHT",
+		"body": comment.Body,
+	}
+	if comment.StartLine > 0 && comment.StartLine < comment.Line {
+		reviewComment["start_line"] = comment.StartLine
+		reviewComment["start_side"] = "RIGHT"
+	}
+	if _, err := m.CallTool(ctx, "create_pull_request_review", map[string]interface{}{
+		"pullNumber": number,
+		"commitId":   comment.CommitSHA,
+		"event":      "COMMENT",
+		"comments":   []interface{}{reviewComment},
+	}); err != nil {
+		return fmt.Errorf("failed to create review comment on PR #%d: %w", number, err)
+	}
+	return nil
 }
 
 // parseToolResult parses MCP tool result into target struct
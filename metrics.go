@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsShutdownTimeout bounds how long the metrics server waits for open scrapes on shutdown
+const metricsShutdownTimeout = 5 * time.Second
+
+// durationBuckets are the histogram buckets, in seconds, for analysis, test and fix durations
+var durationBuckets = []float64{0.5, 1, 5, 10, 30, 60, 120, 300, 600, 1800}
+
+// metricsCollector records the agent's Prometheus metrics. Label values are limited to
+// failure types, repository names, providers and outcomes so no repository content or
+// tokens are exposed.
+type metricsCollector struct {
+	failuresDetected   *counterVec
+	failuresClustered  *counterVec
+	failuresSkipped    *counterVec
+	failuresDuplicate  *counterVec
+	fixesAttempted     *counterVec
+	fixesSucceeded     *counterVec
+	fixesFailed        *counterVec
+	flakyRetries       *counterVec
+	fixVerifications   *counterVec
+	llmRequests        *counterVec
+	llmCacheHits       *counterVec
+	llmTokens          *counterVec
+	llmCost            *counterVec
+	githubCalls        *counterVec
+	redactions         *counterVec
+	githubRate         *gauge
+	analysisDuration   *histogram
+	testDuration       *histogram
+	validationDuration *histogram
+	fixDuration        *histogram
+	families           []metricFamily
+}
+
+// agentMetrics is the collector the agent's components record to
+var agentMetrics = newMetricsCollector()
+
+func newMetricsCollector() *metricsCollector {
+	c := &metricsCollector{
+		failuresDetected:   newCounterVec("github_autofix_failures_detected_total", "Failed workflow runs detected by the monitor, by repository.", "repository"),
+		failuresClustered:  newCounterVec("github_autofix_failures_clustered_total", "Failed workflow runs left to the fix of a newer run with the same failure, by repository.", "repository"),
+		failuresSkipped:    newCounterVec("github_autofix_failures_skipped_total", "Failed workflow runs not submitted because the fix queue was full, by repository; they are retried on the next poll.", "repository"),
+		failuresDuplicate:  newCounterVec("github_autofix_failures_duplicate_total", "Failed workflow runs not submitted because another entry point, polling or event dispatch, already claimed them, by repository.", "repository"),
+		fixesAttempted:     newCounterVec("github_autofix_fixes_attempted_total", "Auto-fix runs started, by repository and failure type.", "repository", "failure_type"),
+		fixesSucceeded:     newCounterVec("github_autofix_fixes_succeeded_total", "Auto-fix runs that produced a valid fix, by repository and failure type.", "repository", "failure_type"),
+		fixesFailed:        newCounterVec("github_autofix_fixes_failed_total", "Auto-fix runs that failed or produced no valid fix, by repository and failure type.", "repository", "failure_type"),
+		flakyRetries:       newCounterVec("github_autofix_flaky_retries_total", "Re-runs of failures that looked flaky, by outcome (resolved, still_failing, error).", "outcome"),
+		fixVerifications:   newCounterVec("github_autofix_fix_verifications_total", "Merged fix PRs verified by their workflow at the merge commit, by failure type and outcome (verified, unverified).", "failure_type", "outcome"),
+		llmRequests:        newCounterVec("github_autofix_llm_requests_total", "LLM requests, by provider and outcome.", "provider", "outcome"),
+		llmCacheHits:       newCounterVec("github_autofix_llm_cache_hits_total", "LLM requests answered from the response cache, by provider.", "provider"),
+		llmTokens:          newCounterVec("github_autofix_llm_tokens_total", "LLM tokens used, by provider and type (prompt, completion).", "provider", "type"),
+		llmCost:            newCounterVec("github_autofix_llm_estimated_cost_usd_total", "Estimated LLM cost in US dollars, by provider.", "provider"),
+		githubCalls:        newCounterVec("github_autofix_github_api_calls_total", "GitHub API calls, by outcome.", "outcome"),
+		redactions:         newCounterVec("github_autofix_redactions_total", "Secrets masked in logs, prompts and test output, by type.", "type"),
+		githubRate:         newGauge("github_autofix_github_rate_limit_remaining", "Remaining GitHub API requests in the current rate limit window."),
+		analysisDuration:   newHistogram("github_autofix_analysis_duration_seconds", "Time to analyze a workflow failure.", durationBuckets),
+		testDuration:       newHistogram("github_autofix_test_duration_seconds", "Time to run the tests validating a fix.", durationBuckets),
+		validationDuration: newHistogram("github_autofix_validation_duration_seconds", "Time to validate each proposed fix, including its test branch and coverage checks.", durationBuckets),
+		fixDuration:        newHistogram("github_autofix_fix_duration_seconds", "End-to-end auto-fix duration.", durationBuckets),
+	}
+	c.families = []metricFamily{
+		c.failuresDetected, c.failuresClustered, c.failuresSkipped, c.failuresDuplicate, c.fixesAttempted, c.fixesSucceeded, c.fixesFailed, c.flakyRetries, c.fixVerifications,
+		c.llmRequests, c.llmCacheHits, c.llmTokens, c.llmCost, c.githubCalls, c.redactions, c.githubRate,
+		c.analysisDuration, c.testDuration, c.validationDuration, c.fixDuration,
+	}
+	return c
+}
+
+// metricsFailureType returns the label value for an analysis, "unknown" when analysis did not finish
+func metricsFailureType(analysis *FailureAnalysisResult) string {
+	if analysis == nil || analysis.Classification.Type == "" {
+		return "unknown"
+	}
+	return string(analysis.Classification.Type)
+}
+
+// metricsRepository returns the label value for an agent's repository, "unknown" when unset
+func metricsRepository(m *DaggerAutofix) string {
+	if m.RepoOwner == "" || m.RepoName == "" {
+		return "unknown"
+	}
+	return m.repositoryName()
+}
+
+// recordFix records the outcome of an AutoFix run
+func (c *metricsCollector) recordFix(repository, failureType string, succeeded bool, duration time.Duration) {
+	c.fixesAttempted.inc(repository, failureType)
+	if succeeded {
+		c.fixesSucceeded.inc(repository, failureType)
+	} else {
+		c.fixesFailed.inc(repository, failureType)
+	}
+	c.fixDuration.observe(duration.Seconds())
+}
+
+// recordFlakyRetry records the outcome of re-running a failure that looked flaky
+func (c *metricsCollector) recordFlakyRetry(outcome string) {
+	c.flakyRetries.inc(outcome)
+}
+
+// recordFixVerification records whether a merged fix's workflow succeeded afterwards
+func (c *metricsCollector) recordFixVerification(failureType, outcome string) {
+	c.fixVerifications.inc(failureType, outcome)
+}
+
+// recordLLMRequest records an LLM request outcome
+func (c *metricsCollector) recordLLMRequest(provider LLMProvider, err error) {
+	c.llmRequests.inc(string(provider), metricsOutcome(err))
+}
+
+// recordLLMUsage records the tokens and estimated cost of an LLM request
+func (c *metricsCollector) recordLLMUsage(provider LLMProvider, usage LLMUsageSummary) {
+	c.llmTokens.add(float64(usage.PromptTokens), string(provider), "prompt")
+	c.llmTokens.add(float64(usage.CompletionTokens), string(provider), "completion")
+	c.llmCost.add(usage.EstimatedCostUSD, string(provider))
+}
+
+// recordGitHubCall records a GitHub API call outcome
+func (c *metricsCollector) recordGitHubCall(err error) {
+	outcome := metricsOutcome(err)
+	if _, limited := rateLimitWait(err, 0); limited {
+		outcome = "rate_limited"
+	}
+	c.githubCalls.inc(outcome)
+}
+
+func metricsOutcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// writeTo writes every metric in the Prometheus text exposition format
+func (c *metricsCollector) writeTo(w io.Writer) {
+	for _, family := range c.families {
+		family.write(w)
+	}
+}
+
+// ServeHTTP serves the metrics for Prometheus scrapes
+func (c *metricsCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.writeTo(w)
+}
+
+// serveMetrics serves /metrics and, when health is set, /healthz on addr until ctx is done
+func serveMetrics(ctx context.Context, addr string, collector *metricsCollector, health func() *HealthStatus) (net.Addr, <-chan error, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen on metrics address %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", collector)
+	if health != nil {
+		mux.Handle("/healthz", healthHandler(health))
+	}
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	done := make(chan error, 1)
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			done <- err
+		}
+		close(done)
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	return listener.Addr(), done, nil
+}
+
+// healthHandler writes the health status as JSON, with 503 Service Unavailable while the
+// monitor is failing so probes can restart it
+func healthHandler(health func() *HealthStatus) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := health()
+		w.Header().Set("Content-Type", "application/json")
+		if status.Status == HealthFailing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+}
+
+// metricFamily is a metric written in the Prometheus text format
+type metricFamily interface {
+	write(w io.Writer)
+}
+
+// counterVec is a counter with a fixed set of labels
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64 // keyed by the formatted label set
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+}
+
+func (c *counterVec) inc(labelValues ...string) {
+	c.add(1, labelValues...)
+}
+
+func (c *counterVec) add(delta float64, labelValues ...string) {
+	key := formatLabels(c.labels, labelValues)
+	c.mu.Lock()
+	c.values[key] += delta
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if len(c.labels) == 0 {
+		fmt.Fprintf(w, "%s %s\n", c.name, formatValue(c.values[""]))
+		return
+	}
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, key, formatValue(c.values[key]))
+	}
+}
+
+// gauge is a value that is only written once it has been set
+type gauge struct {
+	name, help string
+
+	mu    sync.Mutex
+	value float64
+	set   bool
+}
+
+func newGauge(name, help string) *gauge {
+	return &gauge{name: name, help: help}
+}
+
+func (g *gauge) setValue(value float64) {
+	g.mu.Lock()
+	g.value, g.set = value, true
+	g.mu.Unlock()
+}
+
+func (g *gauge) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	if g.set {
+		fmt.Fprintf(w, "%s %s\n", g.name, formatValue(g.value))
+	}
+}
+
+// histogram counts observations into cumulative buckets
+type histogram struct {
+	name, help string
+	buckets    []float64
+
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(name, help string, buckets []float64) *histogram {
+	return &histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	var cumulative uint64
+	for i, bound := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatValue(bound), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatValue(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+// labelValueEscaper escapes label values as the Prometheus text format requires, which
+// unlike Go quoting leaves every other character as is
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels formats a label set as {name="value",...}
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = name + `="` + labelValueEscaper.Replace(value) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
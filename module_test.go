@@ -23,8 +23,8 @@ func TestModuleBasics(t *testing.T) {
 			t.Errorf("Expected default LLM provider to be 'openai', got '%s'", module.LLMProvider)
 		}
 
-		if module.TargetBranch != "main" {
-			t.Errorf("Expected default target branch to be 'main', got '%s'", module.TargetBranch)
+		if module.TargetBranch != "" {
+			t.Errorf("Expected no default target branch, got '%s'", module.TargetBranch)
 		}
 
 		if module.MinCoverage != 85 {
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// HealthState summarizes whether the monitor can poll GitHub
+type HealthState string
+
+const (
+	HealthHealthy  HealthState = "healthy"  // the last poll succeeded
+	HealthDegraded HealthState = "degraded" // recent polls failed and the monitor is backing off
+	HealthFailing  HealthState = "failing"  // monitorAlertFailures or more polls failed in a row
+)
+
+const (
+	// monitorPollInterval is how often the monitor checks for failed workflow runs
+	monitorPollInterval = 30 * time.Second
+	// maxMonitorPollInterval caps the polling interval while GitHub keeps failing
+	maxMonitorPollInterval = 15 * time.Minute
+	// monitorAlertFailures is the number of consecutive failed polls that sends a warning
+	// notification and marks the monitor as failing
+	monitorAlertFailures = 5
+)
+
+// pollJitter returns the random delay added to a backed off polling interval, up to a fifth
+// of it, so agents sharing a token do not retry in lockstep
+var pollJitter = func(interval time.Duration) time.Duration {
+	return time.Duration(rand.Int63n(int64(interval)/5 + 1))
+}
+
+// HealthStatus is the monitor's view of its GitHub polling
+type HealthStatus struct {
+	Status              HealthState   `json:"status"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	LastError           string        `json:"last_error,omitempty"`
+	LastErrorAt         time.Time     `json:"last_error_at,omitempty"`
+	LastSuccessAt       time.Time     `json:"last_success_at,omitempty"`
+	PollInterval        time.Duration `json:"poll_interval"` // the wait before the next poll
+}
+
+// monitorHealth tracks consecutive polling failures and the backed off polling interval
+type monitorHealth struct {
+	mu            sync.Mutex
+	failures      int
+	lastError     error
+	lastErrorAt   time.Time
+	lastSuccessAt time.Time
+	interval      time.Duration
+}
+
+// recordFailure records a failed poll and returns the interval to wait before the next one
+func (h *monitorHealth) recordFailure(err error) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures++
+	h.lastError = err
+	h.lastErrorAt = time.Now()
+	h.interval = pollBackoff(monitorPollInterval, h.failures)
+	return h.interval
+}
+
+// recordSuccess records a successful poll and returns the configured polling interval
+func (h *monitorHealth) recordSuccess() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures = 0
+	h.lastSuccessAt = time.Now()
+	h.interval = monitorPollInterval
+	return h.interval
+}
+
+// status returns a snapshot of the monitor's health
+func (h *monitorHealth) status() *HealthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status := &HealthStatus{
+		Status:              HealthHealthy,
+		ConsecutiveFailures: h.failures,
+		LastErrorAt:         h.lastErrorAt,
+		LastSuccessAt:       h.lastSuccessAt,
+		PollInterval:        h.interval,
+	}
+	if status.PollInterval == 0 {
+		status.PollInterval = monitorPollInterval
+	}
+	if h.lastError != nil {
+		status.LastError = h.lastError.Error()
+	}
+	switch {
+	case h.failures >= monitorAlertFailures:
+		status.Status = HealthFailing
+	case h.failures > 0:
+		status.Status = HealthDegraded
+	}
+	return status
+}
+
+// pollBackoff returns base doubled for each consecutive failure plus jitter, capped at
+// maxMonitorPollInterval
+func pollBackoff(base time.Duration, failures int) time.Duration {
+	interval := base
+	for i := 0; i < failures && interval < maxMonitorPollInterval; i++ {
+		interval *= 2
+	}
+	interval += pollJitter(interval)
+	if interval > maxMonitorPollInterval {
+		interval = maxMonitorPollInterval
+	}
+	return interval
+}
+
+// Health returns whether the monitor can poll GitHub, with its last error and consecutive
+// failure count. It does not call GitHub.
+func (m *DaggerAutofix) Health(ctx context.Context) (*HealthStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return m.health.status(), nil
+}
+
+// pollFailed records a failed check for failures and returns the backed off polling interval.
+// Reaching monitorAlertFailures consecutive failures sends a warning notification once.
+func (m *DaggerAutofix) pollFailed(ctx context.Context, err error) time.Duration {
+	interval := m.health.recordFailure(err)
+	failures := m.health.status().ConsecutiveFailures
+	m.logger.WithError(err).WithField("consecutive_failures", failures).
+		Errorf("Failed to check for workflow failures, polling again in %v", interval.Round(time.Second))
+
+	if failures == monitorAlertFailures {
+		m.notify(ctx, &Notification{
+			Event:  MonitorFailing,
+			Reason: fmt.Sprintf("%d consecutive checks for workflow failures failed: %v", failures, err),
+		})
+	}
+	return interval
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noPollJitter makes backed off polling intervals deterministic for the test
+func noPollJitter(t *testing.T) {
+	old := pollJitter
+	pollJitter = func(time.Duration) time.Duration { return 0 }
+	t.Cleanup(func() { pollJitter = old })
+}
+
+// TestMonitorPollBackoff tests that consecutive polling failures double the interval up to its
+// cap, warn once when the monitor starts failing and that a success resets the interval
+func TestMonitorPollBackoff(t *testing.T) {
+	noPollJitter(t)
+	ctx := context.Background()
+	server := newWebhookServer(t, 0)
+	notifier, err := NewNotifier(server.URL, NotificationFormatWebhook)
+	require.NoError(t, err)
+	m := &DaggerAutofix{RepoOwner: "acme", RepoName: "widgets", logger: quietLogger(), notifier: notifier}
+
+	health, err := m.Health(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &HealthStatus{Status: HealthHealthy, PollInterval: monitorPollInterval}, health)
+
+	pollErr := errors.New("401 Bad credentials")
+	var intervals []time.Duration
+	var states []HealthState
+	for i := 0; i < 5; i++ {
+		intervals = append(intervals, m.pollFailed(ctx, pollErr))
+		health, err := m.Health(ctx)
+		require.NoError(t, err)
+		states = append(states, health.Status)
+	}
+	assert.Equal(t, []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, maxMonitorPollInterval}, intervals)
+	assert.Equal(t, []HealthState{HealthDegraded, HealthDegraded, HealthDegraded, HealthDegraded, HealthFailing}, states)
+	assert.Equal(t, maxMonitorPollInterval, m.pollFailed(ctx, pollErr), "the interval stays capped")
+
+	health, err = m.Health(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 6, health.ConsecutiveFailures)
+	assert.Equal(t, "401 Bad credentials", health.LastError)
+	assert.False(t, health.LastErrorAt.IsZero())
+
+	received := server.received()
+	require.Len(t, received, 1, "only reaching the alert threshold notifies")
+	assert.Equal(t, "monitor_failing", received[0]["event"])
+	assert.Equal(t, "acme/widgets", received[0]["repository"])
+	assert.Contains(t, received[0]["reason"], "5 consecutive checks for workflow failures failed: 401 Bad credentials")
+
+	assert.Equal(t, monitorPollInterval, m.health.recordSuccess())
+	health, err = m.Health(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, HealthHealthy, health.Status)
+	assert.Zero(t, health.ConsecutiveFailures)
+	assert.Equal(t, monitorPollInterval, health.PollInterval)
+	assert.Equal(t, time.Minute, m.pollFailed(ctx, pollErr), "backoff starts over after a success")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = m.Health(cancelled)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// TestPollBackoffJitter tests that jitter stays within a fifth of the interval and the cap
+func TestPollBackoffJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		interval := pollBackoff(monitorPollInterval, 2)
+		assert.GreaterOrEqual(t, interval, 2*time.Minute)
+		assert.LessOrEqual(t, interval, 2*time.Minute+24*time.Second)
+		assert.Equal(t, maxMonitorPollInterval, pollBackoff(monitorPollInterval, 10))
+	}
+}
+
+// TestHealthHandler tests that /healthz reports the health as JSON and fails while failing
+func TestHealthHandler(t *testing.T) {
+	noPollJitter(t)
+	var health monitorHealth
+	handler := healthHandler(health.status)
+
+	get := func() (*httptest.ResponseRecorder, *HealthStatus) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		var status HealthStatus
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &status))
+		return recorder, &status
+	}
+
+	recorder, status := get()
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, HealthHealthy, status.Status)
+
+	health.recordFailure(errors.New("connection refused"))
+	recorder, status = get()
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, HealthDegraded, status.Status)
+
+	for i := 1; i < monitorAlertFailures; i++ {
+		health.recordFailure(errors.New("connection refused"))
+	}
+	recorder, status = get()
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, HealthFailing, status.Status)
+	assert.Equal(t, monitorAlertFailures, status.ConsecutiveFailures)
+	assert.Equal(t, "connection refused", status.LastError)
+}
+
+// TestGetMetricsHealth tests that the metrics include the monitor's health
+func TestGetMetricsHealth(t *testing.T) {
+	noPollJitter(t)
+	m := New()
+	m.githubClient = &mockGitHub{}
+	m.health.recordFailure(errors.New("connection refused"))
+
+	metrics, err := m.GetMetrics(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, metrics.Health)
+	assert.Equal(t, HealthDegraded, metrics.Health.Status)
+	assert.Equal(t, time.Minute, metrics.Health.PollInterval)
+}
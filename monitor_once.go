@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MonitorPass reports a single pass over the monitored repositories
+type MonitorPass struct {
+	FailuresDetected int           `json:"failures_detected"` // failed runs submitted for fixing
+	FixesCompleted   int           `json:"fixes_completed"`
+	FixesFailed      int           `json:"fixes_failed"`
+	Duration         time.Duration `json:"duration"`
+}
+
+// FixesAttempted reports whether the pass found failed runs to fix
+func (p *MonitorPass) FixesAttempted() bool {
+	return p.FailuresDetected > 0
+}
+
+// MonitorOnce checks the monitored repositories for failed runs once, as MonitorWorkflows
+// does on each poll, and returns once their fixes finished, e.g. for cron jobs. Cancelling
+// ctx drains the fixes as stopping MonitorWorkflows does. The pass is returned even when
+// some repositories could not be checked.
+func (m *DaggerAutofix) MonitorOnce(ctx context.Context) (*MonitorPass, error) {
+	if m.githubClient == nil {
+		return nil, ErrNotInitialized
+	}
+
+	start := time.Now()
+	detected, completed, failed := m.stats.failuresDetected.Load(), m.stats.completedFixes.Load(), m.stats.failedFixes.Load()
+	m.reconcileTestBranches(ctx)
+
+	err := m.checkForFailures(ctx)
+	m.finishFixes(ctx)
+	if ctx.Err() != nil {
+		m.cleanupTestBranches()
+		err = ctx.Err()
+	}
+
+	pass := &MonitorPass{
+		FailuresDetected: int(m.stats.failuresDetected.Load() - detected),
+		FixesCompleted:   int(m.stats.completedFixes.Load() - completed),
+		FixesFailed:      int(m.stats.failedFixes.Load() - failed),
+		Duration:         time.Since(start),
+	}
+	m.logger.WithFields(logrus.Fields{
+		"failures_detected": pass.FailuresDetected,
+		"fixes_completed":   pass.FixesCompleted,
+		"fixes_failed":      pass.FixesFailed,
+	}).Info("Monitoring pass finished")
+	return pass, err
+}
+
+// finishFixes waits for the submitted auto-fixes to finish, draining them as drainFixes does
+// once ctx is cancelled
+func (m *DaggerAutofix) finishFixes(ctx context.Context) {
+	m.poolMu.Lock()
+	pool := m.fixPool
+	m.fixPool = nil
+	m.poolMu.Unlock()
+
+	if pool == nil {
+		return
+	}
+	if err := pool.Wait(ctx, m.drainTimeout()); err != nil {
+		m.logger.WithError(err).Warn("Cancelled in-flight auto-fixes")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// onceAutofix returns an agent whose monitored repository lists runIDs as failed, fixing them
+// one at a time
+func onceAutofix(prFixes *[]*FixValidationResult, runIDs ...int64) *DaggerAutofix {
+	m := fixtureAutofix(prFixes)
+	m.MaxConcurrentFixes = 1
+	m.githubClient.(*mockGitHub).getFailedWorkflowRunsFunc = func(ctx context.Context) ([]*WorkflowRun, error) {
+		var runs []*WorkflowRun
+		for _, id := range runIDs {
+			runs = append(runs, &WorkflowRun{ID: id})
+		}
+		return runs, nil
+	}
+	return m
+}
+
+// TestMonitorOnce tests that a single pass fixes the failed runs before returning
+func TestMonitorOnce(t *testing.T) {
+	var prFixes []*FixValidationResult
+	m := onceAutofix(&prFixes, 1, 2)
+
+	pass, err := m.MonitorOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, pass.FailuresDetected)
+	assert.Equal(t, 2, pass.FixesCompleted)
+	assert.Zero(t, pass.FixesFailed)
+	assert.True(t, pass.FixesAttempted())
+	assert.Len(t, prFixes, 2, "the fixes finished before the pass returned")
+
+	// A second pass only counts the runs it submitted itself
+	pass, err = m.MonitorOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, MonitorPass{Duration: pass.Duration}, *pass)
+	assert.False(t, pass.FixesAttempted())
+
+	_, err = (&DaggerAutofix{}).MonitorOnce(context.Background())
+	assert.ErrorIs(t, err, ErrNotInitialized)
+}
+
+// TestMonitorOnceExitCodes tests the exit codes of monitor --once
+func TestMonitorOnceExitCodes(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("FixesSucceeded", func(t *testing.T) {
+		cli, out := outputCLI(t, OutputText)
+		var prFixes []*FixValidationResult
+		err := cli.monitorOnce(ctx, onceAutofix(&prFixes, 1))
+		assert.Equal(t, 0, exitCode(err))
+		assert.Contains(t, out.String(), "Failures Detected: 1\nFixes Completed: 1\nFixes Failed: 0\n")
+	})
+
+	t.Run("FixFailed", func(t *testing.T) {
+		cli, out := outputCLI(t, OutputJSON)
+		var prFixes []*FixValidationResult
+		m := onceAutofix(&prFixes, 1, 2)
+		m.failureEngine.(*mockFailureAnalysisEngine).analyzeFunc = func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+			if fc.WorkflowRun.ID == 2 {
+				return nil, errors.New("analysis failed")
+			}
+			return &FailureAnalysisResult{ID: "a1", Classification: FailureClassification{Type: TestFailure}, Context: fc}, nil
+		}
+		err := cli.monitorOnce(ctx, m)
+		assert.Equal(t, exitChecksFailed, exitCode(err))
+		assert.ErrorContains(t, err, "1 of 2 fixes failed")
+		assert.Contains(t, out.String(), `"fixes_failed": 1`)
+	})
+
+	t.Run("NothingToFix", func(t *testing.T) {
+		cli, _ := outputCLI(t, OutputText)
+		var prFixes []*FixValidationResult
+		err := cli.monitorOnce(ctx, onceAutofix(&prFixes))
+		assert.Equal(t, exitNothingToFix, exitCode(err))
+	})
+
+	t.Run("GitHubFails", func(t *testing.T) {
+		cli, out := outputCLI(t, OutputText)
+		var prFixes []*FixValidationResult
+		m := onceAutofix(&prFixes)
+		m.githubClient.(*mockGitHub).getFailedWorkflowRunsFunc = func(ctx context.Context) ([]*WorkflowRun, error) {
+			return nil, errors.New("connection reset")
+		}
+		err := cli.monitorOnce(ctx, m)
+		assert.Equal(t, exitError, exitCode(err))
+		assert.ErrorContains(t, err, "connection reset")
+		assert.Contains(t, out.String(), "Failures Detected: 0")
+	})
+}
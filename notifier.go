@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// NotificationEvent is a fix lifecycle event sent to the notification webhook
+type NotificationEvent string
+
+const (
+	FailureDetected     NotificationEvent = "failure_detected"
+	AnalysisCompleted   NotificationEvent = "analysis_completed"
+	FixPROpened         NotificationEvent = "fix_pr_opened"
+	FixValidationFailed NotificationEvent = "fix_validation_failed"
+	AutoFixAborted      NotificationEvent = "autofix_aborted"
+	MonitorFailing      NotificationEvent = "monitor_failing"
+)
+
+// Notification webhook payload formats
+const (
+	NotificationFormatWebhook = "webhook"
+	NotificationFormatSlack   = "slack"
+)
+
+func validateNotificationFormat(format string) error {
+	switch format {
+	case "", NotificationFormatWebhook, NotificationFormatSlack:
+		return nil
+	default:
+		return fmt.Errorf("invalid notification format %q, expected webhook or slack", format)
+	}
+}
+
+const (
+	// notificationTimeout bounds a single webhook request
+	notificationTimeout = 10 * time.Second
+	// notificationRetries is how many times a failed webhook request is retried
+	notificationRetries = 1
+)
+
+// notificationRetryDelay is the wait before retrying a failed webhook request
+var notificationRetryDelay = 2 * time.Second
+
+// Notification describes a fix lifecycle event. It carries identifiers and classifications
+// only, never logs or code.
+type Notification struct {
+	Event       NotificationEvent `json:"event"`
+	Repository  string            `json:"repository"`
+	RunID       int64             `json:"run_id"`
+	Workflow    string            `json:"workflow,omitempty"`
+	Branch      string            `json:"branch,omitempty"`
+	RunURL      string            `json:"run_url,omitempty"`
+	FailureType FailureType       `json:"failure_type,omitempty"`
+	Confidence  float64           `json:"confidence,omitempty"`
+	PRNumber    int               `json:"pr_number,omitempty"`
+	PRURL       string            `json:"pr_url,omitempty"`
+	Reason      string            `json:"reason,omitempty"`
+	Timestamp   time.Time         `json:"timestamp"`
+}
+
+// Notifier delivers fix lifecycle notifications
+type Notifier interface {
+	Notify(ctx context.Context, notification *Notification) error
+}
+
+// NewNotifier creates a notifier posting to webhookURL. An empty format selects slack for
+// Slack incoming webhooks and the generic JSON webhook otherwise.
+func NewNotifier(webhookURL, format string) (Notifier, error) {
+	if err := validateNotificationFormat(format); err != nil {
+		return nil, err
+	}
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		// The URL is a secret, so it is not included in the error
+		return nil, fmt.Errorf("notification webhook must be an absolute http(s) URL")
+	}
+
+	client := &http.Client{Timeout: notificationTimeout}
+	if format == NotificationFormatSlack || (format == "" && parsed.Host == "hooks.slack.com") {
+		return &SlackNotifier{url: webhookURL, client: client}, nil
+	}
+	return &WebhookNotifier{url: webhookURL, client: client}, nil
+}
+
+// WebhookNotifier posts each notification as JSON
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// Notify posts the notification
+func (n *WebhookNotifier) Notify(ctx context.Context, notification *Notification) error {
+	return postNotification(ctx, n.client, n.url, notification)
+}
+
+// SlackNotifier posts notifications to a Slack incoming webhook as Block Kit messages
+type SlackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// Notify posts the notification as a Slack message
+func (n *SlackNotifier) Notify(ctx context.Context, notification *Notification) error {
+	return postNotification(ctx, n.client, n.url, formatSlackMessage(notification))
+}
+
+// slackMessage is a Slack incoming webhook payload
+type slackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Fields   []slackText `json:"fields,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+var notificationTitles = map[NotificationEvent]string{
+	FailureDetected:     ":rotating_light: Workflow failure detected",
+	AnalysisCompleted:   ":mag: Failure analysis completed",
+	FixPROpened:         ":white_check_mark: Fix pull request opened",
+	FixValidationFailed: ":x: No proposed fix passed validation",
+	AutoFixAborted:      ":warning: Auto-fix gave up",
+	MonitorFailing:      ":warning: Monitoring workflow runs keeps failing",
+}
+
+// formatSlackMessage renders a notification as a compact Block Kit message
+func formatSlackMessage(n *Notification) *slackMessage {
+	title, ok := notificationTitles[n.Event]
+	if !ok {
+		title = string(n.Event)
+	}
+	summary := fmt.Sprintf("%s in *%s*", title, slackEscape(n.Repository))
+
+	var fields []slackText
+	if n.RunID != 0 || n.Workflow != "" {
+		fields = append(fields, mrkdwn("*Workflow*\n"+slackLink(n.RunURL, orDefault(n.Workflow, fmt.Sprintf("run %d", n.RunID)))))
+	}
+	if n.FailureType != "" {
+		fields = append(fields, mrkdwn("*Failure type*\n"+slackEscape(string(n.FailureType))))
+	}
+	if n.Confidence > 0 {
+		fields = append(fields, mrkdwn(fmt.Sprintf("*Confidence*\n%.0f%%", n.Confidence*100)))
+	}
+	if n.PRURL != "" {
+		fields = append(fields, mrkdwn("*Pull request*\n"+slackLink(n.PRURL, fmt.Sprintf("#%d", n.PRNumber))))
+	}
+
+	blocks := []slackBlock{{Type: "section", Text: &slackText{Type: "mrkdwn", Text: summary}}}
+	if len(fields) > 0 {
+		blocks = append(blocks, slackBlock{Type: "section", Fields: fields})
+	}
+	if n.Reason != "" {
+		blocks = append(blocks, slackBlock{Type: "context", Elements: []slackText{mrkdwn(slackEscape(n.Reason))}})
+	}
+
+	// text is the fallback shown in notifications
+	return &slackMessage{Text: strings.ReplaceAll(summary, "*", ""), Blocks: blocks}
+}
+
+func mrkdwn(text string) slackText {
+	return slackText{Type: "mrkdwn", Text: text}
+}
+
+func slackLink(target, label string) string {
+	if target == "" {
+		return slackEscape(label)
+	}
+	return fmt.Sprintf("<%s|%s>", target, slackEscape(label))
+}
+
+// slackEscape escapes the characters Slack treats as control sequences
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// postNotification posts payload as JSON, retrying a failed request once
+func postNotification(ctx context.Context, client *http.Client, webhookURL string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = postJSON(ctx, client, webhookURL, body)
+		if err == nil || attempt >= notificationRetries {
+			return err
+		}
+		if waitErr := sleepContext(ctx, notificationRetryDelay); waitErr != nil {
+			return err
+		}
+	}
+}
+
+func postJSON(ctx context.Context, client *http.Client, webhookURL string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// url.Error includes the webhook URL, which is a secret
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// notify sends a notification when a webhook is configured and the repository configuration
+// keeps its event. Failures are logged and never interrupt the fix pipeline.
+func (m *DaggerAutofix) notify(ctx context.Context, notification *Notification) {
+	if m.notifier == nil || !m.settings(ctx).notifies(notification.Event) {
+		return
+	}
+	notification.Repository = m.RepoOwner + "/" + m.RepoName
+	if notification.Timestamp.IsZero() {
+		notification.Timestamp = time.Now()
+	}
+
+	if err := m.notifier.Notify(ctx, notification); err != nil {
+		m.logger.WithError(err).WithFields(logrus.Fields{
+			"event":  notification.Event,
+			"run_id": notification.RunID,
+		}).Warn("Failed to send notification")
+	}
+}
+
+// notifyValidationFailed notifies that AutoFix gave up because no fix passed validation
+func (m *DaggerAutofix) notifyValidationFailed(ctx context.Context, runID int64, analysis *FailureAnalysisResult, reason string) {
+	notification := analysisNotification(FixValidationFailed, runID, analysis)
+	notification.Reason = reason
+	m.notify(ctx, notification)
+}
+
+// runNotification returns a notification for event describing the workflow run
+func runNotification(event NotificationEvent, runID int64, run *WorkflowRun) *Notification {
+	notification := &Notification{Event: event, RunID: runID}
+	if run != nil {
+		notification.Workflow = run.Name
+		notification.Branch = run.Branch
+		notification.RunURL = run.URL
+	}
+	return notification
+}
+
+// analysisNotification returns a notification for event that adds the failure classification
+func analysisNotification(event NotificationEvent, runID int64, analysis *FailureAnalysisResult) *Notification {
+	if analysis == nil {
+		return runNotification(event, runID, nil)
+	}
+	notification := runNotification(event, runID, analysis.Context.WorkflowRun)
+	notification.FailureType = analysis.Classification.Type
+	notification.Confidence = analysis.Classification.Confidence
+	return notification
+}
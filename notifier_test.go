@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookServer records the JSON bodies posted to it. The first failures requests fail.
+type webhookServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	bodies   []map[string]interface{}
+	requests int
+	failures int
+}
+
+func newWebhookServer(t *testing.T, failures int) *webhookServer {
+	s := &webhookServer{failures: failures}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests++
+		if s.requests <= s.failures {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var decoded map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &decoded))
+		s.bodies = append(s.bodies, decoded)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *webhookServer) received() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]interface{}(nil), s.bodies...)
+}
+
+// events returns the event of each generic webhook payload received
+func (s *webhookServer) events() []string {
+	var events []string
+	for _, body := range s.received() {
+		events = append(events, body["event"].(string))
+	}
+	return events
+}
+
+func noRetryDelay(t *testing.T) {
+	previous := notificationRetryDelay
+	notificationRetryDelay = 0
+	t.Cleanup(func() { notificationRetryDelay = previous })
+}
+
+var notificationTime = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testNotifications() map[NotificationEvent]*Notification {
+	base := Notification{
+		Repository: "acme/widgets",
+		RunID:      42,
+		Workflow:   "CI",
+		Branch:     "main",
+		RunURL:     "https://github.com/acme/widgets/actions/runs/42",
+		Timestamp:  notificationTime,
+	}
+	withEvent := func(event NotificationEvent, update func(n *Notification)) *Notification {
+		n := base
+		n.Event = event
+		if update != nil {
+			update(&n)
+		}
+		return &n
+	}
+	classified := func(n *Notification) {
+		n.FailureType = TestFailure
+		n.Confidence = 0.87
+	}
+	return map[NotificationEvent]*Notification{
+		FailureDetected:   withEvent(FailureDetected, nil),
+		AnalysisCompleted: withEvent(AnalysisCompleted, classified),
+		FixPROpened: withEvent(FixPROpened, func(n *Notification) {
+			classified(n)
+			n.PRNumber = 7
+			n.PRURL = "https://github.com/acme/widgets/pull/7"
+		}),
+		FixValidationFailed: withEvent(FixValidationFailed, func(n *Notification) {
+			classified(n)
+			n.Reason = "No proposed fix passed validation"
+		}),
+		AutoFixAborted: withEvent(AutoFixAborted, func(n *Notification) {
+			n.Reason = "failure analysis failed: <timeout>"
+		}),
+	}
+}
+
+// TestWebhookNotifierPayloads tests the generic JSON payload of each event
+func TestWebhookNotifierPayloads(t *testing.T) {
+	expected := map[NotificationEvent]map[string]interface{}{
+		FailureDetected: {
+			"event": "failure_detected", "repository": "acme/widgets", "run_id": float64(42), "workflow": "CI",
+			"branch": "main", "run_url": "https://github.com/acme/widgets/actions/runs/42", "timestamp": "2024-03-01T12:00:00Z",
+		},
+		AnalysisCompleted: {
+			"event": "analysis_completed", "repository": "acme/widgets", "run_id": float64(42), "workflow": "CI",
+			"branch": "main", "run_url": "https://github.com/acme/widgets/actions/runs/42", "timestamp": "2024-03-01T12:00:00Z",
+			"failure_type": "test", "confidence": 0.87,
+		},
+		FixPROpened: {
+			"event": "fix_pr_opened", "repository": "acme/widgets", "run_id": float64(42), "workflow": "CI",
+			"branch": "main", "run_url": "https://github.com/acme/widgets/actions/runs/42", "timestamp": "2024-03-01T12:00:00Z",
+			"failure_type": "test", "confidence": 0.87, "pr_number": float64(7), "pr_url": "https://github.com/acme/widgets/pull/7",
+		},
+		FixValidationFailed: {
+			"event": "fix_validation_failed", "repository": "acme/widgets", "run_id": float64(42), "workflow": "CI",
+			"branch": "main", "run_url": "https://github.com/acme/widgets/actions/runs/42", "timestamp": "2024-03-01T12:00:00Z",
+			"failure_type": "test", "confidence": 0.87, "reason": "No proposed fix passed validation",
+		},
+		AutoFixAborted: {
+			"event": "autofix_aborted", "repository": "acme/widgets", "run_id": float64(42), "workflow": "CI",
+			"branch": "main", "run_url": "https://github.com/acme/widgets/actions/runs/42", "timestamp": "2024-03-01T12:00:00Z",
+			"reason": "failure analysis failed: <timeout>",
+		},
+	}
+
+	for event, notification := range testNotifications() {
+		t.Run(string(event), func(t *testing.T) {
+			server := newWebhookServer(t, 0)
+			notifier, err := NewNotifier(server.URL, "")
+			require.NoError(t, err)
+			require.IsType(t, &WebhookNotifier{}, notifier)
+
+			require.NoError(t, notifier.Notify(context.Background(), notification))
+			received := server.received()
+			require.Len(t, received, 1)
+			assert.Equal(t, expected[event], received[0])
+		})
+	}
+}
+
+// TestSlackNotifierPayloads tests the Block Kit message of each event
+func TestSlackNotifierPayloads(t *testing.T) {
+	workflow := map[string]interface{}{"type": "mrkdwn", "text": "*Workflow*\n<https://github.com/acme/widgets/actions/runs/42|CI>"}
+	failureType := map[string]interface{}{"type": "mrkdwn", "text": "*Failure type*\ntest"}
+	confidence := map[string]interface{}{"type": "mrkdwn", "text": "*Confidence*\n87%"}
+	section := func(text string) map[string]interface{} {
+		return map[string]interface{}{"type": "section", "text": map[string]interface{}{"type": "mrkdwn", "text": text}}
+	}
+	fields := func(fields ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"type": "section", "fields": fields}
+	}
+	contextBlock := func(text string) map[string]interface{} {
+		return map[string]interface{}{"type": "context", "elements": []interface{}{map[string]interface{}{"type": "mrkdwn", "text": text}}}
+	}
+
+	expected := map[NotificationEvent]map[string]interface{}{
+		FailureDetected: {
+			"text":   ":rotating_light: Workflow failure detected in acme/widgets",
+			"blocks": []interface{}{section(":rotating_light: Workflow failure detected in *acme/widgets*"), fields(workflow)},
+		},
+		AnalysisCompleted: {
+			"text":   ":mag: Failure analysis completed in acme/widgets",
+			"blocks": []interface{}{section(":mag: Failure analysis completed in *acme/widgets*"), fields(workflow, failureType, confidence)},
+		},
+		FixPROpened: {
+			"text": ":white_check_mark: Fix pull request opened in acme/widgets",
+			"blocks": []interface{}{
+				section(":white_check_mark: Fix pull request opened in *acme/widgets*"),
+				fields(workflow, failureType, confidence, map[string]interface{}{"type": "mrkdwn", "text": "*Pull request*\n<https://github.com/acme/widgets/pull/7|#7>"}),
+			},
+		},
+		FixValidationFailed: {
+			"text": ":x: No proposed fix passed validation in acme/widgets",
+			"blocks": []interface{}{
+				section(":x: No proposed fix passed validation in *acme/widgets*"),
+				fields(workflow, failureType, confidence),
+				contextBlock("No proposed fix passed validation"),
+			},
+		},
+		AutoFixAborted: {
+			"text": ":warning: Auto-fix gave up in acme/widgets",
+			"blocks": []interface{}{
+				section(":warning: Auto-fix gave up in *acme/widgets*"),
+				fields(workflow),
+				contextBlock("failure analysis failed: &lt;timeout&gt;"),
+			},
+		},
+	}
+
+	for event, notification := range testNotifications() {
+		t.Run(string(event), func(t *testing.T) {
+			server := newWebhookServer(t, 0)
+			notifier, err := NewNotifier(server.URL, NotificationFormatSlack)
+			require.NoError(t, err)
+			require.IsType(t, &SlackNotifier{}, notifier)
+
+			require.NoError(t, notifier.Notify(context.Background(), notification))
+			received := server.received()
+			require.Len(t, received, 1)
+			assert.Equal(t, expected[event], received[0])
+		})
+	}
+}
+
+// TestNewNotifier tests format selection and validation
+func TestNewNotifier(t *testing.T) {
+	notifier, err := NewNotifier("https://hooks.slack.com/services/T000/B000/XXXX", "")
+	require.NoError(t, err)
+	assert.IsType(t, &SlackNotifier{}, notifier)
+
+	notifier, err = NewNotifier("https://hooks.slack.com/services/T000/B000/XXXX", NotificationFormatWebhook)
+	require.NoError(t, err)
+	assert.IsType(t, &WebhookNotifier{}, notifier)
+
+	_, err = NewNotifier("https://example.com/hook", "teams")
+	assert.EqualError(t, err, `invalid notification format "teams", expected webhook or slack`)
+
+	_, err = NewNotifier("hooks.slack.com/services/secret-path", "")
+	assert.EqualError(t, err, "notification webhook must be an absolute http(s) URL")
+}
+
+// TestNotifierRetry tests that a failed request is retried once
+func TestNotifierRetry(t *testing.T) {
+	noRetryDelay(t)
+	notification := testNotifications()[FixPROpened]
+
+	t.Run("RetrySucceeds", func(t *testing.T) {
+		server := newWebhookServer(t, 1)
+		notifier, err := NewNotifier(server.URL, "")
+		require.NoError(t, err)
+
+		require.NoError(t, notifier.Notify(context.Background(), notification))
+		assert.Equal(t, 2, server.requests)
+		assert.Len(t, server.received(), 1)
+	})
+
+	t.Run("GivesUpAfterOneRetry", func(t *testing.T) {
+		server := newWebhookServer(t, 5)
+		notifier, err := NewNotifier(server.URL, "")
+		require.NoError(t, err)
+
+		err = notifier.Notify(context.Background(), notification)
+		assert.EqualError(t, err, "notification webhook returned 502 Bad Gateway")
+		assert.Equal(t, 2, server.requests)
+	})
+
+	t.Run("ErrorOmitsURL", func(t *testing.T) {
+		server := newWebhookServer(t, 0)
+		webhookURL := server.URL + "/services/secret-path"
+		server.Close()
+		notifier, err := NewNotifier(webhookURL, "")
+		require.NoError(t, err)
+
+		err = notifier.Notify(context.Background(), notification)
+		require.Error(t, err)
+		assert.NotContains(t, err.Error(), "secret-path")
+	})
+}
+
+// TestAutoFixNotifications tests the events sent by the fix pipeline
+func TestAutoFixNotifications(t *testing.T) {
+	useTestMetrics(t)
+	noRetryDelay(t)
+	ctx := context.Background()
+
+	newAutofix := func(t *testing.T, server *webhookServer) *DaggerAutofix {
+		m := fixtureAutofix(nil)
+		m.RepoOwner, m.RepoName = "acme", "widgets"
+		notifier, err := NewNotifier(server.URL, "")
+		require.NoError(t, err)
+		m.notifier = notifier
+		return m
+	}
+
+	t.Run("PROpened", func(t *testing.T) {
+		server := newWebhookServer(t, 0)
+		m := newAutofix(t, server)
+		m.prEngine.(*mockPullRequestEngine).createWithOptionsFunc = func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error) {
+			return &PullRequest{Number: 9, URL: "https://github.com/acme/widgets/pull/9"}, nil
+		}
+
+		_, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"analysis_completed", "fix_pr_opened"}, server.events())
+		opened := server.received()[1]
+		assert.Equal(t, "acme/widgets", opened["repository"])
+		assert.Equal(t, "test", opened["failure_type"])
+		assert.Equal(t, float64(9), opened["pr_number"])
+		assert.Equal(t, "https://github.com/acme/widgets/pull/9", opened["pr_url"])
+	})
+
+	t.Run("ValidationFailed", func(t *testing.T) {
+		server := newWebhookServer(t, 0)
+		m := newAutofix(t, server)
+		m.testEngine.(*mockTestEngine).runTestsWithChangesFunc = func(ctx context.Context, source *dagger.Directory, changes []CodeChange) (*TestResult, error) {
+			return &TestResult{Success: false, FailedTests: 2}, nil
+		}
+
+		_, err := m.AutoFix(ctx, 1)
+		require.Error(t, err)
+
+		assert.Equal(t, []string{"analysis_completed", "fix_validation_failed"}, server.events())
+		assert.Equal(t, "No proposed fix passed validation", server.received()[1]["reason"])
+	})
+
+	t.Run("Aborted", func(t *testing.T) {
+		server := newWebhookServer(t, 0)
+		m := newAutofix(t, server)
+		m.failureEngine.(*mockFailureAnalysisEngine).generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+			return nil, errors.New("llm unavailable")
+		}
+
+		_, err := m.AutoFix(ctx, 1)
+		require.Error(t, err)
+
+		assert.Equal(t, []string{"analysis_completed", "autofix_aborted"}, server.events())
+		assert.Equal(t, "fix generation failed: llm unavailable", server.received()[1]["reason"])
+		assert.Equal(t, "test", server.received()[1]["failure_type"])
+	})
+
+	t.Run("NotificationFailuresAreIgnored", func(t *testing.T) {
+		server := newWebhookServer(t, 100)
+		m := newAutofix(t, server)
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.True(t, res.Success)
+		assert.Equal(t, 4, server.requests, "each of the two events is tried twice")
+	})
+}
+
+// TestCheckForFailuresNotifies tests that monitoring reports each detected failure
+func TestCheckForFailuresNotifies(t *testing.T) {
+	useTestMetrics(t)
+	server := newWebhookServer(t, 0)
+
+	m := fixtureAutofix(nil)
+	m.RepoOwner, m.RepoName = "acme", "widgets"
+	notifier, err := NewNotifier(server.URL, "")
+	require.NoError(t, err)
+	m.notifier = notifier
+	m.githubClient.(*mockGitHub).getFailedWorkflowRunsFunc = func(ctx context.Context) ([]*WorkflowRun, error) {
+		return []*WorkflowRun{{ID: 5, Name: "CI", Branch: "main", URL: "https://github.com/acme/widgets/actions/runs/5"}}, nil
+	}
+
+	require.NoError(t, m.checkForFailures(context.Background()))
+	m.drainFixes()
+
+	events := server.events()
+	require.NotEmpty(t, events)
+	assert.Equal(t, "failure_detected", events[0])
+	assert.Contains(t, events, "fix_pr_opened")
+	detected := server.received()[0]
+	assert.Equal(t, "CI", detected["workflow"])
+	assert.Equal(t, float64(5), detected["run_id"])
+	assert.Equal(t, "https://github.com/acme/widgets/actions/runs/5", detected["run_url"])
+}
+
+// TestWithNotificationWebhook tests the notification builders and format validation
+func TestWithNotificationWebhook(t *testing.T) {
+	webhook := createTestSecret("notification-webhook", "https://hooks.slack.com/services/T000/B000/XXXX")
+	m := New().WithNotificationWebhook(webhook).WithNotificationFormat(NotificationFormatSlack)
+	assert.Equal(t, webhook, m.NotificationWebhook)
+	assert.Equal(t, NotificationFormatSlack, m.NotificationFormat)
+
+	m = New().
+		WithGitHubToken(createTestSecret("github-token", "ghp_test")).
+		WithLLMProvider("openai", createTestSecret("llm-api-key", "sk-test")).
+		WithRepository("acme", "widgets").
+		WithNotificationFormat("teams")
+	assert.EqualError(t, m.validateConfiguration(), `invalid notification format "teams", expected webhook or slack`)
+}
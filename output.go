@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"dagger.io/dagger"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats for command results
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+	OutputYAML = "yaml"
+)
+
+func validateOutputFormat(format string) error {
+	switch format {
+	case OutputText, OutputJSON, OutputYAML:
+		return nil
+	default:
+		return fmt.Errorf("invalid output format %q, expected text, json or yaml", format)
+	}
+}
+
+// Exit codes of the CLI
+const (
+	exitError              = 1  // the command could not run
+	exitChecksFailed       = 2  // the command ran, but validation or the fix failed
+	exitInvalidInput       = 3  // a run ID, repository, branch name or log is malformed
+	exitGitHubAuth         = 4  // GitHub rejected the token or it lacks a permission
+	exitGitHubNotFound     = 5  // the repository, run or branch does not exist
+	exitLLMAuth            = 6  // the LLM provider rejected the API key
+	exitLLMRateLimited     = 7  // the LLM provider rate limited the request
+	exitLLMInvalidResponse = 8  // the LLM response could not be parsed
+	exitNoValidFixes       = 9  // no proposed fix passed validation
+	exitCoverage           = 10 // a fix's tests passed with too little coverage
+	exitLLMContentFiltered = 11 // the LLM provider's content filter blocked the response
+	exitNothingToFix       = 12 // monitor --once, fix-batch or review found no failed runs to fix
+	exitPreflightWarnings  = 13 // doctor found warnings but no failures
+)
+
+// categoryExitCodes maps error categories to exit codes; other errors exit with exitError
+var categoryExitCodes = map[ErrorCategory]int{
+	ErrorCategoryInvalidInput:       exitInvalidInput,
+	ErrorCategoryGitHubAuth:         exitGitHubAuth,
+	ErrorCategoryGitHubNotFound:     exitGitHubNotFound,
+	ErrorCategoryLLMAuth:            exitLLMAuth,
+	ErrorCategoryLLMRateLimited:     exitLLMRateLimited,
+	ErrorCategoryLLMInvalidResponse: exitLLMInvalidResponse,
+	ErrorCategoryNoValidFixes:       exitNoValidFixes,
+	ErrorCategoryCoverage:           exitCoverage,
+	ErrorCategoryLLMContentFiltered: exitLLMContentFiltered,
+}
+
+// categoryHints tell the user what to do about an error category
+var categoryHints = map[ErrorCategory]string{
+	ErrorCategoryInvalidInput:       "check the run ID, repository and branch arguments",
+	ErrorCategoryGitHubAuth:         "check that the GitHub token is valid and has the actions, contents and pull-requests permissions",
+	ErrorCategoryGitHubNotFound:     "check --repo-owner and --repo-name, and that the token can access the repository",
+	ErrorCategoryLLMAuth:            "check the LLM API key for the configured --llm-provider",
+	ErrorCategoryLLMRateLimited:     "the LLM provider is rate limiting requests, retry later or raise the quota",
+	ErrorCategoryLLMInvalidResponse: "the LLM returned a response that could not be parsed, retry or try another model",
+	ErrorCategoryNoValidFixes:       "none of the proposed fixes passed the tests, see the analysis for a manual fix",
+	ErrorCategoryCoverage:           "a fix passed the tests but not the coverage requirement, see --min-coverage",
+	ErrorCategoryLLMContentFiltered: "the LLM provider's content filter blocked the request, check the logs sent in the prompt or try another model",
+}
+
+// exitCodeHelp documents the exit codes in --help
+const exitCodeHelp = `Exit codes:
+  0   success
+  1   error
+  2   the command ran, but validation or the fix failed
+  3   invalid run ID, PR number, repository or branch name
+  4   GitHub authentication failed
+  5   GitHub repository, run or branch not found
+  6   LLM authentication failed
+  7   LLM rate limit exceeded
+  8   invalid LLM response
+  9   no valid fixes
+  10  coverage below minimum
+  11  LLM response blocked by content filter
+  12  monitor --once, fix-batch or review found no failed runs to fix
+  13  doctor found warnings but no failures`
+
+// checkFailure marks an error reported after a command produced its result because
+// the result is a failure, e.g. failing tests
+type checkFailure struct {
+	error
+}
+
+func (e checkFailure) Unwrap() error {
+	return e.error
+}
+
+// nothingToFix marks a command that ran but found nothing to fix, e.g. monitor --once
+type nothingToFix struct {
+	error
+}
+
+func (e nothingToFix) Unwrap() error {
+	return e.error
+}
+
+// preflightWarnings marks doctor runs whose checks warned but none failed
+type preflightWarnings struct {
+	error
+}
+
+func (e preflightWarnings) Unwrap() error {
+	return e.error
+}
+
+// exitCode maps a command error to the process exit code
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if code, ok := categoryExitCodes[errorCategory(err)]; ok {
+		return code
+	}
+	var failure checkFailure
+	if errors.As(err, &failure) {
+		return exitChecksFailed
+	}
+	var nothing nothingToFix
+	if errors.As(err, &nothing) {
+		return exitNothingToFix
+	}
+	var warnings preflightWarnings
+	if errors.As(err, &warnings) {
+		return exitPreflightWarnings
+	}
+	return exitError
+}
+
+// errorHint returns a suggestion for fixing err, or "" when there is none
+func errorHint(err error) string {
+	return categoryHints[errorCategory(err)]
+}
+
+// outputDuration is how durations are written in json and yaml output
+type outputDuration struct {
+	Nanoseconds int64  `json:"nanoseconds" yaml:"nanoseconds"`
+	Human       string `json:"human" yaml:"human"`
+}
+
+// tokenPattern matches GitHub and LLM provider tokens that may have ended up in logs or output
+var tokenPattern = regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,}|sk-[A-Za-z0-9_-]{20,})`)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+	secretType   = reflect.TypeOf(&dagger.Secret{})
+)
+
+// outputFormat returns the --output flag value
+func (c *CLI) outputFormat() string {
+	format, _ := c.rootCmd.PersistentFlags().GetString("output")
+	if format == "" {
+		return OutputText
+	}
+	return format
+}
+
+// render writes a command result to stdout: text calls writeText, json and yaml marshal
+// the result. Logs go to stderr so the json and yaml streams stay parseable.
+func (c *CLI) render(result interface{}, writeText func(w io.Writer)) error {
+	out := c.rootCmd.OutOrStdout()
+	format := c.outputFormat()
+	if format == OutputText {
+		writeText(out)
+		return nil
+	}
+	if err := validateOutputFormat(format); err != nil {
+		return err
+	}
+
+	config := c.getCurrentConfig(c.rootCmd)
+	value := outputValue(reflect.ValueOf(result), newSecretRedactor(config.GitHubToken, config.LLMAPIKey, config.NotificationWebhook))
+	switch format {
+	case OutputJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(value); err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+	case OutputYAML:
+		encoder := yaml.NewEncoder(out)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(value); err != nil {
+			return fmt.Errorf("failed to encode output: %w", err)
+		}
+		return encoder.Close()
+	}
+	return nil
+}
+
+// newSecretRedactor returns a function masking the configured secrets and anything
+// that looks like a token
+func newSecretRedactor(secrets ...string) func(string) string {
+	var known []string
+	for _, secret := range secrets {
+		// Very short values would mask unrelated text
+		if len(secret) >= 8 {
+			known = append(known, secret)
+		}
+	}
+	return func(s string) string {
+		for _, secret := range known {
+			s = strings.ReplaceAll(s, secret, "***")
+		}
+		return tokenPattern.ReplaceAllString(s, "***")
+	}
+}
+
+// outputValue converts v into plain maps, slices and values following the json field
+// tags, writing durations as outputDuration, dropping Dagger secrets and redacting strings
+func outputValue(v reflect.Value, redact func(string) string) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	switch v.Type() {
+	case durationType:
+		d := time.Duration(v.Int())
+		return outputDuration{Nanoseconds: int64(d), Human: d.String()}
+	case timeType:
+		return v.Interface()
+	case secretType:
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return outputValue(v.Elem(), redact)
+	case reflect.Struct:
+		fields := make(map[string]interface{})
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() || field.Type == secretType {
+				continue
+			}
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			if strings.Contains(opts, "omitempty") && v.Field(i).IsZero() {
+				continue
+			}
+			fields[name] = outputValue(v.Field(i), redact)
+		}
+		return fields
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		entries := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			entries[fmt.Sprint(key)] = outputValue(v.MapIndex(key), redact)
+		}
+		return entries
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = outputValue(v.Index(i), redact)
+		}
+		return items
+	case reflect.String:
+		return redact(v.String())
+	default:
+		return v.Interface()
+	}
+}
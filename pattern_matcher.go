@@ -0,0 +1,143 @@
+package main
+
+import "sort"
+
+// patternMatch is a named error pattern rule found in failure logs
+type patternMatch struct {
+	name string
+	rule *ErrorPatternRule
+}
+
+// patternMatcher finds the patterns of an error pattern database in failure logs. It is an
+// Aho-Corasick automaton, so a log is read once however many patterns there are, and patterns
+// overlapping each other in the log are all found.
+type patternMatcher struct {
+	// rules are ranked by specificity: the longest pattern first, then by name
+	rules []patternMatch
+	// always are the ranks of empty patterns, which match any log
+	always []int32
+	// classes maps the bytes of the patterns to their alphabet class; other bytes are class 0
+	classes [256]uint16
+	width   int
+	// delta is the transition of each state by class, as delta[state*width+class]
+	delta []int32
+	// outputs are the ranks of the patterns ending at each state
+	outputs [][]int32
+}
+
+// newPatternMatcher ranks the patterns and builds their automaton
+func newPatternMatcher(patterns map[string]*ErrorPatternRule) *patternMatcher {
+	m := &patternMatcher{width: 1}
+	for name, rule := range patterns {
+		if rule != nil {
+			m.rules = append(m.rules, patternMatch{name, rule})
+		}
+	}
+	sort.Slice(m.rules, func(i, j int) bool {
+		if len(m.rules[i].rule.Pattern) != len(m.rules[j].rule.Pattern) {
+			return len(m.rules[i].rule.Pattern) > len(m.rules[j].rule.Pattern)
+		}
+		return m.rules[i].name < m.rules[j].name
+	})
+
+	for _, entry := range m.rules {
+		pattern := entry.rule.Pattern
+		for i := 0; i < len(pattern); i++ {
+			if m.classes[pattern[i]] == 0 {
+				m.classes[pattern[i]] = uint16(m.width)
+				m.width++
+			}
+		}
+	}
+
+	// The trie of the patterns, where a zero transition is a missing child
+	m.delta = make([]int32, m.width)
+	m.outputs = [][]int32{nil}
+	for rank, entry := range m.rules {
+		pattern := entry.rule.Pattern
+		if pattern == "" {
+			m.always = append(m.always, int32(rank))
+			continue
+		}
+		state := 0
+		for i := 0; i < len(pattern); i++ {
+			edge := state*m.width + int(m.classes[pattern[i]])
+			if m.delta[edge] == 0 {
+				m.delta[edge] = int32(len(m.outputs))
+				m.delta = append(m.delta, make([]int32, m.width)...)
+				m.outputs = append(m.outputs, nil)
+			}
+			state = int(m.delta[edge])
+		}
+		m.outputs[state] = append(m.outputs[state], int32(rank))
+	}
+
+	// Breadth first, each state falls back to the longest suffix of it that is in the trie,
+	// taking over its outputs and the transitions it lacks
+	fail := make([]int32, len(m.outputs))
+	var queue []int32
+	for class := 0; class < m.width; class++ {
+		if child := m.delta[class]; child != 0 {
+			queue = append(queue, child)
+		}
+	}
+	for len(queue) > 0 {
+		state := int(queue[0])
+		queue = queue[1:]
+		m.outputs[state] = append(m.outputs[state], m.outputs[fail[state]]...)
+		for class := 0; class < m.width; class++ {
+			fallback := m.delta[int(fail[state])*m.width+class]
+			if child := m.delta[state*m.width+class]; child != 0 {
+				fail[child] = fallback
+				queue = append(queue, child)
+			} else {
+				m.delta[state*m.width+class] = fallback
+			}
+		}
+	}
+	return m
+}
+
+// match returns the rules whose pattern appears in any of the logs, most specific first. The
+// logs are read in order, each once, and reading stops when every pattern was found.
+func (m *patternMatcher) match(logs ...string) []patternMatch {
+	found := make([]bool, len(m.rules))
+	remaining := len(m.rules)
+	if len(logs) > 0 {
+		for _, rank := range m.always {
+			found[rank] = true
+			remaining--
+		}
+	}
+	for _, text := range logs {
+		if remaining == 0 {
+			break
+		}
+		remaining = m.scan(text, found, remaining)
+	}
+
+	var matches []patternMatch
+	for rank, ok := range found {
+		if ok {
+			matches = append(matches, m.rules[rank])
+		}
+	}
+	return matches
+}
+
+// scan marks the patterns in text as found and returns how many remain to be found
+func (m *patternMatcher) scan(text string, found []bool, remaining int) int {
+	state := 0
+	for i := 0; i < len(text); i++ {
+		state = int(m.delta[state*m.width+int(m.classes[text[i]])])
+		for _, rank := range m.outputs[state] {
+			if !found[rank] {
+				found[rank] = true
+				if remaining--; remaining == 0 {
+					return 0
+				}
+			}
+		}
+	}
+	return remaining
+}
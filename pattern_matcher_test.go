@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// containsMatchingRules is the reference matcher: it sorts the patterns and checks each with
+// strings.Contains
+func containsMatchingRules(patterns map[string]*ErrorPatternRule, logs ...string) []patternMatch {
+	var rules []patternMatch
+	for name, rule := range patterns {
+		rules = append(rules, patternMatch{name, rule})
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if len(rules[i].rule.Pattern) != len(rules[j].rule.Pattern) {
+			return len(rules[i].rule.Pattern) > len(rules[j].rule.Pattern)
+		}
+		return rules[i].name < rules[j].name
+	})
+
+	var matches []patternMatch
+	for _, entry := range rules {
+		for _, text := range logs {
+			if strings.Contains(text, entry.rule.Pattern) {
+				matches = append(matches, entry)
+				break
+			}
+		}
+	}
+	return matches
+}
+
+func matchNames(matches []patternMatch) []string {
+	var names []string
+	for _, match := range matches {
+		names = append(names, match.name)
+	}
+	return names
+}
+
+func patternRules(patterns ...string) map[string]*ErrorPatternRule {
+	rules := make(map[string]*ErrorPatternRule, len(patterns))
+	for _, pattern := range patterns {
+		rules[pattern] = &ErrorPatternRule{Pattern: pattern}
+	}
+	return rules
+}
+
+// TestPatternMatcher tests that the automaton finds the patterns strings.Contains finds
+func TestPatternMatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		logs     []string
+		want     []string
+	}{
+		{"overlapping", []string{"go build", "build failed", "go build failed"}, []string{"go build failed: exit 1"}, []string{"go build failed", "build failed", "go build"}},
+		{"suffixes", []string{"abc", "bc", "c", "bcd"}, []string{"xxabcx"}, []string{"abc", "bc", "c"}},
+		{"across logs", []string{"timeout", "ENOENT"}, []string{"read ENOENT", "connection timeout"}, []string{"timeout", "ENOENT"}},
+		{"repeated prefix", []string{"aab", "ab"}, []string{"aaab"}, []string{"aab", "ab"}},
+		{"case sensitive", []string{"Build Failed"}, []string{"build failed"}, nil},
+		{"empty pattern", []string{"", "fatal"}, []string{""}, []string{""}},
+		{"no logs", []string{""}, nil, nil},
+		{"unicode", []string{"ошибка сборки", "✗ test"}, []string{"go: ошибка сборки\n✗ test"}, []string{"ошибка сборки", "✗ test"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &ErrorPatternDatabase{Patterns: patternRules(tt.patterns...)}
+			got := db.matchingRules(tt.logs...)
+			assert.Equal(t, tt.want, matchNames(got))
+			assert.Equal(t, matchNames(containsMatchingRules(db.Patterns, tt.logs...)), matchNames(got))
+		})
+	}
+
+	t.Run("builtin patterns on random logs", func(t *testing.T) {
+		db := loadErrorPatterns()
+		var fragments []string
+		for _, rule := range db.Patterns {
+			fragments = append(fragments, rule.Pattern, rule.Pattern[:len(rule.Pattern)/2])
+		}
+		fragments = append(fragments, " ", "\n", "error: ", "npm ", "go ")
+		random := rand.New(rand.NewSource(1))
+		for i := 0; i < 200; i++ {
+			var errorLines, rawLogs strings.Builder
+			for j := 0; j < 20; j++ {
+				errorLines.WriteString(fragments[random.Intn(len(fragments))])
+				rawLogs.WriteString(fragments[random.Intn(len(fragments))])
+			}
+			want := containsMatchingRules(db.Patterns, errorLines.String(), rawLogs.String())
+			require.Equal(t, matchNames(want), matchNames(db.matchingRules(errorLines.String(), rawLogs.String())))
+		}
+	})
+}
+
+// TestMatchingRulesDeterministic tests that patterns of the same length are ranked by name,
+// however the pattern map is iterated
+func TestMatchingRulesDeterministic(t *testing.T) {
+	logs := "npm ERR! connection timeout\nERROR: test failed\nbuild failed"
+	var first []string
+	for i := 0; i < 50; i++ {
+		db := &ErrorPatternDatabase{Patterns: map[string]*ErrorPatternRule{
+			"timeout_b": {Pattern: "connection timeout", Type: InfrastructureFailure},
+			"timeout_a": {Pattern: "connection timeout", Type: TestFailure},
+			"npm":       {Pattern: "npm ERR!", Type: DependencyFailure},
+			"build":     {Pattern: "build failed", Type: BuildFailure},
+			"test":      {Pattern: "test failed", Type: TestFailure},
+		}}
+		names := matchNames(db.matchingRules(logs))
+		if first == nil {
+			first = names
+		}
+		require.Equal(t, first, names, "run %d", i)
+	}
+	assert.Equal(t, []string{"timeout_a", "timeout_b", "build", "test", "npm"}, first)
+}
+
+// benchmarkPatterns returns 100 patterns and a 1MB log holding one of them in its last line
+func benchmarkPatterns() (map[string]*ErrorPatternRule, string) {
+	patterns := loadErrorPatterns().Patterns
+	for i := len(patterns); i < 100; i++ {
+		patterns[fmt.Sprintf("custom_%d", i)] = &ErrorPatternRule{Pattern: fmt.Sprintf("custom failure %d occurred", i)}
+	}
+	var logs strings.Builder
+	for i := 0; logs.Len() < 1<<20; i++ {
+		fmt.Fprintf(&logs, "2024-01-01T00:00:%02dZ step %d: compiling package example.com/module/pkg%d\n", i%60, i, i)
+	}
+	logs.WriteString("custom failure 99 occurred\n")
+	return patterns, logs.String()
+}
+
+// BenchmarkMatchingRules compares matching 100 patterns against a 1MB log with the automaton
+// and with a strings.Contains scan per pattern
+func BenchmarkMatchingRules(b *testing.B) {
+	patterns, logs := benchmarkPatterns()
+	b.Run("Automaton", func(b *testing.B) {
+		db := &ErrorPatternDatabase{Patterns: patterns}
+		db.index()
+		b.SetBytes(int64(len(logs)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = db.matchingRules("", logs)
+		}
+	})
+	b.Run("Contains", func(b *testing.B) {
+		b.SetBytes(int64(len(logs)))
+		for i := 0; i < b.N; i++ {
+			_ = containsMatchingRules(patterns, "", logs)
+		}
+	})
+}
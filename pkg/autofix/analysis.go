@@ -0,0 +1,142 @@
+package autofix
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Analysis is the analysis of a failure: its root cause, classification and the files it
+// involves
+type Analysis struct {
+	RootCause      string                `json:"root_cause"`
+	Description    string                `json:"description"`
+	Classification FailureClassification `json:"classification"`
+	AffectedFiles  []string              `json:"affected_files"`
+	ErrorPatterns  []ErrorPattern        `json:"error_patterns"`
+}
+
+// ParseAnalysis parses an LLM's analysis of a failure. Responses holding a JSON object with
+// root_cause, description, classification, affected_files and error_patterns are parsed
+// field by field; other responses are kept as the description, with a failure type guessed
+// from their wording. onUnknown, when not nil, is called for each classification field whose
+// value is none of the known ones and falls back to unknown.
+func ParseAnalysis(content string, onUnknown func(field string, err error)) (*Analysis, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, fmt.Errorf("empty response content")
+	}
+
+	jsonStart := strings.Index(content, "{")
+	jsonEnd := strings.LastIndex(content, "}")
+	if jsonStart == -1 || jsonEnd == -1 {
+		return parseUnstructuredAnalysis(content), nil
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(content[jsonStart:jsonEnd+1]), &parsed); err != nil {
+		return parseUnstructuredAnalysis(content), nil
+	}
+
+	analysis := &Analysis{
+		RootCause:   getStringField(parsed, "root_cause", ""),
+		Description: getStringField(parsed, "description", ""),
+	}
+	if classData, ok := parsed["classification"].(map[string]interface{}); ok {
+		analysis.Classification = FailureClassification{
+			Type:       parseField(onUnknown, "type", getStringField(classData, "type", string(CodeFailure)), ParseFailureType),
+			Severity:   parseField(onUnknown, "severity", getStringField(classData, "severity", string(Medium)), ParseSeverity),
+			Category:   parseField(onUnknown, "category", getStringField(classData, "category", string(Systematic)), ParseCategory),
+			Confidence: getFloatField(classData, "confidence", 0.7),
+			Tags:       getStringArrayField(classData, "tags"),
+		}
+	}
+	if files, ok := parsed["affected_files"].([]interface{}); ok {
+		for _, file := range files {
+			if fileStr, ok := file.(string); ok {
+				analysis.AffectedFiles = append(analysis.AffectedFiles, fileStr)
+			}
+		}
+	}
+	if patterns, ok := parsed["error_patterns"].([]interface{}); ok {
+		for _, pattern := range patterns {
+			if patternMap, ok := pattern.(map[string]interface{}); ok {
+				analysis.ErrorPatterns = append(analysis.ErrorPatterns, ErrorPattern{
+					Pattern:     getStringField(patternMap, "pattern", ""),
+					Description: getStringField(patternMap, "description", ""),
+					Confidence:  getFloatField(patternMap, "confidence", 0.5),
+					Location:    getStringField(patternMap, "location", ""),
+				})
+			}
+		}
+	}
+	return analysis, nil
+}
+
+// parseUnstructuredAnalysis keeps a response that is not JSON as the description, guessing
+// the failure type from the words it uses
+func parseUnstructuredAnalysis(content string) *Analysis {
+	contentLower := strings.ToLower(content)
+	failureType := CodeFailure
+	if strings.Contains(contentLower, "dependency") || strings.Contains(contentLower, "dependencies") ||
+		strings.Contains(contentLower, "package") {
+		failureType = DependencyFailure
+	} else if strings.Contains(contentLower, "build") || strings.Contains(contentLower, "compilation") {
+		failureType = BuildFailure
+	} else if strings.Contains(contentLower, "test") {
+		failureType = TestFailure
+	} else if strings.Contains(contentLower, "infrastructure") || strings.Contains(contentLower, "network") ||
+		strings.Contains(contentLower, "timeout") {
+		failureType = InfrastructureFailure
+	} else if strings.Contains(contentLower, "security") || strings.Contains(contentLower, "vulnerability") {
+		failureType = SecurityFailure
+	} else if strings.Contains(contentLower, "configuration") || strings.Contains(contentLower, "config") {
+		failureType = ConfigurationFailure
+	}
+
+	return &Analysis{
+		Description: content,
+		RootCause:   "Analysis provided in description field",
+		Classification: FailureClassification{
+			Type:       failureType,
+			Severity:   Medium,
+			Category:   Systematic,
+			Confidence: 0.5,
+			Tags:       []string{"unstructured"},
+		},
+	}
+}
+
+// parseField parses a classification field, reporting values that fall back to unknown
+func parseField[T ~string](onUnknown func(string, error), field, value string, parse func(string) (T, error)) T {
+	parsed, err := parse(value)
+	if err != nil && onUnknown != nil {
+		onUnknown(field, err)
+	}
+	return parsed
+}
+
+func getStringField(data map[string]interface{}, key, defaultValue string) string {
+	if val, ok := data[key].(string); ok {
+		return val
+	}
+	return defaultValue
+}
+
+func getFloatField(data map[string]interface{}, key string, defaultValue float64) float64 {
+	if val, ok := data[key].(float64); ok {
+		return val
+	}
+	return defaultValue
+}
+
+func getStringArrayField(data map[string]interface{}, key string) []string {
+	if val, ok := data[key].([]interface{}); ok {
+		var result []string
+		for _, item := range val {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	}
+	return []string{}
+}
@@ -0,0 +1,47 @@
+package autofix
+
+import (
+	"go/build"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseAnalysis tests parsing structured and unstructured LLM analyses
+func TestParseAnalysis(t *testing.T) {
+	var unknown []string
+	onUnknown := func(field string, err error) { unknown = append(unknown, field) }
+
+	analysis, err := ParseAnalysis(`{"root_cause": "x", "classification": {"type": "cosmic rays"}}`, onUnknown)
+	require.NoError(t, err)
+	assert.Equal(t, FailureClassification{Type: UnknownFailure, Severity: Medium, Category: Systematic, Confidence: 0.7, Tags: []string{}},
+		analysis.Classification)
+	assert.Equal(t, []string{"type"}, unknown)
+
+	analysis, err = ParseAnalysis(`The build failed due to missing dependencies.
+	The package.json file is missing required packages.`, onUnknown)
+	require.NoError(t, err)
+	assert.Equal(t, DependencyFailure, analysis.Classification.Type)
+	assert.Equal(t, []string{"unstructured"}, analysis.Classification.Tags)
+	assert.NotEmpty(t, analysis.RootCause)
+	assert.Contains(t, analysis.Description, "missing dependencies")
+
+	analysis, err = ParseAnalysis("{not json} but a flaky network timeout", nil)
+	require.NoError(t, err)
+	assert.Equal(t, InfrastructureFailure, analysis.Classification.Type)
+
+	_, err = ParseAnalysis(" \n", nil)
+	assert.Error(t, err)
+}
+
+// TestImports tests that the package depends on the standard library only, so importing it
+// does not pull in Dagger, GitHub or CLI dependencies
+func TestImports(t *testing.T) {
+	pkg, err := build.ImportDir(".", 0)
+	require.NoError(t, err)
+	for _, path := range pkg.Imports {
+		assert.NotContains(t, strings.Split(path, "/")[0], ".", "%s is not in the standard library", path)
+	}
+}
@@ -0,0 +1,256 @@
+package autofix
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Unknown values stand in for classifications an LLM or a stored analysis gives that match
+// none of the known ones, so arbitrary strings never reach policies, metrics or labels
+const (
+	UnknownFailure  FailureType     = "unknown"
+	UnknownFix      FixType         = "unknown"
+	UnknownSeverity SeverityLevel   = "unknown"
+	UnknownCategory FailureCategory = "unknown"
+)
+
+// The alias tables are keyed by normalized values, see normalizeClassification
+
+// failureTypeAliases maps normalized failure types, after dropping a "failure" or "error"
+// suffix, to their constant
+var failureTypeAliases = map[string]FailureType{
+	"infrastructure": InfrastructureFailure,
+	"infra":          InfrastructureFailure,
+	"environment":    InfrastructureFailure,
+	"network":        InfrastructureFailure,
+	"runner":         InfrastructureFailure,
+	"resource":       InfrastructureFailure,
+	"timeout":        InfrastructureFailure,
+	"code":           CodeFailure,
+	"source":         CodeFailure,
+	"logic":          CodeFailure,
+	"syntax":         CodeFailure,
+	"runtime":        CodeFailure,
+	"lint":           CodeFailure,
+	"test":           TestFailure,
+	"tests":          TestFailure,
+	"testing":        TestFailure,
+	"unittest":       TestFailure,
+	"integration":    TestFailure,
+	"assertion":      TestFailure,
+	"dependency":     DependencyFailure,
+	"dependencies":   DependencyFailure,
+	"deps":           DependencyFailure,
+	"dep":            DependencyFailure,
+	"package":        DependencyFailure,
+	"module":         DependencyFailure,
+	"build":          BuildFailure,
+	"compile":        BuildFailure,
+	"compilation":    BuildFailure,
+	"compiler":       BuildFailure,
+	"deployment":     DeploymentFailure,
+	"deploy":         DeploymentFailure,
+	"release":        DeploymentFailure,
+	"publish":        DeploymentFailure,
+	"configuration":  ConfigurationFailure,
+	"config":         ConfigurationFailure,
+	"settings":       ConfigurationFailure,
+	"workflow":       ConfigurationFailure,
+	"security":       SecurityFailure,
+	"vulnerability":  SecurityFailure,
+	"vuln":           SecurityFailure,
+	"cve":            SecurityFailure,
+	"unknown":        UnknownFailure,
+}
+
+// fixTypeAliases maps normalized fix types, after dropping a "fix" suffix, to their constant
+var fixTypeAliases = map[string]FixType{
+	"code":           CodeFix,
+	"source":         CodeFix,
+	"logic":          CodeFix,
+	"codechange":     CodeFix,
+	"configuration":  ConfigurationFix,
+	"config":         ConfigurationFix,
+	"settings":       ConfigurationFix,
+	"dependency":     DependencyFix,
+	"dependencies":   DependencyFix,
+	"deps":           DependencyFix,
+	"package":        DependencyFix,
+	"upgrade":        DependencyFix,
+	"versionbump":    DependencyFix,
+	"infrastructure": InfrastructureFix,
+	"infra":          InfrastructureFix,
+	"environment":    InfrastructureFix,
+	"workflow":       WorkflowFix,
+	"ci":             WorkflowFix,
+	"pipeline":       WorkflowFix,
+	"githubactions":  WorkflowFix,
+	"actions":        WorkflowFix,
+	"test":           TestFix,
+	"tests":          TestFix,
+	"testing":        TestFix,
+	"security":       SecurityFix,
+	"vulnerability":  SecurityFix,
+	"unknown":        UnknownFix,
+}
+
+// severityAliases maps normalized severities, including GitHub advisory ones, to their constant
+var severityAliases = map[string]SeverityLevel{
+	"critical": Critical,
+	"blocker":  Critical,
+	"severe":   Critical,
+	"high":     High,
+	"major":    High,
+	"medium":   Medium,
+	"moderate": Medium,
+	"med":      Medium,
+	"normal":   Medium,
+	"low":      Low,
+	"minor":    Low,
+	"trivial":  Low,
+	"info":     Low,
+	"unknown":  UnknownSeverity,
+}
+
+// categoryAliases maps normalized failure categories to their constant
+var categoryAliases = map[string]FailureCategory{
+	"transient":        Transient,
+	"temporary":        Transient,
+	"transitory":       Transient,
+	"retryable":        Transient,
+	"systematic":       Systematic,
+	"systemic":         Systematic,
+	"deterministic":    Systematic,
+	"persistent":       Systematic,
+	"environmental":    Environmental,
+	"environment":      Environmental,
+	"infrastructure":   Environmental,
+	"infra":            Environmental,
+	"flaky":            Flaky,
+	"flakey":           Flaky,
+	"flake":            Flaky,
+	"intermittent":     Flaky,
+	"nondeterministic": Flaky,
+	"unknown":          UnknownCategory,
+}
+
+// normalizeClassification lowercases a value and drops its separators, so "Unit Test",
+// "unit-test", "unit_test" and "UnitTest" compare equal
+func normalizeClassification(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '_', '.', '/':
+			return -1
+		}
+		return r
+	}, strings.ToLower(value))
+}
+
+// lookupClassification finds a value in an alias table, also without one of the given
+// suffixes so "dependency_failure" and "DependencyFailure" match "dependency"
+func lookupClassification[T any](value string, aliases map[string]T, suffixes ...string) (T, bool) {
+	name := normalizeClassification(value)
+	if parsed, ok := aliases[name]; ok {
+		return parsed, true
+	}
+	for _, suffix := range suffixes {
+		if trimmed := strings.TrimSuffix(name, suffix); trimmed != name {
+			if parsed, ok := aliases[trimmed]; ok {
+				return parsed, true
+			}
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// ParseFailureType returns the failure type a value names, case-insensitively and accepting
+// common aliases. Unknown values return UnknownFailure and an error.
+func ParseFailureType(value string) (FailureType, error) {
+	if failureType, ok := lookupClassification(value, failureTypeAliases, "failure", "error"); ok {
+		return failureType, nil
+	}
+	return UnknownFailure, fmt.Errorf("unknown failure type %q", value)
+}
+
+// ParseFixType returns the fix type a value names, case-insensitively and accepting common
+// aliases. Unknown values return UnknownFix and an error.
+func ParseFixType(value string) (FixType, error) {
+	if fixType, ok := lookupClassification(value, fixTypeAliases, "fix"); ok {
+		return fixType, nil
+	}
+	return UnknownFix, fmt.Errorf("unknown fix type %q", value)
+}
+
+// ParseSeverity returns the severity level a value names, case-insensitively and accepting
+// common aliases. Unknown values return UnknownSeverity and an error.
+func ParseSeverity(value string) (SeverityLevel, error) {
+	if severity, ok := lookupClassification(value, severityAliases, "severity", "priority"); ok {
+		return severity, nil
+	}
+	return UnknownSeverity, fmt.Errorf("unknown severity %q", value)
+}
+
+// ParseCategory returns the failure category a value names, case-insensitively and accepting
+// common aliases. Unknown values return UnknownCategory and an error.
+func ParseCategory(value string) (FailureCategory, error) {
+	if category, ok := lookupClassification(value, categoryAliases, "failure", "error"); ok {
+		return category, nil
+	}
+	return UnknownCategory, fmt.Errorf("unknown failure category %q", value)
+}
+
+// unmarshalClassification decodes a JSON string with parse. Empty values stay empty and
+// unknown ones decode to the unknown value, so stored analyses always load.
+func unmarshalClassification[T ~string](data []byte, parse func(string) (T, error)) (T, error) {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", nil
+	}
+	parsed, _ := parse(value)
+	return parsed, nil
+}
+
+// UnmarshalJSON normalizes decoded failure types
+func (f *FailureType) UnmarshalJSON(data []byte) error {
+	parsed, err := unmarshalClassification(data, ParseFailureType)
+	if err != nil {
+		return err
+	}
+	*f = parsed
+	return nil
+}
+
+// UnmarshalJSON normalizes decoded fix types
+func (f *FixType) UnmarshalJSON(data []byte) error {
+	parsed, err := unmarshalClassification(data, ParseFixType)
+	if err != nil {
+		return err
+	}
+	*f = parsed
+	return nil
+}
+
+// UnmarshalJSON normalizes decoded severity levels
+func (s *SeverityLevel) UnmarshalJSON(data []byte) error {
+	parsed, err := unmarshalClassification(data, ParseSeverity)
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// UnmarshalJSON normalizes decoded failure categories
+func (c *FailureCategory) UnmarshalJSON(data []byte) error {
+	parsed, err := unmarshalClassification(data, ParseCategory)
+	if err != nil {
+		return err
+	}
+	*c = parsed
+	return nil
+}
@@ -0,0 +1,120 @@
+package autofix
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// spellings returns the ways an LLM writes a normalized alias: as is, upper case, title
+// case, padded and with the type's suffix
+func spellings(alias, suffix string) []string {
+	title := strings.ToUpper(alias[:1]) + alias[1:]
+	return []string{
+		alias,
+		strings.ToUpper(alias),
+		title,
+		" " + alias + " ",
+		alias + "_" + suffix,
+		alias + "-" + strings.ToUpper(suffix),
+		title + strings.ToUpper(suffix[:1]) + suffix[1:],
+	}
+}
+
+// TestParseFailureType tests every failure type alias and its spellings
+func TestParseFailureType(t *testing.T) {
+	for alias, expected := range failureTypeAliases {
+		for _, value := range spellings(alias, "failure") {
+			parsed, err := ParseFailureType(value)
+			require.NoError(t, err, value)
+			assert.Equal(t, expected, parsed, value)
+		}
+	}
+	for _, failureType := range []FailureType{InfrastructureFailure, CodeFailure, TestFailure, DependencyFailure,
+		BuildFailure, DeploymentFailure, ConfigurationFailure, SecurityFailure, UnknownFailure} {
+		parsed, err := ParseFailureType(string(failureType))
+		require.NoError(t, err)
+		assert.Equal(t, failureType, parsed, "constants parse to themselves")
+		parsed, err = ParseFailureType(failureType.DisplayName())
+		require.NoError(t, err)
+		assert.Equal(t, failureType, parsed, "display names parse back")
+	}
+	for value, expected := range map[string]FailureType{
+		"runtime_error": CodeFailure,
+		"Unit Test":     TestFailure,
+		"unit-test":     TestFailure,
+		"unit_test":     TestFailure,
+	} {
+		parsed, err := ParseFailureType(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, parsed, value)
+	}
+
+	for _, value := range []string{"", "cosmic rays", "failure", "dependency_fix"} {
+		parsed, err := ParseFailureType(value)
+		assert.ErrorContains(t, err, "unknown failure type", value)
+		assert.Equal(t, UnknownFailure, parsed, value)
+	}
+}
+
+// TestParseFixType tests every fix type alias and its spellings
+func TestParseFixType(t *testing.T) {
+	for alias, expected := range fixTypeAliases {
+		for _, value := range spellings(alias, "fix") {
+			parsed, err := ParseFixType(value)
+			require.NoError(t, err, value)
+			assert.Equal(t, expected, parsed, value)
+		}
+	}
+	for _, fixType := range []FixType{CodeFix, ConfigurationFix, DependencyFix, InfrastructureFix,
+		WorkflowFix, TestFix, SecurityFix, UnknownFix} {
+		parsed, err := ParseFixType(string(fixType))
+		require.NoError(t, err)
+		assert.Equal(t, fixType, parsed)
+	}
+
+	for _, value := range []string{"", "rewrite everything", "fix", "code_failure"} {
+		parsed, err := ParseFixType(value)
+		assert.ErrorContains(t, err, "unknown fix type", value)
+		assert.Equal(t, UnknownFix, parsed, value)
+	}
+}
+
+// TestParseSeverity tests every severity alias and its spellings
+func TestParseSeverity(t *testing.T) {
+	for alias, expected := range severityAliases {
+		for _, value := range spellings(alias, "severity") {
+			parsed, err := ParseSeverity(value)
+			require.NoError(t, err, value)
+			assert.Equal(t, expected, parsed, value)
+		}
+	}
+	parsed, err := ParseSeverity("high priority")
+	require.NoError(t, err)
+	assert.Equal(t, High, parsed)
+
+	for _, value := range []string{"", "apocalyptic", "9"} {
+		parsed, err := ParseSeverity(value)
+		assert.ErrorContains(t, err, "unknown severity", value)
+		assert.Equal(t, UnknownSeverity, parsed, value)
+	}
+}
+
+// TestParseCategory tests every failure category alias and its spellings
+func TestParseCategory(t *testing.T) {
+	for alias, expected := range categoryAliases {
+		for _, value := range spellings(alias, "failure") {
+			parsed, err := ParseCategory(value)
+			require.NoError(t, err, value)
+			assert.Equal(t, expected, parsed, value)
+		}
+	}
+
+	for _, value := range []string{"", "dependency", "sometimes"} {
+		parsed, err := ParseCategory(value)
+		assert.ErrorContains(t, err, "unknown failure category", value)
+		assert.Equal(t, UnknownCategory, parsed, value)
+	}
+}
@@ -0,0 +1,14 @@
+// Package autofix holds the parts of the dagger-autofix agent that other Go programs can use
+// without Dagger, GitHub or the dagger-autofix CLI.
+//
+// It holds the failure taxonomy the agent classifies failures with, the log utilities that
+// pick out the lines reporting a failure and the parser of the agent's LLM failure analyses.
+// The agent delegates to this package for all three, so an importer classifies failures as
+// the agent does. The package depends on the standard library only:
+//
+//	errorLines := autofix.ExtractErrorLines(logText)
+//	analysis, err := autofix.ParseAnalysis(llmResponse, nil)
+//
+// Prompting the LLM, fetching workflow logs, the error pattern database, generating and
+// validating fixes and opening pull requests are not part of this package.
+package autofix
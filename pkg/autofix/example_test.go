@@ -0,0 +1,39 @@
+package autofix_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tosin2013/dagger-autofix/pkg/autofix"
+)
+
+func ExampleParseAnalysis() {
+	log := "FAIL src/sum.test.js\n  Expected: 3\n  Received: \"12\"\nnpm ERR! Exit status 1\n"
+	errorLines := autofix.ExtractErrorLines(log)
+
+	// A stand-in for a call to an LLM provider with a prompt of the importer's own
+	complete := func(prompt string) string {
+		return `{
+			"root_cause": "sum concatenates its arguments as strings",
+			"description": "The sum test expects 3 but sum returns \"12\"",
+			"classification": {"type": "Test_Failure", "severity": "medium", "category": "systematic", "confidence": 0.85},
+			"affected_files": ["src/sum.js"]
+		}`
+	}
+	response := complete("Why did this build fail?\n" + strings.Join(errorLines, "\n"))
+
+	analysis, err := autofix.ParseAnalysis(response, nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(analysis.RootCause)
+	fmt.Println(analysis.Classification.Type, analysis.Classification.Confidence)
+	fmt.Println(analysis.AffectedFiles)
+	fmt.Println(errorLines)
+	// Output:
+	// sum concatenates its arguments as strings
+	// test 0.85
+	// [src/sum.js]
+	// [FAIL src/sum.test.js npm ERR! Exit status 1]
+}
@@ -0,0 +1,78 @@
+package autofix
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+const (
+	// MaxLogSize is the largest log that is analyzed, in bytes
+	MaxLogSize = 10 * 1024 * 1024
+	// MaxErrorLines is how many error lines are extracted from a log
+	MaxErrorLines = 50
+)
+
+// ErrInvalidLog is returned for logs that are empty or over MaxLogSize
+var ErrInvalidLog = errors.New("invalid log")
+
+var (
+	// ansiEscape matches the color codes CI systems write into their logs
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+	// logTimestamp matches the timestamp GitHub Actions and other CI systems prefix lines with
+	logTimestamp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?Z\s+`)
+	// logErrorLine matches the lines of build tools, test runners and package managers that
+	// report a failure
+	logErrorLine = regexp.MustCompile(`(?i)\berr(?:or)?!?\b|\bfail(?:ed|ure|ing)?\b|\bfatal\b|\bpanic:|\bexception\b|traceback|cannot find|not found|undefined:|✖|✗|exit(?:ed with)? (?:status|code) [1-9]`)
+	// logSummaryLine matches summaries reporting there were no errors, e.g. "0 errors"
+	logSummaryLine = regexp.MustCompile(`(?i)\b(?:0|no) (?:errors?|failures?|failed)\b`)
+)
+
+// IsErrorLine tells whether a log line looks like it reports a failure
+func IsErrorLine(line string) bool {
+	return logErrorLine.MatchString(line) && !logSummaryLine.MatchString(line)
+}
+
+// ExtractErrorLines returns the distinct lines of a log that look like they report the
+// failure, in log order and without color codes or timestamps, at most MaxErrorLines
+func ExtractErrorLines(logText string) []string {
+	var lines []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(logText, "\n") {
+		line = strings.TrimSpace(logTimestamp.ReplaceAllString(ansiEscape.ReplaceAllString(strings.TrimRight(line, "\r"), ""), ""))
+		if line == "" || seen[line] || !IsErrorLine(line) {
+			continue
+		}
+		seen[line] = true
+		lines = append(lines, line)
+		if len(lines) == MaxErrorLines {
+			break
+		}
+	}
+	return lines
+}
+
+// ReadLog reads a log to analyze, refusing logs over MaxLogSize
+func ReadLog(r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxLogSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read log: %w", err)
+	}
+	if len(data) > MaxLogSize {
+		return "", fmt.Errorf("%w: log exceeds the maximum of %d bytes", ErrInvalidLog, MaxLogSize)
+	}
+	return string(data), nil
+}
+
+// CheckLog returns ErrInvalidLog for a log that is empty or over MaxLogSize
+func CheckLog(logText string) error {
+	if strings.TrimSpace(logText) == "" {
+		return fmt.Errorf("%w: log text is empty", ErrInvalidLog)
+	}
+	if len(logText) > MaxLogSize {
+		return fmt.Errorf("%w: log exceeds the maximum of %d bytes", ErrInvalidLog, MaxLogSize)
+	}
+	return nil
+}
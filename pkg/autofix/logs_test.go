@@ -0,0 +1,66 @@
+package autofix
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// npmLog is a failing `npm test` run as a CI system other than GitHub Actions logs it
+const npmLog = "2024-05-01T10:00:00.000Z > widgets@1.0.0 test\n" +
+	"2024-05-01T10:00:00.100Z > jest\n" +
+	"\n" +
+	"\x1b[31mFAIL\x1b[39m src/sum.test.js\n" +
+	"  ● sum › adds two numbers\n" +
+	"\n" +
+	"    expect(received).toBe(expected) // Object.is equality\n" +
+	"\n" +
+	"    Expected: 3\n" +
+	"    Received: \"12\"\n" +
+	"\n" +
+	"PASS src/format.test.js\n" +
+	"Tests:       1 failed, 4 passed, 5 total\n" +
+	"Found 0 errors in the type check\n" +
+	"npm ERR! code ELIFECYCLE\n" +
+	"npm ERR! errno 1\n" +
+	"npm ERR! widgets@1.0.0 test: `jest`\n" +
+	"npm ERR! Exit status 1\n" +
+	"npm ERR! Exit status 1\n" +
+	"Error: Process completed with exit code 1.\n"
+
+// TestExtractErrorLines tests picking the lines reporting a failure out of a raw log
+func TestExtractErrorLines(t *testing.T) {
+	assert.Equal(t, []string{
+		"FAIL src/sum.test.js",
+		"Tests:       1 failed, 4 passed, 5 total",
+		"npm ERR! code ELIFECYCLE",
+		"npm ERR! errno 1",
+		"npm ERR! widgets@1.0.0 test: `jest`",
+		"npm ERR! Exit status 1",
+		"Error: Process completed with exit code 1.",
+	}, ExtractErrorLines(npmLog))
+
+	assert.Empty(t, ExtractErrorLines("Compiled successfully\nNo errors found\n"))
+	assert.Len(t, ExtractErrorLines(strings.Repeat("error: line\n", 5)+strings.Repeat("x", 10)), 1)
+
+	var many strings.Builder
+	for i := 0; i < MaxErrorLines+10; i++ {
+		many.WriteString("error " + strings.Repeat("a", i) + "\n")
+	}
+	assert.Len(t, ExtractErrorLines(many.String()), MaxErrorLines)
+}
+
+// TestReadLog tests reading logs and rejecting empty and oversized ones
+func TestReadLog(t *testing.T) {
+	logText, err := ReadLog(strings.NewReader(npmLog))
+	require.NoError(t, err)
+	assert.Equal(t, npmLog, logText)
+	assert.NoError(t, CheckLog(logText))
+
+	_, err = ReadLog(strings.NewReader(strings.Repeat("x", MaxLogSize+1)))
+	assert.ErrorIs(t, err, ErrInvalidLog)
+	assert.ErrorIs(t, CheckLog(" \n\t"), ErrInvalidLog)
+	assert.ErrorIs(t, CheckLog(strings.Repeat("x", MaxLogSize+1)), ErrInvalidLog)
+}
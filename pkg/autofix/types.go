@@ -0,0 +1,98 @@
+package autofix
+
+// RepositoryContext provides context about the repository
+type RepositoryContext struct {
+	Owner         string `json:"owner"`
+	Name          string `json:"name"`
+	DefaultBranch string `json:"default_branch"`
+	Language      string `json:"language"`
+	Framework     string `json:"framework"`
+}
+
+// FailureClassification categorizes the type and severity of a failure
+type FailureClassification struct {
+	Type       FailureType     `json:"type"`
+	Severity   SeverityLevel   `json:"severity"`
+	Category   FailureCategory `json:"category"`
+	Confidence float64         `json:"confidence"`
+	Tags       []string        `json:"tags"`
+}
+
+// FailureType represents different types of CI/CD failures
+type FailureType string
+
+const (
+	InfrastructureFailure FailureType = "infrastructure"
+	CodeFailure           FailureType = "code"
+	TestFailure           FailureType = "test"
+	DependencyFailure     FailureType = "dependency"
+	BuildFailure          FailureType = "build"
+	DeploymentFailure     FailureType = "deployment"
+	ConfigurationFailure  FailureType = "configuration"
+	SecurityFailure       FailureType = "security"
+)
+
+// DisplayName returns the display name for the failure type
+func (f FailureType) DisplayName() string {
+	switch f {
+	case InfrastructureFailure:
+		return "InfrastructureFailure"
+	case CodeFailure:
+		return "CodeFailure"
+	case TestFailure:
+		return "TestFailure"
+	case DependencyFailure:
+		return "DependencyFailure"
+	case BuildFailure:
+		return "BuildFailure"
+	case DeploymentFailure:
+		return "DeploymentFailure"
+	case ConfigurationFailure:
+		return "ConfigurationFailure"
+	case SecurityFailure:
+		return "SecurityFailure"
+	default:
+		return string(f)
+	}
+}
+
+// SeverityLevel represents the severity of a failure
+type SeverityLevel string
+
+const (
+	Critical SeverityLevel = "critical"
+	High     SeverityLevel = "high"
+	Medium   SeverityLevel = "medium"
+	Low      SeverityLevel = "low"
+)
+
+// FailureCategory represents the nature of the failure
+type FailureCategory string
+
+const (
+	Transient     FailureCategory = "transient"     // Temporary issues
+	Systematic    FailureCategory = "systematic"    // Code/config issues
+	Environmental FailureCategory = "environmental" // Infrastructure issues
+	Flaky         FailureCategory = "flaky"         // Non-deterministic issues
+)
+
+// ErrorPattern represents a detected error pattern
+type ErrorPattern struct {
+	Pattern     string  `json:"pattern"`
+	Description string  `json:"description"`
+	Confidence  float64 `json:"confidence"`
+	Location    string  `json:"location"` // file:line or job:step
+}
+
+// FixType represents different types of fixes
+type FixType string
+
+const (
+	CodeFix           FixType = "code"
+	ConfigurationFix  FixType = "configuration"
+	DependencyFix     FixType = "dependency"
+	InfrastructureFix FixType = "infrastructure"
+	WorkflowFix       FixType = "workflow"
+	TestFix           FixType = "test"
+	SecurityFix       FixType = "security"
+)
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// PRCommentMode decides how fixes for failed pull_request runs are proposed
+type PRCommentMode string
+
+const (
+	// PRCommentReview comments on the failing pull request, as a review suggestion when the
+	// fix is a small single-hunk change to lines the pull request changes
+	PRCommentReview PRCommentMode = "review"
+	// PRCommentConversation always posts a regular comment on the failing pull request
+	PRCommentConversation PRCommentMode = "comment"
+	// PRCommentOff opens a fix pull request as for any other failure
+	PRCommentOff PRCommentMode = "off"
+)
+
+// pullRequestEvent is the event of workflow runs testing a pull request
+const pullRequestEvent = "pull_request"
+
+const (
+	// maxPRContextDiffBytes is how much of a pull request's diff the failure context keeps
+	maxPRContextDiffBytes = 12000
+	// maxSuggestionLines is the most lines a review suggestion may replace or add
+	maxSuggestionLines = 20
+)
+
+func validatePRCommentMode(mode PRCommentMode) error {
+	switch mode {
+	case "", PRCommentReview, PRCommentConversation, PRCommentOff:
+		return nil
+	default:
+		return fmt.Errorf("unsupported PR comment mode %q (expected review, comment or off)", mode)
+	}
+}
+
+func (m *DaggerAutofix) prCommentMode() PRCommentMode {
+	if m.PRCommentMode == "" {
+		return PRCommentReview
+	}
+	return m.PRCommentMode
+}
+
+// pullRequestContext resolves the pull request a pull_request run tested and returns its
+// number and redacted diff. Failing to resolve it only loses the diff, and the fix is then
+// proposed in a new pull request.
+func (m *DaggerAutofix) pullRequestContext(ctx context.Context, run *WorkflowRun) (int, string) {
+	if m.prCommentMode() == PRCommentOff || run.Event != pullRequestEvent || run.CommitSHA == "" {
+		return 0, ""
+	}
+	logger := m.logger.WithFields(logrus.Fields{"run_id": run.ID, "commit_sha": run.CommitSHA})
+
+	pr, err := m.githubClient.FindPullRequestForCommit(ctx, run.CommitSHA)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to find the pull request of the run, continuing without it")
+		return 0, ""
+	}
+	if pr == nil {
+		logger.Warn("No open pull request contains the run's commit, continuing without it")
+		return 0, ""
+	}
+	files, err := m.githubClient.ListPullRequestFiles(ctx, pr.Number)
+	if err != nil {
+		logger.WithError(err).WithField("pr_number", pr.Number).Warn("Failed to get the pull request's changes, continuing without them")
+		return pr.Number, ""
+	}
+	return pr.Number, m.redactor.Redact(formatPRDiff(files))
+}
+
+// formatPRDiff joins the patches of a pull request's files into one diff, cut after
+// maxPRContextDiffBytes
+func formatPRDiff(files []FileChange) string {
+	var diff strings.Builder
+	for _, file := range files {
+		fmt.Fprintf(&diff, "diff --git a/%s b/%s\n", file.Filename, file.Filename)
+		if file.Patch == "" {
+			diff.WriteString("(no textual changes)\n")
+			continue
+		}
+		diff.WriteString(strings.TrimSuffix(file.Patch, "\n") + "\n")
+	}
+	text, omitted := truncateDiff(diff.String(), maxPRContextDiffBytes)
+	if omitted > 0 {
+		text += fmt.Sprintf("[%d more lines not shown]\n", omitted)
+	}
+	return text
+}
+
+// writePRDiffPrompt adds the changes of the pull request a run tested to a prompt
+func writePRDiffPrompt(prompt *strings.Builder, ctx FailureContext) {
+	if ctx.PRDiff == "" {
+		return
+	}
+	prompt.WriteString("## Pull Request Changes\n\n")
+	prompt.WriteString(fmt.Sprintf("The run tested pull request #%d. It makes these changes, which most likely caused the failure:\n\n", ctx.PRNumber))
+	fence := codeFence(ctx.PRDiff)
+	prompt.WriteString(fence + "diff\n" + ctx.PRDiff + fence + "\n\n")
+}
+
+// hunkHeader matches a hunk header, capturing the start and length of its new side
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// prDiffLines returns, for each file of a diff formatted by formatPRDiff, the ranges of new
+// lines its hunks cover. Only those lines can carry review comments.
+func prDiffLines(diff string) map[string][][2]int {
+	ranges := make(map[string][][2]int)
+	var file string
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "diff --git ") {
+			file = ""
+			if i := strings.LastIndex(line, " b/"); i >= 0 {
+				file = line[i+len(" b/"):]
+			}
+			continue
+		}
+		match := hunkHeader.FindStringSubmatch(line)
+		if match == nil || file == "" {
+			continue
+		}
+		start, _ := strconv.Atoi(match[1])
+		count := 1
+		if match[2] != "" {
+			count, _ = strconv.Atoi(match[2])
+		}
+		if count > 0 {
+			ranges[file] = append(ranges[file], [2]int{start, start + count - 1})
+		}
+	}
+	return ranges
+}
+
+// prSuggestion is a fix small enough to propose as a review suggestion: Replacement replaces
+// the lines StartLine to Line of Path
+type prSuggestion struct {
+	Path        string
+	StartLine   int
+	Line        int
+	Replacement string
+}
+
+// suggestFix returns the fix as a review suggestion on the pull request, or nil when it is
+// not a single small modification of lines the pull request changes
+func (m *DaggerAutofix) suggestFix(ctx context.Context, analysis *FailureAnalysisResult, fix *ProposedFix) *prSuggestion {
+	if fix == nil || len(fix.Changes) != 1 {
+		return nil
+	}
+	change := fix.Changes[0]
+	if (change.Operation != "" && change.Operation != ChangeOperationModify) || change.OldContent == "" ||
+		isBinaryContent(change.OldContent) || isBinaryContent(change.NewContent) {
+		return nil
+	}
+
+	// The change is located in the file as the run tested it
+	run := analysis.Context.WorkflowRun
+	content, exists, err := m.githubClient.GetFileContent(ctx, change.FilePath, run.CommitSHA)
+	if err != nil || !exists {
+		return nil
+	}
+	at := strings.Index(content, change.OldContent)
+	if at < 0 || strings.Count(content, change.OldContent) != 1 || (at > 0 && content[at-1] != '\n') {
+		return nil
+	}
+	offset := strings.Count(content[:at], "\n")
+
+	suggestion := lineSuggestion(lineEdits(splitLines(change.OldContent), splitLines(change.NewContent)))
+	if suggestion == nil {
+		return nil
+	}
+	suggestion.Path = change.FilePath
+	suggestion.StartLine += offset
+	suggestion.Line += offset
+
+	for _, lines := range prDiffLines(analysis.Context.PRDiff)[change.FilePath] {
+		if lines[0] <= suggestion.StartLine && suggestion.Line <= lines[1] {
+			return suggestion
+		}
+	}
+	return nil
+}
+
+// lineSuggestion returns the 1-based old lines a single-hunk edit script replaces and their
+// replacement, or nil when the edits span several hunks or too many lines. Pure insertions
+// also replace the line before them, since suggestions replace at least one line.
+func lineSuggestion(edits []diffLine) *prSuggestion {
+	hunks := diffHunks(edits, 0)
+	if hunks == "" || strings.Count("\n"+hunks, "\n@@ -") != 1 {
+		return nil
+	}
+	first, last := -1, -1
+	for i, edit := range edits {
+		if edit.kind != ' ' {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	removed := 0
+	for _, edit := range edits[first : last+1] {
+		if edit.kind == '-' {
+			removed++
+		}
+	}
+	if removed == 0 {
+		if first > 0 {
+			first--
+		} else {
+			last++
+		}
+	}
+
+	start := 0
+	for _, edit := range edits[:first] {
+		if edit.kind != '+' {
+			start++
+		}
+	}
+	var oldCount, newCount int
+	var replacement strings.Builder
+	for _, edit := range edits[first : last+1] {
+		if edit.kind != '+' {
+			oldCount++
+		}
+		if edit.kind != '-' {
+			newCount++
+			replacement.WriteString(edit.text)
+		}
+	}
+	if oldCount > maxSuggestionLines || newCount > maxSuggestionLines {
+		return nil
+	}
+	return &prSuggestion{
+		StartLine:   start + 1,
+		Line:        start + oldCount,
+		Replacement: strings.TrimSuffix(replacement.String(), "\n"),
+	}
+}
+
+// commentFixOnPR proposes a fix on the pull request the failed run tested instead of opening
+// a new one: as a review suggestion when possible, or else as a regular comment. It returns
+// which of the two it posted.
+func (m *DaggerAutofix) commentFixOnPR(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult) (string, error) {
+	number := analysis.Context.PRNumber
+	logger := m.logger.WithFields(logrus.Fields{"pr_number": number, "fix_id": fix.Fix.ID})
+
+	if m.prCommentMode() == PRCommentReview {
+		if suggestion := m.suggestFix(ctx, analysis, fix.Fix); suggestion != nil {
+			comment := ReviewComment{
+				Body:      formatPRFixComment(analysis, fix, suggestion, m.settings(ctx).MinCoverage),
+				Path:      suggestion.Path,
+				CommitSHA: analysis.Context.WorkflowRun.CommitSHA,
+				StartLine: suggestion.StartLine,
+				Line:      suggestion.Line,
+			}
+			err := m.githubClient.CreateReviewComment(ctx, number, comment)
+			if err == nil {
+				logger.Info("Suggested the fix on the pull request")
+				return "review_comment", nil
+			}
+			logger.WithError(err).Warn("Failed to post the review suggestion, commenting instead")
+		}
+	}
+
+	if err := m.githubClient.AddPullRequestComment(ctx, number, formatPRFixComment(analysis, fix, nil, m.settings(ctx).MinCoverage)); err != nil {
+		return "", err
+	}
+	logger.Info("Commented the fix on the pull request")
+	return "comment", nil
+}
+
+// formatPRFixComment renders the analysis, the fix and its validation for the failing pull
+// request. The fix is a suggestion block when suggestion is set and diffs otherwise.
+func formatPRFixComment(analysis *FailureAnalysisResult, fix *FixValidationResult, suggestion *prSuggestion, minCoverage int) string {
+	return formatFixComment("Automated Fix Suggestion",
+		"The workflow run failed on this pull request. Here is what the analysis found and a validated fix.",
+		analysis, fix, suggestion, minCoverage)
+}
+
+// formatFixComment renders a fix comment on a pull request under title, starting with intro
+func formatFixComment(title, intro string, analysis *FailureAnalysisResult, fix *FixValidationResult, suggestion *prSuggestion, minCoverage int) string {
+	proposed := orEmptyFix(fix.Fix)
+	var body strings.Builder
+
+	body.WriteString("## 🤖 " + title + "\n\n")
+	body.WriteString(intro + "\n\n")
+	writeFailureSummary(&body, analysis)
+
+	body.WriteString("## 🔧 Proposed Fix\n\n")
+	body.WriteString(fmt.Sprintf("**Fix Type**: %s\n", valueOr(string(proposed.Type), notAvailable)))
+	body.WriteString(fmt.Sprintf("**Fix Confidence**: %s\n", formatConfidence(proposed.Confidence)))
+	body.WriteString(fmt.Sprintf("**Description**: %s\n\n", valueOr(proposed.Description, notAvailable)))
+	if proposed.Rationale != "" {
+		body.WriteString(fmt.Sprintf("**Rationale**: %s\n\n", proposed.Rationale))
+	}
+	if suggestion != nil {
+		fence := codeFence(suggestion.Replacement)
+		body.WriteString(fence + "suggestion\n" + suggestion.Replacement + "\n" + fence + "\n\n")
+	} else {
+		caser := cases.Title(language.English)
+		for _, change := range proposed.Changes {
+			line := fmt.Sprintf("- **%s**: %s", caser.String(valueOr(string(change.Operation), "change")), valueOr(change.displayPath(), notAvailable))
+			if change.Explanation != "" {
+				line += fmt.Sprintf(" `%s`", change.Explanation)
+			}
+			body.WriteString(line + "\n")
+		}
+		body.WriteString("\n")
+		writeChangeDiffs(&body, proposed.Changes)
+	}
+
+	writeValidationResults(&body, fix, proposed, minCoverage)
+
+	body.WriteString("## 🔍 Metadata\n\n")
+	body.WriteString(fmt.Sprintf("**Analysis ID**: %s\n", codeOr(analysis.ID)))
+	body.WriteString(fmt.Sprintf("**LLM Provider**: %s\n\n", valueOr(string(analysis.LLMProvider), notAvailable)))
+
+	body.WriteString("---\n")
+	body.WriteString("*This comment was automatically generated by the GitHub Actions Auto-Fix Agent*\n")
+	return body.String()
+}
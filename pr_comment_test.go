@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const parserSource = "package parser\n\nimport \"strconv\"\n\nfunc Parse(s string) (int, error) {\n\treturn strconv.Atoi(s)\n}\n"
+
+// parserPRPatch is the pull request's patch of parser/parser.go, adding lines 3 to 7
+const parserPRPatch = "@@ -1,2 +1,7 @@\n package parser\n \n+import \"strconv\"\n+\n+func Parse(s string) (int, error) {\n+\treturn strconv.Atoi(s)\n+}"
+
+// prTriggeredAutofix returns an agent whose failed run tested pull request #42, which adds
+// Parse, and whose fix makes Parse reject empty input
+func prTriggeredAutofix(t *testing.T, prFixes *[]*FixValidationResult) (*DaggerAutofix, *mockGitHub) {
+	useTestMetrics(t)
+	m := fixtureAutofix(prFixes).WithSourceCommit("head123")
+	gh := m.githubClient.(*mockGitHub)
+	gh.getWorkflowRunFunc = func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+		return &WorkflowRun{ID: runID, CommitSHA: "head123", Branch: "feature", Event: pullRequestEvent}, nil
+	}
+	gh.findPRForCommitFunc = func(ctx context.Context, sha string) (*PullRequest, error) {
+		assert.Equal(t, "head123", sha)
+		return &PullRequest{Number: 42, Branch: "feature", CommitSHA: sha, State: "open"}, nil
+	}
+	gh.listPRFilesFunc = func(ctx context.Context, number int) ([]FileChange, error) {
+		assert.Equal(t, 42, number)
+		return []FileChange{{Filename: "parser/parser.go", Status: "modified", Patch: parserPRPatch, Additions: 5}}, nil
+	}
+	gh.getFileContentFunc = func(ctx context.Context, path, ref string) (string, bool, error) {
+		if path == RepoConfigPath {
+			return "", false, nil
+		}
+		assert.Equal(t, "head123", ref)
+		return parserSource, path == "parser/parser.go", nil
+	}
+	m.failureEngine.(*mockFailureAnalysisEngine).generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+		fix := parserFix()
+		fix.Confidence = 0.9
+		fix.Changes[0].OldContent = "\treturn strconv.Atoi(s)\n"
+		fix.Changes[0].NewContent = "\tif s == \"\" {\n\t\treturn 0, errEmpty\n\t}\n\treturn strconv.Atoi(s)\n"
+		return []*ProposedFix{fix}, nil
+	}
+	return m, gh
+}
+
+// TestAutoFixPRTriggeredFailure tests that fixes for failed pull_request runs are commented
+// on the pull request instead of opened as new pull requests
+func TestAutoFixPRTriggeredFailure(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ReviewSuggestion", func(t *testing.T) {
+		var prFixes []*FixValidationResult
+		m, gh := prTriggeredAutofix(t, &prFixes)
+		var comments []ReviewComment
+		gh.createReviewCommentFunc = func(ctx context.Context, number int, comment ReviewComment) error {
+			assert.Equal(t, 42, number)
+			comments = append(comments, comment)
+			return nil
+		}
+
+		result, err := m.AutoFix(ctx, 7)
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+		assert.Empty(t, prFixes, "no fix pull request is opened")
+		assert.Nil(t, result.PullRequest)
+		assert.Equal(t, 42, result.Metadata["pr_number"])
+		assert.Equal(t, "review_comment", result.Metadata["pr_comment"])
+		assert.NotContains(t, gh.calls, "CreateBranch")
+		assert.NotContains(t, gh.calls, "AddPullRequestComment")
+
+		assert.Equal(t, 42, result.Analysis.Context.PRNumber)
+		assert.Contains(t, result.Analysis.Context.PRDiff, "diff --git a/parser/parser.go b/parser/parser.go\n@@ -1,2 +1,7 @@\n")
+
+		require.Len(t, comments, 1)
+		comment := comments[0]
+		assert.Equal(t, "parser/parser.go", comment.Path)
+		assert.Equal(t, "head123", comment.CommitSHA)
+		assert.Equal(t, 6, comment.StartLine)
+		assert.Equal(t, 6, comment.Line)
+		assert.Contains(t, comment.Body, "## 🤖 Automated Fix Suggestion")
+		assert.Contains(t, comment.Body, "## 📊 Failure Analysis")
+		assert.Contains(t, comment.Body, "```suggestion\n\tif s == \"\" {\n\t\treturn 0, errEmpty\n\t}\n\treturn strconv.Atoi(s)\n```\n")
+		assert.Contains(t, comment.Body, "## 🧪 Validation Results")
+		assert.Contains(t, comment.Body, "**Test Coverage**: 90.0% (Required: 80%)")
+	})
+
+	t.Run("CommentWhenNotInTheDiff", func(t *testing.T) {
+		var prFixes []*FixValidationResult
+		m, gh := prTriggeredAutofix(t, &prFixes)
+		gh.listPRFilesFunc = func(ctx context.Context, number int) ([]FileChange, error) {
+			return []FileChange{{Filename: "README.md", Patch: "@@ -1 +1 @@\n-old\n+new"}}, nil
+		}
+		var body string
+		gh.addPullRequestCommentFunc = func(ctx context.Context, number int, comment string) error {
+			assert.Equal(t, 42, number)
+			body = comment
+			return nil
+		}
+
+		result, err := m.AutoFix(ctx, 7)
+		require.NoError(t, err)
+		assert.Equal(t, "comment", result.Metadata["pr_comment"])
+		assert.NotContains(t, gh.calls, "CreateReviewComment")
+		assert.Empty(t, prFixes)
+		assert.NotContains(t, body, "```suggestion")
+		assert.Contains(t, body, "- **Modify**: parser/parser.go `Return an error for empty input`")
+		assert.Contains(t, body, "```diff\ndiff --git a/parser/parser.go b/parser/parser.go\n")
+		assert.Contains(t, body, "## 🧪 Validation Results")
+	})
+
+	t.Run("CommentMode", func(t *testing.T) {
+		var prFixes []*FixValidationResult
+		m, gh := prTriggeredAutofix(t, &prFixes)
+		m = m.WithPRCommentMode("Comment")
+
+		result, err := m.AutoFix(ctx, 7)
+		require.NoError(t, err)
+		assert.Equal(t, "comment", result.Metadata["pr_comment"])
+		assert.Contains(t, gh.calls, "AddPullRequestComment")
+		assert.NotContains(t, gh.calls, "CreateReviewComment")
+	})
+
+	t.Run("FailedSuggestionFallsBackToComment", func(t *testing.T) {
+		var prFixes []*FixValidationResult
+		m, gh := prTriggeredAutofix(t, &prFixes)
+		gh.createReviewCommentFunc = func(ctx context.Context, number int, comment ReviewComment) error {
+			return errors.New("422 pull_request_review_thread.line must be part of the diff")
+		}
+
+		result, err := m.AutoFix(ctx, 7)
+		require.NoError(t, err)
+		assert.Equal(t, "comment", result.Metadata["pr_comment"])
+		assert.Contains(t, gh.calls, "CreateReviewComment")
+		assert.Contains(t, gh.calls, "AddPullRequestComment")
+	})
+
+	t.Run("CommentFails", func(t *testing.T) {
+		var prFixes []*FixValidationResult
+		m, gh := prTriggeredAutofix(t, &prFixes)
+		m = m.WithPRCommentMode("comment")
+		gh.addPullRequestCommentFunc = func(ctx context.Context, number int, body string) error {
+			return errors.New("403 forbidden")
+		}
+
+		_, err := m.AutoFix(ctx, 7)
+		assert.ErrorContains(t, err, "PR comment failed: 403 forbidden")
+		assert.Empty(t, prFixes)
+	})
+
+	t.Run("OffOpensAPullRequest", func(t *testing.T) {
+		var prFixes []*FixValidationResult
+		m, gh := prTriggeredAutofix(t, &prFixes)
+		m = m.WithPRCommentMode("off")
+
+		result, err := m.AutoFix(ctx, 7)
+		require.NoError(t, err)
+		assert.Len(t, prFixes, 1)
+		assert.Equal(t, 1, result.PullRequest.Number)
+		assert.NotContains(t, gh.calls, "FindPullRequestForCommit")
+		assert.Zero(t, result.Analysis.Context.PRNumber)
+	})
+
+	t.Run("NoOpenPullRequest", func(t *testing.T) {
+		var prFixes []*FixValidationResult
+		m, gh := prTriggeredAutofix(t, &prFixes)
+		gh.findPRForCommitFunc = func(ctx context.Context, sha string) (*PullRequest, error) {
+			return nil, nil
+		}
+
+		result, err := m.AutoFix(ctx, 7)
+		require.NoError(t, err)
+		assert.Len(t, prFixes, 1)
+		assert.Equal(t, 1, result.PullRequest.Number)
+		assert.NotContains(t, gh.calls, "ListPullRequestFiles")
+	})
+
+	t.Run("PushRunsOpenAPullRequest", func(t *testing.T) {
+		var prFixes []*FixValidationResult
+		m, gh := prTriggeredAutofix(t, &prFixes)
+		gh.getWorkflowRunFunc = func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+			return &WorkflowRun{ID: runID, CommitSHA: "head123", Event: "push"}, nil
+		}
+
+		_, err := m.AutoFix(ctx, 7)
+		require.NoError(t, err)
+		assert.Len(t, prFixes, 1)
+		assert.NotContains(t, gh.calls, "FindPullRequestForCommit")
+	})
+}
+
+// TestLineSuggestion tests which edit scripts become suggestions and the lines they replace
+func TestLineSuggestion(t *testing.T) {
+	suggest := func(old, new string) *prSuggestion {
+		return lineSuggestion(lineEdits(splitLines(old), splitLines(new)))
+	}
+
+	assert.Equal(t, &prSuggestion{StartLine: 2, Line: 2, Replacement: "B"}, suggest("a\nb\nc\n", "a\nB\nc\n"))
+	assert.Equal(t, &prSuggestion{StartLine: 2, Line: 3, Replacement: "x"}, suggest("a\nb\nc\nd\n", "a\nx\nd\n"))
+	// Insertions also replace the line before them, or after them at the start
+	assert.Equal(t, &prSuggestion{StartLine: 1, Line: 1, Replacement: "a\nnew"}, suggest("a\nb\n", "a\nnew\nb\n"))
+	assert.Equal(t, &prSuggestion{StartLine: 1, Line: 1, Replacement: "new\na"}, suggest("a\nb\n", "new\na\nb\n"))
+
+	assert.Nil(t, suggest("a\n", "a\n"), "nothing changes")
+	far := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	assert.Nil(t, suggest(far, strings.Replace(strings.Replace(far, "1\n", "one\n", 1), "12\n", "twelve\n", 1)), "two hunks")
+	assert.Nil(t, suggest("a\n", "a\n"+strings.Repeat("x\n", maxSuggestionLines+1)), "too many lines")
+}
+
+// TestPRDiffLines tests parsing the new line ranges of a pull request's hunks
+func TestPRDiffLines(t *testing.T) {
+	diff := formatPRDiff([]FileChange{
+		{Filename: "parser/parser.go", Patch: parserPRPatch + "\n@@ -20,3 +25 @@\n-a\n-b\n c"},
+		{Filename: "logo.png"},
+		{Filename: "removed.go", Patch: "@@ -1,2 +0,0 @@\n-a\n-b"},
+	})
+	assert.Contains(t, diff, "diff --git a/logo.png b/logo.png\n(no textual changes)\n")
+	assert.Equal(t, map[string][][2]int{"parser/parser.go": {{1, 7}, {25, 25}}}, prDiffLines(diff))
+
+	long := formatPRDiff([]FileChange{{Filename: "big.txt", Patch: strings.Repeat("+line\n", maxPRContextDiffBytes/5)}})
+	assert.LessOrEqual(t, len(long), maxPRContextDiffBytes+50)
+	assert.Contains(t, long, "more lines not shown]\n")
+}
+
+// TestPRDiffPrompt tests that the analysis and fix prompts show the pull request's changes
+func TestPRDiffPrompt(t *testing.T) {
+	failureCtx := FailureContext{
+		WorkflowRun: &WorkflowRun{ID: 7, Event: pullRequestEvent},
+		PRNumber:    42,
+		PRDiff:      formatPRDiff([]FileChange{{Filename: "parser/parser.go", Patch: parserPRPatch}}),
+	}
+	analysisPrompt := newAnalysisPromptData(failureCtx, nil).PRDiffSection
+	assert.Contains(t, analysisPrompt, "## Pull Request Changes\n\nThe run tested pull request #42.")
+	assert.Contains(t, analysisPrompt, "```diff\ndiff --git a/parser/parser.go b/parser/parser.go\n")
+	assert.Equal(t, analysisPrompt, newFixPromptData(&FailureAnalysisResult{Context: failureCtx}).PRDiffSection)
+
+	assert.Empty(t, newAnalysisPromptData(FailureContext{}, nil).PRDiffSection)
+}
+
+// TestValidatePRCommentMode tests the accepted PR comment modes
+func TestValidatePRCommentMode(t *testing.T) {
+	for _, mode := range []PRCommentMode{"", PRCommentReview, PRCommentConversation, PRCommentOff} {
+		assert.NoError(t, validatePRCommentMode(mode))
+	}
+	assert.ErrorContains(t, validatePRCommentMode("always"), `unsupported PR comment mode "always"`)
+	assert.Equal(t, PRCommentReview, New().prCommentMode())
+}
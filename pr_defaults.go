@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v45/github"
+)
+
+// PRDefaults are applied to every fix pull request the agent opens
+type PRDefaults struct {
+	Reviewers     []string `json:"reviewers"`
+	TeamReviewers []string `json:"team_reviewers"` // team slugs in the repository's organization
+	Assignees     []string `json:"assignees"`
+	Labels        []string `json:"labels"` // added to the labels generated for each fix
+	// AutoMerge enables auto-merge on non-draft fix PRs when the repository allows it,
+	// so they merge once required checks and reviews pass
+	AutoMerge bool `json:"auto_merge"`
+	// Draft opens every fix PR as a draft
+	Draft bool `json:"draft"`
+	// CoverageGist uploads the HTML coverage report of each fix as a secret gist linked from
+	// its PR; the token needs the gist scope
+	CoverageGist bool `json:"coverage_gist"`
+}
+
+// parseReviewers splits reviewer names into users and team slugs. Teams are given as
+// "org/team" or "@org/team", like in CODEOWNERS.
+func parseReviewers(names []string) (users, teams []string) {
+	for _, name := range names {
+		name = strings.TrimPrefix(strings.TrimSpace(name), "@")
+		if name == "" {
+			continue
+		}
+		if _, team, ok := strings.Cut(name, "/"); ok {
+			teams = append(teams, team)
+		} else {
+			users = append(users, name)
+		}
+	}
+	return users, teams
+}
+
+// mergeNames concatenates name lists, dropping empty names and duplicates (ignoring case)
+func mergeNames(base []string, extra ...[]string) []string {
+	seen := make(map[string]bool, len(base))
+	merged := make([]string, 0, len(base))
+	for _, names := range append([][]string{base}, extra...) {
+		for _, name := range names {
+			if key := strings.ToLower(name); name != "" && !seen[key] {
+				seen[key] = true
+				merged = append(merged, name)
+			}
+		}
+	}
+	return merged
+}
+
+// enableAutoMergeMutation turns on auto-merge for a pull request. GitHub only exposes it
+// through GraphQL.
+const enableAutoMergeMutation = `mutation($pullRequestId: ID!, $mergeMethod: PullRequestMergeMethod!) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $pullRequestId, mergeMethod: $mergeMethod}) {
+    pullRequest { number }
+  }
+}`
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+type graphQLResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// EnableAutoMerge enables auto-merge on a pull request using the merge method the
+// repository allows, preferring squash. It fails when the repository has auto-merge disabled.
+func (g *GitHubIntegration) EnableAutoMerge(ctx context.Context, pullRequestNodeID string) error {
+	repo, err := callGitHub(ctx, g, func() (*github.Repository, *github.Response, error) {
+		return g.client.Repositories.Get(ctx, g.repoOwner, g.repoName)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get repository: %w", err)
+	}
+	if !repo.GetAllowAutoMerge() {
+		return fmt.Errorf("auto-merge is not allowed in %s/%s", g.repoOwner, g.repoName)
+	}
+
+	mergeMethod := "MERGE"
+	switch {
+	case repo.GetAllowSquashMerge():
+		mergeMethod = "SQUASH"
+	case !repo.GetAllowMergeCommit() && repo.GetAllowRebaseMerge():
+		mergeMethod = "REBASE"
+	}
+
+	body := &graphQLRequest{
+		Query: enableAutoMergeMutation,
+		Variables: map[string]interface{}{
+			"pullRequestId": pullRequestNodeID,
+			"mergeMethod":   mergeMethod,
+		},
+	}
+
+	var result graphQLResponse
+	err = g.withRateLimit(ctx, func() (*github.Response, error) {
+		req, err := g.client.NewRequest("POST", g.graphQLURL(), body)
+		if err != nil {
+			return nil, err
+		}
+		return g.client.Do(ctx, req, &result)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable auto-merge: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("failed to enable auto-merge: %s", result.Errors[0].Message)
+	}
+	return nil
+}
+
+// graphQLURL returns the GraphQL endpoint, relative to the REST base URL. GitHub Enterprise
+// Server serves it from /api/graphql rather than below /api/v3/.
+func (g *GitHubIntegration) graphQLURL() string {
+	if strings.HasSuffix(g.client.BaseURL.Path, enterpriseAPIPath) {
+		base := *g.client.BaseURL
+		base.Path = strings.TrimSuffix(base.Path, enterpriseAPIPath) + "/api/graphql"
+		return base.String()
+	}
+	return "graphql"
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// prDefaultsRequests records what the mocked GitHub API received for a fix PR
+type prDefaultsRequests struct {
+	draft     bool
+	body      string
+	labels    []string
+	reviewers github.ReviewersRequest
+	assignees []string
+	mutations []graphQLRequest
+}
+
+// prDefaultsAPI mocks the endpoints used to open a fix PR and apply its defaults.
+// allowAutoMerge controls the repository setting, graphQLError makes the mutation fail.
+func prDefaultsAPI(t *testing.T, allowAutoMerge bool, graphQLError string) (*GitHubIntegration, *prDefaultsRequests) {
+	gh, _, got := prDefaultsMux(t, allowAutoMerge, graphQLError)
+	return gh, got
+}
+
+// prDefaultsMux is prDefaultsAPI returning the mux, for tests mocking further endpoints
+func prDefaultsMux(t *testing.T, allowAutoMerge bool, graphQLError string) (*GitHubIntegration, *http.ServeMux, *prDefaultsRequests) {
+	gh, mux := newMockGitHubAPI(t)
+	gh.SetTargetBranch("main")
+	got := &prDefaultsRequests{}
+
+	mux.HandleFunc("/repos/owner/repo", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"allow_auto_merge":%t,"allow_squash_merge":true,"allow_merge_commit":true}`, allowAutoMerge)
+	})
+	mux.HandleFunc("/repos/owner/repo/git/ref/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"object":{"sha":"abc123"}}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, `[]`)
+			return
+		}
+		var body github.NewPullRequest
+		assert.NoError(t, decodeJSON(r, &body))
+		got.draft = body.GetDraft()
+		got.body = body.GetBody()
+		fmt.Fprint(w, `{"number":7,"node_id":"PR_kwDO7","state":"open"}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/pulls/7/requested_reviewers", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, decodeJSON(r, &got.reviewers))
+		fmt.Fprint(w, `{"number":7}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/issues/7/labels", func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, decodeJSON(r, &got.labels))
+		fmt.Fprint(w, `[]`)
+	})
+	mux.HandleFunc("/repos/owner/repo/issues/7/assignees", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Assignees []string `json:"assignees"`
+		}
+		assert.NoError(t, decodeJSON(r, &body))
+		got.assignees = body.Assignees
+		fmt.Fprint(w, `{"number":7}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{}`)
+	})
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var body graphQLRequest
+		assert.NoError(t, decodeJSON(r, &body))
+		got.mutations = append(got.mutations, body)
+		if graphQLError != "" {
+			fmt.Fprintf(w, `{"errors":[{"message":%q}]}`, graphQLError)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"enablePullRequestAutoMerge":{"pullRequest":{"number":7}}}}`)
+	})
+
+	return gh, mux, got
+}
+
+func highConfidenceFix() *FixValidationResult {
+	return &FixValidationResult{
+		Fix:        &ProposedFix{ID: "fix-1", Type: CodeFix, Confidence: 0.9},
+		TestResult: &TestResult{Success: true, Coverage: 90},
+		Valid:      true,
+	}
+}
+
+// TestCreateFixPRAppliesDefaults tests reviewers, assignees, labels and auto-merge on fix PRs
+func TestCreateFixPRAppliesDefaults(t *testing.T) {
+	ctx := context.Background()
+	analysis := &FailureAnalysisResult{
+		ID:             "analysis-42-1700000000",
+		Classification: FailureClassification{Type: BuildFailure},
+		Context:        FailureContext{WorkflowRun: &WorkflowRun{ID: 42}},
+	}
+	users, teams := parseReviewers([]string{"octocat", "my-org/platform"})
+	defaults := PRDefaults{
+		Reviewers:     users,
+		TeamReviewers: teams,
+		Assignees:     []string{"hubot"},
+		Labels:        []string{"needs-review", "CI-Fix"},
+		AutoMerge:     true,
+	}
+
+	t.Run("AppliedToPR", func(t *testing.T) {
+		gh, got := prDefaultsAPI(t, true, "")
+		engine := NewPullRequestEngine(gh, quietLogger())
+		engine.SetPRDefaults(defaults)
+
+		_, err := engine.CreateFixPR(ctx, analysis, highConfidenceFix())
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"octocat"}, got.reviewers.Reviewers)
+		assert.Equal(t, []string{"platform"}, got.reviewers.TeamReviewers)
+		assert.Equal(t, []string{"hubot"}, got.assignees)
+		assert.Contains(t, got.labels, "needs-review")
+		assert.Contains(t, got.labels, "ci-fix")
+		assert.NotContains(t, got.labels, "CI-Fix", "labels already set by the templates are not repeated")
+
+		require.Len(t, got.mutations, 1)
+		assert.Equal(t, "PR_kwDO7", got.mutations[0].Variables["pullRequestId"])
+		assert.Equal(t, "SQUASH", got.mutations[0].Variables["mergeMethod"])
+	})
+
+	t.Run("AutoMergeNotAllowed", func(t *testing.T) {
+		gh, got := prDefaultsAPI(t, false, "")
+		engine := NewPullRequestEngine(gh, quietLogger())
+		engine.SetPRDefaults(defaults)
+
+		pr, err := engine.CreateFixPR(ctx, analysis, highConfidenceFix())
+		require.NoError(t, err, "auto-merge failures leave the PR open")
+		assert.Equal(t, 7, pr.Number)
+		assert.Empty(t, got.mutations)
+	})
+
+	t.Run("AutoMergeMutationFails", func(t *testing.T) {
+		gh, got := prDefaultsAPI(t, true, "Pull request is in clean status")
+		engine := NewPullRequestEngine(gh, quietLogger())
+		engine.SetPRDefaults(defaults)
+
+		_, err := engine.CreateFixPR(ctx, analysis, highConfidenceFix())
+		require.NoError(t, err)
+		assert.Len(t, got.mutations, 1)
+
+		err = gh.EnableAutoMerge(ctx, "PR_kwDO7")
+		assert.ErrorContains(t, err, "Pull request is in clean status")
+	})
+
+	t.Run("DraftSkipsAutoMerge", func(t *testing.T) {
+		gh, got := prDefaultsAPI(t, true, "")
+		engine := NewPullRequestEngine(gh, quietLogger())
+		draftDefaults := defaults
+		draftDefaults.Draft = true
+		engine.SetPRDefaults(draftDefaults)
+
+		_, err := engine.CreateFixPR(ctx, analysis, highConfidenceFix())
+		require.NoError(t, err)
+		assert.True(t, got.draft)
+		assert.Empty(t, got.mutations)
+	})
+}
+
+// TestParseReviewers tests splitting reviewers into users and team slugs
+func TestParseReviewers(t *testing.T) {
+	users, teams := parseReviewers([]string{"octocat", "@my-org/platform", " ", "org/sre", "@hubot"})
+	assert.Equal(t, []string{"octocat", "hubot"}, users)
+	assert.Equal(t, []string{"platform", "sre"}, teams)
+
+	users, teams = parseReviewers(nil)
+	assert.Empty(t, users)
+	assert.Empty(t, teams)
+}
+
+// TestMergeNames tests case-insensitive deduplication of name lists
+func TestMergeNames(t *testing.T) {
+	assert.Equal(t, []string{"autofix", "ci-fix", "urgent"}, mergeNames([]string{"autofix", "ci-fix"}, []string{"CI-Fix", "", "urgent"}))
+	assert.Equal(t, []string{}, mergeNames(nil))
+}
+
+// TestGraphQLURL tests the GraphQL endpoint for github.com and GitHub Enterprise Server
+func TestGraphQLURL(t *testing.T) {
+	gh, _ := newMockGitHubAPI(t)
+	assert.Equal(t, "graphql", gh.graphQLURL())
+
+	enterprise, err := url.Parse("https://github.example.com/api/v3/")
+	require.NoError(t, err)
+	gh.client.BaseURL = enterprise
+	assert.Equal(t, "https://github.example.com/api/graphql", gh.graphQLURL())
+}
+
+// TestCLIPRDefaults tests reading PR defaults from flags and environment variables
+func TestCLIPRDefaults(t *testing.T) {
+	t.Setenv("PR_REVIEWERS", "octocat, my-org/platform")
+	t.Setenv("PR_ASSIGNEES", "hubot")
+	t.Setenv("PR_LABELS", "")
+	t.Setenv("PR_DRAFT", "true")
+
+	cli := NewCLI()
+	cmd := cli.rootCmd
+	require.NoError(t, cmd.PersistentFlags().Set("pr-label", "needs-review"))
+	require.NoError(t, cmd.PersistentFlags().Set("pr-label", "urgent"))
+	require.NoError(t, cmd.PersistentFlags().Set("pr-auto-merge", "true"))
+
+	config := cli.getCurrentConfig(cmd)
+	assert.Equal(t, []string{"octocat", "my-org/platform"}, config.PRReviewers)
+	assert.Equal(t, []string{"hubot"}, config.PRAssignees)
+	assert.Equal(t, []string{"needs-review", "urgent"}, config.PRLabels)
+	assert.True(t, config.PRAutoMerge)
+	assert.True(t, config.PRDraft)
+
+	defaults := config.prDefaults()
+	assert.Equal(t, []string{"octocat"}, defaults.Reviewers)
+	assert.Equal(t, []string{"platform"}, defaults.TeamReviewers)
+
+	t.Run("FlagOverridesEnv", func(t *testing.T) {
+		cli := NewCLI()
+		cmd := cli.rootCmd
+		require.NoError(t, cmd.ParseFlags([]string{"--pr-reviewer", "monalisa"}))
+		assert.Equal(t, []string{"monalisa"}, cli.getStringSliceValue(cmd, "pr-reviewer", "PR_REVIEWERS"))
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// prMetadataSchemaVersion is the version of the metadata embedded in fix PR bodies, raised
+// when fields change meaning
+const prMetadataSchemaVersion = 1
+
+// prMetadataMarker opens the hidden comment holding the metadata of a fix PR
+const prMetadataMarker = "<!-- autofix-metadata "
+
+// PRMetadata links a fix PR back to the workflow run, analysis and fix it was opened for.
+// It is embedded in the PR body as a hidden HTML comment at its end, so it survives edits to
+// the visible text.
+type PRMetadata struct {
+	SchemaVersion int    `json:"schema_version"`
+	RunID         int64  `json:"run_id,omitempty"`
+	AnalysisID    string `json:"analysis_id,omitempty"`
+	FixID         string `json:"fix_id,omitempty"`
+	// Fingerprint is the hash identifying the failure across runs
+	Fingerprint  string `json:"fingerprint,omitempty"`
+	AgentVersion string `json:"agent_version"`
+}
+
+// newPRMetadata returns the metadata of the PR of a fix for an analysis
+func newPRMetadata(analysis *FailureAnalysisResult, fix *ProposedFix) PRMetadata {
+	analysis, fix = orEmptyAnalysis(analysis), orEmptyFix(fix)
+	metadata := PRMetadata{
+		SchemaVersion: prMetadataSchemaVersion,
+		AnalysisID:    analysis.ID,
+		FixID:         fix.ID,
+		Fingerprint:   valueOr(analysis.Fingerprint, failureFingerprint(analysis.Context.Logs)),
+		AgentVersion:  agentVersion,
+	}
+	if run := analysis.Context.WorkflowRun; run != nil {
+		metadata.RunID = run.ID
+	}
+	return metadata
+}
+
+// embedPRMetadata replaces the metadata block of a PR body with one holding metadata, at the
+// end of the body
+func embedPRMetadata(body string, metadata PRMetadata) string {
+	if start := strings.LastIndex(body, prMetadataMarker); start >= 0 {
+		end := len(body)
+		if i := strings.Index(body[start:], "-->"); i >= 0 {
+			end = start + i + len("-->")
+		}
+		body = strings.TrimRight(body[:start], "\n") + "\n" + strings.TrimLeft(body[end:], "\n")
+	}
+	// Marshal escapes < and >, so no value can end the comment early
+	data, _ := json.Marshal(metadata)
+	return strings.TrimRight(body, "\n") + "\n\n" + prMetadataMarker + string(data) + " -->\n"
+}
+
+// ParsePRMetadata reads the metadata the agent embedded in a fix PR body. Bodies without
+// metadata, of PRs opened by hand or by older versions, return nil and no error; a
+// malformed block returns an error.
+func ParsePRMetadata(body string) (*PRMetadata, error) {
+	start := strings.LastIndex(body, prMetadataMarker)
+	if start < 0 {
+		return nil, nil
+	}
+	data, _, ok := strings.Cut(body[start+len(prMetadataMarker):], "-->")
+	if !ok {
+		return nil, fmt.Errorf("PR metadata is not terminated")
+	}
+
+	var metadata PRMetadata
+	if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &metadata); err != nil {
+		return nil, fmt.Errorf("invalid PR metadata: %w", err)
+	}
+	if metadata.SchemaVersion < 1 {
+		return nil, fmt.Errorf("invalid PR metadata: schema version %d", metadata.SchemaVersion)
+	}
+	return &metadata, nil
+}
+
+// prMetadata reads the metadata of a PR, logging malformed blocks, which callers treat like
+// PRs without metadata
+func prMetadata(pr *PullRequest, logger *logrus.Logger) *PRMetadata {
+	metadata, err := ParsePRMetadata(pr.Body)
+	if err != nil && logger != nil {
+		logger.WithError(err).WithField("pr_number", pr.Number).Debug("Ignoring malformed fix PR metadata")
+	}
+	return metadata
+}
+
+// loginResolver tells the login a GitHub client authenticates as
+type loginResolver interface {
+	AuthenticatedLogin(ctx context.Context) (string, error)
+}
+
+// adoptUntrackedPRs tracks the open fix PRs whose metadata names a workflow run but that the
+// PR tracking state lacks, e.g. opened by another agent instance or before the state file
+// was kept, so they are reconciled and superseded like the agent's own. Only PRs the agent's
+// account opened from a fix branch are adopted, so a PR a person labelled, or opened from a
+// copied body, is never closed; clients that cannot tell the account adopt none.
+func (m *DaggerAutofix) adoptUntrackedPRs(ctx context.Context, tracker *prTracker) {
+	resolver, ok := m.githubClient.(loginResolver)
+	if !ok {
+		return
+	}
+	login, err := resolver.AuthenticatedLogin(ctx)
+	if err != nil || login == "" {
+		m.logger.WithError(err).Warn("Failed to get the authenticated GitHub account, not tracking untracked fix pull requests")
+		return
+	}
+
+	prs, err := m.githubClient.ListOpenPullRequests(ctx, []string{"autofix"})
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to list open fix pull requests to track")
+		return
+	}
+
+	var adopted []*TrackedPR
+	for _, pr := range prs {
+		if _, ok := tracker.get(pr.Number); ok {
+			continue
+		}
+		if !strings.EqualFold(pr.Author, login) || !strings.HasPrefix(pr.Branch, fixBranchPrefix) {
+			continue
+		}
+		metadata := prMetadata(pr, m.logger)
+		if metadata == nil || metadata.RunID == 0 {
+			continue
+		}
+		run, err := m.githubClient.GetWorkflowRun(ctx, metadata.RunID)
+		if err != nil {
+			m.logger.WithError(err).WithField("pr_number", pr.Number).Warn("Failed to get the workflow run of an untracked fix PR")
+			continue
+		}
+		openedAt := pr.CreatedAt
+		if openedAt.IsZero() {
+			openedAt = time.Now()
+		}
+		adopted = append(adopted, &TrackedPR{
+			RunID:    run.ID,
+			Workflow: run.Name,
+			Branch:   run.Branch,
+			Number:   pr.Number,
+			URL:      pr.URL,
+			State:    TrackedPROpen,
+			OpenedAt: openedAt,
+		})
+		m.logger.WithFields(logrus.Fields{"pr_number": pr.Number, "run_id": run.ID}).Info("Tracking fix pull request found by its metadata")
+	}
+	if len(adopted) == 0 {
+		return
+	}
+	if err := tracker.track(adopted...); err != nil {
+		m.logger.WithError(err).Warn("Failed to save PR tracking state")
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// metadataAnalysis returns an analysis of run 42 with a fix, as fix PRs are opened for
+func metadataAnalysis() (*FailureAnalysisResult, *FixValidationResult) {
+	analysis := &FailureAnalysisResult{
+		ID:             "analysis-42-1a2b3c",
+		Fingerprint:    "9f86d081884c7d65",
+		Classification: FailureClassification{Type: TestFailure},
+		Context:        FailureContext{WorkflowRun: &WorkflowRun{ID: 42, Name: "CI", Branch: "main"}},
+	}
+	fix := &FixValidationResult{
+		Fix:        &ProposedFix{ID: "fix-7", Type: CodeFix, Confidence: 0.9, Description: "Add instead of subtracting"},
+		TestResult: &TestResult{Success: true, Coverage: 90},
+		Valid:      true,
+	}
+	return analysis, fix
+}
+
+// TestPRMetadataRoundTrip tests that the metadata generatePRBody embeds is parsed back, and
+// that embedding it again replaces the block
+func TestPRMetadataRoundTrip(t *testing.T) {
+	analysis, fix := metadataAnalysis()
+	body := NewPullRequestEngine(nil, quietLogger()).generatePRBody(analysis, fix)
+
+	want := &PRMetadata{
+		SchemaVersion: prMetadataSchemaVersion,
+		RunID:         42,
+		AnalysisID:    "analysis-42-1a2b3c",
+		FixID:         "fix-7",
+		Fingerprint:   "9f86d081884c7d65",
+		AgentVersion:  agentVersion,
+	}
+	metadata, err := ParsePRMetadata(body)
+	require.NoError(t, err)
+	assert.Equal(t, want, metadata)
+	assert.True(t, strings.HasSuffix(body, prBodyFooter+"\n"+prMetadataMarker+`{"schema_version":1,"run_id":42,"analysis_id":"analysis-42-1a2b3c","fix_id":"fix-7","fingerprint":"9f86d081884c7d65","agent_version":"1.0.0"} -->`+"\n"))
+
+	// Sections added later go above the footer, leaving the block last
+	body = insertBeforeFooter(body, "## 👥 Review\n\n")
+	assert.Contains(t, body, "## 👥 Review\n\n"+prBodyFooter)
+	metadata, err = ParsePRMetadata(body)
+	require.NoError(t, err)
+	assert.Equal(t, want, metadata)
+
+	again := embedPRMetadata(body, PRMetadata{SchemaVersion: prMetadataSchemaVersion, RunID: 43, FixID: "--> <b>"})
+	assert.Equal(t, 1, strings.Count(again, prMetadataMarker))
+	metadata, err = ParsePRMetadata(again)
+	require.NoError(t, err)
+	assert.Equal(t, int64(43), metadata.RunID)
+	assert.Equal(t, "--> <b>", metadata.FixID, "values cannot end the comment")
+}
+
+// TestPRMetadataUserEditedBody tests that the metadata survives users rewriting the visible
+// text of a fix PR, and is restored when an edited body dropped it
+func TestPRMetadataUserEditedBody(t *testing.T) {
+	analysis, fix := metadataAnalysis()
+	body := NewPullRequestEngine(nil, quietLogger()).generatePRBody(analysis, fix)
+
+	block := body[strings.LastIndex(body, prMetadataMarker):]
+	edited := "Reworded by the reviewer: this swaps the operator.\n\n- [x] Checked locally\n\n" +
+		"<!-- a comment of their own -->\n" + block + "\nThanks!\n"
+	metadata, err := ParsePRMetadata(edited)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), metadata.RunID)
+	assert.Equal(t, "fix-7", metadata.FixID)
+
+	// Bodies edited during fix review are opened with the metadata, even if it was deleted
+	gh, mux := newMockGitHubAPI(t)
+	gh.SetTargetBranch("main")
+	var open []map[string]interface{}
+	fixPRAPI(t, mux, &open)
+	_, err = NewPullRequestEngine(gh, quietLogger()).CreateFixPRWithOptions(context.Background(), analysis, fix, FixPROptions{Body: "Swaps the operator."})
+	require.NoError(t, err)
+	require.Len(t, open, 1)
+	opened := open[0]["body"].(string)
+	assert.True(t, strings.HasPrefix(opened, "Swaps the operator.\n\n"+prMetadataMarker))
+	metadata, err = ParsePRMetadata(opened)
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), metadata.RunID)
+}
+
+// TestParsePRMetadataAbsentOrMalformed tests that bodies without metadata parse to nil and
+// malformed blocks to errors
+func TestParsePRMetadataAbsentOrMalformed(t *testing.T) {
+	for _, body := range []string{"", "Fixes the build by hand.\n\n<!-- reviewers: @alice -->\n"} {
+		metadata, err := ParsePRMetadata(body)
+		assert.NoError(t, err)
+		assert.Nil(t, metadata)
+	}
+
+	for body, problem := range map[string]string{
+		prMetadataMarker + `{"schema_version":1,"run_id":42}`: "PR metadata is not terminated",
+		prMetadataMarker + `{"run_id":"42"} -->`:              "invalid PR metadata: json",
+		prMetadataMarker + `{"run_id":42} -->`:                "invalid PR metadata: schema version 0",
+	} {
+		_, err := ParsePRMetadata(body)
+		assert.ErrorContains(t, err, problem, body)
+	}
+}
+
+// TestFindOpenFixPRByMetadata tests that open fix PRs are matched to a run by their metadata,
+// whatever their branch, and PRs without metadata by their branch and body as before
+func TestFindOpenFixPRByMetadata(t *testing.T) {
+	ctx := context.Background()
+	analysis, fix := metadataAnalysis()
+	withRun := func(runID int64) string {
+		return embedPRMetadata("Edited by a reviewer.", PRMetadata{SchemaVersion: prMetadataSchemaVersion, RunID: runID})
+	}
+
+	gh, mux := newMockGitHubAPI(t)
+	gh.SetTargetBranch("main")
+	open := []map[string]interface{}{
+		{"number": 3, "head": map[string]string{"ref": "autofix/test/" + branchHash(analysis)}, "body": withRun(41), "labels": []map[string]string{{"name": "autofix"}}},
+		{"number": 4, "head": map[string]string{"ref": "renamed-by-hand"}, "body": withRun(42), "labels": []map[string]string{{"name": "autofix"}}},
+	}
+	fixPRAPI(t, mux, &open)
+	engine := NewPullRequestEngine(gh, quietLogger())
+
+	pr, err := engine.CreateFixPR(ctx, analysis, fix)
+	require.NoError(t, err)
+	assert.True(t, pr.Existing)
+	assert.Equal(t, 4, pr.Number, "the metadata decides over the branch name")
+
+	// Malformed metadata is treated like none, so the legacy body match applies
+	open[1]["body"] = prMetadataMarker + "{ -->\n**Workflow Run**: #42\n"
+	pr, err = engine.CreateFixPR(ctx, analysis, fix)
+	require.NoError(t, err)
+	assert.Equal(t, 4, pr.Number)
+}
+
+// TestReconcilePRsTracksPRsByMetadata tests that reconciliation tracks open fix PRs the
+// agent's account opened from a fix branch by the run in their metadata, so they are
+// superseded like its own, and leaves other PRs alone
+func TestReconcilePRsTracksPRsByMetadata(t *testing.T) {
+	ctx := context.Background()
+	closed := make(map[int]string)
+	m := trackingAutofix(filepath.Join(t.TempDir(), "state.json"), nil, closed)
+	_, err := m.AutoFix(ctx, 101)
+	require.NoError(t, err)
+
+	gh := m.githubClient.(*mockGitHub)
+	gh.authenticatedLoginFunc = func(ctx context.Context) (string, error) {
+		return "autofix-app[bot]", nil
+	}
+	withRun99 := func(body string) string {
+		return embedPRMetadata(body, PRMetadata{SchemaVersion: prMetadataSchemaVersion, RunID: 99})
+	}
+	gh.listOpenPullRequestsFunc = func(ctx context.Context, labels []string) ([]*PullRequest, error) {
+		return []*PullRequest{
+			{Number: 101, State: "open"},
+			{Number: 7, State: "open", CreatedAt: time.Now(), Author: "autofix-app[bot]", Branch: "autofix/test/abc123", Body: withRun99("Opened by another agent.")},
+			{Number: 8, State: "open", Author: "autofix-app[bot]", Branch: "autofix/test/def456", Body: "Opened by hand."},
+			{Number: 9, State: "open", Author: "octocat", Branch: "autofix/test/abc123", Body: withRun99("Copied from a fix PR.")},
+			{Number: 10, State: "open", Author: "autofix-app[bot]", Branch: "release", Body: withRun99("Not a fix branch.")},
+		}, nil
+	}
+
+	require.NoError(t, m.ReconcilePRs(ctx))
+	assert.Equal(t, map[int]string{7: closed[7]}, closed)
+	assert.Contains(t, closed[7], "run #101")
+
+	tracker, err := m.prTracking()
+	require.NoError(t, err)
+	adopted, ok := tracker.get(7)
+	require.True(t, ok)
+	assert.Equal(t, int64(99), adopted.RunID)
+	assert.Equal(t, "CI", adopted.Workflow)
+	assert.Equal(t, TrackedPRSuperseded, adopted.State)
+	for _, number := range []int{8, 9, 10} {
+		_, ok = tracker.get(number)
+		assert.False(t, ok, "PR #%d is not tracked", number)
+	}
+
+	// Without the authenticated account no PR is adopted
+	gh.authenticatedLoginFunc = func(ctx context.Context) (string, error) {
+		return "", errors.New("forbidden")
+	}
+	unknown := trackingAutofix(filepath.Join(t.TempDir(), "state.json"), nil, closed)
+	unknown.githubClient = gh
+	require.NoError(t, unknown.ReconcilePRs(ctx))
+	tracker, err = unknown.prTracking()
+	require.NoError(t, err)
+	_, ok = tracker.get(7)
+	assert.False(t, ok)
+}
+
+// TestVerifyFixUntrackedPRByMetadata tests that a merged PR the agent does not track is
+// verified against the workflow of the run in its metadata
+func TestVerifyFixUntrackedPRByMetadata(t *testing.T) {
+	ctx := context.Background()
+	m, _ := verificationAutofix(t, [][]*WorkflowRun{{mergeRun(202, "Lint", "completed", "failure"), mergeRun(201, "CI", "completed", "success")}})
+	m.prEngine.(*mockPullRequestEngine).getPRStatusFunc = func(ctx context.Context, prNumber int) (*PullRequest, error) {
+		return &PullRequest{Number: prNumber, State: "closed", Merged: true, MergeCommitSHA: mergeSHA, MergedAt: time.Now(),
+			Body: embedPRMetadata("Merged after review.", PRMetadata{SchemaVersion: prMetadataSchemaVersion, RunID: 55})}, nil
+	}
+
+	result, err := m.VerifyFix(ctx, 300)
+	require.NoError(t, err)
+	assert.True(t, result.Verified(), "the Lint failure is another workflow")
+	assert.Equal(t, int64(55), result.FailedRunID)
+	assert.Equal(t, "CI", result.Workflow)
+}
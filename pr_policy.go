@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PRPolicyAction is what AutoFix does with a validated fix for a given failure type
+type PRPolicyAction string
+
+const (
+	// PRPolicyAuto opens a normal pull request
+	PRPolicyAuto PRPolicyAction = "auto"
+	// PRPolicyDraft opens the pull request as a draft
+	PRPolicyDraft PRPolicyAction = "draft"
+	// PRPolicyAnalysisOnly skips the pull request and comments the analysis on the commit
+	PRPolicyAnalysisOnly PRPolicyAction = "analysis-only"
+)
+
+// prPolicyEnvPrefix prefixes config file entries such as POLICY_SECURITY=draft
+const prPolicyEnvPrefix = "POLICY_"
+
+// defaultPRPolicyActions keeps risky failure types away from fully automatic PRs
+var defaultPRPolicyActions = map[FailureType]PRPolicyAction{
+	BuildFailure:      PRPolicyAuto,
+	DependencyFailure: PRPolicyAuto,
+	TestFailure:       PRPolicyAuto,
+	SecurityFailure:   PRPolicyDraft,
+	DeploymentFailure: PRPolicyDraft,
+}
+
+// PRPolicy decides per failure type whether AutoFix opens a PR, a draft PR, or only
+// comments the analysis. Failure types without an entry use the defaults.
+type PRPolicy struct {
+	Actions       map[FailureType]PRPolicyAction `json:"actions"`
+	MinConfidence float64                        `json:"min_confidence"` // fixes below this never get a PR
+}
+
+// PRPolicyDecision records the policy outcome applied to an AutoFix run
+type PRPolicyDecision struct {
+	Action PRPolicyAction
+	Reason string
+}
+
+// actionFor returns the configured action for a failure type, falling back to the defaults
+func (p PRPolicy) actionFor(failureType FailureType) PRPolicyAction {
+	if action, ok := p.Actions[failureType]; ok {
+		return action
+	}
+	if action, ok := defaultPRPolicyActions[failureType]; ok {
+		return action
+	}
+	return PRPolicyAuto
+}
+
+// decide applies the policy to the selected fix
+func (p PRPolicy) decide(analysis *FailureAnalysisResult, fix *FixValidationResult) PRPolicyDecision {
+	if fix.Fix.Confidence < p.MinConfidence {
+		return PRPolicyDecision{
+			Action: PRPolicyAnalysisOnly,
+			Reason: fmt.Sprintf("fix confidence %.2f is below the policy minimum of %.2f", fix.Fix.Confidence, p.MinConfidence),
+		}
+	}
+
+	failureType := analysis.Classification.Type
+	return PRPolicyDecision{
+		Action: p.actionFor(failureType),
+		Reason: fmt.Sprintf("policy for %s failures", failureType),
+	}
+}
+
+// validate checks every action and the confidence bound
+func (p PRPolicy) validate() error {
+	for failureType, action := range p.Actions {
+		if err := validatePRPolicyAction(action); err != nil {
+			return fmt.Errorf("invalid PR policy for %s failures: %w", failureType, err)
+		}
+	}
+	if p.MinConfidence < 0 || p.MinConfidence > 1 {
+		return fmt.Errorf("PR policy minimum confidence must be between 0 and 1, got %v", p.MinConfidence)
+	}
+	return nil
+}
+
+func validatePRPolicyAction(action PRPolicyAction) error {
+	switch action {
+	case PRPolicyAuto, PRPolicyDraft, PRPolicyAnalysisOnly:
+		return nil
+	default:
+		return fmt.Errorf("unsupported action %q (expected auto, draft or analysis-only)", action)
+	}
+}
+
+// ParsePRPolicy builds a policy from KEY=value environment entries. POLICY_<FAILURE_TYPE>
+// sets the action for a failure type and POLICY_MIN_CONFIDENCE the global minimum.
+func ParsePRPolicy(environ []string) (PRPolicy, error) {
+	policy := PRPolicy{Actions: make(map[FailureType]PRPolicyAction)}
+
+	for _, entry := range environ {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(key, prPolicyEnvPrefix) {
+			continue
+		}
+		name := strings.ToLower(strings.TrimPrefix(key, prPolicyEnvPrefix))
+		value = strings.TrimSpace(value)
+
+		if name == "min_confidence" {
+			confidence, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return PRPolicy{}, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			policy.MinConfidence = confidence
+			continue
+		}
+
+		failureType, err := ParseFailureType(name)
+		if err != nil || failureType == UnknownFailure {
+			return PRPolicy{}, fmt.Errorf("invalid %s: unknown failure type %q", key, name)
+		}
+
+		action := PRPolicyAction(strings.ToLower(value))
+		if err := validatePRPolicyAction(action); err != nil {
+			return PRPolicy{}, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		policy.Actions[failureType] = action
+	}
+
+	if err := policy.validate(); err != nil {
+		return PRPolicy{}, err
+	}
+	return policy, nil
+}
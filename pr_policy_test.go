@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// policyAutofix builds a module whose single valid fix is for a failure of the given type
+func policyAutofix(failureType FailureType, confidence float64, created *[]createdFixPR, comments *[]postedComment) *DaggerAutofix {
+	m := fixtureAutofix(nil)
+	m.githubClient.(*mockGitHub).createCommitCommentFunc = func(ctx context.Context, sha, body string) error {
+		*comments = append(*comments, postedComment{sha, body})
+		return nil
+	}
+
+	fe := m.failureEngine.(*mockFailureAnalysisEngine)
+	fe.analyzeFunc = func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+		return &FailureAnalysisResult{ID: "a1", Classification: FailureClassification{Type: failureType, Confidence: 0.9}, Context: fc}, nil
+	}
+	fe.generateFixesFunc = func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+		fix := parserFix()
+		fix.ID, fix.Confidence = "1", confidence
+		return []*ProposedFix{fix}, nil
+	}
+
+	m.prEngine.(*mockPullRequestEngine).createWithOptionsFunc = func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error) {
+		*created = append(*created, createdFixPR{fix.Fix.ID, opts.Draft})
+		return &PullRequest{Number: 1}, nil
+	}
+	return m
+}
+
+// TestAutoFixPRPolicy tests PR policy decisions under the default and custom policies
+func TestAutoFixPRPolicy(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("SecurityFailureOpensDraft", func(t *testing.T) {
+		var created []createdFixPR
+		var comments []postedComment
+		m := policyAutofix(SecurityFailure, 0.9, &created, &comments)
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []createdFixPR{{"1", true}}, created)
+		assert.True(t, res.Success)
+		assert.Equal(t, "draft", res.Metadata["pr_policy"])
+		assert.Equal(t, "policy for security failures", res.Metadata["pr_policy_reason"])
+	})
+
+	t.Run("BuildFailureOpensNormalPR", func(t *testing.T) {
+		var created []createdFixPR
+		var comments []postedComment
+		m := policyAutofix(BuildFailure, 0.9, &created, &comments)
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []createdFixPR{{"1", false}}, created)
+		assert.Equal(t, "auto", res.Metadata["pr_policy"])
+	})
+
+	t.Run("AnalysisOnly", func(t *testing.T) {
+		var created []createdFixPR
+		var comments []postedComment
+		m := policyAutofix(DeploymentFailure, 0.9, &created, &comments).
+			WithAutoPRPolicy(PRPolicy{Actions: map[FailureType]PRPolicyAction{DeploymentFailure: PRPolicyAnalysisOnly}})
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Empty(t, created)
+		assert.Nil(t, res.PullRequest)
+		assert.False(t, res.Success)
+		assert.Equal(t, "analysis-only", res.Metadata["pr_policy"])
+		require.Len(t, comments, 1)
+		assert.Contains(t, comments[0].body, "policy for deployment failures")
+	})
+
+	t.Run("BelowMinimumConfidence", func(t *testing.T) {
+		var created []createdFixPR
+		var comments []postedComment
+		m := policyAutofix(BuildFailure, 0.4, &created, &comments).
+			WithAutoPRPolicy(PRPolicy{MinConfidence: 0.6})
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Empty(t, created)
+		assert.Equal(t, "analysis-only", res.Metadata["pr_policy"])
+		assert.Contains(t, res.Metadata["pr_policy_reason"], "below the policy minimum")
+		assert.Len(t, comments, 1)
+	})
+
+	t.Run("DryRunRecordsDecision", func(t *testing.T) {
+		var created []createdFixPR
+		var comments []postedComment
+		m := policyAutofix(SecurityFailure, 0.9, &created, &comments).WithDryRun(true)
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Empty(t, created)
+		assert.Empty(t, comments)
+		assert.Equal(t, "draft", res.Metadata["pr_policy"])
+	})
+}
+
+// TestParsePRPolicy tests loading a policy from config file entries
+func TestParsePRPolicy(t *testing.T) {
+	policy, err := ParsePRPolicy([]string{
+		"POLICY_SECURITY=analysis-only",
+		"POLICY_BUILD=Draft",
+		"POLICY_MIN_CONFIDENCE=0.6",
+		"PATH=/usr/bin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, PRPolicyAnalysisOnly, policy.actionFor(SecurityFailure))
+	assert.Equal(t, PRPolicyDraft, policy.actionFor(BuildFailure))
+	assert.Equal(t, PRPolicyDraft, policy.actionFor(DeploymentFailure))
+	assert.Equal(t, PRPolicyAuto, policy.actionFor(InfrastructureFailure))
+	assert.Equal(t, 0.6, policy.MinConfidence)
+
+	_, err = ParsePRPolicy([]string{"POLICY_SECURITY=sometimes"})
+	assert.Error(t, err)
+	_, err = ParsePRPolicy([]string{"POLICY_UNKNOWN=auto"})
+	assert.Error(t, err)
+	_, err = ParsePRPolicy([]string{"POLICY_MIN_CONFIDENCE=high"})
+	assert.Error(t, err)
+	_, err = ParsePRPolicy([]string{"POLICY_MIN_CONFIDENCE=2"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Outcomes of a tracked fix pull request
+const (
+	TrackedPROpen       = "open"
+	TrackedPRMerged     = "merged"
+	TrackedPRClosed     = "closed"     // closed without merging
+	TrackedPRSuperseded = "superseded" // closed by the agent for a newer run's fix
+)
+
+// prReconcileInterval is how often MonitorWorkflows checks the state of tracked PRs
+const prReconcileInterval = 5 * time.Minute
+
+// TrackedPR maps a fix pull request to the workflow run it fixes
+type TrackedPR struct {
+	RunID       int64       `json:"run_id"`
+	Workflow    string      `json:"workflow"`
+	Branch      string      `json:"branch"` // branch of the failed run
+	FailureType FailureType `json:"failure_type,omitempty"`
+	Number      int         `json:"number"`
+	URL         string      `json:"url"`
+	State       string      `json:"state"`
+	OpenedAt    time.Time   `json:"opened_at"`
+	ResolvedAt  time.Time   `json:"resolved_at,omitempty"`
+	// Verification tells whether the workflow succeeded at MergeCommitSHA once the PR
+	// merged, decided by the run VerificationRunID
+	Verification      string `json:"verification,omitempty"`
+	MergeCommitSHA    string `json:"merge_commit_sha,omitempty"`
+	VerificationRunID int64  `json:"verification_run_id,omitempty"`
+}
+
+// prOutcomes counts tracked PRs by state, and merged PRs by verification outcome
+type prOutcomes struct {
+	open, merged, closed, superseded int
+	verified, unverified             int
+	// verifiedByType and verifications count the verified and all verified or unverified
+	// PRs per failure type
+	verifiedByType, verificationsByType map[FailureType]int
+}
+
+func (o *prOutcomes) add(other prOutcomes) {
+	o.open += other.open
+	o.merged += other.merged
+	o.closed += other.closed
+	o.superseded += other.superseded
+	o.verified += other.verified
+	o.unverified += other.unverified
+	if o.verifiedByType == nil {
+		o.verifiedByType = make(map[FailureType]int)
+		o.verificationsByType = make(map[FailureType]int)
+	}
+	for failureType, n := range other.verifiedByType {
+		o.verifiedByType[failureType] += n
+	}
+	for failureType, n := range other.verificationsByType {
+		o.verificationsByType[failureType] += n
+	}
+}
+
+// autofixState is the state file written when StateFile is set
+type autofixState struct {
+	PullRequests []*TrackedPR `json:"pull_requests"`
+}
+
+// prTracker remembers the fix PRs the agent opened, persisting them to path when set
+type prTracker struct {
+	mu   sync.Mutex
+	path string
+	prs  map[int]*TrackedPR // keyed by PR number
+}
+
+// loadPRTracker reads tracked PRs from the state file. A missing file starts empty.
+func loadPRTracker(path string) (*prTracker, error) {
+	t := &prTracker{path: path, prs: make(map[int]*TrackedPR)}
+	if path == "" {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var state autofixState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	for _, pr := range state.PullRequests {
+		t.prs[pr.Number] = pr
+	}
+	return t, nil
+}
+
+// track records newly opened PRs; PRs that are already tracked are left unchanged
+func (t *prTracker) track(prs ...*TrackedPR) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, pr := range prs {
+		if _, ok := t.prs[pr.Number]; !ok {
+			t.prs[pr.Number] = pr
+		}
+	}
+	return t.saveLocked()
+}
+
+// resolve records the final state of a tracked PR
+func (t *prTracker) resolve(number int, state string, at time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pr, ok := t.prs[number]
+	if !ok {
+		return nil
+	}
+	pr.State = state
+	pr.ResolvedAt = at
+	return t.saveLocked()
+}
+
+// verify records the verification outcome of a merged PR, with the merge commit and the
+// run that decided it once known
+func (t *prTracker) verify(number int, outcome, mergeCommitSHA string, runID int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pr, ok := t.prs[number]
+	if !ok {
+		return nil
+	}
+	pr.Verification = outcome
+	if mergeCommitSHA != "" {
+		pr.MergeCommitSHA = mergeCommitSHA
+	}
+	if runID != 0 {
+		pr.VerificationRunID = runID
+	}
+	return t.saveLocked()
+}
+
+// get returns a copy of a tracked PR
+func (t *prTracker) get(number int) (TrackedPR, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pr, ok := t.prs[number]
+	if !ok {
+		return TrackedPR{}, false
+	}
+	return *pr, true
+}
+
+// pendingVerifications returns copies of the merged PRs whose workflow has not yet run at
+// their merge commit, oldest merge first
+func (t *prTracker) pendingVerifications() []TrackedPR {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var pending []TrackedPR
+	for _, pr := range t.prs {
+		if pr.State == TrackedPRMerged && pr.Verification == VerificationPending {
+			pending = append(pending, *pr)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].ResolvedAt.Before(pending[j].ResolvedAt)
+	})
+	return pending
+}
+
+// openPRs returns copies of the tracked PRs that are still open, oldest run first
+func (t *prTracker) openPRs() []TrackedPR {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var open []TrackedPR
+	for _, pr := range t.prs {
+		if pr.State == TrackedPROpen {
+			open = append(open, *pr)
+		}
+	}
+	sort.Slice(open, func(i, j int) bool {
+		if open[i].RunID != open[j].RunID {
+			return open[i].RunID < open[j].RunID
+		}
+		return open[i].Number < open[j].Number
+	})
+	return open
+}
+
+func (t *prTracker) outcomes() prOutcomes {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := prOutcomes{
+		verifiedByType:      make(map[FailureType]int),
+		verificationsByType: make(map[FailureType]int),
+	}
+	for _, pr := range t.prs {
+		switch pr.Verification {
+		case VerificationVerified:
+			counts.verified++
+			counts.verifiedByType[pr.FailureType]++
+			counts.verificationsByType[pr.FailureType]++
+		case VerificationUnverified:
+			counts.unverified++
+			counts.verificationsByType[pr.FailureType]++
+		}
+		switch pr.State {
+		case TrackedPROpen:
+			counts.open++
+		case TrackedPRMerged:
+			counts.merged++
+		case TrackedPRClosed:
+			counts.closed++
+		case TrackedPRSuperseded:
+			counts.superseded++
+		}
+	}
+	return counts
+}
+
+// saveLocked writes the state file through a temporary file so readers never see a partial write
+func (t *prTracker) saveLocked() error {
+	if t.path == "" {
+		return nil
+	}
+
+	state := autofixState{PullRequests: make([]*TrackedPR, 0, len(t.prs))}
+	for _, pr := range t.prs {
+		state.PullRequests = append(state.PullRequests, pr)
+	}
+	sort.Slice(state.PullRequests, func(i, j int) bool {
+		return state.PullRequests[i].Number < state.PullRequests[j].Number
+	})
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+	if err := writeFileAtomic(t.path, ".autofix-state-*", data); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data through a temporary file named after pattern in
+// the same directory
+func writeFileAtomic(path, pattern string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), pattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// prTracking returns the PR tracker, loading it from StateFile on first use
+func (m *DaggerAutofix) prTracking() (*prTracker, error) {
+	m.trackerMu.Lock()
+	defer m.trackerMu.Unlock()
+
+	if m.tracker == nil {
+		tracker, err := loadPRTracker(m.StateFile)
+		if err != nil {
+			return nil, err
+		}
+		m.tracker = tracker
+	}
+	return m.tracker, nil
+}
+
+// trackPRs remembers the PRs opened for a workflow run so ReconcilePRs can follow them up
+func (m *DaggerAutofix) trackPRs(run *WorkflowRun, failureType FailureType, prs []*PullRequest) {
+	if run == nil {
+		return
+	}
+	tracker, err := m.prTracking()
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to load PR tracking state")
+		return
+	}
+
+	tracked := make([]*TrackedPR, 0, len(prs))
+	for _, pr := range prs {
+		if pr == nil {
+			continue
+		}
+		openedAt := pr.CreatedAt
+		if openedAt.IsZero() {
+			openedAt = time.Now()
+		}
+		tracked = append(tracked, &TrackedPR{
+			RunID:       run.ID,
+			Workflow:    run.Name,
+			Branch:      run.Branch,
+			FailureType: failureType,
+			Number:      pr.Number,
+			URL:         pr.URL,
+			State:       TrackedPROpen,
+			OpenedAt:    openedAt,
+		})
+	}
+	if err := tracker.track(tracked...); err != nil {
+		m.logger.WithError(err).Warn("Failed to save PR tracking state")
+	}
+}
+
+// ReconcilePRs checks the fix PRs opened by the agent, and the open fix PRs whose metadata
+// names the run they fix. Merged and closed PRs are recorded in the metrics, and open PRs
+// superseded by a fix for a newer failed run of the same workflow and branch are closed with
+// a comment pointing at the newer PR. Merged PRs are verified once their workflow ran at the
+// merge commit.
+func (m *DaggerAutofix) ReconcilePRs(ctx context.Context) error {
+	if m.prEngine == nil {
+		return ErrNotInitialized
+	}
+	tracker, err := m.prTracking()
+	if err != nil {
+		return err
+	}
+	if m.githubClient != nil {
+		m.adoptUntrackedPRs(ctx, tracker)
+	}
+
+	var stillOpen []TrackedPR
+	for _, tracked := range tracker.openPRs() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		status, err := m.prEngine.GetPRStatus(ctx, tracked.Number)
+		if err != nil {
+			m.logger.WithError(err).WithField("pr_number", tracked.Number).Warn("Failed to get fix PR status")
+			continue
+		}
+		if status.State != "closed" {
+			stillOpen = append(stillOpen, tracked)
+			continue
+		}
+
+		outcome := TrackedPRClosed
+		if status.Merged {
+			outcome = TrackedPRMerged
+		}
+		m.logger.WithFields(logrus.Fields{
+			"pr_number": tracked.Number,
+			"run_id":    tracked.RunID,
+			"outcome":   outcome,
+		}).Info("Fix pull request resolved")
+		if err := tracker.resolve(tracked.Number, outcome, time.Now()); err != nil {
+			return err
+		}
+		if status.Merged {
+			if err := tracker.verify(tracked.Number, VerificationPending, status.MergeCommitSHA, 0); err != nil {
+				return err
+			}
+		}
+		m.resolveFixHistory(tracked.Number, status.Merged)
+	}
+
+	if err := m.closeSupersededPRs(ctx, tracker, stillOpen); err != nil {
+		return err
+	}
+	return m.verifyMergedFixes(ctx, tracker)
+}
+
+// closeSupersededPRs closes open PRs whose workflow and branch have a fix PR for a newer run.
+// open must be sorted oldest run first.
+func (m *DaggerAutofix) closeSupersededPRs(ctx context.Context, tracker *prTracker, open []TrackedPR) error {
+	type workflowKey struct{ workflow, branch string }
+	latest := make(map[workflowKey]TrackedPR)
+	for _, tracked := range open {
+		latest[workflowKey{tracked.Workflow, tracked.Branch}] = tracked
+	}
+
+	for _, tracked := range open {
+		newer := latest[workflowKey{tracked.Workflow, tracked.Branch}]
+		if tracked.Workflow == "" || newer.RunID <= tracked.RunID {
+			continue
+		}
+
+		comment := fmt.Sprintf("🤖 Closing this fix because the %s workflow failed again in run #%d, which is fixed by #%d.",
+			tracked.Workflow, newer.RunID, newer.Number)
+		if err := m.prEngine.ClosePR(ctx, tracked.Number, comment); err != nil {
+			m.logger.WithError(err).WithField("pr_number", tracked.Number).Warn("Failed to close superseded fix PR")
+			continue
+		}
+		m.logger.WithFields(logrus.Fields{
+			"pr_number":     tracked.Number,
+			"superseded_by": newer.Number,
+		}).Info("Closed superseded fix pull request")
+		m.auditLog.Record(tracked.RunID, "", AuditPRClosed, map[string]interface{}{
+			"number":        tracked.Number,
+			"url":           tracked.URL,
+			"reason":        "superseded",
+			"superseded_by": newer.Number,
+		})
+		if err := tracker.resolve(tracked.Number, TrackedPRSuperseded, time.Now()); err != nil {
+			return err
+		}
+		m.resolveFixHistory(tracked.Number, false)
+	}
+	return nil
+}
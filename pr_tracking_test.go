@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// trackingAutofix builds a module whose fixes open PR #<runID> for the named workflow run
+func trackingAutofix(stateFile string, statuses map[int]*PullRequest, closed map[int]string) *DaggerAutofix {
+	m := fixtureAutofix(nil)
+	m.StateFile = stateFile
+	m.githubClient.(*mockGitHub).getWorkflowRunFunc = func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+		return &WorkflowRun{ID: runID, Name: "CI", Branch: "main", CommitSHA: "abc123"}, nil
+	}
+	m.prEngine = &mockPullRequestEngine{
+		createWithOptionsFunc: func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error) {
+			number := int(analysis.Context.WorkflowRun.ID)
+			return &PullRequest{Number: number, State: "open"}, nil
+		},
+		getPRStatusFunc: func(ctx context.Context, prNumber int) (*PullRequest, error) {
+			if status, ok := statuses[prNumber]; ok {
+				return status, nil
+			}
+			return &PullRequest{Number: prNumber, State: "open"}, nil
+		},
+		closePRFunc: func(ctx context.Context, prNumber int, reason string) error {
+			closed[prNumber] = reason
+			return nil
+		},
+	}
+	return m
+}
+
+// TestReconcilePRsClosesSupersededPRs tests closing fix PRs of older runs of the same workflow
+func TestReconcilePRsClosesSupersededPRs(t *testing.T) {
+	ctx := context.Background()
+	closed := make(map[int]string)
+	m := trackingAutofix("", nil, closed)
+
+	_, err := m.AutoFix(ctx, 100)
+	require.NoError(t, err)
+	_, err = m.AutoFix(ctx, 101)
+	require.NoError(t, err)
+
+	// A fix for another workflow on the same branch is not superseded
+	m.trackPRs(&WorkflowRun{ID: 90, Name: "Lint", Branch: "main"}, TestFailure, []*PullRequest{{Number: 90}})
+	// Neither is a fix for the same workflow on another branch
+	m.trackPRs(&WorkflowRun{ID: 95, Name: "CI", Branch: "release"}, TestFailure, []*PullRequest{{Number: 95}})
+
+	require.NoError(t, m.ReconcilePRs(ctx))
+	require.Len(t, closed, 1)
+	assert.Contains(t, closed[100], "run #101")
+	assert.Contains(t, closed[100], "fixed by #101")
+
+	metrics, err := m.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, metrics.SupersededFixPRs)
+	assert.Equal(t, 3, metrics.OpenFixPRs)
+	assert.Equal(t, 0, metrics.SuccessfulFixes, "opening a PR is not a successful fix")
+
+	// Superseded PRs are not closed again
+	require.NoError(t, m.ReconcilePRs(ctx))
+	assert.Len(t, closed, 1)
+}
+
+// TestReconcilePRsRecordsOutcomes tests that merged PRs count as successful fixes and
+// PRs closed without merging as failed ones
+func TestReconcilePRsRecordsOutcomes(t *testing.T) {
+	ctx := context.Background()
+	stateFile := filepath.Join(t.TempDir(), "autofix-state.json")
+	statuses := map[int]*PullRequest{
+		100: {Number: 100, State: "closed", Merged: true},
+		200: {Number: 200, State: "closed"},
+	}
+	closed := make(map[int]string)
+	m := trackingAutofix(stateFile, statuses, closed)
+
+	_, err := m.AutoFix(ctx, 100)
+	require.NoError(t, err)
+	m.trackPRs(&WorkflowRun{ID: 200, Name: "Lint", Branch: "main"}, TestFailure, []*PullRequest{{Number: 200}})
+	m.trackPRs(&WorkflowRun{ID: 300, Name: "Deploy", Branch: "main"}, TestFailure, []*PullRequest{{Number: 300}})
+
+	require.NoError(t, m.ReconcilePRs(ctx))
+	assert.Empty(t, closed)
+
+	metrics, err := m.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, metrics.SuccessfulFixes)
+	assert.Equal(t, 1, metrics.FailedFixes)
+	assert.Equal(t, 1, metrics.OpenFixPRs)
+
+	t.Run("PersistedAcrossRestarts", func(t *testing.T) {
+		restarted := trackingAutofix(stateFile, nil, closed)
+		metrics, err := restarted.GetMetrics(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, metrics.SuccessfulFixes)
+		assert.Equal(t, 1, metrics.FailedFixes)
+
+		tracker, err := restarted.prTracking()
+		require.NoError(t, err)
+		open := tracker.openPRs()
+		require.Len(t, open, 1)
+		assert.Equal(t, TrackedPR{RunID: 300, Workflow: "Deploy", Branch: "main", FailureType: TestFailure, Number: 300, State: TrackedPROpen, OpenedAt: open[0].OpenedAt}, open[0])
+	})
+}
+
+// TestLoadPRTracker tests reading the state file
+func TestLoadPRTracker(t *testing.T) {
+	dir := t.TempDir()
+
+	tracker, err := loadPRTracker(filepath.Join(dir, "missing.json"))
+	require.NoError(t, err)
+	assert.Empty(t, tracker.openPRs())
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	require.NoError(t, os.WriteFile(corrupt, []byte("{"), 0o644))
+	_, err = loadPRTracker(corrupt)
+	assert.ErrorContains(t, err, "failed to parse state file")
+
+	m := &DaggerAutofix{}
+	assert.ErrorContains(t, m.ReconcilePRs(context.Background()), "module not initialized")
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+)
+
+// PreflightStatus is the outcome of a preflight check
+type PreflightStatus string
+
+const (
+	PreflightPass PreflightStatus = "pass"
+	PreflightWarn PreflightStatus = "warn" // the agent runs, but some fixes or features will fail
+	PreflightFail PreflightStatus = "fail" // the agent cannot run until this is fixed
+)
+
+// preflightTimeout bounds each network request of the preflight checks
+const preflightTimeout = 15 * time.Second
+
+// Preflight check IDs
+const (
+	CheckConfiguration  = "configuration"
+	CheckNetwork        = "network"
+	CheckGitHubToken    = "github_token"
+	CheckRepository     = "repository"
+	CheckActionsRead    = "actions_read"
+	CheckContentsWrite  = "contents_write"
+	CheckPullRequests   = "pull_requests_write"
+	CheckActionsEnabled = "actions_enabled"
+	CheckLLMProvider    = "llm_provider"
+	CheckDaggerEngine   = "dagger_engine"
+)
+
+// PreflightCheck is the finding of one preflight check
+type PreflightCheck struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Status      PreflightStatus `json:"status"`
+	Detail      string          `json:"detail"`
+	Remediation string          `json:"remediation,omitempty"`
+}
+
+// PreflightReport is the outcome of Preflight. Status is the worst status of the checks.
+type PreflightReport struct {
+	Status    PreflightStatus  `json:"status"`
+	Checks    []PreflightCheck `json:"checks"`
+	Timestamp time.Time        `json:"timestamp"`
+}
+
+// Check returns the finding of the check with id, nil when it did not run
+func (r *PreflightReport) Check(id string) *PreflightCheck {
+	for i := range r.Checks {
+		if r.Checks[i].ID == id {
+			return &r.Checks[i]
+		}
+	}
+	return nil
+}
+
+// add records a finding and keeps Status at the worst one
+func (r *PreflightReport) add(check PreflightCheck) {
+	r.Checks = append(r.Checks, check)
+	if check.Status == PreflightFail || (check.Status == PreflightWarn && r.Status == PreflightPass) {
+		r.Status = check.Status
+	}
+}
+
+// count returns how many checks have status
+func (r *PreflightReport) count(status PreflightStatus) int {
+	n := 0
+	for _, check := range r.Checks {
+		if check.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Overridden in tests: the client of the network egress check and the containers of the
+// Dagger engine check
+var (
+	preflightHTTPClient  = &http.Client{Timeout: preflightTimeout}
+	newContainerProvider = func() ContainerProvider { return &RealContainerProvider{} }
+)
+
+// Preflight checks everything the agent needs before it runs: the configuration, outbound
+// HTTPS to GitHub and the LLM provider, the GitHub token and its permissions on the
+// repository, Actions being enabled, the LLM provider with a one token completion, and the
+// Dagger engine. Every check runs, except the GitHub checks needing a token GitHub accepted,
+// and each problem comes with a remediation hint. It does not need Initialize and changes
+// nothing; the error is only returned when ctx is done.
+func (m *DaggerAutofix) Preflight(ctx context.Context) (*PreflightReport, error) {
+	report := &PreflightReport{Status: PreflightPass}
+
+	if err := m.validateConfiguration(); err != nil {
+		report.add(PreflightCheck{ID: CheckConfiguration, Name: "Configuration", Status: PreflightFail,
+			Detail: err.Error(), Remediation: "fix the setting named above, config validate lists every problem"})
+	} else {
+		report.add(PreflightCheck{ID: CheckConfiguration, Name: "Configuration", Status: PreflightPass, Detail: "valid"})
+	}
+	report.add(m.checkNetwork(ctx))
+	if !m.LogsOnly {
+		m.checkGitHub(ctx, report)
+	}
+	report.add(m.checkLLMProvider(ctx))
+	report.add(checkDaggerEngine(ctx))
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	report.Timestamp = time.Now()
+	return report, nil
+}
+
+// checkNetwork checks that the GitHub API and the LLM provider answer HTTPS requests. Any
+// HTTP response counts: the other checks tell whether the credentials are accepted.
+func (m *DaggerAutofix) checkNetwork(ctx context.Context) PreflightCheck {
+	check := PreflightCheck{ID: CheckNetwork, Name: "Network egress"}
+	var endpoints []string
+	if !m.LogsOnly && !m.MCPEnabled {
+		endpoints = append(endpoints, valueOr(m.GitHubAPIURL, "https://"+publicGitHubAPIHost))
+	}
+	endpoints = append(endpoints, getProviderBaseURL(m.LLMProvider))
+
+	var reached, unreachable []string
+	for _, endpoint := range endpoints {
+		host := endpoint
+		if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		reqCtx, cancel := context.WithTimeout(ctx, preflightTimeout)
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, endpoint, nil)
+		if err == nil {
+			var resp *http.Response
+			if resp, err = preflightHTTPClient.Do(req); err == nil {
+				resp.Body.Close()
+			}
+		}
+		cancel()
+		if err != nil {
+			unreachable = append(unreachable, fmt.Sprintf("%s (%v)", host, err))
+			continue
+		}
+		reached = append(reached, host)
+	}
+
+	if len(unreachable) > 0 {
+		check.Status = PreflightFail
+		check.Detail = "cannot reach " + strings.Join(unreachable, ", ")
+		check.Remediation = "allow outbound HTTPS to these hosts, or set HTTPS_PROXY when a proxy is required"
+		return check
+	}
+	check.Status = PreflightPass
+	check.Detail = "reached " + strings.Join(reached, ", ")
+	return check
+}
+
+// checkGitHub checks the token, the repository and the token's permissions on it
+func (m *DaggerAutofix) checkGitHub(ctx context.Context, report *PreflightReport) {
+	token := PreflightCheck{ID: CheckGitHubToken, Name: "GitHub token"}
+	if m.MCPEnabled {
+		token.Status = PreflightWarn
+		token.Detail = "not checked, GitHub is accessed through the MCP server"
+		token.Remediation = "run test connection to check the MCP server's GitHub access"
+		report.add(token)
+		return
+	}
+
+	var g *GitHubIntegration
+	var err error
+	switch {
+	case m.GitHubApp != nil:
+		g, err = newGitHubAppIntegration(ctx, m.GitHubApp, m.RepoOwner, m.RepoName, m.githubEndpoints(), m.logger)
+	case m.GitHubToken != nil:
+		g, err = newGitHubIntegration(ctx, m.GitHubToken, m.RepoOwner, m.RepoName, m.githubEndpoints(), m.logger)
+	default:
+		err = errors.New("no GitHub token is configured")
+	}
+	var scopes []string
+	var classic bool
+	if err == nil {
+		g.SetRateLimitRetries(0)
+		scopes, classic, err = g.tokenScopes(ctx)
+	}
+	if err != nil {
+		token.Status = PreflightFail
+		token.Detail = err.Error()
+		token.Remediation = valueOr(errorHint(err), "set --github-token or GITHUB_TOKEN to a personal access token")
+		if m.GitHubApp != nil {
+			token.Remediation = "check the GitHub App ID, installation ID and private key, and that the app is installed on the repository"
+		}
+		report.add(token)
+		return
+	}
+	token.Status = PreflightPass
+	switch {
+	case m.GitHubApp != nil:
+		token.Detail = "GitHub App installation token accepted"
+	case classic:
+		token.Detail = "classic token accepted, scopes: " + valueOr(strings.Join(scopes, ", "), "none")
+	default:
+		token.Detail = "fine-grained token accepted"
+	}
+	report.add(token)
+
+	if m.RepoName == "" {
+		return
+	}
+	name := m.RepoOwner + "/" + m.RepoName
+	repository := PreflightCheck{ID: CheckRepository, Name: "Repository access"}
+	access, err := g.repositoryAccess(ctx)
+	if err != nil {
+		repository.Status = PreflightFail
+		repository.Detail = fmt.Sprintf("cannot get %s: %v", name, err)
+		repository.Remediation = valueOr(errorHint(err), "check --repo-owner and --repo-name")
+		report.add(repository)
+		return
+	}
+	repository.Status = PreflightPass
+	repository.Detail = fmt.Sprintf("%s found, permission: %s", name, valueOr(access.permission, "not reported"))
+	report.add(repository)
+
+	report.add(checkActionsRead(ctx, g))
+	report.add(checkContentsWrite(access, scopes, classic))
+	report.add(checkPullRequests(ctx, g, access, scopes, classic))
+
+	enabled := PreflightCheck{ID: CheckActionsEnabled, Name: "Actions enabled"}
+	switch on, err := g.ActionsEnabled(ctx, m.RepoOwner, m.RepoName); {
+	case err != nil:
+		enabled.Status = PreflightWarn
+		enabled.Detail = err.Error()
+		enabled.Remediation = "check the Actions settings of the repository"
+	case !on:
+		enabled.Status = PreflightFail
+		enabled.Detail = "GitHub Actions is disabled for " + name
+		enabled.Remediation = "enable Actions under Settings > Actions > General, there are no workflow runs to fix otherwise"
+	default:
+		enabled.Status = PreflightPass
+		enabled.Detail = "enabled"
+	}
+	report.add(enabled)
+}
+
+// checkActionsRead checks that the token can list workflow runs
+func checkActionsRead(ctx context.Context, g *GitHubIntegration) PreflightCheck {
+	check := PreflightCheck{ID: CheckActionsRead, Name: "Permission actions:read"}
+	if _, err := g.HasWorkflowRuns(ctx, g.repoOwner, g.repoName); err != nil {
+		check.Status = PreflightFail
+		check.Detail = err.Error()
+		check.Remediation = "grant the token the Actions read permission (the repo scope for classic tokens)"
+		return check
+	}
+	check.Status = PreflightPass
+	check.Detail = "workflow runs can be listed"
+	return check
+}
+
+// checkContentsWrite checks that the token can push fix branches. Pushing changes to workflow
+// files also needs the workflow scope on classic tokens.
+func checkContentsWrite(access *repoAccess, scopes []string, classic bool) PreflightCheck {
+	check := PreflightCheck{ID: CheckContentsWrite, Name: "Permission contents:write"}
+	switch {
+	case access.permission != "" && !access.canPush():
+		check.Status = PreflightFail
+		check.Detail = fmt.Sprintf("the token has %s permission, fix branches need write", access.permission)
+		check.Remediation = "grant the token's user or app write access to the repository"
+	case classic && !hasRepoScope(scopes, access.private):
+		check.Status = PreflightFail
+		check.Detail = "the token lacks the repo scope"
+		check.Remediation = "add the repo scope to the token"
+	case classic && !slices.Contains(scopes, "workflow"):
+		check.Status = PreflightWarn
+		check.Detail = "the token lacks the workflow scope, fixes changing .github/workflows cannot be pushed"
+		check.Remediation = "add the workflow scope to the token"
+	default:
+		check.Status = PreflightPass
+		check.Detail = "fix branches can be pushed"
+	}
+	return check
+}
+
+// checkPullRequests checks that the token can open pull requests. Only classic tokens report
+// their scopes, so for other tokens reading pull requests is checked and writing them is
+// confirmed when the first fix pull request is opened.
+func checkPullRequests(ctx context.Context, g *GitHubIntegration, access *repoAccess, scopes []string, classic bool) PreflightCheck {
+	check := PreflightCheck{ID: CheckPullRequests, Name: "Permission pull_requests:write"}
+	if classic && !hasRepoScope(scopes, access.private) {
+		check.Status = PreflightFail
+		check.Detail = "the token lacks the repo scope"
+		check.Remediation = "add the repo scope to the token"
+		return check
+	}
+	if err := g.listPullRequest(ctx); err != nil {
+		check.Status = PreflightFail
+		check.Detail = err.Error()
+		check.Remediation = "grant the token the Pull requests read and write permission"
+		return check
+	}
+	check.Status = PreflightPass
+	check.Detail = "pull requests can be opened"
+	if !classic {
+		check.Detail = "pull requests can be listed, the write permission is confirmed by the first fix pull request"
+	}
+	return check
+}
+
+// hasRepoScope reports whether classic token scopes grant access to a repository's contents
+// and pull requests
+func hasRepoScope(scopes []string, private bool) bool {
+	return slices.Contains(scopes, "repo") || (!private && slices.Contains(scopes, "public_repo"))
+}
+
+// checkLLMProvider checks the API key and model with a one token completion
+func (m *DaggerAutofix) checkLLMProvider(ctx context.Context) PreflightCheck {
+	check := PreflightCheck{ID: CheckLLMProvider, Name: "LLM provider"}
+	if m.LLMAPIKey == nil {
+		check.Status = PreflightFail
+		check.Detail = "no LLM API key is configured"
+		check.Remediation = "set --llm-api-key or LLM_API_KEY"
+		return check
+	}
+	client, err := newLLMClient(withLLMHeaders(ctx, llmHeaderMap(m.LLMHeaders)), m.LLMProvider, m.LLMAPIKey, m.logger)
+	var resp *LLMResponse
+	if err == nil {
+		resp, err = client.probe(ctx, m.AnalysisModel)
+	}
+	if err != nil {
+		check.Status = PreflightFail
+		if errors.Is(err, ErrLLMRateLimited) {
+			check.Status = PreflightWarn
+		}
+		check.Detail = fmt.Sprintf("%s: %v", m.LLMProvider, err)
+		check.Remediation = valueOr(errorHint(err), "check --llm-provider and that the provider is reachable")
+		return check
+	}
+	check.Status = PreflightPass
+	check.Detail = fmt.Sprintf("%s model %s answered", m.LLMProvider, valueOr(resp.Model, client.config.Model))
+	return check
+}
+
+// checkDaggerEngine checks that the Dagger engine starts the container fixes are validated in
+func checkDaggerEngine(ctx context.Context) PreflightCheck {
+	check := PreflightCheck{ID: CheckDaggerEngine, Name: "Dagger engine", Status: PreflightFail,
+		Remediation: "run the agent with dagger call or dagger run, and check that the engine is up with dagger core version"}
+	provider := newContainerProvider()
+	if _, ok := provider.(*RealContainerProvider); ok && dag == nil {
+		check.Detail = "not connected to a Dagger engine"
+		return check
+	}
+	_, output, err := provider.CreateContainer().From(workspaceImage).Exec(ctx, []string{"git", "--version"})
+	switch {
+	case err != nil:
+		check.Detail = fmt.Sprintf("cannot start a %s container: %v", workspaceImage, err)
+	case output.ExitCode != 0:
+		check.Detail = fmt.Sprintf("a %s container exited with code %d: %s", workspaceImage, output.ExitCode, firstLine(output.Stderr))
+	default:
+		check.Status = PreflightPass
+		check.Remediation = ""
+		check.Detail = "started a " + workspaceImage + " container"
+	}
+	return check
+}
+
+// repoAccess is what the token may do in the repository
+type repoAccess struct {
+	permission string // admin, maintain, write, triage or read, empty when GitHub did not say
+	private    bool
+}
+
+func (a *repoAccess) canPush() bool {
+	return a.permission == "admin" || a.permission == "maintain" || a.permission == "write"
+}
+
+// tokenScopes checks that GitHub accepts the token and returns the scopes of classic tokens,
+// which GitHub lists in the X-OAuth-Scopes header. Fine-grained and app tokens have none.
+func (g *GitHubIntegration) tokenScopes(ctx context.Context) ([]string, bool, error) {
+	var header http.Header
+	_, err := callGitHub(ctx, g, func() (*github.RateLimits, *github.Response, error) {
+		limits, resp, err := g.client.RateLimits(ctx)
+		if resp != nil {
+			header = resp.Header
+		}
+		return limits, resp, err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	values, classic := header[http.CanonicalHeaderKey("X-OAuth-Scopes")]
+	var scopes []string
+	for _, value := range values {
+		for _, scope := range strings.Split(value, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes, classic, nil
+}
+
+// repositoryAccess returns the token's permission on the repository
+func (g *GitHubIntegration) repositoryAccess(ctx context.Context) (*repoAccess, error) {
+	repo, err := callGitHub(ctx, g, func() (*github.Repository, *github.Response, error) {
+		return g.client.Repositories.Get(ctx, g.repoOwner, g.repoName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	access := &repoAccess{private: repo.GetPrivate()}
+	permissions := repo.GetPermissions()
+	for _, level := range []struct{ key, name string }{
+		{"admin", "admin"}, {"maintain", "maintain"}, {"push", "write"}, {"triage", "triage"}, {"pull", "read"},
+	} {
+		if permissions[level.key] {
+			access.permission = level.name
+			break
+		}
+	}
+	return access, nil
+}
+
+// listPullRequest lists a single pull request of the repository
+func (g *GitHubIntegration) listPullRequest(ctx context.Context) error {
+	_, err := callGitHub(ctx, g, func() ([]*github.PullRequest, *github.Response, error) {
+		return g.client.PullRequests.List(ctx, g.repoOwner, g.repoName, &github.PullRequestListOptions{
+			ListOptions: github.ListOptions{PerPage: 1},
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pull requests: %w", err)
+	}
+	return nil
+}
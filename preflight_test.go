@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// transportFunc answers the requests of an http.Client
+type transportFunc func(*http.Request) (*http.Response, error)
+
+func (f transportFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// preflightDeps are the answers of the dependencies checked by Preflight, all healthy unless
+// a test breaks one
+type preflightDeps struct {
+	tokenStatus    int
+	scopes         string
+	repoStatus     int
+	repository     string
+	runsStatus     int
+	pullsStatus    int
+	actionsEnabled bool
+	llmStatus      int
+	unreachable    string
+	daggerDown     bool
+}
+
+func healthyPreflightDeps() *preflightDeps {
+	return &preflightDeps{
+		tokenStatus:    http.StatusOK,
+		scopes:         "repo, workflow",
+		repoStatus:     http.StatusOK,
+		repository:     `{"private": true, "permissions": {"admin": false, "push": true, "pull": true}}`,
+		runsStatus:     http.StatusOK,
+		pullsStatus:    http.StatusOK,
+		actionsEnabled: true,
+		llmStatus:      http.StatusOK,
+	}
+}
+
+// preflightAutofix returns an agent whose GitHub API, LLM provider, network and Dagger engine
+// answer as deps say
+func preflightAutofix(t *testing.T, deps *preflightDeps) *DaggerAutofix {
+	gh, mux := newMockGitHubAPI(t)
+	reply := func(status int, body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			fmt.Fprint(w, body)
+		}
+	}
+	mux.HandleFunc("/rate_limit", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-OAuth-Scopes", deps.scopes)
+		reply(deps.tokenStatus, `{"resources": {}}`)(w, r)
+	})
+	mux.HandleFunc("/repos/owner/repo", func(w http.ResponseWriter, r *http.Request) {
+		reply(deps.repoStatus, deps.repository)(w, r)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+		reply(deps.runsStatus, `{"total_count": 1, "workflow_runs": [{"id": 7}]}`)(w, r)
+	})
+	mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		reply(deps.pullsStatus, `[]`)(w, r)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/permissions", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"enabled": %t}`, deps.actionsEnabled)
+	})
+
+	llm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if deps.llmStatus != http.StatusOK {
+			w.WriteHeader(deps.llmStatus)
+			fmt.Fprint(w, `{"error": {"message": "Incorrect API key provided"}}`)
+			return
+		}
+		fmt.Fprint(w, mockResponses[OpenAI])
+	}))
+	t.Cleanup(llm.Close)
+
+	oldGH, oldLLM, oldHTTP, oldContainers := newGitHubIntegration, newLLMClient, preflightHTTPClient, newContainerProvider
+	t.Cleanup(func() {
+		newGitHubIntegration, newLLMClient, preflightHTTPClient, newContainerProvider = oldGH, oldLLM, oldHTTP, oldContainers
+	})
+	newGitHubIntegration = func(ctx context.Context, token *dagger.Secret, owner, name string, endpoints *GitHubEndpoints, logger *logrus.Logger) (*GitHubIntegration, error) {
+		return gh, nil
+	}
+	newLLMClient = func(ctx context.Context, provider LLMProvider, apiKey *dagger.Secret, logger *logrus.Logger) (*LLMClient, error) {
+		client := createTestClient(provider, llm.URL)
+		client.logger = quietLogger()
+		return client, nil
+	}
+	preflightHTTPClient = &http.Client{Transport: transportFunc(func(r *http.Request) (*http.Response, error) {
+		if r.URL.Host == deps.unreachable {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: r}, nil
+	})}
+	newContainerProvider = func() ContainerProvider {
+		provider := NewMockContainerProvider()
+		provider.MockContainer.ShouldFail = deps.daggerDown
+		provider.MockContainer.FailureMessage = "engine not running"
+		return provider
+	}
+
+	m := New().
+		WithGitHubToken(createTestSecret("token", "ghp_test")).
+		WithLLMProvider("openai", createTestSecret("key", "sk-test")).
+		WithRepository("owner", "repo")
+	m.logger = quietLogger()
+	return m
+}
+
+// TestPreflightHealthy tests that every check passes when every dependency is healthy
+func TestPreflightHealthy(t *testing.T) {
+	report, err := preflightAutofix(t, healthyPreflightDeps()).Preflight(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, PreflightPass, report.Status)
+
+	var ids []string
+	for _, check := range report.Checks {
+		ids = append(ids, check.ID)
+		assert.Equal(t, PreflightPass, check.Status, "%s: %s", check.ID, check.Detail)
+		assert.Empty(t, check.Remediation, check.ID)
+	}
+	assert.Equal(t, []string{CheckConfiguration, CheckNetwork, CheckGitHubToken, CheckRepository, CheckActionsRead,
+		CheckContentsWrite, CheckPullRequests, CheckActionsEnabled, CheckLLMProvider, CheckDaggerEngine}, ids)
+	assert.Equal(t, "owner/repo found, permission: write", report.Check(CheckRepository).Detail)
+	assert.Equal(t, "reached api.github.com, api.openai.com", report.Check(CheckNetwork).Detail)
+	assert.Nil(t, report.Check("unknown"))
+}
+
+// TestPreflightFailingDependency tests that each dependency failing on its own is reported by
+// its check, with a remediation, while the other checks still run
+func TestPreflightFailingDependency(t *testing.T) {
+	tests := []struct {
+		name   string
+		breaks func(*preflightDeps)
+		check  string
+		status PreflightStatus
+		detail string
+		// problems counts the checks reporting a problem when more than this one does
+		problems int
+	}{
+		{
+			name:   "token rejected",
+			breaks: func(d *preflightDeps) { d.tokenStatus = http.StatusUnauthorized },
+			check:  CheckGitHubToken,
+			status: PreflightFail,
+		},
+		{
+			name:   "repository not found",
+			breaks: func(d *preflightDeps) { d.repoStatus = http.StatusNotFound },
+			check:  CheckRepository,
+			status: PreflightFail,
+		},
+		{
+			name:   "read permission",
+			breaks: func(d *preflightDeps) { d.repository = `{"permissions": {"pull": true}}` },
+			check:  CheckContentsWrite,
+			status: PreflightFail,
+			detail: "the token has read permission, fix branches need write",
+		},
+		{
+			name:     "public_repo scope on a private repository",
+			breaks:   func(d *preflightDeps) { d.scopes = "public_repo, workflow" },
+			check:    CheckPullRequests,
+			status:   PreflightFail,
+			detail:   "the token lacks the repo scope",
+			problems: 2,
+		},
+		{
+			name:   "no workflow scope",
+			breaks: func(d *preflightDeps) { d.scopes = "repo" },
+			check:  CheckContentsWrite,
+			status: PreflightWarn,
+		},
+		{
+			name:   "workflow runs forbidden",
+			breaks: func(d *preflightDeps) { d.runsStatus = http.StatusForbidden },
+			check:  CheckActionsRead,
+			status: PreflightFail,
+		},
+		{
+			name:   "pull requests forbidden",
+			breaks: func(d *preflightDeps) { d.pullsStatus = http.StatusForbidden },
+			check:  CheckPullRequests,
+			status: PreflightFail,
+		},
+		{
+			name:   "actions disabled",
+			breaks: func(d *preflightDeps) { d.actionsEnabled = false },
+			check:  CheckActionsEnabled,
+			status: PreflightFail,
+			detail: "GitHub Actions is disabled for owner/repo",
+		},
+		{
+			name:   "LLM key rejected",
+			breaks: func(d *preflightDeps) { d.llmStatus = http.StatusUnauthorized },
+			check:  CheckLLMProvider,
+			status: PreflightFail,
+		},
+		{
+			name:   "LLM provider unreachable",
+			breaks: func(d *preflightDeps) { d.unreachable = "api.openai.com" },
+			check:  CheckNetwork,
+			status: PreflightFail,
+			detail: "cannot reach api.openai.com (Get \"https://api.openai.com\": connection refused)",
+		},
+		{
+			name:   "Dagger engine down",
+			breaks: func(d *preflightDeps) { d.daggerDown = true },
+			check:  CheckDaggerEngine,
+			status: PreflightFail,
+			detail: "cannot start a " + workspaceImage + " container: mock container failed: engine not running",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deps := healthyPreflightDeps()
+			tt.breaks(deps)
+			report, err := preflightAutofix(t, deps).Preflight(context.Background())
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.status, report.Status)
+			check := report.Check(tt.check)
+			require.NotNil(t, check)
+			assert.Equal(t, tt.status, check.Status, check.Detail)
+			assert.NotEmpty(t, check.Remediation)
+			if tt.detail != "" {
+				assert.Equal(t, tt.detail, check.Detail)
+			}
+			assert.Equal(t, max(tt.problems, 1), report.count(PreflightFail)+report.count(PreflightWarn))
+			assert.Equal(t, PreflightPass, report.Check(CheckConfiguration).Status)
+			assert.NotNil(t, report.Check(CheckDaggerEngine), "later checks still run")
+		})
+	}
+}
+
+// TestPreflightMissingCredentials tests that missing credentials fail their checks instead of
+// stopping the preflight
+func TestPreflightMissingCredentials(t *testing.T) {
+	m := preflightAutofix(t, healthyPreflightDeps())
+	m.GitHubToken = nil
+	m.LLMAPIKey = nil
+
+	report, err := m.Preflight(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, PreflightFail, report.Status)
+	assert.Equal(t, PreflightFail, report.Check(CheckConfiguration).Status)
+	assert.Equal(t, "no GitHub token is configured", report.Check(CheckGitHubToken).Detail)
+	assert.Nil(t, report.Check(CheckRepository), "repository checks need an accepted token")
+	assert.Equal(t, "no LLM API key is configured", report.Check(CheckLLMProvider).Detail)
+	assert.Equal(t, PreflightPass, report.Check(CheckDaggerEngine).Status)
+}
+
+// TestPreflightExitCode tests that doctor exits with the worst status of the checks
+func TestPreflightExitCode(t *testing.T) {
+	assert.Equal(t, exitChecksFailed, exitCode(checkFailure{errors.New("1 preflight check(s) failed")}))
+	assert.Equal(t, exitPreflightWarnings, exitCode(preflightWarnings{errors.New("1 preflight check(s) warned")}))
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ProgressStage names the part of an AutoFix run a ProgressEvent reports on
+type ProgressStage string
+
+const (
+	ProgressAnalyzing       ProgressStage = "analyzing"
+	ProgressGeneratingFixes ProgressStage = "generating_fixes"
+	ProgressValidatingFix   ProgressStage = "validating_fix"
+	ProgressCreatingPR      ProgressStage = "creating_pr"
+)
+
+// ProgressEvent reports that an AutoFix run reached a stage boundary
+type ProgressEvent struct {
+	RunID int64         `json:"run_id,omitempty"`
+	Stage ProgressStage `json:"stage"`
+	// Step is the test pipeline stage (lint, build, test, coverage or workflow) while a fix
+	// is validated
+	Step string `json:"step,omitempty"`
+	// Index and Total count the items of the stage, e.g. fix 2 of 3, and are 0 when the
+	// stage has a single item
+	Index     int       `json:"index,omitempty"`
+	Total     int       `json:"total,omitempty"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// progressContextKey stores the progressReporter of a run in its context
+type progressContextKey struct{}
+
+// progressReporter calls the progress func of a run, counting the stage's items
+type progressReporter struct {
+	report func(ProgressEvent)
+	mu     *sync.Mutex // shared by the numbered copies, so fixes validated in parallel report one at a time
+	logger *logrus.Logger
+	runID  int64
+	index  int
+	total  int
+}
+
+// withProgress returns ctx reporting the progress of runID to report, unless report is nil
+// or ctx already reports progress
+func withProgress(ctx context.Context, report func(ProgressEvent), logger *logrus.Logger, runID int64) context.Context {
+	if report == nil {
+		return ctx
+	}
+	if _, ok := ctx.Value(progressContextKey{}).(*progressReporter); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, progressContextKey{}, &progressReporter{report: report, mu: &sync.Mutex{}, logger: logger, runID: runID})
+}
+
+// withProgressIndex returns ctx numbering the events it reports as item index of total
+func withProgressIndex(ctx context.Context, index, total int) context.Context {
+	reporter, ok := ctx.Value(progressContextKey{}).(*progressReporter)
+	if !ok {
+		return ctx
+	}
+	numbered := *reporter
+	numbered.index, numbered.total = index, total
+	return context.WithValue(ctx, progressContextKey{}, &numbered)
+}
+
+// reportProgress sends an event to the progress func of the run in ctx, if any. The func is
+// called directly and never concurrently, so events arrive in order, and a panic in it is
+// logged rather than failing the run.
+func reportProgress(ctx context.Context, stage ProgressStage, step, format string, args ...interface{}) {
+	reporter, ok := ctx.Value(progressContextKey{}).(*progressReporter)
+	if !ok {
+		return
+	}
+	event := ProgressEvent{
+		RunID:     reporter.runID,
+		Stage:     stage,
+		Step:      step,
+		Index:     reporter.index,
+		Total:     reporter.total,
+		Message:   fmt.Sprintf(format, args...),
+		Timestamp: time.Now(),
+	}
+	reporter.mu.Lock()
+	defer reporter.mu.Unlock()
+	defer func() {
+		if r := recover(); r != nil && reporter.logger != nil {
+			reporter.logger.WithField("panic", r).Warn("Progress func panicked, event dropped")
+		}
+	}()
+	reporter.report(event)
+}
+
+// reportStep reports a test pipeline stage starting while a fix is validated
+func reportStep(ctx context.Context, step string) {
+	reportProgress(ctx, ProgressValidatingFix, step, "Running %s", step)
+}
+
+// streamProgressInterval is how often the arrival of a streamed LLM response is reported
+var streamProgressInterval = time.Second
+
+// streamProgress returns the onDelta func of a streamed LLM response, reporting how much of
+// it arrived at most every streamProgressInterval; nil when ctx reports no progress
+func streamProgress(ctx context.Context, stage ProgressStage) func(string) {
+	if _, ok := ctx.Value(progressContextKey{}).(*progressReporter); !ok {
+		return nil
+	}
+	received := 0
+	var reported time.Time
+	return func(delta string) {
+		received += len(delta)
+		if time.Since(reported) < streamProgressInterval {
+			return
+		}
+		reported = time.Now()
+		reportProgress(ctx, stage, "", "Receiving the LLM response (%d characters)", received)
+	}
+}
+
+// progressLabels name the stages in the CLI status line
+var progressLabels = map[ProgressStage]string{
+	ProgressAnalyzing:       "Analyzing",
+	ProgressGeneratingFixes: "Generating fixes",
+	ProgressValidatingFix:   "Validating fix",
+	ProgressCreatingPR:      "Creating pull request",
+}
+
+// String renders the event for the CLI status line, e.g. "Validating fix 2/3: Running test"
+func (e ProgressEvent) String() string {
+	label := valueOr(progressLabels[e.Stage], string(e.Stage))
+	if e.Total > 0 {
+		label += fmt.Sprintf(" %d/%d", e.Index, e.Total)
+	}
+	return label + ": " + e.Message
+}
+
+// stderrIsTerminal reports whether out is a terminal the CLI can rewrite a status line on
+var stderrIsTerminal = func(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	return ok && stdinIsTerminal(f)
+}
+
+// progressPrinter writes the progress of a CLI command to stderr, keeping stdout for the
+// result. Text output is a status line rewritten in place on terminals and a line per event
+// otherwise; the json and yaml formats get one JSON object per event.
+type progressPrinter struct {
+	mu    sync.Mutex
+	out   io.Writer
+	json  bool
+	live  bool
+	shown bool
+}
+
+// newProgressPrinter returns the printer for the command's --progress flag and output
+// format, or nil when no progress is shown. Text output on a terminal shows the status
+// line without the flag.
+func (c *CLI) newProgressPrinter(enabled bool) *progressPrinter {
+	out := c.rootCmd.ErrOrStderr()
+	text := c.outputFormat() == OutputText
+	live := text && stderrIsTerminal(out)
+	if !enabled && !live {
+		return nil
+	}
+	return &progressPrinter{out: out, json: !text, live: live}
+}
+
+// report writes one event; it is the progress func given to the agent
+func (p *progressPrinter) report(event ProgressEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.json:
+		line, err := json.Marshal(event)
+		if err == nil {
+			fmt.Fprintf(p.out, "%s\n", line)
+		}
+	case p.live:
+		// Return to the start of the line and clear it before writing the new status
+		fmt.Fprintf(p.out, "\r\033[K%s", event)
+		p.shown = true
+	default:
+		fmt.Fprintln(p.out, event.String())
+	}
+}
+
+// finish clears the status line before the result is printed. It does nothing on a nil
+// printer, so commands can call it whether progress is shown or not.
+func (p *progressPrinter) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.shown {
+		fmt.Fprint(p.out, "\r\033[K")
+		p.shown = false
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// progressStep is the part of a ProgressEvent the tests compare
+type progressStep struct {
+	stage        ProgressStage
+	index, total int
+	message      string
+}
+
+func progressSteps(events []ProgressEvent) []progressStep {
+	steps := make([]progressStep, 0, len(events))
+	for _, event := range events {
+		steps = append(steps, progressStep{event.Stage, event.Index, event.Total, event.Message})
+	}
+	return steps
+}
+
+// TestAutoFixProgressEvents tests the events of a full AutoFix run validating three fixes,
+// the last of which fails its tests
+func TestAutoFixProgressEvents(t *testing.T) {
+	var prFixes []*FixValidationResult
+	var prOpts []FixPROptions
+	var events []ProgressEvent
+	// Fixes validated one at a time report their events in order
+	m := reviewAutofix(&prFixes, &prOpts).WithMaxParallelValidations(1).WithProgressFunc(func(event ProgressEvent) {
+		events = append(events, event)
+	})
+
+	result, err := m.AutoFix(context.Background(), 42)
+	require.NoError(t, err)
+	require.True(t, result.Success)
+
+	assert.Equal(t, []progressStep{
+		{ProgressAnalyzing, 0, 0, "Analyzing the failed jobs of run 42"},
+		{ProgressGeneratingFixes, 0, 0, "Generating fixes for the failure"},
+		{ProgressValidatingFix, 1, 3, "Validating fix fix1"},
+		{ProgressValidatingFix, 1, 3, "Fix fix1 passed validation"},
+		{ProgressValidatingFix, 2, 3, "Validating fix fix2"},
+		{ProgressValidatingFix, 2, 3, "Fix fix2 passed validation"},
+		{ProgressValidatingFix, 3, 3, "Validating fix fix3"},
+		{ProgressValidatingFix, 3, 3, "Fix fix3 failed validation"},
+		{ProgressCreatingPR, 0, 0, "Opening a pull request for fix fix1"},
+		{ProgressCreatingPR, 0, 0, "Opened pull request #7"},
+	}, progressSteps(events))
+	for _, event := range events {
+		assert.Equal(t, int64(42), event.RunID)
+		assert.False(t, event.Timestamp.IsZero())
+	}
+}
+
+// TestAutoFixProgressFuncPanics tests that a panicking progress func does not stop the run
+func TestAutoFixProgressFuncPanics(t *testing.T) {
+	var prFixes []*FixValidationResult
+	var prOpts []FixPROptions
+	calls := 0
+	m := reviewAutofix(&prFixes, &prOpts).WithProgressFunc(func(event ProgressEvent) {
+		calls++
+		panic("broken progress bar")
+	})
+
+	result, err := m.AutoFix(context.Background(), 1)
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Len(t, prFixes, 1)
+	assert.Equal(t, 10, calls)
+}
+
+// TestRunStageReportsProgress tests that test pipeline stages report their start with the
+// number of the fix being validated
+func TestRunStageReportsProgress(t *testing.T) {
+	var events []ProgressEvent
+	ctx := withProgress(context.Background(), func(event ProgressEvent) { events = append(events, event) }, quietLogger(), 7)
+	ctx = withProgressIndex(ctx, 2, 3)
+
+	for _, stage := range []string{stageLint, stageBuild, stageTest, stageCoverage} {
+		_, err := runStage(ctx, stage, time.Minute, func(ctx context.Context) (string, error) { return "", nil })
+		require.NoError(t, err)
+	}
+	require.Len(t, events, 4)
+	assert.Equal(t, ProgressEvent{RunID: 7, Stage: ProgressValidatingFix, Step: stageTest, Index: 2, Total: 3, Message: "Running test", Timestamp: events[2].Timestamp}, events[2])
+
+	_, err := runStage(context.Background(), stageLint, time.Minute, func(ctx context.Context) (string, error) { return "", nil })
+	assert.NoError(t, err, "stages run without a progress func")
+	assert.Len(t, events, 4)
+}
+
+// TestProgressPrinter tests the status line, the plain lines and the JSON lines of the CLI
+func TestProgressPrinter(t *testing.T) {
+	orig := stderrIsTerminal
+	t.Cleanup(func() { stderrIsTerminal = orig })
+	terminal := false
+	stderrIsTerminal = func(io.Writer) bool { return terminal }
+
+	events := []ProgressEvent{
+		{Stage: ProgressAnalyzing, Message: "Analyzing the failed jobs of run 1"},
+		{Stage: ProgressValidatingFix, Step: stageTest, Index: 2, Total: 3, Message: "Running test"},
+	}
+	printer := func(format string, enabled bool) (*progressPrinter, *bytes.Buffer) {
+		cli, _ := outputCLI(t, format)
+		var stderr bytes.Buffer
+		cli.rootCmd.SetErr(&stderr)
+		return cli.newProgressPrinter(enabled), &stderr
+	}
+
+	p, _ := printer(OutputText, false)
+	assert.Nil(t, p, "no progress without --progress or a terminal")
+	p.finish()
+
+	p, stderr := printer(OutputText, true)
+	for _, event := range events {
+		p.report(event)
+	}
+	p.finish()
+	assert.Equal(t, "Analyzing: Analyzing the failed jobs of run 1\nValidating fix 2/3: Running test\n", stderr.String())
+
+	terminal = true
+	p, stderr = printer(OutputText, false)
+	require.NotNil(t, p)
+	for _, event := range events {
+		p.report(event)
+	}
+	p.finish()
+	assert.Equal(t, "\r\033[KAnalyzing: Analyzing the failed jobs of run 1\r\033[KValidating fix 2/3: Running test\r\033[K", stderr.String())
+
+	p, stderr = printer(OutputJSON, true)
+	for _, event := range events {
+		p.report(event)
+	}
+	p.finish()
+	scanner := bufio.NewScanner(stderr)
+	var decoded []ProgressEvent
+	for scanner.Scan() {
+		var event ProgressEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event), scanner.Text())
+		decoded = append(decoded, event)
+	}
+	assert.Equal(t, events, decoded)
+
+	p, _ = printer(OutputJSON, false)
+	assert.Nil(t, p, "json output only reports progress with --progress")
+}
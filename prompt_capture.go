@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// promptCaptureDir returns the directory captured prompts are written to, prompts/ beside the
+// audit log or else the state file; empty when neither is configured
+func (m *DaggerAutofix) promptCaptureDir() string {
+	switch {
+	case m.AuditLog != "":
+		return filepath.Join(filepath.Dir(m.AuditLog), "prompts")
+	case m.StateFile != "":
+		return filepath.Join(filepath.Dir(m.StateFile), "prompts")
+	}
+	return ""
+}
+
+// savePromptCapture writes the interactions captured for an analysis to <analysis ID>.json in
+// the prompt capture directory, replacing the file as fix generation adds interactions.
+// Failing to write it only logs a warning.
+func (m *DaggerAutofix) savePromptCapture(analysis *FailureAnalysisResult) {
+	dir := m.promptCaptureDir()
+	if !m.PromptCapture || dir == "" || analysis == nil || len(analysis.Interactions) == 0 {
+		return
+	}
+	path := filepath.Join(dir, analysis.ID+".json")
+	if err := writePromptCapture(path, analysis.Interactions); err != nil {
+		m.logger.WithError(err).WithField("path", path).Warn("Failed to save captured prompts")
+	}
+}
+
+// writePromptCapture writes interactions to path. Prompts quote source code and logs, so
+// only the owner may read them.
+func writePromptCapture(path string, interactions []LLMInteraction) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create prompt capture directory: %w", err)
+	}
+	data, err := json.MarshalIndent(interactions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode captured prompts: %w", err)
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
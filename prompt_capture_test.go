@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPromptCapture tests that the requests of an analysis and its fixes are only captured
+// when enabled, and that the captured content is redacted
+func TestPromptCapture(t *testing.T) {
+	const secret = "ghp_capturedSecret1234567890"
+	failureCtx := FailureContext{
+		WorkflowRun: &WorkflowRun{ID: 1},
+		Logs:        &WorkflowLogs{ErrorLines: []string{"auth failed for token " + secret}},
+	}
+	newEngine := func(capture bool) *FailureAnalysisEngine {
+		escalate := routingResponse(0.3)
+		llm := &scriptedLLMClient{chatFunc: func(req *LLMRequest) (*LLMResponse, error) {
+			response, err := escalate(req)
+			if _, ok := req.Context["analysis"]; !ok {
+				response.Content = fmt.Sprintf(`{"root_cause": "token %s expired", "classification": {"type": "test", "confidence": 0.3}}`, secret)
+			}
+			response.Usage = &LLMUsage{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120}
+			return response, err
+		}}
+		redactor, err := NewRedactor(nil)
+		require.NoError(t, err)
+		redactor.AddSecret(RedactionGitHubToken, secret)
+
+		engine := NewFailureAnalysisEngine(llm, quietLogger())
+		engine.SetOSVClient(nil)
+		engine.SetRedactor(redactor)
+		engine.SetModels("gpt-4o-mini", "gpt-4o")
+		engine.SetPromptCapture(capture)
+		return engine
+	}
+
+	engine := newEngine(false)
+	analysis, err := engine.AnalyzeFailure(context.Background(), failureCtx)
+	require.NoError(t, err)
+	_, err = engine.GenerateFixes(context.Background(), analysis)
+	require.NoError(t, err)
+	assert.Empty(t, analysis.Interactions, "nothing is captured by default")
+
+	engine = newEngine(true)
+	analysis, err = engine.AnalyzeFailure(context.Background(), failureCtx)
+	require.NoError(t, err)
+	_, err = engine.GenerateFixes(context.Background(), analysis)
+	require.NoError(t, err)
+
+	require.Len(t, analysis.Interactions, 3)
+	var stages, models []string
+	for _, interaction := range analysis.Interactions {
+		stages = append(stages, interaction.Stage)
+		models = append(models, interaction.Model)
+		assert.NotEmpty(t, interaction.SystemMsg)
+		assert.NotEmpty(t, interaction.Prompt)
+		assert.NotEmpty(t, interaction.Response)
+		assert.Equal(t, &LLMUsage{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120}, interaction.Usage)
+
+		data, err := json.Marshal(interaction)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), secret)
+	}
+	assert.Equal(t, []string{InteractionAnalysis, InteractionEscalatedAnalysis, InteractionFixGeneration}, stages)
+	assert.Equal(t, []string{"gpt-4o-mini", "gpt-4o", "gpt-4o"}, models)
+	assert.Contains(t, analysis.Interactions[0].Prompt, "auth failed for token [REDACTED")
+	assert.Contains(t, analysis.Interactions[0].Response, "token [REDACTED")
+}
+
+// TestPromptCaptureOutput tests writing the captured interactions beside the audit log and
+// printing them after the analyze output
+func TestPromptCaptureOutput(t *testing.T) {
+	captureAgent := func(t *testing.T) (*DaggerAutofix, string) {
+		m, _ := logsOnlyAgent(t)
+		m.AuditLog = filepath.Join(t.TempDir(), "audit.jsonl")
+		m.PromptCapture = true
+		m.failureEngine.(*FailureAnalysisEngine).SetPromptCapture(true)
+		return m, filepath.Join(filepath.Dir(m.AuditLog), "prompts")
+	}
+	readCapture := func(t *testing.T, path string) []LLMInteraction {
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var interactions []LLMInteraction
+		require.NoError(t, json.Unmarshal(data, &interactions))
+		return interactions
+	}
+
+	m, dir := captureAgent(t)
+	analysis, err := m.AnalyzeLogText(context.Background(), npmFailureLog, RepositoryContext{})
+	require.NoError(t, err)
+	path := filepath.Join(dir, analysis.ID+".json")
+	assert.Len(t, readCapture(t, path), 1)
+	_, err = m.generateFixes(context.Background(), analysis)
+	require.NoError(t, err)
+	assert.Len(t, readCapture(t, path), 2, "fix generation is added to the analysis's file")
+
+	m, _ = captureAgent(t)
+	cli, out := outputCLI(t, OutputText)
+	require.NoError(t, cli.rootCmd.ParseFlags([]string{"--debug-prompts"}))
+	require.NoError(t, cli.analyzeLog(context.Background(), m, npmFailureLog, RepositoryContext{}, false, ""))
+	assert.Regexp(t, `(?s)=== Failure Analysis Result ===.*=== LLM Interactions ===.*1\. analysis ---.*Prompt:\n.*FAIL src/sum.test.js`, out.String())
+
+	m, _ = captureAgent(t)
+	cli, out = outputCLI(t, OutputJSON)
+	require.NoError(t, cli.rootCmd.ParseFlags([]string{"--debug-prompts"}))
+	require.NoError(t, cli.analyzeLog(context.Background(), m, npmFailureLog, RepositoryContext{}, true, ""))
+	var result struct {
+		Analysis struct {
+			Interactions []LLMInteraction `json:"interactions"`
+		} `json:"analysis"`
+	}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &result), out.String())
+	require.Len(t, result.Analysis.Interactions, 2)
+	assert.Equal(t, InteractionFixGeneration, result.Analysis.Interactions[1].Stage)
+	assert.NotContains(t, out.String(), "=== LLM Interactions ===")
+
+	// Without --debug-prompts the agent captures nothing and analyze prints nothing more
+	m, _ = logsOnlyAgent(t)
+	cli, out = outputCLI(t, OutputText)
+	require.NoError(t, cli.analyzeLog(context.Background(), m, npmFailureLog, RepositoryContext{}, false, ""))
+	assert.NotContains(t, out.String(), "=== LLM Interactions ===")
+	assert.False(t, m.PromptCapture)
+}
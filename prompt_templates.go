@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"dagger.io/dagger"
+)
+
+// builtinPrompts holds the built-in prompt templates, laid out like a prompt directory
+//
+//go:embed prompts/*.tmpl
+var builtinPrompts embed.FS
+
+// promptFile is a prompt template and the file overriding it in a prompt directory. The
+// template is checked by rendering sample, the kind of data it is rendered with.
+type promptFile struct {
+	name   string
+	field  func(p *PromptTemplates) *string
+	sample func() interface{}
+}
+
+var promptFiles = []promptFile{
+	{"failure_analysis.tmpl", func(p *PromptTemplates) *string { return &p.FailureAnalysis }, sampleAnalysisPromptData},
+	{"failure_analysis_prompt.tmpl", func(p *PromptTemplates) *string { return &p.FailureAnalysisPrompt }, sampleAnalysisPromptData},
+	{"code_analysis.tmpl", func(p *PromptTemplates) *string { return &p.CodeAnalysis }, sampleAnalysisPromptData},
+	{"fix_generation.tmpl", func(p *PromptTemplates) *string { return &p.FixGeneration }, sampleFixPromptData},
+	{"fix_generation_prompt.tmpl", func(p *PromptTemplates) *string { return &p.FixGenerationPrompt }, sampleFixPromptData},
+	{"test_generation.tmpl", func(p *PromptTemplates) *string { return &p.TestGeneration }, sampleFixPromptData},
+	{"security_analysis.tmpl", func(p *PromptTemplates) *string { return &p.SecurityAnalysis }, sampleAnalysisPromptData},
+	{"log_chunk_summary.tmpl", func(p *PromptTemplates) *string { return &p.LogChunkSummary }, sampleLogChunkPromptData},
+	{"log_chunk_summary_prompt.tmpl", func(p *PromptTemplates) *string { return &p.LogChunkSummaryPrompt }, sampleLogChunkPromptData},
+}
+
+// promptFuncs are the functions available to prompt templates besides the text/template
+// builtins
+var promptFuncs = template.FuncMap{
+	"shortSHA": shortSHA,
+	"join":     strings.Join,
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+}
+
+// shortSHA abbreviates a commit SHA to its first 8 characters
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
+
+// AnalysisPromptData is what the failure analysis templates are rendered with
+type AnalysisPromptData struct {
+	Run        *WorkflowRun
+	Repository RepositoryContext
+	// JobName is the failed job the logs are limited to, empty for the whole run
+	JobName string
+	// Classification is the pre-classification by the built-in error patterns
+	Classification *FailureClassification
+	ErrorLines     []string
+	// Logs are the raw logs, cut in the middle when longer than 8000 bytes. They are empty
+	// when the logs were analyzed in chunks, whose summaries are in LogSummariesSection.
+	Logs string
+	// LogSummariesSection lists the error candidates found in each chunk of logs too long for
+	// the prompt
+	LogSummariesSection string
+	// RecentCommits are the three most recent commits
+	RecentCommits []CommitInfo
+	Workflow      *WorkflowDefinition
+	// WorkflowSection describes the workflow file and the failing job's definition
+	WorkflowSection string
+	// PRDiffSection shows the changes of the pull request a pull_request run tested
+	PRDiffSection string
+	// AnnotationsSection lists the failure and warning annotations of the run's check runs
+	AnnotationsSection string
+}
+
+// FixPromptData is what the fix and test generation templates are rendered with
+type FixPromptData struct {
+	Analysis   *FailureAnalysisResult
+	Repository RepositoryContext
+	// PreviousFix is the fix merged the last time the failure happened, if any
+	PreviousFix *FixHistoryEntry
+	Advisories  []Advisory
+	// AdvisoriesSection lists the advisories with their fixed versions
+	AdvisoriesSection string
+	Workflow          *WorkflowDefinition
+	// WorkflowSection describes the workflow file and the failing job's definition
+	WorkflowSection string
+	// PRDiffSection shows the changes of the pull request a pull_request run tested
+	PRDiffSection string
+	// FilesSection shows the repository files selected by the context policy
+	FilesSection string
+	// AllowedFixTypes are the only fix types accepted for the failure type, nil for any, and
+	// FixTypesSection tells the LLM about them
+	AllowedFixTypes []FixType
+	FixTypesSection string
+}
+
+// LogChunkPromptData is what the log chunk summary templates are rendered with
+type LogChunkPromptData struct {
+	Run        *WorkflowRun
+	Repository RepositoryContext
+	JobName    string
+	// Index is the number of the chunk, from 1, and Total the number of chunks of the logs
+	Index int
+	Total int
+	// StartLine and EndLine are the lines of the logs the chunk holds, from 1
+	StartLine int
+	EndLine   int
+	Chunk     string
+}
+
+func newAnalysisPromptData(ctx FailureContext, preClass *FailureClassification) *AnalysisPromptData {
+	data := &AnalysisPromptData{
+		Run:            ctx.WorkflowRun,
+		Repository:     ctx.Repository,
+		JobName:        ctx.JobName,
+		Classification: preClass,
+		RecentCommits:  ctx.RecentCommits,
+		Workflow:       ctx.Workflow,
+	}
+	if data.Run == nil {
+		data.Run = &WorkflowRun{}
+	}
+	if data.Classification == nil {
+		data.Classification = &FailureClassification{}
+	}
+	if ctx.Logs != nil {
+		data.ErrorLines = ctx.Logs.ErrorLines
+		data.Logs = ctx.Logs.RawLogs
+		if len(data.Logs) > analysisLogBudget {
+			data.Logs = data.Logs[:analysisLogBudget/2] + "\n...\n[TRUNCATED]\n...\n" + data.Logs[len(data.Logs)-analysisLogBudget/2:]
+		}
+	}
+	if len(data.RecentCommits) > 3 {
+		data.RecentCommits = data.RecentCommits[:3]
+	}
+	var workflow strings.Builder
+	writeWorkflowDefinitionPrompt(&workflow, ctx)
+	data.WorkflowSection = workflow.String()
+	var prDiff strings.Builder
+	writePRDiffPrompt(&prDiff, ctx)
+	data.PRDiffSection = prDiff.String()
+	var annotations strings.Builder
+	writeAnnotationsPrompt(&annotations, ctx.Logs)
+	data.AnnotationsSection = annotations.String()
+	return data
+}
+
+func newFixPromptData(analysis *FailureAnalysisResult) *FixPromptData {
+	data := &FixPromptData{
+		Analysis:    analysis,
+		Repository:  analysis.Context.Repository,
+		PreviousFix: analysis.PreviousFix,
+		Advisories:  analysis.Advisories,
+		Workflow:    analysis.Context.Workflow,
+	}
+	var section strings.Builder
+	if len(analysis.Advisories) > 0 {
+		writeAdvisoriesPrompt(&section, analysis.Advisories)
+	}
+	data.AdvisoriesSection = section.String()
+	section.Reset()
+	writeWorkflowDefinitionPrompt(&section, analysis.Context)
+	data.WorkflowSection = section.String()
+	section.Reset()
+	writePRDiffPrompt(&section, analysis.Context)
+	data.PRDiffSection = section.String()
+	section.Reset()
+	writeContextFilesPrompt(&section, analysis.Context.Files)
+	data.FilesSection = section.String()
+	return data
+}
+
+func sampleAnalysisPromptData() interface{} {
+	return newAnalysisPromptData(FailureContext{
+		WorkflowRun:   &WorkflowRun{ID: 1, Name: "CI"},
+		Logs:          &WorkflowLogs{ErrorLines: []string{"error"}, RawLogs: "error"},
+		RecentCommits: []CommitInfo{{SHA: "0123456789", Changes: []FileChange{{Filename: "main.go"}}}},
+		Workflow:      &WorkflowDefinition{Path: ".github/workflows/ci.yml"},
+	}, &FailureClassification{Type: BuildFailure})
+}
+
+func sampleLogChunkPromptData() interface{} {
+	return &LogChunkPromptData{
+		Run:       &WorkflowRun{ID: 1, Name: "CI"},
+		Index:     1,
+		Total:     2,
+		StartLine: 1,
+		EndLine:   1,
+		Chunk:     "error",
+	}
+}
+
+func sampleFixPromptData() interface{} {
+	return newFixPromptData(&FailureAnalysisResult{
+		AffectedFiles: []string{"main.go"},
+		ErrorPatterns: []ErrorPattern{{Pattern: "error"}},
+		Context:       FailureContext{WorkflowRun: &WorkflowRun{ID: 1}, Workflow: &WorkflowDefinition{Path: ".github/workflows/ci.yml"}},
+		PreviousFix:   &FixHistoryEntry{PRNumber: 1},
+		Advisories:    []Advisory{{ID: "GHSA-0000-0000-0000"}},
+	})
+}
+
+// builtinPromptTemplates are what prompts fall back to when a custom template fails to render
+var builtinPromptTemplates = loadPromptTemplates()
+
+// loadPromptTemplates returns the built-in prompt templates
+func loadPromptTemplates() *PromptTemplates {
+	prompts := &PromptTemplates{}
+	for _, file := range promptFiles {
+		text, err := builtinPrompts.ReadFile("prompts/" + file.name)
+		if err != nil {
+			panic(fmt.Sprintf("missing built-in prompt template %s", file.name))
+		}
+		*file.field(prompts) = string(text)
+	}
+	if err := prompts.parse(); err != nil {
+		panic(fmt.Sprintf("invalid built-in prompt templates: %v", err))
+	}
+	return prompts
+}
+
+// loadPromptTemplateDir returns the prompt templates with those in dir replacing the built-in
+// templates of the same file name
+func loadPromptTemplateDir(dir string) (*PromptTemplates, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt template directory: %w", err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return loadPromptOverrides(dir, names, func(name string) (string, error) {
+		text, err := os.ReadFile(filepath.Join(dir, name))
+		return string(text), err
+	})
+}
+
+// loadPromptTemplateDirectory is loadPromptTemplateDir for a Dagger directory
+func loadPromptTemplateDirectory(ctx context.Context, dir *dagger.Directory) (*PromptTemplates, error) {
+	names, err := dir.Entries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt template directory: %w", err)
+	}
+	return loadPromptOverrides("", names, func(name string) (string, error) {
+		return dir.File(name).Contents(ctx)
+	})
+}
+
+// loadPromptOverrides overrides the built-in templates with the template files among names.
+// Other .tmpl files are rejected, since a misspelled file would silently change nothing.
+func loadPromptOverrides(dir string, names []string, read func(name string) (string, error)) (*PromptTemplates, error) {
+	present := make(map[string]bool, len(names))
+	for _, name := range names {
+		present[name] = true
+		if strings.HasSuffix(name, ".tmpl") && promptFileNamed(name) == nil {
+			return nil, fmt.Errorf("unknown prompt template %s, expected one of %s", filepath.Join(dir, name), strings.Join(promptFileNames(), ", "))
+		}
+	}
+
+	prompts := loadPromptTemplates()
+	prompts.Sources = make(map[string]string)
+	for _, file := range promptFiles {
+		if !present[file.name] {
+			continue
+		}
+		text, err := read(file.name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt template %s: %w", filepath.Join(dir, file.name), err)
+		}
+		*file.field(prompts) = text
+		prompts.Sources[file.name] = filepath.Join(dir, file.name)
+	}
+	if err := prompts.parse(); err != nil {
+		return nil, err
+	}
+	return prompts, nil
+}
+
+func promptFileNamed(name string) *promptFile {
+	for i := range promptFiles {
+		if promptFiles[i].name == name {
+			return &promptFiles[i]
+		}
+	}
+	return nil
+}
+
+func promptFileNames() []string {
+	names := make([]string, 0, len(promptFiles))
+	for _, file := range promptFiles {
+		names = append(names, file.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parse parses every template and renders it with sample data, so mistakes like unknown
+// fields surface when the templates are loaded rather than in the middle of a fix. Errors
+// name the template file and line.
+func (p *PromptTemplates) parse() error {
+	p.parsed = make(map[string]*template.Template, len(promptFiles))
+	var errs []error
+	for _, file := range promptFiles {
+		tmpl, err := template.New(file.name).Funcs(promptFuncs).Parse(*file.field(p))
+		if err == nil {
+			err = tmpl.Execute(io.Discard, file.sample())
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid prompt template %s: %w", p.source(file.name), err))
+			continue
+		}
+		p.parsed[file.name] = tmpl
+	}
+	return errors.Join(errs...)
+}
+
+// source returns the file a template was loaded from, or "built-in"
+func (p *PromptTemplates) source(name string) string {
+	if source, ok := p.Sources[name]; ok {
+		return source
+	}
+	return "built-in"
+}
+
+// render renders the template of a prompt file with data
+func (p *PromptTemplates) render(name string, data interface{}) (string, error) {
+	if p.parsed == nil {
+		if err := p.parse(); err != nil {
+			return "", err
+		}
+	}
+	tmpl, ok := p.parsed[name]
+	if !ok {
+		return "", fmt.Errorf("unknown prompt template %s", name)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template %s: %w", p.source(name), err)
+	}
+	return out.String(), nil
+}
+
+// promptTemplateInfo describes an effective prompt template for config show-prompts
+type promptTemplateInfo struct {
+	File     string `json:"file"`
+	Source   string `json:"source"`
+	Template string `json:"template"`
+}
+
+// list returns the templates in file name order
+func (p *PromptTemplates) list() []promptTemplateInfo {
+	infos := make([]promptTemplateInfo, 0, len(promptFiles))
+	for _, name := range promptFileNames() {
+		infos = append(infos, promptTemplateInfo{File: name, Source: p.source(name), Template: *promptFileNamed(name).field(p)})
+	}
+	return infos
+}
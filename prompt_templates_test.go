@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePromptDir writes prompt template files to a temporary directory
+func writePromptDir(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	return dir
+}
+
+// TestPromptTemplateOverrides tests that templates in a prompt directory replace the built-in
+// ones in the LLM requests and that missing files keep the built-in templates
+func TestPromptTemplateOverrides(t *testing.T) {
+	dir := writePromptDir(t, map[string]string{
+		"fix_generation.tmpl": "You fix CI failures in {{.Repository.Owner}}/{{.Repository.Name}}.\n" +
+			"House rule: never suggest disabling tests.\n",
+		"notes.md": "not a template",
+	})
+	prompts, err := loadPromptTemplateDir(dir)
+	require.NoError(t, err)
+
+	llm := &scriptedLLMClient{chatFunc: routingResponse(0.85)}
+	engine := NewFailureAnalysisEngine(llm, quietLogger())
+	engine.SetOSVClient(nil)
+	engine.SetPromptTemplates(prompts)
+
+	analysis, err := engine.AnalyzeFailure(context.Background(), FailureContext{
+		WorkflowRun: &WorkflowRun{ID: 1},
+		Logs:        &WorkflowLogs{ErrorLines: []string{"expected 3, got \"12\""}},
+		Repository:  RepositoryContext{Owner: "acme", Name: "widgets"},
+	})
+	require.NoError(t, err)
+	_, err = engine.GenerateFixes(context.Background(), analysis)
+	require.NoError(t, err)
+
+	require.Len(t, llm.requests, 2)
+	assert.Equal(t, loadPromptTemplates().FailureAnalysis[:40], llm.requests[0].SystemMsg[:40])
+	assert.Contains(t, llm.requests[0].Prompt, "## GitHub Actions Workflow Failure Analysis")
+	assert.Equal(t, "You fix CI failures in acme/widgets.\nHouse rule: never suggest disabling tests.", llm.requests[1].SystemMsg)
+	assert.Contains(t, llm.requests[1].Prompt, "## Fix Generation Instructions")
+
+	assert.Equal(t, filepath.Join(dir, "fix_generation.tmpl"), prompts.source("fix_generation.tmpl"))
+	assert.Equal(t, "built-in", prompts.source("failure_analysis.tmpl"))
+}
+
+// TestPromptTemplateErrors tests that broken or unknown templates are rejected with the file
+// they came from
+func TestPromptTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr []string
+	}{
+		{
+			name:    "parse error",
+			files:   map[string]string{"failure_analysis_prompt.tmpl": "## Analysis\n\n{{end}}\n"},
+			wantErr: []string{"failure_analysis_prompt.tmpl", "failure_analysis_prompt.tmpl:3:", "unexpected {{end}}"},
+		},
+		{
+			name:    "unknown field",
+			files:   map[string]string{"fix_generation_prompt.tmpl": "Fix {{.Analysis.Nope}}\n"},
+			wantErr: []string{"fix_generation_prompt.tmpl:1:", "can't evaluate field Nope"},
+		},
+		{
+			name:    "unknown template file",
+			files:   map[string]string{"fix_generaton.tmpl": "typo\n"},
+			wantErr: []string{"unknown prompt template", "fix_generaton.tmpl", "expected one of"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writePromptDir(t, tt.files)
+			_, err := loadPromptTemplateDir(dir)
+			require.Error(t, err)
+			for _, want := range tt.wantErr {
+				assert.Contains(t, err.Error(), want)
+			}
+		})
+	}
+
+	t.Run("missing directory", func(t *testing.T) {
+		_, err := loadPromptTemplateDir(filepath.Join(t.TempDir(), "missing"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+// TestInitializeLoadsPromptTemplates tests that a prompt template that does not parse fails
+// Initialize and that a valid one reaches the LLM requests
+func TestInitializeLoadsPromptTemplates(t *testing.T) {
+	oldLLM := newLLMClient
+	t.Cleanup(func() { newLLMClient = oldLLM })
+	newLLMClient = func(ctx context.Context, provider LLMProvider, apiKey *dagger.Secret, logger *logrus.Logger) (*LLMClient, error) {
+		return &LLMClient{provider: provider}, nil
+	}
+	initialize := func(dir string) (*DaggerAutofix, error) {
+		m := New().WithLLMProvider("openai", createTestSecret("key", "sk-test")).WithLogsOnly(true).WithPromptTemplates(dir)
+		m.logger = quietLogger()
+		return m.Initialize(context.Background())
+	}
+
+	_, err := initialize(writePromptDir(t, map[string]string{"failure_analysis.tmpl": "{{.Run.Name"}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load prompt templates")
+	assert.Contains(t, err.Error(), "failure_analysis.tmpl:1:")
+
+	m, err := initialize(writePromptDir(t, map[string]string{"test_generation.tmpl": "House rule: never suggest disabling tests.\n"}))
+	require.NoError(t, err)
+	llm := &scriptedLLMClient{chatFunc: func(req *LLMRequest) (*LLMResponse, error) {
+		return &LLMResponse{Content: `[]`}, nil
+	}}
+	m.testEngine.(*TestEngine).SetLLMClient(llm)
+	_, _ = m.testEngine.GenerateTestsForFix(context.Background(), &ProposedFix{ID: "fix-1"}, nil)
+	require.Len(t, llm.requests, 1)
+	assert.Equal(t, "House rule: never suggest disabling tests.", llm.requests[0].SystemMsg)
+}
+
+// TestConfigShowPrompts tests printing the effective prompt templates and their sources
+func TestConfigShowPrompts(t *testing.T) {
+	dir := writePromptDir(t, map[string]string{"fix_generation.tmpl": "House rule: never suggest disabling tests.\n"})
+
+	clearConfigEnv(t)
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	var out bytes.Buffer
+	cli.rootCmd.SetOut(&out)
+	cli.rootCmd.SetErr(&out)
+	cli.rootCmd.SetArgs([]string{"config", "show-prompts", "--prompt-dir", dir})
+	require.NoError(t, cli.Execute())
+
+	assert.Contains(t, out.String(), "=== fix_generation.tmpl ("+filepath.Join(dir, "fix_generation.tmpl")+") ===\nHouse rule: never suggest disabling tests.\n")
+	assert.Contains(t, out.String(), "=== failure_analysis_prompt.tmpl (built-in) ===\n## GitHub Actions Workflow Failure Analysis")
+}
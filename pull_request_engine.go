@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"html"
+	"path"
 	"strings"
 	"time"
 
@@ -15,8 +18,13 @@ import (
 // PullRequestEngine handles automated pull request creation and management
 type PullRequestEngine struct {
 	githubClient *GitHubIntegration
+	// client opens and updates pull requests; it is githubClient unless replaced
+	client       GitHubClient
 	logger       *logrus.Logger
 	templates    *PRTemplates
+	targetBranch string
+	defaults     PRDefaults
+	minCoverage  int
 }
 
 // PRTemplates contains templates for pull request content
@@ -30,53 +38,152 @@ type PRTemplates struct {
 
 // PRCreationOptions contains options for PR creation
 type PRCreationOptions struct {
-	BranchName   string   `json:"branch_name"`
-	TargetBranch string   `json:"target_branch"`
-	Title        string   `json:"title"`
-	Body         string   `json:"body"`
-	Labels       []string `json:"labels"`
-	Reviewers    []string `json:"reviewers"`
-	Assignees    []string `json:"assignees"`
-	Draft        bool     `json:"draft"`
-	AutoMerge    bool     `json:"auto_merge"`
-	DeleteBranch bool     `json:"delete_branch"`
+	BranchName    string   `json:"branch_name"`
+	TargetBranch  string   `json:"target_branch"`
+	Title         string   `json:"title"`
+	Body          string   `json:"body"`
+	Labels        []string `json:"labels"`
+	Reviewers     []string `json:"reviewers"`
+	TeamReviewers []string `json:"team_reviewers"`
+	Assignees     []string `json:"assignees"`
+	Draft         bool     `json:"draft"`
+	AutoMerge     bool     `json:"auto_merge"` // ignored for drafts, which cannot be auto-merged
+	DeleteBranch  bool     `json:"delete_branch"`
 }
 
 // NewPullRequestEngine creates a new pull request engine
 func NewPullRequestEngine(githubClient *GitHubIntegration, logger *logrus.Logger) *PullRequestEngine {
-	return &PullRequestEngine{
+	p := &PullRequestEngine{
 		githubClient: githubClient,
 		logger:       logger,
 		templates:    loadPRTemplates(),
 	}
+	if githubClient != nil {
+		p.client = githubClient
+	}
+	return p
+}
+
+// SetGitHubClient replaces the client pull requests are opened, updated and commented with
+func (p *PullRequestEngine) SetGitHubClient(client GitHubClient) {
+	p.client = client
+}
+
+// SetTargetBranch configures the branch fix pull requests are opened against.
+// When empty, the GitHub client's target branch or the repository default branch is used.
+func (p *PullRequestEngine) SetTargetBranch(branch string) {
+	p.targetBranch = branch
+}
+
+// SetCommitTemplate overrides the text/template used for fix commit messages. The template
+// is executed with CommitMessageData; an empty template restores DefaultCommitTemplate.
+func (p *PullRequestEngine) SetCommitTemplate(tmpl string) {
+	if tmpl == "" {
+		tmpl = DefaultCommitTemplate
+	}
+	if p.templates == nil {
+		p.templates = loadPRTemplates()
+	}
+	p.templates.CommitMsg = tmpl
+}
+
+// SetMinCoverage sets the coverage threshold shown as required in fix PR bodies
+func (p *PullRequestEngine) SetMinCoverage(coverage int) {
+	p.minCoverage = coverage
+}
+
+// SetPRDefaults configures the reviewers, assignees, labels, draft and auto-merge
+// settings applied to every fix pull request
+func (p *PullRequestEngine) SetPRDefaults(defaults PRDefaults) {
+	p.defaults = defaults
+}
+
+// FixPROptions adjusts how CreateFixPRWithOptions opens a fix pull request
+type FixPROptions struct {
+	Draft bool `json:"draft"`
+	// AllowDuplicate skips the check for an open fix PR for the same workflow run,
+	// so alternative fixes for one analysis each get their own PR
+	AllowDuplicate bool `json:"allow_duplicate"`
+	// Title and Body replace the generated pull request title and body when set
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+	// Reviewers and TeamReviewers are requested on top of the configured ones
+	Reviewers     []string `json:"reviewers,omitempty"`
+	TeamReviewers []string `json:"team_reviewers,omitempty"`
 }
 
 // CreateFixPR creates a pull request for an automated fix
 func (p *PullRequestEngine) CreateFixPR(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult) (*PullRequest, error) {
+	return p.CreateFixPRWithOptions(ctx, analysis, fix, FixPROptions{})
+}
+
+// CreateFixPRWithOptions creates a pull request for an automated fix, optionally as a draft
+func (p *PullRequestEngine) CreateFixPRWithOptions(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error) {
 	if !fix.Valid {
-		return nil, fmt.Errorf("cannot create PR for invalid fix")
+		return nil, fmt.Errorf("%w: cannot create PR for invalid fix", ErrNoValidFixes)
 	}
 
 	p.logger.WithFields(logrus.Fields{
 		"analysis_id": analysis.ID,
 		"fix_id":      fix.Fix.ID,
+		"draft":       opts.Draft,
 	}).Info("Creating automated fix pull request")
 
-	// Generate branch name
-	branchName := p.generateBranchName(analysis, fix.Fix)
+	// Repeated monitor ticks see the same failed run, so reuse the PR opened for it
+	if !opts.AllowDuplicate {
+		existing, err := p.findOpenFixPR(ctx, analysis)
+		if err != nil {
+			p.logger.WithError(err).Warn("Failed to check for an existing fix pull request")
+		} else if existing != nil {
+			p.logger.WithFields(logrus.Fields{
+				"pr_number": existing.Number,
+				"pr_url":    existing.URL,
+				"run_id":    analysis.Context.WorkflowRun.ID,
+			}).Info("Fix pull request already open for this workflow run, not opening another")
+			return existing, nil
+		}
+	}
+
+	// Retries of the analysis reuse its branch, while alternative fixes get one of their own
+	branchName := p.generateBranchName(analysis)
+	if opts.AllowDuplicate {
+		branchName += "-" + shortHash(fix.Fix.ID, changeSetHashLength)
+	}
+	if err := validateBranchName(branchName); err != nil {
+		return nil, err
+	}
+
+	baseBranch, err := p.resolveBaseBranch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve base branch: %w", err)
+	}
 
 	// Create branch with changes
-	if err := p.createBranch(ctx, branchName, fix.Fix.Changes); err != nil {
+	if err := p.createBranchFrom(ctx, baseBranch, branchName, fix.Fix.Changes, p.commitMessage(analysis, fix.Fix)); err != nil {
 		return nil, fmt.Errorf("failed to create branch: %w", err)
 	}
 
 	// Generate PR content
 	prOptions := p.generatePRContent(analysis, fix)
 	prOptions.BranchName = branchName
+	prOptions.TargetBranch = baseBranch
+	prOptions.Draft = prOptions.Draft || opts.Draft
+	prOptions.Title = valueOr(opts.Title, prOptions.Title)
+
+	// Request the code owners of the changed files, so protected branches can merge the PR
+	review := p.reviewRequirements(ctx, baseBranch, fix.Fix.Changes)
+	users, teams := parseReviewers(review.owners)
+	prOptions.Reviewers = mergeNames(prOptions.Reviewers, opts.Reviewers, users)
+	prOptions.TeamReviewers = mergeNames(prOptions.TeamReviewers, opts.TeamReviewers, teams)
+	prOptions.Body = insertBeforeFooter(prOptions.Body, p.uploadCoverageReport(ctx, fix))
+	prOptions.Body = valueOr(opts.Body, insertBeforeFooter(prOptions.Body, review.section()))
+	// Bodies edited before opening may have lost the metadata block
+	prOptions.Body = embedPRMetadata(prOptions.Body, newPRMetadata(analysis, fix.Fix))
 
 	// Create pull request
 	pr, err := p.createPullRequest(ctx, prOptions)
 	if err != nil {
+		p.deleteBranch(ctx, branchName)
 		return nil, fmt.Errorf("failed to create pull request: %w", err)
 	}
 
@@ -84,16 +191,58 @@ func (p *PullRequestEngine) CreateFixPR(ctx context.Context, analysis *FailureAn
 	if err := p.addPRMetadata(ctx, pr, analysis, fix); err != nil {
 		p.logger.WithError(err).Warn("Failed to add PR metadata")
 	}
+	if !opts.AllowDuplicate {
+		p.deleteSupersededBranches(ctx, analysis, branchName)
+	}
 
 	p.logger.WithFields(logrus.Fields{
-		"pr_number": pr.Number,
-		"pr_url":    pr.URL,
-		"branch":    branchName,
+		"analysis_id": analysis.ID,
+		"fix_id":      fix.Fix.ID,
+		"pr_number":   pr.Number,
+		"pr_url":      pr.URL,
+		"branch":      branchName,
 	}).Info("Pull request created successfully")
 
 	return pr, nil
 }
 
+// LinkRelatedPRs appends a related fixes section to each pull request listing the others,
+// so reviewers can compare alternative fixes for the same failure
+func (p *PullRequestEngine) LinkRelatedPRs(ctx context.Context, prs []*PullRequest) error {
+	if len(prs) < 2 {
+		return nil
+	}
+
+	var errs []string
+	for _, pr := range prs {
+		body := pr.Body + relatedFixesSection(pr, prs)
+		if _, err := p.client.UpdatePullRequest(ctx, pr.Number, PullRequestUpdate{Body: body}); err != nil {
+			errs = append(errs, fmt.Sprintf("#%d: %v", pr.Number, err))
+			continue
+		}
+		pr.Body = body
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to link related PRs: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// relatedFixesSection renders links to every pull request in prs other than current
+func relatedFixesSection(current *PullRequest, prs []*PullRequest) string {
+	var body strings.Builder
+	body.WriteString("\n## 🔗 Related Fixes\n\n")
+	body.WriteString("Alternative fixes were opened for the same failure:\n\n")
+	for _, pr := range prs {
+		if pr.Number == current.Number {
+			continue
+		}
+		body.WriteString(fmt.Sprintf("- #%d %s\n", pr.Number, pr.Title))
+	}
+	return body.String()
+}
+
 // CreateManualPR creates a pull request for manual review
 func (p *PullRequestEngine) CreateManualPR(ctx context.Context, analysis *FailureAnalysisResult, options *PRCreationOptions) (*PullRequest, error) {
 	p.logger.WithField("analysis_id", analysis.ID).Info("Creating manual review pull request")
@@ -112,73 +261,52 @@ func (p *PullRequestEngine) CreateManualPR(ctx context.Context, analysis *Failur
 	return pr, nil
 }
 
-// UpdatePR updates an existing pull request
+// PreviewFixPR returns the branch and pull request content CreateFixPR would use, without calling the API.
+// The target branch is the configured one, since the repository default is only resolved on creation.
+func (p *PullRequestEngine) PreviewFixPR(analysis *FailureAnalysisResult, fix *FixValidationResult) *PRCreationOptions {
+	prOptions := p.generatePRContent(analysis, fix)
+	prOptions.BranchName = p.generateBranchName(analysis)
+	return prOptions
+}
+
+// UpdatePR updates the title, body and, when given, the labels of an existing pull request
 func (p *PullRequestEngine) UpdatePR(ctx context.Context, prNumber int, updates *PRCreationOptions) (*PullRequest, error) {
 	p.logger.WithField("pr_number", prNumber).Info("Updating pull request")
 
 	// Get existing PR
-	existingPR, _, err := p.githubClient.client.PullRequests.Get(ctx, p.githubClient.repoOwner, p.githubClient.repoName, prNumber)
+	existingPR, err := p.client.GetPullRequest(ctx, prNumber)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get existing PR: %w", err)
 	}
 
-	// Update PR
-	updatedPR := &github.PullRequest{
-		Title: &updates.Title,
-		Body:  &updates.Body,
+	update := PullRequestUpdate{Title: updates.Title, Body: updates.Body}
+	if len(updates.Labels) > 0 {
+		update.Labels = updates.Labels
 	}
-
-	result, _, err := p.githubClient.client.PullRequests.Edit(ctx, p.githubClient.repoOwner, p.githubClient.repoName, prNumber, updatedPR)
+	result, err := p.client.UpdatePullRequest(ctx, prNumber, update)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update PR: %w", err)
 	}
-
-	// Update labels if provided
-	if len(updates.Labels) > 0 {
-		if _, _, err := p.githubClient.client.Issues.ReplaceLabelsForIssue(ctx, p.githubClient.repoOwner, p.githubClient.repoName, prNumber, updates.Labels); err != nil {
-			p.logger.WithError(err).Warn("Failed to update PR labels")
-		}
-	}
-
-	return &PullRequest{
-		Number:    result.GetNumber(),
-		Title:     result.GetTitle(),
-		Body:      result.GetBody(),
-		URL:       result.GetHTMLURL(),
-		Branch:    existingPR.GetHead().GetRef(),
-		CommitSHA: result.GetHead().GetSHA(),
-		State:     result.GetState(),
-		CreatedAt: result.GetCreatedAt(),
-		Author:    result.GetUser().GetLogin(),
-		Labels:    updates.Labels,
-	}, nil
+	result.Branch = existingPR.Branch
+	return result, nil
 }
 
-// ClosePR closes a pull request
+// ClosePR closes a pull request and comments the reason on it
 func (p *PullRequestEngine) ClosePR(ctx context.Context, prNumber int, reason string) error {
 	p.logger.WithFields(logrus.Fields{
 		"pr_number": prNumber,
 		"reason":    reason,
 	}).Info("Closing pull request")
 
-	// Close PR
-	state := "closed"
-	updatedPR := &github.PullRequest{
-		State: &state,
-	}
-
-	_, _, err := p.githubClient.client.PullRequests.Edit(ctx, p.githubClient.repoOwner, p.githubClient.repoName, prNumber, updatedPR)
-	if err != nil {
+	if err := p.client.ClosePullRequest(ctx, prNumber); err != nil {
 		return fmt.Errorf("failed to close PR: %w", err)
 	}
 
 	// Add closing comment
-	comment := &github.IssueComment{
-		Body: &reason,
-	}
-
-	if _, _, err := p.githubClient.client.Issues.CreateComment(ctx, p.githubClient.repoOwner, p.githubClient.repoName, prNumber, comment); err != nil {
-		p.logger.WithError(err).Warn("Failed to add closing comment")
+	if reason != "" {
+		if err := p.client.AddPullRequestComment(ctx, prNumber, reason); err != nil {
+			p.logger.WithError(err).Warn("Failed to add closing comment")
+		}
 	}
 
 	return nil
@@ -186,69 +314,159 @@ func (p *PullRequestEngine) ClosePR(ctx context.Context, prNumber int, reason st
 
 // GetPRStatus gets the status of a pull request
 func (p *PullRequestEngine) GetPRStatus(ctx context.Context, prNumber int) (*PullRequest, error) {
-	pr, _, err := p.githubClient.client.PullRequests.Get(ctx, p.githubClient.repoOwner, p.githubClient.repoName, prNumber)
+	pr, err := p.client.GetPullRequest(ctx, prNumber)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get PR: %w", err)
 	}
+	return pr, nil
+}
 
-	// Get labels
-	labels, _, err := p.githubClient.client.Issues.ListLabelsByIssue(ctx, p.githubClient.repoOwner, p.githubClient.repoName, prNumber, nil)
-	if err != nil {
-		p.logger.WithError(err).Warn("Failed to get PR labels")
-	}
+// Private helper methods
 
-	var labelNames []string
-	for _, label := range labels {
-		labelNames = append(labelNames, label.GetName())
+// fixBranchPrefix starts the names of the branches fix PRs are opened from
+const fixBranchPrefix = "autofix/"
+
+// generateBranchName names the fix branch of an analysis by its failure type and a hash of its
+// ID, so fixing the same failure of a run again reuses the branch
+func (p *PullRequestEngine) generateBranchName(analysis *FailureAnalysisResult) string {
+	failureType := sanitizeRefComponent(string(analysis.Classification.Type))
+	if failureType == "" {
+		failureType = string(UnknownFailure)
 	}
+	return fixBranchPrefix + failureType + "/" + branchHash(analysis)
+}
 
-	return &PullRequest{
-		Number:    pr.GetNumber(),
-		Title:     pr.GetTitle(),
-		Body:      pr.GetBody(),
-		URL:       pr.GetHTMLURL(),
-		Branch:    pr.GetHead().GetRef(),
-		CommitSHA: pr.GetHead().GetSHA(),
-		State:     pr.GetState(),
-		CreatedAt: pr.GetCreatedAt(),
-		Author:    pr.GetUser().GetLogin(),
-		Labels:    labelNames,
-	}, nil
+// isAnalysisBranch reports whether branch is a fix branch of the analysis, under any failure
+// type, for its best fix or an alternative
+func isAnalysisBranch(branch string, analysis *FailureAnalysisResult) bool {
+	hash := branchHash(analysis)
+	for _, pattern := range []string{fixBranchPrefix + "*/" + hash, fixBranchPrefix + "*/" + hash + "-*"} {
+		if matched, _ := path.Match(pattern, branch); matched {
+			return true
+		}
+	}
+	return false
 }
 
-// Private helper methods
+// deleteSupersededBranches deletes the fix branches earlier attempts left for the analysis,
+// e.g. under another failure type or for alternatives, once keep supersedes them. Branches
+// of open pull requests are kept. Clients that cannot list branches are skipped.
+func (p *PullRequestEngine) deleteSupersededBranches(ctx context.Context, analysis *FailureAnalysisResult, keep string) {
+	lister, ok := p.client.(branchLister)
+	if !ok {
+		return
+	}
+	branches, err := lister.ListBranches(ctx, fixBranchPrefix)
+	if err != nil {
+		p.logger.WithError(err).Warn("Failed to list superseded fix branches")
+		return
+	}
+	prs, err := p.client.ListOpenPullRequests(ctx, []string{"autofix"})
+	if err != nil {
+		p.logger.WithError(err).Warn("Failed to list open fix pull requests, keeping superseded fix branches")
+		return
+	}
+	open := make(map[string]bool, len(prs))
+	for _, pr := range prs {
+		open[pr.Branch] = true
+	}
 
-func (p *PullRequestEngine) generateBranchName(analysis *FailureAnalysisResult, fix *ProposedFix) string {
-	timestamp := time.Now().Format("20060102-150405")
-	fixType := strings.ToLower(string(fix.Type))
-	return fmt.Sprintf("autofix/%s/%s-%s", fixType, analysis.ID, timestamp)
+	for _, branch := range branches {
+		if branch == keep || open[branch] || !isAnalysisBranch(branch, analysis) {
+			continue
+		}
+		if err := p.client.DeleteBranch(ctx, branch); err != nil {
+			p.logger.WithError(err).Warnf("Failed to delete superseded fix branch %s", branch)
+			continue
+		}
+		audit(ctx, AuditBranchDeleted, map[string]interface{}{"branch": branch, "superseded_by": keep})
+		p.logger.WithFields(logrus.Fields{
+			"branch":        branch,
+			"superseded_by": keep,
+		}).Info("Deleted superseded fix branch")
+	}
 }
 
-func (p *PullRequestEngine) createBranch(ctx context.Context, branchName string, changes []CodeChange) error {
-	p.logger.WithField("branch", branchName).Debug("Creating branch with changes")
+// findOpenFixPR returns the open autofix PR for the analysed workflow run, or nil if there is
+// none. PRs are matched by the run in their metadata; PRs without metadata, opened before it
+// was embedded, by the analysis's branch or the workflow run named in their body, linked or
+// not.
+func (p *PullRequestEngine) findOpenFixPR(ctx context.Context, analysis *FailureAnalysisResult) (*PullRequest, error) {
+	run := analysis.Context.WorkflowRun
+	if run == nil {
+		return nil, nil
+	}
 
-	// Get the default branch reference
-	mainRef, _, err := p.githubClient.client.Git.GetRef(ctx, p.githubClient.repoOwner, p.githubClient.repoName, "heads/main")
+	prs, err := p.client.ListOpenPullRequests(ctx, []string{"autofix"})
 	if err != nil {
-		return fmt.Errorf("failed to get main branch ref: %w", err)
+		return nil, err
+	}
+
+	runLink := fmt.Sprintf("**Workflow Run**: [#%d](", run.ID)
+	runNumber := fmt.Sprintf("**Workflow Run**: #%d\n", run.ID)
+	for _, pr := range prs {
+		if metadata := prMetadata(pr, p.logger); metadata != nil {
+			if metadata.RunID == run.ID {
+				pr.Existing = true
+				return pr, nil
+			}
+			continue
+		}
+		if isAnalysisBranch(pr.Branch, analysis) || strings.Contains(pr.Body, runLink) || strings.Contains(pr.Body, runNumber) {
+			pr.Existing = true
+			return pr, nil
+		}
 	}
+	return nil, nil
+}
 
-	// Create new branch
-	newRef := &github.Reference{
-		Ref: github.String("refs/heads/" + branchName),
-		Object: &github.GitObject{
-			SHA: mainRef.Object.SHA,
-		},
+// resolveBaseBranch returns the configured target branch, falling back to the GitHub client's
+func (p *PullRequestEngine) resolveBaseBranch(ctx context.Context) (string, error) {
+	if p.targetBranch != "" {
+		return p.targetBranch, nil
 	}
+	return p.githubClient.resolveBaseBranch(ctx)
+}
 
-	_, _, err = p.githubClient.client.Git.CreateRef(ctx, p.githubClient.repoOwner, p.githubClient.repoName, newRef)
+func (p *PullRequestEngine) createBranch(ctx context.Context, branchName string, changes []CodeChange) error {
+	baseBranch, err := p.resolveBaseBranch(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create branch: %w", err)
+		return fmt.Errorf("failed to resolve base branch: %w", err)
+	}
+	return p.createBranchFrom(ctx, baseBranch, branchName, changes, "")
+}
+
+// commitMessage renders the commit message for a fix's changes, falling back to the
+// default template when the configured one fails
+func (p *PullRequestEngine) commitMessage(analysis *FailureAnalysisResult, fix *ProposedFix) string {
+	message, err := renderCommitMessage(p.templates.CommitMsg, analysis, fix)
+	if err == nil {
+		return message
+	}
+	p.logger.WithError(err).Warn("Failed to render commit message, using the default template")
+	message, _ = renderCommitMessage(DefaultCommitTemplate, analysis, fix)
+	return message
+}
+
+// createBranchFrom creates branchName from baseBranch and commits the changes to it with
+// message. Without a message each file commit describes its own change.
+func (p *PullRequestEngine) createBranchFrom(ctx context.Context, baseBranch, branchName string, changes []CodeChange, message string) error {
+	p.logger.WithFields(logrus.Fields{
+		"branch": branchName,
+		"base":   baseBranch,
+	}).Debug("Creating branch with changes")
+
+	if err := p.client.CreateBranch(ctx, branchName, baseBranch); err != nil {
+		return err
 	}
 
 	// Apply changes to the branch
 	for _, change := range changes {
-		if err := p.applyChange(ctx, branchName, change); err != nil {
+		if err := p.applyChange(ctx, branchName, change, message); err != nil {
+			if ctx.Err() != nil {
+				p.deleteBranch(ctx, branchName)
+				return fmt.Errorf("failed to apply changes: %w", ctx.Err())
+			}
 			p.logger.WithError(err).Warnf("Failed to apply change to %s", change.FilePath)
 			// Continue with other changes even if one fails
 		}
@@ -257,75 +475,170 @@ func (p *PullRequestEngine) createBranch(ctx context.Context, branchName string,
 	return nil
 }
 
-func (p *PullRequestEngine) applyChange(ctx context.Context, branch string, change CodeChange) error {
+// deleteBranch deletes a fix branch no pull request was opened for. It runs detached from ctx,
+// which is usually done when the branch is left behind.
+func (p *PullRequestEngine) deleteBranch(ctx context.Context, branchName string) {
+	cleanupCtx, cancel := cleanupContext(ctx)
+	defer cancel()
+	if err := p.client.DeleteBranch(cleanupCtx, branchName); err != nil {
+		p.logger.WithError(err).Warnf("Failed to delete branch %s", branchName)
+	}
+}
+
+func (p *PullRequestEngine) applyChange(ctx context.Context, branch string, change CodeChange, message string) error {
 	p.logger.WithFields(logrus.Fields{
 		"file":      change.FilePath,
 		"operation": change.Operation,
 		"branch":    branch,
 	}).Debug("Applying code change")
 
+	if err := validateCodeChange(change); err != nil {
+		return err
+	}
+
+	switch change.Operation {
+	case ChangeOperationAdd:
+		return p.createFile(ctx, branch, change, message)
+	case ChangeOperationModify:
+		return p.updateFile(ctx, branch, change, message)
+	case ChangeOperationRename:
+		return p.renameFile(ctx, branch, change, message)
+	default:
+		return p.deleteFile(ctx, branch, change, message)
+	}
+}
+
+// validateCodeChange rejects unknown operations and paths that are absolute, escape the
+// repository root or point into .git
+func validateCodeChange(change CodeChange) error {
 	switch change.Operation {
-	case "add":
-		return p.createFile(ctx, branch, change)
-	case "modify":
-		return p.updateFile(ctx, branch, change)
-	case "delete":
-		return p.deleteFile(ctx, branch, change)
+	case ChangeOperationAdd, ChangeOperationModify, ChangeOperationDelete, ChangeOperationRename:
 	default:
 		return fmt.Errorf("unknown operation: %s", change.Operation)
 	}
+
+	if _, err := cleanChangePath(change.FilePath); err != nil {
+		return fmt.Errorf("invalid file path: %w", err)
+	}
+	if change.Operation == ChangeOperationRename {
+		renamed, err := cleanChangePath(change.NewFilePath)
+		if err != nil {
+			return fmt.Errorf("invalid new file path: %w", err)
+		}
+		if renamed == path.Clean(change.FilePath) {
+			return fmt.Errorf("rename of %s does not change its path", change.FilePath)
+		}
+	}
+	return nil
+}
+
+// fileCommitMessage returns message, or fallback when no change set message was rendered
+func fileCommitMessage(message, fallback string) *string {
+	if message == "" {
+		message = fallback
+	}
+	return &message
 }
 
-func (p *PullRequestEngine) createFile(ctx context.Context, branch string, change CodeChange) error {
+func (p *PullRequestEngine) createFile(ctx context.Context, branch string, change CodeChange, message string) error {
 	fileContent := &github.RepositoryContentFileOptions{
-		Message: github.String(fmt.Sprintf("Add %s", change.FilePath)),
+		Message: fileCommitMessage(message, fmt.Sprintf("Add %s", change.FilePath)),
 		Content: []byte(change.NewContent),
 		Branch:  &branch,
 	}
 
-	_, _, err := p.githubClient.client.Repositories.CreateFile(ctx, p.githubClient.repoOwner, p.githubClient.repoName, change.FilePath, fileContent)
+	_, err := callGitHub(ctx, p.githubClient, func() (*github.RepositoryContentResponse, *github.Response, error) {
+		return p.githubClient.client.Repositories.CreateFile(ctx, p.githubClient.repoOwner, p.githubClient.repoName, change.FilePath, fileContent)
+	})
 	return err
 }
 
-func (p *PullRequestEngine) updateFile(ctx context.Context, branch string, change CodeChange) error {
+func (p *PullRequestEngine) updateFile(ctx context.Context, branch string, change CodeChange, message string) error {
 	// Get current file to get SHA
-	fileContent, _, _, err := p.githubClient.client.Repositories.GetContents(ctx, p.githubClient.repoOwner, p.githubClient.repoName, change.FilePath, &github.RepositoryContentGetOptions{
-		Ref: branch,
+	var fileContent *github.RepositoryContent
+	err := p.githubClient.withRateLimit(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		fileContent, _, resp, err = p.githubClient.client.Repositories.GetContents(ctx, p.githubClient.repoOwner, p.githubClient.repoName, change.FilePath, &github.RepositoryContentGetOptions{
+			Ref: branch,
+		})
+		return resp, err
 	})
 	if err != nil {
 		return fmt.Errorf("failed to get file content: %w", err)
 	}
 
 	updateOptions := &github.RepositoryContentFileOptions{
-		Message: github.String(fmt.Sprintf("Update %s - %s", change.FilePath, change.Explanation)),
+		Message: fileCommitMessage(message, fmt.Sprintf("Update %s - %s", change.FilePath, change.Explanation)),
 		Content: []byte(change.NewContent),
 		SHA:     fileContent.SHA,
 		Branch:  &branch,
 	}
 
-	_, _, err = p.githubClient.client.Repositories.UpdateFile(ctx, p.githubClient.repoOwner, p.githubClient.repoName, change.FilePath, updateOptions)
+	_, err = callGitHub(ctx, p.githubClient, func() (*github.RepositoryContentResponse, *github.Response, error) {
+		return p.githubClient.client.Repositories.UpdateFile(ctx, p.githubClient.repoOwner, p.githubClient.repoName, change.FilePath, updateOptions)
+	})
 	return err
 }
 
-func (p *PullRequestEngine) deleteFile(ctx context.Context, branch string, change CodeChange) error {
+func (p *PullRequestEngine) deleteFile(ctx context.Context, branch string, change CodeChange, message string) error {
 	// Get current file to get SHA
-	fileContent, _, _, err := p.githubClient.client.Repositories.GetContents(ctx, p.githubClient.repoOwner, p.githubClient.repoName, change.FilePath, &github.RepositoryContentGetOptions{
-		Ref: branch,
+	var fileContent *github.RepositoryContent
+	err := p.githubClient.withRateLimit(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		fileContent, _, resp, err = p.githubClient.client.Repositories.GetContents(ctx, p.githubClient.repoOwner, p.githubClient.repoName, change.FilePath, &github.RepositoryContentGetOptions{
+			Ref: branch,
+		})
+		return resp, err
 	})
 	if err != nil {
 		return fmt.Errorf("failed to get file content: %w", err)
 	}
 
 	deleteOptions := &github.RepositoryContentFileOptions{
-		Message: github.String(fmt.Sprintf("Delete %s - %s", change.FilePath, change.Explanation)),
+		Message: fileCommitMessage(message, fmt.Sprintf("Delete %s - %s", change.FilePath, change.Explanation)),
 		SHA:     fileContent.SHA,
 		Branch:  &branch,
 	}
 
-	_, _, err = p.githubClient.client.Repositories.DeleteFile(ctx, p.githubClient.repoOwner, p.githubClient.repoName, change.FilePath, deleteOptions)
+	_, err = callGitHub(ctx, p.githubClient, func() (*github.RepositoryContentResponse, *github.Response, error) {
+		return p.githubClient.client.Repositories.DeleteFile(ctx, p.githubClient.repoOwner, p.githubClient.repoName, change.FilePath, deleteOptions)
+	})
 	return err
 }
 
+// renameFile moves a file the way the contents API allows: it creates the new path with the
+// old content, or NewContent when set, and then deletes the old path
+func (p *PullRequestEngine) renameFile(ctx context.Context, branch string, change CodeChange, message string) error {
+	content := change.NewContent
+	if content == "" {
+		var fileContent *github.RepositoryContent
+		err := p.githubClient.withRateLimit(ctx, func() (*github.Response, error) {
+			var resp *github.Response
+			var err error
+			fileContent, _, resp, err = p.githubClient.client.Repositories.GetContents(ctx, p.githubClient.repoOwner, p.githubClient.repoName, change.FilePath, &github.RepositoryContentGetOptions{
+				Ref: branch,
+			})
+			return resp, err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get file content: %w", err)
+		}
+		if content, err = fileContent.GetContent(); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", change.FilePath, err)
+		}
+	}
+
+	message = *fileCommitMessage(message, fmt.Sprintf("Rename %s to %s", change.FilePath, change.NewFilePath))
+	created := change
+	created.FilePath, created.NewContent = change.NewFilePath, content
+	if err := p.createFile(ctx, branch, created, message); err != nil {
+		return fmt.Errorf("failed to create %s: %w", change.NewFilePath, err)
+	}
+	return p.deleteFile(ctx, branch, change, message)
+}
+
 func (p *PullRequestEngine) generatePRContent(analysis *FailureAnalysisResult, fix *FixValidationResult) *PRCreationOptions {
 	// Generate title
 	title := p.generatePRTitle(analysis, fix.Fix)
@@ -333,84 +646,215 @@ func (p *PullRequestEngine) generatePRContent(analysis *FailureAnalysisResult, f
 	// Generate body
 	body := p.generatePRBody(analysis, fix)
 
-	// Generate labels
-	labels := p.generatePRLabels(analysis, fix.Fix)
+	// Generate labels, followed by the template and configured ones
+	labels := mergeNames(p.generatePRLabels(analysis, fix.Fix), p.templates.Labels, p.defaults.Labels)
 
 	return &PRCreationOptions{
-		Title:        title,
-		Body:         body,
-		Labels:       labels,
-		TargetBranch: "main",
-		Draft:        false,
-		AutoMerge:    false,
-		DeleteBranch: true,
+		Title:         title,
+		Body:          body,
+		Labels:        labels,
+		Reviewers:     mergeNames(p.templates.Reviewers, p.defaults.Reviewers),
+		TeamReviewers: mergeNames(nil, p.defaults.TeamReviewers),
+		Assignees:     mergeNames(nil, p.defaults.Assignees),
+		TargetBranch:  p.defaultTargetBranch(),
+		Draft:         p.defaults.Draft,
+		AutoMerge:     p.defaults.AutoMerge,
+		DeleteBranch:  true,
+	}
+}
+
+// defaultTargetBranch returns the configured target branch without hitting the API.
+// CreateFixPR replaces it with the resolved base branch before opening the PR.
+func (p *PullRequestEngine) defaultTargetBranch() string {
+	if p.targetBranch != "" {
+		return p.targetBranch
+	}
+	if p.githubClient != nil && p.githubClient.targetBranch != "" {
+		return p.githubClient.targetBranch
+	}
+	return "main"
+}
+
+// writeFailureSummary renders the failure analysis section shared by PR bodies and analysis comments
+func writeFailureSummary(body *strings.Builder, analysis *FailureAnalysisResult) {
+	body.WriteString("## 📊 Failure Analysis\n\n")
+	switch run := analysis.Context.WorkflowRun; {
+	case run == nil:
+		body.WriteString(fmt.Sprintf("**Workflow Run**: %s\n", notAvailable))
+	case run.URL == "":
+		body.WriteString(fmt.Sprintf("**Workflow Run**: #%d\n", run.ID))
+	default:
+		body.WriteString(fmt.Sprintf("**Workflow Run**: [#%d](%s)\n", run.ID, run.URL))
+	}
+	if clustered := analysis.Context.ClusteredRuns; len(clustered) > 0 {
+		body.WriteString(fmt.Sprintf("**Same Failure In**: %s\n", clusteredRunsLine(clustered)))
+	}
+	body.WriteString(fmt.Sprintf("**Failure Type**: %s\n", valueOr(string(analysis.Classification.Type), notAvailable)))
+	body.WriteString(fmt.Sprintf("**Severity**: %s\n", valueOr(string(analysis.Classification.Severity), notAvailable)))
+	body.WriteString(fmt.Sprintf("**Confidence**: %s\n", formatConfidence(analysis.Classification.Confidence)))
+	body.WriteString(fmt.Sprintf("**Root Cause**: %s\n\n", valueOr(analysis.RootCause, notAvailable)))
+
+	if analysis.Description != "" {
+		body.WriteString(fmt.Sprintf("**Description**: %s\n\n", analysis.Description))
+	}
+}
+
+// writeValidationResults renders the test results and coverage a fix was validated with
+func writeValidationResults(body *strings.Builder, fix *FixValidationResult, proposed *ProposedFix, minCoverage int) {
+	required := notAvailable
+	if minCoverage > 0 {
+		required = fmt.Sprintf("%d%%", minCoverage)
 	}
+	body.WriteString("## 🧪 Validation Results\n\n")
+	result := fix.TestResult
+	if result == nil {
+		body.WriteString(fmt.Sprintf("**Tests Passed**: %s\n", notAvailable))
+		body.WriteString(fmt.Sprintf("**Test Coverage**: %s (Required: %s)\n\n", notAvailable, required))
+	} else {
+		body.WriteString(fmt.Sprintf("**Tests Passed**: %s\n", boolToEmoji(result.testsPassed())))
+		body.WriteString(fmt.Sprintf("**Test Coverage**: %s (Required: %s)\n", result.coverageText(), required))
+	}
+	if fix.CoverageNote != "" {
+		body.WriteString(fmt.Sprintf("**Note**: %s\n", fix.CoverageNote))
+	}
+	if c := fix.Coverage; c != nil {
+		body.WriteString(fmt.Sprintf("**Base Coverage**: %.1f%% on `%s` (%+.1f%% with this fix, tolerance %.1f%%, policy: %s)\n",
+			c.BaseCoverage, c.BaseBranch, c.Delta, c.Tolerance, fix.CoveragePolicy))
+	}
+	if result != nil {
+		body.WriteString(fmt.Sprintf("**Tests Run**: %d passed, %d failed, %d skipped\n\n", result.PassedTests, result.FailedTests, result.SkippedTests))
+		writeCoverageTable(body, result.FileCoverage, proposed.Changes)
+	}
+	if failed := result.FailedCases(); len(failed) > 0 {
+		body.WriteString("**Failed Tests**:\n")
+		for _, testCase := range failed {
+			if testCase.Message != "" {
+				body.WriteString(fmt.Sprintf("- `%s`: %s\n", testCase.Name, firstLine(testCase.Message)))
+			} else {
+				body.WriteString(fmt.Sprintf("- `%s`\n", testCase.Name))
+			}
+		}
+		body.WriteString("\n")
+	}
+	writeStepResults(body, fix.StepResults)
+}
+
+// writeStepResults lists the outcome of each validation step the fix was run through
+func writeStepResults(body *strings.Builder, steps []StepResult) {
+	if len(steps) == 0 {
+		return
+	}
+	body.WriteString("**Validation Steps**:\n")
+	for _, step := range steps {
+		status := "✅"
+		switch step.Status {
+		case StepFailed:
+			status = "❌"
+		case StepSkipped:
+			status = "⏭️"
+		}
+		line := fmt.Sprintf("- %s %s (`%s`)", status, step.Name, step.Command)
+		if step.Note != "" {
+			line += ": " + step.Note
+		}
+		body.WriteString(line + "\n")
+	}
+	body.WriteString("\n")
 }
 
 func (p *PullRequestEngine) generatePRTitle(analysis *FailureAnalysisResult, fix *ProposedFix) string {
+	analysis, fix = orEmptyAnalysis(analysis), orEmptyFix(fix)
 	caser := cases.Title(language.English)
-	fixType := caser.String(string(fix.Type))
-	failureType := caser.String(string(analysis.Classification.Type))
+	fixType := caser.String(valueOr(string(fix.Type), "fix"))
+	failureType := caser.String(valueOr(string(analysis.Classification.Type), "unknown"))
 
-	return fmt.Sprintf("🤖 Auto-fix: %s for %s failure (Run #%d)", fixType, failureType, analysis.Context.WorkflowRun.ID)
+	title := fmt.Sprintf("🤖 Auto-fix: %s for %s failure", fixType, failureType)
+	if run := analysis.Context.WorkflowRun; run != nil {
+		title += fmt.Sprintf(" (Run #%d)", run.ID)
+	}
+	return title
 }
 
 func (p *PullRequestEngine) generatePRBody(analysis *FailureAnalysisResult, fix *FixValidationResult) string {
+	analysis = orEmptyAnalysis(analysis)
+	if fix == nil {
+		fix = &FixValidationResult{}
+	}
+	proposed := orEmptyFix(fix.Fix)
+
 	var body strings.Builder
 
 	body.WriteString("## 🤖 Automated Fix\n\n")
 	body.WriteString("This pull request was automatically generated to fix a CI/CD pipeline failure.\n\n")
+	if previous := analysis.PreviousFix; previous != nil {
+		body.WriteString(fmt.Sprintf("> ♻️ Similar failure previously fixed in PR #%d\n\n", previous.PRNumber))
+	}
 
 	// Failure summary
-	body.WriteString("## 📊 Failure Analysis\n\n")
-	body.WriteString(fmt.Sprintf("**Workflow Run**: [#%d](%s)\n", analysis.Context.WorkflowRun.ID, analysis.Context.WorkflowRun.URL))
-	body.WriteString(fmt.Sprintf("**Failure Type**: %s\n", analysis.Classification.Type))
-	body.WriteString(fmt.Sprintf("**Severity**: %s\n", analysis.Classification.Severity))
-	body.WriteString(fmt.Sprintf("**Confidence**: %.1f%%\n", analysis.Classification.Confidence*100))
-	body.WriteString(fmt.Sprintf("**Root Cause**: %s\n\n", analysis.RootCause))
-
-	if analysis.Description != "" {
-		body.WriteString(fmt.Sprintf("**Description**: %s\n\n", analysis.Description))
+	writeFailureSummary(&body, analysis)
+	writeFailingSteps(&body, analysis.Context)
+	if len(analysis.Advisories) > 0 {
+		writeAdvisoriesTable(&body, analysis.Advisories)
 	}
 
 	// Fix details
 	body.WriteString("## 🔧 Fix Details\n\n")
-	body.WriteString(fmt.Sprintf("**Fix Type**: %s\n", fix.Fix.Type))
-	body.WriteString(fmt.Sprintf("**Fix Confidence**: %.1f%%\n", fix.Fix.Confidence*100))
-	body.WriteString(fmt.Sprintf("**Description**: %s\n\n", fix.Fix.Description))
+	body.WriteString(fmt.Sprintf("**Fix Type**: %s\n", valueOr(string(proposed.Type), notAvailable)))
+	body.WriteString(fmt.Sprintf("**Fix Confidence**: %s\n", formatConfidence(proposed.Confidence)))
+	body.WriteString(fmt.Sprintf("**Description**: %s\n\n", valueOr(proposed.Description, notAvailable)))
 
-	if fix.Fix.Rationale != "" {
-		body.WriteString(fmt.Sprintf("**Rationale**: %s\n\n", fix.Fix.Rationale))
+	if proposed.Rationale != "" {
+		body.WriteString(fmt.Sprintf("**Rationale**: %s\n\n", proposed.Rationale))
 	}
 
 	// Changes summary
-	if len(fix.Fix.Changes) > 0 {
-		body.WriteString("## 📝 Changes Made\n\n")
-		for _, change := range fix.Fix.Changes {
-			caser := cases.Title(language.English)
-			body.WriteString(fmt.Sprintf("- **%s**: %s `%s`\n", caser.String(change.Operation), change.FilePath, change.Explanation))
+	body.WriteString("## 📝 Changes Made\n\n")
+	if len(proposed.Changes) == 0 {
+		body.WriteString("No file changes.\n")
+	}
+	caser := cases.Title(language.English)
+	for _, change := range proposed.Changes {
+		line := fmt.Sprintf("- **%s**: %s", caser.String(valueOr(string(change.Operation), "change")), valueOr(change.displayPath(), notAvailable))
+		if change.Explanation != "" {
+			line += fmt.Sprintf(" `%s`", change.Explanation)
+		}
+		body.WriteString(line + "\n")
+	}
+	body.WriteString("\n")
+	writeChangeDiffs(&body, proposed.Changes)
+
+	writeValidationResults(&body, fix, proposed, p.minCoverage)
+
+	if len(proposed.GeneratedTests) > 0 {
+		body.WriteString("## 🧬 Generated Tests\n\n")
+		body.WriteString("These tests were generated for this fix and pass with it applied:\n\n")
+		for _, file := range proposed.GeneratedTests {
+			body.WriteString(fmt.Sprintf("- `%s`\n", file))
 		}
 		body.WriteString("\n")
 	}
 
-	// Test results
-	body.WriteString("## 🧪 Validation Results\n\n")
-	body.WriteString(fmt.Sprintf("**Tests Passed**: %s\n", boolToEmoji(fix.TestResult.Success)))
-	body.WriteString(fmt.Sprintf("**Test Coverage**: %.1f%% (Required: 85%%)\n", fix.TestResult.Coverage))
-	body.WriteString(fmt.Sprintf("**Tests Run**: %d passed, %d failed, %d skipped\n\n", fix.TestResult.PassedTests, fix.TestResult.FailedTests, fix.TestResult.SkippedTests))
+	if len(fix.GuardrailViolations) > 0 {
+		body.WriteString("## 🚧 Fix Guardrails\n\n")
+		body.WriteString("This fix exceeds the configured fix guardrails, review it with extra care:\n\n")
+		for _, violation := range fix.GuardrailViolations {
+			body.WriteString(fmt.Sprintf("- %s\n", violation))
+		}
+		body.WriteString("\n")
+	}
 
 	// Risks and benefits
-	if len(fix.Fix.Risks) > 0 {
+	if len(proposed.Risks) > 0 {
 		body.WriteString("## ⚠️ Potential Risks\n\n")
-		for _, risk := range fix.Fix.Risks {
+		for _, risk := range proposed.Risks {
 			body.WriteString(fmt.Sprintf("- %s\n", risk))
 		}
 		body.WriteString("\n")
 	}
 
-	if len(fix.Fix.Benefits) > 0 {
+	if len(proposed.Benefits) > 0 {
 		body.WriteString("## ✅ Benefits\n\n")
-		for _, benefit := range fix.Fix.Benefits {
+		for _, benefit := range proposed.Benefits {
 			body.WriteString(fmt.Sprintf("- %s\n", benefit))
 		}
 		body.WriteString("\n")
@@ -418,27 +862,117 @@ func (p *PullRequestEngine) generatePRBody(analysis *FailureAnalysisResult, fix
 
 	// Metadata
 	body.WriteString("## 🔍 Metadata\n\n")
-	body.WriteString(fmt.Sprintf("**Analysis ID**: `%s`\n", analysis.ID))
-	body.WriteString(fmt.Sprintf("**Fix ID**: `%s`\n", fix.Fix.ID))
-	body.WriteString(fmt.Sprintf("**LLM Provider**: %s\n", analysis.LLMProvider))
-	body.WriteString(fmt.Sprintf("**Generated**: %s\n\n", fix.Fix.Timestamp.Format(time.RFC3339)))
+	body.WriteString(fmt.Sprintf("**Analysis ID**: %s\n", codeOr(analysis.ID)))
+	if len(analysis.Jobs) > 0 {
+		body.WriteString(fmt.Sprintf("**Failed Jobs**: %s\n", strings.Join(analysis.Jobs, ", ")))
+	}
+	body.WriteString(fmt.Sprintf("**Fix ID**: %s\n", codeOr(proposed.ID)))
+	body.WriteString(fmt.Sprintf("**LLM Provider**: %s\n", valueOr(string(analysis.LLMProvider), notAvailable)))
+	if len(analysis.ModelsUsed) > 0 {
+		body.WriteString(fmt.Sprintf("**LLM Models**: %s\n", strings.Join(analysis.ModelsUsed, ", ")))
+	}
+	if usage := analysis.LLMUsage; usage != nil && usage.Requests > 0 {
+		body.WriteString(fmt.Sprintf("**LLM Tokens**: %d (%d prompt, %d completion)\n", usage.TotalTokens, usage.PromptTokens, usage.CompletionTokens))
+		body.WriteString(fmt.Sprintf("**Estimated LLM Cost**: $%.4f\n", usage.EstimatedCostUSD))
+	}
+	body.WriteString(fmt.Sprintf("**Generated**: %s\n\n", formatTime(proposed.Timestamp)))
+
+	body.WriteString(prBodyFooter)
+
+	return embedPRMetadata(body.String(), newPRMetadata(analysis, proposed))
+}
+
+// prBodyFooter ends every generated fix PR body
+const prBodyFooter = "---\n*This PR was automatically generated by the GitHub Actions Auto-Fix Agent*\n"
 
-	body.WriteString("---\n")
-	body.WriteString("*This PR was automatically generated by the GitHub Actions Auto-Fix Agent*\n")
+// insertBeforeFooter adds section to a generated PR body above its footer, which only the
+// metadata block follows
+func insertBeforeFooter(body, section string) string {
+	if section == "" {
+		return body
+	}
+	if i := strings.LastIndex(body, prBodyFooter); i >= 0 {
+		return body[:i] + section + body[i:]
+	}
+	return body + "\n" + section
+}
+
+// prReviewRequirements are the approvals and code owners a fix PR needs on its target branch
+type prReviewRequirements struct {
+	rules  *BranchReviewRules // nil when unprotected or unknown
+	owners []string           // @user and @org/team code owners of the changed files
+}
+
+// reviewRequirements reads the target branch protection and the CODEOWNERS file. Failures
+// are logged and leave the PR without the extra reviewers, like other PR metadata.
+func (p *PullRequestEngine) reviewRequirements(ctx context.Context, baseBranch string, changes []CodeChange) prReviewRequirements {
+	var review prReviewRequirements
+	rules, err := p.githubClient.GetBranchReviewRules(ctx, baseBranch)
+	switch {
+	case errors.Is(err, ErrGitHubAuth):
+		p.logger.WithField("branch", baseBranch).Debug("Token cannot read branch protection, required approvals unknown")
+	case err != nil:
+		p.logger.WithError(err).Warn("Failed to get branch protection")
+	default:
+		review.rules = rules
+	}
 
+	owners, err := p.githubClient.GetCodeowners(ctx, baseBranch)
+	if err != nil {
+		p.logger.WithError(err).Warn("Failed to read CODEOWNERS")
+	}
+	if owners == nil {
+		return review
+	}
+	if len(owners.Invalid) > 0 {
+		p.logger.WithField("lines", owners.Invalid).Warn("Ignoring CODEOWNERS lines GitHub does not support")
+	}
+	files := make([]string, 0, len(changes))
+	for _, change := range changes {
+		files = append(files, change.paths()...)
+	}
+	review.owners = owners.OwnersOf(files)
+	return review
+}
+
+// section renders the review requirements for the PR body, or "" when there are none
+func (r prReviewRequirements) section() string {
+	if r.rules == nil && len(r.owners) == 0 {
+		return ""
+	}
+	var body strings.Builder
+	body.WriteString("## 👀 Review Requirements\n\n")
+	if r.rules != nil {
+		approvals := fmt.Sprintf("**Required approvals**: %d", r.rules.RequiredApprovals)
+		if r.rules.RequireCodeOwnerReviews {
+			approvals += ", including a code owner"
+		}
+		body.WriteString(approvals + "\n")
+	}
+	if len(r.owners) > 0 {
+		body.WriteString(fmt.Sprintf("**Code Owners**: %s\n", strings.Join(r.owners, ", ")))
+	}
+	body.WriteString("\n")
 	return body.String()
 }
 
 func (p *PullRequestEngine) generatePRLabels(analysis *FailureAnalysisResult, fix *ProposedFix) []string {
-	labels := []string{
-		"autofix",
-		"automated",
-		string(fix.Type) + "-fix",
-		string(analysis.Classification.Type) + "-failure",
+	analysis, fix = orEmptyAnalysis(analysis), orEmptyFix(fix)
+	labels := []string{"autofix", "automated"}
+	if fix.Type != "" {
+		labels = append(labels, string(fix.Type)+"-fix")
+	}
+	if analysis.Classification.Type != "" {
+		labels = append(labels, string(analysis.Classification.Type)+"-failure")
 	}
 
-	// Add severity label
-	switch analysis.Classification.Severity {
+	// Add severity label; critical advisories make any failure critical
+	severity := analysis.Classification.Severity
+	if hasCriticalAdvisory(analysis.Advisories) {
+		severity = Critical
+		labels = append(labels, "security")
+	}
+	switch severity {
 	case Critical:
 		labels = append(labels, "priority-critical")
 	case High:
@@ -462,94 +996,155 @@ func (p *PullRequestEngine) generatePRLabels(analysis *FailureAnalysisResult, fi
 }
 
 func (p *PullRequestEngine) createPullRequest(ctx context.Context, options *PRCreationOptions) (*PullRequest, error) {
-	newPR := &github.NewPullRequest{
-		Title: &options.Title,
-		Head:  &options.BranchName,
-		Base:  &options.TargetBranch,
-		Body:  &options.Body,
-		Draft: &options.Draft,
-	}
-
-	pr, _, err := p.githubClient.client.PullRequests.Create(ctx, p.githubClient.repoOwner, p.githubClient.repoName, newPR)
+	pr, err := p.client.CreatePullRequest(ctx, options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create PR: %w", err)
+		return nil, err
 	}
 
-	// Add labels
-	if len(options.Labels) > 0 {
-		if _, _, err := p.githubClient.client.Issues.AddLabelsToIssue(ctx, p.githubClient.repoOwner, p.githubClient.repoName, pr.GetNumber(), options.Labels); err != nil {
-			p.logger.WithError(err).Warn("Failed to add labels to PR")
+	// Enable auto-merge, leaving the PR open for a manual merge when the repository disallows it
+	if options.AutoMerge && !options.Draft && p.githubClient != nil {
+		if err := p.githubClient.EnableAutoMerge(ctx, pr.NodeID); err != nil {
+			p.logger.WithError(err).WithField("pr_number", pr.Number).Warn("Failed to enable auto-merge")
 		}
 	}
 
-	// Request reviewers
-	if len(options.Reviewers) > 0 {
-		reviewersRequest := github.ReviewersRequest{
-			Reviewers: options.Reviewers,
-		}
-		if _, _, err := p.githubClient.client.PullRequests.RequestReviewers(ctx, p.githubClient.repoOwner, p.githubClient.repoName, pr.GetNumber(), reviewersRequest); err != nil {
-			p.logger.WithError(err).Warn("Failed to request reviewers")
-		}
-	}
+	return pr, nil
+}
 
-	// Assign assignees
-	if len(options.Assignees) > 0 {
-		if _, _, err := p.githubClient.client.Issues.AddAssignees(ctx, p.githubClient.repoOwner, p.githubClient.repoName, pr.GetNumber(), options.Assignees); err != nil {
-			p.logger.WithError(err).Warn("Failed to add assignees")
+func (p *PullRequestEngine) addPRMetadata(ctx context.Context, pr *PullRequest, analysis *FailureAnalysisResult, fix *FixValidationResult) error {
+	analysis = orEmptyAnalysis(analysis)
+	validationDuration, testOutput := notAvailable, notAvailable
+	if fix != nil && fix.TestResult != nil {
+		if fix.TestResult.Duration > 0 {
+			validationDuration = fix.TestResult.Duration.String()
 		}
+		testOutput = valueOr(truncateString(fix.TestResult.Output, 500), notAvailable)
+	}
+	processingTime := notAvailable
+	if analysis.ProcessingTime > 0 {
+		processingTime = analysis.ProcessingTime.String()
+	}
+	tags := notAvailable
+	if len(analysis.Classification.Tags) > 0 {
+		tags = strings.Join(analysis.Classification.Tags, ", ")
 	}
 
-	return &PullRequest{
-		Number:    pr.GetNumber(),
-		Title:     pr.GetTitle(),
-		Body:      pr.GetBody(),
-		URL:       pr.GetHTMLURL(),
-		Branch:    options.BranchName,
-		CommitSHA: pr.GetHead().GetSHA(),
-		State:     pr.GetState(),
-		CreatedAt: pr.GetCreatedAt(),
-		Author:    pr.GetUser().GetLogin(),
-		Labels:    options.Labels,
-	}, nil
-}
-
-func (p *PullRequestEngine) addPRMetadata(ctx context.Context, pr *PullRequest, analysis *FailureAnalysisResult, fix *FixValidationResult) error {
 	// Add a comment with additional metadata
 	metadataComment := fmt.Sprintf(`## 🔍 Additional Metadata
 
 **Analysis Details:**
-- Processing Time: %v
+- Processing Time: %s
 - Error Patterns: %d detected
 - Affected Files: %d
 - Classification Tags: %s
 
 **Fix Validation:**
-- Validation Duration: %v
+- Validation Duration: %s
 - Test Output: %s
 
 **Provider Information:**
 - LLM Provider: %s
-- Model: %s
+- Models: %s
 `,
-		analysis.ProcessingTime,
+		processingTime,
 		len(analysis.ErrorPatterns),
 		len(analysis.AffectedFiles),
-		strings.Join(analysis.Classification.Tags, ", "),
-		fix.TestResult.Duration,
-		truncateString(fix.TestResult.Output, 500),
-		analysis.LLMProvider,
-		"N/A", // Model info would need to be added to the response
+		tags,
+		validationDuration,
+		testOutput,
+		valueOr(string(analysis.LLMProvider), notAvailable),
+		valueOr(strings.Join(analysis.ModelsUsed, ", "), notAvailable),
 	)
 
-	comment := &github.IssueComment{
-		Body: &metadataComment,
+	return p.client.AddPullRequestComment(ctx, pr.Number, metadataComment)
+}
+
+// Helper functions
+
+// notAvailable is rendered in PR content for values the analysis or validation did not produce
+const notAvailable = "not available"
+
+// maxPRDiffBytes is how much of each file's diff a pull request body shows
+const maxPRDiffBytes = 8000
+
+// writeChangeDiffs writes the diff of each change as a collapsible block
+func writeChangeDiffs(body *strings.Builder, changes []CodeChange) {
+	for _, change := range changes {
+		diff := changeDiff(change)
+		if diff == "" {
+			continue
+		}
+		diff, omitted := truncateDiff(diff, maxPRDiffBytes)
+		fence := codeFence(diff)
+		body.WriteString(fmt.Sprintf("<details>\n<summary>Diff of <code>%s</code></summary>\n\n", html.EscapeString(change.displayPath())))
+		body.WriteString(fence + "diff\n" + diff + fence + "\n")
+		if omitted > 0 {
+			body.WriteString(fmt.Sprintf("\n_Diff truncated, %d more lines not shown._\n", omitted))
+		}
+		body.WriteString("\n</details>\n\n")
 	}
+}
 
-	_, _, err := p.githubClient.client.Issues.CreateComment(ctx, p.githubClient.repoOwner, p.githubClient.repoName, pr.Number, comment)
-	return err
+// codeFence returns a backtick fence longer than any backtick run in s
+func codeFence(s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
 }
 
-// Helper functions
+// orEmptyAnalysis lets PR content render without an analysis
+func orEmptyAnalysis(analysis *FailureAnalysisResult) *FailureAnalysisResult {
+	if analysis == nil {
+		return &FailureAnalysisResult{}
+	}
+	return analysis
+}
+
+// orEmptyFix lets PR content render without a proposed fix
+func orEmptyFix(fix *ProposedFix) *ProposedFix {
+	if fix == nil {
+		return &ProposedFix{}
+	}
+	return fix
+}
+
+// valueOr returns s, or fallback when s is empty
+func valueOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// codeOr formats s as inline code, or notAvailable when empty
+func codeOr(s string) string {
+	if s == "" {
+		return notAvailable
+	}
+	return "`" + s + "`"
+}
+
+// formatConfidence renders a 0-1 confidence as a percentage; zero means it was never set
+func formatConfidence(confidence float64) string {
+	if confidence <= 0 {
+		return notAvailable
+	}
+	return fmt.Sprintf("%.1f%%", confidence*100)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return notAvailable
+	}
+	return t.Format(time.RFC3339)
+}
 
 func boolToEmoji(b bool) string {
 	if b {
@@ -565,6 +1160,16 @@ func truncateString(s string, maxLen int) string {
 	return s[:maxLen] + "..."
 }
 
+// firstLine returns the first non-empty line of s, truncated for inline display
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return truncateString(line, 200)
+		}
+	}
+	return ""
+}
+
 func loadPRTemplates() *PRTemplates {
 	return &PRTemplates{
 		Title: "🤖 Auto-fix: {{.FixType}} for {{.FailureType}} failure",
@@ -580,7 +1185,7 @@ This pull request was automatically generated to fix a CI/CD pipeline failure.
 
 ---
 *This PR was automatically generated by the GitHub Actions Auto-Fix Agent*`,
-		CommitMsg: "fix: {{.Description}}\n\nGenerated by GitHub Actions Auto-Fix Agent\nAnalysis ID: {{.AnalysisID}}\nFix ID: {{.FixID}}",
+		CommitMsg: DefaultCommitTemplate,
 		Labels:    []string{"autofix", "automated", "ci-fix"},
 		Reviewers: []string{}, // Can be configured per project
 	}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Redaction types, reported in [REDACTED:<type>] markers and the redactions metric
+const (
+	RedactionGitHubToken  = "github_token"
+	RedactionLLMAPIKey    = "llm_api_key"
+	RedactionAWSAccessKey = "aws_access_key"
+	RedactionNPMToken     = "npm_token"
+	RedactionJWT          = "jwt"
+	RedactionBearerToken  = "bearer_token"
+	RedactionAssignment   = "credential"
+	RedactionBase64       = "base64"
+	RedactionWebhook      = "webhook_url"
+	RedactionCustom       = "custom"
+)
+
+const (
+	redactedPrefix = "[REDACTED:"
+	// base64MinLength is the shortest base64 run treated as an encoded secret
+	base64MinLength = 64
+	// minSecretLength is the shortest configured secret masked verbatim; shorter values
+	// would mask unrelated text
+	minSecretLength = 8
+)
+
+// redactionPattern masks matches of re. Only the group submatch is replaced, so an
+// assignment keeps its key, and matches rejected by keep are left alone.
+type redactionPattern struct {
+	name  string
+	re    *regexp.Regexp
+	group int
+	keep  func(match string) bool
+}
+
+// builtinRedactionPatterns apply in order, so specific token shapes are named before the
+// generic assignment and base64 patterns see them
+var builtinRedactionPatterns = []redactionPattern{
+	{name: RedactionGitHubToken, re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{20,}|github_pat_[A-Za-z0-9_]{20,})`)},
+	{name: RedactionLLMAPIKey, re: regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`)},
+	{name: RedactionAWSAccessKey, re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{name: RedactionNPMToken, re: regexp.MustCompile(`\bnpm_[A-Za-z0-9]{36}\b`)},
+	{name: RedactionJWT, re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{name: RedactionBearerToken, re: regexp.MustCompile(`(?i)(\bbearer\s+)([A-Za-z0-9._~+/-]{16,}=*)`), group: 2},
+	{
+		name:  RedactionAssignment,
+		re:    regexp.MustCompile(`(?i)([A-Za-z0-9_.-]*(?:password|passwd|secret|token|api[_-]?key|access[_-]?key)["']?\s*[=:]\s*["']?)([^\s"'&,;=][^\s"'&,;]{2,})`),
+		group: 2,
+	},
+	{name: RedactionBase64, re: regexp.MustCompile(fmt.Sprintf(`[A-Za-z0-9+/]{%d,}={0,2}`, base64MinLength)), keep: notBase64Secret},
+}
+
+// notBase64Secret keeps long runs that are hex digests, such as commit SHAs, or lack the
+// mixed case and digits of encoded data, such as file paths
+func notBase64Secret(match string) bool {
+	var upper, lower, digit, hex = false, false, false, true
+	for _, r := range match {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= '0' && r <= '9':
+			digit = true
+		}
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			hex = false
+		}
+	}
+	return hex || !(upper && lower && digit)
+}
+
+type namedSecret struct {
+	name, value string
+}
+
+// Redactor masks credentials in workflow logs, LLM prompts, test output and log entries
+type Redactor struct {
+	patterns []redactionPattern
+
+	mu      sync.RWMutex
+	secrets []namedSecret
+}
+
+// NewRedactor creates a redactor with the built-in patterns followed by the given
+// regular expressions, whose matches are reported as custom
+func NewRedactor(patterns []string) (*Redactor, error) {
+	r := &Redactor{patterns: append([]redactionPattern{}, builtinRedactionPatterns...)}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, redactionPattern{name: RedactionCustom, re: re})
+	}
+	return r, nil
+}
+
+// AddSecret masks every occurrence of value, reported as name. Values shorter than
+// minSecretLength are ignored.
+func (r *Redactor) AddSecret(name, value string) {
+	if r == nil || len(value) < minSecretLength {
+		return
+	}
+	r.mu.Lock()
+	r.secrets = append(r.secrets, namedSecret{name: name, value: value})
+	r.mu.Unlock()
+}
+
+// Redact returns s with configured secrets and credential-like values replaced by
+// [REDACTED:<type>]
+func (r *Redactor) Redact(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+
+	r.mu.RLock()
+	for _, secret := range r.secrets {
+		if n := strings.Count(s, secret.value); n > 0 {
+			s = strings.ReplaceAll(s, secret.value, redactionMarker(secret.name))
+			agentMetrics.redactions.add(float64(n), secret.name)
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, pattern := range r.patterns {
+		s = pattern.apply(s)
+	}
+	return s
+}
+
+// RedactLogs redacts workflow logs in place before they are analyzed
+func (r *Redactor) RedactLogs(logs *WorkflowLogs) {
+	if r == nil || logs == nil {
+		return
+	}
+	logs.RawLogs = r.Redact(logs.RawLogs)
+	for job, log := range logs.JobLogs {
+		logs.JobLogs[job] = r.Redact(log)
+	}
+	for step, log := range logs.StepLogs {
+		logs.StepLogs[step] = r.Redact(log)
+	}
+	for i, line := range logs.ErrorLines {
+		logs.ErrorLines[i] = r.Redact(line)
+	}
+	for _, lines := range logs.JobErrorLines {
+		for i, line := range lines {
+			lines[i] = r.Redact(line)
+		}
+	}
+	for i := range logs.Annotations {
+		logs.Annotations[i].Title = r.Redact(logs.Annotations[i].Title)
+		logs.Annotations[i].Message = r.Redact(logs.Annotations[i].Message)
+	}
+}
+
+// RedactTestResult redacts test output in place before it reaches PR bodies and comments
+func (r *Redactor) RedactTestResult(result *TestResult) {
+	if r == nil || result == nil {
+		return
+	}
+	result.Output = r.Redact(result.Output)
+	for i, message := range result.Errors {
+		result.Errors[i] = r.Redact(message)
+	}
+	for i := range result.Cases {
+		result.Cases[i].Message = r.Redact(result.Cases[i].Message)
+	}
+}
+
+func (p redactionPattern) apply(s string) string {
+	matches := p.re.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range matches {
+		start, end := match[2*p.group], match[2*p.group+1]
+		if start < 0 {
+			continue
+		}
+		value := s[start:end]
+		// Values already masked by an earlier pattern are left alone
+		if strings.HasPrefix(value, redactedPrefix) || (p.keep != nil && p.keep(value)) {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(redactionMarker(p.name))
+		last = end
+		agentMetrics.redactions.inc(p.name)
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func redactionMarker(name string) string {
+	return redactedPrefix + name + "]"
+}
+
+// redactionHook masks log messages and string and error fields before they are written
+type redactionHook struct {
+	redactor *Redactor
+}
+
+func newRedactionHook(redactor *Redactor) logrus.Hook {
+	return &redactionHook{redactor: redactor}
+}
+
+// Levels returns every log level
+func (h *redactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire redacts the entry; logrus passes each hook its own copy of the entry's fields
+func (h *redactionHook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.redactor.Redact(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = h.redactor.Redact(v)
+		case []string:
+			redacted := make([]string, len(v))
+			for i, item := range v {
+				redacted[i] = h.redactor.Redact(item)
+			}
+			entry.Data[key] = redacted
+		case error:
+			if message := h.redactor.Redact(v.Error()); message != v.Error() {
+				entry.Data[key] = errors.New(message)
+			}
+		}
+	}
+	return nil
+}
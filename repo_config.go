@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// RepoConfigPath is the file repositories tune the agent with, read from the branch fixes
+// target
+const RepoConfigPath = ".github/autofix.yml"
+
+// RepoConfig is the configuration a repository keeps in RepoConfigPath. It can only make the
+// agent more careful with the repository: settings loosening the agent configuration are
+// ignored.
+type RepoConfig struct {
+	// Enabled false keeps fix pull requests away from the repository; failures only get an
+	// analysis comment
+	Enabled *bool `yaml:"enabled"`
+	// Policy sets PR policy actions by failure type and min_confidence, as the POLICY_
+	// config entries do
+	Policy map[string]string `yaml:"policy"`
+	// MinCoverage is the minimum test coverage of fixes
+	MinCoverage int `yaml:"min_coverage"`
+	// ProtectedPaths are CODEOWNERS style patterns of files no fix may change, on top of the
+	// agent's
+	ProtectedPaths []string `yaml:"protected_paths"`
+	// Reviewers are requested on fix pull requests; org/team names request teams
+	Reviewers     []string                 `yaml:"reviewers"`
+	Notifications RepoNotificationSettings `yaml:"notifications"`
+}
+
+// RepoNotificationSettings choose the notifications sent for a repository
+type RepoNotificationSettings struct {
+	// Events are the notification events sent for the repository; empty sends every event
+	Events []NotificationEvent `yaml:"events"`
+}
+
+// notificationEvents are the events a repository can choose
+var notificationEvents = []NotificationEvent{
+	FailureDetected, AnalysisCompleted, FixPROpened, FixValidationFailed, AutoFixAborted, MonitorFailing,
+}
+
+// ParseRepoConfig parses and validates a repository configuration file. Unknown keys are
+// rejected, so misspelled settings are not silently ignored.
+func ParseRepoConfig(data []byte) (*RepoConfig, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	config := &RepoConfig{}
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid %s: %w", RepoConfigPath, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", RepoConfigPath, err)
+	}
+	return config, nil
+}
+
+// validate checks the policy, coverage, protected paths and notification events
+func (c *RepoConfig) validate() error {
+	if _, err := c.prPolicy(); err != nil {
+		return err
+	}
+	if c.MinCoverage < 0 || c.MinCoverage > 100 {
+		return fmt.Errorf("min_coverage must be between 0 and 100, got %d", c.MinCoverage)
+	}
+	for _, pattern := range c.ProtectedPaths {
+		if _, err := codeownersPattern(pattern); err != nil {
+			return fmt.Errorf("invalid protected path: %w", err)
+		}
+	}
+	for _, event := range c.Notifications.Events {
+		if !containsEvent(notificationEvents, event) {
+			return fmt.Errorf("unknown notification event %q", event)
+		}
+	}
+	return nil
+}
+
+// prPolicy returns the PR policy the repository asks for
+func (c *RepoConfig) prPolicy() (PRPolicy, error) {
+	policy := PRPolicy{Actions: make(map[FailureType]PRPolicyAction)}
+	for name, value := range c.Policy {
+		value = strings.TrimSpace(value)
+		if name == "min_confidence" {
+			confidence, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return PRPolicy{}, fmt.Errorf("invalid policy min_confidence: %w", err)
+			}
+			policy.MinConfidence = confidence
+			continue
+		}
+
+		failureType, err := ParseFailureType(name)
+		if err != nil || failureType == UnknownFailure {
+			return PRPolicy{}, fmt.Errorf("invalid policy: unknown failure type %q", name)
+		}
+		action := PRPolicyAction(strings.ToLower(value))
+		if err := validatePRPolicyAction(action); err != nil {
+			return PRPolicy{}, fmt.Errorf("invalid policy for %s failures: %w", name, err)
+		}
+		policy.Actions[failureType] = action
+	}
+	if err := policy.validate(); err != nil {
+		return PRPolicy{}, err
+	}
+	return policy, nil
+}
+
+func containsEvent(events []NotificationEvent, event NotificationEvent) bool {
+	for _, e := range events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// repoSettings are the settings a fix of a repository runs with: the agent configuration,
+// made stricter by the repository configuration
+type repoSettings struct {
+	Disabled   bool
+	PRPolicy   PRPolicy
+	Guardrails FixGuardrails
+	// MinCoverage is the minimum test coverage of fixes
+	MinCoverage int
+	// Reviewers and TeamReviewers are requested on fix pull requests on top of the agent's
+	Reviewers     []string
+	TeamReviewers []string
+	// NotificationEvents are the events notified, nil for every event
+	NotificationEvents []NotificationEvent
+}
+
+// decide applies the PR policy to the selected fix, withholding pull requests from disabled
+// repositories
+func (s repoSettings) decide(analysis *FailureAnalysisResult, fix *FixValidationResult) PRPolicyDecision {
+	if s.Disabled {
+		return PRPolicyDecision{Action: PRPolicyAnalysisOnly, Reason: "fixes are disabled by " + RepoConfigPath}
+	}
+	return s.PRPolicy.decide(analysis, fix)
+}
+
+// notifies tells whether event is notified
+func (s repoSettings) notifies(event NotificationEvent) bool {
+	return s.NotificationEvents == nil || containsEvent(s.NotificationEvents, event)
+}
+
+// prPolicyRank orders PR policy actions from the least to the most careful
+var prPolicyRank = map[PRPolicyAction]int{PRPolicyAuto: 0, PRPolicyDraft: 1, PRPolicyAnalysisOnly: 2}
+
+// agentSettings returns the settings of the agent configuration alone
+func (m *DaggerAutofix) agentSettings() repoSettings {
+	return repoSettings{PRPolicy: m.PRPolicy, Guardrails: m.fixGuardrails(), MinCoverage: m.MinCoverage}
+}
+
+// mergeRepoConfig returns the agent settings made stricter by config. Policy actions, the
+// policy's minimum confidence and the minimum coverage only apply where they are stricter
+// than the agent's; protected paths and reviewers are added to the agent's. The notification
+// events are not about safety, so the repository chooses them.
+func (m *DaggerAutofix) mergeRepoConfig(config *RepoConfig) repoSettings {
+	settings := m.agentSettings()
+	if config == nil {
+		return settings
+	}
+	ignored := func(setting string, value interface{}) {
+		m.logger.WithFields(logrus.Fields{"setting": setting, "value": value}).
+			Warnf("Ignoring %s setting that is less strict than the agent configuration", RepoConfigPath)
+	}
+
+	if config.Enabled != nil && !*config.Enabled {
+		settings.Disabled = true
+	}
+
+	// The config is validated when parsed, so its policy is valid
+	policy, _ := config.prPolicy()
+	actions := make(map[FailureType]PRPolicyAction, len(m.PRPolicy.Actions)+len(policy.Actions))
+	for failureType, action := range m.PRPolicy.Actions {
+		actions[failureType] = action
+	}
+	failureTypes := make([]FailureType, 0, len(policy.Actions))
+	for failureType := range policy.Actions {
+		failureTypes = append(failureTypes, failureType)
+	}
+	sort.Slice(failureTypes, func(i, j int) bool { return failureTypes[i] < failureTypes[j] })
+	for _, failureType := range failureTypes {
+		action := policy.Actions[failureType]
+		if prPolicyRank[action] < prPolicyRank[m.PRPolicy.actionFor(failureType)] {
+			ignored("policy."+string(failureType), action)
+			continue
+		}
+		actions[failureType] = action
+	}
+	settings.PRPolicy = PRPolicy{Actions: actions, MinConfidence: m.PRPolicy.MinConfidence}
+	if policy.MinConfidence > settings.PRPolicy.MinConfidence {
+		settings.PRPolicy.MinConfidence = policy.MinConfidence
+	} else if _, ok := config.Policy["min_confidence"]; ok && policy.MinConfidence < settings.PRPolicy.MinConfidence {
+		ignored("policy.min_confidence", policy.MinConfidence)
+	}
+
+	if config.MinCoverage > settings.MinCoverage {
+		settings.MinCoverage = config.MinCoverage
+	} else if config.MinCoverage != 0 && config.MinCoverage < settings.MinCoverage {
+		ignored("min_coverage", config.MinCoverage)
+	}
+
+	settings.Guardrails.ProtectedPaths = mergeNames(settings.Guardrails.ProtectedPaths, config.ProtectedPaths)
+	settings.Reviewers, settings.TeamReviewers = parseReviewers(config.Reviewers)
+	if len(config.Notifications.Events) > 0 {
+		settings.NotificationEvents = config.Notifications.Events
+	}
+	return settings
+}
+
+// repoConfig returns the configuration of the repository at the head of the branch fixes
+// target, nil when it has none. Configurations are cached per head commit, so they are only
+// read again once the branch moved. Missing and invalid files are logged and leave the agent
+// configuration in effect.
+func (m *DaggerAutofix) repoConfig(ctx context.Context) *RepoConfig {
+	_, sha, err := m.githubClient.GetBaseBranchHead(ctx)
+	if err != nil || sha == "" {
+		m.logger.WithError(err).Warnf("Failed to resolve the base branch head, ignoring %s", RepoConfigPath)
+		return nil
+	}
+	key := m.repositoryName() + "@" + sha
+	m.repoConfigMu.Lock()
+	config, ok := m.repoConfigs[key]
+	m.repoConfigMu.Unlock()
+	if ok {
+		return config
+	}
+
+	logger := m.logger.WithFields(logrus.Fields{"file": RepoConfigPath, "ref": shortSHA(sha)})
+	content, found, err := m.githubClient.GetFileContent(ctx, RepoConfigPath, sha)
+	switch {
+	case err != nil:
+		// Not cached, so the next fix tries again
+		logger.WithError(err).Warn("Failed to read the repository configuration, using the agent configuration")
+		return nil
+	case !found:
+		logger.Warn("Repository has no configuration file, using the agent configuration")
+	default:
+		if config, err = ParseRepoConfig([]byte(content)); err != nil {
+			logger.WithError(err).Warn("Ignoring the invalid repository configuration, using the agent configuration")
+		}
+	}
+
+	m.repoConfigMu.Lock()
+	if m.repoConfigs == nil {
+		m.repoConfigs = make(map[string]*RepoConfig)
+	}
+	m.repoConfigs[key] = config
+	m.repoConfigMu.Unlock()
+	return config
+}
+
+// repoSettingsContextKey carries the settings of the fix through the fix pipeline
+type repoSettingsContextKey struct{}
+
+// withRepoSettings makes the fix of ctx run with settings
+func withRepoSettings(ctx context.Context, settings repoSettings) context.Context {
+	return context.WithValue(ctx, repoSettingsContextKey{}, settings)
+}
+
+// settings returns the settings the fix of ctx runs with, the agent's outside of fixes
+func (m *DaggerAutofix) settings(ctx context.Context) repoSettings {
+	if settings, ok := ctx.Value(repoSettingsContextKey{}).(repoSettings); ok {
+		return settings
+	}
+	return m.agentSettings()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseRepoConfig tests parsing and validating repository configuration files
+func TestParseRepoConfig(t *testing.T) {
+	config, err := ParseRepoConfig([]byte(`
+enabled: true
+policy:
+  security: analysis-only
+  test: draft
+  min_confidence: 0.8
+min_coverage: 90
+protected_paths: ["migrations/**", "*.tf"]
+reviewers: ["@alice", "acme/platform"]
+notifications:
+  events: [fix_pr_opened, autofix_aborted]
+`))
+	require.NoError(t, err)
+	assert.True(t, *config.Enabled)
+	assert.Equal(t, 90, config.MinCoverage)
+	assert.Equal(t, []string{"migrations/**", "*.tf"}, config.ProtectedPaths)
+	assert.Equal(t, []NotificationEvent{FixPROpened, AutoFixAborted}, config.Notifications.Events)
+	policy, err := config.prPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, PRPolicy{
+		Actions:       map[FailureType]PRPolicyAction{SecurityFailure: PRPolicyAnalysisOnly, TestFailure: PRPolicyDraft},
+		MinConfidence: 0.8,
+	}, policy)
+
+	config, err = ParseRepoConfig(nil)
+	require.NoError(t, err, "an empty file configures nothing")
+	assert.Nil(t, config.Enabled)
+
+	invalid := map[string]string{
+		"unknown key":    "min_coverrage: 90\n",
+		"unknown action": "policy:\n  security: never\n",
+		"unknown type":   "policy:\n  flaky: draft\n",
+		"confidence":     "policy:\n  min_confidence: 2\n",
+		"coverage":       "min_coverage: 120\n",
+		"event":          "notifications:\n  events: [pr_merged]\n",
+		"not yaml":       "enabled: [\n",
+	}
+	for name, content := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseRepoConfig([]byte(content))
+			assert.ErrorContains(t, err, "invalid "+RepoConfigPath)
+		})
+	}
+}
+
+// TestMergeRepoConfig tests that a repository configuration only makes the agent stricter
+func TestMergeRepoConfig(t *testing.T) {
+	m := &DaggerAutofix{
+		logger:        quietLogger(),
+		MinCoverage:   80,
+		PRPolicy:      PRPolicy{Actions: map[FailureType]PRPolicyAction{BuildFailure: PRPolicyDraft}, MinConfidence: 0.5},
+		FixGuardrails: FixGuardrails{ProtectedPaths: []string{"infra/**"}},
+	}
+	parse := func(content string) *RepoConfig {
+		config, err := ParseRepoConfig([]byte(content))
+		require.NoError(t, err)
+		return config
+	}
+
+	t.Run("NoConfig", func(t *testing.T) {
+		assert.Equal(t, m.agentSettings(), m.mergeRepoConfig(nil))
+	})
+
+	t.Run("Stricter", func(t *testing.T) {
+		settings := m.mergeRepoConfig(parse(`
+policy:
+  build: analysis-only
+  test: draft
+  min_confidence: 0.7
+min_coverage: 90
+protected_paths: [migrations/**]
+reviewers: [alice, acme/platform]
+`))
+		assert.Equal(t, PRPolicyAnalysisOnly, settings.PRPolicy.actionFor(BuildFailure))
+		assert.Equal(t, PRPolicyDraft, settings.PRPolicy.actionFor(TestFailure))
+		assert.Equal(t, 0.7, settings.PRPolicy.MinConfidence)
+		assert.Equal(t, 90, settings.MinCoverage)
+		assert.Equal(t, []string{"infra/**", "migrations/**"}, settings.Guardrails.ProtectedPaths)
+		assert.Equal(t, []string{"alice"}, settings.Reviewers)
+		assert.Equal(t, []string{"platform"}, settings.TeamReviewers)
+		assert.False(t, settings.Disabled)
+	})
+
+	t.Run("LooserIgnored", func(t *testing.T) {
+		settings := m.mergeRepoConfig(parse(`
+enabled: true
+policy:
+  build: auto
+  security: auto
+  min_confidence: 0.1
+min_coverage: 50
+`))
+		assert.Equal(t, PRPolicyDraft, settings.PRPolicy.actionFor(BuildFailure), "the agent's draft policy stays")
+		assert.Equal(t, PRPolicyDraft, settings.PRPolicy.actionFor(SecurityFailure), "the default draft policy stays")
+		assert.Equal(t, 0.5, settings.PRPolicy.MinConfidence)
+		assert.Equal(t, 80, settings.MinCoverage)
+		assert.Equal(t, []string{"infra/**"}, settings.Guardrails.ProtectedPaths)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		settings := m.mergeRepoConfig(parse("enabled: false\n"))
+		fix := &FixValidationResult{Fix: &ProposedFix{Confidence: 0.99}}
+		decision := settings.decide(&FailureAnalysisResult{Classification: FailureClassification{Type: TestFailure}}, fix)
+		assert.Equal(t, PRPolicyAnalysisOnly, decision.Action)
+		assert.Contains(t, decision.Reason, RepoConfigPath)
+	})
+
+	t.Run("Notifications", func(t *testing.T) {
+		settings := m.mergeRepoConfig(parse("notifications:\n  events: [fix_pr_opened]\n"))
+		assert.True(t, settings.notifies(FixPROpened))
+		assert.False(t, settings.notifies(AnalysisCompleted))
+		assert.True(t, m.agentSettings().notifies(AnalysisCompleted))
+	})
+
+	assert.Equal(t, PRPolicyDraft, m.PRPolicy.Actions[BuildFailure], "merging leaves the agent configuration alone")
+}
+
+// TestRepoConfigCache tests that the repository configuration is read once per base branch head
+func TestRepoConfigCache(t *testing.T) {
+	head, content := "base123", "min_coverage: 90\n"
+	var readErr error
+	reads := 0
+	gh := &mockGitHub{
+		getBaseBranchHeadFunc: func(ctx context.Context) (string, string, error) {
+			return "main", head, nil
+		},
+		getFileContentFunc: func(ctx context.Context, path, ref string) (string, bool, error) {
+			assert.Equal(t, RepoConfigPath, path)
+			assert.Equal(t, head, ref)
+			reads++
+			return content, content != "", readErr
+		},
+	}
+	m := &DaggerAutofix{githubClient: gh, logger: quietLogger(), RepoOwner: "acme", RepoName: "widgets"}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		require.NotNil(t, m.repoConfig(ctx))
+		assert.Equal(t, 90, m.repoConfig(ctx).MinCoverage)
+	}
+	assert.Equal(t, 1, reads)
+
+	head, content = "base456", "min_coverage: [\n"
+	assert.Nil(t, m.repoConfig(ctx), "invalid files use the agent configuration")
+	assert.Nil(t, m.repoConfig(ctx))
+	assert.Equal(t, 2, reads, "invalid files are cached too")
+
+	head, readErr = "base789", errors.New("rate limited")
+	assert.Nil(t, m.repoConfig(ctx))
+	assert.Nil(t, m.repoConfig(ctx))
+	assert.Equal(t, 4, reads, "read failures are retried")
+}
+
+// TestAutoFixRepoConfig tests that AutoFix runs with the repository configuration
+func TestAutoFixRepoConfig(t *testing.T) {
+	ctx := context.Background()
+	withConfig := func(content string) (*DaggerAutofix, *[]FixPROptions) {
+		m := fixtureAutofix(nil)
+		m.githubClient.(*mockGitHub).getFileContentFunc = func(ctx context.Context, path, ref string) (string, bool, error) {
+			return content, path == RepoConfigPath, nil
+		}
+		opened := new([]FixPROptions)
+		m.prEngine.(*mockPullRequestEngine).createWithOptionsFunc = func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error) {
+			*opened = append(*opened, opts)
+			return &PullRequest{Number: 1}, nil
+		}
+		return m, opened
+	}
+
+	t.Run("ReviewersAndDraft", func(t *testing.T) {
+		m, opened := withConfig("policy:\n  test: draft\nreviewers: [alice, acme/platform]\n")
+		result, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, string(PRPolicyDraft), result.Metadata["pr_policy"])
+		require.Len(t, *opened, 1)
+		assert.True(t, (*opened)[0].Draft)
+		assert.Equal(t, []string{"alice"}, (*opened)[0].Reviewers)
+		assert.Equal(t, []string{"platform"}, (*opened)[0].TeamReviewers)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		m, opened := withConfig("enabled: false\n")
+		result, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, string(PRPolicyAnalysisOnly), result.Metadata["pr_policy"])
+		assert.Empty(t, *opened)
+	})
+
+	t.Run("MinCoverage", func(t *testing.T) {
+		m, opened := withConfig("min_coverage: 95\n")
+		_, err := m.AutoFix(ctx, 1)
+		assert.ErrorIs(t, err, ErrNoValidFixes, "the fix's 90% coverage is below the repository's minimum")
+		var coverageErr *CoverageError
+		require.ErrorAs(t, err, &coverageErr)
+		assert.Equal(t, float64(95), coverageErr.Minimum)
+		assert.Empty(t, *opened)
+		assert.Equal(t, 80, m.MinCoverage)
+	})
+}
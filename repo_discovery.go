@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/sirupsen/logrus"
+)
+
+// repoDiscoveryInterval is how often MonitorWorkflows lists the organization's repositories again
+const repoDiscoveryInterval = time.Hour
+
+// Reasons a discovered repository is not monitored
+const (
+	RepoSkipArchived        = "archived"
+	RepoSkipFork            = "fork"
+	RepoSkipNotIncluded     = "not included"
+	RepoSkipExcluded        = "excluded"
+	RepoSkipActionsDisabled = "actions disabled"
+	RepoSkipNoWorkflowRuns  = "no workflow runs"
+)
+
+// RepoFilter selects the organization repositories that are monitored. Patterns are globs
+// matched against the repository name; an empty Include matches every repository.
+type RepoFilter struct {
+	Include         []string `json:"include,omitempty"`
+	Exclude         []string `json:"exclude,omitempty"`
+	IncludeArchived bool     `json:"include_archived,omitempty"`
+	IncludeForks    bool     `json:"include_forks,omitempty"`
+}
+
+// validateRepoFilter checks that the filter's patterns are valid globs
+func validateRepoFilter(filter RepoFilter) error {
+	for _, pattern := range append(append([]string(nil), filter.Include...), filter.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid repository pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// skipReason returns why repo is filtered out, or "" when it passes the filter
+func (f RepoFilter) skipReason(repo OrganizationRepository) string {
+	switch {
+	case repo.Archived && !f.IncludeArchived:
+		return RepoSkipArchived
+	case repo.Fork && !f.IncludeForks:
+		return RepoSkipFork
+	case len(f.Include) > 0 && !matchesAny(f.Include, repo.Name):
+		return RepoSkipNotIncluded
+	case matchesAny(f.Exclude, repo.Name):
+		return RepoSkipExcluded
+	}
+	return ""
+}
+
+// matchesAny reports whether name matches one of the glob patterns, ignoring case
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// OrganizationRepository is a repository listed for an organization
+type OrganizationRepository struct {
+	Owner    string
+	Name     string
+	Archived bool
+	Fork     bool
+}
+
+// RepositoryDiscovery is the outcome of listing an organization's repositories
+type RepositoryDiscovery struct {
+	Organization string              `json:"organization"`
+	RefreshedAt  time.Time           `json:"refreshed_at"`
+	Repositories []string            `json:"repositories"`
+	Skipped      []SkippedRepository `json:"skipped,omitempty"`
+}
+
+// SkippedRepository is an organization repository that is not monitored, and why
+type SkippedRepository struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// organizationClient lists an organization's repositories and their GitHub Actions activity
+type organizationClient interface {
+	ListOrganizationRepositories(ctx context.Context, org string) ([]OrganizationRepository, error)
+	ActionsEnabled(ctx context.Context, owner, name string) (bool, error)
+	HasWorkflowRuns(ctx context.Context, owner, name string) (bool, error)
+}
+
+// ListOrganizationRepositories pages through every repository of org
+func (g *GitHubIntegration) ListOrganizationRepositories(ctx context.Context, org string) ([]OrganizationRepository, error) {
+	opts := &github.RepositoryListByOrgOptions{
+		Type:        "all",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var results []OrganizationRepository
+	for {
+		var repos []*github.Repository
+		var resp *github.Response
+		err := g.withRateLimit(ctx, func() (*github.Response, error) {
+			var err error
+			repos, resp, err = g.client.Repositories.ListByOrg(ctx, org, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list organization repositories: %w", err)
+		}
+
+		for _, repo := range repos {
+			owner := repo.GetOwner().GetLogin()
+			if owner == "" {
+				owner = org
+			}
+			results = append(results, OrganizationRepository{
+				Owner:    owner,
+				Name:     repo.GetName(),
+				Archived: repo.GetArchived(),
+				Fork:     repo.GetFork(),
+			})
+		}
+
+		if resp == nil || resp.NextPage == 0 {
+			return results, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// ActionsEnabled reports whether GitHub Actions is enabled for a repository. Reading the
+// setting needs admin access, so Actions is assumed enabled when it cannot be read.
+func (g *GitHubIntegration) ActionsEnabled(ctx context.Context, owner, name string) (bool, error) {
+	permissions, err := callGitHub(ctx, g, func() (*github.ActionsPermissionsRepository, *github.Response, error) {
+		return g.client.Repositories.GetActionsPermissions(ctx, owner, name)
+	})
+	if err != nil {
+		var errResp *github.ErrorResponse
+		if errors.As(err, &errResp) && errResp.Response != nil &&
+			(errResp.Response.StatusCode == http.StatusForbidden || errResp.Response.StatusCode == http.StatusNotFound) {
+			return true, nil
+		}
+		return false, fmt.Errorf("failed to get Actions permissions: %w", err)
+	}
+	return permissions.GetEnabled(), nil
+}
+
+// HasWorkflowRuns reports whether a repository has any workflow run, fetching a single run
+func (g *GitHubIntegration) HasWorkflowRuns(ctx context.Context, owner, name string) (bool, error) {
+	runs, err := callGitHub(ctx, g, func() (*github.WorkflowRuns, *github.Response, error) {
+		return g.client.Actions.ListRepositoryWorkflowRuns(ctx, owner, name, &github.ListWorkflowRunsOptions{
+			ListOptions: github.ListOptions{PerPage: 1},
+		})
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to list workflow runs: %w", err)
+	}
+	return runs.GetTotalCount() > 0 || len(runs.WorkflowRuns) > 0, nil
+}
+
+// discoverRepositories lists the organization's repositories and keeps those passing the
+// filter that use GitHub Actions. Repositories monitored after the previous discovery are
+// kept without checking their Actions activity again.
+func (m *DaggerAutofix) discoverRepositories(ctx context.Context, previous *RepositoryDiscovery) (*RepositoryDiscovery, error) {
+	client, ok := m.githubClient.(organizationClient)
+	if !ok {
+		return nil, fmt.Errorf("organization discovery requires the direct GitHub client")
+	}
+	repos, err := client.ListOrganizationRepositories(ctx, m.Organization)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(repos, func(i, j int) bool {
+		return strings.ToLower(repos[i].Name) < strings.ToLower(repos[j].Name)
+	})
+
+	monitored := make(map[string]bool)
+	if previous != nil {
+		for _, name := range previous.Repositories {
+			monitored[strings.ToLower(name)] = true
+		}
+	}
+
+	discovery := &RepositoryDiscovery{Organization: m.Organization, RefreshedAt: time.Now(), Repositories: []string{}}
+	for _, repo := range repos {
+		name := repositoryRef{owner: repo.Owner, name: repo.Name}.String()
+		reason := m.RepoFilter.skipReason(repo)
+		if reason == "" && !monitored[strings.ToLower(name)] {
+			if reason, err = activitySkipReason(ctx, client, repo); err != nil {
+				return nil, err
+			}
+		}
+		if reason != "" {
+			discovery.Skipped = append(discovery.Skipped, SkippedRepository{Name: name, Reason: reason})
+			continue
+		}
+		discovery.Repositories = append(discovery.Repositories, name)
+	}
+	return discovery, nil
+}
+
+// activitySkipReason returns why a repository without GitHub Actions activity is skipped
+func activitySkipReason(ctx context.Context, client organizationClient, repo OrganizationRepository) (string, error) {
+	enabled, err := client.ActionsEnabled(ctx, repo.Owner, repo.Name)
+	if err != nil {
+		return "", err
+	}
+	if !enabled {
+		return RepoSkipActionsDisabled, nil
+	}
+	hasRuns, err := client.HasWorkflowRuns(ctx, repo.Owner, repo.Name)
+	if err != nil {
+		return "", err
+	}
+	if !hasRuns {
+		return RepoSkipNoWorkflowRuns, nil
+	}
+	return "", nil
+}
+
+// refreshRepositories discovers the organization's repositories again and starts or stops
+// monitoring the repositories that appeared or went away
+func (m *DaggerAutofix) refreshRepositories(ctx context.Context) error {
+	m.reposMu.Lock()
+	previous := m.discovery
+	m.reposMu.Unlock()
+
+	discovery, err := m.discoverRepositories(ctx, previous)
+	if err != nil {
+		return err
+	}
+	skipped := make(map[string]string, len(discovery.Skipped))
+	for _, repo := range discovery.Skipped {
+		skipped[repo.Name] = repo.Reason
+	}
+	m.logger.WithFields(logrus.Fields{
+		"organization": discovery.Organization,
+		"repositories": discovery.Repositories,
+		"skipped":      skipped,
+	}).Debug("Discovered organization repositories")
+
+	m.reposMu.Lock()
+	m.discovery = discovery
+	m.reposMu.Unlock()
+	return m.syncRepositories(ctx)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRepoFilter tests the reasons organization repositories are filtered out
+func TestRepoFilter(t *testing.T) {
+	filter := RepoFilter{Include: []string{"service-*", "web"}, Exclude: []string{"*-sandbox"}}
+	tests := []struct {
+		repo   OrganizationRepository
+		reason string
+	}{
+		{OrganizationRepository{Name: "service-api"}, ""},
+		{OrganizationRepository{Name: "Web"}, ""},
+		{OrganizationRepository{Name: "docs"}, RepoSkipNotIncluded},
+		{OrganizationRepository{Name: "service-sandbox"}, RepoSkipExcluded},
+		{OrganizationRepository{Name: "service-old", Archived: true}, RepoSkipArchived},
+		{OrganizationRepository{Name: "service-fork", Fork: true}, RepoSkipFork},
+	}
+	for _, tt := range tests {
+		t.Run(tt.repo.Name, func(t *testing.T) {
+			assert.Equal(t, tt.reason, filter.skipReason(tt.repo))
+		})
+	}
+
+	included := RepoFilter{IncludeArchived: true, IncludeForks: true}
+	assert.Empty(t, included.skipReason(OrganizationRepository{Name: "old", Archived: true, Fork: true}))
+	assert.ErrorContains(t, validateRepoFilter(RepoFilter{Exclude: []string{"service-["}}), `invalid repository pattern "service-["`)
+}
+
+// orgAPI serves a paginated organization listing and the Actions state of its repositories
+type orgAPI struct {
+	mu          sync.Mutex
+	repos       []map[string]interface{}
+	disabled    map[string]bool
+	noRuns      map[string]bool
+	pages       int
+	activityFor []string
+}
+
+func (a *orgAPI) register(mux *http.ServeMux) {
+	mux.HandleFunc("/orgs/acme/repos", func(w http.ResponseWriter, r *http.Request) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.pages++
+		// Two repositories per page
+		page := 1
+		fmt.Sscanf(r.URL.Query().Get("page"), "%d", &page)
+		start, end := (page-1)*2, page*2
+		if end < len(a.repos) {
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d>; rel="next"`, r.URL.Path, page+1))
+		} else {
+			end = len(a.repos)
+		}
+		json.NewEncoder(w).Encode(a.repos[start:end])
+	})
+	mux.HandleFunc("/repos/acme/", func(w http.ResponseWriter, r *http.Request) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/repos/acme/"), "/")
+		name := parts[0]
+		switch strings.Join(parts[1:], "/") {
+		case "actions/permissions":
+			a.activityFor = append(a.activityFor, name)
+			if name == "locked" {
+				http.Error(w, `{"message": "Must have admin rights to Repository."}`, http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(w, `{"enabled": %t, "allowed_actions": "all"}`, !a.disabled[name])
+		case "actions/runs":
+			if a.noRuns[name] {
+				fmt.Fprint(w, `{"total_count": 0, "workflow_runs": []}`)
+				return
+			}
+			fmt.Fprint(w, `{"total_count": 12, "workflow_runs": [{"id": 1}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func (a *orgAPI) setRepos(repos ...map[string]interface{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.repos = repos
+	a.activityFor = nil
+	a.pages = 0
+}
+
+func orgRepo(name string, fields ...string) map[string]interface{} {
+	repo := map[string]interface{}{"name": name, "owner": map[string]string{"login": "acme"}}
+	for _, field := range fields {
+		repo[field] = true
+	}
+	return repo
+}
+
+// TestListOrganizationRepositories tests paging through an organization's repositories
+func TestListOrganizationRepositories(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+	api := &orgAPI{}
+	api.register(mux)
+	api.setRepos(orgRepo("api"), orgRepo("web", "fork"), orgRepo("old", "archived"))
+
+	repos, err := gh.ListOrganizationRepositories(context.Background(), "acme")
+	require.NoError(t, err)
+	assert.Equal(t, 2, api.pages)
+	assert.Equal(t, []OrganizationRepository{
+		{Owner: "acme", Name: "api"},
+		{Owner: "acme", Name: "web", Fork: true},
+		{Owner: "acme", Name: "old", Archived: true},
+	}, repos)
+
+	api.disabled = map[string]bool{"web": true}
+	api.noRuns = map[string]bool{"old": true}
+	for name, want := range map[string]bool{"api": true, "web": false, "locked": true} {
+		enabled, err := gh.ActionsEnabled(context.Background(), "acme", name)
+		require.NoError(t, err)
+		assert.Equal(t, want, enabled, name)
+	}
+	hasRuns, err := gh.HasWorkflowRuns(context.Background(), "acme", "old")
+	require.NoError(t, err)
+	assert.False(t, hasRuns)
+	hasRuns, err = gh.HasWorkflowRuns(context.Background(), "acme", "api")
+	require.NoError(t, err)
+	assert.True(t, hasRuns)
+}
+
+// TestOrganizationDiscovery tests that Initialize monitors the filtered repositories of the
+// organization and that a refresh picks up new ones without checking known ones again
+func TestOrganizationDiscovery(t *testing.T) {
+	orgClient, mux := newMockGitHubAPI(t)
+	api := &orgAPI{disabled: map[string]bool{"legacy": true}, noRuns: map[string]bool{"empty": true}}
+	api.register(mux)
+	api.setRepos(
+		orgRepo("api"), orgRepo("web"), orgRepo("old", "archived"), orgRepo("mirror", "fork"),
+		orgRepo("api-sandbox"), orgRepo("legacy"), orgRepo("empty"),
+	)
+
+	oldGH, oldLLM := newGitHubIntegration, newLLMClient
+	t.Cleanup(func() { newGitHubIntegration, newLLMClient = oldGH, oldLLM })
+	newGitHubIntegration = func(ctx context.Context, token *dagger.Secret, owner, name string, endpoints *GitHubEndpoints, logger *logrus.Logger) (*GitHubIntegration, error) {
+		if name == "" {
+			return orgClient, nil
+		}
+		return &GitHubIntegration{repoOwner: owner, repoName: name}, nil
+	}
+	newLLMClient = func(ctx context.Context, provider LLMProvider, apiKey *dagger.Secret, logger *logrus.Logger) (*LLMClient, error) {
+		return &LLMClient{provider: provider}, nil
+	}
+
+	var logged bytes.Buffer
+	m := New().
+		WithGitHubToken(createTestSecret("token", "ghp_test")).
+		WithLLMProvider("openai", createTestSecret("key", "sk-test")).
+		WithOrganization("acme").
+		WithRepoFilter(nil, []string{"*-sandbox"})
+	m.logger.SetOutput(&logged)
+	m.logger.SetLevel(logrus.DebugLevel)
+
+	ctx := context.Background()
+	_, err := m.Initialize(ctx)
+	require.NoError(t, err)
+
+	metrics, err := m.GetMetrics(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, metrics.Discovery)
+	assert.Equal(t, "acme", metrics.Discovery.Organization)
+	assert.Equal(t, []string{"acme/api", "acme/web"}, metrics.Discovery.Repositories)
+	assert.Equal(t, []SkippedRepository{
+		{Name: "acme/api-sandbox", Reason: RepoSkipExcluded},
+		{Name: "acme/empty", Reason: RepoSkipNoWorkflowRuns},
+		{Name: "acme/legacy", Reason: RepoSkipActionsDisabled},
+		{Name: "acme/mirror", Reason: RepoSkipFork},
+		{Name: "acme/old", Reason: RepoSkipArchived},
+	}, metrics.Discovery.Skipped)
+	assert.Equal(t, []string{"api", "empty", "legacy", "web"}, api.activityFor, "filtered repositories are skipped without API calls")
+	assert.Equal(t, []string{"acme/api", "acme/web"}, repositoryNames(m.agents()))
+	assert.Contains(t, logged.String(), `"msg":"Discovered organization repositories"`)
+	assert.Contains(t, logged.String(), `"acme/legacy":"actions disabled"`)
+
+	// A new repository appears and web is deleted
+	api.setRepos(orgRepo("api"), orgRepo("billing"), orgRepo("legacy"))
+	api.disabled = nil
+	require.NoError(t, m.refreshRepositories(ctx))
+	assert.Equal(t, []string{"acme/api", "acme/billing", "acme/legacy"}, repositoryNames(m.agents()))
+	assert.Equal(t, []string{"billing", "legacy"}, api.activityFor, "already monitored repositories are not checked again")
+}
+
+// TestOrganizationWithoutRepositories tests that the agent itself is not monitored when the
+// organization has no repository to monitor
+func TestOrganizationWithoutRepositories(t *testing.T) {
+	m := &DaggerAutofix{Organization: "acme", RepoOwner: "acme", githubClient: &mockGitHub{}, logger: quietLogger()}
+	assert.Empty(t, m.agents())
+	require.NoError(t, m.checkForFailures(context.Background()))
+
+	_, err := m.discoverRepositories(context.Background(), nil)
+	assert.EqualError(t, err, "organization discovery requires the direct GitHub client")
+}
+
+func repositoryNames(agents []*DaggerAutofix) []string {
+	names := make([]string, 0, len(agents))
+	for _, agent := range agents {
+		names = append(names, agent.repositoryName())
+	}
+	return names
+}
+
+// TestPrintDiscovery tests that the status command shows the discovered and skipped repositories
+func TestPrintDiscovery(t *testing.T) {
+	cli, out := outputCLI(t, "text")
+	require.NoError(t, cli.printMetrics(&OperationalMetrics{Discovery: &RepositoryDiscovery{
+		Organization: "acme",
+		Repositories: []string{"acme/api", "acme/web"},
+		Skipped:      []SkippedRepository{{Name: "acme/old", Reason: RepoSkipArchived}},
+	}}))
+	assert.Contains(t, out.String(), "=== Organization acme ===\n")
+	assert.Contains(t, out.String(), "Monitored Repositories (2): acme/api, acme/web\n")
+	assert.Contains(t, out.String(), "Skipped acme/old: archived\n")
+}
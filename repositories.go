@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// repositoryRef identifies a monitored GitHub repository
+type repositoryRef struct {
+	owner string
+	name  string
+}
+
+func (r repositoryRef) String() string {
+	return r.owner + "/" + r.name
+}
+
+// parseRepository parses an "owner/name" repository reference
+func parseRepository(value string) (repositoryRef, error) {
+	owner, name, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return repositoryRef{}, fmt.Errorf("%w %q, expected owner/name", ErrInvalidRepo, value)
+	}
+	if err := validateRepository(owner, name); err != nil {
+		return repositoryRef{}, err
+	}
+	return repositoryRef{owner: owner, name: name}, nil
+}
+
+// monitoredRepositories returns RepoOwner/RepoName followed by Repositories and the
+// repositories discovered in Organization, without duplicates
+func (m *DaggerAutofix) monitoredRepositories() ([]repositoryRef, error) {
+	var repos []repositoryRef
+	seen := make(map[string]bool)
+	add := func(repo repositoryRef) {
+		if key := strings.ToLower(repo.String()); !seen[key] {
+			seen[key] = true
+			repos = append(repos, repo)
+		}
+	}
+
+	if m.RepoOwner != "" && m.RepoName != "" {
+		add(repositoryRef{owner: m.RepoOwner, name: m.RepoName})
+	}
+	for _, value := range m.Repositories {
+		repo, err := parseRepository(value)
+		if err != nil {
+			return nil, err
+		}
+		add(repo)
+	}
+
+	m.reposMu.Lock()
+	discovery := m.discovery
+	m.reposMu.Unlock()
+	if discovery != nil {
+		for _, value := range discovery.Repositories {
+			repo, err := parseRepository(value)
+			if err != nil {
+				return nil, err
+			}
+			add(repo)
+		}
+	}
+	return repos, nil
+}
+
+// multiRepository reports whether the agent monitors its repositories through one agent per
+// repository rather than itself
+func (m *DaggerAutofix) multiRepository() bool {
+	if m.Organization != "" {
+		return true
+	}
+	repos, _ := m.monitoredRepositories()
+	return len(repos) > 1
+}
+
+// repositoryName returns the "owner/name" of the agent's repository
+func (m *DaggerAutofix) repositoryName() string {
+	return m.RepoOwner + "/" + m.RepoName
+}
+
+// initRepositories creates an initialized agent per monitored repository when there are
+// several or they are discovered in an organization. The agents share the LLM usage, audit
+// log and redactor, and MonitorWorkflows runs their fixes on its single worker pool.
+func (m *DaggerAutofix) initRepositories(ctx context.Context) error {
+	m.reposMu.Lock()
+	m.repositories = nil
+	m.discovery = nil
+	m.reposMu.Unlock()
+
+	if m.Organization != "" {
+		return m.refreshRepositories(ctx)
+	}
+	return m.syncRepositories(ctx)
+}
+
+// syncRepositories creates agents for monitored repositories without one and drops the agents
+// of repositories no longer monitored. Repositories whose agent fails to initialize are left
+// out and reported in the returned error.
+func (m *DaggerAutofix) syncRepositories(ctx context.Context) error {
+	repos, err := m.monitoredRepositories()
+	if err != nil {
+		return err
+	}
+	if !m.multiRepository() {
+		return nil
+	}
+
+	m.reposMu.Lock()
+	existing := make(map[string]*DaggerAutofix, len(m.repositories))
+	for _, agent := range m.repositories {
+		existing[strings.ToLower(agent.repositoryName())] = agent
+	}
+	m.reposMu.Unlock()
+
+	var errs []error
+	agents := make([]*DaggerAutofix, 0, len(repos))
+	for _, repo := range repos {
+		if agent, ok := existing[strings.ToLower(repo.String())]; ok {
+			agents = append(agents, agent)
+			delete(existing, strings.ToLower(repo.String()))
+			continue
+		}
+		primary := repo.owner == m.RepoOwner && repo.name == m.RepoName
+		agent := m.repositoryAgent(repo, primary)
+		if _, err := agent.Initialize(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to initialize repository %s: %w", repo, err))
+			continue
+		}
+		agents = append(agents, agent)
+		m.logger.WithField("repository", repo.String()).Info("Monitoring repository")
+	}
+	for name := range existing {
+		m.logger.WithField("repository", name).Info("Stopped monitoring repository")
+	}
+
+	m.reposMu.Lock()
+	m.repositories = agents
+	m.reposMu.Unlock()
+	return errors.Join(errs...)
+}
+
+// repositoryAgent returns an uninitialized agent for repo with m's configuration. Agents other
+// than the primary repository's keep their PR tracking state and fix history in their own files,
+// since PR numbers are only unique within a repository.
+func (m *DaggerAutofix) repositoryAgent(repo repositoryRef, primary bool) *DaggerAutofix {
+	agent := &DaggerAutofix{}
+	src, dst := reflect.ValueOf(m).Elem(), reflect.ValueOf(agent).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		if src.Type().Field(i).IsExported() {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+
+	agent.RepoOwner = repo.owner
+	agent.RepoName = repo.name
+	agent.Repositories = nil
+	agent.Organization = ""
+	agent.MetricsAddr = ""
+	agent.logger = repositoryLogger(m.logger, repo)
+	agent.redactor = m.redactor
+	agent.usage = m.usage
+	agent.auditLog = m.auditLog
+	agent.progress = m.progress
+	if primary {
+		agent.tracker = m.tracker
+		agent.history = m.history
+	} else {
+		agent.StateFile = repositoryPath(m.StateFile, repo)
+		agent.FixHistory = repositoryPath(m.FixHistory, repo)
+	}
+	return agent
+}
+
+// repositoryPath inserts the repository into a state file name, so state.json becomes
+// state-owner-name.json
+func repositoryPath(path string, repo repositoryRef) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + repo.owner + "-" + repo.name + ext
+}
+
+// repositoryLogger returns a logger writing like base whose entries carry the repository's
+// owner and repo fields
+func repositoryLogger(base *logrus.Logger, repo repositoryRef) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(base.Out)
+	logger.SetFormatter(base.Formatter)
+	logger.SetLevel(base.GetLevel())
+	logger.SetReportCaller(base.ReportCaller)
+	hooks := make(logrus.LevelHooks)
+	for level, levelHooks := range base.Hooks {
+		hooks[level] = append([]logrus.Hook(nil), levelHooks...)
+	}
+	logger.ReplaceHooks(hooks)
+	logger.AddHook(newRepositoryHook(repo))
+	return logger
+}
+
+// repositoryHook adds the owner and repo fields to log entries
+type repositoryHook struct {
+	repo repositoryRef
+}
+
+func newRepositoryHook(repo repositoryRef) logrus.Hook {
+	return &repositoryHook{repo: repo}
+}
+
+// Levels returns every log level
+func (h *repositoryHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire sets the entry's repository fields
+func (h *repositoryHook) Fire(entry *logrus.Entry) error {
+	entry.Data["owner"] = h.repo.owner
+	entry.Data["repo"] = h.repo.name
+	return nil
+}
+
+// agents returns the per-repository agents, or m itself when it monitors a single repository
+func (m *DaggerAutofix) agents() []*DaggerAutofix {
+	m.reposMu.Lock()
+	defer m.reposMu.Unlock()
+
+	if len(m.repositories) > 0 || m.Organization != "" {
+		return append([]*DaggerAutofix(nil), m.repositories...)
+	}
+	return []*DaggerAutofix{m}
+}
+
+// checkForFailures submits the new failed runs of every monitored repository to the shared
+// worker pool, so the concurrency limit holds across repositories
+func (m *DaggerAutofix) checkForFailures(ctx context.Context) error {
+	var errs []error
+	for _, agent := range m.agents() {
+		if err := m.checkRepositoryFailures(ctx, agent); err != nil {
+			if agent != m {
+				err = fmt.Errorf("%s: %w", agent.repositoryName(), err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkRepositoryFailures submits the failed runs of agent's repository that it has not
+// submitted before to the worker pool. Workflow run IDs are unique across GitHub, so the pool
+// keys jobs by run ID.
+func (m *DaggerAutofix) checkRepositoryFailures(ctx context.Context, agent *DaggerAutofix) error {
+	pool := m.ensureFixPool(ctx)
+	return m.claimFailures(ctx, agent, func(run *WorkflowRun) bool {
+		return m.submitRun(pool, agent, run)
+	})
+}
+
+// queuedRun is a run waiting in the worker pool with the agent that fixes it
+type queuedRun struct {
+	agent *DaggerAutofix
+	run   *WorkflowRun
+}
+
+// submitRun queues run of agent's repository in pool, remembering the agent that fixes it.
+// It is called with poolMu held, so the worker finds the run once it starts.
+func (m *DaggerAutofix) submitRun(pool *fixWorkerPool, agent *DaggerAutofix, run *WorkflowRun) bool {
+	if !pool.Submit(run.ID) {
+		return false
+	}
+	if m.queuedRuns == nil {
+		m.queuedRuns = make(map[int64]queuedRun)
+	}
+	m.queuedRuns[run.ID] = queuedRun{agent: agent, run: run}
+	return true
+}
+
+// claimFailures passes the failed runs of agent's repository that it has not claimed before
+// to submit, which is called with poolMu held and reports whether it took the run. Runs
+// failing the same way are clustered and only the newest is submitted. Each run is claimed
+// before it is submitted, so runs another entry point is fixing are skipped.
+func (m *DaggerAutofix) claimFailures(ctx context.Context, agent *DaggerAutofix, submit func(run *WorkflowRun) bool) error {
+	failedRuns, err := agent.githubClient.GetFailedWorkflowRuns(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get workflow runs: %w", err)
+	}
+
+	listed := make(map[int64]bool, len(failedRuns))
+	var newRuns []*WorkflowRun
+	m.poolMu.Lock()
+	for _, run := range failedRuns {
+		listed[run.ID] = true
+		if agent.shouldProcessRun(run) && !agent.processedRuns[run.ID] {
+			newRuns = append(newRuns, run)
+		}
+	}
+	m.poolMu.Unlock()
+
+	for _, cluster := range agent.clusterFailures(ctx, newRuns) {
+		run := cluster.run
+		m.poolMu.Lock()
+		duplicate := run != nil && !m.claimRun(agent, run.ID)
+		submitted := run != nil && !duplicate && submit(run)
+		if run != nil && !duplicate && !submitted {
+			m.runClaims.release(run.ID)
+		}
+		// Clustered runs are fixed along with their cluster's run, once it is submitted
+		if submitted || duplicate || cluster.fixedBy != 0 {
+			if agent.processedRuns == nil {
+				agent.processedRuns = make(map[int64]bool)
+			}
+			for _, other := range cluster.others {
+				agent.processedRuns[other.ID] = true
+			}
+		}
+		if submitted || duplicate {
+			agent.processedRuns[run.ID] = true
+		}
+		m.poolMu.Unlock()
+
+		switch {
+		case duplicate:
+			// Fixed by the entry point that claimed it
+		case submitted:
+			agent.recordCluster(cluster)
+			m.stats.failuresDetected.Add(1)
+			agentMetrics.failuresDetected.inc(metricsRepository(agent))
+		case run != nil:
+			// Left for the next poll
+			agentMetrics.failuresSkipped.inc(metricsRepository(agent))
+			continue
+		}
+		agent.logClusteredRuns(cluster)
+		m.stats.clusteredRuns.Add(int64(len(cluster.others)))
+		agentMetrics.failuresClustered.add(float64(len(cluster.others)), metricsRepository(agent))
+	}
+
+	// Forget runs that dropped out of the failure listing so the set stays bounded
+	m.poolMu.Lock()
+	for runID := range agent.processedRuns {
+		if !listed[runID] {
+			delete(agent.processedRuns, runID)
+		}
+	}
+	m.poolMu.Unlock()
+
+	return nil
+}
+
+// dequeueRun returns the agent that submitted runID and its workflow run, and forgets them.
+// Runs queued without submitRun are fixed by m and have no workflow run.
+func (m *DaggerAutofix) dequeueRun(runID int64) (*DaggerAutofix, *WorkflowRun) {
+	m.poolMu.Lock()
+	defer m.poolMu.Unlock()
+
+	queued, ok := m.queuedRuns[runID]
+	if !ok {
+		return m, nil
+	}
+	delete(m.queuedRuns, runID)
+	return queued.agent, queued.run
+}
+
+// reconcileRepositories reconciles the fix PRs of every monitored repository
+func (m *DaggerAutofix) reconcileRepositories(ctx context.Context) {
+	for _, agent := range m.agents() {
+		if agent.prEngine == nil {
+			continue
+		}
+		if err := agent.ReconcilePRs(ctx); err != nil {
+			agent.logger.WithError(err).Error("Failed to reconcile fix pull requests")
+		}
+	}
+}
+
+// trackedOutcomes sums the outcomes of the fix PRs tracked for every monitored repository
+func (m *DaggerAutofix) trackedOutcomes() (prOutcomes, error) {
+	var total prOutcomes
+	for _, agent := range m.agents() {
+		tracker, err := agent.prTracking()
+		if err != nil {
+			return prOutcomes{}, err
+		}
+		total.add(tracker.outcomes())
+	}
+	return total, nil
+}
+
+// flakyResolved counts the failures resolved by a re-run across the monitored repositories
+func (m *DaggerAutofix) flakyResolved() int64 {
+	total := m.stats.flakyResolved.Load()
+	for _, agent := range m.agents() {
+		if agent != m {
+			total += agent.stats.flakyResolved.Load()
+		}
+	}
+	return total
+}
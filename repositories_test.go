@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMonitoredRepositories tests parsing and deduplicating the configured repositories
+func TestMonitoredRepositories(t *testing.T) {
+	m := New().WithRepositories("acme/api", " acme/web ", "Acme/API")
+	assert.Equal(t, "acme", m.RepoOwner)
+	assert.Equal(t, "api", m.RepoName)
+
+	repos, err := m.monitoredRepositories()
+	require.NoError(t, err)
+	assert.Equal(t, []repositoryRef{{owner: "acme", name: "api"}, {owner: "acme", name: "web"}}, repos)
+
+	m = New().WithRepository("acme", "platform").WithRepositories("acme/api")
+	repos, err = m.monitoredRepositories()
+	require.NoError(t, err)
+	assert.Equal(t, []repositoryRef{{owner: "acme", name: "platform"}, {owner: "acme", name: "api"}}, repos)
+
+	for _, invalid := range []string{"acme", "acme/", "/api", "acme/api/extra"} {
+		_, err := parseRepository(invalid)
+		assert.EqualError(t, err, `invalid repository "`+invalid+`", expected owner/name`)
+	}
+
+	m = New().
+		WithGitHubToken(createTestSecret("token", "ghp_test")).
+		WithLLMProvider("openai", createTestSecret("key", "sk-test")).
+		WithRepositories("acme/api", "web")
+	assert.ErrorContains(t, m.validateConfiguration(), `invalid repository "web"`)
+
+	assert.Equal(t, filepath.Join("state", "prs-acme-web.json"), repositoryPath(filepath.Join("state", "prs.json"), repositoryRef{owner: "acme", name: "web"}))
+	assert.Empty(t, repositoryPath("", repositoryRef{owner: "acme", name: "web"}))
+}
+
+// TestInitializeMultipleRepositories tests that each repository gets its own GitHub client,
+// state file and logger
+func TestInitializeMultipleRepositories(t *testing.T) {
+	oldGH, oldLLM := newGitHubIntegration, newLLMClient
+	t.Cleanup(func() { newGitHubIntegration, newLLMClient = oldGH, oldLLM })
+
+	var mu sync.Mutex
+	var clients []string
+	newGitHubIntegration = func(ctx context.Context, token *dagger.Secret, owner, name string, endpoints *GitHubEndpoints, logger *logrus.Logger) (*GitHubIntegration, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		clients = append(clients, owner+"/"+name)
+		return &GitHubIntegration{repoOwner: owner, repoName: name}, nil
+	}
+	newLLMClient = func(ctx context.Context, provider LLMProvider, apiKey *dagger.Secret, logger *logrus.Logger) (*LLMClient, error) {
+		return &LLMClient{provider: provider}, nil
+	}
+
+	var logged bytes.Buffer
+	stateFile := filepath.Join(t.TempDir(), "prs.json")
+	m := New().
+		WithGitHubToken(createTestSecret("token", "ghp_test")).
+		WithLLMProvider("openai", createTestSecret("key", "sk-test")).
+		WithRepositories("acme/api", "acme/web").
+		WithStateFile(stateFile)
+	m.logger.SetOutput(&logged)
+
+	_, err := m.Initialize(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme/api", "acme/api", "acme/web"}, clients, "the primary repository and each monitored repository")
+
+	require.Len(t, m.repositories, 2)
+	api, web := m.repositories[0], m.repositories[1]
+	assert.Equal(t, "acme/api", api.repositoryName())
+	assert.Equal(t, "acme/web", web.repositoryName())
+	assert.Equal(t, "web", web.githubClient.(*GitHubIntegration).repoName)
+	assert.Same(t, m.tracker, api.tracker, "the primary repository keeps the configured state file")
+	assert.Equal(t, filepath.Join(filepath.Dir(stateFile), "prs-acme-web.json"), web.StateFile)
+	assert.Same(t, m.usage, web.usage)
+	assert.Nil(t, web.repositories)
+
+	logged.Reset()
+	web.logger.Info("checking")
+	assert.Contains(t, logged.String(), `"owner":"acme"`)
+	assert.Contains(t, logged.String(), `"repo":"web"`)
+}
+
+// TestCheckForFailuresAcrossRepositories tests that failures of two repositories are both
+// fixed by the agent of their repository on the shared pool and attributed in the metrics
+func TestCheckForFailuresAcrossRepositories(t *testing.T) {
+	metrics := useTestMetrics(t)
+
+	var active, maxActive int32
+	var mu sync.Mutex
+	fixed := make(map[string][]int64)
+	repositoryAgent := func(owner, name string, runIDs ...int64) *DaggerAutofix {
+		agent := fixtureAutofix(nil).WithRepository(owner, name)
+		gh := agent.githubClient.(*mockGitHub)
+		gh.getFailedWorkflowRunsFunc = func(ctx context.Context) ([]*WorkflowRun, error) {
+			runs := make([]*WorkflowRun, 0, len(runIDs))
+			for _, id := range runIDs {
+				runs = append(runs, &WorkflowRun{ID: id})
+			}
+			return runs, nil
+		}
+		gh.getWorkflowRunFunc = func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+			n := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			for {
+				max := atomic.LoadInt32(&maxActive)
+				if n <= max || atomic.CompareAndSwapInt32(&maxActive, max, n) {
+					break
+				}
+			}
+			mu.Lock()
+			fixed[agent.repositoryName()] = append(fixed[agent.repositoryName()], runID)
+			mu.Unlock()
+			return &WorkflowRun{ID: runID, CommitSHA: "abc123"}, nil
+		}
+		return agent
+	}
+
+	m := &DaggerAutofix{
+		githubClient:       &mockGitHub{},
+		logger:             quietLogger(),
+		MaxConcurrentFixes: 1,
+		repositories: []*DaggerAutofix{
+			repositoryAgent("acme", "api", 11),
+			repositoryAgent("acme", "web", 21, 22),
+		},
+	}
+	ctx := context.Background()
+	require.NoError(t, m.checkForFailures(ctx))
+	require.NoError(t, m.checkForFailures(ctx), "runs already submitted are skipped")
+	m.drainFixes()
+
+	assert.Equal(t, map[string][]int64{"acme/api": {11}, "acme/web": {21, 22}}, fixed)
+	assert.Equal(t, int32(1), maxActive, "the concurrency limit holds across repositories")
+
+	operational, err := m.GetMetrics(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, operational.TotalFailuresDetected)
+	assert.Equal(t, 3, operational.CompletedFixes)
+
+	body := scrapeMetrics(t, metrics)
+	for _, line := range []string{
+		`github_autofix_failures_detected_total{repository="acme/api"} 1`,
+		`github_autofix_failures_detected_total{repository="acme/web"} 2`,
+		`github_autofix_fixes_succeeded_total{repository="acme/api",failure_type="test"} 1`,
+		`github_autofix_fixes_succeeded_total{repository="acme/web",failure_type="test"} 2`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+}
+
+// TestRepositoryLogger tests that repository loggers keep the base logger's hooks and settings
+func TestRepositoryLogger(t *testing.T) {
+	var logged bytes.Buffer
+	base := logrus.New()
+	base.SetOutput(&logged)
+	base.SetFormatter(&logrus.JSONFormatter{})
+	base.SetLevel(logrus.WarnLevel)
+	redactor, err := NewRedactor(nil)
+	require.NoError(t, err)
+	redactor.AddSecret(RedactionGitHubToken, "ghp_secretvalue0123456789")
+	base.AddHook(newRedactionHook(redactor))
+
+	logger := repositoryLogger(base, repositoryRef{owner: "acme", name: "api"})
+	logger.Info("not written")
+	logger.WithField("owner", "someone").Warn("token ghp_secretvalue0123456789")
+
+	assert.NotContains(t, logged.String(), "not written")
+	assert.NotContains(t, logged.String(), "ghp_secretvalue0123456789")
+	assert.Contains(t, logged.String(), `"owner":"acme","repo":"api"`)
+	assert.Len(t, base.Hooks[logrus.InfoLevel], 1, "the base logger does not get the repository hook")
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// repositoryProfile is the language and framework detected for a repository
+type repositoryProfile struct {
+	Language  string
+	Framework string
+}
+
+// appFrameworkFiles identify an application framework by a file in the repository root,
+// checked in this order
+var appFrameworkFiles = []struct{ file, framework string }{
+	{"next.config.js", "nextjs"},
+	{"next.config.mjs", "nextjs"},
+	{"next.config.ts", "nextjs"},
+	{"nuxt.config.js", "nuxt"},
+	{"nuxt.config.ts", "nuxt"},
+	{"angular.json", "angular"},
+	{"svelte.config.js", "sveltekit"},
+	{"manage.py", "django"},
+	{"artisan", "laravel"},
+}
+
+// nodeAppFrameworks identify an application framework by a package.json dependency, checked
+// in this order so meta-frameworks win over the libraries they build on
+var nodeAppFrameworks = []struct{ dependency, framework string }{
+	{"next", "nextjs"},
+	{"nuxt", "nuxt"},
+	{"@nestjs/core", "nestjs"},
+	{"@angular/core", "angular"},
+	{"vue", "vue"},
+	{"react", "react"},
+	{"express", "express"},
+}
+
+// appFrameworkContents identify an application framework by the content of a marker file
+var appFrameworkContents = []struct {
+	file      string
+	pattern   *regexp.Regexp
+	framework string
+}{
+	{"pom.xml", regexp.MustCompile(`<groupId>org\.springframework\.boot</groupId>`), "spring-boot"},
+	{"build.gradle", regexp.MustCompile(`org\.springframework\.boot`), "spring-boot"},
+	{"build.gradle.kts", regexp.MustCompile(`org\.springframework\.boot`), "spring-boot"},
+	{"requirements.txt", regexp.MustCompile(`(?im)^django\b`), "django"},
+	{"requirements.txt", regexp.MustCompile(`(?im)^fastapi\b`), "fastapi"},
+	{"requirements.txt", regexp.MustCompile(`(?im)^flask\b`), "flask"},
+	{"Gemfile", regexp.MustCompile(`(?m)^\s*gem\s+["']rails["']`), "rails"},
+	{"go.mod", regexp.MustCompile(`github\.com/gin-gonic/gin\s`), "gin"},
+}
+
+// profileRepository sets the language and framework of repository from its contents: the
+// primary language by the GitHub languages API, and the framework by the marker files at
+// ref, the failing commit. Profiles are cached per default branch head, so they are only
+// detected again once the default branch moved. Detection only enriches the analysis, so
+// failures keep the repository's metadata.
+func (m *DaggerAutofix) profileRepository(ctx context.Context, repository *RepositoryContext, ref string) {
+	key := ""
+	if _, sha, err := m.githubClient.GetBaseBranchHead(ctx); err == nil && sha != "" {
+		key = m.repositoryName() + "@" + sha
+	}
+	m.profileMu.Lock()
+	profile, ok := m.profiles[key]
+	m.profileMu.Unlock()
+
+	if !ok || key == "" {
+		profile = m.detectRepositoryProfile(ctx, ref)
+		if key != "" {
+			m.profileMu.Lock()
+			if m.profiles == nil {
+				m.profiles = make(map[string]repositoryProfile)
+			}
+			m.profiles[key] = profile
+			m.profileMu.Unlock()
+		}
+	}
+
+	if profile.Language != "" {
+		repository.Language = profile.Language
+	}
+	if profile.Framework != "" {
+		repository.Framework = profile.Framework
+	}
+}
+
+// detectRepositoryProfile detects the primary language and the framework of the repository
+// at ref, leaving either empty when it cannot be told
+func (m *DaggerAutofix) detectRepositoryProfile(ctx context.Context, ref string) repositoryProfile {
+	var profile repositoryProfile
+	languages, err := m.githubClient.GetLanguages(ctx)
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to get repository languages")
+	}
+	profile.Language = primaryLanguage(languages)
+
+	entries, err := m.githubClient.ListDirectory(ctx, "", ref)
+	if err != nil {
+		m.logger.WithError(err).Warn("Failed to list the repository root, continuing without framework detection")
+		return profile
+	}
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		present[strings.TrimSuffix(entry, "/")] = true
+	}
+	profile.Framework = m.detectAppFramework(ctx, present, ref)
+	if profile.Framework == "" {
+		profile.Framework = markerTestFramework(entries, present)
+	}
+	return profile
+}
+
+// primaryLanguage returns the language with the most code, the first by name on a tie
+func primaryLanguage(languages map[string]int) string {
+	names := make([]string, 0, len(languages))
+	for name := range languages {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if languages[names[i]] != languages[names[j]] {
+			return languages[names[i]] > languages[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
+
+// detectAppFramework returns the application framework identified by the files present in
+// the repository root and the contents of marker files at ref, empty when there is none
+func (m *DaggerAutofix) detectAppFramework(ctx context.Context, present map[string]bool, ref string) string {
+	for _, marker := range appFrameworkFiles {
+		if present[marker.file] {
+			return marker.framework
+		}
+	}
+
+	contents := make(map[string]string)
+	read := func(file string) string {
+		if content, ok := contents[file]; ok {
+			return content
+		}
+		content, _, err := m.githubClient.GetFileContent(ctx, file, ref)
+		if err != nil {
+			m.logger.WithError(err).WithField("file", file).Warn("Failed to read framework marker file")
+		}
+		contents[file] = content
+		return content
+	}
+
+	if present["package.json"] {
+		var pkg packageJSON
+		if err := json.Unmarshal([]byte(read("package.json")), &pkg); err == nil {
+			for _, marker := range nodeAppFrameworks {
+				if _, ok := pkg.Dependencies[marker.dependency]; ok {
+					return marker.framework
+				}
+				if _, ok := pkg.DevDependencies[marker.dependency]; ok {
+					return marker.framework
+				}
+			}
+		}
+	}
+	for _, marker := range appFrameworkContents {
+		if present[marker.file] && marker.pattern.MatchString(read(marker.file)) {
+			return marker.framework
+		}
+	}
+	return ""
+}
+
+// markerTestFramework returns the test framework the test engine would detect from the root
+// entries, empty when none matches
+func markerTestFramework(entries []string, present map[string]bool) string {
+	engine := &TestEngine{testFrameworks: loadTestFrameworks()}
+	for _, marker := range frameworkMarkerFiles {
+		if file, ok := markerEntry(marker, entries, present); ok {
+			if framework := engine.getFrameworkByFile(file); framework != nil {
+				return framework.Framework
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// profileGitHub returns a GitHub client serving a repository whose root holds files, keyed
+// by name with their content, and whose default branch head is *head
+func profileGitHub(languages map[string]int, files map[string]string, head *string) *mockGitHub {
+	return &mockGitHub{
+		getWorkflowRunFunc: func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+			return &WorkflowRun{ID: runID, CommitSHA: "abc123"}, nil
+		},
+		getWorkflowLogsFunc: func(ctx context.Context, runID int64) (*WorkflowLogs, error) {
+			return &WorkflowLogs{}, nil
+		},
+		getRepositoryContextFunc: func(ctx context.Context) (*RepositoryContext, error) {
+			return &RepositoryContext{Owner: "acme", Name: "widgets", DefaultBranch: "main", Language: "Shell"}, nil
+		},
+		getBaseBranchHeadFunc: func(ctx context.Context) (string, string, error) {
+			return "main", *head, nil
+		},
+		getLanguagesFunc: func(ctx context.Context) (map[string]int, error) {
+			return languages, nil
+		},
+		listDirectoryFunc: func(ctx context.Context, path, ref string) ([]string, error) {
+			entries := []string{"src/"}
+			for name := range files {
+				entries = append(entries, name)
+			}
+			return entries, nil
+		},
+		getFileContentFunc: func(ctx context.Context, path, ref string) (string, bool, error) {
+			content, ok := files[path]
+			return content, ok, nil
+		},
+	}
+}
+
+// TestProfileRepository tests detecting the primary language and the framework of a
+// repository from its languages and marker files
+func TestProfileRepository(t *testing.T) {
+	head := "base123"
+	tests := []struct {
+		name      string
+		languages map[string]int
+		files     map[string]string
+		language  string
+		framework string
+	}{
+		{
+			name:      "nextjs config",
+			languages: map[string]int{"TypeScript": 52000, "JavaScript": 3100, "CSS": 800},
+			files:     map[string]string{"package.json": `{"dependencies": {"react": "18.2.0"}}`, "next.config.js": ""},
+			language:  "TypeScript",
+			framework: "nextjs",
+		},
+		{
+			name:      "spring boot pom",
+			languages: map[string]int{"Java": 91000},
+			files: map[string]string{"pom.xml": "<project><parent>\n" +
+				"<groupId>org.springframework.boot</groupId>\n<artifactId>spring-boot-starter-parent</artifactId>\n" +
+				"</parent></project>"},
+			language:  "Java",
+			framework: "spring-boot",
+		},
+		{
+			name:      "plain maven",
+			languages: map[string]int{"Java": 91000},
+			files:     map[string]string{"pom.xml": "<project><groupId>com.acme</groupId></project>"},
+			language:  "Java",
+			framework: "maven",
+		},
+		{
+			name:      "django manage.py",
+			languages: map[string]int{"Python": 40000, "HTML": 40000},
+			files:     map[string]string{"manage.py": "", "requirements.txt": "Django==5.0\n"},
+			language:  "HTML",
+			framework: "django",
+		},
+		{
+			name:      "flask requirements",
+			languages: map[string]int{"Python": 40000},
+			files:     map[string]string{"requirements.txt": "requests==2.31\nFlask==3.0\n"},
+			language:  "Python",
+			framework: "flask",
+		},
+		{
+			name:      "react dependency",
+			languages: map[string]int{"JavaScript": 12000},
+			files:     map[string]string{"package.json": `{"devDependencies": {"react": "18.2.0", "jest": "29.0.0"}}`},
+			language:  "JavaScript",
+			framework: "react",
+		},
+		{
+			name:      "test framework fallback",
+			languages: map[string]int{"Go": 30000},
+			files:     map[string]string{"go.mod": "module acme/widgets\n"},
+			language:  "Go",
+			framework: "go",
+		},
+		{
+			name:      "unknown keeps metadata",
+			languages: nil,
+			files:     map[string]string{"README.md": ""},
+			language:  "Shell",
+			framework: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &DaggerAutofix{
+				githubClient: profileGitHub(tt.languages, tt.files, &head),
+				logger:       quietLogger(),
+				RepoOwner:    "acme",
+				RepoName:     "widgets",
+			}
+			fc, err := m.failureContext(context.Background(), 1)
+			require.NoError(t, err)
+			assert.Equal(t, tt.language, fc.Repository.Language)
+			assert.Equal(t, tt.framework, fc.Repository.Framework)
+
+			var out strings.Builder
+			writeAnalysis(&out, &FailureAnalysisResult{ID: "a1", Context: fc})
+			assert.Contains(t, out.String(), "Language: "+tt.language+"\n")
+			if tt.framework != "" {
+				assert.Contains(t, out.String(), "Framework: "+tt.framework+"\n")
+			}
+		})
+	}
+}
+
+// TestProfileRepositoryCache tests that a repository is profiled once per default branch head
+func TestProfileRepositoryCache(t *testing.T) {
+	head := "base123"
+	gh := profileGitHub(map[string]int{"Python": 100}, map[string]string{"manage.py": ""}, &head)
+	m := &DaggerAutofix{githubClient: gh, logger: quietLogger(), RepoOwner: "acme", RepoName: "widgets"}
+	profiled := func() int {
+		count := 0
+		for _, call := range gh.calls {
+			if call == "GetLanguages" {
+				count++
+			}
+		}
+		return count
+	}
+
+	for i := 0; i < 3; i++ {
+		var repository RepositoryContext
+		m.profileRepository(context.Background(), &repository, "abc123")
+		assert.Equal(t, RepositoryContext{Language: "Python", Framework: "django"}, repository)
+	}
+	assert.Equal(t, 1, profiled())
+
+	head = "base456"
+	var repository RepositoryContext
+	m.profileRepository(context.Background(), &repository, "abc123")
+	assert.Equal(t, 2, profiled(), "a new default branch head is profiled again")
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runCompletionTimeout is the longest a workflow run may take on GitHub, queueing included, so
+// waits for a run to complete are in effect bounded by their context alone
+const runCompletionTimeout = 35 * 24 * time.Hour
+
+// pollIntervalContextKey carries how often a workflow run is checked while waiting for it
+type pollIntervalContextKey struct{}
+
+// withPollInterval makes waits for workflow runs under ctx check them every interval
+func withPollInterval(ctx context.Context, interval time.Duration) context.Context {
+	if interval <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, pollIntervalContextKey{}, interval)
+}
+
+// pollInterval returns how often waits for workflow runs under ctx check them
+func pollInterval(ctx context.Context) time.Duration {
+	if interval, ok := ctx.Value(pollIntervalContextKey{}).(time.Duration); ok {
+		return interval
+	}
+	return workflowRunPollInterval
+}
+
+// WaitForRunCompletion waits until attempt of a workflow run, or a later attempt, completed
+// and returns the run as of that attempt. The run is checked every RunPollInterval, GitHub
+// rate limits are waited out, and the wait is bounded by ctx.
+func (m *DaggerAutofix) WaitForRunCompletion(ctx context.Context, runID int64, attempt int) (*WorkflowRun, error) {
+	if err := validateRunID(runID); err != nil {
+		return nil, err
+	}
+	if m.githubClient == nil {
+		return nil, ErrNotInitialized
+	}
+	return m.githubClient.WaitForWorkflowRun(withPollInterval(ctx, m.RunPollInterval), runID, attempt, runCompletionTimeout)
+}
+
+// AnalyzeFailureAttempt analyzes the failure of one attempt of a workflow run, from the logs
+// of that attempt's jobs
+func (m *DaggerAutofix) AnalyzeFailureAttempt(ctx context.Context, runID int64, attempt int) (*FailureAnalysisResult, error) {
+	if err := validateRunID(runID); err != nil {
+		return nil, err
+	}
+	if attempt < 1 {
+		return nil, fmt.Errorf("invalid attempt %d: attempts start at 1", attempt)
+	}
+	if m.failureEngine == nil {
+		return nil, ErrNotInitialized
+	}
+
+	m.logger.WithFields(logrus.Fields{"run_id": runID, "attempt": attempt}).Info("Analyzing workflow failure attempt")
+	ctx = withAuditRun(ctx, m.auditLog, runID)
+
+	failureCtx, err := m.attemptFailureContext(ctx, runID, attempt)
+	if analysis := m.logsUnavailableAnalysis(failureCtx, err); analysis != nil {
+		return analysis, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m.analyzeFailureContext(ctx, failureCtx)
+}
+
+// AttemptAnalysis is a completed attempt of a watched workflow run
+type AttemptAnalysis struct {
+	Attempt int          `json:"attempt"`
+	Run     *WorkflowRun `json:"run"`
+	// Analysis is the analysis of the attempt's failure, nil when it did not fail
+	Analysis *FailureAnalysisResult `json:"analysis,omitempty"`
+	// Comparison compares the attempt with the previous one watched, nil for the first
+	Comparison *AttemptComparison `json:"comparison,omitempty"`
+}
+
+// AttemptComparison tells how an attempt of a workflow run differs from the previous one
+type AttemptComparison struct {
+	PreviousAttempt     int         `json:"previous_attempt"`
+	Passed              bool        `json:"passed"`
+	FailureTypeChanged  bool        `json:"failure_type_changed"`
+	RootCauseChanged    bool        `json:"root_cause_changed"`
+	PreviousFailureType FailureType `json:"previous_failure_type,omitempty"`
+	FailureType         FailureType `json:"failure_type,omitempty"`
+	PreviousRootCause   string      `json:"previous_root_cause,omitempty"`
+	RootCause           string      `json:"root_cause,omitempty"`
+	Summary             string      `json:"summary"`
+}
+
+// failedConclusion tells whether a completed run's conclusion is a failure to analyze
+func failedConclusion(conclusion string) bool {
+	return conclusion == "failure" || conclusion == "timed_out"
+}
+
+// WatchRun follows a workflow run as it is re-run. Each attempt is passed to onAttempt once
+// it completed, with the analysis of its failure and its comparison with the previous
+// attempt, starting with the latest attempt. Watching ends when an attempt passes, when
+// onAttempt returns an error, or when ctx is done.
+func (m *DaggerAutofix) WatchRun(ctx context.Context, runID int64, onAttempt func(*AttemptAnalysis) error) error {
+	if err := validateRunID(runID); err != nil {
+		return err
+	}
+	if m.githubClient == nil || m.failureEngine == nil {
+		return ErrNotInitialized
+	}
+
+	run, err := m.githubClient.GetWorkflowRun(ctx, runID)
+	if err != nil {
+		return fmt.Errorf("failed to get workflow run: %w", err)
+	}
+	attempt := max(run.RunAttempt, 1)
+
+	var previous *AttemptAnalysis
+	for {
+		m.logger.WithFields(logrus.Fields{"run_id": runID, "attempt": attempt}).Info("Waiting for workflow run attempt to complete")
+		run, err := m.WaitForRunCompletion(ctx, runID, attempt)
+		if err != nil {
+			return err
+		}
+
+		current := &AttemptAnalysis{Attempt: max(run.RunAttempt, attempt), Run: run}
+		if failedConclusion(run.Conclusion) {
+			current.Analysis, err = m.AnalyzeFailureAttempt(ctx, runID, current.Attempt)
+			if err != nil {
+				return err
+			}
+		}
+		if previous != nil {
+			current.Comparison = compareAttempts(previous, current)
+		}
+		if err := onAttempt(current); err != nil {
+			return err
+		}
+		if run.Conclusion == "success" {
+			return nil
+		}
+		previous = current
+		attempt = current.Attempt + 1
+	}
+}
+
+// compareAttempts compares an attempt of a run with the previous one
+func compareAttempts(previous, current *AttemptAnalysis) *AttemptComparison {
+	comparison := &AttemptComparison{
+		PreviousAttempt: previous.Attempt,
+		Passed:          current.Run.Conclusion == "success",
+	}
+	if previous.Analysis != nil {
+		comparison.PreviousFailureType = previous.Analysis.Classification.Type
+		comparison.PreviousRootCause = previous.Analysis.RootCause
+	}
+	if current.Analysis != nil {
+		comparison.FailureType = current.Analysis.Classification.Type
+		comparison.RootCause = current.Analysis.RootCause
+	}
+	if previous.Analysis != nil && current.Analysis != nil {
+		comparison.FailureTypeChanged = comparison.FailureType != comparison.PreviousFailureType
+		comparison.RootCauseChanged = !strings.EqualFold(strings.TrimSpace(comparison.RootCause), strings.TrimSpace(comparison.PreviousRootCause))
+	}
+	comparison.Summary = attemptSummary(previous, current, comparison)
+	return comparison
+}
+
+// attemptSummary describes a comparison in a sentence
+func attemptSummary(previous, current *AttemptAnalysis, c *AttemptComparison) string {
+	was := fmt.Sprintf("attempt %d concluded %s", previous.Attempt, valueOr(previous.Run.Conclusion, "without a conclusion"))
+	if previous.Analysis != nil {
+		was = fmt.Sprintf("attempt %d failed (%s failure)", previous.Attempt, c.PreviousFailureType)
+	}
+
+	switch {
+	case c.Passed:
+		return fmt.Sprintf("Attempt %d passed after %s", current.Attempt, was)
+	case current.Analysis == nil:
+		return fmt.Sprintf("Attempt %d concluded %s after %s", current.Attempt, valueOr(current.Run.Conclusion, "without a conclusion"), was)
+	case previous.Analysis == nil:
+		return fmt.Sprintf("Attempt %d failed (%s failure) after %s", current.Attempt, c.FailureType, was)
+	case c.FailureTypeChanged:
+		return fmt.Sprintf("Attempt %d failed differently: the failure type changed from %s to %s", current.Attempt, c.PreviousFailureType, c.FailureType)
+	case c.RootCauseChanged:
+		return fmt.Sprintf("Attempt %d failed differently: same failure type (%s), different root cause", current.Attempt, c.FailureType)
+	default:
+		return fmt.Sprintf("Attempt %d failed the same way as attempt %d (%s failure)", current.Attempt, previous.Attempt, c.FailureType)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// attemptConclusions are the conclusions of the attempts of the watched run 7
+var attemptConclusions = []string{"failure", "failure", "success"}
+
+// attemptErrors are the errors attempts 1 and 2 failed with
+var attemptErrors = []string{
+	"FAIL src/sum.test.js: expected 3, received 12",
+	"npm ERR! 404 Not Found - GET https://registry.npmjs.org/left-padd",
+}
+
+// watchAutofix returns an agent watching run 7 through the attempts of attemptConclusions.
+// Analyses classify the test error as a test failure and the npm error as a dependency one.
+func watchAutofix() (*DaggerAutofix, *mockGitHub) {
+	attempt := func(n int) *WorkflowRun {
+		return &WorkflowRun{ID: 7, Name: "CI", Status: "completed", Conclusion: attemptConclusions[n-1], RunAttempt: n}
+	}
+	gh := &mockGitHub{
+		getWorkflowRunFunc: func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+			return attempt(1), nil
+		},
+		waitForWorkflowRunFunc: func(ctx context.Context, runID int64, minAttempt int, timeout time.Duration) (*WorkflowRun, error) {
+			if minAttempt > len(attemptConclusions) {
+				return nil, errors.New("no further attempt")
+			}
+			return attempt(minAttempt), nil
+		},
+		getRunAttemptFunc: func(ctx context.Context, runID int64, n int) (*WorkflowRun, error) {
+			return attempt(n), nil
+		},
+		getRunAttemptLogsFunc: func(ctx context.Context, runID int64, n int) (*WorkflowLogs, error) {
+			line := attemptErrors[n-1]
+			return &WorkflowLogs{RawLogs: line, ErrorLines: []string{line}}, nil
+		},
+	}
+	fe := &mockFailureAnalysisEngine{
+		analyzeFunc: func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+			analysis := &FailureAnalysisResult{
+				ID:             "analysis-" + fc.Logs.ErrorLines[0][:4],
+				RootCause:      "sum concatenates its arguments",
+				Classification: FailureClassification{Type: TestFailure},
+			}
+			if strings.HasPrefix(fc.Logs.RawLogs, "npm ERR!") {
+				analysis.RootCause = "left-padd does not exist on the registry"
+				analysis.Classification.Type = DependencyFailure
+			}
+			return analysis, nil
+		},
+	}
+	return &DaggerAutofix{githubClient: gh, failureEngine: fe, logger: quietLogger()}, gh
+}
+
+// TestWatchRun tests following a run through a failed attempt, a re-run failing differently
+// and a passing re-run
+func TestWatchRun(t *testing.T) {
+	m, gh := watchAutofix()
+
+	var attempts []*AttemptAnalysis
+	err := m.WatchRun(context.Background(), 7, func(attempt *AttemptAnalysis) error {
+		attempts = append(attempts, attempt)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, attempts, 3)
+
+	first := attempts[0]
+	assert.Equal(t, 1, first.Attempt)
+	require.NotNil(t, first.Analysis)
+	assert.Equal(t, TestFailure, first.Analysis.Classification.Type)
+	assert.Nil(t, first.Comparison)
+
+	second := attempts[1]
+	require.NotNil(t, second.Analysis)
+	assert.Equal(t, DependencyFailure, second.Analysis.Classification.Type)
+	assert.Equal(t, &AttemptComparison{
+		PreviousAttempt:     1,
+		FailureTypeChanged:  true,
+		RootCauseChanged:    true,
+		PreviousFailureType: TestFailure,
+		FailureType:         DependencyFailure,
+		PreviousRootCause:   "sum concatenates its arguments",
+		RootCause:           "left-padd does not exist on the registry",
+		Summary:             "Attempt 2 failed differently: the failure type changed from test to dependency",
+	}, second.Comparison)
+
+	third := attempts[2]
+	assert.Nil(t, third.Analysis)
+	assert.True(t, third.Comparison.Passed)
+	assert.Equal(t, "Attempt 3 passed after attempt 2 failed (dependency failure)", third.Comparison.Summary)
+
+	// Attempts are analyzed from their own logs
+	assert.NotContains(t, gh.calls, "GetWorkflowLogs")
+	assert.NotContains(t, gh.calls, "GetCheckRunAnnotations")
+
+	t.Run("StopsOnCallbackError", func(t *testing.T) {
+		m, _ := watchAutofix()
+		stop := errors.New("stop")
+		calls := 0
+		err := m.WatchRun(context.Background(), 7, func(*AttemptAnalysis) error {
+			calls++
+			return stop
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+// TestCompareAttempts tests the summaries of attempts failing the same way or not completing
+func TestCompareAttempts(t *testing.T) {
+	failed := func(n int, failureType FailureType, rootCause string) *AttemptAnalysis {
+		return &AttemptAnalysis{Attempt: n, Run: &WorkflowRun{Conclusion: "failure"},
+			Analysis: &FailureAnalysisResult{RootCause: rootCause, Classification: FailureClassification{Type: failureType}}}
+	}
+
+	same := compareAttempts(failed(1, TestFailure, "Flaky timer"), failed(2, TestFailure, "flaky timer "))
+	assert.False(t, same.FailureTypeChanged)
+	assert.False(t, same.RootCauseChanged)
+	assert.Equal(t, "Attempt 2 failed the same way as attempt 1 (test failure)", same.Summary)
+
+	cause := compareAttempts(failed(1, TestFailure, "Flaky timer"), failed(2, TestFailure, "Wrong expectation"))
+	assert.True(t, cause.RootCauseChanged)
+	assert.Equal(t, "Attempt 2 failed differently: same failure type (test), different root cause", cause.Summary)
+
+	cancelled := &AttemptAnalysis{Attempt: 2, Run: &WorkflowRun{Conclusion: "cancelled"}}
+	assert.Equal(t, "Attempt 2 concluded cancelled after attempt 1 failed (test failure)",
+		compareAttempts(failed(1, TestFailure, "Flaky timer"), cancelled).Summary)
+	assert.Equal(t, "Attempt 3 failed (build failure) after attempt 2 concluded cancelled",
+		compareAttempts(cancelled, failed(3, BuildFailure, "Missing module")).Summary)
+}
+
+// TestWaitForRunCompletion tests that the wait polls at RunPollInterval
+func TestWaitForRunCompletion(t *testing.T) {
+	var interval time.Duration
+	gh := &mockGitHub{
+		waitForWorkflowRunFunc: func(ctx context.Context, runID int64, minAttempt int, timeout time.Duration) (*WorkflowRun, error) {
+			interval = pollInterval(ctx)
+			return &WorkflowRun{ID: runID, Status: "completed", RunAttempt: minAttempt}, nil
+		},
+	}
+	m := &DaggerAutofix{githubClient: gh, logger: quietLogger()}
+
+	run, err := m.WithRunPollInterval(time.Second).WaitForRunCompletion(context.Background(), 7, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, run.RunAttempt)
+	assert.Equal(t, time.Second, interval)
+
+	_, err = m.WithRunPollInterval(0).WaitForRunCompletion(context.Background(), 7, 2)
+	require.NoError(t, err)
+	assert.Equal(t, workflowRunPollInterval, interval)
+
+	_, err = New().WaitForRunCompletion(context.Background(), 7, 2)
+	assert.ErrorIs(t, err, ErrNotInitialized)
+}
+
+// TestGetWorkflowRunAttempt tests getting a run and the logs of its jobs as of an attempt
+func TestGetWorkflowRunAttempt(t *testing.T) {
+	g, mux := newMockGitHubAPI(t)
+	mux.HandleFunc("/repos/owner/repo/actions/runs/7/attempts/1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 7, "status": "completed", "conclusion": "failure", "run_attempt": 1})
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/7/attempts/1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"total_count": 1, "jobs": []map[string]interface{}{{
+			"id": 70, "name": "test", "conclusion": "failure",
+			"steps": []map[string]interface{}{{"name": "Run tests", "conclusion": "failure"}},
+		}}})
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/jobs/70/logs", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://logs.example.com/70", http.StatusFound)
+	})
+
+	run, err := g.GetWorkflowRunAttempt(context.Background(), 7, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, run.RunAttempt)
+	assert.Equal(t, "failure", run.Conclusion)
+
+	logs, err := g.GetWorkflowRunAttemptLogs(context.Background(), 7, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test"}, logs.FailedJobs)
+	assert.Equal(t, []string{"Step 'Run tests' failed: failure"}, logs.ErrorLines)
+}
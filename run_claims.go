@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultRunClaimLease is how long a claimed run is reserved for its fix. It outlasts the
+	// default fix and drain timeouts, so only fixes that were abandoned lose their claim.
+	DefaultRunClaimLease = time.Hour
+	// runClaimRetention is how long runs that were fixed stay claimed, so late duplicate
+	// deliveries of them are not fixed again
+	runClaimRetention = 24 * time.Hour
+)
+
+// runClaims reserves workflow runs for the entry point that fixes them, so a run reported by
+// both polling and an event is fixed once. Workflow run IDs are unique across GitHub, so one
+// registry serves every monitored repository.
+type runClaims struct {
+	mu     sync.Mutex
+	leases map[int64]time.Time // expiry of each claim
+	now    func() time.Time
+}
+
+// claim reserves runID for lease and reports whether it was free. Runs whose claim expired,
+// because their fix did not complete, can be claimed again.
+func (c *runClaims) claim(runID int64, lease time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock()
+	for id, expiry := range c.leases {
+		if !now.Before(expiry) {
+			delete(c.leases, id)
+		}
+	}
+	if _, ok := c.leases[runID]; ok {
+		return false
+	}
+	if c.leases == nil {
+		c.leases = make(map[int64]time.Time)
+	}
+	c.leases[runID] = now.Add(lease)
+	return true
+}
+
+// complete keeps runID claimed for runClaimRetention once it was fixed
+func (c *runClaims) complete(runID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.leases[runID]; ok {
+		c.leases[runID] = c.clock().Add(runClaimRetention)
+	}
+}
+
+// release frees runID, e.g. when it could not be queued after all
+func (c *runClaims) release(runID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.leases, runID)
+}
+
+func (c *runClaims) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// runClaimLease returns RunClaimLease, or the default when unset
+func (m *DaggerAutofix) runClaimLease() time.Duration {
+	if m.RunClaimLease <= 0 {
+		return DefaultRunClaimLease
+	}
+	return m.RunClaimLease
+}
+
+// claimRun reserves runID of agent's repository for fixing. A run another entry point
+// already claimed is not an error: it is logged at debug level and counted.
+func (m *DaggerAutofix) claimRun(agent *DaggerAutofix, runID int64) bool {
+	if m.runClaims.claim(runID, m.runClaimLease()) {
+		return true
+	}
+	agent.logger.WithField("run_id", runID).Debug("Workflow run already being processed, skipping it")
+	agentMetrics.failuresDuplicate.inc(metricsRepository(agent))
+	return false
+}
+
+// finishRun completes the claim of runID when its fix succeeded. Failed fixes keep their
+// lease until it expires, so a duplicate delivery in the meantime does not retry them.
+func (m *DaggerAutofix) finishRun(runID int64, err error) {
+	if err == nil {
+		m.runClaims.complete(runID)
+	}
+}
+
+// dispatchRun claims a failed run of agent's repository reported by an event, such as a
+// workflow_run webhook, and submits it to the worker pool. It reports whether the run was
+// submitted; runs polling or another delivery already claimed are skipped.
+func (m *DaggerAutofix) dispatchRun(ctx context.Context, agent *DaggerAutofix, run *WorkflowRun) bool {
+	pool := m.ensureFixPool(ctx)
+
+	m.poolMu.Lock()
+	if !m.claimRun(agent, run.ID) {
+		m.poolMu.Unlock()
+		return false
+	}
+	submitted := m.submitRun(pool, agent, run)
+	if submitted {
+		// Polling skips the run from now on
+		if agent.processedRuns == nil {
+			agent.processedRuns = make(map[int64]bool)
+		}
+		agent.processedRuns[run.ID] = true
+	} else {
+		m.runClaims.release(run.ID)
+	}
+	m.poolMu.Unlock()
+
+	if submitted {
+		m.stats.failuresDetected.Add(1)
+		agentMetrics.failuresDetected.inc(metricsRepository(agent))
+		agent.logger.WithFields(logrus.Fields{"run_id": run.ID, "workflow": run.Name}).Info("Dispatched failed workflow run")
+	} else {
+		agentMetrics.failuresSkipped.inc(metricsRepository(agent))
+	}
+	return submitted
+}
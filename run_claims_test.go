@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunClaims tests claiming runs, and claiming them again once their lease expired
+func TestRunClaims(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	claims := &runClaims{now: func() time.Time { return now }}
+
+	assert.True(t, claims.claim(1, time.Minute))
+	assert.False(t, claims.claim(1, time.Minute), "claimed runs are not claimed twice")
+	assert.True(t, claims.claim(2, time.Minute))
+
+	// Run 1 did not complete within its lease, run 2 was fixed
+	claims.complete(2)
+	now = now.Add(time.Minute)
+	assert.True(t, claims.claim(1, time.Minute))
+	assert.False(t, claims.claim(2, time.Minute), "fixed runs stay claimed")
+
+	now = now.Add(runClaimRetention)
+	assert.True(t, claims.claim(2, time.Minute))
+
+	claims.release(2)
+	assert.True(t, claims.claim(2, time.Minute))
+}
+
+// claimAutofix builds a module whose only failed run is runID, counting the auto-fixes of it
+func claimAutofix(runID int64, fixes *int32) *DaggerAutofix {
+	m := fixtureAutofix(nil)
+	m.MaxConcurrentFixes = 2
+	m.githubClient.(*mockGitHub).getFailedWorkflowRunsFunc = func(ctx context.Context) ([]*WorkflowRun, error) {
+		return []*WorkflowRun{{ID: runID}}, nil
+	}
+	m.failureEngine.(*mockFailureAnalysisEngine).analyzeFunc = func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+		atomic.AddInt32(fixes, 1)
+		return nil, errors.New("analysis failed")
+	}
+	return m
+}
+
+// TestDuplicateRunSuppression tests that a run reported by polling and event dispatch at once
+// is fixed exactly once
+func TestDuplicateRunSuppression(t *testing.T) {
+	metrics := useTestMetrics(t)
+
+	const attempts = 20
+	for i := 0; i < attempts; i++ {
+		var fixes int32
+		m := claimAutofix(42, &fixes)
+		ctx := context.Background()
+
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			<-start
+			assert.NoError(t, m.checkForFailures(ctx))
+		}()
+		go func() {
+			defer wg.Done()
+			<-start
+			m.dispatchRun(ctx, m, &WorkflowRun{ID: 42})
+		}()
+		close(start)
+		wg.Wait()
+		m.drainFixes()
+
+		require.Equal(t, int32(1), atomic.LoadInt32(&fixes), "attempt %d", i)
+
+		// The failed fix keeps its claim, so neither entry point retries it
+		assert.NoError(t, m.checkForFailures(ctx))
+		assert.False(t, m.dispatchRun(ctx, m, &WorkflowRun{ID: 42}))
+		m.drainFixes()
+		assert.Equal(t, int32(1), atomic.LoadInt32(&fixes))
+	}
+
+	// Polling does not claim runs it saw dispatched, so only some races count a duplicate
+	c := metrics.failuresDuplicate
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	assert.GreaterOrEqual(t, c.values[formatLabels(c.labels, []string{"unknown"})], float64(attempts))
+}
+
+// TestRunClaimReleasedOnPanic tests that a run whose fix panicked is freed, so it is fixed
+// again without waiting for its lease to expire
+func TestRunClaimReleasedOnPanic(t *testing.T) {
+	var fixes int32
+	m := claimAutofix(42, &fixes)
+	m.failureEngine.(*mockFailureAnalysisEngine).analyzeFunc = func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+		atomic.AddInt32(&fixes, 1)
+		panic("analysis engine bug")
+	}
+	ctx := context.Background()
+
+	require.True(t, m.dispatchRun(ctx, m, &WorkflowRun{ID: 42}))
+	m.drainFixes()
+	require.True(t, m.dispatchRun(ctx, m, &WorkflowRun{ID: 42}), "the panicked fix does not keep its claim")
+	m.drainFixes()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fixes))
+	assert.Equal(t, int64(2), m.stats.failedFixes.Load())
+}
+
+// TestRunClaimLeaseExpiry tests that a run whose fix did not complete is fixed again once its
+// claim expired
+func TestRunClaimLeaseExpiry(t *testing.T) {
+	var fixes int32
+	m := claimAutofix(42, &fixes).WithRunClaimLease(time.Minute)
+	now := time.Now()
+	m.runClaims.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	require.True(t, m.dispatchRun(ctx, m, &WorkflowRun{ID: 42}))
+	m.drainFixes()
+	assert.False(t, m.dispatchRun(ctx, m, &WorkflowRun{ID: 42}))
+
+	now = now.Add(time.Minute)
+	require.True(t, m.dispatchRun(ctx, m, &WorkflowRun{ID: 42}))
+	m.drainFixes()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fixes))
+}
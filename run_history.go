@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// runHistoryLength is how many earlier runs of the workflow the history covers
+	runHistoryLength = 10
+	// maxFailingJobs is how many failed jobs the PR body lists
+	maxFailingJobs = 5
+)
+
+// RunHistory is how the runs of a failed run's workflow went on the target branch before it
+type RunHistory struct {
+	Workflow string `json:"workflow"`
+	Branch   string `json:"branch"`
+	// Runs is how many completed runs preceding the failed one were looked at, and Failed how
+	// many of them failed or timed out
+	Runs   int `json:"runs"`
+	Failed int `json:"failed"`
+	// PassingStreak is how many runs in a row had passed right before the failed one
+	PassingStreak int `json:"passing_streak"`
+}
+
+// runHistory looks up the last completed runs of run's workflow on branch before run. It is
+// nil when the workflow or branch is unknown or the runs cannot be listed.
+func (m *DaggerAutofix) runHistory(ctx context.Context, run *WorkflowRun, branch string) *RunHistory {
+	if run == nil || run.WorkflowID == 0 || branch == "" {
+		return nil
+	}
+	// Runs started after the failed one, e.g. a fix's, would crowd the earlier ones out
+	runs, err := m.githubClient.GetRecentWorkflowRuns(ctx, run.WorkflowID, branch, 3*runHistoryLength)
+	if err != nil {
+		m.logger.WithError(err).WithFields(logrus.Fields{
+			"workflow_id": run.WorkflowID,
+			"branch":      branch,
+		}).Warn("Failed to list recent workflow runs, continuing without the run history")
+		return nil
+	}
+
+	history := &RunHistory{Workflow: run.Name, Branch: branch}
+	streak := true
+	for _, earlier := range runs {
+		if earlier.ID == run.ID || (!run.CreatedAt.IsZero() && !earlier.CreatedAt.Before(run.CreatedAt)) {
+			continue
+		}
+		history.Runs++
+		switch earlier.Conclusion {
+		case "failure", "timed_out":
+			history.Failed++
+			streak = false
+		case "success":
+			if streak {
+				history.PassingStreak++
+			}
+		default:
+			streak = false
+		}
+		if history.Runs == runHistoryLength {
+			break
+		}
+	}
+	if history.Runs == 0 {
+		return nil
+	}
+	return history
+}
+
+// writeFailingSteps lists the failed jobs with the step that failed, how long it ran and its
+// first error, followed by the workflow's recent history. It writes nothing without either.
+func writeFailingSteps(body *strings.Builder, failureCtx FailureContext) {
+	logs := failureCtx.Logs
+	var jobs []string
+	if logs != nil {
+		jobs = appendMissing(nil, logs.FailedJobs...)
+		for _, step := range logs.FailedSteps {
+			jobs = appendMissing(jobs, step.Job)
+		}
+	}
+	history := failureCtx.History
+	if len(jobs) == 0 && history == nil {
+		return
+	}
+
+	body.WriteString("## 🔎 Failing Job/Step\n\n")
+	for i, job := range jobs {
+		if i == maxFailingJobs {
+			body.WriteString(fmt.Sprintf("- ...and %s\n", countOf(len(jobs)-maxFailingJobs, "more failed job")))
+			break
+		}
+		steps := failedStepsOf(logs, job)
+		line := fmt.Sprintf("- **%s**: ", job)
+		switch {
+		case len(steps) == 0:
+			line += "failed step unknown"
+		case steps[0].Duration > 0:
+			line += fmt.Sprintf("`%s` failed after %s", steps[0].Name, formatStepDuration(steps[0].Duration))
+		default:
+			line += fmt.Sprintf("`%s` failed", steps[0].Name)
+		}
+		if len(steps) > 1 {
+			line += fmt.Sprintf(" (and %s)", countOf(len(steps)-1, "more failed step"))
+		}
+		body.WriteString(line + "\n")
+		if detail := firstJobError(logs, job); detail != "" {
+			body.WriteString(fmt.Sprintf("  > %s\n", detail))
+		}
+	}
+	if len(jobs) > 0 {
+		body.WriteString("\n")
+	}
+
+	if history != nil {
+		workflow := "this workflow"
+		if history.Workflow != "" {
+			workflow = fmt.Sprintf("`%s`", history.Workflow)
+		}
+		line := fmt.Sprintf("**History**: %d of the last %s of %s on `%s` also failed",
+			history.Failed, countOf(history.Runs, "run"), workflow, history.Branch)
+		if history.PassingStreak > 0 {
+			line += fmt.Sprintf("; it had passed %s in a row before", countOf(history.PassingStreak, "run"))
+		}
+		body.WriteString(line + "\n\n")
+	}
+}
+
+// failedStepsOf returns the failed steps of a job
+func failedStepsOf(logs *WorkflowLogs, job string) []FailedStep {
+	var steps []FailedStep
+	for _, step := range logs.FailedSteps {
+		if step.Job == job {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// firstJobError returns a job's first failure annotation, or its first error line other than
+// the ones only naming a failed step
+func firstJobError(logs *WorkflowLogs, job string) string {
+	for _, annotation := range logs.Annotations {
+		if annotation.Job != job || annotation.Level != AnnotationFailure {
+			continue
+		}
+		if message := firstLine(annotation.Message); message != "" {
+			if annotation.Path == "" {
+				return message
+			}
+			return fmt.Sprintf("%s: %s", annotation.location(), message)
+		}
+	}
+	for _, line := range logs.JobErrorLines[job] {
+		if strings.HasPrefix(line, "Step '") && strings.HasSuffix(line, "' failed: failure") {
+			continue
+		}
+		if line = firstLine(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// formatStepDuration rounds a step duration to the second, e.g. 1m32s
+func formatStepDuration(d time.Duration) string {
+	if d < time.Second {
+		return "<1s"
+	}
+	return d.Round(time.Second).String()
+}
+
+// countOf returns n and noun, made plural unless n is 1, e.g. 3 failed jobs
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// multiJobLogs returns the logs of a run in which the given number of matrix jobs failed
+func multiJobLogs(jobs int) *WorkflowLogs {
+	logs := &WorkflowLogs{JobErrorLines: make(map[string][]string)}
+	for i := 1; i <= jobs; i++ {
+		job := fmt.Sprintf("test (node %d)", i)
+		logs.FailedJobs = append(logs.FailedJobs, job)
+		logs.FailedSteps = append(logs.FailedSteps, FailedStep{Job: job, Name: "Run tests", Duration: time.Duration(i)*time.Minute + 32*time.Second + 400*time.Millisecond})
+		logs.JobErrorLines[job] = []string{"Step 'Run tests' failed: failure", fmt.Sprintf("npm ERR! Test failed in job %d", i)}
+	}
+	return logs
+}
+
+// TestWriteFailingSteps tests rendering the failed jobs and steps and the run history
+func TestWriteFailingSteps(t *testing.T) {
+	t.Run("MultipleJobs", func(t *testing.T) {
+		logs := multiJobLogs(2)
+		logs.FailedSteps = append(logs.FailedSteps, FailedStep{Job: "test (node 2)", Name: "Upload coverage"})
+		logs.Annotations = []Annotation{
+			{Job: "test (node 1)", Level: AnnotationWarning, Path: "src/app.js", StartLine: 1, Message: "Unused variable"},
+			{Job: "test (node 1)", Level: AnnotationFailure, Path: "src/sum.test.js", StartLine: 3, EndLine: 5, Message: "expected 3 to equal 4\n    at Object.<anonymous>"},
+		}
+		failureCtx := FailureContext{
+			Logs:    logs,
+			History: &RunHistory{Workflow: "CI", Branch: "main", Runs: 10, Failed: 2, PassingStreak: 7},
+		}
+
+		var body strings.Builder
+		writeFailingSteps(&body, failureCtx)
+		assert.Equal(t, "## 🔎 Failing Job/Step\n\n"+
+			"- **test (node 1)**: `Run tests` failed after 1m32s\n"+
+			"  > src/sum.test.js:3-5: expected 3 to equal 4\n"+
+			"- **test (node 2)**: `Run tests` failed after 2m32s (and 1 more failed step)\n"+
+			"  > npm ERR! Test failed in job 2\n\n"+
+			"**History**: 2 of the last 10 runs of `CI` on `main` also failed; it had passed 7 runs in a row before\n\n",
+			body.String())
+	})
+
+	t.Run("JobCap", func(t *testing.T) {
+		var body strings.Builder
+		writeFailingSteps(&body, FailureContext{Logs: multiJobLogs(8)})
+		out := body.String()
+		assert.Contains(t, out, "**test (node 5)**")
+		assert.NotContains(t, out, "**test (node 6)**")
+		assert.Contains(t, out, "- ...and 3 more failed jobs\n")
+		assert.Equal(t, 5, strings.Count(out, "  > "))
+		assert.NotContains(t, out, "**History**")
+	})
+
+	t.Run("MissingData", func(t *testing.T) {
+		logs := &WorkflowLogs{
+			FailedJobs:    []string{"build"},
+			JobErrorLines: map[string][]string{"build": {"Step 'Compile' failed: failure"}},
+			FailedSteps:   []FailedStep{{Job: "lint", Name: "Lint", Duration: 300 * time.Millisecond}},
+		}
+		var body strings.Builder
+		writeFailingSteps(&body, FailureContext{Logs: logs, History: &RunHistory{Branch: "main", Runs: 3}})
+		assert.Equal(t, "## 🔎 Failing Job/Step\n\n"+
+			"- **build**: failed step unknown\n"+
+			"- **lint**: `Lint` failed after <1s\n\n"+
+			"**History**: 0 of the last 3 runs of this workflow on `main` also failed\n\n",
+			body.String())
+
+		body.Reset()
+		writeFailingSteps(&body, FailureContext{})
+		writeFailingSteps(&body, FailureContext{Logs: &WorkflowLogs{}})
+		assert.Empty(t, body.String())
+	})
+
+	t.Run("PRBody", func(t *testing.T) {
+		analysis := &FailureAnalysisResult{ID: "a1", Context: FailureContext{Logs: multiJobLogs(6)}}
+		body := NewPullRequestEngine(nil, quietLogger()).generatePRBody(analysis, &FixValidationResult{})
+		section := strings.Index(body, "## 🔎 Failing Job/Step")
+		require.NotEqual(t, -1, section)
+		assert.Less(t, strings.Index(body, "## 📊 Failure Analysis"), section)
+		assert.Less(t, section, strings.Index(body, "## 🔧 Fix Details"))
+		assert.Contains(t, body, "- ...and 1 more failed job\n")
+	})
+}
+
+// TestRunHistory tests summarizing the earlier runs of a failed run's workflow
+func TestRunHistory(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	failed := &WorkflowRun{ID: 100, Name: "CI", WorkflowID: 7, CreatedAt: now}
+	run := func(id int64, conclusion string, hoursAgo int) *WorkflowRun {
+		return &WorkflowRun{ID: id, WorkflowID: 7, Conclusion: conclusion, CreatedAt: now.Add(-time.Duration(hoursAgo) * time.Hour)}
+	}
+	gh := &mockGitHub{}
+	m := &DaggerAutofix{githubClient: gh, logger: quietLogger()}
+
+	gh.getRecentRunsFunc = func(ctx context.Context, workflowID int64, branch string, limit int) ([]*WorkflowRun, error) {
+		assert.Equal(t, int64(7), workflowID)
+		assert.Equal(t, "main", branch)
+		assert.Greater(t, limit, runHistoryLength)
+		runs := []*WorkflowRun{
+			run(102, "success", -2), // a later run, e.g. after the fix
+			run(100, "failure", 0),
+			run(99, "success", 1),
+			run(98, "success", 2),
+			run(97, "failure", 3),
+			run(96, "cancelled", 4),
+		}
+		for i := 0; i < 20; i++ {
+			runs = append(runs, run(int64(95-i), "success", 5+i))
+		}
+		return runs, nil
+	}
+	history := m.runHistory(context.Background(), failed, "main")
+	require.NotNil(t, history)
+	assert.Equal(t, RunHistory{Workflow: "CI", Branch: "main", Runs: runHistoryLength, Failed: 1, PassingStreak: 2}, *history)
+
+	// Without the workflow or branch, runs to look at or the API, there is no history
+	assert.Nil(t, m.runHistory(context.Background(), &WorkflowRun{ID: 100}, "main"))
+	assert.Nil(t, m.runHistory(context.Background(), failed, ""))
+	gh.getRecentRunsFunc = func(ctx context.Context, workflowID int64, branch string, limit int) ([]*WorkflowRun, error) {
+		return []*WorkflowRun{run(100, "failure", 0)}, nil
+	}
+	assert.Nil(t, m.runHistory(context.Background(), failed, "main"))
+	gh.getRecentRunsFunc = func(ctx context.Context, workflowID int64, branch string, limit int) ([]*WorkflowRun, error) {
+		return nil, errors.New("API unavailable")
+	}
+	assert.Nil(t, m.runHistory(context.Background(), failed, "main"))
+}
+
+// TestForJobFailedSteps tests that job logs keep only the job's failed steps
+func TestForJobFailedSteps(t *testing.T) {
+	logs := multiJobLogs(3)
+	jobLogs := logs.forJob("test (node 2)")
+	require.Len(t, jobLogs.FailedSteps, 1)
+	assert.Equal(t, "test (node 2)", jobLogs.FailedSteps[0].Job)
+	assert.Len(t, mergeWorkflowLogs(jobLogs, logs.forJob("test (node 3)")).FailedSteps, 2)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RunReference is a workflow run given on the command line: a bare run ID, or the URL of a
+// run or one of its jobs as copied from the browser
+type RunReference struct {
+	// Host, Owner and Repo are set for URLs
+	Host  string `json:"host,omitempty"`
+	Owner string `json:"owner,omitempty"`
+	Repo  string `json:"repo,omitempty"`
+	// RunID is zero for check run URLs (/owner/repo/runs/<job-id>), which only name the job
+	RunID int64 `json:"run_id,omitempty"`
+	JobID int64 `json:"job_id,omitempty"`
+}
+
+// Repository returns the "owner/repo" of a URL reference, empty for a bare ID
+func (r RunReference) Repository() string {
+	if r.Owner == "" {
+		return ""
+	}
+	return r.Owner + "/" + r.Repo
+}
+
+// ParseRunReference parses a workflow run ID or the URL of a run or job, e.g.
+//
+//	1234567
+//	https://github.com/owner/repo/actions/runs/1234567
+//	https://github.com/owner/repo/actions/runs/1234567/attempts/2
+//	https://github.com/owner/repo/actions/runs/1234567/job/98765?pr=12
+//	https://github.com/owner/repo/runs/98765
+//	https://ghe.corp.example/owner/repo/actions/runs/1234567/
+//
+// API URLs (https://api.github.com/repos/owner/repo/actions/runs/1234567) are accepted too.
+// Query strings, fragments and trailing slashes are ignored.
+func ParseRunReference(value string) (RunReference, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "/") {
+		runID, err := parseRunID(value)
+		return RunReference{RunID: runID}, err
+	}
+
+	invalid := func(reason string) (RunReference, error) {
+		return RunReference{}, fmt.Errorf("%w %q: %s", ErrInvalidRunID, value, reason)
+	}
+	raw := value
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		return invalid("not a workflow run ID or URL")
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(parsed.Path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	// API URLs name the repository under /repos, behind /api/v3 on Enterprise Server
+	if len(segments) >= 2 && segments[0] == "api" && segments[1] == "v3" {
+		segments = segments[2:]
+	}
+	if len(segments) > 0 && segments[0] == "repos" {
+		segments = segments[1:]
+	}
+	if len(segments) < 4 {
+		return invalid("expected a URL like https://github.com/owner/repo/actions/runs/<run-id>")
+	}
+
+	ref := RunReference{Host: strings.ToLower(parsed.Hostname()), Owner: segments[0], Repo: segments[1]}
+	if err := validateRepository(ref.Owner, ref.Repo); err != nil {
+		return RunReference{}, err
+	}
+	id := func(segment, kind string) (int64, error) {
+		n, err := strconv.ParseInt(segment, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("%w %q: %s ID %q is not a positive number", ErrInvalidRunID, value, kind, segment)
+		}
+		return n, nil
+	}
+
+	switch rest := segments[2:]; {
+	case rest[0] == "actions" && rest[1] == "runs" && len(rest) >= 3:
+		if ref.RunID, err = id(rest[2], "run"); err != nil {
+			return RunReference{}, err
+		}
+		// The job follows the run, after the attempt when the URL names one
+		rest = rest[3:]
+		if len(rest) >= 2 && rest[0] == "attempts" {
+			rest = rest[2:]
+		}
+		if len(rest) >= 2 && (rest[0] == "job" || rest[0] == "jobs") {
+			if ref.JobID, err = id(rest[1], "job"); err != nil {
+				return RunReference{}, err
+			}
+		}
+	case rest[0] == "actions" && rest[1] == "jobs" && len(rest) >= 3:
+		if ref.JobID, err = id(rest[2], "job"); err != nil {
+			return RunReference{}, err
+		}
+	case rest[0] == "runs" || rest[0] == "check-runs":
+		if ref.JobID, err = id(rest[1], "job"); err != nil {
+			return RunReference{}, err
+		}
+	default:
+		return invalid("expected a URL like https://github.com/owner/repo/actions/runs/<run-id>")
+	}
+	return ref, nil
+}
+
+// webHost returns the host of the GitHub web UI the agent talks to: github.com, or the
+// Enterprise host of the configured API URL
+func (m *DaggerAutofix) webHost() string {
+	if m.GitHubAPIURL == "" {
+		return "github.com"
+	}
+	parsed, err := url.Parse(m.GitHubAPIURL)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	// GHE.com and github.com serve their API from the api. subdomain
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "api.")
+}
+
+// ResolveRunReference resolves a workflow run ID or run or job URL, as parsed by
+// ParseRunReference, to the run's ID and the agent of its repository. A URL must name the
+// configured GitHub host and one of the monitored repositories; the agent of that repository
+// is returned, which is m itself for its primary repository. The run of a check run URL naming
+// only a job is looked up through the API.
+func (m *DaggerAutofix) ResolveRunReference(ctx context.Context, value string) (*DaggerAutofix, int64, error) {
+	ref, err := ParseRunReference(value)
+	if err != nil {
+		return nil, 0, err
+	}
+	if ref.Owner == "" {
+		return m, ref.RunID, nil
+	}
+
+	if host := m.webHost(); host != "" && ref.Host != host && ref.Host != "www."+host && ref.Host != "api."+host {
+		return nil, 0, fmt.Errorf("%w: %s is on %s, but the agent is configured for %s", ErrRunRepositoryMismatch, value, ref.Host, host)
+	}
+	agent := m.repositoryAgentFor(ref.Repository())
+	if agent == nil {
+		return nil, 0, fmt.Errorf("%w: %s is a run of %s, not of %s", ErrRunRepositoryMismatch, value, ref.Repository(), m.repositoryName())
+	}
+
+	if ref.RunID == 0 {
+		if err := agent.ensureInitialized(); err != nil {
+			return nil, 0, err
+		}
+		runID, err := agent.githubClient.GetJobRunID(ctx, ref.JobID)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to find the workflow run of job %d: %w", ref.JobID, err)
+		}
+		ref.RunID = runID
+	}
+	return agent, ref.RunID, validateRunID(ref.RunID)
+}
+
+// repositoryAgentFor returns the agent of the "owner/name" repository, nil when it is not
+// monitored. Names are compared case-insensitively, as GitHub does.
+func (m *DaggerAutofix) repositoryAgentFor(repository string) *DaggerAutofix {
+	if strings.EqualFold(m.repositoryName(), repository) {
+		return m
+	}
+	for _, agent := range m.agents() {
+		if strings.EqualFold(agent.repositoryName(), repository) {
+			return agent
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseRunReference tests parsing run IDs and the URLs of runs and jobs
+func TestParseRunReference(t *testing.T) {
+	tests := []struct {
+		value string
+		ref   RunReference
+	}{
+		{"1234567", RunReference{RunID: 1234567}},
+		{" 1234567\n", RunReference{RunID: 1234567}},
+		{"https://github.com/owner/repo/actions/runs/1234567", RunReference{Host: "github.com", Owner: "owner", Repo: "repo", RunID: 1234567}},
+		{"https://github.com/owner/repo/actions/runs/1234567/", RunReference{Host: "github.com", Owner: "owner", Repo: "repo", RunID: 1234567}},
+		{"https://github.com/owner/repo/actions/runs/1234567?pr=12#summary", RunReference{Host: "github.com", Owner: "owner", Repo: "repo", RunID: 1234567}},
+		{"https://github.com/owner/repo/actions/runs/1234567/job/98765", RunReference{Host: "github.com", Owner: "owner", Repo: "repo", RunID: 1234567, JobID: 98765}},
+		{"https://github.com/owner/repo/actions/runs/1234567/job/98765/?pr=12", RunReference{Host: "github.com", Owner: "owner", Repo: "repo", RunID: 1234567, JobID: 98765}},
+		{"https://github.com/owner/repo/actions/runs/1234567/attempts/2", RunReference{Host: "github.com", Owner: "owner", Repo: "repo", RunID: 1234567}},
+		{"https://github.com/owner/repo/actions/runs/1234567/attempts/2/job/98765", RunReference{Host: "github.com", Owner: "owner", Repo: "repo", RunID: 1234567, JobID: 98765}},
+		{"https://github.com/owner/repo/runs/98765?check_suite_focus=true", RunReference{Host: "github.com", Owner: "owner", Repo: "repo", JobID: 98765}},
+		{"github.com/Owner/my.repo/actions/runs/1234567", RunReference{Host: "github.com", Owner: "Owner", Repo: "my.repo", RunID: 1234567}},
+		{"https://GitHub.Example.com/owner/repo/actions/runs/1234567/", RunReference{Host: "github.example.com", Owner: "owner", Repo: "repo", RunID: 1234567}},
+		{"https://github.example.com:8443/owner/repo/actions/runs/1234567/job/98765", RunReference{Host: "github.example.com", Owner: "owner", Repo: "repo", RunID: 1234567, JobID: 98765}},
+		{"https://api.github.com/repos/owner/repo/actions/runs/1234567", RunReference{Host: "api.github.com", Owner: "owner", Repo: "repo", RunID: 1234567}},
+		{"https://github.example.com/api/v3/repos/owner/repo/actions/jobs/98765", RunReference{Host: "github.example.com", Owner: "owner", Repo: "repo", JobID: 98765}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			ref, err := ParseRunReference(tt.value)
+			require.NoError(t, err)
+			assert.Equal(t, tt.ref, ref)
+		})
+	}
+
+	for _, value := range []string{
+		"",
+		"abc",
+		"-5",
+		"https://github.com/owner/repo",
+		"https://github.com/owner/repo/actions",
+		"https://github.com/owner/repo/actions/runs/latest",
+		"https://github.com/owner/repo/actions/runs/0",
+		"https://github.com/owner/repo/actions/runs/1234567/job/summary",
+		"https://github.com/owner/repo/pull/12",
+		"https://github.com/-owner/repo/actions/runs/1234567",
+		"ftp://github.com/owner/repo/actions/runs/1234567",
+	} {
+		t.Run("Invalid/"+value, func(t *testing.T) {
+			_, err := ParseRunReference(value)
+			require.Error(t, err)
+			assert.Equal(t, ErrorCategoryInvalidInput, errorCategory(err))
+		})
+	}
+}
+
+// TestResolveRunReference tests resolving run references to a run ID and the agent of its
+// repository
+func TestResolveRunReference(t *testing.T) {
+	ctx := context.Background()
+	newAgent := func() (*DaggerAutofix, *mockGitHub) {
+		gh := &mockGitHub{}
+		m := fixtureAutofix(nil)
+		m.githubClient = gh
+		m.RepoOwner, m.RepoName = "owner", "repo"
+		return m, gh
+	}
+
+	t.Run("ID", func(t *testing.T) {
+		m, _ := newAgent()
+		agent, runID, err := m.ResolveRunReference(ctx, "42")
+		require.NoError(t, err)
+		assert.Same(t, m, agent)
+		assert.Equal(t, int64(42), runID)
+	})
+
+	t.Run("RunURL", func(t *testing.T) {
+		m, gh := newAgent()
+		agent, runID, err := m.ResolveRunReference(ctx, "https://github.com/Owner/Repo/actions/runs/1234567/job/98765")
+		require.NoError(t, err)
+		assert.Same(t, m, agent)
+		assert.Equal(t, int64(1234567), runID)
+		assert.Empty(t, gh.calls, "the run is in the URL")
+	})
+
+	t.Run("CheckRunURL", func(t *testing.T) {
+		m, gh := newAgent()
+		gh.getJobRunIDFunc = func(ctx context.Context, jobID int64) (int64, error) {
+			assert.Equal(t, int64(98765), jobID)
+			return 1234567, nil
+		}
+		_, runID, err := m.ResolveRunReference(ctx, "https://github.com/owner/repo/runs/98765")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1234567), runID)
+		assert.Equal(t, []string{"GetJobRunID"}, gh.calls)
+
+		gh.getJobRunIDFunc = func(ctx context.Context, jobID int64) (int64, error) {
+			return 0, ErrGitHubNotFound
+		}
+		_, _, err = m.ResolveRunReference(ctx, "https://github.com/owner/repo/runs/98765")
+		assert.ErrorIs(t, err, ErrGitHubNotFound)
+	})
+
+	t.Run("OtherRepository", func(t *testing.T) {
+		m, _ := newAgent()
+		_, _, err := m.ResolveRunReference(ctx, "https://github.com/owner/other/actions/runs/1234567")
+		require.ErrorIs(t, err, ErrRunRepositoryMismatch)
+		assert.Contains(t, err.Error(), "owner/other")
+		assert.Equal(t, ErrorCategoryInvalidInput, errorCategory(err))
+	})
+
+	t.Run("MonitoredRepository", func(t *testing.T) {
+		m, _ := newAgent()
+		other, _ := newAgent()
+		other.RepoName = "other"
+		m.repositories = []*DaggerAutofix{m, other}
+		agent, runID, err := m.ResolveRunReference(ctx, "https://github.com/owner/other/actions/runs/1234567")
+		require.NoError(t, err)
+		assert.Same(t, other, agent)
+		assert.Equal(t, int64(1234567), runID)
+	})
+
+	t.Run("EnterpriseHost", func(t *testing.T) {
+		m, _ := newAgent()
+		m.GitHubAPIURL = "https://github.example.com/api/v3/"
+		_, runID, err := m.ResolveRunReference(ctx, "https://github.example.com/owner/repo/actions/runs/7/")
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), runID)
+
+		_, _, err = m.ResolveRunReference(ctx, "https://github.com/owner/repo/actions/runs/7")
+		require.ErrorIs(t, err, ErrRunRepositoryMismatch)
+		assert.Contains(t, err.Error(), "github.example.com")
+	})
+
+	t.Run("APIHost", func(t *testing.T) {
+		m, _ := newAgent()
+		_, runID, err := m.ResolveRunReference(ctx, "https://api.github.com/repos/owner/repo/actions/runs/7")
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), runID)
+	})
+}
+
+// TestCLIResolveRun tests that the CLI suggests the flag selecting a run's repository or host
+func TestCLIResolveRun(t *testing.T) {
+	m := fixtureAutofix(nil)
+	m.RepoOwner, m.RepoName = "owner", "repo"
+	cli := &CLI{logger: quietLogger()}
+
+	_, _, err := cli.resolveRun(context.Background(), m, "https://github.com/acme/widgets/actions/runs/1")
+	require.True(t, errors.Is(err, ErrRunRepositoryMismatch))
+	assert.Contains(t, err.Error(), "--repo acme/widgets")
+
+	_, _, err = cli.resolveRun(context.Background(), m, "https://github.example.com/owner/repo/actions/runs/1")
+	require.True(t, errors.Is(err, ErrRunRepositoryMismatch))
+	assert.Contains(t, err.Error(), "--github-api-url")
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	sarifVersion  = "2.1.0"
+	sarifSchema   = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifToolName = "dagger-autofix"
+	sarifToolURI  = "https://github.com/tosin2013/dagger-autofix"
+)
+
+// sarifLocationPattern matches the file:line locations of error patterns, optionally followed
+// by a column, e.g. src/app.js:12 or src/app.js:12:5
+var sarifLocationPattern = regexp.MustCompile(`^(.+?):(\d+)(?::(\d+))?$`)
+
+// advisorySecuritySeverity is the CVSS like score code scanning ranks advisories by
+var advisorySecuritySeverity = map[SeverityLevel]string{Critical: "9.5", High: "8.0", Medium: "5.5", Low: "2.0"}
+
+// SARIF 2.1.0 objects written by the exporter
+type (
+	sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+	sarifRun struct {
+		Tool              sarifTool               `json:"tool"`
+		AutomationDetails *sarifAutomationDetails `json:"automationDetails,omitempty"`
+		Results           []sarifResult           `json:"results"`
+	}
+	sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	sarifDriver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	}
+	sarifAutomationDetails struct {
+		ID string `json:"id"`
+	}
+	sarifRule struct {
+		ID                   string             `json:"id"`
+		Name                 string             `json:"name,omitempty"`
+		ShortDescription     sarifText          `json:"shortDescription"`
+		Help                 *sarifText         `json:"help,omitempty"`
+		HelpURI              string             `json:"helpUri,omitempty"`
+		DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+		Properties           *sarifPropertyBag  `json:"properties,omitempty"`
+	}
+	sarifConfiguration struct {
+		Level string `json:"level"`
+	}
+	sarifText struct {
+		Text     string `json:"text"`
+		Markdown string `json:"markdown,omitempty"`
+	}
+	sarifPropertyBag struct {
+		Tags             []string `json:"tags,omitempty"`
+		SecuritySeverity string   `json:"security-severity,omitempty"`
+	}
+	sarifResult struct {
+		RuleID              string            `json:"ruleId"`
+		RuleIndex           int               `json:"ruleIndex"`
+		Level               string            `json:"level"`
+		Message             sarifText         `json:"message"`
+		Locations           []sarifLocation   `json:"locations,omitempty"`
+		PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+	}
+	sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           *sarifRegion          `json:"region,omitempty"`
+	}
+	sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn,omitempty"`
+	}
+)
+
+// ToSARIF exports the analysis as a SARIF 2.1.0 log for code scanning
+func (a *FailureAnalysisResult) ToSARIF() ([]byte, error) {
+	return sarifReport(a)
+}
+
+// sarifReport exports analyses, e.g. those of the failed jobs of a run, as one SARIF run.
+// Error patterns become results at their file:line location, or results of the run when
+// their location is not in a file. Their rule is the built-in error pattern rule they
+// match, else one for the failure type. The root cause is reported at each affected file
+// and advisories as security results.
+func sarifReport(analyses ...*FailureAnalysisResult) ([]byte, error) {
+	builder := &sarifBuilder{rules: make(map[string]int)}
+	for _, analysis := range analyses {
+		if analysis != nil {
+			builder.add(analysis)
+		}
+	}
+
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: sarifToolName, InformationURI: sarifToolURI, Rules: builder.ruleList}},
+		Results: builder.results,
+	}
+	if run.Tool.Driver.Rules == nil {
+		run.Tool.Driver.Rules = []sarifRule{}
+	}
+	if run.Results == nil {
+		run.Results = []sarifResult{}
+	}
+	// Code scanning replaces the previous analysis of the same category on each upload
+	if len(analyses) > 0 && analyses[0] != nil && analyses[0].Context.WorkflowRun != nil && analyses[0].Context.WorkflowRun.Name != "" {
+		run.AutomationDetails = &sarifAutomationDetails{ID: sarifToolName + "/" + analyses[0].Context.WorkflowRun.Name + "/"}
+	}
+
+	data, err := json.MarshalIndent(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SARIF: %w", err)
+	}
+	return data, nil
+}
+
+// sarifBuilder collects the results of analyses and the rules they refer to
+type sarifBuilder struct {
+	ruleList []sarifRule
+	rules    map[string]int // rule index by ID
+	results  []sarifResult
+}
+
+func (b *sarifBuilder) add(analysis *FailureAnalysisResult) {
+	fingerprints := func() map[string]string {
+		if analysis.Fingerprint == "" {
+			return nil
+		}
+		return map[string]string{"failureFingerprint/v1": analysis.Fingerprint}
+	}
+
+	for _, pattern := range analysis.ErrorPatterns {
+		ruleIndex, level := b.patternRule(analysis, pattern)
+		result := sarifResult{
+			RuleID:              b.ruleList[ruleIndex].ID,
+			RuleIndex:           ruleIndex,
+			Level:               level,
+			Message:             sarifText{Text: valueOr(pattern.Description, pattern.Pattern)},
+			PartialFingerprints: fingerprints(),
+		}
+		if location, ok := sarifFileLocation(pattern.Location); ok {
+			result.Locations = []sarifLocation{location}
+		}
+		b.results = append(b.results, result)
+	}
+
+	if analysis.RootCause != "" {
+		ruleIndex := b.failureTypeRule(analysis)
+		level := sarifLevel(analysis.Classification.Severity)
+		message := sarifText{Text: analysis.RootCause}
+		files := analysis.AffectedFiles
+		if len(files) == 0 {
+			files = []string{""}
+		}
+		for _, file := range files {
+			result := sarifResult{RuleID: b.ruleList[ruleIndex].ID, RuleIndex: ruleIndex, Level: level, Message: message, PartialFingerprints: fingerprints()}
+			if location, ok := sarifFileLocation(file); ok {
+				result.Locations = []sarifLocation{location}
+			}
+			b.results = append(b.results, result)
+		}
+	}
+
+	for _, advisory := range analysis.Advisories {
+		ruleIndex := b.rule(sarifRule{
+			ID:                   advisory.ID,
+			Name:                 advisory.Package,
+			ShortDescription:     sarifText{Text: valueOr(advisory.Summary, advisory.ID)},
+			HelpURI:              advisory.URL,
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(advisory.Severity)},
+			Properties: &sarifPropertyBag{
+				Tags:             []string{"security", "dependency"},
+				SecuritySeverity: advisorySecuritySeverity[advisory.Severity],
+			},
+		})
+		message := fmt.Sprintf("%s %s is affected by %s", advisory.Package, valueOr(advisory.InstalledVersion, "(unknown version)"), advisory.ID)
+		if advisory.FixedVersion != "" {
+			message += ", fixed in " + advisory.FixedVersion
+		}
+		b.results = append(b.results, sarifResult{
+			RuleID:    advisory.ID,
+			RuleIndex: ruleIndex,
+			Level:     sarifLevel(advisory.Severity),
+			Message:   sarifText{Text: message},
+		})
+	}
+}
+
+// patternRule returns the index of the rule of an error pattern and the level of its results:
+// those of the built-in error pattern rule it matches, else those of the failure type
+func (b *sarifBuilder) patternRule(analysis *FailureAnalysisResult, pattern ErrorPattern) (int, string) {
+	matches := builtinErrorPatterns.matchingRules(pattern.Pattern, pattern.Description)
+	if len(matches) == 0 {
+		return b.failureTypeRule(analysis), sarifLevel(analysis.Classification.Severity)
+	}
+	match := matches[0]
+	rule := sarifRule{
+		ID:                   match.name,
+		Name:                 match.name,
+		ShortDescription:     sarifText{Text: valueOr(match.rule.Description, match.name)},
+		DefaultConfiguration: sarifConfiguration{Level: sarifLevel(match.rule.Severity)},
+		Help:                 sarifSolutions(match.rule.Solutions),
+		Properties:           &sarifPropertyBag{Tags: append([]string{string(match.rule.Type)}, match.rule.Tags...)},
+	}
+	return b.rule(rule), sarifLevel(match.rule.Severity)
+}
+
+// failureTypeRule returns the index of the rule of the analysis's failure type
+func (b *sarifBuilder) failureTypeRule(analysis *FailureAnalysisResult) int {
+	failureType := analysis.Classification.Type
+	if failureType == "" {
+		failureType = UnknownFailure
+	}
+	return b.rule(sarifRule{
+		ID:                   string(failureType) + "-failure",
+		ShortDescription:     sarifText{Text: fmt.Sprintf("%s failure found by the CI failure analysis", failureType)},
+		DefaultConfiguration: sarifConfiguration{Level: sarifLevel(analysis.Classification.Severity)},
+		Properties:           &sarifPropertyBag{Tags: []string{string(failureType)}},
+	})
+}
+
+// rule adds rule unless a rule with its ID was added before and returns its index
+func (b *sarifBuilder) rule(rule sarifRule) int {
+	if index, ok := b.rules[rule.ID]; ok {
+		return index
+	}
+	if rule.Properties != nil {
+		rule.Properties.Tags = mergeNames(nil, rule.Properties.Tags)
+		sort.Strings(rule.Properties.Tags)
+	}
+	b.rules[rule.ID] = len(b.ruleList)
+	b.ruleList = append(b.ruleList, rule)
+	return len(b.ruleList) - 1
+}
+
+// sarifSolutions renders the solutions of an error pattern rule as the help of its rule
+func sarifSolutions(solutions []string) *sarifText {
+	if len(solutions) == 0 {
+		return nil
+	}
+	var text, markdown bytes.Buffer
+	for i, solution := range solutions {
+		fmt.Fprintf(&text, "%d. %s\n", i+1, solution)
+		fmt.Fprintf(&markdown, "- %s\n", solution)
+	}
+	return &sarifText{Text: text.String(), Markdown: markdown.String()}
+}
+
+// sarifFileLocation returns the location of a repository file given as file, file:line or
+// file:line:column. Locations outside the repository, e.g. job:step, are not files.
+func sarifFileLocation(location string) (sarifLocation, bool) {
+	file, line, column := location, 0, 0
+	if match := sarifLocationPattern.FindStringSubmatch(location); match != nil {
+		file = match[1]
+		line, _ = strconv.Atoi(match[2])
+		column, _ = strconv.Atoi(match[3])
+	}
+	path, err := normalizeChangePath(file)
+	if err != nil || !(strings.Contains(path, "/") || contextPathPattern.MatchString(path)) {
+		return sarifLocation{}, false
+	}
+	physical := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: path}}
+	if line > 0 {
+		physical.Region = &sarifRegion{StartLine: line, StartColumn: column}
+	}
+	return sarifLocation{PhysicalLocation: physical}, true
+}
+
+// sarifLevel maps a severity to a SARIF result level
+func sarifLevel(severity SeverityLevel) string {
+	switch severity {
+	case Critical, High:
+		return "error"
+	case Low:
+		return "note"
+	default:
+		return "warning"
+	}
+}
+
+// encodeSARIF gzips and base64 encodes a SARIF log as the code scanning API expects it
+func encodeSARIF(sarif []byte) (string, error) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(sarif); err != nil {
+		return "", fmt.Errorf("failed to compress SARIF: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress SARIF: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(compressed.Bytes()), nil
+}
+
+// uploadSARIF uploads the analyses of a run to code scanning as the analysis of the failing
+// commit and returns the ID of the upload. Code scanning only shows the analysis, so failures
+// are logged and do not fail the fix.
+func (m *DaggerAutofix) uploadSARIF(ctx context.Context, runID int64, analyses []*FailureAnalysisResult) string {
+	if len(analyses) == 0 || analyses[0].Context.WorkflowRun == nil || analyses[0].Context.WorkflowRun.CommitSHA == "" {
+		m.logger.WithField("run_id", runID).Warn("Failing commit unknown, skipping the SARIF upload")
+		return ""
+	}
+	run := analyses[0].Context.WorkflowRun
+	logger := m.logger.WithFields(logrus.Fields{"run_id": runID, "commit_sha": run.CommitSHA})
+
+	sarif, err := sarifReport(analyses...)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to export the analysis as SARIF")
+		return ""
+	}
+	id, err := m.githubClient.UploadSARIF(ctx, run.CommitSHA, "refs/heads/"+run.Branch, sarif)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to upload the analysis to code scanning")
+		return ""
+	}
+	audit(ctx, AuditSARIFUploaded, map[string]interface{}{"commit_sha": run.CommitSHA, "sarif_id": id, "bytes": len(sarif)})
+	logger.WithField("sarif_id", id).Info("Uploaded the analysis to code scanning")
+	return id
+}
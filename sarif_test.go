@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validateSARIF validates a SARIF log against the SARIF 2.1.0 schema of the objects the
+// exporter writes
+func validateSARIF(t *testing.T, sarif []byte) error {
+	t.Helper()
+	data, err := os.ReadFile("testdata/sarif/sarif-2.1.0-subset.schema.json")
+	require.NoError(t, err)
+	var schema jsonschema.Schema
+	require.NoError(t, json.Unmarshal(data, &schema))
+	resolved, err := schema.Resolve(nil)
+	require.NoError(t, err)
+
+	var instance interface{}
+	require.NoError(t, json.Unmarshal(sarif, &instance))
+	return resolved.Validate(instance)
+}
+
+func sarifTestAnalysis() *FailureAnalysisResult {
+	return &FailureAnalysisResult{
+		ID:          "a1",
+		Fingerprint: "fp123",
+		Context:     FailureContext{WorkflowRun: &WorkflowRun{ID: 42, Name: "CI", Branch: "main", CommitSHA: "abc123"}},
+		Classification: FailureClassification{
+			Type:     BuildFailure,
+			Severity: High,
+		},
+		RootCause:     "the parser package does not compile",
+		AffectedFiles: []string{"parser/parser.go", "/workspace/parser/lexer.go"},
+		ErrorPatterns: []ErrorPattern{
+			{Pattern: "go build failed", Description: "undefined: Token", Location: "parser/parser.go:12:5"},
+			{Pattern: "exit status 2", Description: "compiler exited", Location: "build:compile"},
+		},
+		Advisories: []Advisory{{
+			ID: "GHSA-1234", Package: "golang.org/x/net", Severity: Critical, Summary: "HTTP/2 rapid reset",
+			InstalledVersion: "v0.1.0", FixedVersion: "v0.17.0", URL: "https://osv.dev/GHSA-1234",
+		}},
+	}
+}
+
+// TestToSARIF tests exporting an analysis as SARIF
+func TestToSARIF(t *testing.T) {
+	data, err := sarifTestAnalysis().ToSARIF()
+	require.NoError(t, err)
+	require.NoError(t, validateSARIF(t, data))
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(data, &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+	run := log.Runs[0]
+	assert.Equal(t, "dagger-autofix/CI/", run.AutomationDetails.ID)
+	for _, result := range run.Results {
+		assert.Equal(t, result.RuleID, run.Tool.Driver.Rules[result.RuleIndex].ID, "results refer to their rule by index")
+	}
+
+	results := run.Results
+	require.Len(t, results, 5)
+
+	assert.Equal(t, "build_failure", results[0].RuleID, "the pattern gets the built-in rule it matches")
+	assert.Equal(t, "undefined: Token", results[0].Message.Text)
+	require.Len(t, results[0].Locations, 1)
+	assert.Equal(t, sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{URI: "parser/parser.go"},
+		Region:           &sarifRegion{StartLine: 12, StartColumn: 5},
+	}, results[0].Locations[0].PhysicalLocation)
+	assert.Equal(t, map[string]string{"failureFingerprint/v1": "fp123"}, results[0].PartialFingerprints)
+
+	assert.Equal(t, "build-failure", results[1].RuleID, "unknown patterns get the failure type rule")
+	assert.Equal(t, "error", results[1].Level)
+	assert.Empty(t, results[1].Locations, "job:step locations are not files")
+
+	for i, file := range []string{"parser/parser.go", "parser/lexer.go"} {
+		result := results[2+i]
+		assert.Equal(t, "build-failure", result.RuleID)
+		assert.Equal(t, "the parser package does not compile", result.Message.Text)
+		require.Len(t, result.Locations, 1)
+		assert.Equal(t, file, result.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+		assert.Nil(t, result.Locations[0].PhysicalLocation.Region)
+	}
+
+	advisory := results[4]
+	assert.Equal(t, "GHSA-1234", advisory.RuleID)
+	assert.Equal(t, "error", advisory.Level)
+	assert.Equal(t, "golang.org/x/net v0.1.0 is affected by GHSA-1234, fixed in v0.17.0", advisory.Message.Text)
+	rule := run.Tool.Driver.Rules[advisory.RuleIndex]
+	assert.Equal(t, "9.5", rule.Properties.SecuritySeverity)
+	assert.Equal(t, []string{"dependency", "security"}, rule.Properties.Tags)
+	assert.Equal(t, "https://osv.dev/GHSA-1234", rule.HelpURI)
+
+	t.Run("NoFiles", func(t *testing.T) {
+		analysis := &FailureAnalysisResult{Classification: FailureClassification{Type: TestFailure, Severity: Low}, RootCause: "flaky test"}
+		data, err := analysis.ToSARIF()
+		require.NoError(t, err)
+		require.NoError(t, validateSARIF(t, data))
+		var log sarifLog
+		require.NoError(t, json.Unmarshal(data, &log))
+		require.Len(t, log.Runs[0].Results, 1, "the root cause is a result of the run")
+		assert.Equal(t, "note", log.Runs[0].Results[0].Level)
+		assert.Empty(t, log.Runs[0].Results[0].Locations)
+		assert.Nil(t, log.Runs[0].AutomationDetails)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		data, err := sarifReport()
+		require.NoError(t, err)
+		require.NoError(t, validateSARIF(t, data))
+	})
+
+	t.Run("SchemaRejectsInvalidLogs", func(t *testing.T) {
+		assert.Error(t, validateSARIF(t, bytes.Replace(data, []byte(`"version": "2.1.0"`), []byte(`"version": "2.0.0"`), 1)))
+		assert.Error(t, validateSARIF(t, bytes.Replace(data, []byte(`"level": "error"`), []byte(`"level": "fatal"`), 1)))
+		assert.Error(t, validateSARIF(t, bytes.Replace(data, []byte(`"startLine": 12`), []byte(`"startLine": 0`), 1)))
+	})
+}
+
+// TestSARIFFileLocation tests which error pattern locations are repository files
+func TestSARIFFileLocation(t *testing.T) {
+	tests := []struct {
+		location string
+		uri      string
+		region   *sarifRegion
+	}{
+		{"src/app.js:12", "src/app.js", &sarifRegion{StartLine: 12}},
+		{"main.go:3:7", "main.go", &sarifRegion{StartLine: 3, StartColumn: 7}},
+		{"./cmd/main.go", "cmd/main.go", nil},
+		{"test:unit", "", nil},
+		{"../outside.go:1", "", nil},
+		{"", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			location, ok := sarifFileLocation(tt.location)
+			assert.Equal(t, tt.uri != "", ok)
+			assert.Equal(t, tt.uri, location.PhysicalLocation.ArtifactLocation.URI)
+			assert.Equal(t, tt.region, location.PhysicalLocation.Region)
+		})
+	}
+}
+
+// TestEncodeSARIF tests that SARIF logs are gzipped and base64 encoded for upload
+func TestEncodeSARIF(t *testing.T) {
+	sarif := []byte(`{"version":"2.1.0","runs":[]}`)
+	encoded, err := encodeSARIF(sarif)
+	require.NoError(t, err)
+	compressed, err := base64.StdEncoding.DecodeString(encoded)
+	require.NoError(t, err)
+	reader, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, sarif, decoded)
+}
+
+// TestAutoFixSARIFUpload tests uploading the analysis to code scanning during AutoFix
+func TestAutoFixSARIFUpload(t *testing.T) {
+	ctx := context.Background()
+	type upload struct{ sha, ref string }
+	withUpload := func(err error) (*DaggerAutofix, *[]upload) {
+		m := fixtureAutofix(nil).WithSARIFUpload(true)
+		gh := m.githubClient.(*mockGitHub)
+		gh.getWorkflowRunFunc = func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+			return &WorkflowRun{ID: runID, Name: "CI", Branch: "feature", CommitSHA: "abc123"}, nil
+		}
+		uploads := new([]upload)
+		gh.uploadSARIFFunc = func(ctx context.Context, commitSHA, ref string, sarif []byte) (string, error) {
+			*uploads = append(*uploads, upload{commitSHA, ref})
+			if err != nil {
+				return "", err
+			}
+			if verr := validateSARIF(t, sarif); verr != nil {
+				t.Errorf("uploaded invalid SARIF: %v", verr)
+			}
+			return "sarif-1", nil
+		}
+		return m, uploads
+	}
+
+	t.Run("Uploaded", func(t *testing.T) {
+		m, uploads := withUpload(nil)
+		result, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Equal(t, []upload{{"abc123", "refs/heads/feature"}}, *uploads)
+		assert.Equal(t, "sarif-1", result.Metadata["sarif_id"])
+	})
+
+	t.Run("DryRun", func(t *testing.T) {
+		m, uploads := withUpload(nil)
+		result, err := m.WithDryRun(true).AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Empty(t, *uploads)
+		assert.NotContains(t, result.Metadata, "sarif_id")
+	})
+
+	t.Run("UploadFailureKeepsFix", func(t *testing.T) {
+		m, uploads := withUpload(errors.New("code scanning is not enabled"))
+		result, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.Len(t, *uploads, 1)
+		assert.NotContains(t, result.Metadata, "sarif_id")
+		assert.NotNil(t, result.PullRequest)
+	})
+}
@@ -388,7 +388,7 @@ func TestConfigurationValidation(t *testing.T) {
 				repoName:       "invalid/repo/name",
 				hasGitHubToken: true,
 				hasLLMKey:      true,
-				expectValid:    true, // Currently no validation, documents needed improvement
+				expectValid:    false,
 			},
 		}
 
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"dagger.io/dagger"
+	"github.com/sirupsen/logrus"
+)
+
+// minCommitPrefix is the shortest commit SHA prefix compared with a full SHA
+const minCommitPrefix = 7
+
+// sourceCommitCommand reads the commit checked out in the source directory. Shallow
+// checkouts resolve HEAD too, and the directory is trusted whoever owns it in the container.
+var sourceCommitCommand = []string{"git", "-c", "safe.directory=*", "rev-parse", "HEAD"}
+
+// SourceCommit returns the commit checked out in source. Sources without git metadata, e.g.
+// directories exported without .git, have none and return an error.
+func (e *TestEngine) SourceCommit(ctx context.Context, source *dagger.Directory) (string, error) {
+	if source == nil {
+		return "", fmt.Errorf("source directory is required")
+	}
+	_, output, err := e.sourceWorkspace(source).Exec(ctx, sourceCommitCommand)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the source commit: %w", err)
+	}
+	sha := strings.TrimSpace(output.Stdout)
+	if output.ExitCode != 0 || sha == "" {
+		return "", fmt.Errorf("source is not a git checkout: %s", valueOr(firstLine(output.Stderr), fmt.Sprintf("git exited with code %d", output.ExitCode)))
+	}
+	return sha, nil
+}
+
+// failedCommitContextKey carries the commit of the failed run through the fix pipeline
+type failedCommitContextKey struct{}
+
+// withFailedCommit records the commit the failure being fixed happened at
+func withFailedCommit(ctx context.Context, sha string) context.Context {
+	return context.WithValue(ctx, failedCommitContextKey{}, sha)
+}
+
+// failedCommit returns the commit the failure of ctx happened at, empty outside of fixes
+func failedCommit(ctx context.Context) string {
+	sha, _ := ctx.Value(failedCommitContextKey{}).(string)
+	return sha
+}
+
+// sourceCommit returns the commit of the source directory: the WithSourceCommit hint, or else
+// the checked out commit, read once
+func (m *DaggerAutofix) sourceCommit(ctx context.Context) (string, error) {
+	if m.SourceCommit != "" {
+		return m.SourceCommit, nil
+	}
+	m.sourceCommitMu.Lock()
+	defer m.sourceCommitMu.Unlock()
+	if m.sourceHead == nil {
+		sha, err := m.testEngine.SourceCommit(ctx, m.Source)
+		if err != nil {
+			return "", err
+		}
+		m.sourceHead = &sha
+	}
+	return *m.sourceHead, nil
+}
+
+// validatesOnSource tells whether fixes are validated against the source directory. Outside
+// of fixes of a failed run the source is used as given; fixes of a run only use it when it
+// holds the commit that failed, otherwise they are tested on a branch of the repository.
+func (m *DaggerAutofix) validatesOnSource(ctx context.Context, fix *ProposedFix) bool {
+	if m.Source == nil {
+		return false
+	}
+	failed := failedCommit(ctx)
+	if failed == "" {
+		return true
+	}
+
+	log := m.logger.WithFields(logrus.Fields{"fix_id": fix.ID, "failed_commit": shortSHA(failed)})
+	source, err := m.sourceCommit(ctx)
+	switch {
+	case err != nil:
+		log.WithError(err).Info("Source commit unknown, validating on a test branch instead of the source directory; set it with WithSourceCommit")
+		return false
+	case !sameCommit(source, failed):
+		log.WithField("source_commit", shortSHA(source)).Info("Source directory is not at the failed commit, validating on a test branch instead")
+		return false
+	}
+	return true
+}
+
+// sameCommit tells whether two SHAs name the same commit, either may be abbreviated
+func sameCommit(a, b string) bool {
+	a, b = strings.ToLower(strings.TrimSpace(a)), strings.ToLower(strings.TrimSpace(b))
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	if len(a) < minCommitPrefix && a != b {
+		return false
+	}
+	return a != "" && strings.HasPrefix(b, a)
+}
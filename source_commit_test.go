@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sourceSHA = "0123456789abcdef0123456789abcdef01234567"
+
+// sourceAutofix returns an agent with a source directory whose git metadata reports commit
+// head, and the test branches its validations push
+func sourceAutofix(head string) (*DaggerAutofix, *MockDaggerContainer, *[]string) {
+	provider := NewMockContainerProvider()
+	mock := provider.MockContainer
+	mock.FileSystem = map[string]string{"go.mod": "module test\n\ngo 1.22"}
+	if head == "" {
+		mock.CommandOutputs[strings.Join(sourceCommitCommand, " ")] = MockCommandResult{Stderr: "fatal: not a git repository (or any of the parent directories): .git", ExitCode: 128}
+	} else {
+		mock.CommandOutputs[strings.Join(sourceCommitCommand, " ")] = MockCommandResult{Stdout: head + "\n"}
+	}
+	engine := NewTestEngine(80, quietLogger())
+	engine.SetContainerProvider(provider)
+
+	branches := new([]string)
+	var mu sync.Mutex
+	gh := &mockGitHub{
+		createTestBranchFunc: func(ctx context.Context, branch string, changes []CodeChange) (func(), error) {
+			mu.Lock()
+			defer mu.Unlock()
+			*branches = append(*branches, branch)
+			return func() {}, nil
+		},
+	}
+	return &DaggerAutofix{
+		Source:       &dagger.Directory{},
+		githubClient: gh,
+		testEngine:   engine,
+		logger:       quietLogger(),
+		RepoOwner:    "acme",
+		RepoName:     "widgets",
+	}, mock, branches
+}
+
+// countExecs counts the commands run in the mock container
+func countExecs(mock *MockDaggerContainer, args []string) int {
+	count := 0
+	for _, executed := range mock.ExecHistory {
+		if strings.Join(executed, " ") == strings.Join(args, " ") {
+			count++
+		}
+	}
+	return count
+}
+
+// TestValidateFixOnSource tests validating fixes against the source directory only when it
+// holds the failed commit
+func TestValidateFixOnSource(t *testing.T) {
+	fix := &ProposedFix{ID: "1", Changes: []CodeChange{{FilePath: "main.go", Operation: ChangeOperationModify, NewContent: "package main"}}}
+
+	t.Run("MatchingCommit", func(t *testing.T) {
+		m, mock, branches := sourceAutofix(sourceSHA)
+		ctx := withFailedCommit(context.Background(), sourceSHA[:7])
+
+		for i := 0; i < 2; i++ {
+			_, err := m.ValidateFix(ctx, fix)
+			require.NoError(t, err)
+		}
+		assert.Empty(t, *branches)
+		assert.Contains(t, mock.Operations, "write:main.go")
+		assert.Equal(t, 1, countExecs(mock, sourceCommitCommand), "the source commit is read once")
+	})
+
+	t.Run("DifferentCommit", func(t *testing.T) {
+		m, mock, branches := sourceAutofix("fedcba9876543210fedcba9876543210fedcba98")
+		_, err := m.ValidateFix(withFailedCommit(context.Background(), sourceSHA), fix)
+		require.NoError(t, err)
+		assert.Len(t, *branches, 1)
+		assert.NotContains(t, mock.Operations, "write:main.go")
+	})
+
+	t.Run("NoGitMetadata", func(t *testing.T) {
+		m, _, branches := sourceAutofix("")
+		_, err := m.ValidateFix(withFailedCommit(context.Background(), sourceSHA), fix)
+		require.NoError(t, err)
+		assert.Len(t, *branches, 1)
+
+		// The hint stands in for the git metadata
+		m, mock, branches := sourceAutofix("")
+		m.WithSourceCommit(sourceSHA)
+		_, err = m.ValidateFix(withFailedCommit(context.Background(), sourceSHA), fix)
+		require.NoError(t, err)
+		assert.Empty(t, *branches)
+		assert.Zero(t, countExecs(mock, sourceCommitCommand))
+	})
+
+	t.Run("NoFailedCommit", func(t *testing.T) {
+		m, mock, branches := sourceAutofix("")
+		_, err := m.ValidateFix(context.Background(), fix)
+		require.NoError(t, err)
+		assert.Empty(t, *branches)
+		assert.Zero(t, countExecs(mock, sourceCommitCommand))
+	})
+}
+
+// TestSourceCommit tests reading the commit of a source directory
+func TestSourceCommit(t *testing.T) {
+	m, _, _ := sourceAutofix(sourceSHA)
+	sha, err := m.testEngine.SourceCommit(context.Background(), m.Source)
+	require.NoError(t, err)
+	assert.Equal(t, sourceSHA, sha)
+
+	m, _, _ = sourceAutofix("")
+	_, err = m.testEngine.SourceCommit(context.Background(), m.Source)
+	assert.ErrorContains(t, err, "source is not a git checkout: fatal: not a git repository")
+	_, err = m.testEngine.SourceCommit(context.Background(), nil)
+	assert.Error(t, err)
+}
+
+// TestSameCommit tests comparing full and abbreviated SHAs
+func TestSameCommit(t *testing.T) {
+	assert.True(t, sameCommit(sourceSHA, sourceSHA))
+	assert.True(t, sameCommit(sourceSHA[:7], sourceSHA))
+	assert.True(t, sameCommit(strings.ToUpper(sourceSHA), sourceSHA[:12]+"\n"))
+	assert.False(t, sameCommit(sourceSHA[:6], sourceSHA), "prefixes are at least 7 characters")
+	assert.False(t, sameCommit("fedcba9", sourceSHA))
+	assert.False(t, sameCommit("", sourceSHA))
+	assert.False(t, sameCommit("", ""))
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+)
+
+// testBranchPrefix starts the names of the temporary branches fixes are validated on
+const testBranchPrefix = "autofix-test-"
+
+// cleanupTimeout bounds cleanup such as deleting a branch, which runs detached from the fix's
+// context so it still happens when the fix is cancelled
+const cleanupTimeout = 30 * time.Second
+
+// cleanupContext returns a context for cleanup that must run after ctx is done. It keeps the
+// values of ctx, e.g. the audited run, but not its cancellation.
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+}
+
+// testBranchName returns the name of the test branch for the index-th of the fixes validated
+// together. Fix IDs are derived from the analysis and the changes, so validating the same fix
+// again reuses its branch. The index follows the ID, where truncating long IDs cannot drop it,
+// so fixes validated in parallel never share a branch.
+func testBranchName(fix *ProposedFix, index int) string {
+	var suffix string
+	if index > 0 {
+		suffix = fmt.Sprintf("-%d", index)
+	}
+	return branchName(testBranchPrefix, suffix, fix.ID)
+}
+
+// testBranchRegistry tracks the test branches of running fixes with the functions deleting
+// them, so shutdown can delete the branches of fixes that did not finish
+type testBranchRegistry struct {
+	mu       sync.Mutex
+	branches map[string]func()
+}
+
+// add registers a test branch and the function deleting it
+func (r *testBranchRegistry) add(branch string, cleanup func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.branches == nil {
+		r.branches = make(map[string]func())
+	}
+	r.branches[branch] = cleanup
+}
+
+// release deletes a registered test branch. It reports false when the branch was already
+// deleted, e.g. by shutdown.
+func (r *testBranchRegistry) release(branch string) bool {
+	r.mu.Lock()
+	cleanup, ok := r.branches[branch]
+	delete(r.branches, branch)
+	r.mu.Unlock()
+
+	if ok {
+		cleanup()
+	}
+	return ok
+}
+
+// releaseAll deletes every registered test branch and returns their names
+func (r *testBranchRegistry) releaseAll() []string {
+	r.mu.Lock()
+	branches := r.branches
+	r.branches = nil
+	r.mu.Unlock()
+
+	names := make([]string, 0, len(branches))
+	for name, cleanup := range branches {
+		cleanup()
+		names = append(names, name)
+	}
+	return names
+}
+
+// branchLister lists the repository's branches by name prefix
+type branchLister interface {
+	ListBranches(ctx context.Context, prefix string) ([]string, error)
+}
+
+// testBranchClient lists, dates and deletes the repository's test branches
+type testBranchClient interface {
+	branchLister
+	BranchUpdated(ctx context.Context, branch string) (time.Time, error)
+	DeleteBranch(ctx context.Context, branch string) error
+}
+
+// ListBranches returns the names of the repository's branches starting with prefix
+func (g *GitHubIntegration) ListBranches(ctx context.Context, prefix string) ([]string, error) {
+	if g.client == nil {
+		return nil, errGitHubNotInitialized
+	}
+	opts := &github.ReferenceListOptions{
+		Ref:         "heads/" + prefix,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var branches []string
+	for {
+		var refs []*github.Reference
+		var resp *github.Response
+		err := g.withRateLimit(ctx, func() (*github.Response, error) {
+			var err error
+			refs, resp, err = g.client.Git.ListMatchingRefs(ctx, g.repoOwner, g.repoName, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s branches: %w", prefix, err)
+		}
+
+		for _, ref := range refs {
+			branches = append(branches, strings.TrimPrefix(ref.GetRef(), "refs/heads/"))
+		}
+
+		if resp == nil || resp.NextPage == 0 {
+			return branches, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// BranchUpdated returns when the head commit of a branch was committed. The head of a test
+// branch is the commit of its last change, made when the branch was created.
+func (g *GitHubIntegration) BranchUpdated(ctx context.Context, branch string) (time.Time, error) {
+	if g.client == nil {
+		return time.Time{}, errGitHubNotInitialized
+	}
+	head, err := callGitHub(ctx, g, func() (*github.RepositoryCommit, *github.Response, error) {
+		return g.client.Repositories.GetCommit(ctx, g.repoOwner, g.repoName, "heads/"+branch, nil)
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get head commit of %s: %w", branch, err)
+	}
+	return head.GetCommit().GetCommitter().GetDate(), nil
+}
+
+// DeleteBranch deletes a branch of the repository
+func (g *GitHubIntegration) DeleteBranch(ctx context.Context, branch string) error {
+	if g.client == nil {
+		return errGitHubNotInitialized
+	}
+	err := g.withRateLimit(ctx, func() (*github.Response, error) {
+		return g.client.Git.DeleteRef(ctx, g.repoOwner, g.repoName, "heads/"+branch)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete branch %s: %w", branch, err)
+	}
+	return nil
+}
+
+// orphanedTestBranchAge is how old a test branch must be before startup deletes it. No fix
+// runs longer than FixTimeout plus the drain timeout, so older branches were left behind by
+// an agent that was killed.
+func (m *DaggerAutofix) orphanedTestBranchAge() time.Duration {
+	timeout := m.FixTimeout
+	if timeout <= 0 {
+		timeout = DefaultFixTimeout
+	}
+	return timeout + m.drainTimeout()
+}
+
+// deleteOrphanedTestBranches deletes the repository's test branches whose head commit is older
+// than orphanedTestBranchAge and returns their names
+func (m *DaggerAutofix) deleteOrphanedTestBranches(ctx context.Context) ([]string, error) {
+	client, ok := m.githubClient.(testBranchClient)
+	if !ok {
+		return nil, nil
+	}
+	branches, err := client.ListBranches(ctx, testBranchPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-m.orphanedTestBranchAge())
+	var deleted []string
+	for _, branch := range branches {
+		updated, err := client.BranchUpdated(ctx, branch)
+		if errors.Is(err, ErrGitHubNotFound) {
+			continue // deleted since it was listed
+		}
+		if err != nil {
+			return deleted, err
+		}
+		if updated.IsZero() || updated.After(cutoff) {
+			continue
+		}
+		if err := client.DeleteBranch(ctx, branch); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, branch)
+	}
+	return deleted, nil
+}
+
+// reconcileTestBranches deletes the test branches orphaned in every monitored repository by
+// a previous run of the agent
+func (m *DaggerAutofix) reconcileTestBranches(ctx context.Context) {
+	for _, agent := range m.agents() {
+		if ctx.Err() != nil {
+			return
+		}
+		deleted, err := agent.deleteOrphanedTestBranches(ctx)
+		for _, branch := range deleted {
+			agent.logger.WithField("branch", branch).Info("Deleted orphaned test branch")
+		}
+		if err != nil {
+			agent.logger.WithError(err).Warn("Failed to delete orphaned test branches")
+		}
+	}
+}
+
+// cleanupTestBranches deletes the test branches of fixes still running at shutdown
+func (m *DaggerAutofix) cleanupTestBranches() {
+	for _, agent := range m.agents() {
+		for _, branch := range agent.testBranches.releaseAll() {
+			agent.logger.WithField("branch", branch).Info("Deleted test branch of interrupted fix")
+		}
+	}
+}
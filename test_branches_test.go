@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTestBranchName tests that test branches are named after their fix and its index only,
+// so validating the same fix again reuses its branch
+func TestTestBranchName(t *testing.T) {
+	fix := &ProposedFix{ID: fixID("analysis-42-1a2b3c4d", 1, []CodeChange{{FilePath: "main.go", NewContent: "package main"}})}
+	branch := testBranchName(fix, 0)
+	assert.Regexp(t, `^autofix-test-analysis-42-1a2b3c4d-fix-1-[0-9a-f]{6}$`, branch)
+	assert.Equal(t, branch, testBranchName(&ProposedFix{ID: fix.ID}, 0))
+	assert.NoError(t, validateBranchName(branch))
+
+	assert.Equal(t, branch+"-2", testBranchName(fix, 2))
+	long := &ProposedFix{ID: strings.Repeat("analysis-42-1a2b3c4d-long-job-name-", 10)}
+	assert.NotEqual(t, testBranchName(long, 1), testBranchName(long, 2), "truncated IDs keep their index")
+}
+
+// TestMonitorWorkflowsCleansUpTestBranchesOnShutdown tests that cancelling monitoring while a
+// fix is being validated cancels the fix after the drain timeout and deletes its test branch
+func TestMonitorWorkflowsCleansUpTestBranchesOnShutdown(t *testing.T) {
+	var prFixes []*FixValidationResult
+	m := fixtureAutofix(&prFixes).WithDrainTimeout(20 * time.Millisecond)
+	m.Source = nil
+
+	var mu sync.Mutex
+	var created, deleted []string
+	gh := m.githubClient.(*mockGitHub)
+	gh.getFailedWorkflowRunsFunc = func(ctx context.Context) ([]*WorkflowRun, error) {
+		return []*WorkflowRun{{ID: 9}}, nil
+	}
+	gh.createTestBranchFunc = func(ctx context.Context, branch string, changes []CodeChange) (func(), error) {
+		mu.Lock()
+		defer mu.Unlock()
+		created = append(created, branch)
+		return func() {
+			mu.Lock()
+			defer mu.Unlock()
+			deleted = append(deleted, branch)
+		}, nil
+	}
+	validating := make(chan struct{})
+	m.testEngine.(*mockTestEngine).runTestsFunc = func(ctx context.Context, owner, repo, branch string) (*TestResult, error) {
+		close(validating)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	oldTicker := newTicker
+	newTicker = func(d time.Duration) *time.Ticker {
+		return time.NewTicker(time.Millisecond)
+	}
+	t.Cleanup(func() { newTicker = oldTicker })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.MonitorWorkflows(ctx) }()
+
+	select {
+	case <-validating:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fix validation did not start")
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("MonitorWorkflows did not return after the drain timeout")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, created, 1)
+	assert.Equal(t, created, deleted)
+	assert.Empty(t, m.testBranches.releaseAll())
+	assert.Empty(t, prFixes)
+}
+
+// TestCleanupTestBranches tests that the shutdown hook deletes the test branches of fixes
+// that are still running, and only once
+func TestCleanupTestBranches(t *testing.T) {
+	m := &DaggerAutofix{logger: quietLogger()}
+	deletions := make(map[string]int)
+	for _, branch := range []string{"autofix-test-a-1", "autofix-test-b-2"} {
+		branch := branch
+		m.testBranches.add(branch, func() { deletions[branch]++ })
+	}
+
+	m.cleanupTestBranches()
+	assert.Equal(t, map[string]int{"autofix-test-a-1": 1, "autofix-test-b-2": 1}, deletions)
+	assert.False(t, m.testBranches.release("autofix-test-a-1"), "the fix finishing later does not delete it again")
+	assert.Equal(t, 1, deletions["autofix-test-a-1"])
+}
+
+// TestDeleteOrphanedTestBranches tests that startup deletes test branches whose head commit is
+// older than the fix and drain timeouts and keeps recent ones
+func TestDeleteOrphanedTestBranches(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+	old := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	recent := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	mux.HandleFunc("/repos/owner/repo/git/matching-refs/heads/autofix-test-", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s?page=2>; rel="next"`, r.URL.Path))
+			fmt.Fprint(w, `[{"ref": "refs/heads/autofix-test-fix-1"}, {"ref": "refs/heads/autofix-test-fix-2"}]`)
+			return
+		}
+		fmt.Fprint(w, `[{"ref": "refs/heads/autofix-test-gone"}, {"ref": "refs/heads/autofix-test-fix-3"}]`)
+	})
+	committed := map[string]string{"autofix-test-fix-1": old, "autofix-test-fix-2": recent, "autofix-test-fix-3": old}
+	mux.HandleFunc("/repos/owner/repo/commits/heads/", func(w http.ResponseWriter, r *http.Request) {
+		date, ok := committed[strings.TrimPrefix(r.URL.Path, "/repos/owner/repo/commits/heads/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message": "No commit found for SHA"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"commit": {"committer": {"date": %q}}}`, date)
+	})
+	var deleted []string
+	mux.HandleFunc("/repos/owner/repo/git/refs/heads/", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		deleted = append(deleted, r.URL.Path[len("/repos/owner/repo/git/refs/heads/"):])
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	m := &DaggerAutofix{githubClient: gh, logger: quietLogger(), FixTimeout: DefaultFixTimeout}
+	assert.Equal(t, DefaultFixTimeout+DefaultDrainTimeout, m.orphanedTestBranchAge())
+	removed, err := m.deleteOrphanedTestBranches(context.Background())
+	require.NoError(t, err)
+
+	want := []string{"autofix-test-fix-1", "autofix-test-fix-3"}
+	assert.Equal(t, want, removed)
+	sort.Strings(deleted)
+	assert.Equal(t, want, deleted)
+
+	_, err = (&DaggerAutofix{githubClient: &mockGitHub{}}).deleteOrphanedTestBranches(context.Background())
+	assert.NoError(t, err, "clients that cannot list branches are skipped")
+}
+
+// TestTestBranchCleanupAfterCancellation tests that the cleanup returned by CreateTestBranch
+// still deletes the branch once the context it was created with is cancelled
+func TestTestBranchCleanupAfterCancellation(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+	gh.SetTargetBranch("main")
+	mux.HandleFunc("/repos/owner/repo/git/ref/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ref":"refs/heads/main","object":{"sha":"abc123"}}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ref":"refs/heads/autofix-test-fix-1"}`)
+	})
+	var deleted string
+	mux.HandleFunc("/repos/owner/repo/git/refs/heads/", func(w http.ResponseWriter, r *http.Request) {
+		deleted = r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cleanup, err := gh.CreateTestBranch(ctx, "autofix-test-fix-1", nil)
+	require.NoError(t, err)
+	cancel()
+	cleanup()
+	assert.Equal(t, "/repos/owner/repo/git/refs/heads/autofix-test-fix-1", deleted)
+}
+
+// TestValidateFixCancelledDeletesTestBranch tests that a fix cancelled while its tests run
+// still deletes its test branch, although the context the branch was created with is done
+func TestValidateFixCancelledDeletesTestBranch(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+	gh.SetTargetBranch("main")
+	mux.HandleFunc("/repos/owner/repo/git/ref/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ref":"refs/heads/main","object":{"sha":"abc123"}}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ref":"refs/heads/autofix-test-fix-1"}`)
+	})
+	deleted := make(chan string, 1)
+	mux.HandleFunc("/repos/owner/repo/git/refs/heads/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			deleted <- r.URL.Path
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := &DaggerAutofix{
+		githubClient: gh,
+		testEngine: &mockTestEngine{
+			runTestsFunc: func(ctx context.Context, owner, repo, branch string) (*TestResult, error) {
+				cancel()
+				return nil, ctx.Err()
+			},
+		},
+		logger: quietLogger(),
+	}
+
+	_, err := m.ValidateFix(ctx, &ProposedFix{ID: "fix-1"})
+	assert.ErrorIs(t, err, context.Canceled)
+	select {
+	case path := <-deleted:
+		assert.Equal(t, "/repos/owner/repo/git/refs/heads/autofix-test-fix-1", path)
+	default:
+		t.Fatal("the test branch was not deleted")
+	}
+	assert.Empty(t, m.testBranches.releaseAll(), "the branch is no longer registered for shutdown")
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+
+	"dagger.io/dagger"
+	"gopkg.in/yaml.v3"
+)
+
+// testConfigFile overrides the test container recipe of a repository. It is read from the
+// repository root before frameworks are detected.
+const testConfigFile = ".github-autofix-test.yml"
+
+// testContainerConfig is the container recipe a repository's test config file overrides.
+// Top-level settings apply to every detected framework, and the frameworks section to the
+// framework of that name, e.g.
+//
+//	image: golang:1.23
+//	setup:
+//	  - apt-get update && apt-get install -y protobuf-compiler
+//	env:
+//	  GOFLAGS: -mod=mod
+//	commands:
+//	  test: go test -json -race ./...
+//	frameworks:
+//	  nodejs:
+//	    image: node:22
+type testContainerConfig struct {
+	Image         string                         `yaml:"image"`
+	SetupCommands []string                       `yaml:"setup"`
+	Env           map[string]string              `yaml:"env"`
+	Commands      testCommandOverrides           `yaml:"commands"`
+	Frameworks    map[string]testContainerConfig `yaml:"frameworks"`
+}
+
+// testCommandOverrides replace a framework's pipeline commands; empty ones keep the default
+type testCommandOverrides struct {
+	Test     string `yaml:"test"`
+	Build    string `yaml:"build"`
+	Lint     string `yaml:"lint"`
+	Coverage string `yaml:"coverage"`
+}
+
+// parseTestContainerConfig parses a test config file, rejecting unknown keys and frameworks
+// so typos do not silently keep the defaults
+func parseTestContainerConfig(content string, frameworks map[string]*TestFramework) (*testContainerConfig, error) {
+	decoder := yaml.NewDecoder(bytes.NewBufferString(content))
+	decoder.KnownFields(true)
+
+	var config testContainerConfig
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid %s: %w", testConfigFile, err)
+	}
+	for name, override := range config.Frameworks {
+		if _, ok := frameworks[name]; !ok {
+			return nil, fmt.Errorf("invalid %s: unknown framework %q", testConfigFile, name)
+		}
+		if len(override.Frameworks) > 0 {
+			return nil, fmt.Errorf("invalid %s: frameworks cannot be nested in framework %q", testConfigFile, name)
+		}
+	}
+	return &config, nil
+}
+
+// apply overrides the container recipe and commands of framework
+func (c *testContainerConfig) apply(framework *TestFramework) {
+	if c.Image != "" {
+		framework.Image = c.Image
+	}
+	framework.SetupCommands = append(framework.SetupCommands, c.SetupCommands...)
+	for key, value := range c.Env {
+		framework.Environment[key] = value
+	}
+	if c.Commands.Test != "" {
+		framework.TestCommand = c.Commands.Test
+	}
+	if c.Commands.Build != "" {
+		framework.BuildCommand = c.Commands.Build
+	}
+	if c.Commands.Lint != "" {
+		framework.LintCommand = c.Commands.Lint
+	}
+	if c.Commands.Coverage != "" {
+		framework.CoverageCommand = c.Commands.Coverage
+	}
+}
+
+// WithContainerImage runs every framework's pipeline in image instead of its toolchain
+// image, e.g. a corporate image with all toolchains and CA certificates installed
+func (e *TestEngine) WithContainerImage(image string) *TestEngine {
+	e.containerImage = image
+	return e
+}
+
+// WithContainerEnv sets environment variables in every test container, e.g. HTTP_PROXY
+func (e *TestEngine) WithContainerEnv(env map[string]string) *TestEngine {
+	e.containerEnv = env
+	return e
+}
+
+// WithContainerSecrets exposes secrets, e.g. private registry tokens, as environment
+// variables of every test container without writing them in plaintext. They are the only
+// secrets the repository's commands see; the GitHub token never reaches them.
+func (e *TestEngine) WithContainerSecrets(secrets map[string]*dagger.Secret) *TestEngine {
+	e.containerSecrets = secrets
+	return e
+}
+
+// loadTestContainerConfig reads the repository's test config file from the workspace, nil
+// when the repository has none
+func (e *TestEngine) loadTestContainerConfig(ctx context.Context, workspace ContainerInterface) (*testContainerConfig, error) {
+	content, found, err := readWorkspaceFile(ctx, workspace, testConfigFile)
+	if err != nil || !found {
+		return nil, err
+	}
+	config, err := parseTestContainerConfig(content, e.testFrameworks)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.checkPublishCommands(config); err != nil {
+		return nil, err
+	}
+	e.logger.WithField("file", testConfigFile).Info("Using repository test container config")
+	return config, nil
+}
+
+// configureFrameworks returns copies of the detected frameworks with the engine's container
+// settings applied, then the repository's config file, which takes precedence
+func (e *TestEngine) configureFrameworks(frameworks []*TestFramework, config *testContainerConfig) []*TestFramework {
+	configured := make([]*TestFramework, 0, len(frameworks))
+	for _, base := range frameworks {
+		framework := *base
+		framework.SetupCommands = slices.Clone(base.SetupCommands)
+		framework.Environment = make(map[string]string, len(base.Environment)+len(e.containerEnv))
+		for key, value := range base.Environment {
+			framework.Environment[key] = value
+		}
+
+		if e.containerImage != "" {
+			framework.Image = e.containerImage
+		}
+		for key, value := range e.containerEnv {
+			framework.Environment[key] = value
+		}
+		if config != nil {
+			config.apply(&framework)
+			if override, ok := config.Frameworks[framework.Name]; ok {
+				override.apply(&framework)
+			}
+		}
+		framework.Environment = e.withoutCredentials(framework.Environment, framework.Name+" environment")
+		configured = append(configured, &framework)
+	}
+	return configured
+}
+
+// prepareContainer sets the framework's environment and the engine's secrets in container
+// and runs the framework's setup commands. Credential variables of the image are unset, and
+// the network is cut off before the setup commands under the none policy, after them under
+// the restricted one.
+func (e *TestEngine) prepareContainer(container ContainerInterface, framework *TestFramework) ContainerInterface {
+	container = withoutCredentialEnv(container)
+	for _, key := range sortedKeys(framework.Environment) {
+		container = container.WithEnvVariable(key, framework.Environment[key])
+	}
+	if e.network == TestNetworkNone {
+		container = withOfflineEnv(container)
+	}
+	for _, name := range sortedKeys(e.containerSecrets) {
+		container = container.WithSecretVariable(name, e.containerSecrets[name])
+	}
+	for _, command := range framework.SetupCommands {
+		container = container.WithExec([]string{"sh", "-c", command})
+	}
+	if e.network == TestNetworkRestricted {
+		container = withOfflineEnv(container)
+	}
+	return container
+}
+
+// readWorkspaceFile returns the content of a file in the workspace and whether it exists
+func readWorkspaceFile(ctx context.Context, workspace ContainerInterface, name string) (string, bool, error) {
+	content, err := workspace.File(name).Contents(ctx)
+	if err == nil {
+		return content, true, nil
+	}
+	// Reading fails for missing files too, which are told apart by listing their directory
+	entries, listErr := workspace.Directory(path.Dir(name)).Entries(ctx)
+	if listErr != nil || !slices.Contains(entries, path.Base(name)) {
+		return "", false, nil
+	}
+	return "", false, fmt.Errorf("failed to read %s: %w", name, err)
+}
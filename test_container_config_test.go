@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseTestContainerConfig tests parsing the per-repository test config file
+func TestParseTestContainerConfig(t *testing.T) {
+	frameworks := loadTestFrameworks()
+
+	config, err := parseTestContainerConfig(`
+image: golang:1.23
+setup:
+  - update-ca-certificates
+env:
+  GOFLAGS: -mod=mod
+commands:
+  test: go test -json -race ./...
+frameworks:
+  nodejs:
+    image: node:22
+`, frameworks)
+	require.NoError(t, err)
+	assert.Equal(t, "golang:1.23", config.Image)
+	assert.Equal(t, []string{"update-ca-certificates"}, config.SetupCommands)
+	assert.Equal(t, map[string]string{"GOFLAGS": "-mod=mod"}, config.Env)
+	assert.Equal(t, "go test -json -race ./...", config.Commands.Test)
+	assert.Equal(t, "node:22", config.Frameworks["nodejs"].Image)
+
+	config, err = parseTestContainerConfig("", frameworks)
+	require.NoError(t, err)
+	assert.Empty(t, config.Image)
+
+	_, err = parseTestContainerConfig("images: golang:1.23\n", frameworks)
+	assert.ErrorContains(t, err, "invalid .github-autofix-test.yml")
+	_, err = parseTestContainerConfig("frameworks:\n  go:\n    image: golang:1.23\n", frameworks)
+	assert.ErrorContains(t, err, `unknown framework "go"`)
+	_, err = parseTestContainerConfig("setup: apt-get install -y jq\n", frameworks)
+	assert.Error(t, err, "setup is a list of commands")
+}
+
+// TestRunTestsContainerOverrides tests that the repository's test config file wins over the
+// engine's container settings, which win over the built-in framework defaults
+func TestRunTestsContainerOverrides(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	goMock := func(config string) *MockContainerProvider {
+		mockProvider := NewMockContainerProvider()
+		mockProvider.MockContainer.FileSystem = map[string]string{"go.mod": "module test\n\ngo 1.23"}
+		if config != "" {
+			mockProvider.MockContainer.FileSystem[testConfigFile] = config
+		}
+		return mockProvider
+	}
+	engine := func(mockProvider *MockContainerProvider) *TestEngine {
+		engine := NewTestEngine(0, logger).
+			WithContainerImage("registry.corp.example/toolchains:2024").
+			WithContainerEnv(map[string]string{"HTTPS_PROXY": "http://proxy.corp.example:3128", "GOFLAGS": "-mod=vendor"}).
+			WithContainerSecrets(map[string]*dagger.Secret{"GOPRIVATE_TOKEN": {}})
+		engine.SetContainerProvider(mockProvider)
+		return engine
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		mockProvider := goMock("")
+		e := NewTestEngine(0, logger)
+		e.SetContainerProvider(mockProvider)
+
+		_, err := e.RunTests(context.Background(), "owner", "repo", "main")
+		require.NoError(t, err)
+		assert.Equal(t, "golang:1.22", mockProvider.MockContainer.BaseImage)
+		assert.Empty(t, mockProvider.MockContainer.SecretVars)
+	})
+
+	t.Run("Engine", func(t *testing.T) {
+		mockProvider := goMock("")
+		mock := mockProvider.MockContainer
+
+		_, err := engine(mockProvider).RunTests(context.Background(), "owner", "repo", "main")
+		require.NoError(t, err)
+		assert.Equal(t, "registry.corp.example/toolchains:2024", mock.BaseImage)
+		assert.Equal(t, "http://proxy.corp.example:3128", mock.EnvVars["HTTPS_PROXY"])
+		assert.Equal(t, "-mod=vendor", mock.EnvVars["GOFLAGS"])
+		assert.Equal(t, []string{"GOPRIVATE_TOKEN"}, mock.SecretVars)
+		assert.NotContains(t, mock.EnvVars, "GOPRIVATE_TOKEN", "secrets are not plaintext variables")
+		assert.Contains(t, mock.ExecHistory, []string{"go", "test", "-json", "./..."})
+	})
+
+	t.Run("RepositoryConfig", func(t *testing.T) {
+		mockProvider := goMock(`
+image: golang:1.23
+setup:
+  - cp /workspace/certs/corp.crt /usr/local/share/ca-certificates/ && update-ca-certificates
+env:
+  GOFLAGS: -mod=mod
+commands:
+  test: go test -json -race ./...
+frameworks:
+  golang:
+    setup:
+      - go install gotest.tools/gotestsum@latest
+`)
+		mock := mockProvider.MockContainer
+
+		e := engine(mockProvider)
+		_, err := e.RunTests(context.Background(), "owner", "repo", "main")
+		require.NoError(t, err)
+		assert.Equal(t, "golang:1.23", mock.BaseImage)
+		assert.Equal(t, "-mod=mod", mock.EnvVars["GOFLAGS"])
+		assert.Equal(t, "http://proxy.corp.example:3128", mock.EnvVars["HTTPS_PROXY"], "unset variables keep the engine's")
+		assert.Equal(t, []string{"GOPRIVATE_TOKEN"}, mock.SecretVars)
+
+		certsIdx := slices.Index(mock.Operations, "exec:sh -c cp /workspace/certs/corp.crt /usr/local/share/ca-certificates/ && update-ca-certificates")
+		gotestsumIdx := slices.Index(mock.Operations, "exec:sh -c go install gotest.tools/gotestsum@latest")
+		testIdx := slices.Index(mock.Operations, "exec:go test -json -race ./...")
+		require.NotEqual(t, -1, certsIdx)
+		assert.Less(t, slices.Index(mock.Operations, "directory:/workspace"), certsIdx, "setup runs in the workspace")
+		assert.Less(t, certsIdx, gotestsumIdx)
+		assert.Less(t, gotestsumIdx, testIdx)
+		assert.NotContains(t, mock.ExecHistory, []string{"go", "test", "-json", "./..."})
+
+		// The built-in frameworks are left unchanged for later runs
+		assert.Equal(t, "golang:1.22", e.testFrameworks["golang"].Image)
+		assert.Empty(t, e.testFrameworks["golang"].SetupCommands)
+		assert.NotContains(t, e.testFrameworks["golang"].Environment, "GOFLAGS")
+	})
+
+	t.Run("DetectFrameworks", func(t *testing.T) {
+		mockProvider := goMock("frameworks:\n  golang:\n    commands:\n      lint: golangci-lint run\n")
+
+		frameworks, err := engine(mockProvider).DetectFrameworks(context.Background(), &dagger.Directory{})
+		require.NoError(t, err)
+		require.Len(t, frameworks, 1)
+		assert.Equal(t, "golangci-lint run", frameworks[0].LintCommand)
+		assert.Equal(t, "registry.corp.example/toolchains:2024", frameworks[0].Image)
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		mockProvider := goMock("image: [golang]\n")
+
+		_, err := engine(mockProvider).RunTests(context.Background(), "owner", "repo", "main")
+		assert.ErrorContains(t, err, "invalid .github-autofix-test.yml")
+	})
+}
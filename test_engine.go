@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"dagger.io/dagger"
 	"github.com/sirupsen/logrus"
 )
 
@@ -17,6 +21,120 @@ type TestEngine struct {
 	testFrameworks    map[string]*TestFramework
 	coverageTools     map[string]*CoverageTool
 	containerProvider ContainerProvider // Add this field
+	githubToken       *dagger.Secret    // used to clone private repositories
+	timeouts          TestTimeouts
+	testPaths         []string           // when set, only frameworks detected in these directories run
+	cacheDisabled     bool               // skips dependency cache volumes for reproducible runs
+	requireCoverage   bool               // fails runs whose coverage could not be measured
+	repository        string             // owner/repo scoping cache volumes for local runs
+	llmClient         LLMClientInterface // generates tests for fixes
+	prompts           *PromptTemplates   // renders the test generation system prompt
+	containerImage    string             // replaces every framework's toolchain image when set
+	containerEnv      map[string]string  // set in every test container
+	containerSecrets  map[string]*dagger.Secret
+	network           TestNetwork // network policy of the repository's commands
+	publishAllowed    bool        // lets repository commands publish packages
+
+	// githubTokenSource mints a token per clone under GitHub App auth, in place of githubToken
+	githubTokenSource func(ctx context.Context) (*dagger.Secret, error)
+	// githubURL is the scheme and host repositories are cloned from, github.com when empty
+	githubURL string
+}
+
+// Test pipeline stages, as reported in TestResult.Details["stage"]
+const (
+	stageLint     = "lint"
+	stageBuild    = "build"
+	stageTest     = "test"
+	stageCoverage = "coverage"
+	stageWorkflow = "workflow" // actionlint and schema checks of changed workflow files
+)
+
+// TestTimeouts bounds how long each test pipeline stage may run
+type TestTimeouts struct {
+	Lint     time.Duration `json:"lint"`
+	Build    time.Duration `json:"build"`
+	Test     time.Duration `json:"test"`
+	Coverage time.Duration `json:"coverage"`
+	Workflow time.Duration `json:"workflow"`
+}
+
+// DefaultTestTimeouts returns the stage timeouts used when none are configured
+func DefaultTestTimeouts() TestTimeouts {
+	return TestTimeouts{
+		Lint:     5 * time.Minute,
+		Build:    15 * time.Minute,
+		Test:     30 * time.Minute,
+		Coverage: 15 * time.Minute,
+		Workflow: 2 * time.Minute,
+	}
+}
+
+// withDefaults fills unset stages with the default timeouts
+func (t TestTimeouts) withDefaults() TestTimeouts {
+	defaults := DefaultTestTimeouts()
+	if t.Lint <= 0 {
+		t.Lint = defaults.Lint
+	}
+	if t.Build <= 0 {
+		t.Build = defaults.Build
+	}
+	if t.Test <= 0 {
+		t.Test = defaults.Test
+	}
+	if t.Coverage <= 0 {
+		t.Coverage = defaults.Coverage
+	}
+	if t.Workflow <= 0 {
+		t.Workflow = defaults.Workflow
+	}
+	return t
+}
+
+// forSteps applies the timeout of any validation step whose command matches a stage's command
+func (t TestTimeouts) forSteps(framework *TestFramework, steps []ValidationStep) TestTimeouts {
+	for _, step := range steps {
+		if step.Timeout <= 0 {
+			continue
+		}
+		switch step.Command {
+		case "":
+		case framework.LintCommand:
+			t.Lint = step.Timeout
+		case framework.BuildCommand:
+			t.Build = step.Timeout
+		case framework.TestCommand:
+			t.Test = step.Timeout
+		case framework.CoverageCommand:
+			t.Coverage = step.Timeout
+		}
+	}
+	return t
+}
+
+// stageTimeoutError reports a pipeline stage that exceeded its timeout
+type stageTimeoutError struct {
+	stage   string
+	timeout time.Duration
+}
+
+func (e *stageTimeoutError) Error() string {
+	return fmt.Sprintf("timed out in %s after %v", e.stage, e.timeout)
+}
+
+// runStage runs a pipeline stage under its own timeout, reporting deadline exceedance as a
+// stageTimeoutError. Cancellation of the parent ctx is returned unchanged. The stage start
+// is reported to the progress func of the run in ctx.
+func runStage[T any](ctx context.Context, stage string, timeout time.Duration, run func(ctx context.Context) (T, error)) (T, error) {
+	reportStep(ctx, stage)
+	stageCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result, err := run(stageCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(stageCtx.Err(), context.DeadlineExceeded) {
+		return result, &stageTimeoutError{stage: stage, timeout: timeout}
+	}
+	return result, err
 }
 
 // TestFramework defines testing capabilities for a specific language/framework
@@ -30,6 +148,20 @@ type TestFramework struct {
 	LintCommand     string            `json:"lint_command"`
 	ConfigFiles     []string          `json:"config_files"`
 	Environment     map[string]string `json:"environment"`
+	ReportPaths     []string          `json:"report_paths"`              // JUnit XML reports written by the test command, may be globs
+	CoverageReport  string            `json:"coverage_report,omitempty"` // coverage report written by the coverage command, parsed instead of its output
+	Path            string            `json:"path,omitempty"`            // directory the framework was detected in, relative to the repository root
+	Image           string            `json:"image"`                     // toolchain image the pipeline runs in
+	CacheVolumes    map[string]string `json:"cache_volumes"`             // dependency cache mount path -> cache volume name
+
+	// CoverageArtifacts are the coverage report files kept on the test result, rendered by
+	// CoverageReportCommand after the coverage command when set
+	CoverageArtifacts     []string `json:"coverage_artifacts,omitempty"`
+	CoverageReportCommand string   `json:"coverage_report_command,omitempty"`
+
+	// SetupCommands run in the toolchain container before the pipeline, e.g. to install
+	// system packages or CA certificates the image lacks
+	SetupCommands []string `json:"setup_commands,omitempty"`
 }
 
 // CoverageTool defines coverage analysis capabilities
@@ -57,16 +189,122 @@ func NewTestEngine(minCoverage int, logger *logrus.Logger) *TestEngine {
 		testFrameworks:    loadTestFrameworks(),
 		coverageTools:     loadCoverageTools(),
 		containerProvider: &RealContainerProvider{}, // Default to real implementation
+		timeouts:          DefaultTestTimeouts(),
 	}
 }
 
+// WithTestTimeouts overrides the per-stage timeouts; unset stages keep their defaults
+func (e *TestEngine) WithTestTimeouts(timeouts TestTimeouts) *TestEngine {
+	e.timeouts = timeouts.withDefaults()
+	return e
+}
+
+// WithTestPaths restricts test runs to the frameworks detected in the given directories,
+// relative to the repository root ("." is the root itself)
+func (e *TestEngine) WithTestPaths(paths ...string) *TestEngine {
+	e.testPaths = paths
+	return e
+}
+
+// WithTestCache enables or disables the dependency cache volumes shared between test runs.
+// Caching is enabled by default; disable it when every run must start from a clean state.
+func (e *TestEngine) WithTestCache(enabled bool) *TestEngine {
+	e.cacheDisabled = !enabled
+	return e
+}
+
+// WithRequireCoverage fails runs whose coverage could not be measured. By default such runs
+// succeed when their tests pass, since a missing coverage tool says nothing about the code.
+func (e *TestEngine) WithRequireCoverage(required bool) *TestEngine {
+	e.requireCoverage = required
+	return e
+}
+
+// SetRepository scopes the dependency caches of local test runs to a repository
+func (e *TestEngine) SetRepository(owner, repo string) {
+	e.repository = owner + "/" + repo
+}
+
 // SetContainerProvider allows injecting mock provider for testing
 func (e *TestEngine) SetContainerProvider(provider ContainerProvider) {
 	e.containerProvider = provider
 }
 
+// SetLLMClient configures the LLM used to generate tests for fixes
+func (e *TestEngine) SetLLMClient(client LLMClientInterface) {
+	e.llmClient = client
+}
+
+// SetPromptTemplates sets the templates the test generation system prompt is rendered from;
+// nil uses the built-in templates
+func (e *TestEngine) SetPromptTemplates(prompts *PromptTemplates) {
+	e.prompts = prompts
+}
+
+// SetGitHubToken configures the token used to clone private repositories in the remote-branch path
+func (e *TestEngine) SetGitHubToken(token *dagger.Secret) {
+	e.githubToken = token
+}
+
+// SetGitHubTokenSource configures a source of short-lived tokens, such as GitHub App
+// installation tokens, asked for a token on each clone; it takes precedence over the token
+// set with SetGitHubToken
+func (e *TestEngine) SetGitHubTokenSource(source func(ctx context.Context) (*dagger.Secret, error)) {
+	e.githubTokenSource = source
+}
+
+// SetGitHubURL configures the scheme and host repositories are cloned from, e.g. the host of
+// a GitHub Enterprise Server instance; empty clones from github.com
+func (e *TestEngine) SetGitHubURL(webURL string) {
+	e.githubURL = strings.TrimRight(webURL, "/")
+}
+
+// RunTestsWithChanges runs the test pipeline against source with changes applied inside the
+// container, so fixes can be validated without pushing a branch. Validation steps whose
+// command matches a pipeline stage override that stage's timeout.
+func (e *TestEngine) RunTestsWithChanges(ctx context.Context, source *dagger.Directory, changes []CodeChange, steps ...ValidationStep) (*TestResult, error) {
+	start := time.Now()
+	e.logger.WithField("changes", len(changes)).Info("Starting local test execution")
+
+	if source == nil {
+		return nil, fmt.Errorf("source directory is required")
+	}
+
+	testContainer, err := e.applyChanges(e.sourceWorkspace(source), changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply changes: %w", err)
+	}
+
+	// Broken workflow files are rejected before the expensive test run
+	if rejected := e.validateWorkflowChanges(ctx, testContainer, changes, steps, start); rejected != nil {
+		e.logger.WithFields(logrus.Fields{
+			"files":    rejected.Details["workflow_files"],
+			"problems": len(rejected.Errors),
+		}).Warn("Workflow changes rejected")
+		return rejected, nil
+	}
+
+	return e.runPipeline(ctx, testContainer, e.repository, start, steps)
+}
+
+// DetectFrameworks returns the frameworks the test pipeline would run for source
+func (e *TestEngine) DetectFrameworks(ctx context.Context, source *dagger.Directory) ([]*TestFramework, error) {
+	if source == nil {
+		return nil, fmt.Errorf("source directory is required")
+	}
+	return e.pipelineFrameworks(ctx, e.sourceWorkspace(source))
+}
+
+// ReadSourceFile returns the content of a file in source and whether it exists
+func (e *TestEngine) ReadSourceFile(ctx context.Context, source *dagger.Directory, name string) (string, bool, error) {
+	if source == nil {
+		return "", false, fmt.Errorf("source directory is required")
+	}
+	return readWorkspaceFile(ctx, e.sourceWorkspace(source), name)
+}
+
 // RunTests executes the test suite for a given repository and branch
-func (e *TestEngine) RunTests(ctx context.Context, owner, repo, branch string) (*TestResult, error) {
+func (e *TestEngine) RunTests(ctx context.Context, owner, repo, branch string, steps ...ValidationStep) (*TestResult, error) {
 	start := time.Now()
 	e.logger.WithFields(logrus.Fields{
 		"owner":  owner,
@@ -80,65 +318,189 @@ func (e *TestEngine) RunTests(ctx context.Context, owner, repo, branch string) (
 		return nil, fmt.Errorf("failed to create test container: %w", err)
 	}
 
-	// Detect project type and framework
-	framework, err := e.detectFramework(ctx, testContainer)
+	return e.runPipeline(ctx, testContainer, owner+"/"+repo, start, steps)
+}
+
+// runPipeline detects the frameworks in the workspace container and runs each one's pipeline
+// in its own toolchain container. Results from several frameworks are combined into a single
+// TestResult. repository scopes the dependency caches. Validation steps that are not one of
+// the stages run afterwards from the repository root.
+func (e *TestEngine) runPipeline(ctx context.Context, workspace ContainerInterface, repository string, start time.Time, steps []ValidationStep) (*TestResult, error) {
+	frameworks, err := e.pipelineFrameworks(ctx, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	frameworks, err = e.selectTestPaths(frameworks)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(frameworks) == 1 {
+		result := e.runFrameworkPipeline(ctx, workspace, repository, frameworks[0], start, steps)
+		e.runValidationSteps(ctx, workspace, repository, frameworks, result, steps)
+		return result, nil
+	}
+
+	// Each framework's setup is measured on its own, so the combined setup time adds up
+	// checking out the workspace and preparing every toolchain container
+	setupDuration := time.Since(start)
+	results := make([]*TestResult, 0, len(frameworks))
+	for _, framework := range frameworks {
+		result := e.runFrameworkPipeline(ctx, workspace, repository, framework, time.Now(), steps)
+		if frameworkSetup, ok := result.Details["setup_duration"].(time.Duration); ok {
+			setupDuration += frameworkSetup
+		}
+		results = append(results, result)
+	}
+
+	combined := e.combineResults(frameworks, results, start)
+	combined.Details["setup_duration"] = setupDuration
+	e.runValidationSteps(ctx, workspace, repository, frameworks, combined, steps)
+	return combined, nil
+}
+
+// pipelineFrameworks reads the repository's test container config, then detects the
+// frameworks in the workspace and applies the config to them
+func (e *TestEngine) pipelineFrameworks(ctx context.Context, workspace ContainerInterface) ([]*TestFramework, error) {
+	config, err := e.loadTestContainerConfig(ctx, workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	// Detect project types and frameworks
+	frameworks, err := e.detectFramework(ctx, workspace)
 	if err != nil {
 		return nil, fmt.Errorf("failed to detect framework: %w", err)
 	}
+	return e.configureFrameworks(frameworks, config), nil
+}
 
-	e.logger.WithField("framework", framework.Name).Info("Detected test framework")
+// runFrameworkPipeline prepares the framework's toolchain container and runs its stages,
+// recording how long the container took to become ready in Details["setup_duration"]
+func (e *TestEngine) runFrameworkPipeline(ctx context.Context, workspace ContainerInterface, repository string, framework *TestFramework, start time.Time, steps []ValidationStep) *TestResult {
+	e.logger.WithFields(logrus.Fields{
+		"framework": framework.Name,
+		"path":      frameworkDir(framework),
+	}).Info("Detected test framework")
+
+	testContainer := e.frameworkContainer(workspace, repository, framework)
+	err := testContainer.Sync(ctx)
+	setupDuration := time.Since(start)
+
+	e.logger.WithFields(logrus.Fields{
+		"framework":      framework.Name,
+		"image":          framework.Image,
+		"cache":          !e.cacheDisabled,
+		"setup_duration": setupDuration,
+	}).Info("Test container ready")
+
+	if err != nil {
+		return &TestResult{
+			Success:  false,
+			Duration: time.Since(start),
+			Output:   "Container setup failed",
+			Errors:   []string{err.Error()},
+			Details: map[string]interface{}{
+				"stage":          "setup",
+				"framework":      framework.Name,
+				"setup_duration": setupDuration,
+			},
+		}
+	}
+
+	result := e.runStages(ctx, testContainer, framework, start, steps)
+	result.Details["setup_duration"] = setupDuration
+	return result
+}
+
+// runStages runs lint, build, tests and coverage for one framework, each bounded by its
+// stage timeout
+func (e *TestEngine) runStages(ctx context.Context, testContainer ContainerInterface, framework *TestFramework, start time.Time, steps []ValidationStep) *TestResult {
+	timeouts := e.timeouts.withDefaults().forSteps(framework, steps)
 
 	// Run linting
-	lintResult, err := e.runLinting(ctx, testContainer, framework)
+	lintResult, err := runStage(ctx, stageLint, timeouts.Lint, func(ctx context.Context) (string, error) {
+		return e.runLinting(ctx, testContainer, framework)
+	})
+	if timedOut := e.timeoutResult(err, start, framework, lintResult, nil); timedOut != nil {
+		return timedOut
+	}
 	if err != nil {
 		e.logger.WithError(err).Warn("Linting failed")
 	}
 
 	// Run build
-	buildResult, err := e.runBuild(ctx, testContainer, framework)
+	buildResult, err := runStage(ctx, stageBuild, timeouts.Build, func(ctx context.Context) (string, error) {
+		return e.runBuild(ctx, testContainer, framework)
+	})
+	if timedOut := e.timeoutResult(err, start, framework, buildResult, map[string]interface{}{"lint": lintResult}); timedOut != nil {
+		return timedOut
+	}
 	if err != nil {
 		return &TestResult{
 			Success:  false,
 			Duration: time.Since(start),
-			Output:   "Build failed",
+			Output:   buildResult,
 			Errors:   []string{err.Error()},
-			Details: map[string]interface{}{
+			Details: commandFailureDetails(err, map[string]interface{}{
 				"stage":     "build",
 				"framework": framework.Name,
 				"lint":      lintResult,
-			},
-		}, nil
+			}),
+		}
 	}
 
 	// Run tests
-	testOutput, err := e.runTestSuite(ctx, testContainer, framework)
+	var reports []string
+	testOutput, err := runStage(ctx, stageTest, timeouts.Test, func(ctx context.Context) (string, error) {
+		output, testReports, err := e.runTestSuiteWithReports(ctx, testContainer, framework)
+		reports = testReports
+		return output, err
+	})
+	if timedOut := e.timeoutResult(err, start, framework, testOutput, map[string]interface{}{"lint": lintResult, "build": buildResult}); timedOut != nil {
+		return timedOut
+	}
+
+	// Parse test results
+	testStats := e.testStats(testOutput, reports, framework)
+
 	if err != nil {
 		return &TestResult{
-			Success:  false,
-			Duration: time.Since(start),
-			Output:   testOutput,
-			Errors:   []string{err.Error()},
-			Details: map[string]interface{}{
+			Success:      false,
+			TotalTests:   testStats.Total,
+			PassedTests:  testStats.Passed,
+			FailedTests:  testStats.Failed,
+			SkippedTests: testStats.Skipped,
+			Duration:     time.Since(start),
+			Output:       testOutput,
+			Errors:       []string{err.Error()},
+			Cases:        testStats.Cases,
+			Details: commandFailureDetails(err, map[string]interface{}{
 				"stage":     "test",
 				"framework": framework.Name,
 				"lint":      lintResult,
 				"build":     buildResult,
-			},
-		}, nil
+			}),
+		}
 	}
 
 	// Run coverage analysis
-	coverageResult, err := e.runCoverageAnalysis(ctx, testContainer, framework)
+	coverageResult, err := runStage(ctx, stageCoverage, timeouts.Coverage, func(ctx context.Context) (*CoverageResult, error) {
+		return e.runCoverageAnalysis(ctx, testContainer, framework)
+	})
+	if timedOut := e.timeoutResult(err, start, framework, testOutput, map[string]interface{}{"lint": lintResult, "build": buildResult}); timedOut != nil {
+		return timedOut
+	}
 	if err != nil {
 		e.logger.WithError(err).Warn("Coverage analysis failed")
-		coverageResult = &CoverageResult{Coverage: 0.0}
+		coverageResult = &CoverageResult{Coverage: 0.0, Unknown: true}
 	}
-
-	// Parse test results
-	testStats := e.parseTestOutput(testOutput, framework)
+	coverageMet := e.coverageMet(coverageResult)
 
 	result := &TestResult{
-		Success:      testStats.Passed > 0 && coverageResult.Coverage >= float64(e.minCoverage),
+		Success:      testStats.Passed > 0 && coverageMet,
+		TestsPassed:  testStats.Passed > 0,
 		TotalTests:   testStats.Total,
 		PassedTests:  testStats.Passed,
 		FailedTests:  testStats.Failed,
@@ -146,6 +508,9 @@ func (e *TestEngine) RunTests(ctx context.Context, owner, repo, branch string) (
 		Coverage:     coverageResult.Coverage,
 		Duration:     time.Since(start),
 		Output:       testOutput,
+		FileCoverage: coverageResult.Files,
+		Reports:      coverageResult.Reports,
+		ReportDir:    coverageReportDirectory(coverageResult.Reports),
 		Details: map[string]interface{}{
 			"framework":       framework.Name,
 			"lint":            lintResult,
@@ -153,13 +518,19 @@ func (e *TestEngine) RunTests(ctx context.Context, owner, repo, branch string) (
 			"coverage_detail": coverageResult,
 			"min_coverage":    e.minCoverage,
 		},
+		Cases:           testStats.Cases,
+		CoverageUnknown: coverageResult.Unknown,
 	}
 
 	if testStats.Failed > 0 {
 		result.Errors = append(result.Errors, "Some tests failed")
 	}
 
-	if coverageResult.Coverage < float64(e.minCoverage) {
+	switch {
+	case coverageMet:
+	case coverageResult.Unknown:
+		result.Errors = append(result.Errors, fmt.Sprintf("Coverage not measured, but %.2f%% is required", float64(e.minCoverage)))
+	default:
 		result.Errors = append(result.Errors, fmt.Sprintf("Coverage %.2f%% below minimum %.2f%%", coverageResult.Coverage, float64(e.minCoverage)))
 	}
 
@@ -171,75 +542,206 @@ func (e *TestEngine) RunTests(ctx context.Context, owner, repo, branch string) (
 		"duration":     result.Duration,
 	}).Info("Test execution completed")
 
-	return result, nil
+	return result
+}
+
+// timeoutResult converts a stage timeout into a failed TestResult, or returns nil if err is not one
+func (e *TestEngine) timeoutResult(err error, start time.Time, framework *TestFramework, output string, details map[string]interface{}) *TestResult {
+	var timeoutErr *stageTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		return nil
+	}
+
+	e.logger.WithFields(logrus.Fields{
+		"stage":   timeoutErr.stage,
+		"timeout": timeoutErr.timeout,
+	}).Warn("Test stage timed out")
+
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+	details["stage"] = timeoutErr.stage
+	details["framework"] = framework.Name
+	details["timeout"] = timeoutErr.timeout.String()
+
+	return &TestResult{
+		Success:  false,
+		Duration: time.Since(start),
+		Output:   output,
+		Errors:   []string{timeoutErr.Error()},
+		Details:  details,
+	}
 }
 
 // ValidateTestCoverage validates that test coverage meets minimum requirements
 func (e *TestEngine) ValidateTestCoverage(ctx context.Context, coverage *CoverageResult) error {
 	if coverage.Coverage < float64(e.minCoverage) {
-		return fmt.Errorf("coverage %.2f%% is below minimum required %.2f%%", coverage.Coverage, float64(e.minCoverage))
+		return &CoverageError{Coverage: coverage.Coverage, Minimum: float64(e.minCoverage)}
 	}
 	return nil
 }
 
-// GenerateTestsForFix generates additional tests to validate a specific fix
-func (e *TestEngine) GenerateTestsForFix(ctx context.Context, fix *ProposedFix, analysis *FailureAnalysisResult) ([]string, error) {
-	e.logger.WithField("fix_id", fix.ID).Info("Generating tests for fix")
+// Private helper methods
 
-	var tests []string
+// createTestContainer clones the branch in a fetch container, the only one the GitHub token
+// is given to, and returns a fresh container holding just the checked out workspace, so the
+// repository's commands (Makefile targets, npm scripts) cannot read the token
+func (e *TestEngine) createTestContainer(ctx context.Context, owner, repo, branch string) (ContainerInterface, error) {
+	webURL := valueOr(e.githubURL, "https://github.com")
+	repoURL := fmt.Sprintf("%s/%s/%s", webURL, owner, repo)
+
+	token := e.githubToken
+	if e.githubTokenSource != nil {
+		var err error
+		if token, err = e.githubTokenSource(ctx); err != nil {
+			return nil, fmt.Errorf("failed to get GitHub token to clone %s/%s: %w", owner, repo, err)
+		}
+	}
 
-	// Generate tests based on fix type
-	switch fix.Type {
-	case CodeFix:
-		tests = append(tests, e.generateCodeFixTests(fix, analysis)...)
-	case DependencyFix:
-		tests = append(tests, e.generateDependencyTests(fix, analysis)...)
-	case ConfigurationFix:
-		tests = append(tests, e.generateConfigurationTests(fix, analysis)...)
-	case TestFix:
-		tests = append(tests, e.generateTestFixTests(fix, analysis)...)
+	fetch := e.baseTestContainer()
+	if token != nil {
+		scheme, host, _ := strings.Cut(webURL, "://")
+		// The token stays in a secret variable and is only expanded by the shell,
+		// so it never appears in the command line or logs. The remote is reset to the
+		// plain URL so the token is not left in .git/config either.
+		fetch = fetch.
+			WithSecretVariable("GITHUB_TOKEN", token).
+			WithEnvVariable("AUTOFIX_CLONE_SCHEME", scheme).
+			WithEnvVariable("AUTOFIX_CLONE_HOST", host).
+			WithEnvVariable("AUTOFIX_CLONE_REPO", fmt.Sprintf("%s/%s", owner, repo)).
+			WithEnvVariable("AUTOFIX_CLONE_BRANCH", branch).
+			WithExec([]string{"sh", "-c", `git clone -b "$AUTOFIX_CLONE_BRANCH" "${AUTOFIX_CLONE_SCHEME}://x-access-token:${GITHUB_TOKEN}@${AUTOFIX_CLONE_HOST}/${AUTOFIX_CLONE_REPO}" /workspace && git -C /workspace remote set-url origin "${AUTOFIX_CLONE_SCHEME}://${AUTOFIX_CLONE_HOST}/${AUTOFIX_CLONE_REPO}"`})
+	} else {
+		fetch = fetch.WithExec([]string{"git", "clone", "-b", branch, repoURL, "/workspace"})
 	}
 
-	// Add regression tests
-	tests = append(tests, e.generateRegressionTests(fix, analysis)...)
+	return e.sourceWorkspace(fetch.Directory("/workspace").Unwrap()), nil
+}
 
-	e.logger.WithFields(logrus.Fields{
-		"fix_id":     fix.ID,
-		"test_count": len(tests),
-	}).Info("Test generation completed")
+// workspaceImage checks out the repository; it ships git and a shell but no toolchains,
+// which come from each framework's image
+const workspaceImage = "buildpack-deps:jammy-scm"
+
+// baseTestContainer returns the workspace container shared by the local and remote test
+// paths, with the container environment set so clones go through configured proxies
+func (e *TestEngine) baseTestContainer() ContainerInterface {
+	container := e.containerProvider.CreateContainer().From(workspaceImage)
+	env := e.withoutCredentials(e.containerEnv, "container environment")
+	for _, key := range sortedKeys(env) {
+		container = container.WithEnvVariable(key, env[key])
+	}
+	return container
+}
 
-	return tests, nil
+// sourceWorkspace returns the workspace container with source as the repository
+func (e *TestEngine) sourceWorkspace(source *dagger.Directory) ContainerInterface {
+	return e.baseTestContainer().WithDirectory("/workspace", source).WithWorkdir("/workspace")
 }
 
-// Private helper methods
+// frameworkContainer returns the container a framework's pipeline runs in: the framework's
+// toolchain image with its dependency caches mounted and the workspace copied in, prepared
+// by its setup commands. Frameworks without an image run directly in the workspace container.
+func (e *TestEngine) frameworkContainer(workspace ContainerInterface, repository string, framework *TestFramework) ContainerInterface {
+	workdir := path.Join("/workspace", frameworkDir(framework))
+	if framework.Image == "" {
+		return e.prepareContainer(workspace.WithWorkdir(workdir), framework)
+	}
 
-func (e *TestEngine) createTestContainer(ctx context.Context, owner, repo, branch string) (ContainerInterface, error) {
-	// Create a container for testing
-	repoURL := fmt.Sprintf("https://github.com/%s/%s", owner, repo)
+	container := e.containerProvider.CreateContainer().From(framework.Image)
+	if !e.cacheDisabled {
+		mountPaths := make([]string, 0, len(framework.CacheVolumes))
+		for mountPath := range framework.CacheVolumes {
+			mountPaths = append(mountPaths, mountPath)
+		}
+		sort.Strings(mountPaths)
+		for _, mountPath := range mountPaths {
+			container = container.WithMountedCache(mountPath, cacheVolumeKey(framework.CacheVolumes[mountPath], repository))
+		}
+	}
+
+	return e.prepareContainer(container.
+		WithDirectory("/workspace", workspace.Directory("/workspace").Unwrap()).
+		WithWorkdir(workdir), framework)
+}
 
-	container := e.containerProvider.CreateContainer().
-		From("ubuntu:22.04").
-		WithExec([]string{"apt-get", "update"}).
-		WithExec([]string{"apt-get", "install", "-y", "git", "curl", "wget", "build-essential"}).
-		WithExec([]string{"git", "clone", "-b", branch, repoURL, "/workspace"}).
-		WithWorkdir("/workspace")
+// cacheVolumeKey scopes a cache volume to a repository, e.g. "go-mod-owner-repo"
+func cacheVolumeKey(name, repository string) string {
+	repository = strings.Trim(strings.ReplaceAll(repository, "/", "-"), "-")
+	if repository == "" {
+		return name
+	}
+	return name + "-" + repository
+}
+
+// applyChanges writes changes into the container's working directory. It follows the PR
+// engine's semantics: add and modify replace the whole file, delete removes it and rename
+// moves it, replacing its content when NewContent is set.
+func (e *TestEngine) applyChanges(container ContainerInterface, changes []CodeChange) (ContainerInterface, error) {
+	for _, change := range changes {
+		if err := validateCodeChange(change); err != nil {
+			return nil, err
+		}
 
+		e.logger.WithFields(logrus.Fields{
+			"file":      change.FilePath,
+			"operation": change.Operation,
+		}).Debug("Applying code change to test container")
+
+		switch change.Operation {
+		case ChangeOperationAdd, ChangeOperationModify:
+			container = container.WithNewFile(change.FilePath, change.NewContent)
+		case ChangeOperationDelete:
+			container = container.WithExec([]string{"rm", "-f", "--", change.FilePath})
+		case ChangeOperationRename:
+			container = container.
+				WithExec([]string{"mkdir", "-p", "--", path.Dir(change.NewFilePath)}).
+				WithExec([]string{"mv", "--", change.FilePath, change.NewFilePath})
+			if change.NewContent != "" {
+				container = container.WithNewFile(change.NewFilePath, change.NewContent)
+			}
+		}
+	}
 	return container, nil
 }
 
-func (e *TestEngine) detectFramework(ctx context.Context, container ContainerInterface) (*TestFramework, error) {
-	// Check for various framework indicators
-	files := []string{"package.json", "go.mod", "pom.xml", "requirements.txt", "Cargo.toml", "composer.json"}
+// detectFramework finds every framework in the repository root and its first-level
+// subdirectories, falling back to the generic framework when none is found
+func (e *TestEngine) detectFramework(ctx context.Context, container ContainerInterface) ([]*TestFramework, error) {
+	rootEntries, err := container.Directory(".").Entries(ctx)
+	if err != nil {
+		e.logger.WithError(err).Warn("Failed to list repository, using generic framework")
+		return []*TestFramework{e.testFrameworks["generic"]}, nil
+	}
+
+	frameworks := e.detectFrameworksIn(ctx, container, "", rootEntries)
+	aggregated := make(map[string]bool)
+	for _, framework := range frameworks {
+		aggregated[framework.Name] = aggregatingFrameworks[framework.Name]
+	}
 
-	for _, file := range files {
-		_, err := container.File(file).Contents(ctx)
-		if err == nil {
-			return e.getFrameworkByFile(file), nil
+	for _, entry := range rootEntries {
+		dir := strings.TrimSuffix(entry, "/")
+		if strings.HasPrefix(dir, ".") || ignoredFrameworkDirs[dir] {
+			continue
+		}
+
+		// Listing fails for plain files, which are skipped
+		entries, err := container.Directory(dir).Entries(ctx)
+		if err != nil {
+			continue
+		}
+		for _, framework := range e.detectFrameworksIn(ctx, container, dir, entries) {
+			if !aggregated[framework.Name] {
+				frameworks = append(frameworks, framework)
+			}
 		}
 	}
 
-	// Default to generic framework
-	return e.testFrameworks["generic"], nil
+	if len(frameworks) == 0 {
+		// Default to generic framework
+		return []*TestFramework{e.testFrameworks["generic"]}, nil
+	}
+	return frameworks, nil
 }
 
 func (e *TestEngine) getFrameworkByFile(filename string) *TestFramework {
@@ -260,9 +762,17 @@ func (e *TestEngine) getFrameworkByFile(filename string) *TestFramework {
 		return e.testFrameworks["rust"]
 	case "composer.json":
 		return e.testFrameworks["php"]
+	case "build.gradle", "build.gradle.kts", "settings.gradle", "settings.gradle.kts":
+		return e.testFrameworks["gradle"]
+	case "Gemfile":
+		return e.testFrameworks["ruby"]
 	case "Makefile", "makefile":
 		return e.testFrameworks["generic"]
 	default:
+		// .NET project and solution files are named after the project
+		if matchesMarker("*.csproj", filename) || matchesMarker("*.sln", filename) {
+			return e.testFrameworks["dotnet"]
+		}
 		// For truly unknown files, check if it's a generic build file pattern
 		if strings.HasSuffix(filename, ".file") || strings.Contains(filename, "Makefile") {
 			return e.testFrameworks["generic"]
@@ -284,7 +794,7 @@ func (e *TestEngine) runLinting(ctx context.Context, container ContainerInterfac
 		container = container.WithEnvVariable(key, value)
 	}
 
-	output, err := container.WithExec(strings.Split(framework.LintCommand, " ")).Stdout(ctx)
+	_, output, err := e.runCommand(ctx, container, stageLint, framework.LintCommand)
 	if err != nil {
 		return output, fmt.Errorf("linting failed: %w", err)
 	}
@@ -304,7 +814,7 @@ func (e *TestEngine) runBuild(ctx context.Context, container ContainerInterface,
 		container = container.WithEnvVariable(key, value)
 	}
 
-	output, err := container.WithExec(strings.Split(framework.BuildCommand, " ")).Stdout(ctx)
+	_, output, err := e.runCommand(ctx, container, stageBuild, framework.BuildCommand)
 	if err != nil {
 		return output, fmt.Errorf("build failed: %w", err)
 	}
@@ -313,6 +823,12 @@ func (e *TestEngine) runBuild(ctx context.Context, container ContainerInterface,
 }
 
 func (e *TestEngine) runTestSuite(ctx context.Context, container ContainerInterface, framework *TestFramework) (string, error) {
+	output, _, err := e.runTestSuiteWithReports(ctx, container, framework)
+	return output, err
+}
+
+// runTestSuiteWithReports runs the test command and collects the JUnit reports it wrote
+func (e *TestEngine) runTestSuiteWithReports(ctx context.Context, container ContainerInterface, framework *TestFramework) (string, []string, error) {
 	e.logger.WithField("command", framework.TestCommand).Debug("Running test suite")
 
 	// Setup environment
@@ -320,23 +836,55 @@ func (e *TestEngine) runTestSuite(ctx context.Context, container ContainerInterf
 		container = container.WithEnvVariable(key, value)
 	}
 
-	output, err := container.WithExec(strings.Split(framework.TestCommand, " ")).Stdout(ctx)
+	executed, output, err := e.runCommand(ctx, container, stageTest, framework.TestCommand)
+	reports := e.collectTestReports(ctx, executed, framework)
 	if err != nil {
-		return output, fmt.Errorf("tests failed: %w", err)
+		return output, reports, fmt.Errorf("tests failed: %w", err)
 	}
 
-	return output, nil
+	return output, reports, nil
 }
 
 type CoverageResult struct {
 	Coverage     float64                `json:"coverage"`
 	Details      map[string]interface{} `json:"details"`
 	ReportFormat string                 `json:"report_format"`
+	// Files is the per-file coverage read from the coverage reports, and Reports the report
+	// files by path
+	Files   []FileCoverage    `json:"files,omitempty"`
+	Reports map[string]string `json:"-"`
+	// Unknown tells the framework has no coverage tooling or it failed, so Coverage was not
+	// measured
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// coverageMet reports whether coverage meets the minimum. Unmeasured coverage meets it
+// unless coverage is required.
+func (e *TestEngine) coverageMet(coverage *CoverageResult) bool {
+	if coverage.Unknown {
+		return !e.requireCoverage
+	}
+	return coverage.Coverage >= float64(e.minCoverage)
+}
+
+// coverageFallback returns framework with the language's native coverage command when it
+// has none, so Go projects always run go test -coverprofile
+func (e *TestEngine) coverageFallback(framework *TestFramework) *TestFramework {
+	golang := e.testFrameworks["golang"]
+	if framework.CoverageCommand != "" || framework.Language != "go" || golang == nil {
+		return framework
+	}
+	fallback := *framework
+	fallback.CoverageCommand = golang.CoverageCommand
+	fallback.CoverageArtifacts = golang.CoverageArtifacts
+	fallback.CoverageReportCommand = golang.CoverageReportCommand
+	return &fallback
 }
 
 func (e *TestEngine) runCoverageAnalysis(ctx context.Context, container ContainerInterface, framework *TestFramework) (*CoverageResult, error) {
+	framework = e.coverageFallback(framework)
 	if framework.CoverageCommand == "" {
-		return &CoverageResult{Coverage: 0.0}, nil
+		return &CoverageResult{Coverage: 0.0, Unknown: true}, nil
 	}
 
 	e.logger.WithField("command", framework.CoverageCommand).Debug("Running coverage analysis")
@@ -346,22 +894,39 @@ func (e *TestEngine) runCoverageAnalysis(ctx context.Context, container Containe
 		container = container.WithEnvVariable(key, value)
 	}
 
-	output, err := container.WithExec(strings.Split(framework.CoverageCommand, " ")).Stdout(ctx)
+	executed, output, err := e.runCommand(ctx, container, stageCoverage, framework.CoverageCommand)
 	if err != nil {
 		return nil, fmt.Errorf("coverage analysis failed: %w", err)
 	}
 
-	// Parse coverage from output (simplified)
-	coverage := e.parseCoverageOutput(output, framework)
-
-	return &CoverageResult{
-		Coverage:     coverage,
+	result := &CoverageResult{
 		ReportFormat: "text",
 		Details: map[string]interface{}{
 			"raw_output": output,
 			"framework":  framework.Name,
 		},
-	}, nil
+	}
+
+	// Prefer the report file when the tool writes one, falling back to the command output
+	parsed := output
+	if framework.CoverageReport != "" {
+		report, err := executed.File(framework.CoverageReport).Contents(ctx)
+		if err != nil {
+			e.logger.WithError(err).WithField("path", framework.CoverageReport).Debug("Failed to read coverage report")
+		} else {
+			parsed = report
+			result.ReportFormat = strings.TrimPrefix(path.Ext(framework.CoverageReport), ".")
+			result.Details["coverage_report"] = framework.CoverageReport
+		}
+	}
+
+	// Output without a coverage figure, e.g. from a make target that does not report one, is
+	// not measured rather than 0%
+	var found bool
+	result.Coverage, found = e.findCoverage(parsed, framework)
+	result.Unknown = !found
+	result.Reports, result.Files = e.collectCoverageReports(ctx, executed, framework)
+	return result, nil
 }
 
 type TestStats struct {
@@ -369,14 +934,43 @@ type TestStats struct {
 	Passed  int
 	Failed  int
 	Skipped int
+	Cases   []TestCase
 }
 
 func (e *TestEngine) parseTestOutput(output string, framework *TestFramework) TestStats {
+	// go test -json output carries per-test events
+	if cases, ok := parseGoTestJSON(output); ok {
+		return statsFromCases(cases)
+	}
+
 	// Framework-specific test parsing
 	stats := TestStats{}
 
 	lines := strings.Split(output, "\n")
 	for _, line := range lines {
+		// Per-test results from verbose go test and Jest failure headings
+		if testCase, ok := parseGoTestLine(line); ok {
+			stats.Cases = append(stats.Cases, testCase)
+		} else if testCase, ok := parseJestFailureLine(line); ok {
+			stats.Cases = append(stats.Cases, testCase)
+		}
+
+		// dotnet test prints one summary per test assembly
+		if summary, ok := parseDotnetSummaryLine(line); ok {
+			stats.Total += summary.Total
+			stats.Passed += summary.Passed
+			stats.Failed += summary.Failed
+			stats.Skipped += summary.Skipped
+			continue
+		}
+
+		// RSpec summary: "12 examples, 2 failures, 1 pending"
+		if summary, ok := parseRSpecSummaryLine(line); ok {
+			summary.Cases = stats.Cases
+			stats = summary
+			continue
+		}
+
 		// Go test output parsing
 		if strings.Contains(line, "PASS:") || strings.Contains(line, "FAIL:") {
 			if strings.Contains(line, "PASS:") {
@@ -402,6 +996,11 @@ func (e *TestEngine) parseTestOutput(output string, framework *TestFramework) Te
 						stats.Failed = val
 					}
 				}
+				if part == "skipped," && i > 0 {
+					if val, err := strconv.Atoi(parts[i-1]); err == nil {
+						stats.Skipped = val
+					}
+				}
 				if part == "total" && i > 0 {
 					if val, err := strconv.Atoi(parts[i-1]); err == nil {
 						stats.Total = val
@@ -410,6 +1009,30 @@ func (e *TestEngine) parseTestOutput(output string, framework *TestFramework) Te
 			}
 		}
 
+		// Vitest output parsing
+		// Example: "      Tests  2 failed | 5 passed (7)"
+		if fields := strings.Fields(line); len(fields) > 2 && fields[0] == "Tests" {
+			for i := 2; i < len(fields); i++ {
+				val, err := strconv.Atoi(fields[i-1])
+				if err != nil {
+					continue
+				}
+				switch fields[i] {
+				case "passed":
+					stats.Passed = val
+				case "failed":
+					stats.Failed = val
+				case "skipped":
+					stats.Skipped = val
+				}
+			}
+			if last := fields[len(fields)-1]; strings.HasPrefix(last, "(") {
+				if val, err := strconv.Atoi(strings.Trim(last, "()")); err == nil {
+					stats.Total = val
+				}
+			}
+		}
+
 		// Individual test result lines for Go
 		if (strings.Contains(line, "PASS") || strings.Contains(line, "FAIL")) &&
 			(strings.Contains(line, "Test") || strings.Contains(line, "Example")) {
@@ -426,7 +1049,24 @@ func (e *TestEngine) parseTestOutput(output string, framework *TestFramework) Te
 	return stats
 }
 
+// parseCoverageOutput returns the total coverage in a coverage report or command output, 0
+// when there is none
 func (e *TestEngine) parseCoverageOutput(output string, framework *TestFramework) float64 {
+	coverage, _ := e.findCoverage(output, framework)
+	return coverage
+}
+
+// findCoverage returns the total coverage in a coverage report or command output, and whether
+// one was found
+func (e *TestEngine) findCoverage(output string, framework *TestFramework) (float64, bool) {
+	// Coverage report files
+	if coverage, ok := parseJaCoCoXML(output); ok {
+		return coverage, true
+	}
+	if coverage, ok := parseSimpleCovLastRun(output); ok {
+		return coverage, true
+	}
+
 	// Framework-specific coverage parsing
 	lines := strings.Split(output, "\n")
 	for _, line := range lines {
@@ -437,7 +1077,7 @@ func (e *TestEngine) parseCoverageOutput(output string, framework *TestFramework
 				if strings.HasSuffix(part, "%") {
 					percentStr := strings.TrimSuffix(part, "%")
 					if val, err := strconv.ParseFloat(percentStr, 64); err == nil {
-						return val
+						return val, true
 					}
 				}
 			}
@@ -449,11 +1089,16 @@ func (e *TestEngine) parseCoverageOutput(output string, framework *TestFramework
 			if len(parts) >= 2 {
 				percentStr := strings.TrimSpace(parts[1])
 				if val, err := strconv.ParseFloat(percentStr, 64); err == nil {
-					return val
+					return val, true
 				}
 			}
 		}
 
+		// coverlet summary table: "| Total   | 85.5% | 75%    | 90%    |"
+		if coverage, ok := parseCoverletTotal(line); ok {
+			return coverage, true
+		}
+
 		// Python coverage output: "TOTAL          92%"
 		if strings.Contains(line, "TOTAL") && strings.Contains(line, "%") {
 			parts := strings.Fields(line)
@@ -461,72 +1106,13 @@ func (e *TestEngine) parseCoverageOutput(output string, framework *TestFramework
 				if strings.HasSuffix(part, "%") {
 					percentStr := strings.TrimSuffix(part, "%")
 					if val, err := strconv.ParseFloat(percentStr, 64); err == nil {
-						return val
+						return val, true
 					}
 				}
 			}
 		}
 	}
-	return 0.0
-}
-
-func (e *TestEngine) generateCodeFixTests(fix *ProposedFix, analysis *FailureAnalysisResult) []string {
-	var tests []string
-
-	// Generate unit tests for changed functions
-	for _, change := range fix.Changes {
-		if change.Operation == "modify" || change.Operation == "add" {
-			tests = append(tests, fmt.Sprintf(`
-// Test for changes in %s
-func Test_%s_Fix(t *testing.T) {
-	// Test the fixed functionality
-	// TODO: Implement specific test logic
-}
-`, change.FilePath, strings.ReplaceAll(change.FilePath, "/", "_")))
-		}
-	}
-
-	return tests
-}
-
-func (e *TestEngine) generateDependencyTests(fix *ProposedFix, analysis *FailureAnalysisResult) []string {
-	return []string{
-		`// Test dependency installation
-func TestDependencyInstallation(t *testing.T) {
-	// Verify dependencies are correctly installed
-	// TODO: Implement dependency validation
-}`,
-	}
-}
-
-func (e *TestEngine) generateConfigurationTests(fix *ProposedFix, analysis *FailureAnalysisResult) []string {
-	return []string{
-		`// Test configuration validity
-func TestConfigurationValidity(t *testing.T) {
-	// Verify configuration is valid
-	// TODO: Implement configuration validation
-}`,
-	}
-}
-
-func (e *TestEngine) generateTestFixTests(fix *ProposedFix, analysis *FailureAnalysisResult) []string {
-	return []string{
-		`// Test for test fixes
-func TestFixedTests(t *testing.T) {
-	// Verify previously failing tests now pass
-	// TODO: Implement test validation
-}`,
-	}
-}
-
-func (e *TestEngine) generateRegressionTests(fix *ProposedFix, analysis *FailureAnalysisResult) []string {
-	return []string{
-		`// Regression test
-func TestRegression_` + analysis.ID + `(t *testing.T) {
-	// Ensure the original failure doesn't reoccur
-	// TODO: Implement regression test logic
-}`,
-	}
+	return 0.0, false
 }
 
 // Load predefined test frameworks and coverage tools
@@ -539,39 +1125,54 @@ func loadTestFrameworks() map[string]*TestFramework {
 			Framework:       "npm",
 			TestCommand:     "npm test",
 			CoverageCommand: "npm run coverage",
-			BuildCommand:    "npm run build",
-			LintCommand:     "npm run lint",
-			ConfigFiles:     []string{"package.json", "jest.config.js", ".eslintrc.js"},
+			// Jest's default reporters write an lcov tracefile and its HTML rendering
+			CoverageArtifacts: []string{"coverage/lcov.info", "coverage/lcov-report/index.html"},
+			BuildCommand:      "npm run build",
+			LintCommand:       "npm run lint",
+			ConfigFiles:       []string{"package.json", "jest.config.js", ".eslintrc.js"},
 			Environment: map[string]string{
 				"NODE_ENV": "test",
 			},
+			Image:        "node:20",
+			CacheVolumes: nodeCacheVolumes["npm"],
 		},
 		"golang": {
-			Name:            "golang",
-			Language:        "go",
-			Framework:       "go",
-			TestCommand:     "go test ./...",
-			CoverageCommand: "go test -coverprofile=coverage.out ./...",
-			BuildCommand:    "go build ./...",
-			LintCommand:     "golangci-lint run",
-			ConfigFiles:     []string{"go.mod", "go.sum"},
+			Name:                  "golang",
+			Language:              "go",
+			Framework:             "go",
+			TestCommand:           "go test -json ./...",
+			CoverageCommand:       "go test -coverprofile=coverage.out ./...",
+			CoverageArtifacts:     []string{"coverage.out", "coverage.html"},
+			CoverageReportCommand: "go tool cover -html=coverage.out -o coverage.html",
+			BuildCommand:          "go build ./...",
+			LintCommand:           "golangci-lint run",
+			ConfigFiles:           []string{"go.mod", "go.sum"},
 			Environment: map[string]string{
 				"GO111MODULE": "on",
 				"CGO_ENABLED": "0",
 			},
+			Image: "golang:1.22",
+			CacheVolumes: map[string]string{
+				"/go/pkg/mod":           "go-mod",
+				"/root/.cache/go-build": "go-build",
+			},
 		},
 		"python": {
-			Name:            "python",
-			Language:        "python",
-			Framework:       "pytest",
-			TestCommand:     "pytest",
-			CoverageCommand: "pytest --cov=.",
-			BuildCommand:    "pip install -e .",
-			LintCommand:     "flake8",
-			ConfigFiles:     []string{"requirements.txt", "setup.py", "pyproject.toml", "pytest.ini"},
+			Name:              "python",
+			Language:          "python",
+			Framework:         "pytest",
+			TestCommand:       "pytest --junitxml=test-results/junit.xml",
+			CoverageCommand:   "pytest --cov=. --cov-report=term --cov-report=xml --cov-report=html",
+			CoverageArtifacts: []string{"coverage.xml", "htmlcov/index.html"},
+			BuildCommand:      "pip install -e .",
+			LintCommand:       "flake8",
+			ConfigFiles:       []string{"requirements.txt", "setup.py", "pyproject.toml", "pytest.ini"},
 			Environment: map[string]string{
 				"PYTHONPATH": ".",
 			},
+			ReportPaths:  []string{"test-results/junit.xml"},
+			Image:        "python:3.12",
+			CacheVolumes: map[string]string{"/root/.cache/pip": "pip"},
 		},
 		"maven": {
 			Name:            "maven",
@@ -583,6 +1184,61 @@ func loadTestFrameworks() map[string]*TestFramework {
 			LintCommand:     "mvn checkstyle:check",
 			ConfigFiles:     []string{"pom.xml"},
 			Environment:     map[string]string{},
+			ReportPaths:     []string{"target/surefire-reports/TEST-*.xml"},
+			CoverageReport:  "target/site/jacoco/jacoco.xml",
+			Image:           "maven:3.9-eclipse-temurin-21",
+			CacheVolumes:    map[string]string{"/root/.m2/repository": "maven"},
+		},
+		"gradle": {
+			Name:            "gradle",
+			Language:        "java",
+			Framework:       "gradle",
+			TestCommand:     "gradle test",
+			CoverageCommand: "gradle test jacocoTestReport",
+			BuildCommand:    "gradle assemble",
+			LintCommand:     "gradle check -x test",
+			ConfigFiles:     []string{"build.gradle", "build.gradle.kts", "settings.gradle", "settings.gradle.kts"},
+			Environment: map[string]string{
+				"GRADLE_USER_HOME": "/root/.gradle",
+				"GRADLE_OPTS":      "-Dorg.gradle.daemon=false",
+			},
+			ReportPaths:    []string{"build/test-results/test/TEST-*.xml"},
+			CoverageReport: "build/reports/jacoco/test/jacocoTestReport.xml",
+			Image:          "gradle:8-jdk21",
+			CacheVolumes:   map[string]string{"/root/.gradle/caches": "gradle"},
+		},
+		"dotnet": {
+			Name:            "dotnet",
+			Language:        "csharp",
+			Framework:       "dotnet",
+			TestCommand:     "dotnet test",
+			CoverageCommand: "dotnet test /p:CollectCoverage=true",
+			BuildCommand:    "dotnet build",
+			LintCommand:     "dotnet format --verify-no-changes",
+			ConfigFiles:     []string{"*.sln", "*.csproj", "Directory.Build.props"},
+			Environment: map[string]string{
+				"DOTNET_CLI_TELEMETRY_OPTOUT": "1",
+				"DOTNET_NOLOGO":               "1",
+			},
+			Image:        "mcr.microsoft.com/dotnet/sdk:8.0",
+			CacheVolumes: map[string]string{"/root/.nuget/packages": "nuget"},
+		},
+		"ruby": {
+			Name:            "ruby",
+			Language:        "ruby",
+			Framework:       "rspec",
+			TestCommand:     "bundle exec rspec",
+			CoverageCommand: "bundle exec rspec",
+			BuildCommand:    "bundle install",
+			LintCommand:     "bundle exec rubocop",
+			ConfigFiles:     []string{"Gemfile", "Gemfile.lock", ".rspec"},
+			Environment: map[string]string{
+				"RACK_ENV":  "test",
+				"RAILS_ENV": "test",
+			},
+			CoverageReport: "coverage/.last_run.json",
+			Image:          "ruby:3.3",
+			CacheVolumes:   map[string]string{"/usr/local/bundle": "bundle"},
 		},
 		"rust": {
 			Name:            "rust",
@@ -594,6 +1250,8 @@ func loadTestFrameworks() map[string]*TestFramework {
 			LintCommand:     "cargo clippy",
 			ConfigFiles:     []string{"Cargo.toml", "Cargo.lock"},
 			Environment:     map[string]string{},
+			Image:           "rust:1.77",
+			CacheVolumes:    map[string]string{"/usr/local/cargo/registry": "cargo-registry"},
 		},
 		"php": {
 			Name:            "php",
@@ -605,6 +1263,8 @@ func loadTestFrameworks() map[string]*TestFramework {
 			LintCommand:     "./vendor/bin/phpcs",
 			ConfigFiles:     []string{"composer.json"},
 			Environment:     map[string]string{},
+			Image:           "composer:2",
+			CacheVolumes:    map[string]string{"/tmp/cache": "composer"},
 		},
 		"generic": {
 			Name:            "generic",
@@ -616,6 +1276,7 @@ func loadTestFrameworks() map[string]*TestFramework {
 			LintCommand:     "make lint",
 			ConfigFiles:     []string{"Makefile", "makefile"},
 			Environment:     map[string]string{},
+			Image:           "buildpack-deps:jammy",
 		},
 	}
 }
@@ -306,7 +306,7 @@ func TestDetectFrameworkComprehensive(t *testing.T) {
 
 	t.Run("detectFramework with nil container", func(t *testing.T) {
 		// Test the function with nil container (defensive)
-		var framework *TestFramework
+		var framework []*TestFramework
 		var err error
 		func() {
 			defer func() {
@@ -324,7 +324,7 @@ func TestDetectFrameworkComprehensive(t *testing.T) {
 
 	t.Run("detectFramework with valid context", func(t *testing.T) {
 		// This test covers the code path but will fail due to missing Dagger context
-		var framework *TestFramework
+		var framework []*TestFramework
 		var err error
 		func() {
 			defer func() {
@@ -2,12 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"dagger.io/dagger"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreateTestContainerWithMocks(t *testing.T) {
@@ -59,7 +63,7 @@ func TestCreateTestContainerWithMocks(t *testing.T) {
 
 			// Validate mock behavior
 			mock := mockProvider.MockContainer
-			assert.Equal(t, "ubuntu:22.04", mock.BaseImage)
+			assert.Equal(t, workspaceImage, mock.BaseImage)
 			assert.Equal(t, "/workspace", mock.WorkingDir)
 			assert.True(t, len(mock.ExecHistory) > 0, "Expected exec commands")
 		})
@@ -119,7 +123,7 @@ func TestDetectFrameworkWithMocks(t *testing.T) {
 			container := &MockContainerWrapper{mockProvider.MockContainer}
 
 			// Execute
-			framework, err := engine.detectFramework(context.Background(), container)
+			frameworks, err := engine.detectFramework(context.Background(), container)
 
 			// Validate
 			if tt.expectedError && err == nil {
@@ -129,7 +133,8 @@ func TestDetectFrameworkWithMocks(t *testing.T) {
 				t.Errorf("Unexpected error: %v", err)
 			}
 
-			if framework != nil {
+			if len(frameworks) > 0 {
+				framework := frameworks[0]
 				if tt.expectedFramework == "generic" {
 					assert.Equal(t, "generic", framework.Name)
 				} else {
@@ -499,7 +504,7 @@ func TestRunTestsIntegrationWithMocks(t *testing.T) {
 				mock.SetFileContent("go.mod", "module test\ngo 1.19")
 				
 				// Setup successful commands - make sure to match actual framework commands
-				mock.SetCommandOutput("go test ./...",
+				mock.SetCommandOutput("go test -json ./...",
 					"PASS: 5 passed, 0 failed\ncoverage: 90.0% of statements\nok\ttest\t0.005s",
 					"", 0, nil)
 				mock.SetCommandOutput("go build ./...",
@@ -524,7 +529,7 @@ func TestRunTestsIntegrationWithMocks(t *testing.T) {
 				mock.SetFileContent("go.mod", "module test\ngo 1.19")
 				
 				// Setup commands with low coverage
-				mock.SetCommandOutput("go test ./...",
+				mock.SetCommandOutput("go test -json ./...",
 					"PASS: 3 passed, 0 failed\ncoverage: 60.0% of statements\nok\ttest\t0.005s",
 					"", 0, nil)
 				mock.SetCommandOutput("go build ./...",
@@ -562,9 +567,396 @@ func TestRunTestsIntegrationWithMocks(t *testing.T) {
 
 			// Validate mock behavior
 			mock := mockProvider.MockContainer
-			assert.Equal(t, "ubuntu:22.04", mock.BaseImage)
+			assert.Equal(t, "golang:1.22", mock.BaseImage)
 			assert.Equal(t, "/workspace", mock.WorkingDir)
 			assert.True(t, len(mock.ExecHistory) > 0, "Expected exec commands")
 		})
 	}
-}
\ No newline at end of file
+}
+func TestRunTestsWithChangesWithMocks(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	mockProvider := NewMockContainerProvider()
+	mock := mockProvider.MockContainer
+	mock.FileSystem = map[string]string{"go.mod": "module test\n\ngo 1.19", "old.go": "package old"}
+	mock.SetCommandOutput("go test -json ./...", "PASS\nok\ttest\t0.005s", "", 0, nil)
+
+	engine := NewTestEngine(0, logger)
+	engine.SetContainerProvider(mockProvider)
+
+	changes := []CodeChange{
+		{FilePath: "main.go", Operation: "modify", NewContent: "package main // fixed"},
+		{FilePath: "internal/new.go", Operation: "add", NewContent: "package internal"},
+		{FilePath: "old.go", Operation: "delete"},
+	}
+
+	result, err := engine.RunTestsWithChanges(context.Background(), &dagger.Directory{}, changes)
+	require.NoError(t, err)
+	assert.Equal(t, "golang", result.Details["framework"])
+
+	assert.Equal(t, []string{"/workspace", "/workspace"}, mock.Directories, "the source is mounted, then copied into the toolchain container")
+	assert.Equal(t, "package main // fixed", mock.FileSystem["main.go"])
+	assert.Equal(t, "package internal", mock.FileSystem["internal/new.go"])
+
+	// The source is mounted, then every change is written before any pipeline step runs
+	index := func(op string) int {
+		for i, recorded := range mock.Operations {
+			if recorded == op {
+				return i
+			}
+		}
+		t.Fatalf("operation %q not recorded in %v", op, mock.Operations)
+		return -1
+	}
+	testIdx := index("exec:go test -json ./...")
+	assert.Less(t, index("directory:/workspace"), index("write:main.go"))
+	assert.Less(t, index("write:main.go"), testIdx)
+	assert.Less(t, index("write:internal/new.go"), testIdx)
+	assert.Less(t, index("exec:rm -f -- old.go"), testIdx)
+	assert.Less(t, index("exec:rm -f -- old.go"), index("exec:go build ./..."))
+
+	for _, op := range mock.Operations {
+		assert.NotContains(t, op, "git clone", "local runs should not clone the repository")
+	}
+}
+
+// TestRunTestsWithChangesRenames tests that renames move the file in the container before the
+// pipeline runs, writing its new content when the rename has one
+func TestRunTestsWithChangesRenames(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	mockProvider := NewMockContainerProvider()
+	mock := mockProvider.MockContainer
+	mock.FileSystem = map[string]string{"go.mod": "module test\n\ngo 1.19"}
+	mock.SetCommandOutput("go test -json ./...", "PASS\nok\ttest\t0.005s", "", 0, nil)
+
+	engine := NewTestEngine(0, logger)
+	engine.SetContainerProvider(mockProvider)
+
+	changes := []CodeChange{
+		{FilePath: "legacy.go", NewFilePath: "internal/compat/compat.go", Operation: ChangeOperationRename},
+		{FilePath: "util.go", NewFilePath: "helpers.go", Operation: ChangeOperationRename, NewContent: "package main // helpers"},
+	}
+	_, err := engine.RunTestsWithChanges(context.Background(), &dagger.Directory{}, changes)
+	require.NoError(t, err)
+
+	var applied []string
+	for _, op := range mock.Operations {
+		if strings.HasPrefix(op, "exec:mkdir") || strings.HasPrefix(op, "exec:mv") || op == "write:helpers.go" {
+			applied = append(applied, op)
+		}
+	}
+	assert.Equal(t, []string{
+		"exec:mkdir -p -- internal/compat",
+		"exec:mv -- legacy.go internal/compat/compat.go",
+		"exec:mkdir -p -- .",
+		"exec:mv -- util.go helpers.go",
+		"write:helpers.go",
+	}, applied)
+	assert.Equal(t, "package main // helpers", mock.FileSystem["helpers.go"])
+}
+
+func TestRunTestsWithChangesRejectsInvalidChanges(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	engine := NewTestEngine(85, logger)
+	engine.SetContainerProvider(NewMockContainerProvider())
+
+	_, err := engine.RunTestsWithChanges(context.Background(), nil, nil)
+	assert.Error(t, err)
+
+	for _, change := range []CodeChange{
+		{FilePath: "../escape.go", Operation: "add"},
+		{FilePath: "/etc/passwd", Operation: "modify"},
+		{FilePath: "main.go", Operation: "rename"},
+	} {
+		_, err := engine.RunTestsWithChanges(context.Background(), &dagger.Directory{}, []CodeChange{change})
+		assert.Error(t, err, change.FilePath)
+	}
+}
+
+func TestCreateTestContainerPrivateClone(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	mockProvider := NewMockContainerProvider()
+	engine := NewTestEngine(85, logger)
+	engine.SetContainerProvider(mockProvider)
+	engine.SetGitHubToken(&dagger.Secret{})
+
+	_, err := engine.createTestContainer(context.Background(), "owner", "repo", "autofix-test-1")
+	require.NoError(t, err)
+
+	mock := mockProvider.MockContainer
+	assert.Equal(t, []string{"GITHUB_TOKEN"}, mock.SecretVars)
+	assert.Equal(t, "owner/repo", mock.EnvVars["AUTOFIX_CLONE_REPO"])
+	assert.Equal(t, "autofix-test-1", mock.EnvVars["AUTOFIX_CLONE_BRANCH"])
+	assert.Equal(t, "https", mock.EnvVars["AUTOFIX_CLONE_SCHEME"])
+	assert.Equal(t, "github.com", mock.EnvVars["AUTOFIX_CLONE_HOST"])
+
+	clone := strings.Join(mock.ExecHistory[len(mock.ExecHistory)-1], " ")
+	assert.Contains(t, clone, "${AUTOFIX_CLONE_SCHEME}://x-access-token:${GITHUB_TOKEN}@${AUTOFIX_CLONE_HOST}/${AUTOFIX_CLONE_REPO}")
+	assert.Equal(t, "/workspace", mock.WorkingDir)
+}
+
+// TestCreateTestContainerEnterpriseClone tests that clones go to the GitHub Enterprise host
+// with a token minted per clone, as under GitHub App auth
+func TestCreateTestContainerEnterpriseClone(t *testing.T) {
+	mockProvider := NewMockContainerProvider()
+	engine := NewTestEngine(85, quietLogger())
+	engine.SetContainerProvider(mockProvider)
+	engine.SetGitHubURL((&GitHubEndpoints{APIURL: "https://ghe.example.com/api/v3"}).webURL())
+
+	minted := 0
+	engine.SetGitHubTokenSource(func(ctx context.Context) (*dagger.Secret, error) {
+		minted++
+		return &dagger.Secret{}, nil
+	})
+	_, err := engine.createTestContainer(context.Background(), "owner", "repo", "autofix-test-1")
+	require.NoError(t, err)
+	_, err = engine.createTestContainer(context.Background(), "owner", "repo", "autofix-test-1")
+	require.NoError(t, err)
+	assert.Equal(t, 2, minted)
+
+	mock := mockProvider.MockContainer
+	assert.Contains(t, mock.SecretVars, "GITHUB_TOKEN")
+	assert.Equal(t, "https", mock.EnvVars["AUTOFIX_CLONE_SCHEME"])
+	assert.Equal(t, "ghe.example.com", mock.EnvVars["AUTOFIX_CLONE_HOST"])
+
+	engine.SetGitHubTokenSource(func(ctx context.Context) (*dagger.Secret, error) {
+		return nil, errors.New("installation suspended")
+	})
+	_, err = engine.createTestContainer(context.Background(), "owner", "repo", "autofix-test-1")
+	assert.ErrorContains(t, err, "installation suspended")
+
+	// Public repositories are cloned without a token from the enterprise host too
+	public := NewMockContainerProvider()
+	engine = NewTestEngine(85, quietLogger())
+	engine.SetContainerProvider(public)
+	engine.SetGitHubURL("http://localhost:8080/")
+	_, err = engine.createTestContainer(context.Background(), "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.Contains(t, public.MockContainer.ExecHistory, []string{"git", "clone", "-b", "main", "http://localhost:8080/owner/repo", "/workspace"})
+}
+
+func TestRunPipelineStageTimeoutWithMocks(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	mockProvider := NewMockContainerProvider()
+	mock := mockProvider.MockContainer
+	mock.FileSystem = map[string]string{"go.mod": "module test\n\ngo 1.19"}
+	mock.CommandOutputs["go test -json ./..."] = MockCommandResult{Stdout: "PASS", Delay: time.Minute}
+
+	engine := NewTestEngine(0, logger).WithTestTimeouts(TestTimeouts{Test: 50 * time.Millisecond})
+	engine.SetContainerProvider(mockProvider)
+
+	start := time.Now()
+	result, err := engine.RunTestsWithChanges(context.Background(), &dagger.Directory{}, nil)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	assert.False(t, result.Success)
+	assert.Equal(t, []string{"timed out in test after 50ms"}, result.Errors)
+	assert.Equal(t, "test", result.Details["stage"])
+	assert.Equal(t, "golang", result.Details["framework"])
+	assert.Equal(t, "50ms", result.Details["timeout"])
+	assert.Contains(t, result.Details, "build")
+	assert.Equal(t, DefaultTestTimeouts().Build, engine.timeouts.Build, "unset stages keep their defaults")
+}
+
+func TestValidationStepTimeoutOverridesStage(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	mockProvider := NewMockContainerProvider()
+	mock := mockProvider.MockContainer
+	mock.FileSystem = map[string]string{"go.mod": "module test\n\ngo 1.19"}
+	mock.CommandOutputs["go build ./..."] = MockCommandResult{Stdout: "ok", Delay: time.Minute}
+
+	engine := NewTestEngine(0, logger)
+	engine.SetContainerProvider(mockProvider)
+
+	steps := []ValidationStep{
+		{Name: "Build", Command: "go build ./...", Timeout: 20 * time.Millisecond},
+		{Name: "Unrelated", Command: "make deps-check", Timeout: time.Millisecond},
+	}
+	result, err := engine.RunTestsWithChanges(context.Background(), &dagger.Directory{}, nil, steps...)
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, "build", result.Details["stage"])
+	assert.Equal(t, []string{"timed out in build after 20ms"}, result.Errors)
+}
+
+func TestValidateFixStageTimeoutIsNotAnError(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	mockProvider := NewMockContainerProvider()
+	mock := mockProvider.MockContainer
+	mock.FileSystem = map[string]string{"go.mod": "module test\n\ngo 1.19"}
+	mock.CommandOutputs["go test -json ./..."] = MockCommandResult{Delay: time.Minute}
+
+	engine := NewTestEngine(80, logger).WithTestTimeouts(TestTimeouts{Test: 20 * time.Millisecond})
+	engine.SetContainerProvider(mockProvider)
+
+	m := &DaggerAutofix{
+		Source:       &dagger.Directory{},
+		githubClient: &mockGitHub{},
+		testEngine:   engine,
+		logger:       logger,
+		MinCoverage:  80,
+	}
+
+	validation, err := m.ValidateFix(context.Background(), &ProposedFix{ID: "loop"})
+	require.NoError(t, err)
+	assert.False(t, validation.Valid)
+	assert.Equal(t, "test", validation.TestResult.Details["stage"])
+}
+
+func TestRunTestsMountsDependencyCaches(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	newGoMock := func() *MockContainerProvider {
+		mockProvider := NewMockContainerProvider()
+		mockProvider.MockContainer.FileSystem = map[string]string{"go.mod": "module test\n\ngo 1.22"}
+		return mockProvider
+	}
+
+	t.Run("RemoteBranch", func(t *testing.T) {
+		mockProvider := newGoMock()
+		mock := mockProvider.MockContainer
+		engine := NewTestEngine(0, logger)
+		engine.SetContainerProvider(mockProvider)
+
+		result, err := engine.RunTests(context.Background(), "owner", "repo", "main")
+		require.NoError(t, err)
+
+		assert.Equal(t, "golang:1.22", mock.BaseImage)
+		assert.Equal(t, map[string]string{
+			"/go/pkg/mod":           "go-mod-owner-repo",
+			"/root/.cache/go-build": "go-build-owner-repo",
+		}, mock.Caches)
+		assert.IsType(t, time.Duration(0), result.Details["setup_duration"])
+
+		// Toolchains come from the framework image instead of being installed on every run
+		for _, op := range mock.Operations {
+			assert.NotContains(t, op, "apt-get")
+		}
+		cacheIdx, testIdx := -1, -1
+		for i, op := range mock.Operations {
+			switch op {
+			case "cache:/go/pkg/mod=go-mod-owner-repo":
+				cacheIdx = i
+			case "exec:go test -json ./...":
+				testIdx = i
+			}
+		}
+		require.NotEqual(t, -1, cacheIdx)
+		assert.Less(t, cacheIdx, testIdx)
+	})
+
+	t.Run("LocalSourceUsesRepository", func(t *testing.T) {
+		mockProvider := newGoMock()
+		engine := NewTestEngine(0, logger)
+		engine.SetContainerProvider(mockProvider)
+		engine.SetRepository("acme", "api")
+
+		_, err := engine.RunTestsWithChanges(context.Background(), &dagger.Directory{}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "go-mod-acme-api", mockProvider.MockContainer.Caches["/go/pkg/mod"])
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		mockProvider := newGoMock()
+		engine := NewTestEngine(0, logger).WithTestCache(false)
+		engine.SetContainerProvider(mockProvider)
+
+		result, err := engine.RunTests(context.Background(), "owner", "repo", "main")
+		require.NoError(t, err)
+		assert.Empty(t, mockProvider.MockContainer.Caches)
+		assert.Equal(t, "golang:1.22", mockProvider.MockContainer.BaseImage)
+		assert.Contains(t, result.Details, "setup_duration")
+	})
+
+	t.Run("Monorepo", func(t *testing.T) {
+		mockProvider := monorepoMock()
+		engine := NewTestEngine(0, logger)
+		engine.SetContainerProvider(mockProvider)
+
+		result, err := engine.RunTests(context.Background(), "owner", "repo", "main")
+		require.NoError(t, err)
+		assert.Equal(t, "pnpm-store-owner-repo", mockProvider.MockContainer.Caches["/root/.local/share/pnpm/store"])
+		assert.Equal(t, "go-mod-owner-repo", mockProvider.MockContainer.Caches["/go/pkg/mod"])
+		assert.IsType(t, time.Duration(0), result.Details["setup_duration"])
+
+		perFramework := result.Details["frameworks"].(map[string]interface{})
+		assert.Contains(t, perFramework["nodejs (frontend)"], "setup_duration")
+	})
+}
+
+func TestRunTestsContainerSetupFailure(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+
+	mockProvider := NewMockContainerProvider()
+	engine := NewTestEngine(0, logger)
+	engine.SetContainerProvider(mockProvider)
+
+	framework := engine.testFrameworks["golang"]
+	mockProvider.MockContainer.ShouldFail = true
+	result := engine.runFrameworkPipeline(context.Background(), &MockContainerWrapper{mockProvider.MockContainer}, "owner/repo", framework, time.Now(), nil)
+
+	assert.False(t, result.Success)
+	assert.Equal(t, "setup", result.Details["stage"])
+	assert.Contains(t, result.Details, "setup_duration")
+}
+
+// TestRunCoverageAnalysisFallbacks tests the native coverage command of Go frameworks without
+// one, and coverage left unmeasured when no command reports it
+func TestRunCoverageAnalysisFallbacks(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.ErrorLevel)
+	ctx := context.Background()
+
+	mockProvider := NewMockContainerProvider()
+	mock := mockProvider.MockContainer
+	mock.SetCommandOutput("go test -coverprofile=coverage.out ./...", "ok  \texample.com/app\t0.01s\tcoverage: 72.5% of statements", "", 0, nil)
+	mock.SetCommandOutput("make coverage", "make: *** No rule to make target 'coverage'.  Stop.", "", 2, errors.New("exit status 2"))
+	engine := NewTestEngine(85, logger)
+	engine.SetContainerProvider(mockProvider)
+	container := &MockContainerWrapper{mock}
+
+	custom := &TestFramework{Name: "bazel-go", Language: "go"}
+	result, err := engine.runCoverageAnalysis(ctx, container, custom)
+	require.NoError(t, err)
+	assert.Equal(t, 72.5, result.Coverage)
+	assert.False(t, result.Unknown)
+	assert.Contains(t, mock.ExecHistory, []string{"go", "test", "-coverprofile=coverage.out", "./..."})
+	assert.Empty(t, custom.CoverageCommand, "the framework is not modified")
+
+	result, err = engine.runCoverageAnalysis(ctx, container, &TestFramework{Name: "shell", Language: "shell"})
+	require.NoError(t, err)
+	assert.True(t, result.Unknown)
+
+	result, err = engine.runCoverageAnalysis(ctx, container, &TestFramework{Name: "lua", CoverageCommand: "luacov"})
+	require.NoError(t, err)
+	assert.True(t, result.Unknown, "output without a coverage figure is not 0%")
+
+	// A run whose coverage tooling fails passes on its tests alone, unless coverage is required
+	mock.SetCommandOutput("make test", "--- PASS: TestParse (0.00s)\nPASS", "", 0, nil)
+	generic := engine.testFrameworks["generic"]
+	testResult := engine.runStages(ctx, container, generic, time.Now(), nil)
+	assert.Equal(t, 1, testResult.PassedTests)
+	assert.True(t, testResult.Success)
+	assert.True(t, testResult.CoverageUnknown)
+	assert.NotContains(t, testResult.Errors, "Coverage 0.00% below minimum 85.00%")
+
+	testResult = engine.WithRequireCoverage(true).runStages(ctx, container, generic, time.Now(), nil)
+	assert.False(t, testResult.Success)
+	assert.Contains(t, testResult.Errors, "Coverage not measured, but 85.00% is required")
+}
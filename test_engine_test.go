@@ -68,6 +68,21 @@ func TestGetFrameworkByFile(t *testing.T) {
 			filename:     "Cargo.toml",
 			expectResult: true,
 		},
+		{
+			name:         "Gradle Kotlin build",
+			filename:     "build.gradle.kts",
+			expectResult: true,
+		},
+		{
+			name:         ".NET project file",
+			filename:     "Orders.Api.csproj",
+			expectResult: true,
+		},
+		{
+			name:         "Ruby Gemfile",
+			filename:     "Gemfile",
+			expectResult: true,
+		},
 		{
 			name:         "Unknown file",
 			filename:     "unknown.txt",
@@ -204,175 +219,6 @@ func TestParseCoverageOutput(t *testing.T) {
 	}
 }
 
-// TestGenerateTestsForFix tests the GenerateTestsForFix method
-func TestGenerateTestsForFix(t *testing.T) {
-	logger := logrus.New()
-	engine := NewTestEngine(85, logger)
-	ctx := context.Background()
-
-	fix := &ProposedFix{
-		ID:   "test-fix",
-		Type: CodeFix,
-		Changes: []CodeChange{
-			{
-				Operation:  "modify",
-				FilePath:   "main.go",
-				NewContent: "package main",
-			},
-		},
-	}
-
-	analysis := &FailureAnalysisResult{
-		ID: "test-analysis",
-		Classification: FailureClassification{
-			Type: TestFailure,
-		},
-	}
-
-	tests, err := engine.GenerateTestsForFix(ctx, fix, analysis)
-
-	assert.NoError(t, err)
-	assert.NotNil(t, tests)
-	// The actual implementation may return different lengths
-	assert.GreaterOrEqual(t, len(tests), 0)
-}
-
-// TestGenerateCodeFixTests tests the generateCodeFixTests method
-func TestGenerateCodeFixTests(t *testing.T) {
-	logger := logrus.New()
-	engine := NewTestEngine(85, logger)
-
-	fix := &ProposedFix{
-		ID:   "code-fix",
-		Type: CodeFix,
-		Changes: []CodeChange{
-			{
-				Operation:  "modify",
-				FilePath:   "util.go",
-				NewContent: "func helper() {}",
-			},
-		},
-	}
-
-	analysis := &FailureAnalysisResult{
-		ID: "test-analysis",
-	}
-
-	tests := engine.generateCodeFixTests(fix, analysis)
-
-	assert.NotNil(t, tests)
-	assert.GreaterOrEqual(t, len(tests), 0)
-}
-
-// TestGenerateDependencyTests tests the generateDependencyTests method
-func TestGenerateDependencyTests(t *testing.T) {
-	logger := logrus.New()
-	engine := NewTestEngine(85, logger)
-
-	fix := &ProposedFix{
-		ID:   "dependency-fix",
-		Type: DependencyFix,
-		Changes: []CodeChange{
-			{
-				Operation:  "modify",
-				FilePath:   "package.json",
-				NewContent: `{"dependencies": {"lodash": "^4.17.21"}}`,
-			},
-		},
-	}
-
-	analysis := &FailureAnalysisResult{
-		ID: "test-analysis",
-	}
-
-	tests := engine.generateDependencyTests(fix, analysis)
-
-	assert.NotNil(t, tests)
-	assert.GreaterOrEqual(t, len(tests), 0)
-}
-
-// TestGenerateConfigurationTests tests the generateConfigurationTests method
-func TestGenerateConfigurationTests(t *testing.T) {
-	logger := logrus.New()
-	engine := NewTestEngine(85, logger)
-
-	fix := &ProposedFix{
-		ID:   "config-fix",
-		Type: ConfigurationFix,
-		Changes: []CodeChange{
-			{
-				Operation:  "modify",
-				FilePath:   ".github/workflows/test.yml",
-				NewContent: "name: Test\non: push",
-			},
-		},
-	}
-
-	analysis := &FailureAnalysisResult{
-		ID: "test-analysis",
-	}
-
-	tests := engine.generateConfigurationTests(fix, analysis)
-
-	assert.NotNil(t, tests)
-	assert.GreaterOrEqual(t, len(tests), 0)
-}
-
-// TestGenerateTestFixTests tests the generateTestFixTests method
-func TestGenerateTestFixTests(t *testing.T) {
-	logger := logrus.New()
-	engine := NewTestEngine(85, logger)
-
-	fix := &ProposedFix{
-		ID:   "test-fix",
-		Type: TestFix,
-		Changes: []CodeChange{
-			{
-				Operation:  "modify",
-				FilePath:   "main_test.go",
-				NewContent: "func TestExample(t *testing.T) {}",
-			},
-		},
-	}
-
-	analysis := &FailureAnalysisResult{
-		ID: "test-analysis",
-	}
-
-	tests := engine.generateTestFixTests(fix, analysis)
-
-	assert.NotNil(t, tests)
-	assert.GreaterOrEqual(t, len(tests), 0)
-}
-
-// TestGenerateRegressionTests tests the generateRegressionTests method
-func TestGenerateRegressionTests(t *testing.T) {
-	logger := logrus.New()
-	engine := NewTestEngine(85, logger)
-
-	fix := &ProposedFix{
-		ID:   "regression-fix",
-		Type: CodeFix,
-		Changes: []CodeChange{
-			{
-				Operation:  "modify",
-				FilePath:   "main.go",
-				NewContent: "func main() {}",
-			},
-		},
-	}
-
-	analysis := &FailureAnalysisResult{
-		ID:            "test-analysis",
-		AffectedFiles: []string{"main.go", "util.go"},
-	}
-
-	tests := engine.generateRegressionTests(fix, analysis)
-
-	assert.NotNil(t, tests)
-	assert.GreaterOrEqual(t, len(tests), 0)
-}
-
 // Test helper functions
 func TestLoadTestFrameworks(t *testing.T) {
 	frameworks := loadTestFrameworks()
@@ -462,7 +308,7 @@ func TestDetectFrameworkUnitCoverage(t *testing.T) {
 	ctx := context.Background()
 
 	// Test the function with nil container (defensive)
-	var framework *TestFramework
+	var frameworks []*TestFramework
 	var err error
 
 	func() {
@@ -472,18 +318,18 @@ func TestDetectFrameworkUnitCoverage(t *testing.T) {
 			}
 		}()
 		// This will fail but we're testing the error handling path
-		framework, err = engine.detectFramework(ctx, nil)
+		frameworks, err = engine.detectFramework(ctx, nil)
 	}()
 
 	// Validate error handling behavior
 	if err != nil {
 		// Expected with nil container
 		assert.Contains(t, err.Error(), "panic in detectFramework")
-		assert.Nil(t, framework)
-	} else if framework != nil {
+		assert.Nil(t, frameworks)
+	} else if len(frameworks) > 0 {
 		// If somehow it returns a framework, validate it
-		assert.NotNil(t, framework)
-		assert.NotEmpty(t, framework.Name)
+		assert.NotNil(t, frameworks[0])
+		assert.NotEmpty(t, frameworks[0].Name)
 	}
 
 	// Test edge case: empty getFrameworkByFile calls (already covered but adding for completeness)
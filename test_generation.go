@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// generatedTestFile is a test file as returned by the LLM
+type generatedTestFile struct {
+	FilePath string `json:"file_path"`
+	Content  string `json:"content"`
+}
+
+// GenerateTestsForFix asks the LLM for complete test files that exercise the fix and
+// returns them as new-file changes that can be added to the fix
+func (e *TestEngine) GenerateTestsForFix(ctx context.Context, fix *ProposedFix, analysis *FailureAnalysisResult) ([]CodeChange, error) {
+	if e.llmClient == nil {
+		return nil, fmt.Errorf("LLM client not configured for test generation")
+	}
+
+	e.logger.WithField("fix_id", fix.ID).Info("Generating tests for fix")
+
+	response, err := e.llmClient.Chat(ctx, &LLMRequest{
+		SystemMsg: e.testGenerationSystemPrompt(analysis),
+		Prompt:    e.buildTestGenerationPrompt(fix, analysis),
+		Context: map[string]interface{}{
+			"fix_id":   fix.ID,
+			"fix_type": fix.Type,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("test generation failed: %w", err)
+	}
+
+	tests, err := parseGeneratedTests(response.Content, fix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse generated tests: %w", err)
+	}
+
+	e.logger.WithFields(logrus.Fields{
+		"fix_id":     fix.ID,
+		"test_count": len(tests),
+	}).Info("Test generation completed")
+
+	return tests, nil
+}
+
+// testGenerationSystemPrompt renders the test generation system prompt, falling back to the
+// built-in template when a custom one fails to render
+func (e *TestEngine) testGenerationSystemPrompt(analysis *FailureAnalysisResult) string {
+	if analysis == nil {
+		analysis = &FailureAnalysisResult{}
+	}
+	data := newFixPromptData(analysis)
+	if e.prompts != nil {
+		prompt, err := e.prompts.render("test_generation.tmpl", data)
+		if err == nil {
+			return strings.TrimRight(prompt, "\n")
+		}
+		e.logger.WithError(err).Warn("Falling back to the built-in prompt template")
+	}
+	prompt, _ := builtinPromptTemplates.render("test_generation.tmpl", data)
+	return strings.TrimRight(prompt, "\n")
+}
+
+// buildTestGenerationPrompt describes the fix, the full contents of the files it changes
+// and the project's test framework
+func (e *TestEngine) buildTestGenerationPrompt(fix *ProposedFix, analysis *FailureAnalysisResult) string {
+	var prompt strings.Builder
+
+	prompt.WriteString("## Test Generation for Proposed Fix\n\n")
+	prompt.WriteString(fmt.Sprintf("**Fix**: %s\n", fix.Description))
+	prompt.WriteString(fmt.Sprintf("**Fix Type**: %s\n", fix.Type))
+	if analysis != nil {
+		prompt.WriteString(fmt.Sprintf("**Root Cause**: %s\n", analysis.RootCause))
+		if repo := analysis.Context.Repository; repo.Language != "" {
+			prompt.WriteString(fmt.Sprintf("**Language**: %s\n", repo.Language))
+		}
+	}
+	prompt.WriteString(fmt.Sprintf("**Test Framework**: %s\n", e.testFrameworkFor(fix, analysis)))
+	if names := e.failedTestNames(analysis); len(names) > 0 {
+		prompt.WriteString(fmt.Sprintf("**Failing Tests**: %s\n", strings.Join(names, ", ")))
+	}
+	prompt.WriteString("\n")
+
+	prompt.WriteString("## Changed Files\n\n")
+	for _, change := range fix.Changes {
+		prompt.WriteString(fmt.Sprintf("### %s (%s)\n\n", change.FilePath, change.Operation))
+		if change.Explanation != "" {
+			prompt.WriteString(change.Explanation + "\n\n")
+		}
+		if change.Operation != ChangeOperationDelete {
+			prompt.WriteString("```\n" + change.NewContent + "\n```\n\n")
+		}
+	}
+
+	prompt.WriteString("## Test Generation Instructions\n\n")
+	prompt.WriteString("Write complete test files that fail without the fix and pass with it.\n")
+	prompt.WriteString("1. Each file must compile on its own: include the package or module declaration and every import it uses\n")
+	prompt.WriteString("2. Use the package of the code under test and the project's existing test framework\n")
+	prompt.WriteString("3. Use new file paths that follow the project's test naming conventions; never overwrite the changed files\n")
+	prompt.WriteString("4. Do not leave placeholders or TODOs\n")
+	prompt.WriteString("\nFormat response as JSON array of objects with \"file_path\" and \"content\" fields.\n")
+
+	return prompt.String()
+}
+
+// testFrameworkFor names the framework the generated tests should use, preferring the
+// repository's detected framework over one inferred from the changed files
+func (e *TestEngine) testFrameworkFor(fix *ProposedFix, analysis *FailureAnalysisResult) string {
+	if analysis != nil && analysis.Context.Repository.Framework != "" {
+		return analysis.Context.Repository.Framework
+	}
+	for _, change := range fix.Changes {
+		if framework := e.getFrameworkByFile(path.Base(change.FilePath)); framework != nil {
+			return framework.Name
+		}
+	}
+	return "unknown"
+}
+
+// parseGeneratedTests extracts the test files from the LLM response. Files without a valid
+// path or content, or that would overwrite a file the fix changes, are skipped.
+func parseGeneratedTests(content string, fix *ProposedFix) ([]CodeChange, error) {
+	jsonStart := strings.Index(content, "[")
+	jsonEnd := strings.LastIndex(content, "]")
+	if jsonStart == -1 || jsonEnd < jsonStart {
+		return nil, fmt.Errorf("no JSON array of test files found")
+	}
+
+	var files []generatedTestFile
+	if err := json.Unmarshal([]byte(content[jsonStart:jsonEnd+1]), &files); err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]bool, len(fix.Changes))
+	for _, change := range fix.Changes {
+		changed[path.Clean(change.FilePath)] = true
+	}
+
+	var tests []CodeChange
+	for _, file := range files {
+		change := CodeChange{
+			FilePath:    file.FilePath,
+			NewContent:  file.Content,
+			Operation:   ChangeOperationAdd,
+			Explanation: fmt.Sprintf("Generated test for fix %s", fix.ID),
+		}
+		if strings.TrimSpace(file.Content) == "" || validateCodeChange(change) != nil || changed[path.Clean(file.FilePath)] {
+			continue
+		}
+		changed[path.Clean(file.FilePath)] = true
+		tests = append(tests, change)
+	}
+	return tests, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const generatedTestsResponse = "Here are the tests:\n```json\n" + `[
+  {"file_path": "parser/parser_fix_test.go", "content": "package parser\n\nimport \"testing\"\n\nfunc TestParseEmptyInput(t *testing.T) {\n\tif _, err := Parse(\"\"); err == nil {\n\t\tt.Fatal(\"expected error\")\n\t}\n}\n"},
+  {"file_path": "../escape_test.go", "content": "package main"},
+  {"file_path": "parser/parser.go", "content": "package parser"},
+  {"file_path": "parser/empty_test.go", "content": "  "}
+]` + "\n```"
+
+func parserFix() *ProposedFix {
+	return &ProposedFix{
+		ID:          "fix1",
+		Type:        CodeFix,
+		Description: "Reject empty input",
+		Changes: []CodeChange{{
+			FilePath:    "parser/parser.go",
+			Operation:   ChangeOperationModify,
+			NewContent:  "package parser\n\nfunc Parse(s string) (int, error) { return 0, nil }\n",
+			Explanation: "Return an error for empty input",
+		}},
+	}
+}
+
+// TestGenerateTestsForFix tests generating test files with the LLM
+func TestGenerateTestsForFix(t *testing.T) {
+	ctx := context.Background()
+	analysis := &FailureAnalysisResult{
+		ID:        "a1",
+		RootCause: "Parse accepts empty input",
+		Context:   FailureContext{Repository: RepositoryContext{Language: "Go", Framework: "golang"}},
+	}
+
+	t.Run("ParsesTestFiles", func(t *testing.T) {
+		llm := &mockLLMClient{response: &LLMResponse{Content: generatedTestsResponse}}
+		engine := NewTestEngine(85, quietLogger())
+		engine.SetLLMClient(llm)
+
+		tests, err := engine.GenerateTestsForFix(ctx, parserFix(), analysis)
+		require.NoError(t, err)
+		require.Len(t, tests, 1, "invalid, empty and overwriting files are skipped")
+		assert.Equal(t, "parser/parser_fix_test.go", tests[0].FilePath)
+		assert.Equal(t, ChangeOperationAdd, tests[0].Operation)
+		assert.Contains(t, tests[0].NewContent, "func TestParseEmptyInput(t *testing.T)")
+
+		require.Len(t, llm.requests, 1)
+		prompt := llm.requests[0].Prompt
+		assert.Contains(t, prompt, "**Test Framework**: golang\n")
+		assert.Contains(t, prompt, "### parser/parser.go (modify)")
+		assert.Contains(t, prompt, "func Parse(s string) (int, error)")
+		assert.Contains(t, llm.requests[0].SystemMsg, "compilable test files")
+	})
+
+	t.Run("FrameworkFromChangedFiles", func(t *testing.T) {
+		engine := NewTestEngine(85, quietLogger())
+		fix := &ProposedFix{Changes: []CodeChange{{FilePath: "web/package.json", Operation: ChangeOperationModify}}}
+		assert.Equal(t, "nodejs", engine.testFrameworkFor(fix, &FailureAnalysisResult{}))
+	})
+
+	t.Run("NoLLMClient", func(t *testing.T) {
+		engine := NewTestEngine(85, quietLogger())
+		_, err := engine.GenerateTestsForFix(ctx, parserFix(), analysis)
+		assert.ErrorContains(t, err, "LLM client not configured")
+	})
+
+	t.Run("UnparseableResponse", func(t *testing.T) {
+		engine := NewTestEngine(85, quietLogger())
+		engine.SetLLMClient(&mockLLMClient{response: &LLMResponse{Content: "I cannot write tests for this."}})
+		_, err := engine.GenerateTestsForFix(ctx, parserFix(), analysis)
+		assert.ErrorContains(t, err, "failed to parse generated tests")
+	})
+}
+
+// TestAutoFixWithGeneratedTests tests adding generated tests to the fix PR
+func TestAutoFixWithGeneratedTests(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("TestsPassAreIncluded", func(t *testing.T) {
+		var prFixes []*FixValidationResult
+		m := fixtureAutofix(&prFixes).WithGeneratedTests(true)
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, prFixes, 1)
+
+		fix := prFixes[0].Fix
+		require.Len(t, fix.Changes, 2)
+		assert.Equal(t, "parser/parser.go", fix.Changes[0].FilePath)
+		assert.Equal(t, "parser/parser_fix_test.go", fix.Changes[1].FilePath)
+		assert.Equal(t, []string{"parser/parser_fix_test.go"}, fix.GeneratedTests)
+		assert.Equal(t, []string{"parser/parser_fix_test.go"}, res.Metadata["generated_tests"])
+	})
+
+	t.Run("FailingTestsAreDropped", func(t *testing.T) {
+		var prFixes []*FixValidationResult
+		m := fixtureAutofix(&prFixes).WithGeneratedTests(true)
+		m.testEngine.(*mockTestEngine).runTestsWithChangesFunc = func(ctx context.Context, source *dagger.Directory, changes []CodeChange) (*TestResult, error) {
+			if len(changes) > 1 {
+				return &TestResult{Success: false, FailedTests: 1, Coverage: 90}, nil
+			}
+			return &TestResult{Success: true, Coverage: 90}, nil
+		}
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.True(t, res.Success)
+		require.Len(t, prFixes, 1)
+		assert.Len(t, prFixes[0].Fix.Changes, 1)
+		assert.Empty(t, prFixes[0].Fix.GeneratedTests)
+	})
+
+	t.Run("GenerationErrorKeepsFix", func(t *testing.T) {
+		var prFixes []*FixValidationResult
+		m := fixtureAutofix(&prFixes).WithGeneratedTests(true)
+		m.testEngine.(*mockTestEngine).generateTestsFunc = func(ctx context.Context, fix *ProposedFix, analysis *FailureAnalysisResult) ([]CodeChange, error) {
+			return nil, errors.New("rate limited")
+		}
+
+		_, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, prFixes, 1)
+		assert.Len(t, prFixes[0].Fix.Changes, 1)
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		var prFixes []*FixValidationResult
+		m := fixtureAutofix(&prFixes)
+		m.testEngine.(*mockTestEngine).generateTestsFunc = func(ctx context.Context, fix *ProposedFix, analysis *FailureAnalysisResult) ([]CodeChange, error) {
+			t.Fatal("tests should not be generated")
+			return nil, nil
+		}
+
+		res, err := m.AutoFix(ctx, 1)
+		require.NoError(t, err)
+		assert.NotContains(t, res.Metadata, "generated_tests")
+		assert.Len(t, prFixes[0].Fix.Changes, 1)
+	})
+}
+
+// TestPRBodyListsGeneratedTests verifies generated test files get their own PR body section
+func TestPRBodyListsGeneratedTests(t *testing.T) {
+	engine := NewPullRequestEngine(nil, quietLogger())
+
+	fix := parserFix()
+	fix.GeneratedTests = []string{"parser/parser_fix_test.go"}
+	body := engine.generatePRBody(&FailureAnalysisResult{ID: "a1"}, &FixValidationResult{Fix: fix, TestResult: &TestResult{Success: true}})
+	assert.Contains(t, body, "## 🧬 Generated Tests\n\nThese tests were generated for this fix and pass with it applied:\n\n- `parser/parser_fix_test.go`\n")
+
+	body = engine.generatePRBody(&FailureAnalysisResult{ID: "a1"}, &FixValidationResult{Fix: parserFix(), TestResult: &TestResult{Success: true}})
+	assert.NotContains(t, body, "Generated Tests")
+}
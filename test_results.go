@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// goTestEvent is a single line of `go test -json` output
+type goTestEvent struct {
+	Action  string  `json:"Action"`
+	Package string  `json:"Package"`
+	Test    string  `json:"Test"`
+	Elapsed float64 `json:"Elapsed"`
+	Output  string  `json:"Output"`
+}
+
+// parseGoTestJSON parses `go test -json` output into test cases. It reports false when the
+// output contains no test events, so callers can fall back to text parsing.
+func parseGoTestJSON(output string) ([]TestCase, bool) {
+	var cases []TestCase
+	found := false
+	testOutput := make(map[string]*strings.Builder)
+	failedTests := make(map[string]bool)
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+
+		var event goTestEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil || event.Action == "" {
+			continue
+		}
+		found = true
+
+		key := event.Package + "/" + event.Test
+		switch event.Action {
+		case "output":
+			if event.Test == "" || isGoTestMarker(event.Output) {
+				continue
+			}
+			if testOutput[key] == nil {
+				testOutput[key] = &strings.Builder{}
+			}
+			testOutput[key].WriteString(event.Output)
+		case "pass", "fail", "skip":
+			if event.Test == "" {
+				// A package that fails without any failing test did not build or panicked
+				// outside a test, which is still a failure worth reporting
+				if event.Action == "fail" && !failedTests[event.Package] {
+					cases = append(cases, TestCase{
+						Name:     event.Package,
+						Suite:    event.Package,
+						Status:   TestCaseFailed,
+						Duration: secondsToDuration(event.Elapsed),
+						Message:  "package failed",
+					})
+				}
+				continue
+			}
+
+			testCase := TestCase{
+				Name:     event.Test,
+				Suite:    event.Package,
+				Status:   goTestStatus(event.Action),
+				Duration: secondsToDuration(event.Elapsed),
+			}
+			if testCase.Status == TestCaseFailed {
+				failedTests[event.Package] = true
+				if out := testOutput[key]; out != nil {
+					testCase.Message = strings.TrimSpace(out.String())
+				}
+			}
+			cases = append(cases, testCase)
+		}
+	}
+
+	return cases, found
+}
+
+// isGoTestMarker reports whether a test output line is one of go test's own status lines
+func isGoTestMarker(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	for _, prefix := range []string{"=== RUN", "=== PAUSE", "=== CONT", "--- PASS:", "--- FAIL:", "--- SKIP:"} {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func goTestStatus(action string) TestCaseStatus {
+	switch action {
+	case "pass":
+		return TestCasePassed
+	case "skip":
+		return TestCaseSkipped
+	default:
+		return TestCaseFailed
+	}
+}
+
+// parseGoTestLine parses a verbose `go test` result line such as "--- FAIL: TestName (0.01s)"
+func parseGoTestLine(line string) (TestCase, bool) {
+	trimmed := strings.TrimSpace(line)
+
+	var status TestCaseStatus
+	switch {
+	case strings.HasPrefix(trimmed, "--- PASS:"):
+		status = TestCasePassed
+	case strings.HasPrefix(trimmed, "--- FAIL:"):
+		status = TestCaseFailed
+	case strings.HasPrefix(trimmed, "--- SKIP:"):
+		status = TestCaseSkipped
+	default:
+		return TestCase{}, false
+	}
+
+	fields := strings.Fields(trimmed[len("--- PASS:"):])
+	if len(fields) == 0 {
+		return TestCase{}, false
+	}
+
+	testCase := TestCase{Name: fields[0], Status: status}
+	if len(fields) > 1 {
+		elapsed := strings.TrimSuffix(strings.TrimPrefix(fields[1], "("), ")")
+		if duration, err := time.ParseDuration(elapsed); err == nil {
+			testCase.Duration = duration
+		}
+	}
+	return testCase, true
+}
+
+// parseJestFailureLine parses a Jest failure heading such as "● Suite › does a thing"
+func parseJestFailureLine(line string) (TestCase, bool) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "●") {
+		return TestCase{}, false
+	}
+
+	name := strings.TrimSpace(strings.TrimPrefix(trimmed, "●"))
+	if name == "" || strings.HasPrefix(name, "Console") {
+		return TestCase{}, false
+	}
+	return TestCase{Name: name, Status: TestCaseFailed}, true
+}
+
+// JUnit XML report structure, as written by surefire, pytest --junitxml and most other runners
+type junitTestSuites struct {
+	Suites []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name   string           `xml:"name,attr"`
+	Cases  []junitTestCase  `xml:"testcase"`
+	Suites []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure"`
+	Error     *junitProblem `xml:"error"`
+	Skipped   *junitProblem `xml:"skipped"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// parseJUnitXML parses a JUnit XML report whose root is either <testsuites> or <testsuite>
+func parseJUnitXML(report string) ([]TestCase, error) {
+	decoder := xml.NewDecoder(strings.NewReader(report))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no testsuite element found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JUnit report: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "testsuites":
+			var suites junitTestSuites
+			if err := decoder.DecodeElement(&suites, &start); err != nil {
+				return nil, fmt.Errorf("failed to parse JUnit report: %w", err)
+			}
+			var cases []TestCase
+			for _, suite := range suites.Suites {
+				cases = append(cases, suite.testCases()...)
+			}
+			return cases, nil
+		case "testsuite":
+			var suite junitTestSuite
+			if err := decoder.DecodeElement(&suite, &start); err != nil {
+				return nil, fmt.Errorf("failed to parse JUnit report: %w", err)
+			}
+			return suite.testCases(), nil
+		default:
+			return nil, fmt.Errorf("unexpected JUnit report root element %q", start.Name.Local)
+		}
+	}
+}
+
+// testCases flattens a suite and its nested suites into test cases
+func (s junitTestSuite) testCases() []TestCase {
+	var cases []TestCase
+	for _, c := range s.Cases {
+		suite := c.ClassName
+		if suite == "" {
+			suite = s.Name
+		}
+
+		testCase := TestCase{
+			Name:   c.Name,
+			Suite:  suite,
+			Status: TestCasePassed,
+		}
+		if seconds, err := strconv.ParseFloat(strings.TrimSpace(c.Time), 64); err == nil {
+			testCase.Duration = secondsToDuration(seconds)
+		}
+
+		switch {
+		case c.Failure != nil:
+			testCase.Status = TestCaseFailed
+			testCase.Message = c.Failure.summary()
+		case c.Error != nil:
+			testCase.Status = TestCaseFailed
+			testCase.Message = c.Error.summary()
+		case c.Skipped != nil:
+			testCase.Status = TestCaseSkipped
+			testCase.Message = c.Skipped.summary()
+		}
+		cases = append(cases, testCase)
+	}
+
+	for _, nested := range s.Suites {
+		cases = append(cases, nested.testCases()...)
+	}
+	return cases
+}
+
+// summary prefers the message attribute and falls back to the element text
+func (p *junitProblem) summary() string {
+	if p.Message != "" {
+		return p.Message
+	}
+	return strings.TrimSpace(p.Text)
+}
+
+// statsFromCases counts test cases by status
+func statsFromCases(cases []TestCase) TestStats {
+	stats := TestStats{Cases: cases}
+	for _, testCase := range cases {
+		switch testCase.Status {
+		case TestCasePassed:
+			stats.Passed++
+		case TestCaseFailed:
+			stats.Failed++
+		case TestCaseSkipped:
+			stats.Skipped++
+		}
+	}
+	stats.Total = len(cases)
+	return stats
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// collectTestReports reads the JUnit XML reports the framework writes after a test run.
+// Report paths may be shell globs; missing reports are skipped.
+func (e *TestEngine) collectTestReports(ctx context.Context, container ContainerInterface, framework *TestFramework) []string {
+	var reports []string
+	for _, pattern := range framework.ReportPaths {
+		paths := []string{pattern}
+		if strings.ContainsAny(pattern, "*?[") {
+			listing, err := container.WithExec([]string{"sh", "-c", "ls -1 " + pattern}).Stdout(ctx)
+			if err != nil {
+				e.logger.WithError(err).WithField("pattern", pattern).Debug("No test reports found")
+				continue
+			}
+			paths = strings.Fields(listing)
+		}
+
+		for _, reportPath := range paths {
+			contents, err := container.File(reportPath).Contents(ctx)
+			if err != nil {
+				e.logger.WithError(err).WithField("path", reportPath).Debug("Failed to read test report")
+				continue
+			}
+			reports = append(reports, contents)
+		}
+	}
+	return reports
+}
+
+// testStats builds test statistics from JUnit reports when they contain any test cases,
+// and from the test command's output otherwise
+func (e *TestEngine) testStats(output string, reports []string, framework *TestFramework) TestStats {
+	var cases []TestCase
+	for _, report := range reports {
+		reportCases, err := parseJUnitXML(report)
+		if err != nil {
+			e.logger.WithError(err).Warn("Failed to parse test report")
+			continue
+		}
+		cases = append(cases, reportCases...)
+	}
+
+	if len(cases) > 0 {
+		return statsFromCases(cases)
+	}
+	return e.parseTestOutput(output, framework)
+}
+
+// failedTestNames returns the names of the tests that failed in the analysed workflow logs
+func (e *TestEngine) failedTestNames(analysis *FailureAnalysisResult) []string {
+	if analysis == nil || analysis.Context.Logs == nil {
+		return nil
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	for _, testCase := range e.parseTestOutput(analysis.Context.Logs.RawLogs, nil).Cases {
+		if testCase.Status == TestCaseFailed && !seen[testCase.Name] {
+			seen[testCase.Name] = true
+			names = append(names, testCase.Name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readTestResultFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "test-results", name))
+	require.NoError(t, err)
+	return string(data)
+}
+
+// TestParseGoTestJSON tests per-test results from go test -json output
+func TestParseGoTestJSON(t *testing.T) {
+	engine := NewTestEngine(85, quietLogger())
+
+	stats := engine.parseTestOutput(readTestResultFixture(t, "go-test.json"), loadTestFrameworks()["golang"])
+	assert.Equal(t, 4, stats.Total)
+	assert.Equal(t, 1, stats.Passed)
+	assert.Equal(t, 2, stats.Failed)
+	assert.Equal(t, 1, stats.Skipped)
+
+	require.Len(t, stats.Cases, 4)
+	assert.Equal(t, TestCase{
+		Name:     "TestParse",
+		Suite:    "example.com/app/parser",
+		Status:   TestCasePassed,
+		Duration: 10 * time.Millisecond,
+	}, stats.Cases[0])
+	assert.Equal(t, "TestParseEmpty", stats.Cases[1].Name)
+	assert.Equal(t, TestCaseFailed, stats.Cases[1].Status)
+	assert.Equal(t, "parser_test.go:42: expected error for empty input, got nil", stats.Cases[1].Message)
+	assert.Equal(t, TestCaseSkipped, stats.Cases[2].Status)
+
+	// A package that fails to build is reported as a failed case of its own
+	assert.Equal(t, "example.com/app/broken", stats.Cases[3].Name)
+	assert.Equal(t, TestCaseFailed, stats.Cases[3].Status)
+
+	_, ok := parseGoTestJSON("--- PASS: TestExample (0.00s)\nPASS")
+	assert.False(t, ok)
+}
+
+// TestParseJUnitXML tests JUnit reports from pytest and maven surefire
+func TestParseJUnitXML(t *testing.T) {
+	t.Run("Pytest", func(t *testing.T) {
+		cases, err := parseJUnitXML(readTestResultFixture(t, "pytest-junit.xml"))
+		require.NoError(t, err)
+		require.Len(t, cases, 5)
+
+		stats := statsFromCases(cases)
+		assert.Equal(t, TestStats{Total: 5, Passed: 2, Failed: 2, Skipped: 1, Cases: cases}, stats)
+
+		assert.Equal(t, "test_expired_token", cases[2].Name)
+		assert.Equal(t, "tests.test_auth", cases[2].Suite)
+		assert.Equal(t, "AssertionError: assert 200 == 401", cases[2].Message)
+		assert.Equal(t, 21*time.Millisecond, cases[2].Duration)
+		assert.Equal(t, `failed on setup with "ConnectionRefusedError"`, cases[3].Message)
+		assert.Equal(t, "requires sqlite", cases[4].Message)
+	})
+
+	t.Run("Surefire", func(t *testing.T) {
+		cases, err := parseJUnitXML(readTestResultFixture(t, "surefire-TEST-com.example.CalculatorTest.xml"))
+		require.NoError(t, err)
+		require.Len(t, cases, 3)
+
+		assert.Equal(t, TestCasePassed, cases[0].Status)
+		assert.Equal(t, "testDivideByZero", cases[2].Name)
+		assert.Equal(t, "com.example.CalculatorTest", cases[2].Suite)
+		assert.Equal(t, TestCaseFailed, cases[2].Status)
+		assert.Equal(t, "expected: <ArithmeticException> but was: <null>", cases[2].Message)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := parseJUnitXML("not xml")
+		assert.Error(t, err)
+		_, err = parseJUnitXML("<coverage/>")
+		assert.Error(t, err)
+	})
+}
+
+// TestParseJestSummary tests counts and failed test names from Jest output
+func TestParseJestSummary(t *testing.T) {
+	engine := NewTestEngine(85, quietLogger())
+
+	stats := engine.parseTestOutput(readTestResultFixture(t, "jest-summary.txt"), loadTestFrameworks()["nodejs"])
+	assert.Equal(t, 12, stats.Total)
+	assert.Equal(t, 9, stats.Passed)
+	assert.Equal(t, 2, stats.Failed)
+	assert.Equal(t, 1, stats.Skipped)
+
+	require.Len(t, stats.Cases, 2)
+	assert.Equal(t, "ApiClient › retries failed requests", stats.Cases[0].Name)
+	assert.Equal(t, TestCaseFailed, stats.Cases[1].Status)
+}
+
+// TestRunTestsCollectsJUnitReports verifies reports written by the test command become test cases
+func TestRunTestsCollectsJUnitReports(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	mockProvider := NewMockContainerProvider()
+	mock := mockProvider.MockContainer
+	mock.FileSystem = map[string]string{
+		"pom.xml": `<project></project>`,
+		"target/surefire-reports/TEST-com.example.CalculatorTest.xml": readTestResultFixture(t, "surefire-TEST-com.example.CalculatorTest.xml"),
+	}
+	mock.SetCommandOutput("sh -c ls -1 target/surefire-reports/TEST-*.xml",
+		"target/surefire-reports/TEST-com.example.CalculatorTest.xml\n", "", 0, nil)
+	mock.SetCommandOutput("mvn test", "[ERROR] Tests run: 3, Failures: 1", "", 1, assert.AnError)
+
+	engine := NewTestEngine(0, logger)
+	engine.SetContainerProvider(mockProvider)
+
+	result, err := engine.RunTests(context.Background(), "owner", "repo", "main")
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, "test", result.Details["stage"])
+	assert.Equal(t, 3, result.TotalTests)
+	assert.Equal(t, 1, result.FailedTests)
+
+	failed := result.FailedCases()
+	require.Len(t, failed, 1)
+	assert.Equal(t, "testDivideByZero", failed[0].Name)
+}
+
+// TestTestGenerationPromptNamesFailedTests verifies the tests that failed are named in the test generation prompt
+func TestTestGenerationPromptNamesFailedTests(t *testing.T) {
+	engine := NewTestEngine(85, quietLogger())
+
+	analysis := &FailureAnalysisResult{
+		ID: "analysis1",
+		Context: FailureContext{
+			Logs: &WorkflowLogs{RawLogs: "=== RUN   TestParse\n--- PASS: TestParse (0.00s)\n" +
+				"=== RUN   TestParseEmpty\n--- FAIL: TestParseEmpty (0.01s)\n" +
+				"    --- FAIL: TestParseEmpty/nil_input (0.00s)\nFAIL"},
+		},
+	}
+
+	assert.Equal(t, []string{"TestParseEmpty", "TestParseEmpty/nil_input"}, engine.failedTestNames(analysis))
+
+	prompt := engine.buildTestGenerationPrompt(&ProposedFix{ID: "fix1", Type: CodeFix}, analysis)
+	assert.Contains(t, prompt, "**Failing Tests**: TestParseEmpty, TestParseEmpty/nil_input\n")
+	assert.NotContains(t, engine.buildTestGenerationPrompt(&ProposedFix{ID: "fix1"}, &FailureAnalysisResult{}), "Failing Tests")
+}
+
+// TestPRBodyListsFailedTests verifies failed test names appear in the validation section
+func TestPRBodyListsFailedTests(t *testing.T) {
+	engine := NewPullRequestEngine(nil, quietLogger())
+
+	body := engine.generatePRBody(&FailureAnalysisResult{ID: "a1"}, &FixValidationResult{
+		Fix: &ProposedFix{ID: "f1"},
+		TestResult: &TestResult{
+			FailedTests: 1,
+			Cases: []TestCase{
+				{Name: "TestParse", Status: TestCasePassed},
+				{Name: "TestParseEmpty", Status: TestCaseFailed, Message: "parser_test.go:42: expected error\nmore detail"},
+			},
+		},
+	})
+
+	assert.Contains(t, body, "**Failed Tests**:\n- `TestParseEmpty`: parser_test.go:42: expected error\n")
+	assert.NotContains(t, body, "`TestParse`")
+}
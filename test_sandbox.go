@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TestNetwork decides how much network the repository's commands get in test containers.
+// Dagger v0.11 cannot take the network away from a command, so the policy is enforced by
+// pointing the proxy variables at a closed port and switching package managers to offline
+// mode. Tools that honor neither, or open sockets themselves, still reach the network.
+type TestNetwork string
+
+const (
+	// TestNetworkFull leaves the network alone; it is the default
+	TestNetworkFull TestNetwork = "full"
+	// TestNetworkRestricted lets setup commands install dependencies, then cuts the network
+	// off for the pipeline stages and validation steps
+	TestNetworkRestricted TestNetwork = "restricted"
+	// TestNetworkNone cuts the network off before the setup commands run
+	TestNetworkNone TestNetwork = "none"
+)
+
+// validateTestNetwork checks a test network policy; empty is full
+func validateTestNetwork(network TestNetwork) error {
+	switch network {
+	case "", TestNetworkFull, TestNetworkRestricted, TestNetworkNone:
+		return nil
+	default:
+		return fmt.Errorf("unsupported test network %q (expected none, restricted or full)", network)
+	}
+}
+
+// offlineProxy is a closed port the proxy variables point at, so proxy-aware tools fail fast
+const offlineProxy = "http://127.0.0.1:9"
+
+// offlineEnv cuts proxy-aware tools and package managers off from the network
+var offlineEnv = map[string]string{
+	"HTTP_PROXY":         offlineProxy,
+	"HTTPS_PROXY":        offlineProxy,
+	"ALL_PROXY":          offlineProxy,
+	"http_proxy":         offlineProxy,
+	"https_proxy":        offlineProxy,
+	"all_proxy":          offlineProxy,
+	"NO_PROXY":           "",
+	"no_proxy":           "",
+	"GOPROXY":            "off",
+	"npm_config_offline": "true",
+	"PIP_NO_INDEX":       "1",
+	"CARGO_NET_OFFLINE":  "true",
+}
+
+// credentialEnvVars are the well-known credential variables that are never set in plaintext
+// in test containers and are unset in toolchain images that bake them in
+var credentialEnvVars = []string{
+	"GITHUB_TOKEN", "GH_TOKEN", "GITHUB_PAT", "GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN",
+	"ACTIONS_RUNTIME_TOKEN", "ACTIONS_ID_TOKEN_REQUEST_TOKEN",
+	"NPM_TOKEN", "NODE_AUTH_TOKEN", "TWINE_PASSWORD", "PYPI_TOKEN", "POETRY_PYPI_TOKEN_PYPI",
+	"CARGO_REGISTRY_TOKEN", "GEM_HOST_API_KEY", "NUGET_API_KEY", "DOCKER_PASSWORD",
+	"OPENAI_API_KEY", "ANTHROPIC_API_KEY", "GEMINI_API_KEY", "DEEPSEEK_API_KEY", "LLM_API_KEY",
+}
+
+// isCredentialEnvVar tells whether name is a well-known credential variable, in any case
+func isCredentialEnvVar(name string) bool {
+	for _, credential := range credentialEnvVars {
+		if strings.EqualFold(name, credential) {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutCredentials returns env without the well-known credential variables, logging the
+// ones dropped from source. Credentials the tests need are given with WithContainerSecrets.
+func (e *TestEngine) withoutCredentials(env map[string]string, source string) map[string]string {
+	var dropped []string
+	scrubbed := make(map[string]string, len(env))
+	for key, value := range env {
+		if isCredentialEnvVar(key) {
+			dropped = append(dropped, key)
+			continue
+		}
+		scrubbed[key] = value
+	}
+	if len(dropped) > 0 {
+		sort.Strings(dropped)
+		e.logger.WithFields(logrus.Fields{
+			"source":    source,
+			"variables": dropped,
+		}).Warn("Dropped credential variables from the test container environment")
+	}
+	return scrubbed
+}
+
+// publishCommandPattern matches commands that publish packages or images, which repository
+// commands must not do from a fix's test run
+var publishCommandPattern = regexp.MustCompile(`\b(?:` + strings.Join([]string{
+	`(?:npm|yarn|pnpm|poetry|flit|hatch|cargo|vsce|ovsx)\s+publish`,
+	`twine\s+upload`,
+	`gem\s+push`,
+	`(?:dotnet\s+)?nuget\s+push`,
+	`(?:docker|podman|helm)\s+push`,
+	`mvn\b.*\bdeploy`,
+	`(?:gradle|gradlew)\b.*\bpublish`,
+	`gh\s+release\s+(?:create|upload)`,
+	`goreleaser\s+release`,
+}, "|") + `)\b`)
+
+// publishCommand returns the part of command that publishes packages, empty when it does not
+func publishCommand(command string) string {
+	return publishCommandPattern.FindString(command)
+}
+
+// WithNetwork sets the network policy of the repository's commands in test containers
+func (e *TestEngine) WithNetwork(network TestNetwork) *TestEngine {
+	e.network = network
+	return e
+}
+
+// WithPublishCommands allows repository commands that publish packages or images, which are
+// rejected by default
+func (e *TestEngine) WithPublishCommands(allowed bool) *TestEngine {
+	e.publishAllowed = allowed
+	return e
+}
+
+// checkPublishCommands rejects a repository test config whose setup or pipeline commands
+// publish packages, unless publishing is allowed
+func (e *TestEngine) checkPublishCommands(config *testContainerConfig) error {
+	if e.publishAllowed || config == nil {
+		return nil
+	}
+	configs := []*testContainerConfig{config}
+	for _, name := range sortedKeys(config.Frameworks) {
+		override := config.Frameworks[name]
+		configs = append(configs, &override)
+	}
+	for _, c := range configs {
+		commands := append([]string{c.Commands.Test, c.Commands.Build, c.Commands.Lint, c.Commands.Coverage}, c.SetupCommands...)
+		for _, command := range commands {
+			if publish := publishCommand(command); publish != "" {
+				return fmt.Errorf("invalid %s: %q runs %s, publishing is disabled in test containers", testConfigFile, command, publish)
+			}
+		}
+	}
+	return nil
+}
+
+// withoutCredentialEnv unsets the credential variables a toolchain image may set
+func withoutCredentialEnv(container ContainerInterface) ContainerInterface {
+	for _, name := range credentialEnvVars {
+		container = container.WithoutEnvVariable(name)
+	}
+	return container
+}
+
+// withOfflineEnv cuts the network off for the commands run next in container
+func withOfflineEnv(container ContainerInterface) ContainerInterface {
+	for _, key := range sortedKeys(offlineEnv) {
+		container = container.WithEnvVariable(key, offlineEnv[key])
+	}
+	return container
+}
+
+// stepEnv returns a validation step's environment without credentials and, unless the
+// network is full, without the variables that cut it off
+func (e *TestEngine) stepEnv(step ValidationStep) map[string]string {
+	env := e.withoutCredentials(step.Environment, "validation step "+step.Name)
+	if e.network == TestNetworkRestricted || e.network == TestNetworkNone {
+		for key := range offlineEnv {
+			delete(env, key)
+		}
+	}
+	return env
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sandboxMock returns an isolated mock provider holding a Go repository with config as its
+// test config file
+func sandboxMock(config string) *MockContainerProvider {
+	mockProvider := NewMockContainerProvider()
+	mockProvider.Isolated = true
+	mock := mockProvider.MockContainer
+	mock.FileSystem = map[string]string{"go.mod": "module test\n\ngo 1.22"}
+	if config != "" {
+		mock.FileSystem[testConfigFile] = config
+	}
+	mock.SetCommandOutput("go test -json ./...", "PASS: 5 passed, 0 failed\nok\ttest\t0.005s", "", 0, nil)
+	return mockProvider
+}
+
+// assertNoCredentials asserts that a container has no credential variable set
+func assertNoCredentials(t *testing.T, container *MockDaggerContainer) {
+	t.Helper()
+	for key := range container.EnvVars {
+		assert.False(t, isCredentialEnvVar(key), "%s is set in %s", key, container.BaseImage)
+	}
+	assert.NotContains(t, container.EnvVars, "AUTOFIX_CLONE_REPO")
+}
+
+// TestCreateTestContainerFetchPhase tests that the token is only given to the container that
+// clones the repository, and the pipeline gets a fresh container with the workspace alone
+func TestCreateTestContainerFetchPhase(t *testing.T) {
+	mockProvider := sandboxMock("")
+	engine := NewTestEngine(85, quietLogger()).
+		WithContainerEnv(map[string]string{"HTTPS_PROXY": "http://proxy.corp.example:3128", "GH_TOKEN": "ghp_leaked"})
+	engine.SetContainerProvider(mockProvider)
+	engine.SetGitHubToken(&dagger.Secret{})
+
+	_, err := engine.createTestContainer(context.Background(), "owner", "repo", "autofix-test-1")
+	require.NoError(t, err)
+	require.Len(t, mockProvider.Containers, 2)
+	fetch, exec := mockProvider.Containers[0], mockProvider.Containers[1]
+
+	assert.Equal(t, []string{"GITHUB_TOKEN"}, fetch.SecretVars)
+	require.Len(t, fetch.ExecHistory, 1)
+	clone := strings.Join(fetch.ExecHistory[0], " ")
+	assert.Contains(t, clone, "x-access-token:${GITHUB_TOKEN}@${AUTOFIX_CLONE_HOST}")
+	assert.Contains(t, clone, `remote set-url origin "${AUTOFIX_CLONE_SCHEME}://${AUTOFIX_CLONE_HOST}/${AUTOFIX_CLONE_REPO}"`, "the token is not left in .git/config")
+	assert.NotContains(t, fetch.EnvVars, "GH_TOKEN")
+
+	assert.Empty(t, exec.SecretVars)
+	assert.Empty(t, exec.ExecHistory, "nothing runs in the container before the pipeline")
+	assert.Equal(t, []string{"/workspace"}, exec.Directories)
+	assert.Equal(t, "/workspace", exec.WorkingDir)
+	assert.Equal(t, "http://proxy.corp.example:3128", exec.EnvVars["HTTPS_PROXY"])
+	assertNoCredentials(t, exec)
+}
+
+// TestRunTestsSandbox tests that no container the repository's commands run in holds the
+// token or credential variables, and that publishing commands are refused
+func TestRunTestsSandbox(t *testing.T) {
+	steps := []ValidationStep{
+		{Name: "Vet", Command: "go vet ./...", Environment: map[string]string{"NPM_TOKEN": "npm_leaked", "CGO_ENABLED": "0"}},
+		{Name: "Release", Command: "npm publish --access public"},
+	}
+
+	t.Run("Containers", func(t *testing.T) {
+		mockProvider := sandboxMock("env:\n  GITHUB_TOKEN: ghp_leaked\n  GOFLAGS: -mod=mod\n")
+		engine := NewTestEngine(0, quietLogger()).
+			WithContainerSecrets(map[string]*dagger.Secret{"GOPRIVATE_TOKEN": {}})
+		engine.SetContainerProvider(mockProvider)
+		engine.SetGitHubToken(&dagger.Secret{})
+
+		result, err := engine.RunTests(context.Background(), "owner", "repo", "main", steps...)
+		require.NoError(t, err)
+		assert.True(t, result.Success)
+
+		containers := mockProvider.Containers
+		require.Greater(t, len(containers), 2)
+		assert.Equal(t, []string{"GITHUB_TOKEN"}, containers[0].SecretVars, "the fetch container clones with the token")
+		var ran []string
+		for _, container := range containers[1:] {
+			assert.NotContains(t, container.SecretVars, "GITHUB_TOKEN")
+			assertNoCredentials(t, container)
+			for _, args := range container.ExecHistory {
+				ran = append(ran, strings.Join(args, " "))
+			}
+		}
+		assert.Contains(t, ran, "go test -json ./...")
+		assert.Contains(t, ran, "go vet ./...")
+
+		stepsContainer := containers[len(containers)-1]
+		assert.Equal(t, "golang:1.22", stepsContainer.BaseImage)
+		assert.Equal(t, []string{"GOPRIVATE_TOKEN"}, stepsContainer.SecretVars, "configured secrets are still given")
+		assert.Equal(t, "-mod=mod", stepsContainer.EnvVars["GOFLAGS"])
+		assert.Equal(t, "0", stepsContainer.EnvVars["CGO_ENABLED"])
+
+		require.Len(t, result.Steps, 2)
+		assert.Equal(t, StepPassed, result.Steps[0].Status)
+		assert.Equal(t, StepSkipped, result.Steps[1].Status)
+		assert.Equal(t, "npm publish publishes packages, which is disabled in test containers", result.Steps[1].Note)
+		assert.NotContains(t, ran, "npm publish --access public")
+	})
+
+	t.Run("PublishAllowed", func(t *testing.T) {
+		mockProvider := sandboxMock("")
+		engine := NewTestEngine(0, quietLogger()).WithPublishCommands(true)
+		engine.SetContainerProvider(mockProvider)
+
+		result, err := engine.RunTests(context.Background(), "owner", "repo", "main", steps...)
+		require.NoError(t, err)
+		require.Len(t, result.Steps, 2)
+		assert.Equal(t, StepPassed, result.Steps[1].Status)
+	})
+
+	t.Run("PublishingConfig", func(t *testing.T) {
+		config := "frameworks:\n  golang:\n    setup:\n      - go mod download\n      - docker push ghcr.io/owner/repo:latest\n"
+		engine := NewTestEngine(0, quietLogger())
+		engine.SetContainerProvider(sandboxMock(config))
+		_, err := engine.RunTests(context.Background(), "owner", "repo", "main")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "docker push")
+
+		engine = NewTestEngine(0, quietLogger()).WithPublishCommands(true)
+		engine.SetContainerProvider(sandboxMock(config))
+		_, err = engine.RunTests(context.Background(), "owner", "repo", "main")
+		assert.NoError(t, err)
+	})
+}
+
+// TestRunTestsNetwork tests when each network policy cuts the repository's commands off
+func TestRunTestsNetwork(t *testing.T) {
+	config := "setup:\n  - go mod download\n"
+	// run returns the container the validation step ran in
+	run := func(t *testing.T, network TestNetwork) *MockDaggerContainer {
+		mockProvider := sandboxMock(config)
+		engine := NewTestEngine(0, quietLogger()).
+			WithNetwork(network).
+			WithContainerEnv(map[string]string{"HTTPS_PROXY": "http://proxy.corp.example:3128"})
+		engine.SetContainerProvider(mockProvider)
+		steps := []ValidationStep{{Name: "Vet", Command: "go vet ./...", Environment: map[string]string{"GOPROXY": "direct"}}}
+		_, err := engine.RunTests(context.Background(), "owner", "repo", "main", steps...)
+		require.NoError(t, err)
+		return mockProvider.Containers[len(mockProvider.Containers)-1]
+	}
+	lastIndex := func(ops []string, op string) int {
+		for i := len(ops) - 1; i >= 0; i-- {
+			if ops[i] == op {
+				return i
+			}
+		}
+		return -1
+	}
+
+	t.Run("Full", func(t *testing.T) {
+		steps := run(t, TestNetworkFull)
+		assert.Equal(t, "http://proxy.corp.example:3128", steps.EnvVars["HTTPS_PROXY"])
+		assert.Equal(t, "direct", steps.EnvVars["GOPROXY"])
+	})
+
+	t.Run("Restricted", func(t *testing.T) {
+		steps := run(t, TestNetworkRestricted)
+		assert.Equal(t, offlineProxy, steps.EnvVars["HTTPS_PROXY"])
+		assert.Equal(t, "off", steps.EnvVars["GOPROXY"], "steps cannot turn the network back on")
+		setupIdx := slices.Index(steps.Operations, "exec:sh -c go mod download")
+		require.NotEqual(t, -1, setupIdx)
+		offlineIdx := lastIndex(steps.Operations, "env:HTTPS_PROXY")
+		assert.Less(t, setupIdx, offlineIdx, "setup commands keep the network")
+		assert.Less(t, offlineIdx, slices.Index(steps.Operations, "exec:go vet ./..."))
+	})
+
+	t.Run("None", func(t *testing.T) {
+		steps := run(t, TestNetworkNone)
+		assert.Equal(t, offlineProxy, steps.EnvVars["HTTPS_PROXY"])
+		assert.Equal(t, "true", steps.EnvVars["npm_config_offline"])
+		assert.Less(t, lastIndex(steps.Operations, "env:HTTPS_PROXY"), slices.Index(steps.Operations, "exec:sh -c go mod download"))
+	})
+}
+
+// TestPublishCommand tests recognizing commands that publish packages or images
+func TestPublishCommand(t *testing.T) {
+	tests := map[string]string{
+		"npm publish":                         "npm publish",
+		"pnpm publish --no-git-checks":        "pnpm publish",
+		"python -m twine upload dist/*":       "twine upload",
+		"cargo publish --dry-run":             "cargo publish",
+		"./gradlew build publish":             "gradlew build publish",
+		"mvn -B deploy":                       "mvn -B deploy",
+		"docker build . && docker push img":   "docker push",
+		"gh release create v1.0.0":            "gh release create",
+		"npm test":                            "",
+		"make publish-docs-preview":           "",
+		"go test ./... -run TestPublishEvent": "",
+		"docker build -t app .":               "",
+	}
+	for command, expected := range tests {
+		assert.Equal(t, expected, publishCommand(command), command)
+	}
+}
+
+// TestValidateTestNetwork tests validating test network policies
+func TestValidateTestNetwork(t *testing.T) {
+	for _, network := range []TestNetwork{"", TestNetworkFull, TestNetworkRestricted, TestNetworkNone} {
+		assert.NoError(t, validateTestNetwork(network))
+	}
+	assert.Error(t, validateTestNetwork("offline"))
+}
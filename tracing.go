@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// tracerName identifies the agent's spans
+	tracerName = "github.com/tosin2013/dagger-autofix"
+	// defaultServiceName is reported when OTEL_SERVICE_NAME is not set
+	defaultServiceName = "github-autofix"
+	// traceShutdownTimeout bounds exporting the spans still batched when the agent exits
+	traceShutdownTimeout = 10 * time.Second
+)
+
+var (
+	setupTracingOnce sync.Once
+	// tracerProvider is the provider exporting spans, nil when tracing is disabled
+	tracerProvider *sdktrace.TracerProvider
+)
+
+// setupTracing installs an OTLP/HTTP trace exporter when OTEL_EXPORTER_OTLP_ENDPOINT is set.
+// Otherwise spans are no-ops. Spans are exported in batches in the background, and the
+// batch still pending is exported by shutdownTracing.
+func setupTracing(logger *logrus.Logger) {
+	setupTracingOnce.Do(func() {
+		endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if endpoint == "" {
+			return
+		}
+		serviceName := os.Getenv("OTEL_SERVICE_NAME")
+		if serviceName == "" {
+			serviceName = defaultServiceName
+		}
+		provider, err := newOTLPTracerProvider(context.Background(), serviceName)
+		if err != nil {
+			logger.WithError(err).Warn("Tracing disabled")
+			return
+		}
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+			logger.WithError(err).Warn("Failed to export traces")
+		}))
+		otel.SetTracerProvider(provider)
+		tracerProvider = provider
+		logger.WithField("endpoint", endpoint).Info("Exporting traces over OTLP")
+	})
+}
+
+// newOTLPTracerProvider returns a provider batching spans to the OTLP/HTTP collector
+// configured by the OTEL_EXPORTER_OTLP_* environment variables
+func newOTLPTracerProvider(ctx context.Context, serviceName string) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+	return newTracerProvider(sdktrace.NewBatchSpanProcessor(exporter), serviceName), nil
+}
+
+// newTracerProvider returns a provider sending the spans of serviceName to processor
+func newTracerProvider(processor sdktrace.SpanProcessor, serviceName string) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
+}
+
+// shutdownTracing exports the spans not exported yet and stops the exporter. It is called
+// once the agent exits.
+func shutdownTracing() {
+	if tracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), traceShutdownTimeout)
+	defer cancel()
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		otel.Handle(err)
+	}
+}
+
+// startSpan starts a span named name as a child of the span in ctx
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan ends span, marking it failed when err is set
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -2,13 +2,20 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"dagger.io/dagger"
 	"github.com/google/go-github/v45/github"
 	"github.com/sirupsen/logrus"
+	"github.com/tosin2013/dagger-autofix/pkg/autofix"
 	"golang.org/x/oauth2"
 )
 
@@ -24,6 +31,9 @@ type WorkflowRun struct {
 	UpdatedAt  time.Time `json:"updated_at"`
 	URL        string    `json:"url"`
 	JobsURL    string    `json:"jobs_url"`
+	RunAttempt int       `json:"run_attempt"`
+	Event      string    `json:"event,omitempty"` // what triggered the run, e.g. push or pull_request
+	WorkflowID int64     `json:"workflow_id,omitempty"`
 }
 
 // WorkflowLogs represents the logs from a workflow run
@@ -32,23 +42,47 @@ type WorkflowLogs struct {
 	JobLogs    map[string]string `json:"job_logs"`
 	StepLogs   map[string]string `json:"step_logs"`
 	ErrorLines []string          `json:"error_lines"`
+	// FailedJobs names the jobs that failed, in the order GitHub lists them, and
+	// JobErrorLines holds each job's share of ErrorLines
+	FailedJobs    []string            `json:"failed_jobs,omitempty"`
+	JobErrorLines map[string][]string `json:"job_error_lines,omitempty"`
+	// Annotations are the check run annotations of the run's jobs
+	Annotations []Annotation `json:"annotations,omitempty"`
+	// FailedSteps are the failed steps of the failed jobs, in order
+	FailedSteps []FailedStep `json:"failed_steps,omitempty"`
 }
 
-// RepositoryContext provides context about the repository
-type RepositoryContext struct {
-	Owner         string `json:"owner"`
-	Name          string `json:"name"`
-	DefaultBranch string `json:"default_branch"`
-	Language      string `json:"language"`
-	Framework     string `json:"framework"`
+// FailedStep is a step that failed in one of a workflow run's jobs
+type FailedStep struct {
+	Job  string `json:"job"`
+	Name string `json:"name"`
+	// Duration is zero when GitHub did not report when the step started and completed
+	Duration time.Duration `json:"duration,omitempty"`
 }
 
+// RepositoryContext provides context about the repository
+type RepositoryContext = autofix.RepositoryContext
+
 // FailureContext contains all context needed for failure analysis
 type FailureContext struct {
 	WorkflowRun   *WorkflowRun      `json:"workflow_run"`
 	Logs          *WorkflowLogs     `json:"logs"`
 	Repository    RepositoryContext `json:"repository"`
 	RecentCommits []CommitInfo      `json:"recent_commits"`
+	// JobName is the failed job the logs are limited to; empty when they cover the whole run
+	JobName string `json:"job_name,omitempty"`
+	// Workflow is the workflow file the run was started from
+	Workflow *WorkflowDefinition `json:"workflow,omitempty"`
+	// PRNumber is the pull request a pull_request run tested and PRDiff the diff of the files
+	// it changes
+	PRNumber int    `json:"pr_number,omitempty"`
+	PRDiff   string `json:"pr_diff,omitempty"`
+	// Files are the repository files the fix generation prompt included, at the run's commit
+	Files []ContextFile `json:"files,omitempty"`
+	// ClusteredRuns are the other failed runs with the same failure, fixed along with this one
+	ClusteredRuns []*WorkflowRun `json:"clustered_runs,omitempty"`
+	// History is how the last runs of the workflow went on the target branch
+	History *RunHistory `json:"history,omitempty"`
 }
 
 // CommitInfo represents information about a recent commit
@@ -69,71 +103,34 @@ type FileChange struct {
 	Deletions int    `json:"deletions"`
 }
 
-// FailureClassification categorizes the type and severity of a failure
-type FailureClassification struct {
-	Type       FailureType     `json:"type"`
-	Severity   SeverityLevel   `json:"severity"`
-	Category   FailureCategory `json:"category"`
-	Confidence float64         `json:"confidence"`
-	Tags       []string        `json:"tags"`
-}
-
-// FailureType represents different types of CI/CD failures
-type FailureType string
-
-const (
-	InfrastructureFailure FailureType = "infrastructure"
-	CodeFailure           FailureType = "code"
-	TestFailure           FailureType = "test"
-	DependencyFailure     FailureType = "dependency"
-	BuildFailure          FailureType = "build"
-	DeploymentFailure     FailureType = "deployment"
-	ConfigurationFailure  FailureType = "configuration"
-	SecurityFailure       FailureType = "security"
+// The failure classification lives in the autofix package, so programs embedding the
+// analysis share it with the agent
+type (
+	FailureClassification = autofix.FailureClassification
+	FailureType           = autofix.FailureType
+	SeverityLevel         = autofix.SeverityLevel
+	FailureCategory       = autofix.FailureCategory
 )
 
-// DisplayName returns the display name for the failure type
-func (f FailureType) DisplayName() string {
-	switch f {
-	case InfrastructureFailure:
-		return "InfrastructureFailure"
-	case CodeFailure:
-		return "CodeFailure"
-	case TestFailure:
-		return "TestFailure"
-	case DependencyFailure:
-		return "DependencyFailure"
-	case BuildFailure:
-		return "BuildFailure"
-	case DeploymentFailure:
-		return "DeploymentFailure"
-	case ConfigurationFailure:
-		return "ConfigurationFailure"
-	case SecurityFailure:
-		return "SecurityFailure"
-	default:
-		return string(f)
-	}
-}
-
-// SeverityLevel represents the severity of a failure
-type SeverityLevel string
-
 const (
-	Critical SeverityLevel = "critical"
-	High     SeverityLevel = "high"
-	Medium   SeverityLevel = "medium"
-	Low      SeverityLevel = "low"
-)
+	InfrastructureFailure = autofix.InfrastructureFailure
+	CodeFailure           = autofix.CodeFailure
+	TestFailure           = autofix.TestFailure
+	DependencyFailure     = autofix.DependencyFailure
+	BuildFailure          = autofix.BuildFailure
+	DeploymentFailure     = autofix.DeploymentFailure
+	ConfigurationFailure  = autofix.ConfigurationFailure
+	SecurityFailure       = autofix.SecurityFailure
 
-// FailureCategory represents the nature of the failure
-type FailureCategory string
+	Critical = autofix.Critical
+	High     = autofix.High
+	Medium   = autofix.Medium
+	Low      = autofix.Low
 
-const (
-	Transient     FailureCategory = "transient"     // Temporary issues
-	Systematic    FailureCategory = "systematic"    // Code/config issues
-	Environmental FailureCategory = "environmental" // Infrastructure issues
-	Flaky         FailureCategory = "flaky"         // Non-deterministic issues
+	Transient     = autofix.Transient
+	Systematic    = autofix.Systematic
+	Environmental = autofix.Environmental
+	Flaky         = autofix.Flaky
 )
 
 // FailureAnalysisResult contains the complete analysis of a failure
@@ -148,16 +145,54 @@ type FailureAnalysisResult struct {
 	Timestamp      time.Time             `json:"timestamp"`
 	LLMProvider    LLMProvider           `json:"llm_provider"`
 	ProcessingTime time.Duration         `json:"processing_time"`
+	// Jobs are the failed jobs this analysis explains, several when their failures matched
+	Jobs []string `json:"jobs,omitempty"`
+	// LLMUsage covers the analysis request and, once AutoFix generated fixes for it, the fix
+	// and test generation requests too
+	LLMUsage *LLMUsageSummary `json:"llm_usage,omitempty"`
+	// Fingerprint identifies the failure across runs by its normalized top error lines
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// PreviousFix is the fix merged the last time this failure happened, when the fix
+	// history has one
+	PreviousFix *FixHistoryEntry `json:"previous_fix,omitempty"`
+	// Advisories are the known vulnerabilities a security failure reports, looked up in OSV
+	Advisories []Advisory `json:"advisories,omitempty"`
+	// ModelsUsed are the LLM models that answered the analysis requests and, once fixes were
+	// generated for it, the fix generation request, in the order they were first used
+	ModelsUsed []string `json:"models_used,omitempty"`
+	// Interactions are the redacted prompts and responses of the LLM requests behind the
+	// analysis and its fixes, captured only when prompt capture is enabled
+	Interactions []LLMInteraction `json:"interactions,omitempty"`
+	// Metadata holds debugging details, e.g. "context_files", the ContextDecisions on which
+	// repository files the fix generation prompt included, or "log_chunking", the
+	// LogChunkingStats of logs analyzed in chunks
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
 
-// ErrorPattern represents a detected error pattern
-type ErrorPattern struct {
-	Pattern     string  `json:"pattern"`
-	Description string  `json:"description"`
-	Confidence  float64 `json:"confidence"`
-	Location    string  `json:"location"` // file:line or job:step
+// LLM interaction stages
+const (
+	InteractionAnalysis          = "analysis"
+	InteractionEscalatedAnalysis = "escalated_analysis"
+	InteractionFixGeneration     = "fix_generation"
+	InteractionLogChunkSummary   = "log_chunk_summary"
+)
+
+// LLMInteraction is an LLM request and its response as sent and received, with credentials
+// redacted
+type LLMInteraction struct {
+	Stage     string    `json:"stage"`
+	Model     string    `json:"model,omitempty"`
+	Provider  string    `json:"provider,omitempty"`
+	SystemMsg string    `json:"system_message"`
+	Prompt    string    `json:"prompt"`
+	Response  string    `json:"response"`
+	Usage     *LLMUsage `json:"usage,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
+// ErrorPattern represents a detected error pattern
+type ErrorPattern = autofix.ErrorPattern
+
 // ProposedFix represents a generated fix for a failure
 type ProposedFix struct {
 	ID          string           `json:"id"`
@@ -171,36 +206,78 @@ type ProposedFix struct {
 	Benefits    []string         `json:"benefits"`
 	Validation  []ValidationStep `json:"validation"`
 	Timestamp   time.Time        `json:"timestamp"`
+	// GeneratedTests lists the files among Changes that are generated tests
+	GeneratedTests []string `json:"generated_tests,omitempty"`
 }
 
 // FixType represents different types of fixes
-type FixType string
+type FixType = autofix.FixType
 
 const (
-	CodeFix           FixType = "code"
-	ConfigurationFix  FixType = "configuration"
-	DependencyFix     FixType = "dependency"
-	InfrastructureFix FixType = "infrastructure"
-	WorkflowFix       FixType = "workflow"
-	TestFix           FixType = "test"
-	SecurityFix       FixType = "security"
+	CodeFix           = autofix.CodeFix
+	ConfigurationFix  = autofix.ConfigurationFix
+	DependencyFix     = autofix.DependencyFix
+	InfrastructureFix = autofix.InfrastructureFix
+	WorkflowFix       = autofix.WorkflowFix
+	TestFix           = autofix.TestFix
+	SecurityFix       = autofix.SecurityFix
 )
 
 // CodeChange represents a change to source code
 type CodeChange struct {
-	FilePath    string `json:"file_path"`
-	OldContent  string `json:"old_content"`
-	NewContent  string `json:"new_content"`
-	LineStart   int    `json:"line_start"`
-	LineEnd     int    `json:"line_end"`
-	Operation   string `json:"operation"` // add, modify, delete
-	Explanation string `json:"explanation"`
+	FilePath   string `json:"file_path"`
+	OldContent string `json:"old_content"`
+	NewContent string `json:"new_content"`
+	LineStart  int    `json:"line_start"`
+	LineEnd    int    `json:"line_end"`
+	// NewFilePath is where a rename moves FilePath to. A rename keeps the file's content
+	// unless NewContent is set.
+	NewFilePath string          `json:"new_file_path,omitempty"`
+	Operation   ChangeOperation `json:"operation"`
+	Explanation string          `json:"explanation"`
+}
+
+// ChangeOperation is what a CodeChange does to its file
+type ChangeOperation string
+
+// CodeChange operations
+const (
+	ChangeOperationAdd    ChangeOperation = "add"
+	ChangeOperationModify ChangeOperation = "modify"
+	ChangeOperationDelete ChangeOperation = "delete"
+	ChangeOperationRename ChangeOperation = "rename"
+)
+
+// targetPath returns the path the change leaves its content at: NewFilePath for renames,
+// FilePath otherwise
+func (c CodeChange) targetPath() string {
+	if c.Operation == ChangeOperationRename {
+		return c.NewFilePath
+	}
+	return c.FilePath
+}
+
+// paths returns the paths the change touches, the old and the new one for renames
+func (c CodeChange) paths() []string {
+	if c.Operation == ChangeOperationRename {
+		return []string{c.FilePath, c.NewFilePath}
+	}
+	return []string{c.FilePath}
+}
+
+// displayPath describes the changed path, as "old → new" for renames
+func (c CodeChange) displayPath() string {
+	if c.Operation == ChangeOperationRename {
+		return fmt.Sprintf("%s → %s", c.FilePath, c.NewFilePath)
+	}
+	return c.FilePath
 }
 
 // ValidationStep represents a step to validate a fix
 type ValidationStep struct {
-	Name        string            `json:"name"`
-	Command     string            `json:"command"`
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	// Expected is text the command's output must contain for the step to pass, if set
 	Expected    string            `json:"expected"`
 	Timeout     time.Duration     `json:"timeout"`
 	Environment map[string]string `json:"environment"`
@@ -209,6 +286,7 @@ type ValidationStep struct {
 // TestResult represents the result of running tests
 type TestResult struct {
 	Success      bool                   `json:"success"`
+	TestsPassed  bool                   `json:"tests_passed"` // like Success, but ignoring coverage
 	TotalTests   int                    `json:"total_tests"`
 	PassedTests  int                    `json:"passed_tests"`
 	FailedTests  int                    `json:"failed_tests"`
@@ -218,15 +296,80 @@ type TestResult struct {
 	Output       string                 `json:"output"`
 	Errors       []string               `json:"errors"`
 	Details      map[string]interface{} `json:"details"`
+	Cases        []TestCase             `json:"cases,omitempty"`
+	// FileCoverage is the per-file coverage from the coverage reports. Reports holds the
+	// report files by path, each at most maxCoverageReportBytes, and ReportDir the same files
+	// as a directory for exporting them; nil without a Dagger client.
+	FileCoverage []FileCoverage    `json:"file_coverage,omitempty"`
+	Reports      map[string]string `json:"-"`
+	ReportDir    *dagger.Directory `json:"-"`
+	// CoverageUnknown tells no coverage tooling could run, so Coverage was not measured
+	CoverageUnknown bool `json:"coverage_unknown,omitempty"`
+	// Steps are the results of the fix's validation steps run after the pipeline
+	Steps []StepResult `json:"steps,omitempty"`
+}
+
+// coverageText renders the coverage, or that it was not measured
+func (r *TestResult) coverageText() string {
+	if r.CoverageUnknown {
+		return "not measured"
+	}
+	return fmt.Sprintf("%.1f%%", r.Coverage)
+}
+
+// TestCaseStatus is the outcome of a single test case
+type TestCaseStatus string
+
+const (
+	TestCasePassed  TestCaseStatus = "passed"
+	TestCaseFailed  TestCaseStatus = "failed"
+	TestCaseSkipped TestCaseStatus = "skipped"
+)
+
+// TestCase represents the result of a single test within a test run
+type TestCase struct {
+	Name     string         `json:"name"`
+	Suite    string         `json:"suite,omitempty"` // package, class or file the test belongs to
+	Status   TestCaseStatus `json:"status"`
+	Duration time.Duration  `json:"duration"`
+	Message  string         `json:"message,omitempty"` // failure message or output
+}
+
+// FailedCases returns the test cases that failed
+func (r *TestResult) FailedCases() []TestCase {
+	if r == nil {
+		return nil
+	}
+	var failed []TestCase
+	for _, testCase := range r.Cases {
+		if testCase.Status == TestCaseFailed {
+			failed = append(failed, testCase)
+		}
+	}
+	return failed
+}
+
+// testsPassed reports whether the tests passed, whatever the coverage. Results that only
+// set Success, such as those of older runners, count as passed when successful.
+func (r *TestResult) testsPassed() bool {
+	return r.Success || r.TestsPassed
 }
 
 // FixValidationResult represents the result of validating a fix
 type FixValidationResult struct {
-	Fix        *ProposedFix `json:"fix"`
-	TestResult *TestResult  `json:"test_result"`
-	Valid      bool         `json:"valid"`
-	Timestamp  time.Time    `json:"timestamp"`
-	Errors     []string     `json:"errors"`
+	Fix            *ProposedFix        `json:"fix"`
+	TestResult     *TestResult         `json:"test_result"`
+	Valid          bool                `json:"valid"`
+	Timestamp      time.Time           `json:"timestamp"`
+	Errors         []string            `json:"errors"`
+	CoveragePolicy CoveragePolicy      `json:"coverage_policy,omitempty"`
+	Coverage       *CoverageComparison `json:"coverage,omitempty"` // nil unless base coverage was measured
+	// CoverageNote explains a fix judged by its tests alone because coverage was not measured
+	CoverageNote string `json:"coverage_note,omitempty"`
+	// GuardrailViolations are how the fix exceeds the fix guardrails; they are in Errors too
+	GuardrailViolations []string `json:"guardrail_violations,omitempty"`
+	// StepResults are the results of the fix's validation steps
+	StepResults []StepResult `json:"step_results,omitempty"`
 }
 
 // PullRequest represents a GitHub pull request
@@ -241,18 +384,30 @@ type PullRequest struct {
 	CreatedAt time.Time `json:"created_at"`
 	Author    string    `json:"author"`
 	Labels    []string  `json:"labels"`
+	Existing  bool      `json:"existing,omitempty"` // an already open PR for the same workflow run was returned instead of a new one
+	Merged    bool      `json:"merged,omitempty"`
+	NodeID    string    `json:"node_id,omitempty"` // GraphQL ID, which enabling auto-merge needs
+	// MergeCommitSHA is the commit a merged pull request created on its base branch
+	MergeCommitSHA string    `json:"merge_commit_sha,omitempty"`
+	MergedAt       time.Time `json:"merged_at,omitempty"`
+	// HeadRepository is the owner/name of the repository holding Branch, and Fork tells
+	// whether that is a fork, whose branch cannot be pushed to
+	HeadRepository string `json:"head_repository,omitempty"`
+	Fork           bool   `json:"fork,omitempty"`
 }
 
 // AutoFixResult represents the complete result of an auto-fix operation
 type AutoFixResult struct {
-	ID          string                 `json:"id"`
-	Analysis    *FailureAnalysisResult `json:"analysis"`
-	Fix         *FixValidationResult   `json:"fix"`
-	PullRequest *PullRequest           `json:"pull_request"`
-	Success     bool                   `json:"success"`
-	Timestamp   time.Time              `json:"timestamp"`
-	Duration    time.Duration          `json:"duration"`
-	Metadata    map[string]interface{} `json:"metadata"`
+	ID           string                 `json:"id"`
+	RunID        int64                  `json:"run_id,omitempty"`
+	Analysis     *FailureAnalysisResult `json:"analysis"`
+	Fix          *FixValidationResult   `json:"fix"`
+	PullRequest  *PullRequest           `json:"pull_request"`  // PR for the best fix
+	PullRequests []*PullRequest         `json:"pull_requests"` // every PR opened, best fix first
+	Success      bool                   `json:"success"`
+	Timestamp    time.Time              `json:"timestamp"`
+	Duration     time.Duration          `json:"duration"`
+	Metadata     map[string]interface{} `json:"metadata"`
 }
 
 // OperationalMetrics represents metrics for monitoring the auto-fix agent
@@ -260,24 +415,83 @@ type OperationalMetrics struct {
 	TotalFailuresDetected int                     `json:"total_failures_detected"`
 	SuccessfulFixes       int                     `json:"successful_fixes"`
 	FailedFixes           int                     `json:"failed_fixes"`
+	CompletedFixes        int                     `json:"completed_fixes"` // auto-fix runs that finished without error
+	FlakyResolvedByRetry  int                     `json:"flaky_resolved_by_retry"`
+	ClusteredFailures     int                     `json:"clustered_failures"` // failed runs left to the fix of a run failing the same way
+	OpenFixPRs            int                     `json:"open_fix_prs"`
+	SupersededFixPRs      int                     `json:"superseded_fix_prs"`
+	VerifiedFixes         int                     `json:"verified_fixes"`   // merged fixes whose workflow succeeded afterwards
+	UnverifiedFixes       int                     `json:"unverified_fixes"` // merged fixes whose workflow failed again or did not run
 	AverageFixTime        time.Duration           `json:"average_fix_time"`
 	TestCoverage          float64                 `json:"test_coverage"`
 	LLMProviderStats      map[string]int          `json:"llm_provider_stats"`
 	ErrorRateByType       map[FailureType]float64 `json:"error_rate_by_type"`
 	FixSuccessRateByType  map[FailureType]float64 `json:"fix_success_rate_by_type"`
+	VerifiedRateByType    map[FailureType]float64 `json:"verified_rate_by_type,omitempty"` // verified share of the verified and unverified fixes
+	GitHubRateRemaining   int                     `json:"github_rate_remaining"`           // -1 when unknown
+	LLMTokensUsed         int                     `json:"llm_tokens_used"`
+	LLMEstimatedCost      float64                 `json:"llm_estimated_cost_usd"`
+	LLMUsage              LLMUsageByProvider      `json:"llm_usage,omitempty"`
+	Discovery             *RepositoryDiscovery    `json:"discovery,omitempty"` // last organization repository discovery
+	Health                *HealthStatus           `json:"health,omitempty"`
 	LastUpdated           time.Time               `json:"last_updated"`
 }
 
 // GitHubIntegration handles GitHub API interactions
 type GitHubIntegration struct {
-	client    *github.Client
-	repoOwner string
-	repoName  string
-	logger    *logrus.Logger
+	client       *github.Client
+	repoOwner    string
+	repoName     string
+	targetBranch string
+	logger       *logrus.Logger
+	token        string // kept so the agent can redact it
+	// tokenSource mints the installation tokens of GitHub App auth, which has no fixed token
+	tokenSource oauth2.TokenSource
+
+	rateLimitRetries int
+	rateLimit        rateLimitState
+	failedRunFilter  FailedRunFilter
+
+	repoMu      sync.Mutex
+	repoContext *RepositoryContext
+
+	// appsClient authenticates as the GitHub App itself under GitHub App auth
+	appsClient *github.Client
+	loginMu    sync.Mutex
+	login      string // the account the integration authenticates as, once looked up
 }
 
-// NewGitHubIntegration creates a new GitHub integration client
-func NewGitHubIntegration(ctx context.Context, token *dagger.Secret, owner, name string) (*GitHubIntegration, error) {
+const (
+	// DefaultFailureLookback is how far back GetFailedWorkflowRuns looks for failures
+	DefaultFailureLookback = 24 * time.Hour
+	// DefaultMaxFailedRuns caps the number of failed runs returned per poll
+	DefaultMaxFailedRuns = 50
+	// maxWorkflowRunsPerPage is the largest page size the GitHub API accepts
+	maxWorkflowRunsPerPage = 100
+)
+
+// FailedRunFilter controls which workflow runs GetFailedWorkflowRuns returns
+type FailedRunFilter struct {
+	Lookback        time.Duration `json:"lookback"`
+	MaxResults      int           `json:"max_results"`
+	Workflows       []string      `json:"workflows"` // workflow file names, e.g. ci.yml; empty means all
+	IncludeTimedOut bool          `json:"include_timed_out"`
+}
+
+// withDefaults fills unset limits with the package defaults
+func (f FailedRunFilter) withDefaults() FailedRunFilter {
+	if f.Lookback <= 0 {
+		f.Lookback = DefaultFailureLookback
+	}
+	if f.MaxResults <= 0 {
+		f.MaxResults = DefaultMaxFailedRuns
+	}
+	return f
+}
+
+// NewGitHubIntegration creates a new GitHub integration client logging to logger.
+// A nil endpoints value targets github.com; otherwise the GitHub Enterprise Server API is used.
+func NewGitHubIntegration(ctx context.Context, token *dagger.Secret, owner, name string, endpoints *GitHubEndpoints, logger *logrus.Logger) (*GitHubIntegration, error) {
 	var tokenStr string
 	var err error
 
@@ -295,28 +509,129 @@ func NewGitHubIntegration(ctx context.Context, token *dagger.Secret, owner, name
 		return nil, fmt.Errorf("failed to get GitHub token: %w", err)
 	}
 
-	// Basic validation to catch obviously invalid tokens in tests
-	if !strings.HasPrefix(tokenStr, "ghp_") && !strings.HasPrefix(tokenStr, "gho_") && !strings.HasPrefix(tokenStr, "github_pat_") {
-		return nil, fmt.Errorf("invalid GitHub token")
+	// Basic validation to catch obviously invalid tokens in tests.
+	// Older GHES releases issue tokens without the github.com prefixes.
+	if endpoints.isEnterprise() {
+		if strings.TrimSpace(tokenStr) == "" {
+			return nil, fmt.Errorf("%w: invalid GitHub token", ErrGitHubAuth)
+		}
+	} else if !hasGitHubTokenPrefix(tokenStr) {
+		return nil, fmt.Errorf("%w: invalid GitHub token", ErrGitHubAuth)
 	}
 
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: tokenStr},
 	)
 	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	client, err := newGitHubRESTClient(tc, endpoints)
+	if err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = logrus.New()
+	}
 
 	return &GitHubIntegration{
-		client:    client,
-		repoOwner: owner,
-		repoName:  name,
-		logger:    logrus.New(),
+		client:           client,
+		repoOwner:        owner,
+		repoName:         name,
+		logger:           logger,
+		token:            tokenStr,
+		rateLimitRetries: MaxRetries,
 	}, nil
 }
 
+// SetTargetBranch configures the branch that test and fix branches are created from.
+// When empty, the repository's default branch is looked up from the GitHub API.
+func (g *GitHubIntegration) SetTargetBranch(branch string) {
+	g.targetBranch = branch
+}
+
+// SetFailedRunFilter configures the lookback window, result cap, and workflows used when listing failures
+func (g *GitHubIntegration) SetFailedRunFilter(filter FailedRunFilter) {
+	g.failedRunFilter = filter
+}
+
+// GetRepositoryContext returns the repository's default branch, primary language and
+// matching test framework. The result is cached since it rarely changes between runs.
+func (g *GitHubIntegration) GetRepositoryContext(ctx context.Context) (*RepositoryContext, error) {
+	g.repoMu.Lock()
+	defer g.repoMu.Unlock()
+
+	if g.repoContext != nil {
+		repoCtx := *g.repoContext
+		return &repoCtx, nil
+	}
+
+	repo, err := callGitHub(ctx, g, func() (*github.Repository, *github.Response, error) {
+		return g.client.Repositories.Get(ctx, g.repoOwner, g.repoName)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository: %w", err)
+	}
+
+	g.repoContext = &RepositoryContext{
+		Owner:         g.repoOwner,
+		Name:          g.repoName,
+		DefaultBranch: repo.GetDefaultBranch(),
+		Language:      repo.GetLanguage(),
+		Framework:     frameworkForLanguage(repo.GetLanguage()),
+	}
+
+	repoCtx := *g.repoContext
+	return &repoCtx, nil
+}
+
+// frameworkForLanguage maps a GitHub repository language to the name of a known test framework
+func frameworkForLanguage(language string) string {
+	language = strings.ToLower(language)
+	if language == "typescript" {
+		language = "javascript"
+	}
+
+	for _, framework := range loadTestFrameworks() {
+		if framework.Language == language {
+			return framework.Framework
+		}
+	}
+	return ""
+}
+
+// resolveBaseBranch returns the configured target branch or the repository default branch
+func (g *GitHubIntegration) resolveBaseBranch(ctx context.Context) (string, error) {
+	if g.targetBranch != "" {
+		return g.targetBranch, nil
+	}
+
+	repo, err := callGitHub(ctx, g, func() (*github.Repository, *github.Response, error) {
+		return g.client.Repositories.Get(ctx, g.repoOwner, g.repoName)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get repository: %w", err)
+	}
+	if repo.GetDefaultBranch() == "" {
+		return "", fmt.Errorf("repository %s/%s has no default branch", g.repoOwner, g.repoName)
+	}
+
+	return repo.GetDefaultBranch(), nil
+}
+
+// hasGitHubTokenPrefix reports whether a token uses a known GitHub token prefix
+// (personal, OAuth, fine-grained, or GitHub App installation tokens)
+func hasGitHubTokenPrefix(token string) bool {
+	for _, prefix := range []string{"ghp_", "gho_", "ghs_", "github_pat_"} {
+		if strings.HasPrefix(token, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetWorkflowRun retrieves details about a specific workflow run
 func (g *GitHubIntegration) GetWorkflowRun(ctx context.Context, runID int64) (*WorkflowRun, error) {
-	run, _, err := g.client.Actions.GetWorkflowRunByID(ctx, g.repoOwner, g.repoName, runID)
+	run, err := callGitHub(ctx, g, func() (*github.WorkflowRun, *github.Response, error) {
+		return g.client.Actions.GetWorkflowRunByID(ctx, g.repoOwner, g.repoName, runID)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get workflow run: %w", err)
 	}
@@ -326,35 +641,105 @@ func (g *GitHubIntegration) GetWorkflowRun(ctx context.Context, runID int64) (*W
 		Name:       run.GetName(),
 		Status:     run.GetStatus(),
 		Conclusion: run.GetConclusion(),
+		RunAttempt: run.GetRunAttempt(),
 		Branch:     run.GetHeadBranch(),
 		CommitSHA:  run.GetHeadSHA(),
 		CreatedAt:  run.GetCreatedAt().Time,
 		UpdatedAt:  run.GetUpdatedAt().Time,
 		URL:        run.GetHTMLURL(),
 		JobsURL:    run.GetJobsURL(),
+		Event:      run.GetEvent(),
 	}, nil
 }
 
+// GetWorkflowRunAttempt retrieves a workflow run as of one of its attempts
+func (g *GitHubIntegration) GetWorkflowRunAttempt(ctx context.Context, runID int64, attempt int) (*WorkflowRun, error) {
+	run, err := callGitHub(ctx, g, func() (*github.WorkflowRun, *github.Response, error) {
+		return g.client.Actions.GetWorkflowRunAttempt(ctx, g.repoOwner, g.repoName, runID, attempt, nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attempt %d of workflow run: %w", attempt, err)
+	}
+
+	result := convertWorkflowRun(run)
+	result.JobsURL = run.GetJobsURL()
+	return result, nil
+}
+
+// GetJobRunID returns the ID of the workflow run a job belongs to
+func (g *GitHubIntegration) GetJobRunID(ctx context.Context, jobID int64) (int64, error) {
+	job, err := callGitHub(ctx, g, func() (*github.WorkflowJob, *github.Response, error) {
+		return g.client.Actions.GetWorkflowJobByID(ctx, g.repoOwner, g.repoName, jobID)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get workflow job: %w", err)
+	}
+	return job.GetRunID(), nil
+}
+
 // GetWorkflowLogs retrieves logs from a workflow run
 func (g *GitHubIntegration) GetWorkflowLogs(ctx context.Context, runID int64) (*WorkflowLogs, error) {
 	// Get jobs for the workflow run
-	jobs, _, err := g.client.Actions.ListWorkflowJobs(ctx, g.repoOwner, g.repoName, runID, nil)
+	jobs, err := callGitHub(ctx, g, func() (*github.Jobs, *github.Response, error) {
+		return g.client.Actions.ListWorkflowJobs(ctx, g.repoOwner, g.repoName, runID, nil)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list workflow jobs: %w", err)
 	}
+	return g.jobLogs(ctx, runID, jobs)
+}
 
+// GetWorkflowRunAttemptLogs retrieves the logs of one attempt of a workflow run
+func (g *GitHubIntegration) GetWorkflowRunAttemptLogs(ctx context.Context, runID int64, attempt int) (*WorkflowLogs, error) {
+	// go-github has no call listing the jobs of an attempt
+	jobs, err := callGitHub(ctx, g, func() (*github.Jobs, *github.Response, error) {
+		req, err := g.client.NewRequest("GET", fmt.Sprintf("repos/%v/%v/actions/runs/%v/attempts/%v/jobs", g.repoOwner, g.repoName, runID, attempt), nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		jobs := new(github.Jobs)
+		resp, err := g.client.Do(ctx, req, jobs)
+		return jobs, resp, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs of attempt %d: %w", attempt, err)
+	}
+	return g.jobLogs(ctx, runID, jobs)
+}
+
+// jobLogs collects the logs and failed steps of a workflow run's jobs. When GitHub no longer
+// serves the log of any job, the logs expired or were deleted and a *LogsUnavailableError is
+// returned instead.
+func (g *GitHubIntegration) jobLogs(ctx context.Context, runID int64, jobs *github.Jobs) (*WorkflowLogs, error) {
 	logs := &WorkflowLogs{
-		JobLogs:  make(map[string]string),
-		StepLogs: make(map[string]string),
+		JobLogs:       make(map[string]string),
+		StepLogs:      make(map[string]string),
+		JobErrorLines: make(map[string][]string),
 	}
 
 	var allLogs strings.Builder
 	var errorLines []string
+	var goneStatus, gone int
 
 	for _, job := range jobs.Jobs {
-		// Get job logs
-		logURL, _, err := g.client.Actions.GetWorkflowJobLogs(ctx, g.repoOwner, g.repoName, job.GetID(), true)
+		// Get job logs. go-github reports their statuses as plain errors, so the status is
+		// read from the response.
+		var status int
+		logURL, err := callGitHub(ctx, g, func() (*url.URL, *github.Response, error) {
+			logURL, resp, err := g.client.Actions.GetWorkflowJobLogs(ctx, g.repoOwner, g.repoName, job.GetID(), true)
+			if resp != nil {
+				status = resp.StatusCode
+			}
+			return logURL, resp, err
+		})
 		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("failed to get workflow logs: %w", ctx.Err())
+			}
+			if status == http.StatusGone || status == http.StatusNotFound {
+				goneStatus = status
+				gone++
+			}
 			g.logger.WithError(err).Warnf("Failed to get logs for job %s", job.GetName())
 			continue
 		}
@@ -364,88 +749,524 @@ func (g *GitHubIntegration) GetWorkflowLogs(ctx context.Context, runID int64) (*
 		logs.JobLogs[job.GetName()] = jobLogs
 		allLogs.WriteString(jobLogs)
 
+		if conclusion := job.GetConclusion(); conclusion == "failure" || conclusion == "timed_out" {
+			logs.FailedJobs = append(logs.FailedJobs, job.GetName())
+		}
+
 		// Extract error information from job steps
 		for _, step := range job.Steps {
 			if step.GetConclusion() == "failure" {
-				errorLines = append(errorLines, fmt.Sprintf("Step '%s' failed: %s", step.GetName(), step.GetConclusion()))
+				line := fmt.Sprintf("Step '%s' failed: %s", step.GetName(), step.GetConclusion())
+				errorLines = append(errorLines, line)
+				logs.JobErrorLines[job.GetName()] = append(logs.JobErrorLines[job.GetName()], line)
+
+				failed := FailedStep{Job: job.GetName(), Name: step.GetName()}
+				if step.StartedAt != nil && step.CompletedAt != nil {
+					failed.Duration = step.GetCompletedAt().Sub(step.GetStartedAt().Time)
+				}
+				logs.FailedSteps = append(logs.FailedSteps, failed)
 			}
 		}
 	}
 
+	if gone > 0 && gone == len(jobs.Jobs) {
+		return nil, &LogsUnavailableError{RunID: runID, Status: goneStatus}
+	}
+
 	logs.RawLogs = allLogs.String()
 	logs.ErrorLines = errorLines
 
 	return logs, nil
 }
 
-// GetFailedWorkflowRuns retrieves recent failed workflow runs
+// GetFailedWorkflowRuns retrieves failed workflow runs created within the lookback window,
+// newest first. Results are paginated up to the configured maximum and deduplicated by run ID.
 func (g *GitHubIntegration) GetFailedWorkflowRuns(ctx context.Context) ([]*WorkflowRun, error) {
+	filter := g.failedRunFilter.withDefaults()
+	cutoff := time.Now().Add(-filter.Lookback)
+
+	conclusions := []string{"failure"}
+	if filter.IncludeTimedOut {
+		conclusions = append(conclusions, "timed_out")
+	}
+
+	workflows := filter.Workflows
+	if len(workflows) == 0 {
+		// An empty name lists runs across all workflows in the repository
+		workflows = []string{""}
+	}
+
+	seen := make(map[int64]bool)
+	var failedRuns []*WorkflowRun
+	for _, workflow := range workflows {
+		for _, conclusion := range conclusions {
+			runs, err := g.listWorkflowRunsSince(ctx, workflow, conclusion, cutoff, filter.MaxResults)
+			if err != nil {
+				return nil, err
+			}
+			for _, run := range runs {
+				if seen[run.ID] {
+					continue
+				}
+				seen[run.ID] = true
+				failedRuns = append(failedRuns, run)
+			}
+		}
+	}
+
+	sort.SliceStable(failedRuns, func(i, j int) bool {
+		return failedRuns[i].CreatedAt.After(failedRuns[j].CreatedAt)
+	})
+	if len(failedRuns) > filter.MaxResults {
+		failedRuns = failedRuns[:filter.MaxResults]
+	}
+
+	return failedRuns, nil
+}
+
+// listWorkflowRunsSince pages through runs with the given conclusion until maxResults runs are
+// collected or a run older than cutoff is reached. An empty workflow lists runs for the whole repository.
+func (g *GitHubIntegration) listWorkflowRunsSince(ctx context.Context, workflow, conclusion string, cutoff time.Time, maxResults int) ([]*WorkflowRun, error) {
 	opts := &github.ListWorkflowRunsOptions{
-		Status: "completed",
+		Status:  conclusion,
+		Created: ">=" + cutoff.UTC().Format(time.RFC3339),
 		ListOptions: github.ListOptions{
-			PerPage: 10,
+			PerPage: min(maxResults, maxWorkflowRunsPerPage),
 		},
 	}
 
-	runs, _, err := g.client.Actions.ListRepositoryWorkflowRuns(ctx, g.repoOwner, g.repoName, opts)
+	var results []*WorkflowRun
+	for {
+		var runs *github.WorkflowRuns
+		var resp *github.Response
+		err := g.withRateLimit(ctx, func() (*github.Response, error) {
+			var err error
+			if workflow != "" {
+				runs, resp, err = g.client.Actions.ListWorkflowRunsByFileName(ctx, g.repoOwner, g.repoName, workflow, opts)
+			} else {
+				runs, resp, err = g.client.Actions.ListRepositoryWorkflowRuns(ctx, g.repoOwner, g.repoName, opts)
+			}
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workflow runs: %w", err)
+		}
+
+		for _, run := range runs.WorkflowRuns {
+			// Runs are returned newest first, so anything past the cutoff ends the scan
+			if run.GetCreatedAt().Time.Before(cutoff) {
+				return results, nil
+			}
+			if run.GetConclusion() != conclusion {
+				continue
+			}
+			results = append(results, convertWorkflowRun(run))
+			if len(results) >= maxResults {
+				return results, nil
+			}
+		}
+
+		if resp == nil || resp.NextPage == 0 {
+			return results, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func convertWorkflowRun(run *github.WorkflowRun) *WorkflowRun {
+	return &WorkflowRun{
+		ID:         run.GetID(),
+		Name:       run.GetName(),
+		Status:     run.GetStatus(),
+		Conclusion: run.GetConclusion(),
+		RunAttempt: run.GetRunAttempt(),
+		Branch:     run.GetHeadBranch(),
+		CommitSHA:  run.GetHeadSHA(),
+		CreatedAt:  run.GetCreatedAt().Time,
+		UpdatedAt:  run.GetUpdatedAt().Time,
+		URL:        run.GetHTMLURL(),
+		Event:      run.GetEvent(),
+		WorkflowID: run.GetWorkflowID(),
+	}
+}
+
+// GetSuccessfulWorkflowRuns lists the successful runs on branch for commit sha created since the given time
+func (g *GitHubIntegration) GetSuccessfulWorkflowRuns(ctx context.Context, branch, sha string, since time.Time) ([]*WorkflowRun, error) {
+	opts := &github.ListWorkflowRunsOptions{
+		Branch:      branch,
+		Status:      "success",
+		Created:     ">=" + since.UTC().Format(time.RFC3339),
+		ListOptions: github.ListOptions{PerPage: maxWorkflowRunsPerPage},
+	}
+
+	var results []*WorkflowRun
+	for {
+		var runs *github.WorkflowRuns
+		var resp *github.Response
+		err := g.withRateLimit(ctx, func() (*github.Response, error) {
+			var err error
+			runs, resp, err = g.client.Actions.ListRepositoryWorkflowRuns(ctx, g.repoOwner, g.repoName, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workflow runs: %w", err)
+		}
+		for _, run := range runs.WorkflowRuns {
+			if run.GetHeadSHA() == sha && run.GetConclusion() == "success" {
+				results = append(results, convertWorkflowRun(run))
+			}
+		}
+		if resp == nil || resp.NextPage == 0 {
+			return results, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// GetCommitWorkflowRuns lists the runs of any status on branch for commit sha created since
+// the given time, newest first
+func (g *GitHubIntegration) GetCommitWorkflowRuns(ctx context.Context, branch, sha string, since time.Time) ([]*WorkflowRun, error) {
+	opts := &github.ListWorkflowRunsOptions{
+		Branch:      branch,
+		Created:     ">=" + since.UTC().Format(time.RFC3339),
+		ListOptions: github.ListOptions{PerPage: maxWorkflowRunsPerPage},
+	}
+
+	var results []*WorkflowRun
+	for {
+		var runs *github.WorkflowRuns
+		var resp *github.Response
+		err := g.withRateLimit(ctx, func() (*github.Response, error) {
+			var err error
+			runs, resp, err = g.client.Actions.ListRepositoryWorkflowRuns(ctx, g.repoOwner, g.repoName, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workflow runs: %w", err)
+		}
+		for _, run := range runs.WorkflowRuns {
+			if run.GetHeadSHA() == sha {
+				results = append(results, convertWorkflowRun(run))
+			}
+		}
+		if resp == nil || resp.NextPage == 0 {
+			return results, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// GetRecentWorkflowRuns lists the last completed runs of a workflow on branch, newest first
+func (g *GitHubIntegration) GetRecentWorkflowRuns(ctx context.Context, workflowID int64, branch string, limit int) ([]*WorkflowRun, error) {
+	opts := &github.ListWorkflowRunsOptions{
+		Branch:      branch,
+		Status:      "completed",
+		ListOptions: github.ListOptions{PerPage: min(limit, maxWorkflowRunsPerPage)},
+	}
+	runs, err := callGitHub(ctx, g, func() (*github.WorkflowRuns, *github.Response, error) {
+		return g.client.Actions.ListWorkflowRunsByID(ctx, g.repoOwner, g.repoName, workflowID, opts)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list workflow runs: %w", err)
 	}
 
-	var failedRuns []*WorkflowRun
+	var results []*WorkflowRun
 	for _, run := range runs.WorkflowRuns {
-		failedRuns = append(failedRuns, &WorkflowRun{
-			ID:         run.GetID(),
-			Name:       run.GetName(),
-			Status:     run.GetStatus(),
-			Conclusion: run.GetConclusion(),
-			Branch:     run.GetHeadBranch(),
-			CommitSHA:  run.GetHeadSHA(),
-			CreatedAt:  run.GetCreatedAt().Time,
-			UpdatedAt:  run.GetUpdatedAt().Time,
-			URL:        run.GetHTMLURL(),
-		})
+		if len(results) == limit {
+			break
+		}
+		results = append(results, convertWorkflowRun(run))
 	}
+	return results, nil
+}
 
-	return failedRuns, nil
+// RerunWorkflowFailedJobs re-runs the failed jobs of a completed workflow run, and the jobs
+// depending on them, as a new attempt of the same run
+func (g *GitHubIntegration) RerunWorkflowFailedJobs(ctx context.Context, runID int64) error {
+	err := g.withRateLimit(ctx, func() (*github.Response, error) {
+		return g.client.Actions.RerunFailedJobsByID(ctx, g.repoOwner, g.repoName, runID)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to re-run failed jobs of workflow run %d: %w", runID, err)
+	}
+	return nil
+}
+
+// workflowRunPollInterval is how often WaitForWorkflowRun checks the run's status
+var workflowRunPollInterval = 15 * time.Second
+
+// WaitForWorkflowRun polls a workflow run until attempt minAttempt or a later one completes,
+// so the status of the attempt that was re-run is not mistaken for the new one's
+func (g *GitHubIntegration) WaitForWorkflowRun(ctx context.Context, runID int64, minAttempt int, timeout time.Duration) (*WorkflowRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(pollInterval(ctx))
+	defer ticker.Stop()
+	for {
+		run, err := g.GetWorkflowRun(ctx, runID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("timed out waiting for workflow run %d to complete: %w", runID, ctx.Err())
+			}
+			return nil, err
+		}
+		if run.Status == "completed" && run.RunAttempt >= minAttempt {
+			return run, nil
+		}
+		g.logger.WithFields(logrus.Fields{
+			"run_id":  runID,
+			"attempt": run.RunAttempt,
+			"status":  run.Status,
+		}).Debug("Waiting for workflow run to complete")
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out waiting for workflow run %d to complete: %w", runID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
 }
 
 // CreateTestBranch creates a temporary branch with the proposed changes for testing
 func (g *GitHubIntegration) CreateTestBranch(ctx context.Context, branchName string, changes []CodeChange) (func(), error) {
-	// Get the default branch reference
-	mainRef, _, err := g.client.Git.GetRef(ctx, g.repoOwner, g.repoName, "heads/main")
+	baseBranch, err := g.resolveBaseBranch(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get main branch ref: %w", err)
+		return nil, fmt.Errorf("failed to resolve base branch: %w", err)
 	}
 
-	// Create new branch
-	newRef := &github.Reference{
-		Ref: github.String("refs/heads/" + branchName),
-		Object: &github.GitObject{
-			SHA: mainRef.Object.SHA,
-		},
+	if err := g.CreateBranch(ctx, branchName, baseBranch); err != nil {
+		return nil, err
 	}
 
-	_, _, err = g.client.Git.CreateRef(ctx, g.repoOwner, g.repoName, newRef)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create branch: %w", err)
+	// Return cleanup function, which still deletes the branch once ctx is cancelled
+	cleanup := func() {
+		cleanupCtx, cancel := cleanupContext(ctx)
+		defer cancel()
+		if err := g.DeleteBranch(cleanupCtx, branchName); err != nil {
+			g.logger.WithError(err).Warnf("Failed to delete test branch %s", branchName)
+		}
 	}
 
 	// Apply changes to the branch
 	for _, change := range changes {
 		if err := g.applyFileChange(ctx, branchName, change); err != nil {
+			if ctx.Err() != nil {
+				cleanup()
+				return nil, fmt.Errorf("failed to apply changes to %s: %w", branchName, ctx.Err())
+			}
 			g.logger.WithError(err).Warnf("Failed to apply change to %s", change.FilePath)
 		}
 	}
 
-	// Return cleanup function
-	cleanup := func() {
-		if _, err := g.client.Git.DeleteRef(ctx, g.repoOwner, g.repoName, "heads/"+branchName); err != nil {
-			g.logger.WithError(err).Warnf("Failed to delete test branch %s", branchName)
+	return cleanup, nil
+}
+
+// GetBaseBranchHead returns the branch fixes are based on and the SHA of its head commit
+func (g *GitHubIntegration) GetBaseBranchHead(ctx context.Context) (string, string, error) {
+	baseBranch, err := g.resolveBaseBranch(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve base branch: %w", err)
+	}
+
+	ref, err := callGitHub(ctx, g, func() (*github.Reference, *github.Response, error) {
+		return g.client.Git.GetRef(ctx, g.repoOwner, g.repoName, "heads/"+baseBranch)
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get %s branch ref: %w", baseBranch, err)
+	}
+
+	return baseBranch, ref.GetObject().GetSHA(), nil
+}
+
+// GetFileContent returns the content of a file at ref, and false when the file does not exist
+func (g *GitHubIntegration) GetFileContent(ctx context.Context, path, ref string) (string, bool, error) {
+	var file *github.RepositoryContent
+	err := g.withRateLimit(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		file, _, resp, err = g.client.Repositories.GetContents(ctx, g.repoOwner, g.repoName, path, &github.RepositoryContentGetOptions{Ref: ref})
+		return resp, err
+	})
+	if errors.Is(err, ErrGitHubNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get %s: %w", path, err)
+	}
+	if file == nil {
+		return "", false, fmt.Errorf("failed to get %s: not a file", path)
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return content, true, nil
+}
+
+// ListDirectory returns the names of the entries of a directory at ref, with a trailing slash
+// for subdirectories
+func (g *GitHubIntegration) ListDirectory(ctx context.Context, path, ref string) ([]string, error) {
+	var dir []*github.RepositoryContent
+	err := g.withRateLimit(ctx, func() (*github.Response, error) {
+		var resp *github.Response
+		var err error
+		_, dir, resp, err = g.client.Repositories.GetContents(ctx, g.repoOwner, g.repoName, path, &github.RepositoryContentGetOptions{Ref: ref})
+		return resp, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", path, err)
+	}
+	return directoryEntries(dir), nil
+}
+
+// directoryEntries returns the names of a directory listing, with a trailing slash for
+// subdirectories
+func directoryEntries(dir []*github.RepositoryContent) []string {
+	entries := make([]string, 0, len(dir))
+	for _, entry := range dir {
+		name := entry.GetName()
+		if entry.GetType() == "dir" {
+			name += "/"
 		}
+		entries = append(entries, name)
 	}
+	return entries
+}
 
-	return cleanup, nil
+// GetLanguages returns the repository's languages with the bytes of code written in each
+func (g *GitHubIntegration) GetLanguages(ctx context.Context) (map[string]int, error) {
+	languages, err := callGitHub(ctx, g, func() (map[string]int, *github.Response, error) {
+		return g.client.Repositories.ListLanguages(ctx, g.repoOwner, g.repoName)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get repository languages: %w", err)
+	}
+	return languages, nil
+}
+
+// UploadSARIF uploads a SARIF log to code scanning as the analysis of commitSHA on ref and
+// returns the ID of the upload, which GitHub processes asynchronously
+func (g *GitHubIntegration) UploadSARIF(ctx context.Context, commitSHA, ref string, sarif []byte) (string, error) {
+	encoded, err := encodeSARIF(sarif)
+	if err != nil {
+		return "", err
+	}
+	analysis := &github.SarifAnalysis{
+		CommitSHA: github.String(commitSHA),
+		Ref:       github.String(ref),
+		Sarif:     github.String(encoded),
+		ToolName:  github.String(sarifToolName),
+	}
+	upload, err := callGitHub(ctx, g, func() (*github.SarifID, *github.Response, error) {
+		upload, resp, err := g.client.CodeScanning.UploadSarif(ctx, g.repoOwner, g.repoName, analysis)
+		// The upload is accepted with 202, which go-github reports as an error
+		var accepted *github.AcceptedError
+		if errors.As(err, &accepted) {
+			upload = &github.SarifID{}
+			err = json.Unmarshal(accepted.Raw, upload)
+		}
+		return upload, resp, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload SARIF: %w", err)
+	}
+	return upload.GetID(), nil
+}
+
+// ListOpenPullRequests returns the open pull requests that carry every one of the given labels
+func (g *GitHubIntegration) ListOpenPullRequests(ctx context.Context, labels []string) ([]*PullRequest, error) {
+	opts := &github.PullRequestListOptions{
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var results []*PullRequest
+	for {
+		var prs []*github.PullRequest
+		var resp *github.Response
+		err := g.withRateLimit(ctx, func() (*github.Response, error) {
+			var err error
+			prs, resp, err = g.client.PullRequests.List(ctx, g.repoOwner, g.repoName, opts)
+			return resp, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pull requests: %w", err)
+		}
+
+		for _, pr := range prs {
+			if pr := convertPullRequest(pr); hasLabels(pr.Labels, labels) {
+				results = append(results, pr)
+			}
+		}
+
+		if resp == nil || resp.NextPage == 0 {
+			return results, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func convertPullRequest(pr *github.PullRequest) *PullRequest {
+	labels := make([]string, 0, len(pr.Labels))
+	for _, label := range pr.Labels {
+		labels = append(labels, label.GetName())
+	}
+
+	// A fork that was deleted leaves the head without a repository
+	headRepo := pr.GetHead().GetRepo().GetFullName()
+	baseRepo := pr.GetBase().GetRepo().GetFullName()
+
+	return &PullRequest{
+		Number:    pr.GetNumber(),
+		Title:     pr.GetTitle(),
+		Body:      pr.GetBody(),
+		URL:       pr.GetHTMLURL(),
+		Branch:    pr.GetHead().GetRef(),
+		CommitSHA: pr.GetHead().GetSHA(),
+		State:     pr.GetState(),
+		CreatedAt: pr.GetCreatedAt(),
+		Author:    pr.GetUser().GetLogin(),
+		Labels:    labels,
+		Merged:    pr.GetMerged(),
+		NodeID:    pr.GetNodeID(),
+
+		MergeCommitSHA: pr.GetMergeCommitSHA(),
+		MergedAt:       pr.GetMergedAt(),
+		HeadRepository: headRepo,
+		Fork:           baseRepo != "" && !strings.EqualFold(headRepo, baseRepo),
+	}
+}
+
+// hasLabels reports whether have contains every label in want
+func hasLabels(have, want []string) bool {
+	for _, label := range want {
+		found := false
+		for _, name := range have {
+			if strings.EqualFold(name, label) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// CreateCommitComment posts a comment on a commit
+func (g *GitHubIntegration) CreateCommitComment(ctx context.Context, sha, body string) error {
+	_, err := callGitHub(ctx, g, func() (*github.RepositoryComment, *github.Response, error) {
+		return g.client.Repositories.CreateComment(ctx, g.repoOwner, g.repoName, sha, &github.RepositoryComment{
+			Body: &body,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create commit comment: %w", err)
+	}
+	return nil
 }
 
 func (g *GitHubIntegration) applyFileChange(ctx context.Context, branch string, change CodeChange) error {
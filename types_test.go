@@ -2,12 +2,20 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
+	"dagger.io/dagger"
+	"github.com/google/go-github/v45/github"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestDisplayName tests the DisplayName method for different FailureTypes
@@ -92,7 +100,7 @@ func TestNewGitHubIntegration(t *testing.T) {
 				err = nil
 			}
 		}()
-		integration, err = NewGitHubIntegration(ctx, nil, "test-owner", "test-repo")
+		integration, err = NewGitHubIntegration(ctx, nil, "test-owner", "test-repo", nil, nil)
 	}()
 	
 	// Should either succeed or handle the panic gracefully
@@ -294,7 +302,7 @@ func TestApplyFileChangeWithDifferentOperations(t *testing.T) {
 	ctx := context.Background()
 	branch := "test-branch"
 	
-	operations := []string{"add", "modify", "delete", "unknown"}
+	operations := []ChangeOperation{"add", "modify", "delete", "unknown"}
 	
 	for _, op := range operations {
 		t.Run(fmt.Sprintf("Operation-%s", op), func(t *testing.T) {
@@ -407,4 +415,277 @@ func TestWorkflowLogsStructure(t *testing.T) {
 	assert.Equal(t, "job2 logs", logs.JobLogs["job2"])
 	assert.Equal(t, "step1 logs", logs.StepLogs["step1"])
 	assert.Equal(t, "step2 logs", logs.StepLogs["step2"])
-}
\ No newline at end of file
+}
+
+// newMockGitHubAPI returns a GitHubIntegration whose go-github client talks to an httptest server
+func newMockGitHubAPI(t *testing.T) (*GitHubIntegration, *http.ServeMux) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := github.NewClient(nil)
+	baseURL, err := url.Parse(server.URL + "/")
+	assert.NoError(t, err)
+	client.BaseURL = baseURL
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	return &GitHubIntegration{
+		client:    client,
+		repoOwner: "owner",
+		repoName:  "repo",
+		logger:    logger,
+	}, mux
+}
+
+// decodeJSON decodes a mocked API request body
+func decodeJSON(r *http.Request, target interface{}) error {
+	return json.NewDecoder(r.Body).Decode(target)
+}
+
+// TestCreateTestBranchUsesTargetBranch verifies test branches are cut from the configured branch
+func TestCreateTestBranchUsesTargetBranch(t *testing.T) {
+	t.Run("configured target branch", func(t *testing.T) {
+		gh, mux := newMockGitHubAPI(t)
+		gh.SetTargetBranch("develop")
+
+		var requestedRef string
+		mux.HandleFunc("/repos/owner/repo/git/ref/", func(w http.ResponseWriter, r *http.Request) {
+			requestedRef = r.URL.Path
+			fmt.Fprint(w, `{"ref":"refs/heads/develop","object":{"sha":"abc123"}}`)
+		})
+		var createdFrom string
+		mux.HandleFunc("/repos/owner/repo/git/refs", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			var body map[string]string
+			assert.NoError(t, decodeJSON(r, &body))
+			createdFrom = body["sha"]
+			fmt.Fprint(w, `{"ref":"refs/heads/autofix-test"}`)
+		})
+
+		cleanup, err := gh.CreateTestBranch(context.Background(), "autofix-test", nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, cleanup)
+		assert.Equal(t, "/repos/owner/repo/git/ref/heads/develop", requestedRef)
+		assert.Equal(t, "abc123", createdFrom)
+	})
+
+	t.Run("falls back to repository default branch", func(t *testing.T) {
+		gh, mux := newMockGitHubAPI(t)
+
+		mux.HandleFunc("/repos/owner/repo", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"name":"repo","default_branch":"trunk"}`)
+		})
+		var requestedRef string
+		mux.HandleFunc("/repos/owner/repo/git/ref/", func(w http.ResponseWriter, r *http.Request) {
+			requestedRef = r.URL.Path
+			fmt.Fprint(w, `{"ref":"refs/heads/trunk","object":{"sha":"def456"}}`)
+		})
+		mux.HandleFunc("/repos/owner/repo/git/refs", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"ref":"refs/heads/autofix-test"}`)
+		})
+
+		_, err := gh.CreateTestBranch(context.Background(), "autofix-test", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "/repos/owner/repo/git/ref/heads/trunk", requestedRef)
+	})
+
+	t.Run("New falls back to repository default branch", func(t *testing.T) {
+		gh, mux := newMockGitHubAPI(t)
+		mux.HandleFunc("/repos/owner/repo", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"name":"repo","default_branch":"trunk"}`)
+		})
+		var requestedRef string
+		mux.HandleFunc("/repos/owner/repo/git/ref/", func(w http.ResponseWriter, r *http.Request) {
+			requestedRef = r.URL.Path
+			fmt.Fprint(w, `{"ref":"refs/heads/trunk","object":{"sha":"def456"}}`)
+		})
+		mux.HandleFunc("/repos/owner/repo/git/refs", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"ref":"refs/heads/autofix-test"}`)
+		})
+
+		oldGH, oldLLM := newGitHubIntegration, newLLMClient
+		t.Cleanup(func() { newGitHubIntegration, newLLMClient = oldGH, oldLLM })
+		newGitHubIntegration = func(ctx context.Context, token *dagger.Secret, owner, name string, endpoints *GitHubEndpoints, logger *logrus.Logger) (*GitHubIntegration, error) {
+			return gh, nil
+		}
+		newLLMClient = func(ctx context.Context, provider LLMProvider, apiKey *dagger.Secret, logger *logrus.Logger) (*LLMClient, error) {
+			return &LLMClient{provider: provider}, nil
+		}
+
+		m, err := New().
+			WithGitHubToken(createTestSecret("token", "ghp_test")).
+			WithLLMProvider("openai", createTestSecret("key", "sk-test")).
+			WithRepository("owner", "repo").
+			WithDryRun(true).
+			Initialize(context.Background())
+		require.NoError(t, err)
+
+		_, err = m.githubClient.CreateTestBranch(context.Background(), "autofix-test", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "/repos/owner/repo/git/ref/heads/trunk", requestedRef)
+
+		base, err := m.prEngine.(*PullRequestEngine).resolveBaseBranch(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "trunk", base, "fix PRs target the default branch too")
+	})
+}
+
+// workflowRunJSON renders a workflow run for mocked list responses
+func workflowRunJSON(id int64, conclusion string, createdAt time.Time) string {
+	return fmt.Sprintf(`{"id":%d,"name":"CI","status":"completed","conclusion":"%s","created_at":"%s"}`,
+		id, conclusion, createdAt.UTC().Format(time.RFC3339))
+}
+
+func writeWorkflowRunsPage(w http.ResponseWriter, r *http.Request, nextPage int, runs ...string) {
+	if nextPage > 0 {
+		w.Header().Set("Link", fmt.Sprintf(`<%s?page=%d>; rel="next"`, r.URL.Path, nextPage))
+	}
+	fmt.Fprintf(w, `{"total_count":%d,"workflow_runs":[%s]}`, len(runs), strings.Join(runs, ","))
+}
+
+// TestGetFailedWorkflowRunsPagination tests filtering, paging and stopping conditions
+func TestGetFailedWorkflowRunsPagination(t *testing.T) {
+	now := time.Now()
+
+	t.Run("StopsAtLookbackCutoff", func(t *testing.T) {
+		gh, mux := newMockGitHubAPI(t)
+		gh.SetFailedRunFilter(FailedRunFilter{Lookback: 6 * time.Hour})
+
+		var pages []string
+		mux.HandleFunc("/repos/owner/repo/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "failure", r.URL.Query().Get("status"))
+			assert.True(t, strings.HasPrefix(r.URL.Query().Get("created"), ">="))
+			page := r.URL.Query().Get("page")
+			pages = append(pages, page)
+			switch page {
+			case "":
+				writeWorkflowRunsPage(w, r, 2,
+					workflowRunJSON(5, "failure", now.Add(-time.Hour)),
+					workflowRunJSON(4, "success", now.Add(-2*time.Hour)))
+			case "2":
+				writeWorkflowRunsPage(w, r, 3,
+					workflowRunJSON(3, "failure", now.Add(-3*time.Hour)),
+					workflowRunJSON(2, "failure", now.Add(-7*time.Hour)))
+			default:
+				t.Errorf("unexpected page %s requested", page)
+			}
+		})
+
+		runs, err := gh.GetFailedWorkflowRuns(context.Background())
+		require.NoError(t, err)
+		require.Len(t, runs, 2)
+		assert.Equal(t, int64(5), runs[0].ID)
+		assert.Equal(t, int64(3), runs[1].ID)
+		assert.Equal(t, []string{"", "2"}, pages)
+	})
+
+	t.Run("StopsAtMaxResults", func(t *testing.T) {
+		gh, mux := newMockGitHubAPI(t)
+		gh.SetFailedRunFilter(FailedRunFilter{MaxResults: 2})
+
+		var requests int
+		mux.HandleFunc("/repos/owner/repo/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			assert.Equal(t, "2", r.URL.Query().Get("per_page"))
+			writeWorkflowRunsPage(w, r, 2,
+				workflowRunJSON(9, "failure", now.Add(-time.Minute)),
+				workflowRunJSON(8, "failure", now.Add(-2*time.Minute)))
+		})
+
+		runs, err := gh.GetFailedWorkflowRuns(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, runs, 2)
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("WorkflowFilterAndTimedOut", func(t *testing.T) {
+		gh, mux := newMockGitHubAPI(t)
+		gh.SetFailedRunFilter(FailedRunFilter{
+			Workflows:       []string{"ci.yml", "lint.yml"},
+			IncludeTimedOut: true,
+		})
+
+		mux.HandleFunc("/repos/owner/repo/actions/workflows/ci.yml/runs", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("status") == "timed_out" {
+				writeWorkflowRunsPage(w, r, 0, workflowRunJSON(12, "timed_out", now.Add(-30*time.Minute)))
+				return
+			}
+			writeWorkflowRunsPage(w, r, 0,
+				workflowRunJSON(10, "failure", now.Add(-2*time.Hour)),
+				workflowRunJSON(11, "failure", now.Add(-time.Hour)))
+		})
+		mux.HandleFunc("/repos/owner/repo/actions/workflows/lint.yml/runs", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("status") == "timed_out" {
+				writeWorkflowRunsPage(w, r, 0)
+				return
+			}
+			// Run 11 is also reported here and must be deduplicated
+			writeWorkflowRunsPage(w, r, 0,
+				workflowRunJSON(13, "failure", now.Add(-10*time.Minute)),
+				workflowRunJSON(11, "failure", now.Add(-time.Hour)))
+		})
+		mux.HandleFunc("/repos/owner/repo/actions/runs", func(w http.ResponseWriter, r *http.Request) {
+			t.Error("repository-wide listing should not be used with a workflow filter")
+		})
+
+		runs, err := gh.GetFailedWorkflowRuns(context.Background())
+		require.NoError(t, err)
+
+		var ids []int64
+		for _, run := range runs {
+			ids = append(ids, run.ID)
+		}
+		assert.Equal(t, []int64{13, 12, 11, 10}, ids)
+	})
+}
+
+// TestFailedRunFilterDefaults tests default lookback and result limits
+func TestFailedRunFilterDefaults(t *testing.T) {
+	filter := FailedRunFilter{}.withDefaults()
+	assert.Equal(t, DefaultFailureLookback, filter.Lookback)
+	assert.Equal(t, DefaultMaxFailedRuns, filter.MaxResults)
+
+	filter = FailedRunFilter{Lookback: time.Hour, MaxResults: 5}.withDefaults()
+	assert.Equal(t, time.Hour, filter.Lookback)
+	assert.Equal(t, 5, filter.MaxResults)
+
+	module := New().
+		WithFailureLookback(2*time.Hour).
+		WithMaxFailedRuns(20).
+		WithWorkflowFilter("ci.yml", "release.yml").
+		WithTimedOutRuns(true)
+	assert.Equal(t, 2*time.Hour, module.FailureLookback)
+	assert.Equal(t, 20, module.MaxFailedRuns)
+	assert.Equal(t, []string{"ci.yml", "release.yml"}, module.WorkflowFilter)
+	assert.True(t, module.IncludeTimedOutRuns)
+}
+
+// TestGetRepositoryContext tests repository language detection and caching
+func TestGetRepositoryContext(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+
+	requests := 0
+	mux.HandleFunc("/repos/owner/repo", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"name":"repo","default_branch":"develop","language":"Python"}`)
+	})
+
+	for i := 0; i < 2; i++ {
+		repoCtx, err := gh.GetRepositoryContext(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "owner", repoCtx.Owner)
+		assert.Equal(t, "repo", repoCtx.Name)
+		assert.Equal(t, "develop", repoCtx.DefaultBranch)
+		assert.Equal(t, "Python", repoCtx.Language)
+		assert.Equal(t, "pytest", repoCtx.Framework)
+	}
+	assert.Equal(t, 1, requests)
+
+	assert.Equal(t, "go", frameworkForLanguage("Go"))
+	assert.Equal(t, "npm", frameworkForLanguage("TypeScript"))
+	assert.Equal(t, "", frameworkForLanguage("COBOL"))
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// diffContextLines is how many unchanged lines surround each hunk, as in git diff
+	diffContextLines = 3
+	// maxDiffEdits bounds the edit distance searched for a minimal diff. Files that differ
+	// more are diffed as removing every old line and adding every new one, which is still a
+	// valid patch.
+	maxDiffEdits = 1000
+	// binarySniffBytes is how much of a file is searched for a NUL byte, as git does
+	binarySniffBytes = 8000
+)
+
+// diffLine is one line of an edit script: kind is ' ' for an unchanged line, '-' for a
+// removed line and '+' for an added line. text keeps the line's newline, if it has one.
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// splitLines splits s after each newline, so a missing final newline stays visible
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineEdits returns a shortest edit script turning a into b, using Myers' algorithm
+func lineEdits(a, b []string) []diffLine {
+	// Common prefixes and suffixes are kept out of the search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	edits := make([]diffLine, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		edits = append(edits, diffLine{' ', line})
+	}
+	edits = append(edits, myersEdits(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		edits = append(edits, diffLine{' ', line})
+	}
+	return edits
+}
+
+// myersEdits finds the shortest edit script by keeping, for each edit distance d, the
+// furthest x reached on every diagonal k = x - y, then walking the snapshots back
+func myersEdits(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxDiffEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	// trace[d] holds v[k] for k in [-d-1, d+1] before step d, at index k+d+1
+	var trace [][]int
+
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackEdits(a, b, trace)
+			}
+		}
+	}
+
+	edits := make([]diffLine, 0, n+m)
+	for _, line := range a {
+		edits = append(edits, diffLine{'-', line})
+	}
+	for _, line := range b {
+		edits = append(edits, diffLine{'+', line})
+	}
+	return edits
+}
+
+// backtrackEdits rebuilds the edit script from the end of a and b to their start
+func backtrackEdits(a, b []string, trace [][]int) []diffLine {
+	var reversed []diffLine
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		snapshot := trace[d]
+		at := func(k int) int { return snapshot[k+d+1] }
+
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffLine{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, diffLine{'+', b[y-1]})
+			} else {
+				reversed = append(reversed, diffLine{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	edits := make([]diffLine, len(reversed))
+	for i, edit := range reversed {
+		edits[len(reversed)-1-i] = edit
+	}
+	return edits
+}
+
+// unifiedDiff returns a git-style unified diff of one file for a change operation. Added
+// files diff against /dev/null; deleted files diff to it. It is empty when nothing changed.
+func unifiedDiff(path, oldContent, newContent string, operation ChangeOperation) string {
+	return unifiedDiffAt(path, path, oldContent, newContent, operation, 0)
+}
+
+// changeDiff renders a proposed change as a unified diff of its OldContent and NewContent.
+// Changes to a line range are numbered from LineStart; other changes diff whole files. A
+// rename without NewContent moves the file unchanged, which is only a header.
+func changeDiff(change CodeChange) string {
+	operation := ChangeOperation(valueOr(string(change.Operation), string(ChangeOperationModify)))
+	offset := 0
+	if operation == ChangeOperationModify && change.LineStart > 0 {
+		offset = change.LineStart - 1
+	}
+	oldPath, newPath := path.Clean(change.FilePath), path.Clean(change.FilePath)
+	oldContent, newContent := change.OldContent, change.NewContent
+	if operation == ChangeOperationRename {
+		newPath = path.Clean(change.NewFilePath)
+		if newContent == "" {
+			newContent = oldContent
+		}
+	}
+	return unifiedDiffAt(oldPath, newPath, oldContent, newContent, operation, offset)
+}
+
+// unifiedDiffAt is unifiedDiff for contents that start offset lines into the file, moved
+// from oldPath to newPath by renames. Binary contents are not diffed; a note that they
+// differ replaces the hunks, as in git diff.
+func unifiedDiffAt(oldPath, newPath, oldContent, newContent string, operation ChangeOperation, offset int) string {
+	oldName, newName := "a/"+oldPath, "b/"+newPath
+	var header strings.Builder
+	fmt.Fprintf(&header, "diff --git a/%s b/%s\n", oldPath, newPath)
+	switch operation {
+	case ChangeOperationAdd:
+		header.WriteString("new file mode 100644\n")
+		oldName, oldContent = "/dev/null", ""
+	case ChangeOperationDelete:
+		header.WriteString("deleted file mode 100644\n")
+		newName, newContent = "/dev/null", ""
+	case ChangeOperationRename:
+		if oldContent == newContent {
+			header.WriteString("similarity index 100%\n")
+		}
+		fmt.Fprintf(&header, "rename from %s\nrename to %s\n", oldPath, newPath)
+		if oldContent == newContent {
+			return header.String()
+		}
+	default:
+		if oldContent == newContent {
+			return ""
+		}
+	}
+
+	if isBinaryContent(oldContent) || isBinaryContent(newContent) {
+		fmt.Fprintf(&header, "Binary files %s and %s differ\n", oldName, newName)
+		return header.String()
+	}
+	hunks := diffHunks(lineEdits(splitLines(oldContent), splitLines(newContent)), offset)
+	if hunks == "" {
+		// An added or deleted empty file has no hunks
+		return header.String()
+	}
+	fmt.Fprintf(&header, "--- %s\n+++ %s\n", oldName, newName)
+	return header.String() + hunks
+}
+
+// isBinaryContent reports whether content looks binary: a NUL byte near its start or
+// invalid UTF-8
+func isBinaryContent(content string) bool {
+	return strings.IndexByte(content[:min(len(content), binarySniffBytes)], 0) >= 0 || !utf8.ValidString(content)
+}
+
+// diffHunks formats the changed lines of an edit script as unified diff hunks, numbering
+// lines from offset
+func diffHunks(edits []diffLine, offset int) string {
+	var out strings.Builder
+	// oldLine and newLine count the lines before edits[i] on each side
+	oldLine, newLine := offset, offset
+	for i := 0; i < len(edits); {
+		if edits[i].kind == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		// The hunk starts with up to diffContextLines unchanged lines before the change and
+		// runs until more than twice that many unchanged lines follow a change
+		start := max(i-diffContextLines, 0)
+		end, unchanged := i, 0
+		for end < len(edits) && unchanged <= 2*diffContextLines {
+			if edits[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+			end++
+		}
+		end -= max(unchanged-diffContextLines, 0)
+
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+		oldCount, newCount := 0, 0
+		var body strings.Builder
+		for _, edit := range edits[start:end] {
+			if edit.kind != '+' {
+				oldCount++
+			}
+			if edit.kind != '-' {
+				newCount++
+			}
+			body.WriteByte(edit.kind)
+			body.WriteString(edit.text)
+			if !strings.HasSuffix(edit.text, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n%s", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount), body.String())
+
+		oldLine, newLine = oldStart+oldCount, newStart+newCount
+		i = end
+	}
+	return out.String()
+}
+
+// hunkRange formats the 0-based start and length of a hunk side. Empty ranges name the line
+// before them, as diff does.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// truncateDiff cuts diff after the last whole line within limit bytes and returns how many
+// lines were cut
+func truncateDiff(diff string, limit int) (string, int) {
+	if len(diff) <= limit {
+		return diff, 0
+	}
+	cut := strings.LastIndexByte(diff[:limit], '\n') + 1
+	return diff[:cut], strings.Count(diff[cut:], "\n")
+}
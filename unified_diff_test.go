@@ -0,0 +1,230 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLineEdits tests that edit scripts are minimal and rebuild both sides
+func TestLineEdits(t *testing.T) {
+	tests := []struct {
+		old, new string
+		changes  int
+	}{
+		{"", "", 0},
+		{"a\n", "a\n", 0},
+		{"", "a\nb\n", 2},
+		{"a\nb\n", "", 2},
+		{"a\nb\nc\n", "a\nB\nc\n", 2},
+		{"a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n", 5},
+		{"a\nb", "a\nb\n", 2},
+	}
+	for _, tt := range tests {
+		edits := lineEdits(splitLines(tt.old), splitLines(tt.new))
+		var old, new strings.Builder
+		changes := 0
+		for _, edit := range edits {
+			if edit.kind != '+' {
+				old.WriteString(edit.text)
+			}
+			if edit.kind != '-' {
+				new.WriteString(edit.text)
+			}
+			if edit.kind != ' ' {
+				changes++
+			}
+		}
+		assert.Equal(t, tt.old, old.String())
+		assert.Equal(t, tt.new, new.String())
+		assert.Equal(t, tt.changes, changes, "%q -> %q", tt.old, tt.new)
+	}
+}
+
+// TestUnifiedDiff tests the git diff format of added, modified and deleted files
+func TestUnifiedDiff(t *testing.T) {
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	modified := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	assert.Equal(t, "diff --git a/n.txt b/n.txt\n--- a/n.txt\n+++ b/n.txt\n"+
+		"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n"+
+		"@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n", unifiedDiff("n.txt", old, modified, ChangeOperationModify))
+
+	assert.Equal(t, "diff --git a/new.go b/new.go\nnew file mode 100644\n--- /dev/null\n+++ b/new.go\n"+
+		"@@ -0,0 +1,2 @@\n+package new\n+var x = 1\n\\ No newline at end of file\n", unifiedDiff("new.go", "", "package new\nvar x = 1", ChangeOperationAdd))
+	assert.Equal(t, "diff --git a/old.go b/old.go\ndeleted file mode 100644\n--- a/old.go\n+++ /dev/null\n"+
+		"@@ -1,1 +0,0 @@\n-package old\n", unifiedDiff("old.go", "package old\n", "", ChangeOperationDelete))
+	assert.Equal(t, "diff --git a/empty b/empty\nnew file mode 100644\n", unifiedDiff("empty", "", "", ChangeOperationAdd))
+	assert.Empty(t, unifiedDiff("same.go", "x\n", "x\n", ChangeOperationModify))
+
+	assert.Contains(t, unifiedDiff("eof.txt", "a\nb", "a\nc", ChangeOperationModify),
+		"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n")
+}
+
+// TestRenameDiffAppliesWithGit tests that git apply moves renamed files, with and without
+// content changes
+func TestRenameDiffAppliesWithGit(t *testing.T) {
+	repo := gitRepo(t)
+	writeRepoFile(t, repo, "old/moved.txt", "same\n")
+	writeRepoFile(t, repo, "edited.txt", "a\nb\n")
+	patch := changeDiff(CodeChange{FilePath: "old/moved.txt", NewFilePath: "new/moved.txt", Operation: ChangeOperationRename}) +
+		changeDiff(CodeChange{FilePath: "edited.txt", NewFilePath: "renamed.txt", Operation: ChangeOperationRename, OldContent: "a\nb\n", NewContent: "a\nc\n"})
+	gitApply(t, repo, patch)
+
+	for path, want := range map[string]string{"new/moved.txt": "same\n", "renamed.txt": "a\nc\n"} {
+		content, err := os.ReadFile(filepath.Join(repo, path))
+		require.NoError(t, err)
+		assert.Equal(t, want, string(content), path)
+	}
+	for _, path := range []string{"old/moved.txt", "edited.txt"} {
+		_, err := os.Stat(filepath.Join(repo, path))
+		assert.True(t, os.IsNotExist(err), path)
+	}
+}
+
+// TestUnifiedDiffAppliesWithGit tests that git apply accepts the generated diffs
+func TestUnifiedDiffAppliesWithGit(t *testing.T) {
+	long := func(lines int, change func(i int) string) string {
+		var b strings.Builder
+		for i := 0; i < lines; i++ {
+			b.WriteString(change(i) + "\n")
+		}
+		return b.String()
+	}
+	files := []struct {
+		path, old, new string
+		operation      ChangeOperation
+	}{
+		{"a.txt", "a\nb\nc\n", "a\nB\nc\nd\n", ChangeOperationModify},
+		{"dir/long.txt", long(200, func(i int) string { return strings.Repeat("x", i%7) }),
+			long(205, func(i int) string {
+				if i%40 == 3 {
+					return "changed"
+				}
+				return strings.Repeat("x", i%7)
+			}), ChangeOperationModify},
+		{"eof.txt", "last line", "last line\n", ChangeOperationModify},
+		{"rewritten.txt", long(1500, func(i int) string { return "old" }), long(1500, func(i int) string { return "new" }), ChangeOperationModify},
+		{"added/file.go", "", "package added\n", ChangeOperationAdd},
+		{"removed.txt", "bye\n", "", ChangeOperationDelete},
+	}
+
+	repo := gitRepo(t)
+	var patch strings.Builder
+	for _, f := range files {
+		if f.operation != ChangeOperationAdd {
+			writeRepoFile(t, repo, f.path, f.old)
+		}
+		patch.WriteString(unifiedDiff(f.path, f.old, f.new, f.operation))
+	}
+	gitApply(t, repo, patch.String())
+
+	for _, f := range files {
+		content, err := os.ReadFile(filepath.Join(repo, f.path))
+		if f.operation == ChangeOperationDelete {
+			assert.True(t, os.IsNotExist(err), f.path)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, f.new, string(content), f.path)
+	}
+}
+
+// gitRepo returns an empty scratch directory, skipping the test without git
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	out, err := exec.Command("git", "-C", dir, "init", "-q").CombinedOutput()
+	require.NoError(t, err, string(out))
+	return dir
+}
+
+func writeRepoFile(t *testing.T, repo, path, content string) {
+	t.Helper()
+	target := filepath.Join(repo, filepath.FromSlash(path))
+	require.NoError(t, os.MkdirAll(filepath.Dir(target), 0o755))
+	require.NoError(t, os.WriteFile(target, []byte(content), 0o644))
+}
+
+// gitApply applies patch in repo with git apply, failing the test when it does not apply
+func gitApply(t *testing.T, repo, patch string) {
+	t.Helper()
+	cmd := exec.Command("git", "-C", repo, "apply", "--whitespace=nowarn", "-")
+	cmd.Stdin = strings.NewReader(patch)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, "git apply: %s\n%s", out, patch)
+}
+
+// TestChangeDiffGolden golden-files the diffs of proposed changes in testdata/diff
+func TestChangeDiffGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		change CodeChange
+	}{
+		{"modify", CodeChange{
+			FilePath:   "internal/config/config.go",
+			Operation:  ChangeOperationModify,
+			OldContent: "func Load(path string) (*Config, error) {\n\tdata, _ := os.ReadFile(path)\n\treturn parse(data)\n}\n",
+			NewContent: "func Load(path string) (*Config, error) {\n\tdata, err := os.ReadFile(path)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n\treturn parse(data)\n}\n",
+			LineStart:  40,
+			LineEnd:    43,
+		}},
+		{"add", CodeChange{
+			FilePath:   "./internal/config/config_test.go",
+			Operation:  ChangeOperationAdd,
+			NewContent: "package config\n\nimport \"testing\"\n\nfunc TestLoadMissing(t *testing.T) {\n\tif _, err := Load(\"missing\"); err == nil {\n\t\tt.Fatal(\"expected an error\")\n\t}\n}\n",
+		}},
+		{"delete", CodeChange{
+			FilePath:   "internal/config/legacy.go",
+			Operation:  ChangeOperationDelete,
+			OldContent: "package config\n\n// Deprecated: use Load\nfunc LoadLegacy() {}\n",
+		}},
+		{"multi-hunk", CodeChange{
+			FilePath:   "go.mod",
+			OldContent: "module example.com/app\n\ngo 1.20\n\nrequire (\n\tgithub.com/a/a v1.0.0\n\tgithub.com/b/b v1.0.0\n\tgithub.com/c/c v1.0.0\n\tgithub.com/d/d v1.0.0\n\tgithub.com/e/e v1.0.0\n\tgithub.com/f/f v1.0.0\n\tgithub.com/g/g v1.0.0\n\tgithub.com/h/h v1.0.0\n\tgithub.com/i/i v1.0.0\n)\n",
+			NewContent: "module example.com/app\n\ngo 1.22\n\nrequire (\n\tgithub.com/a/a v1.0.0\n\tgithub.com/b/b v1.0.0\n\tgithub.com/c/c v1.0.0\n\tgithub.com/d/d v1.0.0\n\tgithub.com/e/e v1.0.0\n\tgithub.com/f/f v1.0.0\n\tgithub.com/g/g v1.0.0\n\tgithub.com/h/h v1.0.0\n\tgithub.com/i/i v1.2.0\n)\n",
+		}},
+		{"rename", CodeChange{
+			FilePath:    "internal/config/legacy.go",
+			NewFilePath: "internal/config/compat.go",
+			Operation:   ChangeOperationRename,
+		}},
+		{"rename-modify", CodeChange{
+			FilePath:    "internal/config/legacy.go",
+			NewFilePath: "internal/config/compat.go",
+			Operation:   ChangeOperationRename,
+			OldContent:  "package config\n\n// Deprecated: use Load\nfunc LoadLegacy() {}\n",
+			NewContent:  "package config\n\n// Deprecated: use Load\nfunc LoadCompat() {}\n",
+		}},
+		{"binary", CodeChange{
+			FilePath:   "assets/logo.png",
+			Operation:  ChangeOperationModify,
+			OldContent: "\x89PNG\r\n\x1a\n\x00\x00",
+			NewContent: "\x89PNG\r\n\x1a\n\x00\x01",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertGoldenFile(t, filepath.Join("testdata", "diff", tt.name+".diff"), []byte(changeDiff(tt.change)))
+		})
+	}
+}
+
+// TestTruncateDiff tests cutting diffs on line boundaries
+func TestTruncateDiff(t *testing.T) {
+	diff := "@@ -1,3 +1,3 @@\n-a\n+b\n c\n"
+	got, omitted := truncateDiff(diff, len(diff))
+	assert.Equal(t, diff, got)
+	assert.Zero(t, omitted)
+
+	got, omitted = truncateDiff(diff, 21)
+	assert.Equal(t, "@@ -1,3 +1,3 @@\n-a\n", got)
+	assert.Equal(t, 2, omitted)
+}
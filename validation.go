@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxRefLength is the longest ref GitHub accepts, in bytes
+	maxRefLength = 255
+	// maxBranchLength is the longest branch name, leaving room for the refs/heads/ prefix
+	maxBranchLength = maxRefLength - len("refs/heads/")
+	// maxOwnerLength is the longest GitHub user or organization login
+	maxOwnerLength = 39
+	// maxRepoNameLength is the longest GitHub repository name
+	maxRepoNameLength = 100
+)
+
+var (
+	// ownerPattern matches GitHub logins: letters, digits and inner hyphens, plus the
+	// underscore of Enterprise Managed User logins
+	ownerPattern = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9_-]*[A-Za-z0-9])?$`)
+	// repoNamePattern matches the characters GitHub keeps in repository names
+	repoNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	// unsafeRefChars matches runs of characters sanitizeRefComponent replaces
+	unsafeRefChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+)
+
+// validateRunID checks that runID can be a workflow run ID
+func validateRunID(runID int64) error {
+	if runID <= 0 {
+		return fmt.Errorf("%w %d: must be positive", ErrInvalidRunID, runID)
+	}
+	return nil
+}
+
+// parseRunID parses a workflow run ID given on the command line
+func parseRunID(value string) (int64, error) {
+	runID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w %q: not a number", ErrInvalidRunID, value)
+	}
+	return runID, validateRunID(runID)
+}
+
+// validatePRNumber checks that number can be a pull request number
+func validatePRNumber(number int) error {
+	if number <= 0 {
+		return fmt.Errorf("%w %d: must be positive", ErrInvalidPRNumber, number)
+	}
+	return nil
+}
+
+// parsePRNumber parses a pull request number given on the command line, with or without #
+func parsePRNumber(value string) (int, error) {
+	number, err := strconv.Atoi(strings.TrimPrefix(value, "#"))
+	if err != nil {
+		return 0, fmt.Errorf("%w %q: not a number", ErrInvalidPRNumber, value)
+	}
+	return number, validatePRNumber(number)
+}
+
+// validateOwner checks a repository owner against the logins GitHub allows
+func validateOwner(owner string) error {
+	if len(owner) > maxOwnerLength || !ownerPattern.MatchString(owner) {
+		return fmt.Errorf("%w owner %q: use letters, digits and hyphens, at most %d characters", ErrInvalidRepo, owner, maxOwnerLength)
+	}
+	return nil
+}
+
+// validateRepository checks a repository owner and name against the characters GitHub allows
+func validateRepository(owner, name string) error {
+	if err := validateOwner(owner); err != nil {
+		return err
+	}
+	if len(name) > maxRepoNameLength || !repoNamePattern.MatchString(name) || name == "." || name == ".." {
+		return fmt.Errorf("%w name %q: use letters, digits, '.', '-' and '_', at most %d characters", ErrInvalidRepo, name, maxRepoNameLength)
+	}
+	return nil
+}
+
+// sanitizeRefComponent makes s safe inside a branch name component: it is lowercased, runs of
+// other characters than letters, digits, '.', '-' and '_' (including '/') become a hyphen, and
+// the dots and hyphens git rejects at the edges of a component are trimmed
+func sanitizeRefComponent(s string) string {
+	s = unsafeRefChars.ReplaceAllString(strings.ToLower(s), "-")
+	for strings.Contains(s, "..") {
+		s = strings.ReplaceAll(s, "..", ".")
+	}
+	for {
+		trimmed := strings.TrimSuffix(strings.Trim(s, ".-"), ".lock")
+		if trimmed == s {
+			return s
+		}
+		s = trimmed
+	}
+}
+
+// branchName returns prefix followed by the sanitized, non-empty components joined with
+// hyphens and suffix. The components are shortened so the branch fits maxBranchLength.
+func branchName(prefix, suffix string, components ...string) string {
+	var parts []string
+	for _, component := range components {
+		if component = sanitizeRefComponent(component); component != "" {
+			parts = append(parts, component)
+		}
+	}
+	middle := strings.Join(parts, "-")
+	if middle == "" {
+		return prefix + strings.TrimPrefix(suffix, "-")
+	}
+	if room := maxBranchLength - len(prefix) - len(suffix); len(middle) > room {
+		middle = sanitizeRefComponent(middle[:max(room, 0)])
+	}
+	return prefix + middle + suffix
+}
+
+// validateBranchName checks name against the rules of git check-ref-format --branch and the
+// ref length GitHub accepts
+func validateBranchName(name string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w %q: %s", ErrInvalidBranch, name, reason)
+	}
+
+	switch {
+	case name == "":
+		return invalid("must not be empty")
+	case len(name) > maxBranchLength:
+		return invalid(fmt.Sprintf("longer than %d bytes", maxBranchLength))
+	case name == "@":
+		return invalid(`must not be "@"`)
+	case strings.HasPrefix(name, "-"):
+		return invalid("must not start with '-'")
+	case strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/"):
+		return invalid("must not start or end with '/'")
+	case strings.HasSuffix(name, "."):
+		return invalid("must not end with '.'")
+	}
+	for _, sequence := range []string{"..", "@{", "//"} {
+		if strings.Contains(name, sequence) {
+			return invalid(fmt.Sprintf("must not contain %q", sequence))
+		}
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return invalid(fmt.Sprintf("must not contain %q", r))
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return invalid("components must not start with '.' or end with \".lock\"")
+		}
+	}
+	return nil
+}
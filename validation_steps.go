@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StepStatus is the outcome of a validation step
+type StepStatus string
+
+const (
+	StepPassed  StepStatus = "passed"
+	StepFailed  StepStatus = "failed"
+	StepSkipped StepStatus = "skipped" // the command or make target does not exist in the repository, or publishes packages
+)
+
+// stepOutputLines is how many trailing lines of a step's output are kept in its result
+const stepOutputLines = 20
+
+// StepResult is the outcome of running a fix's validation step in the test container
+type StepResult struct {
+	Name     string        `json:"name"`
+	Command  string        `json:"command"`
+	Status   StepStatus    `json:"status"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+	// Output holds the last lines of the step's output
+	Output string `json:"output,omitempty"`
+	// Note explains why the step failed or was skipped
+	Note string `json:"note,omitempty"`
+}
+
+// failedSteps returns the validation steps that failed
+func failedSteps(steps []StepResult) []StepResult {
+	var failed []StepResult
+	for _, step := range steps {
+		if step.Status == StepFailed {
+			failed = append(failed, step)
+		}
+	}
+	return failed
+}
+
+// extraValidationSteps returns the steps that are not one of the pipeline's stages. Steps
+// with a stage's command only set that stage's timeout, so they are not run twice.
+func extraValidationSteps(frameworks []*TestFramework, steps []ValidationStep) []ValidationStep {
+	var extra []ValidationStep
+	for _, step := range steps {
+		stage := step.Command == "" || step.Command == workflowLintCommand
+		for _, framework := range frameworks {
+			switch step.Command {
+			case framework.LintCommand, framework.BuildCommand, framework.TestCommand, framework.CoverageCommand:
+				stage = true
+			}
+		}
+		if !stage {
+			extra = append(extra, step)
+		}
+	}
+	return extra
+}
+
+// stepsFramework returns the framework whose container the validation steps run in: the
+// first one at the repository root, or the first one detected
+func stepsFramework(frameworks []*TestFramework) *TestFramework {
+	for _, framework := range frameworks {
+		if frameworkDir(framework) == "." {
+			return framework
+		}
+	}
+	return frameworks[0]
+}
+
+// runValidationSteps runs the fix's validation steps that are not pipeline stages from the
+// repository root, once the tests passed. Their results are added to result, which fails
+// when a step does.
+func (e *TestEngine) runValidationSteps(ctx context.Context, workspace ContainerInterface, repository string, frameworks []*TestFramework, result *TestResult, steps []ValidationStep) {
+	steps = extraValidationSteps(frameworks, steps)
+	if len(steps) == 0 || !result.testsPassed() {
+		return
+	}
+
+	framework := stepsFramework(frameworks)
+	container := e.frameworkContainer(workspace, repository, framework).WithWorkdir("/workspace")
+	for _, step := range steps {
+		stepResult := e.runValidationStep(ctx, container, step)
+		e.logger.WithFields(logrus.Fields{
+			"step":     step.Name,
+			"command":  step.Command,
+			"status":   stepResult.Status,
+			"duration": stepResult.Duration,
+		}).Info("Validation step completed")
+
+		result.Steps = append(result.Steps, stepResult)
+		if stepResult.Status == StepFailed {
+			result.Success = false
+			result.Errors = append(result.Errors, fmt.Sprintf("Validation step %s failed: %s", step.Name, stepResult.Note))
+		}
+	}
+}
+
+// runValidationStep runs a step's command with its environment under its timeout. The step
+// passes when the command exits 0 and its output contains Expected, if set.
+func (e *TestEngine) runValidationStep(ctx context.Context, container ContainerInterface, step ValidationStep) StepResult {
+	if publish := publishCommand(step.Command); publish != "" && !e.publishAllowed {
+		return StepResult{
+			Name:    step.Name,
+			Command: step.Command,
+			Status:  StepSkipped,
+			Note:    fmt.Sprintf("%s publishes packages, which is disabled in test containers", publish),
+		}
+	}
+
+	env := e.stepEnv(step)
+	for _, key := range sortedKeys(env) {
+		container = container.WithEnvVariable(key, env[key])
+	}
+	timeout := step.Timeout
+	if timeout <= 0 {
+		timeout = e.timeouts.withDefaults().Test
+	}
+
+	start := time.Now()
+	output, err := runStage(ctx, step.Name, timeout, func(ctx context.Context) (string, error) {
+		_, output, err := e.runCommand(ctx, container, step.Name, step.Command)
+		return output, err
+	})
+	result := StepResult{
+		Name:     step.Name,
+		Command:  step.Command,
+		Status:   StepPassed,
+		Duration: time.Since(start),
+		Output:   tailLines(output, stepOutputLines),
+	}
+
+	var cmdErr *commandError
+	switch {
+	case errors.As(err, &cmdErr):
+		result.ExitCode = cmdErr.exitCode
+		result.Status = StepFailed
+		result.Note = fmt.Sprintf("exited with code %d", cmdErr.exitCode)
+		if missing := missingStepCommand(step.Command, cmdErr.exitCode, output); missing != "" {
+			result.Status = StepSkipped
+			result.Note = missing
+		}
+	case err != nil:
+		result.Status = StepFailed
+		result.Note = err.Error()
+	case step.Expected != "" && !strings.Contains(output, step.Expected):
+		result.Status = StepFailed
+		result.Note = fmt.Sprintf("output does not contain %q", step.Expected)
+	}
+	return result
+}
+
+// missingStepCommand explains a step that failed because its command or make target does
+// not exist in the repository, empty when the step failed otherwise
+func missingStepCommand(command string, exitCode int, output string) string {
+	fields := strings.Fields(command)
+	switch {
+	case exitCode == 127:
+		return fmt.Sprintf("%s is not installed in the test container", path.Base(fields[0]))
+	case fields[0] != "make":
+	case strings.Contains(output, "No targets specified and no makefile found"):
+		return "the repository has no Makefile"
+	case strings.Contains(output, "No rule to make target"):
+		return fmt.Sprintf("the Makefile has no %s target", strings.Join(fields[1:], " "))
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunTestsValidationSteps tests that a fix's validation steps run after the pipeline and
+// pass, fail or are skipped by their exit code and output
+func TestRunTestsValidationSteps(t *testing.T) {
+	goMock := func() *MockContainerProvider {
+		mockProvider := NewMockContainerProvider()
+		mock := mockProvider.MockContainer
+		mock.FileSystem = map[string]string{"go.mod": "module test\n\ngo 1.22"}
+		mock.SetCommandOutput("go test -json ./...", "PASS: 5 passed, 0 failed\nok\ttest\t0.005s", "", 0, nil)
+		return mockProvider
+	}
+	steps := []ValidationStep{
+		{Name: "Vet", Command: "go vet ./...", Expected: "vet ok", Environment: map[string]string{"CGO_ENABLED": "0"}},
+		{Name: "Generate", Command: "make generate", Expected: "generated"},
+		{Name: "Dependency Check", Command: "make deps-check"},
+		{Name: "Security Scan", Command: "gosec ./..."},
+		{Name: "Unit Tests", Command: "go test -json ./..."},
+	}
+
+	t.Run("Results", func(t *testing.T) {
+		mockProvider := goMock()
+		mock := mockProvider.MockContainer
+		mock.SetCommandOutput("go vet ./...", "vet ok\n", "", 0, nil)
+		mock.SetCommandOutput("make generate", "nothing to be done\n", "", 0, nil)
+		mock.SetCommandOutput("make deps-check", "", "make: *** No rule to make target 'deps-check'.  Stop.\n", 2, nil)
+		mock.SetCommandOutput("gosec ./...", "", "sh: gosec: not found\n", 127, nil)
+		e := NewTestEngine(0, quietLogger())
+		e.SetContainerProvider(mockProvider)
+
+		result, err := e.RunTests(context.Background(), "owner", "repo", "main", steps...)
+		require.NoError(t, err)
+		require.Len(t, result.Steps, 4, "steps running a stage's command are not run again")
+
+		assert.Equal(t, StepPassed, result.Steps[0].Status)
+		assert.Equal(t, "0", mock.EnvVars["CGO_ENABLED"])
+		assert.Equal(t, "/workspace", mock.WorkingDir)
+
+		assert.Equal(t, StepFailed, result.Steps[1].Status)
+		assert.Equal(t, `output does not contain "generated"`, result.Steps[1].Note)
+		assert.Equal(t, "nothing to be done", result.Steps[1].Output)
+
+		assert.Equal(t, StepSkipped, result.Steps[2].Status)
+		assert.Equal(t, 2, result.Steps[2].ExitCode)
+		assert.Equal(t, "the Makefile has no deps-check target", result.Steps[2].Note)
+		assert.Equal(t, StepSkipped, result.Steps[3].Status)
+		assert.Equal(t, "gosec is not installed in the test container", result.Steps[3].Note)
+
+		assert.False(t, result.Success)
+		assert.True(t, result.TestsPassed)
+		assert.Contains(t, result.Errors, `Validation step Generate failed: output does not contain "generated"`)
+		assert.Len(t, failedSteps(result.Steps), 1)
+
+		testRuns := 0
+		for _, args := range mock.ExecHistory {
+			if slices.Equal(args, []string{"go", "test", "-json", "./..."}) {
+				testRuns++
+			}
+		}
+		assert.Equal(t, 1, testRuns)
+	})
+
+	t.Run("TestsFailed", func(t *testing.T) {
+		mockProvider := goMock()
+		mock := mockProvider.MockContainer
+		mock.SetCommandOutput("go test -json ./...", "FAIL\ttest\t0.005s", "", 1, nil)
+		e := NewTestEngine(0, quietLogger())
+		e.SetContainerProvider(mockProvider)
+
+		result, err := e.RunTests(context.Background(), "owner", "repo", "main", steps...)
+		require.NoError(t, err)
+		assert.Empty(t, result.Steps)
+		assert.NotContains(t, mock.ExecHistory, []string{"go", "vet", "./..."})
+	})
+}
+
+// TestValidateFixStepResults tests that a failed validation step fails the fix and that step
+// results are listed in the PR body
+func TestValidateFixStepResults(t *testing.T) {
+	ctx := context.Background()
+	validated := func(steps ...StepResult) *FixValidationResult {
+		var branches []string
+		m := coveragePolicyAutofix("either", 0, 0, &branches)
+		m.testEngine = &mockTestEngine{
+			runTestsFunc: func(ctx context.Context, owner, repo, branch string) (*TestResult, error) {
+				return &TestResult{Success: true, TestsPassed: true, PassedTests: 10, Coverage: 90, Steps: steps}, nil
+			},
+		}
+		res, err := m.ValidateFix(ctx, &ProposedFix{ID: "f1"})
+		require.NoError(t, err)
+		return res
+	}
+
+	res := validated(
+		StepResult{Name: "Build Check", Command: "make build", Status: StepPassed},
+		StepResult{Name: "Dependency Check", Command: "make deps-check", Status: StepSkipped, Note: "the Makefile has no deps-check target"},
+	)
+	assert.True(t, res.Valid)
+	assert.Len(t, res.StepResults, 2)
+
+	body := NewPullRequestEngine(nil, quietLogger()).generatePRBody(&FailureAnalysisResult{ID: "a1"}, res)
+	assert.Contains(t, body, "**Validation Steps**:\n"+
+		"- ✅ Build Check (`make build`)\n"+
+		"- ⏭️ Dependency Check (`make deps-check`): the Makefile has no deps-check target\n")
+
+	res = validated(StepResult{Name: "Security Scan", Command: "make security-scan", Status: StepFailed, Note: "exited with code 1"})
+	assert.False(t, res.Valid)
+	assert.Contains(t, res.Errors, "Validation step Security Scan failed: exited with code 1")
+
+	body = NewPullRequestEngine(nil, quietLogger()).generatePRBody(&FailureAnalysisResult{ID: "a1"}, res)
+	assert.Contains(t, body, "- ❌ Security Scan (`make security-scan`): exited with code 1\n")
+}
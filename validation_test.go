@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSanitizeRefComponent tests turning LLM-provided IDs into valid branch name components
+func TestSanitizeRefComponent(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"fix-456", "fix-456"},
+		{"Fix Missing Import", "fix-missing-import"},
+		{"fix/parser/nil-check", "fix-parser-nil-check"},
+		{"fix: handle ~^:?*[\\ chars", "fix-handle-chars"},
+		{"..hidden..file..", "hidden.file"},
+		{"-leading-and-trailing-", "leading-and-trailing"},
+		{"config.lock", "config"},
+		{"deps.lock.lock", "deps"},
+		{"fix@{upstream}", "fix-upstream"},
+		{"tab\tand\nnewline", "tab-and-newline"},
+		{"émoji 🚀 fix", "moji-fix"},
+		{"snake_case.v2", "snake_case.v2"},
+		{"///", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := sanitizeRefComponent(tt.input)
+			assert.Equal(t, tt.want, got)
+			if got != "" {
+				assert.NoError(t, validateBranchName("autofix/"+got))
+			}
+		})
+	}
+}
+
+// TestBranchName tests building branch names within the ref length limit
+func TestBranchName(t *testing.T) {
+	assert.Equal(t, "autofix/code/analysis-12-fix-a-b-20260101", branchName("autofix/code/", "-20260101", "analysis-12", "Fix A/B"))
+	assert.Equal(t, "autofix-test-1700000000", branchName(testBranchPrefix, "-1700000000", "  "))
+
+	long := branchName(testBranchPrefix, "-1700000000", strings.Repeat("very long fix id ", 40))
+	assert.Len(t, long, maxBranchLength)
+	assert.True(t, strings.HasSuffix(long, "-1700000000"), "the suffix is kept")
+	assert.NoError(t, validateBranchName(long))
+
+	long = testBranchName(&ProposedFix{ID: strings.Repeat("very long fix id ", 40)}, 3)
+	assert.LessOrEqual(t, len(long), maxBranchLength)
+	assert.NoError(t, validateBranchName(long))
+}
+
+// TestValidateBranchName tests the git check-ref-format rules
+func TestValidateBranchName(t *testing.T) {
+	for _, valid := range []string{"main", "release/1.2", "autofix/code/analysis-1-20260101-120000", "feature_x"} {
+		assert.NoError(t, validateBranchName(valid), valid)
+	}
+	for _, invalid := range []string{
+		"", "@", "-main", "/main", "main/", "main.", "a..b", "a@{b", "a//b", "has space",
+		"a~b", "a^b", "a:b", "a?b", "a*b", "a[b", "a\\b", "a\x7fb", "a\tb", ".hidden", "a/.b",
+		"a.lock", "a.lock/b", strings.Repeat("a", maxBranchLength+1),
+	} {
+		err := validateBranchName(invalid)
+		assert.ErrorIs(t, err, ErrInvalidBranch, "%q", invalid)
+	}
+}
+
+// TestValidateRepository tests owners and names against what GitHub allows
+func TestValidateRepository(t *testing.T) {
+	tests := []struct {
+		owner, name string
+		valid       bool
+	}{
+		{"acme", "widgets", true},
+		{"acme-corp", "my.repo_v2", true},
+		{"octocat_shortcode", "repo", true},
+		{"owner/with", "slashes", false},
+		{"-acme", "repo", false},
+		{"acme-", "repo", false},
+		{"acme corp", "repo", false},
+		{strings.Repeat("a", maxOwnerLength+1), "repo", false},
+		{"acme", "with/slash", false},
+		{"acme", "..", false},
+		{"acme", "has space", false},
+		{"acme", strings.Repeat("r", maxRepoNameLength+1), false},
+	}
+	for _, tt := range tests {
+		err := validateRepository(tt.owner, tt.name)
+		if tt.valid {
+			assert.NoError(t, err, "%s/%s", tt.owner, tt.name)
+		} else {
+			assert.ErrorIs(t, err, ErrInvalidRepo, "%s/%s", tt.owner, tt.name)
+		}
+	}
+
+	_, err := parseRepository("acme/bad name")
+	assert.ErrorIs(t, err, ErrInvalidRepo)
+}
+
+// TestInitializeRejectsInvalidRepository tests that WithRepository's input is checked on Initialize
+func TestInitializeRejectsInvalidRepository(t *testing.T) {
+	m := New().
+		WithGitHubToken(createTestSecret("token", "ghp_test")).
+		WithLLMProvider("openai", createTestSecret("key", "sk-test")).
+		WithRepository("owner/with", "slashes")
+
+	_, err := m.Initialize(context.Background())
+	assert.ErrorIs(t, err, ErrInvalidRepo)
+	assert.EqualError(t, err, `configuration validation failed: invalid repository owner "owner/with": use letters, digits and hyphens, at most 39 characters`)
+
+	_, err = m.WithRepository("acme", "widgets").WithTargetBranch("bad..branch").Initialize(context.Background())
+	assert.ErrorIs(t, err, ErrInvalidBranch)
+}
+
+// TestRunIDValidation tests that the public methods and the CLI reject non-positive run IDs
+// before calling GitHub
+func TestRunIDValidation(t *testing.T) {
+	m := fixtureAutofix(nil)
+	m.githubClient.(*mockGitHub).getWorkflowRunFunc = func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+		t.Errorf("GetWorkflowRun called with run ID %d", runID)
+		return nil, nil
+	}
+	ctx := context.Background()
+
+	for _, runID := range []int64{0, -1} {
+		_, err := m.AnalyzeFailure(ctx, runID)
+		assert.ErrorIs(t, err, ErrInvalidRunID)
+		_, err = m.AnalyzeFailureJobs(ctx, runID)
+		assert.ErrorIs(t, err, ErrInvalidRunID)
+		_, err = m.AutoFix(ctx, runID)
+		assert.ErrorIs(t, err, ErrInvalidRunID)
+	}
+	_, err := m.AutoFix(ctx, -1)
+	assert.EqualError(t, err, "invalid workflow run ID -1: must be positive")
+
+	for _, arg := range []string{"-1", "0", "abc", "12.5"} {
+		_, err := parseRunID(arg)
+		assert.ErrorIs(t, err, ErrInvalidRunID, arg)
+	}
+	runID, err := parseRunID("42")
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), runID)
+
+	cli := NewCLI()
+	cli.logger = quietLogger()
+	assert.ErrorIs(t, cli.runAnalyze(cli.rootCmd, []string{"-5"}), ErrInvalidRunID)
+	assert.ErrorIs(t, cli.runFix(cli.rootCmd, []string{"abc"}), ErrInvalidRunID)
+}
+
+// TestBranchNamesFromLLMFixIDs tests that fix IDs with spaces and slashes still give valid
+// PR and test branches
+func TestBranchNamesFromLLMFixIDs(t *testing.T) {
+	engine := NewPullRequestEngine(nil, logrus.New())
+	analysis := &FailureAnalysisResult{ID: "analysis-42"}
+	fix := &ProposedFix{ID: "Fix parser/nil check", Type: CodeFix}
+
+	branch := engine.generateBranchName(analysis)
+	assert.NoError(t, validateBranchName(branch))
+
+	testBranch := testBranchName(fix, 0)
+	assert.Equal(t, "autofix-test-fix-parser-nil-check", testBranch)
+	assert.NoError(t, validateBranchName(testBranch))
+}
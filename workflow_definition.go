@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v45/github"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// maxWorkflowPromptBytes caps the workflow file included in prompts
+	maxWorkflowPromptBytes = 6000
+	// maxJobPromptBytes caps the failing job's definition included in prompts
+	maxJobPromptBytes = 3000
+)
+
+// WorkflowDefinition is the workflow file a failed run was started from, at the run's commit
+type WorkflowDefinition struct {
+	Path    string `json:"path"`
+	Content string `json:"content,omitempty"`
+	// Note explains why Content is missing when the file could not be fetched
+	Note string `json:"note,omitempty"`
+}
+
+// GetWorkflowDefinition returns the path and content of the workflow file a run was started
+// from, read at the run's head commit. The path is returned even when the file cannot be read.
+func (g *GitHubIntegration) GetWorkflowDefinition(ctx context.Context, runID int64) (string, string, error) {
+	run, err := callGitHub(ctx, g, func() (*github.WorkflowRun, *github.Response, error) {
+		return g.client.Actions.GetWorkflowRunByID(ctx, g.repoOwner, g.repoName, runID)
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get workflow run: %w", err)
+	}
+
+	workflow, err := callGitHub(ctx, g, func() (*github.Workflow, *github.Response, error) {
+		return g.client.Actions.GetWorkflowByID(ctx, g.repoOwner, g.repoName, run.GetWorkflowID())
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get workflow %d: %w", run.GetWorkflowID(), err)
+	}
+
+	path := workflow.GetPath()
+	content, found, err := g.GetFileContent(ctx, path, run.GetHeadSHA())
+	if err != nil {
+		return path, "", err
+	}
+	if !found {
+		return path, "", fmt.Errorf("%w: %s at %s", ErrGitHubNotFound, path, run.GetHeadSHA())
+	}
+	return path, content, nil
+}
+
+// workflowJobDefinition returns the definition of a job in a workflow file, matching the job
+// by its ID, its name or, for matrix jobs such as "test (ubuntu-latest)", the name's prefix.
+// It returns "" when the file cannot be parsed or has no such job.
+func workflowJobDefinition(content, jobName string) string {
+	var doc yaml.Node
+	if jobName == "" || yaml.Unmarshal([]byte(content), &doc) != nil || len(doc.Content) == 0 {
+		return ""
+	}
+	root := doc.Content[0]
+	jobs := mappingValue(root, "jobs")
+	if jobs == nil || jobs.Kind != yaml.MappingNode {
+		return ""
+	}
+
+	matrixName, _, _ := strings.Cut(jobName, " (")
+	lines := strings.Split(content, "\n")
+	for i := 0; i+1 < len(jobs.Content); i += 2 {
+		key, job := jobs.Content[i], jobs.Content[i+1]
+		name := ""
+		if value := mappingValue(job, "name"); value != nil {
+			name = value.Value
+		}
+		if key.Value != jobName && key.Value != matrixName && (name == "" || (name != jobName && name != matrixName)) {
+			continue
+		}
+
+		// The job runs until the next job, or the next top level key after jobs
+		end := len(lines)
+		if i+2 < len(jobs.Content) {
+			end = jobs.Content[i+2].Line - 1
+		} else if next := nextMappingKey(root, "jobs"); next != nil {
+			end = next.Line - 1
+		}
+		return strings.TrimRight(strings.Join(lines[key.Line-1:end], "\n"), "\n ")
+	}
+	return ""
+}
+
+// nextMappingKey returns the key following key in a mapping node
+func nextMappingKey(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+3 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+2]
+		}
+	}
+	return nil
+}
+
+// truncateWorkflow caps a workflow YAML excerpt for a prompt, cutting at a line boundary
+func truncateWorkflow(content string, maxBytes int) string {
+	if len(content) <= maxBytes {
+		return content
+	}
+	cut := content[:maxBytes]
+	if i := strings.LastIndex(cut, "\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "\n# [TRUNCATED]"
+}
+
+// writeWorkflowDefinitionPrompt adds the workflow file of the failed run and its failing job
+// to a prompt, or a note when the file could not be fetched
+func writeWorkflowDefinitionPrompt(prompt *strings.Builder, ctx FailureContext) {
+	workflow := ctx.Workflow
+	if workflow == nil || workflow.Path == "" {
+		return
+	}
+
+	prompt.WriteString("## Workflow Definition\n\n")
+	prompt.WriteString(fmt.Sprintf("**Path**: %s\n", workflow.Path))
+	prompt.WriteString("Changes to this workflow must use exactly this path.\n\n")
+	if workflow.Content == "" {
+		if workflow.Note != "" {
+			prompt.WriteString(workflow.Note + "\n\n")
+		}
+		return
+	}
+
+	jobName := ctx.JobName
+	if jobName == "" && ctx.Logs != nil && len(ctx.Logs.FailedJobs) > 0 {
+		jobName = ctx.Logs.FailedJobs[0]
+	}
+	if job := workflowJobDefinition(workflow.Content, jobName); job != "" {
+		prompt.WriteString(fmt.Sprintf("**Failing Job** (%s):\n```yaml\n", jobName))
+		prompt.WriteString(truncateWorkflow(job, maxJobPromptBytes))
+		prompt.WriteString("\n```\n\n")
+	}
+	prompt.WriteString("**Workflow File**:\n```yaml\n")
+	prompt.WriteString(truncateWorkflow(strings.TrimRight(workflow.Content, "\n"), maxWorkflowPromptBytes))
+	prompt.WriteString("\n```\n\n")
+}
+
+// correctWorkflowPaths points workflow changes at the workflow file of the failed run when the
+// LLM guessed another path for it. Only modifications of content found in the run's workflow
+// file are corrected, so changes to other workflows keep their paths. It returns the paths
+// it replaced.
+func correctWorkflowPaths(fix *ProposedFix, workflow *WorkflowDefinition) []string {
+	if fix.Type != WorkflowFix || workflow == nil || workflow.Path == "" || workflow.Content == "" {
+		return nil
+	}
+	var corrected []string
+	for i := range fix.Changes {
+		change := &fix.Changes[i]
+		if change.Operation != ChangeOperationModify || change.FilePath == workflow.Path ||
+			!hasPathPrefix(change.FilePath, workflowsDir) ||
+			change.OldContent == "" || !strings.Contains(workflow.Content, change.OldContent) {
+			continue
+		}
+		corrected = append(corrected, change.FilePath)
+		change.FilePath = workflow.Path
+	}
+	return corrected
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ciWorkflow = `name: CI
+on: [push]
+
+jobs:
+  lint:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - run: make lint
+
+  test:
+    name: test
+    runs-on: ${{ matrix.os }}
+    strategy:
+      matrix:
+        os: [ubuntu-latest, macos-latest]
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+        with:
+          go-version: 1.19
+      - run: go test ./...
+
+env:
+  CGO_ENABLED: "0"
+`
+
+const ciTestJob = `  test:
+    name: test
+    runs-on: ${{ matrix.os }}
+    strategy:
+      matrix:
+        os: [ubuntu-latest, macos-latest]
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+        with:
+          go-version: 1.19
+      - run: go test ./...`
+
+// TestGetWorkflowDefinition tests resolving the workflow file of a run and reading it at the
+// run's head commit
+func TestGetWorkflowDefinition(t *testing.T) {
+	gh, mux := newMockGitHubAPI(t)
+	mux.HandleFunc("/repos/owner/repo/actions/runs/7", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":7,"workflow_id":99,"head_sha":"abc123"}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/workflows/99", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":99,"path":".github/workflows/ci.yml"}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/contents/.github/workflows/ci.yml", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "abc123", r.URL.Query().Get("ref"))
+		fmt.Fprintf(w, `{"type":"file","encoding":"base64","content":%q}`, base64.StdEncoding.EncodeToString([]byte(ciWorkflow)))
+	})
+
+	path, content, err := gh.GetWorkflowDefinition(context.Background(), 7)
+	require.NoError(t, err)
+	assert.Equal(t, ".github/workflows/ci.yml", path)
+	assert.Equal(t, ciWorkflow, content)
+
+	// A workflow file removed since the run still reports its path
+	mux.HandleFunc("/repos/owner/repo/actions/runs/8", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":8,"workflow_id":100,"head_sha":"def456"}`)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/workflows/100", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id":100,"path":".github/workflows/gone.yml"}`)
+	})
+	path, _, err = gh.GetWorkflowDefinition(context.Background(), 8)
+	assert.ErrorIs(t, err, ErrGitHubNotFound)
+	assert.Equal(t, ".github/workflows/gone.yml", path)
+}
+
+// TestWorkflowJobDefinition tests finding a job's definition in a workflow file
+func TestWorkflowJobDefinition(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		job     string
+		want    string
+	}{
+		{name: "job ID", content: ciWorkflow, job: "lint", want: "  lint:\n    runs-on: ubuntu-latest\n    steps:\n      - uses: actions/checkout@v4\n      - run: make lint"},
+		{name: "last job before a top level key", content: ciWorkflow, job: "test", want: ciTestJob},
+		{name: "matrix job", content: ciWorkflow, job: "test (macos-latest)", want: ciTestJob},
+		{name: "job name", content: "jobs:\n  build:\n    name: Build and test\n    runs-on: ubuntu-latest\n", job: "Build and test", want: "  build:\n    name: Build and test\n    runs-on: ubuntu-latest"},
+		{name: "unknown job", content: ciWorkflow, job: "deploy"},
+		{name: "no job name", content: ciWorkflow},
+		{name: "invalid YAML", content: "jobs: [", job: "test"},
+		{name: "no jobs", content: "name: CI\n", job: "test"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, workflowJobDefinition(tt.content, tt.job))
+		})
+	}
+}
+
+// TestWorkflowDefinitionPrompts tests that the workflow of the failed run and its failing job
+// reach the analysis and fix prompts, and that fixes modifying the workflow use its path
+func TestWorkflowDefinitionPrompts(t *testing.T) {
+	run := &WorkflowRun{ID: 7, Name: "CI", CommitSHA: "abc123"}
+	gh := &mockGitHub{
+		getWorkflowRunFunc: func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+			return run, nil
+		},
+		getWorkflowLogsFunc: func(ctx context.Context, runID int64) (*WorkflowLogs, error) {
+			return &WorkflowLogs{
+				RawLogs:    "go: go.mod requires go >= 1.22 (running go 1.19)",
+				ErrorLines: []string{"go: go.mod requires go >= 1.22 (running go 1.19)"},
+				FailedJobs: []string{"test (ubuntu-latest)"},
+			}, nil
+		},
+		getWorkflowDefinitionFunc: func(ctx context.Context, runID int64) (string, string, error) {
+			assert.Equal(t, int64(7), runID)
+			return ".github/workflows/ci.yml", ciWorkflow, nil
+		},
+	}
+	llm := &scriptedLLMClient{}
+	llm.chatFunc = func(req *LLMRequest) (*LLMResponse, error) {
+		if len(llm.requests) == 1 {
+			return &LLMResponse{Content: `{"root_cause": "The workflow sets up Go 1.19", "classification": {"type": "configuration", "confidence": 0.9}}`}, nil
+		}
+		// The LLM guesses the workflow is main.yml
+		return &LLMResponse{Content: `[{
+			"type": "workflow",
+			"description": "Set up the Go version go.mod requires",
+			"confidence": 0.9,
+			"changes": [{
+				"file_path": ".github/workflows/main.yml",
+				"operation": "modify",
+				"old_content": "go-version: 1.19",
+				"new_content": "go-version: 1.22"
+			}]
+		}]`}, nil
+	}
+	engine := NewFailureAnalysisEngine(llm, quietLogger())
+	engine.SetOSVClient(nil)
+	m := &DaggerAutofix{githubClient: gh, failureEngine: engine, RepoOwner: "owner", RepoName: "repo", logger: quietLogger()}
+
+	analysis, err := m.AnalyzeFailure(context.Background(), 7)
+	require.NoError(t, err)
+	require.NotNil(t, analysis.Context.Workflow)
+	assert.Equal(t, ".github/workflows/ci.yml", analysis.Context.Workflow.Path)
+
+	fixes, err := engine.GenerateFixes(context.Background(), analysis)
+	require.NoError(t, err)
+	require.Len(t, llm.requests, 2)
+	for _, req := range llm.requests {
+		assert.Contains(t, req.Prompt, "## Workflow Definition\n\n**Path**: .github/workflows/ci.yml\n")
+		assert.Contains(t, req.Prompt, "**Failing Job** (test (ubuntu-latest)):\n```yaml\n"+ciTestJob+"\n```\n")
+		assert.Contains(t, req.Prompt, "**Workflow File**:\n```yaml\n"+strings.TrimRight(ciWorkflow, "\n")+"\n```\n")
+	}
+
+	require.Len(t, fixes, 1)
+	require.Len(t, fixes[0].Changes, 1)
+	assert.Equal(t, ".github/workflows/ci.yml", fixes[0].Changes[0].FilePath, "the run's workflow path replaces the guessed one")
+}
+
+// TestWorkflowDefinitionUnavailable tests that analyses go on with a note when the workflow
+// file cannot be fetched
+func TestWorkflowDefinitionUnavailable(t *testing.T) {
+	gh := &mockGitHub{
+		getWorkflowRunFunc: func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+			return &WorkflowRun{ID: runID, Name: "CI"}, nil
+		},
+		getWorkflowLogsFunc: func(ctx context.Context, runID int64) (*WorkflowLogs, error) {
+			return &WorkflowLogs{ErrorLines: []string{"Error: build failed"}}, nil
+		},
+		getWorkflowDefinitionFunc: func(ctx context.Context, runID int64) (string, string, error) {
+			return ".github/workflows/ci.yml", "", fmt.Errorf("%w: .github/workflows/ci.yml at abc123", ErrGitHubNotFound)
+		},
+	}
+	llm := &scriptedLLMClient{chatFunc: func(req *LLMRequest) (*LLMResponse, error) {
+		return &LLMResponse{Content: `{"root_cause": "The build failed", "classification": {"type": "build", "confidence": 0.8}}`}, nil
+	}}
+	engine := NewFailureAnalysisEngine(llm, quietLogger())
+	engine.SetOSVClient(nil)
+	m := &DaggerAutofix{githubClient: gh, failureEngine: engine, RepoOwner: "owner", RepoName: "repo", logger: quietLogger()}
+
+	analysis, err := m.AnalyzeFailure(context.Background(), 7)
+	require.NoError(t, err)
+	assert.Equal(t, "The build failed", analysis.RootCause)
+	require.Len(t, llm.requests, 1)
+	assert.Contains(t, llm.requests[0].Prompt, "**Path**: .github/workflows/ci.yml\n")
+	assert.Contains(t, llm.requests[0].Prompt, "The workflow file could not be fetched: GitHub resource not found")
+	assert.NotContains(t, llm.requests[0].Prompt, "```yaml")
+
+	// Clients that cannot resolve the workflow at all leave the section out
+	gh.getWorkflowDefinitionFunc = func(ctx context.Context, runID int64) (string, string, error) {
+		return "", "", errors.New("workflow run 7 has no workflow path")
+	}
+	_, err = m.AnalyzeFailure(context.Background(), 7)
+	require.NoError(t, err)
+	assert.NotContains(t, llm.requests[1].Prompt, "## Workflow Definition")
+}
+
+// TestCorrectWorkflowPaths tests which workflow changes are pointed at the run's workflow file
+func TestCorrectWorkflowPaths(t *testing.T) {
+	workflow := &WorkflowDefinition{Path: ".github/workflows/ci.yml", Content: ciWorkflow}
+	fix := &ProposedFix{Type: WorkflowFix, Changes: []CodeChange{
+		{FilePath: ".github/workflows/build.yml", Operation: "modify", OldContent: "run: make lint"},
+		{FilePath: ".github/workflows/release.yml", Operation: "modify", OldContent: "run: goreleaser"},
+		{FilePath: ".github/workflows/new.yml", Operation: "create", NewContent: "name: New\n"},
+		{FilePath: "Makefile", Operation: "modify", OldContent: "run: make lint"},
+	}}
+
+	assert.Equal(t, []string{".github/workflows/build.yml"}, correctWorkflowPaths(fix, workflow))
+	assert.Equal(t, []string{".github/workflows/ci.yml", ".github/workflows/release.yml", ".github/workflows/new.yml", "Makefile"},
+		[]string{fix.Changes[0].FilePath, fix.Changes[1].FilePath, fix.Changes[2].FilePath, fix.Changes[3].FilePath})
+
+	codeFix := &ProposedFix{Type: CodeFix, Changes: []CodeChange{{FilePath: ".github/workflows/build.yml", Operation: "modify", OldContent: "run: make lint"}}}
+	assert.Empty(t, correctWorkflowPaths(codeFix, workflow))
+	assert.Empty(t, correctWorkflowPaths(fix, &WorkflowDefinition{Path: ".github/workflows/ci.yml"}))
+	assert.Empty(t, correctWorkflowPaths(fix, nil))
+}
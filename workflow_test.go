@@ -3,82 +3,104 @@ package main
 import (
 	"context"
 	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"dagger.io/dagger"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // mock implementations
 
-type mockGitHub struct {
-	getWorkflowRunFunc        func(ctx context.Context, runID int64) (*WorkflowRun, error)
-	getWorkflowLogsFunc       func(ctx context.Context, runID int64) (*WorkflowLogs, error)
-	getFailedWorkflowRunsFunc func(ctx context.Context) ([]*WorkflowRun, error)
-	createTestBranchFunc      func(ctx context.Context, branchName string, changes []CodeChange) (func(), error)
+type mockFailureAnalysisEngine struct {
+	analyzeFunc       func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error)
+	generateFixesFunc func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error)
 }
 
-func (m *mockGitHub) GetWorkflowRun(ctx context.Context, runID int64) (*WorkflowRun, error) {
-	if m.getWorkflowRunFunc != nil {
-		return m.getWorkflowRunFunc(ctx, runID)
+func (m *mockFailureAnalysisEngine) AnalyzeFailure(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+	if m.analyzeFunc != nil {
+		return m.analyzeFunc(ctx, fc)
 	}
 	return nil, nil
 }
 
-func (m *mockGitHub) GetWorkflowLogs(ctx context.Context, runID int64) (*WorkflowLogs, error) {
-	if m.getWorkflowLogsFunc != nil {
-		return m.getWorkflowLogsFunc(ctx, runID)
+func (m *mockFailureAnalysisEngine) GenerateFixes(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+	if m.generateFixesFunc != nil {
+		return m.generateFixesFunc(ctx, analysis)
 	}
 	return nil, nil
 }
 
-func (m *mockGitHub) GetFailedWorkflowRuns(ctx context.Context) ([]*WorkflowRun, error) {
-	if m.getFailedWorkflowRunsFunc != nil {
-		return m.getFailedWorkflowRunsFunc(ctx)
+type mockTestEngine struct {
+	runTestsFunc            func(ctx context.Context, owner, repo, branch string) (*TestResult, error)
+	runTestsWithChangesFunc func(ctx context.Context, source *dagger.Directory, changes []CodeChange) (*TestResult, error)
+	generateTestsFunc       func(ctx context.Context, fix *ProposedFix, analysis *FailureAnalysisResult) ([]CodeChange, error)
+	detectFrameworksFunc    func(ctx context.Context, source *dagger.Directory) ([]*TestFramework, error)
+	readSourceFileFunc      func(ctx context.Context, source *dagger.Directory, name string) (string, bool, error)
+	sourceCommitFunc        func(ctx context.Context, source *dagger.Directory) (string, error)
+	regenerateFileFunc      func(ctx context.Context, source *dagger.Directory, changes []CodeChange, generated GeneratedFile, file string) (string, bool, error)
+}
+
+func (m *mockTestEngine) RunTests(ctx context.Context, owner, repo, branch string, steps ...ValidationStep) (*TestResult, error) {
+	if m.runTestsFunc != nil {
+		return m.runTestsFunc(ctx, owner, repo, branch)
 	}
 	return nil, nil
 }
 
-func (m *mockGitHub) CreateTestBranch(ctx context.Context, branchName string, changes []CodeChange) (func(), error) {
-	if m.createTestBranchFunc != nil {
-		return m.createTestBranchFunc(ctx, branchName, changes)
+func (m *mockTestEngine) RunTestsWithChanges(ctx context.Context, source *dagger.Directory, changes []CodeChange, steps ...ValidationStep) (*TestResult, error) {
+	if m.runTestsWithChangesFunc != nil {
+		return m.runTestsWithChangesFunc(ctx, source, changes)
 	}
-	return func() {}, nil
+	return nil, nil
 }
 
-type mockFailureAnalysisEngine struct {
-	analyzeFunc       func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error)
-	generateFixesFunc func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error)
+func (m *mockTestEngine) GenerateTestsForFix(ctx context.Context, fix *ProposedFix, analysis *FailureAnalysisResult) ([]CodeChange, error) {
+	if m.generateTestsFunc != nil {
+		return m.generateTestsFunc(ctx, fix, analysis)
+	}
+	return nil, nil
 }
 
-func (m *mockFailureAnalysisEngine) AnalyzeFailure(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
-	if m.analyzeFunc != nil {
-		return m.analyzeFunc(ctx, fc)
+func (m *mockTestEngine) DetectFrameworks(ctx context.Context, source *dagger.Directory) ([]*TestFramework, error) {
+	if m.detectFrameworksFunc != nil {
+		return m.detectFrameworksFunc(ctx, source)
 	}
 	return nil, nil
 }
 
-func (m *mockFailureAnalysisEngine) GenerateFixes(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
-	if m.generateFixesFunc != nil {
-		return m.generateFixesFunc(ctx, analysis)
+func (m *mockTestEngine) ReadSourceFile(ctx context.Context, source *dagger.Directory, name string) (string, bool, error) {
+	if m.readSourceFileFunc != nil {
+		return m.readSourceFileFunc(ctx, source, name)
 	}
-	return nil, nil
+	return "", false, nil
 }
 
-type mockTestEngine struct {
-	runTestsFunc func(ctx context.Context, owner, repo, branch string) (*TestResult, error)
+func (m *mockTestEngine) SourceCommit(ctx context.Context, source *dagger.Directory) (string, error) {
+	if m.sourceCommitFunc != nil {
+		return m.sourceCommitFunc(ctx, source)
+	}
+	return "", errors.New("source is not a git checkout")
 }
 
-func (m *mockTestEngine) RunTests(ctx context.Context, owner, repo, branch string) (*TestResult, error) {
-	if m.runTestsFunc != nil {
-		return m.runTestsFunc(ctx, owner, repo, branch)
+func (m *mockTestEngine) RegenerateFile(ctx context.Context, source *dagger.Directory, changes []CodeChange, generated GeneratedFile, file string) (string, bool, error) {
+	if m.regenerateFileFunc != nil {
+		return m.regenerateFileFunc(ctx, source, changes, generated, file)
 	}
-	return nil, nil
+	return "", false, errors.New("cannot regenerate files")
 }
 
 type mockPullRequestEngine struct {
-	createFunc func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult) (*PullRequest, error)
+	createFunc            func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult) (*PullRequest, error)
+	createWithOptionsFunc func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error)
+	linkRelatedFunc       func(ctx context.Context, prs []*PullRequest) error
+	previewFunc           func(analysis *FailureAnalysisResult, fix *FixValidationResult) *PRCreationOptions
+	getPRStatusFunc       func(ctx context.Context, prNumber int) (*PullRequest, error)
+	closePRFunc           func(ctx context.Context, prNumber int, reason string) error
 }
 
 func (m *mockPullRequestEngine) CreateFixPR(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult) (*PullRequest, error) {
@@ -88,6 +110,41 @@ func (m *mockPullRequestEngine) CreateFixPR(ctx context.Context, analysis *Failu
 	return nil, nil
 }
 
+func (m *mockPullRequestEngine) CreateFixPRWithOptions(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult, opts FixPROptions) (*PullRequest, error) {
+	if m.createWithOptionsFunc != nil {
+		return m.createWithOptionsFunc(ctx, analysis, fix, opts)
+	}
+	return m.CreateFixPR(ctx, analysis, fix)
+}
+
+func (m *mockPullRequestEngine) LinkRelatedPRs(ctx context.Context, prs []*PullRequest) error {
+	if m.linkRelatedFunc != nil {
+		return m.linkRelatedFunc(ctx, prs)
+	}
+	return nil
+}
+
+func (m *mockPullRequestEngine) PreviewFixPR(analysis *FailureAnalysisResult, fix *FixValidationResult) *PRCreationOptions {
+	if m.previewFunc != nil {
+		return m.previewFunc(analysis, fix)
+	}
+	return &PRCreationOptions{}
+}
+
+func (m *mockPullRequestEngine) GetPRStatus(ctx context.Context, prNumber int) (*PullRequest, error) {
+	if m.getPRStatusFunc != nil {
+		return m.getPRStatusFunc(ctx, prNumber)
+	}
+	return &PullRequest{Number: prNumber, State: "open"}, nil
+}
+
+func (m *mockPullRequestEngine) ClosePR(ctx context.Context, prNumber int, reason string) error {
+	if m.closePRFunc != nil {
+		return m.closePRFunc(ctx, prNumber, reason)
+	}
+	return nil
+}
+
 // Tests
 
 func TestWorkflowMonitorWorkflows(t *testing.T) {
@@ -168,7 +225,13 @@ func TestWorkflowAutoFix(t *testing.T) {
 	ctx := context.Background()
 
 	t.Run("successful autofix", func(t *testing.T) {
+		var mu sync.Mutex
 		calls := []string{}
+		record := func(call string) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, call)
+		}
 		gh := &mockGitHub{
 			getWorkflowRunFunc: func(ctx context.Context, runID int64) (*WorkflowRun, error) {
 				return &WorkflowRun{ID: runID}, nil
@@ -177,18 +240,23 @@ func TestWorkflowAutoFix(t *testing.T) {
 				return &WorkflowLogs{}, nil
 			},
 			createTestBranchFunc: func(ctx context.Context, branch string, changes []CodeChange) (func(), error) {
-				calls = append(calls, "validate")
+				record("validate")
 				return func() {}, nil
 			},
+			getRepositoryContextFunc: func(ctx context.Context) (*RepositoryContext, error) {
+				return &RepositoryContext{Owner: "o", Name: "r", DefaultBranch: "main", Language: "Go", Framework: "go"}, nil
+			},
 		}
 
+		var repository RepositoryContext
 		fe := &mockFailureAnalysisEngine{
 			analyzeFunc: func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
-				calls = append(calls, "analyze")
+				record("analyze")
+				repository = fc.Repository
 				return &FailureAnalysisResult{Classification: FailureClassification{Type: BuildFailure, Confidence: 0.9}}, nil
 			},
 			generateFixesFunc: func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
-				calls = append(calls, "generate")
+				record("generate")
 				return []*ProposedFix{{ID: "1", Confidence: 0.8}}, nil
 			},
 		}
@@ -201,7 +269,7 @@ func TestWorkflowAutoFix(t *testing.T) {
 
 		pr := &mockPullRequestEngine{
 			createFunc: func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult) (*PullRequest, error) {
-				calls = append(calls, "pr")
+				record("pr")
 				return &PullRequest{Number: 1, URL: "http://example"}, nil
 			},
 		}
@@ -216,16 +284,36 @@ func TestWorkflowAutoFix(t *testing.T) {
 			RepoOwner:     "o",
 			RepoName:      "r",
 			MinCoverage:   80,
+			LLMProvider:   Anthropic,
 		}
 
 		res, err := m.AutoFix(ctx, 1)
 		assert.NoError(t, err)
-		assert.NotNil(t, res)
+		require.NotNil(t, res)
 		assert.Equal(t, []string{"analyze", "generate", "validate", "pr"}, calls)
+
+		assert.Regexp(t, `^autofix-1-\d+$`, res.ID)
+		assert.True(t, res.Success)
+		assert.Greater(t, res.Duration, time.Duration(0))
+		assert.Equal(t, 1, res.Metadata["fixes_generated"])
+		assert.Equal(t, 1, res.Metadata["fixes_validated"])
+		assert.Equal(t, 0.8, res.Metadata["selected_fix_confidence"])
+		assert.Equal(t, "anthropic", res.Metadata["llm_provider"])
+
+		assert.Equal(t, "Go", repository.Language)
+		assert.Equal(t, "go", repository.Framework)
+		assert.Equal(t, "main", repository.DefaultBranch)
+		assert.Equal(t, "o", repository.Owner)
 	})
 
 	t.Run("no valid fix", func(t *testing.T) {
+		var mu sync.Mutex
 		calls := []string{}
+		record := func(call string) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, call)
+		}
 		gh := &mockGitHub{
 			getWorkflowRunFunc: func(ctx context.Context, runID int64) (*WorkflowRun, error) {
 				return &WorkflowRun{ID: runID}, nil
@@ -234,18 +322,18 @@ func TestWorkflowAutoFix(t *testing.T) {
 				return &WorkflowLogs{}, nil
 			},
 			createTestBranchFunc: func(ctx context.Context, branch string, changes []CodeChange) (func(), error) {
-				calls = append(calls, "validate")
+				record("validate")
 				return func() {}, nil
 			},
 		}
 
 		fe := &mockFailureAnalysisEngine{
 			analyzeFunc: func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
-				calls = append(calls, "analyze")
+				record("analyze")
 				return &FailureAnalysisResult{Classification: FailureClassification{Type: BuildFailure, Confidence: 0.9}}, nil
 			},
 			generateFixesFunc: func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
-				calls = append(calls, "generate")
+				record("generate")
 				return []*ProposedFix{{ID: "1", Confidence: 0.8}}, nil
 			},
 		}
@@ -271,22 +359,100 @@ func TestWorkflowAutoFix(t *testing.T) {
 		}
 
 		res, err := m.AutoFix(ctx, 1)
-		assert.Nil(t, res)
-		assert.Error(t, err)
+		assert.ErrorIs(t, err, ErrNoValidFixes)
+		require.NotNil(t, res)
+		assert.False(t, res.Success)
+		assert.Equal(t, "no_valid_fixes", res.Metadata["error_category"])
 		assert.Equal(t, []string{"analyze", "generate", "validate"}, calls)
 	})
+
+	t.Run("dry run", func(t *testing.T) {
+		var mu sync.Mutex
+		calls := []string{}
+		record := func(call string) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls = append(calls, call)
+		}
+		gh := &mockGitHub{
+			getWorkflowRunFunc: func(ctx context.Context, runID int64) (*WorkflowRun, error) {
+				return &WorkflowRun{ID: runID}, nil
+			},
+			getWorkflowLogsFunc: func(ctx context.Context, runID int64) (*WorkflowLogs, error) {
+				return &WorkflowLogs{}, nil
+			},
+			createTestBranchFunc: func(ctx context.Context, branch string, changes []CodeChange) (func(), error) {
+				record("validate")
+				return func() { record("cleanup") }, nil
+			},
+		}
+
+		fe := &mockFailureAnalysisEngine{
+			analyzeFunc: func(ctx context.Context, fc FailureContext) (*FailureAnalysisResult, error) {
+				return &FailureAnalysisResult{ID: "a1", Classification: FailureClassification{Type: BuildFailure, Confidence: 0.9}}, nil
+			},
+			generateFixesFunc: func(ctx context.Context, analysis *FailureAnalysisResult) ([]*ProposedFix, error) {
+				return []*ProposedFix{{ID: "1", Confidence: 0.8, Changes: []CodeChange{{FilePath: "main.go"}}}}, nil
+			},
+		}
+
+		te := &mockTestEngine{
+			runTestsFunc: func(ctx context.Context, owner, repo, branch string) (*TestResult, error) {
+				return &TestResult{Success: true, Coverage: 90}, nil
+			},
+		}
+
+		pr := &mockPullRequestEngine{
+			createFunc: func(ctx context.Context, analysis *FailureAnalysisResult, fix *FixValidationResult) (*PullRequest, error) {
+				record("pr")
+				return &PullRequest{Number: 1}, nil
+			},
+			previewFunc: func(analysis *FailureAnalysisResult, fix *FixValidationResult) *PRCreationOptions {
+				return &PRCreationOptions{BranchName: "autofix/build/a1", TargetBranch: "main", Title: "fix: build"}
+			},
+		}
+
+		m := &DaggerAutofix{
+			githubClient:  gh,
+			failureEngine: fe,
+			testEngine:    te,
+			prEngine:      pr,
+			llmClient:     &LLMClient{},
+			logger:        logrus.New(),
+			RepoOwner:     "o",
+			RepoName:      "r",
+			MinCoverage:   80,
+		}
+		m.WithDryRun(true)
+
+		res, err := m.AutoFix(ctx, 1)
+		assert.NoError(t, err)
+		assert.NotNil(t, res)
+		assert.True(t, res.Success)
+		assert.Nil(t, res.PullRequest)
+		assert.True(t, res.Fix.Valid)
+		assert.Equal(t, true, res.Metadata["dry_run"])
+		assert.Equal(t, "autofix/build/a1", res.Metadata["branch_name"])
+		assert.Equal(t, "fix: build", res.Metadata["pr_title"])
+		assert.Equal(t, []string{"main.go"}, res.Metadata["changed_files"])
+		assert.Regexp(t, `^autofix-1-\d+$`, res.ID)
+		assert.Equal(t, 1, res.Metadata["fixes_generated"])
+		assert.Equal(t, 1, res.Metadata["fixes_validated"])
+		// The validation branch is cleaned up and no PR is opened
+		assert.Equal(t, []string{"validate", "cleanup"}, calls)
+	})
 }
 
 func TestWorkflowValidateFix(t *testing.T) {
 	ctx := context.Background()
 
 	t.Run("success", func(t *testing.T) {
-		cleanupCalled := false
+		var cleanupCalled atomic.Bool
 		branchName := ""
 		gh := &mockGitHub{
 			createTestBranchFunc: func(ctx context.Context, branch string, changes []CodeChange) (func(), error) {
 				branchName = branch
-				return func() { cleanupCalled = true }, nil
+				return func() { cleanupCalled.Store(true) }, nil
 			},
 		}
 
@@ -310,14 +476,45 @@ func TestWorkflowValidateFix(t *testing.T) {
 		res, err := m.ValidateFix(ctx, fix)
 		assert.NoError(t, err)
 		assert.True(t, res.Valid)
-		assert.True(t, cleanupCalled)
+		assert.True(t, cleanupCalled.Load())
+	})
+
+	t.Run("local source", func(t *testing.T) {
+		gh := &mockGitHub{
+			createTestBranchFunc: func(ctx context.Context, branch string, changes []CodeChange) (func(), error) {
+				t.Fatal("test branch should not be pushed when Source is set")
+				return nil, nil
+			},
+		}
+
+		source := &dagger.Directory{}
+		changes := []CodeChange{{FilePath: "main.go", Operation: "modify", NewContent: "package main"}}
+		te := &mockTestEngine{
+			runTestsWithChangesFunc: func(ctx context.Context, src *dagger.Directory, got []CodeChange) (*TestResult, error) {
+				assert.Same(t, source, src)
+				assert.Equal(t, changes, got)
+				return &TestResult{Success: true, Coverage: 90}, nil
+			},
+		}
+
+		m := &DaggerAutofix{
+			Source:       source,
+			githubClient: gh,
+			testEngine:   te,
+			logger:       logrus.New(),
+			MinCoverage:  80,
+		}
+
+		res, err := m.ValidateFix(ctx, &ProposedFix{ID: "1", Changes: changes})
+		assert.NoError(t, err)
+		assert.True(t, res.Valid)
 	})
 
 	t.Run("invalid due to coverage", func(t *testing.T) {
-		cleanupCalled := false
+		var cleanupCalled atomic.Bool
 		gh := &mockGitHub{
 			createTestBranchFunc: func(ctx context.Context, branch string, changes []CodeChange) (func(), error) {
-				return func() { cleanupCalled = true }, nil
+				return func() { cleanupCalled.Store(true) }, nil
 			},
 		}
 
@@ -340,7 +537,7 @@ func TestWorkflowValidateFix(t *testing.T) {
 		res, err := m.ValidateFix(ctx, fix)
 		assert.NoError(t, err)
 		assert.False(t, res.Valid)
-		assert.True(t, cleanupCalled)
+		assert.True(t, cleanupCalled.Load())
 	})
 
 	t.Run("branch creation error", func(t *testing.T) {
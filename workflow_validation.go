@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// workflowLintImage ships actionlint, which also runs shellcheck on run: scripts
+	workflowLintImage = "rhysd/actionlint:1.7.1"
+	// workflowLintCommand is the command of the workflow lint stage; a validation step with
+	// this command sets the stage's timeout
+	workflowLintCommand = "actionlint -no-color"
+	workflowDir         = ".github/workflows/"
+)
+
+// workflowEvents are the events a workflow can be triggered by in on:
+var workflowEvents = map[string]bool{
+	"branch_protection_rule": true, "check_run": true, "check_suite": true, "create": true,
+	"delete": true, "deployment": true, "deployment_status": true, "discussion": true,
+	"discussion_comment": true, "fork": true, "gollum": true, "issue_comment": true,
+	"issues": true, "label": true, "merge_group": true, "milestone": true, "page_build": true,
+	"public": true, "pull_request": true, "pull_request_review": true,
+	"pull_request_review_comment": true, "pull_request_target": true, "push": true,
+	"registry_package": true, "release": true, "repository_dispatch": true, "schedule": true,
+	"status": true, "watch": true, "workflow_call": true, "workflow_dispatch": true,
+	"workflow_run": true,
+}
+
+// workflowFiles returns the workflow files added or modified by changes, sorted
+func workflowFiles(changes []CodeChange) []string {
+	var files []string
+	for _, change := range changes {
+		target := change.targetPath()
+		if change.Operation == ChangeOperationDelete || !strings.HasPrefix(target, workflowDir) {
+			continue
+		}
+		if ext := path.Ext(target); ext == ".yml" || ext == ".yaml" {
+			files = appendMissing(files, target)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// validateWorkflowChanges checks the workflow files changed by a fix before the test suite
+// runs, so a fix cannot break a workflow in a new way. Each file is checked against the
+// workflow schema, then actionlint runs on all of them under the workflow stage timeout.
+// It returns nil when no workflow file changed or all of them pass.
+func (e *TestEngine) validateWorkflowChanges(ctx context.Context, workspace ContainerInterface, changes []CodeChange, steps []ValidationStep, start time.Time) *TestResult {
+	files := workflowFiles(changes)
+	if len(files) == 0 {
+		return nil
+	}
+	e.logger.WithField("files", files).Info("Validating workflow changes")
+
+	var problems []string
+	for _, change := range changes {
+		// Workflows renamed without new content are only checked by actionlint
+		target := change.targetPath()
+		if containsString(files, target) && (change.Operation != ChangeOperationRename || change.NewContent != "") {
+			problems = append(problems, checkWorkflowSchema(target, change.NewContent)...)
+		}
+	}
+	if len(problems) > 0 {
+		return workflowLintFailure(start, files, "Workflow schema check failed", problems, nil)
+	}
+
+	timeout := e.timeouts.withDefaults().Workflow
+	for _, step := range steps {
+		if step.Command == workflowLintCommand && step.Timeout > 0 {
+			timeout = step.Timeout
+		}
+	}
+	output, err := runStage(ctx, stageWorkflow, timeout, func(ctx context.Context) (string, error) {
+		container := e.containerProvider.CreateContainer().From(workflowLintImage).
+			WithDirectory("/workspace", workspace.Directory("/workspace").Unwrap()).
+			WithWorkdir("/workspace")
+		_, output, err := e.runCommand(ctx, container, stageWorkflow, workflowLintCommand+" "+strings.Join(files, " "))
+		return output, err
+	})
+	if err == nil {
+		e.logger.WithField("files", files).Info("Workflow changes passed actionlint")
+		return nil
+	}
+
+	var timeoutErr *stageTimeoutError
+	if errors.As(err, &timeoutErr) {
+		e.logger.WithField("timeout", timeoutErr.timeout).Warn("Workflow lint timed out")
+		return workflowLintFailure(start, files, output, []string{timeoutErr.Error()}, map[string]interface{}{"timeout": timeoutErr.timeout.String()})
+	}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			problems = append(problems, line)
+		}
+	}
+	if len(problems) == 0 {
+		problems = []string{err.Error()}
+	}
+	return workflowLintFailure(start, files, output, problems, commandFailureDetails(err, map[string]interface{}{}))
+}
+
+// workflowLintFailure reports rejected workflow changes as a failed TestResult
+func workflowLintFailure(start time.Time, files []string, output string, problems []string, details map[string]interface{}) *TestResult {
+	if details == nil {
+		details = make(map[string]interface{})
+	}
+	details["stage"] = stageWorkflow
+	details["workflow_files"] = files
+	return &TestResult{
+		Success:  false,
+		Duration: time.Since(start),
+		Output:   output,
+		Errors:   problems,
+		Details:  details,
+	}
+}
+
+// checkWorkflowSchema reports the problems of a workflow file that GitHub would reject
+// before running it: invalid YAML, missing or unknown triggers, and jobs without a runner
+func checkWorkflowSchema(file, content string) []string {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		return []string{fmt.Sprintf("%s: invalid YAML: %v", file, err)}
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return []string{fmt.Sprintf("%s: workflow must be a mapping", file)}
+	}
+	root := doc.Content[0]
+
+	var problems []string
+	report := func(node *yaml.Node, format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%s:%d: %s", file, node.Line, fmt.Sprintf(format, args...)))
+	}
+
+	on := mappingValue(root, "on")
+	switch {
+	case on == nil:
+		report(root, `missing "on" trigger`)
+	case on.Kind == yaml.ScalarNode:
+		if !workflowEvents[on.Value] {
+			report(on, "unknown event %q in on", on.Value)
+		}
+	case on.Kind == yaml.SequenceNode:
+		if len(on.Content) == 0 {
+			report(on, "on must list at least one event")
+		}
+		for _, event := range on.Content {
+			if event.Kind != yaml.ScalarNode || !workflowEvents[event.Value] {
+				report(event, "unknown event %q in on", event.Value)
+			}
+		}
+	case on.Kind == yaml.MappingNode:
+		if len(on.Content) == 0 {
+			report(on, "on must configure at least one event")
+		}
+		for i := 0; i < len(on.Content); i += 2 {
+			if event := on.Content[i]; !workflowEvents[event.Value] {
+				report(event, "unknown event %q in on", event.Value)
+			}
+		}
+	default:
+		report(on, "on must be an event, a list of events or a mapping of events")
+	}
+
+	jobs := mappingValue(root, "jobs")
+	switch {
+	case jobs == nil:
+		report(root, `missing "jobs"`)
+	case jobs.Kind != yaml.MappingNode || len(jobs.Content) == 0:
+		report(jobs, "jobs must be a mapping of at least one job")
+	default:
+		for i := 0; i < len(jobs.Content); i += 2 {
+			id, job := jobs.Content[i], jobs.Content[i+1]
+			if job.Kind != yaml.MappingNode {
+				report(job, "job %q must be a mapping", id.Value)
+				continue
+			}
+			if mappingValue(job, "runs-on") == nil && mappingValue(job, "uses") == nil {
+				report(job, `job %q needs "runs-on" or "uses"`, id.Value)
+			}
+			if jobSteps := mappingValue(job, "steps"); jobSteps != nil && jobSteps.Kind != yaml.SequenceNode {
+				report(jobSteps, "steps of job %q must be a list", id.Value)
+			}
+		}
+	}
+	return problems
+}
+
+// mappingValue returns the value of key in a YAML mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dagger.io/dagger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validWorkflow = `name: CI
+on:
+  push:
+    branches: [main]
+  pull_request:
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - run: go test ./...
+`
+
+// TestCheckWorkflowSchema tests the workflow schema check of changed workflow files
+func TestCheckWorkflowSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		problems []string
+	}{
+		{name: "Valid", content: validWorkflow},
+		{name: "SingleEvent", content: "on: push\njobs:\n  test:\n    runs-on: ubuntu-latest\n"},
+		{name: "ReusableWorkflowJob", content: "on: [push, workflow_dispatch]\njobs:\n  call:\n    uses: ./.github/workflows/build.yml\n"},
+		{
+			name:     "UnknownEvent",
+			content:  "on: pushh\njobs:\n  test:\n    runs-on: ubuntu-latest\n",
+			problems: []string{`ci.yml:1: unknown event "pushh" in on`},
+		},
+		{
+			name:     "UnknownEventInList",
+			content:  "on: [push, pull-request]\njobs:\n  test:\n    runs-on: ubuntu-latest\n",
+			problems: []string{`ci.yml:1: unknown event "pull-request" in on`},
+		},
+		{
+			name:     "MissingTrigger",
+			content:  "jobs:\n  test:\n    runs-on: ubuntu-latest\n",
+			problems: []string{`ci.yml:1: missing "on" trigger`},
+		},
+		{
+			name:     "JobWithoutRunner",
+			content:  "on: push\njobs:\n  test:\n    steps:\n      - run: make\n",
+			problems: []string{`ci.yml:4: job "test" needs "runs-on" or "uses"`},
+		},
+		{
+			name:     "StepsNotAList",
+			content:  "on: push\njobs:\n  test:\n    runs-on: ubuntu-latest\n    steps: make\n",
+			problems: []string{`ci.yml:5: steps of job "test" must be a list`},
+		},
+		{
+			name:     "MissingJobs",
+			content:  "on: push\n",
+			problems: []string{`ci.yml:1: missing "jobs"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.problems, checkWorkflowSchema("ci.yml", tt.content))
+		})
+	}
+
+	t.Run("InvalidYAML", func(t *testing.T) {
+		problems := checkWorkflowSchema("ci.yml", "on: push\njobs: [\n")
+		require.Len(t, problems, 1)
+		assert.Contains(t, problems[0], "ci.yml: invalid YAML")
+	})
+}
+
+// TestWorkflowFiles tests which changes are validated as workflow files
+func TestWorkflowFiles(t *testing.T) {
+	changes := []CodeChange{
+		{FilePath: ".github/workflows/test.yaml", Operation: ChangeOperationModify},
+		{FilePath: ".github/workflows/ci.yml", Operation: ChangeOperationAdd},
+		{FilePath: ".github/workflows/old.yml", Operation: ChangeOperationDelete},
+		{FilePath: ".github/workflows/README.md", Operation: ChangeOperationAdd},
+		{FilePath: ".github/dependabot.yml", Operation: ChangeOperationModify},
+		{FilePath: "main.go", Operation: ChangeOperationModify},
+	}
+	assert.Equal(t, []string{".github/workflows/ci.yml", ".github/workflows/test.yaml"}, workflowFiles(changes))
+	assert.Empty(t, workflowFiles(changes[4:]))
+}
+
+// workflowTestEngine returns a test engine running on a mock Go repository
+func workflowTestEngine() (*TestEngine, *MockDaggerContainer) {
+	mockProvider := NewMockContainerProvider()
+	mock := mockProvider.MockContainer
+	mock.FileSystem = map[string]string{"go.mod": "module test\n\ngo 1.22"}
+	mock.SetCommandOutput("go test -json ./...", "PASS\nok\ttest\t0.005s", "", 0, nil)
+
+	engine := NewTestEngine(0, quietLogger())
+	engine.SetContainerProvider(mockProvider)
+	return engine, mock
+}
+
+// TestRunTestsWithChangesValidatesWorkflows tests that broken workflow changes are rejected
+// before the test suite runs
+func TestRunTestsWithChangesValidatesWorkflows(t *testing.T) {
+	ctx := context.Background()
+	lint := workflowLintCommand + " .github/workflows/ci.yml"
+
+	t.Run("InvalidTrigger", func(t *testing.T) {
+		engine, mock := workflowTestEngine()
+		changes := []CodeChange{{
+			FilePath:   ".github/workflows/ci.yml",
+			Operation:  ChangeOperationModify,
+			NewContent: "on:\n  pushh:\n    branches: [main]\njobs:\n  test:\n    runs-on: ubuntu-latest\n",
+		}}
+
+		result, err := engine.RunTestsWithChanges(ctx, &dagger.Directory{}, changes)
+		require.NoError(t, err)
+		assert.False(t, result.Success)
+		assert.Equal(t, stageWorkflow, result.Details["stage"])
+		assert.Equal(t, []string{".github/workflows/ci.yml"}, result.Details["workflow_files"])
+		assert.Equal(t, []string{`.github/workflows/ci.yml:2: unknown event "pushh" in on`}, result.Errors)
+		assert.Empty(t, mock.ExecHistory, "neither actionlint nor the test suite runs")
+	})
+
+	t.Run("ActionlintFailure", func(t *testing.T) {
+		engine, mock := workflowTestEngine()
+		mock.SetCommandOutput(lint,
+			".github/workflows/ci.yml:10:24: property \"go\" is not defined in object type {} [expression]\n", "", 1, nil)
+		changes := []CodeChange{{FilePath: ".github/workflows/ci.yml", Operation: ChangeOperationModify, NewContent: validWorkflow}}
+
+		result, err := engine.RunTestsWithChanges(ctx, &dagger.Directory{}, changes)
+		require.NoError(t, err)
+		assert.False(t, result.Success)
+		assert.Equal(t, stageWorkflow, result.Details["stage"])
+		assert.Equal(t, 1, result.Details["exit_code"])
+		assert.Equal(t, []string{`.github/workflows/ci.yml:10:24: property "go" is not defined in object type {} [expression]`}, result.Errors)
+		assert.Equal(t, workflowLintImage, mock.BaseImage)
+		assert.NotContains(t, mock.Operations, "exec:go test -json ./...")
+	})
+
+	t.Run("ValidRunsTests", func(t *testing.T) {
+		engine, mock := workflowTestEngine()
+		mock.SetCommandOutput(lint, "", "", 0, nil)
+		changes := []CodeChange{
+			{FilePath: ".github/workflows/ci.yml", Operation: ChangeOperationModify, NewContent: validWorkflow},
+			{FilePath: "main.go", Operation: ChangeOperationModify, NewContent: "package main"},
+		}
+
+		result, err := engine.RunTestsWithChanges(ctx, &dagger.Directory{}, changes)
+		require.NoError(t, err)
+		assert.Equal(t, "golang", result.Details["framework"])
+		assert.Contains(t, mock.Operations, "exec:"+lint)
+		assert.Contains(t, mock.Operations, "exec:go test -json ./...")
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		engine, mock := workflowTestEngine()
+		mock.CommandOutputs[lint] = MockCommandResult{Delay: time.Minute}
+		changes := []CodeChange{{FilePath: ".github/workflows/ci.yml", Operation: ChangeOperationModify, NewContent: validWorkflow}}
+
+		steps := []ValidationStep{{Name: "Workflow Lint", Command: workflowLintCommand, Timeout: 20 * time.Millisecond}}
+		result, err := engine.RunTestsWithChanges(ctx, &dagger.Directory{}, changes, steps...)
+		require.NoError(t, err)
+		assert.False(t, result.Success)
+		assert.Equal(t, []string{"timed out in workflow after 20ms"}, result.Errors)
+		assert.Equal(t, "20ms", result.Details["timeout"])
+	})
+}
+
+// TestValidateFixRejectsBrokenWorkflow tests that the linter output is attached to the
+// validation result of a workflow fix
+func TestValidateFixRejectsBrokenWorkflow(t *testing.T) {
+	engine, _ := workflowTestEngine()
+	m := &DaggerAutofix{
+		Source:       &dagger.Directory{},
+		githubClient: &mockGitHub{},
+		testEngine:   engine,
+		logger:       quietLogger(),
+	}
+
+	fix := &ProposedFix{ID: "wf", Type: WorkflowFix, Changes: []CodeChange{{
+		FilePath:   ".github/workflows/ci.yml",
+		Operation:  ChangeOperationModify,
+		NewContent: "on: pushh\njobs:\n  test:\n    runs-on: ubuntu-latest\n",
+	}}}
+	(&FailureAnalysisEngine{}).addValidationSteps(fix, &FailureAnalysisResult{})
+	require.NotEmpty(t, fix.Validation)
+	lintStep := fix.Validation[len(fix.Validation)-1]
+	assert.Equal(t, "Workflow Lint", lintStep.Name)
+	assert.Equal(t, workflowLintCommand, lintStep.Command)
+
+	validation, err := m.ValidateFix(context.Background(), fix)
+	require.NoError(t, err)
+	assert.False(t, validation.Valid)
+	assert.Equal(t, []string{`.github/workflows/ci.yml:1: unknown event "pushh" in on`}, validation.Errors)
+}